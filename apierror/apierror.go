@@ -0,0 +1,116 @@
+// Package apierror defines the errors the API responds with: a catalog of
+// machine-readable codes, each with its HTTP status, and the JSON envelope
+// every error response is sent in.
+package apierror
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"triplink/backend/tracing"
+)
+
+// Error is an error with a code of the catalog, shaped like
+// services.TrackingError. Services return it, or errors convertible to it,
+// for failures clients can act on.
+type Error struct {
+	Code    Code
+	Message string
+	// Extra information for the client, sent as is in the envelope
+	Details interface{}
+	// Underlying error, logged but not sent to the client
+	Err error
+}
+
+// New creates an error with a code and a message for the client
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Newf creates an error with a code and a formatted message
+func Newf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap creates an error with a code and a message for the client, keeping the
+// error that caused it
+func Wrap(code Code, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+// WithDetails returns a copy of the error with details for the client
+func (e *Error) WithDetails(details interface{}) *Error {
+	clone := *e
+	clone.Details = details
+	return &clone
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("[%s] %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("[%s] %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status returns the HTTP status the error is responded with
+func (e *Error) Status() int {
+	return Status(e.Code)
+}
+
+// Coder is implemented by errors of other packages that carry a code of the
+// catalog, like services.TrackingError
+type Coder interface {
+	APIError() *Error
+}
+
+// From converts any error to an API error. Errors without a code are internal
+// errors, whose message isn't sent to the client since it may reveal
+// implementation details.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var coder Coder
+	if errors.As(err, &coder) {
+		return coder.APIError()
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return &Error{Code: CodeForStatus(fiberErr.Code), Message: fiberErr.Message, Err: err}
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &Error{Code: CodeNotFound, Message: "Not found", Err: err}
+	}
+	return &Error{Code: CodeInternal, Message: "Internal server error", Err: err}
+}
+
+// Envelope is the JSON body of every error response. Error is the message,
+// kept under the name clients have always read it from.
+type Envelope struct {
+	Error   string      `json:"error"`
+	Code    Code        `json:"code"`
+	Details interface{} `json:"details,omitempty"`
+	TraceID string      `json:"trace_id,omitempty"`
+}
+
+// Respond sends an error in the envelope, with the status of its code and the
+// ID of the request's trace
+func Respond(c *fiber.Ctx, err error) error {
+	apiErr := From(err)
+	if apiErr.Err != nil && apiErr.Status() >= 500 {
+		tracing.Logf(c.UserContext(), "%s %s failed: %v", c.Method(), c.Path(), apiErr.Err)
+	}
+	return c.Status(apiErr.Status()).JSON(Envelope{
+		Error:   apiErr.Message,
+		Code:    apiErr.Code,
+		Details: apiErr.Details,
+		TraceID: tracing.TraceID(c.UserContext()),
+	})
+}
@@ -0,0 +1,145 @@
+package apierror
+
+// Code is a machine-readable error code, stable across releases so clients
+// can act on it instead of on the wording of the message
+type Code string
+
+// General codes, one for each error status the API responds with
+const (
+	CodeBadRequest         Code = "BAD_REQUEST"
+	CodeUnauthorized       Code = "UNAUTHORIZED"
+	CodePaymentRequired    Code = "PAYMENT_REQUIRED"
+	CodeForbidden          Code = "FORBIDDEN"
+	CodeNotFound           Code = "NOT_FOUND"
+	CodeMethodNotAllowed   Code = "METHOD_NOT_ALLOWED"
+	CodeConflict           Code = "CONFLICT"
+	CodeGone               Code = "GONE"
+	CodePayloadTooLarge    Code = "PAYLOAD_TOO_LARGE"
+	CodeUnsupportedMedia   Code = "UNSUPPORTED_MEDIA_TYPE"
+	CodeValidationFailed   Code = "VALIDATION_FAILED"
+	CodeRateLimited        Code = "RATE_LIMITED"
+	CodeInternal           Code = "INTERNAL_ERROR"
+	CodeNotImplemented     Code = "NOT_IMPLEMENTED"
+	CodeBadGateway         Code = "BAD_GATEWAY"
+	CodeServiceUnavailable Code = "SERVICE_UNAVAILABLE"
+	CodeGatewayTimeout     Code = "GATEWAY_TIMEOUT"
+)
+
+// Tracking codes, those of services.TrackingError
+const (
+	CodeInvalidCoordinates       Code = "INVALID_COORDINATES"
+	CodeInvalidAltitude          Code = "INVALID_ALTITUDE"
+	CodeInvalidSpeed             Code = "INVALID_SPEED"
+	CodeInvalidHeading           Code = "INVALID_HEADING"
+	CodeInvalidAccuracy          Code = "INVALID_ACCURACY"
+	CodeInvalidBatteryLevel      Code = "INVALID_BATTERY_LEVEL"
+	CodeInvalidSpeedLimit        Code = "INVALID_SPEED_LIMIT"
+	CodeInvalidTimestamp         Code = "INVALID_TIMESTAMP"
+	CodeInvalidSource            Code = "INVALID_SOURCE"
+	CodeInvalidStatusTransition  Code = "INVALID_STATUS_TRANSITION"
+	CodeStatusConflict           Code = "STATUS_CONFLICT"
+	CodeTrackingDisabled         Code = "TRACKING_DISABLED"
+	CodeTrackingArchived         Code = "TRACKING_ARCHIVED"
+	CodeTrackingConsentWithdrawn Code = "TRACKING_CONSENT_WITHDRAWN"
+	CodeUpdateFailedAfterRetries Code = "UPDATE_FAILED_AFTER_RETRIES"
+)
+
+// Scheduling codes, those of services.ScheduleConflictError
+const (
+	CodeDriverUnavailable   Code = "DRIVER_UNAVAILABLE"
+	CodeDriverDoubleBooked  Code = "DRIVER_DOUBLE_BOOKED"
+	CodeVehicleDoubleBooked Code = "VEHICLE_DOUBLE_BOOKED"
+)
+
+// Entry describes a code of the catalog
+type Entry struct {
+	Code        Code   `json:"code"`
+	Status      int    `json:"status"`
+	Description string `json:"description"`
+}
+
+// generalCatalog has the general codes, each with the status it's returned
+// with
+var generalCatalog = []Entry{
+	{CodeBadRequest, 400, "The request is malformed, e.g. a path parameter isn't a number"},
+	{CodeUnauthorized, 401, "The request isn't authenticated"},
+	{CodePaymentRequired, 402, "The action requires a paid plan or a settled balance"},
+	{CodeForbidden, 403, "The current user isn't allowed to do this"},
+	{CodeNotFound, 404, "The resource doesn't exist or isn't visible to the current user"},
+	{CodeMethodNotAllowed, 405, "The method isn't supported on this path"},
+	{CodeConflict, 409, "The request conflicts with the current state of the resource"},
+	{CodeGone, 410, "The resource existed but was removed"},
+	{CodePayloadTooLarge, 413, "The request body is too large"},
+	{CodeUnsupportedMedia, 415, "The request body has an unsupported content type"},
+	{CodeValidationFailed, 422, "Fields of the request body are invalid, as listed in fields"},
+	{CodeRateLimited, 429, "Too many requests, retry after the Retry-After header"},
+	{CodeInternal, 500, "An unexpected error, reported with the trace ID"},
+	{CodeNotImplemented, 501, "The feature isn't available on this deployment"},
+	{CodeBadGateway, 502, "A provider the API depends on failed"},
+	{CodeServiceUnavailable, 503, "The API or a provider it depends on is unavailable, retry later"},
+	{CodeGatewayTimeout, 504, "A provider the API depends on timed out"},
+}
+
+var trackingCatalog = []Entry{
+	{CodeInvalidCoordinates, 422, "The latitude or longitude is out of range"},
+	{CodeInvalidAltitude, 422, "The altitude is out of a reasonable range"},
+	{CodeInvalidSpeed, 422, "The speed is out of a reasonable range"},
+	{CodeInvalidHeading, 422, "The heading isn't between 0 and 359 degrees"},
+	{CodeInvalidAccuracy, 422, "The GPS accuracy is out of a reasonable range"},
+	{CodeInvalidBatteryLevel, 422, "The battery level isn't between 0 and 100 percent"},
+	{CodeInvalidSpeedLimit, 422, "The speed limit is out of a reasonable range"},
+	{CodeInvalidTimestamp, 422, "The position's timestamp is in the future"},
+	{CodeInvalidSource, 422, "The location source isn't one of GPS, MANUAL, ESTIMATED, NETWORK or PASSIVE"},
+	{CodeInvalidStatusTransition, 409, "The trip or load can't move from its current status to the one requested"},
+	{CodeStatusConflict, 409, "The status was changed by another request since the version sent, reload it and retry"},
+	{CodeTrackingDisabled, 409, "Tracking of the trip is paused"},
+	{CodeTrackingArchived, 409, "The trip's tracking data was archived"},
+	{CodeTrackingConsentWithdrawn, 409, "The carrier withdrew consent to tracking the trip"},
+	{CodeUpdateFailedAfterRetries, 503, "The location couldn't be stored, retry later"},
+}
+
+var schedulingCatalog = []Entry{
+	{CodeDriverUnavailable, 409, "The driver is off shift or on time off during the trip"},
+	{CodeDriverDoubleBooked, 409, "The driver is assigned to another trip at the same time"},
+	{CodeVehicleDoubleBooked, 409, "The vehicle is booked on another trip at the same time"},
+}
+
+// catalog lists every code the API responds with
+var catalog = append(append(append([]Entry{}, generalCatalog...), trackingCatalog...), schedulingCatalog...)
+
+var statuses = func() map[Code]int {
+	statuses := make(map[Code]int, len(catalog))
+	for _, entry := range catalog {
+		statuses[entry.Code] = entry.Status
+	}
+	return statuses
+}()
+
+// Catalog returns every error code the API responds with
+func Catalog() []Entry {
+	entries := make([]Entry, len(catalog))
+	copy(entries, catalog)
+	return entries
+}
+
+// Status returns the HTTP status of a code, 500 for codes not in the catalog
+func Status(code Code) int {
+	if status, ok := statuses[code]; ok {
+		return status
+	}
+	return 500
+}
+
+// CodeForStatus returns the general code of an HTTP status, for errors
+// responded with a status but no code
+func CodeForStatus(status int) Code {
+	for _, entry := range generalCatalog {
+		if entry.Status == status {
+			return entry.Code
+		}
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
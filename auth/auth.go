@@ -9,6 +9,14 @@ import (
 
 const SecretKey = "secret"
 
+// AccountCheck, when set, is called with the user ID of every authenticated
+// request. An error rejects the request, e.g. for a suspended account.
+var AccountCheck func(userID uint) error
+
+// AccountRole, when set, returns the stored role of a user. RequireRole then
+// checks it rather than the role claim, which lasts as long as the token.
+var AccountRole func(userID uint) (string, error)
+
 func GenerateJWT(userID uint, role string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
@@ -21,36 +29,92 @@ func GenerateJWT(userID uint, role string) (string, error) {
 	return token.SignedString([]byte(SecretKey))
 }
 
-func Middleware() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		var tokenString string
+// requestClaims returns the claims of the request's bearer token or jwt
+// cookie, or false when there is no valid token
+func requestClaims(c *fiber.Ctx) (jwt.MapClaims, bool) {
+	authHeader := c.Get("Authorization")
+	var tokenString string
 
-		if authHeader != "" && len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-			tokenString = authHeader[7:]
-		} else {
-			tokenString = c.Cookies("jwt")
-		}
+	if authHeader != "" && len(authHeader) > 7 && authHeader[:7] == "Bearer " {
+		tokenString = authHeader[7:]
+	} else {
+		tokenString = c.Cookies("jwt")
+	}
 
-		if tokenString == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"message": "unauthenticated",
-			})
-		}
+	if tokenString == "" {
+		return nil, false
+	}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(SecretKey), nil
-		})
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(SecretKey), nil
+	})
+
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+
+	return token.Claims.(jwt.MapClaims), true
+}
+
+// RequestUserID returns the user ID of a request's valid token without
+// rejecting requests that have none, e.g. for middleware running before auth
+func RequestUserID(c *fiber.Ctx) (uint, bool) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return 0, false
+	}
+	userID, ok := claims["user_id"].(float64)
+	return uint(userID), ok
+}
 
-		if err != nil || !token.Valid {
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := requestClaims(c)
+		if !ok {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"message": "unauthenticated",
 			})
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
 		c.Locals("user_id", claims["user_id"])
+		c.Locals("role", claims["role"])
+
+		if AccountCheck != nil {
+			if userID, ok := claims["user_id"].(float64); ok {
+				if err := AccountCheck(uint(userID)); err != nil {
+					return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+						"message": err.Error(),
+					})
+				}
+			}
+		}
 
 		return c.Next()
 	}
 }
+
+// RequireRole only lets through requests of users with one of the roles.
+// It must run after Middleware.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		if AccountRole != nil {
+			userID, _ := c.Locals("user_id").(float64)
+			stored, err := AccountRole(uint(userID))
+			if err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"message": "forbidden",
+				})
+			}
+			role = stored
+		}
+		for _, allowed := range roles {
+			if role == allowed {
+				return c.Next()
+			}
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "forbidden",
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"triplink/backend/database"
+	"triplink/backend/database/migrations"
+)
+
+// Migrate applies and rolls back the versioned database migrations.
+//
+// Usage:
+//
+//	go run ./cmd/migrate up           apply every pending migration
+//	go run ./cmd/migrate up <id>      apply the migrations up to and including id
+//	go run ./cmd/migrate down         roll back the last applied migration
+//	go run ./cmd/migrate down <id>    roll back the migrations applied after id
+//	go run ./cmd/migrate status       list the migrations and whether they are applied
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: migrate up [id] | down [id] | status")
+	}
+	flag.Parse()
+
+	command, target := flag.Arg(0), flag.Arg(1)
+	if command == "" || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db := database.Connect()
+	migrator := migrations.New(db)
+
+	switch command {
+	case "up":
+		var err error
+		if target == "" {
+			err = migrator.Migrate()
+		} else {
+			err = migrator.MigrateTo(target)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		log.Println("Database is up to date")
+	case "down":
+		var err error
+		if target == "" {
+			err = migrator.RollbackLast()
+		} else {
+			err = migrator.RollbackTo(target)
+		}
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+		log.Println("Rollback complete")
+	case "status":
+		status, err := migrations.Status(db)
+		if err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+		for _, migration := range status {
+			state := "pending"
+			if migration.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%-8s %s\n", state, migration.ID)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
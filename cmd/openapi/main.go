@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"triplink/backend/internal/openapi"
+)
+
+// OpenAPI generates docs/openapi.json from the routes and the annotations of
+// their handlers, and reports where the annotations disagree with the routes.
+//
+// Usage:
+//
+//	go run ./cmd/openapi            write docs/openapi.json
+//	go run ./cmd/openapi -check     fail if docs/openapi.json is out of date
+func main() {
+	root := flag.String("root", ".", "root of the backend source")
+	output := flag.String("o", "docs/openapi.json", "file to write the spec to")
+	check := flag.Bool("check", false, "fail if the spec file is out of date instead of writing it")
+	flag.Parse()
+
+	doc, warnings, err := openapi.Generate(*root)
+	if err != nil {
+		log.Fatalf("Failed to generate the OpenAPI spec: %v", err)
+	}
+	for _, warning := range warnings {
+		log.Printf("Warning: %s", warning)
+	}
+
+	spec, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode the OpenAPI spec: %v", err)
+	}
+	spec = append(spec, '\n')
+
+	if *check {
+		current, err := os.ReadFile(*output)
+		if err != nil || !bytes.Equal(current, spec) {
+			log.Fatalf("%s is out of date, run go run ./cmd/openapi", *output)
+		}
+		fmt.Printf("%s is up to date\n", *output)
+		return
+	}
+	if err := os.WriteFile(*output, spec, 0644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *output, err)
+	}
+	fmt.Printf("Wrote %d paths to %s\n", len(doc.Paths), *output)
+}
@@ -0,0 +1,600 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// GeneratorConfig controls how much data the generator creates
+type GeneratorConfig struct {
+	Carriers        int
+	Shippers        int
+	TripsPerCarrier int
+	LoadsPerTrip    int
+	TrackingPoints  int
+	RandomSeed      int64
+}
+
+// Generator creates realistic, interconnected fixture data
+type Generator struct {
+	db     *gorm.DB
+	config GeneratorConfig
+	rand   *rand.Rand
+
+	carriers []models.User
+	shippers []models.User
+	vehicles map[uint][]models.Vehicle
+	counts   map[string]int
+}
+
+// city is a seed location used to build plausible routes
+type city struct {
+	Name    string
+	State   string
+	Country string
+	Lat     float64
+	Lng     float64
+}
+
+var seedCities = []city{
+	{"New York", "NY", "US", 40.7128, -74.0060},
+	{"Boston", "MA", "US", 42.3601, -71.0589},
+	{"Philadelphia", "PA", "US", 39.9526, -75.1652},
+	{"Washington", "DC", "US", 38.9072, -77.0369},
+	{"Chicago", "IL", "US", 41.8781, -87.6298},
+	{"Detroit", "MI", "US", 42.3314, -83.0458},
+	{"Atlanta", "GA", "US", 33.7490, -84.3880},
+	{"Dallas", "TX", "US", 32.7767, -96.7970},
+	{"Houston", "TX", "US", 29.7604, -95.3698},
+	{"Denver", "CO", "US", 39.7392, -104.9903},
+	{"Phoenix", "AZ", "US", 33.4484, -112.0740},
+	{"Los Angeles", "CA", "US", 34.0522, -118.2437},
+	{"Toronto", "ON", "CA", 43.6532, -79.3832},
+	{"Monterrey", "NL", "MX", 25.6866, -100.3161},
+}
+
+var (
+	seedFirstNames   = []string{"James", "Maria", "Robert", "Linda", "Michael", "Sarah", "David", "Aisha", "Daniel", "Chen", "Tendai", "Sofia"}
+	seedLastNames    = []string{"Smith", "Garcia", "Johnson", "Brown", "Moyo", "Nguyen", "Miller", "Davis", "Lopez", "Wilson", "Okafor", "Kim"}
+	seedVehicleMakes = []struct{ Make, Model string }{{"Volvo", "VNL 860"}, {"Freightliner", "Cascadia"}, {"Kenworth", "T680"}, {"Peterbilt", "579"}, {"Isuzu", "NPR"}}
+	seedVehicleTypes = []string{"FLATBED", "REEFER", "DRY_VAN", "TANKER", "BOX_TRUCK"}
+	seedCategories   = []string{"ELECTRONICS", "MACHINERY", "FOOD", "TEXTILES", "FURNITURE", "CHEMICALS"}
+	seedReviewText   = []string{"Great service, arrived on time.", "Driver was professional and careful.", "Slight delay but good communication.", "Cargo arrived damaged, not happy.", "Smooth pickup and delivery."}
+)
+
+// NewGenerator creates a new fixture generator
+func NewGenerator(db *gorm.DB, config GeneratorConfig) *Generator {
+	return &Generator{
+		db:       db,
+		config:   config,
+		rand:     rand.New(rand.NewSource(config.RandomSeed)),
+		vehicles: make(map[uint][]models.Vehicle),
+		counts:   make(map[string]int),
+	}
+}
+
+// Reset removes all rows from the tables populated by the generator
+func (g *Generator) Reset() error {
+	tables := []string{
+		"tracking_events", "tracking_statuses", "tracking_records",
+		"notification_deliveries", "notifications", "reviews", "transactions",
+		"quotes", "customs_documents", "loads", "manifests", "trips",
+		"vehicles", "notification_preferences", "notification_tokens", "messages", "users",
+	}
+	for _, table := range tables {
+		if err := g.db.Exec("DELETE FROM " + table).Error; err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// Run generates all fixture data and returns a summary of created rows
+func (g *Generator) Run() ([]string, error) {
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"users", g.createUsers},
+		{"vehicles", g.createVehicles},
+		{"trips", g.createTrips},
+	}
+
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", step.name, err)
+		}
+	}
+
+	var summary []string
+	for _, entity := range []string{"users", "vehicles", "trips", "tracking_records", "tracking_events", "loads", "quotes", "transactions", "reviews", "notifications"} {
+		summary = append(summary, fmt.Sprintf("%-18s %d", entity, g.counts[entity]))
+	}
+	return summary, nil
+}
+
+func (g *Generator) createUsers() error {
+	// Every seeded account shares the same password to make logging in easy
+	password, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	admin := g.newUser("ADMIN", 0, string(password))
+	if err := g.create(&admin, "users"); err != nil {
+		return err
+	}
+
+	for i := 0; i < g.config.Carriers; i++ {
+		user := g.newUser("CARRIER", i, string(password))
+		user.CompanyName = fmt.Sprintf("%s Freight Lines", user.LastName)
+		user.IsVerified = g.rand.Float64() < 0.8
+		expiry := time.Now().AddDate(1+g.rand.Intn(3), 0, 0)
+		user.LicenseNumber = fmt.Sprintf("CDL-%07d", g.rand.Intn(10000000))
+		user.LicenseExpiry = &expiry
+		if err := g.create(&user, "users"); err != nil {
+			return err
+		}
+		g.carriers = append(g.carriers, user)
+	}
+
+	for i := 0; i < g.config.Shippers; i++ {
+		user := g.newUser("SHIPPER", i, string(password))
+		user.CompanyName = fmt.Sprintf("%s Trading Co", user.LastName)
+		if err := g.create(&user, "users"); err != nil {
+			return err
+		}
+		g.shippers = append(g.shippers, user)
+	}
+
+	return nil
+}
+
+func (g *Generator) newUser(role string, index int, password string) models.User {
+	home := g.randomCity()
+	firstName := seedFirstNames[g.rand.Intn(len(seedFirstNames))]
+	lastName := seedLastNames[g.rand.Intn(len(seedLastNames))]
+
+	return models.User{
+		Email:     fmt.Sprintf("%s%d@seed.triplink.dev", strings.ToLower(role), index+1),
+		Phone:     fmt.Sprintf("+1555%07d", g.rand.Intn(10000000)),
+		Password:  password,
+		Role:      role,
+		FirstName: firstName,
+		LastName:  lastName,
+		City:      home.Name,
+		State:     home.State,
+		Country:   home.Country,
+	}
+}
+
+func (g *Generator) createVehicles() error {
+	for _, carrier := range g.carriers {
+		count := 1 + g.rand.Intn(2)
+		for i := 0; i < count; i++ {
+			kind := seedVehicleMakes[g.rand.Intn(len(seedVehicleMakes))]
+			vehicleType := seedVehicleTypes[g.rand.Intn(len(seedVehicleTypes))]
+			insuranceExpiry := time.Now().AddDate(0, 1+g.rand.Intn(12), 0)
+
+			vehicle := models.Vehicle{
+				UserID:            carrier.ID,
+				Make:              kind.Make,
+				Model:             kind.Model,
+				Year:              2015 + g.rand.Intn(10),
+				LicensePlate:      fmt.Sprintf("SEED-%d-%d", carrier.ID, i+1),
+				VIN:               fmt.Sprintf("1SEED%06d%06d", carrier.ID, i+1),
+				VehicleType:       vehicleType,
+				LoadCapacityKg:    float64(8000 + g.rand.Intn(16000)),
+				LoadCapacityM3:    float64(40 + g.rand.Intn(50)),
+				IsRefrigerated:    vehicleType == "REEFER",
+				IsHazmatCertified: vehicleType == "TANKER" || g.rand.Float64() < 0.1,
+				InsuranceExpiry:   &insuranceExpiry,
+				IsActive:          true,
+			}
+			if err := g.create(&vehicle, "vehicles"); err != nil {
+				return err
+			}
+			g.vehicles[carrier.ID] = append(g.vehicles[carrier.ID], vehicle)
+		}
+	}
+	return nil
+}
+
+func (g *Generator) createTrips() error {
+	statuses := []string{"PLANNED", "ACTIVE", "IN_TRANSIT", "IN_TRANSIT", "COMPLETED", "COMPLETED", "COMPLETED", "CANCELLED"}
+
+	for _, carrier := range g.carriers {
+		vehicles := g.vehicles[carrier.ID]
+		for i := 0; i < g.config.TripsPerCarrier; i++ {
+			vehicle := vehicles[g.rand.Intn(len(vehicles))]
+			origin, destination := g.randomRoute()
+			status := statuses[g.rand.Intn(len(statuses))]
+
+			distance := geo.Distance(origin.Lat, origin.Lng, destination.Lat, destination.Lng)
+			duration := time.Duration(distance/65*float64(time.Hour)) + 2*time.Hour
+
+			departure := g.departureFor(status, duration)
+			trip := models.Trip{
+				UserID:              carrier.ID,
+				VehicleID:           vehicle.ID,
+				OriginCity:          origin.Name,
+				OriginState:         origin.State,
+				OriginCountry:       origin.Country,
+				OriginAddress:       fmt.Sprintf("%d Depot Rd, %s", 100+g.rand.Intn(900), origin.Name),
+				OriginLat:           origin.Lat,
+				OriginLng:           origin.Lng,
+				DestinationCity:     destination.Name,
+				DestinationState:    destination.State,
+				DestinationCountry:  destination.Country,
+				DestinationAddress:  fmt.Sprintf("%d Terminal Ave, %s", 100+g.rand.Intn(900), destination.Name),
+				DestinationLat:      destination.Lat,
+				DestinationLng:      destination.Lng,
+				DepartureDate:       departure,
+				EstimatedArrival:    departure.Add(duration),
+				TotalCapacityWeight: vehicle.LoadCapacityKg,
+				TotalCapacityVolume: vehicle.LoadCapacityM3,
+				BasePrice:           math.Round(distance * (1.2 + g.rand.Float64())),
+				PricePerKg:          0.05 + g.rand.Float64()*0.1,
+				PricePerCubicMeter:  8 + g.rand.Float64()*10,
+				Status:              status,
+				IsPublic:            true,
+				TrackingEnabled:     true,
+			}
+
+			if status != "PLANNED" && status != "CANCELLED" {
+				trip.ActualDeparture = &departure
+			}
+			if status == "COMPLETED" {
+				// Roughly a third of completed trips arrive late
+				arrival := trip.EstimatedArrival.Add(time.Duration(g.rand.Intn(240)-160) * time.Minute)
+				trip.ActualArrival = &arrival
+			}
+
+			if err := g.create(&trip, "trips"); err != nil {
+				return err
+			}
+
+			if err := g.createTracking(&trip, duration); err != nil {
+				return err
+			}
+			if err := g.createLoads(&trip); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// departureFor picks a departure time consistent with the trip status
+func (g *Generator) departureFor(status string, duration time.Duration) time.Time {
+	now := time.Now()
+	switch status {
+	case "PLANNED", "CANCELLED":
+		return now.Add(time.Duration(12+g.rand.Intn(24*14)) * time.Hour)
+	case "ACTIVE":
+		return now.Add(-time.Duration(g.rand.Intn(60)) * time.Minute)
+	case "IN_TRANSIT":
+		return now.Add(-time.Duration(g.rand.Float64() * float64(duration)))
+	default:
+		return now.Add(-duration - time.Duration(24+g.rand.Intn(24*60))*time.Hour)
+	}
+}
+
+// createTracking generates a tracking trace along the straight line between
+// origin and destination with some GPS noise
+func (g *Generator) createTracking(trip *models.Trip, duration time.Duration) error {
+	if trip.ActualDeparture == nil || g.config.TrackingPoints < 2 {
+		return nil
+	}
+
+	progress := 1.0
+	if trip.Status != "COMPLETED" {
+		progress = math.Min(time.Since(*trip.ActualDeparture).Seconds()/duration.Seconds(), 0.95)
+	}
+
+	points := int(math.Max(2, float64(g.config.TrackingPoints)*progress))
+	interval := time.Duration(float64(duration) * progress / float64(points-1))
+
+	var last models.TrackingRecord
+	for i := 0; i < points; i++ {
+		fraction := progress * float64(i) / float64(points-1)
+		speed := 55 + g.rand.Float64()*40
+		heading := math.Mod(math.Atan2(trip.DestinationLng-trip.OriginLng, trip.DestinationLat-trip.OriginLat)*180/math.Pi+360, 360)
+		accuracy := 3 + g.rand.Float64()*12
+
+		record := models.TrackingRecord{
+			TripID:    trip.ID,
+			Latitude:  trip.OriginLat + (trip.DestinationLat-trip.OriginLat)*fraction + g.jitter(),
+			Longitude: trip.OriginLng + (trip.DestinationLng-trip.OriginLng)*fraction + g.jitter(),
+			Speed:     &speed,
+			Heading:   &heading,
+			Accuracy:  &accuracy,
+			Timestamp: trip.ActualDeparture.Add(time.Duration(i) * interval),
+			Source:    "GPS",
+			Status:    "ACTIVE",
+		}
+		if err := g.create(&record, "tracking_records"); err != nil {
+			return err
+		}
+		last = record
+	}
+
+	updates := map[string]interface{}{
+		"current_latitude":     last.Latitude,
+		"current_longitude":    last.Longitude,
+		"last_location_update": last.Timestamp,
+	}
+	if err := g.db.Model(trip).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	departureEvent := models.TrackingEvent{
+		TripID:      trip.ID,
+		EventType:   "DEPARTURE",
+		EventData:   `{"from":"PLANNED","to":"IN_TRANSIT"}`,
+		Location:    trip.OriginCity,
+		Latitude:    &trip.OriginLat,
+		Longitude:   &trip.OriginLng,
+		Timestamp:   *trip.ActualDeparture,
+		Description: "Departed from " + trip.OriginCity,
+	}
+	if err := g.create(&departureEvent, "tracking_events"); err != nil {
+		return err
+	}
+
+	if trip.ActualArrival != nil {
+		arrivalEvent := models.TrackingEvent{
+			TripID:      trip.ID,
+			EventType:   "ARRIVAL",
+			EventData:   `{"from":"IN_TRANSIT","to":"COMPLETED"}`,
+			Location:    trip.DestinationCity,
+			Latitude:    &trip.DestinationLat,
+			Longitude:   &trip.DestinationLng,
+			Timestamp:   *trip.ActualArrival,
+			Description: "Arrived at " + trip.DestinationCity,
+		}
+		if err := g.create(&arrivalEvent, "tracking_events"); err != nil {
+			return err
+		}
+	}
+
+	status := models.TrackingStatus{
+		TripID:            trip.ID,
+		CurrentStatus:     trip.Status,
+		PreviousStatus:    "PLANNED",
+		StatusChangedAt:   *trip.ActualDeparture,
+		EstimatedArrival:  &trip.EstimatedArrival,
+		CompletionPercent: math.Round(progress * 100),
+	}
+	return g.db.Create(&status).Error
+}
+
+// createLoads books shipper loads on a trip and creates the related quotes,
+// transactions, reviews and notifications
+func (g *Generator) createLoads(trip *models.Trip) error {
+	if len(g.shippers) == 0 || g.config.LoadsPerTrip < 1 {
+		return nil
+	}
+
+	loadStatus := map[string]string{
+		"PLANNED":    "BOOKED",
+		"ACTIVE":     "PICKED_UP",
+		"IN_TRANSIT": "IN_TRANSIT",
+		"COMPLETED":  "DELIVERED",
+		"CANCELLED":  "CANCELLED",
+	}[trip.Status]
+
+	count := 1 + g.rand.Intn(g.config.LoadsPerTrip)
+	usedWeight, usedVolume := 0.0, 0.0
+
+	for i := 0; i < count; i++ {
+		shipper := g.shippers[g.rand.Intn(len(g.shippers))]
+		weight := float64(200 + g.rand.Intn(3000))
+		length, width, height := 1+g.rand.Float64()*3, 1+g.rand.Float64()*1.4, 1+g.rand.Float64()*1.5
+		volume := math.Round(length*width*height*100) / 100
+
+		if usedWeight+weight > trip.TotalCapacityWeight || usedVolume+volume > trip.TotalCapacityVolume {
+			break
+		}
+		usedWeight += weight
+		usedVolume += volume
+
+		category := seedCategories[g.rand.Intn(len(seedCategories))]
+		price := math.Round(trip.BasePrice/float64(count) + weight*trip.PricePerKg + volume*trip.PricePerCubicMeter)
+
+		load := models.Load{
+			TripID:                trip.ID,
+			ShipperID:             shipper.ID,
+			BookingReference:      fmt.Sprintf("SEED-%d-%d", trip.ID, i+1),
+			Description:           fmt.Sprintf("%s shipment for %s", category, shipper.CompanyName),
+			Category:              category,
+			Quantity:              1 + g.rand.Intn(20),
+			Weight:                weight,
+			Length:                length,
+			Width:                 width,
+			Height:                height,
+			Volume:                volume,
+			Value:                 math.Round(weight * (5 + g.rand.Float64()*50)),
+			Currency:              "USD",
+			PickupAddress:         trip.OriginAddress,
+			PickupCity:            trip.OriginCity,
+			PickupState:           trip.OriginState,
+			PickupCountry:         trip.OriginCountry,
+			PickupLat:             trip.OriginLat,
+			PickupLng:             trip.OriginLng,
+			DeliveryAddress:       trip.DestinationAddress,
+			DeliveryCity:          trip.DestinationCity,
+			DeliveryState:         trip.DestinationState,
+			DeliveryCountry:       trip.DestinationCountry,
+			DeliveryLat:           trip.DestinationLat,
+			DeliveryLng:           trip.DestinationLng,
+			RequestedPickupDate:   trip.DepartureDate,
+			RequestedDeliveryDate: trip.EstimatedArrival,
+			IsFragile:             category == "ELECTRONICS",
+			IsHazmat:              category == "CHEMICALS",
+			RequiresRefrigeration: category == "FOOD" && g.rand.Float64() < 0.5,
+			AgreedPrice:           price,
+			Status:                loadStatus,
+		}
+		if trip.ActualDeparture != nil {
+			load.ActualPickupDate = trip.ActualDeparture
+		}
+		if trip.ActualArrival != nil {
+			load.ActualDeliveryDate = trip.ActualArrival
+		}
+		if err := g.create(&load, "loads"); err != nil {
+			return err
+		}
+
+		if err := g.createQuotes(trip, &load); err != nil {
+			return err
+		}
+		if err := g.createLoadFollowUps(trip, &load, shipper); err != nil {
+			return err
+		}
+	}
+
+	return g.db.Model(trip).Updates(map[string]interface{}{
+		"used_weight": usedWeight,
+		"used_volume": usedVolume,
+	}).Error
+}
+
+// createQuotes creates the accepted quote from the trip carrier plus a few
+// competing quotes from other carriers
+func (g *Generator) createQuotes(trip *models.Trip, load *models.Load) error {
+	acceptedAt := trip.DepartureDate.Add(-48 * time.Hour)
+	accepted := models.Quote{
+		LoadID:       load.ID,
+		CarrierID:    trip.UserID,
+		QuoteAmount:  load.AgreedPrice,
+		Currency:     "USD",
+		ValidUntil:   trip.DepartureDate,
+		PickupDate:   trip.DepartureDate,
+		DeliveryDate: trip.EstimatedArrival,
+		Status:       "ACCEPTED",
+		AcceptedAt:   &acceptedAt,
+	}
+	if err := g.create(&accepted, "quotes"); err != nil {
+		return err
+	}
+
+	competitors := g.rand.Intn(3)
+	for i := 0; i < competitors && len(g.carriers) > 1; i++ {
+		carrier := g.carriers[g.rand.Intn(len(g.carriers))]
+		if carrier.ID == trip.UserID {
+			continue
+		}
+		quote := models.Quote{
+			LoadID:       load.ID,
+			CarrierID:    carrier.ID,
+			QuoteAmount:  math.Round(load.AgreedPrice * (1.05 + g.rand.Float64()*0.3)),
+			Currency:     "USD",
+			ValidUntil:   trip.DepartureDate,
+			PickupDate:   trip.DepartureDate,
+			DeliveryDate: trip.EstimatedArrival.Add(time.Duration(g.rand.Intn(12)) * time.Hour),
+			Status:       "REJECTED",
+		}
+		if err := g.create(&quote, "quotes"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createLoadFollowUps creates the payment, review and notifications that
+// follow a load through its lifecycle
+func (g *Generator) createLoadFollowUps(trip *models.Trip, load *models.Load, shipper models.User) error {
+	notification := models.Notification{
+		UserID:    shipper.ID,
+		Title:     "Load Booked",
+		Message:   fmt.Sprintf("Your load %s has been booked from %s to %s", load.BookingReference, trip.OriginCity, trip.DestinationCity),
+		Type:      "LOAD_BOOKED",
+		IsRead:    trip.Status == "COMPLETED",
+		RelatedID: load.ID,
+	}
+	if err := g.create(&notification, "notifications"); err != nil {
+		return err
+	}
+
+	if load.Status != "DELIVERED" {
+		return nil
+	}
+
+	processedAt := *load.ActualDeliveryDate
+	transaction := models.Transaction{
+		LoadID:         load.ID,
+		PayerID:        shipper.ID,
+		PayeeID:        trip.UserID,
+		Amount:         load.AgreedPrice,
+		Currency:       "USD",
+		PlatformFee:    math.Round(load.AgreedPrice*0.05*100) / 100,
+		PaymentMethod:  "CARD",
+		PaymentGateway: "STRIPE",
+		GatewayTxnID:   fmt.Sprintf("seed_txn_%d", load.ID),
+		Status:         "COMPLETED",
+		ProcessedAt:    &processedAt,
+	}
+	if err := g.create(&transaction, "transactions"); err != nil {
+		return err
+	}
+
+	if g.rand.Float64() < 0.7 {
+		review := models.Review{
+			ReviewerID: shipper.ID,
+			RevieweeID: trip.UserID,
+			LoadID:     load.ID,
+			Rating:     2 + g.rand.Intn(4),
+			Comment:    seedReviewText[g.rand.Intn(len(seedReviewText))],
+			ReviewType: "SHIPPER_TO_CARRIER",
+		}
+		if err := g.create(&review, "reviews"); err != nil {
+			return err
+		}
+	}
+
+	delivered := models.Notification{
+		UserID:    shipper.ID,
+		Title:     "Load Delivered",
+		Message:   fmt.Sprintf("Your load %s was delivered in %s", load.BookingReference, trip.DestinationCity),
+		Type:      "LOAD_DELIVERED",
+		IsRead:    g.rand.Float64() < 0.5,
+		RelatedID: load.ID,
+	}
+	return g.create(&delivered, "notifications")
+}
+
+// create inserts a record and tracks the count for the summary
+func (g *Generator) create(value interface{}, entity string) error {
+	if err := g.db.Create(value).Error; err != nil {
+		return err
+	}
+	g.counts[entity]++
+	return nil
+}
+
+func (g *Generator) randomCity() city {
+	return seedCities[g.rand.Intn(len(seedCities))]
+}
+
+func (g *Generator) randomRoute() (city, city) {
+	origin := g.randomCity()
+	destination := g.randomCity()
+	for destination.Name == origin.Name {
+		destination = g.randomCity()
+	}
+	return origin, destination
+}
+
+// jitter returns GPS noise of roughly +/- 500 meters in degrees
+func (g *Generator) jitter() float64 {
+	return (g.rand.Float64() - 0.5) * 0.01
+}
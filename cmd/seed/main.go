@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+	"triplink/backend/database"
+	"triplink/backend/database/migrations"
+)
+
+// Seed generates interconnected fixture data for local development and
+// integration tests.
+//
+// Usage:
+//
+//	go run ./cmd/seed -scale 2 -random-seed 42
+func main() {
+	scale := flag.Int("scale", 1, "multiplier applied to every entity count")
+	carriers := flag.Int("carriers", 5, "number of carrier users per scale unit")
+	shippers := flag.Int("shippers", 10, "number of shipper users per scale unit")
+	tripsPerCarrier := flag.Int("trips-per-carrier", 4, "number of trips generated for each carrier")
+	loadsPerTrip := flag.Int("loads-per-trip", 3, "maximum number of loads booked on each trip")
+	trackingPoints := flag.Int("tracking-points", 40, "number of tracking records per started trip")
+	randomSeed := flag.Int64("random-seed", time.Now().UnixNano(), "seed for the random generator, fix it for reproducible data")
+	reset := flag.Bool("reset", false, "delete existing data before seeding")
+	flag.Parse()
+
+	if *scale < 1 {
+		log.Fatal("scale must be at least 1")
+	}
+
+	db := database.Connect()
+	pending, err := migrations.Pending(db)
+	if err != nil {
+		log.Fatalf("Failed to check database migrations: %v", err)
+	}
+	if len(pending) > 0 {
+		log.Fatalf("Database has %d pending migrations, run go run ./cmd/migrate up first", len(pending))
+	}
+
+	generator := NewGenerator(db, GeneratorConfig{
+		Carriers:        *carriers * *scale,
+		Shippers:        *shippers * *scale,
+		TripsPerCarrier: *tripsPerCarrier,
+		LoadsPerTrip:    *loadsPerTrip,
+		TrackingPoints:  *trackingPoints,
+		RandomSeed:      *randomSeed,
+	})
+
+	if *reset {
+		if err := generator.Reset(); err != nil {
+			log.Fatalf("Failed to reset database: %v", err)
+		}
+	}
+
+	summary, err := generator.Run()
+	if err != nil {
+		log.Fatalf("Seeding failed: %v", err)
+	}
+
+	log.Printf("Seeding complete (random seed %d)", *randomSeed)
+	for _, line := range summary {
+		log.Println(line)
+	}
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// AlertConfig holds the thresholds of delay alerts and tracking anomalies.
+// They can be changed by reloading the configuration file.
+type AlertConfig struct {
+	// Delays in minutes at which shippers are alerted, once each
+	DelayThresholds []int
+
+	// Speeds above this are flagged
+	SpeedLimitKmh float64
+
+	// Changes of speed between consecutive positions above this are flagged
+	SpeedChangeKmh float64
+
+	// Speeds implied by consecutive positions above this are flagged as
+	// impossible for ground transport
+	ImpossibleSpeedKmh float64
+
+	// Trips without a location update for this long are flagged
+	UpdateGap time.Duration
+}
+
+// GetAlertConfig returns alert configuration from environment variables
+func GetAlertConfig() *AlertConfig {
+	return &AlertConfig{
+		DelayThresholds:    parseDelayThresholds(getEnvString("ALERT_DELAY_THRESHOLDS", "30,60,120,240")),
+		SpeedLimitKmh:      getEnvFloat("ALERT_SPEED_LIMIT_KMH", 120),
+		SpeedChangeKmh:     getEnvFloat("ALERT_SPEED_CHANGE_KMH", 50),
+		ImpossibleSpeedKmh: getEnvFloat("ALERT_IMPOSSIBLE_SPEED_KMH", 200),
+		UpdateGap:          getEnvDuration("ALERT_UPDATE_GAP", 4*time.Hour),
+	}
+}
+
+// ValidateAlertConfig validates alert configuration
+func (ac *AlertConfig) ValidateAlertConfig() error {
+	if len(ac.DelayThresholds) == 0 {
+		return fmt.Errorf("At least one delay alert threshold is required")
+	}
+	for _, minutes := range ac.DelayThresholds {
+		if minutes <= 0 {
+			return fmt.Errorf("Delay alert thresholds must be positive")
+		}
+	}
+	if ac.SpeedLimitKmh <= 0 || ac.SpeedChangeKmh <= 0 || ac.ImpossibleSpeedKmh <= 0 {
+		return fmt.Errorf("Anomaly speed thresholds must be positive")
+	}
+	if ac.ImpossibleSpeedKmh < ac.SpeedLimitKmh {
+		return fmt.Errorf("Impossible speed can't be below the speed limit")
+	}
+	if ac.UpdateGap <= 0 {
+		return fmt.Errorf("Update gap must be positive")
+	}
+	return nil
+}
+
+// parseDelayThresholds parses a comma separated list of minutes, sorted
+// ascending. Invalid entries are skipped.
+func parseDelayThresholds(value string) []int {
+	var minutes []int
+	for _, part := range strings.Split(value, ",") {
+		if m, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			minutes = append(minutes, m)
+		}
+	}
+	sort.Ints(minutes)
+	return minutes
+}
+
+// currentAlertConfig holds the alert settings as of the last load or reload
+var currentAlertConfig atomic.Pointer[AlertConfig]
+
+// CurrentAlertConfig returns the alert settings in effect. Unlike the other
+// settings, they follow reloads of the configuration file.
+func CurrentAlertConfig() *AlertConfig {
+	if cfg := currentAlertConfig.Load(); cfg != nil {
+		return cfg
+	}
+	cfg := GetAlertConfig()
+	currentAlertConfig.CompareAndSwap(nil, cfg)
+	return currentAlertConfig.Load()
+}
+
+func storeAlertConfig(cfg *AlertConfig) {
+	currentAlertConfig.Store(cfg)
+}
+
+// Environment configuration template for alert thresholds
+const AlertEnvTemplate = `
+# Delay Alerts and Tracking Anomalies (reloaded on SIGHUP)
+ALERT_DELAY_THRESHOLDS=30,60,120,240
+ALERT_SPEED_LIMIT_KMH=120
+ALERT_SPEED_CHANGE_KMH=50
+ALERT_IMPOSSIBLE_SPEED_KMH=200
+ALERT_UPDATE_GAP=4h
+`
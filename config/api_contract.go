@@ -0,0 +1,23 @@
+package config
+
+// APIContractConfig holds settings for checking API calls against the
+// OpenAPI spec in docs/openapi.json
+type APIContractConfig struct {
+	// Reject requests and responses that don't match the spec. Meant for
+	// development and tests, where a mismatch should fail loudly rather than
+	// reach clients.
+	Validate bool
+}
+
+// GetAPIContractConfig returns API contract configuration from environment variables
+func GetAPIContractConfig() *APIContractConfig {
+	return &APIContractConfig{
+		Validate: getEnvBool("API_CONTRACT_VALIDATION", false),
+	}
+}
+
+// Environment configuration template for API contract validation
+const APIContractEnvTemplate = `
+# API Contract, enable in development
+API_CONTRACT_VALIDATION=false
+`
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// APIKeysConfig holds the keys of the external APIs. Features backed by an
+// API without a key fall back or are unavailable, unless the key is listed
+// as required, in which case the API refuses to start without it.
+type APIKeysConfig struct {
+	GoogleMaps     string
+	HERE           string
+	OpenWeatherMap string
+	TollGuru       string
+	GasBuddy       string
+	DOT            string
+	HuggingFace    string
+
+	// Names of the keys that must be set, e.g. GOOGLE_MAPS_API_KEY
+	Required []string
+}
+
+// GetAPIKeysConfig returns external API keys from environment variables
+func GetAPIKeysConfig() *APIKeysConfig {
+	return &APIKeysConfig{
+		GoogleMaps:     getEnvString("GOOGLE_MAPS_API_KEY", ""),
+		HERE:           getEnvString("HERE_API_KEY", ""),
+		OpenWeatherMap: getEnvString("OPENWEATHERMAP_API_KEY", ""),
+		TollGuru:       getEnvString("TOLLGURU_API_KEY", ""),
+		GasBuddy:       getEnvString("GASBUDDY_API_KEY", ""),
+		DOT:            getEnvString("DOT_API_KEY", ""),
+		HuggingFace:    getEnvString("HUGGINGFACE_API_KEY", ""),
+		Required:       parseList(getEnvString("REQUIRED_API_KEYS", "")),
+	}
+}
+
+// keys returns the API keys by setting name
+func (ac *APIKeysConfig) keys() map[string]string {
+	return map[string]string{
+		"GOOGLE_MAPS_API_KEY":    ac.GoogleMaps,
+		"HERE_API_KEY":           ac.HERE,
+		"OPENWEATHERMAP_API_KEY": ac.OpenWeatherMap,
+		"TOLLGURU_API_KEY":       ac.TollGuru,
+		"GASBUDDY_API_KEY":       ac.GasBuddy,
+		"DOT_API_KEY":            ac.DOT,
+		"HUGGINGFACE_API_KEY":    ac.HuggingFace,
+	}
+}
+
+// ValidateAPIKeysConfig validates that the required API keys are set
+func (ac *APIKeysConfig) ValidateAPIKeysConfig() error {
+	keys := ac.keys()
+	var missing []string
+	for _, name := range ac.Required {
+		key, known := keys[name]
+		if !known {
+			return fmt.Errorf("Unknown required API key: %s", name)
+		}
+		if key == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Required API keys are missing: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Environment configuration template for external API keys
+const APIKeysEnvTemplate = `
+# External API Keys
+GOOGLE_MAPS_API_KEY=
+HERE_API_KEY=
+OPENWEATHERMAP_API_KEY=
+TOLLGURU_API_KEY=
+GASBUDDY_API_KEY=
+DOT_API_KEY=
+HUGGINGFACE_API_KEY=
+# Comma separated keys the API refuses to start without
+REQUIRED_API_KEYS=
+`
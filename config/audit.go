@@ -0,0 +1,44 @@
+package config
+
+import (
+	"strings"
+)
+
+// AuditConfig holds settings for the audit log of mutating API calls
+type AuditConfig struct {
+	Enabled bool
+
+	// Paths of calls that aren't audited, matched as path prefixes where *
+	// matches a single segment. Covers POST endpoints that only compute
+	// results and high-volume location updates already kept as tracking data.
+	SkipPaths []string
+}
+
+// GetAuditConfig returns audit log configuration from environment variables
+func GetAuditConfig() *AuditConfig {
+	return &AuditConfig{
+		Enabled:   getEnvBool("AUDIT_ENABLED", true),
+		SkipPaths: parseList(getEnvString("AUDIT_SKIP_PATHS", defaultAuditSkipPaths)),
+	}
+}
+
+const defaultAuditSkipPaths = "/api/login,/api/analytics,/api/graphql,/api/route-optimization,/api/external,/api/ml," +
+	"/api/tracking/trips/*/location,/api/integrations/trips/*/location,/api/telematics/webhooks,/api/mobile/trips/*/sync"
+
+// parseList parses a comma separated list, skipping empty entries
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Environment configuration template for the audit log
+const AuditEnvTemplate = `
+# Audit Log
+AUDIT_ENABLED=true
+AUDIT_SKIP_PATHS=/api/login,/api/analytics,/api/graphql,/api/route-optimization,/api/external,/api/ml,/api/tracking/trips/*/location,/api/integrations/trips/*/location,/api/telematics/webhooks,/api/mobile/trips/*/sync
+`
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// AutoStatusConfig holds the rules for changing trip statuses from their
+// tracking data. Trips become ACTIVE when they start moving after their
+// departure time and AT_DELIVERY when they enter the destination geofence,
+// whose radius is the detention geofence radius. Completion is only
+// suggested to the carrier.
+type AutoStatusConfig struct {
+	Enabled bool
+
+	// A trip is moving when it reports at least this speed, or when it is
+	// this far from its previous position
+	MovingSpeedKmh       float64
+	MovingDistanceMeters float64
+
+	// Time stopped at the destination before completion is suggested
+	CompletionDwell time.Duration
+}
+
+// GetAutoStatusConfig returns automatic trip status configuration from environment variables
+func GetAutoStatusConfig() *AutoStatusConfig {
+	return &AutoStatusConfig{
+		Enabled:              getEnvBool("AUTO_STATUS_ENABLED", true),
+		MovingSpeedKmh:       getEnvFloat("AUTO_STATUS_MOVING_SPEED_KMH", 5),
+		MovingDistanceMeters: getEnvFloat("AUTO_STATUS_MOVING_DISTANCE_METERS", 200),
+		CompletionDwell:      getEnvDuration("AUTO_STATUS_COMPLETION_DWELL", 30*time.Minute),
+	}
+}
+
+// ValidateAutoStatusConfig validates automatic trip status configuration
+func (ac *AutoStatusConfig) ValidateAutoStatusConfig() error {
+	if !ac.Enabled {
+		return nil
+	}
+	if ac.MovingSpeedKmh <= 0 || ac.MovingDistanceMeters <= 0 {
+		return fmt.Errorf("Moving speed and distance must be positive")
+	}
+	if ac.CompletionDwell <= 0 {
+		return fmt.Errorf("Completion dwell time must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for automatic trip statuses
+const AutoStatusEnvTemplate = `
+# Trip statuses from tracking data
+AUTO_STATUS_ENABLED=true
+AUTO_STATUS_MOVING_SPEED_KMH=5
+AUTO_STATUS_MOVING_DISTANCE_METERS=200
+AUTO_STATUS_COMPLETION_DWELL=30m
+`
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// CircuitBreakerConfig holds settings for the circuit breakers that stop
+// calling an external API provider while it is failing
+type CircuitBreakerConfig struct {
+	// Consecutive failures after which a provider's circuit opens
+	FailureThreshold int
+
+	// How long an open circuit fails fast before a trial call is let through
+	OpenTimeout time.Duration
+
+	// Longest a routing provider call may take before counting as a failure
+	CallTimeout time.Duration
+
+	// Routing providers in order of preference, tried in turn before falling
+	// back to straight-line estimates (HERE, GOOGLE_MAPS)
+	RoutingProviders []string
+}
+
+// GetCircuitBreakerConfig returns circuit breaker configuration from environment variables
+func GetCircuitBreakerConfig() *CircuitBreakerConfig {
+	return &CircuitBreakerConfig{
+		FailureThreshold: getEnvInt("CIRCUIT_BREAKER_FAILURE_THRESHOLD", 5),
+		OpenTimeout:      getEnvDuration("CIRCUIT_BREAKER_OPEN_TIMEOUT", 30*time.Second),
+		CallTimeout:      getEnvDuration("CIRCUIT_BREAKER_CALL_TIMEOUT", 5*time.Second),
+		RoutingProviders: parseList(getEnvString("ROUTING_PROVIDER_ORDER", "HERE,GOOGLE_MAPS")),
+	}
+}
+
+// ValidateCircuitBreakerConfig validates circuit breaker configuration
+func (cc *CircuitBreakerConfig) ValidateCircuitBreakerConfig() error {
+	if cc.FailureThreshold <= 0 {
+		return fmt.Errorf("Circuit breaker failure threshold must be positive")
+	}
+	if cc.OpenTimeout <= 0 || cc.CallTimeout <= 0 {
+		return fmt.Errorf("Circuit breaker timeouts must be positive")
+	}
+	for _, provider := range cc.RoutingProviders {
+		if provider != "HERE" && provider != "GOOGLE_MAPS" {
+			return fmt.Errorf("Unknown routing provider %s", provider)
+		}
+	}
+	return nil
+}
+
+// Environment configuration template for circuit breakers
+const CircuitBreakerEnvTemplate = `
+# External API Circuit Breakers
+CIRCUIT_BREAKER_FAILURE_THRESHOLD=5
+CIRCUIT_BREAKER_OPEN_TIMEOUT=30s
+CIRCUIT_BREAKER_CALL_TIMEOUT=5s
+ROUTING_PROVIDER_ORDER=HERE,GOOGLE_MAPS
+`
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CurrencyConfig holds settings for exchange rates and the currency that
+// amounts are normalized to
+type CurrencyConfig struct {
+	// Currency that quotes and payments are normalized to and analytics
+	// aggregate in
+	BaseCurrency string
+
+	// Exchange rate provider (ECB, OPENEXCHANGERATES)
+	RateProvider string
+
+	// European Central Bank daily reference rates, no key needed
+	ECBRatesURL string
+
+	// Open Exchange Rates settings
+	OpenExchangeRatesAppID string
+	OpenExchangeRatesURL   string
+
+	// How long fetched rates are used before being refreshed. Stale rates are
+	// still used while the provider is unavailable.
+	RateCacheTTL time.Duration
+	HTTPTimeout  time.Duration
+}
+
+// GetCurrencyConfig returns currency configuration from environment variables
+func GetCurrencyConfig() *CurrencyConfig {
+	return &CurrencyConfig{
+		BaseCurrency:           strings.ToUpper(getEnvString("BASE_CURRENCY", "USD")),
+		RateProvider:           strings.ToUpper(getEnvString("EXCHANGE_RATE_PROVIDER", "ECB")),
+		ECBRatesURL:            getEnvString("ECB_RATES_URL", "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"),
+		OpenExchangeRatesAppID: getEnvString("OPENEXCHANGERATES_APP_ID", ""),
+		OpenExchangeRatesURL:   getEnvString("OPENEXCHANGERATES_URL", "https://openexchangerates.org/api"),
+		RateCacheTTL:           getEnvDuration("EXCHANGE_RATE_CACHE_TTL", 6*time.Hour),
+		HTTPTimeout:            getEnvDuration("EXCHANGE_RATE_HTTP_TIMEOUT", 10*time.Second),
+	}
+}
+
+// ValidateCurrencyConfig validates currency configuration
+func (cc *CurrencyConfig) ValidateCurrencyConfig() error {
+	if len(cc.BaseCurrency) != 3 {
+		return fmt.Errorf("Base currency must be a 3 letter ISO 4217 code")
+	}
+	switch cc.RateProvider {
+	case "ECB":
+	case "OPENEXCHANGERATES":
+		if cc.OpenExchangeRatesAppID == "" {
+			return fmt.Errorf("Open Exchange Rates app ID is required when it is the rate provider")
+		}
+	default:
+		return fmt.Errorf("Unknown exchange rate provider %s", cc.RateProvider)
+	}
+	if cc.RateCacheTTL <= 0 || cc.HTTPTimeout <= 0 {
+		return fmt.Errorf("Exchange rate cache TTL and HTTP timeout must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for currencies
+const CurrencyEnvTemplate = `
+# Currencies and exchange rates
+BASE_CURRENCY=USD
+EXCHANGE_RATE_PROVIDER=ECB
+ECB_RATES_URL=https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml
+OPENEXCHANGERATES_APP_ID=
+OPENEXCHANGERATES_URL=https://openexchangerates.org/api
+EXCHANGE_RATE_CACHE_TTL=6h
+EXCHANGE_RATE_HTTP_TIMEOUT=10s
+`
@@ -0,0 +1,21 @@
+package config
+
+// DatabaseConfig holds settings for schema management at startup
+type DatabaseConfig struct {
+	// Apply pending migrations when the API starts instead of refusing to
+	// start. Meant for development; production runs cmd/migrate.
+	AutoMigrate bool
+}
+
+// GetDatabaseConfig returns database configuration from environment variables
+func GetDatabaseConfig() *DatabaseConfig {
+	return &DatabaseConfig{
+		AutoMigrate: getEnvBool("DB_AUTO_MIGRATE", false),
+	}
+}
+
+// Environment configuration template for the database
+const DatabaseEnvTemplate = `
+# Database
+DB_AUTO_MIGRATE=false
+`
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DelayModelConfig holds settings for the delay prediction model trained on
+// completed trips
+type DelayModelConfig struct {
+	// How often upcoming trips are predicted, and how old the model may get
+	// before it is trained again on the trips completed since
+	Interval        time.Duration
+	RetrainInterval time.Duration
+
+	// Trips departing within this period are predicted by the scheduled job
+	PredictionHorizon time.Duration
+
+	// The model is only trained on at least this many completed trips, and
+	// on no more than the most recent MaxTrainingTrips
+	MinTrainingTrips int
+	MaxTrainingTrips int
+
+	// Share of the most recent training trips held out to measure the
+	// model's error before it is trained on all of them
+	HoldoutFraction float64
+
+	// Ridge penalty on the standardized coefficients
+	Regularization float64
+
+	// Lane and carrier delay histories are averaged with the overall mean
+	// delay as if it were this many more trips, so that a few trips don't
+	// dominate
+	SmoothingTrips float64
+}
+
+// GetDelayModelConfig returns delay model configuration from environment variables
+func GetDelayModelConfig() *DelayModelConfig {
+	return &DelayModelConfig{
+		Interval:          getEnvDuration("DELAY_MODEL_INTERVAL", 1*time.Hour),
+		RetrainInterval:   getEnvDuration("DELAY_MODEL_RETRAIN_INTERVAL", 24*time.Hour),
+		PredictionHorizon: getEnvDuration("DELAY_MODEL_PREDICTION_HORIZON", 24*time.Hour),
+		MinTrainingTrips:  getEnvInt("DELAY_MODEL_MIN_TRAINING_TRIPS", 50),
+		MaxTrainingTrips:  getEnvInt("DELAY_MODEL_MAX_TRAINING_TRIPS", 20000),
+		HoldoutFraction:   getEnvFloat("DELAY_MODEL_HOLDOUT_FRACTION", 0.2),
+		Regularization:    getEnvFloat("DELAY_MODEL_REGULARIZATION", 1),
+		SmoothingTrips:    getEnvFloat("DELAY_MODEL_SMOOTHING_TRIPS", 5),
+	}
+}
+
+// ValidateDelayModelConfig validates delay model configuration
+func (dc *DelayModelConfig) ValidateDelayModelConfig() error {
+	if dc.Interval <= 0 || dc.RetrainInterval <= 0 {
+		return fmt.Errorf("Intervals must be positive")
+	}
+	if dc.PredictionHorizon <= 0 {
+		return fmt.Errorf("Prediction horizon must be positive")
+	}
+	if dc.MinTrainingTrips <= 0 {
+		return fmt.Errorf("Min training trips must be positive")
+	}
+	if dc.MaxTrainingTrips < dc.MinTrainingTrips {
+		return fmt.Errorf("Max training trips cannot be less than min training trips")
+	}
+	if dc.HoldoutFraction < 0 || dc.HoldoutFraction >= 1 {
+		return fmt.Errorf("Holdout fraction must be at least 0 and less than 1")
+	}
+	if dc.Regularization < 0 {
+		return fmt.Errorf("Regularization cannot be negative")
+	}
+	if dc.SmoothingTrips < 0 {
+		return fmt.Errorf("Smoothing trips cannot be negative")
+	}
+	return nil
+}
+
+// Environment configuration template for the delay model
+const DelayModelEnvTemplate = `
+# Delay Prediction Model
+DELAY_MODEL_INTERVAL=1h
+DELAY_MODEL_RETRAIN_INTERVAL=24h
+DELAY_MODEL_PREDICTION_HORIZON=24h
+DELAY_MODEL_MIN_TRAINING_TRIPS=50
+DELAY_MODEL_MAX_TRAINING_TRIPS=20000
+DELAY_MODEL_HOLDOUT_FRACTION=0.2
+DELAY_MODEL_REGULARIZATION=1
+DELAY_MODEL_SMOOTHING_TRIPS=5
+`
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DetentionConfig holds settings for dwell time tracking at pickup and
+// delivery stops, and for drivers checking in at them
+type DetentionConfig struct {
+	// Radius around a stop within which a vehicle is at the stop
+	GeofenceRadiusKm float64
+
+	// How far from a stop drivers can check in at it or out of it
+	CheckInToleranceKm float64
+
+	// Time at a stop before detention starts
+	FreeTime time.Duration
+
+	// Charge per hour of detention, in the load's currency. Detention is
+	// only charged when AutoCharge is enabled.
+	HourlyRate float64
+	AutoCharge bool
+}
+
+// GetDetentionConfig returns detention configuration from environment variables
+func GetDetentionConfig() *DetentionConfig {
+	return &DetentionConfig{
+		GeofenceRadiusKm:   getEnvFloat("DETENTION_GEOFENCE_RADIUS_KM", 0.5),
+		CheckInToleranceKm: getEnvFloat("STOP_CHECK_IN_TOLERANCE_KM", 1),
+		FreeTime:           getEnvDuration("DETENTION_FREE_TIME", 2*time.Hour),
+		HourlyRate:         getEnvFloat("DETENTION_HOURLY_RATE", 50),
+		AutoCharge:         getEnvBool("DETENTION_AUTO_CHARGE", false),
+	}
+}
+
+// ValidateDetentionConfig validates detention configuration
+func (dc *DetentionConfig) ValidateDetentionConfig() error {
+	if dc.GeofenceRadiusKm <= 0 || dc.GeofenceRadiusKm > 10 {
+		return fmt.Errorf("Detention geofence radius must be between 0 and 10 km")
+	}
+	if dc.CheckInToleranceKm <= 0 {
+		return fmt.Errorf("Stop check-in tolerance must be positive")
+	}
+	if dc.FreeTime < 0 {
+		return fmt.Errorf("Detention free time cannot be negative")
+	}
+	if dc.HourlyRate < 0 {
+		return fmt.Errorf("Detention hourly rate cannot be negative")
+	}
+	return nil
+}
+
+// Environment configuration template for detention
+const DetentionEnvTemplate = `
+# Detention
+DETENTION_GEOFENCE_RADIUS_KM=0.5
+STOP_CHECK_IN_TOLERANCE_KM=1
+DETENTION_FREE_TIME=2h
+DETENTION_HOURLY_RATE=50
+DETENTION_AUTO_CHARGE=false
+`
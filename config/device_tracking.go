@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DeviceTrackingConfig holds the rules for the tracking settings recommended
+// to driver devices as speed, distance to the next stop and battery change
+type DeviceTrackingConfig struct {
+	// Bounds of the update interval while moving, which aims for a
+	// position every TargetSpacingMeters at the current speed
+	MinInterval         time.Duration
+	MaxInterval         time.Duration
+	TargetSpacingMeters float64
+
+	// Interval when the speed isn't known yet
+	DefaultInterval time.Duration
+
+	// Slower than this the vehicle counts as stationary
+	StationarySpeedKmh float64
+	StationaryInterval time.Duration
+
+	// Within this distance of the next stop updates are frequent and
+	// accurate, so arrival and departure are detected promptly
+	ApproachDistanceKm float64
+	ApproachInterval   time.Duration
+
+	// Battery levels, in percent, at which tracking slows down, is kept to
+	// a minimum and stops
+	LowBatteryPercent      float64
+	CriticalBatteryPercent float64
+	StopTrackingPercent    float64
+}
+
+// GetDeviceTrackingConfig returns device tracking configuration from environment variables
+func GetDeviceTrackingConfig() *DeviceTrackingConfig {
+	return &DeviceTrackingConfig{
+		MinInterval:            getEnvDuration("DEVICE_TRACKING_MIN_INTERVAL", 15*time.Second),
+		MaxInterval:            getEnvDuration("DEVICE_TRACKING_MAX_INTERVAL", 2*time.Minute),
+		TargetSpacingMeters:    getEnvFloat("DEVICE_TRACKING_TARGET_SPACING_METERS", 500),
+		DefaultInterval:        getEnvDuration("DEVICE_TRACKING_DEFAULT_INTERVAL", time.Minute),
+		StationarySpeedKmh:     getEnvFloat("DEVICE_TRACKING_STATIONARY_SPEED_KMH", 5),
+		StationaryInterval:     getEnvDuration("DEVICE_TRACKING_STATIONARY_INTERVAL", 5*time.Minute),
+		ApproachDistanceKm:     getEnvFloat("DEVICE_TRACKING_APPROACH_DISTANCE_KM", 2),
+		ApproachInterval:       getEnvDuration("DEVICE_TRACKING_APPROACH_INTERVAL", 10*time.Second),
+		LowBatteryPercent:      getEnvFloat("DEVICE_TRACKING_LOW_BATTERY_PERCENT", 20),
+		CriticalBatteryPercent: getEnvFloat("DEVICE_TRACKING_CRITICAL_BATTERY_PERCENT", 10),
+		StopTrackingPercent:    getEnvFloat("DEVICE_TRACKING_STOP_BATTERY_PERCENT", 5),
+	}
+}
+
+// ValidateDeviceTrackingConfig validates device tracking configuration
+func (dc *DeviceTrackingConfig) ValidateDeviceTrackingConfig() error {
+	if dc.MinInterval <= 0 || dc.MaxInterval < dc.MinInterval {
+		return fmt.Errorf("Device tracking intervals must be positive, with the maximum at least the minimum")
+	}
+	if dc.DefaultInterval <= 0 || dc.StationaryInterval <= 0 || dc.ApproachInterval <= 0 {
+		return fmt.Errorf("Device tracking intervals must be positive")
+	}
+	if dc.TargetSpacingMeters <= 0 {
+		return fmt.Errorf("Device tracking target spacing must be positive")
+	}
+	if dc.StopTrackingPercent > dc.CriticalBatteryPercent || dc.CriticalBatteryPercent > dc.LowBatteryPercent || dc.LowBatteryPercent > 100 {
+		return fmt.Errorf("Battery thresholds must increase from stop tracking to critical to low, up to 100%%")
+	}
+	return nil
+}
+
+// Environment configuration template for device tracking
+const DeviceTrackingEnvTemplate = `
+# Adaptive Device Tracking Settings
+DEVICE_TRACKING_MIN_INTERVAL=15s
+DEVICE_TRACKING_MAX_INTERVAL=2m
+DEVICE_TRACKING_TARGET_SPACING_METERS=500
+DEVICE_TRACKING_DEFAULT_INTERVAL=1m
+DEVICE_TRACKING_STATIONARY_SPEED_KMH=5
+DEVICE_TRACKING_STATIONARY_INTERVAL=5m
+DEVICE_TRACKING_APPROACH_DISTANCE_KM=2
+DEVICE_TRACKING_APPROACH_INTERVAL=10s
+DEVICE_TRACKING_LOW_BATTERY_PERCENT=20
+DEVICE_TRACKING_CRITICAL_BATTERY_PERCENT=10
+DEVICE_TRACKING_STOP_BATTERY_PERCENT=5
+`
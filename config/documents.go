@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DocumentConfig holds settings for document uploads such as licenses,
+// insurance certificates and customs paperwork
+type DocumentConfig struct {
+	// Content types accepted, detected from the uploaded file
+	AllowedContentTypes []string
+
+	// Maximum size of a document in bytes
+	MaxSize int64
+
+	// How long presigned upload and download URLs stay valid
+	URLExpiry time.Duration
+
+	// Address of a clamd daemon (host:port) scanning uploads for viruses.
+	// Scanning is disabled when empty.
+	ClamAVAddress string
+	ClamAVTimeout time.Duration
+}
+
+// GetDocumentConfig returns document upload configuration from environment variables
+func GetDocumentConfig() *DocumentConfig {
+	return &DocumentConfig{
+		AllowedContentTypes: parseList(getEnvString("DOCUMENT_ALLOWED_CONTENT_TYPES", "application/pdf,image/jpeg,image/png,image/webp")),
+		MaxSize:             getEnvInt64("DOCUMENT_MAX_SIZE", 20*1024*1024),
+		URLExpiry:           getEnvDuration("DOCUMENT_URL_EXPIRY", 15*time.Minute),
+		ClamAVAddress:       getEnvString("CLAMAV_ADDRESS", ""),
+		ClamAVTimeout:       getEnvDuration("CLAMAV_TIMEOUT", 30*time.Second),
+	}
+}
+
+// ValidateDocumentConfig validates document upload configuration
+func (dc *DocumentConfig) ValidateDocumentConfig() error {
+	if len(dc.AllowedContentTypes) == 0 {
+		return fmt.Errorf("At least one document content type must be allowed")
+	}
+	if dc.MaxSize <= 0 {
+		return fmt.Errorf("Max document size must be positive")
+	}
+	if dc.URLExpiry <= 0 || dc.URLExpiry > 7*24*time.Hour {
+		return fmt.Errorf("Document URL expiry must be between 1s and 7 days")
+	}
+	if dc.ClamAVAddress != "" && dc.ClamAVTimeout <= 0 {
+		return fmt.Errorf("ClamAV timeout must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for document uploads
+const DocumentEnvTemplate = `
+# Document Uploads
+DOCUMENT_ALLOWED_CONTENT_TYPES=application/pdf,image/jpeg,image/png,image/webp
+DOCUMENT_MAX_SIZE=20971520
+DOCUMENT_URL_EXPIRY=15m
+CLAMAV_ADDRESS=
+CLAMAV_TIMEOUT=30s
+`
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DriverScoringConfig holds settings for scoring drivers' safety from their
+// tracking data
+type DriverScoringConfig struct {
+	// Changes of speed faster than these, in m/s², are harsh acceleration
+	// and harsh braking
+	HarshAccelerationMps2 float64
+	HarshBrakingMps2      float64
+
+	// Speeds this far above the limit count as speeding. Positions without a
+	// reported limit are held to the alert speed limit.
+	SpeedingToleranceKmh float64
+
+	// Driving from NightStartHour until NightEndHour in Timezone is night
+	// driving
+	NightStartHour int
+	NightEndHour   int
+	Timezone       string
+
+	// Positions reported below this speed are idling
+	IdleSpeedKmh float64
+
+	// Consecutive positions further apart than this are not scored, as what
+	// happened between them is unknown
+	MaxSampleGap time.Duration
+
+	// Points deducted from 100 per harsh event per 100 km, and per percent of
+	// driving time speeding or at night, or of time idling
+	HarshEventPenalty   float64
+	SpeedingPenalty     float64
+	NightDrivingPenalty float64
+	IdlingPenalty       float64
+
+	// Drivers are only scored on at least this much driving, and training is
+	// recommended below TrainingScore
+	MinDistanceKm float64
+	TrainingScore float64
+
+	// Period scored when none is given
+	DefaultPeriod time.Duration
+}
+
+// GetDriverScoringConfig returns driver scoring configuration from environment variables
+func GetDriverScoringConfig() *DriverScoringConfig {
+	return &DriverScoringConfig{
+		HarshAccelerationMps2: getEnvFloat("DRIVER_SCORING_HARSH_ACCELERATION_MPS2", 3),
+		HarshBrakingMps2:      getEnvFloat("DRIVER_SCORING_HARSH_BRAKING_MPS2", 4),
+		SpeedingToleranceKmh:  getEnvFloat("DRIVER_SCORING_SPEEDING_TOLERANCE_KMH", 5),
+		NightStartHour:        getEnvInt("DRIVER_SCORING_NIGHT_START_HOUR", 22),
+		NightEndHour:          getEnvInt("DRIVER_SCORING_NIGHT_END_HOUR", 5),
+		Timezone:              getEnvString("DRIVER_SCORING_TIMEZONE", "UTC"),
+		IdleSpeedKmh:          getEnvFloat("DRIVER_SCORING_IDLE_SPEED_KMH", 3),
+		MaxSampleGap:          getEnvDuration("DRIVER_SCORING_MAX_SAMPLE_GAP", 2*time.Minute),
+		HarshEventPenalty:     getEnvFloat("DRIVER_SCORING_HARSH_EVENT_PENALTY", 5),
+		SpeedingPenalty:       getEnvFloat("DRIVER_SCORING_SPEEDING_PENALTY", 1),
+		NightDrivingPenalty:   getEnvFloat("DRIVER_SCORING_NIGHT_DRIVING_PENALTY", 0.2),
+		IdlingPenalty:         getEnvFloat("DRIVER_SCORING_IDLING_PENALTY", 0.5),
+		MinDistanceKm:         getEnvFloat("DRIVER_SCORING_MIN_DISTANCE_KM", 50),
+		TrainingScore:         getEnvFloat("DRIVER_SCORING_TRAINING_SCORE", 70),
+		DefaultPeriod:         getEnvDuration("DRIVER_SCORING_DEFAULT_PERIOD", 30*24*time.Hour),
+	}
+}
+
+// ValidateDriverScoringConfig validates driver scoring configuration
+func (dc *DriverScoringConfig) ValidateDriverScoringConfig() error {
+	if dc.HarshAccelerationMps2 <= 0 || dc.HarshBrakingMps2 <= 0 {
+		return fmt.Errorf("Harsh acceleration and braking thresholds must be positive")
+	}
+	if dc.SpeedingToleranceKmh < 0 {
+		return fmt.Errorf("Speeding tolerance cannot be negative")
+	}
+	if dc.NightStartHour < 0 || dc.NightStartHour > 23 || dc.NightEndHour < 0 || dc.NightEndHour > 23 {
+		return fmt.Errorf("Night hours must be between 0 and 23")
+	}
+	if _, err := time.LoadLocation(dc.Timezone); err != nil {
+		return fmt.Errorf("Invalid timezone %q", dc.Timezone)
+	}
+	if dc.IdleSpeedKmh < 0 {
+		return fmt.Errorf("Idle speed cannot be negative")
+	}
+	if dc.MaxSampleGap <= 0 {
+		return fmt.Errorf("Max sample gap must be positive")
+	}
+	if dc.HarshEventPenalty < 0 || dc.SpeedingPenalty < 0 || dc.NightDrivingPenalty < 0 || dc.IdlingPenalty < 0 {
+		return fmt.Errorf("Penalties cannot be negative")
+	}
+	if dc.MinDistanceKm < 0 {
+		return fmt.Errorf("Min distance cannot be negative")
+	}
+	if dc.TrainingScore < 0 || dc.TrainingScore > 100 {
+		return fmt.Errorf("Training score must be between 0 and 100")
+	}
+	if dc.DefaultPeriod <= 0 {
+		return fmt.Errorf("Default period must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for driver scoring
+const DriverScoringEnvTemplate = `
+# Driver Safety Scoring
+DRIVER_SCORING_HARSH_ACCELERATION_MPS2=3
+DRIVER_SCORING_HARSH_BRAKING_MPS2=4
+DRIVER_SCORING_SPEEDING_TOLERANCE_KMH=5
+DRIVER_SCORING_NIGHT_START_HOUR=22
+DRIVER_SCORING_NIGHT_END_HOUR=5
+DRIVER_SCORING_TIMEZONE=UTC
+DRIVER_SCORING_IDLE_SPEED_KMH=3
+DRIVER_SCORING_MAX_SAMPLE_GAP=2m
+DRIVER_SCORING_HARSH_EVENT_PENALTY=5
+DRIVER_SCORING_SPEEDING_PENALTY=1
+DRIVER_SCORING_NIGHT_DRIVING_PENALTY=0.2
+DRIVER_SCORING_IDLING_PENALTY=0.5
+DRIVER_SCORING_MIN_DISTANCE_KM=50
+DRIVER_SCORING_TRAINING_SCORE=70
+DRIVER_SCORING_DEFAULT_PERIOD=720h
+`
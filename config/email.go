@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+)
+
+// EmailConfig holds settings for email notification delivery
+type EmailConfig struct {
+	Enabled  bool
+	Provider string // smtp, sendgrid
+
+	FromAddress string
+	FromName    string
+
+	// SMTP settings
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+
+	// SendGrid settings
+	SendGridAPIKey string
+
+	// Base URL of the web app, used for links in email templates
+	AppBaseURL string
+}
+
+// GetEmailConfig returns email configuration from environment variables
+func GetEmailConfig() *EmailConfig {
+	return &EmailConfig{
+		Enabled:        getEnvBool("EMAIL_ENABLED", false),
+		Provider:       getEnvString("EMAIL_PROVIDER", "smtp"),
+		FromAddress:    getEnvString("EMAIL_FROM_ADDRESS", "notifications@triplink.app"),
+		FromName:       getEnvString("EMAIL_FROM_NAME", "TripLink"),
+		SMTPHost:       getEnvString("SMTP_HOST", "localhost"),
+		SMTPPort:       getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:   getEnvString("SMTP_USERNAME", ""),
+		SMTPPassword:   getEnvString("SMTP_PASSWORD", ""),
+		SendGridAPIKey: getEnvString("SENDGRID_API_KEY", ""),
+		AppBaseURL:     getEnvString("APP_BASE_URL", "https://app.triplink.app"),
+	}
+}
+
+// ValidateEmailConfig validates email configuration
+func (ec *EmailConfig) ValidateEmailConfig() error {
+	if !ec.Enabled {
+		return nil
+	}
+	if ec.FromAddress == "" {
+		return fmt.Errorf("Email from address cannot be empty")
+	}
+	switch ec.Provider {
+	case "smtp":
+		if ec.SMTPHost == "" {
+			return fmt.Errorf("SMTP host cannot be empty")
+		}
+		if ec.SMTPPort <= 0 {
+			return fmt.Errorf("SMTP port must be positive")
+		}
+	case "sendgrid":
+		if ec.SendGridAPIKey == "" {
+			return fmt.Errorf("SendGrid API key cannot be empty")
+		}
+	default:
+		return fmt.Errorf("Unknown email provider: %s", ec.Provider)
+	}
+	return nil
+}
+
+// Environment configuration template for email delivery
+const EmailEnvTemplate = `
+# Email Notifications
+EMAIL_ENABLED=false
+EMAIL_PROVIDER=smtp
+EMAIL_FROM_ADDRESS=notifications@triplink.app
+EMAIL_FROM_NAME=TripLink
+SMTP_HOST=localhost
+SMTP_PORT=587
+SMTP_USERNAME=
+SMTP_PASSWORD=
+SENDGRID_API_KEY=
+APP_BASE_URL=https://app.triplink.app
+`
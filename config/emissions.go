@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EmissionsConfig holds settings for estimating trips' fuel use and CO2
+// emissions
+type EmissionsConfig struct {
+	// Litres of diesel an empty vehicle of each type uses per 100 km, as
+	// comma separated TYPE=litres pairs, and for vehicles of other types
+	ConsumptionByVehicleType map[string]float64
+	DefaultConsumption       float64
+
+	// Extra litres per 100 km for each tonne of payload
+	PayloadConsumption float64
+
+	// Kilograms of CO2 emitted burning a litre of fuel. The default is
+	// diesel's well-to-wheel factor, as used for GLEC reporting.
+	CO2PerLitre float64
+
+	// Trips without tracking are estimated from the distance between their
+	// origin and destination, multiplied by this to account for the road
+	RoadDistanceFactor float64
+}
+
+// GetEmissionsConfig returns emissions configuration from environment variables
+func GetEmissionsConfig() *EmissionsConfig {
+	return &EmissionsConfig{
+		ConsumptionByVehicleType: parseConsumption(getEnvString("EMISSIONS_CONSUMPTION_BY_VEHICLE_TYPE",
+			"FLATBED=33,REEFER=36,DRY_VAN=33,TANKER=35,BOX_TRUCK=20")),
+		DefaultConsumption: getEnvFloat("EMISSIONS_DEFAULT_CONSUMPTION", 30),
+		PayloadConsumption: getEnvFloat("EMISSIONS_PAYLOAD_CONSUMPTION", 0.4),
+		CO2PerLitre:        getEnvFloat("EMISSIONS_CO2_KG_PER_LITRE", 3.17),
+		RoadDistanceFactor: getEnvFloat("EMISSIONS_ROAD_DISTANCE_FACTOR", 1.2),
+	}
+}
+
+// parseConsumption parses comma separated TYPE=litres pairs. Invalid
+// litres are kept as -1 for validation to report.
+func parseConsumption(value string) map[string]float64 {
+	consumption := make(map[string]float64)
+	for _, item := range parseList(value) {
+		vehicleType, litres, ok := strings.Cut(item, "=")
+		if !ok {
+			consumption[strings.TrimSpace(item)] = -1
+			continue
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(litres), 64)
+		if err != nil {
+			parsed = -1
+		}
+		consumption[strings.ToUpper(strings.TrimSpace(vehicleType))] = parsed
+	}
+	return consumption
+}
+
+// Consumption returns the litres per 100 km of an empty vehicle of a type
+func (ec *EmissionsConfig) Consumption(vehicleType string) float64 {
+	if litres, ok := ec.ConsumptionByVehicleType[strings.ToUpper(vehicleType)]; ok {
+		return litres
+	}
+	return ec.DefaultConsumption
+}
+
+// ValidateEmissionsConfig validates emissions configuration
+func (ec *EmissionsConfig) ValidateEmissionsConfig() error {
+	for vehicleType, litres := range ec.ConsumptionByVehicleType {
+		if litres <= 0 {
+			return fmt.Errorf("Fuel consumption of %s vehicles must be positive litres per 100 km", vehicleType)
+		}
+	}
+	if ec.DefaultConsumption <= 0 {
+		return fmt.Errorf("Default fuel consumption must be positive")
+	}
+	if ec.PayloadConsumption < 0 {
+		return fmt.Errorf("Payload fuel consumption cannot be negative")
+	}
+	if ec.CO2PerLitre <= 0 {
+		return fmt.Errorf("CO2 per litre of fuel must be positive")
+	}
+	if ec.RoadDistanceFactor < 1 {
+		return fmt.Errorf("Road distance factor must be at least 1")
+	}
+	return nil
+}
+
+// Environment configuration template for emissions
+const EmissionsEnvTemplate = `
+# Fuel and CO2 Emissions
+EMISSIONS_CONSUMPTION_BY_VEHICLE_TYPE=FLATBED=33,REEFER=36,DRY_VAN=33,TANKER=35,BOX_TRUCK=20
+EMISSIONS_DEFAULT_CONSUMPTION=30
+EMISSIONS_PAYLOAD_CONSUMPTION=0.4
+EMISSIONS_CO2_KG_PER_LITRE=3.17
+EMISSIONS_ROAD_DISTANCE_FACTOR=1.2
+`
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// FeatureFlagConfig holds settings for feature flags
+type FeatureFlagConfig struct {
+	// Flags are cached by each instance and re-read from the database this
+	// often, so a change made through another instance applies within it
+	RefreshInterval time.Duration
+}
+
+// GetFeatureFlagConfig returns feature flag configuration from environment variables
+func GetFeatureFlagConfig() *FeatureFlagConfig {
+	return &FeatureFlagConfig{
+		RefreshInterval: getEnvDuration("FEATURE_FLAG_REFRESH_INTERVAL", 30*time.Second),
+	}
+}
+
+// ValidateFeatureFlagConfig validates feature flag configuration
+func (fc *FeatureFlagConfig) ValidateFeatureFlagConfig() error {
+	if fc.RefreshInterval <= 0 {
+		return fmt.Errorf("Feature flag refresh interval must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for feature flags
+const FeatureFlagEnvTemplate = `
+# Feature Flags
+FEATURE_FLAG_REFRESH_INTERVAL=30s
+`
@@ -0,0 +1,48 @@
+package config
+
+import "fmt"
+
+// FuelPlanConfig holds settings for planning fuel stops along trip routes
+type FuelPlanConfig struct {
+	// Distance between the points of a route that stations are searched
+	// around. The fuel price API finds stations within 10 km of each point.
+	SampleIntervalKm float64
+
+	// Stations further than this off the route aren't considered
+	MaxDetourKm float64
+
+	// Range left in the tank that plans don't count on, unless a request
+	// gives its own
+	ReserveKm float64
+}
+
+// GetFuelPlanConfig returns fuel plan configuration from environment variables
+func GetFuelPlanConfig() *FuelPlanConfig {
+	return &FuelPlanConfig{
+		SampleIntervalKm: getEnvFloat("FUEL_PLAN_SAMPLE_INTERVAL_KM", 20),
+		MaxDetourKm:      getEnvFloat("FUEL_PLAN_MAX_DETOUR_KM", 5),
+		ReserveKm:        getEnvFloat("FUEL_PLAN_RESERVE_KM", 50),
+	}
+}
+
+// ValidateFuelPlanConfig validates fuel plan configuration
+func (fc *FuelPlanConfig) ValidateFuelPlanConfig() error {
+	if fc.SampleIntervalKm <= 0 {
+		return fmt.Errorf("Sample interval must be positive")
+	}
+	if fc.MaxDetourKm <= 0 {
+		return fmt.Errorf("Max detour must be positive")
+	}
+	if fc.ReserveKm < 0 {
+		return fmt.Errorf("Reserve cannot be negative")
+	}
+	return nil
+}
+
+// Environment configuration template for fuel plans
+const FuelPlanEnvTemplate = `
+# Fuel Stop Planning
+FUEL_PLAN_SAMPLE_INTERVAL_KM=20
+FUEL_PLAN_MAX_DETOUR_KM=5
+FUEL_PLAN_RESERVE_KM=50
+`
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// GeocodingConfig holds settings for caching geocoded addresses
+type GeocodingConfig struct {
+	// How long a geocoded address is reused before it is geocoded again
+	CacheTTL time.Duration
+
+	// How long an address that couldn't be geocoded isn't retried
+	FailureCacheTTL time.Duration
+
+	// Addresses geocoded at once when geocoding in bulk
+	BatchConcurrency int
+}
+
+// GetGeocodingConfig returns geocoding configuration from environment variables
+func GetGeocodingConfig() *GeocodingConfig {
+	return &GeocodingConfig{
+		CacheTTL:         getEnvDuration("GEOCODE_CACHE_TTL", 90*24*time.Hour),
+		FailureCacheTTL:  getEnvDuration("GEOCODE_FAILURE_CACHE_TTL", time.Hour),
+		BatchConcurrency: getEnvInt("GEOCODE_BATCH_CONCURRENCY", 5),
+	}
+}
+
+// ValidateGeocodingConfig validates geocoding configuration
+func (gc *GeocodingConfig) ValidateGeocodingConfig() error {
+	if gc.CacheTTL <= 0 {
+		return fmt.Errorf("Geocode cache TTL must be positive")
+	}
+	if gc.FailureCacheTTL < 0 {
+		return fmt.Errorf("Geocode failure cache TTL cannot be negative")
+	}
+	if gc.BatchConcurrency < 1 {
+		return fmt.Errorf("Geocode batch concurrency must be at least 1")
+	}
+	return nil
+}
+
+// Environment configuration template for geocoding
+const GeocodingEnvTemplate = `
+# Geocoding cache
+GEOCODE_CACHE_TTL=2160h
+GEOCODE_FAILURE_CACHE_TTL=1h
+GEOCODE_BATCH_CONCURRENCY=5
+`
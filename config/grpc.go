@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// GRPCConfig holds settings for the gRPC API that telematics devices and
+// gateways stream high-frequency vehicle positions to
+type GRPCConfig struct {
+	Enabled bool
+	Address string
+
+	// Server certificate, and the CA that client certificates must be issued
+	// by. Clients are always required to present a certificate.
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+
+	// Positions of a stream are recorded once this many are buffered, or
+	// once the oldest buffered position has waited for BatchInterval
+	BatchSize     int
+	BatchInterval time.Duration
+}
+
+// GetGRPCConfig returns gRPC configuration from environment variables
+func GetGRPCConfig() *GRPCConfig {
+	return &GRPCConfig{
+		Enabled:       getEnvBool("GRPC_ENABLED", false),
+		Address:       getEnvString("GRPC_ADDRESS", ":9090"),
+		CertFile:      getEnvString("GRPC_TLS_CERT_FILE", ""),
+		KeyFile:       getEnvString("GRPC_TLS_KEY_FILE", ""),
+		ClientCAFile:  getEnvString("GRPC_CLIENT_CA_FILE", ""),
+		BatchSize:     getEnvInt("GRPC_BATCH_SIZE", 500),
+		BatchInterval: getEnvDuration("GRPC_BATCH_INTERVAL", 5*time.Second),
+	}
+}
+
+// ValidateGRPCConfig validates gRPC configuration
+func (gc *GRPCConfig) ValidateGRPCConfig() error {
+	if !gc.Enabled {
+		return nil
+	}
+	if gc.Address == "" {
+		return fmt.Errorf("gRPC address is required")
+	}
+	if gc.CertFile == "" || gc.KeyFile == "" {
+		return fmt.Errorf("gRPC TLS certificate and key are required")
+	}
+	if gc.ClientCAFile == "" {
+		return fmt.Errorf("gRPC client CA is required to authenticate devices")
+	}
+	if gc.BatchSize <= 0 {
+		return fmt.Errorf("gRPC batch size must be positive")
+	}
+	if gc.BatchInterval <= 0 {
+		return fmt.Errorf("gRPC batch interval must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for the gRPC API
+const GRPCEnvTemplate = `
+# gRPC Telematics Ingestion
+GRPC_ENABLED=false
+GRPC_ADDRESS=:9090
+GRPC_TLS_CERT_FILE=/etc/triplink/grpc/server.crt
+GRPC_TLS_KEY_FILE=/etc/triplink/grpc/server.key
+GRPC_CLIENT_CA_FILE=/etc/triplink/grpc/devices-ca.crt
+GRPC_BATCH_SIZE=500
+GRPC_BATCH_INTERVAL=5s
+`
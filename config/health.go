@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// HealthConfig holds settings for the health, readiness and liveness probes
+type HealthConfig struct {
+	// Each dependency check is abandoned after this long
+	CheckTimeout time.Duration
+
+	// Check Redis, and whether the instance is unready while Redis is down.
+	// Caching and rate limiting fall back without Redis, so by default an
+	// outage only degrades the instance.
+	RedisCheckEnabled bool
+	RedisRequired     bool
+
+	// External APIs checked for reachability. They are reported by /healthz
+	// but never make the instance unready.
+	ExternalURLs []string
+}
+
+// GetHealthConfig returns health check configuration from environment variables
+func GetHealthConfig() *HealthConfig {
+	return &HealthConfig{
+		CheckTimeout:      getEnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+		RedisCheckEnabled: getEnvBool("HEALTH_CHECK_REDIS", true),
+		RedisRequired:     getEnvBool("HEALTH_REDIS_REQUIRED", false),
+		ExternalURLs:      parseList(getEnvString("HEALTH_EXTERNAL_URLS", "")),
+	}
+}
+
+// ValidateHealthConfig validates health check configuration
+func (hc *HealthConfig) ValidateHealthConfig() error {
+	if hc.CheckTimeout <= 0 {
+		return fmt.Errorf("Health check timeout must be positive")
+	}
+	if hc.RedisRequired && !hc.RedisCheckEnabled {
+		return fmt.Errorf("Redis can't be required without checking it")
+	}
+	return nil
+}
+
+// Environment configuration template for health checks
+const HealthEnvTemplate = `
+# Health, Readiness and Liveness Probes
+HEALTH_CHECK_TIMEOUT=2s
+HEALTH_CHECK_REDIS=true
+HEALTH_REDIS_REQUIRED=false
+# Comma separated external APIs checked by /healthz
+HEALTH_EXTERNAL_URLS=
+`
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// KafkaConfig holds settings for publishing tracking and status events to
+// Kafka. Events go through the outbox, so they are delivered at least once.
+type KafkaConfig struct {
+	Enabled bool
+
+	// Bootstrap brokers as host:port
+	Brokers  []string
+	ClientID string
+
+	// SASL/PLAIN credentials, used when the username is set
+	Username string
+	Password string
+
+	// Connect over TLS, verifying the brokers with CAFile instead of the
+	// system roots when set
+	TLSEnabled bool
+	CAFile     string
+
+	// json, or avro for Avro single-object encoding
+	Format string
+
+	// Topics of the event types
+	LocationTopic   string
+	TripStatusTopic string
+	LoadTopic       string
+
+	// Record location updates in the outbox for Kafka. They are by far the
+	// most frequent events, so this can be turned off to only publish
+	// status events.
+	PublishLocations bool
+
+	// How long a produce request waits for all in-sync replicas
+	Timeout time.Duration
+}
+
+// GetKafkaConfig returns Kafka configuration from environment variables
+func GetKafkaConfig() *KafkaConfig {
+	return &KafkaConfig{
+		Enabled:          getEnvBool("KAFKA_ENABLED", false),
+		Brokers:          parseList(getEnvString("KAFKA_BROKERS", "localhost:9092")),
+		ClientID:         getEnvString("KAFKA_CLIENT_ID", "triplink"),
+		Username:         getEnvString("KAFKA_USERNAME", ""),
+		Password:         getEnvString("KAFKA_PASSWORD", ""),
+		TLSEnabled:       getEnvBool("KAFKA_TLS_ENABLED", false),
+		CAFile:           getEnvString("KAFKA_CA_FILE", ""),
+		Format:           getEnvString("KAFKA_FORMAT", "json"),
+		LocationTopic:    getEnvString("KAFKA_LOCATION_TOPIC", "triplink.location.updated"),
+		TripStatusTopic:  getEnvString("KAFKA_TRIP_STATUS_TOPIC", "triplink.trip.status.changed"),
+		LoadTopic:        getEnvString("KAFKA_LOAD_TOPIC", "triplink.load.delivered"),
+		PublishLocations: getEnvBool("KAFKA_PUBLISH_LOCATIONS", true),
+		Timeout:          getEnvDuration("KAFKA_TIMEOUT", 10*time.Second),
+	}
+}
+
+// ValidateKafkaConfig validates Kafka configuration
+func (kc *KafkaConfig) ValidateKafkaConfig() error {
+	if !kc.Enabled {
+		return nil
+	}
+	if len(kc.Brokers) == 0 {
+		return fmt.Errorf("Kafka brokers are required")
+	}
+	if kc.Format != "json" && kc.Format != "avro" {
+		return fmt.Errorf("Kafka format must be json or avro")
+	}
+	if kc.LocationTopic == "" || kc.TripStatusTopic == "" || kc.LoadTopic == "" {
+		return fmt.Errorf("Kafka topics are required")
+	}
+	if kc.CAFile != "" && !kc.TLSEnabled {
+		return fmt.Errorf("Kafka CA file requires TLS to be enabled")
+	}
+	if kc.Timeout <= 0 {
+		return fmt.Errorf("Kafka timeout must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for Kafka
+const KafkaEnvTemplate = `
+# Kafka Event Publishing
+KAFKA_ENABLED=false
+KAFKA_BROKERS=localhost:9092
+KAFKA_CLIENT_ID=triplink
+KAFKA_USERNAME=
+KAFKA_PASSWORD=
+KAFKA_TLS_ENABLED=false
+KAFKA_CA_FILE=
+KAFKA_FORMAT=json
+KAFKA_LOCATION_TOPIC=triplink.location.updated
+KAFKA_TRIP_STATUS_TOPIC=triplink.trip.status.changed
+KAFKA_LOAD_TOPIC=triplink.load.delivered
+KAFKA_PUBLISH_LOCATIONS=true
+KAFKA_TIMEOUT=10s
+`
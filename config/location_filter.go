@@ -0,0 +1,58 @@
+package config
+
+import "fmt"
+
+// LocationFilterConfig holds settings for filtering the positions devices
+// report. Positions reported less accurately than the maximum are dropped,
+// and the rest are smoothed per trip, weighted by their accuracy, into the
+// track used for ETAs, progress and anomaly checks. Raw positions are kept.
+type LocationFilterConfig struct {
+	Enabled bool
+
+	// Positions with a reported accuracy worse than this are dropped
+	MaxAccuracyMeters float64
+
+	// Accuracy assumed for positions reported without one
+	DefaultAccuracyMeters float64
+
+	// Speed the vehicle is assumed able to move at between positions when
+	// it reports a slower one, in m/s. Higher values follow new positions
+	// more closely; lower values smooth more.
+	ProcessNoiseMps float64
+}
+
+// GetLocationFilterConfig returns location filter configuration from environment variables
+func GetLocationFilterConfig() *LocationFilterConfig {
+	return &LocationFilterConfig{
+		Enabled:               getEnvBool("LOCATION_FILTER_ENABLED", true),
+		MaxAccuracyMeters:     getEnvFloat("LOCATION_FILTER_MAX_ACCURACY_METERS", 100),
+		DefaultAccuracyMeters: getEnvFloat("LOCATION_FILTER_DEFAULT_ACCURACY_METERS", 20),
+		ProcessNoiseMps:       getEnvFloat("LOCATION_FILTER_PROCESS_NOISE_MPS", 3),
+	}
+}
+
+// ValidateLocationFilterConfig validates location filter configuration
+func (lc *LocationFilterConfig) ValidateLocationFilterConfig() error {
+	if !lc.Enabled {
+		return nil
+	}
+	if lc.MaxAccuracyMeters <= 0 || lc.DefaultAccuracyMeters <= 0 {
+		return fmt.Errorf("Location filter accuracies must be positive")
+	}
+	if lc.DefaultAccuracyMeters > lc.MaxAccuracyMeters {
+		return fmt.Errorf("Location filter default accuracy can't be worse than the maximum accuracy")
+	}
+	if lc.ProcessNoiseMps <= 0 {
+		return fmt.Errorf("Location filter process noise must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for location filtering
+const LocationFilterEnvTemplate = `
+# Accuracy filtering and smoothing of reported positions
+LOCATION_FILTER_ENABLED=true
+LOCATION_FILTER_MAX_ACCURACY_METERS=100
+LOCATION_FILTER_DEFAULT_ACCURACY_METERS=20
+LOCATION_FILTER_PROCESS_NOISE_MPS=3
+`
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MapMatchingConfig holds settings for snapping GPS points to the road
+// network. Raw positions are always kept; matched positions are stored
+// alongside them.
+type MapMatchingConfig struct {
+	// Map matching provider (OSRM, HERE), or empty to disable matching
+	Provider string
+
+	// Snap points of location batches as they are ingested, and points
+	// not matched yet when a trip replay is generated
+	OnIngest bool
+	OnReplay bool
+
+	// OSRM match service and routing profile
+	OSRMURL     string
+	OSRMProfile string
+
+	// HERE Route Matching API, authenticated with HERE_API_KEY
+	HEREMatchURL string
+	HEREAPIKey   string
+
+	// Search radius around each point for candidate roads, widened to
+	// the accuracy the device reported
+	SearchRadiusMeters float64
+
+	// Matched positions further than this from the raw point are discarded
+	MaxSnapMeters float64
+
+	// Points sent to the provider per request
+	MaxPointsPerRequest int
+
+	HTTPTimeout time.Duration
+}
+
+// GetMapMatchingConfig returns map matching configuration from environment variables
+func GetMapMatchingConfig() *MapMatchingConfig {
+	return &MapMatchingConfig{
+		Provider:            strings.ToUpper(getEnvString("MAP_MATCHING_PROVIDER", "")),
+		OnIngest:            getEnvBool("MAP_MATCHING_ON_INGEST", true),
+		OnReplay:            getEnvBool("MAP_MATCHING_ON_REPLAY", true),
+		OSRMURL:             getEnvString("OSRM_URL", "https://router.project-osrm.org"),
+		OSRMProfile:         getEnvString("OSRM_PROFILE", "driving"),
+		HEREMatchURL:        getEnvString("HERE_ROUTE_MATCHING_URL", "https://routematching.hereapi.com/v8/match/routelinks"),
+		HEREAPIKey:          getEnvString("HERE_API_KEY", ""),
+		SearchRadiusMeters:  getEnvFloat("MAP_MATCHING_SEARCH_RADIUS_METERS", 25),
+		MaxSnapMeters:       getEnvFloat("MAP_MATCHING_MAX_SNAP_METERS", 50),
+		MaxPointsPerRequest: getEnvInt("MAP_MATCHING_MAX_POINTS_PER_REQUEST", 100),
+		HTTPTimeout:         getEnvDuration("MAP_MATCHING_HTTP_TIMEOUT", 10*time.Second),
+	}
+}
+
+// Enabled reports whether a map matching provider is configured
+func (mc *MapMatchingConfig) Enabled() bool {
+	return mc.Provider != ""
+}
+
+// ValidateMapMatchingConfig validates map matching configuration
+func (mc *MapMatchingConfig) ValidateMapMatchingConfig() error {
+	switch mc.Provider {
+	case "":
+		return nil
+	case "OSRM":
+		if mc.OSRMURL == "" {
+			return fmt.Errorf("OSRM URL is required when it is the map matching provider")
+		}
+	case "HERE":
+		if mc.HEREAPIKey == "" {
+			return fmt.Errorf("HERE API key is required when it is the map matching provider")
+		}
+	default:
+		return fmt.Errorf("Unknown map matching provider %s", mc.Provider)
+	}
+	if mc.SearchRadiusMeters <= 0 || mc.MaxSnapMeters <= 0 {
+		return fmt.Errorf("Map matching search radius and max snap distance must be positive")
+	}
+	if mc.MaxPointsPerRequest < 2 {
+		return fmt.Errorf("Map matching requests need at least 2 points")
+	}
+	if mc.HTTPTimeout <= 0 {
+		return fmt.Errorf("Map matching HTTP timeout must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for map matching
+const MapMatchingEnvTemplate = `
+# Snap-to-road map matching (OSRM, HERE; empty disables)
+MAP_MATCHING_PROVIDER=
+MAP_MATCHING_ON_INGEST=true
+MAP_MATCHING_ON_REPLAY=true
+OSRM_URL=https://router.project-osrm.org
+OSRM_PROFILE=driving
+HERE_ROUTE_MATCHING_URL=https://routematching.hereapi.com/v8/match/routelinks
+MAP_MATCHING_SEARCH_RADIUS_METERS=25
+MAP_MATCHING_MAX_SNAP_METERS=50
+MAP_MATCHING_MAX_POINTS_PER_REQUEST=100
+MAP_MATCHING_HTTP_TIMEOUT=10s
+`
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MetricsConfig holds settings for the Prometheus metrics endpoint
+type MetricsConfig struct {
+	Enabled bool
+	Path    string
+
+	// Bearer token scrapers must send, when set
+	Token string
+}
+
+// GetMetricsConfig returns metrics configuration from environment variables
+func GetMetricsConfig() *MetricsConfig {
+	return &MetricsConfig{
+		Enabled: getEnvBool("METRICS_ENABLED", true),
+		Path:    getEnvString("METRICS_PATH", "/metrics"),
+		Token:   getEnvString("METRICS_TOKEN", ""),
+	}
+}
+
+// ValidateMetricsConfig validates metrics configuration
+func (mc *MetricsConfig) ValidateMetricsConfig() error {
+	if mc.Enabled && !strings.HasPrefix(mc.Path, "/") {
+		return fmt.Errorf("Metrics path must start with /")
+	}
+	return nil
+}
+
+// Environment configuration template for metrics
+const MetricsEnvTemplate = `
+# Prometheus Metrics
+METRICS_ENABLED=true
+METRICS_PATH=/metrics
+METRICS_TOKEN=
+`
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MQTTConfig holds settings for bridging positions published by IoT GPS
+// trackers to an MQTT broker into trips
+type MQTTConfig struct {
+	Enabled bool
+
+	// Broker URL, tcp://host:1883, or ssl://host:8883 for TLS
+	BrokerURL string
+	ClientID  string
+	Username  string
+	Password  string
+
+	// CA to verify the broker's certificate with instead of the system roots
+	CAFile string
+
+	// Topic filter trackers publish to. The level matched by the first +
+	// wildcard is the tracker's device ID.
+	Topic string
+
+	// With QoS 1 the broker keeps the bridge's session while it reconnects,
+	// so positions published meanwhile are still delivered
+	QoS int
+
+	KeepAlive time.Duration
+
+	// Wait between attempts to reconnect to the broker
+	ReconnectDelay time.Duration
+}
+
+// GetMQTTConfig returns MQTT configuration from environment variables
+func GetMQTTConfig() *MQTTConfig {
+	return &MQTTConfig{
+		Enabled:        getEnvBool("MQTT_ENABLED", false),
+		BrokerURL:      getEnvString("MQTT_BROKER_URL", "tcp://localhost:1883"),
+		ClientID:       getEnvString("MQTT_CLIENT_ID", "triplink-bridge"),
+		Username:       getEnvString("MQTT_USERNAME", ""),
+		Password:       getEnvString("MQTT_PASSWORD", ""),
+		CAFile:         getEnvString("MQTT_CA_FILE", ""),
+		Topic:          getEnvString("MQTT_TOPIC", "trackers/+/location"),
+		QoS:            getEnvInt("MQTT_QOS", 1),
+		KeepAlive:      getEnvDuration("MQTT_KEEP_ALIVE", 30*time.Second),
+		ReconnectDelay: getEnvDuration("MQTT_RECONNECT_DELAY", 5*time.Second),
+	}
+}
+
+// ValidateMQTTConfig validates MQTT configuration
+func (mc *MQTTConfig) ValidateMQTTConfig() error {
+	if !mc.Enabled {
+		return nil
+	}
+	if mc.BrokerURL == "" {
+		return fmt.Errorf("MQTT broker URL is required")
+	}
+	if mc.ClientID == "" {
+		return fmt.Errorf("MQTT client ID is required")
+	}
+	hasDeviceLevel := false
+	for _, level := range strings.Split(mc.Topic, "/") {
+		if level == "+" {
+			hasDeviceLevel = true
+		}
+	}
+	if !hasDeviceLevel {
+		return fmt.Errorf("MQTT topic must have a + level for the device ID")
+	}
+	if mc.QoS != 0 && mc.QoS != 1 {
+		return fmt.Errorf("MQTT QoS must be 0 or 1")
+	}
+	if mc.KeepAlive < 0 {
+		return fmt.Errorf("MQTT keep alive must not be negative")
+	}
+	if mc.ReconnectDelay <= 0 {
+		return fmt.Errorf("MQTT reconnect delay must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for the MQTT bridge
+const MQTTEnvTemplate = `
+# MQTT Tracker Bridge
+MQTT_ENABLED=false
+MQTT_BROKER_URL=tcp://localhost:1883
+MQTT_CLIENT_ID=triplink-bridge
+MQTT_USERNAME=
+MQTT_PASSWORD=
+MQTT_CA_FILE=
+MQTT_TOPIC=trackers/+/location
+MQTT_QOS=1
+MQTT_KEEP_ALIVE=30s
+MQTT_RECONNECT_DELAY=5s
+`
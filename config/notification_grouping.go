@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// NotificationGroupingConfig holds settings for collapsing bursts of
+// notifications. A notification of the same type about the same trip or
+// load as an unread one the user got within the window is counted on that
+// one instead of being sent again.
+type NotificationGroupingConfig struct {
+	Enabled bool
+	Window  time.Duration
+}
+
+// GetNotificationGroupingConfig returns notification grouping configuration from environment variables
+func GetNotificationGroupingConfig() *NotificationGroupingConfig {
+	return &NotificationGroupingConfig{
+		Enabled: getEnvBool("NOTIFICATION_GROUPING_ENABLED", true),
+		Window:  getEnvDuration("NOTIFICATION_GROUPING_WINDOW", 5*time.Minute),
+	}
+}
+
+// ValidateNotificationGroupingConfig validates notification grouping configuration
+func (nc *NotificationGroupingConfig) ValidateNotificationGroupingConfig() error {
+	if nc.Enabled && nc.Window <= 0 {
+		return fmt.Errorf("Notification grouping window must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for notification grouping
+const NotificationGroupingEnvTemplate = `
+# Collapsing of repeated notifications about the same trip or load
+NOTIFICATION_GROUPING_ENABLED=true
+NOTIFICATION_GROUPING_WINDOW=5m
+`
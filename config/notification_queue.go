@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// NotificationQueueConfig holds settings for the queue delivering
+// notifications outside the request path
+type NotificationQueueConfig struct {
+	Enabled bool
+
+	// Number of delivery workers and of deliveries waiting for one
+	Workers   int
+	QueueSize int
+
+	// Deliveries are attempted up to MaxAttempts times, waiting
+	// InitialBackoff after the first failure and doubling up to MaxBackoff,
+	// before being moved to the dead letter list
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// GetNotificationQueueConfig returns notification queue configuration from environment variables
+func GetNotificationQueueConfig() *NotificationQueueConfig {
+	return &NotificationQueueConfig{
+		Enabled:        getEnvBool("NOTIFICATION_QUEUE_ENABLED", true),
+		Workers:        getEnvInt("NOTIFICATION_QUEUE_WORKERS", 4),
+		QueueSize:      getEnvInt("NOTIFICATION_QUEUE_SIZE", 1000),
+		MaxAttempts:    getEnvInt("NOTIFICATION_QUEUE_MAX_ATTEMPTS", 5),
+		InitialBackoff: getEnvDuration("NOTIFICATION_QUEUE_INITIAL_BACKOFF", 2*time.Second),
+		MaxBackoff:     getEnvDuration("NOTIFICATION_QUEUE_MAX_BACKOFF", 5*time.Minute),
+	}
+}
+
+// ValidateNotificationQueueConfig validates notification queue configuration
+func (nc *NotificationQueueConfig) ValidateNotificationQueueConfig() error {
+	if nc.Workers <= 0 || nc.QueueSize <= 0 {
+		return fmt.Errorf("Notification queue workers and size must be positive")
+	}
+	if nc.MaxAttempts <= 0 {
+		return fmt.Errorf("Notification queue max attempts must be positive")
+	}
+	if nc.InitialBackoff <= 0 || nc.MaxBackoff < nc.InitialBackoff {
+		return fmt.Errorf("Notification queue backoff must be positive and max backoff at least the initial backoff")
+	}
+	return nil
+}
+
+// Environment configuration template for the notification queue
+const NotificationQueueEnvTemplate = `
+# Notification Delivery Queue
+NOTIFICATION_QUEUE_ENABLED=true
+NOTIFICATION_QUEUE_WORKERS=4
+NOTIFICATION_QUEUE_SIZE=1000
+NOTIFICATION_QUEUE_MAX_ATTEMPTS=5
+NOTIFICATION_QUEUE_INITIAL_BACKOFF=2s
+NOTIFICATION_QUEUE_MAX_BACKOFF=5m
+`
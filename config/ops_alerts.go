@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// OpsAlertConfig holds settings for posting operational alerts, like
+// critical delays and load exceptions, to the Slack and Microsoft Teams
+// channels organizations connect
+type OpsAlertConfig struct {
+	Enabled bool
+	Timeout time.Duration // of each post to a channel
+
+	// Base URL of the web app, used for links in alerts
+	AppBaseURL string
+}
+
+// GetOpsAlertConfig returns ops alert configuration from environment variables
+func GetOpsAlertConfig() *OpsAlertConfig {
+	return &OpsAlertConfig{
+		Enabled:    getEnvBool("OPS_ALERTS_ENABLED", true),
+		Timeout:    getEnvDuration("OPS_ALERTS_TIMEOUT", 10*time.Second),
+		AppBaseURL: getEnvString("APP_BASE_URL", "https://app.triplink.app"),
+	}
+}
+
+// ValidateOpsAlertConfig validates ops alert configuration
+func (oc *OpsAlertConfig) ValidateOpsAlertConfig() error {
+	if oc.Timeout <= 0 {
+		return fmt.Errorf("Ops alert timeout must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for ops alerts
+const OpsAlertEnvTemplate = `
+# Ops Alerts to Slack and Microsoft Teams
+OPS_ALERTS_ENABLED=true
+OPS_ALERTS_TIMEOUT=10s
+`
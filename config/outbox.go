@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// OutboxConfig holds settings for publishing the tracking events recorded in
+// the transactional outbox
+type OutboxConfig struct {
+	// Interval of the scheduler job publishing pending events
+	PollInterval time.Duration
+
+	// Events published per run of the job
+	BatchSize int
+
+	// An event is given up on after this many failed attempts. Failed
+	// attempts are retried after RetryBackoff, doubled after every attempt
+	// up to an hour.
+	MaxAttempts  int
+	RetryBackoff time.Duration
+
+	// How long an instance has to publish the events it claimed before
+	// another instance may claim them
+	ClaimTimeout time.Duration
+
+	// Stream events to clients following the trip's location
+	StreamEnabled bool
+
+	// Endpoints events are posted to, signed with HMAC-SHA256 of the secret
+	WebhookURLs    []string
+	WebhookSecret  string
+	WebhookTimeout time.Duration
+}
+
+// GetOutboxConfig returns outbox configuration from environment variables
+func GetOutboxConfig() *OutboxConfig {
+	return &OutboxConfig{
+		PollInterval:   getEnvDuration("OUTBOX_POLL_INTERVAL", 2*time.Second),
+		BatchSize:      getEnvInt("OUTBOX_BATCH_SIZE", 100),
+		MaxAttempts:    getEnvInt("OUTBOX_MAX_ATTEMPTS", 10),
+		RetryBackoff:   getEnvDuration("OUTBOX_RETRY_BACKOFF", 10*time.Second),
+		ClaimTimeout:   getEnvDuration("OUTBOX_CLAIM_TIMEOUT", 1*time.Minute),
+		StreamEnabled:  getEnvBool("OUTBOX_STREAM_ENABLED", true),
+		WebhookURLs:    parseList(getEnvString("OUTBOX_WEBHOOK_URLS", "")),
+		WebhookSecret:  getEnvString("OUTBOX_WEBHOOK_SECRET", ""),
+		WebhookTimeout: getEnvDuration("OUTBOX_WEBHOOK_TIMEOUT", 10*time.Second),
+	}
+}
+
+// ValidateOutboxConfig validates outbox configuration
+func (oc *OutboxConfig) ValidateOutboxConfig() error {
+	if oc.PollInterval <= 0 {
+		return fmt.Errorf("Outbox poll interval must be positive")
+	}
+	if oc.BatchSize <= 0 {
+		return fmt.Errorf("Outbox batch size must be positive")
+	}
+	if oc.MaxAttempts <= 0 {
+		return fmt.Errorf("Outbox max attempts must be positive")
+	}
+	if oc.RetryBackoff <= 0 {
+		return fmt.Errorf("Outbox retry backoff must be positive")
+	}
+	if oc.ClaimTimeout <= 0 {
+		return fmt.Errorf("Outbox claim timeout must be positive")
+	}
+	for _, webhookURL := range oc.WebhookURLs {
+		parsed, err := url.Parse(webhookURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("Invalid outbox webhook URL %q", webhookURL)
+		}
+	}
+	if len(oc.WebhookURLs) > 0 && oc.WebhookSecret == "" {
+		return fmt.Errorf("Outbox webhook secret is required with webhook URLs")
+	}
+	if oc.WebhookTimeout <= 0 {
+		return fmt.Errorf("Outbox webhook timeout must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for the outbox
+const OutboxEnvTemplate = `
+# Tracking Event Outbox
+OUTBOX_POLL_INTERVAL=2s
+OUTBOX_BATCH_SIZE=100
+OUTBOX_MAX_ATTEMPTS=10
+OUTBOX_RETRY_BACKOFF=10s
+OUTBOX_CLAIM_TIMEOUT=1m
+OUTBOX_STREAM_ENABLED=true
+OUTBOX_WEBHOOK_URLS=
+OUTBOX_WEBHOOK_SECRET=
+OUTBOX_WEBHOOK_TIMEOUT=10s
+`
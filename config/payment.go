@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+)
+
+// PaymentConfig holds settings for payment gateways
+type PaymentConfig struct {
+	// Stripe settings
+	StripeSecretKey     string
+	StripeWebhookSecret string
+
+	// Percentage of each payment kept by the platform
+	PlatformFeePercent float64
+
+	// Days shippers have to pay an invoice
+	InvoiceDueDays int
+}
+
+// GetPaymentConfig returns payment configuration from environment variables
+func GetPaymentConfig() *PaymentConfig {
+	return &PaymentConfig{
+		StripeSecretKey:     getEnvString("STRIPE_SECRET_KEY", ""),
+		StripeWebhookSecret: getEnvString("STRIPE_WEBHOOK_SECRET", ""),
+		PlatformFeePercent:  float64(getEnvInt("PLATFORM_FEE_PERCENT", 5)),
+		InvoiceDueDays:      getEnvInt("INVOICE_DUE_DAYS", 30),
+	}
+}
+
+// ValidatePaymentConfig validates payment configuration
+func (pc *PaymentConfig) ValidatePaymentConfig() error {
+	if pc.StripeSecretKey != "" && pc.StripeWebhookSecret == "" {
+		return fmt.Errorf("Stripe webhook secret is required when Stripe is enabled")
+	}
+	if pc.PlatformFeePercent < 0 || pc.PlatformFeePercent > 100 {
+		return fmt.Errorf("Platform fee percent must be between 0 and 100")
+	}
+	if pc.InvoiceDueDays <= 0 {
+		return fmt.Errorf("Invoice due days must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for payments
+const PaymentEnvTemplate = `
+# Payments
+STRIPE_SECRET_KEY=
+STRIPE_WEBHOOK_SECRET=
+PLATFORM_FEE_PERCENT=5
+INVOICE_DUE_DAYS=30
+`
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// RateLimitConfig holds settings for API rate limiting. Authenticated
+// requests are counted per user and anonymous requests per IP address.
+type RateLimitConfig struct {
+	Enabled bool
+
+	// Requests allowed per window for each user and each IP address
+	UserLimit int
+	IPLimit   int
+	Window    time.Duration
+
+	// Expensive endpoints, matched as path prefixes, have their own tighter
+	// limits on top of the standard ones
+	ExpensivePaths     []string
+	ExpensiveUserLimit int
+	ExpensiveIPLimit   int
+	ExpensiveWindow    time.Duration
+}
+
+// GetRateLimitConfig returns rate limiting configuration from environment variables
+func GetRateLimitConfig() *RateLimitConfig {
+	return &RateLimitConfig{
+		Enabled:            getEnvBool("RATE_LIMIT_ENABLED", true),
+		UserLimit:          getEnvInt("RATE_LIMIT_USER", 300),
+		IPLimit:            getEnvInt("RATE_LIMIT_DEFAULT", 100),
+		Window:             getEnvDuration("RATE_LIMIT_WINDOW", 1*time.Minute),
+		ExpensivePaths:     parseList(getEnvString("RATE_LIMIT_EXPENSIVE_PATHS", "/api/analytics,/api/route-optimization")),
+		ExpensiveUserLimit: getEnvInt("RATE_LIMIT_EXPENSIVE_USER", 20),
+		ExpensiveIPLimit:   getEnvInt("RATE_LIMIT_EXPENSIVE_IP", 10),
+		ExpensiveWindow:    getEnvDuration("RATE_LIMIT_EXPENSIVE_WINDOW", 1*time.Minute),
+	}
+}
+
+// ValidateRateLimitConfig validates rate limiting configuration
+func (rc *RateLimitConfig) ValidateRateLimitConfig() error {
+	if rc.UserLimit <= 0 || rc.IPLimit <= 0 {
+		return fmt.Errorf("Rate limits must be positive")
+	}
+	if rc.Window <= 0 {
+		return fmt.Errorf("Rate limit window must be positive")
+	}
+	if len(rc.ExpensivePaths) > 0 {
+		if rc.ExpensiveUserLimit <= 0 || rc.ExpensiveIPLimit <= 0 {
+			return fmt.Errorf("Expensive endpoint rate limits must be positive")
+		}
+		if rc.ExpensiveWindow <= 0 {
+			return fmt.Errorf("Expensive endpoint rate limit window must be positive")
+		}
+	}
+	return nil
+}
+
+// Environment configuration template for rate limiting
+const RateLimitEnvTemplate = `
+# Rate Limiting
+RATE_LIMIT_ENABLED=true
+RATE_LIMIT_USER=300
+RATE_LIMIT_DEFAULT=100
+RATE_LIMIT_WINDOW=1m
+RATE_LIMIT_EXPENSIVE_PATHS=/api/analytics,/api/route-optimization
+RATE_LIMIT_EXPENSIVE_USER=20
+RATE_LIMIT_EXPENSIVE_IP=10
+RATE_LIMIT_EXPENSIVE_WINDOW=1m
+`
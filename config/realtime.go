@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// RealtimeConfig holds settings for streaming live location updates to clients
+type RealtimeConfig struct {
+	// Fan location updates out through Redis pub/sub so that clients
+	// connected to any API instance receive them. When disabled updates only
+	// reach clients connected to the instance that received them.
+	RedisPubSubEnabled bool
+
+	// Interval of keep-alive comments on idle streams
+	StreamHeartbeat time.Duration
+
+	// Updates buffered per client before updates to a slow client are dropped
+	SubscriberBuffer int
+
+	// Cache the latest location and ETA of trips in Redis, written on every
+	// location update, so dashboards don't query them from the database
+	LocationCacheEnabled bool
+
+	// Cached locations and ETAs expire after this long without an update
+	LocationCacheTTL time.Duration
+}
+
+// GetRealtimeConfig returns realtime configuration from environment variables
+func GetRealtimeConfig() *RealtimeConfig {
+	return &RealtimeConfig{
+		RedisPubSubEnabled: getEnvBool("REALTIME_REDIS_PUBSUB_ENABLED", false),
+		StreamHeartbeat:    getEnvDuration("REALTIME_STREAM_HEARTBEAT", 15*time.Second),
+		SubscriberBuffer:   getEnvInt("REALTIME_SUBSCRIBER_BUFFER", 16),
+
+		LocationCacheEnabled: getEnvBool("REALTIME_LOCATION_CACHE_ENABLED", false),
+		LocationCacheTTL:     getEnvDuration("REALTIME_LOCATION_CACHE_TTL", 10*time.Minute),
+	}
+}
+
+// ValidateRealtimeConfig validates realtime configuration
+func (rc *RealtimeConfig) ValidateRealtimeConfig() error {
+	if rc.StreamHeartbeat <= 0 {
+		return fmt.Errorf("Stream heartbeat interval must be positive")
+	}
+	if rc.SubscriberBuffer <= 0 {
+		return fmt.Errorf("Subscriber buffer must be positive")
+	}
+	if rc.LocationCacheEnabled && rc.LocationCacheTTL <= 0 {
+		return fmt.Errorf("Location cache TTL must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for realtime updates
+const RealtimeEnvTemplate = `
+# Realtime Location Streaming
+REALTIME_REDIS_PUBSUB_ENABLED=false
+REALTIME_STREAM_HEARTBEAT=15s
+REALTIME_SUBSCRIBER_BUFFER=16
+REALTIME_LOCATION_CACHE_ENABLED=false
+REALTIME_LOCATION_CACHE_TTL=10m
+`
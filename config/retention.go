@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+)
+
+// RetentionConfig holds the default data retention, used for data types
+// without a default retention policy in the database
+type RetentionConfig struct {
+	// Days each type of data is kept
+	TrackingRecordDays int
+	TrackingEventDays  int
+	CriticalEventDays  int // departures, arrivals, delays and exceptions
+	NotificationDays   int
+
+	// Archive data as JSON to storage before deleting it
+	Archive bool
+
+	// Key prefix of archives in the storage bucket
+	ArchivePrefix string
+
+	// Directory archives are written to when files are stored on the local
+	// disk. Kept apart from uploads so archives aren't publicly served.
+	ArchiveLocalPath string
+
+	// Rows archived and deleted per batch
+	BatchSize int
+}
+
+// GetRetentionConfig returns data retention configuration from environment variables
+func GetRetentionConfig() *RetentionConfig {
+	return &RetentionConfig{
+		TrackingRecordDays: getEnvInt("RETENTION_TRACKING_RECORD_DAYS", 90),
+		TrackingEventDays:  getEnvInt("RETENTION_TRACKING_EVENT_DAYS", 90),
+		CriticalEventDays:  getEnvInt("RETENTION_CRITICAL_EVENT_DAYS", 365),
+		NotificationDays:   getEnvInt("RETENTION_NOTIFICATION_DAYS", 180),
+		Archive:            getEnvBool("RETENTION_ARCHIVE", true),
+		ArchivePrefix:      getEnvString("RETENTION_ARCHIVE_PREFIX", "archive"),
+		ArchiveLocalPath:   getEnvString("RETENTION_ARCHIVE_LOCAL_PATH", "./archive"),
+		BatchSize:          getEnvInt("RETENTION_BATCH_SIZE", 5000),
+	}
+}
+
+// ValidateRetentionConfig validates data retention configuration
+func (rc *RetentionConfig) ValidateRetentionConfig() error {
+	if rc.TrackingRecordDays <= 0 || rc.TrackingEventDays <= 0 || rc.CriticalEventDays <= 0 || rc.NotificationDays <= 0 {
+		return fmt.Errorf("Retention days must be positive")
+	}
+	if rc.BatchSize <= 0 {
+		return fmt.Errorf("Retention batch size must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for data retention
+const RetentionEnvTemplate = `
+# Data Retention
+RETENTION_TRACKING_RECORD_DAYS=90
+RETENTION_TRACKING_EVENT_DAYS=90
+RETENTION_CRITICAL_EVENT_DAYS=365
+RETENTION_NOTIFICATION_DAYS=180
+RETENTION_ARCHIVE=true
+RETENTION_ARCHIVE_PREFIX=archive
+RETENTION_ARCHIVE_LOCAL_PATH=./archive
+RETENTION_BATCH_SIZE=5000
+`
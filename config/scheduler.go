@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// SchedulerConfig holds settings for the background tracking scheduler
+type SchedulerConfig struct {
+	Enabled bool
+
+	// Job intervals
+	DelayCheckInterval         time.Duration
+	ETARefreshInterval         time.Duration
+	StaleDataCheckInterval     time.Duration
+	AnomalyCheckInterval       time.Duration
+	DigestCheckInterval        time.Duration
+	QuoteExpiryInterval        time.Duration
+	CustomsExpiryInterval      time.Duration
+	VehicleExpiryInterval      time.Duration
+	ReportSubscriptionInterval time.Duration
+	RetentionCleanupInterval   time.Duration
+	TelematicsPollInterval     time.Duration
+	PickupReminderInterval     time.Duration
+	TripTemplateInterval       time.Duration
+	TrackingRollupInterval     time.Duration
+	EmissionsInterval          time.Duration
+	FeedbackAnalysisInterval   time.Duration
+	VehicleMaintenanceInterval time.Duration
+
+	// A trip with tracking enabled is considered stale when its last
+	// location update is older than this threshold
+	StaleDataThreshold time.Duration
+
+	// Carriers are reminded of a load's pickup this long before it
+	PickupReminderLeadTime time.Duration
+}
+
+// GetSchedulerConfig returns scheduler configuration from environment variables
+func GetSchedulerConfig() *SchedulerConfig {
+	return &SchedulerConfig{
+		Enabled:                    getEnvBool("SCHEDULER_ENABLED", true),
+		DelayCheckInterval:         getEnvDuration("SCHEDULER_DELAY_CHECK_INTERVAL", 15*time.Minute),
+		ETARefreshInterval:         getEnvDuration("SCHEDULER_ETA_REFRESH_INTERVAL", 5*time.Minute),
+		StaleDataCheckInterval:     getEnvDuration("SCHEDULER_STALE_DATA_CHECK_INTERVAL", 10*time.Minute),
+		AnomalyCheckInterval:       getEnvDuration("SCHEDULER_ANOMALY_CHECK_INTERVAL", 5*time.Minute),
+		DigestCheckInterval:        getEnvDuration("SCHEDULER_DIGEST_CHECK_INTERVAL", 5*time.Minute),
+		QuoteExpiryInterval:        getEnvDuration("SCHEDULER_QUOTE_EXPIRY_INTERVAL", 15*time.Minute),
+		CustomsExpiryInterval:      getEnvDuration("SCHEDULER_CUSTOMS_EXPIRY_INTERVAL", 6*time.Hour),
+		VehicleExpiryInterval:      getEnvDuration("SCHEDULER_VEHICLE_EXPIRY_INTERVAL", 6*time.Hour),
+		ReportSubscriptionInterval: getEnvDuration("SCHEDULER_REPORT_SUBSCRIPTION_INTERVAL", 5*time.Minute),
+		RetentionCleanupInterval:   getEnvDuration("SCHEDULER_RETENTION_CLEANUP_INTERVAL", 24*time.Hour),
+		TelematicsPollInterval:     getEnvDuration("SCHEDULER_TELEMATICS_POLL_INTERVAL", 1*time.Minute),
+		PickupReminderInterval:     getEnvDuration("SCHEDULER_PICKUP_REMINDER_INTERVAL", 15*time.Minute),
+		TripTemplateInterval:       getEnvDuration("SCHEDULER_TRIP_TEMPLATE_INTERVAL", 1*time.Hour),
+		TrackingRollupInterval:     getEnvDuration("SCHEDULER_TRACKING_ROLLUP_INTERVAL", 5*time.Minute),
+		EmissionsInterval:          getEnvDuration("SCHEDULER_EMISSIONS_INTERVAL", 15*time.Minute),
+		FeedbackAnalysisInterval:   getEnvDuration("SCHEDULER_FEEDBACK_ANALYSIS_INTERVAL", 1*time.Minute),
+		VehicleMaintenanceInterval: getEnvDuration("SCHEDULER_VEHICLE_MAINTENANCE_INTERVAL", 1*time.Hour),
+		StaleDataThreshold:         getEnvDuration("SCHEDULER_STALE_DATA_THRESHOLD", 30*time.Minute),
+		PickupReminderLeadTime:     getEnvDuration("SCHEDULER_PICKUP_REMINDER_LEAD_TIME", 2*time.Hour),
+	}
+}
+
+// ValidateSchedulerConfig validates scheduler configuration
+func (sc *SchedulerConfig) ValidateSchedulerConfig() error {
+	if sc.DelayCheckInterval <= 0 {
+		return fmt.Errorf("Delay check interval must be positive")
+	}
+	if sc.ETARefreshInterval <= 0 {
+		return fmt.Errorf("ETA refresh interval must be positive")
+	}
+	if sc.StaleDataCheckInterval <= 0 {
+		return fmt.Errorf("Stale data check interval must be positive")
+	}
+	if sc.AnomalyCheckInterval <= 0 {
+		return fmt.Errorf("Anomaly check interval must be positive")
+	}
+	if sc.DigestCheckInterval <= 0 {
+		return fmt.Errorf("Digest check interval must be positive")
+	}
+	if sc.QuoteExpiryInterval <= 0 {
+		return fmt.Errorf("Quote expiry interval must be positive")
+	}
+	if sc.CustomsExpiryInterval <= 0 {
+		return fmt.Errorf("Customs expiry interval must be positive")
+	}
+	if sc.VehicleExpiryInterval <= 0 {
+		return fmt.Errorf("Vehicle expiry interval must be positive")
+	}
+	if sc.ReportSubscriptionInterval <= 0 {
+		return fmt.Errorf("Report subscription interval must be positive")
+	}
+	if sc.RetentionCleanupInterval <= 0 {
+		return fmt.Errorf("Retention cleanup interval must be positive")
+	}
+	if sc.TelematicsPollInterval <= 0 {
+		return fmt.Errorf("Telematics poll interval must be positive")
+	}
+	if sc.PickupReminderInterval <= 0 {
+		return fmt.Errorf("Pickup reminder interval must be positive")
+	}
+	if sc.TripTemplateInterval <= 0 {
+		return fmt.Errorf("Trip template interval must be positive")
+	}
+	if sc.TrackingRollupInterval <= 0 {
+		return fmt.Errorf("Tracking rollup interval must be positive")
+	}
+	if sc.EmissionsInterval <= 0 {
+		return fmt.Errorf("Emissions interval must be positive")
+	}
+	if sc.FeedbackAnalysisInterval <= 0 {
+		return fmt.Errorf("Feedback analysis interval must be positive")
+	}
+	if sc.VehicleMaintenanceInterval <= 0 {
+		return fmt.Errorf("Vehicle maintenance interval must be positive")
+	}
+	if sc.StaleDataThreshold <= 0 {
+		return fmt.Errorf("Stale data threshold must be positive")
+	}
+	if sc.PickupReminderLeadTime <= 0 {
+		return fmt.Errorf("Pickup reminder lead time must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for the scheduler
+const SchedulerEnvTemplate = `
+# Background Scheduler
+SCHEDULER_ENABLED=true
+SCHEDULER_DELAY_CHECK_INTERVAL=15m
+SCHEDULER_ETA_REFRESH_INTERVAL=5m
+SCHEDULER_STALE_DATA_CHECK_INTERVAL=10m
+SCHEDULER_ANOMALY_CHECK_INTERVAL=5m
+SCHEDULER_DIGEST_CHECK_INTERVAL=5m
+SCHEDULER_QUOTE_EXPIRY_INTERVAL=15m
+SCHEDULER_CUSTOMS_EXPIRY_INTERVAL=6h
+SCHEDULER_VEHICLE_EXPIRY_INTERVAL=6h
+SCHEDULER_REPORT_SUBSCRIPTION_INTERVAL=5m
+SCHEDULER_RETENTION_CLEANUP_INTERVAL=24h
+SCHEDULER_TELEMATICS_POLL_INTERVAL=1m
+SCHEDULER_PICKUP_REMINDER_INTERVAL=15m
+SCHEDULER_TRIP_TEMPLATE_INTERVAL=1h
+SCHEDULER_TRACKING_ROLLUP_INTERVAL=5m
+SCHEDULER_EMISSIONS_INTERVAL=15m
+SCHEDULER_FEEDBACK_ANALYSIS_INTERVAL=1m
+SCHEDULER_VEHICLE_MAINTENANCE_INTERVAL=1h
+SCHEDULER_STALE_DATA_THRESHOLD=30m
+SCHEDULER_PICKUP_REMINDER_LEAD_TIME=2h
+`
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// SMSConfig holds settings for SMS notification delivery through Twilio
+type SMSConfig struct {
+	Enabled bool
+
+	// Twilio settings. Messages are sent from the messaging service when one
+	// is set, otherwise from the from number.
+	TwilioAccountSID          string
+	TwilioAuthToken           string
+	TwilioFromNumber          string
+	TwilioMessagingServiceSID string
+	TwilioAPIURL              string
+
+	// Phone number verification
+	VerificationCodeTTL     time.Duration
+	VerificationMaxAttempts int
+	VerificationResendAfter time.Duration
+
+	// Base URL of the web app, used for links in messages
+	AppBaseURL string
+}
+
+// GetSMSConfig returns SMS configuration from environment variables
+func GetSMSConfig() *SMSConfig {
+	return &SMSConfig{
+		Enabled:                   getEnvBool("SMS_ENABLED", false),
+		TwilioAccountSID:          getEnvString("TWILIO_ACCOUNT_SID", ""),
+		TwilioAuthToken:           getEnvString("TWILIO_AUTH_TOKEN", ""),
+		TwilioFromNumber:          getEnvString("TWILIO_FROM_NUMBER", ""),
+		TwilioMessagingServiceSID: getEnvString("TWILIO_MESSAGING_SERVICE_SID", ""),
+		TwilioAPIURL:              getEnvString("TWILIO_API_URL", "https://api.twilio.com"),
+		VerificationCodeTTL:       getEnvDuration("SMS_VERIFICATION_CODE_TTL", 10*time.Minute),
+		VerificationMaxAttempts:   getEnvInt("SMS_VERIFICATION_MAX_ATTEMPTS", 5),
+		VerificationResendAfter:   getEnvDuration("SMS_VERIFICATION_RESEND_AFTER", 1*time.Minute),
+		AppBaseURL:                getEnvString("APP_BASE_URL", "https://app.triplink.app"),
+	}
+}
+
+// ValidateSMSConfig validates SMS configuration
+func (sc *SMSConfig) ValidateSMSConfig() error {
+	if sc.VerificationCodeTTL <= 0 {
+		return fmt.Errorf("SMS verification code TTL must be positive")
+	}
+	if sc.VerificationMaxAttempts <= 0 {
+		return fmt.Errorf("SMS verification max attempts must be positive")
+	}
+	if sc.VerificationResendAfter < 0 {
+		return fmt.Errorf("SMS verification resend interval cannot be negative")
+	}
+	if !sc.Enabled {
+		return nil
+	}
+	if sc.TwilioAccountSID == "" || sc.TwilioAuthToken == "" {
+		return fmt.Errorf("Twilio account SID and auth token cannot be empty")
+	}
+	if sc.TwilioFromNumber == "" && sc.TwilioMessagingServiceSID == "" {
+		return fmt.Errorf("Twilio from number or messaging service SID is required")
+	}
+	return nil
+}
+
+// Environment configuration template for SMS delivery
+const SMSEnvTemplate = `
+# SMS Notifications (Twilio)
+SMS_ENABLED=false
+TWILIO_ACCOUNT_SID=
+TWILIO_AUTH_TOKEN=
+TWILIO_FROM_NUMBER=
+TWILIO_MESSAGING_SERVICE_SID=
+TWILIO_API_URL=https://api.twilio.com
+SMS_VERIFICATION_CODE_TTL=10m
+SMS_VERIFICATION_MAX_ATTEMPTS=5
+SMS_VERIFICATION_RESEND_AFTER=1m
+APP_BASE_URL=https://app.triplink.app
+`
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings are read from environment variables, then from the YAML
+// configuration file, then fall back to their defaults. The file holds the
+// same settings as the environment, either by name or nested by the
+// words of the name:
+//
+//	REDIS_HOST: redis.internal
+//	alert:
+//	  delay_thresholds: [30, 60, 120]
+//
+// sets REDIS_HOST and ALERT_DELAY_THRESHOLDS. Lists are read as comma
+// separated values.
+var fileSettings = struct {
+	sync.RWMutex
+	path   string
+	values map[string]string
+}{}
+
+// reloadHooks are called after the configuration file is reloaded
+var reloadHooks struct {
+	sync.Mutex
+	hooks []func()
+}
+
+// Load reads the configuration file at path. A missing file is only an
+// error when the path was set explicitly, so deployments configured through
+// the environment alone need no file.
+func Load(path string, required bool) error {
+	values, err := readSettingsFile(path)
+	if os.IsNotExist(err) && !required {
+		values, err = map[string]string{}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fileSettings.Lock()
+	fileSettings.path = path
+	fileSettings.values = values
+	fileSettings.Unlock()
+
+	storeAlertConfig(GetAlertConfig())
+	return nil
+}
+
+// Reload re-reads the configuration file and applies the settings that can
+// change without a restart, such as alert thresholds. Other settings are
+// read at startup and keep their values until the next one. On error the
+// previous settings are kept.
+func Reload() error {
+	fileSettings.RLock()
+	path := fileSettings.path
+	fileSettings.RUnlock()
+	if path == "" {
+		return fmt.Errorf("no configuration file to reload")
+	}
+
+	values, err := readSettingsFile(path)
+	if err != nil {
+		return err
+	}
+
+	fileSettings.Lock()
+	previous := fileSettings.values
+	fileSettings.values = values
+	fileSettings.Unlock()
+
+	alerts := GetAlertConfig()
+	if err := alerts.ValidateAlertConfig(); err != nil {
+		fileSettings.Lock()
+		fileSettings.values = previous
+		fileSettings.Unlock()
+		return fmt.Errorf("invalid alert configuration: %w", err)
+	}
+	storeAlertConfig(alerts)
+
+	reloadHooks.Lock()
+	hooks := append([]func(){}, reloadHooks.hooks...)
+	reloadHooks.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+	return nil
+}
+
+// OnReload registers a function called after each successful reload
+func OnReload(hook func()) {
+	reloadHooks.Lock()
+	defer reloadHooks.Unlock()
+	reloadHooks.hooks = append(reloadHooks.hooks, hook)
+}
+
+// lookupSetting returns the value of a setting from the environment or the
+// configuration file
+func lookupSetting(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	fileSettings.RLock()
+	defer fileSettings.RUnlock()
+	return fileSettings.values[key]
+}
+
+// readSettingsFile reads a YAML configuration file into settings by name
+func readSettingsFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	if err := flattenSettings("", document, values); err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// flattenSettings names nested settings by joining their keys
+func flattenSettings(prefix string, document map[string]interface{}, values map[string]string) error {
+	for key, value := range document {
+		name := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(key))
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+
+		switch value := value.(type) {
+		case map[string]interface{}:
+			if err := flattenSettings(name, value, values); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				if _, nested := item.(map[string]interface{}); nested {
+					return fmt.Errorf("%s: lists can only hold values", name)
+				}
+				items[i] = fmt.Sprint(item)
+			}
+			values[name] = strings.Join(items, ",")
+		case nil:
+			values[name] = ""
+		default:
+			values[name] = fmt.Sprint(value)
+		}
+	}
+	return nil
+}
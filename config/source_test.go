@@ -0,0 +1,133 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func resetSettings(t *testing.T) {
+	t.Cleanup(func() {
+		fileSettings.Lock()
+		fileSettings.path, fileSettings.values = "", nil
+		fileSettings.Unlock()
+		currentAlertConfig.Store(nil)
+	})
+}
+
+func TestLoadReadsNestedAndNamedSettings(t *testing.T) {
+	resetSettings(t)
+	path := writeConfigFile(t, `
+REDIS_HOST: redis.internal
+redis:
+  port: 6380
+alert:
+  delay_thresholds: [120, 30]
+  update-gap: 2h
+`)
+	if err := Load(path, true); err != nil {
+		t.Fatal(err)
+	}
+
+	redis := GetRedisConfig()
+	if redis.Host != "redis.internal" || redis.Port != "6380" {
+		t.Errorf("got redis %s:%s", redis.Host, redis.Port)
+	}
+	alerts := CurrentAlertConfig()
+	if !reflect.DeepEqual(alerts.DelayThresholds, []int{30, 120}) {
+		t.Errorf("got delay thresholds %v", alerts.DelayThresholds)
+	}
+	if alerts.UpdateGap != 2*time.Hour {
+		t.Errorf("got update gap %s", alerts.UpdateGap)
+	}
+}
+
+func TestEnvironmentOverridesFile(t *testing.T) {
+	resetSettings(t)
+	t.Setenv("REDIS_HOST", "from-env")
+	path := writeConfigFile(t, "redis:\n  host: from-file\n")
+	if err := Load(path, true); err != nil {
+		t.Fatal(err)
+	}
+	if host := GetRedisConfig().Host; host != "from-env" {
+		t.Errorf("got host %s", host)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	resetSettings(t)
+	path := filepath.Join(t.TempDir(), "missing.yaml")
+	if err := Load(path, false); err != nil {
+		t.Errorf("optional file: %v", err)
+	}
+	if err := Load(path, true); err == nil {
+		t.Error("required file loaded")
+	}
+}
+
+func TestReloadAppliesAlertThresholds(t *testing.T) {
+	resetSettings(t)
+	path := writeConfigFile(t, "alert:\n  delay_thresholds: 30,60\n")
+	if err := Load(path, true); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := false
+	OnReload(func() { reloaded = true })
+
+	if err := os.WriteFile(path, []byte("alert:\n  delay_thresholds: 15\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := CurrentAlertConfig().DelayThresholds; !reflect.DeepEqual(got, []int{15}) {
+		t.Errorf("got delay thresholds %v", got)
+	}
+	if !reloaded {
+		t.Error("reload hook not called")
+	}
+
+	// Invalid settings are rejected and the previous ones kept
+	if err := os.WriteFile(path, []byte("alert:\n  delay_thresholds: -5\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(); err == nil {
+		t.Fatal("invalid thresholds reloaded")
+	}
+	if got := CurrentAlertConfig().DelayThresholds; !reflect.DeepEqual(got, []int{15}) {
+		t.Errorf("got delay thresholds %v", got)
+	}
+	if got := GetAlertConfig().DelayThresholds; !reflect.DeepEqual(got, []int{15}) {
+		t.Errorf("file settings not restored: %v", got)
+	}
+}
+
+func TestValidateReportsMissingRequiredAPIKeys(t *testing.T) {
+	resetSettings(t)
+	t.Setenv("REQUIRED_API_KEYS", "GOOGLE_MAPS_API_KEY,HERE_API_KEY")
+	t.Setenv("GOOGLE_MAPS_API_KEY", "")
+	t.Setenv("HERE_API_KEY", "key")
+
+	err := Validate()
+	if err == nil || !strings.Contains(err.Error(), "Required API keys are missing: GOOGLE_MAPS_API_KEY") {
+		t.Fatalf("got %v", err)
+	}
+
+	t.Setenv("GOOGLE_MAPS_API_KEY", "key")
+	if err := Validate(); err != nil {
+		t.Errorf("got %v", err)
+	}
+}
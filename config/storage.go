@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+)
+
+// StorageConfig holds settings for file storage used by uploads such as
+// proof-of-delivery photos and signatures
+type StorageConfig struct {
+	Provider string // s3, local
+
+	// S3-compatible settings (AWS S3, MinIO, DigitalOcean Spaces, ...)
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3UsePathStyle bool
+
+	// Base URL files are served from. Defaults to the bucket URL for s3.
+	PublicBaseURL string
+
+	// Directory used by the local provider
+	LocalPath string
+
+	// Maximum size of a single upload in bytes
+	MaxUploadSize int64
+}
+
+// GetStorageConfig returns storage configuration from environment variables
+func GetStorageConfig() *StorageConfig {
+	return &StorageConfig{
+		Provider:       getEnvString("STORAGE_PROVIDER", "local"),
+		S3Endpoint:     getEnvString("S3_ENDPOINT", "https://s3.amazonaws.com"),
+		S3Region:       getEnvString("S3_REGION", "us-east-1"),
+		S3Bucket:       getEnvString("S3_BUCKET", ""),
+		S3AccessKey:    getEnvString("S3_ACCESS_KEY", ""),
+		S3SecretKey:    getEnvString("S3_SECRET_KEY", ""),
+		S3UsePathStyle: getEnvBool("S3_USE_PATH_STYLE", true),
+		PublicBaseURL:  getEnvString("STORAGE_PUBLIC_BASE_URL", ""),
+		LocalPath:      getEnvString("STORAGE_LOCAL_PATH", "./uploads"),
+		MaxUploadSize:  getEnvInt64("STORAGE_MAX_UPLOAD_SIZE", 10*1024*1024),
+	}
+}
+
+// ValidateStorageConfig validates storage configuration
+func (sc *StorageConfig) ValidateStorageConfig() error {
+	switch sc.Provider {
+	case "s3":
+		if sc.S3Bucket == "" {
+			return fmt.Errorf("S3 bucket cannot be empty")
+		}
+		if sc.S3AccessKey == "" || sc.S3SecretKey == "" {
+			return fmt.Errorf("S3 access key and secret key are required")
+		}
+	case "local":
+		if sc.LocalPath == "" {
+			return fmt.Errorf("Local storage path cannot be empty")
+		}
+	default:
+		return fmt.Errorf("Unknown storage provider: %s", sc.Provider)
+	}
+	if sc.MaxUploadSize <= 0 {
+		return fmt.Errorf("Max upload size must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for file storage
+const StorageEnvTemplate = `
+# File Storage
+STORAGE_PROVIDER=local
+STORAGE_LOCAL_PATH=./uploads
+STORAGE_PUBLIC_BASE_URL=
+STORAGE_MAX_UPLOAD_SIZE=10485760
+S3_ENDPOINT=https://s3.amazonaws.com
+S3_REGION=us-east-1
+S3_BUCKET=
+S3_ACCESS_KEY=
+S3_SECRET_KEY=
+S3_USE_PATH_STYLE=true
+`
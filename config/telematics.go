@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// TelematicsConfig holds settings for ingesting vehicle positions from
+// telematics providers such as Samsara and Geotab
+type TelematicsConfig struct {
+	SamsaraBaseURL string
+	GeotabBaseURL  string
+
+	// Timeout of each call to a provider's API
+	HTTPTimeout time.Duration
+
+	// Webhook calls signed longer ago than this are rejected as replays
+	WebhookTolerance time.Duration
+}
+
+// GetTelematicsConfig returns telematics configuration from environment variables
+func GetTelematicsConfig() *TelematicsConfig {
+	return &TelematicsConfig{
+		SamsaraBaseURL:   getEnvString("SAMSARA_API_URL", "https://api.samsara.com"),
+		GeotabBaseURL:    getEnvString("GEOTAB_API_URL", "https://my.geotab.com"),
+		HTTPTimeout:      getEnvDuration("TELEMATICS_HTTP_TIMEOUT", 15*time.Second),
+		WebhookTolerance: getEnvDuration("TELEMATICS_WEBHOOK_TOLERANCE", 5*time.Minute),
+	}
+}
+
+// ValidateTelematicsConfig validates telematics configuration
+func (tc *TelematicsConfig) ValidateTelematicsConfig() error {
+	if tc.SamsaraBaseURL == "" || tc.GeotabBaseURL == "" {
+		return fmt.Errorf("Telematics provider URLs are required")
+	}
+	if tc.HTTPTimeout <= 0 {
+		return fmt.Errorf("Telematics HTTP timeout must be positive")
+	}
+	if tc.WebhookTolerance <= 0 {
+		return fmt.Errorf("Telematics webhook tolerance must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for telematics
+const TelematicsEnvTemplate = `
+# Telematics Providers
+SAMSARA_API_URL=https://api.samsara.com
+GEOTAB_API_URL=https://my.geotab.com
+TELEMATICS_HTTP_TIMEOUT=15s
+TELEMATICS_WEBHOOK_TOLERANCE=5m
+`
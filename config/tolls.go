@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TollConfig holds settings for the expected toll costs of trips
+type TollConfig struct {
+	// Currency of toll costs when the toll API doesn't give one
+	Currency string
+
+	// A trip's tolls are recalculated when its planned route's length changes
+	// by more than this percent, or the route moves further than
+	// RecomputeDeviationKm from the one the tolls were calculated for
+	RecomputeDistancePercent float64
+	RecomputeDeviationKm     float64
+}
+
+// GetTollConfig returns toll configuration from environment variables
+func GetTollConfig() *TollConfig {
+	return &TollConfig{
+		Currency:                 strings.ToUpper(getEnvString("TOLL_CURRENCY", "USD")),
+		RecomputeDistancePercent: getEnvFloat("TOLL_RECOMPUTE_DISTANCE_PERCENT", 10),
+		RecomputeDeviationKm:     getEnvFloat("TOLL_RECOMPUTE_DEVIATION_KM", 5),
+	}
+}
+
+// ValidateTollConfig validates toll configuration
+func (tc *TollConfig) ValidateTollConfig() error {
+	if len(tc.Currency) != 3 {
+		return fmt.Errorf("Toll currency must be a 3 letter ISO 4217 code")
+	}
+	if tc.RecomputeDistancePercent <= 0 {
+		return fmt.Errorf("Recompute distance percent must be positive")
+	}
+	if tc.RecomputeDeviationKm <= 0 {
+		return fmt.Errorf("Recompute deviation must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for tolls
+const TollEnvTemplate = `
+# Toll Costs
+TOLL_CURRENCY=USD
+TOLL_RECOMPUTE_DISTANCE_PERCENT=10
+TOLL_RECOMPUTE_DEVIATION_KM=5
+`
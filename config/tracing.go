@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TracingConfig holds settings for OpenTelemetry tracing. Spans are exported
+// over OTLP/HTTP to a collector such as the OpenTelemetry Collector, Jaeger
+// or Tempo.
+type TracingConfig struct {
+	Enabled     bool
+	ServiceName string
+
+	// OTLP/HTTP endpoint, e.g. http://localhost:4318, and headers sent with
+	// each export such as an API key, as comma separated key=value pairs
+	Endpoint string
+	Headers  map[string]string
+
+	// Fraction of new traces recorded. Requests that arrive with a sampled
+	// trace are always recorded.
+	SampleRatio float64
+}
+
+// GetTracingConfig returns tracing configuration from environment variables,
+// using the standard OpenTelemetry variable names
+func GetTracingConfig() *TracingConfig {
+	return &TracingConfig{
+		Enabled:     getEnvBool("OTEL_TRACING_ENABLED", false),
+		ServiceName: getEnvString("OTEL_SERVICE_NAME", "triplink-backend"),
+		Endpoint:    getEnvString("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318"),
+		Headers:     parseHeaders(getEnvString("OTEL_EXPORTER_OTLP_HEADERS", "")),
+		SampleRatio: getEnvFloat("OTEL_TRACES_SAMPLER_ARG", 1.0),
+	}
+}
+
+// parseHeaders parses comma separated key=value pairs
+func parseHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, item := range parseList(value) {
+		if key, val, ok := strings.Cut(item, "="); ok {
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		}
+	}
+	return headers
+}
+
+// ValidateTracingConfig validates tracing configuration
+func (tc *TracingConfig) ValidateTracingConfig() error {
+	if !tc.Enabled {
+		return nil
+	}
+	if tc.ServiceName == "" {
+		return fmt.Errorf("Tracing service name is required")
+	}
+	if !strings.HasPrefix(tc.Endpoint, "http://") && !strings.HasPrefix(tc.Endpoint, "https://") {
+		return fmt.Errorf("OTLP endpoint must be an http or https URL")
+	}
+	if tc.SampleRatio < 0 || tc.SampleRatio > 1 {
+		return fmt.Errorf("Trace sample ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// Environment configuration template for tracing
+const TracingEnvTemplate = `
+# OpenTelemetry Tracing
+OTEL_TRACING_ENABLED=false
+OTEL_SERVICE_NAME=triplink-backend
+OTEL_EXPORTER_OTLP_ENDPOINT=http://localhost:4318
+OTEL_EXPORTER_OTLP_HEADERS=
+OTEL_TRACES_SAMPLER_ARG=1.0
+`
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// TrackingArchiveConfig holds settings for the tracking_records partitions
+// and the archival of closed trips' records
+type TrackingArchiveConfig struct {
+	Enabled bool
+
+	// How often partitions are created and closed trips archived
+	Interval time.Duration
+
+	// Monthly partitions are created this many months ahead of the current
+	// one, on Postgres
+	PartitionMonthsAhead int
+
+	// Completed and cancelled trips have their records archived this long
+	// after they closed
+	ArchiveAfter time.Duration
+
+	// Trips archived per run
+	BatchSize int
+}
+
+// GetTrackingArchiveConfig returns tracking archive configuration from environment variables
+func GetTrackingArchiveConfig() *TrackingArchiveConfig {
+	return &TrackingArchiveConfig{
+		Enabled:              getEnvBool("TRACKING_ARCHIVE_ENABLED", true),
+		Interval:             getEnvDuration("TRACKING_ARCHIVE_INTERVAL", 6*time.Hour),
+		PartitionMonthsAhead: getEnvInt("TRACKING_PARTITION_MONTHS_AHEAD", 2),
+		ArchiveAfter:         getEnvDuration("TRACKING_ARCHIVE_AFTER", 30*24*time.Hour),
+		BatchSize:            getEnvInt("TRACKING_ARCHIVE_BATCH_SIZE", 100),
+	}
+}
+
+// ValidateTrackingArchiveConfig validates tracking archive configuration
+func (tc *TrackingArchiveConfig) ValidateTrackingArchiveConfig() error {
+	if tc.Interval <= 0 {
+		return fmt.Errorf("Tracking archive interval must be positive")
+	}
+	if tc.PartitionMonthsAhead < 0 {
+		return fmt.Errorf("Tracking partition months ahead can't be negative")
+	}
+	if tc.ArchiveAfter <= 0 {
+		return fmt.Errorf("Tracking archive delay must be positive")
+	}
+	if tc.BatchSize <= 0 {
+		return fmt.Errorf("Tracking archive batch size must be positive")
+	}
+	return nil
+}
+
+// Environment configuration template for the tracking archive
+const TrackingArchiveEnvTemplate = `
+# Tracking Record Partitions and Archive
+TRACKING_ARCHIVE_ENABLED=true
+TRACKING_ARCHIVE_INTERVAL=6h
+TRACKING_PARTITION_MONTHS_AHEAD=2
+TRACKING_ARCHIVE_AFTER=720h
+TRACKING_ARCHIVE_BATCH_SIZE=100
+`
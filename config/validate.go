@@ -0,0 +1,66 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validate validates every configuration section, reporting all invalid
+// sections at once so a deployment can be fixed in one go
+func Validate() error {
+	sections := []struct {
+		name     string
+		validate func() error
+	}{
+		{"API keys", GetAPIKeysConfig().ValidateAPIKeysConfig},
+		{"alerts", GetAlertConfig().ValidateAlertConfig},
+		{"automatic trip statuses", GetAutoStatusConfig().ValidateAutoStatusConfig},
+		{"cache", GetCacheConfig().ValidateCacheConfig},
+		{"circuit breaker", GetCircuitBreakerConfig().ValidateCircuitBreakerConfig},
+		{"currency", GetCurrencyConfig().ValidateCurrencyConfig},
+		{"delay model", GetDelayModelConfig().ValidateDelayModelConfig},
+		{"detention", GetDetentionConfig().ValidateDetentionConfig},
+		{"device tracking", GetDeviceTrackingConfig().ValidateDeviceTrackingConfig},
+		{"documents", GetDocumentConfig().ValidateDocumentConfig},
+		{"driver scoring", GetDriverScoringConfig().ValidateDriverScoringConfig},
+		{"email", GetEmailConfig().ValidateEmailConfig},
+		{"emissions", GetEmissionsConfig().ValidateEmissionsConfig},
+		{"feature flags", GetFeatureFlagConfig().ValidateFeatureFlagConfig},
+		{"fuel plans", GetFuelPlanConfig().ValidateFuelPlanConfig},
+		{"geocoding", GetGeocodingConfig().ValidateGeocodingConfig},
+		{"gRPC", GetGRPCConfig().ValidateGRPCConfig},
+		{"health checks", GetHealthConfig().ValidateHealthConfig},
+		{"Kafka", GetKafkaConfig().ValidateKafkaConfig},
+		{"location filter", GetLocationFilterConfig().ValidateLocationFilterConfig},
+		{"map matching", GetMapMatchingConfig().ValidateMapMatchingConfig},
+		{"metrics", GetMetricsConfig().ValidateMetricsConfig},
+		{"MQTT", GetMQTTConfig().ValidateMQTTConfig},
+		{"notification queue", GetNotificationQueueConfig().ValidateNotificationQueueConfig},
+		{"notification grouping", GetNotificationGroupingConfig().ValidateNotificationGroupingConfig},
+		{"ops alerts", GetOpsAlertConfig().ValidateOpsAlertConfig},
+		{"outbox", GetOutboxConfig().ValidateOutboxConfig},
+		{"payment", GetPaymentConfig().ValidatePaymentConfig},
+		{"rate limit", GetRateLimitConfig().ValidateRateLimitConfig},
+		{"realtime", GetRealtimeConfig().ValidateRealtimeConfig},
+		{"Redis", GetRedisConfig().ValidateRedisConfig},
+		{"retention", GetRetentionConfig().ValidateRetentionConfig},
+		{"scheduler", GetSchedulerConfig().ValidateSchedulerConfig},
+		{"SMS", GetSMSConfig().ValidateSMSConfig},
+		{"storage", GetStorageConfig().ValidateStorageConfig},
+		{"telematics", GetTelematicsConfig().ValidateTelematicsConfig},
+		{"tolls", GetTollConfig().ValidateTollConfig},
+		{"tracing", GetTracingConfig().ValidateTracingConfig},
+		{"tracking archive", GetTrackingArchiveConfig().ValidateTrackingArchiveConfig},
+		{"vehicle compliance", GetVehicleComplianceConfig().ValidateVehicleComplianceConfig},
+		{"vehicle maintenance", GetVehicleMaintenanceConfig().ValidateVehicleMaintenanceConfig},
+		{"weather", GetWeatherConfig().ValidateWeatherConfig},
+	}
+
+	var errs []error
+	for _, section := range sections {
+		if err := section.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", section.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
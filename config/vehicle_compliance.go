@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VehicleComplianceConfig holds settings for vehicle document expiry checks
+type VehicleComplianceConfig struct {
+	// Reject new trips whose vehicle has an expired insurance, registration
+	// or inspection during the trip
+	BlockNonCompliantTrips bool
+
+	// Days before expiry at which carriers are reminded, most distant first
+	ReminderDays []int
+}
+
+// GetVehicleComplianceConfig returns vehicle compliance configuration from environment variables
+func GetVehicleComplianceConfig() *VehicleComplianceConfig {
+	return &VehicleComplianceConfig{
+		BlockNonCompliantTrips: getEnvBool("VEHICLE_COMPLIANCE_BLOCK_TRIPS", false),
+		ReminderDays:           parseReminderDays(getEnvString("VEHICLE_COMPLIANCE_REMINDER_DAYS", "30,14,3")),
+	}
+}
+
+// ValidateVehicleComplianceConfig validates vehicle compliance configuration
+func (vc *VehicleComplianceConfig) ValidateVehicleComplianceConfig() error {
+	if len(vc.ReminderDays) == 0 {
+		return fmt.Errorf("At least one vehicle compliance reminder day is required")
+	}
+	for _, days := range vc.ReminderDays {
+		if days <= 0 {
+			return fmt.Errorf("Vehicle compliance reminder days must be positive")
+		}
+	}
+	return nil
+}
+
+// parseReminderDays parses a comma separated list of days, sorted descending.
+// Invalid entries are skipped.
+func parseReminderDays(value string) []int {
+	var days []int
+	for _, part := range strings.Split(value, ",") {
+		if d, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			days = append(days, d)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(days)))
+	return days
+}
+
+// Environment configuration template for vehicle compliance
+const VehicleComplianceEnvTemplate = `
+# Vehicle Compliance
+VEHICLE_COMPLIANCE_BLOCK_TRIPS=false
+VEHICLE_COMPLIANCE_REMINDER_DAYS=30,14,3
+`
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// VehicleMaintenanceConfig holds settings for mileage based vehicle
+// maintenance reminders
+type VehicleMaintenanceConfig struct {
+	// Service intervals set up without a distance default to these
+	OilIntervalKm        float64
+	TireIntervalKm       float64
+	InspectionIntervalKm float64
+
+	// Carriers are notified when a service is due within this distance, and
+	// again when it is overdue
+	DueSoonKm float64
+
+	// Recent driving that due dates are estimated from
+	UsageWindow time.Duration
+}
+
+// GetVehicleMaintenanceConfig returns vehicle maintenance configuration from environment variables
+func GetVehicleMaintenanceConfig() *VehicleMaintenanceConfig {
+	return &VehicleMaintenanceConfig{
+		OilIntervalKm:        getEnvFloat("VEHICLE_MAINTENANCE_OIL_INTERVAL_KM", 15000),
+		TireIntervalKm:       getEnvFloat("VEHICLE_MAINTENANCE_TIRE_INTERVAL_KM", 60000),
+		InspectionIntervalKm: getEnvFloat("VEHICLE_MAINTENANCE_INSPECTION_INTERVAL_KM", 100000),
+		DueSoonKm:            getEnvFloat("VEHICLE_MAINTENANCE_DUE_SOON_KM", 1000),
+		UsageWindow:          getEnvDuration("VEHICLE_MAINTENANCE_USAGE_WINDOW", 30*24*time.Hour),
+	}
+}
+
+// ValidateVehicleMaintenanceConfig validates vehicle maintenance configuration
+func (vc *VehicleMaintenanceConfig) ValidateVehicleMaintenanceConfig() error {
+	if vc.OilIntervalKm <= 0 || vc.TireIntervalKm <= 0 || vc.InspectionIntervalKm <= 0 {
+		return fmt.Errorf("Vehicle maintenance intervals must be positive")
+	}
+	if vc.DueSoonKm < 0 {
+		return fmt.Errorf("Vehicle maintenance due soon distance cannot be negative")
+	}
+	if vc.UsageWindow < 24*time.Hour {
+		return fmt.Errorf("Vehicle maintenance usage window must be at least a day")
+	}
+	return nil
+}
+
+// Environment configuration template for vehicle maintenance
+const VehicleMaintenanceEnvTemplate = `
+# Vehicle Maintenance
+VEHICLE_MAINTENANCE_OIL_INTERVAL_KM=15000
+VEHICLE_MAINTENANCE_TIRE_INTERVAL_KM=60000
+VEHICLE_MAINTENANCE_INSPECTION_INTERVAL_KM=100000
+VEHICLE_MAINTENANCE_DUE_SOON_KM=1000
+VEHICLE_MAINTENANCE_USAGE_WINDOW=720h
+`
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// WeatherConfig holds settings for adjusting ETAs to the weather forecast
+// along trips' remaining routes and alerting on severe weather ahead
+type WeatherConfig struct {
+	// A trip's route forecast is reused for ETAs until it is this old
+	RefreshInterval time.Duration
+
+	// Only the part of the route reached within this many hours is forecast
+	LookaheadHours int
+
+	// Distance between the points of the route that are forecast, widened
+	// so that no more than MaxSamples points are forecast per trip
+	SampleIntervalKm float64
+	MaxSamples       int
+
+	// Driving speed as a fraction of normal in rain, snow and fog. Fog is
+	// also assumed below FogVisibilityKm of visibility.
+	RainSpeedFactor float64
+	SnowSpeedFactor float64
+	FogSpeedFactor  float64
+	FogVisibilityKm float64
+
+	// Weather is severe with thunderstorms, snow, or beyond these limits.
+	// Precipitation is per 3 hour forecast period.
+	SevereWindKmh         float64
+	SeverePrecipitationMm float64
+	SevereVisibilityKm    float64
+
+	// A trip is alerted of the same hazard at most once in this period
+	AlertCooldown time.Duration
+}
+
+// GetWeatherConfig returns weather configuration from environment variables
+func GetWeatherConfig() *WeatherConfig {
+	return &WeatherConfig{
+		RefreshInterval:       getEnvDuration("WEATHER_REFRESH_INTERVAL", 30*time.Minute),
+		LookaheadHours:        getEnvInt("WEATHER_LOOKAHEAD_HOURS", 6),
+		SampleIntervalKm:      getEnvFloat("WEATHER_SAMPLE_INTERVAL_KM", 50),
+		MaxSamples:            getEnvInt("WEATHER_MAX_SAMPLES", 8),
+		RainSpeedFactor:       getEnvFloat("WEATHER_RAIN_SPEED_FACTOR", 0.9),
+		SnowSpeedFactor:       getEnvFloat("WEATHER_SNOW_SPEED_FACTOR", 0.6),
+		FogSpeedFactor:        getEnvFloat("WEATHER_FOG_SPEED_FACTOR", 0.75),
+		FogVisibilityKm:       getEnvFloat("WEATHER_FOG_VISIBILITY_KM", 1),
+		SevereWindKmh:         getEnvFloat("WEATHER_SEVERE_WIND_KMH", 75),
+		SeverePrecipitationMm: getEnvFloat("WEATHER_SEVERE_PRECIPITATION_MM", 15),
+		SevereVisibilityKm:    getEnvFloat("WEATHER_SEVERE_VISIBILITY_KM", 0.2),
+		AlertCooldown:         getEnvDuration("WEATHER_ALERT_COOLDOWN", 6*time.Hour),
+	}
+}
+
+// ValidateWeatherConfig validates weather configuration
+func (wc *WeatherConfig) ValidateWeatherConfig() error {
+	if wc.RefreshInterval <= 0 {
+		return fmt.Errorf("Refresh interval must be positive")
+	}
+	if wc.LookaheadHours <= 0 {
+		return fmt.Errorf("Lookahead hours must be positive")
+	}
+	if wc.SampleIntervalKm <= 0 {
+		return fmt.Errorf("Sample interval must be positive")
+	}
+	if wc.MaxSamples <= 0 {
+		return fmt.Errorf("Max samples must be positive")
+	}
+	if !validSpeedFactor(wc.RainSpeedFactor) || !validSpeedFactor(wc.SnowSpeedFactor) || !validSpeedFactor(wc.FogSpeedFactor) {
+		return fmt.Errorf("Speed factors must be greater than 0 and at most 1")
+	}
+	if wc.FogVisibilityKm < 0 || wc.SevereVisibilityKm < 0 {
+		return fmt.Errorf("Visibility limits cannot be negative")
+	}
+	if wc.SevereWindKmh <= 0 || wc.SeverePrecipitationMm <= 0 {
+		return fmt.Errorf("Severe wind and precipitation limits must be positive")
+	}
+	if wc.AlertCooldown < 0 {
+		return fmt.Errorf("Alert cooldown cannot be negative")
+	}
+	return nil
+}
+
+// validSpeedFactor reports whether a fraction of normal speed is usable
+func validSpeedFactor(factor float64) bool {
+	return factor > 0 && factor <= 1
+}
+
+// Environment configuration template for weather
+const WeatherEnvTemplate = `
+# Weather-Aware ETAs and Alerts
+WEATHER_REFRESH_INTERVAL=30m
+WEATHER_LOOKAHEAD_HOURS=6
+WEATHER_SAMPLE_INTERVAL_KM=50
+WEATHER_MAX_SAMPLES=8
+WEATHER_RAIN_SPEED_FACTOR=0.9
+WEATHER_SNOW_SPEED_FACTOR=0.6
+WEATHER_FOG_SPEED_FACTOR=0.75
+WEATHER_FOG_VISIBILITY_KM=1
+WEATHER_SEVERE_WIND_KMH=75
+WEATHER_SEVERE_PRECIPITATION_MM=15
+WEATHER_SEVERE_VISIBILITY_KM=0.2
+WEATHER_ALERT_COOLDOWN=6h
+`
@@ -2,16 +2,24 @@ package database
 
 import (
 	"fmt"
+	"time"
+
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"triplink/backend/models"
 )
 
-// DB is no longer a global variable. Functions will receive it as a parameter.
+// DB is the connection opened by Connect, used by the handlers
+var DB *gorm.DB
 
+// Connect opens the database. The schema is managed by the versioned
+// migrations in database/migrations, applied with cmd/migrate.
 func Connect() *gorm.DB {
-	dsn := "host=localhost user=wowcard password=password dbname=triplink port=5432 sslmode=disable"
-	database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// Times are stored and read in UTC, whatever the server's timezone; they
+	// are shown in local time only when rendered
+	dsn := "host=localhost user=wowcard password=password dbname=triplink port=5432 sslmode=disable TimeZone=UTC"
+	database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
 
 	if err != nil {
 		panic("Failed to connect to database!")
@@ -19,22 +27,6 @@ func Connect() *gorm.DB {
 
 	fmt.Println("Database connection successfully opened")
 
-	database.AutoMigrate(
-		&models.User{},
-		&models.Vehicle{},
-		&models.Trip{},
-		&models.Load{},
-		&models.Quote{},
-		&models.Message{},
-		&models.Transaction{},
-		&models.Review{},
-		&models.Notification{},
-		&models.Manifest{},
-		&models.CustomsDocument{},
-		&models.NotificationToken{},
-		&models.NotificationPreferences{},
-		&models.NotificationDelivery{},
-	)
-
+	DB = database
 	return database
 }
\ No newline at end of file
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// initialSchema creates the users, trips, loads and the marketplace tables
+// around them
+var initialSchema = &gormigrate.Migration{
+	ID: "0001_initial_schema",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(
+			&models.User{},
+			&models.Vehicle{},
+			&models.Trip{},
+			&models.Load{},
+			&models.Quote{},
+			&models.Message{},
+			&models.Transaction{},
+			&models.Review{},
+			&models.Notification{},
+			&models.Manifest{},
+			&models.CustomsDocument{},
+			&models.NotificationToken{},
+			&models.NotificationPreferences{},
+			&models.NotificationDelivery{},
+		)
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(
+			&models.NotificationDelivery{},
+			&models.NotificationPreferences{},
+			&models.NotificationToken{},
+			&models.CustomsDocument{},
+			&models.Manifest{},
+			&models.Notification{},
+			&models.Review{},
+			&models.Transaction{},
+			&models.Message{},
+			&models.Quote{},
+			&models.Load{},
+			&models.Trip{},
+			&models.Vehicle{},
+			&models.User{},
+		)
+	},
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// trackingSchema creates the tables for live trip tracking
+var trackingSchema = &gormigrate.Migration{
+	ID: "0002_tracking_schema",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(
+			&models.TrackingRecord{},
+			&models.TrackingStatus{},
+			&models.TrackingEvent{},
+		)
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(
+			&models.TrackingEvent{},
+			&models.TrackingStatus{},
+			&models.TrackingRecord{},
+		)
+	},
+}
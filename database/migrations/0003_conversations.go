@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// conversations creates the tables grouping messages into conversations
+var conversations = &gormigrate.Migration{
+	ID: "0003_conversations",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(
+			&models.Conversation{},
+			&models.ConversationParticipant{},
+		)
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(
+			&models.ConversationParticipant{},
+			&models.Conversation{},
+		)
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// loadProofs creates the proof of delivery table
+var loadProofs = &gormigrate.Migration{
+	ID: "0004_load_proofs",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.LoadProof{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.LoadProof{})
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// notificationDigests creates the table queuing notifications for digests
+var notificationDigests = &gormigrate.Migration{
+	ID: "0005_notification_digests",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.NotificationDigestEntry{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.NotificationDigestEntry{})
+	},
+}
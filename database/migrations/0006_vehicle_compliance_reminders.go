@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// vehicleComplianceReminders records the vehicle document expiry reminders sent
+var vehicleComplianceReminders = &gormigrate.Migration{
+	ID: "0006_vehicle_compliance_reminders",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.VehicleComplianceReminder{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.VehicleComplianceReminder{})
+	},
+}
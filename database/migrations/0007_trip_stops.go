@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// tripStops creates the trip itinerary table
+var tripStops = &gormigrate.Migration{
+	ID: "0007_trip_stops",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TripStop{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.TripStop{})
+	},
+}
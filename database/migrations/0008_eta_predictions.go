@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// etaPredictions stores ETA predictions for measuring ETA accuracy
+var etaPredictions = &gormigrate.Migration{
+	ID: "0008_eta_predictions",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.ETAPrediction{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.ETAPrediction{})
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// reportSubscriptions creates the scheduled analytics report table
+var reportSubscriptions = &gormigrate.Migration{
+	ID: "0009_report_subscriptions",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.ReportSubscription{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.ReportSubscription{})
+	},
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// dataRetention creates the retention policy and cleanup run tables
+var dataRetention = &gormigrate.Migration{
+	ID: "0010_data_retention",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(
+			&models.RetentionPolicy{},
+			&models.RetentionRun{},
+			&models.RetentionRunResult{},
+		)
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(
+			&models.RetentionRunResult{},
+			&models.RetentionRun{},
+			&models.RetentionPolicy{},
+		)
+	},
+}
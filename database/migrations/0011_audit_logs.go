@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// auditLogs creates the audit log of mutating API calls
+var auditLogs = &gormigrate.Migration{
+	ID: "0011_audit_logs",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.AuditLog{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.AuditLog{})
+	},
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// userVerificationColumns are the columns added for admin verification and
+// suspension of accounts
+var userVerificationColumns = []string{
+	"VerificationStatus", "VerificationNote", "VerifiedAt", "VerifiedBy", "SuspendedAt", "SuspensionReason",
+}
+
+// userVerification adds account verification and suspension to users.
+// Accounts already verified are marked approved.
+var userVerification = &gormigrate.Migration{
+	ID: "0012_user_verification",
+	Migrate: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&models.User{}); err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("is_verified = ?", true).Update("verification_status", "APPROVED").Error
+	},
+	Rollback: func(tx *gorm.DB) error {
+		for _, column := range userVerificationColumns {
+			if err := tx.Migrator().DropColumn(&models.User{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
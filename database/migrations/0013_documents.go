@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// documents creates the documents uploaded through the document service
+var documents = &gormigrate.Migration{
+	ID: "0013_documents",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Document{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.Document{})
+	},
+}
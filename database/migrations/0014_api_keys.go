@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// apiKeys creates the API keys of machine-to-machine integrations
+var apiKeys = &gormigrate.Migration{
+	ID: "0014_api_keys",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.ApiKey{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.ApiKey{})
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// telematicsConnections creates the carriers' telematics provider accounts
+var telematicsConnections = &gormigrate.Migration{
+	ID: "0015_telematics_connections",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TelematicsConnection{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.TelematicsConnection{})
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// notificationDeadLetters creates the deliveries the notification queue gave up on
+var notificationDeadLetters = &gormigrate.Migration{
+	ID: "0016_notification_dead_letters",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.NotificationDeadLetter{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.NotificationDeadLetter{})
+	},
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// smsPreferenceColumns are the notification preference columns added for SMS
+var smsPreferenceColumns = []string{"SMSEnabled", "SMSDelays", "SMSPickupReminders"}
+
+// smsNotifications adds phone verification, SMS preferences and pickup
+// reminder tracking for SMS notifications
+var smsNotifications = &gormigrate.Migration{
+	ID: "0017_sms_notifications",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.User{}, &models.NotificationPreferences{}, &models.Load{}, &models.PhoneVerification{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&models.PhoneVerification{}); err != nil {
+			return err
+		}
+		for _, column := range smsPreferenceColumns {
+			if err := tx.Migrator().DropColumn(&models.NotificationPreferences{}, column); err != nil {
+				return err
+			}
+		}
+		if err := tx.Migrator().DropColumn(&models.Load{}, "PickupReminderSentAt"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.User{}, "PhoneVerifiedAt")
+	},
+}
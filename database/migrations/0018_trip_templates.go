@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// tripTemplates creates trip templates and links trips to the template they
+// were created from
+var tripTemplates = &gormigrate.Migration{
+	ID: "0018_trip_templates",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TripTemplate{}, &models.Trip{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropColumn(&models.Trip{}, "TemplateID"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&models.TripTemplate{})
+	},
+}
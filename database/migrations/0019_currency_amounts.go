@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// baseAmountColumns are the columns holding an amount in the base currency
+var baseAmountColumns = []string{"BaseAmount", "BaseCurrency", "ExchangeRate"}
+
+// currencyAmounts stores the base currency amounts of quotes and payments
+var currencyAmounts = &gormigrate.Migration{
+	ID: "0019_currency_amounts",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Quote{}, &models.Transaction{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.Quote{}, &models.Transaction{}} {
+			for _, column := range baseAmountColumns {
+				if err := tx.Migrator().DropColumn(model, column); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// invoices adds invoices of delivered loads and their line items
+var invoices = &gormigrate.Migration{
+	ID: "0020_invoices",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Invoice{}, &models.InvoiceLineItem{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.InvoiceLineItem{}, &models.Invoice{})
+	},
+}
@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// stopDwellTimes adds the dwell and detention times of trip stops
+var stopDwellTimes = &gormigrate.Migration{
+	ID: "0021_stop_dwell_times",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TripStop{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		for _, column := range []string{"DwellMinutes", "DetentionMinutes", "DetentionCharge"} {
+			if err := tx.Migrator().DropColumn(&models.TripStop{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
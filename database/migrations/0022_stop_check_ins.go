@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// stopCheckIns adds drivers' check-ins at and check-outs of trip stops
+var stopCheckIns = &gormigrate.Migration{
+	ID: "0022_stop_check_ins",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.StopCheckIn{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.StopCheckIn{})
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// savedLocations adds users' address books
+var savedLocations = &gormigrate.Migration{
+	ID: "0023_saved_locations",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.SavedLocation{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.SavedLocation{})
+	},
+}
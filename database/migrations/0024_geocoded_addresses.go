@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// geocodedAddresses adds the cache of geocoded addresses
+var geocodedAddresses = &gormigrate.Migration{
+	ID: "0024_geocoded_addresses",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.GeocodedAddress{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.GeocodedAddress{})
+	},
+}
@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// trackingRecordMatches adds tracking records' positions snapped to roads
+var trackingRecordMatches = &gormigrate.Migration{
+	ID: "0025_tracking_record_matches",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TrackingRecord{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		for _, column := range []string{"MatchedLatitude", "MatchedLongitude", "MatchConfidence"} {
+			if err := tx.Migrator().DropColumn(&models.TrackingRecord{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// trackingRecordBattery adds the battery level reported with tracking records
+var trackingRecordBattery = &gormigrate.Migration{
+	ID: "0026_tracking_record_battery",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TrackingRecord{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&models.TrackingRecord{}, "BatteryLevel")
+	},
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// tripAssignments adds drivers assigned to trips, and the driver who posted
+// each tracking record
+var tripAssignments = &gormigrate.Migration{
+	ID: "0027_trip_assignments",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TripAssignment{}, &models.TrackingRecord{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropColumn(&models.TrackingRecord{}, "DriverID"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&models.TripAssignment{})
+	},
+}
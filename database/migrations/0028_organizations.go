@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// organizations adds carrier and shipper organizations and scopes trips and
+// loads to them. Users who already have trips or loads get an organization
+// of their own that they own, holding them.
+var organizations = &gormigrate.Migration{
+	ID: "0028_organizations",
+	Migrate: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&models.Organization{}, &models.OrganizationMembership{}, &models.Trip{}, &models.Load{}); err != nil {
+			return err
+		}
+		return backfillOrganizations(tx)
+	},
+	Rollback: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropColumn(&models.Trip{}, "OrganizationID"); err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropColumn(&models.Load{}, "OrganizationID"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&models.OrganizationMembership{}, &models.Organization{})
+	},
+}
+
+// backfillOrganizations creates an organization for each user owning trips
+// or loads, named after their company
+func backfillOrganizations(tx *gorm.DB) error {
+	var users []models.User
+	if err := tx.Select("id", "email", "role", "company_name").
+		Where("id IN (?) OR id IN (?)",
+			tx.Model(&models.Trip{}).Select("user_id"),
+			tx.Model(&models.Load{}).Select("shipper_id")).
+		Find(&users).Error; err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		organization := models.Organization{Name: user.CompanyName, Type: "CARRIER", OwnerID: user.ID}
+		if organization.Name == "" {
+			organization.Name = user.Email
+		}
+		if user.Role == "SHIPPER" {
+			organization.Type = "SHIPPER"
+		}
+		if err := tx.Create(&organization).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.OrganizationMembership{
+			OrganizationID: organization.ID,
+			UserID:         user.ID,
+			Role:           "OWNER",
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Trip{}).Where("user_id = ? AND organization_id IS NULL", user.ID).
+			Update("organization_id", organization.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Load{}).Where("shipper_id = ? AND organization_id IS NULL", user.ID).
+			Update("organization_id", organization.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
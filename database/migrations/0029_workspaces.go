@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// workspaces adds users' saved filters and dashboards
+var workspaces = &gormigrate.Migration{
+	ID: "0029_workspaces",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.SavedFilter{}, &models.Dashboard{}, &models.DashboardWidget{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.DashboardWidget{}, &models.Dashboard{}, &models.SavedFilter{})
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// telematicsDevices adds the devices and gateways streaming positions over gRPC
+var telematicsDevices = &gormigrate.Migration{
+	ID: "0030_telematics_devices",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TelematicsDevice{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.TelematicsDevice{})
+	},
+}
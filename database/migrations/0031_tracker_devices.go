@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// trackerDevices adds the hardware GPS trackers positions are bridged from
+var trackerDevices = &gormigrate.Migration{
+	ID: "0031_tracker_devices",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TrackerDevice{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.TrackerDevice{})
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// outboxEvents adds the outbox tracking events are published from
+var outboxEvents = &gormigrate.Migration{
+	ID: "0032_outbox_events",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.OutboxEvent{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.OutboxEvent{})
+	},
+}
@@ -0,0 +1,111 @@
+package migrations
+
+import (
+	"strings"
+	"sync"
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// trackingRecordPartitions partitions tracking_records by month on Postgres
+// and adds the archive closed trips' records are moved to. Existing records
+// stay in the default partition; monthly partitions are created ahead of
+// time by the tracking archive job.
+var trackingRecordPartitions = &gormigrate.Migration{
+	ID: "0033_tracking_record_partitions",
+	Migrate: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&models.Trip{}, &models.ArchivedTrackingRecord{}); err != nil {
+			return err
+		}
+		if tx.Dialector.Name() == "postgres" {
+			if err := execAll(tx,
+				`ALTER TABLE tracking_records RENAME TO tracking_records_default`,
+				`ALTER TABLE tracking_records_default RENAME CONSTRAINT tracking_records_pkey TO tracking_records_default_pkey`,
+				`ALTER INDEX IF EXISTS idx_tracking_records_deleted_at RENAME TO idx_tracking_records_default_deleted_at`,
+				`ALTER INDEX IF EXISTS idx_tracking_records_driver_id RENAME TO idx_tracking_records_default_driver_id`,
+				`CREATE TABLE tracking_records (LIKE tracking_records_default INCLUDING DEFAULTS) PARTITION BY RANGE ("timestamp")`,
+				// The partition key must be part of the primary key
+				`ALTER TABLE tracking_records ADD PRIMARY KEY (id, "timestamp")`,
+				`ALTER TABLE tracking_records ATTACH PARTITION tracking_records_default DEFAULT`,
+			); err != nil {
+				return err
+			}
+			// Indexes of the parent are created on every partition
+			if err := tx.AutoMigrate(&models.TrackingRecord{}); err != nil {
+				return err
+			}
+		}
+		return execAll(tx,
+			`CREATE INDEX IF NOT EXISTS idx_tracking_records_trip_timestamp ON tracking_records (trip_id, "timestamp")`,
+			`CREATE INDEX IF NOT EXISTS idx_tracking_records_archive_trip_timestamp ON tracking_records_archive (trip_id, "timestamp")`,
+		)
+	},
+	Rollback: func(tx *gorm.DB) error {
+		if err := execAll(tx,
+			`DROP INDEX IF EXISTS idx_tracking_records_trip_timestamp`,
+			`DROP INDEX IF EXISTS idx_tracking_records_archive_trip_timestamp`,
+		); err != nil {
+			return err
+		}
+
+		if tx.Dialector.Name() == "postgres" {
+			// The sequence belongs to the default partition, which is dropped
+			// with the partitioned table
+			if err := execAll(tx,
+				`CREATE TABLE tracking_records_unpartitioned (LIKE tracking_records INCLUDING DEFAULTS)`,
+				`INSERT INTO tracking_records_unpartitioned SELECT * FROM tracking_records`,
+				`ALTER SEQUENCE tracking_records_id_seq OWNED BY NONE`,
+				`DROP TABLE tracking_records`,
+				`ALTER TABLE tracking_records_unpartitioned RENAME TO tracking_records`,
+				`ALTER TABLE tracking_records ADD PRIMARY KEY (id)`,
+				`ALTER SEQUENCE tracking_records_id_seq OWNED BY tracking_records.id`,
+			); err != nil {
+				return err
+			}
+			if err := tx.AutoMigrate(&models.TrackingRecord{}); err != nil {
+				return err
+			}
+		}
+
+		// Archived records go back to the trips they were moved from
+		columns, err := trackingRecordColumns(tx)
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec("INSERT INTO tracking_records (" + columns + ") SELECT " + columns + " FROM tracking_records_archive").Error; err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropTable(&models.ArchivedTrackingRecord{}); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.Trip{}, "TrackingArchivedAt")
+	},
+}
+
+func execAll(tx *gorm.DB, statements ...string) error {
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trackingRecordColumns returns the quoted columns of tracking_records. Columns
+// added by later migrations are left out, as they are rolled back first.
+func trackingRecordColumns(tx *gorm.DB) (string, error) {
+	s, err := schema.Parse(&models.TrackingRecord{}, &sync.Map{}, tx.NamingStrategy)
+	if err != nil {
+		return "", err
+	}
+	columns := make([]string, 0, len(s.DBNames))
+	for _, name := range s.DBNames {
+		if tx.Migrator().HasColumn("tracking_records", name) {
+			columns = append(columns, `"`+name+`"`)
+		}
+	}
+	return strings.Join(columns, ", "), nil
+}
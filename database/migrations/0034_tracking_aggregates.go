@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// trackingAggregates adds the downsampled tracking history of trips
+var trackingAggregates = &gormigrate.Migration{
+	ID: "0034_tracking_aggregates",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TrackingAggregate{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.TrackingAggregate{})
+	},
+}
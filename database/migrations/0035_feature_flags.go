@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// featureFlags adds the flags features are rolled out behind
+var featureFlags = &gormigrate.Migration{
+	ID: "0035_feature_flags",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.FeatureFlag{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.FeatureFlag{})
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// tripEmissions adds the estimated fuel use and CO2 emissions of trips
+var tripEmissions = &gormigrate.Migration{
+	ID: "0036_trip_emissions",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TripEmission{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.TripEmission{})
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// tripFuelPlans adds the fuel stops planned along trips' routes
+var tripFuelPlans = &gormigrate.Migration{
+	ID: "0037_trip_fuel_plans",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TripFuelPlan{}, &models.TripFuelStop{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.TripFuelStop{}, &models.TripFuelPlan{})
+	},
+}
@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// tripTolls adds the expected toll costs of trips' planned routes
+var tripTolls = &gormigrate.Migration{
+	ID: "0038_trip_tolls",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Trip{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		for _, column := range []string{"TollCost", "TollCurrency", "TollRoutePolyline", "TollsCalculatedAt"} {
+			if err := tx.Migrator().DropColumn(&models.Trip{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// trackingWeather adds the weather forecast on trips' remaining routes to
+// their tracking status
+var trackingWeather = &gormigrate.Migration{
+	ID: "0039_tracking_weather",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TrackingStatus{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		for _, column := range []string{"WeatherCondition", "WeatherSlowdown", "WeatherCheckedAt"} {
+			if err := tx.Migrator().DropColumn(&models.TrackingStatus{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// delayModel adds trips' scheduled arrival, the trained delay prediction
+// models and their predictions. Trips that haven't started are scheduled to
+// arrive at their current estimated arrival.
+var delayModel = &gormigrate.Migration{
+	ID: "0040_delay_model",
+	Migrate: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&models.Trip{}, &models.DelayModel{}, &models.DelayPrediction{}); err != nil {
+			return err
+		}
+		return tx.Model(&models.Trip{}).Where("scheduled_arrival IS NULL AND status = ?", "PLANNED").
+			Update("scheduled_arrival", gorm.Expr("estimated_arrival")).Error
+	},
+	Rollback: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&models.DelayPrediction{}, &models.DelayModel{}); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.Trip{}, "ScheduledArrival")
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// feedback adds shippers' post-delivery feedback and its analysis
+var feedback = &gormigrate.Migration{
+	ID: "0041_feedback",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Feedback{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.Feedback{})
+	},
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// trackingRecordSpeedLimits adds the posted speed limit reported with
+// tracking records, to the records and their archive
+var trackingRecordSpeedLimits = &gormigrate.Migration{
+	ID: "0042_tracking_record_speed_limits",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TrackingRecord{}, &models.ArchivedTrackingRecord{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropColumn(&models.ArchivedTrackingRecord{}, "SpeedLimit"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.TrackingRecord{}, "SpeedLimit")
+	},
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// vehicleMaintenance adds vehicles' tracked mileage and the service intervals
+// they are due every so many kilometers
+var vehicleMaintenance = &gormigrate.Migration{
+	ID: "0043_vehicle_maintenance",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Vehicle{}, &models.VehicleServiceInterval{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&models.VehicleServiceInterval{}); err != nil {
+			return err
+		}
+		for _, column := range []string{"TrackedKm", "OdometerOffsetKm"} {
+			if err := tx.Migrator().DropColumn(&models.Vehicle{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// userUnitSystem adds the system of measurement users want responses and
+// notifications in
+var userUnitSystem = &gormigrate.Migration{
+	ID: "0044_user_unit_system",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.User{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&models.User{}, "UnitSystem")
+	},
+}
@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"triplink/backend/internal/timezone"
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// tripTimezones adds the timezones of trips' origins and destinations, found
+// from the coordinates of existing trips
+var tripTimezones = &gormigrate.Migration{
+	ID: "0045_trip_timezones",
+	Migrate: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&models.Trip{}); err != nil {
+			return err
+		}
+		return backfillTripTimezones(tx)
+	},
+	Rollback: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropColumn(&models.Trip{}, "OriginTimezone"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.Trip{}, "DestinationTimezone")
+	},
+}
+
+// backfillTripTimezones sets the timezones of trips with coordinates
+func backfillTripTimezones(tx *gorm.DB) error {
+	var trips []models.Trip
+	return tx.Select("id", "origin_lat", "origin_lng", "destination_lat", "destination_lng").
+		Where("origin_timezone = '' OR origin_timezone IS NULL").
+		FindInBatches(&trips, 500, func(*gorm.DB, int) error {
+			for _, trip := range trips {
+				if err := tx.Model(&models.Trip{}).Where("id = ?", trip.ID).Updates(map[string]interface{}{
+					"origin_timezone":      timezone.Lookup(trip.OriginLat, trip.OriginLng),
+					"destination_timezone": timezone.Lookup(trip.DestinationLat, trip.DestinationLng),
+				}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
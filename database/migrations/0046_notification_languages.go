@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// notificationLanguages adds the language users get notifications in, and
+// the catalog keys notifications were rendered from
+var notificationLanguages = &gormigrate.Migration{
+	ID: "0046_notification_languages",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.User{}, &models.Notification{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		for _, column := range []string{"MessageKey", "MessageParams"} {
+			if err := tx.Migrator().DropColumn(&models.Notification{}, column); err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropColumn(&models.User{}, "Language")
+	},
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// loadMilestoneETAs adds the pickup and delivery ETAs of loads to their
+// tracking status
+var loadMilestoneETAs = &gormigrate.Migration{
+	ID: "0047_load_milestone_etas",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TrackingStatus{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		for _, column := range []string{"PickupETA", "DeliveryETA"} {
+			if err := tx.Migrator().DropColumn(&models.TrackingStatus{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// tripProgress adds the distance a trip covered along its route to its
+// tracking status
+var tripProgress = &gormigrate.Migration{
+	ID: "0048_trip_progress",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TrackingStatus{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		for _, column := range []string{"DistanceCoveredKm", "RouteDistanceKm"} {
+			if err := tx.Migrator().DropColumn(&models.TrackingStatus{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// locationSmoothing adds the smoothed position of tracking records, to the
+// records and their archive
+var locationSmoothing = &gormigrate.Migration{
+	ID: "0049_location_smoothing",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TrackingRecord{}, &models.ArchivedTrackingRecord{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.ArchivedTrackingRecord{}, &models.TrackingRecord{}} {
+			for _, column := range []string{"SmoothedLatitude", "SmoothedLongitude", "SmoothedAccuracy"} {
+				if err := tx.Migrator().DropColumn(model, column); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// tripStatusSuggestions adds the status changes proposed to carriers from
+// their trips' tracking data
+var tripStatusSuggestions = &gormigrate.Migration{
+	ID: "0050_trip_status_suggestions",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.TripStatusSuggestion{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.TripStatusSuggestion{})
+	},
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// statusVersions adds the version trip and load status changes are checked
+// against
+var statusVersions = &gormigrate.Migration{
+	ID: "0051_status_versions",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Trip{}, &models.Load{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.Load{}, &models.Trip{}} {
+			if err := tx.Migrator().DropColumn(model, "Version"); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// notificationGrouping adds the count of notifications collapsed into one
+var notificationGrouping = &gormigrate.Migration{
+	ID: "0052_notification_grouping",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Notification{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&models.Notification{}, "GroupCount")
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// notificationArchive adds when notifications were archived by their user
+var notificationArchive = &gormigrate.Migration{
+	ID: "0053_notification_archive",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Notification{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&models.Notification{}, "ArchivedAt")
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// opsChannels adds the Slack and Teams channels organizations get alerts in
+var opsChannels = &gormigrate.Migration{
+	ID: "0054_ops_channels",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.OpsChannel{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.OpsChannel{})
+	},
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"triplink/backend/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// driverAvailability adds the shifts and time off drivers declare
+var driverAvailability = &gormigrate.Migration{
+	ID: "0055_driver_availability",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.DriverAvailability{})
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&models.DriverAvailability{})
+	},
+}
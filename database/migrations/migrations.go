@@ -0,0 +1,132 @@
+// Package migrations holds the versioned database schema. Migrations run in
+// the order of All and are recorded in the schema_migrations table, so an
+// upgrade only applies the migrations a database hasn't seen yet.
+//
+// Migrations apply model definitions with AutoMigrate, which only adds
+// missing tables, columns and indexes. A later model change is therefore a
+// new migration auto-migrating the model again; renames, drops and data
+// changes are written out explicitly.
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// TableName is the table applied migrations are recorded in
+const TableName = "schema_migrations"
+
+// All returns every migration, oldest first. New migrations are appended.
+func All() []*gormigrate.Migration {
+	return []*gormigrate.Migration{
+		initialSchema,
+		trackingSchema,
+		conversations,
+		loadProofs,
+		notificationDigests,
+		vehicleComplianceReminders,
+		tripStops,
+		etaPredictions,
+		reportSubscriptions,
+		dataRetention,
+		auditLogs,
+		userVerification,
+		documents,
+		apiKeys,
+		telematicsConnections,
+		notificationDeadLetters,
+		smsNotifications,
+		tripTemplates,
+		currencyAmounts,
+		invoices,
+		stopDwellTimes,
+		stopCheckIns,
+		savedLocations,
+		geocodedAddresses,
+		trackingRecordMatches,
+		trackingRecordBattery,
+		tripAssignments,
+		organizations,
+		workspaces,
+		telematicsDevices,
+		trackerDevices,
+		outboxEvents,
+		trackingRecordPartitions,
+		trackingAggregates,
+		featureFlags,
+		tripEmissions,
+		tripFuelPlans,
+		tripTolls,
+		trackingWeather,
+		delayModel,
+		feedback,
+		trackingRecordSpeedLimits,
+		vehicleMaintenance,
+		userUnitSystem,
+		tripTimezones,
+		notificationLanguages,
+		loadMilestoneETAs,
+		tripProgress,
+		locationSmoothing,
+		tripStatusSuggestions,
+		statusVersions,
+		notificationGrouping,
+		notificationArchive,
+		opsChannels,
+		driverAvailability,
+	}
+}
+
+// New creates a migrator for db
+func New(db *gorm.DB) *gormigrate.Gormigrate {
+	return gormigrate.New(db, &gormigrate.Options{
+		TableName:                 TableName,
+		IDColumnName:              "id",
+		IDColumnSize:              255,
+		ValidateUnknownMigrations: true,
+	}, All())
+}
+
+// MigrationStatus tells whether a migration was applied to the database
+type MigrationStatus struct {
+	ID      string
+	Applied bool
+}
+
+// Status returns every migration with whether it was applied
+func Status(db *gorm.DB) ([]MigrationStatus, error) {
+	applied := make(map[string]bool)
+	if db.Migrator().HasTable(TableName) {
+		var ids []string
+		if err := db.Table(TableName).Pluck("id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		for _, id := range ids {
+			applied[id] = true
+		}
+	}
+
+	var status []MigrationStatus
+	for _, migration := range All() {
+		status = append(status, MigrationStatus{ID: migration.ID, Applied: applied[migration.ID]})
+	}
+	return status, nil
+}
+
+// Pending returns the IDs of the migrations not applied yet
+func Pending(db *gorm.DB) ([]string, error) {
+	status, err := Status(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, migration := range status {
+		if !migration.Applied {
+			pending = append(pending, migration.ID)
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,139 @@
+package migrations
+
+import (
+	"testing"
+	"time"
+	"triplink/backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	// A single connection keeps every query on the same in-memory database
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	return db
+}
+
+func TestMigrationIDsAreUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, migration := range All() {
+		assert.False(t, seen[migration.ID], "duplicate migration %s", migration.ID)
+		assert.NotNil(t, migration.Rollback, "migration %s can't be rolled back", migration.ID)
+		seen[migration.ID] = true
+	}
+}
+
+func TestMigrateAndRollback(t *testing.T) {
+	db := openTestDB(t)
+
+	pending, err := Pending(db)
+	require.NoError(t, err)
+	assert.Len(t, pending, len(All()))
+
+	require.NoError(t, New(db).Migrate())
+
+	pending, err = Pending(db)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	for _, model := range []interface{}{&models.User{}, &models.Trip{}, &models.TrackingRecord{}, &models.RetentionRun{}} {
+		assert.True(t, db.Migrator().HasTable(model))
+	}
+
+	// Migrating again is a no-op
+	require.NoError(t, New(db).Migrate())
+
+	all := All()
+	require.NoError(t, New(db).RollbackLast())
+	pending, err = Pending(db)
+	require.NoError(t, err)
+	assert.Equal(t, []string{all[len(all)-1].ID}, pending)
+
+	require.NoError(t, New(db).RollbackTo(initialSchema.ID))
+	assert.True(t, db.Migrator().HasTable(&models.Trip{}))
+	assert.False(t, db.Migrator().HasTable(&models.TrackingRecord{}))
+
+	status, err := Status(db)
+	require.NoError(t, err)
+	assert.True(t, status[0].Applied)
+	assert.False(t, status[1].Applied)
+}
+
+func TestOrganizationsBackfill(t *testing.T) {
+	db := openTestDB(t)
+	require.NoError(t, New(db).MigrateTo(tripAssignments.ID))
+
+	carrier := models.User{Email: "carrier@example.com", Phone: "+15550000001", Role: "CARRIER", CompanyName: "Haulage Co"}
+	shipper := models.User{Email: "shipper@example.com", Phone: "+15550000002", Role: "SHIPPER"}
+	require.NoError(t, db.Create(&carrier).Error)
+	require.NoError(t, db.Create(&shipper).Error)
+	require.NoError(t, db.Omit("OrganizationID").Create(&models.Trip{UserID: carrier.ID}).Error)
+	require.NoError(t, db.Omit("OrganizationID").Create(&models.Load{ShipperID: shipper.ID, BookingReference: "LOAD-1"}).Error)
+
+	require.NoError(t, New(db).Migrate())
+
+	var organizations []models.Organization
+	require.NoError(t, db.Order("id ASC").Find(&organizations).Error)
+	require.Len(t, organizations, 2)
+	assert.Equal(t, "Haulage Co", organizations[0].Name)
+	assert.Equal(t, "CARRIER", organizations[0].Type)
+	assert.Equal(t, "shipper@example.com", organizations[1].Name)
+	assert.Equal(t, "SHIPPER", organizations[1].Type)
+
+	var trip models.Trip
+	require.NoError(t, db.First(&trip).Error)
+	require.NotNil(t, trip.OrganizationID)
+	assert.Equal(t, organizations[0].ID, *trip.OrganizationID)
+	var load models.Load
+	require.NoError(t, db.First(&load).Error)
+	require.NotNil(t, load.OrganizationID)
+	assert.Equal(t, organizations[1].ID, *load.OrganizationID)
+
+	var owners int64
+	db.Model(&models.OrganizationMembership{}).Where("role = ?", "OWNER").Count(&owners)
+	assert.Equal(t, int64(2), owners)
+}
+
+func TestTrackingRecordPartitionsRollbackRestoresArchive(t *testing.T) {
+	db := openTestDB(t)
+	require.NoError(t, New(db).MigrateTo(trackingRecordPartitions.ID))
+
+	record := models.ArchivedTrackingRecord{
+		TrackingRecord: models.TrackingRecord{TripID: 7, Latitude: -17.8, Longitude: 31.0, Source: "GPS"},
+		ArchivedAt:     time.Now(),
+	}
+	require.NoError(t, db.Create(&record).Error)
+
+	require.NoError(t, New(db).RollbackMigration(trackingRecordPartitions))
+	assert.False(t, db.Migrator().HasTable(&models.ArchivedTrackingRecord{}))
+
+	var restored models.TrackingRecord
+	require.NoError(t, db.First(&restored, record.ID).Error)
+	assert.Equal(t, uint(7), restored.TripID)
+	assert.Equal(t, -17.8, restored.Latitude)
+}
+
+func TestTripTimezonesBackfill(t *testing.T) {
+	db := openTestDB(t)
+	require.NoError(t, New(db).MigrateTo(userUnitSystem.ID))
+
+	located := models.Trip{OriginLat: 41.8781, OriginLng: -87.6298, DestinationLat: 34.0522, DestinationLng: -118.2437}
+	require.NoError(t, db.Omit("OriginTimezone", "DestinationTimezone").Create(&located).Error)
+	unlocated := models.Trip{}
+	require.NoError(t, db.Omit("OriginTimezone", "DestinationTimezone").Create(&unlocated).Error)
+
+	require.NoError(t, New(db).Migrate())
+
+	require.NoError(t, db.First(&located, located.ID).Error)
+	assert.Equal(t, "America/Chicago", located.OriginTimezone)
+	assert.Equal(t, "America/Los_Angeles", located.DestinationTimezone)
+	require.NoError(t, db.First(&unlocated, unlocated.ID).Error)
+	assert.Empty(t, unlocated.OriginTimezone)
+}
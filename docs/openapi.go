@@ -0,0 +1,8 @@
+package docs
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI 3 spec of the API, generated by cmd/openapi
+//
+//go:embed openapi.json
+var OpenAPI []byte
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"triplink/backend/database"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var userAdminService = services.NewUserAdminService(database.DB)
+
+var errAccountSuspended = errors.New("account suspended")
+
+// CheckAccountActive rejects requests of suspended accounts. It is used as
+// auth.AccountCheck.
+func CheckAccountActive(userID uint) error {
+	if userAdminService.IsSuspended(userID) {
+		return errAccountSuspended
+	}
+	return nil
+}
+
+// AccountRole returns the stored role of a user. It is used as
+// auth.AccountRole.
+func AccountRole(userID uint) (string, error) {
+	return userAdminService.Role(userID)
+}
+
+// adminUserAction responds to the result of an admin action on a user
+func adminUserAction(c *fiber.Ctx, result interface{}, err error) error {
+	if err != nil {
+		status := 400
+		if err.Error() == "user not found" {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(result)
+}
+
+// parseUserID reads the id path parameter of a user
+func parseUserID(c *fiber.Ctx) (uint, error) {
+	userID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	return uint(userID), err
+}
+
+// GetAdminUsers @Summary List user accounts for review
+// @Description List registered accounts, newest first, e.g. carriers awaiting verification with verification_status=PENDING
+// @Tags admin
+// @Produce json
+// @Param role query string false "Role (CARRIER, SHIPPER, ADMIN)"
+// @Param verification_status query string false "Verification status (PENDING, APPROVED, REJECTED)"
+// @Param suspended query bool false "Only suspended, or only active, accounts"
+// @Param q query string false "Search email, name and company name"
+// @Param limit query int false "Number of users to return (default 50)"
+// @Param offset query int false "Number of users to skip (default 0, ignored with cursor)"
+// @Param cursor query string false "Cursor from next_cursor of the previous page"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/users [get]
+func GetAdminUsers(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	page, err := parsePageParams(c, 50)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
+	}
+
+	filter := services.UserAdminFilter{
+		Role:               c.Query("role"),
+		VerificationStatus: c.Query("verification_status"),
+		Search:             c.Query("q"),
+	}
+	if value := c.Query("suspended"); value != "" {
+		suspended, err := strconv.ParseBool(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid suspended filter",
+			})
+		}
+		filter.Suspended = &suspended
+	}
+
+	query := userAdminService.UsersQuery(filter)
+
+	var total int64
+	query.Session(&gorm.Session{}).Count(&total)
+
+	var users []models.User
+	if err := page.paginate(query, "created_at").Find(&users).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch users",
+		})
+	}
+
+	nextCursor := ""
+	if page.hasMore(len(users)) {
+		users = users[:page.Limit]
+		last := users[len(users)-1]
+		nextCursor = encodePageCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        users,
+		"count":       len(users),
+		"total":       total,
+		"limit":       page.Limit,
+		"offset":      page.Offset,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	})
+}
+
+// GetAdminUser @Summary Get a user account for review
+// @Description Get an account with its vehicles and the verification checks of its license and insurance documents
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/users/{id} [get]
+func GetAdminUser(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	userID, err := parseUserID(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	user, err := userAdminService.GetUser(userID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"user":                user,
+		"verification_checks": userAdminService.VerificationChecks(user),
+	})
+}
+
+// ApproveUserVerification @Summary Approve a user's verification
+// @Description Verify an account. Carriers must have a valid driver license, a business license and an insured active vehicle. The user is notified.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body object false "Approval note: {note}"
+// @Success 200 {object} models.User
+// @Router /admin/users/{id}/verification/approve [post]
+func ApproveUserVerification(c *fiber.Ctx) error {
+	adminID, status, message := adminUserID(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	userID, err := parseUserID(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+	}
+
+	user, err := userAdminService.ApproveVerification(userID, adminID, req.Note)
+	if err != nil && err.Error() != "user not found" {
+		// Show the admin which documents are missing
+		response := fiber.Map{"error": err.Error()}
+		if user, getErr := userAdminService.GetUser(userID); getErr == nil {
+			response["verification_checks"] = userAdminService.VerificationChecks(user)
+		}
+		return c.Status(400).JSON(response)
+	}
+	return adminUserAction(c, user, err)
+}
+
+// RejectUserVerification @Summary Reject a user's verification
+// @Description Reject an account's verification. The reason is sent to the user.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body object true "Rejection: {reason}"
+// @Success 200 {object} models.User
+// @Router /admin/users/{id}/verification/reject [post]
+func RejectUserVerification(c *fiber.Ctx) error {
+	adminID, status, message := adminUserID(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	userID, err := parseUserID(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	user, err := userAdminService.RejectVerification(userID, adminID, req.Reason)
+	return adminUserAction(c, user, err)
+}
+
+// SuspendUser @Summary Suspend a user account
+// @Description Suspend an account. Suspended users can't sign in or call the API until reinstated. The user is notified.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body object true "Suspension: {reason}"
+// @Success 200 {object} models.User
+// @Router /admin/users/{id}/suspend [post]
+func SuspendUser(c *fiber.Ctx) error {
+	adminID, status, message := adminUserID(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	userID, err := parseUserID(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	user, err := userAdminService.SuspendUser(userID, adminID, req.Reason)
+	return adminUserAction(c, user, err)
+}
+
+// ReinstateUser @Summary Reinstate a suspended user account
+// @Description Lift an account's suspension. The user is notified.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.User
+// @Router /admin/users/{id}/reinstate [post]
+func ReinstateUser(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	userID, err := parseUserID(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	user, err := userAdminService.ReinstateUser(userID)
+	return adminUserAction(c, user, err)
+}
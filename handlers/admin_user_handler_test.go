@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/auth"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type AdminUserHandlerTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	admin   models.User
+	carrier models.User
+}
+
+func (suite *AdminUserHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+	userAdminService = services.NewUserAdminService(testDB)
+
+	suite.admin = models.User{Email: "admin@example.com", Phone: "+1987654321", Password: "password", Role: "ADMIN"}
+	testDB.Create(&suite.admin)
+	suite.carrier = models.User{Email: "carrier@example.com", Phone: "+1555000111", Password: "password", Role: "CARRIER", CompanyName: "Acme Haulage"}
+	testDB.Create(&suite.carrier)
+
+	suite.app = fiber.New()
+
+	// Act as the user given in the X-User-ID header, with the role claim of
+	// the X-Role header or else their role
+	suite.app.Use(func(c *fiber.Ctx) error {
+		if userID, err := strconv.Atoi(c.Get("X-User-ID")); err == nil {
+			var user models.User
+			testDB.First(&user, userID)
+			c.Locals("user_id", float64(userID))
+			c.Locals("role", c.Get("X-Role", user.Role))
+		}
+		return c.Next()
+	})
+	auth.AccountRole = AccountRole
+
+	admin := suite.app.Group("/admin", auth.RequireRole("ADMIN"))
+	admin.Get("/users", GetAdminUsers)
+	admin.Get("/users/:id", GetAdminUser)
+	admin.Post("/users/:id/verification/approve", ApproveUserVerification)
+	admin.Post("/users/:id/verification/reject", RejectUserVerification)
+	admin.Post("/users/:id/suspend", SuspendUser)
+	admin.Post("/users/:id/reinstate", ReinstateUser)
+}
+
+func (suite *AdminUserHandlerTestSuite) TearDownTest() {
+	auth.AccountRole = nil
+	clearTestDB()
+}
+
+func (suite *AdminUserHandlerTestSuite) request(method, url string, userID uint, body interface{}) (int, []byte) {
+	jsonData, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var respBody bytes.Buffer
+	respBody.ReadFrom(resp.Body)
+	return resp.StatusCode, respBody.Bytes()
+}
+
+func (suite *AdminUserHandlerTestSuite) carrierURL(action string) string {
+	return "/admin/users/" + strconv.Itoa(int(suite.carrier.ID)) + action
+}
+
+func (suite *AdminUserHandlerTestSuite) notificationTypes(userID uint) []string {
+	var types []string
+	testDB.Model(&models.Notification{}).Where("user_id = ?", userID).Order("id").Pluck("type", &types)
+	return types
+}
+
+func (suite *AdminUserHandlerTestSuite) TestListPendingRegistrations() {
+	t := suite.T()
+
+	status, body := suite.request("GET", "/admin/users?role=carrier&verification_status=PENDING", suite.admin.ID, nil)
+	assert.Equal(t, 200, status)
+
+	var page struct {
+		Data  []models.User `json:"data"`
+		Total int64         `json:"total"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &page))
+	if assert.Len(t, page.Data, 1) {
+		assert.Equal(t, suite.carrier.ID, page.Data[0].ID)
+		assert.Equal(t, services.VerificationPending, page.Data[0].VerificationStatus)
+	}
+	assert.Equal(t, int64(1), page.Total)
+
+	status, body = suite.request("GET", "/admin/users?q=acme", suite.admin.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.NoError(t, json.Unmarshal(body, &page))
+	assert.Len(t, page.Data, 1)
+
+	// Only admins can review accounts
+	status, _ = suite.request("GET", "/admin/users", suite.carrier.ID, nil)
+	assert.Equal(t, 403, status)
+}
+
+func (suite *AdminUserHandlerTestSuite) TestRoleClaimNotTrusted() {
+	t := suite.T()
+
+	// A token claiming ADMIN for a carrier is refused
+	req := httptest.NewRequest("GET", "/admin/users", nil)
+	req.Header.Set("X-User-ID", strconv.Itoa(int(suite.carrier.ID)))
+	req.Header.Set("X-Role", "ADMIN")
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	// As is the token of an admin whose role has since changed
+	testDB.Model(&suite.admin).Update("role", "SHIPPER")
+	req = httptest.NewRequest("GET", "/admin/users", nil)
+	req.Header.Set("X-User-ID", strconv.Itoa(int(suite.admin.ID)))
+	req.Header.Set("X-Role", "ADMIN")
+	resp, err = suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	assert.Equal(t, 403, resp.StatusCode)
+}
+
+func (suite *AdminUserHandlerTestSuite) TestCarrierVerification() {
+	t := suite.T()
+
+	// The carrier hasn't provided license or insurance documents
+	status, body := suite.request("POST", suite.carrierURL("/verification/approve"), suite.admin.ID, nil)
+	assert.Equal(t, 400, status)
+	var failed struct {
+		Checks []services.VerificationCheck `json:"verification_checks"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &failed))
+	assert.Len(t, failed.Checks, 4)
+	for _, check := range failed.Checks {
+		assert.False(t, check.Passed, check.Name)
+	}
+
+	expiry := time.Now().AddDate(1, 0, 0)
+	testDB.Model(&suite.carrier).Updates(models.User{
+		DriverLicense:   "uploads/license.pdf",
+		LicenseNumber:   "DL-12345",
+		LicenseExpiry:   &expiry,
+		BusinessLicense: "uploads/business.pdf",
+	})
+	testDB.Create(&models.Vehicle{UserID: suite.carrier.ID, LicensePlate: "ABC-123", IsActive: true, InsuranceExpiry: &expiry})
+
+	status, body = suite.request("GET", suite.carrierURL(""), suite.admin.ID, nil)
+	assert.Equal(t, 200, status)
+	var review struct {
+		Checks []services.VerificationCheck `json:"verification_checks"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &review))
+	for _, check := range review.Checks {
+		assert.True(t, check.Passed, check.Name)
+	}
+
+	status, body = suite.request("POST", suite.carrierURL("/verification/approve"), suite.admin.ID, fiber.Map{"note": "Documents checked"})
+	assert.Equal(t, 200, status)
+	var user models.User
+	assert.NoError(t, json.Unmarshal(body, &user))
+	assert.True(t, user.IsVerified)
+	assert.Equal(t, services.VerificationApproved, user.VerificationStatus)
+	if assert.NotNil(t, user.VerifiedBy) {
+		assert.Equal(t, suite.admin.ID, *user.VerifiedBy)
+	}
+
+	// A rejection needs a reason
+	status, _ = suite.request("POST", suite.carrierURL("/verification/reject"), suite.admin.ID, fiber.Map{})
+	assert.Equal(t, 400, status)
+
+	status, body = suite.request("POST", suite.carrierURL("/verification/reject"), suite.admin.ID, fiber.Map{"reason": "Business license doesn't match company name"})
+	assert.Equal(t, 200, status)
+	assert.NoError(t, json.Unmarshal(body, &user))
+	assert.False(t, user.IsVerified)
+	assert.Equal(t, services.VerificationRejected, user.VerificationStatus)
+
+	assert.Equal(t, []string{"ACCOUNT_VERIFIED", "ACCOUNT_VERIFICATION_REJECTED"}, suite.notificationTypes(suite.carrier.ID))
+
+	status, _ = suite.request("POST", "/admin/users/99999/verification/approve", suite.admin.ID, nil)
+	assert.Equal(t, 404, status)
+}
+
+func (suite *AdminUserHandlerTestSuite) TestSuspendAndReinstate() {
+	t := suite.T()
+
+	status, _ := suite.request("POST", suite.carrierURL("/suspend"), suite.admin.ID, fiber.Map{"reason": "Fraudulent bookings"})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, errAccountSuspended, CheckAccountActive(suite.carrier.ID))
+
+	// Suspending twice, or suspending yourself, is rejected
+	status, _ = suite.request("POST", suite.carrierURL("/suspend"), suite.admin.ID, fiber.Map{"reason": "Again"})
+	assert.Equal(t, 400, status)
+	status, _ = suite.request("POST", "/admin/users/"+strconv.Itoa(int(suite.admin.ID))+"/suspend", suite.admin.ID, fiber.Map{"reason": "Oops"})
+	assert.Equal(t, 400, status)
+
+	status, _ = suite.request("GET", "/admin/users?suspended=true", suite.admin.ID, nil)
+	assert.Equal(t, 200, status)
+
+	status, body := suite.request("POST", suite.carrierURL("/reinstate"), suite.admin.ID, nil)
+	assert.Equal(t, 200, status)
+	var user models.User
+	assert.NoError(t, json.Unmarshal(body, &user))
+	assert.Nil(t, user.SuspendedAt)
+	assert.NoError(t, CheckAccountActive(suite.carrier.ID))
+
+	assert.Equal(t, []string{"ACCOUNT_SUSPENDED", "ACCOUNT_REINSTATED"}, suite.notificationTypes(suite.carrier.ID))
+}
+
+func TestAdminUserHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(AdminUserHandlerTestSuite))
+}
@@ -3,23 +3,30 @@ package handlers
 import (
 	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"triplink/backend/database"
-	"triplink/backend/models"
 	"triplink/backend/services"
 )
 
+var analyticsService = services.NewAnalyticsService(database.DB)
+
+// analyticsCache caches analytics results. It is shared so that requests
+// reuse one Redis connection pool rather than each opening their own.
+var analyticsCache = services.NewRedisService()
+
 // Analytics request/response structures
 type AnalyticsFilters struct {
 	DateRange   *DateRange `json:"date_range,omitempty"`
 	VehicleIDs  []uint     `json:"vehicle_ids,omitempty"`
 	DriverIDs   []uint     `json:"driver_ids,omitempty"`
-	RouteIDs    []uint     `json:"route_ids,omitempty"`
+	RouteIDs    []string   `json:"route_ids,omitempty"` // route_id of the delivery performance by route
 	CustomerIDs []uint     `json:"customer_ids,omitempty"`
+	Currency    string     `json:"currency,omitempty"` // of revenue, defaults to the base currency
 }
 
 type DateRange struct {
@@ -27,95 +34,23 @@ type DateRange struct {
 	End   string `json:"end"`
 }
 
-// On-Time Delivery Analytics
-type OnTimeDeliveryMetrics struct {
-	TotalDeliveries     int     `json:"total_deliveries"`
-	OnTimeDeliveries    int     `json:"on_time_deliveries"`
-	OnTimePercentage    float64 `json:"on_time_percentage"`
-	AverageDelay        float64 `json:"average_delay"` // minutes
-	EarlyDeliveries     int     `json:"early_deliveries"`
-	LateDeliveries      int     `json:"late_deliveries"`
-	CriticalDelays      int     `json:"critical_delays"`
-	AverageDeliveryTime float64 `json:"average_delivery_time"` // hours
-	OnTimeImprovement   float64 `json:"on_time_improvement"`   // percentage change
-}
-
-type DeliveryPerformanceByRoute struct {
-	RouteID          string  `json:"route_id"`
-	RouteName        string  `json:"route_name"`
-	Origin           string  `json:"origin"`
-	Destination      string  `json:"destination"`
-	Distance         float64 `json:"distance"`
-	TotalDeliveries  int     `json:"total_deliveries"`
-	OnTimeDeliveries int     `json:"on_time_deliveries"`
-	OnTimePercentage float64 `json:"on_time_percentage"`
-	AverageDelay     float64 `json:"average_delay"`
-	Improvement      float64 `json:"improvement"`
-	RiskLevel        string  `json:"risk_level"`
-}
-
-type DeliveryPerformanceByDriver struct {
-	DriverID             string  `json:"driver_id"`
-	DriverName           string  `json:"driver_name"`
-	TotalDeliveries      int     `json:"total_deliveries"`
-	OnTimeDeliveries     int     `json:"on_time_deliveries"`
-	OnTimePercentage     float64 `json:"on_time_percentage"`
-	AverageDelay         float64 `json:"average_delay"`
-	EarlyDeliveries      int     `json:"early_deliveries"`
-	LateDeliveries       int     `json:"late_deliveries"`
-	PerformanceRating    float64 `json:"performance_rating"`
-	ImprovementTrend     string  `json:"improvement_trend"`
-	TrainingRecommended  bool    `json:"training_recommended"`
-}
-
-// Customer Satisfaction Analytics
-type CustomerSatisfactionMetrics struct {
-	OverallScore              float64 `json:"overall_score"`
-	TotalResponses            int     `json:"total_responses"`
-	ResponseRate              float64 `json:"response_rate"`
-	ScoreImprovement          float64 `json:"score_improvement"`
-	NPSScore                  int     `json:"nps_score"`
-	SatisfiedCustomers        int     `json:"satisfied_customers"`
-	NeutralCustomers          int     `json:"neutral_customers"`
-	DissatisfiedCustomers     int     `json:"dissatisfied_customers"`
-	RetentionRate             float64 `json:"retention_rate"`
-	ChurnRate                 float64 `json:"churn_rate"`
-	AverageResponseTime       float64 `json:"average_response_time"`
-	ResolutionRate            float64 `json:"resolution_rate"`
-}
-
 type CustomerFeedback struct {
-	FeedbackID     string    `json:"feedback_id"`
-	CustomerID     string    `json:"customer_id"`
-	CustomerName   string    `json:"customer_name"`
-	TripID         string    `json:"trip_id"`
-	RouteName      string    `json:"route_name"`
-	DriverName     string    `json:"driver_name"`
-	Rating         int       `json:"rating"`
-	Category       string    `json:"category"`
-	Sentiment      string    `json:"sentiment"`
-	Comment        string    `json:"comment"`
-	SubmittedAt    time.Time `json:"submitted_at"`
-	Status         string    `json:"status"`
-	Priority       string    `json:"priority"`
-	ResponseTime   float64   `json:"response_time"`
-	Resolved       bool      `json:"resolved"`
-	FollowUpRequired bool    `json:"follow_up_required"`
-}
-
-// Load Matching Analytics
-type LoadMatchingMetrics struct {
-	TotalLoads              int     `json:"total_loads"`
-	MatchedLoads            int     `json:"matched_loads"`
-	MatchingRate            float64 `json:"matching_rate"`
-	AverageMatchTime        float64 `json:"average_match_time"` // hours
-	OptimalMatches          int     `json:"optimal_matches"`
-	SuboptimalMatches       int     `json:"suboptimal_matches"`
-	UnmatchedLoads          int     `json:"unmatched_loads"`
-	UtilizationRate         float64 `json:"utilization_rate"`
-	RevenueEfficiency       float64 `json:"revenue_efficiency"`
-	CostEfficiency          float64 `json:"cost_efficiency"`
-	ImprovementOpportunity  float64 `json:"improvement_opportunity"`
+	FeedbackID       string    `json:"feedback_id"`
+	CustomerID       string    `json:"customer_id"`
+	CustomerName     string    `json:"customer_name"`
+	TripID           string    `json:"trip_id"`
+	RouteName        string    `json:"route_name"`
+	DriverName       string    `json:"driver_name"`
+	Rating           int       `json:"rating"`
+	Category         string    `json:"category"`
+	Sentiment        string    `json:"sentiment"`
+	Comment          string    `json:"comment"`
+	SubmittedAt      time.Time `json:"submitted_at"`
+	Status           string    `json:"status"`
+	Priority         string    `json:"priority"`
+	ResponseTime     float64   `json:"response_time"`
+	Resolved         bool      `json:"resolved"`
+	FollowUpRequired bool      `json:"follow_up_required"`
 }
 
 type LoadMatchingData struct {
@@ -139,83 +74,29 @@ type LoadMatchingData struct {
 	ProfitMargin     float64   `json:"profit_margin"`
 }
 
-// Capacity Utilization Analytics
-type CapacityMetrics struct {
-	TotalCapacity         float64 `json:"total_capacity"`
-	UtilizedCapacity      float64 `json:"utilized_capacity"`
-	UtilizationRate       float64 `json:"utilization_rate"`
-	AvailableCapacity     float64 `json:"available_capacity"`
-	PeakUtilization       float64 `json:"peak_utilization"`
-	AverageUtilization    float64 `json:"average_utilization"`
-	CapacityEfficiency    float64 `json:"capacity_efficiency"`
-	RevenuePerCapacityUnit float64 `json:"revenue_per_capacity_unit"`
-	CostPerCapacityUnit   float64 `json:"cost_per_capacity_unit"`
-	CapacityTrend         string  `json:"capacity_trend"`
-	DemandVsCapacity      float64 `json:"demand_vs_capacity"`
-	ForecastedDemand      float64 `json:"forecasted_demand"`
-}
-
-type VehicleCapacityData struct {
-	VehicleID          string    `json:"vehicle_id"`
-	VehicleNumber      string    `json:"vehicle_number"`
-	VehicleType        string    `json:"vehicle_type"`
-	MaxCapacity        float64   `json:"max_capacity"`
-	MaxVolume          float64   `json:"max_volume"`
-	CurrentLoad        float64   `json:"current_load"`
-	CurrentVolume      float64   `json:"current_volume"`
-	WeightUtilization  float64   `json:"weight_utilization"`
-	VolumeUtilization  float64   `json:"volume_utilization"`
-	OverallUtilization float64   `json:"overall_utilization"`
-	Trips              int       `json:"trips"`
-	Revenue            float64   `json:"revenue"`
-	OperatingCosts     float64   `json:"operating_costs"`
-	Profitability      float64   `json:"profitability"`
-	Efficiency         string    `json:"efficiency"`
-	Location           string    `json:"location"`
-	Status             string    `json:"status"`
-	LastUpdated        time.Time `json:"last_updated"`
-	UtilizationTrend   string    `json:"utilization_trend"`
-}
-
-// Delay Analysis Analytics
-type DelayMetrics struct {
-	TotalDelays            int     `json:"total_delays"`
-	AverageDelayDuration   float64 `json:"average_delay_duration"` // minutes
-	DelayFrequency         float64 `json:"delay_frequency"`        // delays per 100 trips
-	TotalDelayTime         float64 `json:"total_delay_time"`       // total minutes lost
-	CostOfDelays           float64 `json:"cost_of_delays"`
-	CustomerImpact         float64 `json:"customer_impact"`
-	OnTimePerformance      float64 `json:"on_time_performance"`
-	DelayTrend             string  `json:"delay_trend"`
-	RecurrentDelays        int     `json:"recurrent_delays"`
-	PreventableDelays      int     `json:"preventable_delays"`
-	MitigatedDelays        int     `json:"mitigated_delays"`
-	ImprovementOpportunity float64 `json:"improvement_opportunity"`
-}
-
 type DelayIncident struct {
-	IncidentID         string    `json:"incident_id"`
-	TripID             string    `json:"trip_id"`
-	VehicleID          string    `json:"vehicle_id"`
-	DriverID           string    `json:"driver_id"`
-	RouteID            string    `json:"route_id"`
-	Origin             string    `json:"origin"`
-	Destination        string    `json:"destination"`
-	ScheduledDeparture time.Time `json:"scheduled_departure"`
-	ActualDeparture    time.Time `json:"actual_departure"`
-	ScheduledArrival   time.Time `json:"scheduled_arrival"`
-	ActualArrival      time.Time `json:"actual_arrival"`
-	DelayDuration      float64   `json:"delay_duration"` // minutes
-	DelayType          string    `json:"delay_type"`
-	Severity           string    `json:"severity"`
-	CustomerNotified   bool      `json:"customer_notified"`
-	ResolutionTime     float64   `json:"resolution_time"`
-	Preventable        bool      `json:"preventable"`
-	Recurrent          bool      `json:"recurrent"`
-	CostImpact         float64   `json:"cost_impact"`
-	CustomerImpact     string    `json:"customer_impact"`
-	Status             string    `json:"status"`
-	ReportedAt         time.Time `json:"reported_at"`
+	IncidentID         string     `json:"incident_id"`
+	TripID             string     `json:"trip_id"`
+	VehicleID          string     `json:"vehicle_id"`
+	DriverID           string     `json:"driver_id"`
+	RouteID            string     `json:"route_id"`
+	Origin             string     `json:"origin"`
+	Destination        string     `json:"destination"`
+	ScheduledDeparture time.Time  `json:"scheduled_departure"`
+	ActualDeparture    time.Time  `json:"actual_departure"`
+	ScheduledArrival   time.Time  `json:"scheduled_arrival"`
+	ActualArrival      time.Time  `json:"actual_arrival"`
+	DelayDuration      float64    `json:"delay_duration"` // minutes
+	DelayType          string     `json:"delay_type"`
+	Severity           string     `json:"severity"`
+	CustomerNotified   bool       `json:"customer_notified"`
+	ResolutionTime     float64    `json:"resolution_time"`
+	Preventable        bool       `json:"preventable"`
+	Recurrent          bool       `json:"recurrent"`
+	CostImpact         float64    `json:"cost_impact"`
+	CustomerImpact     string     `json:"customer_impact"`
+	Status             string     `json:"status"`
+	ReportedAt         time.Time  `json:"reported_at"`
 	ResolvedAt         *time.Time `json:"resolved_at,omitempty"`
 }
 
@@ -225,105 +106,45 @@ type DelayIncident struct {
 // @Tags Analytics
 // @Accept json
 // @Produce json
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
 // @Param filters body AnalyticsFilters true "Analytics filters"
-// @Success 200 {object} OnTimeDeliveryMetrics
+// @Param format query string false "json (default), or csv or xlsx to download the report"
+// @Success 200 {object} services.OnTimeDeliveryMetrics
 // @Router /api/analytics/on-time-delivery [post]
 func GetOnTimeDeliveryAnalytics(c *fiber.Ctx) error {
-	var filters AnalyticsFilters
-	if err := c.BodyParser(&filters); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	filter, err := parseAnalyticsFilters(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	format, err := analyticsExportFormat(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if format != "" {
+		return sendAnalyticsReport(c, filter, format, services.ReportOnTimeDelivery, services.ReportOnTimeDelivery)
 	}
 
-	// Initialize Redis service for caching
-	redisService := services.NewRedisService()
-	
 	// Generate cache key based on filters
-	filterHash := generateFilterHash(filters)
-	
+	filterHash := generateFilterHash(filter)
+
 	// Try to get from cache first
-	var cachedMetrics OnTimeDeliveryMetrics
-	if err := redisService.GetCachedAnalyticsResult("on_time_delivery", filterHash, &cachedMetrics); err == nil {
+	var cachedMetrics services.OnTimeDeliveryMetrics
+	if err := analyticsCache.GetCachedAnalyticsResult("on_time_delivery", filterHash, &cachedMetrics); err == nil {
 		c.Set("X-Cache", "HIT")
 		return c.JSON(cachedMetrics)
 	}
 
-	// Build query based on filters
-	query := database.DB.Table("trips")
-	
-	if filters.DateRange != nil {
-		if filters.DateRange.Start != "" {
-			query = query.Where("departure_date >= ?", filters.DateRange.Start)
-		}
-		if filters.DateRange.End != "" {
-			query = query.Where("departure_date <= ?", filters.DateRange.End)
-		}
-	}
-
-	if len(filters.VehicleIDs) > 0 {
-		query = query.Where("vehicle_id IN ?", filters.VehicleIDs)
-	}
-
-	// Calculate metrics from database
-	var totalDeliveries int64
-	var onTimeDeliveries int64
-	var lateDeliveries int64
-	var earlyDeliveries int64
-
-	// Get total completed trips
-	query.Where("status = ?", "COMPLETED").Count(&totalDeliveries)
-
-	// Count on-time deliveries (delivered within 30 minutes of estimated arrival)
-	database.DB.Table("trips").
-		Where("status = ?", "COMPLETED").
-		Where("ABS(EXTRACT(EPOCH FROM (actual_arrival - estimated_arrival))/60) <= 30").
-		Count(&onTimeDeliveries)
-
-	// Count late deliveries
-	database.DB.Table("trips").
-		Where("status = ?", "COMPLETED").
-		Where("actual_arrival > estimated_arrival + INTERVAL '30 minutes'").
-		Count(&lateDeliveries)
-
-	// Count early deliveries
-	database.DB.Table("trips").
-		Where("status = ?", "COMPLETED").
-		Where("actual_arrival < estimated_arrival - INTERVAL '30 minutes'").
-		Count(&earlyDeliveries)
-
-	// Calculate on-time percentage
-	var onTimePercentage float64
-	if totalDeliveries > 0 {
-		onTimePercentage = (float64(onTimeDeliveries) / float64(totalDeliveries)) * 100
-	}
-
-	// Calculate average delay
-	var avgDelayResult struct {
-		AverageDelay float64
-	}
-	database.DB.Raw(`
-		SELECT AVG(EXTRACT(EPOCH FROM (actual_arrival - estimated_arrival))/60) as average_delay
-		FROM trips 
-		WHERE status = 'COMPLETED' 
-		AND actual_arrival > estimated_arrival
-	`).Scan(&avgDelayResult)
-
-	metrics := OnTimeDeliveryMetrics{
-		TotalDeliveries:     int(totalDeliveries),
-		OnTimeDeliveries:    int(onTimeDeliveries),
-		OnTimePercentage:    onTimePercentage,
-		AverageDelay:        avgDelayResult.AverageDelay,
-		EarlyDeliveries:     int(earlyDeliveries),
-		LateDeliveries:      int(lateDeliveries),
-		CriticalDelays:      0, // Calculate critical delays (>2 hours)
-		AverageDeliveryTime: 0, // Calculate from trip duration
-		OnTimeImprovement:   0, // Calculate trend
+	metrics, err := analyticsService.GetOnTimeDeliveryMetrics(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to calculate on-time delivery metrics"})
 	}
 
 	// Cache the result
 	go func() {
-		redisService.CacheAnalyticsResult("on_time_delivery", filterHash, metrics)
+		analyticsCache.CacheAnalyticsResult("on_time_delivery", filterHash, metrics)
 	}()
-	
+
 	c.Set("X-Cache", "MISS")
 	return c.JSON(metrics)
 }
@@ -333,44 +154,32 @@ func GetOnTimeDeliveryAnalytics(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Param filters body AnalyticsFilters true "Analytics filters"
-// @Success 200 {array} DeliveryPerformanceByRoute
+// @Success 200 {array} services.DeliveryPerformanceByRoute
 // @Router /api/analytics/delivery-performance/by-route [post]
 func GetDeliveryPerformanceByRoute(c *fiber.Ctx) error {
-	var filters AnalyticsFilters
-	if err := c.BodyParser(&filters); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	filter, err := parseAnalyticsFilters(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	filterHash := generateFilterHash(filter)
+
+	var cachedRoutes []services.DeliveryPerformanceByRoute
+	if err := analyticsCache.GetCachedAnalyticsResult("delivery_performance_by_route", filterHash, &cachedRoutes); err == nil {
+		c.Set("X-Cache", "HIT")
+		return c.JSON(cachedRoutes)
 	}
 
-	// Mock data for now - replace with actual database queries
-	routes := []DeliveryPerformanceByRoute{
-		{
-			RouteID:          "RT001",
-			RouteName:        "LA-Phoenix Express",
-			Origin:           "Los Angeles, CA",
-			Destination:      "Phoenix, AZ",
-			Distance:         372,
-			TotalDeliveries:  95,
-			OnTimeDeliveries: 87,
-			OnTimePercentage: 91.6,
-			AverageDelay:     12,
-			Improvement:      3.2,
-			RiskLevel:        "low",
-		},
-		{
-			RouteID:          "RT002",
-			RouteName:        "SF-Sacramento",
-			Origin:           "San Francisco, CA",
-			Destination:      "Sacramento, CA",
-			Distance:         87,
-			TotalDeliveries:  78,
-			OnTimeDeliveries: 65,
-			OnTimePercentage: 83.3,
-			AverageDelay:     28,
-			Improvement:      -1.8,
-			RiskLevel:        "medium",
-		},
+	routes, err := analyticsService.GetRoutePerformance(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to calculate route performance"})
 	}
 
+	go func() {
+		analyticsCache.CacheAnalyticsResult("delivery_performance_by_route", filterHash, routes)
+	}()
+
+	c.Set("X-Cache", "MISS")
 	return c.JSON(routes)
 }
 
@@ -379,76 +188,32 @@ func GetDeliveryPerformanceByRoute(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Param filters body AnalyticsFilters true "Analytics filters"
-// @Success 200 {array} DeliveryPerformanceByDriver
+// @Success 200 {array} services.DeliveryPerformanceByDriver
 // @Router /api/analytics/delivery-performance/by-driver [post]
 func GetDeliveryPerformanceByDriver(c *fiber.Ctx) error {
-	var filters AnalyticsFilters
-	if err := c.BodyParser(&filters); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	filter, err := parseAnalyticsFilters(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Query database for driver performance
-	var drivers []DeliveryPerformanceByDriver
-
-	// Get users who are drivers (carriers) and their trip performance
-	rows, err := database.DB.Raw(`
-		SELECT 
-			u.id as driver_id,
-			CONCAT(u.first_name, ' ', u.last_name) as driver_name,
-			COUNT(t.id) as total_deliveries,
-			COUNT(CASE WHEN ABS(EXTRACT(EPOCH FROM (t.actual_arrival - t.estimated_arrival))/60) <= 30 THEN 1 END) as on_time_deliveries,
-			AVG(CASE WHEN t.actual_arrival > t.estimated_arrival THEN EXTRACT(EPOCH FROM (t.actual_arrival - t.estimated_arrival))/60 ELSE 0 END) as average_delay,
-			COUNT(CASE WHEN t.actual_arrival < t.estimated_arrival - INTERVAL '30 minutes' THEN 1 END) as early_deliveries,
-			COUNT(CASE WHEN t.actual_arrival > t.estimated_arrival + INTERVAL '30 minutes' THEN 1 END) as late_deliveries,
-			u.rating as performance_rating
-		FROM users u
-		JOIN trips t ON u.id = t.user_id
-		WHERE u.role = 'CARRIER' AND t.status = 'COMPLETED'
-		GROUP BY u.id, u.first_name, u.last_name, u.rating
-	`).Rows()
+	filterHash := generateFilterHash(filter)
+
+	var cachedDrivers []services.DeliveryPerformanceByDriver
+	if err := analyticsCache.GetCachedAnalyticsResult("delivery_performance_by_driver", filterHash, &cachedDrivers); err == nil {
+		c.Set("X-Cache", "HIT")
+		return c.JSON(cachedDrivers)
+	}
 
+	drivers, err := analyticsService.GetDriverPerformance(filter)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var driver DeliveryPerformanceByDriver
-		var totalDeliveries, onTimeDeliveries, earlyDeliveries, lateDeliveries int
-		var averageDelay, performanceRating float64
-		var driverName string
-		var driverID string
-
-		err := rows.Scan(
-			&driverID, &driverName, &totalDeliveries, &onTimeDeliveries,
-			&averageDelay, &earlyDeliveries, &lateDeliveries, &performanceRating,
-		)
-		if err != nil {
-			continue
-		}
-
-		var onTimePercentage float64
-		if totalDeliveries > 0 {
-			onTimePercentage = (float64(onTimeDeliveries) / float64(totalDeliveries)) * 100
-		}
-
-		driver = DeliveryPerformanceByDriver{
-			DriverID:             driverID,
-			DriverName:           driverName,
-			TotalDeliveries:      totalDeliveries,
-			OnTimeDeliveries:     onTimeDeliveries,
-			OnTimePercentage:     onTimePercentage,
-			AverageDelay:         averageDelay,
-			EarlyDeliveries:      earlyDeliveries,
-			LateDeliveries:       lateDeliveries,
-			PerformanceRating:    performanceRating,
-			ImprovementTrend:     "stable", // Calculate based on historical data
-			TrainingRecommended:  onTimePercentage < 80,
-		}
-
-		drivers = append(drivers, driver)
-	}
+	go func() {
+		analyticsCache.CacheAnalyticsResult("delivery_performance_by_driver", filterHash, drivers)
+	}()
 
+	c.Set("X-Cache", "MISS")
 	return c.JSON(drivers)
 }
 
@@ -457,48 +222,17 @@ func GetDeliveryPerformanceByDriver(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Param filters body AnalyticsFilters true "Analytics filters"
-// @Success 200 {object} CustomerSatisfactionMetrics
+// @Success 200 {object} services.CustomerSatisfactionMetrics
 // @Router /api/analytics/customer-satisfaction [post]
 func GetCustomerSatisfactionAnalytics(c *fiber.Ctx) error {
-	var filters AnalyticsFilters
-	if err := c.BodyParser(&filters); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
-	}
-
-	// Calculate satisfaction metrics from reviews table
-	var totalReviews int64
-	var avgRating float64
-	var satisfiedCount, neutralCount, dissatisfiedCount int64
-
-	database.DB.Model(&models.Review{}).Count(&totalReviews)
-
-	database.DB.Model(&models.Review{}).Select("AVG(rating)").Row().Scan(&avgRating)
-
-	database.DB.Model(&models.Review{}).Where("rating >= 4").Count(&satisfiedCount)
-	database.DB.Model(&models.Review{}).Where("rating = 3").Count(&neutralCount)
-	database.DB.Model(&models.Review{}).Where("rating <= 2").Count(&dissatisfiedCount)
-
-	// Calculate NPS score (simplified)
-	var npsScore int
-	if totalReviews > 0 {
-		promoters := float64(satisfiedCount) / float64(totalReviews) * 100
-		detractors := float64(dissatisfiedCount) / float64(totalReviews) * 100
-		npsScore = int(promoters - detractors)
+	filter, err := parseAnalyticsFilters(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	metrics := CustomerSatisfactionMetrics{
-		OverallScore:          avgRating,
-		TotalResponses:        int(totalReviews),
-		ResponseRate:          75.0, // Mock data - calculate based on trips vs reviews
-		ScoreImprovement:      0.3,  // Mock data - calculate trend
-		NPSScore:              npsScore,
-		SatisfiedCustomers:    int(satisfiedCount),
-		NeutralCustomers:      int(neutralCount),
-		DissatisfiedCustomers: int(dissatisfiedCount),
-		RetentionRate:         94.2, // Mock data
-		ChurnRate:             5.8,  // Mock data
-		AverageResponseTime:   2.4,  // Mock data
-		ResolutionRate:        87.3, // Mock data
+	metrics, err := analyticsService.GetCustomerSatisfactionMetrics(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to calculate customer satisfaction metrics"})
 	}
 
 	return c.JSON(metrics)
@@ -509,48 +243,17 @@ func GetCustomerSatisfactionAnalytics(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Param filters body AnalyticsFilters true "Analytics filters"
-// @Success 200 {object} LoadMatchingMetrics
+// @Success 200 {object} services.LoadMatchingMetrics
 // @Router /api/analytics/load-matching [post]
 func GetLoadMatchingAnalytics(c *fiber.Ctx) error {
-	var filters AnalyticsFilters
-	if err := c.BodyParser(&filters); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
-	}
-
-	// Calculate load matching metrics
-	var totalLoads, matchedLoads int64
-
-	query := database.DB.Model(&models.Load{})
-	
-	if filters.DateRange != nil {
-		if filters.DateRange.Start != "" {
-			query = query.Where("created_at >= ?", filters.DateRange.Start)
-		}
-		if filters.DateRange.End != "" {
-			query = query.Where("created_at <= ?", filters.DateRange.End)
-		}
-	}
-
-	query.Count(&totalLoads)
-	query.Where("trip_id IS NOT NULL").Count(&matchedLoads)
-
-	var matchingRate float64
-	if totalLoads > 0 {
-		matchingRate = (float64(matchedLoads) / float64(totalLoads)) * 100
+	filter, err := parseAnalyticsFilters(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	metrics := LoadMatchingMetrics{
-		TotalLoads:             int(totalLoads),
-		MatchedLoads:           int(matchedLoads),
-		MatchingRate:           matchingRate,
-		AverageMatchTime:       3.4,  // Mock data - calculate from load creation to trip assignment
-		OptimalMatches:         int(matchedLoads * 60 / 100), // Mock: 60% optimal
-		SuboptimalMatches:      int(matchedLoads * 40 / 100), // Mock: 40% suboptimal
-		UnmatchedLoads:         int(totalLoads - matchedLoads),
-		UtilizationRate:        78.3, // Mock data
-		RevenueEfficiency:      87.5, // Mock data
-		CostEfficiency:         82.1, // Mock data
-		ImprovementOpportunity: 15.8, // Mock data
+	metrics, err := analyticsService.GetLoadMatchingMetrics(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to calculate load matching metrics"})
 	}
 
 	return c.JSON(metrics)
@@ -560,50 +263,28 @@ func GetLoadMatchingAnalytics(c *fiber.Ctx) error {
 // @Tags Analytics
 // @Accept json
 // @Produce json
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
 // @Param filters body AnalyticsFilters true "Analytics filters"
-// @Success 200 {object} CapacityMetrics
+// @Param format query string false "json (default), or csv or xlsx to download the report"
+// @Success 200 {object} services.CapacityMetrics
 // @Router /api/analytics/capacity-utilization [post]
 func GetCapacityUtilizationAnalytics(c *fiber.Ctx) error {
-	var filters AnalyticsFilters
-	if err := c.BodyParser(&filters); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	filter, err := parseAnalyticsFilters(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
-
-	// Calculate capacity metrics from vehicles and trips
-	var totalCapacity, utilizedCapacity float64
-
-	// Get total fleet capacity
-	database.DB.Model(&models.Vehicle{}).
-		Where("is_active = ?", true).
-		Select("SUM(load_capacity_kg)").
-		Row().Scan(&totalCapacity)
-
-	// Calculate current utilization from active trips
-	database.DB.Raw(`
-		SELECT COALESCE(SUM(t.used_weight), 0)
-		FROM trips t 
-		JOIN vehicles v ON t.vehicle_id = v.id
-		WHERE t.status IN ('ACTIVE', 'IN_TRANSIT') AND v.is_active = true
-	`).Row().Scan(&utilizedCapacity)
-
-	var utilizationRate float64
-	if totalCapacity > 0 {
-		utilizationRate = (utilizedCapacity / totalCapacity) * 100
+	format, err := analyticsExportFormat(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if format != "" {
+		return sendAnalyticsReport(c, filter, format, services.ReportCapacityUtilization, services.ReportCapacityUtilization)
 	}
 
-	metrics := CapacityMetrics{
-		TotalCapacity:          totalCapacity,
-		UtilizedCapacity:       utilizedCapacity,
-		UtilizationRate:        utilizationRate,
-		AvailableCapacity:      totalCapacity - utilizedCapacity,
-		PeakUtilization:        94.2, // Mock data - calculate from historical data
-		AverageUtilization:     76.8, // Mock data
-		CapacityEfficiency:     82.1, // Mock data
-		RevenuePerCapacityUnit: 1.85, // Mock data
-		CostPerCapacityUnit:    1.32, // Mock data
-		CapacityTrend:          "increasing",
-		DemandVsCapacity:       85.7, // Mock data
-		ForecastedDemand:       1920000, // Mock data
+	metrics, err := analyticsService.GetCapacityMetrics(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to calculate capacity metrics"})
 	}
 
 	return c.JSON(metrics)
@@ -613,78 +294,50 @@ func GetCapacityUtilizationAnalytics(c *fiber.Ctx) error {
 // @Tags Analytics
 // @Accept json
 // @Produce json
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
 // @Param filters body AnalyticsFilters true "Analytics filters"
-// @Success 200 {object} DelayMetrics
+// @Param format query string false "json (default), or csv or xlsx to download the report"
+// @Success 200 {object} services.DelayMetrics
 // @Router /api/analytics/delay-analysis [post]
 func GetDelayAnalysisAnalytics(c *fiber.Ctx) error {
-	var filters AnalyticsFilters
-	if err := c.BodyParser(&filters); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	filter, err := parseAnalyticsFilters(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	format, err := analyticsExportFormat(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if format != "" {
+		return sendAnalyticsReport(c, filter, format, services.ReportDelayIncidents, services.ReportDelayIncidents)
 	}
 
-	// Calculate delay metrics
-	var totalDelays int64
-	var avgDelayDuration float64
-	var totalDelayTime float64
+	metrics, err := analyticsService.GetDelayMetrics(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to calculate delay metrics"})
+	}
 
-	query := database.DB.Table("trips").Where("status = 'COMPLETED'")
-	
-	if filters.DateRange != nil {
-		if filters.DateRange.Start != "" {
-			query = query.Where("departure_date >= ?", filters.DateRange.Start)
-		}
-		if filters.DateRange.End != "" {
-			query = query.Where("departure_date <= ?", filters.DateRange.End)
-		}
+	return c.JSON(metrics)
+}
+
+// @Summary Get dwell time analytics
+// @Description Dwell and detention time at pickup and delivery stops, per stop type, carrier and shipper
+// @Tags Analytics
+// @Accept json
+// @Produce json
+// @Param filters body AnalyticsFilters true "Analytics filters"
+// @Success 200 {object} services.DwellTimeMetrics
+// @Router /api/analytics/dwell-time [post]
+func GetDwellTimeAnalytics(c *fiber.Ctx) error {
+	filter, err := parseAnalyticsFilters(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Count trips with delays
-	query.Where("actual_arrival > estimated_arrival + INTERVAL '30 minutes'").Count(&totalDelays)
-
-	// Calculate average delay duration
-	database.DB.Raw(`
-		SELECT 
-			AVG(EXTRACT(EPOCH FROM (actual_arrival - estimated_arrival))/60) as avg_delay,
-			SUM(EXTRACT(EPOCH FROM (actual_arrival - estimated_arrival))/60) as total_delay
-		FROM trips 
-		WHERE status = 'COMPLETED' 
-		AND actual_arrival > estimated_arrival + INTERVAL '30 minutes'
-	`).Row().Scan(&avgDelayDuration, &totalDelayTime)
-
-	// Calculate delay frequency (delays per 100 trips)
-	var totalTrips int64
-	database.DB.Model(&models.Trip{}).Where("status = 'COMPLETED'").Count(&totalTrips)
-	
-	var delayFrequency float64
-	if totalTrips > 0 {
-		delayFrequency = (float64(totalDelays) / float64(totalTrips)) * 100
-	}
-
-	// Calculate on-time performance
-	var onTimeTrips int64
-	database.DB.Table("trips").
-		Where("status = 'COMPLETED'").
-		Where("ABS(EXTRACT(EPOCH FROM (actual_arrival - estimated_arrival))/60) <= 30").
-		Count(&onTimeTrips)
-
-	var onTimePerformance float64
-	if totalTrips > 0 {
-		onTimePerformance = (float64(onTimeTrips) / float64(totalTrips)) * 100
-	}
-
-	metrics := DelayMetrics{
-		TotalDelays:            int(totalDelays),
-		AverageDelayDuration:   avgDelayDuration,
-		DelayFrequency:         delayFrequency,
-		TotalDelayTime:         totalDelayTime,
-		CostOfDelays:           85000, // Mock data - calculate based on delay cost
-		CustomerImpact:         23.5,  // Mock data
-		OnTimePerformance:      onTimePerformance,
-		DelayTrend:             "improving", // Mock data - calculate trend
-		RecurrentDelays:        89,   // Mock data
-		PreventableDelays:      156,  // Mock data
-		MitigatedDelays:        67,   // Mock data
-		ImprovementOpportunity: 32.4, // Mock data
+	metrics, err := analyticsService.GetDwellTimeMetrics(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to calculate dwell time metrics"})
 	}
 
 	return c.JSON(metrics)
@@ -694,123 +347,274 @@ func GetDelayAnalysisAnalytics(c *fiber.Ctx) error {
 // @Tags Analytics
 // @Accept json
 // @Produce json
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
 // @Param filters body AnalyticsFilters true "Analytics filters"
-// @Success 200 {array} VehicleCapacityData
+// @Param format query string false "json (default), or csv or xlsx to download the report"
+// @Success 200 {array} services.VehicleCapacityData
 // @Router /api/analytics/vehicle-capacity [post]
 func GetVehicleCapacityData(c *fiber.Ctx) error {
-	var filters AnalyticsFilters
-	if err := c.BodyParser(&filters); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	filter, err := parseAnalyticsFilters(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	format, err := analyticsExportFormat(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if format != "" {
+		return sendAnalyticsReport(c, filter, format, services.ReportCapacityUtilization, services.ReportCapacityUtilization)
 	}
 
-	var vehicles []VehicleCapacityData
-
-	// Query vehicles with their current utilization
-	rows, err := database.DB.Raw(`
-		SELECT 
-			v.id,
-			v.license_plate,
-			v.vehicle_type,
-			v.load_capacity_kg,
-			v.load_capacity_m3,
-			COALESCE(SUM(CASE WHEN t.status IN ('ACTIVE', 'IN_TRANSIT') THEN t.used_weight ELSE 0 END), 0) as current_load,
-			COALESCE(SUM(CASE WHEN t.status IN ('ACTIVE', 'IN_TRANSIT') THEN t.used_volume ELSE 0 END), 0) as current_volume,
-			COUNT(CASE WHEN t.status = 'COMPLETED' THEN 1 END) as completed_trips,
-			v.is_active
-		FROM vehicles v
-		LEFT JOIN trips t ON v.id = t.vehicle_id
-		WHERE v.is_active = true
-		GROUP BY v.id, v.license_plate, v.vehicle_type, v.load_capacity_kg, v.load_capacity_m3, v.is_active
-	`).Rows()
-
+	vehicles, err := analyticsService.GetVehicleCapacity(filter)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var vehicle VehicleCapacityData
-		var vehicleID, licensePlate, vehicleType string
-		var maxCapacity, maxVolume, currentLoad, currentVolume float64
-		var trips int
-		var isActive bool
+	return c.JSON(vehicles)
+}
 
-		err := rows.Scan(
-			&vehicleID, &licensePlate, &vehicleType, &maxCapacity, &maxVolume,
-			&currentLoad, &currentVolume, &trips, &isActive,
-		)
-		if err != nil {
-			continue
-		}
+// @Summary Get analytics trend series
+// @Description Get on-time percentage, delays, utilization and revenue bucketed by day, week (starting Monday) or month in UTC. Without a start date the last 30 days are returned.
+// @Tags Analytics
+// @Accept json
+// @Produce json
+// @Param granularity query string false "daily (default), weekly or monthly"
+// @Param filters body AnalyticsFilters true "Analytics filters"
+// @Success 200 {object} services.TrendSeries
+// @Router /api/analytics/trends [post]
+func GetAnalyticsTrends(c *fiber.Ctx) error {
+	filter, err := parseAnalyticsFilters(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
-		// Calculate utilization percentages
-		var weightUtilization, volumeUtilization, overallUtilization float64
-		if maxCapacity > 0 {
-			weightUtilization = (currentLoad / maxCapacity) * 100
-		}
-		if maxVolume > 0 {
-			volumeUtilization = (currentVolume / maxVolume) * 100
+	series, err := analyticsService.GetTrendSeries(filter, c.Query("granularity", services.TrendDaily))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(series)
+}
+
+// @Summary Compare analytics with the previous period
+// @Description Compare on-time percentage, delays, utilization and revenue of a date range with the period of the same length before it. Without a start date the last 30 days are compared.
+// @Tags Analytics
+// @Accept json
+// @Produce json
+// @Param filters body AnalyticsFilters true "Analytics filters"
+// @Success 200 {object} services.PeriodComparison
+// @Router /api/analytics/comparison [post]
+func GetAnalyticsComparison(c *fiber.Ctx) error {
+	filter, err := parseAnalyticsFilters(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	comparison, err := analyticsService.GetPeriodComparison(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to compare periods"})
+	}
+
+	return c.JSON(comparison)
+}
+
+// LaneBenchmarkRequest is the lane to benchmark, with the analytics filters'
+// date range and currency
+type LaneBenchmarkRequest struct {
+	OriginCity         string     `json:"origin_city" validate:"required"`
+	OriginCountry      string     `json:"origin_country,omitempty"`
+	DestinationCity    string     `json:"destination_city" validate:"required"`
+	DestinationCountry string     `json:"destination_country,omitempty"`
+	DateRange          *DateRange `json:"date_range,omitempty"`
+	Currency           string     `json:"currency,omitempty"`
+}
+
+// @Summary Benchmark a lane's rates
+// @Description Prices agreed for loads on an origin/destination corridor, the quotes made for them, and the average transit time and on-time percentage of its completed trips, so rates can be compared before negotiating. Covers every load and trip on the lane over the last year by default. Countries are optional; quotes are listed without who made them.
+// @Tags Analytics
+// @Accept json
+// @Produce json
+// @Param lane body LaneBenchmarkRequest true "Lane, date range and currency"
+// @Success 200 {object} services.LaneBenchmark
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /api/analytics/lanes [post]
+func GetLaneBenchmark(c *fiber.Ctx) error {
+	var req LaneBenchmarkRequest
+	if err := decodeBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+	// Blank cities are missing
+	req.OriginCity = strings.TrimSpace(req.OriginCity)
+	req.DestinationCity = strings.TrimSpace(req.DestinationCity)
+	if err := validateRequest(&req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	filter, err := parseAnalyticsFilters(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	benchmark, err := analyticsService.GetLaneBenchmark(services.Lane{
+		OriginCity:         req.OriginCity,
+		OriginCountry:      req.OriginCountry,
+		DestinationCity:    req.DestinationCity,
+		DestinationCountry: req.DestinationCountry,
+	}, filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to benchmark lane"})
+	}
+
+	return c.JSON(benchmark)
+}
+
+// @Summary Generate an analytics report
+// @Description Download on-time delivery, delay incident or capacity utilization rows as CSV or XLSX. The "all" report is a workbook with a sheet per report.
+// @Tags Analytics
+// @Accept json
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce text/csv
+// @Param report path string true "on-time-delivery, delay-incidents, capacity-utilization or all"
+// @Param format query string false "xlsx (default) or csv"
+// @Param filters body AnalyticsFilters true "Analytics filters"
+// @Success 200 {file} file
+// @Router /api/analytics/reports/{report} [post]
+func GenerateAnalyticsReport(c *fiber.Ctx) error {
+	filter, err := parseAnalyticsFilters(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	format, err := analyticsExportFormat(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if format == "" {
+		format = "xlsx"
+	}
+
+	report := c.Params("report")
+	if report == "all" {
+		if format == "csv" {
+			return c.Status(400).JSON(fiber.Map{"error": "CSV holds a single report, use xlsx for all reports"})
 		}
-		overallUtilization = (weightUtilization + volumeUtilization) / 2
-
-		// Determine efficiency rating
-		var efficiency string
-		if overallUtilization >= 85 {
-			efficiency = "excellent"
-		} else if overallUtilization >= 70 {
-			efficiency = "good"
-		} else if overallUtilization >= 60 {
-			efficiency = "average"
-		} else {
-			efficiency = "poor"
+		return sendAnalyticsReport(c, filter, format, "analytics-report", services.AnalyticsReports...)
+	}
+	for _, name := range services.AnalyticsReports {
+		if name == report {
+			return sendAnalyticsReport(c, filter, format, report, report)
 		}
+	}
+	return c.Status(404).JSON(fiber.Map{"error": "Report not found"})
+}
 
-		// Determine status
-		var status string
-		if isActive && currentLoad > 0 {
-			status = "active"
-		} else if isActive {
-			status = "idle"
-		} else {
-			status = "unavailable"
-		}
+// analyticsExportFormat returns the download format requested with the format
+// query parameter, or "" for a JSON response
+func analyticsExportFormat(c *fiber.Ctx) (string, error) {
+	switch format := strings.ToLower(c.Query("format")); format {
+	case "", "json":
+		return "", nil
+	case "csv", "xlsx":
+		return format, nil
+	default:
+		return "", errors.New("Invalid format, use json, csv or xlsx")
+	}
+}
 
-		vehicle = VehicleCapacityData{
-			VehicleID:          vehicleID,
-			VehicleNumber:      licensePlate,
-			VehicleType:        vehicleType,
-			MaxCapacity:        maxCapacity,
-			MaxVolume:          maxVolume,
-			CurrentLoad:        currentLoad,
-			CurrentVolume:      currentVolume,
-			WeightUtilization:  weightUtilization,
-			VolumeUtilization:  volumeUtilization,
-			OverallUtilization: overallUtilization,
-			Trips:              trips,
-			Revenue:            0,     // Mock data - calculate from completed trips
-			OperatingCosts:     0,     // Mock data
-			Profitability:      0,     // Mock data
-			Efficiency:         efficiency,
-			Location:           "Unknown", // Mock data - get from tracking
-			Status:             status,
-			LastUpdated:        time.Now(),
-			UtilizationTrend:   "stable", // Mock data
+// sendAnalyticsReport responds with reports as a CSV or XLSX download named
+// after filename and today's date. CSV downloads hold the first report only.
+func sendAnalyticsReport(c *fiber.Ctx, filter services.AnalyticsFilter, format, filename string, reports ...string) error {
+	tables := make([]*services.ReportTable, 0, len(reports))
+	for _, report := range reports {
+		table, err := analyticsService.GetReportTable(report, filter)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to generate report"})
 		}
+		tables = append(tables, table)
+	}
 
-		vehicles = append(vehicles, vehicle)
+	var content []byte
+	var err error
+	if format == "csv" {
+		content, err = tables[0].CSV()
+		c.Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		content, err = services.ReportsXLSX(tables...)
+		c.Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to generate report"})
 	}
 
-	return c.JSON(vehicles)
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, filename, time.Now().Format("2006-01-02"), format))
+	return c.Send(content)
 }
 
-// Helper function to generate filter hash for caching
-func generateFilterHash(filters AnalyticsFilters) string {
-	filterBytes, _ := json.Marshal(filters)
-	hash := md5.Sum(filterBytes)
-	return fmt.Sprintf("%x", hash)
+// parseAnalyticsFilters reads the analytics filters of the request body
+func parseAnalyticsFilters(c *fiber.Ctx) (services.AnalyticsFilter, error) {
+	var filters AnalyticsFilters
+	if err := c.BodyParser(&filters); err != nil {
+		return services.AnalyticsFilter{}, errors.New("Invalid request body")
+	}
+
+	filter := services.AnalyticsFilter{
+		VehicleIDs:  filters.VehicleIDs,
+		DriverIDs:   filters.DriverIDs,
+		RouteIDs:    filters.RouteIDs,
+		CustomerIDs: filters.CustomerIDs,
+		Currency:    strings.ToUpper(filters.Currency),
+	}
+	if filter.Currency != "" && len(filter.Currency) != 3 {
+		return filter, errors.New("Invalid currency")
+	}
+	if filters.DateRange != nil {
+		if filters.DateRange.Start != "" {
+			start, err := parseSearchDate(filters.DateRange.Start)
+			if err != nil {
+				return filter, errors.New("Invalid start date")
+			}
+			filter.From = &start
+		}
+		if filters.DateRange.End != "" {
+			end, err := parseSearchDate(filters.DateRange.End)
+			if err != nil {
+				return filter, errors.New("Invalid end date")
+			}
+			filter.To = &end
+		}
+	}
+	if filter.From != nil && filter.To != nil && !filter.To.After(*filter.From) {
+		return filter, errors.New("End date must be after start date")
+	}
+
+	// Users see analytics of their own and their organizations' trips and
+	// loads
+	if userID, ok := c.Locals("user_id").(float64); ok {
+		scope, err := organizationService.Scope(uint(userID))
+		if err != nil {
+			return filter, err
+		}
+		filter.Scope = scope
+	}
+	return filter, nil
 }
 
-// Additional helper functions for complex analytics queries would go here...
+// generateFilterHash returns the cache key of a filter's results. It covers
+// the filter's whole scope, the trips its user is assigned to drive too, so
+// results are only reused for users who see the same trips and loads.
+func generateFilterHash(filter services.AnalyticsFilter) string {
+	key := struct {
+		Filter          services.AnalyticsFilter `json:"filter"`
+		AssignedTripIDs []uint                   `json:"assigned_trip_ids,omitempty"`
+	}{Filter: filter}
+	if filter.Scope != nil {
+		key.AssignedTripIDs = filter.Scope.AssignedTripIDs
+	}
+	keyBytes, _ := json.Marshal(key)
+	hash := md5.Sum(keyBytes)
+	return fmt.Sprintf("%x", hash)
+}
 
 // @Summary Get operational KPIs
 // @Tags Analytics
@@ -822,7 +626,7 @@ func generateFilterHash(filters AnalyticsFilters) string {
 // @Router /api/analytics/kpis/{category} [post]
 func GetOperationalKPIs(c *fiber.Ctx) error {
 	category := c.Params("category")
-	
+
 	var filters AnalyticsFilters
 	if err := c.BodyParser(&filters); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
@@ -832,23 +636,23 @@ func GetOperationalKPIs(c *fiber.Ctx) error {
 	switch category {
 	case "delivery":
 		return c.JSON(fiber.Map{
-			"on_time_percentage": 87.3,
-			"average_delay": 23.5,
+			"on_time_percentage":    87.3,
+			"average_delay":         23.5,
 			"customer_satisfaction": 4.2,
 		})
 	case "utilization":
 		return c.JSON(fiber.Map{
-			"fleet_utilization": 78.3,
+			"fleet_utilization":   78.3,
 			"capacity_efficiency": 82.1,
-			"load_matching_rate": 81.7,
+			"load_matching_rate":  81.7,
 		})
 	case "financial":
 		return c.JSON(fiber.Map{
 			"revenue_per_mile": 2.35,
-			"profit_margin": 28.4,
-			"cost_efficiency": 82.1,
+			"profit_margin":    28.4,
+			"cost_efficiency":  82.1,
 		})
 	default:
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid KPI category"})
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,538 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type AnalyticsHandlerTestSuite struct {
+	suite.Suite
+	app *fiber.App
+}
+
+func (suite *AnalyticsHandlerTestSuite) SetupSuite() {
+	analyticsService = services.NewAnalyticsService(testDB)
+}
+
+func (suite *AnalyticsHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+	suite.app = fiber.New()
+
+	suite.app.Post("/analytics/on-time-delivery", GetOnTimeDeliveryAnalytics)
+	suite.app.Post("/analytics/delivery-performance/by-route", GetDeliveryPerformanceByRoute)
+	suite.app.Post("/analytics/delivery-performance/by-driver", GetDeliveryPerformanceByDriver)
+	suite.app.Post("/analytics/load-matching", GetLoadMatchingAnalytics)
+	suite.app.Post("/analytics/delay-analysis", GetDelayAnalysisAnalytics)
+	suite.app.Post("/analytics/dwell-time", GetDwellTimeAnalytics)
+	suite.app.Post("/analytics/vehicle-capacity", GetVehicleCapacityData)
+	suite.app.Post("/analytics/trends", GetAnalyticsTrends)
+	suite.app.Post("/analytics/comparison", GetAnalyticsComparison)
+	suite.app.Post("/analytics/lanes", GetLaneBenchmark)
+	suite.app.Post("/analytics/reports/:report", GenerateAnalyticsReport)
+}
+
+func (suite *AnalyticsHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+// createCompletedTrips adds a carrier with trips arriving on time, 1 hour
+// late, 3 hours late and 45 minutes early
+func (suite *AnalyticsHandlerTestSuite) createCompletedTrips() models.User {
+	carrier := models.User{Email: "carrier@example.com", Phone: "+1987654321", Password: "password", Role: "CARRIER", FirstName: "Ada", LastName: "Driver"}
+	testDB.Create(&carrier)
+
+	departure := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	for _, delay := range []time.Duration{10 * time.Minute, time.Hour, 3 * time.Hour, -45 * time.Minute} {
+		estimated := departure.Add(4 * time.Hour)
+		actual := estimated.Add(delay)
+		testDB.Create(&models.Trip{
+			UserID:           carrier.ID,
+			Status:           "COMPLETED",
+			DepartureDate:    departure,
+			EstimatedArrival: estimated,
+			ActualArrival:    &actual,
+		})
+	}
+	return carrier
+}
+
+// createCorridorTrip adds a completed trip between two cities arriving delay
+// after its estimate
+func (suite *AnalyticsHandlerTestSuite) createCorridorTrip(carrierID uint, origin, destination string, departure time.Time, delay time.Duration) {
+	estimated := departure.Add(6 * time.Hour)
+	actual := estimated.Add(delay)
+	testDB.Create(&models.Trip{
+		UserID:             carrierID,
+		OriginCity:         origin,
+		OriginCountry:      "ZW",
+		DestinationCity:    destination,
+		DestinationCountry: "ZA",
+		Status:             "COMPLETED",
+		DepartureDate:      departure,
+		EstimatedArrival:   estimated,
+		ActualArrival:      &actual,
+	})
+}
+
+func (suite *AnalyticsHandlerTestSuite) post(path string, filters interface{}) (int, []byte) {
+	jsonData, _ := json.Marshal(filters)
+	req := httptest.NewRequest("POST", path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+	return resp.StatusCode, body.Bytes()
+}
+
+func (suite *AnalyticsHandlerTestSuite) TestGetOnTimeDeliveryAnalytics() {
+	t := suite.T()
+	suite.createCompletedTrips()
+
+	status, body := suite.post("/analytics/on-time-delivery", AnalyticsFilters{})
+	assert.Equal(t, 200, status)
+
+	var metrics services.OnTimeDeliveryMetrics
+	assert.NoError(t, json.Unmarshal(body, &metrics))
+	assert.Equal(t, 4, metrics.TotalDeliveries)
+	assert.Equal(t, 1, metrics.OnTimeDeliveries)
+	assert.Equal(t, 2, metrics.LateDeliveries)
+	assert.Equal(t, 1, metrics.EarlyDeliveries)
+	assert.Equal(t, 1, metrics.CriticalDelays)
+	assert.InDelta(t, 25, metrics.OnTimePercentage, 0.001)
+	// Average of the 10, 60 and 180 minute delays
+	assert.InDelta(t, 83.333, metrics.AverageDelay, 0.001)
+
+	// Trips departing after the date range are excluded
+	status, body = suite.post("/analytics/on-time-delivery", AnalyticsFilters{
+		DateRange: &DateRange{End: "2024-02-29"},
+	})
+	assert.Equal(t, 200, status)
+	assert.NoError(t, json.Unmarshal(body, &metrics))
+	assert.Equal(t, 0, metrics.TotalDeliveries)
+
+	status, _ = suite.post("/analytics/on-time-delivery", AnalyticsFilters{
+		DateRange: &DateRange{Start: "yesterday"},
+	})
+	assert.Equal(t, 400, status)
+}
+
+func (suite *AnalyticsHandlerTestSuite) TestGetDeliveryPerformanceByDriver() {
+	t := suite.T()
+	carrier := suite.createCompletedTrips()
+
+	status, body := suite.post("/analytics/delivery-performance/by-driver", AnalyticsFilters{})
+	assert.Equal(t, 200, status)
+
+	var drivers []services.DeliveryPerformanceByDriver
+	assert.NoError(t, json.Unmarshal(body, &drivers))
+	assert.Len(t, drivers, 1)
+	assert.Equal(t, "Ada Driver", drivers[0].DriverName)
+	assert.Equal(t, 4, drivers[0].TotalDeliveries)
+	assert.True(t, drivers[0].TrainingRecommended)
+
+	status, body = suite.post("/analytics/delivery-performance/by-driver", AnalyticsFilters{
+		DriverIDs: []uint{carrier.ID + 1},
+	})
+	assert.Equal(t, 200, status)
+	assert.NoError(t, json.Unmarshal(body, &drivers))
+	assert.Empty(t, drivers)
+}
+
+func (suite *AnalyticsHandlerTestSuite) TestGetDeliveryPerformanceByRoute() {
+	t := suite.T()
+
+	carrier := models.User{Email: "carrier@example.com", Phone: "+1987654321", Password: "password", Role: "CARRIER"}
+	testDB.Create(&carrier)
+
+	march := time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC)
+	february := time.Date(2024, 2, 15, 8, 0, 0, 0, time.UTC)
+
+	// Harare - Johannesburg improved from 50% to 100% on time
+	suite.createCorridorTrip(carrier.ID, "Harare", "Johannesburg", march, 0)
+	suite.createCorridorTrip(carrier.ID, " harare", "JOHANNESBURG", march, 20*time.Minute)
+	suite.createCorridorTrip(carrier.ID, "Harare", "Johannesburg", february, 0)
+	suite.createCorridorTrip(carrier.ID, "Harare", "Johannesburg", february, 2*time.Hour)
+
+	// Bulawayo - Durban arrived late
+	suite.createCorridorTrip(carrier.ID, "Bulawayo", "Durban", march, time.Hour)
+
+	filters := AnalyticsFilters{DateRange: &DateRange{Start: "2024-03-01", End: "2024-03-31"}}
+	status, body := suite.post("/analytics/delivery-performance/by-route", filters)
+	assert.Equal(t, 200, status)
+
+	var routes []services.DeliveryPerformanceByRoute
+	assert.NoError(t, json.Unmarshal(body, &routes))
+	assert.Len(t, routes, 2)
+
+	assert.Equal(t, "HARARE,ZW:JOHANNESBURG,ZA", routes[0].RouteID)
+	assert.Equal(t, "Harare, ZW - Johannesburg, ZA", routes[0].RouteName)
+	assert.Equal(t, 2, routes[0].TotalDeliveries)
+	assert.InDelta(t, 100, routes[0].OnTimePercentage, 0.001)
+	assert.InDelta(t, 50, routes[0].Improvement, 0.001)
+	assert.Equal(t, "low", routes[0].RiskLevel)
+
+	assert.Equal(t, "BULAWAYO,ZW:DURBAN,ZA", routes[1].RouteID)
+	assert.InDelta(t, 60, routes[1].AverageDelay, 0.001)
+	assert.Equal(t, "high", routes[1].RiskLevel)
+
+	filters.RouteIDs = []string{"BULAWAYO,ZW:DURBAN,ZA"}
+	status, body = suite.post("/analytics/delivery-performance/by-route", filters)
+	assert.Equal(t, 200, status)
+	assert.NoError(t, json.Unmarshal(body, &routes))
+	assert.Len(t, routes, 1)
+	assert.Equal(t, "BULAWAYO,ZW:DURBAN,ZA", routes[0].RouteID)
+}
+
+func (suite *AnalyticsHandlerTestSuite) TestGetDelayAnalysisAnalytics() {
+	t := suite.T()
+	suite.createCompletedTrips()
+
+	status, body := suite.post("/analytics/delay-analysis", AnalyticsFilters{})
+	assert.Equal(t, 200, status)
+
+	var metrics services.DelayMetrics
+	assert.NoError(t, json.Unmarshal(body, &metrics))
+	assert.Equal(t, 2, metrics.TotalDelays)
+	assert.InDelta(t, 240, metrics.TotalDelayTime, 0.001)
+	assert.InDelta(t, 120, metrics.AverageDelayDuration, 0.001)
+	assert.InDelta(t, 50, metrics.DelayFrequency, 0.001)
+}
+
+func (suite *AnalyticsHandlerTestSuite) TestGetDwellTimeAnalytics() {
+	t := suite.T()
+	carrier := suite.createCompletedTrips()
+
+	var trip models.Trip
+	testDB.Where("user_id = ?", carrier.ID).First(&trip)
+	shipper := models.User{Email: "shipper@example.com", Phone: "+1555000111", Password: "password", Role: "SHIPPER", CompanyName: "Acme"}
+	testDB.Create(&shipper)
+	load := models.Load{ShipperID: shipper.ID, TripID: trip.ID, BookingReference: "DWELL-001", Status: "DELIVERED"}
+	testDB.Create(&load)
+
+	arrival := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, stop := range []struct {
+		stopType  string
+		dwell     int
+		detention int
+		charge    float64
+	}{
+		{"PICKUP", 60, 0, 0},
+		{"DELIVERY", 180, 60, 50},
+	} {
+		departure := arrival.Add(time.Duration(stop.dwell) * time.Minute)
+		testDB.Create(&models.TripStop{
+			TripID:           trip.ID,
+			LoadID:           &load.ID,
+			StopType:         stop.stopType,
+			Status:           "COMPLETED",
+			ActualArrival:    &arrival,
+			ActualDeparture:  &departure,
+			DwellMinutes:     stop.dwell,
+			DetentionMinutes: stop.detention,
+			DetentionCharge:  stop.charge,
+		})
+	}
+	// Stops the vehicle hasn't left yet aren't included
+	testDB.Create(&models.TripStop{TripID: trip.ID, LoadID: &load.ID, StopType: "DELIVERY", Status: "ARRIVED", ActualArrival: &arrival})
+
+	status, body := suite.post("/analytics/dwell-time", AnalyticsFilters{})
+	assert.Equal(t, 200, status)
+
+	var metrics services.DwellTimeMetrics
+	assert.NoError(t, json.Unmarshal(body, &metrics))
+	assert.Equal(t, 2, metrics.TotalStops)
+	assert.InDelta(t, 120, metrics.AverageDwellMinutes, 0.001)
+	assert.Equal(t, 1, metrics.DetentionStops)
+	assert.InDelta(t, 50, metrics.DetentionPercentage, 0.001)
+	assert.Equal(t, 60, metrics.TotalDetentionMinutes)
+	assert.InDelta(t, 50, metrics.DetentionCharges, 0.001)
+	if assert.Len(t, metrics.ByStopType, 2) {
+		assert.Equal(t, "PICKUP", metrics.ByStopType[0].ID)
+		assert.InDelta(t, 180, metrics.ByStopType[1].AverageDwellMinutes, 0.001)
+	}
+	if assert.Len(t, metrics.ByCarrier, 1) {
+		assert.Equal(t, "Ada Driver", metrics.ByCarrier[0].Name)
+		assert.Equal(t, 2, metrics.ByCarrier[0].Stops)
+	}
+	if assert.Len(t, metrics.ByShipper, 1) {
+		assert.Equal(t, "Acme", metrics.ByShipper[0].Name)
+		assert.Equal(t, 60, metrics.ByShipper[0].DetentionMinutes)
+	}
+
+	// Stops of other shippers' loads are left out
+	status, body = suite.post("/analytics/dwell-time", AnalyticsFilters{CustomerIDs: []uint{shipper.ID + 100}})
+	assert.Equal(t, 200, status)
+	assert.NoError(t, json.Unmarshal(body, &metrics))
+	assert.Equal(t, 0, metrics.TotalStops)
+}
+
+func (suite *AnalyticsHandlerTestSuite) TestGetLoadMatchingAnalytics() {
+	t := suite.T()
+
+	// The seeded load is booked on the seeded trip
+	testDB.Create(&models.Load{ShipperID: 1, BookingReference: "TEST-LOAD-002", Status: "PENDING"})
+
+	status, body := suite.post("/analytics/load-matching", AnalyticsFilters{})
+	assert.Equal(t, 200, status)
+
+	var metrics services.LoadMatchingMetrics
+	assert.NoError(t, json.Unmarshal(body, &metrics))
+	assert.Equal(t, 2, metrics.TotalLoads)
+	assert.Equal(t, 1, metrics.MatchedLoads)
+	assert.Equal(t, 1, metrics.UnmatchedLoads)
+}
+
+func (suite *AnalyticsHandlerTestSuite) TestGetVehicleCapacityData() {
+	t := suite.T()
+
+	vehicle := models.Vehicle{UserID: 1, LicensePlate: "CAP-001", VehicleType: "TRUCK", LoadCapacityKg: 1000, LoadCapacityM3: 50, IsActive: true}
+	testDB.Create(&vehicle)
+	testDB.Create(&models.Trip{UserID: 1, VehicleID: vehicle.ID, Status: "IN_TRANSIT", UsedWeight: 800, UsedVolume: 40})
+
+	status, body := suite.post("/analytics/vehicle-capacity", AnalyticsFilters{})
+	assert.Equal(t, 200, status)
+
+	// The seeded vehicle is listed alongside
+	var vehicles []services.VehicleCapacityData
+	assert.NoError(t, json.Unmarshal(body, &vehicles))
+	var capacity *services.VehicleCapacityData
+	for i := range vehicles {
+		if vehicles[i].VehicleNumber == "CAP-001" {
+			capacity = &vehicles[i]
+		}
+	}
+	if assert.NotNil(t, capacity) {
+		assert.InDelta(t, 80, capacity.OverallUtilization, 0.001)
+		assert.Equal(t, "good", capacity.Efficiency)
+		assert.Equal(t, "active", capacity.Status)
+	}
+}
+
+func (suite *AnalyticsHandlerTestSuite) TestGetAnalyticsTrends() {
+	t := suite.T()
+	suite.createCompletedTrips()
+
+	processedAt := time.Date(2024, 3, 6, 10, 0, 0, 0, time.UTC)
+	testDB.Create(&models.Transaction{PayerID: 1, Amount: 100, RefundedAmount: 10, Status: "COMPLETED", ProcessedAt: &processedAt})
+
+	filters := AnalyticsFilters{DateRange: &DateRange{Start: "2024-02-26", End: "2024-03-17"}}
+	status, body := suite.post("/analytics/trends?granularity=weekly", filters)
+	assert.Equal(t, 200, status)
+
+	var series services.TrendSeries
+	assert.NoError(t, json.Unmarshal(body, &series))
+	assert.Equal(t, "weekly", series.Granularity)
+	assert.Len(t, series.Points, 3)
+
+	// The completed trips departed on Friday 1 March, the payment the week after
+	assert.Equal(t, time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), series.Points[0].PeriodStart.UTC())
+	assert.Equal(t, 4, series.Points[0].Deliveries)
+	assert.InDelta(t, 25, series.Points[0].OnTimePercentage, 0.001)
+	assert.InDelta(t, 90, series.Points[1].Revenue, 0.001)
+	assert.Equal(t, 0, series.Points[2].Deliveries)
+
+	status, _ = suite.post("/analytics/trends?granularity=hourly", filters)
+	assert.Equal(t, 400, status)
+
+	status, _ = suite.post("/analytics/trends", AnalyticsFilters{
+		DateRange: &DateRange{Start: "2024-03-17", End: "2024-03-01"},
+	})
+	assert.Equal(t, 400, status)
+}
+
+func (suite *AnalyticsHandlerTestSuite) TestGetAnalyticsComparison() {
+	t := suite.T()
+	suite.createCompletedTrips()
+
+	// The period before 1-15 March starts on 16 February
+	earlier := time.Date(2024, 2, 20, 8, 0, 0, 0, time.UTC)
+	arrival := earlier.Add(4 * time.Hour)
+	testDB.Create(&models.Trip{UserID: 1, Status: "COMPLETED", DepartureDate: earlier, EstimatedArrival: arrival, ActualArrival: &arrival})
+
+	status, body := suite.post("/analytics/comparison", AnalyticsFilters{
+		DateRange: &DateRange{Start: "2024-03-01", End: "2024-03-15"},
+	})
+	assert.Equal(t, 200, status)
+
+	var comparison services.PeriodComparison
+	assert.NoError(t, json.Unmarshal(body, &comparison))
+	assert.Equal(t, 4, comparison.Current.Deliveries)
+	assert.Equal(t, 1, comparison.Previous.Deliveries)
+	assert.Equal(t, 3, comparison.Change.Deliveries)
+	assert.InDelta(t, -75, comparison.Change.OnTimePercentage, 0.001)
+}
+
+func (suite *AnalyticsHandlerTestSuite) TestGetLaneBenchmark() {
+	t := suite.T()
+
+	carrier := models.User{Email: "carrier@example.com", Phone: "+1987654321", Password: "password", Role: "CARRIER"}
+	testDB.Create(&carrier)
+	shipper := models.User{Email: "shipper@example.com", Phone: "+1987654322", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&shipper)
+
+	pickup := time.Now().AddDate(0, -1, 0)
+	createLoad := func(reference, origin, destination, status string, price, weight float64) models.Load {
+		load := models.Load{
+			ShipperID: shipper.ID, BookingReference: reference, Status: status, AgreedPrice: price, Weight: weight, Currency: "USD",
+			PickupCity: origin, PickupCountry: "ZW", DeliveryCity: destination, DeliveryCountry: "ZA", RequestedPickupDate: pickup,
+		}
+		testDB.Create(&load)
+		return load
+	}
+	first := createLoad("LANE-1", "Harare", "Johannesburg", "DELIVERED", 1000, 500)
+	createLoad("LANE-2", " harare", "JOHANNESBURG", "BOOKED", 1600, 1000)
+	createLoad("LANE-3", "Harare", "Johannesburg", "DELIVERED", 1300, 0)
+	// Not agreed yet, cancelled, and on other lanes
+	open := createLoad("LANE-4", "Harare", "Johannesburg", "QUOTE_REQUESTED", 0, 2000)
+	createLoad("LANE-5", "Harare", "Johannesburg", "CANCELLED", 5000, 500)
+	createLoad("LANE-6", "Bulawayo", "Johannesburg", "DELIVERED", 9000, 500)
+
+	testDB.Create(&models.Quote{LoadID: first.ID, CarrierID: carrier.ID, QuoteAmount: 1000, Currency: "USD", Status: "ACCEPTED", ProposedBy: "CARRIER"})
+	// Normalized to the base currency when it was made
+	testDB.Create(&models.Quote{LoadID: open.ID, CarrierID: carrier.ID, QuoteAmount: 24000, Currency: "ZAR", BaseAmount: 1200, BaseCurrency: "USD", ExchangeRate: 0.05, Status: "PENDING", ProposedBy: "CARRIER"})
+
+	departure := time.Now().AddDate(0, 0, -20)
+	suite.createCorridorTrip(carrier.ID, "Harare", "Johannesburg", departure, 0)
+	suite.createCorridorTrip(carrier.ID, "Harare", "Johannesburg", departure, 2*time.Hour)
+	suite.createCorridorTrip(carrier.ID, "Bulawayo", "Johannesburg", departure, 0)
+
+	status, body := suite.post("/analytics/lanes", LaneBenchmarkRequest{OriginCity: "harare", DestinationCity: "Johannesburg", DestinationCountry: "za"})
+	suite.Require().Equal(200, status, string(body))
+
+	var benchmark services.LaneBenchmark
+	suite.Require().NoError(json.Unmarshal(body, &benchmark))
+	assert.Equal(t, "USD", benchmark.Currency)
+	assert.Equal(t, 3, benchmark.AgreedPrices.Count)
+	assert.InDelta(t, 1300, benchmark.AgreedPrices.Average, 0.001)
+	assert.InDelta(t, 1300, benchmark.AgreedPrices.Median, 0.001)
+	assert.InDelta(t, 1000, benchmark.AgreedPrices.Min, 0.001)
+	assert.InDelta(t, 1600, benchmark.AgreedPrices.Max, 0.001)
+	// Of the loads with a weight: 2600 for 1500 kg
+	assert.InDelta(t, 1.73, benchmark.AgreedPrices.AveragePerKg, 0.001)
+
+	assert.Equal(t, 2, benchmark.Quotes.Count)
+	assert.InDelta(t, 1100, benchmark.Quotes.Average, 0.001)
+	if assert.Len(t, benchmark.RecentQuotes, 2) {
+		assert.Equal(t, "ZAR", benchmark.RecentQuotes[0].QuoteCurrency)
+		assert.InDelta(t, 1200, benchmark.RecentQuotes[0].Amount, 0.001)
+		assert.InDelta(t, 2000, benchmark.RecentQuotes[0].Weight, 0.001)
+	}
+	assert.NotContains(t, string(body), "carrier_id")
+
+	assert.Equal(t, 2, benchmark.Transit.Trips)
+	assert.InDelta(t, 7, benchmark.Transit.AverageTransitHours, 0.001)
+	assert.InDelta(t, 50, benchmark.Transit.OnTimePercentage, 0.001)
+	assert.InDelta(t, 120, benchmark.Transit.AverageDelay, 0.001)
+
+	// Only what's in the date range
+	status, body = suite.post("/analytics/lanes", map[string]interface{}{
+		"origin_city": "Harare", "destination_city": "Johannesburg",
+		"date_range": DateRange{Start: time.Now().AddDate(0, 0, -25).Format("2006-01-02")},
+	})
+	suite.Require().Equal(200, status)
+	suite.Require().NoError(json.Unmarshal(body, &benchmark))
+	assert.Equal(t, 0, benchmark.AgreedPrices.Count)
+	assert.Equal(t, 2, benchmark.Transit.Trips)
+
+	status, _ = suite.post("/analytics/lanes", LaneBenchmarkRequest{OriginCity: "Harare"})
+	assert.Equal(t, 422, status)
+	status, _ = suite.post("/analytics/lanes", LaneBenchmarkRequest{OriginCity: "Harare", DestinationCity: " "})
+	assert.Equal(t, 422, status)
+	status, _ = suite.post("/analytics/lanes", LaneBenchmarkRequest{OriginCity: "Harare", DestinationCity: "Johannesburg", DestinationCountry: "GB"})
+	assert.Equal(t, 200, status)
+}
+
+func (suite *AnalyticsHandlerTestSuite) TestExportOnTimeDeliveryCSV() {
+	t := suite.T()
+	suite.createCompletedTrips()
+
+	req := httptest.NewRequest("POST", "/analytics/on-time-delivery?format=csv", bytes.NewBufferString("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), `filename="on-time-delivery-`)
+
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 5)
+	assert.Equal(t, "Trip ID", records[0][0])
+	assert.Equal(t, "Delay (min)", records[0][8])
+	assert.Equal(t, "180", records[3][8])
+	assert.Equal(t, services.DeliveryLate, records[3][9])
+
+	status, _ := suite.post("/analytics/on-time-delivery?format=pdf", AnalyticsFilters{})
+	assert.Equal(t, 400, status)
+}
+
+func (suite *AnalyticsHandlerTestSuite) TestGenerateAnalyticsReport() {
+	t := suite.T()
+	suite.createCompletedTrips()
+
+	status, body := suite.post("/analytics/reports/all", AnalyticsFilters{})
+	assert.Equal(t, 200, status)
+
+	workbook, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	suite.Require().NoError(err)
+	var sheets []string
+	for _, file := range workbook.File {
+		if strings.HasPrefix(file.Name, "xl/worksheets/") {
+			sheets = append(sheets, file.Name)
+		}
+	}
+	assert.Len(t, sheets, len(services.AnalyticsReports))
+
+	// Only the 1 and 3 hour delays are incidents
+	status, body = suite.post("/analytics/reports/delay-incidents?format=csv", AnalyticsFilters{})
+	assert.Equal(t, 200, status)
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, "MINOR", records[1][8])
+	assert.Equal(t, "CRITICAL", records[2][8])
+
+	status, _ = suite.post("/analytics/reports/all?format=csv", AnalyticsFilters{})
+	assert.Equal(t, 400, status)
+
+	status, _ = suite.post("/analytics/reports/revenue", AnalyticsFilters{})
+	assert.Equal(t, 404, status)
+}
+
+func (suite *AnalyticsHandlerTestSuite) TestFilterHashCoversScope() {
+	t := suite.T()
+
+	platform := generateFilterHash(services.AnalyticsFilter{})
+	carrier := generateFilterHash(services.AnalyticsFilter{Scope: &services.OrganizationScope{UserID: 1}})
+	otherCarrier := generateFilterHash(services.AnalyticsFilter{Scope: &services.OrganizationScope{UserID: 2}})
+	dispatcher := generateFilterHash(services.AnalyticsFilter{Scope: &services.OrganizationScope{UserID: 1, OrganizationIDs: []uint{1}}})
+	driver := generateFilterHash(services.AnalyticsFilter{Scope: &services.OrganizationScope{UserID: 1, AssignedTripIDs: []uint{1}}})
+
+	hashes := []string{platform, carrier, otherCarrier, dispatcher, driver}
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			assert.NotEqual(t, hashes[i], hashes[j])
+		}
+	}
+	assert.Equal(t, carrier, generateFilterHash(services.AnalyticsFilter{Scope: &services.OrganizationScope{UserID: 1}}))
+}
+
+func TestAnalyticsHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(AnalyticsHandlerTestSuite))
+}
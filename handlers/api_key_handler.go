@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var apiKeyService = services.NewApiKeyService(database.DB)
+
+// RotateApiKeyRequest sets how long a rotated key keeps working
+type RotateApiKeyRequest struct {
+	GracePeriod string `json:"grace_period"` // e.g. 24h, empty to revoke the old key right away
+}
+
+// apiKeyError responds to an API key service error
+func apiKeyError(c *fiber.Ctx, err error) error {
+	status := 400
+	if err.Error() == "API key not found" {
+		status = 404
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
+
+// apiKeyRequest reads the current user and the API key ID of a request
+func apiKeyRequest(c *fiber.Ctx) (uint, uint, int, string) {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return 0, 0, 401, "Unauthorized"
+	}
+	keyID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, 0, 400, "Invalid API key ID"
+	}
+	return uint(userID), uint(keyID), 0, ""
+}
+
+// CreateApiKey @Summary Issue an API key
+// @Description Issue a key for a telematics provider or other integration to call the integration API as the carrier. Scopes are tracking:write and tracking:read, and trip_ids limits the key to some of the carrier's trips. The key is only returned once.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param api_key body services.ApiKeyRequest true "Key details"
+// @Success 201 {object} services.IssuedApiKey
+// @Router /api-keys [post]
+func CreateApiKey(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req services.ApiKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	issued, err := apiKeyService.CreateKey(uint(userID), req)
+	if err != nil {
+		return apiKeyError(c, err)
+	}
+
+	return c.Status(201).JSON(issued)
+}
+
+// GetApiKeys @Summary List API keys
+// @Description List the current user's API keys, newest first, including revoked and rotated ones
+// @Tags api-keys
+// @Produce json
+// @Success 200 {array} models.ApiKey
+// @Router /api-keys [get]
+func GetApiKeys(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	keys, err := apiKeyService.GetKeys(uint(userID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch API keys",
+		})
+	}
+
+	return c.JSON(keys)
+}
+
+// RotateApiKey @Summary Rotate an API key
+// @Description Issue a replacement for a key with the same name, scopes and trips. The old key keeps working for the grace period, or is revoked right away without one.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param id path int true "API key ID"
+// @Param rotation body RotateApiKeyRequest false "Grace period"
+// @Success 201 {object} services.IssuedApiKey
+// @Router /api-keys/{id}/rotate [post]
+func RotateApiKey(c *fiber.Ctx) error {
+	userID, keyID, status, message := apiKeyRequest(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	var req RotateApiKeyRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+	}
+	var gracePeriod time.Duration
+	if req.GracePeriod != "" {
+		var err error
+		if gracePeriod, err = time.ParseDuration(req.GracePeriod); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid grace_period",
+			})
+		}
+	}
+
+	issued, err := apiKeyService.RotateKey(userID, keyID, gracePeriod)
+	if err != nil {
+		return apiKeyError(c, err)
+	}
+
+	return c.Status(201).JSON(issued)
+}
+
+// RevokeApiKey @Summary Revoke an API key
+// @Description Revoke a key, so it can't authenticate anymore
+// @Tags api-keys
+// @Produce json
+// @Param id path int true "API key ID"
+// @Success 200 {object} models.ApiKey
+// @Router /api-keys/{id} [delete]
+func RevokeApiKey(c *fiber.Ctx) error {
+	userID, keyID, status, message := apiKeyRequest(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	apiKey, err := apiKeyService.RevokeKey(userID, keyID)
+	if err != nil {
+		return apiKeyError(c, err)
+	}
+
+	return c.JSON(apiKey)
+}
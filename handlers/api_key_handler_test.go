@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/middleware"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ApiKeyHandlerTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	carrier models.User
+	trip    models.Trip
+	other   models.Trip
+}
+
+func (suite *ApiKeyHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+
+	apiKeyService = services.NewApiKeyService(testDB)
+
+	suite.carrier = models.User{}
+	testDB.Where("email = ?", "test@example.com").First(&suite.carrier)
+	suite.trip = models.Trip{}
+	testDB.Where("user_id = ?", suite.carrier.ID).First(&suite.trip)
+	suite.other = models.Trip{UserID: suite.carrier.ID, OriginAddress: "A", DestinationAddress: "B", Status: "PLANNED", DepartureDate: time.Now(), EstimatedArrival: time.Now().Add(time.Hour)}
+	testDB.Create(&suite.other)
+
+	suite.app = fiber.New()
+
+	keys := suite.app.Group("/api-keys", asHeaderUser())
+	keys.Post("/", CreateApiKey)
+	keys.Get("/", GetApiKeys)
+	keys.Post("/:id/rotate", RotateApiKey)
+	keys.Delete("/:id", RevokeApiKey)
+
+	apiKeyMiddleware := middleware.NewApiKeyMiddleware(testDB)
+	integrations := suite.app.Group("/integrations", apiKeyMiddleware.Authenticate())
+	actingUser := func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"user_id": c.Locals("user_id")})
+	}
+	integrations.Post("/trips/:trip_id/location", apiKeyMiddleware.RequireScope(services.ScopeTrackingWrite), actingUser)
+	integrations.Get("/trips/:trip_id/current", apiKeyMiddleware.RequireScope(services.ScopeTrackingRead), actingUser)
+}
+
+func (suite *ApiKeyHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *ApiKeyHandlerTestSuite) request(method, url string, userID uint, body interface{}) (int, []byte) {
+	jsonData, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var respBody bytes.Buffer
+	respBody.ReadFrom(resp.Body)
+	return resp.StatusCode, respBody.Bytes()
+}
+
+func (suite *ApiKeyHandlerTestSuite) integrationRequest(method, url, header, value string) int {
+	req := httptest.NewRequest(method, url, nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	return resp.StatusCode
+}
+
+func (suite *ApiKeyHandlerTestSuite) createKey(req services.ApiKeyRequest) (int, services.IssuedApiKey) {
+	status, body := suite.request("POST", "/api-keys", suite.carrier.ID, req)
+
+	var issued services.IssuedApiKey
+	if status == 201 {
+		suite.Require().NoError(json.Unmarshal(body, &issued))
+	}
+	return status, issued
+}
+
+func (suite *ApiKeyHandlerTestSuite) tripURL(tripID uint, action string) string {
+	return "/integrations/trips/" + strconv.Itoa(int(tripID)) + "/" + action
+}
+
+func (suite *ApiKeyHandlerTestSuite) TestIssueAndAuthenticate() {
+	t := suite.T()
+
+	status, issued := suite.createKey(services.ApiKeyRequest{
+		Name:    "Telematics provider",
+		Scopes:  []string{services.ScopeTrackingWrite},
+		TripIDs: []uint{suite.trip.ID},
+	})
+	assert.Equal(t, 201, status)
+	assert.Contains(t, issued.Key, "tlk_")
+	assert.True(t, len(issued.Key) > len(issued.ApiKey.Prefix))
+	assert.Equal(t, issued.Key[:len(issued.ApiKey.Prefix)], issued.ApiKey.Prefix)
+
+	// Only the hash is stored
+	var stored models.ApiKey
+	testDB.First(&stored, issued.ApiKey.ID)
+	assert.NotEqual(t, issued.Key, stored.KeyHash)
+	storedJSON, _ := json.Marshal(stored)
+	assert.NotContains(t, string(storedJSON), "key_hash")
+
+	status, body := suite.request("POST", suite.tripURL(suite.trip.ID, "location"), 0, nil)
+	assert.Equal(t, 401, status, string(body))
+
+	assert.Equal(t, 200, suite.integrationRequest("POST", suite.tripURL(suite.trip.ID, "location"), "X-API-Key", issued.Key))
+	assert.Equal(t, 200, suite.integrationRequest("POST", suite.tripURL(suite.trip.ID, "location"), "Authorization", "ApiKey "+issued.Key))
+	assert.Equal(t, 401, suite.integrationRequest("POST", suite.tripURL(suite.trip.ID, "location"), "X-API-Key", issued.Key+"0"))
+
+	// User tokens aren't accepted
+	assert.Equal(t, 401, suite.integrationRequest("POST", suite.tripURL(suite.trip.ID, "location"), "Authorization", "Bearer "+issued.Key))
+
+	// Scopes and trips are enforced
+	assert.Equal(t, 403, suite.integrationRequest("GET", suite.tripURL(suite.trip.ID, "current"), "X-API-Key", issued.Key))
+	assert.Equal(t, 403, suite.integrationRequest("POST", suite.tripURL(suite.other.ID, "location"), "X-API-Key", issued.Key))
+
+	testDB.First(&stored, issued.ApiKey.ID)
+	assert.NotNil(t, stored.LastUsedAt)
+}
+
+func (suite *ApiKeyHandlerTestSuite) TestCarrierWideKey() {
+	t := suite.T()
+
+	status, issued := suite.createKey(services.ApiKeyRequest{
+		Name:   "Fleet",
+		Scopes: []string{services.ScopeTrackingWrite, services.ScopeTrackingRead},
+	})
+	assert.Equal(t, 201, status)
+
+	assert.Equal(t, 200, suite.integrationRequest("POST", suite.tripURL(suite.other.ID, "location"), "X-API-Key", issued.Key))
+	assert.Equal(t, 200, suite.integrationRequest("GET", suite.tripURL(suite.trip.ID, "current"), "X-API-Key", issued.Key))
+
+	// Trips of other carriers are off limits
+	otherCarrier := models.User{Email: "carrier2@example.com", Phone: "+1555000333", Password: "password", Role: "CARRIER"}
+	testDB.Create(&otherCarrier)
+	foreignTrip := models.Trip{UserID: otherCarrier.ID, OriginAddress: "C", DestinationAddress: "D", Status: "PLANNED", DepartureDate: time.Now(), EstimatedArrival: time.Now().Add(time.Hour)}
+	testDB.Create(&foreignTrip)
+	assert.Equal(t, 403, suite.integrationRequest("POST", suite.tripURL(foreignTrip.ID, "location"), "X-API-Key", issued.Key))
+
+	status, _ = suite.createKey(services.ApiKeyRequest{Name: "Foreign", Scopes: []string{services.ScopeTrackingWrite}, TripIDs: []uint{foreignTrip.ID}})
+	assert.Equal(t, 400, status)
+}
+
+func (suite *ApiKeyHandlerTestSuite) TestValidation() {
+	t := suite.T()
+
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name string
+		req  services.ApiKeyRequest
+	}{
+		{"Missing name", services.ApiKeyRequest{Scopes: []string{services.ScopeTrackingWrite}}},
+		{"Missing scopes", services.ApiKeyRequest{Name: "Key"}},
+		{"Unknown scope", services.ApiKeyRequest{Name: "Key", Scopes: []string{"admin"}}},
+		{"Expired", services.ApiKeyRequest{Name: "Key", Scopes: []string{services.ScopeTrackingWrite}, ExpiresAt: &past}},
+	}
+	for _, tt := range tests {
+		status, _ := suite.createKey(tt.req)
+		assert.Equal(t, 400, status, tt.name)
+	}
+}
+
+func (suite *ApiKeyHandlerTestSuite) TestRotateAndRevoke() {
+	t := suite.T()
+
+	_, issued := suite.createKey(services.ApiKeyRequest{Name: "Provider", Scopes: []string{services.ScopeTrackingWrite}})
+	keyURL := "/api-keys/" + strconv.Itoa(int(issued.ApiKey.ID))
+
+	// With a grace period both keys work
+	status, body := suite.request("POST", keyURL+"/rotate", suite.carrier.ID, RotateApiKeyRequest{GracePeriod: "1h"})
+	assert.Equal(t, 201, status)
+	var rotated services.IssuedApiKey
+	assert.NoError(t, json.Unmarshal(body, &rotated))
+	assert.NotEqual(t, issued.Key, rotated.Key)
+	assert.Equal(t, "Provider", rotated.ApiKey.Name)
+
+	assert.Equal(t, 200, suite.integrationRequest("POST", suite.tripURL(suite.trip.ID, "location"), "X-API-Key", issued.Key))
+	assert.Equal(t, 200, suite.integrationRequest("POST", suite.tripURL(suite.trip.ID, "location"), "X-API-Key", rotated.Key))
+
+	var old models.ApiKey
+	testDB.First(&old, issued.ApiKey.ID)
+	assert.Equal(t, rotated.ApiKey.ID, *old.RotatedToID)
+	assert.NotNil(t, old.ExpiresAt)
+
+	// Without one the old key stops working right away
+	status, body = suite.request("POST", "/api-keys/"+strconv.Itoa(int(rotated.ApiKey.ID))+"/rotate", suite.carrier.ID, nil)
+	assert.Equal(t, 201, status)
+	var replacement services.IssuedApiKey
+	assert.NoError(t, json.Unmarshal(body, &replacement))
+	assert.Equal(t, 401, suite.integrationRequest("POST", suite.tripURL(suite.trip.ID, "location"), "X-API-Key", rotated.Key))
+
+	// Other users can't manage the key
+	status, _ = suite.request("DELETE", "/api-keys/"+strconv.Itoa(int(replacement.ApiKey.ID)), suite.carrier.ID+100, nil)
+	assert.Equal(t, 404, status)
+
+	status, _ = suite.request("DELETE", "/api-keys/"+strconv.Itoa(int(replacement.ApiKey.ID)), suite.carrier.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, 401, suite.integrationRequest("POST", suite.tripURL(suite.trip.ID, "location"), "X-API-Key", replacement.Key))
+
+	status, _ = suite.request("DELETE", "/api-keys/"+strconv.Itoa(int(replacement.ApiKey.ID)), suite.carrier.ID, nil)
+	assert.Equal(t, 400, status)
+
+	status, body = suite.request("GET", "/api-keys", suite.carrier.ID, nil)
+	assert.Equal(t, 200, status)
+	var keys []models.ApiKey
+	assert.NoError(t, json.Unmarshal(body, &keys))
+	assert.Len(t, keys, 3)
+}
+
+func TestApiKeyHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(ApiKeyHandlerTestSuite))
+}
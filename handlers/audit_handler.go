@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"strconv"
+	"triplink/backend/database"
+	"triplink/backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetAuditLogs @Summary Get audit logs
+// @Description Get the audit log of mutating API calls, newest first, filtered by actor, entity and date. Changes hold the before and after values of the entity's status and capacity fields.
+// @Tags admin
+// @Produce json
+// @Param user_id query int false "Actor user ID"
+// @Param entity_type query string false "Entity type, e.g. trip, load, quote"
+// @Param entity_id query int false "Entity ID"
+// @Param request_id query string false "Request ID"
+// @Param from query string false "Start date (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "End date (RFC3339 or YYYY-MM-DD, inclusive)"
+// @Param limit query int false "Number of logs to return (default 50)"
+// @Param offset query int false "Number of logs to skip (default 0, ignored with cursor)"
+// @Param cursor query string false "Cursor from next_cursor of the previous page"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/audit-logs [get]
+func GetAuditLogs(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	page, err := parsePageParams(c, 50)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
+	}
+
+	query := database.DB.Model(&models.AuditLog{})
+	if value := c.Query("user_id"); value != "" {
+		userID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid user ID",
+			})
+		}
+		query = query.Where("actor_id = ?", userID)
+	}
+	if entityType := c.Query("entity_type"); entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	if value := c.Query("entity_id"); value != "" {
+		entityID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid entity ID",
+			})
+		}
+		query = query.Where("entity_id = ?", entityID)
+	}
+	if requestID := c.Query("request_id"); requestID != "" {
+		query = query.Where("request_id = ?", requestID)
+	}
+	if value := c.Query("from"); value != "" {
+		from, err := parseSearchDate(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid from date",
+			})
+		}
+		query = query.Where("created_at >= ?", from)
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := parseSearchDate(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid to date",
+			})
+		}
+		if len(value) == len("2006-01-02") {
+			// A date includes the whole day
+			query = query.Where("created_at < ?", to.AddDate(0, 0, 1))
+		} else {
+			query = query.Where("created_at <= ?", to)
+		}
+	}
+
+	var total int64
+	query.Session(&gorm.Session{}).Count(&total)
+
+	var logs []models.AuditLog
+	if err := page.paginate(query, "created_at").Find(&logs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch audit logs",
+		})
+	}
+
+	nextCursor := ""
+	if page.hasMore(len(logs)) {
+		logs = logs[:page.Limit]
+		last := logs[len(logs)-1]
+		nextCursor = encodePageCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        logs,
+		"count":       len(logs),
+		"total":       total,
+		"limit":       page.Limit,
+		"offset":      page.Offset,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	})
+}
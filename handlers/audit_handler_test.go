@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"triplink/backend/config"
+	"triplink/backend/middleware"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type AuditHandlerTestSuite struct {
+	suite.Suite
+	app   *fiber.App
+	admin models.User
+}
+
+func (suite *AuditHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+
+	suite.admin = models.User{Email: "admin@example.com", Phone: "+1987654321", Password: "password", Role: "ADMIN"}
+	testDB.Create(&suite.admin)
+
+	suite.app = fiber.New()
+
+	suite.app.Use(asHeaderUser())
+	suite.app.Use(middleware.NewAuditMiddleware(testDB, &config.AuditConfig{
+		Enabled:   true,
+		SkipPaths: []string{"/analytics"},
+	}).Audit())
+
+	suite.app.Put("/trips/:trip_id/status", func(c *fiber.Ctx) error {
+		var body struct {
+			Status string `json:"status"`
+		}
+		c.BodyParser(&body)
+		testDB.Model(&models.Trip{}).Where("id = ?", c.Params("trip_id")).Update("status", body.Status)
+		return c.JSON(fiber.Map{"status": body.Status})
+	})
+	suite.app.Post("/loads/:load_id/book", func(c *fiber.Ctx) error {
+		var body struct {
+			TripID uint `json:"trip_id"`
+		}
+		c.BodyParser(&body)
+		loadID, _ := strconv.Atoi(c.Params("load_id"))
+		booked, err := services.NewTripCapacityService(testDB).BookLoad(uint(loadID), body.TripID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(booked)
+	})
+	suite.app.Post("/analytics/on-time-delivery", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{})
+	})
+	suite.app.Get("/admin/audit-logs", GetAuditLogs)
+}
+
+func (suite *AuditHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *AuditHandlerTestSuite) request(method, url string, userID uint, body interface{}) (int, []byte) {
+	jsonData, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var respBody bytes.Buffer
+	respBody.ReadFrom(resp.Body)
+	return resp.StatusCode, respBody.Bytes()
+}
+
+func (suite *AuditHandlerTestSuite) auditLogs(query string) []models.AuditLog {
+	status, body := suite.request("GET", "/admin/audit-logs?"+query, suite.admin.ID, nil)
+	suite.Require().Equal(200, status)
+
+	var page struct {
+		Data []models.AuditLog `json:"data"`
+	}
+	suite.Require().NoError(json.Unmarshal(body, &page))
+	return page.Data
+}
+
+func (suite *AuditHandlerTestSuite) TestAuditStatusChange() {
+	t := suite.T()
+
+	var trip models.Trip
+	testDB.First(&trip)
+	tripPath := strconv.Itoa(int(trip.ID))
+
+	status, _ := suite.request("PUT", "/trips/"+tripPath+"/status", trip.UserID, fiber.Map{"status": "IN_TRANSIT"})
+	assert.Equal(t, 200, status)
+
+	logs := suite.auditLogs("entity_type=trip&entity_id=" + tripPath)
+	if assert.Len(t, logs, 1) {
+		entry := logs[0]
+		assert.Equal(t, "PUT", entry.Method)
+		assert.Equal(t, "/trips/:trip_id/status", entry.Endpoint)
+		assert.Equal(t, 200, entry.StatusCode)
+		if assert.NotNil(t, entry.ActorID) {
+			assert.Equal(t, trip.UserID, *entry.ActorID)
+		}
+
+		var changes map[string]services.AuditChange
+		assert.NoError(t, json.Unmarshal([]byte(entry.Changes), &changes))
+		assert.Equal(t, services.AuditChange{From: "PLANNED", To: "IN_TRANSIT"}, changes["status"])
+		assert.Len(t, changes, 1)
+	}
+
+	// Calls that only compute results aren't audited
+	status, _ = suite.request("POST", "/analytics/on-time-delivery", trip.UserID, nil)
+	assert.Equal(t, 200, status)
+	assert.Len(t, suite.auditLogs(""), 1)
+
+	// Filters
+	assert.Len(t, suite.auditLogs("user_id="+strconv.Itoa(int(suite.admin.ID))), 0)
+	assert.Len(t, suite.auditLogs("from=2000-01-01&to=2000-01-02"), 0)
+
+	status, _ = suite.request("GET", "/admin/audit-logs", trip.UserID, nil)
+	assert.Equal(t, 403, status)
+}
+
+func (suite *AuditHandlerTestSuite) TestAuditCapacityChange() {
+	t := suite.T()
+
+	var carrier models.User
+	testDB.Where("email = ?", "test@example.com").First(&carrier)
+
+	trip := models.Trip{
+		UserID:              carrier.ID,
+		Status:              "PLANNED",
+		TotalCapacityWeight: 1000,
+		TotalCapacityVolume: 20,
+	}
+	testDB.Create(&trip)
+	load := models.Load{
+		ShipperID:        carrier.ID,
+		BookingReference: "TEST-LOAD-002",
+		Status:           "QUOTED",
+		Weight:           200,
+		Volume:           2,
+	}
+	testDB.Create(&load)
+
+	status, _ := suite.request("POST", "/loads/"+strconv.Itoa(int(load.ID))+"/book", carrier.ID, fiber.Map{"trip_id": trip.ID})
+	assert.Equal(t, 200, status)
+
+	loadLogs := suite.auditLogs("entity_type=load&entity_id=" + strconv.Itoa(int(load.ID)))
+	tripLogs := suite.auditLogs("entity_type=trip&entity_id=" + strconv.Itoa(int(trip.ID)))
+	if assert.Len(t, loadLogs, 1) && assert.Len(t, tripLogs, 1) {
+		assert.Equal(t, loadLogs[0].RequestID, tripLogs[0].RequestID)
+
+		var loadChanges map[string]services.AuditChange
+		assert.NoError(t, json.Unmarshal([]byte(loadLogs[0].Changes), &loadChanges))
+		assert.Equal(t, "BOOKED", loadChanges["status"].To)
+		assert.Equal(t, float64(trip.ID), loadChanges["trip_id"].To)
+
+		var tripChanges map[string]services.AuditChange
+		assert.NoError(t, json.Unmarshal([]byte(tripLogs[0].Changes), &tripChanges))
+		assert.Equal(t, services.AuditChange{From: float64(0), To: float64(200)}, tripChanges["used_weight"])
+		assert.Equal(t, services.AuditChange{From: float64(0), To: float64(2)}, tripChanges["used_volume"])
+	}
+}
+
+func TestAuditHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(AuditHandlerTestSuite))
+}
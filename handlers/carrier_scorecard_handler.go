@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var carrierScorecardService = services.NewCarrierScorecardService(database.DB)
+
+// GetCarrierScorecard @Summary Get a carrier's performance scorecard
+// @Description Summarize a carrier's on-time percentage, the share of their loads moved to EXCEPTION, how quickly they quote on posted loads, how completely their trips were tracked and shippers' review ratings over a period, computed from their trips, loads, quotes and tracking data. Any user can see a carrier's scorecard, so shippers can compare carriers before booking. Scorecards are cached for 15 minutes.
+// @Tags carriers
+// @Produce json
+// @Param carrier_id path int true "Carrier ID"
+// @Param from query string false "Start of the period (RFC3339 or YYYY-MM-DD, default 90 days before to)"
+// @Param to query string false "End of the period (RFC3339 or YYYY-MM-DD, default now)"
+// @Success 200 {object} services.CarrierScorecard
+// @Router /carriers/{carrier_id}/scorecard [get]
+func GetCarrierScorecard(c *fiber.Ctx) error {
+	carrierID, err := strconv.ParseUint(c.Params("carrier_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid carrier ID",
+		})
+	}
+
+	from, to, message := scorecardPeriod(c)
+	if message != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+	start, end := carrierScorecardService.Period(from, to)
+	if !start.Before(end) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "from must be before to",
+		})
+	}
+
+	// Keyed by the requested period rather than the computed one, which moves
+	// with the current time when no to date is given
+	cacheKey := fmt.Sprintf("%d:%s:%s", carrierID, c.Query("from"), c.Query("to"))
+	var cached services.CarrierScorecard
+	if err := analyticsCache.GetCachedAnalyticsResult("carrier_scorecard", cacheKey, &cached); err == nil {
+		c.Set("X-Cache", "HIT")
+		return c.JSON(cached)
+	}
+
+	scorecard, err := carrierScorecardService.Scorecard(uint(carrierID), start, end)
+	if err == gorm.ErrRecordNotFound {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Carrier not found",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not score carrier",
+		})
+	}
+
+	go func() {
+		analyticsCache.CacheAnalyticsResult("carrier_scorecard", cacheKey, scorecard)
+	}()
+
+	c.Set("X-Cache", "MISS")
+	return c.JSON(scorecard)
+}
+
+// scorecardPeriod parses the from and to dates of a scorecard request, or
+// returns the message to fail the request with. A date-only to includes the
+// whole day.
+func scorecardPeriod(c *fiber.Ctx) (*time.Time, *time.Time, string) {
+	var from, to *time.Time
+	if value := c.Query("to"); value != "" {
+		parsed, err := parseSearchDate(value)
+		if err != nil {
+			return nil, nil, "Invalid to date"
+		}
+		if len(value) == len("2006-01-02") {
+			parsed = parsed.Add(24 * time.Hour)
+		}
+		to = &parsed
+	}
+	if value := c.Query("from"); value != "" {
+		parsed, err := parseSearchDate(value)
+		if err != nil {
+			return nil, nil, "Invalid from date"
+		}
+		from = &parsed
+	}
+	return from, to, ""
+}
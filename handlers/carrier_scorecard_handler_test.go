@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type CarrierScorecardHandlerTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	carrier models.User
+	shipper models.User
+	start   time.Time
+}
+
+func (suite *CarrierScorecardHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	carrierScorecardService = services.NewCarrierScorecardService(testDB)
+
+	suite.carrier = models.User{Email: "scorecard-carrier@example.com", Phone: "+15550000701", Password: "password", Role: "CARRIER", CompanyName: "Reliable Haulage"}
+	testDB.Create(&suite.carrier)
+	suite.shipper = models.User{Email: "scorecard-shipper@example.com", Phone: "+15550000702", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&suite.shipper)
+	suite.start = time.Now().UTC().Add(-10 * 24 * time.Hour).Truncate(time.Hour)
+
+	suite.app = fiber.New()
+	suite.app.Get("/carriers/:carrier_id/scorecard", GetCarrierScorecard)
+}
+
+func (suite *CarrierScorecardHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+// completedTrip adds a trip of the carrier estimated to take hours that
+// arrived delay late
+func (suite *CarrierScorecardHandlerTestSuite) completedTrip(departure time.Time, hours int, delay time.Duration) models.Trip {
+	estimated := departure.Add(time.Duration(hours) * time.Hour)
+	arrival := estimated.Add(delay)
+	trip := models.Trip{UserID: suite.carrier.ID, Status: "COMPLETED", DepartureDate: departure, EstimatedArrival: estimated, ActualArrival: &arrival}
+	testDB.Create(&trip)
+	return trip
+}
+
+// track records a position of a trip every 10 minutes from from until to
+func (suite *CarrierScorecardHandlerTestSuite) track(trip models.Trip, from, to time.Time) {
+	for at := from; !at.After(to); at = at.Add(10 * time.Minute) {
+		testDB.Create(&models.TrackingRecord{TripID: trip.ID, Latitude: -17.8, Longitude: 31.0, Timestamp: at, Source: "GPS"})
+	}
+}
+
+func (suite *CarrierScorecardHandlerTestSuite) load(reference string, tripID uint, status string, createdAt time.Time) models.Load {
+	load := models.Load{TripID: tripID, ShipperID: suite.shipper.ID, BookingReference: reference, Status: status}
+	load.CreatedAt = createdAt
+	testDB.Create(&load)
+	return load
+}
+
+func (suite *CarrierScorecardHandlerTestSuite) scorecard(query string) (int, map[string]interface{}) {
+	req := httptest.NewRequest("GET", fmt.Sprintf("/carriers/%d/scorecard%s", suite.carrier.ID, query), nil)
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	var body map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func (suite *CarrierScorecardHandlerTestSuite) TestScorecard() {
+	t := suite.T()
+
+	// Tracked throughout and on time, untracked and two hours late, and on
+	// time but with an hour without positions
+	tracked := suite.completedTrip(suite.start, 6, 0)
+	suite.track(tracked, suite.start, suite.start.Add(6*time.Hour))
+	late := suite.completedTrip(suite.start.Add(24*time.Hour), 6, 2*time.Hour)
+	gap := suite.completedTrip(suite.start.Add(48*time.Hour), 4, 0)
+	suite.track(gap, gap.DepartureDate, gap.DepartureDate.Add(2*time.Hour))
+	suite.track(gap, gap.DepartureDate.Add(3*time.Hour), gap.DepartureDate.Add(4*time.Hour))
+	// Before the default period
+	suite.completedTrip(suite.start.AddDate(0, -6, 0), 6, 3*time.Hour)
+
+	// A load that recovered from an exception, one still held up and one
+	// delivered without trouble. Cancelled loads don't count.
+	recovered := suite.load("SCORE-1", tracked.ID, "DELIVERED", suite.start)
+	testDB.Create(&models.TrackingEvent{TripID: tracked.ID, LoadID: &recovered.ID, EventType: "LOAD_STATUS_CHANGE", EventData: `{"from":"IN_TRANSIT","to":"EXCEPTION"}`, Timestamp: suite.start})
+	suite.load("SCORE-2", late.ID, "EXCEPTION", suite.start)
+	suite.load("SCORE-3", late.ID, "DELIVERED", suite.start)
+	suite.load("SCORE-4", gap.ID, "CANCELLED", suite.start)
+
+	// First quoted 2 and 4 hours after the loads were posted
+	posted := time.Now().UTC().Add(-5 * 24 * time.Hour)
+	first := suite.load("SCORE-5", 0, "QUOTED", posted)
+	second := suite.load("SCORE-6", 0, "QUOTED", posted)
+	quote := func(loadID uint, after time.Duration, parentID *uint) models.Quote {
+		quote := models.Quote{LoadID: loadID, CarrierID: suite.carrier.ID, QuoteAmount: 500, Status: "PENDING", ProposedBy: "CARRIER", ParentQuoteID: parentID}
+		quote.CreatedAt = posted.Add(after)
+		testDB.Create(&quote)
+		return quote
+	}
+	original := quote(first.ID, 2*time.Hour, nil)
+	quote(first.ID, 10*time.Hour, nil)
+	quote(first.ID, 20*time.Hour, &original.ID)
+	quote(second.ID, 4*time.Hour, nil)
+
+	testDB.Create(&models.Review{ReviewerID: suite.shipper.ID, RevieweeID: suite.carrier.ID, LoadID: recovered.ID, Rating: 5, ReviewType: "SHIPPER_TO_CARRIER"})
+	testDB.Create(&models.Review{ReviewerID: suite.shipper.ID, RevieweeID: suite.carrier.ID, LoadID: first.ID, Rating: 4, ReviewType: "SHIPPER_TO_CARRIER"})
+	testDB.Create(&models.Review{ReviewerID: suite.carrier.ID, RevieweeID: suite.carrier.ID, LoadID: second.ID, Rating: 1, ReviewType: "CARRIER_TO_SHIPPER"})
+
+	status, body := suite.scorecard("")
+	suite.Require().Equal(200, status, body)
+	assert.Equal(t, "Reliable Haulage", body["carrier_name"])
+	assert.Equal(t, float64(3), body["completed_trips"])
+	assert.Equal(t, float64(2), body["on_time_trips"])
+	assert.InDelta(t, 66.67, body["on_time_percentage"], 0.001)
+
+	assert.Equal(t, float64(3), body["loads"])
+	assert.Equal(t, float64(2), body["exception_loads"])
+	assert.InDelta(t, 66.67, body["exception_rate"], 0.001)
+
+	assert.Equal(t, float64(2), body["quoted_loads"])
+	assert.InDelta(t, 3, body["average_quote_response_hours"], 0.001)
+
+	// Fully, not and three quarters tracked
+	assert.Equal(t, float64(2), body["tracked_trips"])
+	assert.InDelta(t, 58.33, body["tracking_quality_score"], 0.001)
+
+	assert.Equal(t, float64(2), body["reviews"])
+	assert.InDelta(t, 4.5, body["average_rating"], 0.001)
+
+	// A longer period includes the older trip
+	status, body = suite.scorecard("?from=" + suite.start.AddDate(-1, 0, 0).Format("2006-01-02"))
+	suite.Require().Equal(200, status)
+	assert.Equal(t, float64(4), body["completed_trips"])
+	assert.InDelta(t, 50, body["on_time_percentage"], 0.001)
+}
+
+func (suite *CarrierScorecardHandlerTestSuite) TestEmptyScorecard() {
+	t := suite.T()
+
+	status, body := suite.scorecard("?from=2024-01-01&to=2024-03-31")
+	suite.Require().Equal(200, status)
+	assert.Equal(t, float64(0), body["completed_trips"])
+	assert.Nil(t, body["on_time_percentage"])
+	assert.Nil(t, body["exception_rate"])
+	assert.Nil(t, body["tracking_quality_score"])
+	assert.Nil(t, body["average_rating"])
+	assert.Equal(t, "2024-04-01T00:00:00Z", body["to"])
+
+	status, _ = suite.scorecard("?from=last-week")
+	assert.Equal(t, 400, status)
+	status, _ = suite.scorecard("?from=2024-03-31&to=2024-01-01")
+	assert.Equal(t, 400, status)
+
+	// Only carriers have scorecards
+	req := httptest.NewRequest("GET", fmt.Sprintf("/carriers/%d/scorecard", suite.shipper.ID), nil)
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+func TestCarrierScorecardHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(CarrierScorecardHandlerTestSuite))
+}
@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/docs"
+	"triplink/backend/internal/openapi"
+	"triplink/backend/middleware"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// contractExempt are the covered operations the contract tests can't call,
+// and why
+var contractExempt = map[string]string{
+	"GET /api/tracking/trips/{trip_id}/stream": "streams server-sent events until the client disconnects",
+}
+
+// contractCovered reports whether the contract tests must call an operation:
+// every tracking, analytics and notification endpoint
+func contractCovered(path string) bool {
+	return strings.HasPrefix(path, "/api/tracking/") || strings.HasPrefix(path, "/api/analytics/") ||
+		strings.HasPrefix(path, "/api/monitoring/") || strings.Contains(path, "notification")
+}
+
+// contractCase is a call the contract tests make, and the status it should
+// get. Responses that don't match the spec get a 500 instead.
+type contractCase struct {
+	method string
+	path   string
+	user   uint
+	body   interface{}
+	status int
+}
+
+type ContractTestSuite struct {
+	suite.Suite
+	app  *fiber.App
+	spec *openapi.Document
+
+	carrier      models.User
+	shipper      models.User
+	admin        models.User
+	trip         models.Trip
+	load         models.Load
+	stop         models.TripStop
+	notification models.Notification
+	deadLetter   models.NotificationDeadLetter
+	suggestions  []models.TripStatusSuggestion
+}
+
+func (suite *ContractTestSuite) SetupTest() {
+	clearTestDB()
+	trackingService = services.NewTrackingService(testDB)
+	tripAssignmentService = services.NewTripAssignmentService(testDB)
+	organizationService = services.NewOrganizationService(testDB)
+	workspaceService = services.NewWorkspaceService(testDB)
+	analyticsService = services.NewAnalyticsService(testDB)
+	stopCheckInService = services.NewStopCheckInService(testDB, services.NewFileStorage(storageConfig), config.GetDetentionConfig(), storageConfig.MaxUploadSize)
+
+	spec, err := openapi.Load(docs.OpenAPI)
+	suite.Require().NoError(err)
+	suite.spec = spec
+
+	suite.carrier = models.User{Email: "contract-carrier@example.com", Phone: "+15550000801", Password: "password", Role: "CARRIER"}
+	suite.shipper = models.User{Email: "contract-shipper@example.com", Phone: "+15550000802", Password: "password", Role: "SHIPPER"}
+	suite.admin = models.User{Email: "contract-admin@example.com", Phone: "+15550000803", Password: "password", Role: "ADMIN"}
+	for _, user := range []*models.User{&suite.carrier, &suite.shipper, &suite.admin} {
+		suite.Require().NoError(testDB.Create(user).Error)
+	}
+
+	departure := time.Now().Add(-2 * time.Hour)
+	suite.trip = models.Trip{
+		UserID:             suite.carrier.ID,
+		OriginAddress:      "1 Harbour Rd",
+		OriginLat:          -17.8292,
+		OriginLng:          31.0522,
+		DestinationAddress: "2 Main St",
+		DestinationLat:     -20.1325,
+		DestinationLng:     28.6265,
+		Status:             "IN_TRANSIT",
+		TrackingEnabled:    true,
+		DepartureDate:      departure,
+		EstimatedArrival:   departure.Add(6 * time.Hour),
+	}
+	suite.Require().NoError(testDB.Create(&suite.trip).Error)
+	suite.load = models.Load{
+		ShipperID:             suite.shipper.ID,
+		TripID:                suite.trip.ID,
+		BookingReference:      "CONTRACT-001",
+		Status:                "IN_TRANSIT",
+		RequestedPickupDate:   departure,
+		RequestedDeliveryDate: departure.Add(6 * time.Hour),
+	}
+	suite.Require().NoError(testDB.Create(&suite.load).Error)
+	suite.stop = models.TripStop{TripID: suite.trip.ID, LoadID: &suite.load.ID, Sequence: 1, StopType: "DELIVERY", Address: "2 Main St", Latitude: -20.1325, Longitude: 28.6265, Status: "PENDING"}
+	suite.Require().NoError(testDB.Create(&suite.stop).Error)
+	for i, at := range []time.Time{departure.Add(30 * time.Minute), departure.Add(time.Hour)} {
+		speed := 80.0
+		suite.Require().NoError(testDB.Create(&models.TrackingRecord{
+			TripID:    suite.trip.ID,
+			Latitude:  -17.9 - float64(i)*0.5,
+			Longitude: 30.9 - float64(i)*0.5,
+			Speed:     &speed,
+			Timestamp: at,
+			Source:    "GPS",
+			Status:    "ACTIVE",
+		}).Error)
+	}
+	suite.suggestions = []models.TripStatusSuggestion{
+		{TripID: suite.trip.ID, Status: "COMPLETED", Reason: "Stopped at the destination for 30m", State: services.StatusSuggestionPending, SuggestedAt: departure.Add(time.Hour)},
+		{TripID: suite.trip.ID, Status: "COMPLETED", Reason: "Stopped at the destination for 30m", State: services.StatusSuggestionPending, SuggestedAt: departure.Add(2 * time.Hour)},
+	}
+	suite.Require().NoError(testDB.Create(&suite.suggestions).Error)
+	suite.notification = models.Notification{UserID: suite.shipper.ID, Title: "Trip delayed", Message: "Your load is running late", Type: "TRIP_DELAYED"}
+	suite.Require().NoError(testDB.Create(&suite.notification).Error)
+	suite.deadLetter = models.NotificationDeadLetter{NotificationID: suite.notification.ID, UserID: suite.shipper.ID, Channel: "PUSH", Attempts: 5, LastError: "device unreachable"}
+	suite.Require().NoError(testDB.Create(&suite.deadLetter).Error)
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Use(middleware.NewContractMiddleware(docs.OpenAPI, &config.APIContractConfig{Validate: true}).Validate())
+
+	tracking := suite.app.Group("/api/tracking")
+	tracking.Post("/trips/:trip_id/location", UpdateTripLocation)
+	tracking.Get("/trips/:trip_id/current", GetCurrentTripLocation)
+	tracking.Get("/trips/:trip_id/history", GetTripTrackingHistory)
+	tracking.Put("/trips/:trip_id/status", UpdateTripStatus)
+	tracking.Post("/trips/:trip_id/pause", PauseTripTracking)
+	tracking.Post("/trips/:trip_id/resume", ResumeTripTracking)
+	tracking.Post("/trips/:trip_id/consent", RecordTripTrackingConsent)
+	tracking.Get("/trips/:trip_id/eta", GetTripETA)
+	tracking.Get("/trips/:trip_id/status", GetTripTrackingStatus)
+	tracking.Get("/trips/:trip_id/status-suggestions", GetTripStatusSuggestions)
+	tracking.Post("/trips/:trip_id/status-suggestions/:suggestion_id/confirm", ConfirmTripStatusSuggestion)
+	tracking.Post("/trips/:trip_id/status-suggestions/:suggestion_id/dismiss", DismissTripStatusSuggestion)
+	tracking.Get("/trips/:trip_id/events", GetTripTrackingEvents)
+	tracking.Get("/trips/:trip_id/route", GetTripRoute)
+	tracking.Put("/trips/:trip_id/route", UpdateTripPlannedRoute)
+	tracking.Get("/trips/:trip_id/replay", GetTripReplay)
+	tracking.Get("/trips/:trip_id/stops", GetTripStops)
+	tracking.Post("/trips/:trip_id/stops/generate", GenerateTripStops)
+	tracking.Put("/trips/:trip_id/stops/:stop_id/status", UpdateTripStopStatus)
+	tracking.Get("/trips/:trip_id/stops/:stop_id/check-ins", GetStopCheckIns)
+	tracking.Get("/loads/:load_id", GetLoadTracking)
+	tracking.Get("/loads/:load_id/events", GetLoadTrackingEvents)
+	tracking.Put("/loads/:load_id/status", UpdateLoadStatus)
+	tracking.Post("/trips/:trip_id/loads/status", UpdateTripLoadStatuses)
+	tracking.Get("/loads/:load_id/history", GetLoadTrackingHistory)
+	tracking.Get("/users/:user_id/active", GetUserActiveTrackings)
+	tracking.Get("/users/:user_id/shipper-view", GetShipperTrackingView)
+	tracking.Get("/users/:user_id/carrier-view", GetCarrierTrackingView)
+	tracking.Get("/users/:carrier_id/fleet/live", GetFleetLiveMap)
+
+	analytics := suite.app.Group("/api/analytics")
+	analytics.Post("/on-time-delivery", GetOnTimeDeliveryAnalytics)
+	analytics.Post("/delivery-performance/by-route", GetDeliveryPerformanceByRoute)
+	analytics.Post("/delivery-performance/by-driver", GetDeliveryPerformanceByDriver)
+	analytics.Post("/customer-satisfaction", GetCustomerSatisfactionAnalytics)
+	analytics.Post("/load-matching", GetLoadMatchingAnalytics)
+	analytics.Post("/capacity-utilization", GetCapacityUtilizationAnalytics)
+	analytics.Post("/delay-analysis", GetDelayAnalysisAnalytics)
+	analytics.Post("/dwell-time", GetDwellTimeAnalytics)
+	analytics.Post("/vehicle-capacity", GetVehicleCapacityData)
+	analytics.Post("/trends", GetAnalyticsTrends)
+	analytics.Post("/comparison", GetAnalyticsComparison)
+	analytics.Post("/lanes", GetLaneBenchmark)
+	analytics.Post("/reports/:report", GenerateAnalyticsReport)
+	analytics.Post("/kpis/:category", GetOperationalKPIs)
+
+	monitoring := suite.app.Group("/api/monitoring")
+	monitoring.Get("/trips/:trip_id/analytics", GetTrackingAnalytics)
+	monitoring.Get("/tracking/health", GetSystemHealthMetrics)
+	monitoring.Get("/tracking/performance", GetTrackingPerformanceMetrics)
+	monitoring.Get("/tracking/data-quality", GetDataQualityReport)
+	monitoring.Get("/tracking/eta-accuracy", GetETAAccuracyReport)
+
+	suite.app.Post("/api/notifications", CreateNotification)
+	suite.app.Put("/api/notifications/:id/read", MarkNotificationAsRead)
+	suite.app.Put("/api/notifications/:id/unread", MarkNotificationAsUnread)
+	suite.app.Put("/api/notifications/:id/archive", ArchiveNotification)
+	suite.app.Put("/api/notifications/:id/unarchive", UnarchiveNotification)
+	suite.app.Delete("/api/notifications/:id", DeleteNotification)
+	suite.app.Get("/api/users/:user_id/notifications", GetUserNotifications)
+	suite.app.Get("/api/users/:user_id/notifications/count", GetNotificationCounts)
+	suite.app.Get("/api/users/:user_id/notifications/summary", GetNotificationSummary)
+	suite.app.Put("/api/users/:user_id/notifications/read-all", MarkAllNotificationsAsRead)
+	suite.app.Post("/api/users/:user_id/notifications/bulk", BulkUpdateNotifications)
+	suite.app.Post("/api/users/:user_id/notification-tokens", RegisterDeviceToken)
+	suite.app.Delete("/api/users/:user_id/notification-tokens", UnregisterDeviceToken)
+	suite.app.Get("/api/users/:user_id/notification-preferences", GetNotificationPreferences)
+	suite.app.Put("/api/users/:user_id/notification-preferences", UpdateNotificationPreferences)
+	suite.app.Get("/api/admin/notifications/dead-letters", GetNotificationDeadLetters)
+	suite.app.Post("/api/admin/notifications/dead-letters/:id/retry", RetryNotificationDeadLetter)
+}
+
+func (suite *ContractTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *ContractTestSuite) request(tc contractCase) (int, string) {
+	var body io.Reader
+	if tc.body != nil {
+		payload, _ := json.Marshal(tc.body)
+		body = bytes.NewReader(payload)
+	}
+	req := httptest.NewRequest(tc.method, tc.path, body)
+	req.Header.Set("Content-Type", "application/json")
+	if tc.user != 0 {
+		req.Header.Set("X-User-ID", fmt.Sprintf("%d", tc.user))
+	}
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	payload, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(payload)
+}
+
+// cases are the calls of the contract tests, in order: later calls see what
+// earlier ones changed
+func (suite *ContractTestSuite) cases() []contractCase {
+	trip := fmt.Sprintf("/api/tracking/trips/%d", suite.trip.ID)
+	load := fmt.Sprintf("/api/tracking/loads/%d", suite.load.ID)
+	carrier, shipper, admin := suite.carrier.ID, suite.shipper.ID, suite.admin.ID
+	shipperPath := fmt.Sprintf("/api/users/%d", shipper)
+	notification := fmt.Sprintf("/api/notifications/%d", suite.notification.ID)
+	filters := fiber.Map{"date_range": fiber.Map{
+		"start": time.Now().AddDate(0, -1, 0).Format("2006-01-02"),
+		"end":   time.Now().AddDate(0, 0, 1).Format("2006-01-02"),
+	}}
+
+	return []contractCase{
+		// Tracking
+		{"POST", trip + "/location", carrier, fiber.Map{"latitude": -18.4, "longitude": 30.4, "speed": 85, "source": "GPS"}, 200},
+		{"GET", trip + "/current", carrier, nil, 200},
+		{"GET", trip + "/history", carrier, nil, 200},
+		{"GET", trip + "/eta", carrier, nil, 200},
+		{"GET", trip + "/status", carrier, nil, 200},
+		{"GET", trip + "/events", carrier, nil, 200},
+		{"PUT", trip + "/route", carrier, fiber.Map{"polyline": "_p~iF~ps|U_ulLnnqC_mqNvxq`@", "source": "MANUAL"}, 200},
+		{"GET", trip + "/route", carrier, nil, 200},
+		{"GET", trip + "/replay", carrier, nil, 200},
+		{"POST", trip + "/stops/generate", carrier, nil, 200},
+		{"GET", trip + "/stops", carrier, nil, 200},
+		{"PUT", fmt.Sprintf("%s/stops/%d/status", trip, suite.stop.ID), carrier, fiber.Map{"status": "ARRIVED"}, 200},
+		{"GET", fmt.Sprintf("%s/stops/%d/check-ins", trip, suite.stop.ID), carrier, nil, 200},
+		{"POST", trip + "/consent", carrier, fiber.Map{"granted": true}, 200},
+		{"POST", trip + "/pause", carrier, fiber.Map{"reason": "Rest stop"}, 200},
+		{"POST", trip + "/resume", carrier, nil, 200},
+		{"PUT", trip + "/status", carrier, fiber.Map{"status": "DELAYED"}, 200},
+		{"GET", load, shipper, nil, 200},
+		{"GET", load + "/events", shipper, nil, 200},
+		{"GET", load + "/history", shipper, nil, 200},
+		{"POST", trip + "/loads/status", carrier, fiber.Map{"status": "EXCEPTION"}, 200},
+		{"PUT", load + "/status", carrier, fiber.Map{"status": "OUT_FOR_DELIVERY"}, 200},
+		{"GET", fmt.Sprintf("/api/tracking/users/%d/active", carrier), carrier, nil, 200},
+		{"GET", fmt.Sprintf("/api/tracking/users/%d/shipper-view", shipper), shipper, nil, 200},
+		{"GET", fmt.Sprintf("/api/tracking/users/%d/carrier-view", carrier), carrier, nil, 200},
+		{"GET", fmt.Sprintf("/api/tracking/users/%d/fleet/live", carrier), carrier, nil, 200},
+		{"GET", trip + "/status-suggestions", carrier, nil, 200},
+		{"POST", fmt.Sprintf("%s/status-suggestions/%d/dismiss", trip, suite.suggestions[0].ID), carrier, nil, 200},
+		{"POST", fmt.Sprintf("%s/status-suggestions/%d/confirm", trip, suite.suggestions[1].ID), carrier, nil, 200},
+		// Parameters and bodies of the wrong type never reach the handler
+		{"GET", "/api/tracking/trips/first/current", carrier, nil, 400},
+		{"POST", trip + "/location", carrier, fiber.Map{"latitude": "north", "longitude": 30.4}, 400},
+		// Values the handler rejects are reported field by field
+		{"POST", trip + "/location", carrier, fiber.Map{"latitude": 91, "longitude": 30.4}, 422},
+		{"PUT", load + "/status", carrier, fiber.Map{"status": "LOST"}, 422},
+
+		// Analytics
+		{"POST", "/api/analytics/on-time-delivery", admin, filters, 200},
+		{"POST", "/api/analytics/on-time-delivery?format=csv", admin, filters, 200},
+		{"POST", "/api/analytics/delivery-performance/by-route", admin, filters, 200},
+		{"POST", "/api/analytics/delivery-performance/by-driver", admin, filters, 200},
+		{"POST", "/api/analytics/customer-satisfaction", admin, filters, 200},
+		{"POST", "/api/analytics/load-matching", admin, filters, 200},
+		{"POST", "/api/analytics/capacity-utilization", admin, filters, 200},
+		{"POST", "/api/analytics/delay-analysis", admin, filters, 200},
+		{"POST", "/api/analytics/dwell-time", admin, filters, 200},
+		{"POST", "/api/analytics/vehicle-capacity", admin, filters, 200},
+		{"POST", "/api/analytics/trends", admin, filters, 200},
+		{"POST", "/api/analytics/comparison", admin, filters, 200},
+		{"POST", "/api/analytics/lanes", admin, fiber.Map{"origin_city": "Harare", "destination_city": "Johannesburg"}, 200},
+		{"POST", "/api/analytics/lanes", admin, filters, 422},
+		{"POST", "/api/analytics/reports/on-time-delivery?format=csv", admin, filters, 200},
+		{"POST", "/api/analytics/kpis/delivery", admin, filters, 200},
+		{"POST", "/api/analytics/trends", admin, fiber.Map{"vehicle_ids": "all"}, 400},
+
+		// Monitoring
+		{"GET", fmt.Sprintf("/api/monitoring/trips/%d/analytics", suite.trip.ID), carrier, nil, 200},
+		{"GET", "/api/monitoring/tracking/health", admin, nil, 200},
+		{"GET", "/api/monitoring/tracking/performance", admin, nil, 200},
+		{"GET", "/api/monitoring/tracking/data-quality", admin, nil, 200},
+		{"GET", "/api/monitoring/tracking/eta-accuracy", admin, nil, 200},
+
+		// Notifications
+		{"POST", "/api/notifications", shipper, fiber.Map{"user_id": shipper, "title": "Pickup", "message": "Your load was picked up", "type": "LOAD_PICKED_UP"}, 201},
+		{"GET", shipperPath + "/notifications", shipper, nil, 200},
+		{"GET", shipperPath + "/notifications?unread_only=yes", shipper, nil, 400},
+		{"GET", shipperPath + "/notifications?category=tracking&from=2024-01-01", shipper, nil, 200},
+		{"GET", shipperPath + "/notifications/count", shipper, nil, 200},
+		{"GET", shipperPath + "/notifications/summary", shipper, nil, 200},
+		{"PUT", notification + "/read", shipper, nil, 200},
+		{"PUT", notification + "/unread", shipper, nil, 200},
+		{"PUT", notification + "/archive", shipper, nil, 200},
+		{"PUT", notification + "/unarchive", shipper, nil, 200},
+		{"PUT", shipperPath + "/notifications/read-all", shipper, nil, 200},
+		{"POST", shipperPath + "/notifications/bulk", shipper, fiber.Map{"action": "UNREAD", "ids": []uint{suite.notification.ID}}, 200},
+		{"POST", shipperPath + "/notification-tokens", shipper, fiber.Map{"token": "device-token", "deviceType": "ANDROID"}, 200},
+		{"DELETE", shipperPath + "/notification-tokens", shipper, fiber.Map{"token": "device-token"}, 200},
+		{"GET", shipperPath + "/notification-preferences", shipper, nil, 200},
+		{"PUT", shipperPath + "/notification-preferences", shipper, fiber.Map{"delays": false, "location_updates": true}, 200},
+		{"GET", "/api/admin/notifications/dead-letters", admin, nil, 200},
+		// Without a running notification queue
+		{"POST", fmt.Sprintf("/api/admin/notifications/dead-letters/%d/retry", suite.deadLetter.ID), admin, nil, 503},
+		{"DELETE", notification, shipper, nil, 200},
+		{"PUT", notification + "/read", shipper, nil, 404},
+	}
+}
+
+func (suite *ContractTestSuite) TestEndpointsMatchSpec() {
+	t := suite.T()
+
+	called := map[string]bool{}
+	for _, tc := range suite.cases() {
+		operation, path, _ := suite.spec.Find(tc.method, strings.SplitN(tc.path, "?", 2)[0])
+		if !assert.NotNil(t, operation, "%s %s isn't in the spec", tc.method, tc.path) {
+			continue
+		}
+		called[tc.method+" "+path] = true
+
+		status, body := suite.request(tc)
+		assert.Equal(t, tc.status, status, "%s %s: %s", tc.method, tc.path, body)
+		if tc.status < 400 {
+			assert.NotContains(t, body, "API contract", "%s %s", tc.method, tc.path)
+		}
+	}
+
+	// Every tracking, analytics and notification endpoint is called
+	var missing []string
+	for _, operation := range suite.spec.Operations() {
+		key := operation[0] + " " + operation[1]
+		if contractCovered(operation[1]) && !called[key] && contractExempt[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	assert.Empty(t, missing, "endpoints without contract tests")
+}
+
+func (suite *ContractTestSuite) TestMismatchedResponsesAreRejected() {
+	t := suite.T()
+
+	// A handler answering with a shape its annotations don't document
+	app := fiber.New()
+	app.Use(middleware.NewContractMiddleware(docs.OpenAPI, &config.APIContractConfig{Validate: true}).Validate())
+	app.Get("/api/tracking/trips/:trip_id/stops", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"stops": []models.TripStop{suite.stop}})
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", fmt.Sprintf("/api/tracking/trips/%d/stops", suite.trip.ID), nil), -1)
+	suite.Require().NoError(err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, 500, resp.StatusCode)
+	assert.Contains(t, string(body), "Response does not match the API contract: status 200 $: is an object, not an array")
+}
+
+func TestContractTestSuite(t *testing.T) {
+	suite.Run(t, new(ContractTestSuite))
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetExchangeRates @Summary Get exchange rates
+// @Description Get the cached exchange rates against the base currency that quotes, payments and analytics are normalized to
+// @Tags currency
+// @Produce json
+// @Success 200 {object} services.ExchangeRates
+// @Router /exchange-rates [get]
+func GetExchangeRates(c *fiber.Ctx) error {
+	rates, err := services.GetCurrencyService().Rates()
+	if err != nil {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "Exchange rates are unavailable",
+		})
+	}
+
+	return c.JSON(rates)
+}
+
+// ConvertCurrency @Summary Convert an amount between currencies
+// @Description Convert an amount at the cached exchange rates
+// @Tags currency
+// @Produce json
+// @Param amount query number true "Amount"
+// @Param from query string true "Currency of the amount"
+// @Param to query string false "Currency to convert to (default the base currency)"
+// @Success 200 {object} map[string]interface{}
+// @Router /exchange-rates/convert [get]
+func ConvertCurrency(c *fiber.Ctx) error {
+	amount, err := strconv.ParseFloat(c.Query("amount"), 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid amount",
+		})
+	}
+
+	currencies := services.GetCurrencyService()
+	from := strings.ToUpper(c.Query("from"))
+	to := strings.ToUpper(c.Query("to", currencies.BaseCurrency()))
+	if len(from) != 3 || len(to) != 3 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "from and to must be 3 letter currency codes",
+		})
+	}
+
+	rate, err := currencies.Rate(from, to)
+	if err != nil {
+		status := 503
+		if errors.Is(err, services.ErrUnsupportedCurrency) {
+			status = 400
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	converted, _ := currencies.Convert(amount, from, to)
+	return c.JSON(fiber.Map{
+		"amount":    amount,
+		"from":      from,
+		"to":        to,
+		"rate":      rate,
+		"converted": converted,
+	})
+}
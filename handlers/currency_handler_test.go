@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// staticRateProvider returns fixed exchange rates against the euro
+type staticRateProvider struct {
+	calls int
+	err   error
+}
+
+func (p *staticRateProvider) Name() string {
+	return "static"
+}
+
+func (p *staticRateProvider) LatestRates() (string, map[string]float64, error) {
+	p.calls++
+	if p.err != nil {
+		return "", nil, p.err
+	}
+	return "EUR", map[string]float64{"USD": 1.25, "ZAR": 20, "GBP": 0.8}, nil
+}
+
+type CurrencyHandlerTestSuite struct {
+	suite.Suite
+	app      *fiber.App
+	provider *staticRateProvider
+}
+
+func (suite *CurrencyHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+
+	suite.provider = &staticRateProvider{}
+	services.SetCurrencyService(services.NewCurrencyServiceWithProvider(suite.provider, "USD", time.Hour))
+	analyticsService = services.NewAnalyticsService(testDB)
+
+	suite.app = fiber.New()
+	suite.app.Get("/exchange-rates", GetExchangeRates)
+	suite.app.Get("/exchange-rates/convert", ConvertCurrency)
+	suite.app.Post("/quotes", CreateQuote)
+	suite.app.Post("/analytics/comparison", GetAnalyticsComparison)
+}
+
+func (suite *CurrencyHandlerTestSuite) TearDownTest() {
+	services.SetCurrencyService(nil)
+	clearTestDB()
+}
+
+func (suite *CurrencyHandlerTestSuite) request(method, url string, body interface{}) (int, map[string]interface{}) {
+	var reader *bytes.Buffer
+	if body != nil {
+		jsonData, _ := json.Marshal(body)
+		reader = bytes.NewBuffer(jsonData)
+	} else {
+		reader = &bytes.Buffer{}
+	}
+	req := httptest.NewRequest(method, url, reader)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+func (suite *CurrencyHandlerTestSuite) TestGetExchangeRates() {
+	status, body := suite.request("GET", "/exchange-rates", nil)
+	suite.Require().Equal(200, status, body)
+
+	assert.Equal(suite.T(), "USD", body["base"])
+	rates := body["rates"].(map[string]interface{})
+	assert.Equal(suite.T(), 1.0, rates["USD"])
+	assert.Equal(suite.T(), 0.8, rates["EUR"])
+	assert.Equal(suite.T(), 16.0, rates["ZAR"])
+
+	// Rates are cached
+	suite.request("GET", "/exchange-rates", nil)
+	assert.Equal(suite.T(), 1, suite.provider.calls)
+}
+
+func (suite *CurrencyHandlerTestSuite) TestConvertCurrency() {
+	status, body := suite.request("GET", "/exchange-rates/convert?amount=160&from=zar", nil)
+	suite.Require().Equal(200, status, body)
+	assert.Equal(suite.T(), "USD", body["to"])
+	assert.Equal(suite.T(), 10.0, body["converted"])
+
+	status, body = suite.request("GET", "/exchange-rates/convert?amount=100&from=GBP&to=EUR", nil)
+	suite.Require().Equal(200, status, body)
+	assert.Equal(suite.T(), 125.0, body["converted"])
+
+	status, _ = suite.request("GET", "/exchange-rates/convert?amount=100&from=XYZ", nil)
+	assert.Equal(suite.T(), 400, status)
+	status, _ = suite.request("GET", "/exchange-rates/convert?amount=abc&from=ZAR", nil)
+	assert.Equal(suite.T(), 400, status)
+}
+
+func (suite *CurrencyHandlerTestSuite) TestConvertCurrencyWithoutRates() {
+	suite.provider.err = errors.New("provider is down")
+
+	status, _ := suite.request("GET", "/exchange-rates/convert?amount=100&from=ZAR", nil)
+	assert.Equal(suite.T(), 503, status)
+
+	// Amounts in the base currency don't need rates
+	status, body := suite.request("GET", "/exchange-rates/convert?amount=100&from=USD", nil)
+	suite.Require().Equal(200, status, body)
+	assert.Equal(suite.T(), 100.0, body["converted"])
+}
+
+func (suite *CurrencyHandlerTestSuite) TestQuoteStoresBaseAmount() {
+	var load models.Load
+	suite.Require().NoError(testDB.Where("booking_reference = ?", "TEST-LOAD-001").First(&load).Error)
+	testDB.Model(&load).Update("status", "QUOTE_REQUESTED")
+
+	status, body := suite.request("POST", "/quotes", map[string]interface{}{
+		"load_id":      load.ID,
+		"quote_amount": 3200,
+		"currency":     "zar",
+	})
+	suite.Require().Equal(201, status, body)
+	assert.Equal(suite.T(), "ZAR", body["currency"])
+	assert.Equal(suite.T(), 3200.0, body["quote_amount"])
+	assert.Equal(suite.T(), 200.0, body["base_amount"])
+	assert.Equal(suite.T(), "USD", body["base_currency"])
+	assert.Equal(suite.T(), 0.0625, body["exchange_rate"])
+
+	status, _ = suite.request("POST", "/quotes", map[string]interface{}{
+		"load_id":      load.ID,
+		"quote_amount": 100,
+		"currency":     "RANDS",
+	})
+	assert.Equal(suite.T(), 400, status)
+}
+
+func (suite *CurrencyHandlerTestSuite) TestRevenueInBaseCurrency() {
+	var load models.Load
+	suite.Require().NoError(testDB.Where("booking_reference = ?", "TEST-LOAD-001").First(&load).Error)
+	testDB.Where("load_id = ?", load.ID).Delete(&models.Transaction{})
+
+	processedAt := time.Now().Add(-time.Hour)
+	testDB.Create(&models.Transaction{LoadID: load.ID, Amount: 100, Currency: "USD", Status: "COMPLETED", ProcessedAt: &processedAt})
+	// Normalized when paid at an older rate, which is kept
+	testDB.Create(&models.Transaction{LoadID: load.ID, Amount: 1000, Currency: "ZAR", BaseAmount: 50, BaseCurrency: "USD", ExchangeRate: 0.05, Status: "COMPLETED", ProcessedAt: &processedAt})
+	// Converted at the current rate
+	testDB.Create(&models.Transaction{LoadID: load.ID, Amount: 80, Currency: "GBP", Status: "COMPLETED", ProcessedAt: &processedAt})
+
+	status, body := suite.request("POST", "/analytics/comparison", map[string]interface{}{})
+	suite.Require().Equal(200, status, body)
+	assert.Equal(suite.T(), "USD", body["currency"])
+	current := body["current"].(map[string]interface{})
+	assert.InDelta(suite.T(), 100+50+125, current["revenue"], 0.001)
+
+	status, body = suite.request("POST", "/analytics/comparison", map[string]interface{}{"currency": "eur"})
+	suite.Require().Equal(200, status, body)
+	assert.Equal(suite.T(), "EUR", body["currency"])
+	current = body["current"].(map[string]interface{})
+	assert.InDelta(suite.T(), 80+50+100, current["revenue"], 0.001)
+}
+
+func TestCurrencyHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(CurrencyHandlerTestSuite))
+}
@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 	"triplink/backend/database"
 	"triplink/backend/models"
+	"triplink/backend/services"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -37,14 +39,27 @@ func CreateCustomsDocument(c *fiber.Ctx) error {
 }
 
 // GetLoadCustomsDocuments @Summary Get customs documents for a load
-// @Description Get all customs documents for a specific load
+// @Description Get all customs documents for a load the current user can see
 // @Tags customs
 // @Produce json
 // @Param load_id path int true "Load ID"
 // @Success 200 {array} models.CustomsDocument
 // @Router /loads/{load_id}/customs-documents [get]
 func GetLoadCustomsDocuments(c *fiber.Ctx) error {
+	db, ok := tenantDB(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
 	loadID := c.Params("load_id")
+	if err := db.Select("id").First(&models.Load{}, loadID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Load not found",
+		})
+	}
+
 	var documents []models.CustomsDocument
 
 	result := database.DB.Where("load_id = ?", loadID).
@@ -132,6 +147,33 @@ func DeleteCustomsDocument(c *fiber.Ctx) error {
 	})
 }
 
+// CheckLoadCustomsCompliance @Summary Check customs compliance for a load
+// @Description Check the customs documents of a load the current user can see against the documents required for its origin/destination country pair, returning missing, expired and soon to expire documents
+// @Tags customs
+// @Produce json
+// @Param load_id path int true "Load ID"
+// @Success 200 {object} services.CustomsComplianceReport
+// @Router /loads/{load_id}/customs-compliance [get]
+func CheckLoadCustomsCompliance(c *fiber.Ctx) error {
+	loadID, err := strconv.ParseUint(c.Params("load_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid load ID",
+		})
+	}
+
+	// Other organizations' loads are not found
+	customsService := services.NewCustomsService(database.DB.WithContext(c.UserContext()))
+	report, err := customsService.CheckLoadCompliance(uint(loadID))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Load not found",
+		})
+	}
+
+	return c.JSON(report)
+}
+
 // GenerateCommercialInvoice @Summary Generate commercial invoice
 // @Description Generate a commercial invoice for a load
 // @Tags customs
@@ -265,18 +307,25 @@ func GeneratePackingList(c *fiber.Ctx) error {
 }
 
 // GetTripCustomsSummary @Summary Get customs documents summary for trip
-// @Description Get a summary of all customs documents for loads in a trip
+// @Description Get a summary of the customs documents of the loads in a trip that the current user can see
 // @Tags customs
 // @Produce json
 // @Param trip_id path int true "Trip ID"
 // @Success 200 {object} map[string]interface{}
 // @Router /trips/{trip_id}/customs-summary [get]
 func GetTripCustomsSummary(c *fiber.Ctx) error {
+	db, ok := tenantDB(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
 	tripID := c.Params("trip_id")
 
-	// Get all loads for the trip
+	// Get the trip's loads, limited to those the user can see
 	var loads []models.Load
-	if err := database.DB.Where("trip_id = ?", tripID).Find(&loads).Error; err != nil {
+	if err := db.Where("trip_id = ?", tripID).Find(&loads).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Could not fetch loads",
 		})
@@ -307,8 +356,8 @@ func GetTripCustomsSummary(c *fiber.Ctx) error {
 			existingDocs[doc.DocumentType] = true
 		}
 
-		// Check for missing required documents
-		requiredDocs := []string{"COMMERCIAL_INVOICE", "PACKING_LIST", "BOL"}
+		// Check for missing required documents for the load's route
+		requiredDocs := services.RequiredCustomsDocuments(&load)
 		for _, docType := range requiredDocs {
 			if !existingDocs[docType] {
 				missingDoc := map[string]interface{}{
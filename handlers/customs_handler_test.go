@@ -3,9 +3,12 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http/httptest"
 	"testing"
+	"time"
 	"triplink/backend/models"
+	"triplink/backend/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
@@ -18,6 +21,7 @@ type CustomsHandlerTestSuite struct {
 }
 
 func (suite *CustomsHandlerTestSuite) SetupSuite() {
+	registerTenantScope(suite.T())
 }
 
 func (suite *CustomsHandlerTestSuite) SetupTest() {
@@ -26,14 +30,15 @@ func (suite *CustomsHandlerTestSuite) SetupTest() {
 	suite.app = fiber.New()
 
 	suite.app.Post("/customs-documents", CreateCustomsDocument)
-	suite.app.Get("/loads/:load_id/customs-documents", GetLoadCustomsDocuments)
+	suite.app.Get("/loads/:load_id/customs-documents", asSeededUser(), GetLoadCustomsDocuments)
 	suite.app.Get("/customs-documents/:id", GetCustomsDocument)
 	suite.app.Put("/customs-documents/:id", UpdateCustomsDocument)
 	suite.app.Delete("/customs-documents/:id", DeleteCustomsDocument)
 	suite.app.Post("/loads/:load_id/commercial-invoice", GenerateCommercialInvoice)
 	suite.app.Post("/loads/:load_id/bill-of-lading", GenerateBillOfLading)
 	suite.app.Post("/loads/:load_id/packing-list", GeneratePackingList)
-	suite.app.Get("/trips/:trip_id/customs-summary", GetTripCustomsSummary)
+	suite.app.Get("/trips/:trip_id/customs-summary", asSeededUser(), GetTripCustomsSummary)
+	suite.app.Get("/loads/:load_id/customs-compliance", CheckLoadCustomsCompliance)
 }
 
 func (suite *CustomsHandlerTestSuite) TearDownTest() {
@@ -86,7 +91,9 @@ func (suite *CustomsHandlerTestSuite) TestCreateCustomsDocument() {
 
 func (suite *CustomsHandlerTestSuite) TestGetLoadCustomsDocuments() {
 	t := suite.T()
-	req := httptest.NewRequest("GET", "/loads/1/customs-documents", nil)
+	var load models.Load
+	testDB.Where("booking_reference = ?", "TEST-LOAD-001").First(&load)
+	req := httptest.NewRequest("GET", fmt.Sprintf("/loads/%d/customs-documents", load.ID), nil)
 	resp, err := suite.app.Test(req)
 
 	assert.NoError(t, err)
@@ -160,6 +167,42 @@ func (suite *CustomsHandlerTestSuite) TestGetTripCustomsSummary() {
 	assert.Equal(t, 200, resp.StatusCode)
 }
 
+func (suite *CustomsHandlerTestSuite) TestCheckLoadCustomsCompliance() {
+	t := suite.T()
+
+	var load models.Load
+	testDB.Where("booking_reference = ?", "TEST-LOAD-001").First(&load)
+	testDB.Model(&load).Updates(map[string]interface{}{
+		"pickup_country":   "Zimbabwe",
+		"delivery_country": "ZA",
+	})
+
+	testDB.Where("load_id = ?", load.ID).Delete(&models.CustomsDocument{})
+	expired := time.Now().Add(-24 * time.Hour)
+	testDB.Create(&models.CustomsDocument{LoadID: load.ID, DocumentType: "BOL", DocumentNumber: "BOL-1"})
+	testDB.Create(&models.CustomsDocument{LoadID: load.ID, DocumentType: "COMMERCIAL_INVOICE", DocumentNumber: "CI-1", ExpiryDate: &expired})
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/loads/%d/customs-compliance", load.ID), nil)
+	resp, err := suite.app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var report services.CustomsComplianceReport
+	json.NewDecoder(resp.Body).Decode(&report)
+	assert.True(t, report.International)
+	assert.False(t, report.Compliant)
+	assert.ElementsMatch(t, []string{"COMMERCIAL_INVOICE", "PACKING_LIST", "CUSTOMS_DECLARATION", "CERTIFICATE_OF_ORIGIN"}, report.MissingDocuments)
+	assert.Len(t, report.ExpiredDocuments, 1)
+
+	req = httptest.NewRequest("GET", "/loads/999999/customs-compliance", nil)
+	resp, _ = suite.app.Test(req)
+	assert.Equal(t, 404, resp.StatusCode)
+
+	req = httptest.NewRequest("GET", "/loads/invalid/customs-compliance", nil)
+	resp, _ = suite.app.Test(req)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
 func TestCustomsHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(CustomsHandlerTestSuite))
 }
\ No newline at end of file
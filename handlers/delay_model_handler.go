@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// delayModelService returns the shared delay model service, or responds
+// that delay prediction is unavailable
+func delayModelService(c *fiber.Ctx) (*services.DelayModelService, error) {
+	service := services.GetDelayModelService()
+	if service == nil {
+		return nil, c.Status(503).JSON(fiber.Map{
+			"error": "Delay prediction is not available",
+		})
+	}
+	return service, nil
+}
+
+// GetTripDelayPrediction @Summary Predict a trip's delay
+// @Description Predict how many minutes after its scheduled arrival a trip arrives, with the delay model trained on completed trips. The prediction is broken down into the trip's lane and carrier history, departure time, distance and weather, and is recorded to measure the model's accuracy once the trip completes.
+// @Tags trips
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Success 200 {object} services.DelayPredictionResult
+// @Router /api/trips/{trip_id}/delay-prediction [get]
+func GetTripDelayPrediction(c *fiber.Ctx) error {
+	db, ok := tenantDB(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var trip models.Trip
+	if err := db.Select("id").First(&trip, c.Params("trip_id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip not found",
+		})
+	}
+
+	service, err := delayModelService(c)
+	if service == nil {
+		return err
+	}
+
+	prediction, err := service.PredictTrip(trip.ID)
+	if errors.Is(err, services.ErrNoDelayModel) {
+		return c.Status(503).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not predict trip delay",
+		})
+	}
+
+	return c.JSON(prediction)
+}
+
+// TrainDelayModel @Summary Train the delay model
+// @Description Train a new version of the delay model on the most recently completed trips, rather than waiting for the scheduled retraining. Reports the new model's error on the trips held out from training next to that of predicting the mean delay.
+// @Tags admin
+// @Produce json
+// @Success 201 {object} models.DelayModel
+// @Router /admin/delay-model/train [post]
+func TrainDelayModel(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	service, err := delayModelService(c)
+	if service == nil {
+		return err
+	}
+
+	model, err := service.Train()
+	if errors.Is(err, services.ErrNotEnoughDelayHistory) {
+		return c.Status(409).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not train delay model",
+		})
+	}
+
+	return c.Status(201).JSON(model)
+}
+
+// GetDelayModelReport @Summary Get the delay model's accuracy
+// @Description Get the current delay model with its coefficients, and compare the delays predicted for completed trips with how late they arrived: mean absolute error, bias and error percentiles in minutes, overall, by model version and by route.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} services.DelayModelReport
+// @Router /admin/delay-model [get]
+func GetDelayModelReport(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	service, err := delayModelService(c)
+	if service == nil {
+		return err
+	}
+
+	report, err := service.GetReport()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not build delay model report",
+		})
+	}
+
+	return c.JSON(report)
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/middleware"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type DelayModelHandlerTestSuite struct {
+	suite.Suite
+	app      *fiber.App
+	reliable models.User
+	late     models.User
+	admin    models.User
+}
+
+func (suite *DelayModelHandlerTestSuite) SetupSuite() {
+	registerTenantScope(suite.T())
+}
+
+func (suite *DelayModelHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	cfg := config.GetDelayModelConfig()
+	cfg.MinTrainingTrips = 20
+	cfg.HoldoutFraction = 0.25
+	services.SetDelayModelService(services.NewDelayModelService(testDB, cfg))
+
+	users := []*models.User{&suite.reliable, &suite.late, &suite.admin}
+	roles := []string{"CARRIER", "CARRIER", "ADMIN"}
+	for i, user := range users {
+		*user = models.User{Email: fmt.Sprintf("delay%d@example.com", i), Phone: fmt.Sprintf("+1555000040%d", i), Password: "password", Role: roles[i]}
+		testDB.Create(user)
+	}
+
+	tenant := middleware.NewTenantMiddleware(testDB).Scope()
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Get("/trips/:trip_id/delay-prediction", tenant, GetTripDelayPrediction)
+	suite.app.Post("/ml/predict-delay", tenant, PredictDeliveryDelay)
+	suite.app.Post("/admin/delay-model/train", TrainDelayModel)
+	suite.app.Get("/admin/delay-model", GetDelayModelReport)
+}
+
+func (suite *DelayModelHandlerTestSuite) TearDownTest() {
+	services.SetDelayModelService(nil)
+	clearTestDB()
+}
+
+// seedHistory creates 120 completed daily trips. Trips to Bulawayo arrive 30
+// minutes late and the late carrier's another 45.
+func (suite *DelayModelHandlerTestSuite) seedHistory() {
+	start := time.Now().AddDate(0, 0, -130).Truncate(24 * time.Hour)
+	for i := 0; i < 120; i++ {
+		departure := start.AddDate(0, 0, i).Add(time.Duration(6+i/4%4*3) * time.Hour)
+		trip := models.Trip{UserID: suite.reliable.ID, OriginCity: "Harare", DestinationCity: "Mutare", Status: "COMPLETED", DepartureDate: departure}
+		delay := 0
+		if i%2 == 0 {
+			trip.DestinationCity = "Bulawayo"
+			delay += 30
+		}
+		if i/2%2 == 0 {
+			trip.UserID = suite.late.ID
+			delay += 45
+		}
+		scheduled := departure.Add(5 * time.Hour)
+		arrival := scheduled.Add(time.Duration(delay) * time.Minute)
+		trip.ScheduledArrival = &scheduled
+		trip.EstimatedArrival = arrival
+		trip.ActualArrival = &arrival
+		suite.Require().NoError(testDB.Create(&trip).Error)
+	}
+}
+
+// upcomingTrip creates a trip of a carrier under way to a destination
+func (suite *DelayModelHandlerTestSuite) upcomingTrip(carrierID uint, destination string) models.Trip {
+	departure := time.Now().Add(-time.Hour)
+	scheduled := departure.Add(5 * time.Hour)
+	trip := models.Trip{
+		UserID:           carrierID,
+		OriginCity:       "Harare",
+		DestinationCity:  destination,
+		Status:           "IN_TRANSIT",
+		DepartureDate:    departure,
+		EstimatedArrival: scheduled,
+		ScheduledArrival: &scheduled,
+	}
+	suite.Require().NoError(testDB.Create(&trip).Error)
+	return trip
+}
+
+func (suite *DelayModelHandlerTestSuite) request(method, url string, userID uint, body interface{}, result interface{}) int {
+	var payload bytes.Buffer
+	if body != nil {
+		suite.Require().NoError(json.NewEncoder(&payload).Encode(body))
+	}
+	req := httptest.NewRequest(method, url, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	if result != nil && resp.StatusCode < 300 {
+		suite.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	}
+	return resp.StatusCode
+}
+
+func (suite *DelayModelHandlerTestSuite) TestTrainPredictAndResolve() {
+	t := suite.T()
+	suite.seedHistory()
+
+	assert.Equal(t, 403, suite.request("POST", "/admin/delay-model/train", suite.late.ID, nil, nil))
+	var model models.DelayModel
+	suite.Require().Equal(201, suite.request("POST", "/admin/delay-model/train", suite.admin.ID, nil, &model))
+	assert.Equal(t, 1, model.Version)
+	assert.Equal(t, 120, model.TrainingTrips)
+	assert.Equal(t, 30, model.HoldoutTrips)
+	assert.Less(t, model.HoldoutMAEMinutes, model.BaselineMAEMinutes/2)
+
+	// The late carrier on the slow lane is expected about 75 minutes late
+	trip := suite.upcomingTrip(suite.late.ID, "Bulawayo")
+	var prediction services.DelayPredictionResult
+	url := fmt.Sprintf("/trips/%d/delay-prediction", trip.ID)
+	suite.Require().Equal(200, suite.request("GET", url, suite.late.ID, nil, &prediction))
+	assert.InDelta(t, 75, prediction.PredictedDelay, 15)
+	assert.Equal(t, services.DelayRiskHigh, prediction.RiskLevel)
+	assert.Equal(t, "delay-regression-v1", prediction.ModelUsed)
+	assert.Equal(t, trip.ID, prediction.TripID)
+	suite.Require().Len(prediction.FactorsAnalyzed, 6)
+	assert.Equal(t, "lane_history", prediction.FactorsAnalyzed[0].Factor)
+	assert.Greater(t, prediction.FactorsAnalyzed[0].Impact, 0.0)
+	assert.Contains(t, prediction.FactorsAnalyzed[1].Description, "60 earlier trips arrived 60 minutes late")
+
+	// Other carriers' trips aren't predicted for them
+	assert.Equal(t, 404, suite.request("GET", url, suite.reliable.ID, nil, nil))
+
+	// A repeated prediction within the sample interval isn't recorded again
+	suite.Require().Equal(200, suite.request("GET", url, suite.late.ID, nil, nil))
+	var predictions []models.DelayPrediction
+	testDB.Where("trip_id = ?", trip.ID).Find(&predictions)
+	suite.Require().Len(predictions, 1)
+	assert.InDelta(t, prediction.PredictedDelay, predictions[0].PredictedDelayMinutes, 0.01)
+
+	// The reliable carrier on the fast lane is expected on time, here for a lane
+	var lane services.DelayPredictionResult
+	suite.Require().Equal(200, suite.request("POST", "/ml/predict-delay", suite.reliable.ID, fiber.Map{
+		"origin_city": "Harare", "destination_city": "Mutare", "carrier_id": suite.reliable.ID,
+	}, &lane))
+	assert.InDelta(t, 0, lane.PredictedDelay, 15)
+	assert.Equal(t, services.DelayRiskLow, lane.RiskLevel)
+	assert.Equal(t, "Harare - Mutare", lane.RouteID)
+	assert.Equal(t, 400, suite.request("POST", "/ml/predict-delay", suite.reliable.ID, fiber.Map{"departure_time": "tomorrow"}, nil))
+	assert.Equal(t, 404, suite.request("POST", "/ml/predict-delay", suite.reliable.ID, fiber.Map{"trip_id": trip.ID}, nil))
+
+	// The trip arrives 80 minutes late
+	arrival := trip.ScheduledArrival.Add(80 * time.Minute)
+	testDB.Model(&trip).Update("actual_arrival", arrival)
+	suite.Require().NoError(services.NewTrackingService(testDB).UpdateTripStatus(trip.ID, "COMPLETED"))
+	testDB.First(&predictions[0], predictions[0].ID)
+	suite.Require().NotNil(predictions[0].ErrorMinutes)
+	assert.InDelta(t, 80-prediction.PredictedDelay, *predictions[0].ErrorMinutes, 0.01)
+
+	var report services.DelayModelReport
+	suite.Require().Equal(200, suite.request("GET", "/admin/delay-model", suite.admin.ID, nil, &report))
+	suite.Require().NotNil(report.Model)
+	assert.Equal(t, 1, report.Model.Version)
+	assert.Equal(t, 2, report.Lanes)
+	assert.Equal(t, 2, report.Carriers)
+	assert.Greater(t, report.Coefficients["lane_history"], 0.0)
+	assert.Equal(t, 1, report.Overall.Count)
+	suite.Require().Len(report.ByModel, 1)
+	assert.Equal(t, "v1", report.ByModel[0].Group)
+	suite.Require().Len(report.ByRoute, 1)
+	assert.Equal(t, "Harare - Bulawayo", report.ByRoute[0].Group)
+}
+
+func (suite *DelayModelHandlerTestSuite) TestScheduledRetraining() {
+	t := suite.T()
+	service := services.GetDelayModelService()
+
+	// Without enough history there is nothing to predict with
+	trip := suite.upcomingTrip(suite.late.ID, "Bulawayo")
+	suite.Require().NoError(service.RunScheduled())
+	assert.Equal(t, 409, suite.request("POST", "/admin/delay-model/train", suite.admin.ID, nil, nil))
+	assert.Equal(t, 503, suite.request("GET", fmt.Sprintf("/trips/%d/delay-prediction", trip.ID), suite.late.ID, nil, nil))
+	var report services.DelayModelReport
+	suite.Require().Equal(200, suite.request("GET", "/admin/delay-model", suite.admin.ID, nil, &report))
+	assert.Nil(t, report.Model)
+
+	// Then the model is trained and the trip under way predicted
+	suite.seedHistory()
+	suite.Require().NoError(service.RunScheduled())
+	var count int64
+	testDB.Model(&models.DelayModel{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+	testDB.Model(&models.DelayPrediction{}).Where("trip_id = ? AND model_version = ?", trip.ID, 1).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// Until the model is due for retraining, it is kept
+	suite.Require().NoError(service.RunScheduled())
+	testDB.Model(&models.DelayModel{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+	testDB.Model(&models.DelayModel{}).Where("version = ?", 1).Update("trained_at", time.Now().Add(-25*time.Hour))
+	suite.Require().NoError(service.RunScheduled())
+	testDB.Model(&models.DelayModel{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	// A new model's prediction is recorded even within the sample interval
+	testDB.Model(&models.DelayPrediction{}).Where("trip_id = ?", trip.ID).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestDelayModelHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(DelayModelHandlerTestSuite))
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"strconv"
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var documentService = services.NewDocumentService(database.DB, services.NewFileStorage(storageConfig), config.GetDocumentConfig())
+
+// documentError responds to a document service error
+func documentError(c *fiber.Ctx, err error) error {
+	status := 400
+	switch err.Error() {
+	case "document not found", "load not found":
+		status = 404
+	case services.ErrDocumentInfected.Error():
+		status = 422
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
+
+// documentRequest reads the current user and the document ID of a request
+func documentRequest(c *fiber.Ctx) (uint, uint, int, string) {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return 0, 0, 401, "Unauthorized"
+	}
+	documentID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, 0, 400, "Invalid document ID"
+	}
+	return uint(userID), uint(documentID), 0, ""
+}
+
+// CreateDocumentUpload @Summary Start a document upload
+// @Description Register a document and get the URL to upload its file to with the given method and headers. The URL is presigned when the storage supports it. Complete the upload afterwards to have the file checked and scanned.
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param document body services.DocumentUploadRequest true "Document details"
+// @Success 201 {object} services.DocumentURL
+// @Router /documents [post]
+func CreateDocumentUpload(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req services.DocumentUploadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	upload, err := documentService.CreateUpload(uint(userID), req)
+	if err != nil {
+		return documentError(c, err)
+	}
+
+	return c.Status(201).JSON(upload)
+}
+
+// CompleteDocumentUpload @Summary Complete a document upload
+// @Description Check a file uploaded to its presigned URL. Files with a disallowed type or size, or failing the virus scan, are removed.
+// @Tags documents
+// @Produce json
+// @Param id path int true "Document ID"
+// @Success 200 {object} models.Document
+// @Router /documents/{id}/complete [post]
+func CompleteDocumentUpload(c *fiber.Ctx) error {
+	userID, documentID, status, message := documentRequest(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	document, err := documentService.CompleteUpload(userID, documentID)
+	if err != nil {
+		return documentError(c, err)
+	}
+
+	return c.JSON(document)
+}
+
+// UploadDocumentContent @Summary Upload a document's file
+// @Description Upload the file of a document as the raw request body, when the storage doesn't support presigned URLs. The file is checked and scanned right away.
+// @Tags documents
+// @Accept application/octet-stream
+// @Produce json
+// @Param id path int true "Document ID"
+// @Success 200 {object} models.Document
+// @Router /documents/{id}/content [put]
+func UploadDocumentContent(c *fiber.Ctx) error {
+	userID, documentID, status, message := documentRequest(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	// The body is reused by fiber after the handler returns
+	data := append([]byte(nil), c.Body()...)
+	document, err := documentService.StoreContent(userID, documentID, data)
+	if err != nil {
+		return documentError(c, err)
+	}
+
+	return c.JSON(document)
+}
+
+// GetDocumentContent @Summary Download a document's file
+// @Description Download the file of an available document, when the storage doesn't support presigned URLs
+// @Tags documents
+// @Produce octet-stream
+// @Param id path int true "Document ID"
+// @Success 200 {file} file
+// @Router /documents/{id}/content [get]
+func GetDocumentContent(c *fiber.Ctx) error {
+	userID, documentID, status, message := documentRequest(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	document, data, err := documentService.ReadContent(userID, documentID)
+	if err != nil {
+		return documentError(c, err)
+	}
+
+	c.Set(fiber.HeaderContentType, document.ContentType)
+	c.Set(fiber.HeaderContentDisposition, "attachment; filename=\""+document.FileName+"\"")
+	return c.Send(data)
+}
+
+// GetDocumentDownloadURL @Summary Get a document download URL
+// @Description Get a time-limited URL to download an available document
+// @Tags documents
+// @Produce json
+// @Param id path int true "Document ID"
+// @Success 200 {object} services.DocumentURL
+// @Router /documents/{id}/download [get]
+func GetDocumentDownloadURL(c *fiber.Ctx) error {
+	userID, documentID, status, message := documentRequest(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	download, err := documentService.DownloadURL(userID, documentID)
+	if err != nil {
+		return documentError(c, err)
+	}
+
+	return c.JSON(download)
+}
+
+// GetDocument @Summary Get a document
+// @Description Get a document the user uploaded, or one attached to a load they ship or carry
+// @Tags documents
+// @Produce json
+// @Param id path int true "Document ID"
+// @Success 200 {object} models.Document
+// @Router /documents/{id} [get]
+func GetDocument(c *fiber.Ctx) error {
+	userID, documentID, status, message := documentRequest(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	document, err := documentService.GetDocument(userID, documentID)
+	if err != nil {
+		return documentError(c, err)
+	}
+
+	return c.JSON(document)
+}
+
+// GetDocuments @Summary List documents
+// @Description List the user's documents, or the documents attached to a load they ship or carry, newest first
+// @Tags documents
+// @Produce json
+// @Param load_id query int false "Load ID"
+// @Param document_type query string false "Document type"
+// @Success 200 {array} models.Document
+// @Router /documents [get]
+func GetDocuments(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	filter := services.DocumentFilter{DocumentType: c.Query("document_type")}
+	if value := c.Query("load_id"); value != "" {
+		loadID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid load ID",
+			})
+		}
+		id := uint(loadID)
+		filter.LoadID = &id
+	}
+
+	documents, err := documentService.ListDocuments(uint(userID), filter)
+	if err != nil {
+		return documentError(c, err)
+	}
+
+	return c.JSON(documents)
+}
+
+// DeleteDocument @Summary Delete a document
+// @Description Delete a document the user uploaded and its file
+// @Tags documents
+// @Param id path int true "Document ID"
+// @Success 204
+// @Router /documents/{id} [delete]
+func DeleteDocument(c *fiber.Ctx) error {
+	userID, documentID, status, message := documentRequest(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	if err := documentService.DeleteDocument(userID, documentID); err != nil {
+		return documentError(c, err)
+	}
+
+	return c.SendStatus(204)
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeScanner flags files containing the EICAR test string as infected
+type fakeScanner struct{}
+
+func (fakeScanner) Scan(data []byte) (*services.ScanResult, error) {
+	if bytes.Contains(data, []byte("EICAR")) {
+		return &services.ScanResult{Signature: "Eicar-Test-Signature"}, nil
+	}
+	return &services.ScanResult{Clean: true}, nil
+}
+
+type DocumentHandlerTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	shipper models.User
+	load    models.Load
+}
+
+func (suite *DocumentHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+
+	documentService = services.NewDocumentService(testDB, services.NewLocalFileStorage(suite.T().TempDir(), "/uploads"), &config.DocumentConfig{
+		AllowedContentTypes: []string{"application/pdf", "image/png"},
+		MaxSize:             1024,
+		URLExpiry:           15 * time.Minute,
+	})
+	documentService.SetScanner(fakeScanner{})
+
+	suite.shipper = models.User{}
+	testDB.Where("email = ?", "test@example.com").First(&suite.shipper)
+	suite.load = models.Load{}
+	testDB.Where("booking_reference = ?", "TEST-LOAD-001").First(&suite.load)
+
+	suite.app = fiber.New()
+
+	suite.app.Use(asHeaderUser())
+	suite.app.Post("/documents", CreateDocumentUpload)
+	suite.app.Get("/documents", GetDocuments)
+	suite.app.Get("/documents/:id", GetDocument)
+	suite.app.Delete("/documents/:id", DeleteDocument)
+	suite.app.Post("/documents/:id/complete", CompleteDocumentUpload)
+	suite.app.Put("/documents/:id/content", UploadDocumentContent)
+	suite.app.Get("/documents/:id/content", GetDocumentContent)
+	suite.app.Get("/documents/:id/download", GetDocumentDownloadURL)
+}
+
+func (suite *DocumentHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *DocumentHandlerTestSuite) request(method, url string, userID uint, contentType string, body []byte) (int, []byte) {
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var respBody bytes.Buffer
+	respBody.ReadFrom(resp.Body)
+	return resp.StatusCode, respBody.Bytes()
+}
+
+func (suite *DocumentHandlerTestSuite) createUpload(userID uint, req services.DocumentUploadRequest) (int, services.DocumentURL) {
+	jsonData, _ := json.Marshal(req)
+	status, body := suite.request("POST", "/documents", userID, "application/json", jsonData)
+
+	var upload services.DocumentURL
+	if status == 201 {
+		suite.Require().NoError(json.Unmarshal(body, &upload))
+	}
+	return status, upload
+}
+
+func (suite *DocumentHandlerTestSuite) TestUploadLoadDocument() {
+	t := suite.T()
+
+	status, upload := suite.createUpload(suite.shipper.ID, services.DocumentUploadRequest{
+		DocumentType: "proof_of_delivery",
+		FileName:     "../../pod.png",
+		ContentType:  "image/png",
+		Size:         int64(len(testPNG)),
+		LoadID:       &suite.load.ID,
+	})
+	assert.Equal(t, 201, status)
+	assert.Equal(t, "pod.png", upload.Document.FileName)
+	assert.Equal(t, services.DocumentPendingUpload, upload.Document.Status)
+	// Local storage can't presign, so the file goes through the API
+	documentURL := "/documents/" + strconv.Itoa(int(upload.Document.ID))
+	assert.Equal(t, "/api"+documentURL+"/content", upload.URL)
+	assert.Equal(t, "PUT", upload.Method)
+
+	// Downloads wait for the upload
+	status, _ = suite.request("GET", documentURL+"/download", suite.shipper.ID, "", nil)
+	assert.Equal(t, 400, status)
+
+	status, body := suite.request("PUT", documentURL+"/content", suite.shipper.ID, "image/png", testPNG)
+	assert.Equal(t, 200, status)
+	var document models.Document
+	assert.NoError(t, json.Unmarshal(body, &document))
+	assert.Equal(t, services.DocumentAvailable, document.Status)
+	assert.Equal(t, "CLEAN", document.ScanResult)
+	assert.NotNil(t, document.UploadedAt)
+
+	// The upload can't be replaced
+	status, _ = suite.request("PUT", documentURL+"/content", suite.shipper.ID, "image/png", testPNG)
+	assert.Equal(t, 400, status)
+
+	status, body = suite.request("GET", documentURL+"/content", suite.shipper.ID, "", nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, testPNG, body)
+
+	status, body = suite.request("GET", "/documents?load_id="+strconv.Itoa(int(suite.load.ID)), suite.shipper.ID, "", nil)
+	assert.Equal(t, 200, status)
+	var documents []models.Document
+	assert.NoError(t, json.Unmarshal(body, &documents))
+	assert.Len(t, documents, 1)
+
+	// Users outside the load can't see its documents
+	outsider := models.User{Email: "outsider@example.com", Phone: "+1555000222", Password: "password", Role: "CARRIER"}
+	testDB.Create(&outsider)
+	status, _ = suite.request("GET", documentURL, outsider.ID, "", nil)
+	assert.Equal(t, 404, status)
+	status, _ = suite.request("GET", "/documents?load_id="+strconv.Itoa(int(suite.load.ID)), outsider.ID, "", nil)
+	assert.Equal(t, 404, status)
+	status, _ = suite.createUpload(outsider.ID, services.DocumentUploadRequest{
+		DocumentType: "OTHER", FileName: "x.pdf", ContentType: "application/pdf", Size: 10, LoadID: &suite.load.ID,
+	})
+	assert.Equal(t, 404, status)
+
+	status, _ = suite.request("DELETE", documentURL, suite.shipper.ID, "", nil)
+	assert.Equal(t, 204, status)
+	status, _ = suite.request("GET", documentURL, suite.shipper.ID, "", nil)
+	assert.Equal(t, 404, status)
+}
+
+func (suite *DocumentHandlerTestSuite) TestUploadValidation() {
+	t := suite.T()
+
+	tests := []struct {
+		name string
+		req  services.DocumentUploadRequest
+	}{
+		{"Unknown type", services.DocumentUploadRequest{DocumentType: "SELFIE", FileName: "a.png", ContentType: "image/png", Size: 10}},
+		{"Missing file name", services.DocumentUploadRequest{DocumentType: "OTHER", ContentType: "image/png", Size: 10}},
+		{"Too large", services.DocumentUploadRequest{DocumentType: "OTHER", FileName: "a.png", ContentType: "image/png", Size: 4096}},
+		{"Disallowed content type", services.DocumentUploadRequest{DocumentType: "OTHER", FileName: "a.exe", ContentType: "application/x-msdownload", Size: 10}},
+	}
+	for _, tt := range tests {
+		status, _ := suite.createUpload(suite.shipper.ID, tt.req)
+		assert.Equal(t, 400, status, tt.name)
+	}
+
+	// The detected content type must be allowed, whatever the client declared
+	status, upload := suite.createUpload(suite.shipper.ID, services.DocumentUploadRequest{
+		DocumentType: "OTHER", FileName: "fake.png", ContentType: "image/png", Size: 10,
+	})
+	assert.Equal(t, 201, status)
+	status, _ = suite.request("PUT", "/documents/"+strconv.Itoa(int(upload.Document.ID))+"/content", suite.shipper.ID, "image/png", []byte("plain text"))
+	assert.Equal(t, 400, status)
+}
+
+func (suite *DocumentHandlerTestSuite) TestInfectedUpload() {
+	t := suite.T()
+
+	status, upload := suite.createUpload(suite.shipper.ID, services.DocumentUploadRequest{
+		DocumentType: "INSURANCE", FileName: "policy.pdf", ContentType: "application/pdf", Size: 64,
+	})
+	assert.Equal(t, 201, status)
+
+	infected := []byte("%PDF-1.4 EICAR test file")
+	status, body := suite.request("PUT", "/documents/"+strconv.Itoa(int(upload.Document.ID))+"/content", suite.shipper.ID, "application/pdf", infected)
+	assert.Equal(t, 422, status)
+	assert.Contains(t, string(body), "virus scan")
+
+	var document models.Document
+	testDB.First(&document, upload.Document.ID)
+	assert.Equal(t, services.DocumentInfected, document.Status)
+	assert.Equal(t, "Eicar-Test-Signature", document.ScanResult)
+
+	status, _ = suite.request("GET", "/documents/"+strconv.Itoa(int(document.ID))+"/content", suite.shipper.ID, "", nil)
+	assert.Equal(t, 400, status)
+}
+
+func (suite *DocumentHandlerTestSuite) TestLicenseLinkedToUser() {
+	t := suite.T()
+
+	status, upload := suite.createUpload(suite.shipper.ID, services.DocumentUploadRequest{
+		DocumentType: "BUSINESS_LICENSE", FileName: "license.png", ContentType: "image/png", Size: int64(len(testPNG)),
+	})
+	assert.Equal(t, 201, status)
+	status, _ = suite.request("PUT", "/documents/"+strconv.Itoa(int(upload.Document.ID))+"/content", suite.shipper.ID, "image/png", testPNG)
+	assert.Equal(t, 200, status)
+
+	var user models.User
+	testDB.First(&user, suite.shipper.ID)
+	assert.Equal(t, "/api/documents/"+strconv.Itoa(int(upload.Document.ID)), user.BusinessLicense)
+}
+
+func TestDocumentHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(DocumentHandlerTestSuite))
+}
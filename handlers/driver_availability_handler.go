@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+	"triplink/backend/database"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var driverAvailabilityService = services.NewDriverAvailabilityService(database.DB)
+
+// defaultCalendarDays is how far ahead calendars go when no to date is given
+const defaultCalendarDays = 14
+
+// calendarPeriod returns the from and to dates of a calendar request, from
+// the start of today for two weeks by default, or the message to fail the
+// request with. A date-only to includes the whole day.
+func calendarPeriod(c *fiber.Ctx) (time.Time, time.Time, string) {
+	from := time.Now().UTC().Truncate(24 * time.Hour)
+	if value := c.Query("from"); value != "" {
+		parsed, err := parseSearchDate(value)
+		if err != nil {
+			return time.Time{}, time.Time{}, "Invalid from date"
+		}
+		from = parsed
+	}
+
+	to := from.AddDate(0, 0, defaultCalendarDays)
+	if value := c.Query("to"); value != "" {
+		parsed, err := parseSearchDate(value)
+		if err != nil {
+			return time.Time{}, time.Time{}, "Invalid to date"
+		}
+		to = parsed
+		if len(value) == len("2006-01-02") {
+			to = to.AddDate(0, 0, 1)
+		}
+	}
+	if !to.After(from) {
+		return time.Time{}, time.Time{}, "to must be after from"
+	}
+	return from, to, ""
+}
+
+// GetMyAvailability @Summary Get my availability calendar
+// @Description Get the current driver's shifts, time off and trip assignments between from and to, two weeks from today by default
+// @Tags drivers
+// @Produce json
+// @Param from query string false "Start of the calendar, RFC3339 or YYYY-MM-DD"
+// @Param to query string false "End of the calendar, RFC3339 or YYYY-MM-DD (a date includes the whole day)"
+// @Success 200 {object} services.DriverCalendar
+// @Router /users/me/availability [get]
+func GetMyAvailability(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	return driverCalendar(c, uint(userID))
+}
+
+// GetDriverAvailability @Summary Get a driver's availability calendar
+// @Description Get a driver's shifts, time off and trip assignments between from and to, two weeks from today by default. Available to the driver and to carriers, who assign drivers to their trips.
+// @Tags drivers
+// @Produce json
+// @Param driver_id path int true "Driver ID"
+// @Param from query string false "Start of the calendar, RFC3339 or YYYY-MM-DD"
+// @Param to query string false "End of the calendar, RFC3339 or YYYY-MM-DD (a date includes the whole day)"
+// @Success 200 {object} services.DriverCalendar
+// @Router /drivers/{driver_id}/availability [get]
+func GetDriverAvailability(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	driverID, err := strconv.ParseUint(c.Params("driver_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid driver ID",
+		})
+	}
+
+	if uint(driverID) != uint(userID) {
+		var user models.User
+		if err := database.DB.First(&user, uint(userID)).Error; err != nil || user.Role != "CARRIER" {
+			return c.Status(403).JSON(fiber.Map{
+				"error": "Only the driver and carriers can see a driver's calendar",
+			})
+		}
+	}
+
+	return driverCalendar(c, uint(driverID))
+}
+
+// driverCalendar responds with a driver's calendar for the requested period
+func driverCalendar(c *fiber.Ctx, driverID uint) error {
+	from, to, message := calendarPeriod(c)
+	if message != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	calendar, err := driverAvailabilityService.GetCalendar(driverID, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch availability",
+		})
+	}
+
+	return c.JSON(calendar)
+}
+
+// CreateMyAvailability @Summary Declare a shift or time off
+// @Description Add a shift or planned time off to the current driver's calendar. Drivers who declare shifts can only be assigned trips starting in one, and time off blocks assignments altogether. Shifts can't overlap each other and neither can time off.
+// @Tags drivers
+// @Accept json
+// @Produce json
+// @Param availability body services.DriverAvailabilityRequest true "Shift or time off"
+// @Success 201 {object} models.DriverAvailability
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /users/me/availability [post]
+func CreateMyAvailability(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req services.DriverAvailabilityRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	availability, err := driverAvailabilityService.CreateAvailability(uint(userID), req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(availability)
+}
+
+// UpdateMyAvailability @Summary Update a shift or time off
+// @Description Change a shift or time off in the current driver's calendar
+// @Tags drivers
+// @Accept json
+// @Produce json
+// @Param id path int true "Availability ID"
+// @Param availability body services.DriverAvailabilityRequest true "Shift or time off"
+// @Success 200 {object} models.DriverAvailability
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /users/me/availability/{id} [put]
+func UpdateMyAvailability(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	availabilityID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid availability ID",
+		})
+	}
+
+	var req services.DriverAvailabilityRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	availability, err := driverAvailabilityService.UpdateAvailability(uint(userID), uint(availabilityID), req)
+	if err != nil {
+		status := 400
+		if err == services.ErrDriverAvailabilityNotFound {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(availability)
+}
+
+// DeleteMyAvailability @Summary Remove a shift or time off
+// @Description Remove a shift or time off from the current driver's calendar
+// @Tags drivers
+// @Param id path int true "Availability ID"
+// @Success 204
+// @Router /users/me/availability/{id} [delete]
+func DeleteMyAvailability(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	availabilityID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid availability ID",
+		})
+	}
+
+	if err := driverAvailabilityService.DeleteAvailability(uint(userID), uint(availabilityID)); err != nil {
+		status := 500
+		if err == services.ErrDriverAvailabilityNotFound {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.SendStatus(204)
+}
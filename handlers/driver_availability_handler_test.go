@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type DriverAvailabilityHandlerTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	carrier models.User
+	driver  models.User
+	shipper models.User
+	vehicle models.Vehicle
+	start   time.Time
+}
+
+func (suite *DriverAvailabilityHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	driverAvailabilityService = services.NewDriverAvailabilityService(testDB)
+	vehicleBookingService = services.NewVehicleBookingService(testDB)
+	tripAssignmentService = services.NewTripAssignmentService(testDB)
+	organizationService = services.NewOrganizationService(testDB)
+	savedLocationService = services.NewSavedLocationService(testDB, nil)
+	vehicleComplianceService = services.NewVehicleComplianceService(testDB, nil)
+	addressGeocoder = services.NewGeocodingCache(testDB, nil, config.GetGeocodingConfig())
+
+	suite.carrier = models.User{Email: "calendar-carrier@example.com", Phone: "+15550000911", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.carrier)
+	suite.driver = models.User{Email: "calendar-driver@example.com", Phone: "+15550000912", Password: "password", Role: "DRIVER"}
+	testDB.Create(&suite.driver)
+	suite.shipper = models.User{Email: "calendar-shipper@example.com", Phone: "+15550000913", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&suite.shipper)
+	suite.vehicle = models.Vehicle{UserID: suite.carrier.ID, Make: "Scania", Model: "R450", LicensePlate: "CAL-001", VIN: "VINCAL001", IsActive: true}
+	testDB.Create(&suite.vehicle)
+
+	// Tomorrow at 06:00 UTC
+	suite.start = time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1).Add(6 * time.Hour)
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Get("/users/me/availability", GetMyAvailability)
+	suite.app.Post("/users/me/availability", CreateMyAvailability)
+	suite.app.Put("/users/me/availability/:id", UpdateMyAvailability)
+	suite.app.Delete("/users/me/availability/:id", DeleteMyAvailability)
+	suite.app.Get("/drivers/:driver_id/availability", GetDriverAvailability)
+	suite.app.Post("/trips", CreateTrip)
+	suite.app.Post("/trips/:trip_id/assignments", AssignTripDriver)
+}
+
+func (suite *DriverAvailabilityHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *DriverAvailabilityHandlerTestSuite) request(method, path string, userID uint, body interface{}) (int, map[string]interface{}) {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+// declare adds a shift or time off to the driver's calendar
+func (suite *DriverAvailabilityHandlerTestSuite) declare(kind string, startsAt, endsAt time.Time) uint {
+	status, body := suite.request("POST", "/users/me/availability", suite.driver.ID, services.DriverAvailabilityRequest{Kind: kind, StartsAt: startsAt, EndsAt: endsAt})
+	suite.Require().Equal(201, status, body)
+	return uint(body["id"].(float64))
+}
+
+// createTrip creates a trip of the carrier from the test start
+func (suite *DriverAvailabilityHandlerTestSuite) createTrip(departure time.Time, hours int) models.Trip {
+	trip := models.Trip{UserID: suite.carrier.ID, Status: "PLANNED", DepartureDate: departure, EstimatedArrival: departure.Add(time.Duration(hours) * time.Hour)}
+	testDB.Create(&trip)
+	return trip
+}
+
+func (suite *DriverAvailabilityHandlerTestSuite) assign(trip models.Trip, startsAt time.Time) (int, map[string]interface{}) {
+	return suite.request("POST", fmt.Sprintf("/trips/%d/assignments", trip.ID), suite.carrier.ID, fiber.Map{"driver_id": suite.driver.ID, "starts_at": startsAt})
+}
+
+func (suite *DriverAvailabilityHandlerTestSuite) TestManageCalendar() {
+	t := suite.T()
+
+	shiftID := suite.declare("shift", suite.start, suite.start.Add(10*time.Hour))
+	suite.declare("TIME_OFF", suite.start.AddDate(0, 0, 2), suite.start.AddDate(0, 0, 4))
+
+	status, body := suite.request("POST", "/users/me/availability", suite.driver.ID, services.DriverAvailabilityRequest{Kind: "HOLIDAY", StartsAt: suite.start, EndsAt: suite.start.Add(time.Hour)})
+	assert.Equal(t, 400, status)
+	assert.Contains(t, body["error"], "use SHIFT or TIME_OFF")
+	status, body = suite.request("POST", "/users/me/availability", suite.driver.ID, services.DriverAvailabilityRequest{Kind: "SHIFT", StartsAt: suite.start.Add(8 * time.Hour), EndsAt: suite.start.Add(12 * time.Hour)})
+	assert.Equal(t, 400, status)
+	assert.Equal(t, "the shift overlaps another", body["error"])
+	status, _ = suite.request("POST", "/users/me/availability", suite.shipper.ID, services.DriverAvailabilityRequest{Kind: "SHIFT", StartsAt: suite.start, EndsAt: suite.start.Add(time.Hour)})
+	assert.Equal(t, 400, status)
+
+	// The calendar shows what overlaps the period, a date including the whole day
+	day := suite.start.Format("2006-01-02")
+	status, body = suite.request("GET", "/users/me/availability?from="+day+"&to="+day, suite.driver.ID, nil)
+	assert.Equal(t, 200, status)
+	if availability := body["availability"].([]interface{}); assert.Len(t, availability, 1) {
+		assert.Equal(t, "SHIFT", availability[0].(map[string]interface{})["kind"])
+	}
+	status, body = suite.request("GET", "/users/me/availability", suite.driver.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.Len(t, body["availability"], 2)
+	status, _ = suite.request("GET", "/users/me/availability?from=2030-01-02&to=2030-01-01", suite.driver.ID, nil)
+	assert.Equal(t, 400, status)
+
+	// Carriers see drivers' calendars, shippers don't
+	status, body = suite.request("GET", fmt.Sprintf("/drivers/%d/availability", suite.driver.ID), suite.carrier.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(suite.driver.ID), body["driver_id"])
+	status, _ = suite.request("GET", fmt.Sprintf("/drivers/%d/availability", suite.driver.ID), suite.shipper.ID, nil)
+	assert.Equal(t, 403, status)
+
+	path := fmt.Sprintf("/users/me/availability/%d", shiftID)
+	status, body = suite.request("PUT", path, suite.driver.ID, services.DriverAvailabilityRequest{Kind: "SHIFT", StartsAt: suite.start, EndsAt: suite.start.Add(12 * time.Hour), Notes: "Long day"})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "Long day", body["notes"])
+	status, _ = suite.request("PUT", path, suite.carrier.ID, services.DriverAvailabilityRequest{Kind: "SHIFT", StartsAt: suite.start, EndsAt: suite.start.Add(time.Hour)})
+	assert.Equal(t, 404, status)
+
+	status, _ = suite.request("DELETE", path, suite.driver.ID, nil)
+	assert.Equal(t, 204, status)
+	status, _ = suite.request("DELETE", path, suite.driver.ID, nil)
+	assert.Equal(t, 404, status)
+}
+
+func (suite *DriverAvailabilityHandlerTestSuite) TestAssignmentsRespectAvailability() {
+	t := suite.T()
+	trip := suite.createTrip(suite.start, 8)
+
+	// Time off during the trip
+	timeOffID := suite.declare("TIME_OFF", suite.start.Add(4*time.Hour), suite.start.Add(30*time.Hour))
+	status, body := suite.assign(trip, suite.start)
+	assert.Equal(t, 409, status)
+	assert.Equal(t, "DRIVER_UNAVAILABLE", body["code"])
+	assert.Equal(t, float64(timeOffID), body["details"].(map[string]interface{})["availability_id"])
+	suite.request("DELETE", fmt.Sprintf("/users/me/availability/%d", timeOffID), suite.driver.ID, nil)
+
+	// Drivers with shifts must be on shift when the trip starts
+	suite.declare("SHIFT", suite.start.Add(2*time.Hour), suite.start.Add(12*time.Hour))
+	status, body = suite.assign(trip, suite.start)
+	assert.Equal(t, 409, status)
+	assert.Contains(t, body["error"], "The driver has no shift at")
+	status, _ = suite.assign(trip, suite.start.Add(2*time.Hour))
+	assert.Equal(t, 201, status)
+
+	// The driver can't be on two trips at once, until the first is over
+	other := suite.createTrip(suite.start.Add(4*time.Hour), 2)
+	status, body = suite.assign(other, suite.start.Add(4*time.Hour))
+	assert.Equal(t, 409, status)
+	assert.Equal(t, "DRIVER_DOUBLE_BOOKED", body["code"])
+	assert.Equal(t, float64(trip.ID), body["details"].(map[string]interface{})["trip_id"])
+	testDB.Model(&trip).Update("status", "CANCELLED")
+	status, _ = suite.assign(other, suite.start.Add(4*time.Hour))
+	assert.Equal(t, 201, status)
+}
+
+func (suite *DriverAvailabilityHandlerTestSuite) TestCreateTripChecksBookings() {
+	t := suite.T()
+	trip := func(departure time.Time, driverID uint) fiber.Map {
+		return fiber.Map{
+			"vehicle_id": suite.vehicle.ID, "driver_id": driverID, "origin_address": "Harare", "destination_address": "Mutare",
+			"departure_date": departure, "estimated_arrival": departure.Add(6 * time.Hour),
+		}
+	}
+
+	status, body := suite.request("POST", "/trips", suite.carrier.ID, trip(suite.start, suite.driver.ID))
+	suite.Require().Equal(200, status, body)
+	tripID := uint(body["id"].(float64))
+	assert.True(t, tripAssignmentService.IsAssigned(tripID, suite.driver.ID, suite.start.Add(time.Hour)))
+
+	// The vehicle is on the first trip until it arrives
+	status, body = suite.request("POST", "/trips", suite.carrier.ID, trip(suite.start.Add(3*time.Hour), 0))
+	assert.Equal(t, 409, status)
+	assert.Equal(t, "VEHICLE_DOUBLE_BOOKED", body["code"])
+	assert.Equal(t, float64(tripID), body["details"].(map[string]interface{})["trip_id"])
+
+	// And so is the driver, in another vehicle
+	other := models.Vehicle{UserID: suite.carrier.ID, Make: "MAN", Model: "TGX", LicensePlate: "CAL-002", VIN: "VINCAL002", IsActive: true}
+	testDB.Create(&other)
+	request := trip(suite.start.Add(3*time.Hour), suite.driver.ID)
+	request["vehicle_id"] = other.ID
+	status, body = suite.request("POST", "/trips", suite.carrier.ID, request)
+	assert.Equal(t, 409, status)
+	assert.Equal(t, "DRIVER_DOUBLE_BOOKED", body["code"])
+
+	status, _ = suite.request("POST", "/trips", suite.carrier.ID, trip(suite.start.Add(6*time.Hour), suite.driver.ID))
+	assert.Equal(t, 200, status)
+	var trips int64
+	testDB.Model(&models.Trip{}).Where("user_id = ?", suite.carrier.ID).Count(&trips)
+	assert.Equal(t, int64(2), trips)
+}
+
+func (suite *DriverAvailabilityHandlerTestSuite) TestMatchingSkipsTripsWithDriversOff() {
+	t := suite.T()
+	trip := models.Trip{
+		UserID: suite.carrier.ID, Status: "PLANNED", IsPublic: true, TotalCapacityWeight: 10000, TotalCapacityVolume: 40,
+		OriginLat: -17.8292, OriginLng: 31.0522, DestinationLat: -18.9707, DestinationLng: 32.6709,
+		DepartureDate: suite.start, EstimatedArrival: suite.start.Add(6 * time.Hour),
+	}
+	testDB.Create(&trip)
+	load := models.Load{
+		ShipperID: suite.shipper.ID, Status: "QUOTE_REQUESTED", Weight: 500, Volume: 2,
+		PickupLat: -17.83, PickupLng: 31.05, DeliveryLat: -18.97, DeliveryLng: 32.67,
+		RequestedPickupDate: suite.start, RequestedDeliveryDate: suite.start.Add(6 * time.Hour),
+	}
+	testDB.Create(&load)
+	_, err := tripAssignmentService.AssignDriver(trip.ID, suite.carrier.ID, services.TripAssignmentRequest{DriverID: suite.driver.ID, StartsAt: &suite.start})
+	suite.Require().NoError(err)
+
+	matching := services.NewMatchingService(testDB)
+	candidates, err := matching.FindTripsForLoad(load.ID, services.DefaultMatchOptions())
+	suite.Require().NoError(err)
+	assert.Len(t, candidates, 1)
+
+	// Time off declared after the assignment takes the trip off the market
+	suite.declare("TIME_OFF", suite.start.Add(2*time.Hour), suite.start.AddDate(0, 0, 3))
+	candidates, err = matching.FindTripsForLoad(load.ID, services.DefaultMatchOptions())
+	suite.Require().NoError(err)
+	assert.Empty(t, candidates)
+}
+
+func TestDriverAvailabilityHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(DriverAvailabilityHandlerTestSuite))
+}
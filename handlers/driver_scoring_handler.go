@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"strconv"
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var driverScoringService = services.NewDriverScoringService(database.DB, config.GetDriverScoringConfig())
+
+// GetDriverScorecard @Summary Get a driver's safety scorecard
+// @Description Score how safely a driver drove from the positions tracked on their trips: harsh acceleration and braking, speeding against posted limits (or the alert speed limit where none was reported), night driving and idling. Drivers who drove too little in the period aren't scored. Visible to the driver, the owners and dispatchers of their organizations and the carriers they drove for.
+// @Tags drivers
+// @Produce json
+// @Param driver_id path int true "Driver ID"
+// @Param from query string false "Start of the period (RFC3339 or YYYY-MM-DD, default 30 days before to)"
+// @Param to query string false "End of the period (RFC3339 or YYYY-MM-DD, default now)"
+// @Success 200 {object} services.DriverScorecard
+// @Router /drivers/{driver_id}/scorecard [get]
+func GetDriverScorecard(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	driverID, err := strconv.ParseUint(c.Params("driver_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid driver ID",
+		})
+	}
+
+	from, to, message := scorecardPeriod(c)
+	if message != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+	start, end := driverScoringService.Period(from, to)
+	if !start.Before(end) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "from must be before to",
+		})
+	}
+
+	if !driverScoringService.CanViewScorecard(uint(userID), uint(driverID)) {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "You cannot view this driver's scorecard",
+		})
+	}
+
+	scorecard, err := driverScoringService.Scorecard(uint(driverID), start, end)
+	if err == gorm.ErrRecordNotFound {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Driver not found",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not score driver",
+		})
+	}
+
+	return c.JSON(scorecard)
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// kmPerDegree is the length of a degree of longitude at the equator
+const kmPerDegree = 111.195
+
+type DriverScoringHandlerTestSuite struct {
+	suite.Suite
+	app        *fiber.App
+	carrier    models.User
+	dispatcher models.User
+	driver     models.User
+	stranger   models.User
+	trip       models.Trip
+	start      time.Time
+
+	longitude float64
+	lastAt    time.Time
+	lastSpeed float64
+}
+
+func (suite *DriverScoringHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	suite.longitude, suite.lastAt, suite.lastSpeed = 0, time.Time{}, 0
+	driverScoringService = services.NewDriverScoringService(testDB, config.GetDriverScoringConfig())
+	analyticsService = services.NewAnalyticsService(testDB)
+
+	users := []*models.User{&suite.carrier, &suite.dispatcher, &suite.driver, &suite.stranger}
+	roles := []string{"CARRIER", "CARRIER", "DRIVER", "CARRIER"}
+	for i, user := range users {
+		*user = models.User{Email: fmt.Sprintf("scoring%d@example.com", i), Phone: fmt.Sprintf("+1555000060%d", i), Password: "password", Role: roles[i]}
+		testDB.Create(user)
+	}
+	organization := models.Organization{Name: "Scoring Haulage", Type: "CARRIER", OwnerID: suite.carrier.ID}
+	testDB.Create(&organization)
+	testDB.Create(&models.OrganizationMembership{OrganizationID: organization.ID, UserID: suite.dispatcher.ID, Role: services.OrganizationDispatcher})
+	testDB.Create(&models.OrganizationMembership{OrganizationID: organization.ID, UserID: suite.driver.ID, Role: services.OrganizationDriver})
+
+	suite.trip = models.Trip{UserID: suite.carrier.ID, Status: "IN_TRANSIT", TrackingEnabled: true}
+	testDB.Create(&suite.trip)
+
+	// Mid-morning two days ago, in daylight
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	suite.start = today.Add(-48*time.Hour + 10*time.Hour)
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Get("/drivers/:driver_id/scorecard", GetDriverScorecard)
+}
+
+func (suite *DriverScoringHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+// position records a position of a trip driving east along the equator,
+// as far from the last one as its speeds imply
+func (suite *DriverScoringHandlerTestSuite) position(trip models.Trip, driverID *uint, at time.Time, speed float64, limit *float64) {
+	if !suite.lastAt.IsZero() {
+		suite.longitude += (suite.lastSpeed + speed) / 2 * at.Sub(suite.lastAt).Hours() / kmPerDegree
+	}
+	suite.Require().NoError(testDB.Create(&models.TrackingRecord{
+		TripID:     trip.ID,
+		DriverID:   driverID,
+		Longitude:  suite.longitude,
+		Speed:      &speed,
+		SpeedLimit: limit,
+		Timestamp:  at,
+		Source:     "GPS",
+	}).Error)
+	suite.lastAt, suite.lastSpeed = at, speed
+}
+
+// drive records a position every interval at the given speeds, and returns
+// the time of the last one
+func (suite *DriverScoringHandlerTestSuite) drive(trip models.Trip, driverID *uint, at time.Time, interval time.Duration, speeds []float64, limit *float64) time.Time {
+	for i, speed := range speeds {
+		if i > 0 {
+			at = at.Add(interval)
+		}
+		suite.position(trip, driverID, at, speed, limit)
+	}
+	return at
+}
+
+func steady(speed float64, samples int) []float64 {
+	speeds := make([]float64, samples)
+	for i := range speeds {
+		speeds[i] = speed
+	}
+	return speeds
+}
+
+func (suite *DriverScoringHandlerTestSuite) scorecard(userID, driverID uint, query string) (*services.DriverScorecard, int) {
+	req := httptest.NewRequest("GET", fmt.Sprintf("/drivers/%d/scorecard%s", driverID, query), nil)
+	req.Header.Set("X-User-ID", fmt.Sprintf("%d", userID))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	if resp.StatusCode != 200 {
+		return nil, resp.StatusCode
+	}
+	var scorecard services.DriverScorecard
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&scorecard))
+	return &scorecard, resp.StatusCode
+}
+
+func (suite *DriverScoringHandlerTestSuite) TestScorecardPenalizesSpeedingAndHarshBraking() {
+	t := suite.T()
+	limit := 80.0
+
+	// An hour at 90 km/h in an 80 zone, then braking hard to 30 km/h in 3
+	// seconds, then stopped for 10 minutes
+	end := suite.drive(suite.trip, &suite.driver.ID, suite.start, time.Minute, steady(90, 61), &limit)
+	end = end.Add(3 * time.Second)
+	suite.position(suite.trip, &suite.driver.ID, end, 30, &limit)
+	suite.drive(suite.trip, &suite.driver.ID, end.Add(time.Minute), time.Minute, steady(0, 11), &limit)
+
+	scorecard, status := suite.scorecard(suite.driver.ID, suite.driver.ID, "")
+	suite.Require().Equal(200, status)
+	assert.Equal(t, 1, scorecard.Trips)
+	assert.InDelta(t, 90, scorecard.DistanceKm, 1)
+	assert.InDelta(t, 61.05/60, scorecard.DrivingHours, 0.01)
+	assert.InDelta(t, 10.0/60, scorecard.IdleHours, 0.01)
+	assert.Equal(t, 1, scorecard.HarshBrakings)
+	assert.Equal(t, 0, scorecard.HarshAccelerations)
+	assert.Greater(t, scorecard.SpeedingPercent, 95.0)
+	assert.Zero(t, scorecard.NightHours)
+
+	suite.Require().NotNil(scorecard.Score)
+	assert.Less(t, *scorecard.Score, 10.0)
+	assert.Equal(t, services.SafetyPoor, scorecard.Rating)
+	assert.True(t, scorecard.TrainingRecommended)
+	var factors []string
+	for _, penalty := range scorecard.Penalties {
+		factors = append(factors, penalty.Factor)
+	}
+	assert.ElementsMatch(t, []string{"HARSH_EVENTS", "SPEEDING", "IDLING"}, factors)
+}
+
+func (suite *DriverScoringHandlerTestSuite) TestCarefulDriverAndTooLittleDriving() {
+	t := suite.T()
+
+	// An hour at 70 km/h at night, without reported limits, so held to the
+	// alert speed limit
+	night := suite.start.Add(13 * time.Hour)
+	suite.drive(suite.trip, &suite.driver.ID, night, time.Minute, steady(70, 61), nil)
+
+	scorecard, status := suite.scorecard(suite.driver.ID, suite.driver.ID, "")
+	suite.Require().Equal(200, status)
+	assert.Zero(t, scorecard.SpeedingHours)
+	assert.InDelta(t, 100, scorecard.NightDrivingPercent, 2)
+	suite.Require().NotNil(scorecard.Score)
+	assert.InDelta(t, 80, *scorecard.Score, 0.5)
+	assert.Equal(t, services.SafetyGood, scorecard.Rating)
+	assert.False(t, scorecard.TrainingRecommended)
+
+	// The same drive isn't in a period before it
+	scorecard, status = suite.scorecard(suite.driver.ID, suite.driver.ID,
+		"?to="+night.Add(-time.Hour).Format(time.RFC3339))
+	suite.Require().Equal(200, status)
+	assert.Zero(t, scorecard.DistanceKm)
+	assert.Nil(t, scorecard.Score)
+	assert.False(t, scorecard.TrainingRecommended)
+}
+
+func (suite *DriverScoringHandlerTestSuite) TestScorecardAccess() {
+	t := suite.T()
+
+	_, status := suite.scorecard(suite.dispatcher.ID, suite.driver.ID, "")
+	assert.Equal(t, 200, status)
+	_, status = suite.scorecard(suite.stranger.ID, suite.driver.ID, "")
+	assert.Equal(t, 403, status)
+
+	// Carriers see the drivers they assigned trips to
+	_, status = suite.scorecard(suite.carrier.ID, suite.driver.ID, "")
+	assert.Equal(t, 403, status)
+	testDB.Create(&models.TripAssignment{TripID: suite.trip.ID, DriverID: suite.driver.ID, AssignedBy: suite.carrier.ID})
+	_, status = suite.scorecard(suite.carrier.ID, suite.driver.ID, "")
+	assert.Equal(t, 200, status)
+
+	_, status = suite.scorecard(suite.driver.ID, suite.driver.ID, "?from=2024-02-01&to=2024-01-01")
+	assert.Equal(t, 400, status)
+	_, status = suite.scorecard(suite.driver.ID, 99999, "")
+	assert.Equal(t, 403, status)
+}
+
+func (suite *DriverScoringHandlerTestSuite) TestDriverPerformanceUsesSafetyScore() {
+	t := suite.T()
+
+	// Both carriers delivered late; one drove carefully, the other never
+	// reported positions
+	departure := suite.start.Add(-time.Hour)
+	late := suite.start.Add(3 * time.Hour)
+	for _, carrier := range []models.User{suite.carrier, suite.stranger} {
+		trip := models.Trip{UserID: carrier.ID, Status: "COMPLETED", DepartureDate: departure, EstimatedArrival: suite.start.Add(time.Hour), ActualArrival: &late}
+		testDB.Create(&trip)
+		if carrier.ID == suite.carrier.ID {
+			suite.drive(trip, nil, suite.start, time.Minute, steady(70, 61), nil)
+		}
+	}
+
+	drivers, err := analyticsService.GetDriverPerformance(services.AnalyticsFilter{})
+	suite.Require().NoError(err)
+	suite.Require().Len(drivers, 2)
+	byID := map[string]services.DeliveryPerformanceByDriver{}
+	for _, driver := range drivers {
+		byID[driver.DriverID] = driver
+	}
+
+	careful := byID[fmt.Sprintf("%d", suite.carrier.ID)]
+	suite.Require().NotNil(careful.SafetyScore)
+	assert.InDelta(t, 100, *careful.SafetyScore, 0.5)
+	assert.False(t, careful.TrainingRecommended)
+
+	unscored := byID[fmt.Sprintf("%d", suite.stranger.ID)]
+	assert.Nil(t, unscored.SafetyScore)
+	assert.True(t, unscored.TrainingRecommended)
+}
+
+func TestDriverScoringHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(DriverScoringHandlerTestSuite))
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var emissionsService = services.NewEmissionsService(database.DB, config.GetEmissionsConfig())
+
+// GetTripEmissions @Summary Get a trip's emissions
+// @Description Get a trip's fuel use and CO2 emissions, as recorded when it completed or estimated so far, allocated to the loads on it by weight. Shippers only get the allocations of their own loads.
+// @Tags emissions
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Success 200 {object} services.TripEmissions
+// @Router /api/trips/{trip_id}/emissions [get]
+func GetTripEmissions(c *fiber.Ctx) error {
+	db, ok := tenantDB(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var trip models.Trip
+	if err := db.Select("id").First(&trip, c.Params("trip_id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip not found",
+		})
+	}
+
+	emissions, err := emissionsService.GetTripEmissions(trip.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not estimate trip emissions",
+		})
+	}
+
+	// Emissions are allocated over all the trip's loads, but only those the
+	// user sees are listed
+	var visible []uint
+	if err := db.Model(&models.Load{}).Where("trip_id = ?", trip.ID).Pluck("id", &visible).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch loads",
+		})
+	}
+	seen := make(map[uint]bool, len(visible))
+	for _, loadID := range visible {
+		seen[loadID] = true
+	}
+	loads := make([]services.LoadEmission, 0, len(emissions.Loads))
+	for _, load := range emissions.Loads {
+		if seen[load.LoadID] {
+			loads = append(loads, load)
+		}
+	}
+	emissions.Loads = loads
+
+	return c.JSON(emissions)
+}
+
+// GetCarbonReport @Summary Get a carbon report
+// @Description Get the fuel use and CO2 emissions of the current user's trips, or of their loads for the shipper view, over a date range compared with the period before it. The shipper view lists the emissions allocated to each load for ESG reporting. Admins get everyone's.
+// @Tags emissions
+// @Produce json
+// @Param view query string false "carrier (default) or shipper"
+// @Param from query string false "Start date (RFC3339 or YYYY-MM-DD), defaults to 30 days ago"
+// @Param to query string false "End date (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} services.CarbonReport
+// @Router /api/emissions/report [get]
+func GetCarbonReport(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		parsed, err := parseSearchDate(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid to date",
+			})
+		}
+		// A date includes the whole day
+		if len(value) == len("2006-01-02") {
+			parsed = parsed.Add(24*time.Hour - time.Nanosecond)
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 0, -30)
+	if value := c.Query("from"); value != "" {
+		parsed, err := parseSearchDate(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid from date",
+			})
+		}
+		from = parsed
+	}
+
+	scope, err := organizationService.Scope(uint(userID))
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	report, err := emissionsService.GetCarbonReport(scope, c.Query("view", services.CarbonViewCarrier), from, to)
+	if errors.Is(err, services.ErrInvalidCarbonView) || errors.Is(err, services.ErrInvalidCarbonPeriod) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not build carbon report",
+		})
+	}
+
+	return c.JSON(report)
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/middleware"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EmissionsHandlerTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	cfg     *config.EmissionsConfig
+	carrier models.User
+	shipper models.User
+	other   models.User
+	vehicle models.Vehicle
+	trip    models.Trip
+	ownLoad models.Load
+}
+
+func (suite *EmissionsHandlerTestSuite) SetupSuite() {
+	registerTenantScope(suite.T())
+}
+
+func (suite *EmissionsHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	organizationService = services.NewOrganizationService(testDB)
+	suite.cfg = config.GetEmissionsConfig()
+	emissionsService = services.NewEmissionsService(testDB, suite.cfg)
+
+	users := []*models.User{&suite.carrier, &suite.shipper, &suite.other}
+	roles := []string{"CARRIER", "SHIPPER", "SHIPPER"}
+	for i, user := range users {
+		*user = models.User{Email: fmt.Sprintf("emissions%d@example.com", i), Phone: fmt.Sprintf("+1555000020%d", i), Password: "password", Role: roles[i]}
+		testDB.Create(user)
+	}
+
+	suite.vehicle = models.Vehicle{UserID: suite.carrier.ID, LicensePlate: "CO2-1", VIN: "CO2VIN1", VehicleType: "REEFER"}
+	testDB.Create(&suite.vehicle)
+	suite.trip = suite.createTrip(time.Now().AddDate(0, 0, -2))
+
+	// Three quarters of the payload is the shipper's
+	suite.ownLoad = models.Load{ShipperID: suite.shipper.ID, TripID: suite.trip.ID, BookingReference: "CO2-OWN", Weight: 3000, Status: "IN_TRANSIT"}
+	testDB.Create(&suite.ownLoad)
+	testDB.Create(&models.Load{ShipperID: suite.other.ID, TripID: suite.trip.ID, BookingReference: "CO2-OTHER", Weight: 1000, Status: "IN_TRANSIT"})
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Get("/trips/:trip_id/emissions", middleware.NewTenantMiddleware(testDB).Scope(), GetTripEmissions)
+	suite.app.Get("/emissions/report", GetCarbonReport)
+}
+
+func (suite *EmissionsHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+// createTrip creates a trip of the carrier between Johannesburg and
+// Pretoria, arriving at a time
+func (suite *EmissionsHandlerTestSuite) createTrip(arrival time.Time) models.Trip {
+	departure := arrival.Add(-2 * time.Hour)
+	trip := models.Trip{
+		UserID:          suite.carrier.ID,
+		VehicleID:       suite.vehicle.ID,
+		OriginLat:       -26.2041,
+		OriginLng:       28.0473,
+		DestinationLat:  -25.7479,
+		DestinationLng:  28.2293,
+		DepartureDate:   departure,
+		ActualDeparture: &departure,
+		ActualArrival:   &arrival,
+		Status:          "COMPLETED",
+	}
+	testDB.Create(&trip)
+	return trip
+}
+
+func (suite *EmissionsHandlerTestSuite) get(url string, userID uint, result interface{}) int {
+	req := httptest.NewRequest("GET", url, nil)
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	if result != nil && resp.StatusCode == 200 {
+		suite.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	}
+	return resp.StatusCode
+}
+
+func (suite *EmissionsHandlerTestSuite) TestTripEstimatedFromPlannedDistance() {
+	t := suite.T()
+
+	var emissions services.TripEmissions
+	assert.Equal(t, 200, suite.get(fmt.Sprintf("/trips/%d/emissions", suite.trip.ID), suite.carrier.ID, &emissions))
+	assert.False(t, emissions.Recorded)
+	assert.Equal(t, services.EmissionsPlanned, emissions.Method)
+	assert.Equal(t, "REEFER", emissions.VehicleType)
+	assert.Equal(t, 4000.0, emissions.PayloadKg)
+
+	// About 53 km as the crow flies, further by road
+	assert.InDelta(t, 64, emissions.DistanceKm, 2)
+	litresPer100Km := suite.cfg.Consumption("REEFER") + suite.cfg.PayloadConsumption*4
+	assert.InDelta(t, emissions.DistanceKm/100*litresPer100Km, emissions.FuelLitres, 0.001)
+	assert.InDelta(t, emissions.FuelLitres*suite.cfg.CO2PerLitre, emissions.CO2Kg, 0.001)
+
+	// The carrier sees both loads' allocations, by weight
+	assert.Len(t, emissions.Loads, 2)
+	for _, load := range emissions.Loads {
+		assert.InDelta(t, emissions.CO2Kg*load.WeightKg/4000, load.CO2Kg, 0.001)
+	}
+
+	// The shipper only sees their own load's, and other shippers nothing
+	assert.Equal(t, 200, suite.get(fmt.Sprintf("/trips/%d/emissions", suite.trip.ID), suite.shipper.ID, &emissions))
+	assert.Len(t, emissions.Loads, 1)
+	assert.Equal(t, suite.ownLoad.ID, emissions.Loads[0].LoadID)
+	assert.InDelta(t, 0.75, emissions.Loads[0].Share, 0.001)
+
+	stranger := models.User{Email: "stranger@example.com", Phone: "+15550000299", Password: "password", Role: "CARRIER"}
+	testDB.Create(&stranger)
+	assert.Equal(t, 404, suite.get(fmt.Sprintf("/trips/%d/emissions", suite.trip.ID), stranger.ID, nil))
+}
+
+func (suite *EmissionsHandlerTestSuite) TestTripEstimatedFromTelematics() {
+	t := suite.T()
+	cruising, crawling := 80.0, 10.0
+	start := time.Now().Add(-time.Hour).Truncate(5 * time.Minute)
+	testDB.Create(&models.TrackingAggregate{TripID: suite.trip.ID, Resolution: services.TrackingResolution5m, BucketStart: start, AvgSpeed: &cruising, DistanceKm: 6})
+	testDB.Create(&models.TrackingAggregate{TripID: suite.trip.ID, Resolution: services.TrackingResolution5m, BucketStart: start.Add(5 * time.Minute), AvgSpeed: &crawling, DistanceKm: 1})
+
+	emission, err := emissionsService.RecordTrip(suite.trip.ID)
+	suite.Require().NoError(err)
+	assert.Equal(t, services.EmissionsTelematics, emission.Method)
+	assert.InDelta(t, 7, emission.DistanceKm, 0.001)
+
+	// Crawling in traffic burns more fuel per kilometer
+	litresPer100Km := suite.cfg.Consumption("REEFER") + suite.cfg.PayloadConsumption*4
+	assert.InDelta(t, (6+1*1.35)/100*litresPer100Km, emission.FuelLitres, 0.001)
+
+	// Recording again replaces the trip's emissions
+	_, err = emissionsService.RecordTrip(suite.trip.ID)
+	suite.Require().NoError(err)
+	var count int64
+	testDB.Model(&models.TripEmission{}).Where("trip_id = ?", suite.trip.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	var emissions services.TripEmissions
+	assert.Equal(t, 200, suite.get(fmt.Sprintf("/trips/%d/emissions", suite.trip.ID), suite.carrier.ID, &emissions))
+	assert.True(t, emissions.Recorded)
+	assert.InDelta(t, emission.CO2Kg, emissions.CO2Kg, 0.001)
+}
+
+func (suite *EmissionsHandlerTestSuite) TestCarbonReportComparesPeriods() {
+	t := suite.T()
+
+	// A trip in the previous 30 days, with one load of the other shipper's
+	previousTrip := suite.createTrip(time.Now().AddDate(0, 0, -40))
+	testDB.Create(&models.Load{ShipperID: suite.other.ID, TripID: previousTrip.ID, BookingReference: "CO2-PREVIOUS", Weight: 2000, Status: "DELIVERED"})
+	suite.Require().NoError(emissionsService.RecordCompletedTrips())
+
+	var current, previous models.TripEmission
+	testDB.Where("trip_id = ?", suite.trip.ID).First(&current)
+	testDB.Where("trip_id = ?", previousTrip.ID).First(&previous)
+	suite.Require().NotZero(current.ID)
+	suite.Require().NotZero(previous.ID)
+
+	var report services.CarbonReport
+	assert.Equal(t, 200, suite.get("/emissions/report", suite.carrier.ID, &report))
+	assert.Equal(t, services.CarbonViewCarrier, report.View)
+	assert.Equal(t, 1, report.Current.Trips)
+	assert.Equal(t, 2, report.Current.Loads)
+	assert.InDelta(t, current.CO2Kg, report.Current.CO2Kg, 0.001)
+	assert.Equal(t, 1, report.Previous.Trips)
+	assert.InDelta(t, previous.CO2Kg, report.Previous.CO2Kg, 0.001)
+	assert.InDelta(t, current.CO2Kg-previous.CO2Kg, report.Change.CO2Kg, 0.001)
+	suite.Require().NotNil(report.CO2ChangePercent)
+	assert.InDelta(t, (current.CO2Kg-previous.CO2Kg)/previous.CO2Kg*100, *report.CO2ChangePercent, 0.001)
+	assert.Empty(t, report.Loads)
+
+	// The shipper's report only counts their share of the trip
+	report = services.CarbonReport{}
+	assert.Equal(t, 200, suite.get("/emissions/report?view=shipper", suite.shipper.ID, &report))
+	assert.Equal(t, 1, report.Current.Loads)
+	assert.InDelta(t, current.CO2Kg*0.75, report.Current.CO2Kg, 0.001)
+	assert.InDelta(t, report.Current.CO2Kg*1000/(3*current.DistanceKm), report.Current.CO2PerTonneKm, 0.001)
+	assert.Zero(t, report.Previous.Trips)
+	assert.Nil(t, report.CO2ChangePercent)
+	suite.Require().Len(report.Loads, 1)
+	assert.Equal(t, "CO2-OWN", report.Loads[0].BookingReference)
+
+	// A date range only counts the trips in it
+	from := time.Now().AddDate(0, 0, -45).Format("2006-01-02")
+	to := time.Now().AddDate(0, 0, -35).Format("2006-01-02")
+	assert.Equal(t, 200, suite.get("/emissions/report?view=shipper&from="+from+"&to="+to, suite.other.ID, &report))
+	assert.Equal(t, 1, report.Current.Trips)
+	assert.InDelta(t, previous.CO2Kg, report.Current.CO2Kg, 0.001)
+
+	assert.Equal(t, 400, suite.get("/emissions/report?view=fleet", suite.carrier.ID, nil))
+	assert.Equal(t, 400, suite.get("/emissions/report?from="+to+"&to="+from, suite.carrier.ID, nil))
+}
+
+func TestEmissionsHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(EmissionsHandlerTestSuite))
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// featureFlagService returns the feature flag service, or responds with 503
+// when it isn't set up
+func featureFlagService(c *fiber.Ctx) (*services.FeatureFlagService, error) {
+	service := services.GetFeatureFlagService()
+	if service == nil {
+		return nil, c.Status(503).JSON(fiber.Map{
+			"error": "Feature flags are not available",
+		})
+	}
+	return service, nil
+}
+
+// GetFeatureFlags @Summary Get feature flags
+// @Description Get all feature flags with their targeting
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.FeatureFlag
+// @Router /admin/feature-flags [get]
+func GetFeatureFlags(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	service, err := featureFlagService(c)
+	if service == nil {
+		return err
+	}
+
+	flags, err := service.ListFlags()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch feature flags",
+		})
+	}
+
+	return c.JSON(flags)
+}
+
+// SetFeatureFlag @Summary Create or change a feature flag
+// @Description Toggle a feature flag or change its rollout percent and targeted users and organizations. Fields left out keep their value.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param key path string true "Flag key"
+// @Param flag body services.FeatureFlagRequest true "Flag changes"
+// @Success 200 {object} models.FeatureFlag
+// @Router /admin/feature-flags/{key} [put]
+func SetFeatureFlag(c *fiber.Ctx) error {
+	adminID, status, message := adminUserID(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	service, err := featureFlagService(c)
+	if service == nil {
+		return err
+	}
+
+	var req services.FeatureFlagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	flag, err := service.SetFlag(c.Params("key"), req, adminID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(flag)
+}
+
+// DeleteFeatureFlag @Summary Delete a feature flag
+// @Description Delete a feature flag, turning its feature off for everyone
+// @Tags admin
+// @Param key path string true "Flag key"
+// @Success 204
+// @Router /admin/feature-flags/{key} [delete]
+func DeleteFeatureFlag(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	service, err := featureFlagService(c)
+	if service == nil {
+		return err
+	}
+
+	if err := service.DeleteFlag(c.Params("key")); err != nil {
+		if errors.Is(err, services.ErrFeatureFlagNotFound) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Feature flag not found",
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not delete feature flag",
+		})
+	}
+
+	return c.SendStatus(204)
+}
+
+// GetMyFeatureFlags @Summary Get the current user's features
+// @Description Get whether each feature is on for the current user, so clients can show or hide it
+// @Tags users
+// @Produce json
+// @Success 200 {object} map[string]bool
+// @Router /users/me/feature-flags [get]
+func GetMyFeatureFlags(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	service, err := featureFlagService(c)
+	if service == nil {
+		return err
+	}
+
+	return c.JSON(service.EnabledFeatures(uint(userID)))
+}
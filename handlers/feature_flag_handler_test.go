@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/middleware"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type FeatureFlagHandlerTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	service *services.FeatureFlagService
+	admin   models.User
+	user    models.User
+}
+
+func (suite *FeatureFlagHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+
+	suite.admin = models.User{Email: "admin@example.com", Phone: "+1987654321", Password: "password", Role: "ADMIN"}
+	testDB.Create(&suite.admin)
+	testDB.Where("email = ?", "test@example.com").First(&suite.user)
+
+	suite.service = services.NewFeatureFlagService(testDB, time.Minute)
+	services.SetFeatureFlagService(suite.service)
+
+	suite.app = fiber.New()
+
+	suite.app.Use(asHeaderUser())
+
+	suite.app.Get("/admin/feature-flags", GetFeatureFlags)
+	suite.app.Put("/admin/feature-flags/:key", SetFeatureFlag)
+	suite.app.Delete("/admin/feature-flags/:key", DeleteFeatureFlag)
+	suite.app.Get("/users/me/feature-flags", GetMyFeatureFlags)
+	suite.app.Get("/matching", middleware.RequireFeature(services.FeatureMatchingV2), func(c *fiber.Ctx) error {
+		return c.SendString("v2")
+	})
+}
+
+func (suite *FeatureFlagHandlerTestSuite) TearDownTest() {
+	services.SetFeatureFlagService(nil)
+	clearTestDB()
+}
+
+func (suite *FeatureFlagHandlerTestSuite) request(method, url string, userID uint, body interface{}) (int, []byte) {
+	jsonData, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var respBody bytes.Buffer
+	respBody.ReadFrom(resp.Body)
+	return resp.StatusCode, respBody.Bytes()
+}
+
+func (suite *FeatureFlagHandlerTestSuite) setFlag(key string, req services.FeatureFlagRequest) {
+	status, body := suite.request("PUT", "/admin/feature-flags/"+key, suite.admin.ID, req)
+	suite.Require().Equal(200, status, string(body))
+}
+
+func (suite *FeatureFlagHandlerTestSuite) TestManageFlags() {
+	t := suite.T()
+	enabled := true
+
+	// Only admins manage flags
+	status, _ := suite.request("PUT", "/admin/feature-flags/ml_eta", suite.user.ID, services.FeatureFlagRequest{Enabled: &enabled})
+	assert.Equal(t, 403, status)
+	status, _ = suite.request("GET", "/admin/feature-flags", suite.user.ID, nil)
+	assert.Equal(t, 403, status)
+
+	status, _ = suite.request("PUT", "/admin/feature-flags/ML%20ETA", suite.admin.ID, services.FeatureFlagRequest{Enabled: &enabled})
+	assert.Equal(t, 400, status)
+	tooMuch := 150
+	status, _ = suite.request("PUT", "/admin/feature-flags/ml_eta", suite.admin.ID, services.FeatureFlagRequest{RolloutPercent: &tooMuch})
+	assert.Equal(t, 400, status)
+
+	description := "ETAs from the ML model"
+	status, body := suite.request("PUT", "/admin/feature-flags/ml_eta", suite.admin.ID, services.FeatureFlagRequest{
+		Description: &description,
+		UserIDs:     &[]uint{suite.user.ID, suite.user.ID},
+	})
+	assert.Equal(t, 200, status)
+	var flag models.FeatureFlag
+	assert.NoError(t, json.Unmarshal(body, &flag))
+	assert.False(t, flag.Enabled)
+	assert.Equal(t, strconv.Itoa(int(suite.user.ID)), flag.UserIDs)
+	if assert.NotNil(t, flag.UpdatedBy) {
+		assert.Equal(t, suite.admin.ID, *flag.UpdatedBy)
+	}
+
+	// New flags start disabled, and toggling keeps the other fields
+	assert.False(t, services.FeatureEnabled(services.FeatureMLETA, suite.user.ID))
+	suite.setFlag(services.FeatureMLETA, services.FeatureFlagRequest{Enabled: &enabled})
+	assert.True(t, services.FeatureEnabled(services.FeatureMLETA, suite.user.ID))
+
+	status, body = suite.request("GET", "/admin/feature-flags", suite.admin.ID, nil)
+	assert.Equal(t, 200, status)
+	var flags []models.FeatureFlag
+	assert.NoError(t, json.Unmarshal(body, &flags))
+	if assert.Len(t, flags, 1) {
+		assert.Equal(t, description, flags[0].Description)
+		assert.True(t, flags[0].Enabled)
+	}
+
+	// Deleting turns the feature off, and the key can be used again
+	status, _ = suite.request("DELETE", "/admin/feature-flags/ml_eta", suite.admin.ID, nil)
+	assert.Equal(t, 204, status)
+	status, _ = suite.request("DELETE", "/admin/feature-flags/ml_eta", suite.admin.ID, nil)
+	assert.Equal(t, 404, status)
+	assert.False(t, services.FeatureEnabled(services.FeatureMLETA, suite.user.ID))
+
+	suite.setFlag(services.FeatureMLETA, services.FeatureFlagRequest{Enabled: &enabled})
+}
+
+func (suite *FeatureFlagHandlerTestSuite) TestTargeting() {
+	t := suite.T()
+	enabled := true
+
+	other := models.User{Email: "other@example.com", Phone: "+1555555555", Password: "password", Role: "CARRIER"}
+	testDB.Create(&other)
+	organization := models.Organization{Name: "Acme Freight", Type: "CARRIER", OwnerID: other.ID}
+	testDB.Create(&organization)
+	testDB.Create(&models.OrganizationMembership{OrganizationID: organization.ID, UserID: other.ID, Role: "OWNER"})
+
+	suite.setFlag(services.FeatureMatchingV2, services.FeatureFlagRequest{
+		Enabled:         &enabled,
+		OrganizationIDs: &[]uint{organization.ID},
+	})
+	assert.True(t, services.FeatureEnabled(services.FeatureMatchingV2, other.ID))
+	assert.False(t, services.FeatureEnabled(services.FeatureMatchingV2, suite.user.ID))
+	assert.False(t, services.FeatureEnabled(services.FeatureMatchingV2, 0))
+
+	status, body := suite.request("GET", "/users/me/feature-flags", other.ID, nil)
+	assert.Equal(t, 200, status)
+	var features map[string]bool
+	assert.NoError(t, json.Unmarshal(body, &features))
+	assert.Equal(t, map[string]bool{services.FeatureMatchingV2: true}, features)
+
+	// Routes behind the flag don't exist for users it is off for
+	status, _ = suite.request("GET", "/matching", suite.user.ID, nil)
+	assert.Equal(t, 404, status)
+	status, body = suite.request("GET", "/matching", other.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "v2", string(body))
+
+	// Disabling the flag wins over targeting
+	disabled := false
+	suite.setFlag(services.FeatureMatchingV2, services.FeatureFlagRequest{Enabled: &disabled})
+	assert.False(t, services.FeatureEnabled(services.FeatureMatchingV2, other.ID))
+}
+
+func (suite *FeatureFlagHandlerTestSuite) TestRollout() {
+	t := suite.T()
+	enabled := true
+
+	users := make([]uint, 200)
+	for i := range users {
+		users[i] = uint(1000 + i)
+	}
+	onFor := func() map[uint]bool {
+		on := map[uint]bool{}
+		for _, userID := range users {
+			if suite.service.IsEnabled(services.FeatureMLETA, userID) {
+				on[userID] = true
+			}
+		}
+		return on
+	}
+
+	zero := 0
+	suite.setFlag(services.FeatureMLETA, services.FeatureFlagRequest{Enabled: &enabled, RolloutPercent: &zero})
+	assert.Empty(t, onFor())
+
+	quarter := 25
+	suite.setFlag(services.FeatureMLETA, services.FeatureFlagRequest{RolloutPercent: &quarter})
+	rolledOut := onFor()
+	assert.InDelta(t, 50, len(rolledOut), 25, fmt.Sprintf("%d of %d users", len(rolledOut), len(users)))
+	assert.Equal(t, rolledOut, onFor(), "users should stay in their bucket")
+
+	// Growing the rollout keeps the users it was on for
+	half := 50
+	suite.setFlag(services.FeatureMLETA, services.FeatureFlagRequest{RolloutPercent: &half})
+	grown := onFor()
+	assert.Greater(t, len(grown), len(rolledOut))
+	for userID := range rolledOut {
+		assert.True(t, grown[userID], "user %d dropped from the rollout", userID)
+	}
+
+	full := 100
+	suite.setFlag(services.FeatureMLETA, services.FeatureFlagRequest{RolloutPercent: &full})
+	assert.Len(t, onFor(), len(users))
+	assert.True(t, suite.service.IsEnabled(services.FeatureMLETA, 0))
+}
+
+func (suite *FeatureFlagHandlerTestSuite) TestUnavailableWithoutService() {
+	services.SetFeatureFlagService(nil)
+
+	status, _ := suite.request("GET", "/users/me/feature-flags", suite.user.ID, nil)
+	assert.Equal(suite.T(), 503, status)
+	assert.False(suite.T(), services.FeatureEnabled(services.FeatureMLETA, suite.user.ID))
+}
+
+func TestFeatureFlagHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(FeatureFlagHandlerTestSuite))
+}
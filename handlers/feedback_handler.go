@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"strconv"
+	"triplink/backend/database"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var feedbackService = services.NewFeedbackService(database.DB, services.NewMLService())
+
+// SubmitFeedback @Summary Give feedback on a delivered load
+// @Description Rate a delivered load, how likely you are to recommend its carrier and comment on it. Only the load's shipper can give feedback, once per load. Comments are analyzed for their sentiment and topic in the background, and the carrier is asked to follow up on negative feedback.
+// @Tags feedback
+// @Accept json
+// @Produce json
+// @Param load_id path int true "Load ID"
+// @Param feedback body services.SubmitFeedbackRequest true "Survey answers"
+// @Success 201 {object} models.Feedback
+// @Router /loads/{load_id}/feedback [post]
+func SubmitFeedback(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	loadID, err := strconv.ParseUint(c.Params("load_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid load ID",
+		})
+	}
+
+	var req services.SubmitFeedbackRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	feedback, err := feedbackService.Submit(uint(userID), uint(loadID), req)
+	if err != nil {
+		status := 400
+		switch err {
+		case services.ErrNotLoadShipper:
+			status = 403
+		case services.ErrFeedbackExists:
+			status = 409
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(feedback)
+}
+
+// GetFeedback @Summary List feedback
+// @Description List the feedback the current user gave as shipper or received as carrier, newest first
+// @Tags feedback
+// @Produce json
+// @Param sentiment query string false "POSITIVE, NEUTRAL or NEGATIVE"
+// @Param category query string false "Topic of the comment"
+// @Param unresolved query bool false "Only feedback not yet resolved"
+// @Param load_id query int false "Only the feedback on this load"
+// @Param limit query int false "Number of feedback entries to return (default 50)"
+// @Param offset query int false "Number of feedback entries to skip (default 0, ignored with cursor)"
+// @Param cursor query string false "Cursor from next_cursor of the previous page"
+// @Success 200 {object} map[string]interface{}
+// @Router /feedback [get]
+func GetFeedback(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	page, err := parsePageParams(c, 50)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
+	}
+
+	query := feedbackService.UserFeedbackQuery(uint(userID))
+	if sentiment := c.Query("sentiment"); sentiment != "" {
+		query = query.Where("sentiment = ?", sentiment)
+	}
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if c.QueryBool("unresolved") {
+		query = query.Where("resolved_at IS NULL")
+	}
+	if value := c.Query("load_id"); value != "" {
+		loadID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid load ID",
+			})
+		}
+		query = query.Where("load_id = ?", loadID)
+	}
+
+	var total int64
+	query.Session(&gorm.Session{}).Count(&total)
+
+	var feedback []models.Feedback
+	if err := page.paginate(query, "created_at").Find(&feedback).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch feedback",
+		})
+	}
+
+	nextCursor := ""
+	if page.hasMore(len(feedback)) {
+		feedback = feedback[:page.Limit]
+		last := feedback[len(feedback)-1]
+		nextCursor = encodePageCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        feedback,
+		"count":       len(feedback),
+		"total":       total,
+		"limit":       page.Limit,
+		"offset":      page.Offset,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	})
+}
+
+// ResolveFeedback @Summary Resolve feedback
+// @Description Record how the carrier followed up on feedback on one of their loads. Resolved negative feedback counts towards the resolution rate in customer satisfaction analytics.
+// @Tags feedback
+// @Accept json
+// @Produce json
+// @Param id path int true "Feedback ID"
+// @Param resolution body object true "Note on the follow-up"
+// @Success 200 {object} models.Feedback
+// @Router /feedback/{id}/resolve [post]
+func ResolveFeedback(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	feedbackID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid feedback ID",
+		})
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+	}
+
+	feedback, err := feedbackService.Resolve(uint(userID), uint(feedbackID), req.Note)
+	if err != nil {
+		status := 400
+		switch err {
+		case services.ErrFeedbackNotFound:
+			status = 404
+		case services.ErrNotFeedbackCarrier:
+			status = 403
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(feedback)
+}
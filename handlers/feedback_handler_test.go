@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// stubAnalyzer finds comments mentioning "late" negative and about
+// timeliness, and others positive and about communication
+type stubAnalyzer struct {
+	err error
+}
+
+func (s *stubAnalyzer) AnalyzeSentiment(text string) (*services.SentimentAnalysisResult, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if strings.Contains(text, "late") {
+		return &services.SentimentAnalysisResult{Text: text, Sentiment: "negative", Confidence: 0.9}, nil
+	}
+	return &services.SentimentAnalysisResult{Text: text, Sentiment: "positive", Confidence: 0.8}, nil
+}
+
+func (s *stubAnalyzer) ClassifyText(text string, categories []string) (*services.TextClassificationResult, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if strings.Contains(text, "late") {
+		return &services.TextClassificationResult{Text: text, TopCategory: "timeliness", Confidence: 0.7}, nil
+	}
+	return &services.TextClassificationResult{Text: text, TopCategory: "communication", Confidence: 0.6}, nil
+}
+
+type FeedbackHandlerTestSuite struct {
+	suite.Suite
+	app      *fiber.App
+	analyzer *stubAnalyzer
+	shipper  models.User
+	carrier  models.User
+	trip     models.Trip
+	loads    int
+}
+
+func (suite *FeedbackHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	suite.analyzer = &stubAnalyzer{}
+	feedbackService = services.NewFeedbackService(testDB, suite.analyzer)
+	analyticsService = services.NewAnalyticsService(testDB)
+	organizationService = services.NewOrganizationService(testDB)
+	suite.loads = 0
+
+	suite.shipper = models.User{Email: "feedback-shipper@example.com", Phone: "+15550000401", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&suite.shipper)
+	suite.carrier = models.User{Email: "feedback-carrier@example.com", Phone: "+15550000402", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.carrier)
+	suite.trip = models.Trip{UserID: suite.carrier.ID, Status: "COMPLETED"}
+	testDB.Create(&suite.trip)
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Post("/loads/:load_id/feedback", SubmitFeedback)
+	suite.app.Get("/feedback", GetFeedback)
+	suite.app.Post("/feedback/:id/resolve", ResolveFeedback)
+	suite.app.Post("/analytics/customer-satisfaction", GetCustomerSatisfactionAnalytics)
+}
+
+func (suite *FeedbackHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+// load creates a load of the shipper on the trip, created and delivered at
+// the given time
+func (suite *FeedbackHandlerTestSuite) load(shipperID uint, status string, at time.Time) models.Load {
+	suite.loads++
+	load := models.Load{
+		ShipperID:          shipperID,
+		TripID:             suite.trip.ID,
+		BookingReference:   fmt.Sprintf("FB-%d", suite.loads),
+		Weight:             1000,
+		Status:             status,
+		ActualDeliveryDate: &at,
+	}
+	suite.Require().NoError(testDB.Create(&load).Error)
+	testDB.Model(&load).Update("created_at", at)
+	return load
+}
+
+func (suite *FeedbackHandlerTestSuite) request(method, url string, userID uint, body interface{}, result interface{}) int {
+	var payload bytes.Buffer
+	if body != nil {
+		suite.Require().NoError(json.NewEncoder(&payload).Encode(body))
+	}
+	req := httptest.NewRequest(method, url, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	if result != nil && resp.StatusCode < 300 {
+		suite.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	}
+	return resp.StatusCode
+}
+
+func (suite *FeedbackHandlerTestSuite) TestSubmitAnalyzeAndResolve() {
+	t := suite.T()
+	load := suite.load(suite.shipper.ID, "DELIVERED", time.Now())
+	url := fmt.Sprintf("/loads/%d/feedback", load.ID)
+
+	// Only the shipper gives feedback, on delivered loads
+	survey := fiber.Map{"rating": 2, "recommend_score": 4, "comment": "Arrived a day late"}
+	assert.Equal(t, 403, suite.request("POST", url, suite.carrier.ID, survey, nil))
+	assert.Equal(t, 400, suite.request("POST", url, suite.shipper.ID, fiber.Map{"rating": 6}, nil))
+	pending := suite.load(suite.shipper.ID, "IN_TRANSIT", time.Now())
+	assert.Equal(t, 400, suite.request("POST", fmt.Sprintf("/loads/%d/feedback", pending.ID), suite.shipper.ID, survey, nil))
+
+	var feedback models.Feedback
+	suite.Require().Equal(201, suite.request("POST", url, suite.shipper.ID, survey, &feedback))
+	assert.Equal(t, suite.carrier.ID, feedback.CarrierID)
+	assert.Equal(t, suite.trip.ID, feedback.TripID)
+	assert.Equal(t, services.FeedbackPending, feedback.AnalysisStatus)
+	assert.Equal(t, 409, suite.request("POST", url, suite.shipper.ID, survey, nil))
+
+	// Analyzed in the background, and the carrier asked to follow up
+	suite.Require().NoError(feedbackService.AnalyzePending())
+	testDB.First(&feedback, feedback.ID)
+	assert.Equal(t, services.FeedbackAnalyzed, feedback.AnalysisStatus)
+	assert.Equal(t, services.SentimentNegative, feedback.Sentiment)
+	assert.Equal(t, "timeliness", feedback.Category)
+	assert.InDelta(t, 0.9, feedback.SentimentConfidence, 0.001)
+	assert.NotNil(t, feedback.AnalyzedAt)
+	var notifications []models.Notification
+	testDB.Where("type = ?", "FEEDBACK_NEGATIVE").Find(&notifications)
+	suite.Require().Len(notifications, 1)
+	assert.Equal(t, suite.carrier.ID, notifications[0].UserID)
+	assert.Contains(t, notifications[0].Message, load.BookingReference)
+
+	// Both parties see it until the carrier resolves it
+	var list struct {
+		Data  []models.Feedback `json:"data"`
+		Total int64             `json:"total"`
+	}
+	suite.Require().Equal(200, suite.request("GET", "/feedback?sentiment=NEGATIVE", suite.shipper.ID, nil, &list))
+	assert.Equal(t, int64(1), list.Total)
+	resolveURL := fmt.Sprintf("/feedback/%d/resolve", feedback.ID)
+	assert.Equal(t, 403, suite.request("POST", resolveURL, suite.shipper.ID, fiber.Map{"note": "Fine"}, nil))
+	assert.Equal(t, 404, suite.request("POST", "/feedback/999999/resolve", suite.carrier.ID, nil, nil))
+	suite.Require().Equal(200, suite.request("POST", resolveURL, suite.carrier.ID, fiber.Map{"note": "Refunded the late fee"}, &feedback))
+	assert.NotNil(t, feedback.ResolvedAt)
+	assert.Equal(t, "Refunded the late fee", feedback.ResolutionNote)
+	assert.Equal(t, 400, suite.request("POST", resolveURL, suite.carrier.ID, nil, nil))
+	suite.Require().Equal(200, suite.request("GET", "/feedback?unresolved=true", suite.carrier.ID, nil, &list))
+	assert.Equal(t, int64(0), list.Total)
+}
+
+func (suite *FeedbackHandlerTestSuite) TestAnalysisRetriedUntilFailed() {
+	t := suite.T()
+	suite.analyzer.err = errors.New("model unavailable")
+	load := suite.load(suite.shipper.ID, "DELIVERED", time.Now())
+	var feedback models.Feedback
+	suite.Require().Equal(201, suite.request("POST", fmt.Sprintf("/loads/%d/feedback", load.ID), suite.shipper.ID, fiber.Map{"rating": 4, "comment": "Good"}, &feedback))
+
+	// Feedback without a comment has nothing to analyze
+	silent := suite.load(suite.shipper.ID, "DELIVERED", time.Now())
+	var rated models.Feedback
+	suite.Require().Equal(201, suite.request("POST", fmt.Sprintf("/loads/%d/feedback", silent.ID), suite.shipper.ID, fiber.Map{"rating": 5}, &rated))
+	assert.Equal(t, services.FeedbackSkipped, rated.AnalysisStatus)
+
+	for i := 0; i < 2; i++ {
+		suite.Require().NoError(feedbackService.AnalyzePending())
+		testDB.First(&feedback, feedback.ID)
+		assert.Equal(t, services.FeedbackPending, feedback.AnalysisStatus)
+	}
+	suite.Require().NoError(feedbackService.AnalyzePending())
+	testDB.First(&feedback, feedback.ID)
+	assert.Equal(t, services.FeedbackFailed, feedback.AnalysisStatus)
+	assert.Equal(t, 3, feedback.AnalysisAttempts)
+	assert.Empty(t, feedback.Sentiment)
+}
+
+func (suite *FeedbackHandlerTestSuite) TestCustomerSatisfactionAnalytics() {
+	t := suite.T()
+	now := time.Now()
+	start := now.AddDate(0, 0, -30)
+	returning := models.User{Email: "feedback-returning@example.com", Phone: "+15550000403", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&returning)
+	lost := models.User{Email: "feedback-lost@example.com", Phone: "+15550000404", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&lost)
+
+	// In the previous 30 days two shippers booked, rating 2 on average
+	for _, shipper := range []models.User{returning, lost} {
+		load := suite.load(shipper.ID, "DELIVERED", start.AddDate(0, 0, -10))
+		testDB.Create(&models.Feedback{LoadID: load.ID, ShipperID: shipper.ID, CarrierID: suite.carrier.ID, Rating: 2, AnalysisStatus: services.FeedbackSkipped})
+		testDB.Model(&models.Feedback{}).Where("load_id = ?", load.ID).Update("created_at", start.AddDate(0, 0, -5))
+	}
+
+	// In the period one of them booked again, with four deliveries of which
+	// three got feedback
+	surveys := []fiber.Map{
+		{"rating": 5, "recommend_score": 10, "comment": "Driver kept us posted"},
+		{"rating": 4, "recommend_score": 8, "comment": "Smooth"},
+		{"rating": 1, "recommend_score": 2, "comment": "Two days late"},
+	}
+	var feedback []models.Feedback
+	for i := 0; i < 4; i++ {
+		load := suite.load(returning.ID, "DELIVERED", start.AddDate(0, 0, i+1))
+		if i < len(surveys) {
+			var created models.Feedback
+			suite.Require().Equal(201, suite.request("POST", fmt.Sprintf("/loads/%d/feedback", load.ID), returning.ID, surveys[i], &created))
+			feedback = append(feedback, created)
+		}
+	}
+	suite.Require().NoError(feedbackService.AnalyzePending())
+	suite.Require().Equal(200, suite.request("POST", fmt.Sprintf("/feedback/%d/resolve", feedback[2].ID), suite.carrier.ID, nil, nil))
+	testDB.Model(&models.Feedback{}).Where("id = ?", feedback[2].ID).Update("resolved_at", feedback[2].CreatedAt.Add(6*time.Hour))
+
+	var metrics services.CustomerSatisfactionMetrics
+	suite.Require().Equal(200, suite.request("POST", "/analytics/customer-satisfaction", suite.carrier.ID, fiber.Map{
+		"date_range": fiber.Map{"start": start.Format("2006-01-02"), "end": now.AddDate(0, 0, 1).Format("2006-01-02")},
+	}, &metrics))
+	assert.Equal(t, 3, metrics.TotalResponses)
+	assert.InDelta(t, 10.0/3, metrics.OverallScore, 0.001)
+	assert.InDelta(t, 75, metrics.ResponseRate, 0.001)
+	assert.Equal(t, 2, metrics.SatisfiedCustomers)
+	assert.Equal(t, 1, metrics.DissatisfiedCustomers)
+	// One promoter, one passive and one detractor
+	assert.Equal(t, 0, metrics.NPSScore)
+	assert.InDelta(t, 10.0/3-2, metrics.ScoreImprovement, 0.001)
+	assert.InDelta(t, 50, metrics.RetentionRate, 0.001)
+	assert.InDelta(t, 50, metrics.ChurnRate, 0.001)
+	assert.InDelta(t, 6, metrics.AverageResponseTime, 0.01)
+	assert.InDelta(t, 100, metrics.ResolutionRate, 0.001)
+	assert.Equal(t, 2, metrics.PositiveFeedback)
+	assert.Equal(t, 1, metrics.NegativeFeedback)
+	assert.Zero(t, metrics.PendingAnalysis)
+	assert.Equal(t, []services.FeedbackCategoryCount{
+		{Category: "communication", Count: 2},
+		{Category: "timeliness", Count: 1, Negative: 1},
+	}, metrics.Categories)
+
+	// Users outside the loads see none of it
+	outsider := models.User{Email: "feedback-outsider@example.com", Phone: "+15550000405", Password: "password", Role: "CARRIER"}
+	testDB.Create(&outsider)
+	suite.Require().Equal(200, suite.request("POST", "/analytics/customer-satisfaction", outsider.ID, fiber.Map{}, &metrics))
+	assert.Zero(t, metrics.TotalResponses)
+	assert.Zero(t, metrics.ResponseRate)
+}
+
+func TestFeedbackHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(FeedbackHandlerTestSuite))
+}
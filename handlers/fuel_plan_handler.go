@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var fuelPlanService = services.NewFuelPlanService(database.DB, services.NewFuelAPIService(), config.GetFuelPlanConfig(), config.GetEmissionsConfig())
+
+// fuelPlanErrorStatus maps fuel plan service errors to a status
+func fuelPlanErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrFuelPlanUnreachable):
+		return 422
+	case errors.Is(err, services.ErrFuelPricesUnavailable):
+		return 502
+	}
+	return 400
+}
+
+// PlanTripFuelStops @Summary Plan a trip's fuel stops
+// @Description Plan where to refuel along a trip's route, the planned route unless a polyline is given, and how many litres to buy at each station for the lowest cost. Stations off the route are weighed by the detour to them. The plan is attached to the trip, replacing the one planned before.
+// @Tags trips
+// @Accept json
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param plan body services.FuelPlanRequest true "Route and tank range"
+// @Success 201 {object} models.TripFuelPlan
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /api/trips/{trip_id}/fuel-plan [post]
+func PlanTripFuelStops(c *fiber.Ctx) error {
+	trip, _, status, message := driverTrip(c)
+	if trip == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	var req services.FuelPlanRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	plan, err := fuelPlanService.PlanTrip(trip.ID, req)
+	if err != nil {
+		return c.Status(fuelPlanErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(plan)
+}
+
+// GetTripFuelPlan @Summary Get a trip's fuel plan
+// @Description Get the fuel stops planned along a trip's route
+// @Tags trips
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Success 200 {object} models.TripFuelPlan
+// @Router /api/trips/{trip_id}/fuel-plan [get]
+func GetTripFuelPlan(c *fiber.Ctx) error {
+	db, ok := tenantDB(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var trip models.Trip
+	if err := db.Select("id").First(&trip, c.Params("trip_id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip not found",
+		})
+	}
+
+	plan, err := fuelPlanService.GetTripPlan(trip.ID)
+	if errors.Is(err, services.ErrFuelPlanNotFound) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch fuel plan",
+		})
+	}
+
+	return c.JSON(plan)
+}
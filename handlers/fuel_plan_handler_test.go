@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"triplink/backend/config"
+	"triplink/backend/middleware"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// stubFuelPrices returns the same stations along any route
+type stubFuelPrices struct {
+	stations []services.FuelStation
+	err      error
+}
+
+func (s *stubFuelPrices) GetFuelPrices(location services.Coordinate, radius float64) (*services.FuelPriceInfo, error) {
+	return &services.FuelPriceInfo{Location: location, Stations: s.stations}, s.err
+}
+
+func (s *stubFuelPrices) GetFuelPricesAlongRoute(waypoints []services.Coordinate) ([]services.FuelStation, error) {
+	return s.stations, s.err
+}
+
+func (s *stubFuelPrices) GetFuelPriceTrends(location services.Coordinate, days int) (*services.FuelPriceTrend, error) {
+	return nil, s.err
+}
+
+type FuelPlanHandlerTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	prices  *stubFuelPrices
+	carrier models.User
+	other   models.User
+	trip    models.Trip
+	route   string
+}
+
+func (suite *FuelPlanHandlerTestSuite) SetupSuite() {
+	registerTenantScope(suite.T())
+}
+
+func (suite *FuelPlanHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	organizationService = services.NewOrganizationService(testDB)
+	tripAssignmentService = services.NewTripAssignmentService(testDB)
+
+	// About 500 km east along the equator, with stations near the route
+	// 111 km (1.50), 222 km (1.20) and 333 km (1.40) in, a cheaper one too
+	// far off the route and a closed one
+	suite.route = services.EncodePolyline([]services.Coordinate{
+		{Latitude: 0, Longitude: 0}, {Latitude: 0, Longitude: 1}, {Latitude: 0, Longitude: 2},
+		{Latitude: 0, Longitude: 3}, {Latitude: 0, Longitude: 4}, {Latitude: 0, Longitude: 4.5},
+	})
+	suite.prices = &stubFuelPrices{stations: []services.FuelStation{
+		{StationID: "C", Name: "Third", Location: services.Coordinate{Latitude: 0, Longitude: 3}, DieselPrice: 1.40, IsOpen: true},
+		{StationID: "A", Name: "First", Location: services.Coordinate{Latitude: 0.01, Longitude: 1}, DieselPrice: 1.50, IsOpen: true},
+		{StationID: "B", Name: "Second", Location: services.Coordinate{Latitude: 0, Longitude: 2}, DieselPrice: 1.20, IsOpen: true},
+		{StationID: "FAR", Name: "Far", Location: services.Coordinate{Latitude: 0.2, Longitude: 2.5}, DieselPrice: 0.50, IsOpen: true},
+		{StationID: "SHUT", Name: "Closed", Location: services.Coordinate{Latitude: 0, Longitude: 2.5}, DieselPrice: 0.50, IsOpen: false},
+	}}
+	fuelPlanService = services.NewFuelPlanService(testDB, suite.prices, config.GetFuelPlanConfig(), config.GetEmissionsConfig())
+
+	suite.carrier = models.User{Email: "fuel-carrier@example.com", Phone: "+15550000301", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.carrier)
+	suite.other = models.User{Email: "fuel-other@example.com", Phone: "+15550000302", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.other)
+	suite.trip = models.Trip{UserID: suite.carrier.ID, Status: "PLANNED"}
+	testDB.Create(&suite.trip)
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Post("/trips/:trip_id/fuel-plan", PlanTripFuelStops)
+	suite.app.Get("/trips/:trip_id/fuel-plan", middleware.NewTenantMiddleware(testDB).Scope(), GetTripFuelPlan)
+}
+
+func (suite *FuelPlanHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *FuelPlanHandlerTestSuite) request(method string, userID uint, body interface{}, result interface{}) int {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, fmt.Sprintf("/trips/%d/fuel-plan", suite.trip.ID), bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	if result != nil && resp.StatusCode < 300 {
+		suite.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	}
+	return resp.StatusCode
+}
+
+func (suite *FuelPlanHandlerTestSuite) TestPlansCheapestStops() {
+	t := suite.T()
+	startRange, reserve := 150.0, 20.0
+	req := fiber.Map{"polyline": suite.route, "tank_range_km": 300, "start_range_km": startRange, "reserve_km": reserve}
+
+	var plan models.TripFuelPlan
+	assert.Equal(t, 201, suite.request("POST", suite.carrier.ID, req, &plan))
+	assert.InDelta(t, 500, plan.RouteDistanceKm, 1)
+	// Without a vehicle or loads, the default consumption
+	assert.Equal(t, 30.0, plan.ConsumptionPer100Km)
+
+	// Buy just enough at the first station to reach the cheaper second one,
+	// then enough there for the rest of the route, skipping the dearer third
+	suite.Require().Len(plan.Stops, 2)
+	first, second := plan.Stops[0], plan.Stops[1]
+	assert.Equal(t, "A", first.StationID)
+	assert.Equal(t, "B", second.StationID)
+	assert.InDelta(t, 2.2, first.DetourKm, 0.1)
+	assert.InDelta(t, (second.RouteKm+first.DetourKm-(startRange-reserve))*0.3, first.Litres, 0.01)
+	assert.InDelta(t, (plan.RouteDistanceKm-second.RouteKm)*0.3, second.Litres, 0.01)
+	assert.InDelta(t, first.Litres*1.50, first.Cost, 0.01)
+	assert.InDelta(t, first.Litres+second.Litres, plan.TotalLitres, 0.01)
+	assert.InDelta(t, first.Cost+second.Cost, plan.TotalCost, 0.01)
+
+	// The plan is attached to the trip, replacing the previous one
+	assert.Equal(t, 201, suite.request("POST", suite.carrier.ID, req, &plan))
+	var plans, stops int64
+	testDB.Model(&models.TripFuelPlan{}).Where("trip_id = ?", suite.trip.ID).Count(&plans)
+	testDB.Model(&models.TripFuelStop{}).Count(&stops)
+	assert.Equal(t, int64(1), plans)
+	assert.Equal(t, int64(2), stops)
+
+	var stored models.TripFuelPlan
+	assert.Equal(t, 200, suite.request("GET", suite.carrier.ID, nil, &stored))
+	assert.Equal(t, plan.ID, stored.ID)
+	suite.Require().Len(stored.Stops, 2)
+	assert.Equal(t, "A", stored.Stops[0].StationID)
+	assert.Equal(t, 404, suite.request("GET", suite.other.ID, nil, nil))
+}
+
+func (suite *FuelPlanHandlerTestSuite) TestNoStopsWhenTheTankIsEnough() {
+	var plan models.TripFuelPlan
+	assert.Equal(suite.T(), 201, suite.request("POST", suite.carrier.ID, fiber.Map{"polyline": suite.route, "tank_range_km": 800}, &plan))
+	assert.Empty(suite.T(), plan.Stops)
+	assert.Zero(suite.T(), plan.TotalCost)
+}
+
+func (suite *FuelPlanHandlerTestSuite) TestUsesTripPlannedRoute() {
+	t := suite.T()
+	assert.Equal(t, 400, suite.request("POST", suite.carrier.ID, fiber.Map{"tank_range_km": 300}, nil))
+
+	testDB.Model(&suite.trip).Update("planned_route_polyline", suite.route)
+	var plan models.TripFuelPlan
+	assert.Equal(t, 201, suite.request("POST", suite.carrier.ID, fiber.Map{"tank_range_km": 300}, &plan))
+	assert.InDelta(t, 500, plan.RouteDistanceKm, 1)
+}
+
+func (suite *FuelPlanHandlerTestSuite) TestFailures() {
+	t := suite.T()
+	req := fiber.Map{"polyline": suite.route, "tank_range_km": 300}
+
+	assert.Equal(t, 403, suite.request("POST", suite.other.ID, req, nil))
+	assert.Equal(t, 422, suite.request("POST", suite.carrier.ID, fiber.Map{"polyline": suite.route}, nil))
+	assert.Equal(t, 404, suite.request("GET", suite.carrier.ID, nil, nil))
+
+	// The stations are further apart than the tank's range
+	assert.Equal(t, 422, suite.request("POST", suite.carrier.ID, fiber.Map{"polyline": suite.route, "tank_range_km": 100, "reserve_km": 0}, nil))
+
+	suite.prices.err = errors.New("timeout")
+	assert.Equal(t, 502, suite.request("POST", suite.carrier.ID, req, nil))
+}
+
+func TestFuelPlanHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(FuelPlanHandlerTestSuite))
+}
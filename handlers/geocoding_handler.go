@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BatchGeocodeRequest is the addresses to geocode, at most 100 at once
+type BatchGeocodeRequest struct {
+	Addresses []string `json:"addresses" validate:"required,min=1,max=100,dive,required"`
+}
+
+// addressGeocoder geocodes addresses through the geocoding cache
+var addressGeocoder = services.NewGeocodingCache(database.DB, services.DefaultAddressGeocoder(), config.GetGeocodingConfig())
+
+// BatchGeocodeAddresses @Summary Geocode addresses
+// @Description Geocode up to 100 addresses. Results are cached, so addresses geocoded before aren't sent to the mapping provider again.
+// @Tags geocoding
+// @Accept json
+// @Produce json
+// @Param request body BatchGeocodeRequest true "Addresses"
+// @Success 200 {array} services.BatchGeocodeResult
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /geocode/batch [post]
+func BatchGeocodeAddresses(c *fiber.Ctx) error {
+	var req BatchGeocodeRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	return c.JSON(addressGeocoder.BatchGeocode(req.Addresses))
+}
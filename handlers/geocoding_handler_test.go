@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+)
+
+type GeocodingHandlerTestSuite struct {
+	suite.Suite
+	app      *fiber.App
+	geocoder *fakeGeocoder
+}
+
+func (suite *GeocodingHandlerTestSuite) SetupTest() {
+	clearTestDB()
+
+	suite.geocoder = &fakeGeocoder{places: map[string]services.Coordinate{
+		"1 Harare Rd":   {Latitude: -17.83, Longitude: 31.05},
+		"2 Bulawayo St": {Latitude: -20.15, Longitude: 28.58},
+	}}
+	addressGeocoder = services.NewGeocodingCache(testDB, suite.geocoder, &config.GeocodingConfig{
+		CacheTTL:         24 * time.Hour,
+		FailureCacheTTL:  time.Hour,
+		BatchConcurrency: 2,
+	})
+	organizationService = services.NewOrganizationService(testDB)
+
+	suite.app = fiber.New()
+	suite.app.Post("/geocode/batch", BatchGeocodeAddresses)
+	suite.app.Post("/loads", CreateLoad)
+}
+
+func (suite *GeocodingHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *GeocodingHandlerTestSuite) post(path string, body interface{}, out interface{}) int {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func (suite *GeocodingHandlerTestSuite) TestBatchGeocodeCachesResults() {
+	addresses := []string{"1 Harare Rd, Harare", "2 Bulawayo St", "1  harare rd ,HARARE", "9 Unknown Ave"}
+
+	var results []services.BatchGeocodeResult
+	suite.Equal(200, suite.post("/geocode/batch", map[string]interface{}{"addresses": addresses}, &results))
+	suite.Require().Len(results, 4)
+	suite.Equal("1 Harare Rd, Harare", results[0].Address)
+	suite.InDelta(-17.83, results[0].Result.Geometry.Location.Latitude, 0.0001)
+	suite.False(results[0].Cached)
+	suite.InDelta(-17.83, results[2].Result.Geometry.Location.Latitude, 0.0001, "differently written addresses share an entry")
+	suite.Nil(results[3].Result)
+	suite.NotEmpty(results[3].Error)
+	suite.Equal(3, suite.geocoder.calls)
+
+	// Geocoded again from the cache, including the address without a result
+	suite.Equal(200, suite.post("/geocode/batch", map[string]interface{}{"addresses": addresses}, &results))
+	suite.Equal(3, suite.geocoder.calls)
+	suite.True(results[0].Cached)
+	suite.True(results[1].Cached)
+	suite.Equal("ZW", results[1].Result.AddressComponents[0].ShortName)
+	suite.NotEmpty(results[3].Error)
+
+	var entry models.GeocodedAddress
+	suite.Require().NoError(testDB.Where("address_key = ?", "1 harare rd,harare").First(&entry).Error)
+	suite.True(entry.Found)
+	suite.Equal(1, entry.Hits)
+
+	// Expired entries are geocoded again
+	testDB.Model(&models.GeocodedAddress{}).Where("id = ?", entry.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	suite.post("/geocode/batch", map[string]interface{}{"addresses": addresses[:1]}, &results)
+	suite.Equal(4, suite.geocoder.calls)
+	suite.False(results[0].Cached)
+}
+
+func (suite *GeocodingHandlerTestSuite) TestBatchGeocodeValidation() {
+	suite.Equal(422, suite.post("/geocode/batch", map[string]interface{}{"addresses": []string{}}, nil))
+
+	addresses := make([]string, 101)
+	for i := range addresses {
+		addresses[i] = "1 Harare Rd"
+	}
+	suite.Equal(422, suite.post("/geocode/batch", map[string]interface{}{"addresses": addresses}, nil))
+}
+
+func (suite *GeocodingHandlerTestSuite) TestCreateLoadGeocodesAddresses() {
+	var load models.Load
+	suite.Equal(200, suite.post("/loads", map[string]interface{}{
+		"booking_reference": "GEO-001",
+		"pickup_address":    "1 Harare Rd",
+		"delivery_address":  "2 Bulawayo St",
+		"delivery_lat":      -20.0,
+		"delivery_lng":      28.0,
+	}, &load))
+	suite.InDelta(-17.83, load.PickupLat, 0.0001)
+	suite.Equal("ZW", load.PickupCountry)
+	suite.Equal(-20.0, load.DeliveryLat, "given coordinates are kept")
+	suite.Equal(1, suite.geocoder.calls)
+
+	// The next load at the same pickup uses the cache
+	suite.Equal(200, suite.post("/loads", map[string]interface{}{
+		"booking_reference": "GEO-002",
+		"pickup_address":    "1 Harare Rd",
+	}, &load))
+	suite.InDelta(-17.83, load.PickupLat, 0.0001)
+	suite.Equal(1, suite.geocoder.calls)
+}
+
+func TestGeocodingHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(GeocodingHandlerTestSuite))
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"triplink/backend/internal/graphql"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GraphQL @Summary Run a GraphQL query
+// @Description Run a GraphQL query over the trips, loads, tracking records, events and analytics the current user sees, selecting only the fields needed. Related records are fetched in one batch per field. Only queries are supported; changes go through the REST API.
+// @Tags graphql
+// @Accept json
+// @Produce json
+// @Param request body graphql.Request true "Query, operation name and variables"
+// @Success 200 {object} graphql.Response
+// @Router /graphql [post]
+func GraphQL(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req graphql.Request
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	db, ok := tenantDB(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	request := newGraphQLContext(db, uint(userID))
+	ctx := context.WithValue(c.UserContext(), graphqlKey{}, request)
+	response := graphqlSchema.Execute(ctx, req)
+	// Queries that could not run at all are bad requests
+	if response.Data == nil {
+		return c.Status(400).JSON(response)
+	}
+	return c.JSON(response)
+}
+
+// GetGraphQLSchema @Summary Get the GraphQL schema
+// @Description Get the schema of the GraphQL API in the schema definition language, for client code generation
+// @Tags graphql
+// @Produce plain
+// @Success 200 {string} string
+// @Router /graphql/schema [get]
+func GetGraphQLSchema(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	return c.SendString(graphqlSchema.SDL())
+}
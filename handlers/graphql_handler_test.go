@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/middleware"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+)
+
+type GraphQLHandlerTestSuite struct {
+	suite.Suite
+	app      *fiber.App
+	carrier  models.User
+	shipper  models.User
+	other    models.User
+	outsider models.User
+	trip     models.Trip
+	load     models.Load
+}
+
+func (suite *GraphQLHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	registerTenantScope(suite.T())
+	organizationService = services.NewOrganizationService(testDB)
+	tripAssignmentService = services.NewTripAssignmentService(testDB)
+	analyticsService = services.NewAnalyticsService(testDB)
+
+	suite.carrier = models.User{Email: "carrier@haulage.example", Phone: "+15550000040", Password: "password", Role: "CARRIER", CompanyName: "Haulage Co"}
+	testDB.Create(&suite.carrier)
+	suite.shipper = models.User{Email: "shipper@example.com", Phone: "+15550000041", Password: "password", Role: "SHIPPER", CompanyName: "Grain Traders"}
+	testDB.Create(&suite.shipper)
+	suite.other = models.User{Email: "other@example.com", Phone: "+15550000042", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&suite.other)
+	suite.outsider = models.User{Email: "outsider@example.com", Phone: "+15550000043", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.outsider)
+
+	vehicle := models.Vehicle{UserID: suite.carrier.ID, Make: "Volvo", Model: "FH16", LicensePlate: "ABC-1234", VIN: "VIN-GRAPHQL-1"}
+	testDB.Create(&vehicle)
+
+	now := time.Now()
+	suite.trip = models.Trip{
+		UserID:           suite.carrier.ID,
+		VehicleID:        vehicle.ID,
+		OriginCity:       "Harare",
+		DestinationCity:  "Bulawayo",
+		Status:           "IN_TRANSIT",
+		DepartureDate:    now.Add(-2 * time.Hour),
+		EstimatedArrival: now.Add(4 * time.Hour),
+		TrackingEnabled:  true,
+	}
+	testDB.Create(&suite.trip)
+	empty := models.Trip{UserID: suite.carrier.ID, OriginCity: "Mutare", DestinationCity: "Gweru", Status: "PLANNED", DepartureDate: now.Add(24 * time.Hour), EstimatedArrival: now.Add(30 * time.Hour)}
+	testDB.Create(&empty)
+
+	suite.load = models.Load{TripID: suite.trip.ID, ShipperID: suite.shipper.ID, BookingReference: "GQL-001", Status: "IN_TRANSIT", RequestedPickupDate: now, RequestedDeliveryDate: now.Add(48 * time.Hour)}
+	testDB.Create(&suite.load)
+	otherLoad := models.Load{TripID: suite.trip.ID, ShipperID: suite.other.ID, BookingReference: "GQL-002", Status: "IN_TRANSIT", RequestedPickupDate: now, RequestedDeliveryDate: now.Add(48 * time.Hour)}
+	testDB.Create(&otherLoad)
+
+	for i := 0; i < 3; i++ {
+		testDB.Create(&models.TrackingRecord{
+			TripID:    suite.trip.ID,
+			Latitude:  -17.8 - float64(i)*0.1,
+			Longitude: 31.0 - float64(i)*0.1,
+			Timestamp: now.Add(time.Duration(i-3) * time.Minute),
+			Source:    "GPS",
+		})
+		testDB.Create(&models.TrackingEvent{
+			TripID:      suite.trip.ID,
+			EventType:   "MILESTONE",
+			Timestamp:   now.Add(time.Duration(i-3) * time.Minute),
+			Description: "Milestone " + strconv.Itoa(i+1),
+		})
+	}
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Post("/graphql", middleware.NewTenantMiddleware(testDB).Scope(), GraphQL)
+	suite.app.Get("/graphql/schema", GetGraphQLSchema)
+}
+
+func (suite *GraphQLHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+// query runs a GraphQL query as a user, decoding the response into out
+func (suite *GraphQLHandlerTestSuite) query(userID uint, query string, variables map[string]interface{}, out interface{}) int {
+	payload, _ := json.Marshal(fiber.Map{"query": query, "variables": variables})
+	req := httptest.NewRequest("POST", "/graphql", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	json.NewDecoder(resp.Body).Decode(out)
+	return resp.StatusCode
+}
+
+type graphqlTestResponse struct {
+	Data struct {
+		Me struct {
+			ID          string `json:"id"`
+			CompanyName string `json:"companyName"`
+		} `json:"me"`
+		Trips []struct {
+			ID              string `json:"id"`
+			Status          string `json:"status"`
+			DestinationCity string `json:"destinationCity"`
+			Carrier         *struct {
+				CompanyName string `json:"companyName"`
+			} `json:"carrier"`
+			Vehicle *struct {
+				LicensePlate string `json:"licensePlate"`
+			} `json:"vehicle"`
+			Loads []struct {
+				BookingReference string `json:"bookingReference"`
+				Shipper          struct {
+					CompanyName string `json:"companyName"`
+				} `json:"shipper"`
+			} `json:"loads"`
+			CurrentLocation *struct {
+				Latitude float64 `json:"latitude"`
+			} `json:"currentLocation"`
+			TrackingRecords []struct {
+				Timestamp string `json:"timestamp"`
+			} `json:"trackingRecords"`
+			Events []struct {
+				Description string `json:"description"`
+			} `json:"events"`
+		} `json:"trips"`
+		Trip *struct {
+			ID string `json:"id"`
+		} `json:"trip"`
+		Load *struct {
+			BookingReference string `json:"bookingReference"`
+			Trip             *struct {
+				OriginCity string `json:"originCity"`
+			} `json:"trip"`
+		} `json:"load"`
+		Analytics struct {
+			OnTimeDelivery struct {
+				TotalDeliveries int `json:"totalDeliveries"`
+			} `json:"onTimeDelivery"`
+		} `json:"analytics"`
+	} `json:"data"`
+	Errors []struct {
+		Message string        `json:"message"`
+		Path    []interface{} `json:"path"`
+	} `json:"errors"`
+}
+
+func (suite *GraphQLHandlerTestSuite) TestCarrierQueriesTrips() {
+	var response graphqlTestResponse
+	status := suite.query(suite.carrier.ID, `
+		query Fleet($status: String) {
+			me { id companyName }
+			trips(status: $status) {
+				id status destinationCity
+				carrier { companyName }
+				vehicle { licensePlate }
+				loads { bookingReference shipper { companyName } }
+				currentLocation { latitude }
+				trackingRecords(first: 2) { timestamp }
+				events(first: 1) { description }
+			}
+		}`, map[string]interface{}{"status": "in_transit"}, &response)
+	suite.Equal(200, status)
+	suite.Empty(response.Errors)
+
+	suite.Equal(strconv.Itoa(int(suite.carrier.ID)), response.Data.Me.ID)
+	suite.Equal("Haulage Co", response.Data.Me.CompanyName)
+	suite.Require().Len(response.Data.Trips, 1)
+	trip := response.Data.Trips[0]
+	suite.Equal(strconv.Itoa(int(suite.trip.ID)), trip.ID)
+	suite.Equal("Bulawayo", trip.DestinationCity)
+	suite.Require().NotNil(trip.Carrier)
+	suite.Equal("Haulage Co", trip.Carrier.CompanyName)
+	suite.Require().NotNil(trip.Vehicle)
+	suite.Equal("ABC-1234", trip.Vehicle.LicensePlate)
+	suite.Require().Len(trip.Loads, 2)
+	suite.Equal("GQL-001", trip.Loads[0].BookingReference)
+	suite.Equal("Grain Traders", trip.Loads[0].Shipper.CompanyName)
+	// The latest record is the last one created
+	suite.Require().NotNil(trip.CurrentLocation)
+	suite.InDelta(-18.0, trip.CurrentLocation.Latitude, 0.0001)
+	suite.Len(trip.TrackingRecords, 2)
+	suite.Require().Len(trip.Events, 1)
+	suite.Equal("Milestone 3", trip.Events[0].Description)
+}
+
+func (suite *GraphQLHandlerTestSuite) TestEmptyListsAndMissingRelations() {
+	var response graphqlTestResponse
+	status := suite.query(suite.carrier.ID, `{
+		trips(status: "PLANNED") { id vehicle { licensePlate } loads { bookingReference } currentLocation { latitude } events { description } }
+	}`, nil, &response)
+	suite.Equal(200, status)
+	suite.Empty(response.Errors)
+	suite.Require().Len(response.Data.Trips, 1)
+	suite.Nil(response.Data.Trips[0].Vehicle)
+	suite.Empty(response.Data.Trips[0].Loads)
+	suite.Nil(response.Data.Trips[0].CurrentLocation)
+	suite.Empty(response.Data.Trips[0].Events)
+}
+
+func (suite *GraphQLHandlerTestSuite) TestShipperSeesOnlyTheirLoads() {
+	var response graphqlTestResponse
+	status := suite.query(suite.shipper.ID, `{
+		trips { id loads { bookingReference } }
+		load(id: "`+strconv.Itoa(int(suite.load.ID))+`") { bookingReference trip { originCity } }
+	}`, nil, &response)
+	suite.Equal(200, status)
+	suite.Empty(response.Errors)
+
+	// The trip carrying the shipper's load, without the other shipper's
+	suite.Require().Len(response.Data.Trips, 1)
+	suite.Require().Len(response.Data.Trips[0].Loads, 1)
+	suite.Equal("GQL-001", response.Data.Trips[0].Loads[0].BookingReference)
+	suite.Require().NotNil(response.Data.Load)
+	suite.Require().NotNil(response.Data.Load.Trip)
+	suite.Equal("Harare", response.Data.Load.Trip.OriginCity)
+}
+
+func (suite *GraphQLHandlerTestSuite) TestOutsiderSeesNothing() {
+	var response graphqlTestResponse
+	status := suite.query(suite.outsider.ID, `query ($id: ID!) { trips { id } trip(id: $id) { id } }`,
+		map[string]interface{}{"id": suite.trip.ID}, &response)
+	suite.Equal(200, status)
+	suite.Empty(response.Errors)
+	suite.Empty(response.Data.Trips)
+	suite.Nil(response.Data.Trip)
+}
+
+func (suite *GraphQLHandlerTestSuite) TestAnalytics() {
+	var response graphqlTestResponse
+	status := suite.query(suite.carrier.ID, `{ analytics(from: "2024-01-01") { onTimeDelivery { totalDeliveries } } }`, nil, &response)
+	suite.Equal(200, status)
+	suite.Empty(response.Errors)
+	suite.Equal(0, response.Data.Analytics.OnTimeDelivery.TotalDeliveries)
+
+	response = graphqlTestResponse{}
+	status = suite.query(suite.carrier.ID, `{ analytics(from: "2024-02-01", to: "2024-01-01") { delays { totalDelays } } }`, nil, &response)
+	suite.Equal(200, status)
+	suite.Require().Len(response.Errors, 1)
+	suite.Equal("to must be after from", response.Errors[0].Message)
+	suite.Equal([]interface{}{"analytics"}, response.Errors[0].Path)
+}
+
+func (suite *GraphQLHandlerTestSuite) TestInvalidQueries() {
+	suite.Run("Unknown field", func() {
+		var response graphqlTestResponse
+		status := suite.query(suite.carrier.ID, `{ trips { id password } }`, nil, &response)
+		suite.Equal(400, status)
+		suite.Require().Len(response.Errors, 1)
+		suite.Equal(`Cannot query field "password" on type "Trip".`, response.Errors[0].Message)
+	})
+
+	suite.Run("Contact details aren't exposed", func() {
+		var response graphqlTestResponse
+		status := suite.query(suite.carrier.ID, `{ me { email phone } }`, nil, &response)
+		suite.Equal(400, status)
+		suite.Len(response.Errors, 2)
+	})
+
+	suite.Run("Mutations", func() {
+		var response graphqlTestResponse
+		status := suite.query(suite.carrier.ID, `mutation { trips { id } }`, nil, &response)
+		suite.Equal(400, status)
+		suite.Require().Len(response.Errors, 1)
+	})
+
+	suite.Run("Too deep", func() {
+		var response graphqlTestResponse
+		status := suite.query(suite.carrier.ID, `{ trips { loads { trip { loads { trip { loads { trip { loads { id } } } } } } } } }`, nil, &response)
+		suite.Equal(400, status)
+		suite.Require().NotEmpty(response.Errors)
+		suite.Contains(response.Errors[0].Message, "nested deeper")
+	})
+
+	suite.Run("Unauthenticated", func() {
+		req := httptest.NewRequest("POST", "/graphql", bytes.NewReader([]byte(`{"query":"{ me { id } }"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := suite.app.Test(req, -1)
+		suite.Require().NoError(err)
+		suite.Equal(401, resp.StatusCode)
+	})
+}
+
+func (suite *GraphQLHandlerTestSuite) TestSchema() {
+	req := httptest.NewRequest("GET", "/graphql/schema", nil)
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	suite.Equal(200, resp.StatusCode)
+
+	body, _ := io.ReadAll(resp.Body)
+	suite.Contains(string(body), "type Trip {")
+	suite.Contains(string(body), "  trips(first: Int = 20, offset: Int = 0, status: String): [Trip!]!\n")
+	suite.Contains(string(body), "  currentLocation: TrackingRecord\n")
+	suite.NotContains(string(body), "password")
+}
+
+func TestGraphQLHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(GraphQLHandlerTestSuite))
+}
@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"triplink/backend/database"
+	"triplink/backend/internal/graphql"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"gorm.io/gorm"
+)
+
+// graphqlMaxDepth caps how deeply GraphQL queries can nest fields, so
+// trip { loads { trip { loads ... } } } can't be nested without end
+const graphqlMaxDepth = 8
+
+// graphqlKey is the context key of a GraphQL request's graphqlContext
+type graphqlKey struct{}
+
+// graphqlContext is what the resolvers of one GraphQL request share: who is
+// asking and the loaders batching their lookups
+type graphqlContext struct {
+	userID uint
+	// scope is nil for admins, who see everything
+	scope *services.OrganizationScope
+	// db is the request's session, whose reads of trips and loads only
+	// return those the user sees
+	db      *gorm.DB
+	loaders map[string]*graphql.Loader
+}
+
+func newGraphQLContext(db *gorm.DB, userID uint) *graphqlContext {
+	scope, _ := services.TenantScopeFromContext(db.Statement.Context)
+	return &graphqlContext{
+		userID:  userID,
+		scope:   scope,
+		db:      db,
+		loaders: map[string]*graphql.Loader{},
+	}
+}
+
+func graphqlRequest(ctx context.Context) *graphqlContext {
+	return ctx.Value(graphqlKey{}).(*graphqlContext)
+}
+
+// loader returns the request's loader of a name, creating it with a batch
+// function the first time
+func (g *graphqlContext) loader(name string, batch graphql.BatchFunc) *graphql.Loader {
+	loader, ok := g.loaders[name]
+	if !ok {
+		loader = graphql.NewLoader(batch)
+		g.loaders[name] = loader
+	}
+	return loader
+}
+
+// graphqlSchema is the schema served at /api/graphql
+var graphqlSchema = newGraphQLSchema()
+
+func newGraphQLSchema() *graphql.Schema {
+	user := &graphql.Object{
+		Name:        "User",
+		Description: "A carrier, shipper or driver, without their contact details",
+		Fields: graphql.Fields{
+			"id":          {Type: nonNull(graphql.ID)},
+			"role":        {Type: nonNull(graphql.String)},
+			"firstName":   {Type: nonNull(graphql.String)},
+			"lastName":    {Type: nonNull(graphql.String)},
+			"companyName": {Type: nonNull(graphql.String)},
+			"rating":      {Type: nonNull(graphql.Float)},
+			"isVerified":  {Type: nonNull(graphql.Boolean)},
+		},
+	}
+	vehicle := modelObject("Vehicle", models.Vehicle{})
+	trackingRecord := modelObject("TrackingRecord", models.TrackingRecord{})
+	trackingEvent := modelObject("TrackingEvent", models.TrackingEvent{})
+	trackingStatus := modelObject("TrackingStatus", models.TrackingStatus{})
+	trip := modelObject("Trip", models.Trip{})
+	load := modelObject("Load", models.Load{})
+
+	trip.Fields["carrier"] = &graphql.Field{
+		Type: user,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return loadUser(p.Context, p.Source.(models.Trip).UserID), nil
+		},
+	}
+	trip.Fields["vehicle"] = &graphql.Field{
+		Type: vehicle,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			request := graphqlRequest(p.Context)
+			return request.loader("vehicles", func(ids []uint) (map[uint]interface{}, error) {
+				var vehicles []models.Vehicle
+				if err := database.DB.Where("id IN ?", ids).Find(&vehicles).Error; err != nil {
+					return nil, errors.New("could not fetch vehicles")
+				}
+				byID := map[uint]interface{}{}
+				for _, vehicle := range vehicles {
+					byID[vehicle.ID] = vehicle
+				}
+				return byID, nil
+			}).Load(p.Source.(models.Trip).VehicleID), nil
+		},
+	}
+	trip.Fields["loads"] = &graphql.Field{
+		Type:        nonNullList(load),
+		Description: "The trip's loads the user sees",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			request := graphqlRequest(p.Context)
+			return request.loader("tripLoads", func(tripIDs []uint) (map[uint]interface{}, error) {
+				var loads []models.Load
+				if err := request.db.Where("trip_id IN ?", tripIDs).
+					Order("id ASC").Find(&loads).Error; err != nil {
+					return nil, errors.New("could not fetch loads")
+				}
+				byTrip := map[uint]interface{}{}
+				for _, tripID := range tripIDs {
+					byTrip[tripID] = []models.Load{}
+				}
+				for _, load := range loads {
+					tripLoads, _ := byTrip[load.TripID].([]models.Load)
+					byTrip[load.TripID] = append(tripLoads, load)
+				}
+				return byTrip, nil
+			}).Load(p.Source.(models.Trip).ID), nil
+		},
+	}
+	trip.Fields["trackingRecords"] = &graphql.Field{
+		Type:        nonNullList(trackingRecord),
+		Description: "The trip's latest tracking records, newest first",
+		Args:        map[string]*graphql.Argument{"first": {Type: graphql.Int, DefaultValue: 50}},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			first, err := firstArg(p)
+			if err != nil {
+				return nil, err
+			}
+			return loadLatestRecords(p.Context, p.Source.(models.Trip).ID, first), nil
+		},
+	}
+	trip.Fields["currentLocation"] = &graphql.Field{
+		Type:        trackingRecord,
+		Description: "The trip's latest tracking record",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			records := loadLatestRecords(p.Context, p.Source.(models.Trip).ID, 1)
+			return graphql.Thunk(func() (interface{}, error) {
+				value, err := records()
+				if latest, _ := value.([]models.TrackingRecord); len(latest) > 0 {
+					return latest[0], err
+				}
+				return nil, err
+			}), nil
+		},
+	}
+	trip.Fields["events"] = &graphql.Field{
+		Type:        nonNullList(trackingEvent),
+		Description: "The trip's latest tracking events, newest first",
+		Args:        map[string]*graphql.Argument{"first": {Type: graphql.Int, DefaultValue: 20}},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			first, err := firstArg(p)
+			if err != nil {
+				return nil, err
+			}
+			request := graphqlRequest(p.Context)
+			return request.loader(fmt.Sprintf("events:%d", first), func(tripIDs []uint) (map[uint]interface{}, error) {
+				var events []models.TrackingEvent
+				if err := latestPerTrip("tracking_events", tripIDs, first).Scan(&events).Error; err != nil {
+					return nil, errors.New("could not fetch tracking events")
+				}
+				byTrip := map[uint]interface{}{}
+				for _, tripID := range tripIDs {
+					byTrip[tripID] = []models.TrackingEvent{}
+				}
+				for _, event := range events {
+					tripEvents, _ := byTrip[event.TripID].([]models.TrackingEvent)
+					byTrip[event.TripID] = append(tripEvents, event)
+				}
+				return byTrip, nil
+			}).Load(p.Source.(models.Trip).ID), nil
+		},
+	}
+	trip.Fields["trackingStatus"] = &graphql.Field{
+		Type:        trackingStatus,
+		Description: "The trip's tracking status, ETA and delay",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			request := graphqlRequest(p.Context)
+			return request.loader("trackingStatuses", func(tripIDs []uint) (map[uint]interface{}, error) {
+				var statuses []models.TrackingStatus
+				if err := database.DB.Where("trip_id IN ? AND load_id IS NULL", tripIDs).Find(&statuses).Error; err != nil {
+					return nil, errors.New("could not fetch tracking statuses")
+				}
+				byTrip := map[uint]interface{}{}
+				for _, status := range statuses {
+					byTrip[status.TripID] = status
+				}
+				return byTrip, nil
+			}).Load(p.Source.(models.Trip).ID), nil
+		},
+	}
+
+	load.Fields["shipper"] = &graphql.Field{
+		Type: user,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return loadUser(p.Context, p.Source.(models.Load).ShipperID), nil
+		},
+	}
+	load.Fields["trip"] = &graphql.Field{
+		Type: trip,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return loadTrip(p.Context, p.Source.(models.Load).TripID), nil
+		},
+	}
+
+	listArgs := map[string]*graphql.Argument{
+		"status": {Type: graphql.String},
+		"first":  {Type: graphql.Int, DefaultValue: 20},
+		"offset": {Type: graphql.Int, DefaultValue: 0},
+	}
+	idArgs := map[string]*graphql.Argument{"id": {Type: nonNull(graphql.ID)}}
+
+	root := &graphql.Object{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": {
+				Type: nonNull(user),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadUser(p.Context, graphqlRequest(p.Context).userID), nil
+				},
+			},
+			"trips": {
+				Type:        nonNullList(trip),
+				Description: "The trips the user sees, newest first",
+				Args:        listArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					query, err := listQuery(p)
+					if err != nil {
+						return nil, err
+					}
+					var trips []models.Trip
+					if err := query.Find(&trips).Error; err != nil {
+						return nil, errors.New("could not fetch trips")
+					}
+					return trips, nil
+				},
+			},
+			"trip": {
+				Type: trip,
+				Args: idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadTrip(p.Context, p.Args["id"].(uint)), nil
+				},
+			},
+			"loads": {
+				Type:        nonNullList(load),
+				Description: "The loads the user sees, newest first",
+				Args:        listArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					query, err := listQuery(p)
+					if err != nil {
+						return nil, err
+					}
+					var loads []models.Load
+					if err := query.Find(&loads).Error; err != nil {
+						return nil, errors.New("could not fetch loads")
+					}
+					return loads, nil
+				},
+			},
+			"load": {
+				Type: load,
+				Args: idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var load models.Load
+					err := graphqlRequest(p.Context).db.Where("id = ?", p.Args["id"]).First(&load).Error
+					if errors.Is(err, gorm.ErrRecordNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, errors.New("could not fetch load")
+					}
+					return load, nil
+				},
+			},
+			"analytics": {
+				Type:        nonNull(analyticsObject()),
+				Description: "Analytics of the trips and loads the user sees. Only the metrics selected are computed.",
+				Args: map[string]*graphql.Argument{
+					"from":        {Type: graphql.Time},
+					"to":          {Type: graphql.Time},
+					"vehicleIds":  {Type: &graphql.List{OfType: nonNull(graphql.ID)}},
+					"driverIds":   {Type: &graphql.List{OfType: nonNull(graphql.ID)}},
+					"customerIds": {Type: &graphql.List{OfType: nonNull(graphql.ID)}},
+					"currency":    {Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					filter := services.AnalyticsFilter{
+						VehicleIDs:  idList(p.Args["vehicleIds"]),
+						DriverIDs:   idList(p.Args["driverIds"]),
+						CustomerIDs: idList(p.Args["customerIds"]),
+						Scope:       graphqlRequest(p.Context).scope,
+					}
+					if from, ok := p.Args["from"].(time.Time); ok {
+						filter.From = &from
+					}
+					if to, ok := p.Args["to"].(time.Time); ok {
+						filter.To = &to
+					}
+					if filter.From != nil && filter.To != nil && !filter.To.After(*filter.From) {
+						return nil, errors.New("to must be after from")
+					}
+					if currency, ok := p.Args["currency"].(string); ok {
+						if len(currency) != 3 {
+							return nil, errors.New("invalid currency")
+						}
+						filter.Currency = strings.ToUpper(currency)
+					}
+					return filter, nil
+				},
+			},
+		},
+	}
+
+	return &graphql.Schema{Query: root, MaxDepth: graphqlMaxDepth}
+}
+
+// analyticsObject returns the Analytics type, whose fields each compute one
+// set of metrics for the filter it resolves to
+func analyticsObject() *graphql.Object {
+	metric := func(name string, sample interface{}, list bool, compute func(services.AnalyticsFilter) (interface{}, error)) *graphql.Field {
+		var typ graphql.Type = nonNull(&graphql.Object{Name: name, Fields: graphql.StructFields(sample)})
+		if list {
+			typ = nonNull(&graphql.List{OfType: typ})
+		}
+		return &graphql.Field{
+			Type: typ,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return compute(p.Source.(services.AnalyticsFilter))
+			},
+		}
+	}
+
+	return &graphql.Object{
+		Name: "Analytics",
+		Fields: graphql.Fields{
+			"onTimeDelivery": metric("OnTimeDeliveryMetrics", services.OnTimeDeliveryMetrics{}, false, func(filter services.AnalyticsFilter) (interface{}, error) {
+				return analyticsService.GetOnTimeDeliveryMetrics(filter)
+			}),
+			"delays": metric("DelayMetrics", services.DelayMetrics{}, false, func(filter services.AnalyticsFilter) (interface{}, error) {
+				return analyticsService.GetDelayMetrics(filter)
+			}),
+			"capacity": metric("CapacityMetrics", services.CapacityMetrics{}, false, func(filter services.AnalyticsFilter) (interface{}, error) {
+				return analyticsService.GetCapacityMetrics(filter)
+			}),
+			"loadMatching": metric("LoadMatchingMetrics", services.LoadMatchingMetrics{}, false, func(filter services.AnalyticsFilter) (interface{}, error) {
+				return analyticsService.GetLoadMatchingMetrics(filter)
+			}),
+			"customerSatisfaction": metric("CustomerSatisfactionMetrics", services.CustomerSatisfactionMetrics{}, false, func(filter services.AnalyticsFilter) (interface{}, error) {
+				return analyticsService.GetCustomerSatisfactionMetrics(filter)
+			}),
+			"routes": metric("RoutePerformance", services.DeliveryPerformanceByRoute{}, true, func(filter services.AnalyticsFilter) (interface{}, error) {
+				return analyticsService.GetRoutePerformance(filter)
+			}),
+			"drivers": metric("DriverPerformance", services.DeliveryPerformanceByDriver{}, true, func(filter services.AnalyticsFilter) (interface{}, error) {
+				return analyticsService.GetDriverPerformance(filter)
+			}),
+			"vehicles": metric("VehicleCapacity", services.VehicleCapacityData{}, true, func(filter services.AnalyticsFilter) (interface{}, error) {
+				return analyticsService.GetVehicleCapacity(filter)
+			}),
+		},
+	}
+}
+
+// modelObject returns an object with the scalar fields of a model
+func modelObject(name string, model interface{}) *graphql.Object {
+	fields := graphql.StructFields(model)
+	delete(fields, "deletedAt")
+	return &graphql.Object{Name: name, Fields: fields}
+}
+
+func nonNull(t graphql.Type) graphql.Type {
+	return &graphql.NonNull{OfType: t}
+}
+
+func nonNullList(t graphql.Type) graphql.Type {
+	return nonNull(&graphql.List{OfType: nonNull(t)})
+}
+
+// firstArg returns the first argument of a list field, capped at
+// maxPageLimit
+func firstArg(p graphql.ResolveParams) (int, error) {
+	first := p.Args["first"].(int)
+	if first < 1 {
+		return 0, errors.New("first must be positive")
+	}
+	if first > maxPageLimit {
+		first = maxPageLimit
+	}
+	return first, nil
+}
+
+// listQuery returns a query of a page of the trips or loads the user sees,
+// newest first, with the status asked for
+func listQuery(p graphql.ResolveParams) (*gorm.DB, error) {
+	first, err := firstArg(p)
+	if err != nil {
+		return nil, err
+	}
+	offset := p.Args["offset"].(int)
+	if offset < 0 {
+		return nil, errors.New("offset can't be negative")
+	}
+
+	query := graphqlRequest(p.Context).db.Order("created_at DESC, id DESC").Limit(first).Offset(offset)
+	if status, ok := p.Args["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", strings.ToUpper(status))
+	}
+	return query, nil
+}
+
+// idList converts an ID list argument to IDs
+func idList(arg interface{}) []uint {
+	items, _ := arg.([]interface{})
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.(uint))
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return ids
+}
+
+func loadUser(ctx context.Context, userID uint) graphql.Thunk {
+	return graphqlRequest(ctx).loader("users", func(ids []uint) (map[uint]interface{}, error) {
+		var users []models.User
+		if err := database.DB.Where("id IN ?", ids).Find(&users).Error; err != nil {
+			return nil, errors.New("could not fetch users")
+		}
+		byID := map[uint]interface{}{}
+		for _, user := range users {
+			byID[user.ID] = user
+		}
+		return byID, nil
+	}).Load(userID)
+}
+
+// loadTrip loads a trip the user sees, or nil for others
+func loadTrip(ctx context.Context, tripID uint) graphql.Thunk {
+	request := graphqlRequest(ctx)
+	return request.loader("trips", func(ids []uint) (map[uint]interface{}, error) {
+		var trips []models.Trip
+		if err := request.db.Where("id IN ?", ids).Find(&trips).Error; err != nil {
+			return nil, errors.New("could not fetch trips")
+		}
+		byID := map[uint]interface{}{}
+		for _, trip := range trips {
+			byID[trip.ID] = trip
+		}
+		return byID, nil
+	}).Load(tripID)
+}
+
+// loadLatestRecords loads the latest tracking records of a trip
+func loadLatestRecords(ctx context.Context, tripID uint, limit int) graphql.Thunk {
+	return graphqlRequest(ctx).loader(fmt.Sprintf("records:%d", limit), func(tripIDs []uint) (map[uint]interface{}, error) {
+		// A trip's records are either live or archived
+		var records []models.TrackingRecord
+		for _, table := range []string{"tracking_records", "tracking_records_archive"} {
+			var tableRecords []models.TrackingRecord
+			if err := latestPerTrip(table, tripIDs, limit).Scan(&tableRecords).Error; err != nil {
+				return nil, errors.New("could not fetch tracking records")
+			}
+			records = append(records, tableRecords...)
+		}
+		byTrip := map[uint]interface{}{}
+		for _, tripID := range tripIDs {
+			byTrip[tripID] = []models.TrackingRecord{}
+		}
+		for _, record := range records {
+			tripRecords, _ := byTrip[record.TripID].([]models.TrackingRecord)
+			byTrip[record.TripID] = append(tripRecords, record)
+		}
+		return byTrip, nil
+	}).Load(tripID)
+}
+
+// latestPerTrip selects the latest rows by timestamp of a table for each of
+// several trips, newest first
+func latestPerTrip(table string, tripIDs []uint, limit int) *gorm.DB {
+	return database.DB.Raw(`SELECT * FROM (
+		SELECT *, ROW_NUMBER() OVER (PARTITION BY trip_id ORDER BY timestamp DESC, id DESC) AS trip_rank
+		FROM `+table+` WHERE trip_id IN ?
+	) ranked WHERE trip_rank <= ? ORDER BY trip_id, timestamp DESC, id DESC`, tripIDs, limit)
+}
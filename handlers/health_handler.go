@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var healthService = newHealthService(config.GetHealthConfig())
+
+// newHealthService registers the checks of the API's dependencies
+func newHealthService(cfg *config.HealthConfig) *services.HealthService {
+	service := services.NewHealthService(cfg.CheckTimeout)
+	service.Register(services.DatabaseHealthCheck(func() *gorm.DB { return database.DB }))
+	if cfg.RedisCheckEnabled {
+		service.Register(services.RedisHealthCheck(services.NewRedisService().Client, cfg.RedisRequired))
+	}
+	for _, url := range cfg.ExternalURLs {
+		service.Register(services.HTTPHealthCheck(url))
+	}
+	return service
+}
+
+// healthStatusCode is the response status of a health report, failing the
+// probe only when a critical component is down
+func healthStatusCode(report services.HealthReport) int {
+	if report.Status == services.HealthDown {
+		return fiber.StatusServiceUnavailable
+	}
+	return fiber.StatusOK
+}
+
+// GetHealth @Summary Get health of the API and its dependencies
+// @Description Check the database, Redis and the configured external APIs, each with a timeout. The status is UP, DEGRADED when a non-critical component is down, or DOWN with a 503 when a critical one is.
+// @Tags health
+// @Produce json
+// @Success 200 {object} services.HealthReport
+// @Failure 503 {object} services.HealthReport
+// @Router /healthz [get]
+func GetHealth(c *fiber.Ctx) error {
+	report := healthService.Check(c.UserContext())
+	return c.Status(healthStatusCode(report)).JSON(report)
+}
+
+// GetReadiness @Summary Readiness probe
+// @Description Check the dependencies the API can't serve traffic without. Responds 503 while any of them is down, taking the instance out of load balancing.
+// @Tags health
+// @Produce json
+// @Success 200 {object} services.HealthReport
+// @Failure 503 {object} services.HealthReport
+// @Router /readyz [get]
+func GetReadiness(c *fiber.Ctx) error {
+	report := healthService.CheckReadiness(c.UserContext())
+	return c.Status(healthStatusCode(report)).JSON(report)
+}
+
+// GetLiveness @Summary Liveness probe
+// @Description Respond as long as the process serves requests. Dependencies aren't checked, so their outages don't get the instance restarted.
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /livez [get]
+func GetLiveness(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status":         services.HealthUp,
+		"uptime_seconds": int64(healthService.Uptime().Seconds()),
+	})
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type HealthHandlerTestSuite struct {
+	suite.Suite
+	app      *fiber.App
+	previous *services.HealthService
+	redisErr error
+	apiErr   error
+}
+
+func (suite *HealthHandlerTestSuite) SetupTest() {
+	suite.redisErr = nil
+	suite.apiErr = nil
+
+	suite.previous = healthService
+	healthService = services.NewHealthService(100 * time.Millisecond)
+	healthService.Register(services.DatabaseHealthCheck(func() *gorm.DB { return testDB }))
+	healthService.Register(services.HealthCheck{
+		Name: "redis",
+		Check: func(ctx context.Context) error {
+			return suite.redisErr
+		},
+	})
+	healthService.Register(services.HealthCheck{
+		Name: "external:maps.example.com",
+		Check: func(ctx context.Context) error {
+			return suite.apiErr
+		},
+	})
+
+	suite.app = fiber.New()
+	suite.app.Get("/healthz", GetHealth)
+	suite.app.Get("/readyz", GetReadiness)
+	suite.app.Get("/livez", GetLiveness)
+	suite.app.Get("/monitoring/tracking/health", GetSystemHealthMetrics)
+}
+
+func (suite *HealthHandlerTestSuite) TearDownTest() {
+	healthService = suite.previous
+}
+
+func (suite *HealthHandlerTestSuite) get(path string) (int, services.HealthReport) {
+	resp, err := suite.app.Test(httptest.NewRequest("GET", path, nil), -1)
+	suite.Require().NoError(err)
+	var report services.HealthReport
+	body, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(body, &report)
+	return resp.StatusCode, report
+}
+
+func (suite *HealthHandlerTestSuite) TestHealthy() {
+	t := suite.T()
+	status, report := suite.get("/healthz")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, services.HealthUp, report.Status)
+	suite.Require().Len(report.Components, 3)
+	assert.Equal(t, services.HealthUp, report.Components["database"].Status)
+	assert.True(t, report.Components["database"].Critical)
+
+	// Readiness only checks what the instance can't serve without
+	status, report = suite.get("/readyz")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, []string{"database"}, componentNames(report))
+}
+
+func (suite *HealthHandlerTestSuite) TestOptionalComponentsDegrade() {
+	t := suite.T()
+	suite.redisErr = errors.New("connection refused")
+	suite.apiErr = errors.New("no such host")
+
+	status, report := suite.get("/healthz")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, services.HealthDegraded, report.Status)
+	assert.Equal(t, services.HealthDown, report.Components["redis"].Status)
+	assert.Equal(t, "connection refused", report.Components["redis"].Error)
+	assert.Equal(t, services.HealthDown, report.Components["external:maps.example.com"].Status)
+
+	status, report = suite.get("/readyz")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, services.HealthUp, report.Status)
+}
+
+func (suite *HealthHandlerTestSuite) TestCriticalComponentDown() {
+	t := suite.T()
+	healthService.Register(services.HealthCheck{
+		Name:     "broker",
+		Critical: true,
+		Check: func(ctx context.Context) error {
+			return errors.New("unreachable")
+		},
+	})
+
+	status, report := suite.get("/healthz")
+	assert.Equal(t, 503, status)
+	assert.Equal(t, services.HealthDown, report.Status)
+
+	status, report = suite.get("/readyz")
+	assert.Equal(t, 503, status)
+	assert.Equal(t, services.HealthDown, report.Components["broker"].Status)
+}
+
+func (suite *HealthHandlerTestSuite) TestChecksTimeOut() {
+	t := suite.T()
+	healthService.Register(services.HealthCheck{
+		Name:     "hanging",
+		Critical: true,
+		Check: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		},
+	})
+
+	started := time.Now()
+	status, report := suite.get("/readyz")
+	assert.Less(t, time.Since(started), 500*time.Millisecond)
+	assert.Equal(t, 503, status)
+	assert.Contains(t, report.Components["hanging"].Error, "timed out")
+	assert.Equal(t, services.HealthUp, report.Components["database"].Status)
+}
+
+func (suite *HealthHandlerTestSuite) TestLiveness() {
+	suite.redisErr = errors.New("connection refused")
+	resp, err := suite.app.Test(httptest.NewRequest("GET", "/livez", nil), -1)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 200, resp.StatusCode)
+}
+
+func (suite *HealthHandlerTestSuite) TestSystemHealthMetricsUseDatabaseCheck() {
+	t := suite.T()
+	resp, err := suite.app.Test(httptest.NewRequest("GET", "/monitoring/tracking/health", nil), -1)
+	suite.Require().NoError(err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var body struct {
+		Database map[string]interface{} `json:"database"`
+	}
+	data, _ := io.ReadAll(resp.Body)
+	suite.Require().NoError(json.Unmarshal(data, &body))
+	assert.Equal(t, true, body.Database["connected"])
+	assert.Equal(t, "healthy", body.Database["status"])
+}
+
+func componentNames(report services.HealthReport) []string {
+	var names []string
+	for name := range report.Components {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestHealthHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(HealthHandlerTestSuite))
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var invoiceService = services.NewInvoiceService(database.DB, services.NewFileStorage(storageConfig), config.GetPaymentConfig())
+
+// IssueInvoice @Summary Invoice a delivered load
+// @Description Invoice the shipper of a delivered load for the agreed price and any toll, detention or other surcharges. Only the carrier of the load's trip can invoice it, and a load has one invoice unless it is voided. A payment already made for the load is reconciled with the invoice.
+// @Tags invoices
+// @Accept json
+// @Produce json
+// @Param load_id path int true "Load ID"
+// @Param invoice body services.IssueInvoiceRequest false "Surcharges and terms"
+// @Success 201 {object} models.Invoice
+// @Router /loads/{load_id}/invoices [post]
+func IssueInvoice(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	loadID, err := strconv.ParseUint(c.Params("load_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid load ID",
+		})
+	}
+
+	var req services.IssueInvoiceRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+	}
+
+	invoice, err := invoiceService.IssueInvoice(uint(userID), uint(loadID), req)
+	if err != nil {
+		status := 400
+		switch err {
+		case services.ErrNotLoadCarrier:
+			status = 403
+		case services.ErrInvoiceExists:
+			status = 409
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(invoice)
+}
+
+// GetInvoices @Summary List invoices
+// @Description List the invoices the current user is the shipper or carrier of, newest first
+// @Tags invoices
+// @Produce json
+// @Param status query string false "ISSUED, PAID or VOID"
+// @Param load_id query int false "Only invoices of this load"
+// @Param limit query int false "Number of invoices to return (default 50)"
+// @Param offset query int false "Number of invoices to skip (default 0, ignored with cursor)"
+// @Param cursor query string false "Cursor from next_cursor of the previous page"
+// @Success 200 {object} map[string]interface{}
+// @Router /invoices [get]
+func GetInvoices(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	page, err := parsePageParams(c, 50)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
+	}
+
+	query := invoiceService.UserInvoicesQuery(uint(userID))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if value := c.Query("load_id"); value != "" {
+		loadID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid load ID",
+			})
+		}
+		query = query.Where("load_id = ?", loadID)
+	}
+
+	var total int64
+	query.Session(&gorm.Session{}).Count(&total)
+
+	var invoices []models.Invoice
+	if err := page.paginate(query, "created_at").Preload("LineItems").Find(&invoices).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch invoices",
+		})
+	}
+
+	nextCursor := ""
+	if page.hasMore(len(invoices)) {
+		invoices = invoices[:page.Limit]
+		last := invoices[len(invoices)-1]
+		nextCursor = encodePageCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        invoices,
+		"count":       len(invoices),
+		"total":       total,
+		"limit":       page.Limit,
+		"offset":      page.Offset,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	})
+}
+
+// GetInvoice @Summary Get an invoice
+// @Description Get an invoice and its line items
+// @Tags invoices
+// @Produce json
+// @Param id path int true "Invoice ID"
+// @Success 200 {object} models.Invoice
+// @Router /invoices/{id} [get]
+func GetInvoice(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	invoiceID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid invoice ID",
+		})
+	}
+
+	invoice, err := invoiceService.GetInvoice(uint(userID), uint(invoiceID))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Invoice not found",
+		})
+	}
+
+	return c.JSON(invoice)
+}
+
+// DownloadInvoice @Summary Download an invoice PDF
+// @Description Download the PDF of an invoice
+// @Tags invoices
+// @Produce application/pdf
+// @Param id path int true "Invoice ID"
+// @Success 200 {file} file
+// @Router /invoices/{id}/pdf [get]
+func DownloadInvoice(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	invoiceID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid invoice ID",
+		})
+	}
+
+	data, invoice, err := invoiceService.GetInvoicePDF(uint(userID), uint(invoiceID))
+	if err != nil {
+		status := 500
+		if err == services.ErrInvoiceNotFound {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, invoice.InvoiceNumber))
+	return c.Send(data)
+}
+
+// VoidInvoice @Summary Void an invoice
+// @Description Void an unpaid invoice, for example to reissue it with corrected surcharges. Only the carrier who issued it can void it.
+// @Tags invoices
+// @Accept json
+// @Produce json
+// @Param id path int true "Invoice ID"
+// @Param void body map[string]string false "Void data (reason)"
+// @Success 200 {object} models.Invoice
+// @Router /invoices/{id}/void [post]
+func VoidInvoice(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	invoiceID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid invoice ID",
+		})
+	}
+
+	var voidData struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&voidData); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+	}
+
+	invoice, err := invoiceService.VoidInvoice(uint(userID), uint(invoiceID), voidData.Reason)
+	if err != nil {
+		status := 400
+		switch err {
+		case services.ErrInvoiceNotFound:
+			status = 404
+		case services.ErrNotLoadCarrier:
+			status = 403
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(invoice)
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type InvoiceHandlerTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	shipper models.User
+	carrier models.User
+	load    models.Load
+}
+
+func (suite *InvoiceHandlerTestSuite) SetupTest() {
+	clearTestDB()
+
+	invoiceService = services.NewInvoiceService(testDB, services.NewLocalFileStorage(suite.T().TempDir(), "/uploads"), &config.PaymentConfig{
+		PlatformFeePercent: 5,
+		InvoiceDueDays:     30,
+	})
+
+	suite.shipper = models.User{Email: "shipper@example.com", Phone: "+15550000001", Password: "password", Role: "SHIPPER", FirstName: "Sam", LastName: "Shipper"}
+	testDB.Create(&suite.shipper)
+	suite.carrier = models.User{Email: "carrier@example.com", Phone: "+15550000002", Password: "password", Role: "CARRIER", CompanyName: "Road Haulage"}
+	testDB.Create(&suite.carrier)
+
+	trip := models.Trip{
+		UserID:             suite.carrier.ID,
+		OriginAddress:      "Harare",
+		DestinationAddress: "Bulawayo",
+		Status:             "COMPLETED",
+		DepartureDate:      time.Now().Add(-48 * time.Hour),
+		EstimatedArrival:   time.Now().Add(-24 * time.Hour),
+	}
+	testDB.Create(&trip)
+	suite.load = models.Load{
+		ShipperID:             suite.shipper.ID,
+		TripID:                trip.ID,
+		BookingReference:      "INV-LOAD-001",
+		Status:                "DELIVERED",
+		AgreedPrice:           1000,
+		Currency:              "USD",
+		RequestedPickupDate:   time.Now().Add(-48 * time.Hour),
+		RequestedDeliveryDate: time.Now().Add(-24 * time.Hour),
+	}
+	testDB.Create(&suite.load)
+
+	suite.app = fiber.New()
+
+	suite.app.Use(asHeaderUser())
+	suite.app.Post("/loads/:load_id/invoices", IssueInvoice)
+	suite.app.Get("/invoices", GetInvoices)
+	suite.app.Get("/invoices/:id", GetInvoice)
+	suite.app.Get("/invoices/:id/pdf", DownloadInvoice)
+	suite.app.Post("/invoices/:id/void", VoidInvoice)
+}
+
+func (suite *InvoiceHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *InvoiceHandlerTestSuite) request(method, url string, userID uint, body interface{}) (int, []byte) {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var respBody bytes.Buffer
+	respBody.ReadFrom(resp.Body)
+	return resp.StatusCode, respBody.Bytes()
+}
+
+func (suite *InvoiceHandlerTestSuite) issue(userID uint, req services.IssueInvoiceRequest) (int, models.Invoice) {
+	status, body := suite.request("POST", fmt.Sprintf("/loads/%d/invoices", suite.load.ID), userID, req)
+
+	var invoice models.Invoice
+	if status == 201 {
+		suite.Require().NoError(json.Unmarshal(body, &invoice))
+	}
+	return status, invoice
+}
+
+func (suite *InvoiceHandlerTestSuite) TestIssueInvoiceWithSurcharges() {
+	t := suite.T()
+
+	status, invoice := suite.issue(suite.carrier.ID, services.IssueInvoiceRequest{
+		Surcharges: []services.InvoiceSurcharge{
+			{Type: "toll", Description: "Beitbridge toll", Amount: 45.5},
+			{Type: "DETENTION", Amount: 120},
+		},
+		DueDays: 14,
+	})
+	assert.Equal(t, 201, status)
+	assert.Equal(t, services.InvoiceStatusIssued, invoice.Status)
+	assert.Equal(t, suite.shipper.ID, invoice.ShipperID)
+	assert.Equal(t, suite.carrier.ID, invoice.CarrierID)
+	assert.Equal(t, 1000.0, invoice.Subtotal)
+	assert.Equal(t, 165.5, invoice.SurchargeTotal)
+	assert.Equal(t, 1165.5, invoice.Total)
+	assert.InDelta(t, 58.28, invoice.PlatformFee, 0.001)
+	assert.Equal(t, "USD", invoice.Currency)
+	assert.WithinDuration(t, invoice.IssuedAt.AddDate(0, 0, 14), invoice.DueDate, time.Second)
+	assert.Len(t, invoice.LineItems, 3)
+	assert.Equal(t, services.InvoiceItemFreight, invoice.LineItems[0].Type)
+	assert.Equal(t, "Detention", invoice.LineItems[2].Description)
+
+	// The load already has an open invoice
+	status, _ = suite.issue(suite.carrier.ID, services.IssueInvoiceRequest{})
+	assert.Equal(t, 409, status)
+}
+
+func (suite *InvoiceHandlerTestSuite) TestIssueInvoiceWithDetentionCharges() {
+	t := suite.T()
+
+	testDB.Create(&models.TripStop{
+		TripID:           suite.load.TripID,
+		LoadID:           &suite.load.ID,
+		Sequence:         3,
+		StopType:         "DELIVERY",
+		Status:           "COMPLETED",
+		DwellMinutes:     210,
+		DetentionMinutes: 90,
+		DetentionCharge:  75,
+	})
+
+	status, invoice := suite.issue(suite.carrier.ID, services.IssueInvoiceRequest{})
+	assert.Equal(t, 201, status)
+	assert.Equal(t, 1075.0, invoice.Total)
+	if assert.Len(t, invoice.LineItems, 2) {
+		assert.Equal(t, services.InvoiceItemDetention, invoice.LineItems[1].Type)
+		assert.Equal(t, "Detention at delivery, 1h 30m", invoice.LineItems[1].Description)
+	}
+
+	// Detention itemized by the carrier replaces the automatic charges
+	suite.request("POST", fmt.Sprintf("/invoices/%d/void", invoice.ID), suite.carrier.ID, nil)
+	status, invoice = suite.issue(suite.carrier.ID, services.IssueInvoiceRequest{
+		Surcharges: []services.InvoiceSurcharge{{Type: "DETENTION", Amount: 100}},
+	})
+	assert.Equal(t, 201, status)
+	assert.Equal(t, 1100.0, invoice.Total)
+	assert.Len(t, invoice.LineItems, 2)
+}
+
+func (suite *InvoiceHandlerTestSuite) TestIssueInvoiceRules() {
+	t := suite.T()
+
+	// Only the carrier can invoice the load
+	status, _ := suite.issue(suite.shipper.ID, services.IssueInvoiceRequest{})
+	assert.Equal(t, 403, status)
+
+	status, _ = suite.issue(suite.carrier.ID, services.IssueInvoiceRequest{
+		Surcharges: []services.InvoiceSurcharge{{Type: "FUEL", Amount: 10}},
+	})
+	assert.Equal(t, 400, status)
+
+	status, _ = suite.issue(suite.carrier.ID, services.IssueInvoiceRequest{
+		Surcharges: []services.InvoiceSurcharge{{Type: "TOLL", Amount: -10}},
+	})
+	assert.Equal(t, 400, status)
+
+	// Loads aren't invoiced until they are delivered
+	testDB.Model(&suite.load).Update("status", "IN_TRANSIT")
+	status, _ = suite.issue(suite.carrier.ID, services.IssueInvoiceRequest{})
+	assert.Equal(t, 400, status)
+}
+
+func (suite *InvoiceHandlerTestSuite) TestIssueInvoiceReconcilesPayment() {
+	t := suite.T()
+
+	processedAt := time.Now().Add(-time.Hour)
+	transaction := models.Transaction{
+		LoadID:      suite.load.ID,
+		PayerID:     suite.shipper.ID,
+		PayeeID:     suite.carrier.ID,
+		Amount:      1000,
+		Currency:    "USD",
+		Status:      "COMPLETED",
+		ProcessedAt: &processedAt,
+	}
+	testDB.Create(&transaction)
+
+	status, invoice := suite.issue(suite.carrier.ID, services.IssueInvoiceRequest{})
+	assert.Equal(t, 201, status)
+	assert.Equal(t, services.InvoiceStatusPaid, invoice.Status)
+	assert.Equal(t, 1000.0, invoice.AmountPaid)
+	if assert.NotNil(t, invoice.TransactionID) {
+		assert.Equal(t, transaction.ID, *invoice.TransactionID)
+	}
+	assert.NotNil(t, invoice.PaidAt)
+
+	// Paid invoices are refunded rather than voided
+	status, _ = suite.request("POST", fmt.Sprintf("/invoices/%d/void", invoice.ID), suite.carrier.ID, nil)
+	assert.Equal(t, 400, status)
+}
+
+func (suite *InvoiceHandlerTestSuite) TestVoidAndReissueInvoice() {
+	t := suite.T()
+
+	_, invoice := suite.issue(suite.carrier.ID, services.IssueInvoiceRequest{})
+
+	// Shippers can't void invoices
+	status, _ := suite.request("POST", fmt.Sprintf("/invoices/%d/void", invoice.ID), suite.shipper.ID, nil)
+	assert.Equal(t, 403, status)
+
+	status, body := suite.request("POST", fmt.Sprintf("/invoices/%d/void", invoice.ID), suite.carrier.ID, fiber.Map{"reason": "missing toll"})
+	assert.Equal(t, 200, status)
+	var voided models.Invoice
+	json.Unmarshal(body, &voided)
+	assert.Equal(t, services.InvoiceStatusVoid, voided.Status)
+	assert.Equal(t, "missing toll", voided.VoidReason)
+	assert.NotNil(t, voided.VoidedAt)
+
+	status, reissued := suite.issue(suite.carrier.ID, services.IssueInvoiceRequest{
+		Surcharges: []services.InvoiceSurcharge{{Type: "TOLL", Amount: 45.5}},
+	})
+	assert.Equal(t, 201, status)
+	assert.NotEqual(t, invoice.InvoiceNumber, reissued.InvoiceNumber)
+	assert.Equal(t, 1045.5, reissued.Total)
+}
+
+func (suite *InvoiceHandlerTestSuite) TestListAndDownloadInvoices() {
+	t := suite.T()
+
+	_, invoice := suite.issue(suite.carrier.ID, services.IssueInvoiceRequest{})
+
+	for _, userID := range []uint{suite.shipper.ID, suite.carrier.ID} {
+		status, body := suite.request("GET", "/invoices?status=ISSUED", userID, nil)
+		assert.Equal(t, 200, status)
+		var response struct {
+			Data  []models.Invoice `json:"data"`
+			Total int64            `json:"total"`
+		}
+		json.Unmarshal(body, &response)
+		assert.Equal(t, int64(1), response.Total)
+		if assert.Len(t, response.Data, 1) {
+			assert.Len(t, response.Data[0].LineItems, 1)
+		}
+	}
+
+	status, body := suite.request("GET", "/invoices?status=PAID", suite.shipper.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.Contains(t, string(body), `"total":0`)
+
+	// Other users can't see the invoice
+	status, _ = suite.request("GET", fmt.Sprintf("/invoices/%d", invoice.ID), suite.carrier.ID+100, nil)
+	assert.Equal(t, 404, status)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/invoices/%d/pdf", invoice.ID), nil)
+	req.Header.Set("X-User-ID", strconv.Itoa(int(suite.shipper.ID)))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "application/pdf", resp.Header.Get("Content-Type"))
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), invoice.InvoiceNumber+".pdf")
+	var pdf bytes.Buffer
+	pdf.ReadFrom(resp.Body)
+	assert.True(t, bytes.HasPrefix(pdf.Bytes(), []byte("%PDF")))
+}
+
+func TestInvoiceHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(InvoiceHandlerTestSuite))
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/avro"
+	"triplink/backend/internal/kafka"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeKafkaProducer records the messages produced to it
+type fakeKafkaProducer struct {
+	mu       sync.Mutex
+	topics   []string
+	messages []kafka.Message
+	err      error
+}
+
+func (p *fakeKafkaProducer) Produce(ctx context.Context, topic string, messages ...kafka.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	for _, message := range messages {
+		p.topics = append(p.topics, topic)
+		p.messages = append(p.messages, message)
+	}
+	return nil
+}
+
+type KafkaPublisherTestSuite struct {
+	suite.Suite
+	app      *fiber.App
+	trip     models.Trip
+	load     models.Load
+	cfg      *config.KafkaConfig
+	producer *fakeKafkaProducer
+}
+
+func (suite *KafkaPublisherTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+	trackingService = services.NewTrackingService(testDB)
+	// Statuses are only changed by the requests of the tests
+	trackingService.SetAutoStatusConfig(&config.AutoStatusConfig{})
+	services.SetLocationOutboxEnabled(true)
+
+	suite.trip = models.Trip{}
+	testDB.First(&suite.trip)
+	suite.load = models.Load{}
+	testDB.Where("trip_id = ?", suite.trip.ID).First(&suite.load)
+
+	suite.cfg = &config.KafkaConfig{
+		Format:          "json",
+		LocationTopic:   "triplink.location.updated",
+		TripStatusTopic: "triplink.trip.status.changed",
+		LoadTopic:       "triplink.load.delivered",
+	}
+	suite.producer = &fakeKafkaProducer{}
+
+	suite.app = fiber.New()
+	suite.app.Put("/trips/:trip_id/tracking/status", UpdateTripStatus)
+	suite.app.Put("/loads/:load_id/status", UpdateLoadStatus)
+}
+
+func (suite *KafkaPublisherTestSuite) TearDownTest() {
+	services.SetLocationOutboxEnabled(false)
+	clearTestDB()
+}
+
+func (suite *KafkaPublisherTestSuite) put(url, status string) {
+	body, _ := json.Marshal(map[string]string{"status": status})
+	req := httptest.NewRequest("PUT", url, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+}
+
+func (suite *KafkaPublisherTestSuite) dispatcher() *services.OutboxDispatcher {
+	outboxConfig := &config.OutboxConfig{BatchSize: 100, MaxAttempts: 3, RetryBackoff: time.Minute, ClaimTimeout: time.Minute}
+	return services.NewOutboxDispatcher(testDB, outboxConfig, services.StreamPublisher{}, services.NewKafkaPublisher(suite.cfg, suite.producer))
+}
+
+func (suite *KafkaPublisherTestSuite) updateLocation() {
+	speed := 62.5
+	suite.Require().NoError(trackingService.UpdateLocation(suite.trip.ID, services.LocationUpdate{
+		Latitude:  -17.8252,
+		Longitude: 31.0335,
+		Speed:     &speed,
+		Source:    "GPS",
+	}))
+}
+
+func header(message kafka.Message, key string) string {
+	for _, h := range message.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (suite *KafkaPublisherTestSuite) TestPublishesEventsToTopics() {
+	t := suite.T()
+	suite.updateLocation()
+	suite.put("/trips/"+strconv.Itoa(int(suite.trip.ID))+"/tracking/status", "ACTIVE")
+	suite.put("/loads/"+strconv.Itoa(int(suite.load.ID))+"/status", "PICKED_UP")
+	suite.put("/loads/"+strconv.Itoa(int(suite.load.ID))+"/status", "DELIVERED")
+	assert.NoError(t, suite.dispatcher().DispatchPending())
+
+	// Pick-ups are not published
+	assert.Equal(t, []string{"triplink.location.updated", "triplink.trip.status.changed", "triplink.load.delivered"}, suite.producer.topics)
+
+	tripKey := strconv.Itoa(int(suite.trip.ID))
+	var events []services.KafkaEvent
+	for _, message := range suite.producer.messages {
+		assert.Equal(t, tripKey, string(message.Key))
+		assert.Equal(t, "application/json", header(message, "content_type"))
+		assert.Equal(t, "1", header(message, "schema_version"))
+
+		var event services.KafkaEvent
+		suite.Require().NoError(json.Unmarshal(message.Value, &event))
+		assert.Equal(t, event.EventType, header(message, "event_type"))
+		assert.Equal(t, strconv.Itoa(int(event.EventID)), header(message, "event_id"))
+		events = append(events, event)
+	}
+
+	suite.Require().NotNil(events[0].Location)
+	assert.Equal(t, services.KafkaLocationUpdated, events[0].EventType)
+	assert.Equal(t, -17.8252, events[0].Location.Latitude)
+	assert.Equal(t, 62.5, *events[0].Location.Speed)
+	assert.NotZero(t, events[0].Location.RecordID)
+
+	assert.Equal(t, services.KafkaTripStatusChanged, events[1].EventType)
+	assert.Equal(t, &services.KafkaStatusChange{From: "PLANNED", To: "ACTIVE"}, events[1].Status)
+
+	assert.Equal(t, services.KafkaLoadDelivered, events[2].EventType)
+	assert.Equal(t, suite.load.ID, *events[2].LoadID)
+	assert.Equal(t, "DELIVERED", events[2].Status.To)
+
+	var outbox []models.OutboxEvent
+	testDB.Order("id").Find(&outbox)
+	suite.Require().Len(outbox, 4)
+	assert.Equal(t, services.LocationUpdateEvent, outbox[0].EventType)
+	// Location updates are streamed as they are recorded already
+	assert.Equal(t, "kafka", outbox[0].Delivered)
+	for _, event := range outbox {
+		assert.NotNil(t, event.PublishedAt)
+	}
+}
+
+func (suite *KafkaPublisherTestSuite) TestLocationUpdatesAreOptional() {
+	services.SetLocationOutboxEnabled(false)
+	suite.updateLocation()
+
+	var count int64
+	testDB.Model(&models.OutboxEvent{}).Count(&count)
+	assert.Zero(suite.T(), count)
+}
+
+func (suite *KafkaPublisherTestSuite) TestRetriesFailedProduces() {
+	t := suite.T()
+	suite.producer.err = errors.New("kafka: broker unavailable")
+	suite.put("/trips/"+strconv.Itoa(int(suite.trip.ID))+"/tracking/status", "ACTIVE")
+	assert.Error(t, suite.dispatcher().DispatchPending())
+
+	var event models.OutboxEvent
+	testDB.First(&event)
+	assert.Nil(t, event.PublishedAt)
+	assert.Equal(t, "stream", event.Delivered)
+	assert.Contains(t, event.LastError, "broker unavailable")
+
+	suite.producer.err = nil
+	testDB.Model(&event).Update("next_attempt_at", time.Now().Add(-time.Second))
+	assert.NoError(t, suite.dispatcher().DispatchPending())
+	assert.Equal(t, []string{"triplink.trip.status.changed"}, suite.producer.topics)
+}
+
+func (suite *KafkaPublisherTestSuite) TestPublishesAvro() {
+	t := suite.T()
+	suite.cfg.Format = "avro"
+	suite.put("/trips/"+strconv.Itoa(int(suite.trip.ID))+"/tracking/status", "ACTIVE")
+	assert.NoError(t, suite.dispatcher().DispatchPending())
+
+	suite.Require().Len(suite.producer.messages, 1)
+	message := suite.producer.messages[0]
+	assert.Equal(t, "avro/binary", header(message, "content_type"))
+
+	value := message.Value
+	suite.Require().Greater(len(value), 10)
+	assert.Equal(t, []byte{0xC3, 0x01}, value[:2])
+	assert.Equal(t, avro.Fingerprint(services.KafkaEventAvroSchema), binary.LittleEndian.Uint64(value[2:10]))
+
+	// The body starts with the schema version and ends with the status
+	assert.Equal(t, byte(0x02), value[10])
+	assert.True(t, bytes.HasSuffix(value, []byte("\x02\x0ePLANNED\x0cACTIVE")))
+}
+
+func TestKafkaPublisherTestSuite(t *testing.T) {
+	suite.Run(t, new(KafkaPublisherTestSuite))
+}
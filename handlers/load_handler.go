@@ -1,36 +1,210 @@
 package handlers
 
 import (
+	"log"
+	"strconv"
+
 	"github.com/gofiber/fiber/v2"
 	"triplink/backend/database"
 	"triplink/backend/models"
+	"triplink/backend/services"
 )
 
+// CreateLoad @Summary Create a load
+// @Description Create a load for the current shipper, in the shipper organization they book for. Loads created on a trip reserve its capacity. Pickup and delivery can be given as saved locations with pickup_location_id and delivery_location_id.
+// @Tags loads
+// @Accept json
+// @Produce json
+// @Param load body models.Load true "Load"
+// @Success 200 {object} models.Load
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /loads [post]
 func CreateLoad(c *fiber.Ctx) error {
 	var load models.Load
+	if err := decodeBody(c, &load); err != nil {
+		return invalidRequest(c, err)
+	}
 
-	if err := c.BodyParser(&load); err != nil {
-		return err
+	// Addresses from the shipper's address book. Coordinates of 0 are on the
+	// equator or prime meridian, not missing.
+	var locations struct {
+		PickupLat          *float64 `json:"pickup_lat" validate:"omitempty,latitude"`
+		PickupLng          *float64 `json:"pickup_lng" validate:"omitempty,longitude"`
+		DeliveryLat        *float64 `json:"delivery_lat" validate:"omitempty,latitude"`
+		DeliveryLng        *float64 `json:"delivery_lng" validate:"omitempty,longitude"`
+		PickupLocationID   uint     `json:"pickup_location_id"`
+		DeliveryLocationID uint     `json:"delivery_location_id"`
+	}
+	if err := parseBody(c, &locations); err != nil {
+		return invalidRequest(c, err)
+	}
+	userID, _ := c.Locals("user_id").(float64)
+	if err := savedLocationService.ApplyToLoad(uint(userID), &load, locations.PickupLocationID, locations.DeliveryLocationID); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	// Loads belong to the shipper organization the user books for
+	organizationID, err := organizationService.ResolveOrganization(uint(userID), services.OrganizationShipper, load.OrganizationID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	load.OrganizationID = organizationID
+	// Addresses given without coordinates are geocoded so the load can be
+	// matched to trips; a load that can't be geocoded is still created
+	if err := services.GeocodeLoad(addressGeocoder, &load); err != nil {
+		log.Printf("Failed to geocode load %s: %v", load.BookingReference, err)
 	}
 
-	database.DB.Create(&load)
+	// Loads created on a trip reserve its capacity
+	capacityService := services.NewTripCapacityService(database.DB)
+	if err := capacityService.CreateLoad(&load); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 
 	return c.JSON(load)
 }
 
+// GetLoads @Summary Get loads
+// @Description Get the loads the current user can see: their own and their organizations', and those on trips they carry or drive
+// @Tags loads
+// @Produce json
+// @Success 200 {array} models.Load
+// @Router /loads [get]
 func GetLoads(c *fiber.Ctx) error {
-	var loads []models.Load
+	db, ok := tenantDB(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
 
-	database.DB.Find(&loads)
+	var loads []models.Load
+	if err := db.Find(&loads).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch loads",
+		})
+	}
 
 	return c.JSON(loads)
 }
 
+// GetLoad @Summary Get a load
+// @Description Get a load the current user can see. Other organizations' loads are not found.
+// @Tags loads
+// @Produce json
+// @Param id path int true "Load ID"
+// @Success 200 {object} models.Load
+// @Router /loads/{id} [get]
 func GetLoad(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var load models.Load
+	db, ok := tenantDB(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
 
-	database.DB.First(&load, id)
+	var load models.Load
+	if err := db.First(&load, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Load not found",
+		})
+	}
 
 	return c.JSON(load)
 }
+
+// LoadBookingRequest is the trip to book a load on
+type LoadBookingRequest struct {
+	TripID uint `json:"trip_id" validate:"required"`
+}
+
+// BookLoadOnTrip @Summary Book a load onto a trip
+// @Description Assign an unassigned load to a trip, atomically reserving the trip's remaining weight and volume capacity
+// @Tags loads
+// @Accept json
+// @Produce json
+// @Param load_id path int true "Load ID"
+// @Param booking body LoadBookingRequest true "Booking data"
+// @Success 200 {object} models.Load
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /loads/{load_id}/book [post]
+func BookLoadOnTrip(c *fiber.Ctx) error {
+	loadID, err := strconv.ParseUint(c.Params("load_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid load ID",
+		})
+	}
+
+	var bookingData LoadBookingRequest
+	if err := parseBody(c, &bookingData); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	// Verify load exists
+	var load models.Load
+	if err := database.DB.First(&load, uint(loadID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Load not found",
+		})
+	}
+
+	capacityService := services.NewTripCapacityService(database.DB)
+	booked, err := capacityService.BookLoad(uint(loadID), bookingData.TripID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Add the pickup and delivery to the trip itinerary
+	if _, err := trackingService.GenerateTripStops(bookingData.TripID); err != nil {
+		log.Printf("Failed to update stops of trip %d: %v", bookingData.TripID, err)
+	}
+
+	return c.JSON(booked)
+}
+
+// CancelLoadBooking @Summary Cancel a load booking
+// @Description Remove a booked load from its trip and release the reserved trip capacity
+// @Tags loads
+// @Produce json
+// @Param load_id path int true "Load ID"
+// @Success 200 {object} models.Load
+// @Router /loads/{load_id}/book [delete]
+func CancelLoadBooking(c *fiber.Ctx) error {
+	loadID, err := strconv.ParseUint(c.Params("load_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid load ID",
+		})
+	}
+
+	// Verify load exists
+	var load models.Load
+	if err := database.DB.First(&load, uint(loadID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Load not found",
+		})
+	}
+
+	capacityService := services.NewTripCapacityService(database.DB)
+	cancelled, err := capacityService.CancelBooking(uint(loadID))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Remove the pickup and delivery from the trip itinerary
+	if _, err := trackingService.GenerateTripStops(load.TripID); err != nil {
+		log.Printf("Failed to update stops of trip %d: %v", load.TripID, err)
+	}
+
+	return c.JSON(cancelled)
+}
@@ -3,9 +3,11 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http/httptest"
 	"testing"
 	"triplink/backend/models"
+	"triplink/backend/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
@@ -18,6 +20,8 @@ type LoadHandlerTestSuite struct {
 }
 
 func (suite *LoadHandlerTestSuite) SetupSuite() {
+	organizationService = services.NewOrganizationService(testDB)
+	registerTenantScope(suite.T())
 }
 
 func (suite *LoadHandlerTestSuite) SetupTest() {
@@ -26,8 +30,10 @@ func (suite *LoadHandlerTestSuite) SetupTest() {
 	suite.app = fiber.New()
 
 	suite.app.Post("/loads", CreateLoad)
-	suite.app.Get("/loads", GetLoads)
-	suite.app.Get("/loads/:id", GetLoad)
+	suite.app.Get("/loads", asSeededUser(), GetLoads)
+	suite.app.Get("/loads/:id", asSeededUser(), GetLoad)
+	suite.app.Post("/loads/:load_id/book", BookLoadOnTrip)
+	suite.app.Delete("/loads/:load_id/book", CancelLoadBooking)
 }
 
 func (suite *LoadHandlerTestSuite) TearDownTest() {
@@ -63,13 +69,63 @@ func (suite *LoadHandlerTestSuite) TestGetLoads() {
 func (suite *LoadHandlerTestSuite) TestGetLoad() {
 	t := suite.T()
 
-	req := httptest.NewRequest("GET", "/loads/1", nil)
+	var load models.Load
+	testDB.First(&load)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/loads/%d", load.ID), nil)
 	resp, err := suite.app.Test(req)
 
 	assert.NoError(t, err)
 	assert.Equal(t, 200, resp.StatusCode)
 }
 
+func (suite *LoadHandlerTestSuite) TestBookLoadOnTrip() {
+	t := suite.T()
+
+	trip := models.Trip{
+		TotalCapacityWeight: 1000,
+		TotalCapacityVolume: 10,
+		Status:              "PLANNED",
+	}
+	testDB.Create(&trip)
+
+	first := models.Load{BookingReference: "CAPACITY-LOAD-1", Weight: 600, Volume: 4, Status: "QUOTE_REQUESTED"}
+	second := models.Load{BookingReference: "CAPACITY-LOAD-2", Weight: 600, Volume: 4, Status: "QUOTE_REQUESTED"}
+	testDB.Create(&first)
+	testDB.Create(&second)
+
+	tests := []struct {
+		name           string
+		method         string
+		loadID         uint
+		body           string
+		expectedStatus int
+	}{
+		{"Book first load", "POST", first.ID, fmt.Sprintf(`{"trip_id":%d}`, trip.ID), 200},
+		{"Second load exceeds capacity", "POST", second.ID, fmt.Sprintf(`{"trip_id":%d}`, trip.ID), 400},
+		{"Load already assigned", "POST", first.ID, fmt.Sprintf(`{"trip_id":%d}`, trip.ID), 400},
+		{"Missing trip ID", "POST", second.ID, `{}`, 422},
+		{"Load not found", "POST", 999999, fmt.Sprintf(`{"trip_id":%d}`, trip.ID), 404},
+		{"Cancel first booking", "DELETE", first.ID, "", 200},
+		{"Second load fits after cancellation", "POST", second.ID, fmt.Sprintf(`{"trip_id":%d}`, trip.ID), 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, fmt.Sprintf("/loads/%d/book", tt.loadID), bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := suite.app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+
+	testDB.First(&trip, trip.ID)
+	assert.Equal(t, 600.0, trip.UsedWeight)
+	assert.Equal(t, 4.0, trip.UsedVolume)
+}
+
 func TestLoadHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(LoadHandlerTestSuite))
 }
\ No newline at end of file
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"io"
+	"strconv"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var loadImportService = services.NewLoadImportService(database.DB, addressGeocoder)
+
+// ImportLoads @Summary Import loads from a file
+// @Description Create loads in bulk from a CSV or XLSX file with a header row. Required columns are weight, pickup_address, delivery_address, pickup_date and delivery_date. Addresses without coordinates are geocoded. Loads are only created when every row is valid; otherwise the report lists the errors of each row.
+// @Tags loads
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "CSV or XLSX file"
+// @Param dry_run query bool false "Validate the file without creating loads"
+// @Success 201 {object} services.LoadImportReport
+// @Success 200 {object} services.LoadImportReport "Dry run"
+// @Failure 422 {object} services.LoadImportReport "Invalid rows"
+// @Router /loads/import [post]
+func ImportLoads(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	dryRun := false
+	if value := c.Query("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid dry_run value",
+			})
+		}
+		dryRun = parsed
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "A file is required",
+		})
+	}
+	if fileHeader.Size > storageConfig.MaxUploadSize {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "File is too large",
+		})
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot read file",
+		})
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, storageConfig.MaxUploadSize+1))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot read file",
+		})
+	}
+
+	report, err := loadImportService.ImportLoads(uint(userID), fileHeader.Filename, data, dryRun)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	switch {
+	case report.InvalidRows > 0:
+		return c.Status(422).JSON(report)
+	case report.Created > 0:
+		return c.Status(201).JSON(report)
+	}
+	return c.JSON(report)
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeGeocoder geocodes the addresses it knows
+type fakeGeocoder struct {
+	mu     sync.Mutex
+	places map[string]services.Coordinate
+	calls  int
+}
+
+func (g *fakeGeocoder) GeocodeAddress(address string) (*services.GeocodeResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls++
+	for prefix, location := range g.places {
+		if strings.HasPrefix(address, prefix) {
+			result := &services.GeocodeResult{Address: address}
+			result.Geometry.Location = location
+			result.AddressComponents = append(result.AddressComponents, services.AddressComponent{
+				LongName: "Zimbabwe", ShortName: "ZW", Types: []string{"country", "political"},
+			})
+			return result, nil
+		}
+	}
+	return nil, errors.New("no results found for address")
+}
+
+type LoadImportHandlerTestSuite struct {
+	suite.Suite
+	app      *fiber.App
+	shipper  models.User
+	geocoder *fakeGeocoder
+}
+
+func (suite *LoadImportHandlerTestSuite) SetupTest() {
+	clearTestDB()
+
+	suite.geocoder = &fakeGeocoder{places: map[string]services.Coordinate{
+		"1 Harare Rd":   {Latitude: -17.83, Longitude: 31.05},
+		"2 Bulawayo St": {Latitude: -20.15, Longitude: 28.58},
+	}}
+	loadImportService = services.NewLoadImportService(testDB, suite.geocoder)
+
+	suite.shipper = models.User{Email: "shipper@example.com", Phone: "+15550000001", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&suite.shipper)
+
+	suite.app = fiber.New()
+	suite.app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", float64(suite.shipper.ID))
+		return c.Next()
+	})
+	suite.app.Post("/loads/import", ImportLoads)
+}
+
+func (suite *LoadImportHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *LoadImportHandlerTestSuite) upload(path, fileName string, data []byte) (int, services.LoadImportReport) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", fileName)
+	part.Write(data)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", path, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var report services.LoadImportReport
+	json.NewDecoder(resp.Body).Decode(&report)
+	return resp.StatusCode, report
+}
+
+func (suite *LoadImportHandlerTestSuite) TestImportCSV() {
+	csv := "Booking Reference,Description,Weight,Pickup Address,Pickup City,Delivery Address,Delivery Lat,Delivery Lng,Pickup Date,Delivery Date,Fragile,Notes\n" +
+		"PO-1001,Tiles,1200,1 Harare Rd,Harare,2 Bulawayo St,-20.15,28.58,2024-03-01,2024-03-02,yes,x\n" +
+		",,,,,,,,,,,\n" +
+		",Cement,800.5,1 Harare Rd,Harare,2 Bulawayo St,,,2024-03-01 08:00,2024-03-03,,\n"
+
+	status, report := suite.upload("/loads/import", "loads.csv", []byte(csv))
+	suite.Equal(201, status)
+	suite.Equal(2, report.TotalRows)
+	suite.Equal(2, report.Created)
+	suite.Equal([]string{"Notes"}, report.UnknownColumns)
+	suite.Require().Len(report.Rows, 2)
+	suite.Equal(2, report.Rows[0].Row)
+	suite.Equal(4, report.Rows[1].Row, "blank rows keep the numbering of the file")
+	suite.Equal("PO-1001", report.Rows[0].BookingReference)
+	suite.True(strings.HasPrefix(report.Rows[1].BookingReference, "IMP-"))
+
+	// The shared pickup address is geocoded once, the delivery of the
+	// second row once
+	suite.Equal(2, suite.geocoder.calls)
+
+	var loads []models.Load
+	testDB.Order("id").Find(&loads)
+	suite.Require().Len(loads, 2)
+	for i, load := range loads {
+		suite.Equal(report.Rows[i].LoadID, load.ID)
+		suite.Equal(suite.shipper.ID, load.ShipperID)
+		suite.Equal("QUOTE_REQUESTED", load.Status)
+		suite.Equal("USD", load.Currency)
+		suite.InDelta(-17.83, load.PickupLat, 0.0001)
+		suite.InDelta(-20.15, load.DeliveryLat, 0.0001)
+		suite.Equal("ZW", load.PickupCountry)
+	}
+	suite.True(loads[0].IsFragile)
+	suite.Equal("Harare", loads[0].PickupCity)
+	suite.Equal(800.5, loads[1].Weight)
+	suite.Equal(8, loads[1].RequestedPickupDate.Hour())
+}
+
+func (suite *LoadImportHandlerTestSuite) TestImportWithInvalidRowsCreatesNothing() {
+	testDB.Create(&models.Load{ShipperID: suite.shipper.ID, BookingReference: "PO-1", Status: "QUOTE_REQUESTED"})
+
+	csv := "reference,weight,pickup_address,delivery_address,pickup_date,delivery_date\n" +
+		"PO-2,100,1 Harare Rd,2 Bulawayo St,2024-03-01,2024-03-02\n" +
+		"PO-1,100,1 Harare Rd,2 Bulawayo St,2024-03-01,2024-03-02\n" +
+		"PO-3,-5,,2 Bulawayo St,2024-03-05,2024-03-02\n" +
+		"PO-4,100,9 Unknown Ave,2 Bulawayo St,2024-03-01,2024-03-02\n"
+	csv = strings.Replace(csv, "reference", "booking_reference", 1)
+
+	status, report := suite.upload("/loads/import", "loads.csv", []byte(csv))
+	suite.Equal(422, status)
+	suite.Equal(4, report.TotalRows)
+	suite.Equal(1, report.ValidRows)
+	suite.Equal(3, report.InvalidRows)
+	suite.Equal(0, report.Created)
+	suite.Require().Len(report.Rows, 4)
+
+	suite.Equal(services.LoadImportValid, report.Rows[0].Status)
+	suite.Equal([]string{"booking_reference is already used by another load"}, report.Rows[1].Errors)
+	suite.Contains(report.Rows[2].Errors, "weight must be a non-negative number")
+	suite.Contains(report.Rows[2].Errors, "pickup_address is required")
+	suite.Contains(report.Rows[2].Errors, "delivery_date must not be before pickup_date")
+	suite.Equal([]string{"pickup address could not be geocoded"}, report.Rows[3].Errors)
+
+	var count int64
+	testDB.Model(&models.Load{}).Count(&count)
+	suite.Equal(int64(1), count)
+}
+
+func (suite *LoadImportHandlerTestSuite) TestImportDryRun() {
+	csv := "weight,pickup_address,delivery_address,pickup_date,delivery_date\n" +
+		"100,1 Harare Rd,2 Bulawayo St,2024-03-01,2024-03-02\n"
+
+	status, report := suite.upload("/loads/import?dry_run=true", "loads.csv", []byte(csv))
+	suite.Equal(200, status)
+	suite.True(report.DryRun)
+	suite.Equal(1, report.ValidRows)
+	suite.Equal(0, report.Created)
+	suite.Equal(services.LoadImportValid, report.Rows[0].Status)
+
+	var count int64
+	testDB.Model(&models.Load{}).Count(&count)
+	suite.Equal(int64(0), count)
+}
+
+func (suite *LoadImportHandlerTestSuite) TestImportXLSX() {
+	writer := services.NewXLSXWriter()
+	writer.AddSheet("Loads", []string{"weight", "pickup_address", "delivery_address", "pickup_date", "delivery_date", "hazmat"}, [][]interface{}{
+		{2500, "1 Harare Rd", "2 Bulawayo St", "2024-03-01", 45353, "TRUE"},
+	})
+	data, err := writer.Bytes()
+	suite.Require().NoError(err)
+
+	status, report := suite.upload("/loads/import", "loads.xlsx", data)
+	suite.Equal(201, status, "%+v", report)
+	suite.Equal(1, report.Created)
+
+	var load models.Load
+	suite.Require().NoError(testDB.First(&load, report.Rows[0].LoadID).Error)
+	suite.Equal(2500.0, load.Weight)
+	suite.True(load.IsHazmat)
+	suite.Equal("2024-03-02", load.RequestedDeliveryDate.Format("2006-01-02"), "serial dates are days since 1899-12-30")
+}
+
+func (suite *LoadImportHandlerTestSuite) TestImportRejectsFileWithoutRequiredColumns() {
+	status, _ := suite.upload("/loads/import", "loads.csv", []byte("weight,pickup_address\n100,1 Harare Rd\n"))
+	suite.Equal(400, status)
+}
+
+func TestLoadImportHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(LoadImportHandlerTestSuite))
+}
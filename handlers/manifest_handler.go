@@ -2,13 +2,18 @@ package handlers
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 	"triplink/backend/database"
 	"triplink/backend/models"
+	"triplink/backend/services"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
+var manifestService = services.NewManifestService(database.DB, services.NewFileStorage(storageConfig))
+
 // GenerateManifest @Summary Generate manifest for a trip
 // @Description Generate a consolidated manifest for all loads in a trip
 // @Tags manifests
@@ -88,16 +93,28 @@ func GenerateManifest(c *fiber.Ctx) error {
 }
 
 // GetTripManifest @Summary Get manifest by trip ID
-// @Description Get the manifest for a specific trip
+// @Description Get the manifest for a trip the current user can see
 // @Tags manifests
 // @Produce json
 // @Param trip_id path int true "Trip ID"
 // @Success 200 {object} models.Manifest
 // @Router /trips/{trip_id}/manifest [get]
 func GetTripManifest(c *fiber.Ctx) error {
+	db, ok := tenantDB(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
 	tripID := c.Params("trip_id")
-	var manifest models.Manifest
+	if err := db.Select("id").First(&models.Trip{}, tripID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip not found",
+		})
+	}
 
+	var manifest models.Manifest
 	result := database.DB.Where("trip_id = ?", tripID).First(&manifest)
 	if result.Error != nil {
 		return c.Status(404).JSON(fiber.Map{
@@ -109,46 +126,66 @@ func GetTripManifest(c *fiber.Ctx) error {
 }
 
 // GetManifest @Summary Get manifest by ID
-// @Description Get a specific manifest by its ID
+// @Description Get a manifest of a trip the current user can see by its ID
 // @Tags manifests
 // @Produce json
 // @Param id path int true "Manifest ID"
 // @Success 200 {object} models.Manifest
 // @Router /manifests/{id} [get]
 func GetManifest(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var manifest models.Manifest
-
-	result := database.DB.First(&manifest, id)
-	if result.Error != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": "Manifest not found",
+	manifest, _, status, message := visibleManifest(c)
+	if manifest == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
 		})
 	}
 
 	return c.JSON(manifest)
 }
 
+// visibleManifest loads the manifest in the id parameter when the current
+// user can see its trip, with the request's scoped database session.
+// Otherwise the manifest is nil and the status and message describe the
+// error to respond with.
+func visibleManifest(c *fiber.Ctx) (*models.Manifest, *gorm.DB, int, string) {
+	db, ok := tenantDB(c)
+	if !ok {
+		return nil, nil, 401, "Unauthorized"
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return nil, nil, 400, "Invalid manifest ID"
+	}
+
+	var manifest models.Manifest
+	if err := database.DB.First(&manifest, uint(id)).Error; err != nil {
+		return nil, nil, 404, "Manifest not found"
+	}
+	if err := db.Select("id").First(&models.Trip{}, manifest.TripID).Error; err != nil {
+		return nil, nil, 404, "Manifest not found"
+	}
+	return &manifest, db, 0, ""
+}
+
 // GetDetailedManifest @Summary Get detailed manifest data
-// @Description Get manifest with detailed load information
+// @Description Get a manifest with detailed information on the loads the current user can see
 // @Tags manifests
 // @Produce json
 // @Param id path int true "Manifest ID"
 // @Success 200 {object} map[string]interface{}
 // @Router /manifests/{id}/detailed [get]
 func GetDetailedManifest(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var manifest models.Manifest
-
-	if err := database.DB.First(&manifest, id).Error; err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": "Manifest not found",
+	manifest, db, status, message := visibleManifest(c)
+	if manifest == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
 		})
 	}
 
 	// Get trip details
 	var trip models.Trip
-	if err := database.DB.First(&trip, manifest.TripID).Error; err != nil {
+	if err := db.First(&trip, manifest.TripID).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Could not fetch trip details",
 		})
@@ -160,9 +197,9 @@ func GetDetailedManifest(c *fiber.Ctx) error {
 	database.DB.First(&vehicle, trip.VehicleID)
 	database.DB.First(&user, trip.UserID)
 
-	// Get loads with shipper info and customs documents
+	// Get the loads the user can see with shipper info and customs documents
 	var loads []models.Load
-	if err := database.DB.Preload("CustomsDocuments").
+	if err := db.Preload("CustomsDocuments").
 		Where("trip_id = ? AND (status = ? OR status = ? OR status = ?)",
 			manifest.TripID, "BOOKED", "PICKED_UP", "IN_TRANSIT").
 		Find(&loads).Error; err != nil {
@@ -228,3 +265,63 @@ func UpdateManifestDocument(c *fiber.Ctx) error {
 
 	return c.JSON(manifest)
 }
+
+// GenerateManifestPDF @Summary Generate manifest PDF for a trip
+// @Description Aggregate the loads of a trip into its manifest, render the manifest PDF with HS codes, weights, values and shipper details, and store it
+// @Tags manifests
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Success 200 {object} models.Manifest
+// @Router /trips/{trip_id}/manifest/generate [post]
+func GenerateManifestPDF(c *fiber.Ctx) error {
+	tripID, err := strconv.ParseUint(c.Params("trip_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid trip ID",
+		})
+	}
+
+	// Verify trip exists
+	var trip models.Trip
+	if err := database.DB.First(&trip, uint(tripID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip not found",
+		})
+	}
+
+	manifest, err := manifestService.GenerateManifest(uint(tripID))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Could not generate manifest: " + err.Error(),
+		})
+	}
+
+	return c.JSON(manifest)
+}
+
+// DownloadManifest @Summary Download manifest PDF
+// @Description Download the generated PDF of a manifest of a trip the current user can see
+// @Tags manifests
+// @Produce application/pdf
+// @Param id path int true "Manifest ID"
+// @Success 200 {file} file
+// @Router /manifests/{id}/download [get]
+func DownloadManifest(c *fiber.Ctx) error {
+	visible, _, status, message := visibleManifest(c)
+	if visible == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	data, manifest, err := manifestService.GetManifestPDF(visible.ID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, manifest.ManifestNumber))
+	return c.Send(data)
+}
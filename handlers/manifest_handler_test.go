@@ -3,8 +3,12 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http/httptest"
 	"testing"
+	"triplink/backend/models"
+	"triplink/backend/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
@@ -17,6 +21,9 @@ type ManifestHandlerTestSuite struct {
 }
 
 func (suite *ManifestHandlerTestSuite) SetupSuite() {
+	storage := services.NewLocalFileStorage(suite.T().TempDir(), "/uploads")
+	manifestService = services.NewManifestService(testDB, storage)
+	registerTenantScope(suite.T())
 }
 
 func (suite *ManifestHandlerTestSuite) SetupTest() {
@@ -25,10 +32,12 @@ func (suite *ManifestHandlerTestSuite) SetupTest() {
 	suite.app = fiber.New()
 
 	suite.app.Post("/trips/:trip_id/manifest", GenerateManifest)
-	suite.app.Get("/trips/:trip_id/manifest", GetTripManifest)
-	suite.app.Get("/manifests/:id", GetManifest)
-	suite.app.Get("/manifests/:id/detailed", GetDetailedManifest)
+	suite.app.Get("/trips/:trip_id/manifest", asSeededUser(), GetTripManifest)
+	suite.app.Get("/manifests/:id", asSeededUser(), GetManifest)
+	suite.app.Get("/manifests/:id/detailed", asSeededUser(), GetDetailedManifest)
 	suite.app.Put("/manifests/:id/document", UpdateManifestDocument)
+	suite.app.Post("/trips/:trip_id/manifest/generate", GenerateManifestPDF)
+	suite.app.Get("/manifests/:id/download", asSeededUser(), DownloadManifest)
 }
 
 func (suite *ManifestHandlerTestSuite) TearDownTest() {
@@ -62,6 +71,22 @@ func (suite *ManifestHandlerTestSuite) TestGetManifest() {
 	assert.Equal(t, 200, resp.StatusCode) // Manifest should exist now
 }
 
+func (suite *ManifestHandlerTestSuite) TestManifestOfOtherCarrier() {
+	t := suite.T()
+
+	// The trip and its loads belong to another carrier and shipper
+	carrier := models.User{Email: "carrier@example.com", Phone: "+1555000111", Password: "password", Role: "CARRIER"}
+	testDB.Create(&carrier)
+	testDB.Model(&models.Trip{}).Where("id = ?", 1).Update("user_id", carrier.ID)
+	testDB.Model(&models.Load{}).Where("trip_id = ?", 1).Update("shipper_id", carrier.ID)
+
+	for _, path := range []string{"/manifests/1", "/manifests/1/detailed", "/manifests/1/download"} {
+		resp, err := suite.app.Test(httptest.NewRequest("GET", path, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, 404, resp.StatusCode, path)
+	}
+}
+
 func (suite *ManifestHandlerTestSuite) TestGetDetailedManifest() {
 	t := suite.T()
 	req := httptest.NewRequest("GET", "/manifests/1/detailed", nil)
@@ -86,4 +111,45 @@ func (suite *ManifestHandlerTestSuite) TestUpdateManifestDocument() {
 
 func TestManifestHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(ManifestHandlerTestSuite))
-}
\ No newline at end of file
+}
+
+func (suite *ManifestHandlerTestSuite) TestGenerateAndDownloadManifestPDF() {
+	t := suite.T()
+
+	var trip models.Trip
+	testDB.First(&trip)
+	testDB.Model(&models.Load{}).Where("trip_id = ?", trip.ID).Updates(map[string]interface{}{
+		"hs_code": "8471.30",
+		"weight":  1200.5,
+		"value":   15000,
+	})
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/trips/%d/manifest/generate", trip.ID), nil)
+	resp, err := suite.app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var manifest models.Manifest
+	json.NewDecoder(resp.Body).Decode(&manifest)
+	assert.NotEmpty(t, manifest.DocumentURL)
+	assert.Equal(t, 1200.5, manifest.TotalWeight)
+
+	req = httptest.NewRequest("GET", fmt.Sprintf("/manifests/%d/download", manifest.ID), nil)
+	resp, err = suite.app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "application/pdf", resp.Header.Get("Content-Type"))
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.True(t, bytes.HasPrefix(body, []byte("%PDF-")))
+	assert.Contains(t, string(body), "8471.30")
+
+	// Unknown trip and manifest without a PDF
+	req = httptest.NewRequest("POST", "/trips/999999/manifest/generate", nil)
+	resp, _ = suite.app.Test(req)
+	assert.Equal(t, 404, resp.StatusCode)
+
+	req = httptest.NewRequest("GET", "/manifests/999999/download", nil)
+	resp, _ = suite.app.Test(req)
+	assert.Equal(t, 404, resp.StatusCode)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+	"triplink/backend/database"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetLoadMatches @Summary Get matching trips for a load
+// @Description Rank available trips for an unassigned load by route proximity, remaining capacity, vehicle requirements and date windows
+// @Tags matching
+// @Produce json
+// @Param load_id path int true "Load ID"
+// @Param limit query int false "Maximum number of candidates (default 10)"
+// @Param max_deviation_km query number false "Maximum distance between the trip route and the load pickup/delivery in km (default 100)"
+// @Success 200 {object} map[string]interface{}
+// @Router /loads/{load_id}/matches [get]
+func GetLoadMatches(c *fiber.Ctx) error {
+	loadIDStr := c.Params("load_id")
+	loadID, err := strconv.ParseUint(loadIDStr, 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid load ID",
+		})
+	}
+
+	opts := services.DefaultMatchOptions()
+	opts.Limit = c.QueryInt("limit", opts.Limit)
+	if maxDeviation := c.Query("max_deviation_km"); maxDeviation != "" {
+		value, err := strconv.ParseFloat(maxDeviation, 64)
+		if err != nil || value <= 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid max_deviation_km",
+			})
+		}
+		opts.MaxDeviationKm = value
+	}
+
+	db, ok := tenantDB(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	// Verify the user can see the load and it is unassigned
+	var load models.Load
+	if err := db.First(&load, uint(loadID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Load not found",
+		})
+	}
+	if load.TripID != 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Load is already assigned to a trip",
+		})
+	}
+
+	matchingService := services.NewMatchingService(database.DB)
+	candidates, err := matchingService.FindTripsForLoad(uint(loadID), opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to match load: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"load_id":    loadID,
+		"candidates": candidates,
+		"count":      len(candidates),
+	})
+}
+
+// GetConsolidationSuggestions @Summary Suggest loads to consolidate onto upcoming trips
+// @Description Find pending loads whose pickup and delivery lie within the route corridor of the current carrier's planned trips and fit their remaining capacity, ranked by added revenue less the cost of the detour
+// @Tags matching
+// @Produce json
+// @Param trip_id query int false "Only suggest loads for this trip"
+// @Param max_deviation_km query number false "Maximum distance between the trip route and the load pickup/delivery in km (default 50)"
+// @Param days query int false "Consider trips departing within this many days (default 14)"
+// @Param cost_per_km query number false "Cost of each extra km driven (default 1.5)"
+// @Param limit query int false "Maximum number of suggestions (default 20)"
+// @Success 200 {object} map[string]interface{}
+// @Router /users/me/consolidation-suggestions [get]
+func GetConsolidationSuggestions(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	opts := services.DefaultConsolidationOptions()
+	opts.Limit = c.QueryInt("limit", opts.Limit)
+	opts.TripID = uint(c.QueryInt("trip_id", 0))
+	if days := c.QueryInt("days", 0); days < 0 || days > 90 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "days must be between 1 and 90",
+		})
+	} else if days > 0 {
+		opts.Horizon = time.Duration(days) * 24 * time.Hour
+	}
+	for _, param := range []struct {
+		name  string
+		value *float64
+		zero  bool
+	}{
+		{"max_deviation_km", &opts.MaxDeviationKm, false},
+		{"cost_per_km", &opts.CostPerKm, true},
+	} {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || value < 0 || (value == 0 && !param.zero) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid " + param.name,
+			})
+		}
+		*param.value = value
+	}
+
+	matchingService := services.NewMatchingService(database.DB)
+	suggestions, err := matchingService.SuggestConsolidations(uint(userID), opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to find consolidation suggestions: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"suggestions": suggestions,
+		"count":       len(suggestions),
+	})
+}
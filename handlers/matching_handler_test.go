@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type MatchingHandlerTestSuite struct {
+	suite.Suite
+	app *fiber.App
+}
+
+func (suite *MatchingHandlerTestSuite) SetupSuite() {
+	registerTenantScope(suite.T())
+}
+
+func (suite *MatchingHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+	suite.app = fiber.New()
+
+	suite.app.Use(asHeaderUser())
+
+	suite.app.Get("/loads/:load_id/matches", asSeededUser(), GetLoadMatches)
+	suite.app.Get("/consolidation-suggestions", GetConsolidationSuggestions)
+}
+
+func (suite *MatchingHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *MatchingHandlerTestSuite) TestGetLoadMatches() {
+	t := suite.T()
+
+	// Unassigned load along a public trip
+	trip := models.Trip{
+		OriginLat:           40.7128,
+		OriginLng:           -74.0060,
+		DestinationLat:      39.9526,
+		DestinationLng:      -75.1652,
+		DepartureDate:       time.Now().Add(24 * time.Hour),
+		EstimatedArrival:    time.Now().Add(30 * time.Hour),
+		TotalCapacityWeight: 10000,
+		TotalCapacityVolume: 50,
+		Status:              "PLANNED",
+		IsPublic:            true,
+	}
+	testDB.Create(&trip)
+
+	var shipper models.User
+	testDB.Where("email = ?", "test@example.com").First(&shipper)
+
+	load := models.Load{
+		ShipperID:             shipper.ID,
+		BookingReference:      "MATCH-LOAD-001",
+		Weight:                1000,
+		Volume:                5,
+		PickupLat:             40.7357,
+		PickupLng:             -74.1724,
+		DeliveryLat:           39.9526,
+		DeliveryLng:           -75.1652,
+		RequestedPickupDate:   time.Now().Add(24 * time.Hour),
+		RequestedDeliveryDate: time.Now().Add(48 * time.Hour),
+		Status:                "QUOTE_REQUESTED",
+	}
+	testDB.Create(&load)
+
+	// Another shipper's load
+	otherLoad := models.Load{
+		ShipperID:             shipper.ID + 1000,
+		BookingReference:      "MATCH-LOAD-002",
+		RequestedPickupDate:   time.Now().Add(24 * time.Hour),
+		RequestedDeliveryDate: time.Now().Add(48 * time.Hour),
+		Status:                "QUOTE_REQUESTED",
+	}
+	testDB.Create(&otherLoad)
+
+	var assignedLoad models.Load
+	testDB.Where("booking_reference = ?", "TEST-LOAD-001").First(&assignedLoad)
+
+	tests := []struct {
+		name           string
+		loadID         string
+		queryParams    string
+		expectedStatus int
+	}{
+		{
+			name:           "Unassigned load",
+			loadID:         fmt.Sprint(load.ID),
+			queryParams:    "",
+			expectedStatus: 200,
+		},
+		{
+			name:           "Unassigned load with options",
+			loadID:         fmt.Sprint(load.ID),
+			queryParams:    "?limit=5&max_deviation_km=50",
+			expectedStatus: 200,
+		},
+		{
+			name:           "Invalid max deviation",
+			loadID:         fmt.Sprint(load.ID),
+			queryParams:    "?max_deviation_km=abc",
+			expectedStatus: 400,
+		},
+		{
+			name:           "Already assigned load",
+			loadID:         fmt.Sprint(assignedLoad.ID),
+			queryParams:    "",
+			expectedStatus: 400,
+		},
+		{
+			name:           "Other shipper's load",
+			loadID:         fmt.Sprint(otherLoad.ID),
+			queryParams:    "",
+			expectedStatus: 404,
+		},
+		{
+			name:           "Load not found",
+			loadID:         "999999",
+			queryParams:    "",
+			expectedStatus: 404,
+		},
+		{
+			name:           "Invalid load ID",
+			loadID:         "invalid",
+			queryParams:    "",
+			expectedStatus: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/loads/"+tt.loadID+"/matches"+tt.queryParams, nil)
+			resp, err := suite.app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+}
+
+func (suite *MatchingHandlerTestSuite) TestGetConsolidationSuggestions() {
+	t := suite.T()
+
+	carrier := models.User{Email: "carrier@example.com", Password: "password", Role: "CARRIER"}
+	testDB.Create(&carrier)
+
+	// New York to Philadelphia, with 2000 kg of capacity left
+	trip := models.Trip{
+		UserID:              carrier.ID,
+		OriginLat:           40.7128,
+		OriginLng:           -74.0060,
+		DestinationLat:      39.9526,
+		DestinationLng:      -75.1652,
+		DepartureDate:       time.Now().Add(24 * time.Hour),
+		EstimatedArrival:    time.Now().Add(30 * time.Hour),
+		TotalCapacityWeight: 10000,
+		UsedWeight:          8000,
+		TotalCapacityVolume: 50,
+		BasePrice:           100,
+		PricePerKg:          0.5,
+		Status:              "PLANNED",
+		IsPublic:            true,
+	}
+	testDB.Create(&trip)
+
+	loads := []models.Load{
+		// Newark to Philadelphia, just off the route
+		{BookingReference: "CONSOLIDATE-NEAR", Weight: 1000, PickupLat: 40.7357, PickupLng: -74.1724, DeliveryLat: 39.9526, DeliveryLng: -75.1652, Status: "QUOTE_REQUESTED"},
+		// Trenton to Philadelphia, on the route
+		{BookingReference: "CONSOLIDATE-SMALL", Weight: 200, PickupLat: 40.2206, PickupLng: -74.7597, DeliveryLat: 39.9526, DeliveryLng: -75.1652, Status: "QUOTED"},
+		// Too heavy for the remaining capacity
+		{BookingReference: "CONSOLIDATE-HEAVY", Weight: 5000, PickupLat: 40.7357, PickupLng: -74.1724, DeliveryLat: 39.9526, DeliveryLng: -75.1652, Status: "QUOTE_REQUESTED"},
+		// Against the direction of travel
+		{BookingReference: "CONSOLIDATE-BACKWARDS", Weight: 100, PickupLat: 39.9526, PickupLng: -75.1652, DeliveryLat: 40.7357, DeliveryLng: -74.1724, Status: "QUOTE_REQUESTED"},
+		// Boston, far from the route
+		{BookingReference: "CONSOLIDATE-FAR", Weight: 100, PickupLat: 42.3601, PickupLng: -71.0589, DeliveryLat: 39.9526, DeliveryLng: -75.1652, Status: "QUOTE_REQUESTED"},
+	}
+	for i := range loads {
+		testDB.Create(&loads[i])
+	}
+
+	request := func(userID uint, query string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("GET", "/consolidation-suggestions"+query, nil)
+		req.Header.Set("X-User-ID", fmt.Sprint(userID))
+		resp, err := suite.app.Test(req)
+		suite.Require().NoError(err)
+
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	status, body := request(carrier.ID, "")
+	suite.Require().Equal(200, status, body)
+	suggestions := body["suggestions"].([]interface{})
+	suite.Require().Len(suggestions, 2)
+
+	// The heavier load adds more revenue than its longer detour costs
+	first := suggestions[0].(map[string]interface{})
+	second := suggestions[1].(map[string]interface{})
+	assert.Equal(t, "CONSOLIDATE-NEAR", first["load"].(map[string]interface{})["booking_reference"])
+	assert.Equal(t, "CONSOLIDATE-SMALL", second["load"].(map[string]interface{})["booking_reference"])
+	assert.Equal(t, 600.0, first["added_revenue"])
+	assert.Equal(t, 1000.0, first["remaining_weight"])
+	assert.Greater(t, first["detour_cost"].(float64), second["detour_cost"].(float64))
+	assert.Greater(t, first["net_gain"].(float64), second["net_gain"].(float64))
+
+	// A tighter corridor leaves only the load on the route
+	status, body = request(carrier.ID, "?max_deviation_km=5")
+	suite.Require().Equal(200, status, body)
+	assert.Equal(t, 1.0, body["count"])
+
+	// Other carriers' trips aren't considered
+	var shipper models.User
+	testDB.Where("email = ?", "test@example.com").First(&shipper)
+	status, body = request(shipper.ID, "")
+	suite.Require().Equal(200, status, body)
+	assert.Equal(t, 0.0, body["count"])
+
+	status, _ = request(carrier.ID, "?cost_per_km=abc")
+	assert.Equal(t, 400, status)
+	status, _ = request(carrier.ID, "?days=365")
+	assert.Equal(t, 400, status)
+}
+
+func TestMatchingHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(MatchingHandlerTestSuite))
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"strconv"
 	"triplink/backend/database"
 	"triplink/backend/models"
 	"triplink/backend/services"
@@ -8,8 +9,10 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
+var messagingService = services.NewMessagingService(database.DB)
+
 // CreateMessage @Summary Create a message
-// @Description Create a new message between users
+// @Description Send a direct message between two users. The message is added to their direct conversation.
 // @Tags messages
 // @Accept json
 // @Produce json
@@ -25,19 +28,18 @@ func CreateMessage(c *fiber.Ctx) error {
 		})
 	}
 
-	// Create message in database
-	result := database.DB.Create(&message)
-	if result.Error != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Could not create message",
-		})
+	if userID, ok := c.Locals("user_id").(float64); ok {
+		message.SenderID = uint(userID)
 	}
 
-	// Trigger notification for new message
-	triggerService := services.NewNotificationTriggerService()
-	triggerService.MessageReceivedHandler(message.ID)
+	created, err := messagingService.SendDirectMessage(message.SenderID, message.ReceiverID, message.Content)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 
-	return c.Status(201).JSON(message)
+	return c.Status(201).JSON(created)
 }
 
 // GetMessages @Summary Get all messages
@@ -104,3 +106,244 @@ func GetConversation(c *fiber.Ctx) error {
 
 	return c.JSON(messages)
 }
+
+// StartConversation @Summary Start a conversation
+// @Description Start a conversation with other users, optionally about a load or trip. The shipper and carrier of the load or trip are added automatically and an existing conversation with the same participants is reused.
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param conversation body services.ConversationRequest true "Conversation data"
+// @Success 201 {object} models.Conversation
+// @Router /conversations [post]
+func StartConversation(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req services.ConversationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	conversation, created, err := messagingService.StartConversation(uint(userID), req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if created {
+		return c.Status(201).JSON(conversation)
+	}
+	return c.JSON(conversation)
+}
+
+// GetConversations @Summary Get conversations
+// @Description Get the current user's conversations with their latest message and unread count
+// @Tags messages
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /conversations [get]
+func GetConversations(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	conversations, err := messagingService.GetUserConversations(uint(userID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch conversations",
+		})
+	}
+
+	var unread int64
+	for _, conversation := range conversations {
+		unread += conversation.UnreadCount
+	}
+
+	return c.JSON(fiber.Map{
+		"conversations": conversations,
+		"count":         len(conversations),
+		"unread_count":  unread,
+	})
+}
+
+// GetUnreadMessageCounts @Summary Get unread message counts
+// @Description Get the number of unread messages of the current user, in total and per conversation
+// @Tags messages
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /conversations/unread [get]
+func GetUnreadMessageCounts(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	counts, total, err := messagingService.GetUnreadCounts(uint(userID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not count unread messages",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"total":         total,
+		"conversations": counts,
+	})
+}
+
+// GetConversationMessages @Summary Get conversation messages
+// @Description Get the messages of a conversation, newest first
+// @Tags messages
+// @Produce json
+// @Param id path int true "Conversation ID"
+// @Param limit query int false "Number of messages to return (default 50)"
+// @Param cursor query string false "Cursor from next_cursor of the previous page"
+// @Success 200 {object} map[string]interface{}
+// @Router /conversations/{id}/messages [get]
+func GetConversationMessages(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	conversationID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid conversation ID",
+		})
+	}
+
+	page, err := parsePageParams(c, 50)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
+	}
+
+	if !messagingService.IsParticipant(uint(conversationID), uint(userID)) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	var messages []models.Message
+	result := page.paginate(database.DB.Where("conversation_id = ?", conversationID), "created_at").
+		Find(&messages)
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch messages",
+		})
+	}
+
+	nextCursor := ""
+	if page.hasMore(len(messages)) {
+		messages = messages[:page.Limit]
+		last := messages[len(messages)-1]
+		nextCursor = encodePageCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"conversation_id": conversationID,
+		"data":            messages,
+		"count":           len(messages),
+		"limit":           page.Limit,
+		"next_cursor":     nextCursor,
+		"has_more":        nextCursor != "",
+	})
+}
+
+// SendConversationMessage @Summary Send a message
+// @Description Send a message to a conversation and notify the other participants
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param id path int true "Conversation ID"
+// @Param message body map[string]string true "Message content"
+// @Success 201 {object} models.Message
+// @Router /conversations/{id}/messages [post]
+func SendConversationMessage(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	conversationID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid conversation ID",
+		})
+	}
+
+	var body struct {
+		Content string `json:"content"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if !messagingService.IsParticipant(uint(conversationID), uint(userID)) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	message, err := messagingService.SendMessage(uint(conversationID), uint(userID), body.Content)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(message)
+}
+
+// MarkConversationRead @Summary Mark conversation as read
+// @Description Mark all messages of a conversation as read by the current user
+// @Tags messages
+// @Produce json
+// @Param id path int true "Conversation ID"
+// @Success 200 {object} map[string]string
+// @Router /conversations/{id}/read [post]
+func MarkConversationRead(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	conversationID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid conversation ID",
+		})
+	}
+
+	if err := messagingService.MarkConversationRead(uint(conversationID), uint(userID)); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Conversation marked as read",
+	})
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 	"triplink/backend/models"
+	"triplink/backend/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
@@ -18,6 +20,7 @@ type MessageHandlerTestSuite struct {
 }
 
 func (suite *MessageHandlerTestSuite) SetupSuite() {
+	messagingService = services.NewMessagingService(testDB)
 }
 
 func (suite *MessageHandlerTestSuite) SetupTest() {
@@ -25,10 +28,25 @@ func (suite *MessageHandlerTestSuite) SetupTest() {
 	seedTestDB()
 	suite.app = fiber.New()
 
+	suite.app.Use(asHeaderUser())
+
 	suite.app.Post("/messages", CreateMessage)
 	suite.app.Get("/messages", GetMessages)
 	suite.app.Get("/users/:user_id/messages", GetUserMessages)
 	suite.app.Get("/messages/conversation/:user1_id/:user2_id", GetConversation)
+	suite.app.Post("/conversations", StartConversation)
+	suite.app.Get("/conversations", GetConversations)
+	suite.app.Get("/conversations/unread", GetUnreadMessageCounts)
+	suite.app.Get("/conversations/:id/messages", GetConversationMessages)
+	suite.app.Post("/conversations/:id/messages", SendConversationMessage)
+	suite.app.Post("/conversations/:id/read", MarkConversationRead)
+}
+
+// createCarrier adds a second user to talk to
+func (suite *MessageHandlerTestSuite) createCarrier() models.User {
+	carrier := models.User{Email: "carrier@example.com", Phone: "+1987654321", Password: "password", Role: "CARRIER"}
+	testDB.Create(&carrier)
+	return carrier
 }
 
 func (suite *MessageHandlerTestSuite) TearDownTest() {
@@ -38,9 +56,13 @@ func (suite *MessageHandlerTestSuite) TearDownTest() {
 func (suite *MessageHandlerTestSuite) TestCreateMessage() {
 	t := suite.T()
 
+	var shipper models.User
+	testDB.First(&shipper)
+	carrier := suite.createCarrier()
+
 	message := models.Message{
-		SenderID:   1,
-		ReceiverID: 2,
+		SenderID:   shipper.ID,
+		ReceiverID: carrier.ID,
 		Content:    "Hello",
 	}
 	jsonData, _ := json.Marshal(message)
@@ -83,6 +105,93 @@ func (suite *MessageHandlerTestSuite) TestGetConversation() {
 	assert.Equal(t, 200, resp.StatusCode)
 }
 
+func (suite *MessageHandlerTestSuite) TestConversations() {
+	t := suite.T()
+
+	var shipper models.User
+	testDB.First(&shipper)
+	var load models.Load
+	testDB.First(&load)
+	carrier := suite.createCarrier()
+
+	shipperID := strconv.Itoa(int(shipper.ID))
+	carrierID := strconv.Itoa(int(carrier.ID))
+
+	request := func(method, url, userID string, body interface{}) (int, map[string]interface{}) {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		if userID != "" {
+			req.Header.Set("X-User-ID", userID)
+		}
+		resp, err := suite.app.Test(req)
+		assert.NoError(t, err)
+
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	// Start a conversation about the load; starting it again reuses it
+	status, conversation := request("POST", "/conversations", shipperID, map[string]interface{}{
+		"load_id":         load.ID,
+		"participant_ids": []uint{carrier.ID},
+		"subject":         "Pickup time",
+	})
+	assert.Equal(t, 201, status)
+	conversationID := strconv.Itoa(int(conversation["id"].(float64)))
+
+	status, _ = request("POST", "/conversations", carrierID, map[string]interface{}{
+		"load_id":         load.ID,
+		"participant_ids": []uint{shipper.ID},
+	})
+	assert.Equal(t, 200, status)
+
+	status, _ = request("POST", "/conversations", "", map[string]interface{}{})
+	assert.Equal(t, 401, status)
+
+	// Send messages
+	status, _ = request("POST", "/conversations/"+conversationID+"/messages", shipperID, map[string]string{"content": "Can you pick up at 9?"})
+	assert.Equal(t, 201, status)
+	status, _ = request("POST", "/conversations/"+conversationID+"/messages", shipperID, map[string]string{"content": "Gate 4"})
+	assert.Equal(t, 201, status)
+	status, _ = request("POST", "/conversations/"+conversationID+"/messages", shipperID, map[string]string{"content": "  "})
+	assert.Equal(t, 400, status)
+	status, _ = request("POST", "/conversations/"+conversationID+"/messages", "99999", map[string]string{"content": "Hi"})
+	assert.Equal(t, 404, status)
+
+	// The carrier has two unread messages, the sender none
+	_, unread := request("GET", "/conversations/unread", carrierID, nil)
+	assert.Equal(t, float64(2), unread["total"])
+	_, unread = request("GET", "/conversations/unread", shipperID, nil)
+	assert.Equal(t, float64(0), unread["total"])
+
+	status, conversations := request("GET", "/conversations", carrierID, nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(1), conversations["count"])
+	assert.Equal(t, float64(2), conversations["unread_count"])
+
+	status, messages := request("GET", "/conversations/"+conversationID+"/messages?limit=1", carrierID, nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, true, messages["has_more"])
+	status, _ = request("GET", "/conversations/"+conversationID+"/messages", "99999", nil)
+	assert.Equal(t, 404, status)
+
+	// Reading the conversation clears the unread count
+	status, _ = request("POST", "/conversations/"+conversationID+"/read", carrierID, nil)
+	assert.Equal(t, 200, status)
+	_, unread = request("GET", "/conversations/unread", carrierID, nil)
+	assert.Equal(t, float64(0), unread["total"])
+
+	// The carrier is notified about new messages, grouped into one
+	// notification for the conversation
+	var notifications []models.Notification
+	testDB.Where("user_id = ? AND type = ?", carrier.ID, "NEW_MESSAGE").Find(&notifications)
+	if assert.Len(t, notifications, 1) {
+		assert.Equal(t, 2, notifications[0].GroupCount)
+	}
+}
+
 func TestMessageHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(MessageHandlerTestSuite))
 }
\ No newline at end of file
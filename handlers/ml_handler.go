@@ -3,33 +3,58 @@ package handlers
 import (
 	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"triplink/backend/models"
 	"triplink/backend/services"
 )
 
 // ML Handlers for Hugging Face model integration
 
+// TextAnalysisRequest is a text to analyze the sentiment of
+type TextAnalysisRequest struct {
+	Text string `json:"text" validate:"required"`
+}
+
+// TextClassificationRequest is a text to classify into one of the categories
+type TextClassificationRequest struct {
+	Text       string   `json:"text" validate:"required"`
+	Categories []string `json:"categories" validate:"required,min=1,dive,required"`
+}
+
+// FeedbackItem is a piece of customer feedback to analyze
+type FeedbackItem struct {
+	ID   string `json:"id"`
+	Text string `json:"text" validate:"required"`
+}
+
+// FeedbackBatchRequest is the customer feedback to analyze in one batch
+type FeedbackBatchRequest struct {
+	Feedbacks []FeedbackItem `json:"feedbacks" validate:"required,min=1,dive"`
+}
+
+// OperationsInsightsRequest narrows the operations insights to routes and customers
+type OperationsInsightsRequest struct {
+	TimeRange   map[string]string `json:"time_range"`
+	RouteIDs    []string          `json:"route_ids,omitempty"`
+	CustomerIDs []string          `json:"customer_ids,omitempty"`
+}
+
 // @Summary Analyze sentiment of customer feedback
 // @Tags Machine Learning
 // @Accept json
 // @Produce json
-// @Param request body fiber.Map true "Text analysis request"
+// @Param request body TextAnalysisRequest true "Text analysis request"
 // @Success 200 {object} services.SentimentAnalysisResult
+// @Failure 422 {object} ValidationErrorResponse
 // @Router /api/ml/sentiment-analysis [post]
 func AnalyzeSentiment(c *fiber.Ctx) error {
-	var request struct {
-		Text string `json:"text" validate:"required"`
-	}
-
-	if err := c.BodyParser(&request); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
-	}
-
-	if request.Text == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "Text field is required"})
+	var request TextAnalysisRequest
+	if err := parseBody(c, &request); err != nil {
+		return invalidRequest(c, err)
 	}
 
 	// Initialize Redis service for caching
@@ -61,6 +86,7 @@ func AnalyzeSentiment(c *fiber.Ctx) error {
 }
 
 // @Summary Predict delivery delays using ML models
+// @Description Predict a delay with the model trained on completed trips, for a trip by trip_id or for a lane by origin_city, destination_city, carrier_id, departure_time, distance and weather
 // @Tags Machine Learning
 // @Accept json
 // @Produce json
@@ -73,9 +99,27 @@ func PredictDeliveryDelay(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
+	// Trips are only predicted for users who can see them
+	if tripID, ok := routeData["trip_id"].(float64); ok && tripID > 0 {
+		db, ok := tenantDB(c)
+		if !ok {
+			return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+		var trip models.Trip
+		if err := db.Select("id").First(&trip, uint(tripID)).Error; err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Trip not found"})
+		}
+	}
+
 	mlService := services.NewMLService()
 	result, err := mlService.PredictDeliveryDelay(routeData)
-	if err != nil {
+	var parseErr *time.ParseError
+	switch {
+	case errors.Is(err, services.ErrNoDelayModel):
+		return c.Status(503).JSON(fiber.Map{"error": err.Error()})
+	case errors.As(err, &parseErr):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to predict delay"})
 	}
 
@@ -108,21 +152,14 @@ func PredictCustomerSatisfaction(c *fiber.Ctx) error {
 // @Tags Machine Learning
 // @Accept json
 // @Produce json
-// @Param request body fiber.Map true "Text classification request"
+// @Param request body TextClassificationRequest true "Text classification request"
 // @Success 200 {object} services.TextClassificationResult
+// @Failure 422 {object} ValidationErrorResponse
 // @Router /api/ml/classify-text [post]
 func ClassifyText(c *fiber.Ctx) error {
-	var request struct {
-		Text       string   `json:"text" validate:"required"`
-		Categories []string `json:"categories" validate:"required"`
-	}
-
-	if err := c.BodyParser(&request); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
-	}
-
-	if request.Text == "" || len(request.Categories) == 0 {
-		return c.Status(400).JSON(fiber.Map{"error": "Text and categories are required"})
+	var request TextClassificationRequest
+	if err := parseBody(c, &request); err != nil {
+		return invalidRequest(c, err)
 	}
 
 	mlService := services.NewMLService()
@@ -160,23 +197,14 @@ func OptimizeRouteWithML(c *fiber.Ctx) error {
 // @Tags Machine Learning
 // @Accept json
 // @Produce json
-// @Param request body fiber.Map true "Batch feedback analysis request"
+// @Param request body FeedbackBatchRequest true "Batch feedback analysis request"
 // @Success 200 {object} fiber.Map
+// @Failure 422 {object} ValidationErrorResponse
 // @Router /api/ml/batch-analyze-feedback [post]
 func BatchAnalyzeFeedback(c *fiber.Ctx) error {
-	var request struct {
-		Feedbacks []struct {
-			ID   string `json:"id"`
-			Text string `json:"text"`
-		} `json:"feedbacks" validate:"required"`
-	}
-
-	if err := c.BodyParser(&request); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
-	}
-
-	if len(request.Feedbacks) == 0 {
-		return c.Status(400).JSON(fiber.Map{"error": "No feedback provided"})
+	var request FeedbackBatchRequest
+	if err := parseBody(c, &request); err != nil {
+		return invalidRequest(c, err)
 	}
 
 	mlService := services.NewMLService()
@@ -235,18 +263,13 @@ func BatchAnalyzeFeedback(c *fiber.Ctx) error {
 // @Tags Machine Learning
 // @Accept json
 //@Produce json
-// @Param request body fiber.Map true "Operations data for ML insights"
+// @Param request body OperationsInsightsRequest true "Operations data for ML insights"
 // @Success 200 {object} fiber.Map
 // @Router /api/ml/operations-insights [post]
 func GetOperationsMLInsights(c *fiber.Ctx) error {
-	var request struct {
-		TimeRange   map[string]string `json:"time_range"`
-		RouteIDs    []string          `json:"route_ids,omitempty"`
-		CustomerIDs []string          `json:"customer_ids,omitempty"`
-	}
-
-	if err := c.BodyParser(&request); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	var request OperationsInsightsRequest
+	if err := parseBody(c, &request); err != nil {
+		return invalidRequest(c, err)
 	}
 
 	mlService := services.NewMLService()
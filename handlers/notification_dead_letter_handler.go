@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"strconv"
+	"triplink/backend/database"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetNotificationDeadLetters @Summary Get failed notification deliveries
+// @Description Get the notification deliveries the delivery queue gave up on after retrying, newest first
+// @Tags admin
+// @Produce json
+// @Param channel query string false "Delivery channel (PUSH, EMAIL)"
+// @Param user_id query int false "Recipient user ID"
+// @Param retried query bool false "Only retried, or only not yet retried, deliveries"
+// @Param limit query int false "Number of deliveries to return (default 50)"
+// @Param offset query int false "Number of deliveries to skip (default 0, ignored with cursor)"
+// @Param cursor query string false "Cursor from next_cursor of the previous page"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/notifications/dead-letters [get]
+func GetNotificationDeadLetters(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	page, err := parsePageParams(c, 50)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
+	}
+
+	query := database.DB.Model(&models.NotificationDeadLetter{})
+	if channel := c.Query("channel"); channel != "" {
+		query = query.Where("channel = ?", channel)
+	}
+	if value := c.Query("user_id"); value != "" {
+		userID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid user ID",
+			})
+		}
+		query = query.Where("user_id = ?", userID)
+	}
+	if value := c.Query("retried"); value != "" {
+		retried, err := strconv.ParseBool(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid retried filter",
+			})
+		}
+		if retried {
+			query = query.Where("retried_at IS NOT NULL")
+		} else {
+			query = query.Where("retried_at IS NULL")
+		}
+	}
+
+	var total int64
+	query.Session(&gorm.Session{}).Count(&total)
+
+	var letters []models.NotificationDeadLetter
+	if err := page.paginate(query, "created_at").Find(&letters).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch dead letters",
+		})
+	}
+
+	nextCursor := ""
+	if page.hasMore(len(letters)) {
+		letters = letters[:page.Limit]
+		last := letters[len(letters)-1]
+		nextCursor = encodePageCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        letters,
+		"count":       len(letters),
+		"total":       total,
+		"limit":       page.Limit,
+		"offset":      page.Offset,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	})
+}
+
+// RetryNotificationDeadLetter @Summary Retry a failed notification delivery
+// @Description Queue a dead lettered delivery again with a fresh set of attempts
+// @Tags admin
+// @Produce json
+// @Param id path int true "Dead letter ID"
+// @Success 202 {object} models.NotificationDeadLetter
+// @Router /admin/notifications/dead-letters/{id}/retry [post]
+func RetryNotificationDeadLetter(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	letterID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid dead letter ID",
+		})
+	}
+
+	queue := services.GetNotificationQueue()
+	if queue == nil {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "Notification queue is not running",
+		})
+	}
+
+	letter, err := queue.RetryDeadLetter(uint(letterID))
+	if err != nil {
+		status := 400
+		if err == services.ErrNotificationQueueFull {
+			status = 503
+		} else if err.Error() == "dead letter not found" {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(202).JSON(letter)
+}
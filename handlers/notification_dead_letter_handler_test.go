@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// unavailablePushProvider is a push provider that is down
+type unavailablePushProvider struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *unavailablePushProvider) SendNotification(tokens []string, notification *models.Notification) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	return errors.New("push service unavailable")
+}
+
+func (p *unavailablePushProvider) BatchSendNotifications(notifications []services.NotificationBatch) error {
+	return errors.New("push service unavailable")
+}
+
+func (p *unavailablePushProvider) Name() string {
+	return "TEST_PUSH"
+}
+
+func (p *unavailablePushProvider) Calls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+type NotificationDeadLetterHandlerTestSuite struct {
+	suite.Suite
+	app      *fiber.App
+	admin    models.User
+	user     models.User
+	provider *unavailablePushProvider
+	queue    *services.NotificationQueue
+}
+
+func (suite *NotificationDeadLetterHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+
+	suite.admin = models.User{Email: "admin@example.com", Phone: "+1987654321", Password: "password", Role: "ADMIN"}
+	testDB.Create(&suite.admin)
+	suite.user = models.User{Email: "driver@example.com", Phone: "+1555000111", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.user)
+
+	sender := services.NewNotificationService(testDB)
+	suite.provider = &unavailablePushProvider{}
+	sender.RegisterProvider(suite.provider)
+	suite.Require().NoError(sender.RegisterDeviceToken(suite.user.ID, "ExponentPushToken[test]", "ios"))
+
+	suite.queue = services.NewNotificationQueue(testDB, sender, &config.NotificationQueueConfig{
+		Workers:        2,
+		QueueSize:      10,
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	})
+	suite.queue.Start()
+	services.SetNotificationQueue(suite.queue)
+
+	suite.app = fiber.New()
+
+	suite.app.Use(asHeaderUser())
+	suite.app.Get("/admin/notifications/dead-letters", GetNotificationDeadLetters)
+	suite.app.Post("/admin/notifications/dead-letters/:id/retry", RetryNotificationDeadLetter)
+}
+
+func (suite *NotificationDeadLetterHandlerTestSuite) TearDownTest() {
+	services.SetNotificationQueue(nil)
+	suite.queue.Stop()
+	clearTestDB()
+}
+
+func (suite *NotificationDeadLetterHandlerTestSuite) request(method, url string, userID uint) (int, map[string]interface{}) {
+	req := httptest.NewRequest(method, url, nil)
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	resp, err := suite.app.Test(req)
+	suite.Require().NoError(err)
+
+	var body map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func (suite *NotificationDeadLetterHandlerTestSuite) TestFailedDeliveryIsRetriedThenDeadLettered() {
+	t := suite.T()
+
+	notification := models.Notification{UserID: suite.user.ID, Type: "TRIP_DELAY", Title: "Delayed", Message: "Your trip is delayed"}
+	created, result, err := services.NewNotificationService(testDB).CreateNotificationWithDelivery(&notification)
+	assert.NoError(t, err)
+	assert.NotNil(t, created)
+	assert.Nil(t, result, "deliveries are queued rather than made in the request")
+
+	var letter models.NotificationDeadLetter
+	assert.Eventually(t, func() bool {
+		return testDB.Where("notification_id = ?", created.ID).First(&letter).Error == nil
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, 3, suite.provider.Calls())
+	assert.Equal(t, services.DeliveryChannelPush, letter.Channel)
+	assert.Equal(t, 3, letter.Attempts)
+	assert.Equal(t, "push service unavailable", letter.LastError)
+
+	var deliveries int64
+	testDB.Model(&models.NotificationDelivery{}).Where("notification_id = ?", created.ID).Count(&deliveries)
+	assert.Equal(t, int64(3), deliveries)
+
+	status, body := suite.request("GET", "/admin/notifications/dead-letters?channel=PUSH&retried=false", suite.admin.ID)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(1), body["total"])
+
+	status, _ = suite.request("GET", "/admin/notifications/dead-letters", suite.user.ID)
+	assert.Equal(t, 403, status)
+
+	// A retry gets a fresh set of attempts, and can only be made once
+	status, body = suite.request("POST", fmt.Sprintf("/admin/notifications/dead-letters/%d/retry", letter.ID), suite.admin.ID)
+	assert.Equal(t, 202, status)
+	assert.NotNil(t, body["retried_at"])
+	assert.Eventually(t, func() bool {
+		var count int64
+		testDB.Model(&models.NotificationDeadLetter{}).Where("notification_id = ?", created.ID).Count(&count)
+		return count == 2
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, 6, suite.provider.Calls())
+
+	status, _ = suite.request("POST", fmt.Sprintf("/admin/notifications/dead-letters/%d/retry", letter.ID), suite.admin.ID)
+	assert.Equal(t, 400, status)
+
+	status, _ = suite.request("GET", "/admin/notifications/dead-letters?retried=true", suite.admin.ID)
+	assert.Equal(t, 200, status)
+
+	status, _ = suite.request("POST", "/admin/notifications/dead-letters/999999/retry", suite.admin.ID)
+	assert.Equal(t, 404, status)
+}
+
+func (suite *NotificationDeadLetterHandlerTestSuite) TestBackoffDoublesUpToMax() {
+	t := suite.T()
+
+	queue := services.NewNotificationQueue(testDB, nil, &config.NotificationQueueConfig{
+		InitialBackoff: 2 * time.Second,
+		MaxBackoff:     10 * time.Second,
+	})
+	assert.Equal(t, 2*time.Second, queue.Backoff(1))
+	assert.Equal(t, 4*time.Second, queue.Backoff(2))
+	assert.Equal(t, 8*time.Second, queue.Backoff(3))
+	assert.Equal(t, 10*time.Second, queue.Backoff(4))
+}
+
+func TestNotificationDeadLetterHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(NotificationDeadLetterHandlerTestSuite))
+}
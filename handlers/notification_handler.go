@@ -1,599 +1,760 @@
 package handlers
 
 import (
-	"fmt"
+	"strconv"
+	"strings"
 	"time"
 	"triplink/backend/database"
+	"triplink/backend/internal/timezone"
 	"triplink/backend/models"
+	"triplink/backend/services"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
+// notificationService returns the notification service set up at startup
+func notificationService() *services.NotificationService {
+	if service := services.GetNotificationService(); service != nil {
+		return service
+	}
+	return services.NewNotificationService(database.DB)
+}
+
+// notificationUserID returns the user in the user_id path parameter, or the
+// status and message to respond with. Signed in users can only manage their
+// own notifications.
+func notificationUserID(c *fiber.Ctx) (uint, int, string) {
+	userID, err := strconv.ParseUint(c.Params("user_id"), 10, 32)
+	if err != nil {
+		return 0, 400, "Invalid user ID"
+	}
+	if current, ok := c.Locals("user_id").(float64); ok && uint(current) != uint(userID) {
+		return 0, 403, "You can only manage your own notifications"
+	}
+	return uint(userID), 0, ""
+}
+
+// findUserNotification loads the notification in the id path parameter, or
+// nil when it doesn't exist or belongs to another user than the signed in one
+func findUserNotification(c *fiber.Ctx) *models.Notification {
+	var notification models.Notification
+	if err := database.DB.First(&notification, c.Params("id")).Error; err != nil {
+		return nil
+	}
+	if current, ok := c.Locals("user_id").(float64); ok && uint(current) != notification.UserID {
+		return nil
+	}
+	return &notification
+}
+
 // CreateNotification @Summary Create a notification
-// @Description Createuser
-// @Tags notifi
+// @Description Create a notification for a user and deliver it
+// @Tags notifications
 // @Accept json
 // @Produce json
-// @Param notification body models.Notificatn data"
-// @Success 201 {object} models.
+// @Param notification body models.Notification true "Notification data"
+// @Success 201 {object} map[string]interface{}
 // @Router /notifications [post]
-func CreateNotification(c *fiber.Ctx)or {
-ation
-
-	if err := c.BodyParser(&notification)nil {
-		return c.Status(400).JSON(fibep{
-			"se JSON",
-		)
-}
-
-	// Use notification servation
-	notificationService := services.GetNoce()
-	createdNotification, deliveryResult, err :=ation)
+func CreateNotification(c *fiber.Ctx) error {
+	var notification models.Notification
+	if err := c.BodyParser(&notification); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
 
-	i {
-{
-			"error": "Could not create notificati(),
+	createdNotification, deliveryResult, err := notificationService().CreateNotificationWithDelivery(&notification)
+	if createdNotification == nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not create notification: " + err.Error(),
 		})
 	}
 
 	// Return both notification and delivery result
-	return c.Status(201).ap{
-		"notification"cation,
+	return c.Status(201).JSON(fiber.Map{
+		"notification": createdNotification,
 		"delivery":     deliveryResult,
 	})
 }
 
-// GetUserNotifications @Summary Get user notifns
-// @Description Get all notifiuser
+// GetUserNotifications @Summary Get user notifications
+// @Description Get the notifications in a user's inbox, newest first. Archived notifications are only listed with archived=true.
 // @Tags notifications
-on
+// @Produce json
 // @Param user_id path int true "User ID"
-// @Param unread
-// @Success 200 {array} models.Notification
-//
- {
-	userID := c.Params("user_id")
-	unreadOnly := c.Query("unread_only") == "true"
+// @Param unread_only query boolean false "Show only unread notifications"
+// @Param type query string false "Notification types, comma-separated, e.g. TRIP_DELAYED,ETA_UPDATED"
+// @Param category query string false "Only notifications of a category of types: tracking"
+// @Param archived query boolean false "Show archived notifications instead of the inbox"
+// @Param from query string false "Only notifications from this date (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "Only notifications up to this date (RFC3339 or YYYY-MM-DD)"
+// @Param limit query int false "Number of notifications to return (default 50)"
+// @Param cursor query string false "Cursor from next_cursor of the previous page"
+// @Success 200 {object} map[string]interface{}
+// @Router /users/{user_id}/notifications [get]
+func GetUserNotifications(c *fiber.Ctx) error {
+	userID, status, message := notificationUserID(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
 
-	query := database.DB.Whe
-	if unreadOnly {
-		query = query.Where("is_read = ?", false)
+	page, err := parsePageParams(c, 50)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
 	}
 
+	filter := services.NotificationInboxFilter{
+		UnreadOnly: c.QueryBool("unread_only", false),
+		Archived:   c.QueryBool("archived", false),
+	}
+	if value := c.Query("type"); value != "" {
+		filter.Types = strings.Split(value, ",")
+	}
+	if category := c.Query("category"); category != "" {
+		types, ok := services.NotificationCategories[category]
+		if !ok {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Unknown notification category: " + category,
+			})
+		}
+		filter.Types = append(filter.Types, types...)
+	}
+	if value := c.Query("from"); value != "" {
+		from, err := parseSearchDate(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid from date",
+			})
+		}
+		filter.From = &from
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := parseSearchDate(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid to date",
+			})
+		}
+		if len(value) == len("2006-01-02") {
+			// A date includes the whole day
+			to = to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		filter.To = &to
+	}
 
-	result := query.Order("creat
+	query := notificationService().InboxQuery(userID, filter)
 
+	var total int64
+	query.Session(&gorm.Session{}).Count(&total)
 
+	var notifications []models.Notification
+	if err := page.paginate(query, "created_at").Find(&notifications).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Could not fetch notifications",
 		})
 	}
 
-	return c.JSON(notifications)
+	nextCursor := ""
+	if page.hasMore(len(notifications)) {
+		notifications = notifications[:page.Limit]
+		last := notifications[len(notifications)-1]
+		nextCursor = encodePageCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        notifications,
+		"count":       len(notifications),
+		"total":       total,
+		"limit":       page.Limit,
+		"offset":      page.Offset,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	})
 }
 
-// MarkNotificationAsRead @Summary Maad
-s read
+// GetNotificationSummary @Summary Get a summary of a user's notifications
+// @Description Count a user's notifications in total and for each type, with how many are unread and archived
 // @Tags notifications
-// @Param id path int true "Notificati
-// @Success 200 {object} models.Notif
-// @ad [put]
-furor {
-)
-	var notification models.No
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 200 {object} services.NotificationInboxSummary
+// @Router /users/{user_id}/notifications/summary [get]
+func GetNotificationSummary(c *fiber.Ctx) error {
+	userID, status, message := notificationUserID(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
 
-nil {
-		return c.Status(404).JSON(
-	
+	summary, err := notificationService().GetInboxSummary(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not count notifications",
 		})
 	}
 
-	notification.IsRead =e
-	database.DB.Save(&notification)
+	return c.JSON(summary)
+}
+
+// MarkNotificationAsRead @Summary Mark a notification as read
+// @Description Mark a notification as read
+// @Tags notifications
+// @Produce json
+// @Param id path int true "Notification ID"
+// @Success 200 {object} models.Notification
+// @Router /notifications/{id}/read [put]
+func MarkNotificationAsRead(c *fiber.Ctx) error {
+	return setNotificationRead(c, true)
+}
 
-	return c.JSON(notification)
+// MarkNotificationAsUnread @Summary Mark a notification as unread
+// @Description Mark a notification as unread again
+// @Tags notifications
+// @Produce json
+// @Param id path int true "Notification ID"
+// @Success 200 {object} models.Notification
+// @Router /notifications/{id}/unread [put]
+func MarkNotificationAsUnread(c *fiber.Ctx) error {
+	return setNotificationRead(c, false)
 }
 
-as read
-// @Description Mark all notifications for a user as ad
+// ArchiveNotification @Summary Archive a notification
+// @Description Move a notification out of the inbox, e.g. once it's been dealt with
 // @Tags notifications
-// @Param user_id path in ID"
-ce{}
-// @Router /users/{user_it]
-func MarkAllNotificationsAsRead(c *fib
-	userID := c.Params("user_id")
+// @Produce json
+// @Param id path int true "Notification ID"
+// @Success 200 {object} models.Notification
+// @Router /notifications/{id}/archive [put]
+func ArchiveNotification(c *fiber.Ctx) error {
+	return setNotificationArchived(c, true)
+}
 
-	r{}).
-e).
-		Update("is_read", true)
+// UnarchiveNotification @Summary Unarchive a notification
+// @Description Move an archived notification back to the inbox
+// @Tags notifications
+// @Produce json
+// @Param id path int true "Notification ID"
+// @Success 200 {object} models.Notification
+// @Router /notifications/{id}/unarchive [put]
+func UnarchiveNotification(c *fiber.Ctx) error {
+	return setNotificationArchived(c, false)
+}
 
-	if result.Error != nil {
-		rr.Map{
-	ons",
-})
+// setNotificationArchived archives the notification in the path or moves it
+// back to the inbox
+func setNotificationArchived(c *fiber.Ctx, archived bool) error {
+	notification := findUserNotification(c)
+	if notification == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Notification not found",
+		})
 	}
 
-	return c.JSON(fiber.Mp{
-		"message":       "All notifications marked
-		"updated_count": result.RowsAffected,
-	})
+	if _, err := notificationService().SetNotificationsArchived(notification.UserID, []uint{notification.ID}, archived); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not update notification",
+		})
+	}
+
+	database.DB.First(notification, notification.ID)
+	return c.JSON(notification)
 }
 
-// DeleteNotification @Summary Delete
-on
-// @Tags notifications
-// @Param id path int true "Notificati
-// @Success 200 {object} map[string]sg
-// @e]
-fu
-)
-	var notification models.Notification
+// setNotificationRead sets the read flag of the notification in the path
+func setNotificationRead(c *fiber.Ctx, read bool) error {
+	notification := findUserNotification(c)
+	if notification == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Notification not found",
+		})
+	}
 
-	if err := database.DB.First(&notification, id).E nil {
-		rer.Map{
-	
-})
+	if err := database.DB.Model(notification).Update("is_read", read).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not update notification",
+		})
 	}
 
-	database.DB.Delete(&n
-	return c.JSON(fp{
-		"message": "Notification deleted succes
-	})
+	return c.JSON(notification)
 }
 
-// GetNotificationCounts @Summnts
-ad)
+// MarkAllNotificationsAsRead @Summary Mark all notifications as read
+// @Description Mark all notifications of a user as read, or only those of a type
 // @Tags notifications
-n
-// @Param user_id pD"
-// @Success 200 {object} map[string]interfa
-// @Router /users/{user_id}/not
-func GetNotification
-
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param type query string false "Notification type, e.g. TRIP_DELAYED"
+// @Success 200 {object} map[string]interface{}
+// @Router /users/{user_id}/notifications/read-all [put]
+func MarkAllNotificationsAsRead(c *fiber.Ctx) error {
+	userID, status, message := notificationUserID(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
 
-	var totalCount, unreadCount int64
+	updated, err := notificationService().MarkAllNotificationsRead(userID, c.Query("type"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not update notifications",
+		})
+	}
 
-	// Get total count
-n{}).
-		Where("user_id = ?", userID).
-		Count(&totalCount)
+	return c.JSON(fiber.Map{
+		"message":       "All notifications marked as read",
+		"updated_count": updated,
+	})
+}
 
-	//ount
-	n{}).
-).
-		Count(&unreadCount)
+// BulkNotificationRequest is an action on several notifications of a user.
+// One request changes at most 500 notifications.
+type BulkNotificationRequest struct {
+	Action string `json:"action" validate:"required,oneof=READ UNREAD ARCHIVE UNARCHIVE DELETE"`
+	IDs    []uint `json:"ids" validate:"required,min=1,max=500"`
+}
 
-	return c.JSON(map[string]interface{}{
-		"total_count":  totalCount,
-		"unread_count": unreadCount,
-	})
+// DeviceTokenRequest is a device to send push notifications to
+type DeviceTokenRequest struct {
+	Token      string `json:"token" validate:"required"`
+	DeviceType string `json:"deviceType"`
 }
 
-// RegisterDeviceToken @Summartoken
-// @Description Regis
-//ions
+// BulkUpdateNotifications @Summary Manage several notifications
+// @Description Mark several notifications of a user as read or unread, archive or unarchive them, or delete them. Notifications of other users are ignored.
+// @Tags notifications
 // @Accept json
-/oduce json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param request body BulkNotificationRequest true "Action and notification IDs"
+// @Success 200 {object} map[string]interface{}
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /users/{user_id}/notifications/bulk [post]
+func BulkUpdateNotifications(c *fiber.Ctx) error {
+	userID, status, message := notificationUserID(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
 
-// @Param token body object true "Token data"
-// @Success 200 {object} map[string]string
-// @Router /users/{user_id}/notificat
-func RegisterDeviceTokeor {
-	userID, err := c.ParamsIntid")
+	var req BulkNotificationRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	service := notificationService()
+	var updated int64
+	var err error
+	switch req.Action {
+	case "READ":
+		updated, err = service.SetNotificationsRead(userID, req.IDs, true)
+	case "UNREAD":
+		updated, err = service.SetNotificationsRead(userID, req.IDs, false)
+	case "ARCHIVE":
+		updated, err = service.SetNotificationsArchived(userID, req.IDs, true)
+	case "UNARCHIVE":
+		updated, err = service.SetNotificationsArchived(userID, req.IDs, false)
+	case "DELETE":
+		updated, err = service.DeleteNotifications(userID, req.IDs)
+	}
 	if err != nil {
-		return c.Status(400).JSONer.Map{
-			"error": "InvalidD",
-		)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not update notifications",
+		})
 	}
 
-dy
-	var tokenData struct {
-		Token      string `json:"token"`
-		DeviceType string `json:"deviceType"`
-		Timestamp  string `js
+	return c.JSON(fiber.Map{
+		"action":        req.Action,
+		"updated_count": updated,
+	})
+}
+
+// DeleteNotification @Summary Delete a notification
+// @Description Delete a notification
+// @Tags notifications
+// @Produce json
+// @Param id path int true "Notification ID"
+// @Success 200 {object} map[string]string
+// @Router /notifications/{id} [delete]
+func DeleteNotification(c *fiber.Ctx) error {
+	notification := findUserNotification(c)
+	if notification == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Notification not found",
+		})
 	}
 
-	if err := c.BodyParser(&tokenDa{
-		return c.Status(40ap{
-		SON",
+	if err := database.DB.Delete(notification).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not delete notification",
 		})
 	}
 
-	// Validate token
-	if tokenData.Token == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Token is r,
+	return c.JSON(fiber.Map{
+		"message": "Notification deleted successfully",
+	})
+}
+
+// GetNotificationCounts @Summary Get notification counts
+// @Description Get the total and unread notification counts of a user, with the unread count of each notification type
+// @Tags notifications
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /users/{user_id}/notifications/count [get]
+func GetNotificationCounts(c *fiber.Ctx) error {
+	userID, status, message := notificationUserID(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
 		})
 	}
 
-	// Register token w
-	n()
-	if err := notificationService.RegisterDeviceToil {
-	
+	var totalCount int64
+	if err := database.DB.Model(&models.Notification{}).Where("user_id = ?", userID).Count(&totalCount).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not count notifications",
+		})
+	}
 
+	unreadByType, err := notificationService().GetUnreadCountsByType(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not count notifications",
 		})
 	}
+	var unreadCount int64
+	for _, count := range unreadByType {
+		unreadCount += count
+	}
 
 	return c.JSON(fiber.Map{
-		"message": "Device token registered,
-		"token":   tokenData.n,
+		"total_count":    totalCount,
+		"unread_count":   unreadCount,
+		"unread_by_type": unreadByType,
 	})
 }
 
-// UnregisterDeviceTce token
-//ns
+// RegisterDeviceToken @Summary Register a device token
+// @Description Register a device token for push notifications
 // @Tags notifications
-/ json
-son
+// @Accept json
+// @Produce json
 // @Param user_id path int true "User ID"
-// @Param token body object true "Token data"
+// @Param token body DeviceTokenRequest true "Token data"
 // @Success 200 {object} map[string]string
-// @Router /users/{usere]
-func UnregisterDeviceToken(c {
-	userID, err := c.ParamsInt("user_id")
-	if err != nil {
-		return c.Status(40r.Map{
-		ID",
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /users/{user_id}/notification-tokens [post]
+func RegisterDeviceToken(c *fiber.Ctx) error {
+	userID, status, message := notificationUserID(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
 		})
 	}
 
-	// Parse request body
-	var tokenData struct {
-		Token string `json:"token"`
+	var tokenData DeviceTokenRequest
+	if err := parseBody(c, &tokenData); err != nil {
+		return invalidRequest(c, err)
 	}
 
-	i{
-er.Map{
-			"error": "Cannot parse JSON",
+	if err := notificationService().RegisterDeviceToken(userID, tokenData.Token, tokenData.DeviceType); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not register device token: " + err.Error(),
 		})
 	}
 
-	// Validate token
-	if tokenData.Token  {
-		Map{
-			"error": "Token is required",
-	
+	return c.JSON(fiber.Map{
+		"message": "Device token registered successfully",
+		"token":   tokenData.Token,
+	})
+}
+
+// UnregisterDeviceToken @Summary Unregister a device token
+// @Description Stop sending push notifications to a device
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param token body DeviceTokenRequest true "Token data"
+// @Success 200 {object} map[string]string
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /users/{user_id}/notification-tokens [delete]
+func UnregisterDeviceToken(c *fiber.Ctx) error {
+	userID, status, message := notificationUserID(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
 
+	var tokenData DeviceTokenRequest
+	if err := parseBody(c, &tokenData); err != nil {
+		return invalidRequest(c, err)
+	}
 
-	// Unregister token with notification service
-	notificationService := services.GetNe()
-	if err := notification= nil {
-		return c.Status(500).JSONber.Map{
+	if err := notificationService().UnregisterDeviceToken(userID, tokenData.Token); err != nil {
+		return c.Status(500).JSON(fiber.Map{
 			"error": "Could not unregister device token: " + err.Error(),
 		})
 	}
 
 	return c.JSON(fiber.Map{
-	ly",
+		"message": "Device token unregistered successfully",
 	})
 }
 
-// GetNotificationPreferences @Summarerences
+// GetNotificationPreferences @Summary Get notification preferences
 // @Description Get notification preferences for a user
 // @Tags notifications
 // @Produce json
 // @Param user_id path int true "User ID"
 // @Success 200 {object} models.NotificationPreferences
 // @Router /users/{user_id}/notification-preferences [get]
-fu
-_id")
-	if err != nil {
-		return c.Status(4{
-			"error": "Invalid user ID",
+func GetNotificationPreferences(c *fiber.Ctx) error {
+	userID, status, message := notificationUserID(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
 		})
-}
-
-	// Get preferences from notification ser
-	n
+	}
 
+	preferences, err := notificationService().GetUserNotificationPreferences(userID)
 	if err != nil {
-		return c.Status(500).r.Map{
-			"error": "Could not get notificor(),
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not get notification preferences: " + err.Error(),
 		})
 	}
 
-	r
+	return c.JSON(preferences)
 }
 
-es
+// UpdateNotificationPreferences @Summary Update notification preferences
 // @Description Update notification preferences for a user
 // @Tags notifications
 // @Accept json
 // @Produce json
-// @Param user_id path int true
-// @Param preferences body models.NotificationPrefererences"
-// @Success 200 {object} modelss
-// @Router /users/{uput]
-fu
-	userID, err := c.ParamsInt("user_id")
-	
-{
-			"error": "Invalid user ID",
+// @Param user_id path int true "User ID"
+// @Param preferences body models.NotificationPreferences true "Notification preferences"
+// @Success 200 {object} models.NotificationPreferences
+// @Router /users/{user_id}/notification-preferences [put]
+func UpdateNotificationPreferences(c *fiber.Ctx) error {
+	userID, status, message := notificationUserID(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
 		})
 	}
 
-	// Parse request body
-	var prefereces
-	i {
-
+	var preferences models.NotificationPreferences
+	if err := c.BodyParser(&preferences); err != nil {
+		return c.Status(400).JSON(fiber.Map{
 			"error": "Cannot parse JSON",
 		})
 	}
 
-	// Set user ID
-	preferences.UserID = (userID)
-
-	// Update preferencee
-	no)
-	if err := notificationService.Upda
-		er.Map{
-,
+	if err := notificationService().UpdateUserNotificationPreferences(userID, &preferences); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Could not update notification preferences: " + err.Error(),
 		})
 	}
 
 	return c.JSON(preferences)
 }
 
-
-
-// CreateQuoteNotification creates a noeived
-func CreateQuoteNotificatio
-	notification := models.Notcation{
+// CreateQuoteNotification creates a notification when a quote is received
+func CreateQuoteNotification(shipperID uint, loadID uint) error {
+	notification := models.Notification{
 		UserID:    shipperID,
-		Title:     "New Quote Rec
-		Message:   "You have rece,
+		Title:     "New Quote Received",
+		Message:   "You have received a new quote for your load",
 		Type:      "QUOTE_RECEIVED",
 		RelatedID: loadID,
 	}
-	
-rvice()
-	_, _, err := notification)
+
+	_, _, err := notificationService().CreateNotificationWithDelivery(&notification)
 	return err
 }
 
-/
-
+// CreateBookingNotification creates a notification when a load is booked
+func CreateBookingNotification(carrierID uint, loadID uint) error {
 	notification := models.Notification{
 		UserID:    carrierID,
 		Title:     "Load Booked",
-d",
+		Message:   "A load has been booked on your trip",
 		Type:      "LOAD_BOOKED",
 		RelatedID: loadID,
 	}
-	
-	not
-	_ation)
 
+	_, _, err := notificationService().CreateNotificationWithDelivery(&notification)
+	return err
 }
 
-// CreatePickupNotificaticheduled
+// CreatePickupNotification creates a notification when a pickup is scheduled
 func CreatePickupNotification(shipperID uint, loadID uint) error {
-	notification := models.{
+	notification := models.Notification{
 		UserID:    shipperID,
-		T
-	
+		Title:     "Pickup Scheduled",
+		Message:   "The pickup of your load has been scheduled",
+		Type:      "PICKUP_SCHEDULED",
+		RelatedID: loadID,
+	}
 
-	})
-}eferences,es": prrencfe
-		"preID,":     user	"user_idy",
-	cessfull updated sucenceseferication prNotif":     "		"messagep{
-fiber.MaN(turn c.JSO	}
-
-	re})
-
-		ror(), + err.Ernces: "tion preferee notificadat not up"Couldor": 
-			"errfiber.Map{0).JSON(Status(50	return c.	il {
-rr != nences); eID), &preferusert(ences(uintionPreferNotifica.UpdateUserionServiceotificatr := nf erce()
-	ierviationSicotifces.GetN= serviionService :catfi	notiice
-ation serv notificences with prefer
-	// Updatet(userID)
-erID = uins.UserenceID
-	preft user 
-	// Se	})
-	}
-SON",
-	parse J"Cannot or": "err			fiber.Map{
-SON(tatus(400).J	return c.S	nil {
-r != nces); er&prefereer(Parsrr := c.Body eiferences
-	onPreftificatis.Nos modeleferencey
-	var prst bod reque/ Parse
-
-	/	})
-	}	 ID",
-d user "Invalirror":"e	
-		(fiber.Map{us(400).JSONc.Staturn et	rnil {
-	rr !=  e
-	if"user_id")msInt(Parar := c.D, er{
-	userI error fiber.Ctx)(c *ferencesreonPNotificatirackingUpdateTnc events
-fucking es for tra preferencificationdates notups referenceficationPckingNotieTra/ Updat
-/
-}
-ences,
-	})prefer: "nces	"prefere
-	     userID,user_id":	".Map{
-	JSON(fiberturn c.	}
-
-	re	})
-),
-	rr.Error(es: " + encon preferecati get notifi notould": "C"error	
-		N(fiber.Map{500).JSOatus(n c.St
-		returnil {= f err !ID))
-	is(uint(userncetionPrefereUserNotificarvice.GetnSetioca:= notifies, err 	preferencnService()
-ioGetNotificatvices.rvice := sertionSeficaotiervice
-	nation snotificm erences fro Get pref	//
+	_, _, err := notificationService().CreateNotificationWithDelivery(&notification)
+	return err
+}
 
+// CreateDeliveryNotification creates a notification when a load is delivered
+func CreateDeliveryNotification(shipperID uint, loadID uint) error {
+	notification := models.Notification{
+		UserID:    shipperID,
+		Title:     "Load Delivered",
+		Message:   "Your load has been successfully delivered. Please review the carrier.",
+		Type:      "LOAD_DELIVERED",
+		RelatedID: loadID,
+	}
 
-		})
-	}ser ID",lid unvarror": "I			"ep{
-ON(fiber.Maus(400).JSStatreturn c.il {
-		if err != nd")
-	r_isInt("useram := c.PaerID, err
-	usr {x) erroiber.Ctrences(c *fionPrefecatotifikingNunc GetTracg events
-fckinnces for tra prefereficationes gets notiencferficationPreNotikingGetTrac// 
+	_, _, err := notificationService().CreateNotificationWithDelivery(&notification)
+	return err
 }
 
-urn nilet	}
+// Tracking-specific notification functions
 
-	r
-		}
+// CreateTripDepartureNotification creates a notification when a trip departs
+func CreateTripDepartureNotification(shipperID uint, tripID uint, carrierName string) error {
+	notification := models.Notification{
+		UserID:    shipperID,
+		Title:     "Trip Departed",
+		Message:   "Your shipment with " + carrierName + " has departed and is now in transit.",
+		Type:      "TRIP_DEPARTED",
+		RelatedID: tripID,
+	}
+
+	_, _, err := notificationService().CreateNotificationWithDelivery(&notification)
+	return err
+}
+
+// CreateTripArrivalNotification creates a notification when a trip arrives at destination
+func CreateTripArrivalNotification(shipperID uint, tripID uint, location string) error {
+	notification := models.Notification{
+		UserID:    shipperID,
+		Title:     "Trip Arrived",
+		Message:   "Your shipment has arrived at " + location + ". Delivery is being prepared.",
+		Type:      "TRIP_ARRIVED",
+		RelatedID: tripID,
+	}
+
+	_, _, err := notificationService().CreateNotificationWithDelivery(&notification)
+	return err
+}
+
+// CreateDelayNotification creates a notification when a trip is delayed
+func CreateDelayNotification(userID uint, tripID uint, delayMinutes int, reason string) error {
+	notification := models.Notification{
+		UserID:     userID,
+		MessageKey: "notification.trip_delayed",
+		MessageParams: map[string]interface{}{
+			"minutes": delayMinutes,
+			"reason":  reason,
+		},
+		Type:      "TRIP_DELAYED",
+		RelatedID: tripID,
+	}
+
+	_, _, err := notificationService().CreateNotificationWithDelivery(&notification)
+	return err
+}
+
+// CreateETAUpdateNotification creates a notification when the ETA is updated,
+// telling the time at the trip's destination
+func CreateETAUpdateNotification(shipperID uint, tripID uint, newETA time.Time) error {
+	var trip models.Trip
+	database.DB.Select("id", "destination_timezone").First(&trip, tripID)
+
+	notification := models.Notification{
+		UserID:        shipperID,
+		MessageKey:    "notification.eta_updated",
+		MessageParams: map[string]interface{}{"eta": timezone.In(newETA, trip.DestinationTimezone)},
+		Type:          "ETA_UPDATED",
+		RelatedID:     tripID,
+	}
+
+	_, _, err := notificationService().CreateNotificationWithDelivery(&notification)
 	return err
-		{ nil f err !=n)
-		i&notificatioDelivery(nWithtificatioateNoree.CrvictionSe notificarr :=, e, _		_ce()
-cationServiNotifiservices.GetnService := otificatio
-		
-		n}		D: tripID,
-latedIe,
-			ReationTypficoti n   	Type:  sage,
-		ge:   mes		Messa
-	     title,		Title:erID,
-	oad.ShipprID:    l	Usen{
-		atio.Notific modelson :=	notificati
-	 loads {= rangead :lor _, hipper
-	foeach scations for eate notifi// Cr
-
-	err
-	}	return nil {
-	or; err != &loads).Errind( tripID).F= ?",id e("trip_se.DB.Wherdataba err := Load
-	ifdels.movar loads []	 trip
-on thisoads // Get all lerror {
-	 string) ficationTypeotig, nage string, messitle strinD uint, tnTrip(tripIrsOlShippeNotifyAl
-func  triploads on apers with ip all shtions tocatifirip sends noippersOnTotifyAllSh
-}
-
-// N	return errion)
-notificatvery(&WithDelitionotificaeNvice.CreationSer= notificat err :_, _,e()
-	rvicSeicationtNotifices.Gevice := servificationSer
-	not
-	}
-	 tripID,tedID:",
-		RelaON_UPDATE "LOCATI   e:  n,
-		Typ locatioed " +achs rehipment ha:   "Your sge	Messa
-	",Updatetion     "Loca: 
-		Title shipperID,UserID:   {
-		ification models.Notfication :=notior {
-	tring) errtion s locaD uint,int, tripIipperID uion(shificatateNottionUpdcaeLo
-func Creation updatest locatignificanfor sfication ates a notiation creictifionUpdateNocat
-// CreateLo
-}
-	return errcation)
-&notifiDelivery(ionWithNotificatce.CreateicationServiif:= notrr 	_, _, ee()
-ionServictificatetNo services.GService :=otification
-	
-	n
-	}ID,dID: load		RelateHANGED",
-S_CSTATU   "LOAD_Type:   
-		ssage, me	Message:  te",
-	us Upda Statoad"LTitle:     	,
-	IDhipper  srID:  on{
-		Uses.Notificati= modelation :tificno
-
-	)"
-	}kingRef + "f: " + boo(Re " essage +=" {
-		m != " bookingRef}
-
-	ifs
-	atuewSt+ nted to " da upen betatus hasload sge = "Your 
-		messae == "" { messag]
-	ifwStatusMessages[ne:= statusge 
-	messa",
-	}
- attentiont requiresd thaour loae with ysu is an is     "There  XCEPTION": ,
-		"Edelivered"ccessfully s been suYour load ha"        D":	"DELIVEREvery",
-	t for deliis our load ": "YouOR_DELIVERY	"OUT_Fsit",
-	ranin tcurrently is our load  "Y      ":TRANSIT"IN_t",
-		sin trans now i i and up picked been hasr load"You:        P"PICKED_U
-		"heduled",s been schap d pickuloaD": "Your CHEDULE_SICKUP{
-		"Ptring]stringes := map[statusMessagerror {
-	sg)  strin bookingReftring, newStatus st,D uin, loadIntrID uiion(shippeficatsChangeNotidStatureateLoanc Changes
-fuatus chen load stion w a notificatn createsNotificatioStatusChangeLoad
-
-// Creatern err
-}ion)
-	retunotificaty(&WithDeliveronatireateNotificervice.CcationS notifi :=_, err, 
-	_ice()ervcationSs.GetNotifie := serviceationServic
-	notific	,
-	}
-dID: tripIDlate",
-		ReA_UPDATEDe:      "ETTyp,
-		4 PM")006 at 3:0("Jan 2, 2matFor" + newETA.pdated to n uime has bee tivalated arrs estimipment'sh   "Your essage:ed",
-		MUpdat     "ETA 
-		Title:pperID,  shi:  
-		UserIDtion{otifica models.Nion :=	notificat) error {
-ime.TimeTA tint, newEripID unt, tui(shipperID ontiNotificaTAUpdatenc CreateEpdated
-fuis uA  ETwhentification es a noon creatteNotificatiUpdaeETACreat
-}
-
-// rrreturn eon)
-	otificatiy(&nelivercationWithDtifiice.CreateNoionServotificat _, err := n
-	_,e()tionServictNotificas.Ge= serviceService :tification
-	
-	noripID,
-	}: tRelatedID
-		DELAYED",    "TRIP_pe:  
-		Tyssage,  me	Message: ",
-	 Delayed"Shipment     		Title:D,
-serI    uD:
-		UserItion{ificamodels.Noton := tificati
-
-	noon
-	}+ rease to "  " du	message +="" {
-	= f reason !inutes)
-	iayM", del %d minuteselayed byis dt ipmen("Your sh fmt.Sprintfsage :=	mes) error {
-eason stringes int, r delayMinutripID uint,rID uint, tfication(useNotiateDelayunc Cres delayed
-fip ihen a trion wificat a not createstificationayNoel
-// CreateDn err
-}
-	returtion)
-icavery(&notifWithDeliotificationce.CreateNationServificoti err := n_,
-	_, ce()viSercationtNotifirvices.Ge := seationServicefic	noti	}
-	
-,
-ID: tripIDelated
-		RP_ARRIVED",RI   "Te:   yp	T	,
-prepared."being very is n + ". Delitioloca" + ed at as arrivhipment h"Your s	Message:   	
- Arrived", "Trip	Title:    erID,
-	shipp:    
-		UserIDation{Notificn := models.notificatior {
-	erron string) tioint, locaipID ut, trinerID u(shippionalNotificatipArrivateTrunc Cretion
-fat destinas trip arriveen a whation ficeates a notication crivalNotifieTripArr
-
-// Createturn err
-}	rcation)
-otifielivery(&ncationWithDfiNotireateionService.Ccatfir := noti_, er, e()
-	_rviconSeificatitNotces.Ge := serviiceervcationSnotifi
-	
-	ID,
-	}D: tripRelatedI",
-		ED"TRIP_DEPART:      peTy",
-		 in transit.nowed and is art dep " hasrName + + carrieh "witpment ur shie:   "Yo	Messag
-	ed","Trip Departtle:     	TirID,
-	:    shippeID
-		Useron{tis.Notifica := modelicationifot	n error {
-e string)rrierNamcaint, ID unt, triprID uiion(shippeaticNotifpDeparturereateTrifunc Cdeparts
-en a trip whon notificatites a creaon NotificatipDepartureteTri
-
-// Crea functionsicationcific notif-specking/ Traerr
-}
-
-/	return 
-n)tificatioy(&nonWithDeliverificatioeNotervice.CreatcationS notifi :=	_, _, errervice()
-onSatiotifices.GetN service :=Servicon	notificati}
-	
-ID,
-	ad lo	RelatedID:	",
-D_DELIVERED:      "LOAype.",
-		Tierhe carrreview te red. Pleasdeliveully n successfeead has b"Your lossage:   		Meered",
-"Load Deliv    e: 	Titl
-	shipperID,	UserID:    on{
-	catifi models.Notin :=notificatiorror {
-	int) e uadIDID uint, lohippertion(sificaryNotveCreateDeli
-func livered is de loadwhencation s a notifi createcationfieliveryNoti// CreateDerr
-}
-
-turn reation)
-	ificlivery(&notnWithDeotificatiovice.CreateNficationSernoti, err := 	_, _e()
-ervicificationSvices.GetNotsere := ictionServtifica
-	no
-	}
-	D: loadID,dIelate,
-		RULED"CKUP_SCHED"PI    ype:  		T
\ No newline at end of file
+}
+
+// CreateLoadStatusChangeNotification creates a notification when the load status changes
+func CreateLoadStatusChangeNotification(shipperID uint, loadID uint, newStatus string, bookingRef string) error {
+	statusMessages := map[string]string{
+		"PICKUP_SCHEDULED": "Your load pickup has been scheduled",
+		"PICKED_UP":        "Your load has been picked up and is now in transit",
+		"IN_TRANSIT":       "Your load is currently in transit",
+		"OUT_FOR_DELIVERY": "Your load is out for delivery",
+		"DELIVERED":        "Your load has been successfully delivered",
+		"EXCEPTION":        "There is an issue with your load that requires attention",
+	}
+
+	message := statusMessages[newStatus]
+	if message == "" {
+		message = "Your load status has been updated to " + newStatus
+	}
+	if bookingRef != "" {
+		message += " (Ref: " + bookingRef + ")"
+	}
+
+	notification := models.Notification{
+		UserID:    shipperID,
+		Title:     "Load Status Update",
+		Message:   message,
+		Type:      "LOAD_STATUS_CHANGED",
+		RelatedID: loadID,
+	}
+
+	_, _, err := notificationService().CreateNotificationWithDelivery(&notification)
+	return err
+}
+
+// CreateLocationUpdateNotification creates a notification for significant location updates
+func CreateLocationUpdateNotification(shipperID uint, tripID uint, location string) error {
+	notification := models.Notification{
+		UserID:        shipperID,
+		MessageKey:    "notification.location_update",
+		MessageParams: map[string]interface{}{"location": location},
+		Type:          "LOCATION_UPDATE",
+		RelatedID:     tripID,
+	}
+
+	_, _, err := notificationService().CreateNotificationWithDelivery(&notification)
+	return err
+}
+
+// NotifyAllShippersOnTrip sends notifications to all shippers with loads on a trip
+func NotifyAllShippersOnTrip(tripID uint, title string, message string, notificationType string) error {
+	var loads []models.Load
+	if err := database.DB.Where("trip_id = ?", tripID).Find(&loads).Error; err != nil {
+		return err
+	}
+
+	service := notificationService()
+	for _, load := range loads {
+		notification := models.Notification{
+			UserID:    load.ShipperID,
+			Title:     title,
+			Message:   message,
+			Type:      notificationType,
+			RelatedID: tripID,
+		}
+		if _, _, err := service.CreateNotificationWithDelivery(&notification); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
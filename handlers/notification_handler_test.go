@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
+	"triplink/backend/config"
 	"triplink/backend/models"
+	"triplink/backend/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
@@ -25,12 +29,19 @@ func (suite *NotificationHandlerTestSuite) SetupTest() {
 	seedTestDB()
 	suite.app = fiber.New()
 
+	suite.app.Use(asHeaderUser())
+
 	suite.app.Post("/notifications", CreateNotification)
 	suite.app.Get("/users/:user_id/notifications", GetUserNotifications)
 	suite.app.Put("/notifications/:id/read", MarkNotificationAsRead)
+	suite.app.Put("/notifications/:id/unread", MarkNotificationAsUnread)
 	suite.app.Put("/users/:user_id/notifications/read-all", MarkAllNotificationsAsRead)
 	suite.app.Delete("/notifications/:id", DeleteNotification)
 	suite.app.Get("/users/:user_id/notifications/count", GetNotificationCounts)
+	suite.app.Get("/users/:user_id/notifications/summary", GetNotificationSummary)
+	suite.app.Put("/notifications/:id/archive", ArchiveNotification)
+	suite.app.Put("/notifications/:id/unarchive", UnarchiveNotification)
+	suite.app.Post("/users/:user_id/notifications/bulk", BulkUpdateNotifications)
 }
 
 func (suite *NotificationHandlerTestSuite) TearDownTest() {
@@ -101,6 +112,224 @@ func (suite *NotificationHandlerTestSuite) TestGetNotificationCounts() {
 	assert.Equal(t, 200, resp.StatusCode)
 }
 
+// createNotifications creates notifications of the given types for a user
+func (suite *NotificationHandlerTestSuite) createNotifications(userID uint, types ...string) []models.Notification {
+	notifications := make([]models.Notification, len(types))
+	for i, notificationType := range types {
+		notifications[i] = models.Notification{UserID: userID, Title: "Test", Message: "Test", Type: notificationType}
+		suite.Require().NoError(testDB.Create(&notifications[i]).Error)
+	}
+	return notifications
+}
+
+func (suite *NotificationHandlerTestSuite) request(method, url string, userID uint, body interface{}) (int, map[string]interface{}) {
+	jsonData, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	if userID != 0 {
+		req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	}
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+func (suite *NotificationHandlerTestSuite) TestUnreadCountsByType() {
+	t := suite.T()
+	user := models.User{Email: "counts@example.com", Phone: "+15550000001", Role: "SHIPPER"}
+	testDB.Create(&user)
+	notifications := suite.createNotifications(user.ID, "TRIP_DELAYED", "TRIP_DELAYED", "QUOTE_RECEIVED")
+	testDB.Model(&notifications[2]).Update("is_read", true)
+
+	status, body := suite.request("GET", "/users/"+strconv.Itoa(int(user.ID))+"/notifications/count", user.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(3), body["total_count"])
+	assert.Equal(t, float64(2), body["unread_count"])
+	assert.Equal(t, map[string]interface{}{"TRIP_DELAYED": float64(2)}, body["unread_by_type"])
+}
+
+func (suite *NotificationHandlerTestSuite) TestMarkNotificationAsUnread() {
+	t := suite.T()
+	user := models.User{Email: "unread@example.com", Phone: "+15550000002", Role: "SHIPPER"}
+	testDB.Create(&user)
+	notification := suite.createNotifications(user.ID, "TRIP_DELAYED")[0]
+	url := "/notifications/" + strconv.Itoa(int(notification.ID))
+
+	status, body := suite.request("PUT", url+"/read", user.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, true, body["is_read"])
+
+	status, body = suite.request("PUT", url+"/unread", user.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, false, body["is_read"])
+
+	// Other users' notifications are hidden
+	status, _ = suite.request("PUT", url+"/read", user.ID+1000, nil)
+	assert.Equal(t, 404, status)
+}
+
+func (suite *NotificationHandlerTestSuite) TestBulkUpdateNotifications() {
+	t := suite.T()
+	user := models.User{Email: "bulk@example.com", Phone: "+15550000003", Role: "SHIPPER"}
+	other := models.User{Email: "bulk-other@example.com", Phone: "+15550000004", Role: "SHIPPER"}
+	testDB.Create(&user)
+	testDB.Create(&other)
+	mine := suite.createNotifications(user.ID, "TRIP_DELAYED", "ETA_UPDATED", "QUOTE_RECEIVED")
+	theirs := suite.createNotifications(other.ID, "TRIP_DELAYED")[0]
+	url := "/users/" + strconv.Itoa(int(user.ID)) + "/notifications/bulk"
+
+	status, body := suite.request("POST", url, user.ID, BulkNotificationRequest{
+		Action: "READ", IDs: []uint{mine[0].ID, mine[1].ID, theirs.ID},
+	})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(2), body["updated_count"])
+
+	status, body = suite.request("POST", url, user.ID, BulkNotificationRequest{
+		Action: "DELETE", IDs: []uint{mine[0].ID, theirs.ID},
+	})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(1), body["updated_count"])
+
+	var remaining int64
+	testDB.Model(&models.Notification{}).Where("id = ?", theirs.ID).Count(&remaining)
+	assert.Equal(t, int64(1), remaining)
+
+	status, _ = suite.request("POST", url, user.ID, BulkNotificationRequest{Action: "SNOOZE", IDs: []uint{mine[2].ID}})
+	assert.Equal(t, 422, status)
+
+	// Users can't manage another user's notifications
+	status, _ = suite.request("POST", url, other.ID, BulkNotificationRequest{Action: "READ", IDs: []uint{mine[2].ID}})
+	assert.Equal(t, 403, status)
+}
+
+func (suite *NotificationHandlerTestSuite) TestPushPayloadHasBadgeCount() {
+	t := suite.T()
+	user := models.User{Email: "badge@example.com", Phone: "+15550000005", Role: "SHIPPER"}
+	testDB.Create(&user)
+	notifications := suite.createNotifications(user.ID, "TRIP_DELAYED", "ETA_UPDATED", "QUOTE_RECEIVED")
+	testDB.Model(&notifications[0]).Update("is_read", true)
+
+	payload := services.NewNotificationService(testDB).PrepareNotificationPayload(&notifications[2])
+	assert.Equal(t, int64(2), payload["badge"])
+}
+
+func (suite *NotificationHandlerTestSuite) TestRepeatedNotificationsAreGrouped() {
+	t := suite.T()
+	user := models.User{Email: "grouped@example.com", Phone: "+15550000006", Role: "SHIPPER"}
+	testDB.Create(&user)
+	service := services.NewNotificationService(testDB)
+	service.SetGrouping(&config.NotificationGroupingConfig{Enabled: true, Window: time.Minute})
+	notify := func(relatedID uint, message string) *models.Notification {
+		// Delivery fails without a device token, after the notification is stored
+		notification, _, _ := service.CreateNotificationWithDelivery(&models.Notification{
+			UserID: user.ID, Type: "LOAD_STATUS_CHANGED", RelatedID: relatedID, Title: "Load Status Update", Message: message,
+		})
+		suite.Require().NotNil(notification)
+		return notification
+	}
+
+	first := notify(7, "Your load is now PICKED_UP")
+	grouped := notify(7, "Your load is now IN_TRANSIT")
+	assert.Equal(t, first.ID, grouped.ID)
+	assert.Equal(t, 2, grouped.GroupCount)
+
+	// Other loads aren't grouped with it
+	other := notify(8, "Your load is now PICKED_UP")
+	assert.NotEqual(t, first.ID, other.ID)
+
+	var stored models.Notification
+	testDB.First(&stored, first.ID)
+	assert.Equal(t, "Your load is now IN_TRANSIT", stored.Message)
+	assert.Equal(t, 2, stored.GroupCount)
+
+	// Once read, or outside the window, the next one is new
+	testDB.Model(&stored).Update("is_read", true)
+	assert.NotEqual(t, first.ID, notify(7, "Your load is now DELIVERED").ID)
+	testDB.Model(&models.Notification{}).Where("id = ?", other.ID).Update("created_at", time.Now().Add(-2*time.Minute))
+	assert.NotEqual(t, other.ID, notify(8, "Your load is now IN_TRANSIT").ID)
+
+	var count int64
+	testDB.Model(&models.Notification{}).Where("user_id = ?", user.ID).Count(&count)
+	assert.Equal(t, int64(4), count)
+}
+
+func (suite *NotificationHandlerTestSuite) TestInboxFilters() {
+	t := suite.T()
+	user := models.User{Email: "inbox@example.com", Phone: "+15550000007", Role: "SHIPPER"}
+	testDB.Create(&user)
+	notifications := suite.createNotifications(user.ID, "TRIP_DELAYED", "ETA_UPDATED", "QUOTE_RECEIVED", "NEW_MESSAGE")
+	testDB.Model(&notifications[0]).Update("created_at", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	url := "/users/" + strconv.Itoa(int(user.ID)) + "/notifications"
+
+	ids := func(query string) []float64 {
+		status, body := suite.request("GET", url+query, user.ID, nil)
+		suite.Require().Equal(200, status, body)
+		var ids []float64
+		for _, notification := range body["data"].([]interface{}) {
+			ids = append(ids, notification.(map[string]interface{})["id"].(float64))
+		}
+		return ids
+	}
+	id := func(i int) float64 { return float64(notifications[i].ID) }
+
+	assert.ElementsMatch(t, []float64{id(2), id(3)}, ids("?type=QUOTE_RECEIVED,NEW_MESSAGE"))
+	assert.ElementsMatch(t, []float64{id(0), id(1)}, ids("?category=tracking"))
+	assert.Equal(t, []float64{id(0)}, ids("?from=2024-03-01&to=2024-03-01"))
+	assert.NotContains(t, ids("?from=2024-03-02"), id(0))
+
+	status, _ := suite.request("GET", url+"?category=billing", user.ID, nil)
+	assert.Equal(t, 400, status)
+	status, _ = suite.request("GET", url+"?to=yesterday", user.ID, nil)
+	assert.Equal(t, 400, status)
+}
+
+func (suite *NotificationHandlerTestSuite) TestArchivedNotifications() {
+	t := suite.T()
+	user := models.User{Email: "archive@example.com", Phone: "+15550000008", Role: "SHIPPER"}
+	testDB.Create(&user)
+	notifications := suite.createNotifications(user.ID, "TRIP_DELAYED", "TRIP_DELAYED", "QUOTE_RECEIVED")
+	testDB.Model(&notifications[2]).Update("is_read", true)
+	userURL := "/users/" + strconv.Itoa(int(user.ID))
+
+	status, body := suite.request("PUT", "/notifications/"+strconv.Itoa(int(notifications[0].ID))+"/archive", user.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.NotNil(t, body["archived_at"])
+
+	// Archived notifications leave the inbox and its unread counts
+	_, body = suite.request("GET", userURL+"/notifications", user.ID, nil)
+	assert.Equal(t, float64(2), body["total"])
+	_, body = suite.request("GET", userURL+"/notifications?archived=true", user.ID, nil)
+	assert.Equal(t, float64(1), body["total"])
+	_, body = suite.request("GET", userURL+"/notifications/count", user.ID, nil)
+	assert.Equal(t, float64(1), body["unread_count"])
+
+	status, body = suite.request("GET", userURL+"/notifications/summary", user.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(3), body["total"])
+	assert.Equal(t, float64(1), body["unread"])
+	assert.Equal(t, float64(1), body["archived"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "QUOTE_RECEIVED", "total": float64(1), "unread": float64(0), "archived": float64(0)},
+		map[string]interface{}{"type": "TRIP_DELAYED", "total": float64(2), "unread": float64(1), "archived": float64(1)},
+	}, body["by_type"])
+
+	status, body = suite.request("POST", userURL+"/notifications/bulk", user.ID, BulkNotificationRequest{
+		Action: "UNARCHIVE", IDs: []uint{notifications[0].ID, notifications[1].ID},
+	})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(1), body["updated_count"])
+	_, body = suite.request("GET", userURL+"/notifications", user.ID, nil)
+	assert.Equal(t, float64(3), body["total"])
+
+	// Other users' notifications are hidden
+	status, _ = suite.request("PUT", "/notifications/"+strconv.Itoa(int(notifications[1].ID))+"/archive", user.ID+1000, nil)
+	assert.Equal(t, 404, status)
+}
+
 func TestNotificationHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(NotificationHandlerTestSuite))
 }
\ No newline at end of file
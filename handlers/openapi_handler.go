@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"triplink/backend/docs"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetOpenAPISpec @Summary Get the OpenAPI spec
+// @Description Get the OpenAPI 3 spec of the API, generated from its routes and the annotations of their handlers
+// @Tags docs
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /openapi.json [get]
+func GetOpenAPISpec(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(docs.OpenAPI)
+}
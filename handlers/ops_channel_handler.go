@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"strconv"
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// opsAlertService returns the ops alert service set up at startup. Channels
+// can be managed while alerts are disabled.
+func opsAlertService() *services.OpsAlertService {
+	if service := services.GetOpsAlertService(); service != nil {
+		return service
+	}
+	return services.NewOpsAlertService(database.DB, config.GetOpsAlertConfig())
+}
+
+// opsChannelParams returns the current user and the organization and
+// channel in the path, or the status and message to respond with
+func opsChannelParams(c *fiber.Ctx, withChannel bool) (userID, organizationID, channelID uint, status int, message string) {
+	current, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return 0, 0, 0, 401, "Unauthorized"
+	}
+	organization, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, 0, 0, 400, "Invalid organization ID"
+	}
+	if withChannel {
+		channel, err := strconv.ParseUint(c.Params("channel_id"), 10, 32)
+		if err != nil {
+			return 0, 0, 0, 400, "Invalid channel ID"
+		}
+		channelID = uint(channel)
+	}
+	return uint(current), uint(organization), channelID, 0, ""
+}
+
+// opsChannelErrorStatus maps ops alert service errors to a status
+func opsChannelErrorStatus(err error) int {
+	if err == services.ErrOpsChannelNotFound {
+		return 404
+	}
+	return organizationErrorStatus(err)
+}
+
+// GetOpsChannels @Summary Get an organization's ops channels
+// @Description Get the Slack and Microsoft Teams channels one of the current user's organizations gets ops alerts in
+// @Tags organizations
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Success 200 {array} models.OpsChannel
+// @Router /organizations/{id}/ops-channels [get]
+func GetOpsChannels(c *fiber.Ctx) error {
+	userID, organizationID, _, status, message := opsChannelParams(c, false)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	channels, err := opsAlertService().GetChannels(organizationID, userID)
+	if err != nil {
+		return c.Status(opsChannelErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(channels)
+}
+
+// CreateOpsChannel @Summary Connect an ops channel
+// @Description Connect a Slack or Microsoft Teams incoming webhook to one of the organizations the current user owns. Critical delays, tracking anomalies, load exceptions and failed notifications are posted to it, or only the alert types in event_types, with the message templates in templates replacing the built-in ones.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param channel body services.OpsChannelRequest true "Channel"
+// @Success 201 {object} models.OpsChannel
+// @Router /organizations/{id}/ops-channels [post]
+func CreateOpsChannel(c *fiber.Ctx) error {
+	userID, organizationID, _, status, message := opsChannelParams(c, false)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	var req services.OpsChannelRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	channel, err := opsAlertService().CreateChannel(organizationID, userID, req)
+	if err != nil {
+		return c.Status(opsChannelErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(channel)
+}
+
+// UpdateOpsChannel @Summary Change an ops channel
+// @Description Change an ops channel of one of the organizations the current user owns. The webhook URL is kept when left empty.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param channel_id path int true "Channel ID"
+// @Param channel body services.OpsChannelRequest true "Channel"
+// @Success 200 {object} models.OpsChannel
+// @Router /organizations/{id}/ops-channels/{channel_id} [put]
+func UpdateOpsChannel(c *fiber.Ctx) error {
+	userID, organizationID, channelID, status, message := opsChannelParams(c, true)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	var req services.OpsChannelRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	channel, err := opsAlertService().UpdateChannel(organizationID, userID, channelID, req)
+	if err != nil {
+		return c.Status(opsChannelErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(channel)
+}
+
+// DeleteOpsChannel @Summary Disconnect an ops channel
+// @Description Stop posting ops alerts to a channel of one of the organizations the current user owns
+// @Tags organizations
+// @Param id path int true "Organization ID"
+// @Param channel_id path int true "Channel ID"
+// @Success 204
+// @Router /organizations/{id}/ops-channels/{channel_id} [delete]
+func DeleteOpsChannel(c *fiber.Ctx) error {
+	userID, organizationID, channelID, status, message := opsChannelParams(c, true)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	if err := opsAlertService().DeleteChannel(organizationID, userID, channelID); err != nil {
+		return c.Status(opsChannelErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.SendStatus(204)
+}
+
+// TestOpsChannel @Summary Test an ops channel
+// @Description Post a test alert to a channel of one of the organizations the current user owns
+// @Tags organizations
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param channel_id path int true "Channel ID"
+// @Success 200 {object} models.OpsChannel
+// @Failure 502 {object} map[string]interface{}
+// @Router /organizations/{id}/ops-channels/{channel_id}/test [post]
+func TestOpsChannel(c *fiber.Ctx) error {
+	userID, organizationID, channelID, status, message := opsChannelParams(c, true)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	channel, err := opsAlertService().TestChannel(organizationID, userID, channelID)
+	if channel == nil {
+		return c.Status(opsChannelErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(502).JSON(fiber.Map{
+			"error": "The channel couldn't be posted to: " + err.Error(),
+		})
+	}
+
+	return c.JSON(channel)
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type OpsChannelHandlerTestSuite struct {
+	suite.Suite
+	app          *fiber.App
+	owner        models.User
+	dispatcher   models.User
+	organization models.Organization
+	webhook      *httptest.Server
+	mu           sync.Mutex
+	posts        map[string][]map[string]interface{}
+	failing      bool
+}
+
+func (suite *OpsChannelHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	organizationService = services.NewOrganizationService(testDB)
+	trackingService = services.NewTrackingService(testDB)
+	services.SetOpsAlertService(services.NewOpsAlertService(testDB, &config.OpsAlertConfig{Enabled: true, Timeout: time.Second, AppBaseURL: "https://app.example"}))
+
+	suite.owner = models.User{Email: "ops-owner@haulage.example", Phone: "+15550000811", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.owner)
+	suite.dispatcher = models.User{Email: "ops-dispatch@haulage.example", Phone: "+15550000812", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.dispatcher)
+	suite.organization = models.Organization{Name: "Haulage Co", Type: "CARRIER", OwnerID: suite.owner.ID}
+	testDB.Create(&suite.organization)
+	testDB.Create(&[]models.OrganizationMembership{
+		{OrganizationID: suite.organization.ID, UserID: suite.owner.ID, Role: services.OrganizationOwner},
+		{OrganizationID: suite.organization.ID, UserID: suite.dispatcher.ID, Role: services.OrganizationDispatcher},
+	})
+
+	// Records what's posted to each path, failing while failing is set
+	suite.posts = make(map[string][]map[string]interface{})
+	suite.failing = false
+	suite.webhook = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+		suite.posts[r.URL.Path] = append(suite.posts[r.URL.Path], body)
+		if suite.failing {
+			w.WriteHeader(500)
+		}
+	}))
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Get("/organizations/:id/ops-channels", GetOpsChannels)
+	suite.app.Post("/organizations/:id/ops-channels", CreateOpsChannel)
+	suite.app.Put("/organizations/:id/ops-channels/:channel_id", UpdateOpsChannel)
+	suite.app.Delete("/organizations/:id/ops-channels/:channel_id", DeleteOpsChannel)
+	suite.app.Post("/organizations/:id/ops-channels/:channel_id/test", TestOpsChannel)
+}
+
+func (suite *OpsChannelHandlerTestSuite) TearDownTest() {
+	suite.webhook.Close()
+	services.SetOpsAlertService(nil)
+	clearTestDB()
+}
+
+func (suite *OpsChannelHandlerTestSuite) request(method, path string, userID uint, body interface{}) (int, map[string]interface{}) {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+func (suite *OpsChannelHandlerTestSuite) channelsPath() string {
+	return fmt.Sprintf("/organizations/%d/ops-channels", suite.organization.ID)
+}
+
+// createChannel connects a channel posting to a path of the test webhook
+func (suite *OpsChannelHandlerTestSuite) createChannel(provider, path string, eventTypes []string, templates map[string]string) uint {
+	status, body := suite.request("POST", suite.channelsPath(), suite.owner.ID, services.OpsChannelRequest{
+		Name: provider + " ops", Provider: provider, WebhookURL: suite.webhook.URL + path, EventTypes: eventTypes, Templates: templates,
+	})
+	suite.Require().Equal(201, status, body)
+	return uint(body["id"].(float64))
+}
+
+func (suite *OpsChannelHandlerTestSuite) postsTo(path string) []map[string]interface{} {
+	suite.mu.Lock()
+	defer suite.mu.Unlock()
+	return suite.posts[path]
+}
+
+func (suite *OpsChannelHandlerTestSuite) TestManageChannels() {
+	t := suite.T()
+
+	status, body := suite.request("POST", suite.channelsPath(), suite.owner.ID, services.OpsChannelRequest{
+		Name: "Dispatch", Provider: "slack", WebhookURL: suite.webhook.URL + "/slack", EventTypes: []string{"load_exception", "CRITICAL_DELAY"},
+	})
+	assert.Equal(t, 201, status)
+	assert.Equal(t, "SLACK", body["provider"])
+	assert.Equal(t, []interface{}{"CRITICAL_DELAY", "LOAD_EXCEPTION"}, body["event_types"])
+	assert.Equal(t, true, body["active"])
+	// The webhook URL is a secret
+	assert.NotContains(t, body, "webhook_url")
+	channelPath := fmt.Sprintf("%s/%d", suite.channelsPath(), uint(body["id"].(float64)))
+
+	status, body = suite.request("POST", suite.channelsPath(), suite.owner.ID, services.OpsChannelRequest{Name: "Email", Provider: "EMAIL", WebhookURL: suite.webhook.URL})
+	assert.Equal(t, 400, status)
+	assert.Contains(t, body["error"], "use SLACK or TEAMS")
+	status, _ = suite.request("POST", suite.channelsPath(), suite.owner.ID, services.OpsChannelRequest{Name: "Slack", Provider: "SLACK", WebhookURL: suite.webhook.URL, EventTypes: []string{"EVERYTHING"}})
+	assert.Equal(t, 400, status)
+	status, _ = suite.request("POST", suite.channelsPath(), suite.owner.ID, services.OpsChannelRequest{
+		Name: "Slack", Provider: "SLACK", WebhookURL: suite.webhook.URL, Templates: map[string]string{"CRITICAL_DELAY": "{{.Data"},
+	})
+	assert.Equal(t, 400, status)
+
+	// Updates keep the webhook URL when it's left out
+	status, body = suite.request("PUT", channelPath, suite.owner.ID, services.OpsChannelRequest{Name: "Dispatch", Provider: "SLACK"})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, []interface{}{}, body["event_types"])
+	var channel models.OpsChannel
+	testDB.First(&channel, uint(body["id"].(float64)))
+	assert.Equal(t, suite.webhook.URL+"/slack", channel.WebhookURL)
+
+	// Only owners manage channels
+	status, _ = suite.request("GET", suite.channelsPath(), suite.dispatcher.ID, nil)
+	assert.Equal(t, 403, status)
+	status, _ = suite.request("DELETE", channelPath, suite.dispatcher.ID, nil)
+	assert.Equal(t, 403, status)
+
+	status, _ = suite.request("DELETE", channelPath, suite.owner.ID, nil)
+	assert.Equal(t, 204, status)
+	status, _ = suite.request("PUT", channelPath, suite.owner.ID, services.OpsChannelRequest{Name: "Dispatch", Provider: "SLACK"})
+	assert.Equal(t, 404, status)
+}
+
+func (suite *OpsChannelHandlerTestSuite) TestAlertsAreRoutedByType() {
+	t := suite.T()
+	suite.createChannel("SLACK", "/slack", []string{"LOAD_EXCEPTION"}, nil)
+	suite.createChannel("TEAMS", "/teams", nil, map[string]string{"CRITICAL_DELAY": "Late: trip {{.TripID}} by {{.Data.delay_minutes}} min"})
+
+	trip := models.Trip{UserID: suite.owner.ID, OrganizationID: &suite.organization.ID, Status: "IN_TRANSIT", DepartureDate: time.Now().Add(-8 * time.Hour), EstimatedArrival: time.Now().Add(-3 * time.Hour)}
+	testDB.Create(&trip)
+	load := models.Load{TripID: trip.ID, ShipperID: suite.owner.ID, BookingReference: "OPS-1", Status: "PICKED_UP"}
+	testDB.Create(&load)
+
+	_, err := trackingService.ChangeLoadStatus(load.ID, "EXCEPTION", nil)
+	suite.Require().NoError(err)
+	slack := suite.postsTo("/slack")
+	if assert.Len(t, slack, 1) {
+		assert.Equal(t, fmt.Sprintf("*Load exception*\nLoad OPS-1 on trip %d was PICKED_UP and is now an exception\n<https://app.example/trips/%d|Open in TripLink>", trip.ID, trip.ID), slack[0]["text"])
+	}
+
+	suite.Require().NoError(trackingService.ProcessDelayAlerts(trip.ID))
+	// Only the Teams channel gets delays, with its own template
+	assert.Len(t, suite.postsTo("/slack"), 1)
+	teams := suite.postsTo("/teams")
+	if assert.Len(t, teams, 2) {
+		assert.Equal(t, "MessageCard", teams[1]["@type"])
+		assert.Equal(t, "Critical delay", teams[1]["title"])
+		assert.Regexp(t, fmt.Sprintf(`^Late: trip %d by 1[89]\d min$`, trip.ID), teams[1]["text"])
+	}
+
+	// Trips outside an organization have no channels
+	other := models.Trip{UserID: suite.owner.ID, Status: "IN_TRANSIT", DepartureDate: time.Now(), EstimatedArrival: time.Now().Add(-3 * time.Hour)}
+	testDB.Create(&other)
+	suite.Require().NoError(trackingService.ProcessDelayAlerts(other.ID))
+	assert.Len(t, suite.postsTo("/teams"), 2)
+}
+
+func (suite *OpsChannelHandlerTestSuite) TestChannelTest() {
+	t := suite.T()
+	channelID := suite.createChannel("SLACK", "/slack", []string{"LOAD_EXCEPTION"}, nil)
+	path := fmt.Sprintf("%s/%d/test", suite.channelsPath(), channelID)
+
+	status, body := suite.request("POST", path, suite.owner.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.NotNil(t, body["last_sent_at"])
+	if posts := suite.postsTo("/slack"); assert.Len(t, posts, 1) {
+		assert.Equal(t, "*TripLink alerts connected*\nHaulage Co will get LOAD_EXCEPTION alerts in this channel", posts[0]["text"])
+	}
+
+	suite.mu.Lock()
+	suite.failing = true
+	suite.mu.Unlock()
+	status, body = suite.request("POST", path, suite.owner.ID, nil)
+	assert.Equal(t, 502, status)
+	assert.Contains(t, body["error"], "status 500")
+	var channel models.OpsChannel
+	testDB.First(&channel, channelID)
+	assert.Equal(t, "webhook responded with status 500", channel.LastError)
+}
+
+func TestOpsChannelHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(OpsChannelHandlerTestSuite))
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"strconv"
+	"triplink/backend/database"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var organizationService = services.NewOrganizationService(database.DB)
+
+// dispatchesTrip reports whether a user manages a trip as an owner or
+// dispatcher of the organization it belongs to
+func dispatchesTrip(trip *models.Trip, userID uint) bool {
+	return trip.OrganizationID != nil && organizationService.CanDispatch(*trip.OrganizationID, userID)
+}
+
+// tenantDB returns the request's database session, whose reads of trips and
+// loads only return those the current user can see, or false when the tenant
+// middleware didn't run
+func tenantDB(c *fiber.Ctx) (*gorm.DB, bool) {
+	ctx := c.UserContext()
+	if _, ok := services.TenantScopeFromContext(ctx); !ok {
+		return nil, false
+	}
+	return database.DB.WithContext(ctx), true
+}
+
+// organizationErrorStatus maps organization service errors to a status
+func organizationErrorStatus(err error) int {
+	switch err {
+	case services.ErrOrganizationNotFound, services.ErrOrganizationMemberNotFound:
+		return 404
+	case services.ErrNotOrganizationOwner:
+		return 403
+	}
+	return 400
+}
+
+// CreateOrganization @Summary Create an organization
+// @Description Create a carrier or shipper organization owned by the current user. Trips and loads created by its owners and dispatchers belong to it and are shared with its members.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param organization body services.OrganizationRequest true "Organization"
+// @Success 201 {object} models.Organization
+// @Router /organizations [post]
+func CreateOrganization(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req services.OrganizationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	organization, err := organizationService.CreateOrganization(uint(userID), req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(organization)
+}
+
+// GetOrganizations @Summary Get the current user's organizations
+// @Description Get the organizations the current user is a member of, by name
+// @Tags organizations
+// @Produce json
+// @Success 200 {array} models.Organization
+// @Router /organizations [get]
+func GetOrganizations(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	organizations, err := organizationService.GetUserOrganizations(uint(userID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch organizations",
+		})
+	}
+
+	return c.JSON(organizations)
+}
+
+// GetOrganization @Summary Get an organization
+// @Description Get one of the current user's organizations with its members
+// @Tags organizations
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Success 200 {object} models.Organization
+// @Router /organizations/{id} [get]
+func GetOrganization(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	organizationID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid organization ID",
+		})
+	}
+
+	organization, err := organizationService.GetOrganization(uint(organizationID), uint(userID))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(organization)
+}
+
+// UpdateOrganization @Summary Rename an organization
+// @Description Rename one of the organizations the current user owns
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param organization body services.OrganizationRequest true "Organization"
+// @Success 200 {object} models.Organization
+// @Router /organizations/{id} [put]
+func UpdateOrganization(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	organizationID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid organization ID",
+		})
+	}
+
+	var req services.OrganizationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	organization, err := organizationService.UpdateOrganization(uint(organizationID), uint(userID), req)
+	if err != nil {
+		return c.Status(organizationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(organization)
+}
+
+// AddOrganizationMember @Summary Add an organization member
+// @Description Add a user, by ID or email, to one of the organizations the current user owns with the role OWNER, DISPATCHER, DRIVER or FINANCE
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param member body services.MembershipRequest true "Member"
+// @Success 201 {object} models.OrganizationMembership
+// @Router /organizations/{id}/members [post]
+func AddOrganizationMember(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	organizationID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid organization ID",
+		})
+	}
+
+	var req services.MembershipRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	membership, err := organizationService.AddMember(uint(organizationID), uint(userID), req)
+	if err != nil {
+		return c.Status(organizationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(membership)
+}
+
+// UpdateOrganizationMember @Summary Change an organization member's role
+// @Description Change the role of a member of one of the organizations the current user owns. The last owner can't be demoted.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param user_id path int true "Member's user ID"
+// @Param member body services.MembershipRequest true "Member (role)"
+// @Success 200 {object} models.OrganizationMembership
+// @Router /organizations/{id}/members/{user_id} [put]
+func UpdateOrganizationMember(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	organizationID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid organization ID",
+		})
+	}
+	memberID, err := strconv.ParseUint(c.Params("user_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var req services.MembershipRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	membership, err := organizationService.UpdateMember(uint(organizationID), uint(userID), uint(memberID), req.Role)
+	if err != nil {
+		return c.Status(organizationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(membership)
+}
+
+// RemoveOrganizationMember @Summary Remove an organization member
+// @Description Remove a member from one of the organizations the current user owns, or leave an organization by removing oneself. The last owner can't be removed.
+// @Tags organizations
+// @Param id path int true "Organization ID"
+// @Param user_id path int true "Member's user ID"
+// @Success 204
+// @Router /organizations/{id}/members/{user_id} [delete]
+func RemoveOrganizationMember(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	organizationID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid organization ID",
+		})
+	}
+	memberID, err := strconv.ParseUint(c.Params("user_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if err := organizationService.RemoveMember(uint(organizationID), uint(userID), uint(memberID)); err != nil {
+		return c.Status(organizationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.SendStatus(204)
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+)
+
+type OrganizationHandlerTestSuite struct {
+	suite.Suite
+	app        *fiber.App
+	owner      models.User
+	dispatcher models.User
+	finance    models.User
+	driver     models.User
+	outsider   models.User
+}
+
+func (suite *OrganizationHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	organizationService = services.NewOrganizationService(testDB)
+	workspaceService = services.NewWorkspaceService(testDB)
+	tripAssignmentService = services.NewTripAssignmentService(testDB)
+	trackingService = services.NewTrackingService(testDB)
+	analyticsService = services.NewAnalyticsService(testDB)
+
+	suite.owner = models.User{Email: "owner@haulage.example", Phone: "+15550000020", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.owner)
+	suite.dispatcher = models.User{Email: "dispatch@haulage.example", Phone: "+15550000021", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.dispatcher)
+	suite.finance = models.User{Email: "finance@haulage.example", Phone: "+15550000022", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.finance)
+	suite.driver = models.User{Email: "driver@haulage.example", Phone: "+15550000023", Password: "password", Role: "DRIVER"}
+	testDB.Create(&suite.driver)
+	suite.outsider = models.User{Email: "other@example.com", Phone: "+15550000024", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.outsider)
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Post("/organizations", CreateOrganization)
+	suite.app.Get("/organizations", GetOrganizations)
+	suite.app.Get("/organizations/:id", GetOrganization)
+	suite.app.Put("/organizations/:id", UpdateOrganization)
+	suite.app.Post("/organizations/:id/members", AddOrganizationMember)
+	suite.app.Put("/organizations/:id/members/:user_id", UpdateOrganizationMember)
+	suite.app.Delete("/organizations/:id/members/:user_id", RemoveOrganizationMember)
+	suite.app.Post("/trips", CreateTrip)
+	suite.app.Post("/loads", CreateLoad)
+	suite.app.Post("/trips/:trip_id/assignments", AssignTripDriver)
+	suite.app.Get("/users/:user_id/tracking/carrier-view", GetCarrierTrackingView)
+	suite.app.Get("/users/:user_id/tracking/shipper-view", GetShipperTrackingView)
+	suite.app.Post("/analytics/load-matching", GetLoadMatchingAnalytics)
+}
+
+func (suite *OrganizationHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *OrganizationHandlerTestSuite) request(method, path string, userID uint, body interface{}, out interface{}) int {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+// createCarrier creates the owner's carrier organization with a dispatcher,
+// a finance member and a driver
+func (suite *OrganizationHandlerTestSuite) createCarrier() models.Organization {
+	var organization models.Organization
+	status := suite.request("POST", "/organizations", suite.owner.ID, fiber.Map{"name": "Haulage Co", "type": "carrier"}, &organization)
+	suite.Require().Equal(201, status)
+
+	members := []fiber.Map{
+		{"email": suite.dispatcher.Email, "role": "DISPATCHER"},
+		{"user_id": suite.finance.ID, "role": "FINANCE"},
+		{"user_id": suite.driver.ID, "role": "DRIVER"},
+	}
+	for _, member := range members {
+		status := suite.request("POST", fmt.Sprintf("/organizations/%d/members", organization.ID), suite.owner.ID, member, nil)
+		suite.Require().Equal(201, status)
+	}
+	return organization
+}
+
+func (suite *OrganizationHandlerTestSuite) TestManageMembers() {
+	organization := suite.createCarrier()
+	path := fmt.Sprintf("/organizations/%d", organization.ID)
+	suite.Equal(services.OrganizationCarrier, organization.Type)
+
+	var fetched models.Organization
+	status := suite.request("GET", path, suite.finance.ID, nil, &fetched)
+	suite.Equal(200, status)
+	suite.Require().Len(fetched.Members, 4)
+	suite.Equal(services.OrganizationOwner, fetched.Members[0].Role)
+	if suite.NotNil(fetched.Members[1].User) {
+		suite.Equal(suite.dispatcher.Email, fetched.Members[1].User.Email)
+	}
+
+	var organizations []models.Organization
+	suite.request("GET", "/organizations", suite.driver.ID, nil, &organizations)
+	suite.Len(organizations, 1)
+
+	// Outsiders can't see the organization, and only owners change it
+	status = suite.request("GET", path, suite.outsider.ID, nil, nil)
+	suite.Equal(404, status)
+	status = suite.request("PUT", path, suite.dispatcher.ID, fiber.Map{"name": "Dispatch Co"}, nil)
+	suite.Equal(403, status)
+	status = suite.request("POST", path+"/members", suite.dispatcher.ID, fiber.Map{"user_id": suite.outsider.ID, "role": "DRIVER"}, nil)
+	suite.Equal(403, status)
+	status = suite.request("POST", path+"/members", suite.owner.ID, fiber.Map{"user_id": suite.driver.ID, "role": "DRIVER"}, nil)
+	suite.Equal(400, status)
+	status = suite.request("POST", path+"/members", suite.owner.ID, fiber.Map{"user_id": suite.outsider.ID, "role": "MANAGER"}, nil)
+	suite.Equal(400, status)
+
+	// The last owner can't step down or leave
+	status = suite.request("PUT", fmt.Sprintf("%s/members/%d", path, suite.owner.ID), suite.owner.ID, fiber.Map{"role": "DISPATCHER"}, nil)
+	suite.Equal(400, status)
+	status = suite.request("DELETE", fmt.Sprintf("%s/members/%d", path, suite.owner.ID), suite.owner.ID, nil, nil)
+	suite.Equal(400, status)
+
+	var promoted models.OrganizationMembership
+	status = suite.request("PUT", fmt.Sprintf("%s/members/%d", path, suite.dispatcher.ID), suite.owner.ID, fiber.Map{"role": "owner"}, &promoted)
+	suite.Equal(200, status)
+	suite.Equal(services.OrganizationOwner, promoted.Role)
+	status = suite.request("DELETE", fmt.Sprintf("%s/members/%d", path, suite.owner.ID), suite.owner.ID, nil, nil)
+	suite.Equal(204, status)
+
+	// Members can leave on their own
+	status = suite.request("DELETE", fmt.Sprintf("%s/members/%d", path, suite.finance.ID), suite.finance.ID, nil, nil)
+	suite.Equal(204, status)
+	status = suite.request("GET", path, suite.finance.ID, nil, nil)
+	suite.Equal(404, status)
+}
+
+func (suite *OrganizationHandlerTestSuite) TestTripsSharedWithMembers() {
+	organization := suite.createCarrier()
+	trip := fiber.Map{
+		"origin_address":      "Harare",
+		"origin_lat":          -17.83,
+		"origin_lng":          31.05,
+		"destination_address": "Bulawayo",
+		"destination_lat":     -20.15,
+		"destination_lng":     28.58,
+		"status":              "PLANNED",
+		"departure_date":      time.Now().Add(24 * time.Hour),
+		"estimated_arrival":   time.Now().Add(30 * time.Hour),
+	}
+
+	// Trips dispatchers create belong to their organization
+	var created models.Trip
+	status := suite.request("POST", "/trips", suite.dispatcher.ID, trip, &created)
+	suite.Require().Equal(200, status)
+	if suite.NotNil(created.OrganizationID) {
+		suite.Equal(organization.ID, *created.OrganizationID)
+	}
+	var own models.Trip
+	status = suite.request("POST", "/trips", suite.outsider.ID, trip, &own)
+	suite.Require().Equal(200, status)
+	suite.Nil(own.OrganizationID)
+
+	// Finance members can't add trips to the organization
+	trip["organization_id"] = organization.ID
+	status = suite.request("POST", "/trips", suite.finance.ID, trip, nil)
+	suite.Equal(400, status)
+
+	// The owner dispatches the dispatcher's trip
+	status = suite.request("POST", fmt.Sprintf("/trips/%d/assignments", created.ID), suite.owner.ID, fiber.Map{"driver_id": suite.driver.ID}, nil)
+	suite.Equal(201, status)
+	status = suite.request("POST", fmt.Sprintf("/trips/%d/assignments", created.ID), suite.outsider.ID, fiber.Map{"driver_id": suite.driver.ID}, nil)
+	suite.Equal(403, status)
+
+	tripIDs := func(userID uint) []uint {
+		var view struct {
+			Trips []map[string]interface{} `json:"tracking_data"`
+		}
+		status := suite.request("GET", fmt.Sprintf("/users/%d/tracking/carrier-view", userID), userID, nil, &view)
+		suite.Equal(200, status)
+		var ids []uint
+		for _, trip := range view.Trips {
+			ids = append(ids, uint(trip["trip_id"].(float64)))
+		}
+		return ids
+	}
+	suite.Equal([]uint{created.ID}, tripIDs(suite.owner.ID))
+	suite.Equal([]uint{created.ID}, tripIDs(suite.finance.ID))
+	suite.Equal([]uint{own.ID}, tripIDs(suite.outsider.ID))
+	// Drivers only see the trips they are assigned to
+	suite.Equal([]uint{created.ID}, tripIDs(suite.driver.ID))
+}
+
+func (suite *OrganizationHandlerTestSuite) TestLoadsSharedWithMembers() {
+	shipper := models.User{Email: "shipper@imports.example", Phone: "+15550000025", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&shipper)
+	colleague := models.User{Email: "finance@imports.example", Phone: "+15550000026", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&colleague)
+
+	var organization models.Organization
+	status := suite.request("POST", "/organizations", shipper.ID, fiber.Map{"name": "Imports Ltd", "type": "SHIPPER"}, &organization)
+	suite.Require().Equal(201, status)
+	status = suite.request("POST", fmt.Sprintf("/organizations/%d/members", organization.ID), shipper.ID, fiber.Map{"user_id": colleague.ID, "role": "FINANCE"}, nil)
+	suite.Require().Equal(201, status)
+
+	var load models.Load
+	status = suite.request("POST", "/loads", shipper.ID, fiber.Map{
+		"shipper_id":       shipper.ID,
+		"description":      "Machine parts",
+		"weight":           500,
+		"pickup_address":   "Harare",
+		"pickup_lat":       -17.83,
+		"pickup_lng":       31.05,
+		"delivery_address": "Bulawayo",
+		"delivery_lat":     -20.15,
+		"delivery_lng":     28.58,
+		"status":           "PENDING",
+	}, &load)
+	suite.Require().Equal(200, status)
+	if suite.NotNil(load.OrganizationID) {
+		suite.Equal(organization.ID, *load.OrganizationID)
+	}
+	testDB.Create(&models.Load{ShipperID: suite.outsider.ID, BookingReference: "OTHER-1", Status: "PENDING"})
+
+	var view struct {
+		Loads []map[string]interface{} `json:"tracking_data"`
+	}
+	status = suite.request("GET", fmt.Sprintf("/users/%d/tracking/shipper-view", colleague.ID), colleague.ID, nil, &view)
+	suite.Equal(200, status)
+	if suite.Len(view.Loads, 1) {
+		suite.Equal(float64(load.ID), view.Loads[0]["load_id"])
+	}
+
+	// Analytics cover the organization's loads only
+	var metrics services.LoadMatchingMetrics
+	status = suite.request("POST", "/analytics/load-matching", colleague.ID, fiber.Map{}, &metrics)
+	suite.Equal(200, status)
+	suite.Equal(1, metrics.TotalLoads)
+	status = suite.request("POST", "/analytics/load-matching", suite.outsider.ID, fiber.Map{}, &metrics)
+	suite.Equal(200, status)
+	suite.Equal(1, metrics.TotalLoads)
+}
+
+func TestOrganizationHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(OrganizationHandlerTestSuite))
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// maxPageLimit caps the page size of paginated endpoints
+const maxPageLimit = 500
+
+// pageCursor marks the position after the last item of a page, for lists
+// ordered newest first by a timestamp column with the ID as tie-breaker
+type pageCursor struct {
+	Timestamp time.Time
+	ID        uint
+}
+
+// encodePageCursor encodes a cursor as an opaque URL-safe string
+func encodePageCursor(timestamp time.Time, id uint) string {
+	raw := fmt.Sprintf("%d:%d", timestamp.UnixNano(), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodePageCursor decodes a cursor produced by encodePageCursor
+func decodePageCursor(value string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("invalid cursor")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	return &pageCursor{Timestamp: time.Unix(0, nanos), ID: uint(id)}, nil
+}
+
+// pageParams holds the pagination query parameters of a request. Cursor
+// pagination is used when a cursor is given, otherwise limit/offset.
+type pageParams struct {
+	Limit  int
+	Offset int
+	Cursor *pageCursor
+}
+
+// parsePageParams reads the limit, offset and cursor query parameters
+func parsePageParams(c *fiber.Ctx, defaultLimit int) (pageParams, error) {
+	params := pageParams{
+		Limit:  c.QueryInt("limit", defaultLimit),
+		Offset: c.QueryInt("offset", 0),
+	}
+	if params.Limit <= 0 {
+		params.Limit = defaultLimit
+	}
+	if params.Limit > maxPageLimit {
+		params.Limit = maxPageLimit
+	}
+	if params.Offset < 0 {
+		params.Offset = 0
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodePageCursor(value)
+		if err != nil {
+			return params, err
+		}
+		params.Cursor = cursor
+		params.Offset = 0
+	}
+	return params, nil
+}
+
+// paginate orders query newest first by timeColumn and applies the cursor or
+// offset. One extra row is fetched so callers can tell if there is a next page.
+func (p pageParams) paginate(query *gorm.DB, timeColumn string) *gorm.DB {
+	if p.Cursor != nil {
+		query = query.Where(fmt.Sprintf("(%s < ?) OR (%s = ? AND id < ?)", timeColumn, timeColumn),
+			p.Cursor.Timestamp, p.Cursor.Timestamp, p.Cursor.ID)
+	} else if p.Offset > 0 {
+		query = query.Offset(p.Offset)
+	}
+	return query.Order(timeColumn + " DESC").Order("id DESC").Limit(p.Limit + 1)
+}
+
+// hasMore reports whether a page fetched with paginate has a next page
+func (p pageParams) hasMore(fetched int) bool {
+	return fetched > p.Limit
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"strconv"
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var paymentService = services.NewPaymentService(database.DB, config.GetPaymentConfig())
+
+// ChargeLoadPayment @Summary Pay for a load
+// @Description Charge the shipper of a booked load the agreed price through a payment gateway. Only the load's shipper can pay for it.
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param load_id path int true "Load ID"
+// @Param payment body map[string]string true "Payment data (gateway, payment_method, payment_method_id)"
+// @Success 201 {object} models.Transaction
+// @Router /loads/{load_id}/payments [post]
+func ChargeLoadPayment(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	loadID, err := strconv.ParseUint(c.Params("load_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid load ID",
+		})
+	}
+
+	var paymentData struct {
+		Gateway         string `json:"gateway"`
+		PaymentMethod   string `json:"payment_method"`
+		PaymentMethodID string `json:"payment_method_id"`
+	}
+	if err := c.BodyParser(&paymentData); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse payment data",
+		})
+	}
+	if paymentData.Gateway == "" {
+		paymentData.Gateway = "STRIPE"
+	}
+	if paymentData.PaymentMethod == "" {
+		paymentData.PaymentMethod = "CARD"
+	}
+
+	// Verify load exists
+	var load models.Load
+	if err := database.DB.First(&load, uint(loadID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Load not found",
+		})
+	}
+	if load.ShipperID != uint(userID) {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "Only the load's shipper can pay for it",
+		})
+	}
+
+	transaction, err := paymentService.ChargeLoad(uint(loadID), paymentData.Gateway, paymentData.PaymentMethod, paymentData.PaymentMethodID)
+	if err != nil {
+		response := fiber.Map{
+			"error": "Payment failed: " + err.Error(),
+		}
+		if transaction != nil {
+			response["transaction"] = transaction
+		}
+		return c.Status(400).JSON(response)
+	}
+
+	return c.Status(201).JSON(transaction)
+}
+
+// RefundLoadPayment @Summary Refund a load payment
+// @Description Refund all or part of the completed payment for a load. Only the carrier paid for the load and admins can refund it.
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param load_id path int true "Load ID"
+// @Param refund body map[string]float64 false "Refund data (amount, omit for a full refund)"
+// @Success 200 {object} models.Transaction
+// @Router /loads/{load_id}/refunds [post]
+func RefundLoadPayment(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	loadID, err := strconv.ParseUint(c.Params("load_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid load ID",
+		})
+	}
+
+	var refundData struct {
+		Amount float64 `json:"amount"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&refundData); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Cannot parse refund data",
+			})
+		}
+	}
+	if refundData.Amount < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Refund amount cannot be negative",
+		})
+	}
+
+	var payment models.Transaction
+	if err := database.DB.Where("load_id = ? AND status = ?", uint(loadID), "COMPLETED").
+		Order("created_at DESC").
+		First(&payment).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "No completed payment found for load",
+		})
+	}
+	if payment.PayeeID != uint(userID) {
+		var user models.User
+		if err := database.DB.Select("role").First(&user, uint(userID)).Error; err != nil || user.Role != "ADMIN" {
+			return c.Status(403).JSON(fiber.Map{
+				"error": "Only the carrier paid for the load and admins can refund it",
+			})
+		}
+	}
+
+	transaction, err := paymentService.RefundLoadPayment(uint(loadID), refundData.Amount)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Refund failed: " + err.Error(),
+		})
+	}
+
+	return c.JSON(transaction)
+}
+
+// StripeWebhook @Summary Stripe webhook
+// @Description Receive Stripe payment events and update transaction status
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /payments/webhooks/stripe [post]
+func StripeWebhook(c *fiber.Ctx) error {
+	if err := paymentService.HandleWebhook("STRIPE", c.Body(), c.Get("Stripe-Signature")); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"received": true,
+	})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// fakePaymentGateway completes every charge and refund immediately
+type fakePaymentGateway struct{}
+
+func (g *fakePaymentGateway) Name() string { return "FAKE" }
+
+func (g *fakePaymentGateway) CreateCharge(request services.ChargeRequest) (*services.ChargeResult, error) {
+	return &services.ChargeResult{GatewayTxnID: "fake_" + request.IdempotencyKey, Status: "COMPLETED"}, nil
+}
+
+func (g *fakePaymentGateway) Refund(gatewayTxnID string, amount float64) (*services.RefundResult, error) {
+	return &services.RefundResult{GatewayRefundID: "fake_refund", Amount: amount}, nil
+}
+
+func (g *fakePaymentGateway) ParseWebhook(payload []byte, signature string) (*services.PaymentWebhookEvent, error) {
+	return &services.PaymentWebhookEvent{}, nil
+}
+
+type PaymentHandlerTestSuite struct {
+	suite.Suite
+	app             *fiber.App
+	previousService *services.PaymentService
+	shipper         models.User
+	carrier         models.User
+	admin           models.User
+}
+
+func (suite *PaymentHandlerTestSuite) SetupSuite() {
+	suite.previousService = paymentService
+	paymentService = services.NewPaymentService(testDB, config.GetPaymentConfig())
+	paymentService.RegisterGateway(&fakePaymentGateway{})
+}
+
+func (suite *PaymentHandlerTestSuite) TearDownSuite() {
+	paymentService = suite.previousService
+}
+
+func (suite *PaymentHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+
+	// The seeded load is carried on a trip of another carrier
+	testDB.Where("email = ?", "test@example.com").First(&suite.shipper)
+	suite.carrier = models.User{Email: "carrier@example.com", Phone: "+1555000111", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.carrier)
+	suite.admin = models.User{Email: "admin@example.com", Phone: "+1555000222", Password: "password", Role: "ADMIN"}
+	testDB.Create(&suite.admin)
+	testDB.Model(&models.Trip{}).Where("user_id = ?", suite.shipper.ID).Update("user_id", suite.carrier.ID)
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+
+	suite.app.Post("/loads/:load_id/payments", ChargeLoadPayment)
+	suite.app.Post("/loads/:load_id/refunds", RefundLoadPayment)
+	suite.app.Post("/payments/webhooks/stripe", StripeWebhook)
+}
+
+func (suite *PaymentHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *PaymentHandlerTestSuite) TestChargeAndRefundLoadPayment() {
+	t := suite.T()
+
+	var load models.Load
+	testDB.Where("booking_reference = ?", "TEST-LOAD-001").First(&load)
+	testDB.Model(&load).Update("agreed_price", 500.00)
+	testDB.Where("load_id = ?", load.ID).Delete(&models.Transaction{})
+	loadID := fmt.Sprint(load.ID)
+
+	tests := []struct {
+		name           string
+		path           string
+		userID         uint
+		body           map[string]interface{}
+		expectedStatus int
+	}{
+		{"Refund before payment", "/loads/" + loadID + "/refunds", suite.carrier.ID, map[string]interface{}{}, 404},
+		{"Unconfigured gateway", "/loads/" + loadID + "/payments", suite.shipper.ID, map[string]interface{}{"gateway": "PAYPAL"}, 400},
+		{"Charge by the carrier", "/loads/" + loadID + "/payments", suite.carrier.ID, map[string]interface{}{"gateway": "FAKE"}, 403},
+		{"Successful charge", "/loads/" + loadID + "/payments", suite.shipper.ID, map[string]interface{}{"gateway": "FAKE", "payment_method_id": "pm_card"}, 201},
+		{"Duplicate charge", "/loads/" + loadID + "/payments", suite.shipper.ID, map[string]interface{}{"gateway": "FAKE"}, 400},
+		{"Refund by the shipper", "/loads/" + loadID + "/refunds", suite.shipper.ID, map[string]interface{}{"amount": 100.00}, 403},
+		{"Refund exceeding balance", "/loads/" + loadID + "/refunds", suite.carrier.ID, map[string]interface{}{"amount": 1000.00}, 400},
+		{"Partial refund", "/loads/" + loadID + "/refunds", suite.carrier.ID, map[string]interface{}{"amount": 60.00}, 200},
+		{"Partial refund by an admin", "/loads/" + loadID + "/refunds", suite.admin.ID, map[string]interface{}{"amount": 40.00}, 200},
+		{"Load not found", "/loads/999999/payments", suite.shipper.ID, map[string]interface{}{"gateway": "FAKE"}, 404},
+		{"Invalid load ID", "/loads/invalid/payments", suite.shipper.ID, map[string]interface{}{}, 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonData, _ := json.Marshal(tt.body)
+			req := httptest.NewRequest("POST", tt.path, bytes.NewBuffer(jsonData))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-User-ID", fmt.Sprint(tt.userID))
+
+			resp, err := suite.app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+
+	var transaction models.Transaction
+	testDB.Where("load_id = ?", load.ID).First(&transaction)
+	assert.Equal(t, "COMPLETED", transaction.Status)
+	assert.Equal(t, 100.00, transaction.RefundedAmount)
+	assert.Equal(t, 25.00, transaction.PlatformFee)
+}
+
+func (suite *PaymentHandlerTestSuite) TestStripeWebhookWithoutGateway() {
+	t := suite.T()
+
+	req := httptest.NewRequest("POST", "/payments/webhooks/stripe", bytes.NewBufferString(`{"type":"payment_intent.succeeded"}`))
+	req.Header.Set("Stripe-Signature", "t=0,v1=invalid")
+
+	resp, err := suite.app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestPaymentHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(PaymentHandlerTestSuite))
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var phoneVerificationService = services.NewPhoneVerificationService(database.DB, config.GetSMSConfig())
+
+// StartPhoneVerification @Summary Send a phone verification code
+// @Description Text a six digit code to the current user's phone number. The number must be verified before SMS notifications are sent to it.
+// @Tags users
+// @Produce json
+// @Success 202 {object} map[string]interface{}
+// @Router /users/me/phone/verification [post]
+func StartPhoneVerification(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	verification, err := phoneVerificationService.StartVerification(uint(userID))
+	if err != nil {
+		status := 500
+		switch err {
+		case services.ErrInvalidPhoneNumber, services.ErrPhoneAlreadyVerified:
+			status = 400
+		case services.ErrVerificationCodeRecentlySent:
+			status = 429
+		case services.ErrPhoneVerificationUnavailable:
+			status = 503
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"message":    "Verification code sent",
+		"phone":      verification.Phone,
+		"expires_at": verification.ExpiresAt,
+	})
+}
+
+// PhoneVerificationRequest is the code texted to the phone being verified
+type PhoneVerificationRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// ConfirmPhoneVerification @Summary Confirm a phone verification code
+// @Description Verify the current user's phone number with the code texted to it
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param code body PhoneVerificationRequest true "Verification code"
+// @Success 200 {object} models.User
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /users/me/phone/verify [post]
+func ConfirmPhoneVerification(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req PhoneVerificationRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	user, err := phoneVerificationService.ConfirmVerification(uint(userID), req.Code)
+	if err != nil {
+		status := 500
+		switch err {
+		case services.ErrInvalidVerificationCode:
+			status = 400
+		case services.ErrTooManyVerificationAttempts:
+			status = 429
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(user)
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// recordingSMSSender keeps the text messages it is asked to send
+type recordingSMSSender struct {
+	to     []string
+	bodies []string
+}
+
+func (s *recordingSMSSender) Send(to, body string) error {
+	s.to = append(s.to, to)
+	s.bodies = append(s.bodies, body)
+	return nil
+}
+
+type PhoneVerificationHandlerTestSuite struct {
+	suite.Suite
+	app    *fiber.App
+	sender *recordingSMSSender
+	user   models.User
+}
+
+func (suite *PhoneVerificationHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+	suite.user = models.User{}
+	suite.Require().NoError(testDB.Where("email = ?", "test@example.com").First(&suite.user).Error)
+
+	suite.sender = &recordingSMSSender{}
+	phoneVerificationService = services.NewPhoneVerificationService(testDB, &config.SMSConfig{
+		VerificationCodeTTL:     10 * time.Minute,
+		VerificationMaxAttempts: 3,
+		VerificationResendAfter: time.Minute,
+	})
+	phoneVerificationService.SetSMSSender(suite.sender)
+
+	suite.app = fiber.New()
+
+	suite.app.Use(asHeaderUser())
+
+	suite.app.Post("/users/me/phone/verification", StartPhoneVerification)
+	suite.app.Post("/users/me/phone/verify", ConfirmPhoneVerification)
+}
+
+func (suite *PhoneVerificationHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *PhoneVerificationHandlerTestSuite) request(url string, body interface{}) (int, []byte) {
+	jsonData, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(suite.user.ID)))
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var respBody bytes.Buffer
+	respBody.ReadFrom(resp.Body)
+	return resp.StatusCode, respBody.Bytes()
+}
+
+// sentCode returns the verification code in the last message sent
+func (suite *PhoneVerificationHandlerTestSuite) sentCode() string {
+	suite.Require().NotEmpty(suite.sender.bodies)
+	code := regexp.MustCompile(`\d{6}`).FindString(suite.sender.bodies[len(suite.sender.bodies)-1])
+	suite.Require().NotEmpty(code)
+	return code
+}
+
+func (suite *PhoneVerificationHandlerTestSuite) TestVerifyPhone() {
+	status, _ := suite.request("/users/me/phone/verification", nil)
+	assert.Equal(suite.T(), 202, status)
+	assert.Equal(suite.T(), []string{suite.user.Phone}, suite.sender.to)
+
+	var verification models.PhoneVerification
+	suite.Require().NoError(testDB.Where("user_id = ?", suite.user.ID).First(&verification).Error)
+	assert.NotContains(suite.T(), verification.CodeHash, suite.sentCode())
+
+	status, body := suite.request("/users/me/phone/verify", map[string]string{"code": suite.sentCode()})
+	assert.Equal(suite.T(), 200, status)
+
+	var user models.User
+	suite.Require().NoError(json.Unmarshal(body, &user))
+	assert.NotNil(suite.T(), user.PhoneVerifiedAt)
+
+	// A verified number isn't sent another code
+	status, _ = suite.request("/users/me/phone/verification", nil)
+	assert.Equal(suite.T(), 400, status)
+}
+
+func (suite *PhoneVerificationHandlerTestSuite) TestWrongCodeAttemptsAreLimited() {
+	status, _ := suite.request("/users/me/phone/verification", nil)
+	suite.Require().Equal(202, status)
+	code := suite.sentCode()
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < 3; i++ {
+		status, _ = suite.request("/users/me/phone/verify", map[string]string{"code": wrong})
+		assert.Equal(suite.T(), 400, status)
+	}
+
+	// The right code no longer works once the attempts are used up
+	status, _ = suite.request("/users/me/phone/verify", map[string]string{"code": code})
+	assert.Equal(suite.T(), 429, status)
+
+	var user models.User
+	testDB.First(&user, suite.user.ID)
+	assert.Nil(suite.T(), user.PhoneVerifiedAt)
+}
+
+func (suite *PhoneVerificationHandlerTestSuite) TestResendIsRateLimited() {
+	status, _ := suite.request("/users/me/phone/verification", nil)
+	suite.Require().Equal(202, status)
+
+	status, _ = suite.request("/users/me/phone/verification", nil)
+	assert.Equal(suite.T(), 429, status)
+	assert.Len(suite.T(), suite.sender.bodies, 1)
+}
+
+func (suite *PhoneVerificationHandlerTestSuite) TestInvalidPhoneNumber() {
+	testDB.Model(&suite.user).Update("phone", "555-0100")
+
+	status, _ := suite.request("/users/me/phone/verification", nil)
+	assert.Equal(suite.T(), 400, status)
+	assert.Empty(suite.T(), suite.sender.bodies)
+}
+
+func (suite *PhoneVerificationHandlerTestSuite) TestSMSIsOptInAndNeedsVerifiedPhone() {
+	notificationService := services.NewNotificationService(testDB)
+	provider, err := services.NewSMSNotificationProviderWithSender(suite.sender, "https://app.triplink.app")
+	suite.Require().NoError(err)
+	notificationService.RegisterSMSProvider(provider)
+
+	delay := func() {
+		notificationService.CreateNotificationWithDelivery(&models.Notification{
+			UserID: suite.user.ID, Title: "Trip Delayed", Message: "Your shipment is running 45 minutes late",
+			Type: "DELAY_ALERT", RelatedID: 7,
+		})
+	}
+
+	// Not opted in
+	delay()
+	assert.Empty(suite.T(), suite.sender.bodies)
+
+	preferences, err := notificationService.GetUserNotificationPreferences(suite.user.ID)
+	suite.Require().NoError(err)
+	preferences.SMSEnabled = true
+	suite.Require().NoError(notificationService.UpdateUserNotificationPreferences(suite.user.ID, preferences))
+
+	// Opted in, but the phone number isn't verified
+	delay()
+	assert.Empty(suite.T(), suite.sender.bodies)
+
+	now := time.Now()
+	testDB.Model(&suite.user).Update("phone_verified_at", &now)
+	delay()
+	suite.Require().Len(suite.sender.bodies, 1)
+	assert.Equal(suite.T(), suite.user.Phone, suite.sender.to[0])
+	assert.Contains(suite.T(), suite.sender.bodies[0], "TripLink delay alert: Your shipment is running 45 minutes late")
+	assert.Contains(suite.T(), suite.sender.bodies[0], "https://app.triplink.app/trips/7")
+
+	// Other notification types aren't texted
+	notificationService.CreateNotificationWithDelivery(&models.Notification{
+		UserID: suite.user.ID, Title: "Quote", Message: "New quote", Type: "QUOTE_RECEIVED",
+	})
+	assert.Len(suite.T(), suite.sender.bodies, 1)
+
+	// Opting out is saved
+	preferences.SMSEnabled = false
+	suite.Require().NoError(notificationService.UpdateUserNotificationPreferences(suite.user.ID, preferences))
+	delay()
+	assert.Len(suite.T(), suite.sender.bodies, 1)
+}
+
+func (suite *PhoneVerificationHandlerTestSuite) TestPickupReminders() {
+	var trip models.Trip
+	suite.Require().NoError(testDB.First(&trip).Error)
+
+	due := models.Load{ShipperID: suite.user.ID, TripID: trip.ID, BookingReference: "PICKUP-DUE", Status: "BOOKED",
+		PickupAddress: "12 Dock Rd", RequestedPickupDate: time.Now().Add(time.Hour), RequestedDeliveryDate: time.Now().Add(48 * time.Hour)}
+	later := models.Load{ShipperID: suite.user.ID, TripID: trip.ID, BookingReference: "PICKUP-LATER", Status: "BOOKED",
+		RequestedPickupDate: time.Now().Add(5 * time.Hour), RequestedDeliveryDate: time.Now().Add(48 * time.Hour)}
+	testDB.Create(&due)
+	testDB.Create(&later)
+
+	reminders := services.NewPickupReminderService(testDB, services.NewNotificationService(testDB), 2*time.Hour)
+	suite.Require().NoError(reminders.SendPickupReminders())
+	suite.Require().NoError(reminders.SendPickupReminders())
+
+	var notifications []models.Notification
+	testDB.Where("type = ?", "PICKUP_REMINDER").Find(&notifications)
+	suite.Require().Len(notifications, 1)
+	assert.Equal(suite.T(), trip.UserID, notifications[0].UserID)
+	assert.Equal(suite.T(), due.ID, notifications[0].RelatedID)
+	assert.Contains(suite.T(), notifications[0].Message, "PICKUP-DUE")
+	assert.Contains(suite.T(), notifications[0].Message, "12 Dock Rd")
+
+	testDB.First(&due, due.ID)
+	assert.NotNil(suite.T(), due.PickupReminderSentAt)
+}
+
+func TestPhoneVerificationHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(PhoneVerificationHandlerTestSuite))
+}
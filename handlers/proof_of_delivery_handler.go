@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"io"
+	"strconv"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var storageConfig = config.GetStorageConfig()
+
+var proofService = services.NewProofOfDeliveryService(database.DB, services.NewFileStorage(storageConfig), storageConfig.MaxUploadSize)
+
+// UploadLoadProof @Summary Upload proof of pickup or delivery
+// @Description Upload a photo or e-signature for a load. Only the carrier of the load's trip and its assigned drivers can upload proofs. The first delivery proof marks the load as delivered.
+// @Tags load-tracking
+// @Accept multipart/form-data
+// @Produce json
+// @Param load_id path int true "Load ID"
+// @Param file formData file true "Photo or signature image (JPEG, PNG or WebP)"
+// @Param stage formData string true "PICKUP or DELIVERY"
+// @Param kind formData string true "PHOTO or SIGNATURE"
+// @Param signed_by formData string false "Name of the person who signed (required for signatures)"
+// @Param latitude formData number false "Latitude where the proof was captured"
+// @Param longitude formData number false "Longitude where the proof was captured"
+// @Param captured_at formData string false "Capture time (RFC3339, default now)"
+// @Success 201 {object} services.ProofUploadResult
+// @Router /loads/{load_id}/proofs [post]
+func UploadLoadProof(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	loadID, err := strconv.ParseUint(c.Params("load_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid load ID",
+		})
+	}
+
+	// Verify load exists and the user carries or drives its trip
+	var load models.Load
+	if err := database.DB.First(&load, uint(loadID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Load not found",
+		})
+	}
+	var trip models.Trip
+	if load.TripID == 0 || database.DB.First(&trip, load.TripID).Error != nil ||
+		(trip.UserID != uint(userID) && !dispatchesTrip(&trip, uint(userID)) &&
+			!tripAssignmentService.IsAssigned(trip.ID, uint(userID), time.Now())) {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "Only the trip's carrier and assigned drivers can upload proofs",
+		})
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "File is required",
+		})
+	}
+	if fileHeader.Size > storageConfig.MaxUploadSize {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "File is too large",
+		})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot read file",
+		})
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, storageConfig.MaxUploadSize+1))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot read file",
+		})
+	}
+
+	upload := services.ProofUpload{
+		Stage:      c.FormValue("stage"),
+		Kind:       c.FormValue("kind"),
+		Data:       data,
+		SignedBy:   c.FormValue("signed_by"),
+		UploadedBy: uint(userID),
+	}
+	if lat, err := strconv.ParseFloat(c.FormValue("latitude"), 64); err == nil {
+		upload.Latitude = &lat
+	}
+	if lng, err := strconv.ParseFloat(c.FormValue("longitude"), 64); err == nil {
+		upload.Longitude = &lng
+	}
+	if capturedAt := c.FormValue("captured_at"); capturedAt != "" {
+		parsed, err := time.Parse(time.RFC3339, capturedAt)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid captured_at, expected RFC3339",
+			})
+		}
+		upload.CapturedAt = parsed
+	}
+
+	result, err := proofService.UploadProof(uint(loadID), upload)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if result.Delivered {
+		triggerService := services.NewNotificationTriggerService(database.DB)
+		triggerService.LoadStatusChangeHandler(uint(loadID), result.PreviousStatus, result.LoadStatus)
+	}
+
+	return c.Status(201).JSON(result)
+}
+
+// GetLoadProofs @Summary Get load proofs
+// @Description Get the proof of pickup and delivery photos and signatures of a load the current user can see
+// @Tags load-tracking
+// @Produce json
+// @Param load_id path int true "Load ID"
+// @Success 200 {array} models.LoadProof
+// @Router /loads/{load_id}/proofs [get]
+func GetLoadProofs(c *fiber.Ctx) error {
+	loadID, err := strconv.ParseUint(c.Params("load_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid load ID",
+		})
+	}
+
+	db, ok := tenantDB(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+	if err := db.Select("id").First(&models.Load{}, uint(loadID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Load not found",
+		})
+	}
+
+	proofs, err := proofService.GetLoadProofs(uint(loadID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get proofs",
+		})
+	}
+
+	return c.JSON(proofs)
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/middleware"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// testPNG is the PNG file signature followed by filler, enough for content type detection
+var testPNG = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+
+type ProofOfDeliveryHandlerTestSuite struct {
+	suite.Suite
+	app *fiber.App
+}
+
+func (suite *ProofOfDeliveryHandlerTestSuite) SetupSuite() {
+	storage := services.NewLocalFileStorage(suite.T().TempDir(), "/uploads")
+	proofService = services.NewProofOfDeliveryService(testDB, storage, 1024*1024)
+	organizationService = services.NewOrganizationService(testDB)
+	tripAssignmentService = services.NewTripAssignmentService(testDB)
+	registerTenantScope(suite.T())
+}
+
+func (suite *ProofOfDeliveryHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+	suite.app = fiber.New()
+
+	suite.app.Use(asHeaderUser())
+
+	suite.app.Post("/loads/:load_id/proofs", UploadLoadProof)
+	suite.app.Get("/loads/:load_id/proofs", middleware.NewTenantMiddleware(testDB).Scope(), GetLoadProofs)
+}
+
+// upload posts a proof as a user, or without one for a user ID of 0
+func (suite *ProofOfDeliveryHandlerTestSuite) upload(path string, userID uint, fields map[string]string, file []byte) int {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, value := range fields {
+		writer.WriteField(key, value)
+	}
+	if file != nil {
+		part, _ := writer.CreateFormFile("file", "proof.png")
+		part.Write(file)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest("POST", path, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if userID != 0 {
+		req.Header.Set("X-User-ID", fmt.Sprint(userID))
+	}
+
+	resp, err := suite.app.Test(req)
+	suite.Require().NoError(err)
+	return resp.StatusCode
+}
+
+func (suite *ProofOfDeliveryHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *ProofOfDeliveryHandlerTestSuite) TestUploadLoadProof() {
+	t := suite.T()
+
+	var load models.Load
+	testDB.Where("booking_reference = ?", "TEST-LOAD-001").First(&load)
+	loadID := fmt.Sprint(load.ID)
+	var trip models.Trip
+	testDB.First(&trip, load.TripID)
+
+	tests := []struct {
+		name           string
+		path           string
+		fields         map[string]string
+		file           []byte
+		expectedStatus int
+	}{
+		{"Pickup photo", "/loads/" + loadID + "/proofs", map[string]string{"stage": "PICKUP", "kind": "PHOTO"}, testPNG, 201},
+		{"Signature without signer", "/loads/" + loadID + "/proofs", map[string]string{"stage": "DELIVERY", "kind": "SIGNATURE"}, testPNG, 400},
+		{"Unsupported file type", "/loads/" + loadID + "/proofs", map[string]string{"stage": "DELIVERY", "kind": "PHOTO"}, []byte("plain text"), 400},
+		{"Invalid stage", "/loads/" + loadID + "/proofs", map[string]string{"stage": "TRANSIT", "kind": "PHOTO"}, testPNG, 400},
+		{"Delivery signature", "/loads/" + loadID + "/proofs", map[string]string{"stage": "DELIVERY", "kind": "SIGNATURE", "signed_by": "Jane Doe", "latitude": "39.9526", "longitude": "-75.1652"}, testPNG, 201},
+		{"Missing file", "/loads/" + loadID + "/proofs", map[string]string{"stage": "DELIVERY", "kind": "PHOTO"}, nil, 400},
+		{"Load not found", "/loads/999999/proofs", map[string]string{"stage": "DELIVERY", "kind": "PHOTO"}, testPNG, 404},
+		{"Invalid load ID", "/loads/invalid/proofs", map[string]string{"stage": "DELIVERY", "kind": "PHOTO"}, testPNG, 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedStatus, suite.upload(tt.path, trip.UserID, tt.fields, tt.file))
+		})
+	}
+
+	// The delivery signature marks the load delivered and creates a tracking event
+	testDB.First(&load, load.ID)
+	assert.Equal(t, "DELIVERED", load.Status)
+	assert.NotEmpty(t, load.PickupProof)
+	assert.NotEmpty(t, load.DeliveryProof)
+	assert.NotNil(t, load.ActualDeliveryDate)
+
+	var eventCount int64
+	testDB.Model(&models.TrackingEvent{}).Where("load_id = ? AND event_type = ?", load.ID, "LOAD_DELIVERED").Count(&eventCount)
+	assert.Equal(t, int64(1), eventCount)
+
+	req := httptest.NewRequest("GET", "/loads/"+loadID+"/proofs", nil)
+	req.Header.Set("X-User-ID", fmt.Sprint(trip.UserID))
+	resp, err := suite.app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var proofs []models.LoadProof
+	json.NewDecoder(resp.Body).Decode(&proofs)
+	assert.Len(t, proofs, 2)
+}
+
+func (suite *ProofOfDeliveryHandlerTestSuite) TestOnlyTripDriversUploadProofs() {
+	t := suite.T()
+
+	var load models.Load
+	testDB.Where("booking_reference = ?", "TEST-LOAD-001").First(&load)
+	path := fmt.Sprintf("/loads/%d/proofs", load.ID)
+	delivery := map[string]string{"stage": "DELIVERY", "kind": "SIGNATURE", "signed_by": "Jane Doe"}
+
+	outsider := models.User{Email: "outsider@example.com", Phone: "+1555000111", Password: "password", Role: "CARRIER"}
+	testDB.Create(&outsider)
+	driver := models.User{Email: "driver@example.com", Phone: "+1555000222", Password: "password", Role: "DRIVER"}
+	testDB.Create(&driver)
+
+	// Others can neither deliver the load nor see its proofs
+	assert.Equal(t, 403, suite.upload(path, outsider.ID, delivery, testPNG))
+	testDB.First(&load, load.ID)
+	assert.NotEqual(t, "DELIVERED", load.Status)
+	assert.Equal(t, 401, suite.upload(path, 0, delivery, testPNG))
+
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("X-User-ID", fmt.Sprint(outsider.ID))
+	resp, err := suite.app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+
+	// A driver assigned to the trip can
+	testDB.Create(&models.TripAssignment{TripID: load.TripID, DriverID: driver.ID, AssignedBy: driver.ID, StartsAt: time.Now().Add(-time.Hour)})
+	assert.Equal(t, 201, suite.upload(path, driver.ID, delivery, testPNG))
+	testDB.First(&load, load.ID)
+	assert.Equal(t, "DELIVERED", load.Status)
+}
+
+func TestProofOfDeliveryHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(ProofOfDeliveryHandlerTestSuite))
+}
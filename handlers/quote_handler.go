@@ -1,15 +1,17 @@
 package handlers
 
 import (
+	"strconv"
 	"time"
 	"triplink/backend/database"
 	"triplink/backend/models"
+	"triplink/backend/services"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 // CreateQuote @Summary Create a quote
-// @Description Create a new quote for a load
+// @Description Create a new pending quote for a load, optionally for a specific trip
 // @Tags quotes
 // @Accept json
 // @Produce json
@@ -25,12 +27,10 @@ func CreateQuote(c *fiber.Ctx) error {
 		})
 	}
 
-	quote.Status = "PENDING"
-
-	result := database.DB.Create(&quote)
-	if result.Error != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Could not create quote",
+	quoteService := services.NewQuoteService(database.DB)
+	if err := quoteService.CreateQuote(&quote); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Could not create quote: " + err.Error(),
 		})
 	}
 
@@ -38,7 +38,7 @@ func CreateQuote(c *fiber.Ctx) error {
 }
 
 // GetLoadQuotes @Summary Get quotes for a load
-// @Description Get all quotes for a specific load
+// @Description Get all quotes for a load the current user can see
 // @Tags quotes
 // @Produce json
 // @Param load_id path int true "Load ID"
@@ -46,9 +46,18 @@ func CreateQuote(c *fiber.Ctx) error {
 // @Router /loads/{load_id}/quotes [get]
 func GetLoadQuotes(c *fiber.Ctx) error {
 	loadID := c.Params("load_id")
+
+	// Verify the load exists and the user can see it
+	db := database.DB.WithContext(c.UserContext())
+	if err := db.Select("id").First(&models.Load{}, loadID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Load not found",
+		})
+	}
+
 	var quotes []models.Quote
 
-	result := database.DB.Where("load_id = ?", loadID).
+	result := db.Where("load_id = ?", loadID).
 		Preload("Carrier").
 		Order("created_at DESC").
 		Find(&quotes)
@@ -88,77 +97,81 @@ func GetCarrierQuotes(c *fiber.Ctx) error {
 }
 
 // AcceptQuote @Summary Accept a quote
-// @Description Accept a quote and create a booking
+// @Description Accept a quote, book the load onto the trip and reserve the trip capacity
 // @Tags quotes
 // @Param id path int true "Quote ID"
 // @Success 200 {object} models.Quote
 // @Router /quotes/{id}/accept [post]
 func AcceptQuote(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var quote models.Quote
+	quoteID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid quote ID",
+		})
+	}
 
-	if err := database.DB.First(&quote, id).Error; err != nil {
+	var quote models.Quote
+	if err := database.DB.First(&quote, uint(quoteID)).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Quote not found",
 		})
 	}
 
-	if quote.Status != "PENDING" {
+	quoteService := services.NewQuoteService(database.DB)
+	accepted, err := quoteService.AcceptQuote(uint(quoteID))
+	if err != nil {
 		return c.Status(400).JSON(fiber.Map{
-			"error": "Quote is no longer available",
+			"error": "Could not accept quote: " + err.Error(),
 		})
 	}
 
-	if time.Now().After(quote.ValidUntil) {
+	return c.JSON(accepted)
+}
+
+// CounterQuote @Summary Counter a quote
+// @Description Replace a pending quote with a counter-offer from the other party
+// @Tags quotes
+// @Accept json
+// @Produce json
+// @Param id path int true "Quote ID"
+// @Param counter body map[string]interface{} true "Counter-offer (quote_amount, notes, valid_until)"
+// @Success 201 {object} models.Quote
+// @Router /quotes/{id}/counter [post]
+func CounterQuote(c *fiber.Ctx) error {
+	quoteID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
 		return c.Status(400).JSON(fiber.Map{
-			"error": "Quote has expired",
+			"error": "Invalid quote ID",
 		})
 	}
 
-	// Start transaction
-	tx := database.DB.Begin()
-
-	// Update quote status
-	now := time.Now()
-	quote.Status = "ACCEPTED"
-	quote.AcceptedAt = &now
-	if err := tx.Save(&quote).Error; err != nil {
-		tx.Rollback()
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Could not accept quote",
-		})
+	var counterData struct {
+		QuoteAmount float64    `json:"quote_amount"`
+		Notes       string     `json:"notes"`
+		ValidUntil  *time.Time `json:"valid_until"`
 	}
-
-	// Update load status and agreed price
-	var load models.Load
-	if err := tx.First(&load, quote.LoadID).Error; err != nil {
-		tx.Rollback()
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Load not found",
+	if err := c.BodyParser(&counterData); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
 		})
 	}
 
-	load.Status = "BOOKED"
-	load.AgreedPrice = quote.QuoteAmount
-	if err := tx.Save(&load).Error; err != nil {
-		tx.Rollback()
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Could not update load",
+	var quote models.Quote
+	if err := database.DB.First(&quote, uint(quoteID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Quote not found",
 		})
 	}
 
-	// Reject other pending quotes for this load
-	if err := tx.Model(&models.Quote{}).
-		Where("load_id = ? AND id != ? AND status = ?", quote.LoadID, quote.ID, "PENDING").
-		Update("status", "REJECTED").Error; err != nil {
-		tx.Rollback()
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Could not reject other quotes",
+	quoteService := services.NewQuoteService(database.DB)
+	counter, err := quoteService.CounterQuote(uint(quoteID), counterData.QuoteAmount, counterData.Notes, counterData.ValidUntil)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Could not counter quote: " + err.Error(),
 		})
 	}
 
-	tx.Commit()
-	return c.JSON(quote)
+	return c.Status(201).JSON(counter)
 }
 
 // RejectQuote @Summary Reject a quote
@@ -168,25 +181,29 @@ func AcceptQuote(c *fiber.Ctx) error {
 // @Success 200 {object} models.Quote
 // @Router /quotes/{id}/reject [post]
 func RejectQuote(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var quote models.Quote
+	quoteID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid quote ID",
+		})
+	}
 
-	if err := database.DB.First(&quote, id).Error; err != nil {
+	var quote models.Quote
+	if err := database.DB.First(&quote, uint(quoteID)).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Quote not found",
 		})
 	}
 
-	if quote.Status != "PENDING" {
+	quoteService := services.NewQuoteService(database.DB)
+	rejected, err := quoteService.RejectQuote(uint(quoteID))
+	if err != nil {
 		return c.Status(400).JSON(fiber.Map{
-			"error": "Quote cannot be rejected",
+			"error": err.Error(),
 		})
 	}
 
-	quote.Status = "REJECTED"
-	database.DB.Save(&quote)
-
-	return c.JSON(quote)
+	return c.JSON(rejected)
 }
 
 // UpdateQuote @Summary Update quote
@@ -223,11 +240,14 @@ func UpdateQuote(c *fiber.Ctx) error {
 
 	// Only allow updating certain fields
 	quote.QuoteAmount = updateData.QuoteAmount
-	quote.Currency = updateData.Currency
+	if updateData.Currency != "" {
+		quote.Currency = updateData.Currency
+	}
 	quote.ValidUntil = updateData.ValidUntil
 	quote.PickupDate = updateData.PickupDate
 	quote.DeliveryDate = updateData.DeliveryDate
 	quote.Notes = updateData.Notes
+	services.NormalizeQuoteAmount(&quote)
 
 	database.DB.Save(&quote)
 	return c.JSON(quote)
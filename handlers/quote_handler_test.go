@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http/httptest"
 	"testing"
 	"time"
@@ -31,6 +32,7 @@ func (suite *QuoteHandlerTestSuite) SetupTest() {
 	suite.app.Get("/carriers/:carrier_id/quotes", GetCarrierQuotes)
 	suite.app.Post("/quotes/:id/accept", AcceptQuote)
 	suite.app.Post("/quotes/:id/reject", RejectQuote)
+	suite.app.Post("/quotes/:id/counter", CounterQuote)
 	suite.app.Put("/quotes/:id", UpdateQuote)
 }
 
@@ -106,6 +108,68 @@ func (suite *QuoteHandlerTestSuite) TestUpdateQuote() {
 	assert.Equal(t, 200, resp.StatusCode)
 }
 
+func (suite *QuoteHandlerTestSuite) TestCounterQuote() {
+	t := suite.T()
+
+	var quote models.Quote
+	testDB.First(&quote)
+	quoteID := fmt.Sprint(quote.ID)
+
+	tests := []struct {
+		name           string
+		quoteID        string
+		counterData    map[string]interface{}
+		expectedStatus int
+	}{
+		{
+			name:           "Valid counter-offer",
+			quoteID:        quoteID,
+			counterData:    map[string]interface{}{"quote_amount": 900.00, "notes": "Can you do 900?"},
+			expectedStatus: 201,
+		},
+		{
+			name:           "Invalid amount",
+			quoteID:        quoteID,
+			counterData:    map[string]interface{}{"quote_amount": 0},
+			expectedStatus: 400,
+		},
+		{
+			name:           "Quote not found",
+			quoteID:        "999",
+			counterData:    map[string]interface{}{"quote_amount": 900.00},
+			expectedStatus: 404,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonData, _ := json.Marshal(tt.counterData)
+			req := httptest.NewRequest("POST", "/quotes/"+tt.quoteID+"/counter", bytes.NewBuffer(jsonData))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := suite.app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+}
+
+func (suite *QuoteHandlerTestSuite) TestAcceptExpiredQuote() {
+	t := suite.T()
+
+	var quote models.Quote
+	testDB.First(&quote)
+	testDB.Model(&quote).Update("valid_until", time.Now().Add(-time.Hour))
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/quotes/%d/accept", quote.ID), nil)
+	resp, err := suite.app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	testDB.First(&quote, quote.ID)
+	assert.Equal(t, "EXPIRED", quote.Status)
+}
+
 func TestQuoteHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(QuoteHandlerTestSuite))
 }
\ No newline at end of file
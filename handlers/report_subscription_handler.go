@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var reportSubscriptionService = services.NewReportSubscriptionService(database.DB, config.GetEmailConfig())
+
+// CreateReportSubscription @Summary Subscribe to an analytics report
+// @Description Email an analytics report (CSV or PDF) to the current user or a list of recipients every day, week or month, e.g. the on-time delivery report every Monday at 08:00
+// @Tags analytics
+// @Accept json
+// @Produce json
+// @Param subscription body services.ReportSubscriptionRequest true "Report and schedule"
+// @Success 201 {object} models.ReportSubscription
+// @Router /report-subscriptions [post]
+func CreateReportSubscription(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req services.ReportSubscriptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	subscription, err := reportSubscriptionService.CreateSubscription(uint(userID), req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(subscription)
+}
+
+// GetReportSubscriptions @Summary Get report subscriptions
+// @Description Get the current user's analytics report subscriptions
+// @Tags analytics
+// @Produce json
+// @Success 200 {array} models.ReportSubscription
+// @Router /report-subscriptions [get]
+func GetReportSubscriptions(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	subscriptions, err := reportSubscriptionService.GetUserSubscriptions(uint(userID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch report subscriptions",
+		})
+	}
+
+	return c.JSON(subscriptions)
+}
+
+// UpdateReportSubscription @Summary Update a report subscription
+// @Description Replace the report, format, schedule and recipients of a report subscription
+// @Tags analytics
+// @Accept json
+// @Produce json
+// @Param id path int true "Subscription ID"
+// @Param subscription body services.ReportSubscriptionRequest true "Report and schedule"
+// @Success 200 {object} models.ReportSubscription
+// @Router /report-subscriptions/{id} [put]
+func UpdateReportSubscription(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	subscriptionID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid subscription ID",
+		})
+	}
+
+	if _, err := reportSubscriptionService.GetSubscription(uint(userID), uint(subscriptionID)); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Report subscription not found",
+		})
+	}
+
+	var req services.ReportSubscriptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	subscription, err := reportSubscriptionService.UpdateSubscription(uint(userID), uint(subscriptionID), req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(subscription)
+}
+
+// DeleteReportSubscription @Summary Delete a report subscription
+// @Description Stop emailing a report
+// @Tags analytics
+// @Param id path int true "Subscription ID"
+// @Success 204
+// @Router /report-subscriptions/{id} [delete]
+func DeleteReportSubscription(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	subscriptionID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid subscription ID",
+		})
+	}
+
+	if err := reportSubscriptionService.DeleteSubscription(uint(userID), uint(subscriptionID)); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Report subscription not found",
+		})
+	}
+
+	return c.SendStatus(204)
+}
+
+// SendReportSubscription @Summary Send a subscribed report now
+// @Description Email a subscription's report for the period ending now, without changing its schedule
+// @Tags analytics
+// @Produce json
+// @Param id path int true "Subscription ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /report-subscriptions/{id}/send [post]
+func SendReportSubscription(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	subscriptionID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid subscription ID",
+		})
+	}
+
+	subscription, err := reportSubscriptionService.GetSubscription(uint(userID), uint(subscriptionID))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Report subscription not found",
+		})
+	}
+
+	if err := reportSubscriptionService.SendReport(subscription, time.Now()); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not send report: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Report sent",
+	})
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// recordingEmailSender keeps the emails it is asked to send
+type recordingEmailSender struct {
+	to     []string
+	emails []*services.RenderedEmail
+}
+
+func (s *recordingEmailSender) Send(to string, email *services.RenderedEmail) error {
+	s.to = append(s.to, to)
+	s.emails = append(s.emails, email)
+	return nil
+}
+
+type ReportSubscriptionHandlerTestSuite struct {
+	suite.Suite
+	app    *fiber.App
+	sender *recordingEmailSender
+}
+
+func (suite *ReportSubscriptionHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+
+	suite.sender = &recordingEmailSender{}
+	reportSubscriptionService = services.NewReportSubscriptionService(testDB, &config.EmailConfig{})
+	reportSubscriptionService.SetEmailSender(suite.sender)
+
+	suite.app = fiber.New()
+
+	suite.app.Use(asHeaderUser())
+
+	suite.app.Post("/report-subscriptions", CreateReportSubscription)
+	suite.app.Get("/report-subscriptions", GetReportSubscriptions)
+	suite.app.Put("/report-subscriptions/:id", UpdateReportSubscription)
+	suite.app.Delete("/report-subscriptions/:id", DeleteReportSubscription)
+	suite.app.Post("/report-subscriptions/:id/send", SendReportSubscription)
+}
+
+func (suite *ReportSubscriptionHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *ReportSubscriptionHandlerTestSuite) request(method, url string, userID uint, body interface{}) (int, []byte) {
+	jsonData, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var respBody bytes.Buffer
+	respBody.ReadFrom(resp.Body)
+	return resp.StatusCode, respBody.Bytes()
+}
+
+func (suite *ReportSubscriptionHandlerTestSuite) TestReportSubscriptions() {
+	t := suite.T()
+
+	var user models.User
+	testDB.First(&user)
+
+	status, body := suite.request("POST", "/report-subscriptions", user.ID, services.ReportSubscriptionRequest{
+		Report:    services.ReportOnTimeDelivery,
+		Frequency: "weekly",
+		DayOfWeek: int(time.Monday),
+		Hour:      8,
+	})
+	assert.Equal(t, 201, status)
+
+	var subscription models.ReportSubscription
+	assert.NoError(t, json.Unmarshal(body, &subscription))
+	assert.Equal(t, services.ReportWeekly, subscription.Frequency)
+	assert.Equal(t, services.ReportFormatCSV, subscription.Format)
+	assert.True(t, subscription.Active)
+	if assert.NotNil(t, subscription.NextRunAt) {
+		next := subscription.NextRunAt.UTC()
+		assert.Equal(t, time.Monday, next.Weekday())
+		assert.Equal(t, 8, next.Hour())
+		assert.True(t, next.After(time.Now()))
+	}
+
+	status, _ = suite.request("POST", "/report-subscriptions", user.ID, services.ReportSubscriptionRequest{
+		Report:    services.ReportOnTimeDelivery,
+		Frequency: "HOURLY",
+	})
+	assert.Equal(t, 400, status)
+
+	status, body = suite.request("GET", "/report-subscriptions", user.ID, nil)
+	assert.Equal(t, 200, status)
+	var subscriptions []models.ReportSubscription
+	assert.NoError(t, json.Unmarshal(body, &subscriptions))
+	assert.Len(t, subscriptions, 1)
+
+	// Other users can't see or change the subscription
+	path := "/report-subscriptions/" + strconv.Itoa(int(subscription.ID))
+	status, _ = suite.request("PUT", path, user.ID+1, services.ReportSubscriptionRequest{
+		Report:    services.ReportDelayIncidents,
+		Frequency: services.ReportDaily,
+	})
+	assert.Equal(t, 404, status)
+
+	status, body = suite.request("PUT", path, user.ID, services.ReportSubscriptionRequest{
+		Report:     services.ReportDelayIncidents,
+		Format:     "pdf",
+		Frequency:  services.ReportMonthly,
+		DayOfMonth: 1,
+		Hour:       6,
+		Recipients: "Fleet Manager <fleet@example.com>, ops@example.com",
+	})
+	assert.Equal(t, 200, status)
+	assert.NoError(t, json.Unmarshal(body, &subscription))
+	assert.Equal(t, services.ReportFormatPDF, subscription.Format)
+	assert.Equal(t, "fleet@example.com, ops@example.com", subscription.Recipients)
+	assert.Equal(t, 1, subscription.NextRunAt.UTC().Day())
+
+	status, _ = suite.request("DELETE", path, user.ID, nil)
+	assert.Equal(t, 204, status)
+	status, _ = suite.request("DELETE", path, user.ID, nil)
+	assert.Equal(t, 404, status)
+}
+
+func (suite *ReportSubscriptionHandlerTestSuite) TestSendReportSubscription() {
+	t := suite.T()
+
+	var user models.User
+	testDB.First(&user)
+
+	subscription, err := reportSubscriptionService.CreateSubscription(user.ID, services.ReportSubscriptionRequest{
+		Report:    services.ReportOnTimeDelivery,
+		Frequency: services.ReportDaily,
+		Hour:      8,
+	})
+	suite.Require().NoError(err)
+
+	status, _ := suite.request("POST", "/report-subscriptions/"+strconv.Itoa(int(subscription.ID))+"/send", user.ID, nil)
+	assert.Equal(t, 200, status)
+
+	if assert.Len(t, suite.sender.emails, 1) {
+		assert.Equal(t, "test@example.com", suite.sender.to[0])
+		email := suite.sender.emails[0]
+		assert.Contains(t, email.Subject, "On-Time Delivery")
+		if assert.Len(t, email.Attachments, 1) {
+			assert.True(t, strings.HasSuffix(email.Attachments[0].Filename, ".csv"))
+			assert.True(t, strings.HasPrefix(string(email.Attachments[0].Content), "Trip ID,"))
+		}
+	}
+}
+
+func (suite *ReportSubscriptionHandlerTestSuite) TestSendDueReports() {
+	t := suite.T()
+
+	var user models.User
+	testDB.First(&user)
+
+	due, err := reportSubscriptionService.CreateSubscription(user.ID, services.ReportSubscriptionRequest{
+		Report:    services.ReportCapacityUtilization,
+		Format:    services.ReportFormatPDF,
+		Frequency: services.ReportDaily,
+	})
+	suite.Require().NoError(err)
+	_, err = reportSubscriptionService.CreateSubscription(user.ID, services.ReportSubscriptionRequest{
+		Report:    services.ReportDelayIncidents,
+		Frequency: services.ReportDaily,
+	})
+	suite.Require().NoError(err)
+
+	missed := time.Now().Add(-2 * time.Hour)
+	testDB.Model(due).Update("next_run_at", missed)
+
+	assert.NoError(t, reportSubscriptionService.SendDueReports())
+	if assert.Len(t, suite.sender.emails, 1) {
+		attachment := suite.sender.emails[0].Attachments[0]
+		assert.Equal(t, "application/pdf", attachment.ContentType)
+		assert.True(t, bytes.HasPrefix(attachment.Content, []byte("%PDF")))
+	}
+
+	var sent models.ReportSubscription
+	testDB.First(&sent, due.ID)
+	assert.NotNil(t, sent.LastSentAt)
+	assert.True(t, sent.NextRunAt.After(time.Now()))
+	assert.Empty(t, sent.LastError)
+}
+
+func TestReportSubscriptionHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(ReportSubscriptionHandlerTestSuite))
+}
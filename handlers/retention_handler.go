@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"strconv"
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var retentionService = services.NewRetentionService(database.DB, config.GetRetentionConfig(), config.GetStorageConfig())
+
+// adminUserID returns the current user's ID when they are an admin, or the
+// status and message to respond with
+func adminUserID(c *fiber.Ctx) (uint, int, string) {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return 0, 401, "Unauthorized"
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, uint(userID)).Error; err != nil || user.Role != "ADMIN" {
+		return 0, 403, "Admin access required"
+	}
+	return user.ID, 0, ""
+}
+
+// GetRetentionPolicies @Summary Get data retention policies
+// @Description Get the stored retention policies. Data types without a default policy use the configured retention.
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.RetentionPolicy
+// @Router /admin/retention/policies [get]
+func GetRetentionPolicies(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	policies, err := retentionService.GetPolicies()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch retention policies",
+		})
+	}
+
+	return c.JSON(policies)
+}
+
+// SetRetentionPolicy @Summary Set a data retention policy
+// @Description Set how many days a data type (TRACKING_RECORDS, TRACKING_EVENTS, CRITICAL_TRACKING_EVENTS, NOTIFICATIONS) is kept for a carrier, or by default when no carrier is given, and whether it is archived before deletion
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param policy body services.RetentionPolicyRequest true "Retention policy"
+// @Success 200 {object} models.RetentionPolicy
+// @Router /admin/retention/policies [put]
+func SetRetentionPolicy(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	var req services.RetentionPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	policy, err := retentionService.SetPolicy(req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(policy)
+}
+
+// DeleteRetentionPolicy @Summary Delete a data retention policy
+// @Description Delete a retention policy. The carrier's data falls back to the default policy.
+// @Tags admin
+// @Param id path int true "Policy ID"
+// @Success 204
+// @Router /admin/retention/policies/{id} [delete]
+func DeleteRetentionPolicy(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	policyID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid policy ID",
+		})
+	}
+
+	if err := retentionService.DeletePolicy(uint(policyID)); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Retention policy not found",
+		})
+	}
+
+	return c.SendStatus(204)
+}
+
+// RunRetentionCleanup @Summary Run the data retention cleanup
+// @Description Archive and delete the data past its retention now, instead of waiting for the scheduled cleanup
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.RetentionRun
+// @Router /admin/retention/runs [post]
+func RunRetentionCleanup(c *fiber.Ctx) error {
+	adminID, status, message := adminUserID(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	run, err := retentionService.RunCleanup("MANUAL", &adminID)
+	if err == services.ErrRetentionRunInProgress {
+		return c.Status(409).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not run retention cleanup: " + err.Error(),
+		})
+	}
+
+	return c.JSON(run)
+}
+
+// GetRetentionRuns @Summary Get data retention cleanup runs
+// @Description Get the latest retention cleanup runs, newest first
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Number of runs (default 20, max 100)"
+// @Success 200 {array} models.RetentionRun
+// @Router /admin/retention/runs [get]
+func GetRetentionRuns(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	limit := c.QueryInt("limit", 20)
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	runs, err := retentionService.GetRuns(limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch retention runs",
+		})
+	}
+
+	return c.JSON(runs)
+}
+
+// GetRetentionRun @Summary Get a data retention cleanup run
+// @Description Get a retention cleanup run with the records archived and deleted for each policy
+// @Tags admin
+// @Produce json
+// @Param id path int true "Run ID"
+// @Success 200 {object} models.RetentionRun
+// @Router /admin/retention/runs/{id} [get]
+func GetRetentionRun(c *fiber.Ctx) error {
+	if _, status, message := adminUserID(c); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	runID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid run ID",
+		})
+	}
+
+	run, err := retentionService.GetRun(uint(runID))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Retention run not found",
+		})
+	}
+
+	return c.JSON(run)
+}
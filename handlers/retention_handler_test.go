@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RetentionHandlerTestSuite struct {
+	suite.Suite
+	app        *fiber.App
+	archiveDir string
+	admin      models.User
+}
+
+func (suite *RetentionHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+
+	suite.archiveDir = suite.T().TempDir()
+	retentionService = services.NewRetentionService(testDB, config.GetRetentionConfig(), &config.StorageConfig{Provider: "local"})
+	retentionService.SetArchiveStorage(services.NewLocalFileStorage(suite.archiveDir, ""))
+
+	suite.admin = models.User{Email: "admin@example.com", Phone: "+1987654321", Password: "password", Role: "ADMIN"}
+	testDB.Create(&suite.admin)
+
+	suite.app = fiber.New()
+
+	suite.app.Use(asHeaderUser())
+
+	suite.app.Get("/admin/retention/policies", GetRetentionPolicies)
+	suite.app.Put("/admin/retention/policies", SetRetentionPolicy)
+	suite.app.Delete("/admin/retention/policies/:id", DeleteRetentionPolicy)
+	suite.app.Post("/admin/retention/runs", RunRetentionCleanup)
+	suite.app.Get("/admin/retention/runs", GetRetentionRuns)
+	suite.app.Get("/admin/retention/runs/:id", GetRetentionRun)
+}
+
+func (suite *RetentionHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *RetentionHandlerTestSuite) request(method, url string, userID uint, body interface{}) (int, []byte) {
+	jsonData, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var respBody bytes.Buffer
+	respBody.ReadFrom(resp.Body)
+	return resp.StatusCode, respBody.Bytes()
+}
+
+func (suite *RetentionHandlerTestSuite) TestRetentionPolicies() {
+	t := suite.T()
+
+	var carrier models.User
+	testDB.Where("email = ?", "test@example.com").First(&carrier)
+
+	// Only admins manage retention
+	status, _ := suite.request("GET", "/admin/retention/policies", carrier.ID, nil)
+	assert.Equal(t, 403, status)
+
+	status, _ = suite.request("PUT", "/admin/retention/policies", suite.admin.ID, services.RetentionPolicyRequest{
+		DataType:      "LOCATIONS",
+		RetentionDays: 30,
+	})
+	assert.Equal(t, 400, status)
+
+	status, body := suite.request("PUT", "/admin/retention/policies", suite.admin.ID, services.RetentionPolicyRequest{
+		CarrierID:     &carrier.ID,
+		DataType:      "tracking_records",
+		RetentionDays: 30,
+	})
+	assert.Equal(t, 200, status)
+	var policy models.RetentionPolicy
+	assert.NoError(t, json.Unmarshal(body, &policy))
+	assert.Equal(t, services.RetentionTrackingRecords, policy.DataType)
+
+	// Setting the policy again replaces it
+	status, _ = suite.request("PUT", "/admin/retention/policies", suite.admin.ID, services.RetentionPolicyRequest{
+		CarrierID:     &carrier.ID,
+		DataType:      services.RetentionTrackingRecords,
+		RetentionDays: 60,
+	})
+	assert.Equal(t, 200, status)
+
+	status, body = suite.request("GET", "/admin/retention/policies", suite.admin.ID, nil)
+	assert.Equal(t, 200, status)
+	var policies []models.RetentionPolicy
+	assert.NoError(t, json.Unmarshal(body, &policies))
+	if assert.Len(t, policies, 1) {
+		assert.Equal(t, 60, policies[0].RetentionDays)
+	}
+
+	status, _ = suite.request("DELETE", "/admin/retention/policies/"+strconv.Itoa(int(policy.ID)), suite.admin.ID, nil)
+	assert.Equal(t, 204, status)
+	status, _ = suite.request("DELETE", "/admin/retention/policies/"+strconv.Itoa(int(policy.ID)), suite.admin.ID, nil)
+	assert.Equal(t, 404, status)
+}
+
+func (suite *RetentionHandlerTestSuite) TestRunRetentionCleanup() {
+	t := suite.T()
+
+	var trip models.Trip
+	testDB.First(&trip)
+	testDB.Exec("DELETE FROM tracking_records")
+	testDB.Exec("DELETE FROM tracking_events")
+
+	old := time.Now().AddDate(0, 0, -120)
+	testDB.Create(&models.TrackingRecord{TripID: trip.ID, Latitude: 40.7128, Longitude: -74.0060, Timestamp: old})
+	testDB.Create(&models.TrackingRecord{TripID: trip.ID, Latitude: 40.7306, Longitude: -73.9352, Timestamp: time.Now()})
+	testDB.Create(&models.TrackingEvent{TripID: trip.ID, EventType: "LOCATION_UPDATE", Timestamp: old})
+	testDB.Create(&models.TrackingEvent{TripID: trip.ID, EventType: "ARRIVAL", Timestamp: old})
+
+	status, body := suite.request("POST", "/admin/retention/runs", suite.admin.ID, nil)
+	assert.Equal(t, 200, status)
+
+	var run models.RetentionRun
+	assert.NoError(t, json.Unmarshal(body, &run))
+	assert.Equal(t, services.RetentionCompleted, run.Status)
+	assert.Equal(t, "MANUAL", run.Trigger)
+	assert.Equal(t, int64(2), run.RecordsDeleted)
+	assert.Equal(t, int64(2), run.RecordsArchived)
+
+	// Recent records and critical events within their retention are kept
+	var records, events int64
+	testDB.Model(&models.TrackingRecord{}).Count(&records)
+	testDB.Model(&models.TrackingEvent{}).Count(&events)
+	assert.Equal(t, int64(1), records)
+	assert.Equal(t, int64(1), events)
+
+	// Deleted records were archived first
+	archive, err := os.ReadFile(filepath.Join(suite.archiveDir, "archive", "run-"+strconv.Itoa(int(run.ID)), "tracking_records", "default", "0001.json"))
+	if assert.NoError(t, err) {
+		var rows []map[string]interface{}
+		assert.NoError(t, json.Unmarshal(archive, &rows))
+		assert.Len(t, rows, 1)
+	}
+
+	status, body = suite.request("GET", "/admin/retention/runs/"+strconv.Itoa(int(run.ID)), suite.admin.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.NoError(t, json.Unmarshal(body, &run))
+	assert.Len(t, run.Results, 4)
+
+	status, body = suite.request("GET", "/admin/retention/runs", suite.admin.ID, nil)
+	assert.Equal(t, 200, status)
+	var runs []models.RetentionRun
+	assert.NoError(t, json.Unmarshal(body, &runs))
+	assert.Len(t, runs, 1)
+}
+
+func TestRetentionHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(RetentionHandlerTestSuite))
+}
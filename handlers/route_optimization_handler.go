@@ -2,12 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
-	"math"
+	"fmt"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"triplink/backend/database"
-	"triplink/backend/models"
+	"triplink/backend/internal/geo"
 	"triplink/backend/services"
 )
 
@@ -15,7 +14,7 @@ import (
 type RouteOptimizationRequest struct {
 	Origin      Location              `json:"origin"`
 	Destination Location              `json:"destination"`
-	Waypoints   []Location            `json:"waypoints,omitempty"`
+	Waypoints   []Location            `json:"waypoints,omitempty" validate:"dive"`
 	VehicleType string                `json:"vehicle_type,omitempty"`
 	LoadWeight  float64               `json:"load_weight,omitempty"`
 	LoadVolume  float64               `json:"load_volume,omitempty"`
@@ -25,8 +24,8 @@ type RouteOptimizationRequest struct {
 
 type Location struct {
 	Address   string  `json:"address"`
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude" validate:"latitude"`
+	Longitude float64 `json:"longitude" validate:"longitude"`
 	City      string  `json:"city,omitempty"`
 	State     string  `json:"state,omitempty"`
 	Country   string  `json:"country,omitempty"`
@@ -266,11 +265,12 @@ type RouteMetadata struct {
 // @Produce json
 // @Param request body RouteOptimizationRequest true "Route optimization request"
 // @Success 200 {object} RouteOptimizationResponse
+// @Failure 422 {object} ValidationErrorResponse
 // @Router /api/route-optimization/optimize [post]
 func OptimizeRoute(c *fiber.Ctx) error {
 	var request RouteOptimizationRequest
-	if err := c.BodyParser(&request); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	if err := parseBody(c, &request); err != nil {
+		return invalidRequest(c, err)
 	}
 
 	// Initialize Redis service for caching
@@ -304,11 +304,12 @@ func OptimizeRoute(c *fiber.Ctx) error {
 // @Produce json
 // @Param request body RouteOptimizationRequest true "Route optimization request"
 // @Success 200 {object} RouteOptimizationResponse
+// @Failure 422 {object} ValidationErrorResponse
 // @Router /api/route-optimization/multiple [post]
 func GetMultipleRouteOptions(c *fiber.Ctx) error {
 	var request RouteOptimizationRequest
-	if err := c.BodyParser(&request); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	if err := parseBody(c, &request); err != nil {
+		return invalidRequest(c, err)
 	}
 
 	// Generate multiple route options with different optimization priorities
@@ -326,8 +327,8 @@ func GetMultipleRouteOptions(c *fiber.Ctx) error {
 // @Router /api/route-optimization/compare [post]
 func CompareRoutes(c *fiber.Ctx) error {
 	var routes []OptimizedRoute
-	if err := c.BodyParser(&routes); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	if err := decodeBody(c, &routes); err != nil {
+		return invalidRequest(c, err)
 	}
 
 	// Generate comparison matrix
@@ -363,7 +364,7 @@ func GetRouteRecommendations(c *fiber.Ctx) error {
 	routeID := c.Params("route_id")
 	
 	// Generate route-specific recommendations
-	recommendations := generateRouteRecommendations(routeID)
+	recommendations := generateRouteOptimizationRecommendations(routeID)
 	
 	return c.JSON(recommendations)
 }
@@ -372,7 +373,7 @@ func GetRouteRecommendations(c *fiber.Ctx) error {
 
 func generateOptimizedRoute(request RouteOptimizationRequest) RouteOptimizationResponse {
 	// Calculate straight-line distance between origin and destination
-	distance := calculateDistance(request.Origin, request.Destination)
+	distance := geo.Distance(request.Origin.Latitude, request.Origin.Longitude, request.Destination.Latitude, request.Destination.Longitude)
 	
 	// Apply optimization algorithms based on preferences
 	optimizedRoute := OptimizedRoute{
@@ -387,7 +388,7 @@ func generateOptimizedRoute(request RouteOptimizationRequest) RouteOptimizationR
 		Segments:         generateRouteSegments(request),
 		TrafficInfo:      generateTrafficInfo(),
 		WeatherInfo:      generateWeatherInfo(),
-		Efficiency:       calculateRouteEfficiency(distance),
+		Efficiency:       calculateDistanceEfficiency(distance),
 		RiskAssessment:   generateRiskAssessment(),
 	}
 
@@ -525,7 +526,7 @@ func getRealTimeTrafficInfo(routeID string) TrafficInfo {
 	}
 }
 
-func generateRouteRecommendations(routeID string) []RouteRecommendation {
+func generateRouteOptimizationRecommendations(routeID string) []RouteRecommendation {
 	return []RouteRecommendation{
 		{
 			RecommendationID: "REC001",
@@ -554,22 +555,6 @@ func generateRouteRecommendations(routeID string) []RouteRecommendation {
 
 // Utility functions
 
-func calculateDistance(origin, destination Location) float64 {
-	// Haversine formula for great-circle distance
-	const R = 6371 // Earth's radius in km
-	
-	lat1 := origin.Latitude * math.Pi / 180
-	lat2 := destination.Latitude * math.Pi / 180
-	deltaLat := (destination.Latitude - origin.Latitude) * math.Pi / 180
-	deltaLng := (destination.Longitude - origin.Longitude) * math.Pi / 180
-	
-	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
-		math.Cos(lat1)*math.Cos(lat2)*
-			math.Sin(deltaLng/2)*math.Sin(deltaLng/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	
-	return R * c
-}
 
 func calculateFuelCost(distance float64, vehicleType string) float64 {
 	// Fuel consumption rates by vehicle type (L/100km)
@@ -641,7 +626,7 @@ func generateRouteSegments(request RouteOptimizationRequest) []RouteSegment {
 			SegmentID:     "SEG001",
 			StartLocation: request.Origin,
 			EndLocation:   request.Destination,
-			Distance:      calculateDistance(request.Origin, request.Destination),
+			Distance:      geo.Distance(request.Origin.Latitude, request.Origin.Longitude, request.Destination.Latitude, request.Destination.Longitude),
 			Duration:      2.5,
 			RoadType:      "highway",
 			TollCost:      15.50,
@@ -684,7 +669,7 @@ func generateWeatherInfo() WeatherInfo {
 	}
 }
 
-func calculateRouteEfficiency(distance float64) RouteEfficiency {
+func calculateDistanceEfficiency(distance float64) RouteEfficiency {
 	return RouteEfficiency{
 		FuelEfficiency:    8.5,  // km/l
 		TimeEfficiency:    87.3, // percentage
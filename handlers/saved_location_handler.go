@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"strconv"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var savedLocationService = services.NewSavedLocationService(database.DB, addressGeocoder)
+
+// CreateSavedLocation @Summary Save a location
+// @Description Add a location such as a warehouse to the current user's address book. Locations without lat and lng are geocoded from their address. Marking a location the default pickup or delivery clears the flag on the user's other locations.
+// @Tags saved-locations
+// @Accept json
+// @Produce json
+// @Param location body services.SavedLocationRequest true "Location"
+// @Success 201 {object} models.SavedLocation
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /saved-locations [post]
+func CreateSavedLocation(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req services.SavedLocationRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	location, err := savedLocationService.CreateLocation(uint(userID), req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(location)
+}
+
+// GetSavedLocations @Summary Get saved locations
+// @Description Get the current user's address book, by name
+// @Tags saved-locations
+// @Produce json
+// @Success 200 {array} models.SavedLocation
+// @Router /saved-locations [get]
+func GetSavedLocations(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	locations, err := savedLocationService.GetUserLocations(uint(userID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch saved locations",
+		})
+	}
+
+	return c.JSON(locations)
+}
+
+// GetSavedLocation @Summary Get a saved location
+// @Description Get a location from the current user's address book
+// @Tags saved-locations
+// @Produce json
+// @Param id path int true "Location ID"
+// @Success 200 {object} models.SavedLocation
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /saved-locations/{id} [get]
+func GetSavedLocation(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	locationID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid location ID",
+		})
+	}
+
+	location, err := savedLocationService.GetLocation(uint(userID), uint(locationID))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Saved location not found",
+		})
+	}
+
+	return c.JSON(location)
+}
+
+// UpdateSavedLocation @Summary Update a saved location
+// @Description Replace a saved location. A changed address is geocoded again unless lat and lng are given. Loads and trips created from the location are left unchanged.
+// @Tags saved-locations
+// @Accept json
+// @Produce json
+// @Param id path int true "Location ID"
+// @Param location body services.SavedLocationRequest true "Location"
+// @Success 200 {object} models.SavedLocation
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /saved-locations/{id} [put]
+func UpdateSavedLocation(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	locationID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid location ID",
+		})
+	}
+
+	var req services.SavedLocationRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	location, err := savedLocationService.UpdateLocation(uint(userID), uint(locationID), req)
+	if err != nil {
+		status := 400
+		if err == services.ErrSavedLocationNotFound {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(location)
+}
+
+// DeleteSavedLocation @Summary Delete a saved location
+// @Description Remove a location from the current user's address book
+// @Tags saved-locations
+// @Param id path int true "Location ID"
+// @Success 204
+// @Router /saved-locations/{id} [delete]
+func DeleteSavedLocation(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	locationID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid location ID",
+		})
+	}
+
+	if err := savedLocationService.DeleteLocation(uint(userID), uint(locationID)); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Saved location not found",
+		})
+	}
+
+	return c.SendStatus(204)
+}
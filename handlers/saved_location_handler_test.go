@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+)
+
+type SavedLocationHandlerTestSuite struct {
+	suite.Suite
+	app      *fiber.App
+	shipper  models.User
+	geocoder *fakeGeocoder
+}
+
+func (suite *SavedLocationHandlerTestSuite) SetupTest() {
+	clearTestDB()
+
+	suite.geocoder = &fakeGeocoder{places: map[string]services.Coordinate{
+		"1 Harare Rd":   {Latitude: -17.83, Longitude: 31.05},
+		"2 Bulawayo St": {Latitude: -20.15, Longitude: 28.58},
+	}}
+	savedLocationService = services.NewSavedLocationService(testDB, suite.geocoder)
+	organizationService = services.NewOrganizationService(testDB)
+
+	suite.shipper = models.User{Email: "shipper@example.com", Phone: "+15550000001", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&suite.shipper)
+
+	suite.app = fiber.New()
+	suite.app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", float64(suite.shipper.ID))
+		return c.Next()
+	})
+	suite.app.Post("/saved-locations", CreateSavedLocation)
+	suite.app.Get("/saved-locations", GetSavedLocations)
+	suite.app.Get("/saved-locations/:id", GetSavedLocation)
+	suite.app.Put("/saved-locations/:id", UpdateSavedLocation)
+	suite.app.Delete("/saved-locations/:id", DeleteSavedLocation)
+	suite.app.Post("/loads", CreateLoad)
+}
+
+func (suite *SavedLocationHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *SavedLocationHandlerTestSuite) request(method, path string, body interface{}, out interface{}) int {
+	var reader *bytes.Reader
+	if body != nil {
+		payload, _ := json.Marshal(body)
+		reader = bytes.NewReader(payload)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func (suite *SavedLocationHandlerTestSuite) TestCreateGeocodesAddress() {
+	var location models.SavedLocation
+	status := suite.request("POST", "/saved-locations", map[string]interface{}{
+		"name":    "Main warehouse",
+		"address": "1 Harare Rd",
+		"city":    "Harare",
+	}, &location)
+	suite.Equal(201, status)
+	suite.Equal(suite.shipper.ID, location.UserID)
+	suite.InDelta(-17.83, location.Lat, 0.0001)
+	suite.InDelta(31.05, location.Lng, 0.0001)
+	suite.Equal("ZW", location.Country)
+
+	status = suite.request("POST", "/saved-locations", map[string]interface{}{
+		"name":    "Nowhere",
+		"address": "9 Unknown Ave",
+	}, nil)
+	suite.Equal(400, status)
+
+	// Given coordinates aren't geocoded
+	calls := suite.geocoder.calls
+	status = suite.request("POST", "/saved-locations", map[string]interface{}{
+		"name":    "Yard",
+		"address": "9 Unknown Ave",
+		"lat":     -18.0,
+		"lng":     30.0,
+	}, &location)
+	suite.Equal(201, status)
+	suite.Equal(calls, suite.geocoder.calls)
+}
+
+func (suite *SavedLocationHandlerTestSuite) TestUpdateAndDelete() {
+	var location models.SavedLocation
+	suite.request("POST", "/saved-locations", map[string]interface{}{"name": "Warehouse", "address": "1 Harare Rd"}, &location)
+	path := fmt.Sprintf("/saved-locations/%d", location.ID)
+
+	// Changing only the contact keeps the coordinates without geocoding
+	calls := suite.geocoder.calls
+	var updated models.SavedLocation
+	suite.Equal(200, suite.request("PUT", path, map[string]interface{}{
+		"name": "Warehouse", "address": "1 Harare Rd", "country": "ZW", "contact_name": "Tendai",
+	}, &updated))
+	suite.Equal("Tendai", updated.ContactName)
+	suite.Equal(calls, suite.geocoder.calls)
+
+	suite.Equal(200, suite.request("PUT", path, map[string]interface{}{
+		"name": "Warehouse", "address": "2 Bulawayo St", "country": "ZW",
+	}, &updated))
+	suite.InDelta(-20.15, updated.Lat, 0.0001)
+
+	var locations []models.SavedLocation
+	suite.Equal(200, suite.request("GET", "/saved-locations", nil, &locations))
+	suite.Len(locations, 1)
+
+	// Other users' locations aren't visible
+	other := models.SavedLocation{UserID: suite.shipper.ID + 100, Name: "Other", Address: "Elsewhere"}
+	testDB.Create(&other)
+	suite.Equal(404, suite.request("GET", fmt.Sprintf("/saved-locations/%d", other.ID), nil, nil))
+	suite.Equal(404, suite.request("PUT", fmt.Sprintf("/saved-locations/%d", other.ID), map[string]interface{}{"name": "Mine", "address": "Here", "lat": 1, "lng": 1}, nil))
+
+	suite.Equal(204, suite.request("DELETE", path, nil, nil))
+	suite.Equal(404, suite.request("GET", path, nil, nil))
+}
+
+func (suite *SavedLocationHandlerTestSuite) TestDefaultsAreExclusive() {
+	var first, second models.SavedLocation
+	suite.request("POST", "/saved-locations", map[string]interface{}{"name": "A", "address": "1 Harare Rd", "is_default_pickup": true, "is_default_delivery": true}, &first)
+	suite.request("POST", "/saved-locations", map[string]interface{}{"name": "B", "address": "2 Bulawayo St", "is_default_pickup": true}, &second)
+
+	testDB.First(&first, first.ID)
+	suite.False(first.IsDefaultPickup)
+	suite.True(first.IsDefaultDelivery)
+	testDB.First(&second, second.ID)
+	suite.True(second.IsDefaultPickup)
+}
+
+func (suite *SavedLocationHandlerTestSuite) TestCreateLoadFromSavedLocations() {
+	var warehouse, customer models.SavedLocation
+	suite.request("POST", "/saved-locations", map[string]interface{}{"name": "Warehouse", "address": "1 Harare Rd", "city": "Harare", "is_default_pickup": true}, &warehouse)
+	suite.request("POST", "/saved-locations", map[string]interface{}{"name": "Customer", "address": "2 Bulawayo St", "city": "Bulawayo"}, &customer)
+
+	var load models.Load
+	status := suite.request("POST", "/loads", map[string]interface{}{
+		"shipper_id":           suite.shipper.ID,
+		"booking_reference":    "SAVED-001",
+		"weight":               100,
+		"delivery_location_id": customer.ID,
+	}, &load)
+	suite.Equal(200, status)
+	suite.Equal("1 Harare Rd", load.PickupAddress, "the default pickup fills a missing pickup")
+	suite.Equal("Harare", load.PickupCity)
+	suite.InDelta(-17.83, load.PickupLat, 0.0001)
+	suite.Equal("2 Bulawayo St", load.DeliveryAddress)
+	suite.Equal("Bulawayo", load.DeliveryCity)
+	suite.InDelta(28.58, load.DeliveryLng, 0.0001)
+
+	// A given address isn't replaced by the default
+	suite.request("POST", "/loads", map[string]interface{}{
+		"booking_reference": "SAVED-002",
+		"pickup_address":    "Gate 4",
+	}, &load)
+	suite.Equal("Gate 4", load.PickupAddress)
+
+	other := models.SavedLocation{UserID: suite.shipper.ID + 100, Name: "Other", Address: "Elsewhere"}
+	testDB.Create(&other)
+	var body map[string]interface{}
+	status = suite.request("POST", "/loads", map[string]interface{}{
+		"booking_reference":  "SAVED-003",
+		"pickup_location_id": other.ID,
+	}, &body)
+	suite.Equal(400, status)
+	suite.Equal("pickup saved location not found", body["error"])
+}
+
+func TestSavedLocationHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(SavedLocationHandlerTestSuite))
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type StatusTransitionTestSuite struct {
+	suite.Suite
+	app  *fiber.App
+	trip models.Trip
+	load models.Load
+}
+
+func (suite *StatusTransitionTestSuite) SetupTest() {
+	clearTestDB()
+	trackingService = services.NewTrackingService(testDB)
+	trackingService.SetAutoStatusConfig(&config.AutoStatusConfig{})
+
+	carrier := models.User{Email: "transition-carrier@example.com", Phone: "+15550000612", Password: "password", Role: "CARRIER"}
+	testDB.Create(&carrier)
+	suite.trip = models.Trip{UserID: carrier.ID, Status: "PLANNED", DepartureDate: time.Now(), EstimatedArrival: time.Now().Add(4 * time.Hour)}
+	testDB.Create(&suite.trip)
+	suite.load = models.Load{TripID: suite.trip.ID, ShipperID: carrier.ID, BookingReference: "TRANSITION-1", Status: "BOOKED"}
+	testDB.Create(&suite.load)
+
+	suite.app = fiber.New()
+	suite.app.Put("/trips/:trip_id/tracking/status", UpdateTripStatus)
+	suite.app.Put("/loads/:load_id/status", UpdateLoadStatus)
+}
+
+func (suite *StatusTransitionTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *StatusTransitionTestSuite) put(path string, body fiber.Map) (int, map[string]interface{}) {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest("PUT", path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	var result map[string]interface{}
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&result))
+	return resp.StatusCode, result
+}
+
+func (suite *StatusTransitionTestSuite) tripStatus(body fiber.Map) (int, map[string]interface{}) {
+	return suite.put(fmt.Sprintf("/trips/%d/tracking/status", suite.trip.ID), body)
+}
+
+func (suite *StatusTransitionTestSuite) events(eventType string) int64 {
+	var count int64
+	testDB.Model(&models.TrackingEvent{}).Where("trip_id = ? AND event_type = ?", suite.trip.ID, eventType).Count(&count)
+	return count
+}
+
+func (suite *StatusTransitionTestSuite) TestRejectsTransitionWithReason() {
+	t := suite.T()
+
+	status, body := suite.tripStatus(fiber.Map{"status": "COMPLETED"})
+	assert.Equal(t, 409, status)
+	assert.Equal(t, "INVALID_STATUS_TRANSITION", body["code"])
+	assert.Equal(t, "A trip can't go from PLANNED to COMPLETED, only to ACTIVE, CANCELLED", body["error"])
+	details := body["details"].(map[string]interface{})
+	assert.Equal(t, "PLANNED", details["from"])
+	assert.Equal(t, []interface{}{"ACTIVE", "CANCELLED"}, details["allowed"])
+
+	// Nothing changed and nothing was recorded
+	var trip models.Trip
+	testDB.First(&trip, suite.trip.ID)
+	assert.Equal(t, "PLANNED", trip.Status)
+	assert.Equal(t, uint(1), trip.Version)
+	assert.Zero(t, suite.events("STATUS_CHANGE"))
+
+	// Final statuses are final
+	testDB.Model(&trip).Update("status", "CANCELLED")
+	status, body = suite.tripStatus(fiber.Map{"status": "ACTIVE"})
+	assert.Equal(t, 409, status)
+	assert.Equal(t, "The trip is CANCELLED, a final status", body["error"])
+}
+
+func (suite *StatusTransitionTestSuite) TestStaleVersionConflicts() {
+	t := suite.T()
+
+	status, body := suite.tripStatus(fiber.Map{"status": "ACTIVE", "version": 1})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(2), body["version"])
+
+	// Another client still at version 1
+	status, body = suite.tripStatus(fiber.Map{"status": "IN_TRANSIT", "version": 1})
+	assert.Equal(t, 409, status)
+	assert.Equal(t, "STATUS_CONFLICT", body["code"])
+	details := body["details"].(map[string]interface{})
+	assert.Equal(t, "ACTIVE", details["from"])
+	assert.Equal(t, float64(2), details["version"])
+
+	status, body = suite.tripStatus(fiber.Map{"status": "IN_TRANSIT", "version": 2})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(3), body["version"])
+}
+
+func (suite *StatusTransitionTestSuite) TestConcurrentChangesApplyOnce() {
+	t := suite.T()
+
+	// Both changes were requested against the trip as read at version 1
+	version := uint(1)
+	_, err := trackingService.ChangeTripStatus(suite.trip.ID, "ACTIVE", &version)
+	assert.NoError(t, err)
+	_, err = trackingService.ChangeTripStatus(suite.trip.ID, "CANCELLED", &version)
+	var rejection *services.StatusTransitionError
+	if assert.ErrorAs(t, err, &rejection) {
+		assert.True(t, rejection.Conflict)
+		assert.Equal(t, "ACTIVE", rejection.From)
+	}
+
+	var trip models.Trip
+	testDB.First(&trip, suite.trip.ID)
+	assert.Equal(t, "ACTIVE", trip.Status)
+	assert.Equal(t, int64(1), suite.events("STATUS_CHANGE"))
+}
+
+func (suite *StatusTransitionTestSuite) TestLoadTransitions() {
+	t := suite.T()
+	path := fmt.Sprintf("/loads/%d/status", suite.load.ID)
+
+	status, body := suite.put(path, fiber.Map{"status": "DELIVERED"})
+	assert.Equal(t, 409, status)
+	assert.Equal(t, "A load can't go from BOOKED to DELIVERED, only to PICKUP_SCHEDULED, PICKED_UP, EXCEPTION", body["error"])
+
+	status, body = suite.put(path, fiber.Map{"status": "PICKED_UP"})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "BOOKED", body["previous_status"])
+	assert.Equal(t, float64(2), body["version"])
+
+	status, _ = suite.put(path, fiber.Map{"status": "DELIVERED", "version": 1})
+	assert.Equal(t, 409, status)
+	status, _ = suite.put(path, fiber.Map{"status": "DELIVERED", "version": 2})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, int64(2), suite.events("LOAD_STATUS_CHANGE"))
+
+	var trackingStatus models.TrackingStatus
+	testDB.Where("load_id = ?", suite.load.ID).First(&trackingStatus)
+	assert.Equal(t, "DELIVERED", trackingStatus.CurrentStatus)
+	assert.Equal(t, "PICKED_UP", trackingStatus.PreviousStatus)
+	assert.Equal(t, 100.0, trackingStatus.CompletionPercent)
+}
+
+func TestStatusTransitionTestSuite(t *testing.T) {
+	suite.Run(t, new(StatusTransitionTestSuite))
+}
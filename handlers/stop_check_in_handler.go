@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"io"
+	"strconv"
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var stopCheckInService = services.NewStopCheckInService(database.DB, services.NewFileStorage(storageConfig), config.GetDetentionConfig(), storageConfig.MaxUploadSize)
+
+// StopCheckInForm is the driver's position at a stop check-in or check-out,
+// sent as a form with the photo or as JSON
+type StopCheckInForm struct {
+	Latitude  *float64 `json:"latitude" form:"latitude" validate:"required,latitude"`
+	Longitude *float64 `json:"longitude" form:"longitude" validate:"required,longitude"`
+	Accuracy  *float64 `json:"accuracy" form:"accuracy" validate:"omitempty,gte=0"`
+	Notes     string   `json:"notes" form:"notes"`
+}
+
+// CheckInAtStop @Summary Check in at a trip stop
+// @Description Record the driver's arrival at a stop. The reported position must be near the stop.
+// @Tags mobile
+// @Accept multipart/form-data
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param stop_id path int true "Stop ID"
+// @Param latitude formData number true "Latitude of the driver"
+// @Param longitude formData number true "Longitude of the driver"
+// @Param accuracy formData number false "Accuracy of the position in meters"
+// @Param notes formData string false "Notes"
+// @Param photo formData file false "Photo (JPEG, PNG or WebP)"
+// @Success 200 {object} services.StopCheckInResult
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /mobile/trips/{trip_id}/stops/{stop_id}/check-in [post]
+func CheckInAtStop(c *fiber.Ctx) error {
+	return recordStopCheckIn(c, services.StopCheckInArrive)
+}
+
+// CheckOutOfStop @Summary Check out of a trip stop
+// @Description Record the driver's departure from a stop. The reported position must be near the stop. Checking out of a pickup marks its load picked up and checking out of a delivery marks it delivered.
+// @Tags mobile
+// @Accept multipart/form-data
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param stop_id path int true "Stop ID"
+// @Param latitude formData number true "Latitude of the driver"
+// @Param longitude formData number true "Longitude of the driver"
+// @Param accuracy formData number false "Accuracy of the position in meters"
+// @Param notes formData string false "Notes"
+// @Param photo formData file false "Photo (JPEG, PNG or WebP)"
+// @Success 200 {object} services.StopCheckInResult
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /mobile/trips/{trip_id}/stops/{stop_id}/check-out [post]
+func CheckOutOfStop(c *fiber.Ctx) error {
+	return recordStopCheckIn(c, services.StopCheckInDepart)
+}
+
+// recordStopCheckIn records a check-in or check-out by the trip's carrier or
+// an assigned driver. The position and notes are read from a form or JSON body.
+func recordStopCheckIn(c *fiber.Ctx, action string) error {
+	trip, userID, status, message := driverTrip(c)
+	if trip == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	stopID, err := strconv.ParseUint(c.Params("stop_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid stop ID",
+		})
+	}
+
+	var body StopCheckInForm
+	if err := parseBody(c, &body); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	req := services.StopCheckInRequest{
+		Action:    action,
+		Latitude:  *body.Latitude,
+		Longitude: *body.Longitude,
+		Accuracy:  body.Accuracy,
+		Notes:     body.Notes,
+	}
+	if fileHeader, err := c.FormFile("photo"); err == nil {
+		if fileHeader.Size > storageConfig.MaxUploadSize {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Photo is too large",
+			})
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Cannot read photo",
+			})
+		}
+		defer file.Close()
+		if req.Photo, err = io.ReadAll(io.LimitReader(file, storageConfig.MaxUploadSize+1)); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Cannot read photo",
+			})
+		}
+	}
+
+	result, err := stopCheckInService.CheckIn(userID, trip.ID, uint(stopID), req)
+	if err != nil {
+		status := 400
+		if err.Error() == "trip stop not found" {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if result.LoadStatusChanged {
+		triggerService := services.NewNotificationTriggerService(database.DB)
+		triggerService.LoadStatusChangeHandler(*result.CheckIn.LoadID, result.PreviousLoadStatus, result.LoadStatus)
+	}
+
+	return c.JSON(result)
+}
+
+// GetStopCheckIns @Summary Get trip stop check-ins
+// @Description Get the driver check-ins at and check-outs of a trip stop, oldest first
+// @Tags tracking
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param stop_id path int true "Stop ID"
+// @Success 200 {array} models.StopCheckIn
+// @Router /tracking/trips/{trip_id}/stops/{stop_id}/check-ins [get]
+func GetStopCheckIns(c *fiber.Ctx) error {
+	tripID, err := strconv.ParseUint(c.Params("trip_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid trip ID",
+		})
+	}
+	stopID, err := strconv.ParseUint(c.Params("stop_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid stop ID",
+		})
+	}
+
+	checkIns, err := stopCheckInService.GetStopCheckIns(uint(tripID), uint(stopID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get check-ins",
+		})
+	}
+
+	return c.JSON(checkIns)
+}
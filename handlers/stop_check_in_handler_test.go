@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type StopCheckInHandlerTestSuite struct {
+	suite.Suite
+	app      *fiber.App
+	carrier  models.User
+	trip     models.Trip
+	load     models.Load
+	pickup   models.TripStop
+	delivery models.TripStop
+}
+
+func (suite *StopCheckInHandlerTestSuite) SetupTest() {
+	clearTestDB()
+
+	stopCheckInService = services.NewStopCheckInService(testDB, services.NewLocalFileStorage(suite.T().TempDir(), "/uploads"), &config.DetentionConfig{
+		GeofenceRadiusKm:   0.5,
+		CheckInToleranceKm: 0.5,
+		FreeTime:           2 * time.Hour,
+	}, 1024*1024)
+	tripAssignmentService = services.NewTripAssignmentService(testDB)
+
+	suite.carrier = models.User{Email: "carrier@example.com", Phone: "+15550000002", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.carrier)
+	shipper := models.User{Email: "shipper@example.com", Phone: "+15550000001", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&shipper)
+
+	suite.trip = models.Trip{
+		UserID:             suite.carrier.ID,
+		OriginAddress:      "Depot",
+		DestinationAddress: "Depot",
+		OriginLat:          -17.80,
+		OriginLng:          31.00,
+		DestinationLat:     -17.80,
+		DestinationLng:     31.00,
+		Status:             "IN_TRANSIT",
+		DepartureDate:      time.Now().Add(-time.Hour),
+		EstimatedArrival:   time.Now().Add(6 * time.Hour),
+	}
+	testDB.Create(&suite.trip)
+	suite.load = models.Load{
+		ShipperID:             shipper.ID,
+		TripID:                suite.trip.ID,
+		BookingReference:      "CHECKIN-001",
+		Status:                "BOOKED",
+		PickupLat:             -17.83,
+		PickupLng:             31.05,
+		DeliveryLat:           -20.15,
+		DeliveryLng:           28.58,
+		RequestedPickupDate:   time.Now(),
+		RequestedDeliveryDate: time.Now().Add(6 * time.Hour),
+	}
+	testDB.Create(&suite.load)
+
+	stops, err := services.NewTrackingService(testDB).GenerateTripStops(suite.trip.ID)
+	suite.Require().NoError(err)
+	for _, stop := range stops {
+		switch stop.StopType {
+		case "PICKUP":
+			suite.pickup = stop
+		case "DELIVERY":
+			suite.delivery = stop
+		}
+	}
+
+	suite.app = fiber.New()
+
+	suite.app.Use(asHeaderUser())
+	suite.app.Post("/mobile/trips/:trip_id/stops/:stop_id/check-in", CheckInAtStop)
+	suite.app.Post("/mobile/trips/:trip_id/stops/:stop_id/check-out", CheckOutOfStop)
+	suite.app.Get("/tracking/trips/:trip_id/stops/:stop_id/check-ins", GetStopCheckIns)
+}
+
+func (suite *StopCheckInHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *StopCheckInHandlerTestSuite) checkIn(action string, stopID, userID uint, body interface{}) (int, services.StopCheckInResult) {
+	jsonData, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", fmt.Sprintf("/mobile/trips/%d/stops/%d/%s", suite.trip.ID, stopID, action), bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var result services.StopCheckInResult
+	if resp.StatusCode == 200 {
+		suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&result))
+	}
+	return resp.StatusCode, result
+}
+
+func (suite *StopCheckInHandlerTestSuite) TestCheckInAtPickup() {
+	t := suite.T()
+	nearPickup := fiber.Map{"latitude": -17.832, "longitude": 31.05, "notes": "Gate 3"}
+
+	// Only the trip's carrier and assigned drivers can check in
+	status, _ := suite.checkIn("check-in", suite.pickup.ID, suite.carrier.ID+100, nearPickup)
+	assert.Equal(t, 403, status)
+
+	status, _ = suite.checkIn("check-in", suite.pickup.ID, suite.carrier.ID, fiber.Map{"latitude": -17.90, "longitude": 31.05})
+	assert.Equal(t, 400, status)
+
+	status, _ = suite.checkIn("check-in", suite.pickup.ID, suite.carrier.ID, fiber.Map{"notes": "no position"})
+	assert.Equal(t, 422, status)
+
+	status, _ = suite.checkIn("check-in", 999999, suite.carrier.ID, nearPickup)
+	assert.Equal(t, 404, status)
+
+	status, result := suite.checkIn("check-in", suite.pickup.ID, suite.carrier.ID, nearPickup)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "ARRIVE", result.CheckIn.Action)
+	assert.Equal(t, "Gate 3", result.CheckIn.Notes)
+	assert.InDelta(t, 0.22, result.CheckIn.DistanceKm, 0.01)
+	assert.Equal(t, "ARRIVED", result.Stop.Status)
+	assert.NotNil(t, result.Stop.ActualArrival)
+	assert.False(t, result.LoadStatusChanged)
+
+	// A stop can only be arrived at once
+	status, _ = suite.checkIn("check-in", suite.pickup.ID, suite.carrier.ID, nearPickup)
+	assert.Equal(t, 400, status)
+}
+
+func (suite *StopCheckInHandlerTestSuite) TestCheckOutWithPhoto() {
+	t := suite.T()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("latitude", "-17.83")
+	writer.WriteField("longitude", "31.05")
+	writer.WriteField("notes", "Loaded 12 pallets")
+	part, _ := writer.CreateFormFile("photo", "pallets.png")
+	part.Write(testPNG)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/mobile/trips/%d/stops/%d/check-out", suite.trip.ID, suite.pickup.ID), body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-User-ID", strconv.Itoa(int(suite.carrier.ID)))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var result services.StopCheckInResult
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, "DEPART", result.CheckIn.Action)
+	assert.Contains(t, result.CheckIn.PhotoURL, ".png")
+	assert.Equal(t, "COMPLETED", result.Stop.Status)
+	assert.True(t, result.LoadStatusChanged)
+	assert.Equal(t, "BOOKED", result.PreviousLoadStatus)
+	assert.Equal(t, "PICKED_UP", result.LoadStatus)
+
+	var load models.Load
+	testDB.First(&load, suite.load.ID)
+	assert.Equal(t, "PICKED_UP", load.Status)
+	assert.NotNil(t, load.ActualPickupDate)
+
+	var eventCount int64
+	testDB.Model(&models.TrackingEvent{}).Where("load_id = ? AND event_type = ?", load.ID, "LOAD_STATUS_CHANGE").Count(&eventCount)
+	assert.Equal(t, int64(1), eventCount)
+}
+
+func (suite *StopCheckInHandlerTestSuite) TestCheckOutOfDelivery() {
+	t := suite.T()
+
+	// 900 m away is accepted with a reported accuracy of 500 m
+	farDelivery := fiber.Map{"latitude": -20.158, "longitude": 28.58}
+	status, _ := suite.checkIn("check-out", suite.delivery.ID, suite.carrier.ID, farDelivery)
+	assert.Equal(t, 400, status)
+	farDelivery["accuracy"] = 500
+	status, result := suite.checkIn("check-out", suite.delivery.ID, suite.carrier.ID, farDelivery)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "DELIVERED", result.LoadStatus)
+
+	var load models.Load
+	testDB.First(&load, suite.load.ID)
+	assert.Equal(t, "DELIVERED", load.Status)
+	assert.NotNil(t, load.ActualDeliveryDate)
+	assert.Nil(t, load.ActualPickupDate)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/tracking/trips/%d/stops/%d/check-ins", suite.trip.ID, suite.delivery.ID), nil)
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	assert.Equal(t, 200, resp.StatusCode)
+	var checkIns []models.StopCheckIn
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&checkIns))
+	if assert.Len(t, checkIns, 1) {
+		assert.Equal(t, suite.carrier.ID, checkIns[0].DriverID)
+		assert.Equal(t, suite.load.ID, *checkIns[0].LoadID)
+	}
+}
+
+func TestStopCheckInHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(StopCheckInHandlerTestSuite))
+}
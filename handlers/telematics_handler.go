@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"strconv"
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var telematicsService = services.NewTelematicsService(database.DB, config.GetTelematicsConfig())
+
+// telematicsError responds to a telematics service error
+func telematicsError(c *fiber.Ctx, err error) error {
+	status := 400
+	if err.Error() == "telematics connection not found" || err.Error() == "telematics device not found" {
+		status = 404
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
+
+// telematicsRequest reads the current user and the connection ID of a request
+func telematicsRequest(c *fiber.Ctx) (uint, uint, int, string) {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return 0, 0, 401, "Unauthorized"
+	}
+	connectionID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, 0, 400, "Invalid connection ID"
+	}
+	return uint(userID), uint(connectionID), 0, ""
+}
+
+// CreateTelematicsConnection @Summary Connect a telematics account
+// @Description Connect the carrier's Samsara or Geotab account. Vehicle positions are polled from it and ingested into the active trips of vehicles matching by VIN or license plate. Samsara accounts can also push positions to the connection's webhook, signed with webhook_secret.
+// @Tags telematics
+// @Accept json
+// @Produce json
+// @Param connection body services.TelematicsConnectionRequest true "Provider account"
+// @Success 201 {object} models.TelematicsConnection
+// @Router /telematics/connections [post]
+func CreateTelematicsConnection(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req services.TelematicsConnectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	conn, err := telematicsService.CreateConnection(uint(userID), req)
+	if err != nil {
+		return telematicsError(c, err)
+	}
+
+	return c.Status(201).JSON(conn)
+}
+
+// GetTelematicsConnections @Summary List telematics accounts
+// @Description List the current user's telematics connections with the outcome of their last poll
+// @Tags telematics
+// @Produce json
+// @Success 200 {array} models.TelematicsConnection
+// @Router /telematics/connections [get]
+func GetTelematicsConnections(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	connections, err := telematicsService.GetConnections(uint(userID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch telematics connections",
+		})
+	}
+
+	return c.JSON(connections)
+}
+
+// DeleteTelematicsConnection @Summary Disconnect a telematics account
+// @Description Stop ingesting positions from a telematics account
+// @Tags telematics
+// @Param id path int true "Connection ID"
+// @Success 204
+// @Router /telematics/connections/{id} [delete]
+func DeleteTelematicsConnection(c *fiber.Ctx) error {
+	userID, connectionID, status, message := telematicsRequest(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	if err := telematicsService.DeleteConnection(userID, connectionID); err != nil {
+		return telematicsError(c, err)
+	}
+
+	return c.SendStatus(204)
+}
+
+// PollTelematicsConnection @Summary Poll a telematics account
+// @Description Ingest the positions reported since the last poll right away, instead of waiting for the scheduled poll
+// @Tags telematics
+// @Produce json
+// @Param id path int true "Connection ID"
+// @Success 200 {object} services.TelematicsIngestResult
+// @Router /telematics/connections/{id}/poll [post]
+func PollTelematicsConnection(c *fiber.Ctx) error {
+	userID, connectionID, status, message := telematicsRequest(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	result, err := telematicsService.PollConnection(userID, connectionID)
+	if err != nil {
+		if err.Error() == "telematics connection not found" {
+			return telematicsError(c, err)
+		}
+		return c.Status(502).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// ReceiveTelematicsWebhook @Summary Receive telematics positions
+// @Description Ingest vehicle positions pushed by a telematics provider. The call is authenticated by the provider's signature of the body with the connection's webhook secret.
+// @Tags telematics
+// @Accept json
+// @Produce json
+// @Param id path int true "Connection ID"
+// @Success 200 {object} services.TelematicsIngestResult
+// @Router /telematics/webhooks/{id} [post]
+func ReceiveTelematicsWebhook(c *fiber.Ctx) error {
+	connectionID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid connection ID",
+		})
+	}
+
+	headers := make(map[string]string)
+	for name, values := range c.GetReqHeaders() {
+		if len(values) > 0 {
+			headers[name] = values[0]
+		}
+	}
+
+	result, err := telematicsService.HandleWebhook(uint(connectionID), headers, c.Body())
+	if err != nil {
+		status := 401
+		if err.Error() == "telematics connection not found" {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// CreateTelematicsDevice @Summary Register a telematics device
+// @Description Register a device or gateway that streams the carrier's vehicle positions to the gRPC ingestion API. The device authenticates with a client certificate issued by the platform's device CA for common_name.
+// @Tags telematics
+// @Accept json
+// @Produce json
+// @Param device body services.TelematicsDeviceRequest true "Device"
+// @Success 201 {object} models.TelematicsDevice
+// @Router /telematics/devices [post]
+func CreateTelematicsDevice(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req services.TelematicsDeviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	device, err := telematicsService.CreateDevice(uint(userID), req)
+	if err != nil {
+		return telematicsError(c, err)
+	}
+
+	return c.Status(201).JSON(device)
+}
+
+// GetTelematicsDevices @Summary List telematics devices
+// @Description List the current user's devices streaming positions over gRPC, with when each was last seen
+// @Tags telematics
+// @Produce json
+// @Success 200 {array} models.TelematicsDevice
+// @Router /telematics/devices [get]
+func GetTelematicsDevices(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	devices, err := telematicsService.GetDevices(uint(userID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch telematics devices",
+		})
+	}
+
+	return c.JSON(devices)
+}
+
+// DeleteTelematicsDevice @Summary Revoke a telematics device
+// @Description Stop accepting positions from a device, rejecting its certificate from then on
+// @Tags telematics
+// @Param id path int true "Device ID"
+// @Success 204
+// @Router /telematics/devices/{id} [delete]
+func DeleteTelematicsDevice(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+	deviceID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid device ID",
+		})
+	}
+
+	if err := telematicsService.DeleteDevice(uint(userID), uint(deviceID)); err != nil {
+		return telematicsError(c, err)
+	}
+
+	return c.SendStatus(204)
+}
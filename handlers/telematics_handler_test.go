@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+const testSamsaraWebhookSecret = "c2Ftc2FyYS1zZWNyZXQ=" // base64 of samsara-secret
+
+type TelematicsHandlerTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	carrier models.User
+	vehicle models.Vehicle
+	trip    models.Trip
+	samsara *httptest.Server
+	geotab  *httptest.Server
+	feeds   []string // Samsara feed cursors requested
+}
+
+func (suite *TelematicsHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+	// Positions are the tests' own, not the seeded one
+	testDB.Exec("DELETE FROM tracking_records")
+
+	suite.carrier = models.User{}
+	testDB.Where("email = ?", "test@example.com").First(&suite.carrier)
+	suite.vehicle = models.Vehicle{UserID: suite.carrier.ID, Make: "Volvo", LicensePlate: "ABC-123", VIN: "1FUJGLDR12LM00001"}
+	testDB.Create(&suite.vehicle)
+	suite.trip = models.Trip{}
+	testDB.Where("user_id = ?", suite.carrier.ID).First(&suite.trip)
+	testDB.Model(&suite.trip).Updates(map[string]interface{}{
+		"vehicle_id": suite.vehicle.ID, "status": "IN_TRANSIT", "tracking_enabled": true,
+		"destination_lat": 40.7128, "destination_lng": -74.0060,
+	})
+
+	suite.feeds = nil
+	suite.samsara = httptest.NewServer(http.HandlerFunc(suite.serveSamsara))
+	suite.geotab = httptest.NewServer(http.HandlerFunc(suite.serveGeotab))
+
+	cfg := &config.TelematicsConfig{
+		SamsaraBaseURL:   suite.samsara.URL,
+		GeotabBaseURL:    suite.geotab.URL,
+		HTTPTimeout:      5 * time.Second,
+		WebhookTolerance: 5 * time.Minute,
+	}
+	telematicsService = services.NewTelematicsService(testDB, cfg)
+
+	suite.app = fiber.New()
+
+	connections := suite.app.Group("/connections", asHeaderUser())
+	connections.Post("/", CreateTelematicsConnection)
+	connections.Get("/", GetTelematicsConnections)
+	connections.Delete("/:id", DeleteTelematicsConnection)
+	connections.Post("/:id/poll", PollTelematicsConnection)
+	suite.app.Post("/webhooks/:id", ReceiveTelematicsWebhook)
+}
+
+func (suite *TelematicsHandlerTestSuite) TearDownTest() {
+	suite.samsara.Close()
+	suite.geotab.Close()
+	clearTestDB()
+}
+
+// serveSamsara fakes the Samsara vehicle stats feed and vehicle list
+func (suite *TelematicsHandlerTestSuite) serveSamsara(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer samsara-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message":"Unauthorized"}`))
+		return
+	}
+
+	switch r.URL.Path {
+	case "/fleet/vehicles/stats/feed":
+		after := r.URL.Query().Get("after")
+		suite.feeds = append(suite.feeds, after)
+		if after == "" {
+			now := time.Now().UTC()
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": []map[string]interface{}{
+					{"id": "281474", "name": "Truck 1", "externalIds": map[string]string{}, "gps": []map[string]interface{}{
+						{"time": now.Add(-time.Minute), "latitude": 40.1, "longitude": -75.1, "headingDegrees": 90, "speedMilesPerHour": 50},
+						{"time": now.Add(-2 * time.Minute), "latitude": 40.0, "longitude": -75.2, "headingDegrees": 90, "speedMilesPerHour": 40},
+					}},
+					{"id": "999", "name": "Unknown truck", "gps": []map[string]interface{}{
+						{"time": now, "latitude": 41, "longitude": -76},
+					}},
+				},
+				"pagination": map[string]interface{}{"endCursor": "cursor-1", "hasNextPage": false},
+			})
+			return
+		}
+		w.Write([]byte(`{"data":[],"pagination":{"endCursor":"cursor-2","hasNextPage":false}}`))
+	case "/fleet/vehicles":
+		w.Write([]byte(`{"data":[{"id":"281474","licensePlate":"abc 123"},{"id":"999","licensePlate":"ZZZ-999"}],"pagination":{"hasNextPage":false}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// serveGeotab fakes the MyGeotab JSON-RPC API
+func (suite *TelematicsHandlerTestSuite) serveGeotab(w http.ResponseWriter, r *http.Request) {
+	var call struct {
+		Method string                 `json:"method"`
+		Params map[string]interface{} `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&call)
+
+	switch call.Method {
+	case "Authenticate":
+		if call.Params["password"] != "geotab-password" {
+			w.Write([]byte(`{"error":{"message":"Incorrect login credentials"}}`))
+			return
+		}
+		w.Write([]byte(`{"result":{"credentials":{"database":"fleet","userName":"api@fleet.com","sessionId":"s1"},"path":"ThisServer"}}`))
+	case "GetFeed":
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]interface{}{
+			"data": []map[string]interface{}{
+				{"dateTime": time.Now().UTC().Add(-time.Minute), "latitude": 40.2, "longitude": -75.0, "speed": 80, "device": map[string]string{"id": "b1"}},
+			},
+			"toVersion": "0000000000000042",
+		}})
+	case "Get":
+		w.Write([]byte(`{"result":[{"id":"b1","name":"Unit 7","licensePlate":"","vehicleIdentificationNumber":"1fujgldr12lm00001"}]}`))
+	}
+}
+
+func (suite *TelematicsHandlerTestSuite) request(method, url string, userID uint, body interface{}) (int, []byte) {
+	jsonData, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var respBody bytes.Buffer
+	respBody.ReadFrom(resp.Body)
+	return resp.StatusCode, respBody.Bytes()
+}
+
+func (suite *TelematicsHandlerTestSuite) connect(req services.TelematicsConnectionRequest) models.TelematicsConnection {
+	status, body := suite.request("POST", "/connections", suite.carrier.ID, req)
+	suite.Require().Equal(201, status, string(body))
+
+	var conn models.TelematicsConnection
+	suite.Require().NoError(json.Unmarshal(body, &conn))
+	return conn
+}
+
+func (suite *TelematicsHandlerTestSuite) TestPollSamsara() {
+	t := suite.T()
+
+	conn := suite.connect(services.TelematicsConnectionRequest{Provider: "samsara", Secret: "samsara-token"})
+	assert.Equal(t, services.TelematicsSamsara, conn.Provider)
+
+	status, body := suite.request("POST", "/connections/"+strconv.Itoa(int(conn.ID))+"/poll", suite.carrier.ID, nil)
+	assert.Equal(t, 200, status, string(body))
+	var result services.TelematicsIngestResult
+	assert.NoError(t, json.Unmarshal(body, &result))
+	assert.Equal(t, 3, result.Positions)
+	assert.Equal(t, 2, result.Ingested)
+	assert.Equal(t, []uint{suite.trip.ID}, result.Trips)
+	assert.Equal(t, []string{"Unknown truck"}, result.UnmatchedVehicles)
+	assert.Empty(t, result.Errors)
+
+	// Positions are recorded in order, at the time they were reported
+	var records []models.TrackingRecord
+	testDB.Where("trip_id = ?", suite.trip.ID).Order("id").Find(&records)
+	assert.Len(t, records, 2)
+	assert.Equal(t, 40.0, records[0].Latitude)
+	assert.Equal(t, 40.1, records[1].Latitude)
+	assert.True(t, records[1].Timestamp.Before(time.Now().Add(-30*time.Second)))
+	assert.InDelta(t, 80.5, *records[1].Speed, 0.1)
+
+	var trip models.Trip
+	testDB.First(&trip, suite.trip.ID)
+	assert.Equal(t, 40.1, *trip.CurrentLatitude)
+
+	// The next poll continues from the feed's cursor
+	status, _ = suite.request("POST", "/connections/"+strconv.Itoa(int(conn.ID))+"/poll", suite.carrier.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, []string{"", "cursor-1"}, suite.feeds)
+	testDB.First(&conn, conn.ID)
+	assert.Equal(t, "cursor-2", conn.Cursor)
+	assert.NotNil(t, conn.LastPolledAt)
+}
+
+func (suite *TelematicsHandlerTestSuite) TestPollGeotab() {
+	t := suite.T()
+
+	// Missing Geotab account details are rejected
+	status, _ := suite.request("POST", "/connections", suite.carrier.ID, services.TelematicsConnectionRequest{Provider: "GEOTAB", Secret: "geotab-password"})
+	assert.Equal(t, 400, status)
+
+	conn := suite.connect(services.TelematicsConnectionRequest{
+		Provider: "GEOTAB", AccountID: "fleet", Username: "api@fleet.com", Secret: "geotab-password",
+	})
+
+	status, body := suite.request("POST", "/connections/"+strconv.Itoa(int(conn.ID))+"/poll", suite.carrier.ID, nil)
+	assert.Equal(t, 200, status, string(body))
+	var result services.TelematicsIngestResult
+	assert.NoError(t, json.Unmarshal(body, &result))
+	assert.Equal(t, 1, result.Ingested)
+
+	testDB.First(&conn, conn.ID)
+	assert.Equal(t, "0000000000000042", conn.Cursor)
+
+	// Failed polls are recorded on the connection
+	testDB.Model(&conn).Update("secret", "wrong")
+	status, _ = suite.request("POST", "/connections/"+strconv.Itoa(int(conn.ID))+"/poll", suite.carrier.ID, nil)
+	assert.Equal(t, 502, status)
+	testDB.First(&conn, conn.ID)
+	assert.Contains(t, conn.LastError, "Incorrect login credentials")
+
+	// Other carriers can't see or poll the connection
+	status, _ = suite.request("POST", "/connections/"+strconv.Itoa(int(conn.ID))+"/poll", suite.carrier.ID+100, nil)
+	assert.Equal(t, 404, status)
+	status, body = suite.request("GET", "/connections", suite.carrier.ID+100, nil)
+	assert.Equal(t, 200, status)
+	assert.JSONEq(t, "[]", string(body))
+}
+
+func (suite *TelematicsHandlerTestSuite) TestSamsaraWebhook() {
+	t := suite.T()
+
+	conn := suite.connect(services.TelematicsConnectionRequest{Provider: "SAMSARA", Secret: "samsara-token", WebhookSecret: testSamsaraWebhookSecret})
+	webhookURL := "/webhooks/" + strconv.Itoa(int(conn.ID))
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"data": []map[string]interface{}{
+			{"id": "281474", "name": "Truck 1", "externalIds": map[string]string{"samsara.vin": "1FUJGLDR12LM00001"}, "gps": []map[string]interface{}{
+				{"time": time.Now().UTC(), "latitude": 40.3, "longitude": -74.9},
+			}},
+		},
+	})
+	send := func(timestamp int64, signature string) int {
+		req := httptest.NewRequest("POST", webhookURL, bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Samsara-Timestamp", strconv.FormatInt(timestamp, 10))
+		req.Header.Set("X-Samsara-Signature", signature)
+		resp, err := suite.app.Test(req, -1)
+		suite.Require().NoError(err)
+		return resp.StatusCode
+	}
+	sign := func(timestamp int64) string {
+		secret, _ := base64.StdEncoding.DecodeString(testSamsaraWebhookSecret)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte("v1:" + strconv.FormatInt(timestamp, 10) + ":"))
+		mac.Write(payload)
+		return "v1=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	now := time.Now().Unix()
+	assert.Equal(t, 401, send(now, "v1=deadbeef"))
+	old := time.Now().Add(-time.Hour).Unix()
+	assert.Equal(t, 401, send(old, sign(old)))
+	assert.Equal(t, 200, send(now, sign(now)))
+
+	var records []models.TrackingRecord
+	testDB.Where("trip_id = ?", suite.trip.ID).Find(&records)
+	assert.Len(t, records, 1)
+	assert.Equal(t, 40.3, records[0].Latitude)
+
+	// Deleted connections stop accepting positions
+	status, _ := suite.request("DELETE", "/connections/"+strconv.Itoa(int(conn.ID)), suite.carrier.ID, nil)
+	assert.Equal(t, 204, status)
+	assert.Equal(t, 404, send(now, sign(now)))
+}
+
+func TestTelematicsHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(TelematicsHandlerTestSuite))
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/telematicspb"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// maxStreamSummaryErrors caps the errors returned in a stream's summary, as a
+// misbehaving device can send thousands of rejected positions
+const maxStreamSummaryErrors = 100
+
+// TelematicsStreamServer implements the gRPC API that devices and gateways
+// stream vehicle positions to
+type TelematicsStreamServer struct {
+	telematicspb.UnimplementedTelematicsIngestionServer
+	telematics    *services.TelematicsService
+	batchSize     int
+	batchInterval time.Duration
+}
+
+// NewTelematicsStreamServer creates a new telematics stream server
+func NewTelematicsStreamServer(telematics *services.TelematicsService, cfg *config.GRPCConfig) *TelematicsStreamServer {
+	return &TelematicsStreamServer{
+		telematics:    telematics,
+		batchSize:     cfg.BatchSize,
+		batchInterval: cfg.BatchInterval,
+	}
+}
+
+// NewGRPCServer creates the gRPC server with the telematics ingestion API.
+// Clients must present a certificate issued by the configured client CA.
+func NewGRPCServer(cfg *config.GRPCConfig, telematics *services.TelematicsService) (*grpc.Server, error) {
+	certificate, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load gRPC certificate: %w", err)
+	}
+	caPEM, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gRPC client CA: %w", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("gRPC client CA %s has no certificates", cfg.ClientCAFile)
+	}
+
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    clientCAs,
+			MinVersion:   tls.VersionTLS12,
+		})),
+		// Streams cancelled on shutdown still record their buffered positions
+		grpc.WaitForHandlers(true),
+	)
+	telematicspb.RegisterTelematicsIngestionServer(server, NewTelematicsStreamServer(telematics, cfg))
+	return server, nil
+}
+
+// authenticateDevice returns the device registered with the common name of
+// the stream's verified client certificate
+func (s *TelematicsStreamServer) authenticateDevice(ctx context.Context) (*models.TelematicsDevice, error) {
+	client, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "client certificate required")
+	}
+	info, ok := client.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "client certificate required")
+	}
+
+	commonName := info.State.VerifiedChains[0][0].Subject.CommonName
+	device, err := s.telematics.AuthenticateDevice(commonName)
+	if err != nil {
+		return nil, status.Errorf(codes.PermissionDenied, "certificate %q is not registered as a telematics device", commonName)
+	}
+	return device, nil
+}
+
+// LocationUpdates records the positions streamed by a device in batches of
+// up to batchSize, waiting at most batchInterval to record a position. While
+// a batch is recorded no more positions are read, so fast clients are slowed
+// down by flow control instead of buffering without bound.
+func (s *TelematicsStreamServer) LocationUpdates(stream telematicspb.TelematicsIngestion_LocationUpdatesServer) error {
+	device, err := s.authenticateDevice(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	updates := make(chan *telematicspb.LocationUpdate)
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			update, err := stream.Recv()
+			if err != nil {
+				closed <- err
+				return
+			}
+			select {
+			case updates <- update:
+			case <-stream.Context().Done():
+				closed <- stream.Context().Err()
+				return
+			}
+		}
+	}()
+
+	summary := newStreamSummary()
+	var batch []services.TelematicsPosition
+	var deadline <-chan time.Time
+	flush := func() {
+		if len(batch) > 0 {
+			summary.add(s.telematics.IngestDeviceBatch(device, batch))
+		}
+		batch = nil
+		deadline = nil
+	}
+
+	for {
+		select {
+		case update := <-updates:
+			summary.received++
+			batch = append(batch, telematicsPosition(update, time.Now()))
+			if len(batch) == 1 {
+				deadline = time.After(s.batchInterval)
+			}
+			if len(batch) >= s.batchSize {
+				flush()
+			}
+		case <-deadline:
+			flush()
+		case err := <-closed:
+			// Positions received before the stream broke are still recorded
+			flush()
+			if err != io.EOF {
+				return err
+			}
+			return stream.SendAndClose(summary.message())
+		}
+	}
+}
+
+// telematicsPosition converts a streamed position, which without a timestamp
+// was recorded when received
+func telematicsPosition(update *telematicspb.LocationUpdate, received time.Time) services.TelematicsPosition {
+	timestamp := received
+	if update.Timestamp != nil {
+		timestamp = update.Timestamp.AsTime()
+	}
+	label := update.Vin
+	if label == "" {
+		label = update.LicensePlate
+	}
+	return services.TelematicsPosition{
+		VehicleID:    label,
+		LicensePlate: update.LicensePlate,
+		VIN:          update.Vin,
+		Latitude:     update.Latitude,
+		Longitude:    update.Longitude,
+		Altitude:     update.Altitude,
+		Speed:        update.Speed,
+		Heading:      update.Heading,
+		Accuracy:     update.Accuracy,
+		Timestamp:    timestamp,
+	}
+}
+
+// streamSummary accumulates the outcome of a stream's batches
+type streamSummary struct {
+	received  int64
+	ingested  int64
+	trips     map[uint]bool
+	unmatched map[string]bool
+	idle      map[string]bool
+	errors    []string
+}
+
+func newStreamSummary() *streamSummary {
+	return &streamSummary{
+		trips:     make(map[uint]bool),
+		unmatched: make(map[string]bool),
+		idle:      make(map[string]bool),
+	}
+}
+
+func (ss *streamSummary) add(result *services.TelematicsIngestResult) {
+	ss.ingested += int64(result.Ingested)
+	for _, tripID := range result.Trips {
+		ss.trips[tripID] = true
+	}
+	for _, label := range result.UnmatchedVehicles {
+		ss.unmatched[label] = true
+	}
+	for _, label := range result.IdleVehicles {
+		ss.idle[label] = true
+	}
+	for _, message := range result.Errors {
+		if len(ss.errors) >= maxStreamSummaryErrors {
+			break
+		}
+		ss.errors = append(ss.errors, message)
+	}
+}
+
+func (ss *streamSummary) message() *telematicspb.LocationUpdatesSummary {
+	summary := &telematicspb.LocationUpdatesSummary{
+		Received: ss.received,
+		Ingested: ss.ingested,
+		Errors:   ss.errors,
+	}
+	for tripID := range ss.trips {
+		summary.Trips = append(summary.Trips, uint64(tripID))
+	}
+	for label := range ss.unmatched {
+		summary.UnmatchedVehicles = append(summary.UnmatchedVehicles, label)
+	}
+	for label := range ss.idle {
+		summary.IdleVehicles = append(summary.IdleVehicles, label)
+	}
+	sort.Slice(summary.Trips, func(i, j int) bool { return summary.Trips[i] < summary.Trips[j] })
+	sort.Strings(summary.UnmatchedVehicles)
+	sort.Strings(summary.IdleVehicles)
+	return summary
+}
@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/telematicspb"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type TelematicsStreamHandlerTestSuite struct {
+	suite.Suite
+	app      *fiber.App
+	carrier  models.User
+	vehicle  models.Vehicle
+	trip     models.Trip
+	ca       *testCertificateAuthority
+	cfg      *config.GRPCConfig
+	listener *bufconn.Listener
+	server   *grpc.Server
+}
+
+// testCertificateAuthority issues the certificates of a test server and its
+// clients
+type testCertificateAuthority struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pem         []byte
+	serial      int64
+}
+
+func newTestCertificateAuthority(t *testing.T) *testCertificateAuthority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Triplink Devices Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	return &testCertificateAuthority{
+		certificate: certificate,
+		key:         key,
+		pem:         pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		serial:      1,
+	}
+}
+
+// issue returns the PEM encoded certificate and key for a common name
+func (ca *testCertificateAuthority) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (suite *TelematicsStreamHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+	// Positions are the tests' own, not the seeded one
+	testDB.Exec("DELETE FROM tracking_records")
+	t := suite.T()
+
+	suite.carrier = models.User{}
+	testDB.Where("email = ?", "test@example.com").First(&suite.carrier)
+	suite.vehicle = models.Vehicle{UserID: suite.carrier.ID, Make: "Volvo", LicensePlate: "ABC-123", VIN: "1FUJGLDR12LM00001"}
+	testDB.Create(&suite.vehicle)
+	suite.trip = models.Trip{}
+	testDB.Where("user_id = ?", suite.carrier.ID).First(&suite.trip)
+	testDB.Model(&suite.trip).Updates(map[string]interface{}{
+		"vehicle_id": suite.vehicle.ID, "status": "IN_TRANSIT", "tracking_enabled": true,
+		"destination_lat": 40.7128, "destination_lng": -74.0060,
+	})
+
+	telematicsService = services.NewTelematicsService(testDB, config.GetTelematicsConfig())
+
+	suite.app = fiber.New()
+	devices := suite.app.Group("/devices", asHeaderUser())
+	devices.Post("/", CreateTelematicsDevice)
+	devices.Get("/", GetTelematicsDevices)
+	devices.Delete("/:id", DeleteTelematicsDevice)
+
+	// Serve the gRPC API over an in-memory listener with the server
+	// certificate and client CA read from files, as configured in production
+	suite.ca = newTestCertificateAuthority(t)
+	dir := t.TempDir()
+	certPEM, keyPEM := suite.ca.issue(t, "localhost", x509.ExtKeyUsageServerAuth)
+	cfg := &config.GRPCConfig{
+		Enabled:       true,
+		CertFile:      filepath.Join(dir, "server.crt"),
+		KeyFile:       filepath.Join(dir, "server.key"),
+		ClientCAFile:  filepath.Join(dir, "ca.crt"),
+		BatchSize:     3,
+		BatchInterval: time.Hour,
+	}
+	suite.Require().NoError(os.WriteFile(cfg.CertFile, certPEM, 0600))
+	suite.Require().NoError(os.WriteFile(cfg.KeyFile, keyPEM, 0600))
+	suite.Require().NoError(os.WriteFile(cfg.ClientCAFile, suite.ca.pem, 0600))
+	suite.cfg = cfg
+	suite.startServer(cfg)
+}
+
+func (suite *TelematicsStreamHandlerTestSuite) startServer(cfg *config.GRPCConfig) {
+	if suite.server != nil {
+		suite.server.Stop()
+	}
+	server, err := NewGRPCServer(cfg, telematicsService)
+	suite.Require().NoError(err)
+	suite.server = server
+	suite.listener = bufconn.Listen(1024 * 1024)
+	go server.Serve(suite.listener)
+}
+
+func (suite *TelematicsStreamHandlerTestSuite) TearDownTest() {
+	suite.server.Stop()
+	suite.server = nil
+	clearTestDB()
+}
+
+func (suite *TelematicsStreamHandlerTestSuite) request(method, url string, userID uint, body interface{}) (int, []byte) {
+	jsonData, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var respBody bytes.Buffer
+	respBody.ReadFrom(resp.Body)
+	return resp.StatusCode, respBody.Bytes()
+}
+
+func (suite *TelematicsStreamHandlerTestSuite) registerDevice(commonName string) models.TelematicsDevice {
+	status, body := suite.request("POST", "/devices", suite.carrier.ID, services.TelematicsDeviceRequest{Name: "Yard gateway", CommonName: commonName})
+	suite.Require().Equal(201, status, string(body))
+
+	var device models.TelematicsDevice
+	suite.Require().NoError(json.Unmarshal(body, &device))
+	return device
+}
+
+// client connects to the gRPC API with a certificate issued by ca
+func (suite *TelematicsStreamHandlerTestSuite) client(ca *testCertificateAuthority, commonName string) telematicspb.TelematicsIngestionClient {
+	t := suite.T()
+	certPEM, keyPEM := ca.issue(t, commonName, x509.ExtKeyUsageClientAuth)
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	suite.Require().NoError(err)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(suite.ca.pem)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return suite.listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			RootCAs:      roots,
+			ServerName:   "localhost",
+		})),
+	)
+	suite.Require().NoError(err)
+	t.Cleanup(func() { conn.Close() })
+	return telematicspb.NewTelematicsIngestionClient(conn)
+}
+
+// stream sends positions and returns the summary of the closed stream
+func (suite *TelematicsStreamHandlerTestSuite) stream(client telematicspb.TelematicsIngestionClient, updates ...*telematicspb.LocationUpdate) (*telematicspb.LocationUpdatesSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := client.LocationUpdates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, update := range updates {
+		if err := stream.Send(update); err != nil {
+			break
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+func streamedSpeed(value float64) *float64 {
+	return &value
+}
+
+func (suite *TelematicsStreamHandlerTestSuite) TestStreamLocationUpdates() {
+	t := suite.T()
+	device := suite.registerDevice("gateway-01.fleet.example")
+
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	var updates []*telematicspb.LocationUpdate
+	for i := 0; i < 4; i++ {
+		updates = append(updates, &telematicspb.LocationUpdate{
+			Vin:       "1fujgldr12lm00001",
+			Latitude:  40.0 + float64(i)*0.001,
+			Longitude: -75.0,
+			Speed:     streamedSpeed(72),
+			Timestamp: timestamppb.New(start.Add(time.Duration(i) * time.Second)),
+		})
+	}
+	updates = append(updates,
+		// Matched by license plate, without a timestamp
+		&telematicspb.LocationUpdate{LicensePlate: "abc 123", Latitude: 40.01, Longitude: -75.0},
+		&telematicspb.LocationUpdate{LicensePlate: "ZZZ-999", Latitude: 41, Longitude: -76},
+		&telematicspb.LocationUpdate{Vin: "1FUJGLDR12LM00001", Latitude: 95, Longitude: -75},
+	)
+
+	summary, err := suite.stream(suite.client(suite.ca, device.CommonName), updates...)
+	suite.Require().NoError(err)
+	assert.Equal(t, int64(7), summary.Received)
+	assert.Equal(t, int64(5), summary.Ingested)
+	assert.Equal(t, []uint64{uint64(suite.trip.ID)}, summary.Trips)
+	assert.Equal(t, []string{"ZZZ-999"}, summary.UnmatchedVehicles)
+	assert.Len(t, summary.Errors, 1)
+
+	var records []models.TrackingRecord
+	testDB.Where("trip_id = ?", suite.trip.ID).Order("id").Find(&records)
+	assert.Len(t, records, 5)
+	assert.True(t, records[0].Timestamp.Equal(start))
+	assert.InDelta(t, 72, *records[0].Speed, 0.1)
+	assert.WithinDuration(t, time.Now(), records[4].Timestamp, 10*time.Second)
+
+	testDB.First(&device, device.ID)
+	assert.NotNil(t, device.LastSeenAt)
+
+	// Streamed batches are not logged as sync events
+	var events int64
+	testDB.Model(&models.TrackingEvent{}).Where("trip_id = ? AND event_type = ?", suite.trip.ID, "TELEMATICS_SYNC").Count(&events)
+	assert.Zero(t, events)
+}
+
+func (suite *TelematicsStreamHandlerTestSuite) TestStreamRecordsBatchAfterInterval() {
+	t := suite.T()
+	device := suite.registerDevice("gateway-01.fleet.example")
+	cfg := *suite.cfg
+	cfg.BatchSize = 100
+	cfg.BatchInterval = 50 * time.Millisecond
+	suite.startServer(&cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := suite.client(suite.ca, device.CommonName).LocationUpdates(ctx)
+	suite.Require().NoError(err)
+	suite.Require().NoError(stream.Send(&telematicspb.LocationUpdate{Vin: suite.vehicle.VIN, Latitude: 40, Longitude: -75}))
+
+	// Recorded while the stream is still open
+	assert.Eventually(t, func() bool {
+		var count int64
+		testDB.Model(&models.TrackingRecord{}).Where("trip_id = ?", suite.trip.ID).Count(&count)
+		return count == 1
+	}, 5*time.Second, 20*time.Millisecond)
+
+	summary, err := stream.CloseAndRecv()
+	suite.Require().NoError(err)
+	assert.Equal(t, int64(1), summary.Ingested)
+}
+
+func (suite *TelematicsStreamHandlerTestSuite) TestStreamRejectsUnregisteredDevice() {
+	t := suite.T()
+
+	_, err := suite.stream(suite.client(suite.ca, "unknown.fleet.example"), &telematicspb.LocationUpdate{Vin: suite.vehicle.VIN, Latitude: 40, Longitude: -75})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Revoked devices are rejected even with a valid certificate
+	device := suite.registerDevice("gateway-02.fleet.example")
+	code, _ := suite.request("DELETE", "/devices/"+strconv.Itoa(int(device.ID)), suite.carrier.ID, nil)
+	suite.Require().Equal(204, code)
+	_, err = suite.stream(suite.client(suite.ca, device.CommonName), &telematicspb.LocationUpdate{Vin: suite.vehicle.VIN, Latitude: 40, Longitude: -75})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	var count int64
+	testDB.Model(&models.TrackingRecord{}).Where("trip_id = ?", suite.trip.ID).Count(&count)
+	assert.Zero(t, count)
+}
+
+func (suite *TelematicsStreamHandlerTestSuite) TestStreamRejectsCertificateFromOtherCA() {
+	t := suite.T()
+	device := suite.registerDevice("gateway-01.fleet.example")
+
+	other := newTestCertificateAuthority(t)
+	_, err := suite.stream(suite.client(other, device.CommonName), &telematicspb.LocationUpdate{Vin: suite.vehicle.VIN, Latitude: 40, Longitude: -75})
+	assert.Error(t, err)
+
+	var count int64
+	testDB.Model(&models.TrackingRecord{}).Where("trip_id = ?", suite.trip.ID).Count(&count)
+	assert.Zero(t, count)
+}
+
+func (suite *TelematicsStreamHandlerTestSuite) TestManageDevices() {
+	t := suite.T()
+	device := suite.registerDevice(" gateway-01.fleet.example ")
+	assert.Equal(t, "gateway-01.fleet.example", device.CommonName)
+	assert.Equal(t, "Yard gateway", device.Name)
+	assert.True(t, device.IsActive)
+
+	status, body := suite.request("POST", "/devices", suite.carrier.ID, services.TelematicsDeviceRequest{CommonName: "gateway-01.fleet.example"})
+	assert.Equal(t, 400, status, string(body))
+	status, _ = suite.request("POST", "/devices", suite.carrier.ID, services.TelematicsDeviceRequest{Name: "No certificate"})
+	assert.Equal(t, 400, status)
+
+	status, body = suite.request("GET", "/devices", suite.carrier.ID, nil)
+	assert.Equal(t, 200, status)
+	var devices []models.TelematicsDevice
+	assert.NoError(t, json.Unmarshal(body, &devices))
+	assert.Len(t, devices, 1)
+
+	// Other carriers neither see nor revoke the device
+	other := models.User{Email: "other@example.com", Phone: "+1987654321", Password: "password", Role: "CARRIER"}
+	testDB.Create(&other)
+	status, body = suite.request("GET", "/devices", other.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.JSONEq(t, "[]", string(body))
+	status, _ = suite.request("DELETE", "/devices/"+strconv.Itoa(int(device.ID)), other.ID, nil)
+	assert.Equal(t, 404, status)
+
+	status, _ = suite.request("DELETE", "/devices/"+strconv.Itoa(int(device.ID)), suite.carrier.ID, nil)
+	assert.Equal(t, 204, status)
+}
+
+func TestTelematicsStreamHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(TelematicsStreamHandlerTestSuite))
+}
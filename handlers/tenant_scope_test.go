@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/middleware"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+// registerTenantScope registers the tenant scope plugin on the test
+// database, once for all suites
+func registerTenantScope(t *testing.T) {
+	if err := testDB.Use(services.NewTenantScopePlugin()); err != nil && !errors.Is(err, gorm.ErrRegistered) {
+		t.Fatal(err)
+	}
+}
+
+// asSeededUser scopes a request to the user created by seedTestDB
+func asSeededUser() fiber.Handler {
+	tenant := middleware.NewTenantMiddleware(testDB).Scope()
+	return func(c *fiber.Ctx) error {
+		var user models.User
+		testDB.Where("email = ?", "test@example.com").First(&user)
+		c.Locals("user_id", float64(user.ID))
+		return tenant(c)
+	}
+}
+
+type TenantScopeTestSuite struct {
+	suite.Suite
+	app        *fiber.App
+	dispatcher models.User
+	driver     models.User
+	shipper    models.User
+	rival      models.User
+	admin      models.User
+
+	fleetTrip models.Trip
+	rivalTrip models.Trip
+	ownLoad   models.Load
+	otherLoad models.Load
+	rivalLoad models.Load
+}
+
+func (suite *TenantScopeTestSuite) SetupSuite() {
+	registerTenantScope(suite.T())
+}
+
+func (suite *TenantScopeTestSuite) SetupTest() {
+	clearTestDB()
+	organizationService = services.NewOrganizationService(testDB)
+	trackingService = services.NewTrackingService(testDB)
+	workspaceService = services.NewWorkspaceService(testDB)
+	tripAssignmentService = services.NewTripAssignmentService(testDB)
+
+	users := []*models.User{&suite.dispatcher, &suite.driver, &suite.shipper, &suite.rival, &suite.admin}
+	roles := []string{"CARRIER", "DRIVER", "SHIPPER", "CARRIER", "ADMIN"}
+	for i, user := range users {
+		*user = models.User{Email: fmt.Sprintf("user%d@example.com", i), Phone: fmt.Sprintf("+1555000010%d", i), Password: "password", Role: roles[i]}
+		testDB.Create(user)
+	}
+
+	// The dispatcher's fleet and a rival carrier, each with a trip
+	fleet := models.Organization{Name: "Fleet", Type: services.OrganizationCarrier, OwnerID: suite.dispatcher.ID}
+	testDB.Create(&fleet)
+	testDB.Create(&models.OrganizationMembership{OrganizationID: fleet.ID, UserID: suite.dispatcher.ID, Role: services.OrganizationDispatcher})
+	testDB.Create(&models.OrganizationMembership{OrganizationID: fleet.ID, UserID: suite.driver.ID, Role: services.OrganizationDriver})
+
+	suite.fleetTrip = models.Trip{UserID: suite.admin.ID, OrganizationID: &fleet.ID, Status: "PLANNED"}
+	testDB.Create(&suite.fleetTrip)
+	suite.rivalTrip = models.Trip{UserID: suite.rival.ID, Status: "PLANNED"}
+	testDB.Create(&suite.rivalTrip)
+	testDB.Create(&models.TripAssignment{TripID: suite.fleetTrip.ID, DriverID: suite.driver.ID, AssignedBy: suite.dispatcher.ID, StartsAt: time.Now().Add(-time.Hour)})
+
+	// The shipper's load and another shipper's on the fleet's trip, and a
+	// load on the rival's trip
+	suite.ownLoad = models.Load{ShipperID: suite.shipper.ID, TripID: suite.fleetTrip.ID, BookingReference: "OWN"}
+	testDB.Create(&suite.ownLoad)
+	suite.otherLoad = models.Load{ShipperID: suite.admin.ID, TripID: suite.fleetTrip.ID, BookingReference: "OTHER"}
+	testDB.Create(&suite.otherLoad)
+	suite.rivalLoad = models.Load{ShipperID: suite.admin.ID, TripID: suite.rivalTrip.ID, BookingReference: "RIVAL"}
+	testDB.Create(&suite.rivalLoad)
+
+	suite.app = fiber.New()
+
+	suite.app.Use(asHeaderUser())
+
+	tenant := middleware.NewTenantMiddleware(testDB).Scope()
+	suite.app.Get("/trips", tenant, GetTrips)
+	suite.app.Get("/trips/:id", tenant, GetTrip)
+	suite.app.Get("/trips/:trip_id/customs-summary", tenant, GetTripCustomsSummary)
+	suite.app.Get("/loads", tenant, GetLoads)
+	suite.app.Get("/loads/:id", tenant, GetLoad)
+	suite.app.Get("/loads/:load_id/customs-documents", tenant, GetLoadCustomsDocuments)
+	suite.app.Get("/loads/:load_id/customs-compliance", tenant, CheckLoadCustomsCompliance)
+	suite.app.Get("/loads/:load_id/quotes", tenant, GetLoadQuotes)
+	suite.app.Get("/trips/:trip_id/assignments", tenant, GetTripAssignments)
+	suite.app.Get("/trips/:trip_id/fuel-plan", tenant, GetTripFuelPlan)
+
+	tracking := suite.app.Group("/tracking", tenant)
+	tracking.Get("/trips/:trip_id/current", GetCurrentTripLocation)
+	tracking.Get("/trips/:trip_id/history", GetTripTrackingHistory)
+	tracking.Get("/trips/:trip_id/events", GetTripTrackingEvents)
+	tracking.Get("/trips/:trip_id/status", GetTripTrackingStatus)
+	tracking.Get("/loads/:load_id", GetLoadTracking)
+	tracking.Get("/loads/:load_id/history", GetLoadTrackingHistory)
+	tracking.Get("/users/:user_id/carrier-view", GetCarrierTrackingView)
+}
+
+func (suite *TenantScopeTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *TenantScopeTestSuite) get(url string, userID uint, result interface{}) int {
+	req := httptest.NewRequest("GET", url, nil)
+	if userID != 0 {
+		req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	}
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	if result != nil && resp.StatusCode == 200 {
+		suite.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	}
+	return resp.StatusCode
+}
+
+func (suite *TenantScopeTestSuite) tripIDs(userID uint) []uint {
+	var trips []models.Trip
+	suite.Require().Equal(200, suite.get("/trips", userID, &trips))
+	ids := []uint{}
+	for _, trip := range trips {
+		ids = append(ids, trip.ID)
+	}
+	return ids
+}
+
+func (suite *TenantScopeTestSuite) loadIDs(userID uint) []uint {
+	var loads []models.Load
+	suite.Require().Equal(200, suite.get("/loads", userID, &loads))
+	ids := []uint{}
+	for _, load := range loads {
+		ids = append(ids, load.ID)
+	}
+	return ids
+}
+
+func (suite *TenantScopeTestSuite) TestListsOnlyVisibleRecords() {
+	t := suite.T()
+	fleetTrip, rivalTrip := suite.fleetTrip.ID, suite.rivalTrip.ID
+
+	assert.ElementsMatch(t, []uint{fleetTrip}, suite.tripIDs(suite.dispatcher.ID))
+	assert.ElementsMatch(t, []uint{fleetTrip}, suite.tripIDs(suite.driver.ID))
+	assert.ElementsMatch(t, []uint{fleetTrip}, suite.tripIDs(suite.shipper.ID))
+	assert.ElementsMatch(t, []uint{rivalTrip}, suite.tripIDs(suite.rival.ID))
+	assert.ElementsMatch(t, []uint{fleetTrip, rivalTrip}, suite.tripIDs(suite.admin.ID))
+
+	// Carriers see every load on their trips, shippers only their own
+	assert.ElementsMatch(t, []uint{suite.ownLoad.ID, suite.otherLoad.ID}, suite.loadIDs(suite.dispatcher.ID))
+	assert.ElementsMatch(t, []uint{suite.ownLoad.ID, suite.otherLoad.ID}, suite.loadIDs(suite.driver.ID))
+	assert.ElementsMatch(t, []uint{suite.ownLoad.ID}, suite.loadIDs(suite.shipper.ID))
+	assert.ElementsMatch(t, []uint{suite.rivalLoad.ID}, suite.loadIDs(suite.rival.ID))
+	assert.Len(t, suite.loadIDs(suite.admin.ID), 3)
+}
+
+func (suite *TenantScopeTestSuite) TestOtherTenantsRecordsAreNotFound() {
+	t := suite.T()
+	fleetTrip := fmt.Sprintf("/trips/%d", suite.fleetTrip.ID)
+	rivalLoad := fmt.Sprintf("/loads/%d", suite.rivalLoad.ID)
+
+	var trip models.Trip
+	assert.Equal(t, 200, suite.get(fleetTrip, suite.dispatcher.ID, &trip))
+	assert.Equal(t, suite.fleetTrip.ID, trip.ID)
+	assert.Equal(t, 404, suite.get(fleetTrip, suite.rival.ID, nil))
+	assert.Equal(t, 404, suite.get(rivalLoad, suite.dispatcher.ID, nil))
+	assert.Equal(t, 404, suite.get(fmt.Sprintf("/loads/%d", suite.otherLoad.ID), suite.shipper.ID, nil))
+	assert.Equal(t, 404, suite.get(rivalLoad+"/customs-documents", suite.shipper.ID, nil))
+	assert.Equal(t, 200, suite.get(rivalLoad+"/customs-documents", suite.rival.ID, nil))
+	assert.Equal(t, 200, suite.get(rivalLoad, suite.admin.ID, nil))
+
+	// The customs summary only counts the loads the user sees
+	var summary map[string]interface{}
+	assert.Equal(t, 200, suite.get(fleetTrip+"/customs-summary", suite.shipper.ID, &summary))
+	assert.Equal(t, float64(1), summary["total_loads"])
+	assert.Equal(t, 200, suite.get(fleetTrip+"/customs-summary", suite.rival.ID, &summary))
+	assert.Equal(t, float64(0), summary["total_loads"])
+
+	// Reads need a user to scope them to
+	assert.Equal(t, 401, suite.get(fleetTrip, 0, nil))
+}
+
+func (suite *TenantScopeTestSuite) TestOtherTenantsTrackingIsNotFound() {
+	t := suite.T()
+	testDB.Create(&models.TrackingRecord{TripID: suite.fleetTrip.ID, Latitude: -17.8, Longitude: 31.0, Timestamp: time.Now()})
+	fleetTrip := fmt.Sprintf("/tracking/trips/%d", suite.fleetTrip.ID)
+	rivalLoad := fmt.Sprintf("/loads/%d", suite.rivalLoad.ID)
+
+	assert.Equal(t, 200, suite.get(fleetTrip+"/current", suite.dispatcher.ID, nil))
+	assert.Equal(t, 200, suite.get(fleetTrip+"/current", suite.shipper.ID, nil))
+	for _, path := range []string{"/current", "/history", "/events", "/status"} {
+		assert.Equal(t, 404, suite.get(fleetTrip+path, suite.rival.ID, nil), path)
+	}
+
+	assert.Equal(t, 200, suite.get("/tracking"+rivalLoad, suite.rival.ID, nil))
+	assert.Equal(t, 404, suite.get("/tracking"+rivalLoad, suite.dispatcher.ID, nil))
+	assert.Equal(t, 404, suite.get("/tracking"+rivalLoad+"/history", suite.dispatcher.ID, nil))
+	assert.Equal(t, 404, suite.get(rivalLoad+"/quotes", suite.shipper.ID, nil))
+	assert.Equal(t, 200, suite.get(rivalLoad+"/customs-compliance", suite.rival.ID, nil))
+	assert.Equal(t, 404, suite.get(rivalLoad+"/customs-compliance", suite.shipper.ID, nil))
+
+	// Views of another user only show what the requesting user sees
+	var view map[string]interface{}
+	carrierView := fmt.Sprintf("/tracking/users/%d/carrier-view", suite.dispatcher.ID)
+	assert.Equal(t, 200, suite.get(carrierView, suite.dispatcher.ID, &view))
+	assert.Equal(t, float64(1), view["total_trips"])
+	assert.Equal(t, 200, suite.get(carrierView, suite.rival.ID, &view))
+	assert.Equal(t, float64(0), view["total_trips"])
+}
+
+func (suite *TenantScopeTestSuite) TestOtherTenantsAssignmentsAreNotFound() {
+	t := suite.T()
+	assignments := fmt.Sprintf("/trips/%d/assignments", suite.fleetTrip.ID)
+
+	assert.Equal(t, 200, suite.get(assignments, suite.dispatcher.ID, nil))
+	assert.Equal(t, 200, suite.get(assignments, suite.driver.ID, nil))
+	assert.Equal(t, 404, suite.get(assignments, suite.rival.ID, nil))
+	assert.Equal(t, 404, suite.get(fmt.Sprintf("/trips/%d/fuel-plan", suite.fleetTrip.ID), suite.rival.ID, nil))
+}
+
+func (suite *TenantScopeTestSuite) TestEndedAssignmentsAreNotVisible() {
+	ended := time.Now().Add(-time.Minute)
+	testDB.Model(&models.TripAssignment{}).Where("driver_id = ?", suite.driver.ID).Update("ends_at", ended)
+
+	assert.Empty(suite.T(), suite.tripIDs(suite.driver.ID))
+}
+
+func TestTenantScopeTestSuite(t *testing.T) {
+	suite.Run(t, new(TenantScopeTestSuite))
+}
@@ -3,9 +3,11 @@ package handlers
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/gofiber/fiber/v2"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"triplink/backend/database"
@@ -24,42 +26,104 @@ func TestMain(m *testing.M) {
 
 	// Migrate the schema
 	fmt.Println("Migrating database schema...")
-	err = testDB.AutoMigrate(&models.User{}, &models.Trip{}, &models.Load{}, &models.Vehicle{}, &models.Quote{}, &models.Review{}, &models.Transaction{}, &models.Notification{}, &models.CustomsDocument{}, &models.Manifest{}, &models.Message{}, &models.TrackingRecord{}, &models.TrackingEvent{}, &models.TrackingStatus{}, &models.NotificationToken{}, &models.NotificationPreferences{}, &models.NotificationDelivery{})
+	err = testDB.AutoMigrate(&models.User{}, &models.Organization{}, &models.OrganizationMembership{}, &models.Trip{}, &models.TripAssignment{}, &models.DriverAvailability{}, &models.TripTemplate{}, &models.SavedLocation{}, &models.SavedFilter{}, &models.Dashboard{}, &models.DashboardWidget{}, &models.GeocodedAddress{}, &models.Load{}, &models.Vehicle{}, &models.VehicleComplianceReminder{}, &models.VehicleServiceInterval{}, &models.Quote{}, &models.Review{}, &models.Transaction{}, &models.Invoice{}, &models.InvoiceLineItem{}, &models.Notification{}, &models.CustomsDocument{}, &models.LoadProof{}, &models.Manifest{}, &models.Message{}, &models.Conversation{}, &models.ConversationParticipant{}, &models.TrackingRecord{}, &models.ArchivedTrackingRecord{}, &models.TrackingAggregate{}, &models.TrackingEvent{}, &models.TrackingStatus{}, &models.TripStop{}, &models.TripStatusSuggestion{}, &models.StopCheckIn{}, &models.ETAPrediction{}, &models.NotificationToken{}, &models.NotificationPreferences{}, &models.NotificationDelivery{}, &models.NotificationDeadLetter{}, &models.PhoneVerification{}, &models.ReportSubscription{}, &models.OpsChannel{}, &models.RetentionPolicy{}, &models.RetentionRun{}, &models.RetentionRunResult{}, &models.AuditLog{}, &models.Document{}, &models.ApiKey{}, &models.TelematicsConnection{}, &models.TelematicsDevice{}, &models.TrackerDevice{}, &models.OutboxEvent{}, &models.FeatureFlag{}, &models.TripEmission{}, &models.TripFuelPlan{}, &models.TripFuelStop{}, &models.DelayModel{}, &models.DelayPrediction{}, &models.Feedback{})
 	if err != nil {
 		fmt.Printf("Error migrating database: %v\n", err)
 		panic("failed to migrate database")
 	}
 	fmt.Println("Database schema migrated successfully.")
 
+	// Handlers read through the global connection
+	database.DB = testDB
+
 	code := m.Run()
 	os.Exit(code)
 }
 
-func clearTestDB(db *gorm.DB) {
+// asHeaderUser acts as the user given in the X-User-ID header, as
+// auth.Middleware does for the user of a token
+func asHeaderUser() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if userID, err := strconv.Atoi(c.Get("X-User-ID")); err == nil {
+			c.Locals("user_id", float64(userID))
+		}
+		return c.Next()
+	}
+}
+
+func clearTestDB() {
+	db := testDB
 	fmt.Println("Clearing test database...")
 	if db != nil {
+		// Restart IDs at 1 for tests that look records up by ID
+		db.Exec("DELETE FROM sqlite_sequence")
 		db.Exec("DELETE FROM users")
+		db.Exec("DELETE FROM organizations")
+		db.Exec("DELETE FROM organization_memberships")
 		db.Exec("DELETE FROM trips")
+		db.Exec("DELETE FROM trip_assignments")
+		db.Exec("DELETE FROM driver_availabilities")
+		db.Exec("DELETE FROM trip_templates")
+		db.Exec("DELETE FROM saved_locations")
+		db.Exec("DELETE FROM saved_filters")
+		db.Exec("DELETE FROM dashboards")
+		db.Exec("DELETE FROM dashboard_widgets")
+		db.Exec("DELETE FROM geocoded_addresses")
 		db.Exec("DELETE FROM loads")
 		db.Exec("DELETE FROM vehicles")
+		db.Exec("DELETE FROM vehicle_compliance_reminders")
+		db.Exec("DELETE FROM vehicle_service_intervals")
 		db.Exec("DELETE FROM quotes")
 		db.Exec("DELETE FROM reviews")
 		db.Exec("DELETE FROM transactions")
+		db.Exec("DELETE FROM invoices")
+		db.Exec("DELETE FROM invoice_line_items")
 		db.Exec("DELETE FROM notifications")
 		db.Exec("DELETE FROM customs_documents")
+		db.Exec("DELETE FROM load_proofs")
 		db.Exec("DELETE FROM manifests")
 		db.Exec("DELETE FROM messages")
+		db.Exec("DELETE FROM conversations")
+		db.Exec("DELETE FROM conversation_participants")
 		db.Exec("DELETE FROM tracking_records")
+		db.Exec("DELETE FROM tracking_records_archive")
+		db.Exec("DELETE FROM tracking_aggregates")
 		db.Exec("DELETE FROM tracking_events")
 		db.Exec("DELETE FROM tracking_statuses")
+		db.Exec("DELETE FROM trip_stops")
+		db.Exec("DELETE FROM stop_check_ins")
+		db.Exec("DELETE FROM trip_status_suggestions")
+		db.Exec("DELETE FROM eta_predictions")
 		db.Exec("DELETE FROM notification_tokens")
 		db.Exec("DELETE FROM notification_preferences")
 		db.Exec("DELETE FROM notification_deliveries")
+		db.Exec("DELETE FROM notification_dead_letters")
+		db.Exec("DELETE FROM phone_verifications")
+		db.Exec("DELETE FROM report_subscriptions")
+		db.Exec("DELETE FROM ops_channels")
+		db.Exec("DELETE FROM retention_policies")
+		db.Exec("DELETE FROM retention_runs")
+		db.Exec("DELETE FROM retention_run_results")
+		db.Exec("DELETE FROM audit_logs")
+		db.Exec("DELETE FROM documents")
+		db.Exec("DELETE FROM api_keys")
+		db.Exec("DELETE FROM telematics_connections")
+		db.Exec("DELETE FROM telematics_devices")
+		db.Exec("DELETE FROM tracker_devices")
+		db.Exec("DELETE FROM outbox_events")
+		db.Exec("DELETE FROM feature_flags")
+		db.Exec("DELETE FROM trip_emissions")
+		db.Exec("DELETE FROM trip_fuel_stops")
+		db.Exec("DELETE FROM trip_fuel_plans")
+		db.Exec("DELETE FROM delay_predictions")
+		db.Exec("DELETE FROM delay_models")
+		db.Exec("DELETE FROM feedbacks")
 	}
 	fmt.Println("Test database cleared.")
 }
 
-func seedTestDB(db *gorm.DB) {
+func seedTestDB() {
+	db := testDB
 	fmt.Println("Seeding test database...")
 	// Create a test user
 	user := models.User{
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"strconv"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var trackerService = services.NewTrackerService(database.DB)
+
+// trackerError responds to a tracker service error
+func trackerError(c *fiber.Ctx, err error) error {
+	status := 400
+	switch err {
+	case services.ErrTrackerNotFound:
+		status = 404
+	case services.ErrTrackerRegistered:
+		status = 409
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
+
+// trackerRequest reads the current user and the tracker ID of a request
+func trackerRequest(c *fiber.Ctx) (uint, uint, int, string) {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return 0, 0, 401, "Unauthorized"
+	}
+	trackerID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, 0, 400, "Invalid tracker ID"
+	}
+	return uint(userID), uint(trackerID), 0, ""
+}
+
+// CreateTracker @Summary Register a GPS tracker
+// @Description Register a hardware GPS tracker by the device ID it publishes positions under, usually its IMEI. Positions bridged from MQTT are recorded in the trip the tracker is pinned to, or else in the active trip of the vehicle it is installed in.
+// @Tags trackers
+// @Accept json
+// @Produce json
+// @Param tracker body services.TrackerRequest true "Tracker"
+// @Success 201 {object} models.TrackerDevice
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /trackers [post]
+func CreateTracker(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req services.TrackerRequest
+	if err := decodeBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	tracker, err := trackerService.CreateTracker(uint(userID), req)
+	if err != nil {
+		return trackerError(c, err)
+	}
+
+	return c.Status(201).JSON(tracker)
+}
+
+// GetTrackers @Summary List GPS trackers
+// @Description List the current user's GPS trackers with when each last reported a position
+// @Tags trackers
+// @Produce json
+// @Success 200 {array} models.TrackerDevice
+// @Router /trackers [get]
+func GetTrackers(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	trackers, err := trackerService.GetTrackers(uint(userID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch trackers",
+		})
+	}
+
+	return c.JSON(trackers)
+}
+
+// UpdateTracker @Summary Update a GPS tracker
+// @Description Rename a tracker, install it in another vehicle, pin it to a trip or deactivate it. A vehicle_id or trip_id of 0 clears it.
+// @Tags trackers
+// @Accept json
+// @Produce json
+// @Param id path int true "Tracker ID"
+// @Param tracker body services.TrackerRequest true "Fields to change"
+// @Success 200 {object} models.TrackerDevice
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /trackers/{id} [put]
+func UpdateTracker(c *fiber.Ctx) error {
+	userID, trackerID, status, message := trackerRequest(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	var req services.TrackerRequest
+	if err := decodeBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	tracker, err := trackerService.UpdateTracker(userID, trackerID, req)
+	if err != nil {
+		return trackerError(c, err)
+	}
+
+	return c.JSON(tracker)
+}
+
+// DeleteTracker @Summary Remove a GPS tracker
+// @Description Stop recording the positions a tracker publishes
+// @Tags trackers
+// @Param id path int true "Tracker ID"
+// @Success 204
+// @Router /trackers/{id} [delete]
+func DeleteTracker(c *fiber.Ctx) error {
+	userID, trackerID, status, message := trackerRequest(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	if err := trackerService.DeleteTracker(userID, trackerID); err != nil {
+		return trackerError(c, err)
+	}
+
+	return c.SendStatus(204)
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TrackerHandlerTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	carrier models.User
+	vehicle models.Vehicle
+	trip    models.Trip
+	bridge  *services.MQTTBridge
+}
+
+func (suite *TrackerHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+	// Positions are the tests' own, not the seeded one
+	testDB.Exec("DELETE FROM tracking_records")
+
+	suite.carrier = models.User{}
+	testDB.Where("email = ?", "test@example.com").First(&suite.carrier)
+	suite.vehicle = models.Vehicle{UserID: suite.carrier.ID, Make: "Isuzu", LicensePlate: "TRK-001", VIN: "JALE5W161A7900001"}
+	testDB.Create(&suite.vehicle)
+	suite.trip = models.Trip{}
+	testDB.Where("user_id = ?", suite.carrier.ID).First(&suite.trip)
+	testDB.Model(&suite.trip).Updates(map[string]interface{}{
+		"vehicle_id": suite.vehicle.ID, "status": "IN_TRANSIT", "tracking_enabled": true,
+		"destination_lat": 40.7128, "destination_lng": -74.0060,
+	})
+
+	trackerService = services.NewTrackerService(testDB)
+	suite.bridge = services.NewMQTTBridge(testDB, &config.MQTTConfig{Topic: "fleet/+/location"})
+
+	suite.app = fiber.New()
+	trackers := suite.app.Group("/trackers", asHeaderUser())
+	trackers.Post("/", CreateTracker)
+	trackers.Get("/", GetTrackers)
+	trackers.Put("/:id", UpdateTracker)
+	trackers.Delete("/:id", DeleteTracker)
+}
+
+func (suite *TrackerHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *TrackerHandlerTestSuite) request(method, url string, userID uint, body interface{}) (int, []byte) {
+	jsonData, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var respBody bytes.Buffer
+	respBody.ReadFrom(resp.Body)
+	return resp.StatusCode, respBody.Bytes()
+}
+
+func (suite *TrackerHandlerTestSuite) register(req services.TrackerRequest) models.TrackerDevice {
+	status, body := suite.request("POST", "/trackers", suite.carrier.ID, req)
+	suite.Require().Equal(201, status, string(body))
+
+	var tracker models.TrackerDevice
+	suite.Require().NoError(json.Unmarshal(body, &tracker))
+	return tracker
+}
+
+func (suite *TrackerHandlerTestSuite) records() []models.TrackingRecord {
+	var records []models.TrackingRecord
+	testDB.Where("trip_id = ?", suite.trip.ID).Order("id").Find(&records)
+	return records
+}
+
+func (suite *TrackerHandlerTestSuite) TestManageTrackers() {
+	t := suite.T()
+
+	tracker := suite.register(services.TrackerRequest{DeviceID: " 356938035643809 ", VehicleID: &suite.vehicle.ID})
+	assert.Equal(t, "356938035643809", tracker.DeviceID)
+	assert.Equal(t, "356938035643809", tracker.Name)
+	assert.Equal(t, suite.vehicle.ID, *tracker.VehicleID)
+	assert.True(t, tracker.IsActive)
+
+	status, _ := suite.request("POST", "/trackers", suite.carrier.ID, services.TrackerRequest{DeviceID: "356938035643809"})
+	assert.Equal(t, 409, status)
+	status, _ = suite.request("POST", "/trackers", suite.carrier.ID, services.TrackerRequest{Name: "No ID"})
+	assert.Equal(t, 400, status)
+
+	// Trackers are only installed in the carrier's own vehicles and trips
+	other := models.User{Email: "other@example.com", Phone: "+1987654321", Password: "password", Role: "CARRIER"}
+	testDB.Create(&other)
+	otherVehicle := models.Vehicle{UserID: other.ID, Make: "MAN", LicensePlate: "OTH-001", VIN: "WMAH05ZZ1AM000002"}
+	testDB.Create(&otherVehicle)
+	status, body := suite.request("POST", "/trackers", suite.carrier.ID, services.TrackerRequest{DeviceID: "111", VehicleID: &otherVehicle.ID})
+	assert.Equal(t, 400, status)
+	assert.Contains(t, string(body), "vehicle not found")
+
+	url := "/trackers/" + strconv.Itoa(int(tracker.ID))
+	noVehicle := uint(0)
+	inactive := false
+	status, body = suite.request("PUT", url, suite.carrier.ID, services.TrackerRequest{Name: "Reefer 1", VehicleID: &noVehicle, TripID: &suite.trip.ID, IsActive: &inactive})
+	assert.Equal(t, 200, status, string(body))
+	var updated models.TrackerDevice
+	assert.NoError(t, json.Unmarshal(body, &updated))
+	assert.Equal(t, "Reefer 1", updated.Name)
+	assert.Nil(t, updated.VehicleID)
+	assert.Equal(t, suite.trip.ID, *updated.TripID)
+	assert.False(t, updated.IsActive)
+
+	status, body = suite.request("GET", "/trackers", other.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.JSONEq(t, "[]", string(body))
+	status, _ = suite.request("PUT", url, other.ID, services.TrackerRequest{Name: "Mine"})
+	assert.Equal(t, 404, status)
+	status, _ = suite.request("DELETE", url, other.ID, nil)
+	assert.Equal(t, 404, status)
+
+	status, _ = suite.request("DELETE", url, suite.carrier.ID, nil)
+	assert.Equal(t, 204, status)
+	status, body = suite.request("GET", "/trackers", suite.carrier.ID, nil)
+	assert.Equal(t, 200, status)
+	assert.JSONEq(t, "[]", string(body))
+}
+
+func (suite *TrackerHandlerTestSuite) TestBridgeRecordsTrackerPositions() {
+	t := suite.T()
+	tracker := suite.register(services.TrackerRequest{DeviceID: "356938035643809", VehicleID: &suite.vehicle.ID})
+
+	recorded := time.Now().Add(-time.Minute).Truncate(time.Second)
+	payload := `{"_type":"location","lat":40.1,"lon":-75.1,"tst":` + strconv.FormatInt(recorded.Unix(), 10) + `,"vel":62,"cog":180,"acc":8,"batt":76}`
+	assert.NoError(t, suite.bridge.HandleMessage("fleet/356938035643809/location", []byte(payload)))
+	assert.NoError(t, suite.bridge.HandleMessage("fleet/356938035643809/location", []byte(`{"latitude":40.2,"longitude":-75.0,"speed":55,"timestamp":"`+recorded.Add(30*time.Second).Format(time.RFC3339)+`"}`)))
+
+	records := suite.records()
+	suite.Require().Len(records, 2)
+	assert.Equal(t, 40.1, records[0].Latitude)
+	assert.True(t, records[0].Timestamp.Equal(recorded))
+	assert.InDelta(t, 62, *records[0].Speed, 0.1)
+	assert.InDelta(t, 180, *records[0].Heading, 0.1)
+	assert.Equal(t, "GPS", records[0].Source)
+	assert.Equal(t, 40.2, records[1].Latitude)
+
+	testDB.First(&tracker, tracker.ID)
+	assert.NotNil(t, tracker.LastSeenAt)
+
+	// Positions go through the same validation as the app's
+	err := suite.bridge.HandleMessage("fleet/356938035643809/location", []byte(`{"lat":95,"lon":-75}`))
+	assert.Error(t, err)
+	assert.Error(t, suite.bridge.HandleMessage("fleet/356938035643809/location", []byte(`{"speed":10}`)))
+	assert.Error(t, suite.bridge.HandleMessage("fleet/356938035643809/location", []byte(`not json`)))
+	assert.Len(t, suite.records(), 2)
+}
+
+func (suite *TrackerHandlerTestSuite) TestBridgeDecodesTrackerProtocols() {
+	t := suite.T()
+	suite.register(services.TrackerRequest{DeviceID: "356307042441013", VehicleID: &suite.vehicle.ID})
+	topic := "fleet/356307042441013/location"
+
+	// RMC and GGA sentences of the same fix make one position
+	nmea := "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47\r\n" +
+		"$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A\r\n"
+	assert.NoError(t, suite.bridge.HandleMessage(topic, []byte(nmea)))
+	records := suite.records()
+	suite.Require().Len(records, 1)
+	assert.InDelta(t, 48.1173, records[0].Latitude, 1e-6)
+	assert.InDelta(t, 41.5, *records[0].Speed, 1e-6) // 22.4 knots
+	assert.InDelta(t, 545.4, *records[0].Altitude, 1e-6)
+	assert.True(t, records[0].Timestamp.Equal(time.Date(1994, 3, 23, 12, 35, 19, 0, time.UTC)))
+
+	assert.Error(t, suite.bridge.HandleMessage(topic, []byte("$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6B")))
+
+	// A Teltonika codec 8 packet with one record: 2019-06-10 10:04:46 UTC at
+	// 54.6773000, 25.2589824, 11 satellites, 80 km/h, battery at 87%
+	teltonika, _ := hex.DecodeString("000000000000002508010000016B40D8EA30010F0E37002097180800C800B40B0050000202EF01715700000001000041A6")
+	assert.NoError(t, suite.bridge.HandleMessage(topic, teltonika))
+	records = suite.records()
+	suite.Require().Len(records, 2)
+	assert.InDelta(t, 54.6773, records[1].Latitude, 1e-6)
+	assert.InDelta(t, 25.2589824, records[1].Longitude, 1e-6)
+	assert.InDelta(t, 80, *records[1].Speed, 1e-6)
+	assert.InDelta(t, 87, *records[1].BatteryLevel, 1e-6)
+	assert.True(t, records[1].Timestamp.Equal(time.UnixMilli(1560161086000)))
+}
+
+func (suite *TrackerHandlerTestSuite) TestBridgeRejectsUnknownTrackers() {
+	t := suite.T()
+	payload := []byte(`{"lat":40.1,"lon":-75.1}`)
+
+	assert.Equal(t, services.ErrTrackerNotFound, suite.bridge.HandleMessage("fleet/unknown/location", payload))
+	assert.Error(t, suite.bridge.HandleMessage("other/356938035643809/location", payload))
+
+	// Inactive trackers and trackers without an active trip are dropped
+	inactive := false
+	tracker := suite.register(services.TrackerRequest{DeviceID: "356938035643809", VehicleID: &suite.vehicle.ID})
+	suite.request("PUT", "/trackers/"+strconv.Itoa(int(tracker.ID)), suite.carrier.ID, services.TrackerRequest{IsActive: &inactive})
+	assert.Equal(t, services.ErrTrackerNotFound, suite.bridge.HandleMessage("fleet/356938035643809/location", payload))
+
+	suite.register(services.TrackerRequest{DeviceID: "loose"})
+	assert.Equal(t, services.ErrTrackerNoTrip, suite.bridge.HandleMessage("fleet/loose/location", payload))
+	assert.Empty(t, suite.records())
+}
+
+func (suite *TrackerHandlerTestSuite) TestBridgePrefersPinnedTrip() {
+	t := suite.T()
+
+	// A trailer tracker pinned to a trip of another vehicle
+	otherVehicle := models.Vehicle{UserID: suite.carrier.ID, Make: "Volvo", LicensePlate: "TRK-002", VIN: "YV2XG40A0AB000003"}
+	testDB.Create(&otherVehicle)
+	pinned := models.Trip{UserID: suite.carrier.ID, VehicleID: otherVehicle.ID, OriginAddress: "A", DestinationAddress: "B", Status: "ACTIVE", TrackingEnabled: true, DepartureDate: time.Now(), EstimatedArrival: time.Now().Add(time.Hour)}
+	testDB.Create(&pinned)
+	suite.register(services.TrackerRequest{DeviceID: "trailer-7", VehicleID: &suite.vehicle.ID, TripID: &pinned.ID})
+
+	assert.NoError(t, suite.bridge.HandleMessage("fleet/trailer-7/location", []byte(`{"lat":40.1,"lon":-75.1}`)))
+	var count int64
+	testDB.Model(&models.TrackingRecord{}).Where("trip_id = ?", pinned.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+	assert.Empty(t, suite.records())
+
+	// Once the pinned trip is over, the vehicle's active trip is used
+	testDB.Model(&pinned).Update("status", "COMPLETED")
+	assert.NoError(t, suite.bridge.HandleMessage("fleet/trailer-7/location", []byte(`{"lat":40.2,"lon":-75.1}`)))
+	assert.Len(t, suite.records(), 1)
+}
+
+func TestTrackerHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(TrackerHandlerTestSuite))
+}
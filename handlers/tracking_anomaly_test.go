@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TrackingAnomalyTestSuite struct {
+	suite.Suite
+	carrier    models.User
+	dispatcher models.User
+	driver     models.User
+	trip       models.Trip
+}
+
+func (suite *TrackingAnomalyTestSuite) SetupTest() {
+	clearTestDB()
+	trackingService = services.NewTrackingService(testDB)
+
+	users := []*models.User{&suite.carrier, &suite.dispatcher, &suite.driver}
+	for i, user := range users {
+		*user = models.User{Email: fmt.Sprintf("anomaly%d@example.com", i), Phone: fmt.Sprintf("+1555000050%d", i), Password: "password", Role: "CARRIER"}
+		testDB.Create(user)
+	}
+	organization := models.Organization{Name: "Anomaly Haulage", Type: "CARRIER", OwnerID: suite.carrier.ID}
+	testDB.Create(&organization)
+	testDB.Create(&models.OrganizationMembership{OrganizationID: organization.ID, UserID: suite.carrier.ID, Role: services.OrganizationOwner})
+	testDB.Create(&models.OrganizationMembership{OrganizationID: organization.ID, UserID: suite.dispatcher.ID, Role: services.OrganizationDispatcher})
+	testDB.Create(&models.OrganizationMembership{OrganizationID: organization.ID, UserID: suite.driver.ID, Role: services.OrganizationDriver})
+
+	suite.trip = models.Trip{UserID: suite.carrier.ID, OrganizationID: &organization.ID, Status: "IN_TRANSIT", TrackingEnabled: true}
+	testDB.Create(&suite.trip)
+}
+
+func (suite *TrackingAnomalyTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *TrackingAnomalyTestSuite) position(age time.Duration, longitude, speed float64) {
+	suite.Require().NoError(testDB.Create(&models.TrackingRecord{
+		TripID:    suite.trip.ID,
+		Longitude: longitude,
+		Speed:     &speed,
+		Timestamp: time.Now().Add(-age),
+		Source:    "GPS",
+	}).Error)
+}
+
+func (suite *TrackingAnomalyTestSuite) anomalyNotifications() []models.Notification {
+	var notifications []models.Notification
+	testDB.Where("type = ?", "TRACKING_ANOMALY").Order("user_id").Find(&notifications)
+	return notifications
+}
+
+func (suite *TrackingAnomalyTestSuite) TestAnomaliesRecordedOnceAndHighSeverityNotified() {
+	t := suite.T()
+
+	// Speeding to 180 km/h, then jumping about 155 km east in 5 minutes, and
+	// silent since, longer than the update gap
+	suite.position(6*time.Hour, 0, 60)
+	suite.position(5*time.Hour+50*time.Minute, 0.05, 65)
+	suite.position(5*time.Hour+45*time.Minute, 0.1, 180)
+	suite.position(5*time.Hour+40*time.Minute, 1.5, 70)
+	testDB.Model(&suite.dispatcher).Update("unit_system", "imperial")
+
+	recorded, err := trackingService.ProcessAnomalies(suite.trip.ID)
+	suite.Require().NoError(err)
+	severities := map[string]string{}
+	for _, anomaly := range recorded {
+		severities[anomaly.Type] = anomaly.Severity
+	}
+	assert.Len(t, recorded, 5)
+	assert.Equal(t, map[string]string{
+		services.AnomalySpeedChange:   services.AnomalySeverityLow,
+		services.AnomalyHighSpeed:     services.AnomalySeverityMedium,
+		services.AnomalyTeleportation: services.AnomalySeverityHigh,
+		services.AnomalyLongSilence:   services.AnomalySeverityHigh,
+	}, severities)
+
+	var events []models.TrackingEvent
+	testDB.Where("trip_id = ? AND event_type = ?", suite.trip.ID, "ANOMALY").Order("id").Find(&events)
+	suite.Require().Len(events, 5)
+	var data map[string]interface{}
+	suite.Require().NoError(json.Unmarshal([]byte(events[0].EventData), &data))
+	assert.NotEmpty(t, data["type"])
+	assert.NotEmpty(t, data["severity"])
+	assert.NotEmpty(t, data["fingerprint"])
+
+	// The two HIGH anomalies go to the carrier and the dispatcher, not the
+	// driver
+	notifications := suite.anomalyNotifications()
+	suite.Require().Len(notifications, 4)
+	assert.Equal(t, suite.carrier.ID, notifications[0].UserID)
+	assert.Equal(t, suite.dispatcher.ID, notifications[3].UserID)
+	assert.Equal(t, suite.trip.ID, notifications[0].RelatedID)
+	// Each in the units they use
+	speeds := map[uint]string{}
+	for _, notification := range notifications {
+		if strings.HasSuffix(notification.Message, " between locations") {
+			speeds[notification.UserID] = notification.Message
+		}
+	}
+	assert.Contains(t, speeds[suite.carrier.ID], " km/h ")
+	assert.Contains(t, speeds[suite.dispatcher.ID], " mph ")
+
+	// Found again on the next run, but not recorded again
+	recorded, err = trackingService.ProcessAnomalies(suite.trip.ID)
+	suite.Require().NoError(err)
+	assert.Empty(t, recorded)
+	assert.Len(t, suite.anomalyNotifications(), 4)
+
+	// Ad-hoc detection still describes them
+	descriptions, err := trackingService.DetectAnomalies(suite.trip.ID)
+	suite.Require().NoError(err)
+	assert.Contains(t, descriptions, "High speed detected: 180.0 km/h")
+}
+
+func (suite *TrackingAnomalyTestSuite) TestImpossibleReportedSpeed() {
+	t := suite.T()
+	suite.position(2*time.Minute, 0, 80)
+	suite.position(time.Minute, 0.001, 320)
+
+	recorded, err := trackingService.ProcessAnomalies(suite.trip.ID)
+	suite.Require().NoError(err)
+	var types []string
+	for _, anomaly := range recorded {
+		types = append(types, anomaly.Type)
+	}
+	assert.ElementsMatch(t, []string{services.AnomalySpeedChange, services.AnomalyImpossibleSpeed}, types)
+	assert.Len(t, suite.anomalyNotifications(), 2)
+}
+
+func (suite *TrackingAnomalyTestSuite) TestSchedulerRunsAnomalyDetection() {
+	scheduler := services.NewTrackingScheduler(testDB, config.GetSchedulerConfig())
+	var jobs []string
+	for _, job := range scheduler.GetJobStatus() {
+		jobs = append(jobs, job["name"].(string))
+	}
+	assert.Contains(suite.T(), jobs, "anomaly_detection")
+}
+
+func TestTrackingAnomalyTestSuite(t *testing.T) {
+	suite.Run(t, new(TrackingAnomalyTestSuite))
+}
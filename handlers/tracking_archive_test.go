@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TrackingArchiveTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	carrier models.User
+	closed  models.Trip
+	active  models.Trip
+	archive *services.TrackingArchiveService
+}
+
+func (suite *TrackingArchiveTestSuite) SetupTest() {
+	clearTestDB()
+	trackingService = services.NewTrackingService(testDB)
+	tripAssignmentService = services.NewTripAssignmentService(testDB)
+
+	suite.carrier = models.User{Email: "archive-carrier@example.com", Phone: "+15550001001", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.carrier)
+
+	arrival := time.Now().AddDate(0, -2, 0)
+	suite.closed = models.Trip{UserID: suite.carrier.ID, Status: "COMPLETED", ActualArrival: &arrival, TrackingEnabled: true}
+	suite.active = models.Trip{UserID: suite.carrier.ID, Status: "IN_TRANSIT", TrackingEnabled: true}
+	testDB.Create(&suite.closed)
+	testDB.Create(&suite.active)
+
+	for i, trip := range []models.Trip{suite.closed, suite.closed, suite.closed, suite.active} {
+		testDB.Create(&models.TrackingRecord{
+			TripID:    trip.ID,
+			Latitude:  -17.8 + float64(i)/100,
+			Longitude: 31.0,
+			Timestamp: arrival.Add(time.Duration(i-3) * time.Hour),
+			Source:    "GPS",
+			Status:    "ACTIVE",
+		})
+	}
+
+	suite.archive = services.NewTrackingArchiveService(testDB, &config.TrackingArchiveConfig{
+		ArchiveAfter: 30 * 24 * time.Hour,
+		BatchSize:    10,
+	})
+
+	suite.app = fiber.New()
+	suite.app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", float64(suite.carrier.ID))
+		return c.Next()
+	})
+	suite.app.Get("/trips/:trip_id/tracking/history", GetTripTrackingHistory)
+	suite.app.Post("/trips/:trip_id/tracking/location", UpdateTripLocation)
+}
+
+func (suite *TrackingArchiveTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *TrackingArchiveTestSuite) count(model interface{}, tripID uint) int64 {
+	var count int64
+	testDB.Model(model).Where("trip_id = ?", tripID).Count(&count)
+	return count
+}
+
+func (suite *TrackingArchiveTestSuite) TestArchivesClosedTrips() {
+	t := suite.T()
+	archived, err := suite.archive.ArchiveClosedTrips()
+	suite.Require().NoError(err)
+	assert.Equal(t, 1, archived)
+
+	assert.Zero(t, suite.count(&models.TrackingRecord{}, suite.closed.ID))
+	assert.Equal(t, int64(3), suite.count(&models.ArchivedTrackingRecord{}, suite.closed.ID))
+	assert.Equal(t, int64(1), suite.count(&models.TrackingRecord{}, suite.active.ID))
+
+	var trip models.Trip
+	testDB.First(&trip, suite.closed.ID)
+	assert.NotNil(t, trip.TrackingArchivedAt)
+
+	// Archived trips are not archived again
+	archived, err = suite.archive.ArchiveClosedTrips()
+	suite.Require().NoError(err)
+	assert.Zero(t, archived)
+}
+
+func (suite *TrackingArchiveTestSuite) TestRecentlyClosedTripsAreKept() {
+	arrival := time.Now().Add(-time.Hour)
+	testDB.Model(&suite.closed).Update("actual_arrival", arrival)
+
+	archived, err := suite.archive.ArchiveClosedTrips()
+	suite.Require().NoError(err)
+	assert.Zero(suite.T(), archived)
+	assert.Equal(suite.T(), int64(3), suite.count(&models.TrackingRecord{}, suite.closed.ID))
+}
+
+func (suite *TrackingArchiveTestSuite) TestHistoryReadsArchive() {
+	t := suite.T()
+	suite.Require().NoError(suite.archive.ArchiveTrip(suite.closed.ID))
+
+	req := httptest.NewRequest("GET", "/trips/"+strconv.Itoa(int(suite.closed.ID))+"/tracking/history?limit=2", nil)
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var body struct {
+		Data  []models.TrackingRecord `json:"data"`
+		Total int64                   `json:"total"`
+	}
+	data, _ := io.ReadAll(resp.Body)
+	suite.Require().NoError(json.Unmarshal(data, &body))
+	assert.Equal(t, int64(3), body.Total)
+	suite.Require().Len(body.Data, 2)
+	assert.True(t, body.Data[0].Timestamp.After(body.Data[1].Timestamp))
+
+	location, err := trackingService.GetCurrentLocation(suite.closed.ID)
+	suite.Require().NoError(err)
+	assert.Equal(t, body.Data[0].ID, location.ID)
+}
+
+func (suite *TrackingArchiveTestSuite) TestArchivedTripsRejectLocationUpdates() {
+	suite.Require().NoError(suite.archive.ArchiveTrip(suite.closed.ID))
+
+	body, _ := json.Marshal(map[string]float64{"latitude": -17.9, "longitude": 31.1})
+	req := httptest.NewRequest("POST", "/trips/"+strconv.Itoa(int(suite.closed.ID))+"/tracking/location", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 409, resp.StatusCode)
+	assert.Zero(suite.T(), suite.count(&models.TrackingRecord{}, suite.closed.ID))
+}
+
+func (suite *TrackingArchiveTestSuite) TestRetentionCoversArchive() {
+	t := suite.T()
+	suite.Require().NoError(suite.archive.ArchiveTrip(suite.closed.ID))
+
+	retention := services.NewRetentionService(testDB, &config.RetentionConfig{
+		TrackingRecordDays: 30,
+		TrackingEventDays:  30,
+		CriticalEventDays:  30,
+		NotificationDays:   30,
+		BatchSize:          100,
+	}, &config.StorageConfig{Provider: "local"})
+	run, err := retention.RunCleanup("MANUAL", nil)
+	suite.Require().NoError(err)
+	assert.Equal(t, services.RetentionCompleted, run.Status)
+
+	assert.Zero(t, suite.count(&models.ArchivedTrackingRecord{}, suite.closed.ID))
+	assert.Zero(t, suite.count(&models.TrackingRecord{}, suite.active.ID))
+	assert.Equal(t, int64(4), run.RecordsDeleted)
+}
+
+func TestTrackingArchiveTestSuite(t *testing.T) {
+	suite.Run(t, new(TrackingArchiveTestSuite))
+}
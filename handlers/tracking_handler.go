@@ -1,28 +1,110 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
 	"strconv"
+	"strings"
 	"time"
+	"triplink/backend/apierror"
+	"triplink/backend/config"
 	"triplink/backend/database"
+	"triplink/backend/internal/geo"
+	"triplink/backend/metrics"
 	"triplink/backend/models"
 	"triplink/backend/services"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 var trackingService = services.NewTrackingService(database.DB)
+var realtimeConfig = config.GetRealtimeConfig()
+var deviceTrackingConfig = config.GetDeviceTrackingConfig()
+
+// LocationUpdateRequest is a position reported by a device. The coordinates
+// are pointers so that 0, on the equator or the prime meridian, isn't taken
+// for a missing coordinate.
+type LocationUpdateRequest struct {
+	Latitude     *float64   `json:"latitude" validate:"required,latitude"`
+	Longitude    *float64   `json:"longitude" validate:"required,longitude"`
+	Altitude     *float64   `json:"altitude,omitempty"`
+	Speed        *float64   `json:"speed,omitempty" validate:"omitempty,gte=0"`
+	Heading      *float64   `json:"heading,omitempty" validate:"omitempty,gte=0,lt=360"`
+	Accuracy     *float64   `json:"accuracy,omitempty" validate:"omitempty,gte=0"`
+	Source       string     `json:"source" validate:"omitempty,oneof=GPS MANUAL ESTIMATED NETWORK PASSIVE"`
+	BatteryLevel *float64   `json:"battery_level,omitempty" validate:"omitempty,gte=0,lte=100"`
+	SpeedLimit   *float64   `json:"speed_limit,omitempty" validate:"omitempty,gt=0"`
+	Timestamp    *time.Time `json:"timestamp,omitempty"`
+}
+
+// locationUpdate converts the request to the tracking service's update,
+// defaulting the source to GPS
+func (r LocationUpdateRequest) locationUpdate() services.LocationUpdate {
+	source := r.Source
+	if source == "" {
+		source = "GPS"
+	}
+	return services.LocationUpdate{
+		Latitude:     *r.Latitude,
+		Longitude:    *r.Longitude,
+		Altitude:     r.Altitude,
+		Speed:        r.Speed,
+		Heading:      r.Heading,
+		Accuracy:     r.Accuracy,
+		Source:       source,
+		BatteryLevel: r.BatteryLevel,
+		SpeedLimit:   r.SpeedLimit,
+		Timestamp:    r.Timestamp,
+	}
+}
+
+// TripStatusRequest changes the status of a trip. With the version of the
+// trip the client last read, the change is rejected if the trip has changed
+// since.
+type TripStatusRequest struct {
+	Status  string `json:"status" validate:"required,oneof=PLANNED ACTIVE IN_TRANSIT AT_PICKUP AT_DELIVERY DELAYED COMPLETED CANCELLED"`
+	Version *uint  `json:"version,omitempty"`
+}
+
+// LoadStatusRequest changes the status of a load, at a version like
+// TripStatusRequest
+type LoadStatusRequest struct {
+	Status  string `json:"status" validate:"required,oneof=BOOKED PICKUP_SCHEDULED PICKED_UP IN_TRANSIT OUT_FOR_DELIVERY DELIVERED EXCEPTION"`
+	Version *uint  `json:"version,omitempty"`
+}
+
+// TripLoadStatusRequest changes the status of loads of a trip together: the
+// loads listed, or every load of the trip still under way
+type TripLoadStatusRequest struct {
+	Status  string `json:"status" validate:"required,oneof=PICKUP_SCHEDULED PICKED_UP IN_TRANSIT OUT_FOR_DELIVERY DELIVERED EXCEPTION"`
+	LoadIDs []uint `json:"load_ids,omitempty"`
+}
+
+// TripStopStatusRequest changes the status of a trip stop. The transitions
+// allowed depend on the stop, so the tracking service checks the value.
+type TripStopStatusRequest struct {
+	Status string `json:"status" validate:"required"`
+}
+
+// TrackingConsentRequest gives or withdraws consent to tracking a trip
+type TrackingConsentRequest struct {
+	Granted *bool `json:"granted" validate:"required"`
+}
 
 // UpdateTripLocation @Summary Update trip location
-// @Description Update the current location of a trip
+// @Description Update the current location of a trip. Positions with a timestamp older than the trip's last location are added to its history without moving the trip, and a position already recorded at the same time is answered with duplicate set instead of being recorded again. Positions reported less accurately than the location filter allows are dropped and answered with filtered set; the rest are recorded raw and smoothed, and the trip's current location, progress and ETA follow the smoothed track.
 // @Tags tracking
 // @Accept json
 // @Produce json
 // @Param trip_id path int true "Trip ID"
-// @Param location body services.LocationUpdate true "Location data"
+// @Param location body LocationUpdateRequest true "Location data"
 // @Success 200 {object} map[string]interface{}
-// @Router /trips/{trip_id}/tracking/location [post]
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /tracking/trips/{trip_id}/location [post]
 func UpdateTripLocation(c *fiber.Ctx) error {
 	tripIDStr := c.Params("trip_id")
 	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
@@ -32,24 +114,11 @@ func UpdateTripLocation(c *fiber.Ctx) error {
 		})
 	}
 
-	var locationUpdate services.LocationUpdate
-	if err := c.BodyParser(&locationUpdate); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Cannot parse location data",
-		})
-	}
-
-	// Validate required fields
-	if locationUpdate.Latitude == 0 || locationUpdate.Longitude == 0 {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Latitude and longitude are required",
-		})
-	}
-
-	// Set default source if not provided
-	if locationUpdate.Source == "" {
-		locationUpdate.Source = "GPS"
+	var req LocationUpdateRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
 	}
+	locationUpdate := req.locationUpdate()
 
 	// Verify trip exists and user has permission
 	var trip models.Trip
@@ -58,21 +127,61 @@ func UpdateTripLocation(c *fiber.Ctx) error {
 			"error": "Trip not found",
 		})
 	}
+	driverID, status := assignedDriverID(c, &trip)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": "Only the trip's carrier and assigned drivers can update its location",
+		})
+	}
+	locationUpdate.DriverID = driverID
 
 	// Update location using tracking service
-	if err := trackingService.UpdateLocation(uint(tripID), locationUpdate); err != nil {
+	err = trackingService.WithContext(c.UserContext()).UpdateLocation(uint(tripID), locationUpdate)
+	if errors.Is(err, services.ErrDuplicateLocationUpdate) {
+		// Retries of an update that was recorded succeed without recording it again
+		return c.JSON(fiber.Map{
+			"message":   "Location already recorded",
+			"trip_id":   tripID,
+			"latitude":  locationUpdate.Latitude,
+			"longitude": locationUpdate.Longitude,
+			"duplicate": true,
+		})
+	}
+	if errors.Is(err, services.ErrInaccurateLocation) {
+		// Devices can't send a better fix of the past, so dropped positions
+		// aren't errors to retry
+		return c.JSON(fiber.Map{
+			"message":   "Location dropped as too inaccurate",
+			"trip_id":   tripID,
+			"latitude":  locationUpdate.Latitude,
+			"longitude": locationUpdate.Longitude,
+			"filtered":  true,
+		})
+	}
+	if err != nil {
+		var trackingErr *services.TrackingError
+		if errors.As(err, &trackingErr) {
+			return apierror.Respond(c, trackingErr)
+		}
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to update location: " + err.Error(),
 		})
 	}
 
-	return c.JSON(fiber.Map{
+	response := fiber.Map{
 		"message":   "Location updated successfully",
 		"trip_id":   tripID,
 		"latitude":  locationUpdate.Latitude,
 		"longitude": locationUpdate.Longitude,
 		"timestamp": trip.LastLocationUpdate,
-	})
+	}
+
+	// Devices adjust their tracking to the settings returned with each update
+	if settings, err := trackingService.PushTrackingSettings(uint(tripID), locationUpdate.BatteryLevel); err == nil {
+		response["tracking_settings"] = settings
+	}
+
+	return c.JSON(response)
 }
 
 // GetCurrentTripLocation @Summary Get current trip location
@@ -81,7 +190,7 @@ func UpdateTripLocation(c *fiber.Ctx) error {
 // @Produce json
 // @Param trip_id path int true "Trip ID"
 // @Success 200 {object} models.TrackingRecord
-// @Router /trips/{trip_id}/tracking/current [get]
+// @Router /tracking/trips/{trip_id}/current [get]
 func GetCurrentTripLocation(c *fiber.Ctx) error {
 	tripIDStr := c.Params("trip_id")
 	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
@@ -91,9 +200,9 @@ func GetCurrentTripLocation(c *fiber.Ctx) error {
 		})
 	}
 
-	// Verify trip exists
+	// Verify the trip exists and the user can see it
 	var trip models.Trip
-	if err := database.DB.First(&trip, uint(tripID)).Error; err != nil {
+	if err := database.DB.WithContext(c.UserContext()).First(&trip, uint(tripID)).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Trip not found",
 		})
@@ -110,15 +219,133 @@ func GetCurrentTripLocation(c *fiber.Ctx) error {
 	return c.JSON(location)
 }
 
+// StreamTripLocation @Summary Stream trip location updates
+// @Description Stream the location updates of a trip as server-sent events. The current location is sent first, followed by a "location" event per update, a "tracking_event" event per status change and periodic heartbeat comments.
+// @Tags tracking
+// @Produce text/event-stream
+// @Param trip_id path int true "Trip ID"
+// @Success 200 {object} services.TripLocationUpdate
+// @Router /tracking/trips/{trip_id}/stream [get]
+func StreamTripLocation(c *fiber.Ctx) error {
+	tripIDStr := c.Params("trip_id")
+	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid trip ID",
+		})
+	}
+
+	// Verify trip exists
+	var trip models.Trip
+	if err := database.DB.First(&trip, uint(tripID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip not found",
+		})
+	}
+
+	// Subscribe before reading the current location so no update is missed
+	updates, unsubscribe := services.GetLocationHub().Subscribe(uint(tripID))
+	current, _ := trackingService.GetCurrentLocation(uint(tripID))
+	heartbeat := realtimeConfig.StreamHeartbeat
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		if current != nil {
+			writeLocationEvent(w, services.TripLocationUpdate{
+				TripID:    current.TripID,
+				RecordID:  current.ID,
+				Latitude:  current.Latitude,
+				Longitude: current.Longitude,
+				Altitude:  current.Altitude,
+				Speed:     current.Speed,
+				Heading:   current.Heading,
+				Accuracy:  current.Accuracy,
+				Source:    current.Source,
+				Timestamp: current.Timestamp,
+			})
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case update, ok := <-updates:
+				if !ok {
+					return
+				}
+				writeLocationEvent(w, update)
+			case <-ticker.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			}
+
+			// Flushing fails once the client has disconnected
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// writeLocationEvent writes a location update as a server-sent event, or a
+// tracking event as a "tracking_event" event
+func writeLocationEvent(w *bufio.Writer, update services.TripLocationUpdate) {
+	if update.Event != nil {
+		data, err := json.Marshal(update.Event)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "event: tracking_event\ndata: %s\n\n", data)
+		return
+	}
+
+	data, err := json.Marshal(update)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: location\ndata: %s\n\n", update.RecordID, data)
+}
+
+// trackingGeoJSON reports whether GeoJSON was requested with the format query
+// parameter of a tracking endpoint
+func trackingGeoJSON(c *fiber.Ctx) (bool, error) {
+	switch strings.ToLower(c.Query("format")) {
+	case "", "json":
+		return false, nil
+	case "geojson":
+		return true, nil
+	default:
+		return false, errors.New("Invalid format, use json or geojson")
+	}
+}
+
 // GetTripTrackingHistory @Summary Get trip tracking history
-// @Description Get the location history for a trip
+// @Description Get the location history for a trip, newest first. With format=geojson the page is a FeatureCollection holding the path driven as a LineString, oldest position first, with the pagination fields as foreign members. With resolution=5m or 1h the page holds aggregates of the records in each interval instead, with their last position, speeds and distance driven; aggregates are refreshed by a background job, so the latest interval may lag behind.
 // @Tags tracking
 // @Produce json
+// @Produce application/geo+json
 // @Param trip_id path int true "Trip ID"
 // @Param limit query int false "Number of records to return (default 50)"
-// @Param offset query int false "Number of records to skip (default 0)"
-// @Success 200 {array} models.TrackingRecord
-// @Router /trips/{trip_id}/tracking/history [get]
+// @Param offset query int false "Number of records to skip (default 0, ignored with cursor)"
+// @Param cursor query string false "Cursor from next_cursor of the previous page"
+// @Param format query string false "Response format, json or geojson (default json)"
+// @Param resolution query string false "raw, 5m or 1h (default raw)"
+// @Success 200 {object} map[string]interface{}
+// @Router /tracking/trips/{trip_id}/history [get]
 func GetTripTrackingHistory(c *fiber.Ctx) error {
 	tripIDStr := c.Params("trip_id")
 	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
@@ -129,23 +356,43 @@ func GetTripTrackingHistory(c *fiber.Ctx) error {
 	}
 
 	// Parse query parameters
-	limit := c.QueryInt("limit", 50)
-	offset := c.QueryInt("offset", 0)
+	page, err := parsePageParams(c, 50)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
+	}
+	geoJSON, err := trackingGeoJSON(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	resolution := strings.ToLower(c.Query("resolution", services.TrackingResolutionRaw))
+	if !services.IsTrackingResolution(resolution) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid resolution, use raw, 5m or 1h",
+		})
+	}
 
-	// Verify trip exists
+	// Verify the trip exists and the user can see it
 	var trip models.Trip
-	if err := database.DB.First(&trip, uint(tripID)).Error; err != nil {
+	if err := database.DB.WithContext(c.UserContext()).First(&trip, uint(tripID)).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Trip not found",
 		})
 	}
 
+	if resolution != services.TrackingResolutionRaw {
+		return tripTrackingAggregates(c, uint(tripID), resolution, page, geoJSON)
+	}
+
+	var total int64
+	services.TripTrackingRecords(database.DB, uint(tripID)).Count(&total)
+
 	// Get tracking history
 	var trackingRecords []models.TrackingRecord
-	result := database.DB.Where("trip_id = ?", tripID).
-		Order("timestamp DESC").
-		Limit(limit).
-		Offset(offset).
+	result := page.paginate(services.TripTrackingRecords(database.DB, uint(tripID)), "timestamp").
 		Find(&trackingRecords)
 
 	if result.Error != nil {
@@ -154,23 +401,111 @@ func GetTripTrackingHistory(c *fiber.Ctx) error {
 		})
 	}
 
+	nextCursor := ""
+	if page.hasMore(len(trackingRecords)) {
+		trackingRecords = trackingRecords[:page.Limit]
+		last := trackingRecords[len(trackingRecords)-1]
+		nextCursor = encodePageCursor(last.Timestamp, last.ID)
+	}
+
+	if geoJSON {
+		// The path is drawn in the order it was driven
+		path := make([]models.TrackingRecord, len(trackingRecords))
+		for i, record := range trackingRecords {
+			path[len(path)-1-i] = record
+		}
+		collection := services.TrackingHistoryGeoJSON(uint(tripID), path)
+		return c.JSON(fiber.Map{
+			"type":        collection.Type,
+			"features":    collection.Features,
+			"count":       len(trackingRecords),
+			"total":       total,
+			"limit":       page.Limit,
+			"offset":      page.Offset,
+			"next_cursor": nextCursor,
+			"has_more":    nextCursor != "",
+		}, services.GeoJSONContentType)
+	}
+
 	return c.JSON(fiber.Map{
-		"data":   trackingRecords,
-		"count":  len(trackingRecords),
-		"limit":  limit,
-		"offset": offset,
+		"data":        trackingRecords,
+		"count":       len(trackingRecords),
+		"total":       total,
+		"limit":       page.Limit,
+		"offset":      page.Offset,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	})
+}
+
+// tripTrackingAggregates serves a page of a trip's history at the
+// resolution of its aggregates
+func tripTrackingAggregates(c *fiber.Ctx, tripID uint, resolution string, page pageParams, geoJSON bool) error {
+	query := database.DB.Model(&models.TrackingAggregate{}).Where("trip_id = ? AND resolution = ?", tripID, resolution)
+
+	var total int64
+	query.Session(&gorm.Session{}).Count(&total)
+
+	var aggregates []models.TrackingAggregate
+	if err := page.paginate(query, "bucket_start").Find(&aggregates).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch tracking history",
+		})
+	}
+
+	nextCursor := ""
+	if page.hasMore(len(aggregates)) {
+		aggregates = aggregates[:page.Limit]
+		last := aggregates[len(aggregates)-1]
+		nextCursor = encodePageCursor(last.BucketStart, last.ID)
+	}
+
+	if geoJSON {
+		path := make([]models.TrackingRecord, len(aggregates))
+		for i, aggregate := range aggregates {
+			path[len(path)-1-i] = models.TrackingRecord{
+				TripID:    tripID,
+				Latitude:  aggregate.Latitude,
+				Longitude: aggregate.Longitude,
+				Timestamp: aggregate.LastTimestamp,
+			}
+		}
+		collection := services.TrackingHistoryGeoJSON(tripID, path)
+		return c.JSON(fiber.Map{
+			"type":        collection.Type,
+			"features":    collection.Features,
+			"resolution":  resolution,
+			"count":       len(aggregates),
+			"total":       total,
+			"limit":       page.Limit,
+			"offset":      page.Offset,
+			"next_cursor": nextCursor,
+			"has_more":    nextCursor != "",
+		}, services.GeoJSONContentType)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        aggregates,
+		"resolution":  resolution,
+		"count":       len(aggregates),
+		"total":       total,
+		"limit":       page.Limit,
+		"offset":      page.Offset,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
 	})
 }
 
 // UpdateTripStatus @Summary Update trip status
-// @Description Update the status of a trip
+// @Description Update the status of a trip. Changes the trip's lifecycle doesn't allow are rejected with INVALID_STATUS_TRANSITION, and changes at a version the trip has moved on from with STATUS_CONFLICT, both with the reason, the current status and version, and the statuses allowed from it.
 // @Tags tracking
 // @Accept json
 // @Produce json
 // @Param trip_id path int true "Trip ID"
-// @Param status body map[string]string true "Status data"
+// @Param status body TripStatusRequest true "Status data"
 // @Success 200 {object} map[string]interface{}
-// @Router /trips/{trip_id}/tracking/status [put]
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /tracking/trips/{trip_id}/status [put]
 func UpdateTripStatus(c *fiber.Ctx) error {
 	tripIDStr := c.Params("trip_id")
 	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
@@ -180,35 +515,11 @@ func UpdateTripStatus(c *fiber.Ctx) error {
 		})
 	}
 
-	var statusUpdate map[string]string
-	if err := c.BodyParser(&statusUpdate); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Cannot parse status data",
-		})
-	}
-
-	newStatus, exists := statusUpdate["status"]
-	if !exists || newStatus == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Status is required",
-		})
-	}
-
-	// Validate status value
-	validStatuses := []string{"PLANNED", "ACTIVE", "IN_TRANSIT", "AT_PICKUP", "AT_DELIVERY", "DELAYED", "COMPLETED", "CANCELLED"}
-	isValid := false
-	for _, status := range validStatuses {
-		if status == newStatus {
-			isValid = true
-			break
-		}
-	}
-
-	if !isValid {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid status value",
-		})
+	var req TripStatusRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
 	}
+	newStatus := req.Status
 
 	// Get current trip status
 	var trip models.Trip
@@ -220,7 +531,12 @@ func UpdateTripStatus(c *fiber.Ctx) error {
 	oldStatus := trip.Status
 
 	// Update status using tracking service
-	if err := trackingService.UpdateTripStatus(uint(tripID), newStatus); err != nil {
+	updated, err := trackingService.WithContext(c.UserContext()).ChangeTripStatus(uint(tripID), newStatus, req.Version)
+	if err != nil {
+		var rejection *services.StatusTransitionError
+		if errors.As(err, &rejection) {
+			return apierror.Respond(c, rejection)
+		}
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Failed to update status: " + err.Error(),
 		})
@@ -234,16 +550,142 @@ func UpdateTripStatus(c *fiber.Ctx) error {
 		"message": "Status updated successfully",
 		"trip_id": tripID,
 		"status":  newStatus,
+		"version": updated.Version,
 	})
 }
 
+// PauseTripTracking @Summary Pause trip tracking
+// @Description Stop accepting location updates for a trip, e.g. while the driver is off duty. Only the trip's carrier can pause tracking.
+// @Tags tracking
+// @Accept json
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param request body map[string]string false "Optional reason"
+// @Success 200 {object} models.Trip
+// @Router /tracking/trips/{trip_id}/pause [post]
+func PauseTripTracking(c *fiber.Ctx) error {
+	trip, userID, status, message := carrierTrip(c)
+	if trip == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+	}
+
+	trip, err := trackingService.PauseTracking(trip.ID, userID, req.Reason)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to pause tracking: " + err.Error(),
+		})
+	}
+
+	return c.JSON(trip)
+}
+
+// ResumeTripTracking @Summary Resume trip tracking
+// @Description Accept location updates for a paused trip again. Tracking can't resume while the carrier's tracking consent is withdrawn.
+// @Tags tracking
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Success 200 {object} models.Trip
+// @Router /tracking/trips/{trip_id}/resume [post]
+func ResumeTripTracking(c *fiber.Ctx) error {
+	trip, userID, status, message := carrierTrip(c)
+	if trip == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	trip, err := trackingService.ResumeTracking(trip.ID, userID)
+	if err != nil {
+		var trackingErr *services.TrackingError
+		if errors.As(err, &trackingErr) {
+			return apierror.Respond(c, trackingErr)
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to resume tracking: " + err.Error(),
+		})
+	}
+
+	return c.JSON(trip)
+}
+
+// RecordTripTrackingConsent @Summary Record tracking consent
+// @Description Record the carrier giving or withdrawing consent to location tracking of a trip. Withdrawing consent pauses tracking.
+// @Tags tracking
+// @Accept json
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param request body TrackingConsentRequest true "granted: true to give consent, false to withdraw it"
+// @Success 200 {object} models.Trip
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /tracking/trips/{trip_id}/consent [post]
+func RecordTripTrackingConsent(c *fiber.Ctx) error {
+	trip, userID, status, message := carrierTrip(c)
+	if trip == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	var req TrackingConsentRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	trip, err := trackingService.RecordTrackingConsent(trip.ID, userID, *req.Granted)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to record consent: " + err.Error(),
+		})
+	}
+
+	return c.JSON(trip)
+}
+
+// carrierTrip loads the trip in the trip_id parameter when the current user is
+// its carrier or an owner or dispatcher of its organization. Otherwise the trip is nil and the status and message describe
+// the error to respond with. Trips outside the request's tenant scope aren't
+// found.
+func carrierTrip(c *fiber.Ctx) (*models.Trip, uint, int, string) {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return nil, 0, 401, "Unauthorized"
+	}
+
+	tripID, err := strconv.ParseUint(c.Params("trip_id"), 10, 32)
+	if err != nil {
+		return nil, 0, 400, "Invalid trip ID"
+	}
+
+	var trip models.Trip
+	if err := database.DB.WithContext(c.UserContext()).First(&trip, uint(tripID)).Error; err != nil {
+		return nil, 0, 404, "Trip not found"
+	}
+	if trip.UserID != uint(userID) && !dispatchesTrip(&trip, uint(userID)) {
+		return nil, 0, 403, "Only the trip's carrier can change its tracking"
+	}
+	return &trip, uint(userID), 0, ""
+}
+
 // GetTripETA @Summary Get trip ETA
-// @Description Get the estimated time of arrival for a trip
+// @Description Get the estimated time of arrival for a trip, allowing for the weather forecast on its remaining route
 // @Tags tracking
 // @Produce json
 // @Param trip_id path int true "Trip ID"
 // @Success 200 {object} map[string]interface{}
-// @Router /trips/{trip_id}/tracking/eta [get]
+// @Router /tracking/trips/{trip_id}/eta [get]
 func GetTripETA(c *fiber.Ctx) error {
 	tripIDStr := c.Params("trip_id")
 	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
@@ -253,16 +695,16 @@ func GetTripETA(c *fiber.Ctx) error {
 		})
 	}
 
-	// Verify trip exists
+	// Verify the trip exists and the user can see it
 	var trip models.Trip
-	if err := database.DB.First(&trip, uint(tripID)).Error; err != nil {
+	if err := database.DB.WithContext(c.UserContext()).First(&trip, uint(tripID)).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Trip not found",
 		})
 	}
 
 	// Calculate ETA
-	eta, err := trackingService.CalculateETA(uint(tripID))
+	estimate, err := trackingService.WithContext(c.UserContext()).CalculateETAEstimate(uint(tripID))
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to calculate ETA: " + err.Error(),
@@ -274,8 +716,19 @@ func GetTripETA(c *fiber.Ctx) error {
 
 	response := fiber.Map{
 		"trip_id":           tripID,
-		"estimated_arrival": eta,
+		"estimated_arrival": estimate.EstimatedArrival,
 		"original_eta":      trip.EstimatedArrival,
+		"eta_source":        estimate.Source,
+		"eta_confidence":    estimate.Confidence,
+	}
+
+	if estimate.DistanceKm > 0 {
+		response["remaining_distance_km"] = estimate.DistanceKm
+		response["traffic_delay_minutes"] = estimate.TrafficDelayMinutes
+	}
+	if estimate.WeatherCondition != "" {
+		response["weather_condition"] = estimate.WeatherCondition
+		response["weather_delay_minutes"] = estimate.WeatherDelayMinutes
 	}
 
 	if delayInfo != nil {
@@ -286,12 +739,12 @@ func GetTripETA(c *fiber.Ctx) error {
 }
 
 // GetTripTrackingStatus @Summary Get trip tracking status
-// @Description Get the current tracking status and progress of a trip
+// @Description Get the current tracking status and progress of a trip. completion_percent is the share of the route covered at the last location, measured along the planned route, and follows the status before the first location.
 // @Tags tracking
 // @Produce json
 // @Param trip_id path int true "Trip ID"
 // @Success 200 {object} models.TrackingStatus
-// @Router /trips/{trip_id}/tracking/status [get]
+// @Router /tracking/trips/{trip_id}/status [get]
 func GetTripTrackingStatus(c *fiber.Ctx) error {
 	tripIDStr := c.Params("trip_id")
 	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
@@ -301,26 +754,286 @@ func GetTripTrackingStatus(c *fiber.Ctx) error {
 		})
 	}
 
+	// Verify the trip exists and the user can see it
+	if err := database.DB.WithContext(c.UserContext()).Select("id").First(&models.Trip{}, uint(tripID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip not found",
+		})
+	}
+
 	// Get tracking status
 	var trackingStatus models.TrackingStatus
-	if err := database.DB.Where("trip_id = ?", tripID).First(&trackingStatus).Error; err != nil {
+	if err := database.DB.Where("trip_id = ? AND load_id IS NULL", tripID).First(&trackingStatus).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Tracking status not found",
 		})
 	}
 
-	return c.JSON(trackingStatus)
+	return c.JSON(trackingStatus)
+}
+
+// GetTripTrackingEvents @Summary Get trip tracking events
+// @Description Get all tracking events for a trip
+// @Tags tracking
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param limit query int false "Number of events to return (default 20)"
+// @Param cursor query string false "Cursor from next_cursor of the previous page"
+// @Success 200 {object} map[string]interface{}
+// @Router /tracking/trips/{trip_id}/events [get]
+func GetTripTrackingEvents(c *fiber.Ctx) error {
+	tripIDStr := c.Params("trip_id")
+	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid trip ID",
+		})
+	}
+
+	page, err := parsePageParams(c, 20)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
+	}
+
+	// Verify the trip exists and the user can see it
+	if err := database.DB.WithContext(c.UserContext()).Select("id").First(&models.Trip{}, uint(tripID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip not found",
+		})
+	}
+
+	var total int64
+	database.DB.Model(&models.TrackingEvent{}).Where("trip_id = ?", tripID).Count(&total)
+
+	// Get tracking events
+	var events []models.TrackingEvent
+	result := page.paginate(database.DB.Where("trip_id = ?", tripID), "timestamp").
+		Find(&events)
+
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch tracking events",
+		})
+	}
+
+	return c.JSON(trackingEventsPage(page, events, total))
+}
+
+// GetTripRoute @Summary Get trip route overview
+// @Description Get the planned route polyline and the simplified traveled path of a trip. The planned route is fetched when the trip is created or updated.
+// @Tags tracking
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param tolerance query number false "Simplification tolerance in meters (default 25)"
+// @Success 200 {object} services.RouteOverview
+// @Router /tracking/trips/{trip_id}/route [get]
+func GetTripRoute(c *fiber.Ctx) error {
+	tripIDStr := c.Params("trip_id")
+	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid trip ID",
+		})
+	}
+
+	tolerance, err := strconv.ParseFloat(c.Query("tolerance", "25"), 64)
+	if err != nil || tolerance < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid tolerance",
+		})
+	}
+
+	// Verify the trip exists and the user can see it
+	var trip models.Trip
+	if err := database.DB.WithContext(c.UserContext()).First(&trip, uint(tripID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip not found",
+		})
+	}
+
+	overview, err := trackingService.GetRouteOverview(uint(tripID), tolerance)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to build route overview: " + err.Error(),
+		})
+	}
+
+	return c.JSON(overview)
+}
+
+// GetTripReplay @Summary Get trip replay frames
+// @Description Get the tracking history of a trip resampled into evenly spaced, interpolated frames for animated playback
+// @Tags tracking
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param interval query number false "Seconds of trip time between frames (default 30)"
+// @Param speed query number false "Playback speed multiplier used for playback_ms (default 60)"
+// @Success 200 {object} services.TripReplay
+// @Router /tracking/trips/{trip_id}/replay [get]
+func GetTripReplay(c *fiber.Ctx) error {
+	tripIDStr := c.Params("trip_id")
+	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid trip ID",
+		})
+	}
+
+	interval, err := strconv.ParseFloat(c.Query("interval", "30"), 64)
+	if err != nil || interval < 1 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid interval, must be at least 1 second",
+		})
+	}
+
+	speed, err := strconv.ParseFloat(c.Query("speed", "60"), 64)
+	if err != nil || speed <= 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid playback speed",
+		})
+	}
+
+	// Verify the trip exists and the user can see it
+	var trip models.Trip
+	if err := database.DB.WithContext(c.UserContext()).First(&trip, uint(tripID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip not found",
+		})
+	}
+
+	replay, err := trackingService.GetTripReplay(uint(tripID), time.Duration(interval*float64(time.Second)), speed)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(replay)
+}
+
+// GetTripStops @Summary Get trip stops
+// @Description Get the itinerary of a trip: its origin, the pickups and deliveries of its loads and its destination in visiting order, with planned, estimated and actual times. The itinerary is generated on first access.
+// @Tags tracking
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Success 200 {array} models.TripStop
+// @Router /tracking/trips/{trip_id}/stops [get]
+func GetTripStops(c *fiber.Ctx) error {
+	tripIDStr := c.Params("trip_id")
+	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid trip ID",
+		})
+	}
+
+	// Verify the trip exists and the user can see it
+	var trip models.Trip
+	if err := database.DB.WithContext(c.UserContext()).First(&trip, uint(tripID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip not found",
+		})
+	}
+
+	stops, err := trackingService.GetTripStops(uint(tripID))
+	if err == nil && len(stops) == 0 {
+		stops, err = trackingService.GenerateTripStops(uint(tripID))
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get trip stops: " + err.Error(),
+		})
+	}
+
+	return c.JSON(stops)
+}
+
+// GenerateTripStops @Summary Regenerate trip stops
+// @Description Rebuild the pending stops of a trip from its current loads. Visited stops are kept.
+// @Tags tracking
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Success 200 {array} models.TripStop
+// @Router /tracking/trips/{trip_id}/stops/generate [post]
+func GenerateTripStops(c *fiber.Ctx) error {
+	tripIDStr := c.Params("trip_id")
+	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid trip ID",
+		})
+	}
+
+	stops, err := trackingService.GenerateTripStops(uint(tripID))
+	if err != nil {
+		status := 500
+		if err.Error() == "trip not found" {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(stops)
+}
+
+// UpdateTripStopStatus @Summary Update trip stop status
+// @Description Record the arrival at (ARRIVED), departure from (COMPLETED) or skipping of (SKIPPED) a trip stop
+// @Tags tracking
+// @Accept json
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param stop_id path int true "Stop ID"
+// @Param status body TripStopStatusRequest true "Status data"
+// @Success 200 {object} models.TripStop
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /tracking/trips/{trip_id}/stops/{stop_id}/status [put]
+func UpdateTripStopStatus(c *fiber.Ctx) error {
+	tripID, err := strconv.ParseUint(c.Params("trip_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid trip ID",
+		})
+	}
+	stopID, err := strconv.ParseUint(c.Params("stop_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid stop ID",
+		})
+	}
+
+	var statusData TripStopStatusRequest
+	if err := parseBody(c, &statusData); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	stop, err := trackingService.UpdateTripStopStatus(uint(tripID), uint(stopID), statusData.Status)
+	if err != nil {
+		status := 400
+		if err.Error() == "trip stop not found" {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(stop)
 }
 
-// GetTripTrackingEvents @Summary Get trip tracking events
-// @Description Get all tracking events for a trip
+// UpdateTripPlannedRoute @Summary Set trip planned route
+// @Description Store an encoded polyline as the planned route of a trip
 // @Tags tracking
+// @Accept json
 // @Produce json
 // @Param trip_id path int true "Trip ID"
-// @Param limit query int false "Number of events to return (default 20)"
-// @Success 200 {array} models.TrackingEvent
-// @Router /trips/{trip_id}/tracking/events [get]
-func GetTripTrackingEvents(c *fiber.Ctx) error {
+// @Param route body map[string]string true "Route data (polyline, source)"
+// @Success 200 {object} map[string]interface{}
+// @Router /tracking/trips/{trip_id}/route [put]
+func UpdateTripPlannedRoute(c *fiber.Ctx) error {
 	tripIDStr := c.Params("trip_id")
 	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
 	if err != nil {
@@ -329,33 +1042,40 @@ func GetTripTrackingEvents(c *fiber.Ctx) error {
 		})
 	}
 
-	limit := c.QueryInt("limit", 20)
+	var routeData map[string]string
+	if err := c.BodyParser(&routeData); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse route data",
+		})
+	}
 
-	// Get tracking events
-	var events []models.TrackingEvent
-	result := database.DB.Where("trip_id = ?", tripID).
-		Order("timestamp DESC").
-		Limit(limit).
-		Find(&events)
+	source := routeData["source"]
+	if source == "" {
+		source = "MANUAL"
+	}
 
-	if result.Error != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to fetch tracking events",
+	if err := trackingService.SetPlannedRoute(uint(tripID), routeData["polyline"], source); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Failed to update planned route: " + err.Error(),
 		})
 	}
 
-	return c.JSON(events)
+	return c.JSON(fiber.Map{
+		"message": "Planned route updated successfully",
+		"trip_id": tripID,
+		"source":  source,
+	})
 }
 
 // Load Tracking Endpoints
 
 // GetLoadTracking @Summary Get load tracking information
-// @Description Get comprehensive tracking information for a specific load
+// @Description Get comprehensive tracking information for a specific load. local_times has the trip's departure at the local time of its origin and its arrival at that of its destination. pickup_eta and delivery_eta are when the vehicle is expected at the load's pickup, until it gets there, and at its delivery, following the trip's stop sequence.
 // @Tags load-tracking
 // @Produce json
 // @Param load_id path int true "Load ID"
 // @Success 200 {object} map[string]interface{}
-// @Router /loads/{load_id}/tracking [get]
+// @Router /tracking/loads/{load_id} [get]
 func GetLoadTracking(c *fiber.Ctx) error {
 	loadIDStr := c.Params("load_id")
 	loadID, err := strconv.ParseUint(loadIDStr, 10, 32)
@@ -365,9 +1085,9 @@ func GetLoadTracking(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get load with trip information
+	// Get load with trip information, if the user can see it
 	var load models.Load
-	if err := database.DB.Preload("TrackingRecords").
+	if err := database.DB.WithContext(c.UserContext()).Preload("TrackingRecords").
 		Preload("TrackingStatus").
 		Preload("TrackingEvents").
 		First(&load, uint(loadID)).Error; err != nil {
@@ -378,7 +1098,7 @@ func GetLoadTracking(c *fiber.Ctx) error {
 
 	// Get trip information for this load
 	var trip models.Trip
-	if err := database.DB.First(&trip, load.TripID).Error; err != nil {
+	if err := database.DB.WithContext(c.UserContext()).First(&trip, load.TripID).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Associated trip not found",
 		})
@@ -405,6 +1125,7 @@ func GetLoadTracking(c *fiber.Ctx) error {
 		"trip_status":       trip.Status,
 		"current_location":  currentLocation,
 		"estimated_arrival": eta,
+		"local_times":       services.LocalTimes(&trip, eta),
 		"pickup_address":    load.PickupAddress,
 		"delivery_address":  load.DeliveryAddress,
 		"tracking_enabled":  trip.TrackingEnabled,
@@ -416,6 +1137,8 @@ func GetLoadTracking(c *fiber.Ctx) error {
 
 	if loadTrackingStatus.ID != 0 {
 		response["load_tracking_status"] = loadTrackingStatus
+		response["pickup_eta"] = loadTrackingStatus.PickupETA
+		response["delivery_eta"] = loadTrackingStatus.DeliveryETA
 	}
 
 	return c.JSON(response)
@@ -427,8 +1150,9 @@ func GetLoadTracking(c *fiber.Ctx) error {
 // @Produce json
 // @Param load_id path int true "Load ID"
 // @Param limit query int false "Number of events to return (default 20)"
-// @Success 200 {array} models.TrackingEvent
-// @Router /loads/{load_id}/tracking/events [get]
+// @Param cursor query string false "Cursor from next_cursor of the previous page"
+// @Success 200 {object} map[string]interface{}
+// @Router /tracking/loads/{load_id}/events [get]
 func GetLoadTrackingEvents(c *fiber.Ctx) error {
 	loadIDStr := c.Params("load_id")
 	loadID, err := strconv.ParseUint(loadIDStr, 10, 32)
@@ -438,22 +1162,32 @@ func GetLoadTrackingEvents(c *fiber.Ctx) error {
 		})
 	}
 
-	limit := c.QueryInt("limit", 20)
+	page, err := parsePageParams(c, 20)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
+	}
 
-	// Verify load exists
+	// Verify the load exists and the user can see it
 	var load models.Load
-	if err := database.DB.First(&load, uint(loadID)).Error; err != nil {
+	if err := database.DB.WithContext(c.UserContext()).First(&load, uint(loadID)).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Load not found",
 		})
 	}
 
 	// Get load-specific tracking events and trip-level events
+	eventsQuery := func() *gorm.DB {
+		return database.DB.Model(&models.TrackingEvent{}).
+			Where("load_id = ? OR (trip_id = ? AND load_id IS NULL)", loadID, load.TripID)
+	}
+
+	var total int64
+	eventsQuery().Count(&total)
+
 	var events []models.TrackingEvent
-	result := database.DB.Where("load_id = ? OR (trip_id = ? AND load_id IS NULL)", loadID, load.TripID).
-		Order("timestamp DESC").
-		Limit(limit).
-		Find(&events)
+	result := page.paginate(eventsQuery(), "timestamp").Find(&events)
 
 	if result.Error != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -461,18 +1195,38 @@ func GetLoadTrackingEvents(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(events)
+	return c.JSON(trackingEventsPage(page, events, total))
+}
+
+// trackingEventsPage builds the paginated response for a page of tracking events
+func trackingEventsPage(page pageParams, events []models.TrackingEvent, total int64) fiber.Map {
+	nextCursor := ""
+	if page.hasMore(len(events)) {
+		events = events[:page.Limit]
+		last := events[len(events)-1]
+		nextCursor = encodePageCursor(last.Timestamp, last.ID)
+	}
+
+	return fiber.Map{
+		"data":        events,
+		"count":       len(events),
+		"total":       total,
+		"limit":       page.Limit,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	}
 }
 
 // UpdateLoadStatus @Summary Update load status
-// @Description Update the status of a specific load and create tracking events
+// @Description Update the status of a specific load and create tracking events. Changes are checked like those of trip statuses.
 // @Tags load-tracking
 // @Accept json
 // @Produce json
 // @Param load_id path int true "Load ID"
-// @Param status body map[string]string true "Status data"
+// @Param status body LoadStatusRequest true "Status data"
 // @Success 200 {object} map[string]interface{}
-// @Router /loads/{load_id}/status [put]
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /tracking/loads/{load_id}/status [put]
 func UpdateLoadStatus(c *fiber.Ctx) error {
 	loadIDStr := c.Params("load_id")
 	loadID, err := strconv.ParseUint(loadIDStr, 10, 32)
@@ -482,35 +1236,11 @@ func UpdateLoadStatus(c *fiber.Ctx) error {
 		})
 	}
 
-	var statusUpdate map[string]string
-	if err := c.BodyParser(&statusUpdate); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Cannot parse status data",
-		})
-	}
-
-	newStatus, exists := statusUpdate["status"]
-	if !exists || newStatus == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Status is required",
-		})
-	}
-
-	// Validate load status
-	validLoadStatuses := []string{"BOOKED", "PICKUP_SCHEDULED", "PICKED_UP", "IN_TRANSIT", "OUT_FOR_DELIVERY", "DELIVERED", "EXCEPTION"}
-	isValid := false
-	for _, status := range validLoadStatuses {
-		if status == newStatus {
-			isValid = true
-			break
-		}
-	}
-
-	if !isValid {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid load status value",
-		})
+	var req LoadStatusRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
 	}
+	newStatus := req.Status
 
 	// Get load
 	var load models.Load
@@ -522,49 +1252,17 @@ func UpdateLoadStatus(c *fiber.Ctx) error {
 
 	previousStatus := load.Status
 
-	// Update load status
-	if err := database.DB.Model(&load).Update("status", newStatus).Error; err != nil {
+	updated, err := trackingService.WithContext(c.UserContext()).ChangeLoadStatus(load.ID, newStatus, req.Version)
+	if err != nil {
+		var rejection *services.StatusTransitionError
+		if errors.As(err, &rejection) {
+			return apierror.Respond(c, rejection)
+		}
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to update load status",
 		})
 	}
 
-	// Create tracking event for load status change
-	event := models.TrackingEvent{
-		TripID:      load.TripID,
-		LoadID:      &load.ID,
-		EventType:   "LOAD_STATUS_CHANGE",
-		EventData:   `{"from":"` + previousStatus + `","to":"` + newStatus + `"}`,
-		Location:    "",
-		Timestamp:   time.Now(),
-		Description: "Load status changed from " + previousStatus + " to " + newStatus,
-	}
-	database.DB.Create(&event)
-
-	// Update or create load tracking status
-	var loadTrackingStatus models.TrackingStatus
-	result := database.DB.Where("load_id = ?", loadID).First(&loadTrackingStatus)
-
-	if result.Error != nil {
-		// Create new load tracking status
-		loadTrackingStatus = models.TrackingStatus{
-			TripID:            load.TripID,
-			LoadID:            &load.ID,
-			CurrentStatus:     newStatus,
-			PreviousStatus:    previousStatus,
-			StatusChangedAt:   time.Now(),
-			CompletionPercent: calculateLoadCompletionPercent(newStatus),
-		}
-		database.DB.Create(&loadTrackingStatus)
-	} else {
-		// Update existing load tracking status
-		loadTrackingStatus.PreviousStatus = loadTrackingStatus.CurrentStatus
-		loadTrackingStatus.CurrentStatus = newStatus
-		loadTrackingStatus.StatusChangedAt = time.Now()
-		loadTrackingStatus.CompletionPercent = calculateLoadCompletionPercent(newStatus)
-		database.DB.Save(&loadTrackingStatus)
-	}
-
 	// Trigger notification for load status change
 	triggerService := services.NewNotificationTriggerService(database.DB)
 	triggerService.LoadStatusChangeHandler(uint(loadID), previousStatus, newStatus)
@@ -574,6 +1272,55 @@ func UpdateLoadStatus(c *fiber.Ctx) error {
 		"load_id":         loadID,
 		"status":          newStatus,
 		"previous_status": previousStatus,
+		"version":         updated.Version,
+	})
+}
+
+// UpdateTripLoadStatuses @Summary Update the status of a trip's loads
+// @Description Move the loads of a trip to a status at once, e.g. when the trip departs: the loads listed in load_ids, or every load of the trip still under way. Loads that can't take the status are left as they are and reported with the reason, while the others are changed together. Each shipper gets one notification for all their loads changed. Only the trip's carrier or its dispatchers can update its loads.
+// @Tags load-tracking
+// @Accept json
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param status body TripLoadStatusRequest true "Status and loads"
+// @Success 200 {object} map[string]interface{}
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /tracking/trips/{trip_id}/loads/status [post]
+func UpdateTripLoadStatuses(c *fiber.Ctx) error {
+	trip, _, status, message := carrierTrip(c)
+	if trip == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	var req TripLoadStatusRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	results, err := trackingService.WithContext(c.UserContext()).ChangeTripLoadStatuses(trip.ID, req.Status, req.LoadIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update load statuses",
+		})
+	}
+
+	updated := 0
+	for _, result := range results {
+		if result.Updated {
+			updated++
+		}
+	}
+	triggerService := services.NewNotificationTriggerService(database.DB)
+	triggerService.LoadStatusesChangeHandler(trip.ID, req.Status, results)
+
+	return c.JSON(fiber.Map{
+		"trip_id":  trip.ID,
+		"status":   req.Status,
+		"updated":  updated,
+		"rejected": len(results) - updated,
+		"results":  results,
 	})
 }
 
@@ -583,9 +1330,10 @@ func UpdateLoadStatus(c *fiber.Ctx) error {
 // @Produce json
 // @Param load_id path int true "Load ID"
 // @Param limit query int false "Number of records to return (default 50)"
-// @Param offset query int false "Number of records to skip (default 0)"
+// @Param offset query int false "Number of records to skip (default 0, ignored with cursor)"
+// @Param cursor query string false "Cursor from next_cursor of the previous page"
 // @Success 200 {object} map[string]interface{}
-// @Router /loads/{load_id}/tracking/history [get]
+// @Router /tracking/loads/{load_id}/history [get]
 func GetLoadTrackingHistory(c *fiber.Ctx) error {
 	loadIDStr := c.Params("load_id")
 	loadID, err := strconv.ParseUint(loadIDStr, 10, 32)
@@ -596,23 +1344,27 @@ func GetLoadTrackingHistory(c *fiber.Ctx) error {
 	}
 
 	// Parse query parameters
-	limit := c.QueryInt("limit", 50)
-	offset := c.QueryInt("offset", 0)
+	page, err := parsePageParams(c, 50)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
+	}
 
-	// Get load to find associated trip
+	// Get load to find associated trip, if the user can see it
 	var load models.Load
-	if err := database.DB.First(&load, uint(loadID)).Error; err != nil {
+	if err := database.DB.WithContext(c.UserContext()).First(&load, uint(loadID)).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Load not found",
 		})
 	}
 
+	var total int64
+	services.TripTrackingRecords(database.DB, load.TripID).Count(&total)
+
 	// Get tracking history for the trip (which includes this load)
 	var trackingRecords []models.TrackingRecord
-	result := database.DB.Where("trip_id = ?", load.TripID).
-		Order("timestamp DESC").
-		Limit(limit).
-		Offset(offset).
+	result := page.paginate(services.TripTrackingRecords(database.DB, load.TripID), "timestamp").
 		Find(&trackingRecords)
 
 	if result.Error != nil {
@@ -621,34 +1373,26 @@ func GetLoadTrackingHistory(c *fiber.Ctx) error {
 		})
 	}
 
+	nextCursor := ""
+	if page.hasMore(len(trackingRecords)) {
+		trackingRecords = trackingRecords[:page.Limit]
+		last := trackingRecords[len(trackingRecords)-1]
+		nextCursor = encodePageCursor(last.Timestamp, last.ID)
+	}
+
 	return c.JSON(fiber.Map{
 		"load_id":       loadID,
 		"trip_id":       load.TripID,
 		"tracking_data": trackingRecords,
 		"count":         len(trackingRecords),
-		"limit":         limit,
-		"offset":        offset,
+		"total":         total,
+		"limit":         page.Limit,
+		"offset":        page.Offset,
+		"next_cursor":   nextCursor,
+		"has_more":      nextCursor != "",
 	})
 }
 
-// Helper function for load completion percentage
-func calculateLoadCompletionPercent(status string) float64 {
-	statusPercent := map[string]float64{
-		"BOOKED":           10.0,
-		"PICKUP_SCHEDULED": 20.0,
-		"PICKED_UP":        40.0,
-		"IN_TRANSIT":       60.0,
-		"OUT_FOR_DELIVERY": 80.0,
-		"DELIVERED":        100.0,
-		"EXCEPTION":        50.0, // Depends on context
-	}
-
-	if percent, exists := statusPercent[status]; exists {
-		return percent
-	}
-	return 0.0
-}
-
 // User-Specific Tracking Endpoints
 
 // GetUserActiveTrackings @Summary Get active trackings for a user
@@ -658,7 +1402,7 @@ func calculateLoadCompletionPercent(status string) float64 {
 // @Param user_id path int true "User ID"
 // @Param role query string false "User role filter (CARRIER, SHIPPER)"
 // @Success 200 {object} map[string]interface{}
-// @Router /users/{user_id}/tracking/active [get]
+// @Router /tracking/users/{user_id}/active [get]
 func GetUserActiveTrackings(c *fiber.Ctx) error {
 	userIDStr := c.Params("user_id")
 	userID, err := strconv.ParseUint(userIDStr, 10, 32)
@@ -670,6 +1414,9 @@ func GetUserActiveTrackings(c *fiber.Ctx) error {
 
 	role := c.Query("role", "")
 
+	// Trips and loads are limited to those the requesting user can see
+	db := database.DB.WithContext(c.UserContext())
+
 	// Get user to determine their role if not specified
 	var user models.User
 	if err := database.DB.First(&user, uint(userID)).Error; err != nil {
@@ -690,7 +1437,7 @@ func GetUserActiveTrackings(c *fiber.Ctx) error {
 	if role == "CARRIER" {
 		// Get active trips for carrier
 		var trips []models.Trip
-		database.DB.Where("user_id = ? AND status IN ?", userID,
+		db.Where("user_id = ? AND status IN ?", userID,
 			[]string{"ACTIVE", "IN_TRANSIT", "AT_PICKUP", "AT_DELIVERY"}).
 			Preload("Loads").
 			Find(&trips)
@@ -727,7 +1474,7 @@ func GetUserActiveTrackings(c *fiber.Ctx) error {
 	} else if role == "SHIPPER" {
 		// Get active loads for shipper
 		var loads []models.Load
-		database.DB.Where("shipper_id = ? AND status IN ?", userID,
+		db.Where("shipper_id = ? AND status IN ?", userID,
 			[]string{"BOOKED", "PICKUP_SCHEDULED", "PICKED_UP", "IN_TRANSIT", "OUT_FOR_DELIVERY"}).
 			Find(&loads)
 
@@ -736,7 +1483,7 @@ func GetUserActiveTrackings(c *fiber.Ctx) error {
 		for _, load := range loads {
 			// Get trip information
 			var trip models.Trip
-			database.DB.First(&trip, load.TripID)
+			db.First(&trip, load.TripID)
 
 			currentLocation, _ := trackingService.GetCurrentLocation(trip.ID)
 			eta, _ := trackingService.CalculateETA(trip.ID)
@@ -770,14 +1517,15 @@ func GetUserActiveTrackings(c *fiber.Ctx) error {
 }
 
 // GetShipperTrackingView @Summary Get shipper-specific tracking view
-// @Description Get comprehensive tracking view for shippers showing their loads
+// @Description Get comprehensive tracking view for shippers showing their loads, with the times of their trips at local time in local_times
 // @Tags user-tracking
 // @Produce json
 // @Param user_id path int true "Shipper User ID"
 // @Param status query string false "Load status filter"
+// @Param filter_id query int false "ID of one of the user's saved filters to apply"
 // @Param limit query int false "Number of loads to return (default 20)"
 // @Success 200 {object} map[string]interface{}
-// @Router /users/{user_id}/tracking/shipper-view [get]
+// @Router /tracking/users/{user_id}/shipper-view [get]
 func GetShipperTrackingView(c *fiber.Ctx) error {
 	userIDStr := c.Params("user_id")
 	userID, err := strconv.ParseUint(userIDStr, 10, 32)
@@ -798,10 +1546,34 @@ func GetShipperTrackingView(c *fiber.Ctx) error {
 		})
 	}
 
-	query := database.DB.Where("shipper_id = ?", userID)
+	// Shippers see their own loads and those of their organizations, limited
+	// to those the requesting user can see
+	db := database.DB.WithContext(c.UserContext())
+	organizationIDs, err := organizationService.VisibleOrganizationIDs(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch organizations",
+		})
+	}
+	query := db.Where("shipper_id = ? OR organization_id IN ?", userID, organizationIDs)
 	if statusFilter != "" {
 		query = query.Where("status = ?", statusFilter)
 	}
+	savedFilter, status, message := viewSavedFilter(c, user.ID, services.SavedFilterLoads)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+	if savedFilter != nil {
+		query = services.ApplySavedFilter(query, savedFilter, time.Now())
+	}
+	workspace, err := workspaceService.GetWorkspace(user.ID, services.SavedFilterLoads)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch workspace",
+		})
+	}
 
 	var loads []models.Load
 	query.Limit(limit).Order("created_at DESC").Find(&loads)
@@ -810,7 +1582,7 @@ func GetShipperTrackingView(c *fiber.Ctx) error {
 	for _, load := range loads {
 		// Get trip and tracking information
 		var trip models.Trip
-		database.DB.First(&trip, load.TripID)
+		db.First(&trip, load.TripID)
 
 		currentLocation, _ := trackingService.GetCurrentLocation(trip.ID)
 		eta, _ := trackingService.CalculateETA(trip.ID)
@@ -823,6 +1595,10 @@ func GetShipperTrackingView(c *fiber.Ctx) error {
 			Limit(5).
 			Find(&recentEvents)
 
+		// Get pickup and delivery proofs for this load
+		var proofs []models.LoadProof
+		database.DB.Where("load_id = ?", load.ID).Order("captured_at ASC").Find(&proofs)
+
 		loadTracking := map[string]interface{}{
 			"load_id":           load.ID,
 			"booking_reference": load.BookingReference,
@@ -834,8 +1610,15 @@ func GetShipperTrackingView(c *fiber.Ctx) error {
 			"trip_status":       trip.Status,
 			"current_location":  currentLocation,
 			"estimated_arrival": eta,
+			"local_times":       services.LocalTimes(&trip, eta),
 			"recent_events":     recentEvents,
 			"tracking_enabled":  trip.TrackingEnabled,
+			"pickup_proof":      load.PickupProof,
+			"delivery_proof":    load.DeliveryProof,
+			"proofs":            proofs,
+		}
+		if load.ActualDeliveryDate != nil {
+			loadTracking["delivered_at"] = load.ActualDeliveryDate
 		}
 
 		if delayInfo != nil {
@@ -846,11 +1629,13 @@ func GetShipperTrackingView(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"user_id":       userID,
-		"role":          "SHIPPER",
-		"tracking_data": trackingData,
-		"total_loads":   len(trackingData),
-		"status_filter": statusFilter,
+		"user_id":        userID,
+		"role":           "SHIPPER",
+		"tracking_data":  trackingData,
+		"total_loads":    len(trackingData),
+		"status_filter":  statusFilter,
+		"applied_filter": savedFilter,
+		"workspace":      workspace,
 	})
 }
 
@@ -860,9 +1645,10 @@ func GetShipperTrackingView(c *fiber.Ctx) error {
 // @Produce json
 // @Param user_id path int true "Carrier User ID"
 // @Param status query string false "Trip status filter"
+// @Param filter_id query int false "ID of one of the user's saved filters to apply"
 // @Param limit query int false "Number of trips to return (default 20)"
 // @Success 200 {object} map[string]interface{}
-// @Router /users/{user_id}/tracking/carrier-view [get]
+// @Router /tracking/users/{user_id}/carrier-view [get]
 func GetCarrierTrackingView(c *fiber.Ctx) error {
 	userIDStr := c.Params("user_id")
 	userID, err := strconv.ParseUint(userIDStr, 10, 32)
@@ -883,10 +1669,46 @@ func GetCarrierTrackingView(c *fiber.Ctx) error {
 		})
 	}
 
-	query := database.DB.Where("user_id = ?", userID)
+	// Carriers see their own trips and those of their organizations, limited
+	// to those the requesting user can see
+	db := database.DB.WithContext(c.UserContext())
+	organizationIDs, err := organizationService.VisibleOrganizationIDs(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch organizations",
+		})
+	}
+	query := db.Where("user_id = ? OR organization_id IN ?", userID, organizationIDs)
+	role := "CARRIER"
+	// Drivers see the trips they are assigned to rather than trips they own
+	if user.Role == "DRIVER" {
+		role = user.Role
+		tripIDs, err := tripAssignmentService.AssignedTripIDs(user.ID, time.Now())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Could not fetch assigned trips",
+			})
+		}
+		query = db.Where("id IN ?", tripIDs)
+	}
 	if statusFilter != "" {
 		query = query.Where("status = ?", statusFilter)
 	}
+	savedFilter, status, message := viewSavedFilter(c, user.ID, services.SavedFilterTrips)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+	if savedFilter != nil {
+		query = services.ApplySavedFilter(query, savedFilter, time.Now())
+	}
+	workspace, err := workspaceService.GetWorkspace(user.ID, services.SavedFilterTrips)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch workspace",
+		})
+	}
 
 	var trips []models.Trip
 	query.Preload("Loads").Limit(limit).Order("created_at DESC").Find(&trips)
@@ -939,62 +1761,67 @@ func GetCarrierTrackingView(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"user_id":       userID,
-		"role":          "CARRIER",
-		"tracking_data": trackingData,
-		"total_trips":   len(trackingData),
-		"status_filter": statusFilter,
+		"user_id":        userID,
+		"role":           role,
+		"tracking_data":  trackingData,
+		"total_trips":    len(trackingData),
+		"status_filter":  statusFilter,
+		"applied_filter": savedFilter,
+		"workspace":      workspace,
 	})
 }
 
-// GetUserTrackingNotifications @Summary Get tracking notifications for a user
-// @Description Get all tracking-related notifications for a specific user
+// GetFleetLiveMap @Summary Get live fleet map
+// @Description Get the latest position, status, heading and speed of every active trip of a carrier for the dispatcher map. With cluster=true, positions that would overlap at the given map zoom are grouped into clusters.
 // @Tags user-tracking
 // @Produce json
-// @Param user_id path int true "User ID"
-// @Param unread_only query boolean false "Show only unread notifications"
-// @Param limit query int false "Number of notifications to return (default 20)"
-// @Success 200 {array} models.Notification
-// @Router /users/{user_id}/tracking/notifications [get]
-func GetUserTrackingNotifications(c *fiber.Ctx) error {
-	userIDStr := c.Params("user_id")
-	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+// @Produce application/geo+json
+// @Param carrier_id path int true "Carrier User ID"
+// @Param cluster query bool false "Group nearby positions into clusters (default false)"
+// @Param zoom query int false "Map zoom level used for clustering, 0-20 (default 6)"
+// @Param format query string false "Response format, json or geojson for a FeatureCollection of Points (default json)"
+// @Success 200 {object} services.FleetLiveMap
+// @Router /tracking/users/{carrier_id}/fleet/live [get]
+func GetFleetLiveMap(c *fiber.Ctx) error {
+	carrierID, err := strconv.ParseUint(c.Params("carrier_id"), 10, 32)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid user ID",
+			"error": "Invalid carrier ID",
 		})
 	}
 
-	unreadOnly := c.Query("unread_only") == "true"
-	limit := c.QueryInt("limit", 20)
-
-	// Define tracking-related notification types
-	trackingTypes := []string{
-		"TRIP_DEPARTED", "TRIP_ARRIVED", "TRIP_DELAYED", "ETA_UPDATED",
-		"LOAD_STATUS_CHANGED", "LOCATION_UPDATE", "PICKUP_SCHEDULED",
-		"LOAD_DELIVERED",
+	zoom := c.QueryInt("zoom", 6)
+	if zoom < 0 || zoom > 20 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid zoom, must be between 0 and 20",
+		})
 	}
-
-	query := database.DB.Where("user_id = ? AND type IN ?", userID, trackingTypes)
-	if unreadOnly {
-		query = query.Where("is_read = ?", false)
+	geoJSON, err := trackingGeoJSON(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
 	}
 
-	var notifications []models.Notification
-	result := query.Order("created_at DESC").Limit(limit).Find(&notifications)
+	var carrier models.User
+	if err := database.DB.First(&carrier, uint(carrierID)).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Carrier not found",
+		})
+	}
 
-	if result.Error != nil {
+	fleet, err := trackingService.GetFleetLiveMap(uint(carrierID), c.QueryBool("cluster", false), zoom)
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
-			"error": "Could not fetch tracking notifications",
+			"error": "Could not fetch fleet positions",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"user_id":       userID,
-		"notifications": notifications,
-		"count":         len(notifications),
-		"unread_only":   unreadOnly,
-	})
+	if geoJSON {
+		return c.JSON(services.FleetLiveGeoJSON(fleet), services.GeoJSONContentType)
+	}
+
+	return c.JSON(fleet)
 }
 
 // Mobile-Optimized Tracking Endpoints
@@ -1066,8 +1893,9 @@ func GetLightweightTracking(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Param trip_id path int true "Trip ID"
-// @Param data body []services.LocationUpdate true "Offline location data"
+// @Param data body []LocationUpdateRequest true "Offline location data"
 // @Success 200 {object} map[string]interface{}
+// @Failure 422 {object} ValidationErrorResponse
 // @Router /mobile/trips/{trip_id}/sync [post]
 func SyncOfflineData(c *fiber.Ctx) error {
 	tripIDStr := c.Params("trip_id")
@@ -1078,11 +1906,21 @@ func SyncOfflineData(c *fiber.Ctx) error {
 		})
 	}
 
+	var records []LocationUpdateRequest
+	if err := decodeBody(c, &records); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	// Invalid records are reported with the batch result rather than failing
+	// the sync, so that the rest of the data collected offline isn't lost
 	var offlineData []services.LocationUpdate
-	if err := c.BodyParser(&offlineData); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Cannot parse offline data",
-		})
+	var rejected []string
+	for i, record := range records {
+		if err := validateRequest(record); err != nil {
+			rejected = append(rejected, fmt.Sprintf("Record %d: %v", i, err))
+			continue
+		}
+		offlineData = append(offlineData, record.locationUpdate())
 	}
 
 	// Verify trip exists
@@ -1092,50 +1930,51 @@ func SyncOfflineData(c *fiber.Ctx) error {
 			"error": "Trip not found",
 		})
 	}
+	driverID, status := assignedDriverID(c, &trip)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": "Only the trip's carrier and assigned drivers can sync its location",
+		})
+	}
+	for i := range offlineData {
+		offlineData[i].DriverID = driverID
+	}
 
-	successCount := 0
-	errorCount := 0
-	var errors []string
-
-	// Process each location update
-	for _, locationUpdate := range offlineData {
-		// Validate and sanitize data
-		if err := trackingService.ValidateLocationUpdate(uint(tripID), locationUpdate); err != nil {
-			errorCount++
-			errors = append(errors, err.Error())
-			continue
-		}
+	result := trackingService.WithContext(c.UserContext()).IngestLocationBatch(uint(tripID), offlineData)
+	result.TotalRecords += len(rejected)
+	result.ErrorCount += len(rejected)
+	result.Errors = append(rejected, result.Errors...)
 
-		trackingService.SanitizeLocationData(&locationUpdate)
+	// Log sync event
+	trackingService.LogTrackingEvent(uint(tripID), nil, "OFFLINE_SYNC",
+		fmt.Sprintf(`{"total_records":%d,"success":%d,"errors":%d}`, result.TotalRecords, result.SuccessCount, result.ErrorCount),
+		"", nil, nil, fmt.Sprintf("Synced %d offline location records", result.SuccessCount))
 
-		// Update location
-		if err := trackingService.UpdateLocation(uint(tripID), locationUpdate); err != nil {
-			errorCount++
-			errors = append(errors, err.Error())
-		} else {
-			successCount++
+	response := fiber.Map{
+		"message":         "Offline data sync completed",
+		"total_records":   result.TotalRecords,
+		"success_count":   result.SuccessCount,
+		"error_count":     result.ErrorCount,
+		"duplicate_count": result.DuplicateCount,
+		"filtered_count":  result.FilteredCount,
+		"matched_count":   result.MatchedCount,
+		"errors":          result.Errors,
+	}
+	if result.SuccessCount > 0 {
+		if settings, err := trackingService.PushTrackingSettings(uint(tripID), nil); err == nil {
+			response["tracking_settings"] = settings
 		}
 	}
 
-	// Log sync event
-	trackingService.LogTrackingEvent(uint(tripID), nil, "OFFLINE_SYNC",
-		fmt.Sprintf(`{"total_records":%d,"success":%d,"errors":%d}`, len(offlineData), successCount, errorCount),
-		"", nil, nil, fmt.Sprintf("Synced %d offline location records", successCount))
-
-	return c.JSON(fiber.Map{
-		"message":       "Offline data sync completed",
-		"total_records": len(offlineData),
-		"success_count": successCount,
-		"error_count":   errorCount,
-		"errors":        errors,
-	})
+	return c.JSON(response)
 }
 
 // GetBatteryOptimizedSettings @Summary Get battery-optimized tracking settings
-// @Description Get tracking settings optimized for battery life
+// @Description Get the tracking settings recommended for the trip's device from its current speed, distance to the next stop and battery level
 // @Tags mobile-tracking
 // @Produce json
 // @Param trip_id path int true "Trip ID"
+// @Param battery_level query number false "Current battery level in percent, instead of the level last reported"
 // @Success 200 {object} map[string]interface{}
 // @Router /mobile/trips/{trip_id}/battery-settings [get]
 func GetBatteryOptimizedSettings(c *fiber.Ctx) error {
@@ -1147,60 +1986,119 @@ func GetBatteryOptimizedSettings(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get trip to determine optimal settings
-	var trip models.Trip
-	if err := database.DB.First(&trip, uint(tripID)).Error; err != nil {
+	var batteryLevel *float64
+	if value := c.Query("battery_level"); value != "" {
+		level, err := strconv.ParseFloat(value, 64)
+		if err != nil || level < 0 || level > 100 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Battery level must be between 0 and 100",
+			})
+		}
+		batteryLevel = &level
+	}
+
+	settings, err := trackingService.RecommendTrackingSettings(uint(tripID), batteryLevel)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Trip not found",
 		})
 	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to recommend tracking settings: " + err.Error(),
+		})
+	}
 
-	// Calculate trip duration to optimize settings
-	tripDuration := trip.EstimatedArrival.Sub(trip.DepartureDate).Hours()
+	return c.JSON(fiber.Map{
+		"trip_id":  tripID,
+		"settings": settings,
+		"battery_level_thresholds": fiber.Map{
+			"low_battery_mode":      deviceTrackingConfig.LowBatteryPercent,
+			"critical_battery_mode": deviceTrackingConfig.CriticalBatteryPercent,
+			"stop_tracking":         deviceTrackingConfig.StopTrackingPercent,
+		},
+	})
+}
 
-	// Optimize based on trip duration
-	var settings map[string]interface{}
+// StreamTrackingSettings @Summary Stream tracking settings to a device
+// @Description Stream the tracking settings recommended for the trip's device as server-sent events. The current settings are sent first, followed by a "settings" event whenever they change mid-trip, and periodic heartbeat comments.
+// @Tags mobile-tracking
+// @Produce text/event-stream
+// @Param trip_id path int true "Trip ID"
+// @Success 200 {object} services.DeviceTrackingSettings
+// @Router /mobile/trips/{trip_id}/tracking-settings/stream [get]
+func StreamTrackingSettings(c *fiber.Ctx) error {
+	tripIDStr := c.Params("trip_id")
+	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid trip ID",
+		})
+	}
 
-	if tripDuration < 2 { // Short trips
-		settings = map[string]interface{}{
-			"update_interval_seconds": 30,
-			"high_accuracy_mode":      true,
-			"background_updates":      true,
-			"wifi_only_sync":          false,
-		}
-	} else if tripDuration < 8 { // Medium trips
-		settings = map[string]interface{}{
-			"update_interval_seconds": 60,
-			"high_accuracy_mode":      false,
-			"background_updates":      true,
-			"wifi_only_sync":          false,
-		}
-	} else { // Long trips
-		settings = map[string]interface{}{
-			"update_interval_seconds": 120,
-			"high_accuracy_mode":      false,
-			"background_updates":      false,
-			"wifi_only_sync":          true,
+	// Subscribe before recommending the current settings so no change is missed
+	updates, unsubscribe := services.GetDeviceConfigHub().Subscribe(uint(tripID))
+	current, err := trackingService.RecommendTrackingSettings(uint(tripID), nil)
+	if err != nil {
+		unsubscribe()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Trip not found",
+			})
 		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to recommend tracking settings: " + err.Error(),
+		})
+	}
+	heartbeat := realtimeConfig.StreamHeartbeat
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
 	}
 
-	// Add common battery optimization settings
-	settings["adaptive_interval"] = true
-	settings["stop_when_stationary"] = true
-	settings["reduce_accuracy_when_slow"] = true
-	settings["batch_uploads"] = true
-	settings["compress_data"] = true
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
 
-	return c.JSON(fiber.Map{
-		"trip_id":             tripID,
-		"trip_duration_hours": tripDuration,
-		"settings":            settings,
-		"battery_level_thresholds": map[string]interface{}{
-			"low_battery_mode":      20, // Switch to power saving at 20%
-			"critical_battery_mode": 10, // Minimal tracking at 10%
-			"stop_tracking":         5,  // Stop tracking at 5%
-		},
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		writeSettingsEvent(w, *current)
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case settings, ok := <-updates:
+				if !ok {
+					return
+				}
+				writeSettingsEvent(w, settings)
+			case <-ticker.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			}
+
+			// Flushing fails once the device has disconnected
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
 	})
+
+	return nil
+}
+
+// writeSettingsEvent writes tracking settings as a server-sent event
+func writeSettingsEvent(w *bufio.Writer, settings services.DeviceTrackingSettings) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: settings\ndata: %s\n\n", data)
 }
 
 // UpdateMobileTrackingPreferences @Summary Update mobile tracking preferences
@@ -1366,7 +2264,7 @@ func GetMobileTrackingSummary(c *fiber.Ctx) error {
 // @Produce json
 // @Param trip_id path int true "Trip ID"
 // @Success 200 {object} map[string]interface{}
-// @Router /analytics/trips/{trip_id}/tracking [get]
+// @Router /monitoring/trips/{trip_id}/analytics [get]
 func GetTrackingAnalytics(c *fiber.Ctx) error {
 	tripIDStr := c.Params("trip_id")
 	tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
@@ -1410,7 +2308,7 @@ func GetTrackingAnalytics(c *fiber.Ctx) error {
 }
 
 // GetSystemHealthMetrics @Summary Get system health metrics
-// @Description Get health metrics for the tracking system
+// @Description Get health metrics for the tracking system, including the circuit breaker state of each external API provider (CLOSED, OPEN or HALF_OPEN)
 // @Tags monitoring
 // @Produce json
 // @Success 200 {object} map[string]interface{}
@@ -1421,7 +2319,7 @@ func GetSystemHealthMetrics(c *fiber.Ctx) error {
 	}
 
 	// Database health
-	dbHealth := checkDatabaseHealth()
+	dbHealth := checkDatabaseHealth(c.UserContext())
 	metrics["database"] = dbHealth
 
 	// Tracking data quality
@@ -1440,6 +2338,9 @@ func GetSystemHealthMetrics(c *fiber.Ctx) error {
 	errorRates := getTrackingErrorRates()
 	metrics["error_rates"] = errorRates
 
+	// External API providers, failing fast while their circuit is open
+	metrics["external_providers"] = services.CircuitBreakerStatuses()
+
 	// Overall health score (0-100)
 	healthScore := calculateOverallHealthScore(dbHealth, dataQuality, performance, errorRates)
 	metrics["health_score"] = healthScore
@@ -1447,8 +2348,52 @@ func GetSystemHealthMetrics(c *fiber.Ctx) error {
 	return c.JSON(metrics)
 }
 
+// GetETAAccuracyReport @Summary Get ETA accuracy report
+// @Description Compare the ETAs predicted for completed trips with their actual arrival. Reports the mean absolute error, bias and error percentiles in minutes overall and by ETA source, route, carrier, hour of day (UTC) and prediction horizon.
+// @Tags monitoring
+// @Produce json
+// @Param from query string false "Only predictions made from this date (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "Only predictions made up to this date (RFC3339 or YYYY-MM-DD)"
+// @Param carrier_id query int false "Only trips of this carrier"
+// @Param source query string false "Only predictions from this source (GOOGLE_MAPS, HERE, HAVERSINE)"
+// @Success 200 {object} services.ETAAccuracyReport
+// @Router /monitoring/tracking/eta-accuracy [get]
+func GetETAAccuracyReport(c *fiber.Ctx) error {
+	filter := services.ETAAccuracyFilter{
+		CarrierID: uint(c.QueryInt("carrier_id", 0)),
+		Source:    c.Query("source"),
+	}
+	if value := c.Query("from"); value != "" {
+		from, err := parseSearchDate(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid from date",
+			})
+		}
+		filter.From = &from
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := parseSearchDate(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid to date",
+			})
+		}
+		filter.To = &to
+	}
+
+	report, err := trackingService.GetETAAccuracyReport(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to build ETA accuracy report: " + err.Error(),
+		})
+	}
+
+	return c.JSON(report)
+}
+
 // GetTrackingPerformanceMetrics @Summary Get tracking performance metrics
-// @Description Get detailed performance metrics for tracking operations
+// @Description Get detailed performance metrics for tracking operations. Response times are measured by this instance since it started, and are null for operations it hasn't served.
 // @Tags monitoring
 // @Produce json
 // @Param hours query int false "Hours to look back (default 24)"
@@ -1470,12 +2415,12 @@ func GetTrackingPerformanceMetrics(c *fiber.Ctx) error {
 		Where("created_at >= ?", since).
 		Count(&eventCount)
 
-	// Average response times (simulated - in real system would be measured)
-	avgResponseTimes := map[string]float64{
-		"location_update_ms": 150.5,
-		"status_update_ms":   89.2,
-		"eta_calculation_ms": 245.8,
-		"history_query_ms":   312.1,
+	// Average response times, as recorded by the metrics middleware
+	avgResponseTimes := map[string]*metrics.RouteLatency{
+		"location_update": metrics.RequestLatency("POST", "/api/tracking/trips/:trip_id/location"),
+		"status_update":   metrics.RequestLatency("PUT", "/api/tracking/trips/:trip_id/status"),
+		"eta_calculation": metrics.RequestLatency("GET", "/api/tracking/trips/:trip_id/eta"),
+		"history_query":   metrics.RequestLatency("GET", "/api/tracking/trips/:trip_id/history"),
 	}
 
 	// Error counts by type
@@ -1487,7 +2432,7 @@ func GetTrackingPerformanceMetrics(c *fiber.Ctx) error {
 		"events_per_hour":           float64(eventCount) / float64(hours),
 	}
 
-	metrics := fiber.Map{
+	performance := fiber.Map{
 		"time_period_hours":  hours,
 		"since":              since,
 		"location_updates":   locationUpdateCount,
@@ -1498,7 +2443,7 @@ func GetTrackingPerformanceMetrics(c *fiber.Ctx) error {
 		"generated_at":       time.Now(),
 	}
 
-	return c.JSON(metrics)
+	return c.JSON(performance)
 }
 
 // GetDataQualityReport @Summary Get data quality report
@@ -1544,18 +2489,19 @@ func calculateRouteEfficiency(tripID uint) map[string]interface{} {
 	database.DB.First(&trip, tripID)
 
 	// Calculate direct distance
-	directDistance := calculateDistance(trip.OriginLat, trip.OriginLng,
+	directDistance := geo.Distance(trip.OriginLat, trip.OriginLng,
 		trip.DestinationLat, trip.DestinationLng)
 
 	// Calculate actual distance traveled
 	var records []models.TrackingRecord
-	database.DB.Where("trip_id = ?", tripID).Order("timestamp ASC").Find(&records)
+	services.TripTrackingRecords(database.DB, tripID).Order("timestamp ASC").Find(&records)
 
+	// Snapped positions don't wander off the road, so they don't inflate the distance
 	actualDistance := 0.0
 	for i := 1; i < len(records); i++ {
-		actualDistance += calculateDistance(
-			records[i-1].Latitude, records[i-1].Longitude,
-			records[i].Latitude, records[i].Longitude)
+		fromLat, fromLng, _ := services.TrackPosition(records[i-1])
+		toLat, toLng, _ := services.TrackPosition(records[i])
+		actualDistance += geo.Distance(fromLat, fromLng, toLat, toLng)
 	}
 
 	efficiency := 0.0
@@ -1596,23 +2542,29 @@ func getDelayAnalysis(tripID uint) map[string]interface{} {
 	}
 }
 
-func checkDatabaseHealth() map[string]interface{} {
-	// Check database connectivity and performance
-	start := time.Now()
-	var count int64
-	err := database.DB.Model(&models.TrackingRecord{}).Count(&count)
-	queryTime := time.Since(start).Milliseconds()
+func checkDatabaseHealth(ctx context.Context) map[string]interface{} {
+	// Check database connectivity with the readiness probe's check
+	component, _ := healthService.CheckComponent(ctx, "database")
+	connected := component.Status == services.HealthUp
 
 	health := map[string]interface{}{
-		"connected":     err == nil,
-		"query_time_ms": queryTime,
-		"total_records": count,
+		"connected":     connected,
+		"query_time_ms": component.LatencyMs,
+	}
+	if component.Error != "" {
+		health["error"] = component.Error
 	}
 
-	if queryTime > 1000 {
-		health["status"] = "slow"
-	} else if err != nil {
+	if !connected {
 		health["status"] = "error"
+		return health
+	}
+
+	var count int64
+	database.DB.WithContext(ctx).Model(&models.TrackingRecord{}).Count(&count)
+	health["total_records"] = count
+	if component.LatencyMs > 1000 {
+		health["status"] = "slow"
 	} else {
 		health["status"] = "healthy"
 	}
@@ -1773,26 +2725,3 @@ func min(a, b float64) float64 {
 	}
 	return b
 }
-
-// calculateDistance calculates the distance between two coordinates using Haversine formula
-func calculateDistance(lat1, lng1, lat2, lng2 float64) float64 {
-	const earthRadius = 6371 // Earth's radius in kilometers
-
-	// Convert degrees to radians
-	lat1Rad := lat1 * math.Pi / 180
-	lng1Rad := lng1 * math.Pi / 180
-	lat2Rad := lat2 * math.Pi / 180
-	lng2Rad := lng2 * math.Pi / 180
-
-	// Calculate differences
-	deltaLat := lat2Rad - lat1Rad
-	deltaLng := lng2Rad - lng1Rad
-
-	// Haversine formula
-	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
-		math.Cos(lat1Rad)*math.Cos(lat2Rad)*
-			math.Sin(deltaLng/2)*math.Sin(deltaLng/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-
-	return earthRadius * c
-}
@@ -2,9 +2,17 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
 	"triplink/backend/services"
 
 	"github.com/gofiber/fiber/v2"
@@ -23,17 +31,34 @@ func (suite *TrackingHandlerTestSuite) SetupSuite() {
 func (suite *TrackingHandlerTestSuite) SetupTest() {
 	clearTestDB()
 	seedTestDB()
+	trackingService = services.NewTrackingService(testDB)
+	tripAssignmentService = services.NewTripAssignmentService(testDB)
 	suite.app = fiber.New()
 
+	suite.app.Use(asHeaderUser())
+
 	// Add tracking routes
 	suite.app.Post("/trips/:trip_id/tracking/location", UpdateTripLocation)
 	suite.app.Get("/trips/:trip_id/tracking/current", GetCurrentTripLocation)
 	suite.app.Get("/trips/:trip_id/tracking/history", GetTripTrackingHistory)
 	suite.app.Put("/trips/:trip_id/tracking/status", UpdateTripStatus)
+	suite.app.Post("/trips/:trip_id/tracking/pause", PauseTripTracking)
+	suite.app.Post("/trips/:trip_id/tracking/resume", ResumeTripTracking)
+	suite.app.Post("/trips/:trip_id/tracking/consent", RecordTripTrackingConsent)
 	suite.app.Get("/trips/:trip_id/tracking/eta", GetTripETA)
+	suite.app.Get("/trips/:trip_id/tracking/route", GetTripRoute)
+	suite.app.Put("/trips/:trip_id/tracking/route", UpdateTripPlannedRoute)
+	suite.app.Get("/trips/:trip_id/tracking/replay", GetTripReplay)
+	suite.app.Get("/trips/:trip_id/tracking/stops", GetTripStops)
+	suite.app.Put("/trips/:trip_id/tracking/stops/:stop_id/status", UpdateTripStopStatus)
 	suite.app.Get("/loads/:load_id/tracking", GetLoadTracking)
 	suite.app.Get("/users/:user_id/tracking/active", GetUserActiveTrackings)
+	suite.app.Get("/users/:carrier_id/fleet/live", GetFleetLiveMap)
 	suite.app.Get("/mobile/trips/:trip_id/tracking", GetLightweightTracking)
+	suite.app.Post("/mobile/trips/:trip_id/sync", SyncOfflineData)
+	suite.app.Get("/mobile/trips/:trip_id/battery-settings", GetBatteryOptimizedSettings)
+	suite.app.Get("/monitoring/tracking/eta-accuracy", GetETAAccuracyReport)
+	suite.app.Get("/monitoring/tracking/health", GetSystemHealthMetrics)
 }
 
 func (suite *TrackingHandlerTestSuite) TearDownTest() {
@@ -47,42 +72,76 @@ func (suite *TrackingHandlerTestSuite) TestUpdateTripLocation() {
 	tests := []struct {
 		name           string
 		tripID         string
-		locationData   services.LocationUpdate
+		locationData   map[string]interface{}
 		expectedStatus int
+		invalidFields  []string
 	}{
 		{
 			name:   "Valid location update",
 			tripID: "1",
-			locationData: services.LocationUpdate{
-				Latitude:  40.7128,
-				Longitude: -74.0060,
-				Source:    "GPS",
+			locationData: map[string]interface{}{
+				"latitude":  40.7128,
+				"longitude": -74.0060,
+				"source":    "GPS",
+			},
+			expectedStatus: 200,
+		},
+		{
+			name:   "On the equator and prime meridian",
+			tripID: "1",
+			locationData: map[string]interface{}{
+				"latitude":  0,
+				"longitude": 0,
 			},
 			expectedStatus: 200,
 		},
 		{
 			name:   "Invalid coordinates",
 			tripID: "1",
-			locationData: services.LocationUpdate{
-				Latitude:  91.0,
-				Longitude: -74.0060,
-				Source:    "GPS",
+			locationData: map[string]interface{}{
+				"latitude":  91.0,
+				"longitude": -74.0060,
+				"source":    "GPS",
 			},
-			expectedStatus: 400,
+			expectedStatus: 422,
+			invalidFields:  []string{"latitude"},
 		},
 		{
 			name:           "Invalid trip ID",
 			tripID:         "invalid",
-			locationData:   services.LocationUpdate{},
+			locationData:   map[string]interface{}{},
 			expectedStatus: 400,
 		},
 		{
 			name:   "Missing coordinates",
 			tripID: "1",
-			locationData: services.LocationUpdate{
-				Source: "GPS",
+			locationData: map[string]interface{}{
+				"source": "GPS",
 			},
-			expectedStatus: 400,
+			expectedStatus: 422,
+			invalidFields:  []string{"latitude", "longitude"},
+		},
+		{
+			name:   "Invalid source and battery level",
+			tripID: "1",
+			locationData: map[string]interface{}{
+				"latitude":      -33.9249,
+				"longitude":     18.4241,
+				"source":        "PIGEON",
+				"battery_level": 140,
+			},
+			expectedStatus: 422,
+			invalidFields:  []string{"source", "battery_level"},
+		},
+		{
+			name:   "Coordinate of the wrong type",
+			tripID: "1",
+			locationData: map[string]interface{}{
+				"latitude":  "north",
+				"longitude": 18.4241,
+			},
+			expectedStatus: 422,
+			invalidFields:  []string{"latitude"},
 		},
 	}
 
@@ -95,6 +154,18 @@ func (suite *TrackingHandlerTestSuite) TestUpdateTripLocation() {
 			resp, err := suite.app.Test(req)
 			assert.NoError(t, err)
 			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+
+			if tt.invalidFields != nil {
+				var body ValidationErrorResponse
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+				assert.Equal(t, "Validation failed", body.Error)
+				var fields []string
+				for _, field := range body.Fields {
+					assert.NotEmpty(t, field.Message)
+					fields = append(fields, field.Field)
+				}
+				assert.Equal(t, tt.invalidFields, fields)
+			}
 		})
 	}
 }
@@ -154,13 +225,13 @@ func (suite *TrackingHandlerTestSuite) TestUpdateTripStatus() {
 			statusData: map[string]string{
 				"status": "INVALID_STATUS",
 			},
-			expectedStatus: 400,
+			expectedStatus: 422,
 		},
 		{
 			name:           "Missing status",
 			tripID:         "1",
 			statusData:     map[string]string{},
-			expectedStatus: 400,
+			expectedStatus: 422,
 		},
 		{
 			name:           "Invalid trip ID",
@@ -183,6 +254,67 @@ func (suite *TrackingHandlerTestSuite) TestUpdateTripStatus() {
 	}
 }
 
+// Test pausing and resuming tracking and recording consent
+func (suite *TrackingHandlerTestSuite) TestTrackingPauseAndConsent() {
+	t := suite.T()
+
+	var trip models.Trip
+	testDB.First(&trip)
+	carrierID := strconv.Itoa(int(trip.UserID))
+	tripURL := fmt.Sprintf("/trips/%d/tracking", trip.ID)
+
+	request := func(method, url, userID string, body interface{}) int {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		if userID != "" {
+			req.Header.Set("X-User-ID", userID)
+		}
+		resp, err := suite.app.Test(req, -1)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+	location := services.LocationUpdate{Latitude: -17.8292, Longitude: 31.0522, Source: "GPS"}
+	countEvents := func(eventType string) int64 {
+		var count int64
+		testDB.Model(&models.TrackingEvent{}).Where("trip_id = ? AND event_type = ?", trip.ID, eventType).Count(&count)
+		return count
+	}
+
+	// Only the trip's carrier can pause tracking
+	assert.Equal(t, 401, request("POST", tripURL+"/pause", "", nil))
+	assert.Equal(t, 403, request("POST", tripURL+"/pause", strconv.Itoa(int(trip.UserID)+1), nil))
+	assert.Equal(t, 200, request("POST", tripURL+"/pause", carrierID, map[string]string{"reason": "Driver off duty"}))
+
+	testDB.First(&trip, trip.ID)
+	assert.False(t, trip.TrackingEnabled)
+	assert.NotNil(t, trip.TrackingPausedAt)
+	assert.Equal(t, int64(1), countEvents("TRACKING_PAUSED"))
+
+	// Updates are rejected while paused, and the rejection is logged once
+	assert.Equal(t, 409, request("POST", tripURL+"/location", "", location))
+	assert.Equal(t, 409, request("POST", tripURL+"/location", "", location))
+	assert.Equal(t, int64(1), countEvents("TRACKING_DISABLED"))
+
+	assert.Equal(t, 200, request("POST", tripURL+"/resume", carrierID, nil))
+	assert.Equal(t, 200, request("POST", tripURL+"/location", "", location))
+
+	// Withdrawing consent pauses tracking until consent is given again
+	assert.Equal(t, 422, request("POST", tripURL+"/consent", carrierID, map[string]string{}))
+	assert.Equal(t, 200, request("POST", tripURL+"/consent", carrierID, map[string]bool{"granted": false}))
+	assert.Equal(t, 409, request("POST", tripURL+"/location", "", location))
+	assert.Equal(t, 409, request("POST", tripURL+"/resume", carrierID, nil))
+
+	assert.Equal(t, 200, request("POST", tripURL+"/consent", carrierID, map[string]bool{"granted": true}))
+	assert.Equal(t, 200, request("POST", tripURL+"/resume", carrierID, nil))
+
+	testDB.First(&trip, trip.ID)
+	assert.True(t, trip.TrackingEnabled)
+	assert.NotNil(t, trip.TrackingConsentAt)
+	assert.Nil(t, trip.TrackingConsentWithdrawnAt)
+	assert.Equal(t, int64(2), countEvents("TRACKING_DISABLED"))
+}
+
 // Test GetTripTrackingHistory endpoint
 func (suite *TrackingHandlerTestSuite) TestGetTripTrackingHistory() {
 	t := suite.T()
@@ -211,6 +343,12 @@ func (suite *TrackingHandlerTestSuite) TestGetTripTrackingHistory() {
 			queryParams:    "?offset=5",
 			expectedStatus: 200,
 		},
+		{
+			name:           "Invalid cursor",
+			tripID:         "1",
+			queryParams:    "?cursor=not-a-cursor",
+			expectedStatus: 400,
+		},
 		{
 			name:           "Invalid trip ID",
 			tripID:         "invalid",
@@ -229,6 +367,849 @@ func (suite *TrackingHandlerTestSuite) TestGetTripTrackingHistory() {
 	}
 }
 
+// Test walking GetTripTrackingHistory pages with next_cursor
+func (suite *TrackingHandlerTestSuite) TestGetTripTrackingHistoryCursor() {
+	t := suite.T()
+
+	var trip models.Trip
+	testDB.First(&trip)
+	testDB.Exec("DELETE FROM tracking_records")
+
+	// Two records share a timestamp so the ID tie-breaker is exercised
+	base := time.Now().Add(-time.Hour)
+	for i, offset := range []int{0, 1, 1, 2, 3} {
+		testDB.Create(&models.TrackingRecord{
+			TripID:    trip.ID,
+			Latitude:  40.7 + float64(i)/100,
+			Longitude: -74.0,
+			Timestamp: base.Add(time.Duration(offset) * time.Minute),
+		})
+	}
+
+	seen := make(map[uint]bool)
+	cursor := ""
+	pages := 0
+	for {
+		url := fmt.Sprintf("/trips/%d/tracking/history?limit=2", trip.ID)
+		if cursor != "" {
+			url += "&cursor=" + cursor
+		}
+		resp, err := suite.app.Test(httptest.NewRequest("GET", url, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		var body struct {
+			Data       []models.TrackingRecord `json:"data"`
+			Total      int64                   `json:"total"`
+			NextCursor string                  `json:"next_cursor"`
+			HasMore    bool                    `json:"has_more"`
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, int64(5), body.Total)
+		for _, record := range body.Data {
+			assert.False(t, seen[record.ID], "record %d returned twice", record.ID)
+			seen[record.ID] = true
+		}
+
+		pages++
+		if !body.HasMore || pages > 5 {
+			break
+		}
+		cursor = body.NextCursor
+	}
+
+	assert.Equal(t, 3, pages)
+	assert.Len(t, seen, 5)
+}
+
+// Test GetTripTrackingHistory as GeoJSON
+func (suite *TrackingHandlerTestSuite) TestGetTripTrackingHistoryGeoJSON() {
+	t := suite.T()
+
+	var trip models.Trip
+	testDB.First(&trip)
+	testDB.Exec("DELETE FROM tracking_records")
+	url := fmt.Sprintf("/trips/%d/tracking/history", trip.ID)
+
+	base := time.Now().Add(-time.Hour)
+	for i, latitude := range []float64{40.70, 40.71, 40.72} {
+		testDB.Create(&models.TrackingRecord{
+			TripID:    trip.ID,
+			Latitude:  latitude,
+			Longitude: -74.0,
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	resp, err := suite.app.Test(httptest.NewRequest("GET", url+"?format=geojson&limit=2", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, services.GeoJSONContentType, resp.Header.Get("Content-Type"))
+
+	var body struct {
+		services.GeoJSONFeatureCollection
+		NextCursor string `json:"next_cursor"`
+		HasMore    bool   `json:"has_more"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "FeatureCollection", body.Type)
+	assert.True(t, body.HasMore)
+	if assert.Len(t, body.Features, 1) {
+		// The latest page, oldest position first
+		feature := body.Features[0]
+		assert.Equal(t, "LineString", feature.Geometry.Type)
+		assert.Equal(t, []interface{}{
+			[]interface{}{-74.0, 40.71},
+			[]interface{}{-74.0, 40.72},
+		}, feature.Geometry.Coordinates)
+		assert.Equal(t, float64(2), feature.Properties["point_count"])
+		assert.Len(t, feature.Properties["coordTimes"], 2)
+	}
+
+	// The last page holds a single position
+	resp, err = suite.app.Test(httptest.NewRequest("GET", url+"?format=geojson&limit=2&cursor="+body.NextCursor, nil))
+	assert.NoError(t, err)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	if assert.Len(t, body.Features, 1) {
+		assert.Equal(t, "Point", body.Features[0].Geometry.Type)
+	}
+
+	resp, err = suite.app.Test(httptest.NewRequest("GET", url+"?format=gpx", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+// Test UpdateTripPlannedRoute and GetTripRoute endpoints
+func (suite *TrackingHandlerTestSuite) TestTripRoute() {
+	t := suite.T()
+
+	var trip models.Trip
+	testDB.First(&trip)
+	tripID := fmt.Sprint(trip.ID)
+
+	polyline := services.EncodePolyline([]services.Coordinate{
+		{Latitude: 40.7128, Longitude: -74.0060},
+		{Latitude: 40.7306, Longitude: -73.9352},
+	})
+
+	updateTests := []struct {
+		name           string
+		tripID         string
+		routeData      map[string]string
+		expectedStatus int
+	}{
+		{
+			name:           "Valid planned route",
+			tripID:         tripID,
+			routeData:      map[string]string{"polyline": polyline, "source": "MANUAL"},
+			expectedStatus: 200,
+		},
+		{
+			name:           "Empty polyline",
+			tripID:         tripID,
+			routeData:      map[string]string{"polyline": ""},
+			expectedStatus: 400,
+		},
+		{
+			name:           "Invalid trip ID",
+			tripID:         "invalid",
+			routeData:      map[string]string{"polyline": polyline},
+			expectedStatus: 400,
+		},
+	}
+
+	for _, tt := range updateTests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.routeData)
+			req := httptest.NewRequest("PUT", "/trips/"+tt.tripID+"/tracking/route", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := suite.app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+
+	getTests := []struct {
+		name           string
+		tripID         string
+		queryParams    string
+		expectedStatus int
+	}{
+		{
+			name:           "Valid request with default tolerance",
+			tripID:         tripID,
+			queryParams:    "",
+			expectedStatus: 200,
+		},
+		{
+			name:           "Valid request with tolerance",
+			tripID:         tripID,
+			queryParams:    "?tolerance=50",
+			expectedStatus: 200,
+		},
+		{
+			name:           "Invalid tolerance",
+			tripID:         tripID,
+			queryParams:    "?tolerance=abc",
+			expectedStatus: 400,
+		},
+		{
+			name:           "Invalid trip ID",
+			tripID:         "invalid",
+			queryParams:    "",
+			expectedStatus: 400,
+		},
+		{
+			name:           "Trip not found",
+			tripID:         "999",
+			queryParams:    "",
+			expectedStatus: 404,
+		},
+	}
+
+	for _, tt := range getTests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/trips/"+tt.tripID+"/tracking/route"+tt.queryParams, nil)
+			resp, err := suite.app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+}
+
+// Test GetTripReplay endpoint
+func (suite *TrackingHandlerTestSuite) TestGetTripReplay() {
+	t := suite.T()
+
+	var trip models.Trip
+	testDB.First(&trip)
+	testDB.Exec("DELETE FROM tracking_records")
+	url := fmt.Sprintf("/trips/%d/tracking/replay", trip.ID)
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, record := range []struct {
+		offset   time.Duration
+		latitude float64
+	}{
+		{0, 40.0},
+		{60 * time.Second, 40.6},
+		{150 * time.Second, 41.5},
+	} {
+		testDB.Create(&models.TrackingRecord{
+			TripID:    trip.ID,
+			Latitude:  record.latitude,
+			Longitude: -74.0,
+			Timestamp: base.Add(record.offset),
+		})
+	}
+
+	resp, err := suite.app.Test(httptest.NewRequest("GET", url+"?interval=30&speed=10", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var replay services.TripReplay
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&replay))
+	assert.Equal(t, 3, replay.RecordCount)
+	assert.Equal(t, 150.0, replay.DurationSeconds)
+	assert.Len(t, replay.Frames, 6)
+	assert.Equal(t, 6, replay.FrameCount)
+
+	// Frames between records are interpolated
+	assert.InDelta(t, 40.3, replay.Frames[1].Latitude, 1e-9)
+	assert.True(t, replay.Frames[1].Interpolated)
+	assert.Equal(t, int64(3000), replay.Frames[1].PlaybackMs)
+	assert.InDelta(t, 40.6, replay.Frames[2].Latitude, 1e-9)
+	assert.False(t, replay.Frames[2].Interpolated)
+	assert.InDelta(t, 41.5, replay.Frames[5].Latitude, 1e-9)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+	}{
+		{"Invalid interval", url + "?interval=0", 400},
+		{"Invalid speed", url + "?speed=-1", 400},
+		{"Trip not found", "/trips/999/tracking/replay", 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := suite.app.Test(httptest.NewRequest("GET", tt.url, nil))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+}
+
+// shiftingMapMatcher snaps points a fixed distance east, except points north
+// of cutoff which it can't match
+type shiftingMapMatcher struct {
+	shift  float64
+	cutoff float64
+	calls  int
+}
+
+func (m *shiftingMapMatcher) Name() string {
+	return "TEST"
+}
+
+func (m *shiftingMapMatcher) MatchTrace(ctx context.Context, points []services.TracePoint) ([]*services.MatchedPoint, error) {
+	m.calls++
+	results := make([]*services.MatchedPoint, len(points))
+	for i, point := range points {
+		if point.Latitude > m.cutoff {
+			continue
+		}
+		results[i] = &services.MatchedPoint{Latitude: point.Latitude, Longitude: point.Longitude + m.shift, Confidence: 0.8}
+	}
+	return results, nil
+}
+
+// Test snapping synced offline positions to roads, and replaying them
+func (suite *TrackingHandlerTestSuite) TestMapMatching() {
+	t := suite.T()
+
+	var trip models.Trip
+	assert.NoError(t, testDB.First(&trip).Error)
+	testDB.Exec("DELETE FROM tracking_records")
+	matcher := &shiftingMapMatcher{shift: 0.0001, cutoff: 40.0015}
+	trackingService.SetMapMatcher(matcher)
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	var updates []services.LocationUpdate
+	for i, latitude := range []float64{40.0, 40.001, 40.002, 40.003} {
+		timestamp := base.Add(time.Duration(i) * time.Minute)
+		updates = append(updates, services.LocationUpdate{
+			Latitude: latitude, Longitude: -74.0, Source: "GPS", Timestamp: &timestamp,
+		})
+	}
+	body, _ := json.Marshal(updates)
+	req := httptest.NewRequest("POST", fmt.Sprintf("/mobile/trips/%d/sync", trip.ID), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var result map[string]interface{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, float64(4), result["success_count"])
+	assert.Equal(t, float64(2), result["matched_count"])
+	assert.Equal(t, 1, matcher.calls)
+
+	// Raw positions are kept next to matched ones
+	var records []models.TrackingRecord
+	testDB.Where("trip_id = ?", trip.ID).Order("timestamp ASC").Find(&records)
+	assert.Len(t, records, 4)
+	assert.Equal(t, -74.0, records[0].Longitude)
+	if assert.NotNil(t, records[0].MatchedLongitude) {
+		assert.InDelta(t, -73.9999, *records[0].MatchedLongitude, 1e-9)
+		assert.Equal(t, 0.8, *records[0].MatchConfidence)
+	}
+	assert.Nil(t, records[2].MatchedLongitude)
+
+	// Unmatched records are matched again for replays, and matches too far
+	// from the raw position are discarded
+	matcher.shift = 0.01
+	resp, err = suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/trips/%d/tracking/replay?interval=60", trip.ID), nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 2, matcher.calls)
+
+	var replay services.TripReplay
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&replay))
+	assert.Len(t, replay.Frames, 4)
+	assert.True(t, replay.Frames[0].Snapped)
+	assert.InDelta(t, -73.9999, replay.Frames[0].Longitude, 1e-9)
+	assert.False(t, replay.Frames[2].Snapped)
+	assert.InDelta(t, -74.0, replay.Frames[2].Longitude, 1e-9)
+	assert.False(t, replay.Frames[3].Snapped)
+}
+
+// Test that invalid records of an offline sync are reported without failing
+// the rest of the batch
+func (suite *TrackingHandlerTestSuite) TestSyncOfflineDataWithInvalidRecords() {
+	t := suite.T()
+
+	var trip models.Trip
+	assert.NoError(t, testDB.First(&trip).Error)
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	body, _ := json.Marshal([]map[string]interface{}{
+		{"latitude": 0.0, "longitude": 9.5, "timestamp": base},
+		{"longitude": 9.6, "timestamp": base.Add(time.Minute)},
+		{"latitude": 0.2, "longitude": 9.7, "heading": 400, "timestamp": base.Add(2 * time.Minute)},
+	})
+	req := httptest.NewRequest("POST", fmt.Sprintf("/mobile/trips/%d/sync", trip.ID), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var result struct {
+		TotalRecords int      `json:"total_records"`
+		SuccessCount int      `json:"success_count"`
+		ErrorCount   int      `json:"error_count"`
+		Errors       []string `json:"errors"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, 3, result.TotalRecords)
+	assert.Equal(t, 1, result.SuccessCount)
+	assert.Equal(t, 2, result.ErrorCount)
+	assert.Equal(t, []string{
+		"Record 1: Validation failed: latitude is required",
+		"Record 2: Validation failed: heading must be less than 360",
+	}, result.Errors)
+
+	var count int64
+	testDB.Model(&models.TrackingRecord{}).Where("trip_id = ? AND latitude = 0", trip.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// A body that isn't a list of records can't be synced at all
+	req = httptest.NewRequest("POST", fmt.Sprintf("/mobile/trips/%d/sync", trip.ID), bytes.NewBufferString(`{"latitude": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = suite.app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+// Test matching a trace with an OSRM server
+func (suite *TrackingHandlerTestSuite) TestOSRMMapMatcher() {
+	t := suite.T()
+
+	var path string
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.Path, r.URL.Query()
+		w.Write([]byte(`{"code":"Ok","matchings":[{"confidence":0.9}],
+			"tracepoints":[{"location":[-74.00005,40.0],"matchings_index":0},null]}`))
+	}))
+	defer server.Close()
+
+	cfg := config.GetMapMatchingConfig()
+	cfg.OSRMURL = server.URL
+	matcher := services.NewOSRMMapMatcher(cfg)
+
+	base := time.Unix(1700000000, 0)
+	results, err := matcher.MatchTrace(context.Background(), []services.TracePoint{
+		{Latitude: 40.0, Longitude: -74.0, Timestamp: base, RadiusMeters: 25},
+		{Latitude: 40.001, Longitude: -74.0, Timestamp: base.Add(time.Minute), RadiusMeters: 40},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "/match/v1/driving/-74.000000,40.000000;-74.000000,40.001000", path)
+	assert.Equal(t, "1700000000;1700000060", query["timestamps"][0])
+	assert.Equal(t, "25.0;40.0", query["radiuses"][0])
+	if assert.Len(t, results, 2) && assert.NotNil(t, results[0]) {
+		assert.Equal(t, -74.00005, results[0].Longitude)
+		assert.Equal(t, 0.9, results[0].Confidence)
+		assert.Nil(t, results[1])
+	}
+}
+
+// Test GetBatteryOptimizedSettings adapting to speed, the next stop and battery
+func (suite *TrackingHandlerTestSuite) TestBatteryOptimizedSettings() {
+	t := suite.T()
+
+	var trip models.Trip
+	assert.NoError(t, testDB.First(&trip).Error)
+	testDB.Model(&trip).Updates(map[string]interface{}{"destination_lat": 41.0, "destination_lng": -74.0})
+	speed, battery := 90.0, 60.0
+	record := models.TrackingRecord{
+		TripID: trip.ID, Latitude: 40.0, Longitude: -74.0, Speed: &speed, BatteryLevel: &battery, Timestamp: time.Now(),
+	}
+	testDB.Create(&record)
+
+	getSettings := func(query string) services.DeviceTrackingSettings {
+		resp, err := suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/mobile/trips/%d/battery-settings%s", trip.ID, query), nil))
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		var result struct {
+			Settings services.DeviceTrackingSettings `json:"settings"`
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result.Settings
+	}
+
+	// A position every 500 m at 90 km/h
+	settings := getSettings("")
+	assert.Equal(t, services.DeviceTrackingMoving, settings.Mode)
+	assert.Equal(t, 20, settings.UpdateIntervalSeconds)
+	assert.True(t, settings.TrackingEnabled)
+	if assert.NotNil(t, settings.DistanceToNextStopKm) {
+		assert.InDelta(t, 111.2, *settings.DistanceToNextStopKm, 0.1)
+	}
+
+	settings = getSettings("?battery_level=15")
+	assert.Equal(t, services.DeviceTrackingLowBattery, settings.Mode)
+	assert.Equal(t, 40, settings.UpdateIntervalSeconds)
+	assert.True(t, settings.BatchUploads)
+
+	settings = getSettings("?battery_level=8")
+	assert.Equal(t, services.DeviceTrackingCriticalBattery, settings.Mode)
+	assert.Equal(t, 300, settings.UpdateIntervalSeconds)
+
+	settings = getSettings("?battery_level=3")
+	assert.Equal(t, services.DeviceTrackingOff, settings.Mode)
+	assert.False(t, settings.TrackingEnabled)
+
+	// Close to the destination and stopped
+	testDB.Model(&record).Updates(map[string]interface{}{"latitude": 40.99, "speed": 0})
+	settings = getSettings("")
+	assert.Equal(t, services.DeviceTrackingApproaching, settings.Mode)
+	assert.Equal(t, 10, settings.UpdateIntervalSeconds)
+	assert.True(t, settings.HighAccuracyMode)
+
+	testDB.Model(&record).Update("latitude", 40.0)
+	settings = getSettings("")
+	assert.Equal(t, services.DeviceTrackingStationary, settings.Mode)
+	assert.Equal(t, 300, settings.UpdateIntervalSeconds)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+	}{
+		{"Invalid battery level", fmt.Sprintf("/mobile/trips/%d/battery-settings?battery_level=120", trip.ID), 400},
+		{"Trip not found", "/mobile/trips/999/battery-settings", 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := suite.app.Test(httptest.NewRequest("GET", tt.url, nil))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+}
+
+// Test that changed tracking settings are pushed to the device mid-trip
+func (suite *TrackingHandlerTestSuite) TestTrackingSettingsPush() {
+	t := suite.T()
+
+	var trip models.Trip
+	assert.NoError(t, testDB.First(&trip).Error)
+	updates, unsubscribe := services.GetDeviceConfigHub().Subscribe(trip.ID)
+	defer unsubscribe()
+
+	postLocation := func(battery float64) map[string]interface{} {
+		body, _ := json.Marshal(services.LocationUpdate{Latitude: 40.0, Longitude: -74.0, Source: "GPS", BatteryLevel: &battery})
+		req := httptest.NewRequest("POST", fmt.Sprintf("/trips/%d/tracking/location", trip.ID), bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := suite.app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		var result map[string]interface{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result
+	}
+
+	result := postLocation(8)
+	settings, _ := result["tracking_settings"].(map[string]interface{})
+	assert.Equal(t, services.DeviceTrackingCriticalBattery, settings["mode"])
+	select {
+	case pushed := <-updates:
+		assert.Equal(t, services.DeviceTrackingCriticalBattery, pushed.Mode)
+	default:
+		t.Fatal("Expected the changed settings to be pushed")
+	}
+
+	// Unchanged settings aren't pushed again
+	postLocation(7)
+	assert.Len(t, updates, 0)
+
+	postLocation(80)
+	select {
+	case pushed := <-updates:
+		assert.NotEqual(t, services.DeviceTrackingCriticalBattery, pushed.Mode)
+		assert.True(t, pushed.TrackingEnabled)
+	default:
+		t.Fatal("Expected the changed settings to be pushed")
+	}
+}
+
+// Test GetTripStops, stop progress from location updates and UpdateTripStopStatus
+func (suite *TrackingHandlerTestSuite) TestTripStops() {
+	t := suite.T()
+
+	var trip models.Trip
+	testDB.First(&trip)
+	var load models.Load
+	testDB.First(&load)
+	url := fmt.Sprintf("/trips/%d/tracking", trip.ID)
+
+	testDB.Model(&trip).Updates(map[string]interface{}{
+		"origin_lat": 40.0, "origin_lng": -74.0, "destination_lat": 42.0, "destination_lng": -74.0,
+	})
+	testDB.Model(&load).Updates(map[string]interface{}{
+		"pickup_lat": 40.5, "pickup_lng": -74.0, "delivery_lat": 41.5, "delivery_lng": -74.0,
+	})
+	second := models.Load{
+		TripID:           trip.ID,
+		ShipperID:        load.ShipperID,
+		BookingReference: "TEST-LOAD-002",
+		Status:           "BOOKED",
+		PickupLat:        41.0,
+		PickupLng:        -74.0,
+		DeliveryLat:      40.8,
+		DeliveryLng:      -74.0,
+	}
+	testDB.Create(&second)
+
+	getStops := func() []models.TripStop {
+		resp, err := suite.app.Test(httptest.NewRequest("GET", url+"/stops", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		var stops []models.TripStop
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&stops))
+		return stops
+	}
+
+	// Nearest stop first, but the second load is delivered after its pickup
+	stops := getStops()
+	assert.Len(t, stops, 6)
+	expected := []struct {
+		stopType string
+		loadID   uint
+	}{
+		{"ORIGIN", 0}, {"PICKUP", load.ID}, {"PICKUP", second.ID}, {"DELIVERY", second.ID}, {"DELIVERY", load.ID}, {"DESTINATION", 0},
+	}
+	for i, stop := range stops {
+		assert.Equal(t, expected[i].stopType, stop.StopType)
+		assert.Equal(t, i+1, stop.Sequence)
+		if expected[i].loadID != 0 {
+			assert.Equal(t, expected[i].loadID, *stop.LoadID)
+		}
+	}
+
+	// Reaching the first pickup departs the origin and arrives at the pickup
+	body, _ := json.Marshal(map[string]interface{}{"latitude": 40.5, "longitude": -74.0})
+	req := httptest.NewRequest("POST", url+"/location", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	stops = getStops()
+	assert.Equal(t, "COMPLETED", stops[0].Status)
+	assert.Equal(t, "ARRIVED", stops[1].Status)
+	assert.NotNil(t, stops[1].ActualArrival)
+	for _, stop := range stops[2:] {
+		assert.Equal(t, "PENDING", stop.Status)
+		assert.NotNil(t, stop.EstimatedArrival)
+	}
+	assert.True(t, stops[2].EstimatedArrival.Before(*stops[5].EstimatedArrival))
+
+	var trackingStatus models.TrackingStatus
+	testDB.Where("trip_id = ?", trip.ID).First(&trackingStatus)
+	assert.Contains(t, trackingStatus.NextMilestone, "At")
+
+	tests := []struct {
+		name           string
+		stopID         uint
+		status         string
+		expectedStatus int
+	}{
+		{"Depart arrived stop", stops[1].ID, "COMPLETED", 200},
+		{"Arrive at completed stop", stops[1].ID, "ARRIVED", 400},
+		{"Skip pending stop", stops[2].ID, "SKIPPED", 200},
+		{"Stop not found", 999, "ARRIVED", 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"status": tt.status})
+			req := httptest.NewRequest("PUT", fmt.Sprintf("%s/stops/%d/status", url, tt.stopID), bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := suite.app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+}
+
+func (suite *TrackingHandlerTestSuite) TestStopDwellAndDetention() {
+	t := suite.T()
+	trackingService.SetDetentionConfig(&config.DetentionConfig{
+		GeofenceRadiusKm: 1,
+		FreeTime:         2 * time.Hour,
+		HourlyRate:       40,
+		AutoCharge:       true,
+	})
+	var trip models.Trip
+	testDB.First(&trip)
+	var load models.Load
+	testDB.First(&load)
+	url := fmt.Sprintf("/trips/%d/tracking", trip.ID)
+
+	testDB.Model(&trip).Updates(map[string]interface{}{
+		"origin_lat": 40.0, "origin_lng": -74.0, "destination_lat": 42.0, "destination_lng": -74.0,
+	})
+	testDB.Model(&load).Updates(map[string]interface{}{
+		"pickup_lat": 40.5, "pickup_lng": -74.0, "delivery_lat": 41.5, "delivery_lng": -74.0,
+	})
+
+	updateLocation := func(latitude, longitude float64) {
+		body, _ := json.Marshal(map[string]interface{}{"latitude": latitude, "longitude": longitude})
+		req := httptest.NewRequest("POST", url+"/location", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := suite.app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+	}
+
+	resp, err := suite.app.Test(httptest.NewRequest("GET", url+"/stops", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	// Entering the pickup's geofence arrives at it
+	updateLocation(40.505, -74.0)
+	var pickup models.TripStop
+	testDB.Where("trip_id = ? AND stop_type = ?", trip.ID, "PICKUP").First(&pickup)
+	assert.Equal(t, "ARRIVED", pickup.Status)
+
+	// Arrived 4 hours ago, an hour before the appointment, so detention
+	// started after 3 hours
+	arrival := time.Now().Add(-4 * time.Hour)
+	planned := arrival.Add(time.Hour)
+	testDB.Model(&pickup).Updates(map[string]interface{}{"actual_arrival": arrival, "planned_arrival": planned})
+
+	// Leaving the geofence departs the pickup
+	updateLocation(40.6, -74.0)
+	testDB.First(&pickup, pickup.ID)
+	assert.Equal(t, "COMPLETED", pickup.Status)
+	assert.InDelta(t, 240, pickup.DwellMinutes, 1)
+	assert.InDelta(t, 60, pickup.DetentionMinutes, 1)
+	assert.InDelta(t, 40, pickup.DetentionCharge, 1)
+
+	var event models.TrackingEvent
+	assert.NoError(t, testDB.Where("trip_id = ? AND event_type = ?", trip.ID, "DETENTION").First(&event).Error)
+	assert.Contains(t, event.EventData, fmt.Sprintf(`"stop_id":%d`, pickup.ID))
+	assert.Contains(t, event.Description, "Detained 1h")
+
+	// Short stops aren't detained
+	body, _ := json.Marshal(map[string]string{"status": "COMPLETED"})
+	var delivery models.TripStop
+	testDB.Where("trip_id = ? AND stop_type = ?", trip.ID, "DELIVERY").First(&delivery)
+	req := httptest.NewRequest("PUT", fmt.Sprintf("%s/stops/%d/status", url, delivery.ID), bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = suite.app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	testDB.First(&delivery, delivery.ID)
+	assert.Equal(t, 0, delivery.DetentionMinutes)
+	assert.Zero(t, delivery.DetentionCharge)
+}
+
+// Test GetETAAccuracyReport endpoint
+func (suite *TrackingHandlerTestSuite) TestGetETAAccuracyReport() {
+	t := suite.T()
+
+	var trip models.Trip
+	testDB.First(&trip)
+	arrival := time.Now().Truncate(time.Second)
+	for _, prediction := range []struct {
+		source string
+		offset time.Duration
+	}{
+		{services.ETASourceHaversine, -20 * time.Minute},
+		{services.ETASourceHaversine, 10 * time.Minute},
+		{services.ETASourceGoogleMaps, -5 * time.Minute},
+	} {
+		testDB.Create(&models.ETAPrediction{
+			TripID:           trip.ID,
+			Source:           prediction.source,
+			PredictedAt:      arrival.Add(-2 * time.Hour),
+			PredictedArrival: arrival.Add(prediction.offset),
+		})
+	}
+	assert.NoError(t, trackingService.ResolveETAPredictions(trip.ID, arrival))
+
+	resp, err := suite.app.Test(httptest.NewRequest("GET", "/monitoring/tracking/eta-accuracy", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var report services.ETAAccuracyReport
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, 3, report.Overall.Count)
+	assert.InDelta(t, 35.0/3, report.Overall.MAEMinutes, 1e-6)
+	assert.InDelta(t, 5.0, report.Overall.MeanErrorMinutes, 1e-6)
+	assert.Len(t, report.BySource, 2)
+	assert.Equal(t, "1-4h", report.ByHorizon[0].Group)
+
+	resp, err = suite.app.Test(httptest.NewRequest("GET", "/monitoring/tracking/eta-accuracy?source=GOOGLE_MAPS", nil))
+	assert.NoError(t, err)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, 1, report.Overall.Count)
+
+	resp, err = suite.app.Test(httptest.NewRequest("GET", "/monitoring/tracking/eta-accuracy?from=yesterday", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+// failingETAProvider is a routing provider that is down
+type failingETAProvider struct {
+	calls int
+}
+
+func (p *failingETAProvider) Name() string {
+	return services.ETASourceHERE
+}
+
+func (p *failingETAProvider) EstimateRoute(ctx context.Context, origin, destination services.Coordinate) (*services.RoadRouteEstimate, error) {
+	p.calls++
+	return nil, errors.New("service unavailable")
+}
+
+// Test that ETAs stop waiting on a routing provider that is down
+func (suite *TrackingHandlerTestSuite) TestETAProviderCircuitBreaker() {
+	t := suite.T()
+
+	var trip models.Trip
+	assert.NoError(t, testDB.First(&trip).Error)
+	latitude, longitude := 40.7128, -74.0060
+	testDB.Model(&trip).Updates(map[string]interface{}{
+		"current_latitude":  latitude,
+		"current_longitude": longitude,
+		"destination_lat":   40.7306,
+		"destination_lng":   -73.9352,
+	})
+
+	provider := &failingETAProvider{}
+	breaker := services.GetCircuitBreaker("TEST_ROUTING")
+	trackingService.SetETAProviders(services.NewCircuitBreakerETAProvider(provider, breaker, time.Second))
+
+	threshold := config.GetCircuitBreakerConfig().FailureThreshold
+	for i := 0; i < threshold+2; i++ {
+		resp, err := suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/trips/%d/tracking/eta", trip.ID), nil))
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		var result map[string]interface{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		assert.Equal(t, services.ETASourceHaversine, result["eta_source"])
+	}
+
+	// Once open, the provider isn't called until the circuit's timeout passes
+	assert.Equal(t, threshold, provider.calls)
+	assert.Equal(t, services.CircuitOpen, breaker.State())
+
+	resp, err := suite.app.Test(httptest.NewRequest("GET", "/monitoring/tracking/health", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var health struct {
+		ExternalProviders []services.CircuitBreakerStatus `json:"external_providers"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+	var status *services.CircuitBreakerStatus
+	for i := range health.ExternalProviders {
+		if health.ExternalProviders[i].Name == "TEST_ROUTING" {
+			status = &health.ExternalProviders[i]
+		}
+	}
+	if assert.NotNil(t, status) {
+		assert.Equal(t, services.CircuitOpen, status.State)
+		assert.Equal(t, "service unavailable", status.LastError)
+		assert.NotNil(t, status.RetryAt)
+	}
+}
+
 // Test GetLoadTracking endpoint
 func (suite *TrackingHandlerTestSuite) TestGetLoadTracking() {
 	t := suite.T()
@@ -305,6 +1286,123 @@ func (suite *TrackingHandlerTestSuite) TestGetUserActiveTrackings() {
 	}
 }
 
+// Test GetFleetLiveMap with and without clustering
+func (suite *TrackingHandlerTestSuite) TestGetFleetLiveMap() {
+	t := suite.T()
+
+	var carrier models.User
+	testDB.First(&carrier)
+
+	// Two trips near Harare, one in Johannesburg and one without a position yet
+	now := time.Now()
+	trips := make([]models.Trip, 4)
+	for i := range trips {
+		trips[i] = models.Trip{UserID: carrier.ID, Status: "IN_TRANSIT", DepartureDate: now, EstimatedArrival: now.Add(time.Hour)}
+		testDB.Create(&trips[i])
+	}
+	testDB.Create(&models.Trip{UserID: carrier.ID, Status: "COMPLETED", DepartureDate: now, EstimatedArrival: now})
+
+	speed := 72.0
+	for _, record := range []struct {
+		trip      models.Trip
+		latitude  float64
+		longitude float64
+		age       time.Duration
+	}{
+		{trips[0], -17.70, 30.90, time.Hour},
+		{trips[0], -17.80, 31.00, time.Minute},
+		{trips[1], -17.85, 31.05, time.Minute},
+		{trips[2], -26.20, 28.05, time.Minute},
+	} {
+		testDB.Create(&models.TrackingRecord{
+			TripID:    record.trip.ID,
+			Latitude:  record.latitude,
+			Longitude: record.longitude,
+			Speed:     &speed,
+			Timestamp: now.Add(-record.age),
+		})
+	}
+
+	url := fmt.Sprintf("/users/%d/fleet/live", carrier.ID)
+	resp, err := suite.app.Test(httptest.NewRequest("GET", url, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var fleet services.FleetLiveMap
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&fleet))
+	assert.Equal(t, 4, fleet.ActiveTrips)
+	assert.Equal(t, 3, fleet.Located)
+	assert.Len(t, fleet.Positions, 4)
+	for _, position := range fleet.Positions {
+		if position.TripID == trips[0].ID {
+			assert.InDelta(t, -17.80, *position.Latitude, 1e-9)
+			assert.InDelta(t, 72.0, *position.Speed, 1e-9)
+		}
+		if position.TripID == trips[3].ID {
+			assert.Nil(t, position.Latitude)
+		}
+	}
+
+	resp, err = suite.app.Test(httptest.NewRequest("GET", url+"?cluster=true&zoom=6", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&fleet))
+	assert.True(t, fleet.Clustered)
+	assert.Len(t, fleet.Positions, 2)
+	if assert.Len(t, fleet.Clusters, 1) {
+		assert.Equal(t, 2, fleet.Clusters[0].Count)
+		assert.ElementsMatch(t, []uint{trips[0].ID, trips[1].ID}, fleet.Clusters[0].TripIDs)
+	}
+
+	// GeoJSON has a Point per located trip, and per cluster when clustered
+	resp, err = suite.app.Test(httptest.NewRequest("GET", url+"?format=geojson", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, services.GeoJSONContentType, resp.Header.Get("Content-Type"))
+	var collection services.GeoJSONFeatureCollection
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&collection))
+	assert.Equal(t, "FeatureCollection", collection.Type)
+	assert.Len(t, collection.Features, 3)
+	for _, feature := range collection.Features {
+		assert.Equal(t, "Point", feature.Geometry.Type)
+		if feature.Properties["trip_id"] == float64(trips[0].ID) {
+			assert.Equal(t, []interface{}{31.00, -17.80}, feature.Geometry.Coordinates)
+			assert.Equal(t, 72.0, feature.Properties["speed"])
+		}
+	}
+
+	resp, err = suite.app.Test(httptest.NewRequest("GET", url+"?format=geojson&cluster=true&zoom=6", nil))
+	assert.NoError(t, err)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&collection))
+	assert.Len(t, collection.Features, 2)
+	clusters := 0
+	for _, feature := range collection.Features {
+		if feature.Properties["cluster"] == true {
+			clusters++
+			assert.Equal(t, float64(2), feature.Properties["point_count"])
+		}
+	}
+	assert.Equal(t, 1, clusters)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+	}{
+		{"Invalid carrier ID", "/users/invalid/fleet/live", 400},
+		{"Invalid zoom", url + "?zoom=25", 400},
+		{"Invalid format", url + "?format=kml", 400},
+		{"Carrier not found", "/users/999/fleet/live", 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := suite.app.Test(httptest.NewRequest("GET", tt.url, nil))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+}
+
 // Test GetLightweightTracking endpoint (mobile)
 func (suite *TrackingHandlerTestSuite) TestGetLightweightTracking() {
 	t := suite.T()
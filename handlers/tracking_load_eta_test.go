@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LoadETATestSuite struct {
+	suite.Suite
+	app  *fiber.App
+	trip models.Trip
+}
+
+func (suite *LoadETATestSuite) SetupTest() {
+	clearTestDB()
+	trackingService = services.NewTrackingService(testDB)
+	trackingService.SetETAProviders()
+
+	carrier := models.User{Email: "eta-carrier@example.com", Phone: "+15550000431", Password: "password", Role: "CARRIER"}
+	testDB.Create(&carrier)
+
+	// East along the equator, half a degree from the origin at the default 60 km/h
+	latitude, longitude := 0.0, 0.5
+	suite.trip = models.Trip{
+		UserID:           carrier.ID,
+		Status:           "IN_TRANSIT",
+		DestinationLng:   4.5,
+		CurrentLatitude:  &latitude,
+		CurrentLongitude: &longitude,
+		DepartureDate:    time.Now(),
+		EstimatedArrival: time.Now().Add(8 * time.Hour),
+	}
+	testDB.Create(&suite.trip)
+
+	suite.app = fiber.New()
+	suite.app.Get("/loads/:load_id/tracking", GetLoadTracking)
+}
+
+func (suite *LoadETATestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *LoadETATestSuite) createLoad(reference, status string, pickupLng, deliveryLng float64) models.Load {
+	load := models.Load{
+		TripID:           suite.trip.ID,
+		ShipperID:        suite.trip.UserID,
+		BookingReference: reference,
+		Status:           status,
+		PickupLng:        pickupLng,
+		DeliveryLng:      deliveryLng,
+	}
+	suite.Require().NoError(testDB.Create(&load).Error)
+	return load
+}
+
+type loadETAs struct {
+	PickupETA   *time.Time `json:"pickup_eta"`
+	DeliveryETA *time.Time `json:"delivery_eta"`
+}
+
+func (suite *LoadETATestSuite) loadTracking(loadID uint) loadETAs {
+	resp, err := suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/loads/%d/tracking", loadID), nil), -1)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+	var etas loadETAs
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&etas))
+	return etas
+}
+
+func (suite *LoadETATestSuite) TestLoadETAsFollowStopSequence() {
+	t := suite.T()
+
+	first := suite.createLoad("ETA-1", "BOOKED", 1, 3)
+	second := suite.createLoad("ETA-2", "BOOKED", 2, 4)
+	_, err := trackingService.GenerateTripStops(suite.trip.ID)
+	suite.Require().NoError(err)
+
+	a := suite.loadTracking(first.ID)
+	b := suite.loadTracking(second.ID)
+	suite.Require().NotNil(a.PickupETA)
+	suite.Require().NotNil(a.DeliveryETA)
+	suite.Require().NotNil(b.PickupETA)
+	suite.Require().NotNil(b.DeliveryETA)
+
+	// Pickup 1, pickup 2, delivery 1, delivery 2
+	assert.True(t, a.PickupETA.Before(*b.PickupETA))
+	assert.True(t, b.PickupETA.Before(*a.DeliveryETA))
+	assert.True(t, a.DeliveryETA.Before(*b.DeliveryETA))
+
+	var stops []models.TripStop
+	testDB.Where("trip_id = ? AND load_id = ?", suite.trip.ID, first.ID).Order("sequence").Find(&stops)
+	suite.Require().Len(stops, 2)
+	assert.WithinDuration(t, *stops[0].EstimatedArrival, *a.PickupETA, time.Second)
+	assert.WithinDuration(t, *stops[1].EstimatedArrival, *a.DeliveryETA, time.Second)
+
+	// Each load has its own tracking status next to the trip's
+	var statuses []models.TrackingStatus
+	testDB.Where("trip_id = ?", suite.trip.ID).Find(&statuses)
+	assert.Len(t, statuses, 3)
+	var tripStatus models.TrackingStatus
+	suite.Require().NoError(testDB.Where("trip_id = ? AND load_id IS NULL", suite.trip.ID).First(&tripStatus).Error)
+	assert.True(t, tripStatus.EstimatedArrival.After(*b.DeliveryETA))
+}
+
+func (suite *LoadETATestSuite) TestLoadETAsWithoutItinerary() {
+	t := suite.T()
+
+	// About 222 km to the delivery, already on board
+	onBoard := suite.createLoad("ETA-3", "IN_TRANSIT", 0.2, 2.5)
+	etas := suite.loadTracking(onBoard.ID)
+	assert.Nil(t, etas.PickupETA)
+	suite.Require().NotNil(etas.DeliveryETA)
+	assert.WithinDuration(t, time.Now().Add(222*time.Minute), *etas.DeliveryETA, 10*time.Minute)
+
+	// Picked up on the way, with time at the pickup
+	booked := suite.createLoad("ETA-4", "BOOKED", 1.5, 2.5)
+	etas = suite.loadTracking(booked.ID)
+	suite.Require().NotNil(etas.PickupETA)
+	suite.Require().NotNil(etas.DeliveryETA)
+	assert.WithinDuration(t, time.Now().Add(111*time.Minute), *etas.PickupETA, 10*time.Minute)
+	assert.WithinDuration(t, etas.PickupETA.Add(111*time.Minute+15*time.Minute), *etas.DeliveryETA, 5*time.Minute)
+}
+
+func TestLoadETATestSuite(t *testing.T) {
+	suite.Run(t, new(LoadETATestSuite))
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LocationFilterTestSuite struct {
+	suite.Suite
+	app  *fiber.App
+	trip models.Trip
+}
+
+func (suite *LocationFilterTestSuite) SetupTest() {
+	clearTestDB()
+	trackingService = services.NewTrackingService(testDB)
+
+	carrier := models.User{Email: "filter-carrier@example.com", Phone: "+15550000533", Password: "password", Role: "CARRIER"}
+	testDB.Create(&carrier)
+
+	suite.trip = models.Trip{
+		UserID:           carrier.ID,
+		Status:           "IN_TRANSIT",
+		DestinationLng:   2,
+		TrackingEnabled:  true,
+		DepartureDate:    time.Now(),
+		EstimatedArrival: time.Now().Add(4 * time.Hour),
+	}
+	testDB.Create(&suite.trip)
+
+	suite.app = fiber.New()
+	suite.app.Post("/trips/:trip_id/tracking/location", UpdateTripLocation)
+	suite.app.Post("/mobile/trips/:trip_id/sync", SyncOfflineData)
+}
+
+func (suite *LocationFilterTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *LocationFilterTestSuite) post(path string, body interface{}) map[string]interface{} {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+	var result map[string]interface{}
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&result))
+	return result
+}
+
+func (suite *LocationFilterTestSuite) location(update fiber.Map) map[string]interface{} {
+	return suite.post(fmt.Sprintf("/trips/%d/tracking/location", suite.trip.ID), update)
+}
+
+func (suite *LocationFilterTestSuite) latest() models.TrackingRecord {
+	var record models.TrackingRecord
+	suite.Require().NoError(testDB.Where("trip_id = ?", suite.trip.ID).Order("timestamp DESC").First(&record).Error)
+	return record
+}
+
+func (suite *LocationFilterTestSuite) currentLongitude() float64 {
+	var trip models.Trip
+	suite.Require().NoError(testDB.First(&trip, suite.trip.ID).Error)
+	return *trip.CurrentLongitude
+}
+
+func (suite *LocationFilterTestSuite) TestSmoothsByAccuracy() {
+	t := suite.T()
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+
+	suite.location(fiber.Map{"latitude": 0, "longitude": 1.0, "accuracy": 10, "timestamp": start})
+	record := suite.latest()
+	assert.Equal(t, 1.0, *record.SmoothedLongitude)
+	assert.Equal(t, 10.0, *record.SmoothedAccuracy)
+
+	// A vague fix about 110 m away barely moves a slow vehicle
+	suite.location(fiber.Map{"latitude": 0, "longitude": 1.001, "accuracy": 50, "timestamp": start.Add(30 * time.Second)})
+	record = suite.latest()
+	assert.Equal(t, 1.001, record.Longitude)
+	assert.InDelta(t, 1.00013, *record.SmoothedLongitude, 0.00001)
+	assert.InDelta(t, 1.00013, suite.currentLongitude(), 0.00001)
+
+	// At speed, accurate fixes are followed closely
+	suite.location(fiber.Map{"latitude": 0, "longitude": 1.01, "accuracy": 10, "speed": 72, "timestamp": start.Add(time.Minute)})
+	assert.InDelta(t, 1.01, suite.currentLongitude(), 0.0001)
+	assert.Less(t, suite.currentLongitude(), 1.01)
+}
+
+func (suite *LocationFilterTestSuite) TestDropsInaccuratePositions() {
+	t := suite.T()
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+
+	result := suite.location(fiber.Map{"latitude": 0, "longitude": 1.0, "accuracy": 150, "timestamp": start})
+	assert.Equal(t, true, result["filtered"])
+	var count int64
+	testDB.Model(&models.TrackingRecord{}).Where("trip_id = ?", suite.trip.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	result = suite.post(fmt.Sprintf("/mobile/trips/%d/sync", suite.trip.ID), []fiber.Map{
+		{"latitude": 0, "longitude": 1.0, "accuracy": 10, "timestamp": start},
+		{"latitude": 0.5, "longitude": 1.5, "accuracy": 500, "timestamp": start.Add(time.Minute)},
+	})
+	assert.Equal(t, 1.0, result["success_count"])
+	assert.Equal(t, 1.0, result["filtered_count"])
+	assert.Equal(t, 0.0, result["error_count"])
+	assert.Equal(t, 1.0, suite.currentLongitude())
+}
+
+func TestLocationFilterTestSuite(t *testing.T) {
+	suite.Run(t, new(LocationFilterTestSuite))
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LocationSyncTestSuite struct {
+	suite.Suite
+	app  *fiber.App
+	trip models.Trip
+}
+
+func (suite *LocationSyncTestSuite) SetupTest() {
+	clearTestDB()
+	trackingService = services.NewTrackingService(testDB)
+
+	carrier := models.User{Email: "sync-carrier@example.com", Phone: "+15550000532", Password: "password", Role: "CARRIER"}
+	testDB.Create(&carrier)
+
+	suite.trip = models.Trip{
+		UserID:           carrier.ID,
+		Status:           "IN_TRANSIT",
+		DestinationLng:   2,
+		TrackingEnabled:  true,
+		DepartureDate:    time.Now(),
+		EstimatedArrival: time.Now().Add(4 * time.Hour),
+	}
+	testDB.Create(&suite.trip)
+
+	suite.app = fiber.New()
+	suite.app.Post("/trips/:trip_id/tracking/location", UpdateTripLocation)
+	suite.app.Post("/mobile/trips/:trip_id/sync", SyncOfflineData)
+}
+
+func (suite *LocationSyncTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *LocationSyncTestSuite) post(path string, body interface{}) map[string]interface{} {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+	var result map[string]interface{}
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&result))
+	return result
+}
+
+func (suite *LocationSyncTestSuite) location(lat, lng float64, at time.Time) map[string]interface{} {
+	return suite.post(fmt.Sprintf("/trips/%d/tracking/location", suite.trip.ID),
+		fiber.Map{"latitude": lat, "longitude": lng, "timestamp": at})
+}
+
+func (suite *LocationSyncTestSuite) current() models.Trip {
+	var trip models.Trip
+	suite.Require().NoError(testDB.First(&trip, suite.trip.ID).Error)
+	return trip
+}
+
+func (suite *LocationSyncTestSuite) records() int64 {
+	var count int64
+	testDB.Model(&models.TrackingRecord{}).Where("trip_id = ?", suite.trip.ID).Count(&count)
+	return count
+}
+
+func (suite *LocationSyncTestSuite) TestLatePointsKeepCurrentLocation() {
+	t := suite.T()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	suite.location(0.1, 1.0, now)
+	trip := suite.current()
+	assert.Equal(t, 1.0, *trip.CurrentLongitude)
+	assert.Equal(t, now, trip.LastLocationUpdate.UTC())
+
+	// A point recorded offline half an hour ago is kept in the history only
+	suite.location(0.1, 0.5, now.Add(-30*time.Minute))
+	trip = suite.current()
+	assert.Equal(t, 1.0, *trip.CurrentLongitude)
+	assert.Equal(t, now, trip.LastLocationUpdate.UTC())
+	assert.Equal(t, int64(2), suite.records())
+
+	suite.location(0.1, 1.5, now.Add(time.Minute))
+	assert.Equal(t, 1.5, *suite.current().CurrentLongitude)
+}
+
+func (suite *LocationSyncTestSuite) TestDuplicatePointsAreSkipped() {
+	t := suite.T()
+	at := time.Now().UTC().Add(-time.Hour)
+
+	suite.location(0.1, 0.5, at)
+	result := suite.location(0.1, 0.5, at)
+	assert.Equal(t, true, result["duplicate"])
+	assert.Equal(t, int64(1), suite.records())
+
+	result = suite.post(fmt.Sprintf("/mobile/trips/%d/sync", suite.trip.ID), []fiber.Map{
+		{"latitude": 0.1, "longitude": 0.5, "timestamp": at},
+		{"latitude": 0.1, "longitude": 0.6, "timestamp": at.Add(time.Minute)},
+	})
+	assert.Equal(t, 1.0, result["success_count"])
+	assert.Equal(t, 1.0, result["duplicate_count"])
+	assert.Equal(t, 0.0, result["error_count"])
+	assert.Equal(t, int64(2), suite.records())
+}
+
+func TestLocationSyncTestSuite(t *testing.T) {
+	suite.Run(t, new(LocationSyncTestSuite))
+}
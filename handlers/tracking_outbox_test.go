@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TrackingOutboxTestSuite struct {
+	suite.Suite
+	app  *fiber.App
+	trip models.Trip
+	load models.Load
+	cfg  *config.OutboxConfig
+
+	mu       sync.Mutex
+	received []services.OutboxMessage
+	failing  bool
+	webhook  *httptest.Server
+}
+
+func (suite *TrackingOutboxTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+	trackingService = services.NewTrackingService(testDB)
+	services.SetLocationHub(services.NewLocationHub(nil, 16))
+
+	suite.trip = models.Trip{}
+	testDB.First(&suite.trip)
+	suite.load = models.Load{}
+	testDB.Where("trip_id = ?", suite.trip.ID).First(&suite.load)
+
+	suite.received = nil
+	suite.failing = false
+	suite.webhook = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signature := "sha256=" + services.WebhookSignature("secret", r.Header.Get("X-Triplink-Timestamp"), body)
+		if r.Header.Get("X-Triplink-Signature") != signature {
+			w.WriteHeader(401)
+			return
+		}
+
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+		if suite.failing {
+			w.WriteHeader(503)
+			return
+		}
+		var message services.OutboxMessage
+		json.Unmarshal(body, &message)
+		suite.received = append(suite.received, message)
+	}))
+	suite.cfg = &config.OutboxConfig{BatchSize: 100, MaxAttempts: 3, RetryBackoff: time.Minute, ClaimTimeout: time.Minute}
+
+	suite.app = fiber.New()
+	suite.app.Put("/trips/:trip_id/tracking/status", UpdateTripStatus)
+	suite.app.Put("/loads/:load_id/status", UpdateLoadStatus)
+}
+
+func (suite *TrackingOutboxTestSuite) TearDownTest() {
+	suite.webhook.Close()
+	services.SetLocationHub(services.NewLocationHub(nil, 0))
+	clearTestDB()
+}
+
+func (suite *TrackingOutboxTestSuite) put(url, status string) int {
+	body, _ := json.Marshal(map[string]string{"status": status})
+	req := httptest.NewRequest("PUT", url, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	return resp.StatusCode
+}
+
+func (suite *TrackingOutboxTestSuite) dispatcher() *services.OutboxDispatcher {
+	return services.NewOutboxDispatcher(testDB, suite.cfg, services.StreamPublisher{}, services.NewWebhookPublisher(suite.webhook.URL, "secret", 5*time.Second))
+}
+
+func (suite *TrackingOutboxTestSuite) outbox() []models.OutboxEvent {
+	var events []models.OutboxEvent
+	testDB.Order("id").Find(&events)
+	return events
+}
+
+func (suite *TrackingOutboxTestSuite) receivedTypes() []string {
+	suite.mu.Lock()
+	defer suite.mu.Unlock()
+	types := make([]string, len(suite.received))
+	for i, message := range suite.received {
+		types[i] = message.Type
+	}
+	return types
+}
+
+func (suite *TrackingOutboxTestSuite) TestStatusChangesRecordOutboxEvents() {
+	t := suite.T()
+	tripURL := "/trips/" + strconv.Itoa(int(suite.trip.ID)) + "/tracking/status"
+
+	assert.Equal(t, 200, suite.put(tripURL, "ACTIVE"))
+	assert.Equal(t, 200, suite.put("/loads/"+strconv.Itoa(int(suite.load.ID))+"/status", "PICKED_UP"))
+
+	// A rejected change records nothing
+	assert.Equal(t, 409, suite.put(tripURL, "COMPLETED"))
+
+	events := suite.outbox()
+	suite.Require().Len(events, 2)
+	assert.Equal(t, "STATUS_CHANGE", events[0].EventType)
+	assert.Equal(t, suite.trip.ID, events[0].TripID)
+	assert.Nil(t, events[0].PublishedAt)
+	assert.Equal(t, "LOAD_STATUS_CHANGE", events[1].EventType)
+	assert.Equal(t, suite.load.ID, *events[1].LoadID)
+
+	var event models.TrackingEvent
+	assert.NoError(t, json.Unmarshal([]byte(events[0].Payload), &event))
+	assert.Equal(t, `{"from":"PLANNED","to":"ACTIVE"}`, event.EventData)
+	assert.NotZero(t, event.ID)
+}
+
+func (suite *TrackingOutboxTestSuite) TestDispatcherPublishesEvents() {
+	t := suite.T()
+	updates, unsubscribe := services.GetLocationHub().Subscribe(suite.trip.ID)
+	defer unsubscribe()
+
+	suite.put("/trips/"+strconv.Itoa(int(suite.trip.ID))+"/tracking/status", "ACTIVE")
+	assert.NoError(t, suite.dispatcher().DispatchPending())
+
+	assert.Equal(t, []string{"STATUS_CHANGE"}, suite.receivedTypes())
+	assert.Equal(t, suite.trip.ID, suite.received[0].TripID)
+	assert.Contains(t, string(suite.received[0].Data), `"event_type":"STATUS_CHANGE"`)
+
+	select {
+	case update := <-updates:
+		suite.Require().NotNil(update.Event)
+		assert.Equal(t, suite.received[0].ID, update.Event.ID)
+	default:
+		t.Fatal("expected the event to be streamed")
+	}
+
+	events := suite.outbox()
+	suite.Require().Len(events, 1)
+	assert.NotNil(t, events[0].PublishedAt)
+	assert.Equal(t, 1, events[0].Attempts)
+
+	// Published events are not published again
+	assert.NoError(t, suite.dispatcher().DispatchPending())
+	assert.Len(t, suite.receivedTypes(), 1)
+}
+
+func (suite *TrackingOutboxTestSuite) TestDispatcherRetriesInOrder() {
+	t := suite.T()
+	updates, unsubscribe := services.GetLocationHub().Subscribe(suite.trip.ID)
+	defer unsubscribe()
+
+	suite.failing = true
+	suite.put("/trips/"+strconv.Itoa(int(suite.trip.ID))+"/tracking/status", "ACTIVE")
+	assert.Error(t, suite.dispatcher().DispatchPending())
+
+	events := suite.outbox()
+	suite.Require().Len(events, 1)
+	assert.Nil(t, events[0].PublishedAt)
+	assert.Equal(t, "stream", events[0].Delivered)
+	assert.Contains(t, events[0].LastError, "503")
+	assert.True(t, events[0].NextAttemptAt.After(time.Now().Add(30*time.Second)))
+	assert.Len(t, updates, 1)
+
+	// Later events of the trip wait for the failed one
+	suite.failing = false
+	suite.put("/loads/"+strconv.Itoa(int(suite.load.ID))+"/status", "PICKED_UP")
+	assert.NoError(t, suite.dispatcher().DispatchPending())
+	assert.Empty(t, suite.receivedTypes())
+
+	testDB.Model(&models.OutboxEvent{}).Where("id = ?", events[0].ID).Update("next_attempt_at", time.Now().Add(-time.Second))
+	assert.NoError(t, suite.dispatcher().DispatchPending())
+	assert.Equal(t, []string{"STATUS_CHANGE", "LOAD_STATUS_CHANGE"}, suite.receivedTypes())
+
+	// The stream already had the first event
+	assert.Len(t, updates, 2)
+	for _, event := range suite.outbox() {
+		assert.NotNil(t, event.PublishedAt)
+	}
+}
+
+func (suite *TrackingOutboxTestSuite) TestDispatcherGivesUpAfterMaxAttempts() {
+	t := suite.T()
+	suite.failing = true
+	suite.put("/trips/"+strconv.Itoa(int(suite.trip.ID))+"/tracking/status", "ACTIVE")
+
+	for i := 0; i < suite.cfg.MaxAttempts; i++ {
+		testDB.Model(&models.OutboxEvent{}).Where("1 = 1").Update("next_attempt_at", time.Now().Add(-time.Second))
+		assert.Error(t, suite.dispatcher().DispatchPending())
+	}
+
+	events := suite.outbox()
+	suite.Require().Len(events, 1)
+	assert.Equal(t, suite.cfg.MaxAttempts, events[0].Attempts)
+	assert.NotNil(t, events[0].FailedAt)
+	assert.Nil(t, events[0].PublishedAt)
+
+	// Failed events no longer hold up the trip's later events
+	suite.failing = false
+	suite.put("/loads/"+strconv.Itoa(int(suite.load.ID))+"/status", "PICKED_UP")
+	assert.NoError(t, suite.dispatcher().DispatchPending())
+	assert.Equal(t, []string{"LOAD_STATUS_CHANGE"}, suite.receivedTypes())
+}
+
+func (suite *TrackingOutboxTestSuite) TestClaimedEventsAreSkipped() {
+	t := suite.T()
+	suite.put("/trips/"+strconv.Itoa(int(suite.trip.ID))+"/tracking/status", "ACTIVE")
+
+	// Another instance is publishing the event
+	testDB.Model(&models.OutboxEvent{}).Where("1 = 1").Update("claimed_until", time.Now().Add(time.Minute))
+	assert.NoError(t, suite.dispatcher().DispatchPending())
+	assert.Empty(t, suite.receivedTypes())
+
+	// Its claim expired without it publishing the event
+	testDB.Model(&models.OutboxEvent{}).Where("1 = 1").Update("claimed_until", time.Now().Add(-time.Second))
+	assert.NoError(t, suite.dispatcher().DispatchPending())
+	assert.Equal(t, []string{"STATUS_CHANGE"}, suite.receivedTypes())
+}
+
+func TestTrackingOutboxTestSuite(t *testing.T) {
+	suite.Run(t, new(TrackingOutboxTestSuite))
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TripProgressTestSuite struct {
+	suite.Suite
+	app  *fiber.App
+	trip models.Trip
+}
+
+func (suite *TripProgressTestSuite) SetupTest() {
+	clearTestDB()
+	trackingService = services.NewTrackingService(testDB)
+	trackingService.SetETAProviders()
+
+	carrier := models.User{Email: "progress-carrier@example.com", Phone: "+15550000531", Password: "password", Role: "CARRIER"}
+	testDB.Create(&carrier)
+
+	// Two degrees east along the equator, about 222 km
+	suite.trip = models.Trip{
+		UserID:           carrier.ID,
+		Status:           "IN_TRANSIT",
+		DestinationLng:   2,
+		TrackingEnabled:  true,
+		DepartureDate:    time.Now(),
+		EstimatedArrival: time.Now().Add(4 * time.Hour),
+	}
+	testDB.Create(&suite.trip)
+
+	suite.app = fiber.New()
+	suite.app.Post("/trips/:trip_id/tracking/location", UpdateTripLocation)
+	suite.app.Put("/trips/:trip_id/tracking/status", UpdateTripStatus)
+	suite.app.Get("/trips/:trip_id/tracking/status", GetTripTrackingStatus)
+}
+
+func (suite *TripProgressTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *TripProgressTestSuite) send(method, path string, body interface{}) {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, fmt.Sprintf("/trips/%d/tracking/%s", suite.trip.ID, path), bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+}
+
+func (suite *TripProgressTestSuite) status() models.TrackingStatus {
+	resp, err := suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/trips/%d/tracking/status", suite.trip.ID), nil), -1)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+	var status models.TrackingStatus
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&status))
+	return status
+}
+
+func (suite *TripProgressTestSuite) TestProgressFollowsLocationUpdates() {
+	t := suite.T()
+
+	suite.send("POST", "location", fiber.Map{"latitude": 0.01, "longitude": 0.5})
+	status := suite.status()
+	assert.InDelta(t, 25, status.CompletionPercent, 0.5)
+	assert.InDelta(t, 55.6, status.DistanceCoveredKm, 0.5)
+	assert.InDelta(t, 222.4, status.RouteDistanceKm, 0.5)
+
+	suite.send("POST", "location", fiber.Map{"latitude": -0.01, "longitude": 1.5})
+	assert.InDelta(t, 75, suite.status().CompletionPercent, 0.5)
+
+	// Status changes keep the progress until the trip completes
+	suite.send("PUT", "status", fiber.Map{"status": "DELAYED"})
+	status = suite.status()
+	assert.Equal(t, "DELAYED", status.CurrentStatus)
+	assert.InDelta(t, 75, status.CompletionPercent, 0.5)
+
+	suite.send("PUT", "status", fiber.Map{"status": "COMPLETED"})
+	assert.Equal(t, 100.0, suite.status().CompletionPercent)
+}
+
+func TestTripProgressTestSuite(t *testing.T) {
+	suite.Run(t, new(TripProgressTestSuite))
+}
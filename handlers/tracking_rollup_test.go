@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TrackingRollupTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	trip    models.Trip
+	start   time.Time
+	rollups *services.TrackingRollupService
+}
+
+func (suite *TrackingRollupTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+	// Positions are the tests' own, not the seeded one
+	testDB.Exec("DELETE FROM tracking_records")
+	suite.trip = models.Trip{}
+	testDB.First(&suite.trip)
+
+	// Two hours of positions a minute apart, driving north
+	suite.start = time.Now().Add(-3 * time.Hour).Truncate(time.Hour)
+	for i := 0; i < 120; i++ {
+		speed := float64(60 + i%10)
+		testDB.Create(&models.TrackingRecord{
+			TripID:    suite.trip.ID,
+			Latitude:  -18.0 + float64(i)*0.01,
+			Longitude: 31.0,
+			Speed:     &speed,
+			Timestamp: suite.start.Add(time.Duration(i) * time.Minute),
+			Source:    "GPS",
+			Status:    "ACTIVE",
+		})
+	}
+	now := time.Now()
+	testDB.Model(&suite.trip).Update("last_location_update", &now)
+
+	suite.rollups = services.NewTrackingRollupService(testDB)
+
+	suite.app = fiber.New()
+	suite.app.Get("/trips/:trip_id/tracking/history", GetTripTrackingHistory)
+}
+
+func (suite *TrackingRollupTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+type aggregatePage struct {
+	Data       []models.TrackingAggregate `json:"data"`
+	Resolution string                     `json:"resolution"`
+	Total      int64                      `json:"total"`
+	NextCursor string                     `json:"next_cursor"`
+}
+
+func (suite *TrackingRollupTestSuite) history(query string) (int, aggregatePage) {
+	req := httptest.NewRequest("GET", "/trips/"+strconv.Itoa(int(suite.trip.ID))+"/tracking/history"+query, nil)
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	var page aggregatePage
+	body, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(body, &page)
+	return resp.StatusCode, page
+}
+
+func (suite *TrackingRollupTestSuite) TestServesAggregates() {
+	t := suite.T()
+	suite.Require().NoError(suite.rollups.RollupRecent())
+
+	status, page := suite.history("?resolution=5m&limit=500")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "5m", page.Resolution)
+	assert.Equal(t, int64(24), page.Total)
+	suite.Require().Len(page.Data, 24)
+
+	// Newest first, each bucket ending at its last position
+	latest := page.Data[0]
+	assert.True(t, latest.BucketStart.Equal(suite.start.Add(115*time.Minute)))
+	assert.Equal(t, 5, latest.PointCount)
+	assert.InDelta(t, -18.0+119*0.01, latest.Latitude, 1e-9)
+	assert.InDelta(t, 67.0, *latest.AvgSpeed, 1e-9)
+	assert.Equal(t, 69.0, *latest.MaxSpeed)
+
+	// Distances add up to the distance driven
+	driven := geo.Distance(-18.0, 31.0, -18.0+119*0.01, 31.0)
+	total := 0.0
+	for _, aggregate := range page.Data {
+		total += aggregate.DistanceKm
+	}
+	assert.InDelta(t, driven, total, 0.01)
+
+	status, page = suite.history("?resolution=1h")
+	assert.Equal(t, 200, status)
+	suite.Require().Len(page.Data, 2)
+	assert.Equal(t, 60, page.Data[1].PointCount)
+	assert.InDelta(t, driven, page.Data[0].DistanceKm+page.Data[1].DistanceKm, 0.01)
+}
+
+func (suite *TrackingRollupTestSuite) TestPaginatesAggregates() {
+	suite.Require().NoError(suite.rollups.RollupTrip(suite.trip.ID))
+
+	_, first := suite.history("?resolution=5m&limit=10")
+	suite.Require().Len(first.Data, 10)
+	suite.Require().NotEmpty(first.NextCursor)
+
+	_, second := suite.history("?resolution=5m&limit=10&cursor=" + first.NextCursor)
+	suite.Require().Len(second.Data, 10)
+	assert.True(suite.T(), second.Data[0].BucketStart.Before(first.Data[9].BucketStart))
+}
+
+func (suite *TrackingRollupTestSuite) TestLateRecordsUpdateTheirBucket() {
+	t := suite.T()
+	suite.Require().NoError(suite.rollups.RollupTrip(suite.trip.ID))
+
+	// A device uploads a position it buffered while offline
+	speed := 90.0
+	testDB.Create(&models.TrackingRecord{
+		TripID:    suite.trip.ID,
+		Latitude:  -18.0 + 10.5*0.01,
+		Longitude: 31.0,
+		Speed:     &speed,
+		Timestamp: suite.start.Add(10*time.Minute + 30*time.Second),
+		Source:    "GPS",
+		Status:    "ACTIVE",
+	})
+	suite.Require().NoError(suite.rollups.RollupTrip(suite.trip.ID))
+
+	var aggregates []models.TrackingAggregate
+	testDB.Where("trip_id = ? AND resolution = ?", suite.trip.ID, "5m").Order("bucket_start").Find(&aggregates)
+	suite.Require().Len(aggregates, 24)
+	assert.Equal(t, 6, aggregates[2].PointCount)
+	assert.Equal(t, 90.0, *aggregates[2].MaxSpeed)
+	assert.Equal(t, 5, aggregates[3].PointCount)
+
+	var hourly int64
+	testDB.Model(&models.TrackingAggregate{}).Where("trip_id = ? AND resolution = ?", suite.trip.ID, "1h").Count(&hourly)
+	assert.Equal(t, int64(2), hourly)
+}
+
+func (suite *TrackingRollupTestSuite) TestInvalidResolution() {
+	status, _ := suite.history("?resolution=10m")
+	assert.Equal(suite.T(), 400, status)
+}
+
+func TestTrackingRollupTestSuite(t *testing.T) {
+	suite.Run(t, new(TrackingRollupTestSuite))
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// stubWeather forecasts rain west of 2°E and snow east of it, every 3 hours
+type stubWeather struct {
+	calls int
+	err   error
+}
+
+func (s *stubWeather) GetCurrentWeather(lat, lng float64) (*services.WeatherCondition, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *stubWeather) GetWeatherForecast(lat, lng float64, hours int) ([]services.WeatherCondition, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	condition := "Rain"
+	if lng >= 2 {
+		condition = "Snow"
+	}
+	var forecast []services.WeatherCondition
+	for h := 0; h <= hours; h += 3 {
+		forecast = append(forecast, services.WeatherCondition{
+			Location:   services.Coordinate{Latitude: lat, Longitude: lng},
+			Condition:  condition,
+			Visibility: 10,
+			Timestamp:  time.Now().Add(time.Duration(h) * time.Hour),
+		})
+	}
+	return forecast, nil
+}
+
+func (s *stubWeather) GetWeatherAlerts(bounds services.BoundingBox) ([]services.WeatherAlert, error) {
+	return nil, nil
+}
+
+func (s *stubWeather) GetRouteWeather(waypoints []services.Coordinate) ([]services.WeatherCondition, error) {
+	return nil, nil
+}
+
+type TrackingWeatherTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	weather *stubWeather
+	carrier models.User
+	shipper models.User
+	trip    models.Trip
+}
+
+func (suite *TrackingWeatherTestSuite) SetupTest() {
+	clearTestDB()
+	suite.weather = &stubWeather{}
+	trackingService = services.NewTrackingService(testDB)
+	trackingService.SetETAProviders()
+	trackingService.SetWeatherService(suite.weather)
+
+	suite.carrier = models.User{Email: "weather-carrier@example.com", Phone: "+15550000321", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.carrier)
+	suite.shipper = models.User{Email: "weather-shipper@example.com", Phone: "+15550000322", Password: "password", Role: "SHIPPER", UnitSystem: "imperial"}
+	testDB.Create(&suite.shipper)
+
+	// About 500 km east along the equator, 8h20m at the default 60 km/h
+	latitude, longitude := 0.0, 0.0
+	suite.trip = models.Trip{
+		UserID:           suite.carrier.ID,
+		Status:           "IN_TRANSIT",
+		DestinationLng:   4.5,
+		CurrentLatitude:  &latitude,
+		CurrentLongitude: &longitude,
+		DepartureDate:    time.Now(),
+		EstimatedArrival: time.Now().Add(8 * time.Hour),
+	}
+	testDB.Create(&suite.trip)
+	testDB.Create(&models.Load{ShipperID: suite.shipper.ID, TripID: suite.trip.ID, BookingReference: "WX-1", Weight: 1000, Status: "IN_TRANSIT"})
+
+	suite.app = fiber.New()
+	suite.app.Get("/trips/:trip_id/tracking/eta", GetTripETA)
+}
+
+func (suite *TrackingWeatherTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *TrackingWeatherTestSuite) eta() map[string]interface{} {
+	req := httptest.NewRequest("GET", fmt.Sprintf("/trips/%d/tracking/eta", suite.trip.ID), nil)
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+	var result map[string]interface{}
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&result))
+	return result
+}
+
+func (suite *TrackingWeatherTestSuite) weatherAlerts() []models.TrackingEvent {
+	var events []models.TrackingEvent
+	testDB.Where("trip_id = ? AND event_type = ?", suite.trip.ID, "WEATHER_ALERT").Find(&events)
+	return events
+}
+
+func (suite *TrackingWeatherTestSuite) TestETASlowedByWeatherAhead() {
+	t := suite.T()
+	cfg := config.GetWeatherConfig()
+
+	estimate, err := trackingService.CalculateETAEstimate(suite.trip.ID)
+	suite.Require().NoError(err)
+
+	// Of 8 points along the route, the 6 reached within the 6 hour lookahead
+	// are forecast: 4 in rain and 2 in snow
+	assert.Equal(t, 6, suite.weather.calls)
+	slowdown := (4*(1/cfg.RainSpeedFactor-1) + 2*(1/cfg.SnowSpeedFactor-1)) / 8
+	base := estimate.DurationMinutes - estimate.WeatherDelayMinutes
+	assert.InDelta(t, 500, base, 5)
+	assert.InDelta(t, base*slowdown, estimate.WeatherDelayMinutes, 0.001)
+	assert.Equal(t, "Snow", estimate.WeatherCondition)
+	assert.WithinDuration(t, time.Now().Add(time.Duration(estimate.DurationMinutes*float64(time.Minute))), estimate.EstimatedArrival, time.Second)
+
+	var status models.TrackingStatus
+	testDB.Where("trip_id = ?", suite.trip.ID).First(&status)
+	assert.InDelta(t, slowdown, status.WeatherSlowdown, 0.0001)
+	assert.Equal(t, "Snow", status.WeatherCondition)
+	assert.NotNil(t, status.WeatherCheckedAt)
+
+	// Snow is alerted once, to the carrier and the shipper
+	alerts := suite.weatherAlerts()
+	suite.Require().Len(alerts, 1)
+	assert.Contains(t, alerts[0].EventData, `"hazard":"SNOW"`)
+	assert.Contains(t, alerts[0].Description, "Snow expected")
+	var recipients []uint
+	testDB.Model(&models.Notification{}).Where("type = ?", "WEATHER_ALERT").Order("user_id").Pluck("user_id", &recipients)
+	assert.ElementsMatch(t, []uint{suite.carrier.ID, suite.shipper.ID}, recipients)
+	var messages []string
+	testDB.Model(&models.Notification{}).Where("type = ?", "WEATHER_ALERT").Order("user_id").Pluck("message", &messages)
+	for i, userID := range recipients {
+		unit := " km ahead"
+		if userID == suite.shipper.ID {
+			unit = " mi ahead"
+		}
+		assert.Contains(t, messages[i], unit)
+	}
+
+	// Until the refresh interval passes, the last forecast is reused
+	result := suite.eta()
+	assert.Equal(t, 6, suite.weather.calls)
+	assert.Equal(t, "Snow", result["weather_condition"])
+	assert.InDelta(t, estimate.WeatherDelayMinutes, result["weather_delay_minutes"], 1)
+
+	// Then forecast again, without alerting the same hazard within the cooldown
+	testDB.Model(&models.TrackingStatus{}).Where("trip_id = ?", suite.trip.ID).
+		Update("weather_checked_at", time.Now().Add(-cfg.RefreshInterval))
+	suite.eta()
+	assert.Equal(t, 12, suite.weather.calls)
+	assert.Len(t, suite.weatherAlerts(), 1)
+}
+
+func (suite *TrackingWeatherTestSuite) TestETAWithoutForecast() {
+	t := suite.T()
+	suite.weather.err = errors.New("timeout")
+
+	estimate, err := trackingService.CalculateETAEstimate(suite.trip.ID)
+	suite.Require().NoError(err)
+	assert.Zero(t, estimate.WeatherDelayMinutes)
+	assert.Empty(t, estimate.WeatherCondition)
+	assert.Empty(t, suite.weatherAlerts())
+
+	// Retried on the next estimate
+	_, err = trackingService.CalculateETAEstimate(suite.trip.ID)
+	suite.Require().NoError(err)
+	assert.Equal(t, 2*6, suite.weather.calls)
+	_, present := suite.eta()["weather_condition"]
+	assert.False(t, present)
+}
+
+func TestTrackingWeatherTestSuite(t *testing.T) {
+	suite.Run(t, new(TrackingWeatherTestSuite))
+}
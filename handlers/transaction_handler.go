@@ -6,6 +6,13 @@ import (
 	"triplink/backend/models"
 )
 
+// CreateTransaction @Summary Create a transaction
+// @Tags transactions
+// @Accept json
+// @Produce json
+// @Param transaction body models.Transaction true "Transaction"
+// @Success 200 {object} models.Transaction
+// @Router /transactions [post]
 func CreateTransaction(c *fiber.Ctx) error {
 	var transaction models.Transaction
 
@@ -18,6 +25,11 @@ func CreateTransaction(c *fiber.Ctx) error {
 	return c.JSON(transaction)
 }
 
+// GetTransactions @Summary Get transactions
+// @Tags transactions
+// @Produce json
+// @Success 200 {array} models.Transaction
+// @Router /transactions [get]
 func GetTransactions(c *fiber.Ctx) error {
 	var transactions []models.Transaction
 
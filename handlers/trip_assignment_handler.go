@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+	"triplink/backend/apierror"
+	"triplink/backend/database"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var tripAssignmentService = services.NewTripAssignmentService(database.DB)
+
+// driverTrip returns the trip of the request when the current user is its
+// carrier, one of its organization's dispatchers or a driver assigned to it
+// now, with the user's ID, or the status and message to fail the request with.
+// Trips outside the request's tenant scope aren't found.
+func driverTrip(c *fiber.Ctx) (*models.Trip, uint, int, string) {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return nil, 0, 401, "Unauthorized"
+	}
+
+	tripID, err := strconv.ParseUint(c.Params("trip_id"), 10, 32)
+	if err != nil {
+		return nil, 0, 400, "Invalid trip ID"
+	}
+
+	var trip models.Trip
+	if err := database.DB.WithContext(c.UserContext()).First(&trip, uint(tripID)).Error; err != nil {
+		return nil, 0, 404, "Trip not found"
+	}
+	if trip.UserID != uint(userID) && !dispatchesTrip(&trip, uint(userID)) &&
+		!tripAssignmentService.IsAssigned(trip.ID, uint(userID), time.Now()) {
+		return nil, 0, 403, "Only the trip's carrier and assigned drivers can do this"
+	}
+	return &trip, uint(userID), 0, ""
+}
+
+// assignedDriverID returns the current user when they are a driver assigned
+// to the trip now, so their location updates are attributed to them. Users
+// who neither dispatch the trip nor are assigned to it get a 403 status;
+// requests without a user, e.g. from telematics, are let through.
+func assignedDriverID(c *fiber.Ctx, trip *models.Trip) (*uint, int) {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return nil, 0
+	}
+	if tripAssignmentService.IsAssigned(trip.ID, uint(userID), time.Now()) {
+		driverID := uint(userID)
+		return &driverID, 0
+	}
+	if trip.UserID != uint(userID) && !dispatchesTrip(trip, uint(userID)) {
+		return nil, 403
+	}
+	return nil, 0
+}
+
+// AssignTripDriver @Summary Assign a driver to a trip
+// @Description Assign a driver to one of the current carrier's trips for a period, starting now by default and open-ended unless ends_at is given. With reassign set, the trip's other assignments end when this one starts. Drivers on time off, off shift or assigned to another trip at the same time are rejected with a 409 status.
+// @Tags trips
+// @Accept json
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param assignment body services.TripAssignmentRequest true "Assignment"
+// @Success 201 {object} models.TripAssignment
+// @Router /trips/{trip_id}/assignments [post]
+func AssignTripDriver(c *fiber.Ctx) error {
+	trip, userID, status, message := carrierTrip(c)
+	if trip == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	var req services.TripAssignmentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	assignment, err := tripAssignmentService.AssignDriver(trip.ID, userID, req)
+	if err != nil {
+		var conflict *services.ScheduleConflictError
+		if errors.As(err, &conflict) {
+			return apierror.Respond(c, conflict)
+		}
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(assignment)
+}
+
+// GetTripAssignments @Summary Get a trip's driver assignments
+// @Description Get the drivers assigned to a trip, past and future, in the order their assignments start. Available to the trip's carrier and its assigned drivers.
+// @Tags trips
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Success 200 {array} models.TripAssignment
+// @Router /trips/{trip_id}/assignments [get]
+func GetTripAssignments(c *fiber.Ctx) error {
+	trip, _, status, message := driverTrip(c)
+	if trip == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	assignments, err := tripAssignmentService.GetTripAssignments(trip.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch trip assignments",
+		})
+	}
+
+	return c.JSON(assignments)
+}
+
+// UpdateTripAssignment @Summary Update a driver assignment
+// @Description Change the period or notes of a driver's assignment to one of the current carrier's trips. An omitted ends_at makes the assignment open-ended.
+// @Tags trips
+// @Accept json
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param assignment_id path int true "Assignment ID"
+// @Param assignment body services.TripAssignmentRequest true "Assignment"
+// @Success 200 {object} models.TripAssignment
+// @Router /trips/{trip_id}/assignments/{assignment_id} [put]
+func UpdateTripAssignment(c *fiber.Ctx) error {
+	trip, _, status, message := carrierTrip(c)
+	if trip == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	assignmentID, err := strconv.ParseUint(c.Params("assignment_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid assignment ID",
+		})
+	}
+
+	var req services.TripAssignmentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	assignment, err := tripAssignmentService.UpdateAssignment(trip.ID, uint(assignmentID), req)
+	if err != nil {
+		var conflict *services.ScheduleConflictError
+		if errors.As(err, &conflict) {
+			return apierror.Respond(c, conflict)
+		}
+		status := 400
+		if err == services.ErrTripAssignmentNotFound {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(assignment)
+}
+
+// EndTripAssignment @Summary Unassign a driver from a trip
+// @Description End a driver's assignment to one of the current carrier's trips now. Assignments that haven't started are removed.
+// @Tags trips
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param assignment_id path int true "Assignment ID"
+// @Success 200 {object} models.TripAssignment
+// @Router /trips/{trip_id}/assignments/{assignment_id} [delete]
+func EndTripAssignment(c *fiber.Ctx) error {
+	trip, _, status, message := carrierTrip(c)
+	if trip == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	assignmentID, err := strconv.ParseUint(c.Params("assignment_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid assignment ID",
+		})
+	}
+
+	assignment, err := tripAssignmentService.EndAssignment(trip.ID, uint(assignmentID))
+	if err != nil {
+		status := 500
+		if err == services.ErrTripAssignmentNotFound {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(assignment)
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+)
+
+type TripAssignmentHandlerTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	carrier models.User
+	driver  models.User
+	relief  models.User
+	trip    models.Trip
+}
+
+func (suite *TripAssignmentHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	tripAssignmentService = services.NewTripAssignmentService(testDB)
+	trackingService = services.NewTrackingService(testDB)
+	organizationService = services.NewOrganizationService(testDB)
+	workspaceService = services.NewWorkspaceService(testDB)
+
+	suite.carrier = models.User{Email: "dispatch@example.com", Phone: "+15550000010", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.carrier)
+	suite.driver = models.User{Email: "driver@example.com", Phone: "+15550000011", Password: "password", Role: "DRIVER"}
+	testDB.Create(&suite.driver)
+	suite.relief = models.User{Email: "relief@example.com", Phone: "+15550000012", Password: "password", Role: "DRIVER"}
+	testDB.Create(&suite.relief)
+
+	suite.trip = models.Trip{
+		UserID:             suite.carrier.ID,
+		OriginAddress:      "Harare",
+		DestinationAddress: "Bulawayo",
+		Status:             "IN_TRANSIT",
+		DepartureDate:      time.Now().Add(-time.Hour),
+		EstimatedArrival:   time.Now().Add(6 * time.Hour),
+		TrackingEnabled:    true,
+	}
+	testDB.Create(&suite.trip)
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Post("/trips/:trip_id/assignments", AssignTripDriver)
+	suite.app.Get("/trips/:trip_id/assignments", GetTripAssignments)
+	suite.app.Put("/trips/:trip_id/assignments/:assignment_id", UpdateTripAssignment)
+	suite.app.Delete("/trips/:trip_id/assignments/:assignment_id", EndTripAssignment)
+	suite.app.Post("/trips/:trip_id/tracking/location", UpdateTripLocation)
+	suite.app.Get("/users/:user_id/tracking/carrier-view", GetCarrierTrackingView)
+}
+
+func (suite *TripAssignmentHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *TripAssignmentHandlerTestSuite) request(method, path string, userID uint, body interface{}, out interface{}) int {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func (suite *TripAssignmentHandlerTestSuite) assignmentsPath() string {
+	return fmt.Sprintf("/trips/%d/assignments", suite.trip.ID)
+}
+
+func (suite *TripAssignmentHandlerTestSuite) TestAssignAndReassign() {
+	var first models.TripAssignment
+	status := suite.request("POST", suite.assignmentsPath(), suite.carrier.ID, fiber.Map{"driver_id": suite.driver.ID, "notes": "First leg"}, &first)
+	suite.Equal(201, status)
+	suite.Equal(suite.driver.ID, first.DriverID)
+	suite.Equal(suite.carrier.ID, first.AssignedBy)
+	suite.Nil(first.EndsAt)
+	if suite.NotNil(first.Driver) {
+		suite.Equal("driver@example.com", first.Driver.Email)
+	}
+
+	// Only the trip's carrier dispatches its drivers
+	status = suite.request("POST", suite.assignmentsPath(), suite.driver.ID, fiber.Map{"driver_id": suite.relief.ID}, nil)
+	suite.Equal(403, status)
+
+	// Overlapping assignments of a driver and non-drivers are rejected
+	status = suite.request("POST", suite.assignmentsPath(), suite.carrier.ID, fiber.Map{"driver_id": suite.driver.ID}, nil)
+	suite.Equal(400, status)
+	shipper := models.User{Email: "shipper@example.com", Phone: "+15550000013", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&shipper)
+	status = suite.request("POST", suite.assignmentsPath(), suite.carrier.ID, fiber.Map{"driver_id": shipper.ID}, nil)
+	suite.Equal(400, status)
+
+	// Reassigning hands the trip over to the relief driver
+	var second models.TripAssignment
+	status = suite.request("POST", suite.assignmentsPath(), suite.carrier.ID, fiber.Map{"driver_id": suite.relief.ID, "reassign": true}, &second)
+	suite.Equal(201, status)
+
+	var assignments []models.TripAssignment
+	status = suite.request("GET", suite.assignmentsPath(), suite.relief.ID, nil, &assignments)
+	suite.Equal(200, status)
+	suite.Len(assignments, 2)
+	suite.NotNil(assignments[0].EndsAt)
+	suite.Nil(assignments[1].EndsAt)
+
+	// The first driver is no longer assigned
+	status = suite.request("GET", suite.assignmentsPath(), suite.driver.ID, nil, nil)
+	suite.Equal(403, status)
+
+	// Scheduling the relief driver's assignment to end
+	endsAt := time.Now().Add(2 * time.Hour)
+	var updated models.TripAssignment
+	status = suite.request("PUT", fmt.Sprintf("%s/%d", suite.assignmentsPath(), second.ID), suite.carrier.ID, fiber.Map{"ends_at": endsAt}, &updated)
+	suite.Equal(200, status)
+	if suite.NotNil(updated.EndsAt) {
+		suite.WithinDuration(endsAt, *updated.EndsAt, time.Second)
+	}
+	status = suite.request("PUT", fmt.Sprintf("%s/%d", suite.assignmentsPath(), second.ID), suite.carrier.ID, fiber.Map{"driver_id": suite.driver.ID}, nil)
+	suite.Equal(400, status)
+
+	var ended models.TripAssignment
+	status = suite.request("DELETE", fmt.Sprintf("%s/%d", suite.assignmentsPath(), second.ID), suite.carrier.ID, nil, &ended)
+	suite.Equal(200, status)
+	suite.NotNil(ended.EndsAt)
+	suite.False(tripAssignmentService.IsAssigned(suite.trip.ID, suite.relief.ID, time.Now()))
+
+	status = suite.request("DELETE", fmt.Sprintf("%s/999", suite.assignmentsPath()), suite.carrier.ID, nil, nil)
+	suite.Equal(404, status)
+}
+
+func (suite *TripAssignmentHandlerTestSuite) TestLocationUpdatesAttributedToDriver() {
+	location := fiber.Map{"latitude": -17.83, "longitude": 31.05, "source": "GPS"}
+
+	// Drivers can't post locations of trips they aren't assigned to
+	status := suite.request("POST", fmt.Sprintf("/trips/%d/tracking/location", suite.trip.ID), suite.driver.ID, location, nil)
+	suite.Equal(403, status)
+
+	_, err := tripAssignmentService.AssignDriver(suite.trip.ID, suite.carrier.ID, services.TripAssignmentRequest{DriverID: suite.driver.ID})
+	suite.Require().NoError(err)
+	status = suite.request("POST", fmt.Sprintf("/trips/%d/tracking/location", suite.trip.ID), suite.driver.ID, location, nil)
+	suite.Equal(200, status)
+	status = suite.request("POST", fmt.Sprintf("/trips/%d/tracking/location", suite.trip.ID), suite.carrier.ID, location, nil)
+	suite.Equal(200, status)
+
+	var records []models.TrackingRecord
+	testDB.Where("trip_id = ?", suite.trip.ID).Order("id ASC").Find(&records)
+	suite.Require().Len(records, 2)
+	if suite.NotNil(records[0].DriverID) {
+		suite.Equal(suite.driver.ID, *records[0].DriverID)
+	}
+	suite.Nil(records[1].DriverID)
+}
+
+func (suite *TripAssignmentHandlerTestSuite) TestCarrierViewShowsDriversAssignedTrips() {
+	other := models.Trip{
+		UserID:             suite.carrier.ID,
+		OriginAddress:      "Mutare",
+		DestinationAddress: "Gweru",
+		Status:             "PLANNED",
+		DepartureDate:      time.Now().Add(24 * time.Hour),
+		EstimatedArrival:   time.Now().Add(30 * time.Hour),
+	}
+	testDB.Create(&other)
+	_, err := tripAssignmentService.AssignDriver(suite.trip.ID, suite.carrier.ID, services.TripAssignmentRequest{DriverID: suite.driver.ID})
+	suite.Require().NoError(err)
+	// Assignments that haven't started aren't shown yet
+	startsAt := time.Now().Add(24 * time.Hour)
+	_, err = tripAssignmentService.AssignDriver(other.ID, suite.carrier.ID, services.TripAssignmentRequest{DriverID: suite.driver.ID, StartsAt: &startsAt})
+	suite.Require().NoError(err)
+
+	tripIDs := func(userID uint) []uint {
+		var view struct {
+			Trips []map[string]interface{} `json:"tracking_data"`
+		}
+		status := suite.request("GET", fmt.Sprintf("/users/%d/tracking/carrier-view", userID), userID, nil, &view)
+		suite.Equal(200, status)
+		var ids []uint
+		for _, trip := range view.Trips {
+			ids = append(ids, uint(trip["trip_id"].(float64)))
+		}
+		return ids
+	}
+
+	suite.ElementsMatch([]uint{suite.trip.ID, other.ID}, tripIDs(suite.carrier.ID))
+	suite.Equal([]uint{suite.trip.ID}, tripIDs(suite.driver.ID))
+	suite.Empty(tripIDs(suite.relief.ID))
+}
+
+func TestTripAssignmentHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(TripAssignmentHandlerTestSuite))
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TripAutoStatusTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	carrier models.User
+	trip    models.Trip
+	start   time.Time
+}
+
+func (suite *TripAutoStatusTestSuite) SetupTest() {
+	clearTestDB()
+	trackingService = services.NewTrackingService(testDB)
+	tripAssignmentService = services.NewTripAssignmentService(testDB)
+
+	suite.carrier = models.User{Email: "auto-status-carrier@example.com", Phone: "+15550000534", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.carrier)
+
+	// About 11 km east along the equator
+	suite.start = time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Second)
+	suite.trip = models.Trip{
+		UserID:           suite.carrier.ID,
+		Status:           "PLANNED",
+		DestinationLng:   0.1,
+		TrackingEnabled:  true,
+		DepartureDate:    suite.start,
+		EstimatedArrival: suite.start.Add(time.Hour),
+	}
+	testDB.Create(&suite.trip)
+
+	suite.app = fiber.New()
+	suite.app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", float64(suite.carrier.ID))
+		return c.Next()
+	})
+	suite.app.Post("/trips/:trip_id/tracking/location", UpdateTripLocation)
+	suite.app.Get("/trips/:trip_id/status-suggestions", GetTripStatusSuggestions)
+	suite.app.Post("/trips/:trip_id/status-suggestions/:suggestion_id/confirm", ConfirmTripStatusSuggestion)
+	suite.app.Post("/trips/:trip_id/status-suggestions/:suggestion_id/dismiss", DismissTripStatusSuggestion)
+}
+
+func (suite *TripAutoStatusTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *TripAutoStatusTestSuite) request(method, path string, body interface{}) (int, fiber.Map) {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, fmt.Sprintf("/trips/%d/%s", suite.trip.ID, path), bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	var result fiber.Map
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+func (suite *TripAutoStatusTestSuite) locate(longitude float64, at time.Duration, speed *float64) {
+	update := fiber.Map{"latitude": 0, "longitude": longitude, "timestamp": suite.start.Add(at)}
+	if speed != nil {
+		update["speed"] = *speed
+	}
+	status, _ := suite.request("POST", "tracking/location", update)
+	suite.Require().Equal(200, status)
+}
+
+func (suite *TripAutoStatusTestSuite) status() string {
+	var trip models.Trip
+	suite.Require().NoError(testDB.First(&trip, suite.trip.ID).Error)
+	return trip.Status
+}
+
+func (suite *TripAutoStatusTestSuite) events(eventType string) []models.TrackingEvent {
+	var events []models.TrackingEvent
+	testDB.Where("trip_id = ? AND event_type = ?", suite.trip.ID, eventType).Order("id").Find(&events)
+	return events
+}
+
+func (suite *TripAutoStatusTestSuite) suggestions() []models.TripStatusSuggestion {
+	resp, err := suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/trips/%d/status-suggestions", suite.trip.ID), nil), -1)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+	var suggestions []models.TripStatusSuggestion
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&suggestions))
+	return suggestions
+}
+
+func (suite *TripAutoStatusTestSuite) TestActivatesOnMovementAfterDeparture() {
+	t := suite.T()
+	speed := 40.0
+
+	// Moving before the departure time
+	suite.locate(0, -10*time.Minute, &speed)
+	assert.Equal(t, "PLANNED", suite.status())
+
+	// Stationary after it
+	suite.locate(0, time.Minute, nil)
+	assert.Equal(t, "PLANNED", suite.status())
+
+	suite.locate(0.01, 2*time.Minute, nil)
+	assert.Equal(t, "ACTIVE", suite.status())
+	events := suite.events("AUTO_STATUS_CHANGE")
+	suite.Require().Len(events, 1)
+	assert.Contains(t, events[0].EventData, `"to":"ACTIVE"`)
+}
+
+func (suite *TripAutoStatusTestSuite) TestArrivalSuggestsCompletion() {
+	t := suite.T()
+	testDB.Model(&suite.trip).Update("status", "IN_TRANSIT")
+
+	suite.locate(0.05, 0, nil)
+	assert.Equal(t, "IN_TRANSIT", suite.status())
+	suite.locate(0.1, 10*time.Minute, nil)
+	assert.Equal(t, "AT_DELIVERY", suite.status())
+	assert.Contains(t, suite.events("AUTO_STATUS_CHANGE")[0].EventData, `"to":"AT_DELIVERY"`)
+
+	// Not at the destination for the whole dwell time yet
+	suite.locate(0.1, 30*time.Minute, nil)
+	assert.Empty(t, suite.suggestions())
+
+	suite.locate(0.1, 45*time.Minute, nil)
+	suite.locate(0.1, 50*time.Minute, nil)
+	suggestions := suite.suggestions()
+	suite.Require().Len(suggestions, 1)
+	assert.Equal(t, "COMPLETED", suggestions[0].Status)
+	assert.Equal(t, services.StatusSuggestionPending, suggestions[0].State)
+	assert.Equal(t, "AT_DELIVERY", suite.status())
+	assert.Len(t, suite.events("STATUS_SUGGESTED"), 1)
+	var notified int64
+	testDB.Model(&models.Notification{}).Where("user_id = ? AND type = ?", suite.carrier.ID, "TRIP_STATUS_SUGGESTION").Count(&notified)
+	assert.Equal(t, int64(1), notified)
+
+	// Dismissed suggestions aren't made again for the same arrival
+	status, result := suite.request("POST", fmt.Sprintf("status-suggestions/%d/dismiss", suggestions[0].ID), nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, services.StatusSuggestionDismissed, result["state"])
+	suite.locate(0.1, time.Hour, nil)
+	assert.Len(t, suite.suggestions(), 1)
+	assert.Equal(t, "AT_DELIVERY", suite.status())
+}
+
+func (suite *TripAutoStatusTestSuite) TestConfirmSuggestion() {
+	t := suite.T()
+	testDB.Model(&suite.trip).Update("status", "AT_DELIVERY")
+	suggestion := models.TripStatusSuggestion{TripID: suite.trip.ID, Status: "COMPLETED", State: services.StatusSuggestionPending, SuggestedAt: time.Now()}
+	testDB.Create(&suggestion)
+
+	status, result := suite.request("POST", fmt.Sprintf("status-suggestions/%d/confirm", suggestion.ID), nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, services.StatusSuggestionConfirmed, result["state"])
+	assert.Equal(t, float64(suite.carrier.ID), result["resolved_by"])
+	assert.Equal(t, "COMPLETED", suite.status())
+
+	status, _ = suite.request("POST", fmt.Sprintf("status-suggestions/%d/confirm", suggestion.ID), nil)
+	assert.Equal(t, 409, status)
+	status, _ = suite.request("POST", fmt.Sprintf("status-suggestions/%d/dismiss", suggestion.ID+1), nil)
+	assert.Equal(t, 404, status)
+
+	// Only the carrier resolves suggestions
+	other := models.Trip{UserID: suite.carrier.ID + 1000, Status: "AT_DELIVERY"}
+	testDB.Create(&other)
+	resp, err := suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/trips/%d/status-suggestions", other.ID), nil), -1)
+	suite.Require().NoError(err)
+	assert.Equal(t, 403, resp.StatusCode)
+}
+
+func TestTripAutoStatusTestSuite(t *testing.T) {
+	suite.Run(t, new(TripAutoStatusTestSuite))
+}
@@ -1,39 +1,482 @@
 package handlers
 
 import (
+	"log"
+	"strconv"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
+	"triplink/backend/apierror"
 	"triplink/backend/database"
 	"triplink/backend/models"
+	"triplink/backend/services"
 )
 
+var tripSearchService = services.NewTripSearchService(database.DB)
+
+// CreateTrip @Summary Create a trip
+// @Description Create a trip for the current carrier, in the carrier organization they dispatch for. Origin and destination can be given as saved locations with origin_location_id and destination_location_id, and a driver to assign from the departure with driver_id. The route between them is planned through HERE, falling back to Google Maps. Vehicles and drivers booked on another trip at the same time, and drivers on time off or off shift, are rejected with a 409 status; admins can book a vehicle anyway with override_conflicts.
+// @Tags trips
+// @Accept json
+// @Produce json
+// @Param trip body models.Trip true "Trip"
+// @Param override_conflicts query bool false "Book the vehicle even if it's on another trip at the same time (admins only)"
+// @Success 200 {object} models.Trip
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /trips [post]
 func CreateTrip(c *fiber.Ctx) error {
 	var trip models.Trip
+	if err := decodeBody(c, &trip); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	// Addresses from the carrier's address book, and the driver to assign.
+	// Coordinates of 0 are on the equator or prime meridian, not missing.
+	var locations struct {
+		OriginLat             *float64 `json:"origin_lat" validate:"omitempty,latitude"`
+		OriginLng             *float64 `json:"origin_lng" validate:"omitempty,longitude"`
+		DestinationLat        *float64 `json:"destination_lat" validate:"omitempty,latitude"`
+		DestinationLng        *float64 `json:"destination_lng" validate:"omitempty,longitude"`
+		OriginLocationID      uint     `json:"origin_location_id"`
+		DestinationLocationID uint     `json:"destination_location_id"`
+		DriverID              uint     `json:"driver_id"`
+	}
+	if err := parseBody(c, &locations); err != nil {
+		return invalidRequest(c, err)
+	}
 
-	if err := c.BodyParser(&trip); err != nil {
-		return err
+	override, status := overrideVehicleConflicts(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": "Only admins can override vehicle conflicts",
+		})
 	}
 
 	userID := c.Locals("user_id").(float64)
 	trip.UserID = uint(userID)
 
+	// Trips belong to the carrier organization the user dispatches for
+	organizationID, err := organizationService.ResolveOrganization(trip.UserID, services.OrganizationCarrier, trip.OrganizationID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	trip.OrganizationID = organizationID
+
+	if err := savedLocationService.ApplyToTrip(trip.UserID, &trip, locations.OriginLocationID, locations.DestinationLocationID); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err := services.GeocodeTrip(addressGeocoder, &trip); err != nil {
+		log.Printf("Failed to geocode trip of user %d: %v", trip.UserID, err)
+	}
+	services.LocalizeTrip(&trip)
+
+	if vehicleComplianceConfig.BlockNonCompliantTrips {
+		if err := vehicleComplianceService.ValidateVehicleForTrip(&trip); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	// The vehicle and driver can't be on another trip at the same time
+	tripEnd := services.TripEnd(&trip)
+	if !override {
+		if err := vehicleBookingService.CheckVehicle(trip.VehicleID, 0, trip.DepartureDate, tripEnd); err != nil {
+			return apierror.Respond(c, err)
+		}
+	}
+	if locations.DriverID != 0 {
+		if trip.DepartureDate.IsZero() {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "departure_date is required to assign a driver",
+			})
+		}
+		if err := tripAssignmentService.ValidateDriver(locations.DriverID); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if err := driverAvailabilityService.CheckDriver(locations.DriverID, 0, trip.DepartureDate, tripEnd); err != nil {
+			return apierror.Respond(c, err)
+		}
+	}
+
+	// Delays are measured from the arrival the trip is created with
+	trip.ScheduledArrival = nil
+	if !trip.EstimatedArrival.IsZero() {
+		scheduled := trip.EstimatedArrival
+		trip.ScheduledArrival = &scheduled
+	}
+
 	database.DB.Create(&trip)
 
+	if locations.DriverID != 0 {
+		departure := trip.DepartureDate
+		if _, err := tripAssignmentService.AssignDriver(trip.ID, trip.UserID, services.TripAssignmentRequest{
+			DriverID: locations.DriverID,
+			StartsAt: &departure,
+		}); err != nil {
+			// The driver was booked on another trip meanwhile
+			database.DB.Unscoped().Delete(&trip)
+			return apierror.Respond(c, err)
+		}
+	}
+
+	// Storing the planned route prices its tolls. Without a route they are
+	// priced between the origin and destination.
+	if err := trackingService.FetchPlannedRoute(trip.ID); err != nil {
+		log.Printf("Failed to plan route of trip %d: %v", trip.ID, err)
+		if tolls := services.GetTripTollService(); tolls != nil {
+			if _, err := tolls.CalculateTrip(trip.ID); err != nil {
+				log.Printf("Failed to calculate tolls of trip %d: %v", trip.ID, err)
+			}
+		}
+	}
+	database.DB.First(&trip, trip.ID)
+
+	return c.JSON(trip)
+}
+
+// TripUpdateRequest changes the plan of a trip. Fields left out are kept.
+type TripUpdateRequest struct {
+	VehicleID           *uint      `json:"vehicle_id"`
+	DepartureDate       *time.Time `json:"departure_date"`
+	EstimatedArrival    *time.Time `json:"estimated_arrival"`
+	TotalCapacityWeight *float64   `json:"total_capacity_weight" validate:"omitempty,gte=0"`
+	TotalCapacityVolume *float64   `json:"total_capacity_volume" validate:"omitempty,gte=0"`
+	BasePrice           *float64   `json:"base_price" validate:"omitempty,gte=0"`
+	PricePerKg          *float64   `json:"price_per_kg" validate:"omitempty,gte=0"`
+	PricePerCubicMeter  *float64   `json:"price_per_cubic_meter" validate:"omitempty,gte=0"`
+	Notes               *string    `json:"notes"`
+	IsPublic            *bool      `json:"is_public"`
+}
+
+// overrideVehicleConflicts reports whether the request asks to book a
+// vehicle even if it's on another trip at the same time, which only admins
+// can, or the status to fail the request with
+func overrideVehicleConflicts(c *fiber.Ctx) (bool, int) {
+	if !c.QueryBool("override_conflicts") {
+		return false, 0
+	}
+	if role, _ := c.Locals("role").(string); role != "ADMIN" {
+		return false, 403
+	}
+	return true, 0
+}
+
+// UpdateTrip @Summary Update a trip
+// @Description Change the vehicle, schedule, capacity, prices or notes of a trip of the current carrier. Changing the estimated arrival replans the trip, so delays are measured from the new arrival. Trips without a planned route get one. A vehicle booked on another trip at the same time is rejected with VEHICLE_DOUBLE_BOOKED; admins can book it anyway with override_conflicts.
+// @Tags trips
+// @Accept json
+// @Produce json
+// @Param id path int true "Trip ID"
+// @Param trip body TripUpdateRequest true "Changes"
+// @Param override_conflicts query bool false "Book the vehicle even if it's on another trip at the same time (admins only)"
+// @Success 200 {object} models.Trip
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /trips/{id} [put]
+func UpdateTrip(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var trip models.Trip
+	if err := database.DB.First(&trip, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip not found",
+		})
+	}
+	role, _ := c.Locals("role").(string)
+	if trip.UserID != uint(userID) && !dispatchesTrip(&trip, uint(userID)) && role != "ADMIN" {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "Only the trip's carrier can change it",
+		})
+	}
+
+	override, status := overrideVehicleConflicts(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": "Only admins can override vehicle conflicts",
+		})
+	}
+
+	var req TripUpdateRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+	if trip.Status == "COMPLETED" || trip.Status == "CANCELLED" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "The trip is " + trip.Status + " and can't be changed",
+		})
+	}
+
+	updates := map[string]interface{}{}
+	if req.VehicleID != nil {
+		trip.VehicleID = *req.VehicleID
+		updates["vehicle_id"] = trip.VehicleID
+	}
+	if req.DepartureDate != nil {
+		trip.DepartureDate = req.DepartureDate.UTC()
+		updates["departure_date"] = trip.DepartureDate
+	}
+	if req.EstimatedArrival != nil {
+		trip.EstimatedArrival = req.EstimatedArrival.UTC()
+		scheduled := trip.EstimatedArrival
+		trip.ScheduledArrival = &scheduled
+		updates["estimated_arrival"] = trip.EstimatedArrival
+		updates["scheduled_arrival"] = scheduled
+	}
+	if req.TotalCapacityWeight != nil {
+		trip.TotalCapacityWeight = *req.TotalCapacityWeight
+		updates["total_capacity_weight"] = trip.TotalCapacityWeight
+	}
+	if req.TotalCapacityVolume != nil {
+		trip.TotalCapacityVolume = *req.TotalCapacityVolume
+		updates["total_capacity_volume"] = trip.TotalCapacityVolume
+	}
+	if req.BasePrice != nil {
+		updates["base_price"] = *req.BasePrice
+	}
+	if req.PricePerKg != nil {
+		updates["price_per_kg"] = *req.PricePerKg
+	}
+	if req.PricePerCubicMeter != nil {
+		updates["price_per_cubic_meter"] = *req.PricePerCubicMeter
+	}
+	if req.Notes != nil {
+		updates["notes"] = *req.Notes
+	}
+	if req.IsPublic != nil {
+		updates["is_public"] = *req.IsPublic
+	}
+
+	if !trip.EstimatedArrival.IsZero() && !trip.EstimatedArrival.After(trip.DepartureDate) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "estimated_arrival must be after departure_date",
+		})
+	}
+	if trip.TotalCapacityWeight < trip.UsedWeight || trip.TotalCapacityVolume < trip.UsedVolume {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "The capacity can't be less than what's booked on the trip",
+		})
+	}
+
+	rebooked := req.VehicleID != nil || req.DepartureDate != nil || req.EstimatedArrival != nil
+	if rebooked && vehicleComplianceConfig.BlockNonCompliantTrips {
+		if err := vehicleComplianceService.ValidateVehicleForTrip(&trip); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+	if rebooked && !override {
+		if err := vehicleBookingService.CheckVehicle(trip.VehicleID, trip.ID, trip.DepartureDate, services.TripEnd(&trip)); err != nil {
+			return apierror.Respond(c, err)
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := database.DB.Model(&models.Trip{}).Where("id = ?", trip.ID).Updates(updates).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Could not update trip",
+			})
+		}
+	}
+
+	// Plan the route of trips that couldn't be planned when they were created
+	if trip.PlannedRoutePolyline == "" {
+		if err := trackingService.FetchPlannedRoute(trip.ID); err != nil {
+			log.Printf("Failed to plan route of trip %d: %v", trip.ID, err)
+		}
+	}
+	if err := database.DB.First(&trip, trip.ID).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch trip",
+		})
+	}
+
 	return c.JSON(trip)
 }
 
+// GetTrips @Summary Get trips
+// @Description Get the trips the current user can see: their own and their organizations', those they drive and those carrying their loads
+// @Tags trips
+// @Produce json
+// @Success 200 {array} models.Trip
+// @Router /trips [get]
 func GetTrips(c *fiber.Ctx) error {
-	var trips []models.Trip
+	db, ok := tenantDB(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
 
-	database.DB.Find(&trips)
+	var trips []models.Trip
+	if err := db.Find(&trips).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch trips",
+		})
+	}
 
 	return c.JSON(trips)
 }
 
+// GetTrip @Summary Get a trip
+// @Description Get a trip the current user can see. Other organizations' trips are not found.
+// @Tags trips
+// @Produce json
+// @Param id path int true "Trip ID"
+// @Success 200 {object} models.Trip
+// @Router /trips/{id} [get]
 func GetTrip(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var trip models.Trip
+	db, ok := tenantDB(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
 
-	database.DB.First(&trip, id)
+	var trip models.Trip
+	if err := db.First(&trip, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip not found",
+		})
+	}
 
 	return c.JSON(trip)
 }
+
+// SearchTrips @Summary Search public trips
+// @Description Search planned and active public trips by text, origin/destination radius, departure window, vehicle type, remaining capacity and price
+// @Tags trips
+// @Produce json
+// @Param q query string false "Text matched against addresses, cities, countries and notes"
+// @Param origin_lat query number false "Origin latitude"
+// @Param origin_lng query number false "Origin longitude"
+// @Param origin_radius_km query number false "Origin search radius in km (default 50)"
+// @Param destination_lat query number false "Destination latitude"
+// @Param destination_lng query number false "Destination longitude"
+// @Param destination_radius_km query number false "Destination search radius in km (default 50)"
+// @Param departure_from query string false "Earliest departure (RFC3339 or YYYY-MM-DD)"
+// @Param departure_to query string false "Latest departure (RFC3339 or YYYY-MM-DD)"
+// @Param vehicle_type query string false "Vehicle type"
+// @Param min_weight query number false "Minimum remaining weight capacity in kg"
+// @Param min_volume query number false "Minimum remaining volume capacity in m3"
+// @Param max_price query number false "Maximum estimated price for min_weight and min_volume"
+// @Param max_price_per_kg query number false "Maximum price per kg"
+// @Param sort query string false "Sort by departure_date (default), price or distance"
+// @Param limit query int false "Number of trips to return (default 20)"
+// @Param offset query int false "Number of trips to skip (default 0)"
+// @Success 200 {object} map[string]interface{}
+// @Router /trips/search [get]
+func SearchTrips(c *fiber.Ctx) error {
+	params := services.TripSearchParams{
+		Query:       c.Query("q"),
+		VehicleType: c.Query("vehicle_type"),
+		SortBy:      c.Query("sort"),
+		Limit:       c.QueryInt("limit", 20),
+		Offset:      c.QueryInt("offset", 0),
+	}
+	if params.Limit > maxPageLimit {
+		params.Limit = maxPageLimit
+	}
+
+	floats := []struct {
+		name   string
+		target *float64
+	}{
+		{"origin_radius_km", &params.OriginRadiusKm},
+		{"destination_radius_km", &params.DestinationRadiusKm},
+		{"min_weight", &params.MinWeight},
+		{"min_volume", &params.MinVolume},
+		{"max_price", &params.MaxPrice},
+		{"max_price_per_kg", &params.MaxPricePerKg},
+	}
+	for _, f := range floats {
+		if value := c.Query(f.name); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Invalid " + f.name,
+				})
+			}
+			*f.target = parsed
+		}
+	}
+
+	coordinates := []struct {
+		name   string
+		target **float64
+	}{
+		{"origin_lat", &params.OriginLat},
+		{"origin_lng", &params.OriginLng},
+		{"destination_lat", &params.DestinationLat},
+		{"destination_lng", &params.DestinationLng},
+	}
+	for _, coordinate := range coordinates {
+		if value := c.Query(coordinate.name); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Invalid " + coordinate.name,
+				})
+			}
+			*coordinate.target = &parsed
+		}
+	}
+
+	dates := []struct {
+		name   string
+		target **time.Time
+	}{
+		{"departure_from", &params.DepartureFrom},
+		{"departure_to", &params.DepartureTo},
+	}
+	for _, date := range dates {
+		if value := c.Query(date.name); value != "" {
+			parsed, err := parseSearchDate(value)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Invalid " + date.name,
+				})
+			}
+			*date.target = &parsed
+		}
+	}
+	// A date-only upper bound includes the whole day
+	if value := c.Query("departure_to"); len(value) == len("2006-01-02") && params.DepartureTo != nil {
+		endOfDay := params.DepartureTo.Add(24*time.Hour - time.Nanosecond)
+		params.DepartureTo = &endOfDay
+	}
+
+	results, total, err := tripSearchService.SearchTrips(params)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":   results,
+		"count":  len(results),
+		"total":  total,
+		"limit":  params.Limit,
+		"offset": params.Offset,
+	})
+}
+
+// parseSearchDate parses an RFC3339 timestamp or a YYYY-MM-DD date
+func parseSearchDate(value string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -2,10 +2,16 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http/httptest"
 	"testing"
+	"time"
+	"triplink/backend/config"
 	"triplink/backend/models"
+	"triplink/backend/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
@@ -17,12 +23,35 @@ type TripHandlerTestSuite struct {
 	app *fiber.App
 }
 
+// fakeRouteProvider plans a fixed route, or fails when it has none
+type fakeRouteProvider struct {
+	name  string
+	route []services.Coordinate
+}
+
+func (p *fakeRouteProvider) Name() string { return p.name }
+
+func (p *fakeRouteProvider) PlannedRoute(ctx context.Context, origin, destination services.Coordinate) ([]services.Coordinate, error) {
+	if p.route == nil {
+		return nil, errors.New("service unavailable")
+	}
+	return p.route, nil
+}
+
 func (suite *TripHandlerTestSuite) SetupSuite() {
+	vehicleComplianceService = services.NewVehicleComplianceService(testDB, nil)
+	tripSearchService = services.NewTripSearchService(testDB)
+	organizationService = services.NewOrganizationService(testDB)
+	addressGeocoder = services.NewGeocodingCache(testDB, nil, config.GetGeocodingConfig())
+	trackingService = services.NewTrackingService(testDB)
+	vehicleBookingService = services.NewVehicleBookingService(testDB)
+	registerTenantScope(suite.T())
 }
 
 func (suite *TripHandlerTestSuite) SetupTest() {
 	clearTestDB()
 	seedTestDB()
+	trackingService.SetPlannedRouteProviders()
 	suite.app = fiber.New()
 
 	suite.app.Use(func(c *fiber.Ctx) error {
@@ -31,8 +60,10 @@ func (suite *TripHandlerTestSuite) SetupTest() {
 	})
 
 	suite.app.Post("/trips", CreateTrip)
-	suite.app.Get("/trips", GetTrips)
-	suite.app.Get("/trips/:id", GetTrip)
+	suite.app.Put("/trips/:id", UpdateTrip)
+	suite.app.Get("/trips", asSeededUser(), GetTrips)
+	suite.app.Get("/trips/search", SearchTrips)
+	suite.app.Get("/trips/:id", asSeededUser(), GetTrip)
 }
 
 func (suite *TripHandlerTestSuite) TearDownTest() {
@@ -56,6 +87,153 @@ func (suite *TripHandlerTestSuite) TestCreateTrip() {
 	assert.Equal(t, 200, resp.StatusCode)
 }
 
+func (suite *TripHandlerTestSuite) TestCreateTripStoresTimezonesAndUTC() {
+	t := suite.T()
+
+	// Chicago to Los Angeles, departing 8 AM Chicago time
+	body := []byte(`{
+		"origin_address": "Chicago", "origin_lat": 41.8781, "origin_lng": -87.6298,
+		"destination_address": "Los Angeles", "destination_lat": 34.0522, "destination_lng": -118.2437,
+		"departure_date": "2026-03-02T08:00:00-06:00",
+		"estimated_arrival": "2026-03-03T20:00:00-08:00"
+	}`)
+	req := httptest.NewRequest("POST", "/trips", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+
+	var created models.Trip
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&created))
+	assert.Equal(t, "America/Chicago", created.OriginTimezone)
+	assert.Equal(t, "America/Los_Angeles", created.DestinationTimezone)
+
+	var trip models.Trip
+	suite.Require().NoError(testDB.First(&trip, created.ID).Error)
+	assert.Equal(t, time.Date(2026, 3, 2, 14, 0, 0, 0, time.UTC), trip.DepartureDate.UTC())
+	assert.Equal(t, time.UTC, created.DepartureDate.Location())
+
+	local := services.LocalTimes(&trip, nil)
+	assert.Equal(t, "2026-03-02T08:00:00-06:00", local.Departure.Format(time.RFC3339))
+	assert.Equal(t, "2026-03-03T20:00:00-08:00", local.EstimatedArrival.Format(time.RFC3339))
+	assert.Equal(t, "Mar 3, 2026 at 8:00 PM PST", services.FormatArrival(&trip, trip.EstimatedArrival))
+}
+
+func (suite *TripHandlerTestSuite) TestCreateTripPlansRoute() {
+	t := suite.T()
+
+	here := &fakeRouteProvider{name: services.ETASourceHERE}
+	google := &fakeRouteProvider{name: services.ETASourceGoogleMaps}
+	trackingService.SetPlannedRouteProviders(here, google)
+	route := []services.Coordinate{{Latitude: 41.8781, Longitude: -87.6298}, {Latitude: 38.627, Longitude: -90.1994}, {Latitude: 34.0522, Longitude: -118.2437}}
+
+	body := []byte(`{
+		"origin_address": "Chicago", "origin_lat": 41.8781, "origin_lng": -87.6298,
+		"destination_address": "Los Angeles", "destination_lat": 34.0522, "destination_lng": -118.2437
+	}`)
+	create := func() models.Trip {
+		req := httptest.NewRequest("POST", "/trips", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := suite.app.Test(req)
+		suite.Require().NoError(err)
+		suite.Require().Equal(200, resp.StatusCode)
+
+		var created models.Trip
+		suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&created))
+		return created
+	}
+
+	// Google Maps plans the route while HERE is down
+	google.route = route
+	created := create()
+	assert.Equal(t, services.EncodePolyline(route), created.PlannedRoutePolyline)
+	assert.Equal(t, services.ETASourceGoogleMaps, created.PlannedRouteSource)
+
+	// Trips are still created with both down, and planned when next updated
+	google.route = nil
+	created = create()
+	assert.Empty(t, created.PlannedRoutePolyline)
+
+	here.route = route
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/trips/%d", created.ID), bytes.NewBufferString(`{"notes": "Fragile"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+
+	var trip models.Trip
+	testDB.First(&trip, created.ID)
+	assert.Equal(t, services.EncodePolyline(route), trip.PlannedRoutePolyline)
+	assert.Equal(t, services.ETASourceHERE, trip.PlannedRouteSource)
+}
+
+func (suite *TripHandlerTestSuite) TestCreateTripValidatesCoordinates() {
+	t := suite.T()
+	post := func(body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("POST", "/trips", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := suite.app.Test(req)
+		suite.Require().NoError(err)
+
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	// Libreville is on the equator
+	status, _ := post(`{"origin_address": "Libreville", "origin_lat": 0, "origin_lng": 9.4544, "destination_address": "Franceville", "destination_lat": -1.6333, "destination_lng": 13.5833}`)
+	assert.Equal(t, 200, status)
+
+	status, body := post(`{"origin_address": "Nowhere", "origin_lat": 91, "origin_lng": 9.4544, "destination_address": "Franceville", "destination_lat": -1.6333, "destination_lng": 13.5833}`)
+	assert.Equal(t, 422, status)
+	if fields, ok := body["fields"].([]interface{}); assert.True(t, ok) && assert.Len(t, fields, 1) {
+		assert.Equal(t, "origin_lat", fields[0].(map[string]interface{})["field"])
+	}
+}
+
+func (suite *TripHandlerTestSuite) TestCreateTripWithNonCompliantVehicle() {
+	t := suite.T()
+
+	vehicleComplianceConfig.BlockNonCompliantTrips = true
+	defer func() { vehicleComplianceConfig.BlockNonCompliantTrips = false }()
+
+	var vehicle models.Vehicle
+	testDB.Where("license_plate = ?", "TEST123").First(&vehicle)
+	testDB.Model(&vehicle).Updates(map[string]interface{}{
+		"user_id":          1,
+		"insurance_expiry": time.Now().AddDate(0, 0, 10),
+	})
+
+	tests := []struct {
+		name           string
+		arrival        time.Time
+		expectedStatus int
+	}{
+		{"Insurance valid for the whole trip", time.Now().AddDate(0, 0, 2), 200},
+		{"Insurance expires during the trip", time.Now().AddDate(0, 0, 12), 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trip := models.Trip{
+				VehicleID:          vehicle.ID,
+				OriginAddress:      "123 Main St",
+				DestinationAddress: "456 Oak Ave",
+				DepartureDate:      time.Now().AddDate(0, 0, 1),
+				EstimatedArrival:   tt.arrival,
+			}
+			jsonData, _ := json.Marshal(trip)
+
+			req := httptest.NewRequest("POST", "/trips", bytes.NewBuffer(jsonData))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := suite.app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+}
+
 func (suite *TripHandlerTestSuite) TestGetTrips() {
 	t := suite.T()
 
@@ -66,14 +244,94 @@ func (suite *TripHandlerTestSuite) TestGetTrips() {
 	assert.Equal(t, 200, resp.StatusCode)
 }
 
+func (suite *TripHandlerTestSuite) TestSearchTrips() {
+	t := suite.T()
+
+	departure := time.Date(2030, 3, 10, 8, 0, 0, 0, time.UTC)
+	trips := []models.Trip{
+		{
+			UserID: 1, OriginCity: "Johannesburg", DestinationCity: "Harare", Status: "PLANNED", IsPublic: true,
+			OriginLat: -26.2041, OriginLng: 28.0473, DestinationLat: -17.8292, DestinationLng: 31.0522,
+			DepartureDate: departure, TotalCapacityWeight: 10000, TotalCapacityVolume: 40, BasePrice: 500, PricePerKg: 0.5,
+		},
+		{
+			UserID: 1, OriginCity: "Pretoria", DestinationCity: "Lusaka", Status: "PLANNED", IsPublic: true,
+			OriginLat: -25.7479, OriginLng: 28.2293, DestinationLat: -15.3875, DestinationLng: 28.3228,
+			DepartureDate: departure.AddDate(0, 0, 2), TotalCapacityWeight: 2000, TotalCapacityVolume: 10, BasePrice: 200, PricePerKg: 0.3,
+		},
+		{
+			UserID: 1, OriginCity: "Cape Town", DestinationCity: "Windhoek", Status: "PLANNED", IsPublic: true,
+			OriginLat: -33.9249, OriginLng: 18.4241, DestinationLat: -22.5609, DestinationLng: 17.0658,
+			DepartureDate: departure.AddDate(0, 0, 1), TotalCapacityWeight: 5000, TotalCapacityVolume: 20, BasePrice: 300,
+		},
+	}
+	for i := range trips {
+		testDB.Create(&trips[i])
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedCities []string
+	}{
+		{"Text search", "?q=harare", 200, []string{"Johannesburg"}},
+		{"Origin radius", "?origin_lat=-26.2&origin_lng=28.05&origin_radius_km=100", 200, []string{"Johannesburg", "Pretoria"}},
+		{"Origin and destination radius", "?origin_lat=-26.2&origin_lng=28.05&origin_radius_km=100&destination_lat=-15.4&destination_lng=28.3", 200, []string{"Pretoria"}},
+		{"Departure window", "?departure_from=2030-03-11&departure_to=2030-03-11", 200, []string{"Cape Town"}},
+		{"Remaining capacity", "?min_weight=3000&departure_from=2030-01-01", 200, []string{"Johannesburg", "Cape Town"}},
+		{"Sort by price", "?min_weight=1000&sort=price&departure_from=2030-01-01", 200, []string{"Cape Town", "Pretoria", "Johannesburg"}},
+		{"Max price", "?min_weight=1000&max_price=600&sort=price&departure_from=2030-01-01", 200, []string{"Cape Town", "Pretoria"}},
+		{"Invalid coordinate", "?origin_lat=abc&origin_lng=28", 400, nil},
+		{"Latitude without longitude", "?origin_lat=-26.2", 400, nil},
+		{"Distance sort without location", "?sort=distance", 400, nil},
+		{"Invalid sort", "?sort=name", 400, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := suite.app.Test(httptest.NewRequest("GET", "/trips/search"+tt.query, nil))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+
+			if tt.expectedCities != nil {
+				var body struct {
+					Data []struct {
+						Trip models.Trip `json:"trip"`
+					} `json:"data"`
+				}
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+				cities := []string{}
+				for _, result := range body.Data {
+					cities = append(cities, result.Trip.OriginCity)
+				}
+				assert.Equal(t, tt.expectedCities, cities)
+			}
+		})
+	}
+}
+
 func (suite *TripHandlerTestSuite) TestGetTrip() {
 	t := suite.T()
 
-	req := httptest.NewRequest("GET", "/trips/1", nil)
+	var trip models.Trip
+	testDB.Where("origin_address = ?", "123 Main St").First(&trip)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/trips/%d", trip.ID), nil)
 	resp, err := suite.app.Test(req)
 
 	assert.NoError(t, err)
 	assert.Equal(t, 200, resp.StatusCode)
+
+	// Other users' trips are not found
+	other := models.Trip{UserID: trip.UserID + 1000, Status: "PLANNED"}
+	testDB.Create(&other)
+	req = httptest.NewRequest("GET", fmt.Sprintf("/trips/%d", other.ID), nil)
+	resp, err = suite.app.Test(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
 }
 
 func TestTripHandlerTestSuite(t *testing.T) {
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TripLoadStatusTestSuite struct {
+	suite.Suite
+	app      *fiber.App
+	carrier  models.User
+	shippers []models.User
+	trip     models.Trip
+	loads    []models.Load
+}
+
+func (suite *TripLoadStatusTestSuite) SetupTest() {
+	clearTestDB()
+	trackingService = services.NewTrackingService(testDB)
+
+	suite.carrier = models.User{Email: "bulk-carrier@example.com", Phone: "+15550000711", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.carrier)
+	suite.shippers = []models.User{
+		{Email: "bulk-shipper-1@example.com", Phone: "+15550000712", Password: "password", Role: "SHIPPER"},
+		{Email: "bulk-shipper-2@example.com", Phone: "+15550000713", Password: "password", Role: "SHIPPER"},
+	}
+	testDB.Create(&suite.shippers)
+	suite.trip = models.Trip{UserID: suite.carrier.ID, Status: "ACTIVE", DepartureDate: time.Now(), EstimatedArrival: time.Now().Add(6 * time.Hour)}
+	testDB.Create(&suite.trip)
+
+	suite.loads = []models.Load{
+		{TripID: suite.trip.ID, ShipperID: suite.shippers[0].ID, BookingReference: "BULK-1", Status: "BOOKED"},
+		{TripID: suite.trip.ID, ShipperID: suite.shippers[0].ID, BookingReference: "BULK-2", Status: "PICKUP_SCHEDULED"},
+		{TripID: suite.trip.ID, ShipperID: suite.shippers[1].ID, BookingReference: "BULK-3", Status: "BOOKED"},
+		{TripID: suite.trip.ID, ShipperID: suite.shippers[1].ID, BookingReference: "BULK-4", Status: "DELIVERED"},
+		{TripID: suite.trip.ID, ShipperID: suite.shippers[1].ID, BookingReference: "BULK-5", Status: "QUOTED"},
+	}
+	testDB.Create(&suite.loads)
+
+	suite.app = fiber.New()
+	suite.app.Post("/trips/:trip_id/loads/status", asHeaderUser(), UpdateTripLoadStatuses)
+}
+
+func (suite *TripLoadStatusTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *TripLoadStatusTestSuite) post(userID uint, body fiber.Map) (int, map[string]interface{}) {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", fmt.Sprintf("/trips/%d/loads/status", suite.trip.ID), bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", fmt.Sprint(userID))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	var result map[string]interface{}
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&result))
+	return resp.StatusCode, result
+}
+
+func (suite *TripLoadStatusTestSuite) status(load models.Load) string {
+	testDB.First(&load, load.ID)
+	return load.Status
+}
+
+func (suite *TripLoadStatusTestSuite) TestUpdatesAllLoadsUnderWay() {
+	t := suite.T()
+
+	status, body := suite.post(suite.carrier.ID, fiber.Map{"status": "PICKED_UP"})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(3), body["updated"])
+	assert.Equal(t, float64(0), body["rejected"])
+	results := body["results"].([]interface{})
+	if assert.Len(t, results, 3) {
+		first := results[0].(map[string]interface{})
+		assert.Equal(t, "BULK-1", first["booking_reference"])
+		assert.Equal(t, "BOOKED", first["previous_status"])
+		assert.Equal(t, "PICKED_UP", first["status"])
+		assert.Equal(t, float64(2), first["version"])
+	}
+
+	assert.Equal(t, "PICKED_UP", suite.status(suite.loads[0]))
+	assert.Equal(t, "PICKED_UP", suite.status(suite.loads[1]))
+	assert.Equal(t, "PICKED_UP", suite.status(suite.loads[2]))
+	assert.Equal(t, "DELIVERED", suite.status(suite.loads[3]))
+	assert.Equal(t, "QUOTED", suite.status(suite.loads[4]))
+
+	var events int64
+	testDB.Model(&models.OutboxEvent{}).Where("trip_id = ? AND event_type = ?", suite.trip.ID, "LOAD_STATUS_CHANGE").Count(&events)
+	assert.Equal(t, int64(3), events)
+
+	// One notification per shipper
+	var notifications []models.Notification
+	testDB.Where("type = ?", "LOAD_STATUS_CHANGED").Order("user_id ASC").Find(&notifications)
+	if assert.Len(t, notifications, 2) {
+		assert.Equal(t, suite.shippers[0].ID, notifications[0].UserID)
+		assert.Equal(t, fmt.Sprintf("2 of your loads on trip %d are now PICKED_UP: BULK-1, BULK-2", suite.trip.ID), notifications[0].Message)
+		assert.Equal(t, suite.shippers[1].ID, notifications[1].UserID)
+		assert.Contains(t, notifications[1].Message, "BULK-3")
+	}
+}
+
+func (suite *TripLoadStatusTestSuite) TestReportsRejectedLoads() {
+	t := suite.T()
+	loadIDs := []uint{suite.loads[0].ID, suite.loads[3].ID, suite.loads[2].ID + 1000}
+
+	status, body := suite.post(suite.carrier.ID, fiber.Map{"status": "PICKED_UP", "load_ids": loadIDs})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(1), body["updated"])
+	assert.Equal(t, float64(2), body["rejected"])
+
+	results := body["results"].([]interface{})
+	suite.Require().Len(results, 3)
+	delivered := results[1].(map[string]interface{})
+	assert.Equal(t, false, delivered["updated"])
+	assert.Equal(t, "INVALID_STATUS_TRANSITION", delivered["code"])
+	assert.Equal(t, "The load is DELIVERED, a final status", delivered["error"])
+	missing := results[2].(map[string]interface{})
+	assert.Equal(t, "NOT_FOUND", missing["code"])
+
+	// The rejected load doesn't hold up the others
+	assert.Equal(t, "PICKED_UP", suite.status(suite.loads[0]))
+	assert.Equal(t, "BOOKED", suite.status(suite.loads[2]))
+}
+
+func (suite *TripLoadStatusTestSuite) TestOnlyCarrierUpdates() {
+	t := suite.T()
+
+	status, _ := suite.post(suite.shippers[0].ID, fiber.Map{"status": "PICKED_UP"})
+	assert.Equal(t, 403, status)
+	status, _ = suite.post(suite.carrier.ID, fiber.Map{"status": "LOST"})
+	assert.Equal(t, 422, status)
+	assert.Equal(t, "BOOKED", suite.status(suite.loads[0]))
+}
+
+func TestTripLoadStatusTestSuite(t *testing.T) {
+	suite.Run(t, new(TripLoadStatusTestSuite))
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// memoryTripLocationCache is an in-process stand-in for the Redis cache
+type memoryTripLocationCache struct {
+	mu        sync.Mutex
+	locations map[uint]models.TrackingRecord
+	etas      map[uint]time.Time
+}
+
+func newMemoryTripLocationCache() *memoryTripLocationCache {
+	return &memoryTripLocationCache{locations: map[uint]models.TrackingRecord{}, etas: map[uint]time.Time{}}
+}
+
+func (m *memoryTripLocationCache) GetLocation(tripID uint) (*models.TrackingRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.locations[tripID]
+	if !ok {
+		return nil, services.ErrTripLocationCacheMiss
+	}
+	return &record, nil
+}
+
+func (m *memoryTripLocationCache) SetLocation(record *models.TrackingRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.locations[record.TripID] = *record
+	return nil
+}
+
+func (m *memoryTripLocationCache) GetETA(tripID uint) (*time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	eta, ok := m.etas[tripID]
+	if !ok {
+		return nil, services.ErrTripLocationCacheMiss
+	}
+	return &eta, nil
+}
+
+func (m *memoryTripLocationCache) SetETA(tripID uint, eta time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.etas[tripID] = eta
+	return nil
+}
+
+func (m *memoryTripLocationCache) Invalidate(tripID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.locations, tripID)
+	delete(m.etas, tripID)
+	return nil
+}
+
+type TripLocationCacheTestSuite struct {
+	suite.Suite
+	app   *fiber.App
+	trip  models.Trip
+	cache *memoryTripLocationCache
+}
+
+func (suite *TripLocationCacheTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+	trackingService = services.NewTrackingService(testDB)
+	trackingService.SetETAProviders()
+
+	suite.trip = models.Trip{}
+	testDB.First(&suite.trip)
+	testDB.Model(&suite.trip).Updates(map[string]interface{}{
+		"status":          "IN_TRANSIT",
+		"destination_lat": -17.8,
+		"destination_lng": 31.0,
+	})
+
+	suite.cache = newMemoryTripLocationCache()
+	services.SetTripLocationCache(suite.cache)
+
+	suite.app = fiber.New()
+	suite.app.Get("/trips/:trip_id/tracking/current", GetCurrentTripLocation)
+	suite.app.Put("/trips/:trip_id/tracking/status", UpdateTripStatus)
+}
+
+func (suite *TripLocationCacheTestSuite) TearDownTest() {
+	services.SetTripLocationCache(nil)
+	clearTestDB()
+}
+
+func (suite *TripLocationCacheTestSuite) path(suffix string) string {
+	return "/trips/" + strconv.Itoa(int(suite.trip.ID)) + "/tracking/" + suffix
+}
+
+func (suite *TripLocationCacheTestSuite) currentLocation() (int, models.TrackingRecord) {
+	resp, err := suite.app.Test(httptest.NewRequest("GET", suite.path("current"), nil), -1)
+	suite.Require().NoError(err)
+	var record models.TrackingRecord
+	body, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(body, &record)
+	return resp.StatusCode, record
+}
+
+func (suite *TripLocationCacheTestSuite) TestLocationUpdatesWriteTheCache() {
+	t := suite.T()
+	suite.Require().NoError(trackingService.UpdateLocation(suite.trip.ID, services.LocationUpdate{Latitude: -18.5, Longitude: 31.0, Source: "GPS"}))
+
+	cached, err := suite.cache.GetLocation(suite.trip.ID)
+	suite.Require().NoError(err)
+	assert.Equal(t, -18.5, cached.Latitude)
+	eta, err := suite.cache.GetETA(suite.trip.ID)
+	suite.Require().NoError(err)
+	assert.True(t, eta.After(time.Now()))
+
+	// Reads are served from the cache without touching the database
+	testDB.Exec("DELETE FROM tracking_records")
+	status, record := suite.currentLocation()
+	assert.Equal(t, 200, status)
+	assert.Equal(t, cached.ID, record.ID)
+
+	calculated, err := trackingService.CalculateETA(suite.trip.ID)
+	suite.Require().NoError(err)
+	assert.True(t, eta.Equal(*calculated))
+}
+
+func (suite *TripLocationCacheTestSuite) TestLateUploadsDontReplaceNewerLocation() {
+	suite.Require().NoError(trackingService.UpdateLocation(suite.trip.ID, services.LocationUpdate{Latitude: -18.5, Longitude: 31.0, Source: "GPS"}))
+
+	buffered := time.Now().Add(-time.Hour)
+	suite.Require().NoError(trackingService.UpdateLocation(suite.trip.ID, services.LocationUpdate{Latitude: -19.0, Longitude: 31.0, Source: "GPS", Timestamp: &buffered}))
+
+	cached, err := suite.cache.GetLocation(suite.trip.ID)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), -18.5, cached.Latitude)
+}
+
+func (suite *TripLocationCacheTestSuite) TestMissesFallBackToDatabase() {
+	t := suite.T()
+	record := models.TrackingRecord{TripID: suite.trip.ID, Latitude: -18.2, Longitude: 31.0, Timestamp: time.Now(), Source: "GPS", Status: "ACTIVE"}
+	testDB.Create(&record)
+
+	status, location := suite.currentLocation()
+	assert.Equal(t, 200, status)
+	assert.Equal(t, record.ID, location.ID)
+
+	// The location read is cached for the next refresh
+	cached, err := suite.cache.GetLocation(suite.trip.ID)
+	suite.Require().NoError(err)
+	assert.Equal(t, record.ID, cached.ID)
+}
+
+func (suite *TripLocationCacheTestSuite) TestCompletionInvalidatesTheCache() {
+	t := suite.T()
+	suite.Require().NoError(trackingService.UpdateLocation(suite.trip.ID, services.LocationUpdate{Latitude: -17.9, Longitude: 31.0, Source: "GPS"}))
+
+	body, _ := json.Marshal(map[string]string{"status": "COMPLETED"})
+	req := httptest.NewRequest("PUT", suite.path("status"), bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	_, err = suite.cache.GetLocation(suite.trip.ID)
+	assert.ErrorIs(t, err, services.ErrTripLocationCacheMiss)
+	_, err = suite.cache.GetETA(suite.trip.ID)
+	assert.ErrorIs(t, err, services.ErrTripLocationCacheMiss)
+}
+
+func TestTripLocationCacheTestSuite(t *testing.T) {
+	suite.Run(t, new(TripLocationCacheTestSuite))
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetTripStatusSuggestions @Summary List trip status suggestions
+// @Description List the status changes proposed from a trip's tracking data, newest first. Completion is suggested once the vehicle has stayed at the destination; the carrier confirms or dismisses it.
+// @Tags tracking
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param state query string false "Only suggestions in this state (PENDING, CONFIRMED, DISMISSED)"
+// @Success 200 {array} models.TripStatusSuggestion
+// @Router /tracking/trips/{trip_id}/status-suggestions [get]
+func GetTripStatusSuggestions(c *fiber.Ctx) error {
+	trip, _, status, message := carrierTrip(c)
+	if trip == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	state := c.Query("state")
+	switch state {
+	case "", services.StatusSuggestionPending, services.StatusSuggestionConfirmed, services.StatusSuggestionDismissed:
+	default:
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid state",
+		})
+	}
+
+	suggestions, err := trackingService.GetStatusSuggestions(trip.ID, state)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get status suggestions",
+		})
+	}
+	return c.JSON(suggestions)
+}
+
+// ConfirmTripStatusSuggestion @Summary Confirm a trip status suggestion
+// @Description Change the trip to the suggested status. Only the trip's carrier can confirm suggestions.
+// @Tags tracking
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param suggestion_id path int true "Suggestion ID"
+// @Success 200 {object} models.TripStatusSuggestion
+// @Router /tracking/trips/{trip_id}/status-suggestions/{suggestion_id}/confirm [post]
+func ConfirmTripStatusSuggestion(c *fiber.Ctx) error {
+	return resolveTripStatusSuggestion(c, true)
+}
+
+// DismissTripStatusSuggestion @Summary Dismiss a trip status suggestion
+// @Description Reject the suggested status, leaving the trip's status as it is. Completion isn't suggested again until the trip arrives at its destination anew.
+// @Tags tracking
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Param suggestion_id path int true "Suggestion ID"
+// @Success 200 {object} models.TripStatusSuggestion
+// @Router /tracking/trips/{trip_id}/status-suggestions/{suggestion_id}/dismiss [post]
+func DismissTripStatusSuggestion(c *fiber.Ctx) error {
+	return resolveTripStatusSuggestion(c, false)
+}
+
+// resolveTripStatusSuggestion confirms or dismisses a pending suggestion of
+// a trip the current user is the carrier of
+func resolveTripStatusSuggestion(c *fiber.Ctx, confirm bool) error {
+	trip, userID, status, message := carrierTrip(c)
+	if trip == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	suggestionID, err := strconv.ParseUint(c.Params("suggestion_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid suggestion ID",
+		})
+	}
+
+	service := trackingService.WithContext(c.UserContext())
+	resolve := service.DismissStatusSuggestion
+	if confirm {
+		resolve = service.ConfirmStatusSuggestion
+	}
+	suggestion, err := resolve(trip.ID, uint(suggestionID), userID)
+	switch {
+	case errors.Is(err, services.ErrStatusSuggestionNotFound):
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Status suggestion not found",
+		})
+	case errors.Is(err, services.ErrStatusSuggestionResolved):
+		return c.Status(409).JSON(fiber.Map{
+			"error": "Status suggestion was already confirmed or dismissed",
+		})
+	case err != nil:
+		return c.Status(409).JSON(fiber.Map{
+			"error": "Failed to update status: " + err.Error(),
+		})
+	}
+
+	if confirm {
+		triggerService := services.NewNotificationTriggerService(database.DB)
+		triggerService.TripStatusChangeHandler(trip.ID, trip.Status, suggestion.Status)
+	}
+	return c.JSON(suggestion)
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var tripTemplateService = services.NewTripTemplateService(database.DB)
+
+// CreateTripTemplate @Summary Create a trip template
+// @Description Save a lane that a carrier runs regularly, with its vehicle, capacity, pricing and a recurrence rule such as FREQ=WEEKLY;BYDAY=MO,TH. Trips are created from the template for the next generate_ahead_days days, and kept up to date by the scheduler.
+// @Tags trips
+// @Accept json
+// @Produce json
+// @Param template body services.TripTemplateRequest true "Lane and schedule"
+// @Success 201 {object} models.TripTemplate
+// @Router /trip-templates [post]
+func CreateTripTemplate(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req services.TripTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	template, err := tripTemplateService.CreateTemplate(uint(userID), req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(template)
+}
+
+// GetTripTemplates @Summary Get trip templates
+// @Description Get the current user's trip templates
+// @Tags trips
+// @Produce json
+// @Success 200 {array} models.TripTemplate
+// @Router /trip-templates [get]
+func GetTripTemplates(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	templates, err := tripTemplateService.GetUserTemplates(uint(userID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch trip templates",
+		})
+	}
+
+	return c.JSON(templates)
+}
+
+// GetTripTemplate @Summary Get a trip template
+// @Description Get a trip template and the trips created from it
+// @Tags trips
+// @Produce json
+// @Param id path int true "Template ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /trip-templates/{id} [get]
+func GetTripTemplate(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	templateID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid template ID",
+		})
+	}
+
+	template, err := tripTemplateService.GetTemplate(uint(userID), uint(templateID))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip template not found",
+		})
+	}
+
+	trips, err := tripTemplateService.GetTemplateTrips(template)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch template trips",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"template": template,
+		"trips":    trips,
+	})
+}
+
+// UpdateTripTemplate @Summary Update a trip template
+// @Description Replace the lane, pricing and schedule of a trip template. Trips already created are left unchanged.
+// @Tags trips
+// @Accept json
+// @Produce json
+// @Param id path int true "Template ID"
+// @Param template body services.TripTemplateRequest true "Lane and schedule"
+// @Success 200 {object} models.TripTemplate
+// @Router /trip-templates/{id} [put]
+func UpdateTripTemplate(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	templateID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid template ID",
+		})
+	}
+
+	if _, err := tripTemplateService.GetTemplate(uint(userID), uint(templateID)); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip template not found",
+		})
+	}
+
+	var req services.TripTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	template, err := tripTemplateService.UpdateTemplate(uint(userID), uint(templateID), req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(template)
+}
+
+// DeleteTripTemplate @Summary Delete a trip template
+// @Description Stop creating trips from a template. Trips already created are kept.
+// @Tags trips
+// @Param id path int true "Template ID"
+// @Success 204
+// @Router /trip-templates/{id} [delete]
+func DeleteTripTemplate(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	templateID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid template ID",
+		})
+	}
+
+	if err := tripTemplateService.DeleteTemplate(uint(userID), uint(templateID)); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip template not found",
+		})
+	}
+
+	return c.SendStatus(204)
+}
+
+// GenerateTripTemplateTrips @Summary Create a template's trips now
+// @Description Create the template's trips due within its generation window without waiting for the scheduler. Departures that already have a trip are skipped.
+// @Tags trips
+// @Produce json
+// @Param id path int true "Template ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /trip-templates/{id}/generate [post]
+func GenerateTripTemplateTrips(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	templateID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid template ID",
+		})
+	}
+
+	template, err := tripTemplateService.GetTemplate(uint(userID), uint(templateID))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Trip template not found",
+		})
+	}
+
+	trips, err := tripTemplateService.GenerateTrips(template, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not create trips: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"created": len(trips),
+		"trips":   trips,
+	})
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TripTemplateHandlerTestSuite struct {
+	suite.Suite
+	app  *fiber.App
+	user models.User
+}
+
+func (suite *TripTemplateHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	seedTestDB()
+
+	suite.user = models.User{}
+	suite.Require().NoError(testDB.First(&suite.user).Error)
+	tripTemplateService = services.NewTripTemplateService(testDB)
+
+	suite.app = fiber.New()
+
+	suite.app.Use(asHeaderUser())
+
+	suite.app.Post("/trip-templates", CreateTripTemplate)
+	suite.app.Get("/trip-templates", GetTripTemplates)
+	suite.app.Get("/trip-templates/:id", GetTripTemplate)
+	suite.app.Put("/trip-templates/:id", UpdateTripTemplate)
+	suite.app.Delete("/trip-templates/:id", DeleteTripTemplate)
+	suite.app.Post("/trip-templates/:id/generate", GenerateTripTemplateTrips)
+}
+
+func (suite *TripTemplateHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *TripTemplateHandlerTestSuite) request(method, url string, userID uint, body interface{}) (int, []byte) {
+	jsonData, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var respBody bytes.Buffer
+	respBody.ReadFrom(resp.Body)
+	return resp.StatusCode, respBody.Bytes()
+}
+
+func (suite *TripTemplateHandlerTestSuite) templateRequest(rule string) services.TripTemplateRequest {
+	return services.TripTemplateRequest{
+		Name:                "Harare to Lusaka",
+		OriginCity:          "Harare",
+		DestinationCity:     "Lusaka",
+		TotalCapacityWeight: 20000,
+		BasePrice:           500,
+		PricePerKg:          0.2,
+		RecurrenceRule:      rule,
+		StartDate:           time.Now().AddDate(0, 0, -7),
+		DepartureTime:       "06:00",
+		Timezone:            "Africa/Harare",
+		DurationMinutes:     600,
+		GenerateAheadDays:   21,
+	}
+}
+
+func (suite *TripTemplateHandlerTestSuite) TestCreateTemplateGeneratesTrips() {
+	status, body := suite.request("POST", "/trip-templates", suite.user.ID, suite.templateRequest("FREQ=WEEKLY;BYDAY=MO,TH"))
+	suite.Require().Equal(201, status, string(body))
+
+	var template models.TripTemplate
+	suite.Require().NoError(json.Unmarshal(body, &template))
+	assert.Equal(suite.T(), suite.user.ID, template.UserID)
+	assert.NotNil(suite.T(), template.LastGeneratedAt)
+
+	var trips []models.Trip
+	testDB.Where("template_id = ?", template.ID).Order("departure_date ASC").Find(&trips)
+	// Two departures a week over three weeks
+	suite.Require().True(len(trips) >= 5 && len(trips) <= 7, "got %d trips", len(trips))
+
+	harare, _ := time.LoadLocation("Africa/Harare")
+	for _, trip := range trips {
+		departure := trip.DepartureDate.In(harare)
+		assert.Contains(suite.T(), []time.Weekday{time.Monday, time.Thursday}, departure.Weekday())
+		assert.Equal(suite.T(), 6, departure.Hour())
+		assert.Equal(suite.T(), 10*time.Hour, trip.EstimatedArrival.Sub(trip.DepartureDate))
+		assert.True(suite.T(), trip.DepartureDate.After(time.Now()))
+		assert.Equal(suite.T(), "PLANNED", trip.Status)
+		assert.Equal(suite.T(), "Lusaka", trip.DestinationCity)
+		assert.Equal(suite.T(), 20000.0, trip.TotalCapacityWeight)
+		assert.Equal(suite.T(), 500.0, trip.BasePrice)
+	}
+}
+
+func (suite *TripTemplateHandlerTestSuite) TestGenerateSkipsExistingDepartures() {
+	status, body := suite.request("POST", "/trip-templates", suite.user.ID, suite.templateRequest("FREQ=DAILY;INTERVAL=2"))
+	suite.Require().Equal(201, status, string(body))
+
+	var template models.TripTemplate
+	suite.Require().NoError(json.Unmarshal(body, &template))
+
+	var before int64
+	testDB.Model(&models.Trip{}).Where("template_id = ?", template.ID).Count(&before)
+	suite.Require().NotZero(before)
+
+	// A deleted trip isn't recreated
+	var trip models.Trip
+	suite.Require().NoError(testDB.Where("template_id = ?", template.ID).First(&trip).Error)
+	testDB.Delete(&trip)
+
+	status, body = suite.request("POST", "/trip-templates/"+strconv.Itoa(int(template.ID))+"/generate", suite.user.ID, nil)
+	suite.Require().Equal(200, status, string(body))
+
+	var result map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(body, &result))
+	assert.Equal(suite.T(), float64(0), result["created"])
+
+	var after int64
+	testDB.Model(&models.Trip{}).Where("template_id = ?", template.ID).Count(&after)
+	assert.Equal(suite.T(), before-1, after)
+}
+
+func (suite *TripTemplateHandlerTestSuite) TestRecurrenceCount() {
+	req := suite.templateRequest("FREQ=DAILY;COUNT=10")
+	status, body := suite.request("POST", "/trip-templates", suite.user.ID, req)
+	suite.Require().Equal(201, status, string(body))
+
+	var template models.TripTemplate
+	suite.Require().NoError(json.Unmarshal(body, &template))
+
+	// Seven of the ten departures were in the past week
+	var count int64
+	testDB.Model(&models.Trip{}).Where("template_id = ?", template.ID).Count(&count)
+	assert.True(suite.T(), count == 2 || count == 3, "got %d trips", count)
+}
+
+func (suite *TripTemplateHandlerTestSuite) TestCreateTemplateValidation() {
+	cases := map[string]func(*services.TripTemplateRequest){
+		"missing rule":      func(r *services.TripTemplateRequest) { r.RecurrenceRule = "" },
+		"bad frequency":     func(r *services.TripTemplateRequest) { r.RecurrenceRule = "FREQ=HOURLY" },
+		"bad weekday":       func(r *services.TripTemplateRequest) { r.RecurrenceRule = "FREQ=WEEKLY;BYDAY=XX" },
+		"bad time":          func(r *services.TripTemplateRequest) { r.DepartureTime = "25:00" },
+		"bad timezone":      func(r *services.TripTemplateRequest) { r.Timezone = "Mars/Olympus" },
+		"no duration":       func(r *services.TripTemplateRequest) { r.DurationMinutes = 0 },
+		"too far ahead":     func(r *services.TripTemplateRequest) { r.GenerateAheadDays = 365 },
+		"unknown vehicle":   func(r *services.TripTemplateRequest) { r.VehicleID = 9999 },
+		"missing start":     func(r *services.TripTemplateRequest) { r.StartDate = time.Time{} },
+		"negative capacity": func(r *services.TripTemplateRequest) { r.TotalCapacityWeight = -1 },
+	}
+
+	for name, modify := range cases {
+		req := suite.templateRequest("FREQ=WEEKLY")
+		modify(&req)
+		status, body := suite.request("POST", "/trip-templates", suite.user.ID, req)
+		assert.Equal(suite.T(), 400, status, "%s: %s", name, body)
+	}
+
+	var count int64
+	testDB.Model(&models.TripTemplate{}).Count(&count)
+	assert.Zero(suite.T(), count)
+}
+
+func (suite *TripTemplateHandlerTestSuite) TestTemplateBelongsToOwner() {
+	status, body := suite.request("POST", "/trip-templates", suite.user.ID, suite.templateRequest("FREQ=WEEKLY"))
+	suite.Require().Equal(201, status, string(body))
+
+	var template models.TripTemplate
+	suite.Require().NoError(json.Unmarshal(body, &template))
+	url := "/trip-templates/" + strconv.Itoa(int(template.ID))
+
+	other := suite.user.ID + 1000
+	status, _ = suite.request("GET", url, other, nil)
+	assert.Equal(suite.T(), 404, status)
+	status, _ = suite.request("DELETE", url, other, nil)
+	assert.Equal(suite.T(), 404, status)
+
+	status, body = suite.request("GET", url, suite.user.ID, nil)
+	suite.Require().Equal(200, status, string(body))
+	var result struct {
+		Template models.TripTemplate `json:"template"`
+		Trips    []models.Trip       `json:"trips"`
+	}
+	suite.Require().NoError(json.Unmarshal(body, &result))
+	assert.Equal(suite.T(), template.ID, result.Template.ID)
+	assert.NotEmpty(suite.T(), result.Trips)
+
+	// Pausing the template stops new trips
+	req := suite.templateRequest("FREQ=WEEKLY")
+	active := false
+	req.Active = &active
+	status, body = suite.request("PUT", url, suite.user.ID, req)
+	suite.Require().Equal(200, status, string(body))
+
+	status, body = suite.request("POST", url+"/generate", suite.user.ID, nil)
+	suite.Require().Equal(200, status, string(body))
+	assert.Contains(suite.T(), string(body), `"created":0`)
+
+	status, _ = suite.request("DELETE", url, suite.user.ID, nil)
+	assert.Equal(suite.T(), 204, status)
+
+	// Trips created from a deleted template are kept
+	var count int64
+	testDB.Model(&models.Trip{}).Where("template_id = ?", template.ID).Count(&count)
+	assert.NotZero(suite.T(), count)
+}
+
+func TestTripTemplateHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(TripTemplateHandlerTestSuite))
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RecalculateTripTolls @Summary Recalculate a trip's tolls
+// @Description Recalculate the expected tolls of a trip's planned route, or between its origin and destination before it has one. Tolls are otherwise calculated when the trip is created and when its route changes significantly.
+// @Tags trips
+// @Produce json
+// @Param trip_id path int true "Trip ID"
+// @Success 200 {object} models.Trip
+// @Router /api/trips/{trip_id}/tolls/recalculate [post]
+func RecalculateTripTolls(c *fiber.Ctx) error {
+	trip, _, status, message := carrierTrip(c)
+	if trip == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	tolls := services.GetTripTollService()
+	if tolls == nil {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "Toll calculation is not available",
+		})
+	}
+
+	trip, err := tolls.CalculateTrip(trip.ID)
+	if err != nil {
+		return c.Status(502).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(trip)
+}
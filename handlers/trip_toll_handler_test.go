@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// stubTolls charges a fixed amount for any route and counts its calls
+type stubTolls struct {
+	cost  float64
+	calls int
+	err   error
+}
+
+func (s *stubTolls) GetTollRates(origin, destination string) (*services.TollInfo, error) {
+	s.calls++
+	return &services.TollInfo{TotalCost: s.cost, Currency: "usd"}, s.err
+}
+
+func (s *stubTolls) GetTollStationsAlongRoute(waypoints []services.Coordinate) ([]services.TollStation, error) {
+	return nil, s.err
+}
+
+func (s *stubTolls) CalculateTollCosts(routePolyline string) (*services.TollCostBreakdown, error) {
+	s.calls++
+	return &services.TollCostBreakdown{TotalCost: s.cost}, s.err
+}
+
+type TripTollHandlerTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	tolls   *stubTolls
+	carrier models.User
+	other   models.User
+	trip    models.Trip
+}
+
+func (suite *TripTollHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	suite.tolls = &stubTolls{cost: 120}
+	services.SetTripTollService(services.NewTripTollService(testDB, suite.tolls, config.GetTollConfig()))
+
+	suite.carrier = models.User{Email: "toll-carrier@example.com", Phone: "+15550000311", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.carrier)
+	suite.other = models.User{Email: "toll-other@example.com", Phone: "+15550000312", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.other)
+	suite.trip = models.Trip{
+		UserID:              suite.carrier.ID,
+		Status:              "PLANNED",
+		IsPublic:            true,
+		DestinationLng:      4.5,
+		DepartureDate:       time.Now().Add(24 * time.Hour),
+		TotalCapacityWeight: 10000,
+		BasePrice:           500,
+		PricePerKg:          0.1,
+	}
+	testDB.Create(&suite.trip)
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Post("/trips/:trip_id/tolls/recalculate", RecalculateTripTolls)
+}
+
+func (suite *TripTollHandlerTestSuite) TearDownTest() {
+	services.SetTripTollService(nil)
+	clearTestDB()
+}
+
+func (suite *TripTollHandlerTestSuite) recalculate(userID uint, result interface{}) int {
+	req := httptest.NewRequest("POST", fmt.Sprintf("/trips/%d/tolls/recalculate", suite.trip.ID), nil)
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	if result != nil && resp.StatusCode == 200 {
+		suite.Require().NoError(json.NewDecoder(resp.Body).Decode(result))
+	}
+	return resp.StatusCode
+}
+
+func (suite *TripTollHandlerTestSuite) reload() models.Trip {
+	var trip models.Trip
+	suite.Require().NoError(testDB.First(&trip, suite.trip.ID).Error)
+	return trip
+}
+
+func (suite *TripTollHandlerTestSuite) TestRecalculateBetweenOriginAndDestination() {
+	t := suite.T()
+
+	var trip models.Trip
+	assert.Equal(t, 200, suite.recalculate(suite.carrier.ID, &trip))
+	assert.Equal(t, 120.0, trip.TollCost)
+	assert.Equal(t, "USD", trip.TollCurrency)
+	assert.NotNil(t, trip.TollsCalculatedAt)
+	assert.Equal(t, 120.0, suite.reload().TollCost)
+
+	assert.Equal(t, 403, suite.recalculate(suite.other.ID, nil))
+
+	suite.tolls.err = errors.New("timeout")
+	assert.Equal(t, 502, suite.recalculate(suite.carrier.ID, nil))
+	assert.Equal(t, 120.0, suite.reload().TollCost)
+}
+
+func (suite *TripTollHandlerTestSuite) TestRecalculatedWhenRouteChangesSignificantly() {
+	t := suite.T()
+	tracking := services.NewTrackingService(testDB)
+
+	// About 500 km east along the equator
+	route := []services.Coordinate{
+		{Latitude: 0, Longitude: 0}, {Latitude: 0, Longitude: 1}, {Latitude: 0, Longitude: 2},
+		{Latitude: 0, Longitude: 3}, {Latitude: 0, Longitude: 4}, {Latitude: 0, Longitude: 4.5},
+	}
+	suite.Require().NoError(tracking.SetPlannedRoute(suite.trip.ID, services.EncodePolyline(route), "manual"))
+	assert.Equal(t, 1, suite.tolls.calls)
+	assert.Equal(t, 120.0, suite.reload().TollCost)
+
+	// A kilometer off the route halfway is the same road
+	suite.tolls.cost = 150
+	nudged := append([]services.Coordinate{}, route...)
+	nudged[2] = services.Coordinate{Latitude: 0.01, Longitude: 2}
+	suite.Require().NoError(tracking.SetPlannedRoute(suite.trip.ID, services.EncodePolyline(nudged), "manual"))
+	assert.Equal(t, 1, suite.tolls.calls)
+	assert.Equal(t, 120.0, suite.reload().TollCost)
+
+	// Half a degree north is another road
+	detour := append([]services.Coordinate{}, route...)
+	detour[2] = services.Coordinate{Latitude: 0.5, Longitude: 2}
+	suite.Require().NoError(tracking.SetPlannedRoute(suite.trip.ID, services.EncodePolyline(detour), "manual"))
+	assert.Equal(t, 2, suite.tolls.calls)
+	assert.Equal(t, 150.0, suite.reload().TollCost)
+
+	// A failing toll API doesn't stop the route from changing
+	suite.tolls.err = errors.New("timeout")
+	suite.Require().NoError(tracking.SetPlannedRoute(suite.trip.ID, services.EncodePolyline(route), "manual"))
+	assert.Equal(t, services.EncodePolyline(route), suite.reload().PlannedRoutePolyline)
+}
+
+func (suite *TripTollHandlerTestSuite) TestSearchEstimateIncludesTollShare() {
+	t := suite.T()
+	_, err := services.GetTripTollService().CalculateTrip(suite.trip.ID)
+	suite.Require().NoError(err)
+
+	search := services.NewTripSearchService(testDB)
+	results, total, err := search.SearchTrips(services.TripSearchParams{MinWeight: 2500})
+	suite.Require().NoError(err)
+	suite.Require().Equal(1, total)
+	assert.Equal(t, 30.0, results[0].EstimatedTolls)
+	assert.InDelta(t, 500+250+30, results[0].EstimatedPrice, 0.001)
+
+	// The price limit counts the tolls
+	_, total, err = search.SearchTrips(services.TripSearchParams{MinWeight: 2500, MaxPrice: 780})
+	suite.Require().NoError(err)
+	assert.Equal(t, 1, total)
+	_, total, err = search.SearchTrips(services.TripSearchParams{MinWeight: 2500, MaxPrice: 760})
+	suite.Require().NoError(err)
+	assert.Zero(t, total)
+}
+
+func (suite *TripTollHandlerTestSuite) TestInvoiceChargesTollShare() {
+	t := suite.T()
+	_, err := services.GetTripTollService().CalculateTrip(suite.trip.ID)
+	suite.Require().NoError(err)
+
+	shipper := models.User{Email: "toll-shipper@example.com", Phone: "+15550000313", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&shipper)
+	load := models.Load{ShipperID: shipper.ID, TripID: suite.trip.ID, BookingReference: "TOLL-1", Weight: 5000, Status: "DELIVERED", AgreedPrice: 1000, Currency: "USD"}
+	testDB.Create(&load)
+
+	invoices := services.NewInvoiceService(testDB, services.NewLocalFileStorage(t.TempDir(), "/uploads"), &config.PaymentConfig{InvoiceDueDays: 30})
+	invoice, err := invoices.IssueInvoice(suite.carrier.ID, load.ID, services.IssueInvoiceRequest{})
+	suite.Require().NoError(err)
+	var items []models.InvoiceLineItem
+	testDB.Where("invoice_id = ?", invoice.ID).Order("id ASC").Find(&items)
+	suite.Require().Len(items, 2)
+	assert.Equal(t, services.InvoiceItemToll, items[1].Type)
+	assert.Equal(t, 60.0, items[1].Amount)
+
+	// Tolls itemized by the carrier replace the expected ones
+	testDB.Model(&models.Invoice{}).Where("id = ?", invoice.ID).Update("status", services.InvoiceStatusVoid)
+	invoice, err = invoices.IssueInvoice(suite.carrier.ID, load.ID, services.IssueInvoiceRequest{
+		Surcharges: []services.InvoiceSurcharge{{Type: services.InvoiceItemToll, Description: "Bridge", Amount: 45}},
+	})
+	suite.Require().NoError(err)
+	items = nil
+	testDB.Where("invoice_id = ? AND type = ?", invoice.ID, services.InvoiceItemToll).Find(&items)
+	suite.Require().Len(items, 1)
+	assert.Equal(t, 45.0, items[0].Amount)
+}
+
+func TestTripTollHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(TripTollHandlerTestSuite))
+}
@@ -20,9 +20,17 @@ type LoginSuccessResponse struct {
 	Token   string `json:"token"`
 }
 
+// registrableRoles are the roles users can sign up with. ADMIN accounts are
+// not self-service.
+var registrableRoles = map[string]bool{
+	"SHIPPER": true,
+	"CARRIER": true,
+	"DRIVER":  true,
+}
+
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user with email, phone, password, and role
+// @Description Register a new user with email, phone, password, and role (SHIPPER, CARRIER or DRIVER)
 // @Tags Auth
 // @Accept json
 // @Produce json
@@ -37,6 +45,12 @@ func Register(c *fiber.Ctx) error {
 		return err
 	}
 
+	if !registrableRoles[data["role"]] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "role must be SHIPPER, CARRIER or DRIVER",
+		})
+	}
+
 	password, _ := bcrypt.GenerateFromPassword([]byte(data["password"]), 14)
 
 	user := models.User{
@@ -88,6 +102,13 @@ func Login(c *fiber.Ctx) error {
 		})
 	}
 
+	if user.SuspendedAt != nil {
+		c.Status(fiber.StatusForbidden)
+		return c.JSON(fiber.Map{
+			"message": errAccountSuspended.Error(),
+		})
+	}
+
 	token, err := auth.GenerateJWT(user.ID, user.Role)
 
 	if err != nil {
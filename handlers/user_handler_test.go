@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http/httptest"
 	"testing"
+	"triplink/backend/models"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
@@ -39,7 +40,7 @@ func (suite *UserHandlerTestSuite) TestRegister() {
 		"email":    "newuser@example.com",
 		"phone":    "+1987654321",
 		"password": "newpassword",
-		"role":     "user",
+		"role":     "SHIPPER",
 	}
 	jsonData, _ := json.Marshal(user)
 
@@ -51,6 +52,31 @@ func (suite *UserHandlerTestSuite) TestRegister() {
 	assert.Equal(t, 200, resp.StatusCode)
 }
 
+func (suite *UserHandlerTestSuite) TestRegisterRejectsRoles() {
+	t := suite.T()
+
+	for _, role := range []string{"ADMIN", "user", ""} {
+		user := map[string]string{
+			"email":    "newuser@example.com",
+			"phone":    "+1987654321",
+			"password": "newpassword",
+			"role":     role,
+		}
+		jsonData, _ := json.Marshal(user)
+
+		req := httptest.NewRequest("POST", "/api/register", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := suite.app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode, role)
+	}
+
+	var count int64
+	testDB.Model(&models.User{}).Where("email = ?", "newuser@example.com").Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
 func (suite *UserHandlerTestSuite) TestLogin() {
 	t := suite.T()
 
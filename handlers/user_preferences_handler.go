@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var userPreferencesService = services.NewUserPreferencesService(database.DB)
+
+// UserPreferencesRequest changes the current user's preferences. Fields left
+// out keep their value.
+type UserPreferencesRequest struct {
+	// System of measurement of responses and notifications
+	UnitSystem *string `json:"unit_system,omitempty" validate:"omitempty,oneof=metric imperial"`
+	// Language of notifications
+	Language *string `json:"language,omitempty" validate:"omitempty,oneof=en es fr"`
+}
+
+// GetMyPreferences @Summary Get my preferences
+// @Description Get the current user's preferences, like the system of measurement tracking, analytics and vehicle responses and notifications are in, and the language of notifications
+// @Tags users
+// @Produce json
+// @Success 200 {object} services.UserPreferences
+// @Router /users/me/preferences [get]
+func GetMyPreferences(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	preferences, err := userPreferencesService.GetPreferences(uint(userID))
+	if err != nil {
+		if err == services.ErrUserNotFound {
+			return c.Status(404).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch preferences",
+		})
+	}
+
+	return c.JSON(preferences)
+}
+
+// UpdateMyPreferences @Summary Update my preferences
+// @Description Change the current user's preferences. A unit_system of imperial has responses use miles, mph, pounds, feet and °F unless a request asks otherwise with its units parameter, and notifications use them too. The language, en, es or fr, is the one notifications are written in.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param preferences body UserPreferencesRequest true "Preferences to change"
+// @Success 200 {object} services.UserPreferences
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /users/me/preferences [put]
+func UpdateMyPreferences(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req UserPreferencesRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	preferences, err := userPreferencesService.UpdatePreferences(uint(userID), services.UserPreferencesUpdate{
+		UnitSystem: req.UnitSystem,
+		Language:   req.Language,
+	})
+	if err != nil {
+		switch err {
+		case services.ErrUserNotFound:
+			return c.Status(404).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		case services.ErrInvalidUnitSystem, services.ErrInvalidLanguage:
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not update preferences",
+		})
+	}
+
+	return c.JSON(preferences)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type UserPreferencesHandlerTestSuite struct {
+	suite.Suite
+	app  *fiber.App
+	user models.User
+}
+
+func (suite *UserPreferencesHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	userPreferencesService = services.NewUserPreferencesService(testDB)
+
+	suite.user = models.User{Email: "preferences@example.com", Phone: "+15550000801", Password: "password", Role: "SHIPPER"}
+	testDB.Create(&suite.user)
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Get("/users/me/preferences", GetMyPreferences)
+	suite.app.Put("/users/me/preferences", UpdateMyPreferences)
+}
+
+func (suite *UserPreferencesHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *UserPreferencesHandlerTestSuite) request(method string, userID uint, body interface{}) (int, map[string]interface{}) {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, "/users/me/preferences", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if userID != 0 {
+		req.Header.Set("X-User-ID", fmt.Sprintf("%d", userID))
+	}
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+func (suite *UserPreferencesHandlerTestSuite) TestPreferencesDefaultToMetric() {
+	status, body := suite.request("GET", suite.user.ID, nil)
+	suite.Require().Equal(200, status)
+	assert.Equal(suite.T(), "metric", body["unit_system"])
+	assert.Equal(suite.T(), "en", body["language"])
+}
+
+func (suite *UserPreferencesHandlerTestSuite) TestUpdateUnitSystem() {
+	t := suite.T()
+
+	status, body := suite.request("PUT", suite.user.ID, fiber.Map{"unit_system": "imperial"})
+	suite.Require().Equal(200, status)
+	assert.Equal(t, "imperial", body["unit_system"])
+	assert.Equal(t, "imperial", string(services.UserUnitSystem(testDB, suite.user.ID)))
+
+	// Leaving the field out keeps it
+	status, body = suite.request("PUT", suite.user.ID, fiber.Map{})
+	suite.Require().Equal(200, status)
+	assert.Equal(t, "imperial", body["unit_system"])
+
+	status, body = suite.request("GET", suite.user.ID, nil)
+	suite.Require().Equal(200, status)
+	assert.Equal(t, "imperial", body["unit_system"])
+}
+
+func (suite *UserPreferencesHandlerTestSuite) TestUpdateLanguage() {
+	t := suite.T()
+
+	status, body := suite.request("PUT", suite.user.ID, fiber.Map{"language": "es"})
+	suite.Require().Equal(200, status)
+	assert.Equal(t, "es", body["language"])
+	assert.Equal(t, "metric", body["unit_system"])
+
+	// Notifications are written in the user's language
+	notification := models.Notification{
+		UserID:        suite.user.ID,
+		MessageKey:    "notification.trip_delayed",
+		MessageParams: map[string]interface{}{"minutes": 40, "reason": "Behind schedule"},
+		Type:          "TRIP_DELAYED",
+	}
+	// Pushing fails without device tokens, but the notification is stored
+	services.NewNotificationService(testDB).CreateNotificationWithDelivery(&notification)
+	suite.Require().NotZero(notification.ID)
+
+	var stored models.Notification
+	suite.Require().NoError(testDB.First(&stored, notification.ID).Error)
+	assert.Equal(t, "Envío retrasado", stored.Title)
+	assert.Equal(t, "Su envío lleva un retraso de 40 minutos debido a: Behind schedule", stored.Message)
+	assert.Equal(t, "notification.trip_delayed", stored.MessageKey)
+	assert.EqualValues(t, 40, stored.MessageParams["minutes"])
+
+	status, body = suite.request("PUT", suite.user.ID, fiber.Map{"language": "de"})
+	suite.Require().Equal(422, status)
+	assert.Equal(t, "language", body["fields"].([]interface{})[0].(map[string]interface{})["field"])
+}
+
+func (suite *UserPreferencesHandlerTestSuite) TestUpdateRejectsInvalidPreferences() {
+	status, body := suite.request("PUT", suite.user.ID, fiber.Map{"unit_system": "nautical"})
+	suite.Require().Equal(422, status)
+	fields := body["fields"].([]interface{})
+	suite.Require().Len(fields, 1)
+	assert.Equal(suite.T(), "unit_system", fields[0].(map[string]interface{})["field"])
+
+	status, _ = suite.request("PUT", 0, fiber.Map{"unit_system": "metric"})
+	assert.Equal(suite.T(), 401, status)
+	status, _ = suite.request("GET", suite.user.ID+1000, nil)
+	assert.Equal(suite.T(), 404, status)
+}
+
+func TestUserPreferencesHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(UserPreferencesHandlerTestSuite))
+}
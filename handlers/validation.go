@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"triplink/backend/apierror"
+	"triplink/backend/tracing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestValidator checks request DTOs against their validate tags. Fields
+// are reported by their JSON names, as clients sent them.
+var requestValidator = newRequestValidator()
+
+func newRequestValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return v
+}
+
+// FieldError describes a request field that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationErrorResponse is returned with status 422 when a request body
+// is well-formed but its fields are invalid. It's the error envelope of
+// package apierror with the invalid fields.
+type ValidationErrorResponse struct {
+	Error   string        `json:"error"`
+	Code    apierror.Code `json:"code"`
+	Fields  []FieldError  `json:"fields"`
+	TraceID string        `json:"trace_id,omitempty"`
+}
+
+// requestError is a request body that couldn't be decoded or failed
+// validation. Without fields the body couldn't be decoded at all.
+type requestError struct {
+	message string
+	fields  []FieldError
+}
+
+func (e *requestError) Error() string {
+	if len(e.fields) == 0 {
+		return e.message
+	}
+	problems := make([]string, len(e.fields))
+	for i, field := range e.fields {
+		problems[i] = field.Field + " " + field.Message
+	}
+	return e.message + ": " + strings.Join(problems, "; ")
+}
+
+// parseBody decodes the JSON request body into a DTO and validates it. The
+// DTO may be a struct or a slice of structs, for batch endpoints.
+func parseBody(c *fiber.Ctx, dto interface{}) error {
+	if err := decodeBody(c, dto); err != nil {
+		return err
+	}
+	return validateRequest(dto)
+}
+
+// decodeBody decodes the JSON request body into a DTO without validating
+// it, for batches whose items are validated one by one
+func decodeBody(c *fiber.Ctx, dto interface{}) error {
+	if err := c.BodyParser(dto); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return &requestError{message: "Validation failed", fields: []FieldError{{
+				Field:   typeErr.Field,
+				Rule:    "type",
+				Message: "must be " + jsonTypeName(typeErr.Type),
+			}}}
+		}
+		return &requestError{message: "Cannot parse request body"}
+	}
+	return nil
+}
+
+// validateRequest checks a DTO against its validate tags
+func validateRequest(dto interface{}) error {
+	var err error
+	if kind := reflect.Indirect(reflect.ValueOf(dto)).Kind(); kind == reflect.Slice || kind == reflect.Array {
+		err = requestValidator.Var(dto, "dive")
+	} else {
+		err = requestValidator.Struct(dto)
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+	fields := make([]FieldError, 0, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		fields = append(fields, FieldError{
+			Field:   fieldPath(fieldErr),
+			Rule:    fieldErr.Tag(),
+			Message: fieldMessage(fieldErr),
+		})
+	}
+	return &requestError{message: "Validation failed", fields: fields}
+}
+
+// invalidRequest responds to an error from parseBody, with 422 and the
+// invalid fields, or 400 for bodies that aren't JSON of the expected shape
+func invalidRequest(c *fiber.Ctx, err error) error {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if len(reqErr.fields) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": reqErr.message,
+		})
+	}
+	return c.Status(422).JSON(ValidationErrorResponse{
+		Error:   reqErr.message,
+		Code:    apierror.CodeValidationFailed,
+		Fields:  reqErr.fields,
+		TraceID: tracing.TraceID(c.UserContext()),
+	})
+}
+
+// fieldPath is the path of a field in the request body, e.g. "latitude" or
+// "[2].latitude" for batches, without the name of the DTO type
+func fieldPath(fieldErr validator.FieldError) string {
+	namespace := fieldErr.Namespace()
+	if strings.HasPrefix(namespace, "[") {
+		return namespace
+	}
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+func fieldMessage(fieldErr validator.FieldError) string {
+	param := fieldErr.Param()
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "latitude":
+		return "must be a latitude between -90 and 90"
+	case "longitude":
+		return "must be a longitude between -180 and 180"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(param), ", ")
+	case "gt":
+		return "must be greater than " + param
+	case "gte", "min":
+		return "must be at least " + param + lengthUnit(fieldErr.Kind())
+	case "lt":
+		return "must be less than " + param
+	case "lte", "max":
+		return "must be at most " + param + lengthUnit(fieldErr.Kind())
+	}
+	return fmt.Sprintf("failed the %s rule", fieldErr.Tag())
+}
+
+// lengthUnit is the unit of a length rule, which for strings and lists
+// limits their length rather than their value
+func lengthUnit(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return " items"
+	}
+	return ""
+}
+
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	}
+	return "an object"
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type VehicleBookingTestSuite struct {
+	suite.Suite
+	app      *fiber.App
+	carrier  models.User
+	admin    models.User
+	other    models.User
+	vehicle  models.Vehicle
+	spare    models.Vehicle
+	departed time.Time
+}
+
+func (suite *VehicleBookingTestSuite) SetupTest() {
+	clearTestDB()
+	vehicleBookingService = services.NewVehicleBookingService(testDB)
+	driverAvailabilityService = services.NewDriverAvailabilityService(testDB)
+	organizationService = services.NewOrganizationService(testDB)
+	savedLocationService = services.NewSavedLocationService(testDB, nil)
+	vehicleComplianceService = services.NewVehicleComplianceService(testDB, nil)
+	addressGeocoder = services.NewGeocodingCache(testDB, nil, config.GetGeocodingConfig())
+
+	suite.carrier = models.User{Email: "fleet-carrier@example.com", Phone: "+15550001011", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.carrier)
+	suite.admin = models.User{Email: "fleet-admin@example.com", Phone: "+15550001012", Password: "password", Role: "ADMIN"}
+	testDB.Create(&suite.admin)
+	suite.other = models.User{Email: "fleet-other@example.com", Phone: "+15550001013", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.other)
+	suite.vehicle = models.Vehicle{UserID: suite.carrier.ID, Make: "Volvo", Model: "FH16", LicensePlate: "FLEET-1", VIN: "VINFLEET1", IsActive: true}
+	testDB.Create(&suite.vehicle)
+	suite.spare = models.Vehicle{UserID: suite.carrier.ID, Make: "DAF", Model: "XF", LicensePlate: "FLEET-2", VIN: "VINFLEET2", IsActive: true}
+	testDB.Create(&suite.spare)
+	suite.departed = time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Second)
+
+	roles := map[uint]string{suite.carrier.ID: suite.carrier.Role, suite.admin.ID: suite.admin.Role, suite.other.ID: suite.other.Role}
+	suite.app = fiber.New()
+	suite.app.Use(func(c *fiber.Ctx) error {
+		if userID, err := strconv.Atoi(c.Get("X-User-ID")); err == nil {
+			c.Locals("user_id", float64(userID))
+			c.Locals("role", roles[uint(userID)])
+		}
+		return c.Next()
+	})
+	suite.app.Post("/trips", CreateTrip)
+	suite.app.Put("/trips/:id", UpdateTrip)
+	suite.app.Get("/users/me/vehicles/conflicts", GetMyVehicleConflicts)
+	suite.app.Get("/admin/vehicles/conflicts", GetVehicleConflicts)
+}
+
+func (suite *VehicleBookingTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *VehicleBookingTestSuite) request(method, path string, userID uint, body interface{}) (int, map[string]interface{}) {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+// createTrip adds a trip of the carrier departing hours after the first
+// trip departed, for a number of hours
+func (suite *VehicleBookingTestSuite) createTrip(vehicleID uint, after, hours int) models.Trip {
+	departure := suite.departed.Add(time.Duration(after) * time.Hour)
+	trip := models.Trip{
+		UserID: suite.carrier.ID, VehicleID: vehicleID, Status: "PLANNED", TotalCapacityWeight: 1000,
+		DepartureDate: departure, EstimatedArrival: departure.Add(time.Duration(hours) * time.Hour),
+	}
+	testDB.Create(&trip)
+	return trip
+}
+
+func (suite *VehicleBookingTestSuite) conflicts(path string, userID uint) []interface{} {
+	status, body := suite.request("GET", path, userID, nil)
+	suite.Require().Equal(200, status)
+	return body["conflicts"].([]interface{})
+}
+
+func (suite *VehicleBookingTestSuite) TestUpdateChecksVehicle() {
+	t := suite.T()
+	first := suite.createTrip(suite.vehicle.ID, 0, 8)
+	second := suite.createTrip(suite.spare.ID, 4, 8)
+	path := fmt.Sprintf("/trips/%d", second.ID)
+
+	status, body := suite.request("PUT", path, suite.carrier.ID, fiber.Map{"vehicle_id": suite.vehicle.ID})
+	assert.Equal(t, 409, status)
+	assert.Equal(t, "VEHICLE_DOUBLE_BOOKED", body["code"])
+	assert.Equal(t, float64(first.ID), body["details"].(map[string]interface{})["trip_id"])
+
+	// Moved to depart once the first trip arrives, the vehicle is free
+	departure := suite.departed.Add(8 * time.Hour)
+	status, body = suite.request("PUT", path, suite.carrier.ID, fiber.Map{
+		"vehicle_id": suite.vehicle.ID, "departure_date": departure, "estimated_arrival": departure.Add(6 * time.Hour),
+	})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(suite.vehicle.ID), body["vehicle_id"])
+	var trip models.Trip
+	testDB.First(&trip, second.ID)
+	if assert.NotNil(t, trip.ScheduledArrival) {
+		assert.True(t, departure.Add(6*time.Hour).Equal(*trip.ScheduledArrival))
+	}
+
+	// Changes that don't move the trip aren't checked again
+	status, _ = suite.request("PUT", fmt.Sprintf("/trips/%d", first.ID), suite.carrier.ID, fiber.Map{"notes": "Fragile"})
+	assert.Equal(t, 200, status)
+	assert.Empty(t, suite.conflicts("/users/me/vehicles/conflicts", suite.carrier.ID))
+}
+
+func (suite *VehicleBookingTestSuite) TestAdminsOverrideConflicts() {
+	t := suite.T()
+	first := suite.createTrip(suite.vehicle.ID, 0, 8)
+	second := suite.createTrip(suite.spare.ID, 4, 8)
+	path := fmt.Sprintf("/trips/%d?override_conflicts=true", second.ID)
+
+	status, body := suite.request("PUT", path, suite.carrier.ID, fiber.Map{"vehicle_id": suite.vehicle.ID})
+	assert.Equal(t, 403, status)
+	assert.Equal(t, "Only admins can override vehicle conflicts", body["error"])
+	status, _ = suite.request("PUT", path, suite.admin.ID, fiber.Map{"vehicle_id": suite.vehicle.ID})
+	assert.Equal(t, 200, status)
+
+	departure := suite.departed.Add(6 * time.Hour)
+	trip := fiber.Map{"vehicle_id": suite.vehicle.ID, "departure_date": departure, "estimated_arrival": departure.Add(4 * time.Hour)}
+	status, _ = suite.request("POST", "/trips", suite.carrier.ID, trip)
+	assert.Equal(t, 409, status)
+	status, body = suite.request("POST", "/trips?override_conflicts=true", suite.admin.ID, trip)
+	suite.Require().Equal(200, status)
+	third := uint(body["id"].(float64))
+
+	// Each pair of overlapping trips is a conflict
+	conflicts := suite.conflicts("/users/me/vehicles/conflicts", suite.carrier.ID)
+	suite.Require().Len(conflicts, 3)
+	conflict := conflicts[0].(map[string]interface{})
+	assert.Equal(t, "FLEET-1", conflict["license_plate"])
+	trips := conflict["trips"].([]interface{})
+	assert.Equal(t, float64(first.ID), trips[0].(map[string]interface{})["trip_id"])
+	assert.Equal(t, float64(second.ID), trips[1].(map[string]interface{})["trip_id"])
+	assert.Equal(t, suite.departed.Add(4*time.Hour).Format(time.RFC3339), conflict["overlap_starts_at"])
+	assert.Equal(t, suite.departed.Add(8*time.Hour).Format(time.RFC3339), conflict["overlap_ends_at"])
+	last := conflicts[2].(map[string]interface{})["trips"].([]interface{})
+	assert.Equal(t, float64(third), last[1].(map[string]interface{})["trip_id"])
+
+	assert.Empty(t, suite.conflicts("/users/me/vehicles/conflicts", suite.other.ID))
+	assert.Len(t, suite.conflicts("/admin/vehicles/conflicts", suite.admin.ID), 3)
+
+	// Cancelled trips free the vehicle
+	testDB.Model(&models.Trip{}).Where("id IN ?", []uint{second.ID, third}).Update("status", "CANCELLED")
+	assert.Empty(t, suite.conflicts("/admin/vehicles/conflicts", suite.admin.ID))
+}
+
+func (suite *VehicleBookingTestSuite) TestUpdateValidation() {
+	t := suite.T()
+	trip := suite.createTrip(suite.vehicle.ID, 0, 8)
+	testDB.Model(&trip).Update("used_weight", 600)
+	path := fmt.Sprintf("/trips/%d", trip.ID)
+
+	status, _ := suite.request("PUT", path, suite.other.ID, fiber.Map{"notes": "Mine now"})
+	assert.Equal(t, 403, status)
+	status, body := suite.request("PUT", path, suite.carrier.ID, fiber.Map{"total_capacity_weight": 500})
+	assert.Equal(t, 400, status)
+	assert.Equal(t, "The capacity can't be less than what's booked on the trip", body["error"])
+	status, _ = suite.request("PUT", path, suite.carrier.ID, fiber.Map{"estimated_arrival": suite.departed.Add(-time.Hour)})
+	assert.Equal(t, 400, status)
+
+	testDB.Model(&trip).Update("status", "COMPLETED")
+	status, body = suite.request("PUT", path, suite.carrier.ID, fiber.Map{"notes": "Late"})
+	assert.Equal(t, 400, status)
+	assert.Equal(t, "The trip is COMPLETED and can't be changed", body["error"])
+}
+
+func TestVehicleBookingTestSuite(t *testing.T) {
+	suite.Run(t, new(VehicleBookingTestSuite))
+}
@@ -2,12 +2,21 @@ package handlers
 
 import (
 	"strconv"
+	"time"
+	"triplink/backend/config"
 	"triplink/backend/database"
 	"triplink/backend/models"
+	"triplink/backend/services"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+var vehicleComplianceConfig = config.GetVehicleComplianceConfig()
+
+var vehicleComplianceService = services.NewVehicleComplianceService(database.DB, vehicleComplianceConfig.ReminderDays)
+
+var vehicleBookingService = services.NewVehicleBookingService(database.DB)
+
 // CreateVehicle @Summary Create a new vehicle
 // @Description Create a new vehicle for a carrier
 // @Tags vehicles
@@ -181,3 +190,109 @@ func SearchVehicles(c *fiber.Ctx) error {
 
 	return c.JSON(vehicles)
 }
+
+// GetVehicleCompliance @Summary Get vehicle compliance
+// @Description Check a vehicle's insurance, registration and inspection expiry dates
+// @Tags vehicles
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Success 200 {object} services.VehicleComplianceStatus
+// @Router /vehicles/{id}/compliance [get]
+func GetVehicleCompliance(c *fiber.Ctx) error {
+	vehicleID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid vehicle ID",
+		})
+	}
+
+	status, err := vehicleComplianceService.GetVehicleCompliance(uint(vehicleID))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(status)
+}
+
+// GetUserVehicleExpirations @Summary Get upcoming vehicle document expirations
+// @Description List expired and soon to expire insurance, registration and inspection dates of a carrier's vehicles
+// @Tags vehicles
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param days query int false "Look-ahead window in days (default 30)"
+// @Success 200 {object} map[string]interface{}
+// @Router /users/{user_id}/vehicles/expirations [get]
+func GetUserVehicleExpirations(c *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(c.Params("user_id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	days := c.QueryInt("days", 30)
+	if days <= 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Days must be positive",
+		})
+	}
+
+	expirations, err := vehicleComplianceService.GetUpcomingExpirations(uint(userID), days)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch vehicle expirations",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"user_id":     userID,
+		"days":        days,
+		"expirations": expirations,
+		"count":       len(expirations),
+	})
+}
+
+// GetMyVehicleConflicts @Summary Get the current carrier's vehicle conflicts
+// @Description List pairs of trips booked on the same vehicle of the current carrier at the same time that haven't ended, e.g. trips booked with an admin's override
+// @Tags vehicles
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /users/me/vehicles/conflicts [get]
+func GetMyVehicleConflicts(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	return vehicleConflicts(c, uint(userID))
+}
+
+// GetVehicleConflicts @Summary Get vehicle conflicts
+// @Description List pairs of trips booked on the same vehicle at the same time that haven't ended, across every carrier
+// @Tags admin
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/vehicles/conflicts [get]
+func GetVehicleConflicts(c *fiber.Ctx) error {
+	return vehicleConflicts(c, 0)
+}
+
+// vehicleConflicts responds with the vehicle conflicts of a carrier, or of
+// every carrier when carrierID is 0
+func vehicleConflicts(c *fiber.Ctx, carrierID uint) error {
+	conflicts, err := vehicleBookingService.GetConflicts(carrierID, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch vehicle conflicts",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"conflicts": conflicts,
+		"count":     len(conflicts),
+	})
+}
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 	"triplink/backend/models"
+	"triplink/backend/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
@@ -18,6 +21,7 @@ type VehicleHandlerTestSuite struct {
 }
 
 func (suite *VehicleHandlerTestSuite) SetupSuite() {
+	vehicleComplianceService = services.NewVehicleComplianceService(testDB, nil)
 }
 
 func (suite *VehicleHandlerTestSuite) SetupTest() {
@@ -31,6 +35,8 @@ func (suite *VehicleHandlerTestSuite) SetupTest() {
 	suite.app.Put("/vehicles/:id", UpdateVehicle)
 	suite.app.Delete("/vehicles/:id", DeleteVehicle)
 	suite.app.Get("/vehicles/search", SearchVehicles)
+	suite.app.Get("/vehicles/:id/compliance", GetVehicleCompliance)
+	suite.app.Get("/users/:user_id/vehicles/expirations", GetUserVehicleExpirations)
 }
 
 func (suite *VehicleHandlerTestSuite) TearDownTest() {
@@ -105,6 +111,56 @@ func (suite *VehicleHandlerTestSuite) TestSearchVehicles() {
 	assert.Equal(t, 200, resp.StatusCode)
 }
 
+func (suite *VehicleHandlerTestSuite) TestVehicleCompliance() {
+	t := suite.T()
+
+	var vehicle models.Vehicle
+	testDB.Where("license_plate = ?", "TEST123").First(&vehicle)
+	insuranceExpiry := time.Now().AddDate(0, 0, 10)
+	inspectionExpiry := time.Now().AddDate(0, 0, -2)
+	testDB.Model(&vehicle).Updates(map[string]interface{}{
+		"insurance_expiry":  insuranceExpiry,
+		"inspection_expiry": inspectionExpiry,
+	})
+
+	vehicleID := strconv.Itoa(int(vehicle.ID))
+	userID := strconv.Itoa(int(vehicle.UserID))
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedCount  int
+	}{
+		{"Expirations within 30 days", "/users/" + userID + "/vehicles/expirations", 200, 2},
+		{"Expirations within 5 days", "/users/" + userID + "/vehicles/expirations?days=5", 200, 1},
+		{"Invalid days", "/users/" + userID + "/vehicles/expirations?days=0", 400, 0},
+		{"Invalid user ID", "/users/invalid/vehicles/expirations", 400, 0},
+		{"Vehicle compliance", "/vehicles/" + vehicleID + "/compliance", 200, 0},
+		{"Vehicle not found", "/vehicles/99999/compliance", 404, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := suite.app.Test(httptest.NewRequest("GET", tt.url, nil))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+
+			if tt.expectedCount > 0 {
+				var body map[string]interface{}
+				json.NewDecoder(resp.Body).Decode(&body)
+				assert.Equal(t, float64(tt.expectedCount), body["count"])
+			}
+		})
+	}
+
+	resp, err := suite.app.Test(httptest.NewRequest("GET", "/vehicles/"+vehicleID+"/compliance", nil))
+	assert.NoError(t, err)
+	var status map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&status)
+	assert.Equal(t, false, status["compliant"])
+}
+
 func TestVehicleHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(VehicleHandlerTestSuite))
 }
\ No newline at end of file
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"strconv"
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var vehicleMaintenanceService = services.NewVehicleMaintenanceService(database.DB, config.GetVehicleMaintenanceConfig())
+
+// vehicleMaintenanceErrorStatus maps vehicle maintenance service errors to a status
+func vehicleMaintenanceErrorStatus(err error) int {
+	switch err {
+	case services.ErrVehicleNotFound, services.ErrServiceNotSetUp:
+		return 404
+	case services.ErrNotVehicleOwner:
+		return 403
+	case services.ErrInvalidServiceType, services.ErrInvalidIntervalKm, services.ErrInvalidOdometerKm,
+		services.ErrInvalidLastService, services.ErrInvalidWithinKm:
+		return 400
+	}
+	return 500
+}
+
+// maintenanceVehicle returns the current user and the vehicle ID of a
+// vehicle maintenance request, or the status and message to fail it with
+func maintenanceVehicle(c *fiber.Ctx) (uint, uint, int, string) {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return 0, 0, 401, "Unauthorized"
+	}
+
+	vehicleID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, 0, 400, "Invalid vehicle ID"
+	}
+	return uint(userID), uint(vehicleID), 0, ""
+}
+
+// GetVehicleMaintenance @Summary Get vehicle maintenance
+// @Description Get a vehicle's odometer, the kilometers tracked on its trips and, for each service set up, how far it is from being due and the date it is expected due at its recent daily distance
+// @Tags vehicles
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Success 200 {object} services.VehicleMaintenanceStatus
+// @Router /vehicles/{id}/maintenance [get]
+func GetVehicleMaintenance(c *fiber.Ctx) error {
+	userID, vehicleID, status, message := maintenanceVehicle(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	maintenance, err := vehicleMaintenanceService.GetMaintenance(userID, vehicleID)
+	if err != nil {
+		return c.Status(vehicleMaintenanceErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(maintenance)
+}
+
+// SetVehicleServiceInterval @Summary Set up a vehicle service interval
+// @Description Set how many kilometers a vehicle goes between oil changes, tire services or inspections, and when it was last serviced. The carrier is notified when the service comes due and again when it is overdue.
+// @Tags vehicles
+// @Accept json
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Param service_type path string true "OIL, TIRES or INSPECTION"
+// @Param interval body services.ServiceIntervalRequest true "Interval, defaulting to the configured one"
+// @Success 200 {object} models.VehicleServiceInterval
+// @Router /vehicles/{id}/maintenance/{service_type} [put]
+func SetVehicleServiceInterval(c *fiber.Ctx) error {
+	userID, vehicleID, status, message := maintenanceVehicle(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	var req services.ServiceIntervalRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+	}
+
+	interval, err := vehicleMaintenanceService.SetServiceInterval(userID, vehicleID, c.Params("service_type"), req)
+	if err != nil {
+		return c.Status(vehicleMaintenanceErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(interval)
+}
+
+// CompleteVehicleService @Summary Record a vehicle service
+// @Description Record that a vehicle was serviced at its current odometer reading, so the service is next due an interval later
+// @Tags vehicles
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Param service_type path string true "OIL, TIRES or INSPECTION"
+// @Success 200 {object} models.VehicleServiceInterval
+// @Router /vehicles/{id}/maintenance/{service_type}/complete [post]
+func CompleteVehicleService(c *fiber.Ctx) error {
+	userID, vehicleID, status, message := maintenanceVehicle(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	interval, err := vehicleMaintenanceService.CompleteService(userID, vehicleID, c.Params("service_type"))
+	if err != nil {
+		return c.Status(vehicleMaintenanceErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(interval)
+}
+
+// OdometerRequest is a vehicle's odometer reading
+type OdometerRequest struct {
+	OdometerKm *float64 `json:"odometer_km" validate:"required,gte=0"`
+}
+
+// SetVehicleOdometer @Summary Correct a vehicle's odometer
+// @Description Set a vehicle's odometer to its reading. Kilometers tracked on its trips are added to the reading from then on.
+// @Tags vehicles
+// @Accept json
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Param odometer body OdometerRequest true "Odometer reading in km"
+// @Success 200 {object} map[string]interface{}
+// @Failure 422 {object} ValidationErrorResponse
+// @Router /vehicles/{id}/odometer [put]
+func SetVehicleOdometer(c *fiber.Ctx) error {
+	userID, vehicleID, status, message := maintenanceVehicle(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	var req OdometerRequest
+	if err := parseBody(c, &req); err != nil {
+		return invalidRequest(c, err)
+	}
+
+	vehicle, err := vehicleMaintenanceService.SetOdometer(userID, vehicleID, *req.OdometerKm)
+	if err != nil {
+		return c.Status(vehicleMaintenanceErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"vehicle_id":  vehicle.ID,
+		"odometer_km": services.VehicleOdometer(vehicle),
+		"tracked_km":  vehicle.TrackedKm,
+	})
+}
+
+// GetUpcomingVehicleMaintenance @Summary Get upcoming vehicle maintenance
+// @Description List the services of the current carrier's active vehicles that are overdue or due within a distance, most urgent first
+// @Tags vehicles
+// @Produce json
+// @Param within_km query number false "Look-ahead distance in km (default 1000)"
+// @Success 200 {object} map[string]interface{}
+// @Router /users/me/vehicles/maintenance [get]
+func GetUpcomingVehicleMaintenance(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	withinKm := 1000.0
+	if value := c.Query("within_km"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid within_km",
+			})
+		}
+		withinKm = parsed
+	}
+
+	upcoming, err := vehicleMaintenanceService.GetUpcomingMaintenance(uint(userID), withinKm)
+	if err != nil {
+		return c.Status(vehicleMaintenanceErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"within_km": withinKm,
+		"services":  upcoming,
+		"count":     len(upcoming),
+	})
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type VehicleMaintenanceHandlerTestSuite struct {
+	suite.Suite
+	app     *fiber.App
+	carrier models.User
+	other   models.User
+	vehicle models.Vehicle
+	trip    models.Trip
+	buckets int
+}
+
+func (suite *VehicleMaintenanceHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	vehicleMaintenanceService = services.NewVehicleMaintenanceService(testDB, config.GetVehicleMaintenanceConfig())
+	suite.buckets = 0
+
+	suite.carrier = models.User{Email: "maintenance-carrier@example.com", Phone: "+15550000701", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.carrier)
+	suite.other = models.User{Email: "maintenance-other@example.com", Phone: "+15550000702", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.other)
+	suite.vehicle = models.Vehicle{UserID: suite.carrier.ID, LicensePlate: "MNT-001", VIN: "MNT0000000000001", IsActive: true}
+	testDB.Create(&suite.vehicle)
+	suite.trip = models.Trip{UserID: suite.carrier.ID, VehicleID: suite.vehicle.ID, Status: "IN_TRANSIT"}
+	testDB.Create(&suite.trip)
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Get("/vehicles/:id/maintenance", GetVehicleMaintenance)
+	suite.app.Put("/vehicles/:id/maintenance/:service_type", SetVehicleServiceInterval)
+	suite.app.Post("/vehicles/:id/maintenance/:service_type/complete", CompleteVehicleService)
+	suite.app.Put("/vehicles/:id/odometer", SetVehicleOdometer)
+	suite.app.Get("/users/me/vehicles/maintenance", GetUpcomingVehicleMaintenance)
+}
+
+func (suite *VehicleMaintenanceHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+// drive rolls up an hour of the trip driving the given distance, as the
+// tracking rollup would, along with its finer 5 minute aggregate
+func (suite *VehicleMaintenanceHandlerTestSuite) drive(distanceKm float64) {
+	suite.buckets++
+	bucket := time.Now().Truncate(time.Hour).Add(-time.Duration(suite.buckets) * time.Hour)
+	for _, resolution := range []string{services.TrackingResolution1h, services.TrackingResolution5m} {
+		suite.Require().NoError(testDB.Create(&models.TrackingAggregate{
+			TripID:      suite.trip.ID,
+			Resolution:  resolution,
+			BucketStart: bucket,
+			DistanceKm:  distanceKm,
+		}).Error)
+	}
+}
+
+func (suite *VehicleMaintenanceHandlerTestSuite) request(method, url string, userID uint, body interface{}) (int, map[string]interface{}) {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, url, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", fmt.Sprintf("%d", userID))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+func (suite *VehicleMaintenanceHandlerTestSuite) maintenanceNotifications() []models.Notification {
+	var notifications []models.Notification
+	testDB.Where("type = ?", "VEHICLE_MAINTENANCE_DUE").Order("id").Find(&notifications)
+	return notifications
+}
+
+func (suite *VehicleMaintenanceHandlerTestSuite) TestMileageDrivesServicesDue() {
+	t := suite.T()
+	base := fmt.Sprintf("/vehicles/%d", suite.vehicle.ID)
+
+	status, body := suite.request("PUT", base+"/odometer", suite.carrier.ID, fiber.Map{"odometer_km": 100000})
+	suite.Require().Equal(200, status)
+	assert.Equal(t, 100000.0, body["odometer_km"])
+
+	status, body = suite.request("PUT", base+"/maintenance/oil", suite.carrier.ID, fiber.Map{"interval_km": 2000, "last_service_km": 98500})
+	suite.Require().Equal(200, status)
+	assert.Equal(t, services.VehicleServiceOil, body["service_type"])
+	// Tires at the configured interval from the current reading
+	status, body = suite.request("PUT", base+"/maintenance/TIRES", suite.carrier.ID, nil)
+	suite.Require().Equal(200, status)
+	assert.Equal(t, 60000.0, body["interval_km"])
+	assert.Equal(t, 100000.0, body["last_service_km"])
+
+	// 400 km brings the oil change within the due soon distance
+	suite.drive(400)
+	suite.Require().NoError(vehicleMaintenanceService.UpdateMileage())
+	suite.Require().NoError(vehicleMaintenanceService.UpdateMileage())
+	notifications := suite.maintenanceNotifications()
+	suite.Require().Len(notifications, 1)
+	assert.Equal(t, suite.carrier.ID, notifications[0].UserID)
+	assert.Equal(t, "Vehicle MNT-001 is due its oil change in 100 km, at 100500 km", notifications[0].Message)
+
+	status, body = suite.request("GET", "/users/me/vehicles/maintenance", suite.carrier.ID, nil)
+	suite.Require().Equal(200, status)
+	suite.Require().Equal(1.0, body["count"])
+	upcoming := body["services"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, services.MaintenanceDueSoon, upcoming["status"])
+	assert.Equal(t, 100.0, upcoming["remaining_km"])
+	assert.NotNil(t, upcoming["estimated_due_date"])
+
+	// And 300 km more makes it overdue, told in the carrier's miles
+	suite.Require().NoError(testDB.Model(&suite.carrier).Update("unit_system", "imperial").Error)
+	suite.drive(300)
+	suite.Require().NoError(vehicleMaintenanceService.UpdateMileage())
+	notifications = suite.maintenanceNotifications()
+	suite.Require().Len(notifications, 2)
+	assert.Equal(t, "Vehicle MNT-001 is 124 mi overdue for its oil change, due at 62448 mi", notifications[1].Message)
+
+	status, body = suite.request("GET", base+"/maintenance", suite.carrier.ID, nil)
+	suite.Require().Equal(200, status)
+	assert.Equal(t, 100700.0, body["odometer_km"])
+	assert.Equal(t, 700.0, body["tracked_km"])
+	assert.InDelta(t, 700.0/30, body["average_daily_km"], 0.01)
+	suite.Require().Len(body["services"], 2)
+
+	// Once changed, the oil is next due an interval later
+	status, body = suite.request("POST", base+"/maintenance/OIL/complete", suite.carrier.ID, nil)
+	suite.Require().Equal(200, status)
+	assert.Equal(t, 100700.0, body["last_service_km"])
+	assert.NotNil(t, body["last_service_at"])
+
+	status, body = suite.request("GET", "/users/me/vehicles/maintenance", suite.carrier.ID, nil)
+	suite.Require().Equal(200, status)
+	assert.Equal(t, 0.0, body["count"])
+	suite.Require().NoError(vehicleMaintenanceService.UpdateMileage())
+	assert.Len(t, suite.maintenanceNotifications(), 2)
+}
+
+func (suite *VehicleMaintenanceHandlerTestSuite) TestMaintenanceValidationAndAccess() {
+	t := suite.T()
+	base := fmt.Sprintf("/vehicles/%d", suite.vehicle.ID)
+
+	status, _ := suite.request("GET", base+"/maintenance", suite.other.ID, nil)
+	assert.Equal(t, 403, status)
+	status, _ = suite.request("GET", "/vehicles/99999/maintenance", suite.carrier.ID, nil)
+	assert.Equal(t, 404, status)
+
+	status, _ = suite.request("PUT", base+"/maintenance/BRAKES", suite.carrier.ID, nil)
+	assert.Equal(t, 400, status)
+	status, _ = suite.request("PUT", base+"/maintenance/OIL", suite.carrier.ID, fiber.Map{"last_service_km": 500})
+	assert.Equal(t, 400, status)
+	status, _ = suite.request("POST", base+"/maintenance/INSPECTION/complete", suite.carrier.ID, nil)
+	assert.Equal(t, 404, status)
+
+	status, _ = suite.request("PUT", base+"/odometer", suite.carrier.ID, fiber.Map{})
+	assert.Equal(t, 422, status)
+	status, _ = suite.request("PUT", base+"/odometer", suite.carrier.ID, fiber.Map{"odometer_km": -1})
+	assert.Equal(t, 422, status)
+	status, _ = suite.request("GET", "/users/me/vehicles/maintenance?within_km=-5", suite.carrier.ID, nil)
+	assert.Equal(t, 400, status)
+}
+
+func TestVehicleMaintenanceHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(VehicleMaintenanceHandlerTestSuite))
+}
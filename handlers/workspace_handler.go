@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"strconv"
+	"triplink/backend/database"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var workspaceService = services.NewWorkspaceService(database.DB)
+
+// viewSavedFilter returns the saved filter a tracking view was asked to
+// apply with filter_id, or nil when none was
+func viewSavedFilter(c *fiber.Ctx, userID uint, view string) (*models.SavedFilter, int, string) {
+	if c.Query("filter_id") == "" {
+		return nil, 0, ""
+	}
+	filterID, err := strconv.ParseUint(c.Query("filter_id"), 10, 32)
+	if err != nil {
+		return nil, 400, "Invalid filter ID"
+	}
+
+	filter, err := workspaceService.GetSavedFilter(userID, uint(filterID))
+	if err != nil {
+		return nil, 404, err.Error()
+	}
+	if filter.View != view {
+		return nil, 400, "The saved filter is not a filter of " + view
+	}
+	return filter, 0, ""
+}
+
+// GetWorkspace @Summary Get the current user's workspace
+// @Description Get the current user's saved filters and dashboards, to restore their workspace from
+// @Tags workspace
+// @Produce json
+// @Param view query string false "Only saved filters of this view: TRIPS or LOADS"
+// @Success 200 {object} services.Workspace
+// @Router /workspace [get]
+func GetWorkspace(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	workspace, err := workspaceService.GetWorkspace(uint(userID), c.Query("view"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch workspace",
+		})
+	}
+
+	return c.JSON(workspace)
+}
+
+// CreateSavedFilter @Summary Save a filter
+// @Description Save a named set of trip or load filters: statuses, a lane's origin and destination cities and a date range, fixed or relative to the day it is applied. Marking a filter the default clears the flag on the user's other filters of its view.
+// @Tags workspace
+// @Accept json
+// @Produce json
+// @Param filter body services.SavedFilterRequest true "Filter"
+// @Success 201 {object} models.SavedFilter
+// @Router /saved-filters [post]
+func CreateSavedFilter(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req services.SavedFilterRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	filter, err := workspaceService.CreateSavedFilter(uint(userID), req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(filter)
+}
+
+// GetSavedFilters @Summary Get saved filters
+// @Description Get the current user's saved filters by name
+// @Tags workspace
+// @Produce json
+// @Param view query string false "Only filters of this view: TRIPS or LOADS"
+// @Success 200 {array} models.SavedFilter
+// @Router /saved-filters [get]
+func GetSavedFilters(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	filters, err := workspaceService.GetSavedFilters(uint(userID), c.Query("view"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch saved filters",
+		})
+	}
+
+	return c.JSON(filters)
+}
+
+// UpdateSavedFilter @Summary Update a saved filter
+// @Description Replace the filters of one of the current user's saved filters
+// @Tags workspace
+// @Accept json
+// @Produce json
+// @Param id path int true "Filter ID"
+// @Param filter body services.SavedFilterRequest true "Filter"
+// @Success 200 {object} models.SavedFilter
+// @Router /saved-filters/{id} [put]
+func UpdateSavedFilter(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	filterID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid filter ID",
+		})
+	}
+
+	var req services.SavedFilterRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	filter, err := workspaceService.UpdateSavedFilter(uint(userID), uint(filterID), req)
+	if err != nil {
+		status := 400
+		if err == services.ErrSavedFilterNotFound {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(filter)
+}
+
+// DeleteSavedFilter @Summary Delete a saved filter
+// @Description Delete one of the current user's saved filters. Dashboard widgets showing it show everything instead.
+// @Tags workspace
+// @Param id path int true "Filter ID"
+// @Success 204
+// @Router /saved-filters/{id} [delete]
+func DeleteSavedFilter(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	filterID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid filter ID",
+		})
+	}
+
+	if err := workspaceService.DeleteSavedFilter(uint(userID), uint(filterID)); err != nil {
+		status := 500
+		if err == services.ErrSavedFilterNotFound {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.SendStatus(204)
+}
+
+// CreateDashboard @Summary Create a dashboard
+// @Description Create a dashboard laying out widgets on a grid. Widgets listing trips or loads can show one of the user's saved filters.
+// @Tags workspace
+// @Accept json
+// @Produce json
+// @Param dashboard body services.DashboardRequest true "Dashboard"
+// @Success 201 {object} models.Dashboard
+// @Router /dashboards [post]
+func CreateDashboard(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req services.DashboardRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	dashboard, err := workspaceService.CreateDashboard(uint(userID), req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(dashboard)
+}
+
+// GetDashboards @Summary Get dashboards
+// @Description Get the current user's dashboards by name, with their widgets
+// @Tags workspace
+// @Produce json
+// @Success 200 {array} models.Dashboard
+// @Router /dashboards [get]
+func GetDashboards(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	dashboards, err := workspaceService.GetDashboards(uint(userID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Could not fetch dashboards",
+		})
+	}
+
+	return c.JSON(dashboards)
+}
+
+// GetDashboard @Summary Get a dashboard
+// @Description Get one of the current user's dashboards with its widgets
+// @Tags workspace
+// @Produce json
+// @Param id path int true "Dashboard ID"
+// @Success 200 {object} models.Dashboard
+// @Router /dashboards/{id} [get]
+func GetDashboard(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	dashboardID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid dashboard ID",
+		})
+	}
+
+	dashboard, err := workspaceService.GetDashboard(uint(userID), uint(dashboardID))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(dashboard)
+}
+
+// UpdateDashboard @Summary Update a dashboard
+// @Description Rename one of the current user's dashboards and replace its widgets
+// @Tags workspace
+// @Accept json
+// @Produce json
+// @Param id path int true "Dashboard ID"
+// @Param dashboard body services.DashboardRequest true "Dashboard"
+// @Success 200 {object} models.Dashboard
+// @Router /dashboards/{id} [put]
+func UpdateDashboard(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	dashboardID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid dashboard ID",
+		})
+	}
+
+	var req services.DashboardRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	dashboard, err := workspaceService.UpdateDashboard(uint(userID), uint(dashboardID), req)
+	if err != nil {
+		status := 400
+		if err == services.ErrDashboardNotFound {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(dashboard)
+}
+
+// DeleteDashboard @Summary Delete a dashboard
+// @Description Delete one of the current user's dashboards with its widgets
+// @Tags workspace
+// @Param id path int true "Dashboard ID"
+// @Success 204
+// @Router /dashboards/{id} [delete]
+func DeleteDashboard(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(float64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	dashboardID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid dashboard ID",
+		})
+	}
+
+	if err := workspaceService.DeleteDashboard(uint(userID), uint(dashboardID)); err != nil {
+		status := 500
+		if err == services.ErrDashboardNotFound {
+			status = 404
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.SendStatus(204)
+}
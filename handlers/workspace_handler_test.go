@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+)
+
+type WorkspaceHandlerTestSuite struct {
+	suite.Suite
+	app        *fiber.App
+	dispatcher models.User
+	other      models.User
+}
+
+func (suite *WorkspaceHandlerTestSuite) SetupTest() {
+	clearTestDB()
+	workspaceService = services.NewWorkspaceService(testDB)
+	organizationService = services.NewOrganizationService(testDB)
+	tripAssignmentService = services.NewTripAssignmentService(testDB)
+	trackingService = services.NewTrackingService(testDB)
+
+	suite.dispatcher = models.User{Email: "dispatch@haulage.example", Phone: "+15550000030", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.dispatcher)
+	suite.other = models.User{Email: "other@example.com", Phone: "+15550000031", Password: "password", Role: "CARRIER"}
+	testDB.Create(&suite.other)
+
+	suite.app = fiber.New()
+	suite.app.Use(asHeaderUser())
+	suite.app.Get("/workspace", GetWorkspace)
+	suite.app.Post("/saved-filters", CreateSavedFilter)
+	suite.app.Get("/saved-filters", GetSavedFilters)
+	suite.app.Put("/saved-filters/:id", UpdateSavedFilter)
+	suite.app.Delete("/saved-filters/:id", DeleteSavedFilter)
+	suite.app.Post("/dashboards", CreateDashboard)
+	suite.app.Get("/dashboards", GetDashboards)
+	suite.app.Get("/dashboards/:id", GetDashboard)
+	suite.app.Put("/dashboards/:id", UpdateDashboard)
+	suite.app.Delete("/dashboards/:id", DeleteDashboard)
+	suite.app.Get("/users/:user_id/tracking/carrier-view", GetCarrierTrackingView)
+	suite.app.Get("/users/:user_id/tracking/shipper-view", GetShipperTrackingView)
+}
+
+func (suite *WorkspaceHandlerTestSuite) TearDownTest() {
+	clearTestDB()
+}
+
+func (suite *WorkspaceHandlerTestSuite) request(method, path string, userID uint, body interface{}, out interface{}) int {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func (suite *WorkspaceHandlerTestSuite) createFilter(body fiber.Map) models.SavedFilter {
+	var filter models.SavedFilter
+	status := suite.request("POST", "/saved-filters", suite.dispatcher.ID, body, &filter)
+	suite.Require().Equal(201, status)
+	return filter
+}
+
+func (suite *WorkspaceHandlerTestSuite) TestSavedFilters() {
+	suite.Run("Creates a filter", func() {
+		filter := suite.createFilter(fiber.Map{
+			"name":        "Harare outbound",
+			"view":        "trips",
+			"statuses":    []string{"planned", " in_transit"},
+			"origin_city": "Harare",
+			"days_ahead":  7,
+			"is_default":  true,
+		})
+		suite.Equal("TRIPS", filter.View)
+		suite.Equal("PLANNED,IN_TRANSIT", filter.Statuses)
+		suite.Equal(suite.dispatcher.ID, filter.UserID)
+		suite.Require().NotNil(filter.DaysAhead)
+		suite.Equal(7, *filter.DaysAhead)
+		suite.True(filter.IsDefault)
+	})
+
+	suite.Run("Rejects invalid filters", func() {
+		bodies := []fiber.Map{
+			{"view": "TRIPS"},
+			{"name": "Everything", "view": "INVOICES"},
+			{"name": "Mixed", "view": "TRIPS", "date_from": time.Now(), "days_back": 3},
+			{"name": "Backwards", "view": "LOADS", "date_from": time.Now(), "date_to": time.Now().Add(-time.Hour)},
+		}
+		for _, body := range bodies {
+			status := suite.request("POST", "/saved-filters", suite.dispatcher.ID, body, nil)
+			suite.Equal(400, status, body)
+		}
+	})
+
+	suite.Run("Keeps one default filter per view", func() {
+		loads := suite.createFilter(fiber.Map{"name": "Open loads", "view": "LOADS", "is_default": true})
+		trips := suite.createFilter(fiber.Map{"name": "Late trips", "view": "TRIPS", "statuses": []string{"DELAYED"}, "is_default": true})
+
+		var filters []models.SavedFilter
+		status := suite.request("GET", "/saved-filters?view=TRIPS", suite.dispatcher.ID, nil, &filters)
+		suite.Equal(200, status)
+		suite.Require().Len(filters, 2)
+		for _, filter := range filters {
+			suite.Equal(filter.ID == trips.ID, filter.IsDefault, filter.Name)
+		}
+
+		status = suite.request("GET", "/saved-filters?view=LOADS", suite.dispatcher.ID, nil, &filters)
+		suite.Equal(200, status)
+		suite.Require().Len(filters, 1)
+		suite.Equal(loads.ID, filters[0].ID)
+		suite.True(filters[0].IsDefault)
+	})
+
+	suite.Run("Updates and deletes only the user's own filters", func() {
+		filter := suite.createFilter(fiber.Map{"name": "Bulawayo", "view": "TRIPS"})
+		path := fmt.Sprintf("/saved-filters/%d", filter.ID)
+
+		status := suite.request("PUT", path, suite.other.ID, fiber.Map{"name": "Mine", "view": "TRIPS"}, nil)
+		suite.Equal(404, status)
+		status = suite.request("DELETE", path, suite.other.ID, nil, nil)
+		suite.Equal(404, status)
+
+		var updated models.SavedFilter
+		status = suite.request("PUT", path, suite.dispatcher.ID, fiber.Map{"name": "Bulawayo inbound", "view": "TRIPS", "destination_city": "Bulawayo"}, &updated)
+		suite.Equal(200, status)
+		suite.Equal("Bulawayo inbound", updated.Name)
+		suite.Equal("Bulawayo", updated.DestinationCity)
+
+		status = suite.request("DELETE", path, suite.dispatcher.ID, nil, nil)
+		suite.Equal(204, status)
+		status = suite.request("DELETE", path, suite.dispatcher.ID, nil, nil)
+		suite.Equal(404, status)
+	})
+}
+
+func (suite *WorkspaceHandlerTestSuite) TestDashboards() {
+	filter := suite.createFilter(fiber.Map{"name": "In transit", "view": "TRIPS", "statuses": []string{"IN_TRANSIT"}})
+
+	var dashboard models.Dashboard
+	status := suite.request("POST", "/dashboards", suite.dispatcher.ID, fiber.Map{
+		"name":       "Operations",
+		"is_default": true,
+		"widgets": []fiber.Map{
+			{"type": "trip_list", "title": "On the road", "filter_id": filter.ID, "x": 0, "y": 1, "width": 6, "height": 4},
+			{"type": "MAP", "x": 0, "y": 0, "width": 12, "height": 1},
+		},
+	}, &dashboard)
+	suite.Require().Equal(201, status)
+	suite.True(dashboard.IsDefault)
+	suite.Require().Len(dashboard.Widgets, 2)
+	// Widgets come back in grid order
+	suite.Equal("MAP", dashboard.Widgets[0].Type)
+	suite.Equal("TRIP_LIST", dashboard.Widgets[1].Type)
+	suite.Require().NotNil(dashboard.Widgets[1].FilterID)
+	suite.Equal(filter.ID, *dashboard.Widgets[1].FilterID)
+
+	suite.Run("Rejects invalid widgets", func() {
+		otherFilter := models.SavedFilter{UserID: suite.other.ID, Name: "Theirs", View: "TRIPS"}
+		testDB.Create(&otherFilter)
+
+		widgets := []fiber.Map{
+			{"type": "CHART", "x": 0, "y": 0, "width": 1, "height": 1},
+			{"type": "KPI", "x": -1, "y": 0, "width": 1, "height": 1},
+			{"type": "KPI", "x": 0, "y": 0, "width": 0, "height": 1},
+			{"type": "TRIP_LIST", "filter_id": otherFilter.ID, "x": 0, "y": 0, "width": 1, "height": 1},
+		}
+		for _, widget := range widgets {
+			status := suite.request("POST", "/dashboards", suite.dispatcher.ID, fiber.Map{"name": "Broken", "widgets": []fiber.Map{widget}}, nil)
+			suite.Equal(400, status, widget)
+		}
+	})
+
+	suite.Run("Replaces widgets and keeps one default dashboard", func() {
+		var second models.Dashboard
+		status := suite.request("POST", "/dashboards", suite.dispatcher.ID, fiber.Map{
+			"name":       "Finance",
+			"is_default": true,
+			"widgets":    []fiber.Map{{"type": "KPI", "x": 0, "y": 0, "width": 3, "height": 2}},
+		}, &second)
+		suite.Require().Equal(201, status)
+
+		var updated models.Dashboard
+		status = suite.request("PUT", fmt.Sprintf("/dashboards/%d", second.ID), suite.dispatcher.ID, fiber.Map{
+			"name":       "Finance",
+			"is_default": true,
+			"widgets":    []fiber.Map{{"type": "ALERTS", "x": 0, "y": 0, "width": 4, "height": 2}},
+		}, &updated)
+		suite.Equal(200, status)
+		suite.Require().Len(updated.Widgets, 1)
+		suite.Equal("ALERTS", updated.Widgets[0].Type)
+
+		var widgets int64
+		testDB.Model(&models.DashboardWidget{}).Where("dashboard_id = ?", second.ID).Count(&widgets)
+		suite.Equal(int64(1), widgets)
+
+		var first models.Dashboard
+		status = suite.request("GET", fmt.Sprintf("/dashboards/%d", dashboard.ID), suite.dispatcher.ID, nil, &first)
+		suite.Equal(200, status)
+		suite.False(first.IsDefault)
+	})
+
+	suite.Run("Deleting a filter clears it from widgets", func() {
+		status := suite.request("DELETE", fmt.Sprintf("/saved-filters/%d", filter.ID), suite.dispatcher.ID, nil, nil)
+		suite.Equal(204, status)
+
+		var reloaded models.Dashboard
+		status = suite.request("GET", fmt.Sprintf("/dashboards/%d", dashboard.ID), suite.dispatcher.ID, nil, &reloaded)
+		suite.Equal(200, status)
+		suite.Require().Len(reloaded.Widgets, 2)
+		suite.Nil(reloaded.Widgets[1].FilterID)
+	})
+
+	suite.Run("Only the user's own dashboards", func() {
+		status := suite.request("GET", fmt.Sprintf("/dashboards/%d", dashboard.ID), suite.other.ID, nil, nil)
+		suite.Equal(404, status)
+		status = suite.request("DELETE", fmt.Sprintf("/dashboards/%d", dashboard.ID), suite.other.ID, nil, nil)
+		suite.Equal(404, status)
+
+		var dashboards []models.Dashboard
+		status = suite.request("GET", "/dashboards", suite.other.ID, nil, &dashboards)
+		suite.Equal(200, status)
+		suite.Empty(dashboards)
+
+		status = suite.request("DELETE", fmt.Sprintf("/dashboards/%d", dashboard.ID), suite.dispatcher.ID, nil, nil)
+		suite.Equal(204, status)
+	})
+}
+
+func (suite *WorkspaceHandlerTestSuite) TestTrackingViewsRestoreWorkspace() {
+	now := time.Now()
+	trips := []models.Trip{
+		{UserID: suite.dispatcher.ID, OriginCity: "Harare", DestinationCity: "Bulawayo", Status: "PLANNED", DepartureDate: now.Add(48 * time.Hour), EstimatedArrival: now.Add(54 * time.Hour)},
+		{UserID: suite.dispatcher.ID, OriginCity: "Harare", DestinationCity: "Mutare", Status: "PLANNED", DepartureDate: now.Add(20 * 24 * time.Hour), EstimatedArrival: now.Add(20*24*time.Hour + 4*time.Hour)},
+		{UserID: suite.dispatcher.ID, OriginCity: "Gweru", DestinationCity: "Bulawayo", Status: "PLANNED", DepartureDate: now.Add(24 * time.Hour), EstimatedArrival: now.Add(26 * time.Hour)},
+		{UserID: suite.dispatcher.ID, OriginCity: "Harare", DestinationCity: "Gweru", Status: "COMPLETED", DepartureDate: now.Add(-72 * time.Hour), EstimatedArrival: now.Add(-68 * time.Hour)},
+	}
+	for i := range trips {
+		testDB.Create(&trips[i])
+	}
+
+	filter := suite.createFilter(fiber.Map{
+		"name":        "Harare this week",
+		"view":        "TRIPS",
+		"statuses":    []string{"PLANNED"},
+		"origin_city": "harare",
+		"days_ahead":  7,
+		"is_default":  true,
+	})
+	loadFilter := suite.createFilter(fiber.Map{"name": "Open loads", "view": "LOADS"})
+	var dashboard models.Dashboard
+	status := suite.request("POST", "/dashboards", suite.dispatcher.ID, fiber.Map{
+		"name":    "Operations",
+		"widgets": []fiber.Map{{"type": "TRIP_LIST", "filter_id": filter.ID, "x": 0, "y": 0, "width": 6, "height": 4}},
+	}, &dashboard)
+	suite.Require().Equal(201, status)
+
+	suite.Run("Returns the workspace with the view", func() {
+		var view struct {
+			TotalTrips int                `json:"total_trips"`
+			Workspace  services.Workspace `json:"workspace"`
+		}
+		path := fmt.Sprintf("/users/%d/tracking/carrier-view", suite.dispatcher.ID)
+		status := suite.request("GET", path, suite.dispatcher.ID, nil, &view)
+		suite.Equal(200, status)
+		suite.Equal(4, view.TotalTrips)
+		suite.Require().Len(view.Workspace.SavedFilters, 1)
+		suite.Equal(filter.ID, view.Workspace.SavedFilters[0].ID)
+		suite.Require().Len(view.Workspace.Dashboards, 1)
+		suite.Equal(dashboard.ID, view.Workspace.Dashboards[0].ID)
+		suite.Len(view.Workspace.Dashboards[0].Widgets, 1)
+	})
+
+	suite.Run("Applies a saved filter", func() {
+		var view struct {
+			TrackingData  []map[string]interface{} `json:"tracking_data"`
+			AppliedFilter *models.SavedFilter      `json:"applied_filter"`
+		}
+		path := fmt.Sprintf("/users/%d/tracking/carrier-view?filter_id=%d", suite.dispatcher.ID, filter.ID)
+		status := suite.request("GET", path, suite.dispatcher.ID, nil, &view)
+		suite.Equal(200, status)
+		suite.Require().Len(view.TrackingData, 1)
+		suite.Equal(float64(trips[0].ID), view.TrackingData[0]["trip_id"])
+		suite.Require().NotNil(view.AppliedFilter)
+		suite.Equal(filter.ID, view.AppliedFilter.ID)
+	})
+
+	suite.Run("Rejects filters of other views and users", func() {
+		path := fmt.Sprintf("/users/%d/tracking/carrier-view?filter_id=%d", suite.dispatcher.ID, loadFilter.ID)
+		status := suite.request("GET", path, suite.dispatcher.ID, nil, nil)
+		suite.Equal(400, status)
+
+		path = fmt.Sprintf("/users/%d/tracking/carrier-view?filter_id=%d", suite.other.ID, filter.ID)
+		status = suite.request("GET", path, suite.other.ID, nil, nil)
+		suite.Equal(404, status)
+	})
+
+	suite.Run("Returns load filters with the shipper view", func() {
+		var view struct {
+			Workspace services.Workspace `json:"workspace"`
+		}
+		path := fmt.Sprintf("/users/%d/tracking/shipper-view", suite.dispatcher.ID)
+		status := suite.request("GET", path, suite.dispatcher.ID, nil, &view)
+		suite.Equal(200, status)
+		suite.Require().Len(view.Workspace.SavedFilters, 1)
+		suite.Equal(loadFilter.ID, view.Workspace.SavedFilters[0].ID)
+	})
+}
+
+func TestWorkspaceHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkspaceHandlerTestSuite))
+}
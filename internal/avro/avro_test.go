@@ -0,0 +1,55 @@
+package avro
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	// Vectors of the Avro specification's schema tests
+	vectors := map[string]int64{
+		`"null"`:   7195948357588979594,
+		`"int"`:    8247732601305521295,
+		`"string"`: -8142146995180207161,
+	}
+	for schema, expected := range vectors {
+		if fp := int64(Fingerprint(schema)); fp != expected {
+			t.Errorf("Fingerprint(%s) = %d, expected %d", schema, fp, expected)
+		}
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	e := &Encoder{}
+	e.Long(0)
+	e.Long(-1)
+	e.Long(64)
+	e.Boolean(true)
+	e.String("foo")
+	e.Double(1.5)
+	e.OptionalLong(nil)
+	answer := int64(42)
+	e.OptionalLong(&answer)
+	e.OptionalDouble(nil)
+
+	expected := []byte{
+		0x00, 0x01, 0x80, 0x01, // zigzag varints
+		0x01,
+		0x06, 'f', 'o', 'o',
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xF8, 0x3F, // little-endian IEEE 754
+		0x00,
+		0x02, 0x54,
+		0x00,
+	}
+	if !bytes.Equal(e.Bytes(), expected) {
+		t.Errorf("encoded % X, expected % X", e.Bytes(), expected)
+	}
+}
+
+func TestSingleObject(t *testing.T) {
+	framed := SingleObject(0x0102030405060708, []byte{0xAA})
+	expected := []byte{0xC3, 0x01, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0xAA}
+	if !bytes.Equal(framed, expected) {
+		t.Errorf("framed % X, expected % X", framed, expected)
+	}
+}
@@ -0,0 +1,70 @@
+package geo
+
+import "math"
+
+// BoundingBox is a rectangle of latitudes and longitudes. Boxes that would
+// cross the antimeridian span every longitude instead.
+type BoundingBox struct {
+	MinLat float64 `json:"min_lat"`
+	MinLng float64 `json:"min_lng"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLng float64 `json:"max_lng"`
+}
+
+// BoundsAround returns the box containing every point within radiusKm of a
+// point
+func BoundsAround(lat, lng, radiusKm float64) BoundingBox {
+	return BoundingBox{MinLat: lat, MinLng: lng, MaxLat: lat, MaxLng: lng}.Expand(radiusKm)
+}
+
+// BoundsOf returns the smallest box containing the points, or an empty box
+// for no points
+func BoundsOf(points []Point) BoundingBox {
+	if len(points) == 0 {
+		return BoundingBox{}
+	}
+	box := BoundingBox{MinLat: points[0].Lat, MinLng: points[0].Lng, MaxLat: points[0].Lat, MaxLng: points[0].Lng}
+	for _, point := range points[1:] {
+		box.MinLat = math.Min(box.MinLat, point.Lat)
+		box.MinLng = math.Min(box.MinLng, point.Lng)
+		box.MaxLat = math.Max(box.MaxLat, point.Lat)
+		box.MaxLng = math.Max(box.MaxLng, point.Lng)
+	}
+	return box
+}
+
+// Expand returns the box grown by km on every side, so that it contains every
+// point within km of the original box. Longitude degrees shrink towards the
+// poles, so the longitude margin is taken at the latitude furthest from the
+// equator; near the poles, or when the box would cross the antimeridian, it
+// spans every longitude.
+func (b BoundingBox) Expand(km float64) BoundingBox {
+	latDelta := km / kmPerDegree
+	expanded := BoundingBox{
+		MinLat: math.Max(-90, b.MinLat-latDelta),
+		MaxLat: math.Min(90, b.MaxLat+latDelta),
+	}
+
+	cosLat := math.Cos(radians(math.Max(math.Abs(expanded.MinLat), math.Abs(expanded.MaxLat))))
+	if cosLat < 0.01 {
+		expanded.MinLng, expanded.MaxLng = -180, 180
+		return expanded
+	}
+	lngDelta := km / (kmPerDegree * cosLat)
+	expanded.MinLng = b.MinLng - lngDelta
+	expanded.MaxLng = b.MaxLng + lngDelta
+	if expanded.MinLng < -180 || expanded.MaxLng > 180 {
+		expanded.MinLng, expanded.MaxLng = -180, 180
+	}
+	return expanded
+}
+
+// Contains reports whether a point lies within the box, edges included
+func (b BoundingBox) Contains(lat, lng float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lng >= b.MinLng && lng <= b.MaxLng
+}
+
+// SpansAllLongitudes reports whether the box places no limit on longitude
+func (b BoundingBox) SpansAllLongitudes() bool {
+	return b.MinLng <= -180 && b.MaxLng >= 180
+}
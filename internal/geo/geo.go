@@ -0,0 +1,92 @@
+// Package geo provides the geodesic calculations shared by tracking,
+// matching and search: great-circle distance and bearing, point in polygon
+// tests, bounding boxes, and Google encoded polylines.
+package geo
+
+import "math"
+
+// EarthRadiusKm is the mean radius of the Earth
+const EarthRadiusKm = 6371.0
+
+// kmPerDegree is the length of a degree of latitude
+const kmPerDegree = EarthRadiusKm * math.Pi / 180
+
+// Point is a latitude and longitude in degrees
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// ValidCoordinate reports whether a latitude and longitude are within range
+func ValidCoordinate(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+// Distance returns the great-circle distance in kilometers between two
+// points, using the haversine formula
+func Distance(lat1, lng1, lat2, lng2 float64) float64 {
+	lat1Rad := radians(lat1)
+	lat2Rad := radians(lat2)
+	deltaLat := radians(lat2 - lat1)
+	deltaLng := radians(lng2 - lng1)
+
+	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
+		math.Cos(lat1Rad)*math.Cos(lat2Rad)*math.Sin(deltaLng/2)*math.Sin(deltaLng/2)
+	// Rounding can push a just past 1 for antipodal points
+	a = math.Min(1, a)
+
+	return EarthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// PointDistance returns the great-circle distance in kilometers between two
+// points
+func PointDistance(a, b Point) float64 {
+	return Distance(a.Lat, a.Lng, b.Lat, b.Lng)
+}
+
+// Bearing returns the initial bearing in degrees clockwise from north, in
+// [0, 360), of the great circle from the first point to the second
+func Bearing(lat1, lng1, lat2, lng2 float64) float64 {
+	lat1Rad := radians(lat1)
+	lat2Rad := radians(lat2)
+	deltaLng := radians(lng2 - lng1)
+
+	y := math.Sin(deltaLng) * math.Cos(lat2Rad)
+	x := math.Cos(lat1Rad)*math.Sin(lat2Rad) - math.Sin(lat1Rad)*math.Cos(lat2Rad)*math.Cos(deltaLng)
+	bearing := math.Mod(degrees(math.Atan2(y, x))+360, 360)
+	if bearing >= 360 {
+		bearing = 0
+	}
+	return bearing
+}
+
+// PointInPolygon reports whether a point lies inside a polygon, given by
+// its vertices in order with or without the first repeated at the end.
+// Points are treated as planar, which holds for polygons such as geofences
+// that are small and don't cross the antimeridian.
+func PointInPolygon(point Point, polygon []Point) bool {
+	if len(polygon) < 3 {
+		return false
+	}
+
+	// Count the edges a ray east of the point crosses
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Lat > point.Lat) != (b.Lat > point.Lat) {
+			crossingLng := a.Lng + (point.Lat-a.Lat)*(b.Lng-a.Lng)/(b.Lat-a.Lat)
+			if point.Lng < crossingLng {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
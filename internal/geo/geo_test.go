@@ -0,0 +1,206 @@
+package geo
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// randomPoint generates points spread over the globe for quick.Check
+type randomPoint Point
+
+func (randomPoint) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(randomPoint{
+		Lat: r.Float64()*180 - 90,
+		Lng: r.Float64()*360 - 180,
+	})
+}
+
+var quickConfig = &quick.Config{MaxCount: 2000}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lng1, lat2, lng2 float64
+		expected               float64
+		tolerance              float64
+	}{
+		{"same point", -17.8292, 31.0522, -17.8292, 31.0522, 0, 0.0001},
+		{"Harare to Bulawayo", -17.8292, 31.0522, -20.1325, 28.6265, 361.4, 1},
+		{"New York to Los Angeles", 40.7128, -74.0060, 34.0522, -118.2437, 3935.7, 2},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, 111.19, 0.1},
+		{"pole to pole", 90, 0, -90, 0, math.Pi * EarthRadiusKm, 0.001},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.expected, Distance(tt.lat1, tt.lng1, tt.lat2, tt.lng2), tt.tolerance)
+		})
+	}
+}
+
+func TestDistanceProperties(t *testing.T) {
+	halfCircumference := math.Pi * EarthRadiusKm
+
+	symmetric := func(a, b randomPoint) bool {
+		return math.Abs(Distance(a.Lat, a.Lng, b.Lat, b.Lng)-Distance(b.Lat, b.Lng, a.Lat, a.Lng)) < 1e-6
+	}
+	require.NoError(t, quick.Check(symmetric, quickConfig))
+
+	bounded := func(a, b randomPoint) bool {
+		d := Distance(a.Lat, a.Lng, b.Lat, b.Lng)
+		return d >= 0 && d <= halfCircumference+1e-6 && Distance(a.Lat, a.Lng, a.Lat, a.Lng) == 0
+	}
+	require.NoError(t, quick.Check(bounded, quickConfig))
+
+	triangle := func(a, b, c randomPoint) bool {
+		ab := Distance(a.Lat, a.Lng, b.Lat, b.Lng)
+		bc := Distance(b.Lat, b.Lng, c.Lat, c.Lng)
+		ac := Distance(a.Lat, a.Lng, c.Lat, c.Lng)
+		return ac <= ab+bc+1e-6
+	}
+	require.NoError(t, quick.Check(triangle, quickConfig))
+}
+
+func TestBearing(t *testing.T) {
+	assert.InDelta(t, 0, Bearing(0, 0, 1, 0), 1e-9, "north")
+	assert.InDelta(t, 90, Bearing(0, 0, 0, 1), 1e-9, "east")
+	assert.InDelta(t, 180, Bearing(1, 0, 0, 0), 1e-9, "south")
+	assert.InDelta(t, 270, Bearing(0, 1, 0, 0), 1e-9, "west")
+	assert.InDelta(t, 90, Bearing(0, 179.5, 0, -179.5), 1e-9, "east across the antimeridian")
+
+	inRange := func(a, b randomPoint) bool {
+		bearing := Bearing(a.Lat, a.Lng, b.Lat, b.Lng)
+		return bearing >= 0 && bearing < 360
+	}
+	require.NoError(t, quick.Check(inRange, quickConfig))
+
+	// Along the equator the way back is the opposite direction
+	reverse := func(a, b randomPoint) bool {
+		if math.Abs(a.Lng-b.Lng) < 1e-3 || math.Abs(a.Lng-b.Lng) > 179 {
+			return true
+		}
+		there := Bearing(0, a.Lng, 0, b.Lng)
+		back := Bearing(0, b.Lng, 0, a.Lng)
+		return math.Abs(math.Mod(there-back+360, 360)-180) < 1e-6
+	}
+	require.NoError(t, quick.Check(reverse, quickConfig))
+}
+
+func TestPointInPolygon(t *testing.T) {
+	// A depot yard, not closed
+	yard := []Point{{-17.80, 31.00}, {-17.80, 31.02}, {-17.82, 31.02}, {-17.82, 31.00}}
+	assert.True(t, PointInPolygon(Point{-17.81, 31.01}, yard))
+	assert.False(t, PointInPolygon(Point{-17.79, 31.01}, yard))
+	assert.False(t, PointInPolygon(Point{-17.81, 31.03}, yard))
+
+	// Closed, concave polygon shaped like a U
+	u := []Point{{0, 0}, {0, 3}, {3, 3}, {3, 2}, {1, 2}, {1, 1}, {3, 1}, {3, 0}, {0, 0}}
+	assert.True(t, PointInPolygon(Point{0.5, 1.5}, u))
+	assert.True(t, PointInPolygon(Point{2, 0.5}, u))
+	assert.False(t, PointInPolygon(Point{2, 1.5}, u), "inside the notch")
+
+	assert.False(t, PointInPolygon(Point{0, 0}, yard[:2]), "fewer than 3 vertices")
+
+	// Points strictly inside a box are in it, points outside aren't
+	box := func(a, b, p randomPoint) bool {
+		minLat, maxLat := math.Min(a.Lat, b.Lat), math.Max(a.Lat, b.Lat)
+		minLng, maxLng := math.Min(a.Lng, b.Lng), math.Max(a.Lng, b.Lng)
+		polygon := []Point{{minLat, minLng}, {minLat, maxLng}, {maxLat, maxLng}, {maxLat, minLng}}
+		inside := p.Lat > minLat && p.Lat < maxLat && p.Lng > minLng && p.Lng < maxLng
+		outside := p.Lat < minLat || p.Lat > maxLat || p.Lng < minLng || p.Lng > maxLng
+		got := PointInPolygon(Point(p), polygon)
+		return (!inside || got) && (!outside || !got)
+	}
+	require.NoError(t, quick.Check(box, quickConfig))
+}
+
+func TestBoundsAround(t *testing.T) {
+	bounds := BoundsAround(-17.83, 31.05, 50)
+	assert.InDelta(t, -17.83-50/kmPerDegree, bounds.MinLat, 1e-9)
+	assert.InDelta(t, -17.83+50/kmPerDegree, bounds.MaxLat, 1e-9)
+	assert.False(t, bounds.SpansAllLongitudes())
+
+	assert.True(t, BoundsAround(0, 179.9, 50).SpansAllLongitudes(), "crossing the antimeridian")
+	assert.True(t, BoundsAround(89.9, 10, 50).SpansAllLongitudes(), "near the pole")
+	assert.Equal(t, 90.0, BoundsAround(89.9, 10, 50).MaxLat)
+
+	// Every point within the radius is in the box
+	contains := func(center, target randomPoint) bool {
+		radius := Distance(center.Lat, center.Lng, target.Lat, target.Lng)
+		return BoundsAround(center.Lat, center.Lng, radius+1e-6).Contains(target.Lat, target.Lng)
+	}
+	require.NoError(t, quick.Check(contains, quickConfig))
+
+	// Including points close to the center, which random pairs rarely are
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		center := Point{rng.Float64()*160 - 80, rng.Float64()*340 - 170}
+		target := Point{center.Lat + rng.Float64() - 0.5, center.Lng + rng.Float64() - 0.5}
+		radius := PointDistance(center, target)
+		require.True(t, BoundsAround(center.Lat, center.Lng, radius+1e-6).Contains(target.Lat, target.Lng), "%v %v", center, target)
+	}
+}
+
+func TestBoundsOfAndExpand(t *testing.T) {
+	assert.Equal(t, BoundingBox{}, BoundsOf(nil))
+
+	points := []Point{{-17.8, 31.0}, {-20.1, 28.6}, {-18.9, 32.6}}
+	bounds := BoundsOf(points)
+	assert.Equal(t, BoundingBox{MinLat: -20.1, MinLng: 28.6, MaxLat: -17.8, MaxLng: 32.6}, bounds)
+	for _, point := range points {
+		assert.True(t, bounds.Contains(point.Lat, point.Lng))
+	}
+
+	expanded := bounds.Expand(10)
+	assert.Less(t, expanded.MinLat, bounds.MinLat)
+	assert.Greater(t, expanded.MaxLng, bounds.MaxLng)
+	assert.Equal(t, bounds, bounds.Expand(0))
+}
+
+func TestDecodeFlexiblePolyline(t *testing.T) {
+	// Example from HERE's flexible polyline documentation
+	decoded, err := DecodeFlexiblePolyline("BFoz5xJ67i1B1B7PzIhaxL7Y")
+	require.NoError(t, err)
+	assert.Equal(t, []Point{{50.10228, 8.69821}, {50.10201, 8.69567}, {50.10063, 8.6915}, {50.09878, 8.68752}}, decoded)
+
+	_, err = DecodeFlexiblePolyline("BFoz5xJ67i1B1B7PzIhaxL7")
+	assert.Error(t, err)
+	_, err = DecodeFlexiblePolyline("CFoz5xJ67i1B")
+	assert.Error(t, err)
+}
+
+func TestPolylineRoundTrip(t *testing.T) {
+	// Example from the polyline algorithm's documentation
+	points := []Point{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}
+	assert.Equal(t, "_p~iF~ps|U_ulLnnqC_mqNvxq`@", EncodePolyline(points))
+
+	decoded, err := DecodePolyline("_p~iF~ps|U_ulLnnqC_mqNvxq`@")
+	require.NoError(t, err)
+	assert.Equal(t, points, decoded)
+
+	_, err = DecodePolyline("_p~iF~ps|U_")
+	assert.Error(t, err)
+
+	roundTrip := func(raw []randomPoint) bool {
+		points := make([]Point, len(raw))
+		for i, point := range raw {
+			points[i] = Point(point)
+		}
+		decoded, err := DecodePolyline(EncodePolyline(points))
+		if err != nil || len(decoded) != len(points) {
+			return false
+		}
+		for i := range points {
+			if math.Abs(decoded[i].Lat-points[i].Lat) > 0.5e-5+1e-9 || math.Abs(decoded[i].Lng-points[i].Lng) > 0.5e-5+1e-9 {
+				return false
+			}
+		}
+		return true
+	}
+	require.NoError(t, quick.Check(roundTrip, quickConfig))
+}
@@ -0,0 +1,175 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// EncodePolyline encodes points using the Google encoded polyline algorithm
+// with 5 decimal places of precision
+func EncodePolyline(points []Point) string {
+	var sb strings.Builder
+	prevLat, prevLng := 0, 0
+
+	for _, point := range points {
+		lat := int(math.Round(point.Lat * 1e5))
+		lng := int(math.Round(point.Lng * 1e5))
+
+		encodePolylineValue(&sb, lat-prevLat)
+		encodePolylineValue(&sb, lng-prevLng)
+
+		prevLat, prevLng = lat, lng
+	}
+
+	return sb.String()
+}
+
+// DecodePolyline decodes a Google encoded polyline into points
+func DecodePolyline(encoded string) ([]Point, error) {
+	var points []Point
+	lat, lng := 0, 0
+	index := 0
+
+	for index < len(encoded) {
+		deltaLat, next, err := decodePolylineValue(encoded, index)
+		if err != nil {
+			return nil, err
+		}
+		deltaLng, next, err := decodePolylineValue(encoded, next)
+		if err != nil {
+			return nil, err
+		}
+		index = next
+
+		lat += deltaLat
+		lng += deltaLng
+		points = append(points, Point{
+			Lat: float64(lat) / 1e5,
+			Lng: float64(lng) / 1e5,
+		})
+	}
+
+	return points, nil
+}
+
+func encodePolylineValue(sb *strings.Builder, value int) {
+	shifted := value << 1
+	if value < 0 {
+		shifted = ^shifted
+	}
+
+	for shifted >= 0x20 {
+		sb.WriteByte(byte((0x20 | (shifted & 0x1f)) + 63))
+		shifted >>= 5
+	}
+	sb.WriteByte(byte(shifted + 63))
+}
+
+func decodePolylineValue(encoded string, index int) (int, int, error) {
+	result, shift := 0, 0
+
+	for {
+		if index >= len(encoded) {
+			return 0, index, errors.New("invalid polyline: unexpected end of input")
+		}
+
+		b := int(encoded[index]) - 63
+		index++
+		if b < 0 {
+			return 0, index, errors.New("invalid polyline: unexpected character")
+		}
+
+		result |= (b & 0x1f) << shift
+		shift += 5
+		if b < 0x20 {
+			break
+		}
+	}
+
+	if result&1 != 0 {
+		return ^(result >> 1), index, nil
+	}
+	return result >> 1, index, nil
+}
+
+// flexiblePolylineAlphabet is the URL-safe alphabet of HERE flexible polylines
+const flexiblePolylineAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// DecodeFlexiblePolyline decodes a HERE flexible polyline into points,
+// dropping the third dimension (e.g. elevation) when it has one
+func DecodeFlexiblePolyline(encoded string) ([]Point, error) {
+	version, index, err := decodeFlexibleUnsigned(encoded, 0)
+	if err != nil {
+		return nil, err
+	}
+	if version != 1 {
+		return nil, errors.New("invalid flexible polyline: unsupported version")
+	}
+	header, index, err := decodeFlexibleUnsigned(encoded, index)
+	if err != nil {
+		return nil, err
+	}
+	factor := math.Pow10(int(header & 15))
+	hasThirdDimension := (header>>4)&7 != 0
+
+	var points []Point
+	lat, lng := int64(0), int64(0)
+	for index < len(encoded) {
+		var deltaLat, deltaLng int64
+		if deltaLat, index, err = decodeFlexibleSigned(encoded, index); err != nil {
+			return nil, err
+		}
+		if deltaLng, index, err = decodeFlexibleSigned(encoded, index); err != nil {
+			return nil, err
+		}
+		if hasThirdDimension {
+			if _, index, err = decodeFlexibleSigned(encoded, index); err != nil {
+				return nil, err
+			}
+		}
+
+		lat += deltaLat
+		lng += deltaLng
+		points = append(points, Point{
+			Lat: float64(lat) / factor,
+			Lng: float64(lng) / factor,
+		})
+	}
+
+	return points, nil
+}
+
+func decodeFlexibleUnsigned(encoded string, index int) (int64, int, error) {
+	var result int64
+	shift := uint(0)
+
+	for {
+		if index >= len(encoded) {
+			return 0, index, errors.New("invalid flexible polyline: unexpected end of input")
+		}
+
+		b := strings.IndexByte(flexiblePolylineAlphabet, encoded[index])
+		index++
+		if b < 0 {
+			return 0, index, errors.New("invalid flexible polyline: unexpected character")
+		}
+
+		result |= int64(b&0x1f) << shift
+		shift += 5
+		if b < 0x20 {
+			return result, index, nil
+		}
+	}
+}
+
+func decodeFlexibleSigned(encoded string, index int) (int64, int, error) {
+	result, index, err := decodeFlexibleUnsigned(encoded, index)
+	if err != nil {
+		return 0, index, err
+	}
+	if result&1 != 0 {
+		return ^(result >> 1), index, nil
+	}
+	return result >> 1, index, nil
+}
@@ -0,0 +1,556 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Request is a GraphQL request as clients post it
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Response is the result of a request. Data is nil when the request could not
+// be executed at all.
+type Response struct {
+	Data   interface{} `json:"data"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Error is an error of a request, or of one of its fields with the path of
+// the field in the response
+type Error struct {
+	Message   string        `json:"message"`
+	Locations []Location    `json:"locations,omitempty"`
+	Path      []interface{} `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Execute parses, validates and runs a query. Fields that fail are returned
+// as null with an error, alongside the fields that didn't.
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{asError(err)}}
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{asError(err)}}
+	}
+	if op.kind != "query" {
+		return &Response{Errors: []*Error{{
+			Message:   fmt.Sprintf("%s operations are not supported, only queries.", op.kind),
+			Locations: []Location{op.loc},
+		}}}
+	}
+
+	e := &executor{ctx: ctx, schema: s, doc: doc}
+	if e.variables, err = variableValues(op, req.Variables); err != nil {
+		return &Response{Errors: []*Error{asError(err)}}
+	}
+	v := &validator{schema: s, doc: doc, defined: map[string]bool{}}
+	for _, definition := range op.variables {
+		v.defined[definition.name] = true
+	}
+	v.selections(s.Query, op.selections, 1, map[string]bool{})
+	if len(v.errors) > 0 {
+		return &Response{Errors: v.errors}
+	}
+
+	data := e.executeFields(s.Query, nil, e.collectFields(s.Query, op.selections, nil), nil)
+	// Deferred fields can defer more of their own, which run after them
+	for i := 0; i < len(e.deferred); i++ {
+		e.deferred[i]()
+	}
+	return &Response{Data: data, Errors: e.errors}
+}
+
+func asError(err error) *Error {
+	if gqlErr, ok := err.(*Error); ok {
+		return gqlErr
+	}
+	return &Error{Message: err.Error()}
+}
+
+// operation returns the operation a request runs: the named one, or the only
+// one in the document
+func (d *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(d.operations) > 1 {
+			return nil, &Error{Message: "The query has several operations; operationName is required."}
+		}
+		return d.operations[0], nil
+	}
+	for _, op := range d.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("Unknown operation named %q.", name)}
+}
+
+// variableValues returns the values of an operation's variables, with the
+// defaults of those not given
+func variableValues(op *operation, given map[string]interface{}) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, definition := range op.variables {
+		value, ok := given[definition.name]
+		switch {
+		case ok:
+			values[definition.name] = value
+		case definition.hasDefault:
+			values[definition.name] = definition.defaultValue
+		case definition.typ.nonNull:
+			return nil, &Error{Message: fmt.Sprintf("Variable \"$%s\" of required type %q was not provided.", definition.name, definition.typ)}
+		}
+		if definition.typ.nonNull && ok && value == nil {
+			return nil, &Error{Message: fmt.Sprintf("Variable \"$%s\" of non-null type %q must not be null.", definition.name, definition.typ)}
+		}
+	}
+	return values, nil
+}
+
+// validator checks that a query only selects fields and arguments of the
+// schema before it runs
+type validator struct {
+	schema  *Schema
+	doc     *document
+	defined map[string]bool
+	errors  []*Error
+}
+
+func (v *validator) report(loc Location, format string, args ...interface{}) {
+	v.errors = append(v.errors, &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{loc}})
+}
+
+// selections validates the selections of an object, at a depth of nested
+// fields. spreading holds the fragments being spread, to catch cycles.
+func (v *validator) selections(object *Object, selections []selection, depth int, spreading map[string]bool) {
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *field:
+			v.field(object, sel, depth, spreading)
+		case *inlineFragment:
+			v.directives(sel.directives)
+			if sel.typeCondition != "" && sel.typeCondition != object.Name {
+				v.report(Location{}, "Fragment cannot be spread here as objects of type %q can never be of type %q.", object.Name, sel.typeCondition)
+				continue
+			}
+			v.selections(object, sel.selections, depth, spreading)
+		case *fragmentSpread:
+			v.directives(sel.directives)
+			fragment, ok := v.doc.fragments[sel.name]
+			if !ok {
+				v.report(sel.loc, "Unknown fragment %q.", sel.name)
+				continue
+			}
+			if spreading[sel.name] {
+				v.report(sel.loc, "Cannot spread fragment %q within itself.", sel.name)
+				continue
+			}
+			if fragment.typeCondition != object.Name {
+				v.report(sel.loc, "Fragment %q cannot be spread here as objects of type %q can never be of type %q.", sel.name, object.Name, fragment.typeCondition)
+				continue
+			}
+			spreading[sel.name] = true
+			v.selections(object, fragment.selections, depth, spreading)
+			delete(spreading, sel.name)
+		}
+	}
+}
+
+func (v *validator) field(object *Object, f *field, depth int, spreading map[string]bool) {
+	v.directives(f.directives)
+	if v.schema.MaxDepth > 0 && depth > v.schema.MaxDepth {
+		v.report(f.loc, "The query is nested deeper than %d fields.", v.schema.MaxDepth)
+		return
+	}
+	if f.name == "__typename" {
+		if f.selections != nil {
+			v.report(f.loc, "Field \"__typename\" must not have a selection since type \"String!\" has no subfields.")
+		}
+		return
+	}
+
+	definition, ok := object.Fields[f.name]
+	if !ok {
+		v.report(f.loc, "Cannot query field %q on type %q.", f.name, object.Name)
+		return
+	}
+	for name, value := range f.arguments {
+		if _, ok := definition.Args[name]; !ok {
+			v.report(f.loc, "Unknown argument %q on field \"%s.%s\".", name, object.Name, f.name)
+		}
+		v.variables(f.loc, value)
+	}
+	for name, arg := range definition.Args {
+		if _, ok := arg.Type.(*NonNull); ok && arg.DefaultValue == nil {
+			if _, given := f.arguments[name]; !given {
+				v.report(f.loc, "Field \"%s.%s\" argument %q of type %q is required, but it was not provided.", object.Name, f.name, name, arg.Type)
+			}
+		}
+	}
+
+	switch t := namedType(definition.Type).(type) {
+	case *Object:
+		if f.selections == nil {
+			v.report(f.loc, "Field %q of type %q must have a selection of subfields.", f.name, definition.Type)
+			return
+		}
+		v.selections(t, f.selections, depth+1, spreading)
+	default:
+		if f.selections != nil {
+			v.report(f.loc, "Field %q must not have a selection since type %q has no subfields.", f.name, definition.Type)
+		}
+	}
+}
+
+func (v *validator) directives(directives []*directive) {
+	for _, d := range directives {
+		if d.name != "skip" && d.name != "include" {
+			v.report(d.loc, "Unknown directive \"@%s\".", d.name)
+			continue
+		}
+		if _, ok := d.arguments["if"]; !ok || len(d.arguments) != 1 {
+			v.report(d.loc, "Directive \"@%s\" takes a single argument \"if\".", d.name)
+		}
+		for _, value := range d.arguments {
+			v.variables(d.loc, value)
+		}
+	}
+}
+
+// variables checks that the variables a value uses are defined
+func (v *validator) variables(loc Location, value interface{}) {
+	switch value := value.(type) {
+	case variable:
+		if !v.defined[string(value)] {
+			v.report(loc, "Variable \"$%s\" is not defined.", string(value))
+		}
+	case []interface{}:
+		for _, item := range value {
+			v.variables(loc, item)
+		}
+	case map[string]interface{}:
+		for _, item := range value {
+			v.variables(loc, item)
+		}
+	}
+}
+
+// namedType returns the scalar or object a type is a list or non-null of
+func namedType(t Type) Type {
+	for {
+		switch wrapper := t.(type) {
+		case *NonNull:
+			t = wrapper.OfType
+		case *List:
+			t = wrapper.OfType
+		default:
+			return t
+		}
+	}
+}
+
+// executor runs a validated query
+type executor struct {
+	ctx       context.Context
+	schema    *Schema
+	doc       *document
+	variables map[string]interface{}
+	errors    []*Error
+	deferred  []func()
+}
+
+func (e *executor) fieldError(err error, f *field, path []interface{}) {
+	e.errors = append(e.errors, &Error{
+		Message:   err.Error(),
+		Locations: []Location{f.loc},
+		Path:      path,
+	})
+}
+
+// fieldGroup is the fields selected under one response key, whose
+// selections are merged
+type fieldGroup struct {
+	key    string
+	fields []*field
+}
+
+// collectFields groups the fields selected on an object by response key, in
+// the order they are first selected, leaving out skipped fields
+func (e *executor) collectFields(object *Object, selections []selection, groups []*fieldGroup) []*fieldGroup {
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *field:
+			if !e.included(sel.directives) {
+				continue
+			}
+			key := sel.responseKey()
+			found := false
+			for _, group := range groups {
+				if group.key == key {
+					group.fields = append(group.fields, sel)
+					found = true
+					break
+				}
+			}
+			if !found {
+				groups = append(groups, &fieldGroup{key: key, fields: []*field{sel}})
+			}
+		case *inlineFragment:
+			if e.included(sel.directives) {
+				groups = e.collectFields(object, sel.selections, groups)
+			}
+		case *fragmentSpread:
+			if e.included(sel.directives) {
+				groups = e.collectFields(object, e.doc.fragments[sel.name].selections, groups)
+			}
+		}
+	}
+	return groups
+}
+
+// included applies the @skip and @include directives of a selection
+func (e *executor) included(directives []*directive) bool {
+	for _, d := range directives {
+		condition, _ := e.value(d.arguments["if"])
+		if (d.name == "skip") == (condition == true) {
+			return false
+		}
+	}
+	return true
+}
+
+// value substitutes the variables in an argument value. Missing variables
+// are reported as not found.
+func (e *executor) value(raw interface{}) (interface{}, bool) {
+	switch raw := raw.(type) {
+	case variable:
+		value, ok := e.variables[string(raw)]
+		return value, ok
+	case []interface{}:
+		list := make([]interface{}, len(raw))
+		for i, item := range raw {
+			list[i], _ = e.value(item)
+		}
+		return list, true
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(raw))
+		for key, item := range raw {
+			object[key], _ = e.value(item)
+		}
+		return object, true
+	}
+	return raw, true
+}
+
+// arguments coerces the arguments of a field to their types
+func (e *executor) arguments(definition *Field, f *field) (map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	for name, arg := range definition.Args {
+		raw, ok := f.arguments[name]
+		if ok {
+			raw, ok = e.value(raw)
+		}
+		if !ok {
+			if arg.DefaultValue != nil {
+				args[name] = arg.DefaultValue
+			} else if _, nonNull := arg.Type.(*NonNull); nonNull {
+				return nil, fmt.Errorf("argument %q of type %q is required", name, arg.Type)
+			}
+			continue
+		}
+		value, err := coerceArgument(arg.Type, raw)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q has an invalid value: %v", name, err)
+		}
+		args[name] = value
+	}
+	return args, nil
+}
+
+func coerceArgument(t Type, raw interface{}) (interface{}, error) {
+	if nonNull, ok := t.(*NonNull); ok {
+		if raw == nil {
+			return nil, fmt.Errorf("expected a non-null %s", nonNull.OfType)
+		}
+		return coerceArgument(nonNull.OfType, raw)
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *List:
+		items, ok := raw.([]interface{})
+		if !ok {
+			// A single value is a list of one
+			items = []interface{}{raw}
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			value, err := coerceArgument(t.OfType, item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	case *Scalar:
+		return t.Parse(raw)
+	}
+	return nil, fmt.Errorf("%s can't be an argument", t)
+}
+
+// executeFields resolves the fields of an object
+func (e *executor) executeFields(object *Object, source interface{}, groups []*fieldGroup, path []interface{}) *orderedMap {
+	result := &orderedMap{values: map[string]interface{}{}}
+	for _, group := range groups {
+		f := group.fields[0]
+		fieldPath := appendPath(path, group.key)
+		result.set(group.key, nil)
+		if f.name == "__typename" {
+			result.set(group.key, object.Name)
+			continue
+		}
+
+		definition := object.Fields[f.name]
+		args, err := e.arguments(definition, f)
+		if err != nil {
+			e.fieldError(err, f, fieldPath)
+			continue
+		}
+		var value interface{}
+		if definition.Resolve != nil {
+			value, err = definition.Resolve(ResolveParams{Context: e.ctx, Source: source, Args: args})
+		} else {
+			value, err = defaultResolve(source, f.name)
+		}
+		if err != nil {
+			e.fieldError(err, f, fieldPath)
+			continue
+		}
+
+		key := group.key
+		e.complete(definition.Type, group.fields, value, fieldPath, func(v interface{}) { result.set(key, v) })
+	}
+	return result
+}
+
+// complete converts a resolved value to the field's type and sets it, once
+// any thunk it is deferred behind has run
+func (e *executor) complete(t Type, fields []*field, value interface{}, path []interface{}, set func(interface{})) {
+	if thunk, ok := value.(Thunk); ok {
+		e.deferred = append(e.deferred, func() {
+			value, err := thunk()
+			if err != nil {
+				e.fieldError(err, fields[0], path)
+				return
+			}
+			e.complete(t, fields, value, path, set)
+		})
+		return
+	}
+
+	if nonNull, ok := t.(*NonNull); ok {
+		if isNull(value) {
+			e.fieldError(fmt.Errorf("cannot return null for non-nullable field %s", fields[0].name), fields[0], path)
+			return
+		}
+		e.complete(nonNull.OfType, fields, value, path, set)
+		return
+	}
+	if isNull(value) {
+		set(nil)
+		return
+	}
+
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	switch t := t.(type) {
+	case *List:
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			e.fieldError(fmt.Errorf("expected a list for field %s", fields[0].name), fields[0], path)
+			return
+		}
+		items := make([]interface{}, v.Len())
+		set(items)
+		for i := range items {
+			i := i
+			e.complete(t.OfType, fields, v.Index(i).Interface(), appendPath(path, i), func(item interface{}) { items[i] = item })
+		}
+	case *Scalar:
+		serialized, err := t.Serialize(v.Interface())
+		if err != nil {
+			e.fieldError(err, fields[0], path)
+			return
+		}
+		set(serialized)
+	case *Object:
+		var selections []selection
+		for _, f := range fields {
+			selections = append(selections, f.selections...)
+		}
+		set(e.executeFields(t, value, e.collectFields(t, selections, nil), path))
+	}
+}
+
+// isNull reports whether a value is null. Nil slices are empty lists.
+func isNull(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Interface, reflect.Func:
+		return v.IsNil()
+	}
+	return false
+}
+
+func appendPath(path []interface{}, key interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(path)+1), path...), key)
+}
+
+// orderedMap is an object of a response, which keeps its fields in the order
+// they were selected
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (m *orderedMap) set(key string, value interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,323 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAuthor struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+type testBook struct {
+	ID        uint       `json:"id"`
+	Title     string     `json:"title"`
+	AuthorID  uint       `json:"author_id"`
+	Pages     int        `json:"pages"`
+	Rating    *float64   `json:"rating,omitempty"`
+	Published time.Time  `json:"published"`
+	Secret    string     `json:"-"`
+	Tags      []string   `json:"tags"`
+	Author    testAuthor `json:"author"`
+}
+
+// testSchema is a library of books by two authors. Authors are loaded in
+// batches, counting the batches in batches.
+func testSchema(batches *[][]uint) *Schema {
+	authors := map[uint]testAuthor{1: {ID: 1, Name: "Achebe"}, 2: {ID: 2, Name: "Dangarembga"}}
+	rating := 4.5
+	books := []testBook{
+		{ID: 1, Title: "Things Fall Apart", AuthorID: 1, Pages: 209, Rating: &rating, Published: time.Date(1958, 6, 17, 0, 0, 0, 0, time.UTC), Tags: []string{"classic"}},
+		{ID: 2, Title: "Nervous Conditions", AuthorID: 2, Pages: 204, Published: time.Date(1988, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: 3, Title: "Arrow of God", AuthorID: 1, Pages: 230, Published: time.Date(1964, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	author := &Object{Name: "Author", Fields: StructFields(testAuthor{})}
+	bookFields := StructFields(testBook{})
+	book := &Object{Name: "Book", Fields: bookFields}
+	loader := NewLoader(func(keys []uint) (map[uint]interface{}, error) {
+		*batches = append(*batches, keys)
+		values := map[uint]interface{}{}
+		for _, key := range keys {
+			values[key] = authors[key]
+		}
+		return values, nil
+	})
+	bookFields["author"] = &Field{
+		Type: &NonNull{OfType: author},
+		Resolve: func(p ResolveParams) (interface{}, error) {
+			return loader.Load(p.Source.(testBook).AuthorID), nil
+		},
+	}
+	author.Fields["books"] = &Field{
+		Type: &NonNull{OfType: &List{OfType: &NonNull{OfType: book}}},
+		Resolve: func(p ResolveParams) (interface{}, error) {
+			var written []testBook
+			for _, b := range books {
+				if b.AuthorID == p.Source.(testAuthor).ID {
+					written = append(written, b)
+				}
+			}
+			return written, nil
+		},
+	}
+
+	return &Schema{
+		MaxDepth: 5,
+		Query: &Object{Name: "Query", Fields: Fields{
+			"books": {
+				Type: &NonNull{OfType: &List{OfType: &NonNull{OfType: book}}},
+				Args: map[string]*Argument{
+					"first":    {Type: Int, DefaultValue: 10},
+					"minPages": {Type: Int},
+				},
+				Resolve: func(p ResolveParams) (interface{}, error) {
+					var result []testBook
+					for _, b := range books {
+						if minPages, ok := p.Args["minPages"].(int); ok && b.Pages < minPages {
+							continue
+						}
+						if len(result) < p.Args["first"].(int) {
+							result = append(result, b)
+						}
+					}
+					return result, nil
+				},
+			},
+			"book": {
+				Type: book,
+				Args: map[string]*Argument{"id": {Type: &NonNull{OfType: ID}}},
+				Resolve: func(p ResolveParams) (interface{}, error) {
+					for _, b := range books {
+						if b.ID == p.Args["id"].(uint) {
+							return b, nil
+						}
+					}
+					return nil, nil
+				},
+			},
+			"broken": {
+				Type: String,
+				Resolve: func(p ResolveParams) (interface{}, error) {
+					return nil, errors.New("the shelf collapsed")
+				},
+			},
+			"missing": {
+				Type: &NonNull{OfType: String},
+				Resolve: func(p ResolveParams) (interface{}, error) {
+					return nil, nil
+				},
+			},
+		}},
+	}
+}
+
+// execute runs a query and returns its response as JSON decodes it
+func execute(t *testing.T, schema *Schema, query string, variables map[string]interface{}) (map[string]interface{}, []*Error) {
+	response := schema.Execute(context.Background(), Request{Query: query, Variables: variables})
+	if response.Data == nil {
+		return nil, response.Errors
+	}
+	encoded, err := json.Marshal(response.Data)
+	require.NoError(t, err)
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(encoded, &data))
+	return data, response.Errors
+}
+
+func TestExecute(t *testing.T) {
+	var batches [][]uint
+	schema := testSchema(&batches)
+
+	t.Run("Selects fields in order", func(t *testing.T) {
+		response := schema.Execute(context.Background(), Request{Query: `{ book(id: 1) { title id pages rating published tags } }`})
+		require.Empty(t, response.Errors)
+		encoded, err := json.Marshal(response.Data)
+		require.NoError(t, err)
+		assert.Equal(t, `{"book":{"title":"Things Fall Apart","id":"1","pages":209,"rating":4.5,"published":"1958-06-17T00:00:00Z","tags":["classic"]}}`, string(encoded))
+	})
+
+	t.Run("Aliases, arguments and variables", func(t *testing.T) {
+		data, errs := execute(t, schema, `
+			query Long($pages: Int, $id: ID!) {
+				long: books(minPages: $pages) { title }
+				first: books(first: 1) { title }
+				chosen: book(id: $id) { title }
+			}`, map[string]interface{}{"pages": float64(205), "id": "2"})
+		require.Empty(t, errs)
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"title": "Things Fall Apart"},
+			map[string]interface{}{"title": "Arrow of God"},
+		}, data["long"])
+		assert.Len(t, data["first"], 1)
+		assert.Equal(t, map[string]interface{}{"title": "Nervous Conditions"}, data["chosen"])
+	})
+
+	t.Run("Fragments, directives and typename", func(t *testing.T) {
+		data, errs := execute(t, schema, `
+			query ($withPages: Boolean = false) {
+				book(id: "3") {
+					__typename
+					...Summary
+					pages @include(if: $withPages)
+					... on Book { id @skip(if: true) }
+				}
+			}
+			fragment Summary on Book { title author { name } }`, nil)
+		require.Empty(t, errs)
+		assert.Equal(t, map[string]interface{}{
+			"__typename": "Book",
+			"title":      "Arrow of God",
+			"author":     map[string]interface{}{"name": "Achebe"},
+		}, data["book"])
+	})
+
+	t.Run("Batches nested loads", func(t *testing.T) {
+		// Loaders cache for as long as they live, which is one request
+		batches = nil
+		schema := testSchema(&batches)
+		data, errs := execute(t, schema, `{ books { author { name books { author { id } } } } }`, nil)
+		require.Empty(t, errs)
+		books := data["books"].([]interface{})
+		require.Len(t, books, 3)
+		assert.Equal(t, "Dangarembga", books[1].(map[string]interface{})["author"].(map[string]interface{})["name"])
+		// The authors of the three books are loaded together, and are cached
+		// for the nested books' authors
+		assert.Equal(t, [][]uint{{1, 2}}, batches)
+	})
+
+	t.Run("Field errors leave the rest of the response", func(t *testing.T) {
+		data, errs := execute(t, schema, `{ broken missing book(id: 2) { title } }`, nil)
+		require.Len(t, errs, 2)
+		assert.Equal(t, "the shelf collapsed", errs[0].Message)
+		assert.Equal(t, []interface{}{"broken"}, errs[0].Path)
+		assert.Equal(t, []interface{}{"missing"}, errs[1].Path)
+		assert.Nil(t, data["broken"])
+		assert.Equal(t, map[string]interface{}{"title": "Nervous Conditions"}, data["book"])
+	})
+
+	t.Run("Invalid arguments", func(t *testing.T) {
+		data, errs := execute(t, schema, `{ book(id: "abc") { title } }`, nil)
+		require.Len(t, errs, 1)
+		assert.Contains(t, errs[0].Message, "invalid ID")
+		assert.Nil(t, data["book"])
+	})
+}
+
+func TestExecuteRejectsInvalidQueries(t *testing.T) {
+	var batches [][]uint
+	schema := testSchema(&batches)
+
+	tests := []struct {
+		name    string
+		query   string
+		message string
+	}{
+		{"Syntax error", `{ books { title }`, "Syntax Error"},
+		{"Unknown field", `{ books { isbn } }`, `Cannot query field "isbn" on type "Book".`},
+		{"Hidden field", `{ books { secret } }`, `Cannot query field "secret"`},
+		{"Unknown argument", `{ books(sort: "title") { title } }`, `Unknown argument "sort"`},
+		{"Missing required argument", `{ book { title } }`, `argument "id" of type "ID!" is required`},
+		{"Missing selection", `{ books }`, "must have a selection of subfields"},
+		{"Selection on a scalar", `{ books { title { length } } }`, "must not have a selection"},
+		{"Undefined variable", `{ book(id: $id) { title } }`, `Variable "$id" is not defined.`},
+		{"Unknown fragment", `{ books { ...Details } }`, `Unknown fragment "Details".`},
+		{"Fragment cycle", `{ books { ...A } } fragment A on Book { author { books { ...A } } }`, "within itself"},
+		{"Fragment on another type", `{ books { ...A } } fragment A on Author { name }`, "can never be of type"},
+		{"Too deep", `{ books { author { books { author { books { title } } } } } }`, "nested deeper than 5"},
+		{"Mutation", `mutation { books { title } }`, "only queries"},
+		{"Several operations", `query A { books { title } } query B { books { id } }`, "operationName is required"},
+		{"Missing variable", `query ($id: ID!) { book(id: $id) { title } }`, `Variable "$id" of required type "ID!" was not provided.`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, errs := execute(t, schema, tt.query, nil)
+			assert.Nil(t, data)
+			require.NotEmpty(t, errs)
+			assert.Contains(t, errs[0].Message, tt.message)
+		})
+	}
+}
+
+func TestLoader(t *testing.T) {
+	var calls [][]uint
+	loader := NewLoader(func(keys []uint) (map[uint]interface{}, error) {
+		calls = append(calls, keys)
+		if keys[0] == 9 {
+			return nil, errors.New("unavailable")
+		}
+		values := map[uint]interface{}{}
+		for _, key := range keys {
+			if key != 3 {
+				values[key] = key * 10
+			}
+		}
+		return values, nil
+	})
+
+	first, second, missing := loader.Load(1), loader.Load(2), loader.Load(3)
+	repeated := loader.Load(1)
+	value, err := second()
+	require.NoError(t, err)
+	assert.Equal(t, uint(20), value)
+	value, _ = first()
+	assert.Equal(t, uint(10), value)
+	value, _ = repeated()
+	assert.Equal(t, uint(10), value)
+	value, err = missing()
+	assert.NoError(t, err)
+	assert.Nil(t, value)
+	assert.Equal(t, [][]uint{{1, 2, 3}}, calls)
+
+	// Cached keys aren't fetched again
+	value, _ = loader.Load(2)()
+	assert.Equal(t, uint(20), value)
+	assert.Len(t, calls, 1)
+
+	_, err = loader.Load(9)()
+	assert.EqualError(t, err, "unavailable")
+}
+
+func TestStructFields(t *testing.T) {
+	fields := StructFields(testBook{})
+
+	types := map[string]string{}
+	for name, f := range fields {
+		types[name] = f.Type.String()
+	}
+	assert.Equal(t, map[string]string{
+		"id":        "ID!",
+		"title":     "String!",
+		"authorId":  "ID!",
+		"pages":     "Int!",
+		"rating":    "Float",
+		"published": "Time!",
+		"tags":      "[String!]!",
+	}, types)
+}
+
+func TestSDL(t *testing.T) {
+	var batches [][]uint
+	sdl := testSchema(&batches).SDL()
+
+	assert.Contains(t, sdl, "schema {\n  query: Query\n}\n")
+	assert.Contains(t, sdl, "\"An RFC 3339 timestamp\"\nscalar Time\n")
+	assert.Contains(t, sdl, "type Author {\n  books: [Book!]!\n  id: ID!\n  name: String!\n}\n")
+	assert.Contains(t, sdl, "  books(first: Int = 10, minPages: Int): [Book!]!\n")
+	assert.NotContains(t, sdl, "scalar String")
+}
+
+func TestCamelCase(t *testing.T) {
+	assert.Equal(t, "originCity", CamelCase("origin_city"))
+	assert.Equal(t, "etaSource", CamelCase("eta_source"))
+	assert.Equal(t, "id", CamelCase("id"))
+	assert.Equal(t, "origin_city", snakeCase("originCity"))
+}
@@ -0,0 +1,61 @@
+package graphql
+
+// BatchFunc fetches the values of several keys at once. Keys missing from
+// the result have no value.
+type BatchFunc func(keys []uint) (map[uint]interface{}, error)
+
+// Loader batches the lookups of a request. Every key loaded before the first
+// of their thunks runs is fetched in one call of the batch function, and
+// values are cached for the rest of the request. A Loader is used by one
+// request and isn't safe for concurrent use.
+type Loader struct {
+	batch   BatchFunc
+	pending []uint
+	values  map[uint]interface{}
+	errors  map[uint]error
+}
+
+// NewLoader creates a loader fetching with a batch function
+func NewLoader(batch BatchFunc) *Loader {
+	return &Loader{batch: batch, values: map[uint]interface{}{}, errors: map[uint]error{}}
+}
+
+// Load returns a thunk of the value of a key
+func (l *Loader) Load(key uint) Thunk {
+	if !l.loaded(key) && !l.isPending(key) {
+		l.pending = append(l.pending, key)
+	}
+	return func() (interface{}, error) {
+		if !l.loaded(key) {
+			l.dispatch()
+		}
+		return l.values[key], l.errors[key]
+	}
+}
+
+func (l *Loader) loaded(key uint) bool {
+	_, ok := l.values[key]
+	return ok
+}
+
+func (l *Loader) isPending(key uint) bool {
+	for _, pending := range l.pending {
+		if pending == key {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch fetches the pending keys
+func (l *Loader) dispatch() {
+	keys := l.pending
+	l.pending = nil
+	values, err := l.batch(keys)
+	for _, key := range keys {
+		l.values[key] = values[key]
+		if err != nil {
+			l.errors[key] = err
+		}
+	}
+}
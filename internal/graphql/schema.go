@@ -0,0 +1,446 @@
+// Package graphql is a small GraphQL server: it parses queries, validates
+// them against a schema declared in Go and executes them. Only queries are
+// supported, without introspection; clients get the schema from its SDL.
+// Resolvers can return a Thunk to defer work, which Loader uses to batch the
+// lookups of sibling fields into one query.
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is a *Scalar, *Object, *List or *NonNull
+type Type interface {
+	String() string
+}
+
+// Scalar is a leaf type. Serialize converts a resolved value to its JSON
+// representation and Parse converts an argument value to the Go value
+// resolvers get.
+type Scalar struct {
+	Name        string
+	Description string
+	Serialize   func(value interface{}) (interface{}, error)
+	Parse       func(value interface{}) (interface{}, error)
+}
+
+func (s *Scalar) String() string { return s.Name }
+
+// Object is a type with fields
+type Object struct {
+	Name        string
+	Description string
+	Fields      Fields
+}
+
+func (o *Object) String() string { return o.Name }
+
+// Fields are the fields of an object by name
+type Fields map[string]*Field
+
+// Field is a field of an object. Fields without a resolver return the field
+// of their source struct with the snake_case JSON name of the field.
+type Field struct {
+	Type        Type
+	Description string
+	Args        map[string]*Argument
+	Resolve     ResolveFunc
+}
+
+// Argument is an argument of a field. Missing arguments take their default
+// value, if they have one.
+type Argument struct {
+	Type         Type
+	Description  string
+	DefaultValue interface{}
+}
+
+// List is a list of another type
+type List struct {
+	OfType Type
+}
+
+func (l *List) String() string { return "[" + l.OfType.String() + "]" }
+
+// NonNull is another type that can't be null
+type NonNull struct {
+	OfType Type
+}
+
+func (n *NonNull) String() string { return n.OfType.String() + "!" }
+
+// ResolveFunc resolves the value of a field. It returns the value, or a
+// Thunk that returns it later.
+type ResolveFunc func(p ResolveParams) (interface{}, error)
+
+// ResolveParams are the source object of a field and its arguments
+type ResolveParams struct {
+	Context context.Context
+	Source  interface{}
+	Args    map[string]interface{}
+}
+
+// Thunk is a deferred field value. Thunks run after the fields already being
+// resolved, so their work can be batched.
+type Thunk func() (interface{}, error)
+
+// Schema is the query type of an API and the limits queries are held to
+type Schema struct {
+	Query *Object
+	// MaxDepth is the deepest nesting of fields a query can select, or 0
+	// for no limit
+	MaxDepth int
+}
+
+// Built-in scalars
+var (
+	Int = &Scalar{
+		Name:      "Int",
+		Serialize: func(value interface{}) (interface{}, error) { return coerceInt(value) },
+		Parse:     func(value interface{}) (interface{}, error) { return coerceInt(value) },
+	}
+	Float = &Scalar{
+		Name:      "Float",
+		Serialize: func(value interface{}) (interface{}, error) { return coerceFloat(value) },
+		Parse:     func(value interface{}) (interface{}, error) { return coerceFloat(value) },
+	}
+	String = &Scalar{
+		Name:      "String",
+		Serialize: func(value interface{}) (interface{}, error) { return fmt.Sprint(value), nil },
+		Parse: func(value interface{}) (interface{}, error) {
+			if s, ok := value.(string); ok {
+				return s, nil
+			}
+			return nil, fmt.Errorf("expected a string, got %v", value)
+		},
+	}
+	Boolean = &Scalar{
+		Name:      "Boolean",
+		Serialize: func(value interface{}) (interface{}, error) { return coerceBoolean(value) },
+		Parse:     func(value interface{}) (interface{}, error) { return coerceBoolean(value) },
+	}
+	// ID is serialized as a string and parsed from a string or an integer
+	// to a uint, as the IDs of models are
+	ID = &Scalar{
+		Name: "ID",
+		Serialize: func(value interface{}) (interface{}, error) {
+			return fmt.Sprint(value), nil
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			if s, ok := value.(string); ok {
+				id, err := strconv.ParseUint(s, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid ID %q", s)
+				}
+				return uint(id), nil
+			}
+			id, err := coerceInt(value)
+			if err != nil || id < 0 {
+				return nil, fmt.Errorf("invalid ID %v", value)
+			}
+			return uint(id), nil
+		},
+	}
+	// Time is an RFC 3339 timestamp. Dates without a time are parsed as
+	// midnight UTC.
+	Time = &Scalar{
+		Name:        "Time",
+		Description: "An RFC 3339 timestamp",
+		Serialize: func(value interface{}) (interface{}, error) {
+			if t, ok := value.(time.Time); ok {
+				return t.Format(time.RFC3339), nil
+			}
+			return nil, fmt.Errorf("expected a time, got %v", value)
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a timestamp, got %v", value)
+			}
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				return t, nil
+			}
+			if t, err := time.Parse("2006-01-02", s); err == nil {
+				return t, nil
+			}
+			return nil, fmt.Errorf("invalid timestamp %q", s)
+		},
+	}
+)
+
+func coerceInt(value interface{}) (int, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		// Variables decoded from JSON are floats
+		if f := v.Float(); f == float64(int(f)) {
+			return int(f), nil
+		}
+	}
+	return 0, fmt.Errorf("expected an integer, got %v", value)
+}
+
+func coerceFloat(value interface{}) (float64, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+	return 0, fmt.Errorf("expected a number, got %v", value)
+}
+
+func coerceBoolean(value interface{}) (bool, error) {
+	if b, ok := value.(bool); ok {
+		return b, nil
+	}
+	return false, fmt.Errorf("expected a boolean, got %v", value)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// StructFields returns fields for the exported scalar fields of a struct,
+// including those of embedded structs, named after their JSON names in
+// camelCase. Fields named id or ending in _id are IDs. Nested structs and
+// slices of structs are left for the caller to declare with resolvers.
+func StructFields(sample interface{}) Fields {
+	fields := Fields{}
+	addStructFields(fields, reflect.TypeOf(sample))
+	return fields
+}
+
+func addStructFields(fields Fields, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			addStructFields(fields, sf.Type)
+			continue
+		}
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if !sf.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		typ := typeOfGoType(sf.Type, name == "id" || strings.HasSuffix(name, "_id"))
+		if typ == nil {
+			continue
+		}
+		fields[CamelCase(name)] = &Field{Type: typ}
+	}
+}
+
+// typeOfGoType returns the type of a Go type, or nil when it isn't a scalar
+// or a list of scalars
+func typeOfGoType(t reflect.Type, isID bool) Type {
+	if t.Kind() == reflect.Ptr {
+		if typ := typeOfGoType(t.Elem(), isID); typ != nil {
+			if nonNull, ok := typ.(*NonNull); ok {
+				return nonNull.OfType
+			}
+		}
+		return nil
+	}
+
+	var scalar *Scalar
+	switch t.Kind() {
+	case reflect.Bool:
+		scalar = Boolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		scalar = Int
+	case reflect.Float32, reflect.Float64:
+		scalar = Float
+	case reflect.String:
+		scalar = String
+	case reflect.Slice:
+		if ofType := typeOfGoType(t.Elem(), false); ofType != nil {
+			return &NonNull{OfType: &List{OfType: ofType}}
+		}
+		return nil
+	case reflect.Struct:
+		if t != timeType {
+			return nil
+		}
+		scalar = Time
+	default:
+		return nil
+	}
+	if isID && scalar == Int {
+		scalar = ID
+	}
+	return &NonNull{OfType: scalar}
+}
+
+// CamelCase converts a snake_case name to camelCase
+func CamelCase(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// snakeCase converts a camelCase name to snake_case
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// defaultResolve returns the field of a struct or map source with the
+// snake_case JSON name of a field
+func defaultResolve(source interface{}, name string) (interface{}, error) {
+	v := reflect.ValueOf(source)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+
+	jsonName := snakeCase(name)
+	switch v.Kind() {
+	case reflect.Map:
+		value := v.MapIndex(reflect.ValueOf(jsonName))
+		if !value.IsValid() {
+			return nil, nil
+		}
+		return value.Interface(), nil
+	case reflect.Struct:
+		if value, ok := structField(v, jsonName); ok {
+			return value.Interface(), nil
+		}
+	}
+	return nil, fmt.Errorf("no field %s on %s", name, v.Type())
+}
+
+func structField(v reflect.Value, jsonName string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			if value, ok := structField(v.Field(i), jsonName); ok {
+				return value, true
+			}
+			continue
+		}
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = sf.Name
+		}
+		if name == jsonName && sf.IsExported() {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// SDL returns the schema in the GraphQL schema definition language
+func (s *Schema) SDL() string {
+	objects := map[string]*Object{}
+	scalars := map[string]*Scalar{}
+	collectTypes(s.Query, objects, scalars)
+
+	var b strings.Builder
+	b.WriteString("schema {\n  query: " + s.Query.Name + "\n}\n")
+	for _, name := range sortedKeys(scalars) {
+		switch name {
+		case "Int", "Float", "String", "Boolean", "ID":
+			continue
+		}
+		b.WriteString("\n")
+		writeDescription(&b, "", scalars[name].Description)
+		b.WriteString("scalar " + name + "\n")
+	}
+	for _, name := range sortedKeys(objects) {
+		object := objects[name]
+		b.WriteString("\n")
+		writeDescription(&b, "", object.Description)
+		b.WriteString("type " + name + " {\n")
+		for _, fieldName := range sortedKeys(object.Fields) {
+			f := object.Fields[fieldName]
+			writeDescription(&b, "  ", f.Description)
+			b.WriteString("  " + fieldName)
+			if len(f.Args) > 0 {
+				var args []string
+				for _, argName := range sortedKeys(f.Args) {
+					arg := f.Args[argName]
+					definition := argName + ": " + arg.Type.String()
+					if arg.DefaultValue != nil {
+						definition += " = " + fmt.Sprintf("%#v", arg.DefaultValue)
+					}
+					args = append(args, definition)
+				}
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			b.WriteString(": " + f.Type.String() + "\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+func writeDescription(b *strings.Builder, indent, description string) {
+	if description != "" {
+		b.WriteString(indent + strconv.Quote(description) + "\n")
+	}
+}
+
+func collectTypes(t Type, objects map[string]*Object, scalars map[string]*Scalar) {
+	switch t := t.(type) {
+	case *NonNull:
+		collectTypes(t.OfType, objects, scalars)
+	case *List:
+		collectTypes(t.OfType, objects, scalars)
+	case *Scalar:
+		scalars[t.Name] = t
+	case *Object:
+		if _, ok := objects[t.Name]; ok {
+			return
+		}
+		objects[t.Name] = t
+		for _, f := range t.Fields {
+			collectTypes(f.Type, objects, scalars)
+			for _, arg := range f.Args {
+				collectTypes(arg.Type, objects, scalars)
+			}
+		}
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,168 @@
+// Package i18n translates the text the API sends to people, such as the
+// titles and messages of notifications. Messages are looked up by key in a
+// catalog per language and are templates of the values they mention.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Language is a supported language, by its ISO 639-1 code
+type Language string
+
+const (
+	English Language = "en"
+	Spanish Language = "es"
+	French  Language = "fr"
+)
+
+// Default is the language of users who haven't picked one, and the one
+// messages missing from a catalog fall back to
+const Default = English
+
+// dateTimeKey is the catalog entry holding the time layout of a language
+const dateTimeKey = "format.datetime"
+
+// Params are the values a message mentions, by the names its template uses
+type Params map[string]interface{}
+
+//go:embed locales/*.json
+var locales embed.FS
+
+var catalogs map[Language]*catalog
+
+func init() {
+	catalogs = loadCatalogs()
+}
+
+// Languages returns the supported languages
+func Languages() []Language {
+	return []Language{English, Spanish, French}
+}
+
+// Parse returns the supported language of a name, case-insensitively. Region
+// subtags are ignored, so "es-MX" is Spanish. The empty name is the default.
+func Parse(name string) (Language, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return Default, true
+	}
+	if i := strings.IndexAny(name, "-_"); i >= 0 {
+		name = name[:i]
+	}
+	for _, language := range Languages() {
+		if Language(name) == language {
+			return language, true
+		}
+	}
+	return "", false
+}
+
+// T renders the message of a key in a language. Messages the language has no
+// translation for are rendered in the default language, and unknown keys are
+// returned as they are.
+func T(language Language, key string, params Params) string {
+	tmpl := lookup(language, key)
+	if tmpl == nil {
+		return key
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, params); err != nil {
+		return key
+	}
+	return b.String()
+}
+
+// Has reports whether a key has a message in the default language
+func Has(key string) bool {
+	return lookup(Default, key) != nil
+}
+
+// FormatTime formats a time with a language's layout. Times are written in
+// their own location, which the layout names.
+func FormatTime(language Language, t time.Time) string {
+	layout := "2006-01-02 15:04 MST"
+	if c := catalogs[language]; c != nil && c.layout != "" {
+		layout = c.layout
+	} else if c := catalogs[Default]; c != nil && c.layout != "" {
+		layout = c.layout
+	}
+	return t.Format(layout)
+}
+
+type catalog struct {
+	layout   string
+	messages map[string]*template.Template
+}
+
+func lookup(language Language, key string) *template.Template {
+	if c := catalogs[language]; c != nil {
+		if tmpl, ok := c.messages[key]; ok {
+			return tmpl
+		}
+	}
+	if c := catalogs[Default]; c != nil {
+		return c.messages[key]
+	}
+	return nil
+}
+
+// loadCatalogs parses the embedded catalogs. They ship with the binary, so a
+// message that doesn't parse is a bug and stops the program from starting.
+func loadCatalogs() map[Language]*catalog {
+	loaded := make(map[Language]*catalog)
+	for _, language := range Languages() {
+		data, err := locales.ReadFile(path.Join("locales", string(language)+".json"))
+		if err != nil {
+			panic(fmt.Sprintf("i18n: missing catalog for %s: %v", language, err))
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: invalid catalog for %s: %v", language, err))
+		}
+
+		c := &catalog{layout: messages[dateTimeKey], messages: make(map[string]*template.Template, len(messages))}
+		funcs := template.FuncMap{"datetime": datetimeFunc(language)}
+		for key, text := range messages {
+			if key == dateTimeKey {
+				continue
+			}
+			tmpl, err := template.New(key).Funcs(funcs).Option("missingkey=zero").Parse(text)
+			if err != nil {
+				panic(fmt.Sprintf("i18n: invalid message %s in %s: %v", key, language, err))
+			}
+			c.messages[key] = tmpl
+		}
+		loaded[language] = c
+	}
+	return loaded
+}
+
+// datetimeFunc formats times given to templates in a language's layout.
+// Times read back from JSON are strings and are parsed first.
+func datetimeFunc(language Language) func(interface{}) string {
+	return func(value interface{}) string {
+		switch v := value.(type) {
+		case time.Time:
+			return FormatTime(language, v)
+		case *time.Time:
+			if v == nil {
+				return ""
+			}
+			return FormatTime(language, *v)
+		case string:
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return v
+			}
+			return FormatTime(language, t)
+		}
+		return fmt.Sprint(value)
+	}
+}
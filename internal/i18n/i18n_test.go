@@ -0,0 +1,89 @@
+package i18n
+
+import (
+	"encoding/json"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Language
+		ok       bool
+	}{
+		{"", English, true},
+		{"en", English, true},
+		{"ES", Spanish, true},
+		{"fr-CA", French, true},
+		{" es_MX ", Spanish, true},
+		{"de", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			language, ok := Parse(tt.name)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, language)
+		})
+	}
+}
+
+func TestT(t *testing.T) {
+	params := Params{"minutes": 45, "reason": "traffic"}
+	assert.Equal(t, "Your shipment is delayed by 45 minutes due to traffic", T(English, "notification.trip_delayed.message", params))
+	assert.Equal(t, "Su envío lleva un retraso de 45 minutos debido a: traffic", T(Spanish, "notification.trip_delayed.message", params))
+	assert.Equal(t, "Envoi retardé", T(French, "notification.trip_delayed.title", nil))
+
+	// Optional values are left out when they aren't given
+	assert.Equal(t, "Your shipment is delayed by 10 minutes", T(English, "notification.trip_delayed.message", Params{"minutes": 10}))
+
+	// Unsupported languages fall back to the default, unknown keys to themselves
+	assert.Equal(t, "Shipment Delayed", T("de", "notification.trip_delayed.title", nil))
+	assert.Equal(t, "notification.unknown.title", T(English, "notification.unknown.title", nil))
+	assert.False(t, Has("notification.unknown.title"))
+	assert.True(t, Has("notification.eta_updated.message"))
+}
+
+func TestDateTime(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	require.NoError(t, err)
+	eta := time.Date(2026, 3, 3, 20, 0, 0, 0, chicago)
+
+	assert.Equal(t, "Your shipment's estimated arrival time has been updated to Mar 3, 2026 at 8:00 PM CST",
+		T(English, "notification.eta_updated.message", Params{"eta": eta}))
+	assert.Equal(t, "La hora estimada de llegada de su envío se ha actualizado a 03/03/2026 20:00 CST",
+		T(Spanish, "notification.eta_updated.message", Params{"eta": eta}))
+
+	assert.Equal(t, "03/03/2026 à 20:00 CST", FormatTime(French, eta))
+
+	// Times read back from JSON keep their offset but not the zone's name
+	assert.Equal(t, "Your shipment's estimated arrival time has been updated to Mar 3, 2026 at 8:00 PM -0600",
+		T(English, "notification.eta_updated.message", Params{"eta": eta.Format(time.RFC3339)}))
+}
+
+// Every message of the default catalog is translated, and translations don't
+// mention values the default doesn't
+func TestCatalogsAreComplete(t *testing.T) {
+	read := func(language Language) map[string]string {
+		data, err := locales.ReadFile(path.Join("locales", string(language)+".json"))
+		require.NoError(t, err)
+		var messages map[string]string
+		require.NoError(t, json.Unmarshal(data, &messages))
+		return messages
+	}
+
+	defaults := read(Default)
+	for _, language := range Languages() {
+		messages := read(language)
+		for key := range defaults {
+			assert.Contains(t, messages, key, "%s is missing %s", language, key)
+		}
+		for key := range messages {
+			assert.Contains(t, defaults, key, "%s has unknown key %s", language, key)
+		}
+	}
+}
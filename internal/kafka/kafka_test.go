@@ -0,0 +1,444 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMurmur2(t *testing.T) {
+	// Vectors of the Java client's partitioner tests
+	vectors := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+	for key, expected := range vectors {
+		if hash := murmur2([]byte(key)); hash != expected {
+			t.Errorf("murmur2(%q) = %d, expected %d", key, hash, expected)
+		}
+	}
+}
+
+// record is a record decoded from a batch
+type record struct {
+	key, value []byte
+	headers    map[string]string
+	offset     int64
+	timestamp  int64
+}
+
+// decodeRecordBatch decodes a batch, verifying its length and CRC
+func decodeRecordBatch(t *testing.T, batch []byte) []record {
+	t.Helper()
+	d := &decoder{b: batch}
+	d.int64() // base_offset
+	if length := d.int32(); int(length) != len(d.b) {
+		t.Fatalf("batch length %d, %d bytes follow", length, len(d.b))
+	}
+	d.int32() // partition_leader_epoch
+	if magic := d.int8(); magic != 2 {
+		t.Fatalf("magic %d", magic)
+	}
+	crc := uint32(d.int32())
+	if crc != crc32.Checksum(d.b, castagnoli) {
+		t.Fatal("batch CRC mismatch")
+	}
+	if attributes := d.int16(); attributes != 0 {
+		t.Fatalf("attributes %d", attributes)
+	}
+	lastOffsetDelta := d.int32()
+	firstTimestamp := d.int64()
+	d.int64() // max_timestamp
+	if producerID := d.int64(); producerID != -1 {
+		t.Fatalf("producer ID %d", producerID)
+	}
+	d.int16()
+	d.int32()
+	count := int(d.int32())
+	if int32(count-1) != lastOffsetDelta {
+		t.Fatalf("%d records, last offset delta %d", count, lastOffsetDelta)
+	}
+
+	varint := func() int64 {
+		v, n := binary.Varint(d.b)
+		if n <= 0 {
+			t.Fatal("invalid varint")
+		}
+		d.b = d.b[n:]
+		return v
+	}
+	varBytes := func() []byte {
+		n := varint()
+		if n < 0 {
+			return nil
+		}
+		return d.next(int(n))
+	}
+
+	records := make([]record, count)
+	for i := range records {
+		length := varint()
+		start := len(d.b)
+		d.int8() // attributes
+		records[i].timestamp = firstTimestamp + varint()
+		records[i].offset = varint()
+		records[i].key = varBytes()
+		records[i].value = varBytes()
+		records[i].headers = make(map[string]string)
+		for n := varint(); n > 0; n-- {
+			key := string(varBytes())
+			records[i].headers[key] = string(varBytes())
+		}
+		if int64(start-len(d.b)) != length {
+			t.Fatalf("record %d length %d, read %d bytes", i, length, start-len(d.b))
+		}
+	}
+	if d.err != nil || len(d.b) != 0 {
+		t.Fatalf("batch has %d trailing bytes: %v", len(d.b), d.err)
+	}
+	return records
+}
+
+func TestEncodeRecordBatch(t *testing.T) {
+	now := time.UnixMilli(1718000000000)
+	records := decodeRecordBatch(t, encodeRecordBatch([]Message{
+		{Key: []byte("7"), Value: []byte(`{"a":1}`), Headers: []Header{{Key: "event_type", Value: []byte("trip.status.changed")}}, Time: now},
+		{Value: []byte("second"), Time: now.Add(1500 * time.Millisecond)},
+	}))
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if string(records[0].key) != "7" || string(records[0].value) != `{"a":1}` || records[0].headers["event_type"] != "trip.status.changed" {
+		t.Errorf("unexpected first record %+v", records[0])
+	}
+	if records[1].key != nil || records[1].offset != 1 || records[1].timestamp != now.UnixMilli()+1500 {
+		t.Errorf("unexpected second record %+v", records[1])
+	}
+}
+
+// fakeBroker is a single broker cluster answering metadata, SASL and
+// produce requests
+type fakeBroker struct {
+	t          *testing.T
+	listener   net.Listener
+	partitions int32
+	username   string
+	password   string
+
+	mu             sync.Mutex
+	metadataCalls  int
+	produceErrors  []Error
+	produced       map[int32][]record
+	clientIDs      []string
+	requiredAcks   int16
+	unauthedAccess bool
+}
+
+func newFakeBroker(t *testing.T, partitions int32) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{t: t, listener: listener, partitions: partitions, produced: make(map[int32][]record)}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) address() string {
+	return b.listener.Addr().String()
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := false
+
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(reader, size[:]); err != nil {
+			return
+		}
+		frame := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			return
+		}
+		d := &decoder{b: frame}
+		apiKey, version, correlation := d.int16(), d.int16(), d.int32()
+		clientID := d.string()
+
+		b.mu.Lock()
+		b.clientIDs = append(b.clientIDs, clientID)
+		b.mu.Unlock()
+
+		if b.username != "" && !authenticated && apiKey != apiSaslHandshake && apiKey != apiSaslAuthenticate {
+			b.mu.Lock()
+			b.unauthedAccess = true
+			b.mu.Unlock()
+			return
+		}
+
+		e := &encoder{}
+		e.int32(correlation)
+		switch {
+		case apiKey == apiMetadata && version == metadataVersion:
+			b.metadata(d, e)
+		case apiKey == apiProduce && version == produceVersion:
+			b.produce(d, e)
+		case apiKey == apiSaslHandshake && version == saslHandshakeVersion:
+			if mechanism := d.string(); mechanism != "PLAIN" {
+				e.int16(int16(ErrSaslAuthentication))
+			} else {
+				e.int16(0)
+			}
+			e.arrayLength(1)
+			e.string("PLAIN")
+		case apiKey == apiSaslAuthenticate && version == saslAuthenticateVersion:
+			auth := d.bytes()
+			if string(auth) == "\x00"+b.username+"\x00"+b.password {
+				authenticated = true
+				e.int16(0)
+				e.nullableString("")
+			} else {
+				e.int16(int16(ErrSaslAuthentication))
+				e.string("invalid credentials")
+			}
+			e.bytes([]byte{})
+		default:
+			b.t.Errorf("unexpected request %d v%d", apiKey, version)
+			return
+		}
+
+		frame = binary.BigEndian.AppendUint32(nil, uint32(len(e.b)))
+		if _, err := conn.Write(append(frame, e.b...)); err != nil {
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) metadata(d *decoder, e *encoder) {
+	var topics []string
+	for n := d.arrayLength(); n > 0; n-- {
+		topics = append(topics, d.string())
+	}
+	d.bool()
+
+	b.mu.Lock()
+	b.metadataCalls++
+	b.mu.Unlock()
+
+	host, portText, _ := net.SplitHostPort(b.address())
+	port, _ := strconv.Atoi(portText)
+	e.int32(0) // throttle
+	e.arrayLength(1)
+	e.int32(1)
+	e.string(host)
+	e.int32(int32(port))
+	e.nullableString("")
+	e.nullableString("cluster")
+	e.int32(1)
+	e.arrayLength(len(topics))
+	for _, topic := range topics {
+		if topic != "events" {
+			e.int16(int16(ErrTopicAuthorization))
+			e.string(topic)
+			e.bool(false)
+			e.arrayLength(0)
+			continue
+		}
+		e.int16(0)
+		e.string(topic)
+		e.bool(false)
+		e.arrayLength(int(b.partitions))
+		for id := b.partitions - 1; id >= 0; id-- {
+			e.int16(0)
+			e.int32(id)
+			e.int32(1)
+			e.arrayLength(1)
+			e.int32(1)
+			e.arrayLength(1)
+			e.int32(1)
+		}
+	}
+}
+
+func (b *fakeBroker) produce(d *decoder, e *encoder) {
+	d.string() // transactional_id
+	acks := d.int16()
+	d.int32()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requiredAcks = acks
+	code := Error(0)
+	if len(b.produceErrors) > 0 {
+		code = b.produceErrors[0]
+		b.produceErrors = b.produceErrors[1:]
+	}
+
+	topics := d.arrayLength()
+	e.arrayLength(topics)
+	for ; topics > 0; topics-- {
+		topic := d.string()
+		e.string(topic)
+		partitions := d.arrayLength()
+		e.arrayLength(partitions)
+		for ; partitions > 0; partitions-- {
+			partition := d.int32()
+			batch := d.bytes()
+			if code == 0 {
+				b.produced[partition] = append(b.produced[partition], decodeRecordBatch(b.t, batch)...)
+			}
+			e.int32(partition)
+			e.int16(int16(code))
+			e.int64(0)
+			e.int64(-1)
+		}
+	}
+	e.int32(0)
+}
+
+func TestProducerPartitionsByKey(t *testing.T) {
+	broker := newFakeBroker(t, 3)
+	producer, err := NewProducer(Options{Brokers: []string{broker.address()}, ClientID: "triplink"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		messages := []Message{
+			{Key: []byte("21"), Value: []byte("trip 21 #" + strconv.Itoa(i))},
+			{Key: []byte("42"), Value: []byte("trip 42 #" + strconv.Itoa(i))},
+		}
+		if err := producer.Produce(ctx, "events", messages...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	// The partitions the Java client picks for the keys
+	expected := map[int32]string{0: "trip 21", 1: "trip 42"}
+	for partition, prefix := range expected {
+		records := broker.produced[partition]
+		if len(records) != 3 {
+			t.Fatalf("partition %d has %d records", partition, len(records))
+		}
+		for i, r := range records {
+			if string(r.value) != prefix+" #"+strconv.Itoa(i) {
+				t.Errorf("partition %d record %d is %q", partition, i, r.value)
+			}
+		}
+	}
+	if broker.metadataCalls != 1 {
+		t.Errorf("expected metadata to be cached, fetched %d times", broker.metadataCalls)
+	}
+	if broker.requiredAcks != -1 {
+		t.Errorf("expected acks from all replicas, got %d", broker.requiredAcks)
+	}
+	if broker.clientIDs[0] != "triplink" {
+		t.Errorf("unexpected client ID %q", broker.clientIDs[0])
+	}
+}
+
+func TestProducerRetriesAfterLeaderChange(t *testing.T) {
+	broker := newFakeBroker(t, 1)
+	broker.produceErrors = []Error{ErrNotLeaderOrFollower}
+	producer, _ := NewProducer(Options{Brokers: []string{broker.address()}})
+	defer producer.Close()
+
+	if err := producer.Produce(context.Background(), "events", Message{Key: []byte("1"), Value: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if len(broker.produced[0]) != 1 {
+		t.Errorf("expected the message to be produced once, got %d", len(broker.produced[0]))
+	}
+	if broker.metadataCalls != 2 {
+		t.Errorf("expected the leader to be looked up again, metadata fetched %d times", broker.metadataCalls)
+	}
+}
+
+func TestProducerErrors(t *testing.T) {
+	broker := newFakeBroker(t, 1)
+	producer, _ := NewProducer(Options{Brokers: []string{broker.address()}})
+	defer producer.Close()
+	ctx := context.Background()
+
+	err := producer.Produce(ctx, "forbidden", Message{Value: []byte("v")})
+	if !errors.Is(err, ErrTopicAuthorization) {
+		t.Errorf("expected a topic authorization error, got %v", err)
+	}
+
+	broker.mu.Lock()
+	broker.produceErrors = []Error{ErrNotEnoughReplicas, ErrNotEnoughReplicas, ErrNotEnoughReplicas}
+	broker.mu.Unlock()
+	if err := producer.Produce(ctx, "events", Message{Value: []byte("v")}); !errors.Is(err, ErrNotEnoughReplicas) {
+		t.Errorf("expected retries to give up, got %v", err)
+	}
+
+	unreachable, _ := NewProducer(Options{Brokers: []string{"127.0.0.1:1"}, Timeout: time.Second})
+	if err := unreachable.Produce(ctx, "events", Message{Value: []byte("v")}); err == nil {
+		t.Error("expected an unreachable cluster to fail")
+	}
+
+	if _, err := NewProducer(Options{}); err == nil {
+		t.Error("expected bootstrap brokers to be required")
+	}
+	if _, err := NewProducer(Options{Brokers: []string{"localhost:9092"}, Acks: 2}); err == nil {
+		t.Error("expected invalid acks to be rejected")
+	}
+}
+
+func TestProducerSASL(t *testing.T) {
+	broker := newFakeBroker(t, 1)
+	broker.username, broker.password = "triplink", "secret"
+	ctx := context.Background()
+
+	producer, _ := NewProducer(Options{Brokers: []string{broker.address()}, Username: "triplink", Password: "secret"})
+	defer producer.Close()
+	if err := producer.Produce(ctx, "events", Message{Value: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+
+	wrong, _ := NewProducer(Options{Brokers: []string{broker.address()}, Username: "triplink", Password: "wrong"})
+	defer wrong.Close()
+	err := wrong.Produce(ctx, "events", Message{Value: []byte("v")})
+	if !errors.Is(err, ErrSaslAuthentication) {
+		t.Errorf("expected an authentication error, got %v", err)
+	}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if broker.unauthedAccess {
+		t.Error("expected requests to wait for authentication")
+	}
+	if len(broker.produced[0]) != 1 {
+		t.Errorf("expected 1 record, got %d", len(broker.produced[0]))
+	}
+}
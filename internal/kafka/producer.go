@@ -0,0 +1,466 @@
+// Package kafka is a minimal Kafka producer for publishing tracking events
+// to a cluster. It speaks the produce and metadata APIs over plaintext or
+// TLS, with optional SASL/PLAIN authentication, and partitions messages by
+// key like the Java client. Consuming, compression, idempotence and
+// transactions are not supported.
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxResponseSize caps the responses read from a broker
+const maxResponseSize = 64 * 1024 * 1024
+
+// Options configure a producer
+type Options struct {
+	// Bootstrap brokers as host:port, used to discover the cluster
+	Brokers  []string
+	ClientID string
+
+	// Connect to the brokers over TLS
+	TLSConfig *tls.Config
+
+	// SASL/PLAIN credentials, used when Username is set
+	Username string
+	Password string
+
+	// Acknowledgements a produce request waits for: 1 for the partition
+	// leader's, -1 for all in-sync replicas'. Defaults to -1.
+	Acks int16
+
+	// How long a produce request waits for the acknowledgements, defaults
+	// to 10 seconds
+	Timeout time.Duration
+
+	// Partition leaders are looked up again after this long, defaults to 5
+	// minutes. They are also looked up when a broker reports it is no
+	// longer the leader.
+	MetadataMaxAge time.Duration
+}
+
+// Producer produces messages to a cluster. It is safe for concurrent use.
+type Producer struct {
+	opts Options
+
+	mu         sync.Mutex
+	conns      map[int32]*brokerConn
+	brokers    map[int32]broker
+	partitions map[string][]partitionMetadata
+	fetchedAt  map[string]time.Time
+	roundRobin uint32
+}
+
+// NewProducer creates a producer. Connections are made on the first
+// produce.
+func NewProducer(opts Options) (*Producer, error) {
+	if len(opts.Brokers) == 0 {
+		return nil, errors.New("kafka: no bootstrap brokers")
+	}
+	if opts.Acks == 0 {
+		opts.Acks = -1
+	}
+	if opts.Acks != 1 && opts.Acks != -1 {
+		return nil, errors.New("kafka: acks must be 1 or -1")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.MetadataMaxAge <= 0 {
+		opts.MetadataMaxAge = 5 * time.Minute
+	}
+	return &Producer{
+		opts:       opts,
+		conns:      make(map[int32]*brokerConn),
+		brokers:    make(map[int32]broker),
+		partitions: make(map[string][]partitionMetadata),
+		fetchedAt:  make(map[string]time.Time),
+	}, nil
+}
+
+// Produce appends messages to a topic and waits for their acknowledgement.
+// Requests failing with a retriable error are retried twice after looking
+// up the partition leaders again, so a message may be appended more than
+// once.
+func (p *Producer) Produce(ctx context.Context, topic string, messages ...Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+			}
+		}
+
+		if err = p.produce(ctx, topic, messages); err == nil {
+			return nil
+		}
+		if !p.retriable(ctx, err) {
+			return err
+		}
+		p.forget(topic)
+	}
+	return err
+}
+
+// Close closes the connections to the brokers
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, conn := range p.conns {
+		conn.close()
+		delete(p.conns, id)
+	}
+	return nil
+}
+
+// retriable reports whether a failed produce may succeed when retried
+func (p *Producer) retriable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var code Error
+	if errors.As(err, &code) {
+		return code.Retriable()
+	}
+	// Connection failures
+	return true
+}
+
+// produce sends the messages to the leaders of their partitions
+func (p *Producer) produce(ctx context.Context, topic string, messages []Message) error {
+	partitions, err := p.partitionsFor(ctx, topic)
+	if err != nil {
+		return err
+	}
+
+	byLeader := make(map[int32]map[int32][]Message)
+	for _, message := range messages {
+		partition := partitions[p.partition(message.Key, len(partitions))]
+		if partition.err != 0 && partition.err != ErrLeaderNotAvailable {
+			return fmt.Errorf("%s/%d: %w", topic, partition.id, partition.err)
+		}
+		if partition.leader < 0 {
+			return fmt.Errorf("%s/%d: %w", topic, partition.id, ErrLeaderNotAvailable)
+		}
+		if byLeader[partition.leader] == nil {
+			byLeader[partition.leader] = make(map[int32][]Message)
+		}
+		byLeader[partition.leader][partition.id] = append(byLeader[partition.leader][partition.id], message)
+	}
+
+	for leader, byPartition := range byLeader {
+		batches := make(map[int32][]byte, len(byPartition))
+		for partition, partitionMessages := range byPartition {
+			for i := range partitionMessages {
+				if partitionMessages[i].Time.IsZero() {
+					partitionMessages[i].Time = time.Now()
+				}
+			}
+			batches[partition] = encodeRecordBatch(partitionMessages)
+		}
+
+		body := encodeProduceRequest(produceRequest{
+			acks:    p.opts.Acks,
+			timeout: int32(p.opts.Timeout.Milliseconds()),
+			batches: map[string]map[int32][]byte{topic: batches},
+		})
+		response, err := p.roundTrip(ctx, leader, apiProduce, produceVersion, body)
+		if err != nil {
+			return err
+		}
+		failed, err := decodeProduceResponse(response)
+		if err != nil {
+			return err
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("%s/%d: %w", failed[0].topic, failed[0].partition, failed[0].err)
+		}
+	}
+	return nil
+}
+
+// partition picks the partition of a key: the murmur2 hash of the key like
+// the Java client, or round robin for messages without a key
+func (p *Producer) partition(key []byte, count int) int {
+	if key == nil {
+		p.mu.Lock()
+		p.roundRobin++
+		n := p.roundRobin
+		p.mu.Unlock()
+		return int(n % uint32(count))
+	}
+	return int(uint32(murmur2(key))&0x7fffffff) % count
+}
+
+// partitionsFor returns the partitions of a topic indexed by ID, looking
+// them up when they are unknown or old
+func (p *Producer) partitionsFor(ctx context.Context, topic string) ([]partitionMetadata, error) {
+	p.mu.Lock()
+	partitions, ok := p.partitions[topic]
+	fresh := time.Since(p.fetchedAt[topic]) < p.opts.MetadataMaxAge
+	p.mu.Unlock()
+	if ok && fresh {
+		return partitions, nil
+	}
+
+	metadata, err := p.fetchMetadata(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range metadata.topics {
+		if t.name != topic {
+			continue
+		}
+		if t.err != 0 {
+			return nil, fmt.Errorf("%s: %w", topic, t.err)
+		}
+		partitions = make([]partitionMetadata, len(t.partitions))
+		for _, partition := range t.partitions {
+			if partition.id < 0 || int(partition.id) >= len(partitions) {
+				return nil, fmt.Errorf("kafka: %s has non-contiguous partition %d", topic, partition.id)
+			}
+			partitions[partition.id] = partition
+		}
+		if len(partitions) == 0 {
+			return nil, fmt.Errorf("%s: %w", topic, ErrLeaderNotAvailable)
+		}
+
+		p.mu.Lock()
+		for _, b := range metadata.brokers {
+			p.brokers[b.id] = b
+		}
+		p.partitions[topic] = partitions
+		p.fetchedAt[topic] = time.Now()
+		p.mu.Unlock()
+		return partitions, nil
+	}
+	return nil, fmt.Errorf("%s: %w", topic, ErrUnknownTopicOrPartition)
+}
+
+// fetchMetadata asks the bootstrap brokers in turn for a topic's metadata
+func (p *Producer) fetchMetadata(ctx context.Context, topic string) (*metadataResponse, error) {
+	var lastErr error
+	for _, address := range p.opts.Brokers {
+		conn, err := p.dial(ctx, address)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, err := conn.roundTrip(ctx, p.opts, apiMetadata, metadataVersion, encodeMetadataRequest([]string{topic}))
+		conn.close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return decodeMetadataResponse(body)
+	}
+	return nil, fmt.Errorf("kafka: no bootstrap broker reachable: %w", lastErr)
+}
+
+// forget drops the partitions of a topic and the connections, so the next
+// attempt looks up the leaders and reconnects
+func (p *Producer) forget(topic string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.partitions, topic)
+	for id, conn := range p.conns {
+		conn.close()
+		delete(p.conns, id)
+	}
+}
+
+// roundTrip sends a request to a broker, connecting to it when needed
+func (p *Producer) roundTrip(ctx context.Context, brokerID int32, apiKey, version int16, body []byte) ([]byte, error) {
+	p.mu.Lock()
+	conn, ok := p.conns[brokerID]
+	b, known := p.brokers[brokerID]
+	p.mu.Unlock()
+
+	if !ok {
+		if !known {
+			return nil, fmt.Errorf("kafka: unknown broker %d", brokerID)
+		}
+		var err error
+		if conn, err = p.dial(ctx, net.JoinHostPort(b.host, strconv.Itoa(int(b.port)))); err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		if existing, ok := p.conns[brokerID]; ok {
+			conn.close()
+			conn = existing
+		} else {
+			p.conns[brokerID] = conn
+		}
+		p.mu.Unlock()
+	}
+
+	response, err := conn.roundTrip(ctx, p.opts, apiKey, version, body)
+	if err != nil {
+		p.mu.Lock()
+		if p.conns[brokerID] == conn {
+			delete(p.conns, brokerID)
+		}
+		p.mu.Unlock()
+		conn.close()
+	}
+	return response, err
+}
+
+// dial connects and authenticates to a broker
+func (p *Producer) dial(ctx context.Context, address string) (*brokerConn, error) {
+	dialer := &net.Dialer{Timeout: p.opts.Timeout}
+	c, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: failed to connect to %s: %w", address, err)
+	}
+	if p.opts.TLSConfig != nil {
+		config := p.opts.TLSConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(address)
+		}
+		tlsConn := tls.Client(c, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("kafka: TLS handshake with %s failed: %w", address, err)
+		}
+		c = tlsConn
+	}
+
+	conn := &brokerConn{conn: c, reader: bufio.NewReader(c)}
+	if p.opts.Username != "" {
+		if err := conn.authenticate(ctx, p.opts); err != nil {
+			conn.close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// brokerConn is a connection to a broker. Requests are sent one at a time.
+type brokerConn struct {
+	mu          sync.Mutex
+	conn        net.Conn
+	reader      *bufio.Reader
+	correlation int32
+}
+
+// authenticate performs the SASL/PLAIN handshake
+func (c *brokerConn) authenticate(ctx context.Context, opts Options) error {
+	body, err := c.roundTrip(ctx, opts, apiSaslHandshake, saslHandshakeVersion, encodeSaslHandshakeRequest("PLAIN"))
+	if err != nil {
+		return err
+	}
+	if mechanisms, err := decodeSaslHandshakeResponse(body); err != nil {
+		return fmt.Errorf("kafka: broker does not accept SASL/PLAIN, only %v: %w", mechanisms, err)
+	}
+
+	auth := []byte("\x00" + opts.Username + "\x00" + opts.Password)
+	body, err = c.roundTrip(ctx, opts, apiSaslAuthenticate, saslAuthenticateVersion, encodeSaslAuthenticateRequest(auth))
+	if err != nil {
+		return err
+	}
+	return decodeSaslAuthenticateResponse(body)
+}
+
+// roundTrip writes a request and reads its response, returning the response
+// body after the header
+func (c *brokerConn) roundTrip(ctx context.Context, opts Options, apiKey, version int16, body []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deadline := time.Now().Add(opts.Timeout + 10*time.Second)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	c.conn.SetDeadline(deadline)
+
+	c.correlation++
+	header := &encoder{}
+	header.int16(apiKey)
+	header.int16(version)
+	header.int32(c.correlation)
+	header.nullableString(opts.ClientID)
+
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(header.b)+len(body)))
+	frame = append(frame, header.b...)
+	frame = append(frame, body...)
+	if _, err := c.conn.Write(frame); err != nil {
+		return nil, fmt.Errorf("kafka: failed to send request: %w", err)
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c.reader, size[:]); err != nil {
+		return nil, fmt.Errorf("kafka: failed to read response: %w", err)
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > maxResponseSize {
+		return nil, fmt.Errorf("kafka: invalid response size %d", n)
+	}
+	response := make([]byte, n)
+	if _, err := io.ReadFull(c.reader, response); err != nil {
+		return nil, fmt.Errorf("kafka: failed to read response: %w", err)
+	}
+	if correlation := int32(binary.BigEndian.Uint32(response)); correlation != c.correlation {
+		return nil, fmt.Errorf("kafka: response %d to request %d", correlation, c.correlation)
+	}
+	return response[4:], nil
+}
+
+func (c *brokerConn) close() {
+	c.conn.Close()
+}
+
+// murmur2 is the hash the Java client partitions keys by
+func murmur2(data []byte) int32 {
+	const (
+		seed = 0x9747b28c
+		m    = 0x5bd1e995
+		r    = 24
+	)
+	length := len(data)
+	h := uint32(seed) ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
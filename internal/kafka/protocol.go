@@ -0,0 +1,332 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// API keys and the versions of them the producer speaks, all supported by
+// brokers from Kafka 1.0 through 4.x
+const (
+	apiProduce          = 0
+	apiMetadata         = 3
+	apiSaslHandshake    = 17
+	apiSaslAuthenticate = 36
+
+	produceVersion          = 3
+	metadataVersion         = 4
+	saslHandshakeVersion    = 1
+	saslAuthenticateVersion = 0
+)
+
+// Error is an error code returned by a broker
+type Error int16
+
+// Error codes the producer handles
+const (
+	ErrUnknownTopicOrPartition Error = 3
+	ErrLeaderNotAvailable      Error = 5
+	ErrNotLeaderOrFollower     Error = 6
+	ErrRequestTimedOut         Error = 7
+	ErrNetworkException        Error = 13
+	ErrNotEnoughReplicas       Error = 19
+	ErrTopicAuthorization      Error = 29
+	ErrSaslAuthentication      Error = 58
+)
+
+func (e Error) Error() string {
+	names := map[Error]string{
+		ErrUnknownTopicOrPartition: "unknown topic or partition",
+		ErrLeaderNotAvailable:      "leader not available",
+		ErrNotLeaderOrFollower:     "not leader or follower",
+		ErrRequestTimedOut:         "request timed out",
+		ErrNetworkException:        "network exception",
+		ErrNotEnoughReplicas:       "not enough replicas",
+		ErrTopicAuthorization:      "topic authorization failed",
+		ErrSaslAuthentication:      "SASL authentication failed",
+	}
+	if name, ok := names[e]; ok {
+		return "kafka: " + name
+	}
+	return fmt.Sprintf("kafka: error code %d", int16(e))
+}
+
+// Retriable reports whether the request may succeed once metadata is
+// refreshed or the broker recovers
+func (e Error) Retriable() bool {
+	switch e {
+	case ErrUnknownTopicOrPartition, ErrLeaderNotAvailable, ErrNotLeaderOrFollower,
+		ErrRequestTimedOut, ErrNetworkException, ErrNotEnoughReplicas:
+		return true
+	}
+	return false
+}
+
+// encoder appends the primitive types of the protocol, all big-endian
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8)   { e.b = append(e.b, byte(v)) }
+func (e *encoder) int16(v int16) { e.b = binary.BigEndian.AppendUint16(e.b, uint16(v)) }
+func (e *encoder) int32(v int32) { e.b = binary.BigEndian.AppendUint32(e.b, uint32(v)) }
+func (e *encoder) int64(v int64) { e.b = binary.BigEndian.AppendUint64(e.b, uint64(v)) }
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.int8(1)
+	} else {
+		e.int8(0)
+	}
+}
+
+func (e *encoder) string(v string) {
+	e.int16(int16(len(v)))
+	e.b = append(e.b, v...)
+}
+
+// nullableString encodes an empty string as null
+func (e *encoder) nullableString(v string) {
+	if v == "" {
+		e.int16(-1)
+		return
+	}
+	e.string(v)
+}
+
+func (e *encoder) bytes(v []byte) {
+	if v == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(v)))
+	e.b = append(e.b, v...)
+}
+
+func (e *encoder) arrayLength(n int) { e.int32(int32(n)) }
+
+// decoder reads the primitive types of the protocol. Reading past the end
+// records an error and returns zero values, so responses are decoded without
+// checking every read.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+var errTruncated = errors.New("kafka: truncated response")
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return make([]byte, n)
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = errTruncated
+		return make([]byte, max(n, 0))
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) int8() int8   { return int8(d.next(1)[0]) }
+func (d *decoder) int16() int16 { return int16(binary.BigEndian.Uint16(d.next(2))) }
+func (d *decoder) int32() int32 { return int32(binary.BigEndian.Uint32(d.next(4))) }
+func (d *decoder) int64() int64 { return int64(binary.BigEndian.Uint64(d.next(8))) }
+func (d *decoder) bool() bool   { return d.int8() != 0 }
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.next(int(n))
+}
+
+// arrayLength reads the length of an array, treating null as empty
+func (d *decoder) arrayLength() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	if int(n) > len(d.b) {
+		// Every element takes at least a byte
+		d.err = errTruncated
+		return 0
+	}
+	return int(n)
+}
+
+// broker is a broker of the cluster as listed in metadata
+type broker struct {
+	id   int32
+	host string
+	port int32
+}
+
+// partitionMetadata is the leader of a partition
+type partitionMetadata struct {
+	err    Error
+	id     int32
+	leader int32
+}
+
+// topicMetadata is the partitions of a topic
+type topicMetadata struct {
+	err        Error
+	name       string
+	partitions []partitionMetadata
+}
+
+// metadataResponse is the part of a metadata response the producer uses
+type metadataResponse struct {
+	brokers []broker
+	topics  []topicMetadata
+}
+
+func encodeMetadataRequest(topics []string) []byte {
+	e := &encoder{}
+	e.arrayLength(len(topics))
+	for _, topic := range topics {
+		e.string(topic)
+	}
+	e.bool(false) // allow_auto_topic_creation
+	return e.b
+}
+
+func decodeMetadataResponse(body []byte) (*metadataResponse, error) {
+	d := &decoder{b: body}
+	d.int32() // throttle_time_ms
+
+	response := &metadataResponse{}
+	for n := d.arrayLength(); n > 0; n-- {
+		b := broker{id: d.int32(), host: d.string(), port: d.int32()}
+		d.string() // rack
+		response.brokers = append(response.brokers, b)
+	}
+	d.string() // cluster_id
+	d.int32()  // controller_id
+
+	for n := d.arrayLength(); n > 0; n-- {
+		topic := topicMetadata{err: Error(d.int16()), name: d.string()}
+		d.bool() // is_internal
+		for m := d.arrayLength(); m > 0; m-- {
+			partition := partitionMetadata{err: Error(d.int16()), id: d.int32(), leader: d.int32()}
+			for r := d.arrayLength(); r > 0; r-- {
+				d.int32() // replica_nodes
+			}
+			for r := d.arrayLength(); r > 0; r-- {
+				d.int32() // isr_nodes
+			}
+			topic.partitions = append(topic.partitions, partition)
+		}
+		response.topics = append(response.topics, topic)
+	}
+	return response, d.err
+}
+
+// produceRequest is the record batches of a produce request by topic and
+// partition
+type produceRequest struct {
+	acks    int16
+	timeout int32
+	batches map[string]map[int32][]byte
+}
+
+func encodeProduceRequest(req produceRequest) []byte {
+	e := &encoder{}
+	e.nullableString("") // transactional_id
+	e.int16(req.acks)
+	e.int32(req.timeout)
+	e.arrayLength(len(req.batches))
+	for topic, partitions := range req.batches {
+		e.string(topic)
+		e.arrayLength(len(partitions))
+		for partition, batch := range partitions {
+			e.int32(partition)
+			e.bytes(batch)
+		}
+	}
+	return e.b
+}
+
+// partitionError is the outcome of producing to a partition
+type partitionError struct {
+	topic     string
+	partition int32
+	err       Error
+}
+
+// decodeProduceResponse returns the partitions the records were not
+// appended to
+func decodeProduceResponse(body []byte) ([]partitionError, error) {
+	d := &decoder{b: body}
+	var failed []partitionError
+	for n := d.arrayLength(); n > 0; n-- {
+		topic := d.string()
+		for m := d.arrayLength(); m > 0; m-- {
+			partition := d.int32()
+			code := Error(d.int16())
+			d.int64() // base_offset
+			d.int64() // log_append_time_ms
+			if code != 0 {
+				failed = append(failed, partitionError{topic: topic, partition: partition, err: code})
+			}
+		}
+	}
+	d.int32() // throttle_time_ms
+	return failed, d.err
+}
+
+func encodeSaslHandshakeRequest(mechanism string) []byte {
+	e := &encoder{}
+	e.string(mechanism)
+	return e.b
+}
+
+func decodeSaslHandshakeResponse(body []byte) ([]string, error) {
+	d := &decoder{b: body}
+	code := Error(d.int16())
+	var mechanisms []string
+	for n := d.arrayLength(); n > 0; n-- {
+		mechanisms = append(mechanisms, d.string())
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if code != 0 {
+		return mechanisms, code
+	}
+	return mechanisms, nil
+}
+
+func encodeSaslAuthenticateRequest(auth []byte) []byte {
+	e := &encoder{}
+	e.bytes(auth)
+	return e.b
+}
+
+func decodeSaslAuthenticateResponse(body []byte) error {
+	d := &decoder{b: body}
+	code := Error(d.int16())
+	message := d.string()
+	d.bytes() // auth_bytes
+	if d.err != nil {
+		return d.err
+	}
+	if code != 0 {
+		if message != "" {
+			return fmt.Errorf("%w: %s", code, message)
+		}
+		return code
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"time"
+)
+
+// castagnoli is the CRC-32C table record batches are checksummed with
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Header is a header of a message
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Message is a message to produce. Messages with the same key go to the
+// same partition, so they are consumed in the order they were produced.
+type Message struct {
+	Key     []byte
+	Value   []byte
+	Headers []Header
+	Time    time.Time
+}
+
+// encodeRecordBatch encodes messages into a v2 record batch: uncompressed,
+// without idempotence or transactions
+func encodeRecordBatch(messages []Message) []byte {
+	first, last := messages[0].Time, messages[0].Time
+	for _, message := range messages {
+		if message.Time.Before(first) {
+			first = message.Time
+		}
+		if message.Time.After(last) {
+			last = message.Time
+		}
+	}
+
+	var records []byte
+	for i, message := range messages {
+		records = appendRecord(records, message, int64(i), message.Time.Sub(first).Milliseconds())
+	}
+
+	// The CRC covers everything from the attributes on
+	e := &encoder{}
+	e.int16(0) // attributes
+	e.int32(int32(len(messages) - 1))
+	e.int64(first.UnixMilli())
+	e.int64(last.UnixMilli())
+	e.int64(-1) // producer_id
+	e.int16(-1) // producer_epoch
+	e.int32(-1) // base_sequence
+	e.int32(int32(len(messages)))
+	e.b = append(e.b, records...)
+	checksummed := e.b
+
+	batch := &encoder{}
+	batch.int64(0) // base_offset
+	batch.int32(int32(4 + 1 + 4 + len(checksummed)))
+	batch.int32(-1) // partition_leader_epoch
+	batch.int8(2)   // magic
+	batch.b = binary.BigEndian.AppendUint32(batch.b, crc32.Checksum(checksummed, castagnoli))
+	batch.b = append(batch.b, checksummed...)
+	return batch.b
+}
+
+// appendRecord appends a record, prefixed with its length. Lengths and deltas
+// are zigzag varints.
+func appendRecord(b []byte, message Message, offsetDelta, timestampDelta int64) []byte {
+	var r []byte
+	r = append(r, 0) // attributes
+	r = binary.AppendVarint(r, timestampDelta)
+	r = binary.AppendVarint(r, offsetDelta)
+	r = appendVarBytes(r, message.Key)
+	r = appendVarBytes(r, message.Value)
+	r = binary.AppendVarint(r, int64(len(message.Headers)))
+	for _, header := range message.Headers {
+		r = appendVarBytes(r, []byte(header.Key))
+		r = appendVarBytes(r, header.Value)
+	}
+
+	b = binary.AppendVarint(b, int64(len(r)))
+	return append(b, r...)
+}
+
+func appendVarBytes(b, v []byte) []byte {
+	if v == nil {
+		return binary.AppendVarint(b, -1)
+	}
+	b = binary.AppendVarint(b, int64(len(v)))
+	return append(b, v...)
+}
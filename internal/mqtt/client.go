@@ -0,0 +1,307 @@
+// Package mqtt is a minimal MQTT 3.1.1 client for subscribing to the topics
+// that IoT GPS trackers publish positions to. It supports QoS 0 and 1
+// subscriptions, keep-alive pings and TLS, but not publishing or QoS 2.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMaxPacketSize caps the packets read from the broker
+const defaultMaxPacketSize = 1024 * 1024
+
+// Options configure a connection to a broker
+type Options struct {
+	// Broker URL, tcp://host:1883, or ssl://host:8883 or mqtts:// for TLS
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+
+	// Start without the subscriptions and queued messages of a previous
+	// session with the same client ID
+	CleanSession bool
+
+	// Interval of pings that keep the connection alive, 0 disables them
+	KeepAlive time.Duration
+
+	// TLS settings for ssl:// and mqtts:// brokers
+	TLSConfig *tls.Config
+
+	// Largest packet accepted from the broker, defaults to 1 MiB
+	MaxPacketSize int
+}
+
+// Message is a message published to a subscribed topic
+type Message struct {
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retained bool
+}
+
+// Handler handles messages received on subscribed topics. QoS 1 messages
+// are acknowledged once the handler returns.
+type Handler func(Message)
+
+// ConnectError is the refusal of a connection by the broker
+type ConnectError struct {
+	Code byte
+}
+
+func (e *ConnectError) Error() string {
+	reasons := map[byte]string{
+		1: "unacceptable protocol version",
+		2: "client identifier rejected",
+		3: "server unavailable",
+		4: "bad user name or password",
+		5: "not authorized",
+	}
+	if reason, ok := reasons[e.Code]; ok {
+		return "connection refused: " + reason
+	}
+	return fmt.Sprintf("connection refused with code %d", e.Code)
+}
+
+// Client is a connection to a broker
+type Client struct {
+	conn          net.Conn
+	reader        *bufio.Reader
+	keepAlive     time.Duration
+	maxPacketSize int
+
+	writeMu sync.Mutex
+	nextID  uint16
+
+	// Messages received while waiting for a subscription to be acknowledged
+	pending []Message
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Connect opens a session with the broker
+func Connect(ctx context.Context, opts Options) (*Client, error) {
+	if opts.ClientID == "" && !opts.CleanSession {
+		return nil, errors.New("client ID is required for persistent sessions")
+	}
+	broker, err := url.Parse(opts.Broker)
+	if err != nil || broker.Host == "" {
+		return nil, fmt.Errorf("invalid broker URL %q", opts.Broker)
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{}
+	switch strings.ToLower(broker.Scheme) {
+	case "tcp", "mqtt":
+		conn, err = dialer.DialContext(ctx, "tcp", broker.Host)
+	case "ssl", "tls", "mqtts":
+		tlsConfig := opts.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", broker.Host)
+	default:
+		return nil, fmt.Errorf("unsupported broker scheme %q", broker.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to broker: %w", err)
+	}
+
+	client := newClient(conn, opts)
+	if err := client.handshake(ctx, opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func newClient(conn net.Conn, opts Options) *Client {
+	maxPacketSize := opts.MaxPacketSize
+	if maxPacketSize <= 0 {
+		maxPacketSize = defaultMaxPacketSize
+	}
+	return &Client{
+		conn:          conn,
+		reader:        bufio.NewReader(conn),
+		keepAlive:     opts.KeepAlive,
+		maxPacketSize: maxPacketSize,
+		closed:        make(chan struct{}),
+	}
+}
+
+// handshake sends CONNECT and waits for the broker to accept it
+func (c *Client) handshake(ctx context.Context, opts Options) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+		defer c.conn.SetDeadline(time.Time{})
+	}
+
+	if err := c.write(connectPacket(opts)); err != nil {
+		return fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+	ack, err := readPacket(c.reader, c.maxPacketSize)
+	if err != nil {
+		return fmt.Errorf("failed to read CONNACK: %w", err)
+	}
+	if ack.kind != packetConnack || len(ack.body) != 2 {
+		return errors.New("broker did not acknowledge the connection")
+	}
+	if ack.body[1] != 0 {
+		return &ConnectError{Code: ack.body[1]}
+	}
+	return nil
+}
+
+// Subscribe subscribes to a topic filter with QoS 0 or 1, waiting for the
+// broker to acknowledge it. It must be called before Serve.
+func (c *Client) Subscribe(filter string, qos byte) error {
+	if qos > 1 {
+		return errors.New("only QoS 0 and 1 are supported")
+	}
+
+	c.nextID++
+	id := c.nextID
+	if err := c.write(subscribePacket(id, filter, qos)); err != nil {
+		return fmt.Errorf("failed to send SUBSCRIBE: %w", err)
+	}
+
+	for {
+		p, err := readPacket(c.reader, c.maxPacketSize)
+		if err != nil {
+			return fmt.Errorf("failed to read SUBACK: %w", err)
+		}
+		switch p.kind {
+		case packetSuback:
+			if len(p.body) < 3 || binary.BigEndian.Uint16(p.body) != id {
+				return errors.New("unexpected SUBACK")
+			}
+			if p.body[2] == 0x80 {
+				return fmt.Errorf("broker refused the subscription to %s", filter)
+			}
+			return nil
+		case packetPublish:
+			// Retained messages may arrive before the acknowledgement
+			message, _, err := parsePublish(p)
+			if err != nil {
+				return err
+			}
+			c.pending = append(c.pending, message)
+		}
+	}
+}
+
+// Serve delivers the messages of the subscribed topics to handler until the
+// connection is closed or lost, sending keep-alive pings meanwhile
+func (c *Client) Serve(handler Handler) error {
+	for _, message := range c.pending {
+		handler(message)
+	}
+	c.pending = nil
+
+	if c.keepAlive > 0 {
+		go c.ping()
+	}
+
+	for {
+		if c.keepAlive > 0 {
+			// The broker answers pings, so a silent connection is dead
+			c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		}
+		p, err := readPacket(c.reader, c.maxPacketSize)
+		if err != nil {
+			select {
+			case <-c.closed:
+				return nil
+			default:
+			}
+			c.Close()
+			return fmt.Errorf("connection lost: %w", err)
+		}
+
+		switch p.kind {
+		case packetPublish:
+			message, id, err := parsePublish(p)
+			if err != nil {
+				c.Close()
+				return err
+			}
+			handler(message)
+			if message.QoS == 1 {
+				ack := &packet{kind: packetPuback, body: binary.BigEndian.AppendUint16(nil, id)}
+				if err := c.write(ack); err != nil {
+					c.Close()
+					return fmt.Errorf("failed to send PUBACK: %w", err)
+				}
+			}
+		case packetPingresp, packetSuback:
+		default:
+			c.Close()
+			return fmt.Errorf("unexpected packet type %d", p.kind)
+		}
+	}
+}
+
+// ping sends PINGREQ every keep-alive interval until the client is closed
+func (c *Client) ping() {
+	ticker := time.NewTicker(c.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			if err := c.write(&packet{kind: packetPingreq}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Close disconnects from the broker
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.write(&packet{kind: packetDisconnect})
+		err = c.conn.Close()
+	})
+	return err
+}
+
+func (c *Client) write(p *packet) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(p.encode())
+	return err
+}
+
+// MatchTopic reports whether a topic matches a filter, where + matches one
+// level and a trailing # matches any number of levels
+func MatchTopic(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
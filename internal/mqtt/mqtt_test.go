@@ -0,0 +1,190 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeBroker accepts one connection and runs script against it
+func fakeBroker(t *testing.T, script func(r *bufio.Reader, conn net.Conn)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		script(bufio.NewReader(conn), conn)
+	}()
+	return "tcp://" + listener.Addr().String()
+}
+
+func publishPacket(topic string, qos byte, retained bool, id uint16, payload string) []byte {
+	flags := qos << 1
+	if retained {
+		flags |= 0x01
+	}
+	body := appendString(nil, topic)
+	if qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, payload...)
+	return (&packet{kind: packetPublish, flags: flags, body: body}).encode()
+}
+
+func TestSubscribeAndServe(t *testing.T) {
+	acked := make(chan uint16, 1)
+	broker := fakeBroker(t, func(r *bufio.Reader, conn net.Conn) {
+		connect, err := readPacket(r, defaultMaxPacketSize)
+		if err != nil || connect.kind != packetConnect {
+			t.Errorf("expected CONNECT, got %v %v", connect, err)
+			return
+		}
+		protocol, rest, _ := readString(connect.body)
+		if protocol != "MQTT" || rest[0] != 4 || rest[1] != 0xc2 || binary.BigEndian.Uint16(rest[2:]) != 30 {
+			t.Errorf("unexpected CONNECT header % x", connect.body)
+		}
+		clientID, rest, _ := readString(rest[4:])
+		username, rest, _ := readString(rest)
+		password, _, _ := readString(rest)
+		if clientID != "triplink" || username != "bridge" || password != "secret" {
+			t.Errorf("unexpected credentials %q %q %q", clientID, username, password)
+		}
+		conn.Write((&packet{kind: packetConnack, body: []byte{0, 0}}).encode())
+
+		subscribe, _ := readPacket(r, defaultMaxPacketSize)
+		if subscribe.kind != packetSubscribe || subscribe.flags != 0x02 {
+			t.Errorf("expected SUBSCRIBE, got %v", subscribe)
+			return
+		}
+		filter, rest, _ := readString(subscribe.body[2:])
+		if filter != "trackers/+/location" || rest[0] != 1 {
+			t.Errorf("unexpected subscription %q % x", filter, rest)
+		}
+
+		// A retained message arrives before the acknowledgement
+		conn.Write(publishPacket("trackers/A1/location", 0, true, 0, "retained"))
+		conn.Write((&packet{kind: packetSuback, body: append(subscribe.body[:2:2], 1)}).encode())
+		conn.Write(publishPacket("trackers/B2/location", 1, false, 7, "live"))
+
+		puback, err := readPacket(r, defaultMaxPacketSize)
+		if err == nil && puback.kind == packetPuback {
+			acked <- binary.BigEndian.Uint16(puback.body)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := Connect(ctx, Options{
+		Broker:       broker,
+		ClientID:     "triplink",
+		Username:     "bridge",
+		Password:     "secret",
+		CleanSession: true,
+		KeepAlive:    30 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Subscribe("trackers/+/location", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []Message
+	err = client.Serve(func(message Message) {
+		messages = append(messages, message)
+	})
+	if err == nil {
+		t.Error("expected the lost connection to be reported")
+	}
+
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(messages))
+	}
+	if messages[0].Topic != "trackers/A1/location" || string(messages[0].Payload) != "retained" || !messages[0].Retained {
+		t.Errorf("unexpected retained message %+v", messages[0])
+	}
+	if messages[1].Topic != "trackers/B2/location" || string(messages[1].Payload) != "live" || messages[1].QoS != 1 {
+		t.Errorf("unexpected message %+v", messages[1])
+	}
+	select {
+	case id := <-acked:
+		if id != 7 {
+			t.Errorf("expected PUBACK of packet 7, got %d", id)
+		}
+	case <-time.After(time.Second):
+		t.Error("QoS 1 message was not acknowledged")
+	}
+}
+
+func TestConnectRefused(t *testing.T) {
+	broker := fakeBroker(t, func(r *bufio.Reader, conn net.Conn) {
+		readPacket(r, defaultMaxPacketSize)
+		conn.Write((&packet{kind: packetConnack, body: []byte{0, 5}}).encode())
+	})
+
+	_, err := Connect(context.Background(), Options{Broker: broker, ClientID: "triplink"})
+	connectErr, ok := err.(*ConnectError)
+	if !ok || connectErr.Code != 5 {
+		t.Fatalf("expected a not authorized refusal, got %v", err)
+	}
+}
+
+func TestConnectRejectsUnsupportedBroker(t *testing.T) {
+	if _, err := Connect(context.Background(), Options{Broker: "ws://broker:8080", CleanSession: true}); err == nil {
+		t.Error("expected websocket brokers to be rejected")
+	}
+	if _, err := Connect(context.Background(), Options{Broker: "tcp://broker:1883"}); err == nil {
+		t.Error("expected a client ID to be required for persistent sessions")
+	}
+}
+
+func TestPacketRemainingLength(t *testing.T) {
+	for _, size := range []int{0, 127, 128, 16383, 16384, 300000} {
+		p := &packet{kind: packetPublish, flags: 0x02, body: bytes.Repeat([]byte{'x'}, size)}
+		decoded, err := readPacket(bufio.NewReader(bytes.NewReader(p.encode())), maxRemainingBytes)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if decoded.kind != packetPublish || decoded.flags != 0x02 || len(decoded.body) != size {
+			t.Errorf("size %d: decoded %d bytes of type %d", size, len(decoded.body), decoded.kind)
+		}
+	}
+
+	large := &packet{kind: packetPublish, body: make([]byte, 2048)}
+	if _, err := readPacket(bufio.NewReader(bytes.NewReader(large.encode())), 1024); err == nil {
+		t.Error("expected packets over the limit to be rejected")
+	}
+}
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		match  bool
+	}{
+		{"trackers/+/location", "trackers/A1/location", true},
+		{"trackers/+/location", "trackers/A1/status", false},
+		{"trackers/+/location", "trackers/A1/location/extra", false},
+		{"trackers/#", "trackers/A1/location", true},
+		{"trackers/#", "trackers", true},
+		{"trackers/A1", "trackers/A1", true},
+		{"trackers/A1", "trackers/A2", false},
+	}
+	for _, tt := range tests {
+		if got := MatchTopic(tt.filter, tt.topic); got != tt.match {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.match)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+	maxRemainingBytes = 268435455
+)
+
+// packet is a control packet: its type, the flags of the fixed header and
+// the rest of the packet
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+// readPacket reads the next control packet, rejecting packets larger than
+// maxSize
+func readPacket(r *bufio.Reader, maxSize int) (*packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	// Remaining length is encoded in up to four bytes, seven bits at a time
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return nil, errors.New("malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	if length > maxSize {
+		return nil, fmt.Errorf("packet of %d bytes exceeds the limit of %d", length, maxSize)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &packet{kind: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+// encode returns the packet with its fixed header
+func (p *packet) encode() []byte {
+	out := []byte{p.kind<<4 | p.flags}
+	length := len(p.body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(out, p.body...)
+}
+
+// appendString appends a length-prefixed UTF-8 string
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// readString reads a length-prefixed string at the start of b, returning it
+// and the rest of b
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("truncated string")
+	}
+	length := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+length {
+		return "", nil, errors.New("truncated string")
+	}
+	return string(b[2 : 2+length]), b[2+length:], nil
+}
+
+// connectPacket builds the CONNECT packet of a session
+func connectPacket(opts Options) *packet {
+	var flags byte
+	if opts.CleanSession {
+		flags |= 0x02
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags) // protocol level 4 is MQTT 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive.Seconds()))
+	body = appendString(body, opts.ClientID)
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+	}
+	if opts.Password != "" {
+		body = appendString(body, opts.Password)
+	}
+	return &packet{kind: packetConnect, body: body}
+}
+
+// subscribePacket builds a SUBSCRIBE packet for a topic filter
+func subscribePacket(id uint16, filter string, qos byte) *packet {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, filter)
+	body = append(body, qos)
+	// SUBSCRIBE requires the reserved flags to be 0010
+	return &packet{kind: packetSubscribe, flags: 0x02, body: body}
+}
+
+// parsePublish decodes a PUBLISH packet into a message and its packet ID,
+// which is only set for QoS 1 and 2
+func parsePublish(p *packet) (Message, uint16, error) {
+	message := Message{
+		QoS:      (p.flags >> 1) & 0x03,
+		Retained: p.flags&0x01 != 0,
+	}
+	topic, rest, err := readString(p.body)
+	if err != nil {
+		return message, 0, err
+	}
+	message.Topic = topic
+
+	var id uint16
+	if message.QoS > 0 {
+		if len(rest) < 2 {
+			return message, 0, errors.New("truncated packet ID")
+		}
+		id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	message.Payload = rest
+	return message, id, nil
+}
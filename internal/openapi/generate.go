@@ -0,0 +1,497 @@
+package openapi
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// modulePath is the import path of the module, under which packages are
+// read for the types annotations name
+const modulePath = "triplink/backend"
+
+// routeDecl is a route registered in routes.go
+type routeDecl struct {
+	method   string
+	path     string
+	handler  string
+	security string
+}
+
+// annotations are the swag annotations of a handler
+type annotations struct {
+	summary     string
+	description []string
+	tags        []string
+	accept      string
+	produce     []string
+	params      []paramAnnotation
+	responses   []responseAnnotation
+	routerPath  string
+	routerVerb  string
+}
+
+type paramAnnotation struct {
+	name        string
+	in          string
+	typ         string
+	required    bool
+	description string
+}
+
+type responseAnnotation struct {
+	status      string
+	kind        string
+	typ         string
+	description string
+}
+
+// Generate builds the spec of the API whose source is under root. It also
+// returns warnings about where the handler annotations disagree with the
+// routes, so they can be fixed.
+func Generate(root string) (*Document, []string, error) {
+	routes, err := parseRoutes(filepath.Join(root, "routes", "routes.go"))
+	if err != nil {
+		return nil, nil, err
+	}
+	types := newTypeIndex(root)
+	handlers, err := types.load(modulePath + "/handlers")
+	if err != nil {
+		return nil, nil, err
+	}
+	docs := handlerAnnotations(handlers)
+
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       "Triplink API",
+			Description: "Generated from the routes and handler annotations by cmd/openapi",
+			Version:     "1.0",
+		},
+		Paths: map[string]PathItem{},
+		Components: Components{
+			Schemas: types.schemas,
+			SecuritySchemes: map[string]*SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				"apiKeyAuth": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+			},
+		},
+	}
+	// The envelope of package apierror, which handlers' own error bodies
+	// are sent in
+	types.schemas[ErrorSchema] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"error":    {Type: "string"},
+			"code":     {Type: "string"},
+			"details":  {},
+			"trace_id": {Type: "string"},
+		},
+		Required: []string{"error"},
+	}
+
+	var warnings []string
+	warn := func(r routeDecl, format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf("%s %s (%s): %s", r.method, r.path, r.handler, fmt.Sprintf(format, args...)))
+	}
+	// Handlers routed more than once document one of their routes
+	routed := map[string]bool{}
+	for _, r := range routes {
+		routed[r.handler+" "+r.method+" "+r.path] = true
+	}
+	operationIDs := map[string]int{}
+	for _, r := range routes {
+		a, documented := docs[r.handler]
+		if !documented {
+			warn(r, "handler has no annotations")
+			a = &annotations{}
+		} else if verb := strings.ToUpper(a.routerVerb); a.routerPath != "" && !routed[r.handler+" "+verb+" /api"+openAPIPath(a.routerPath)] && !routed[r.handler+" "+verb+" "+openAPIPath(a.routerPath)] {
+			warn(r, "@Router says %s [%s]", a.routerPath, a.routerVerb)
+		}
+
+		operationIDs[r.handler]++
+		operation := &Operation{
+			OperationID: r.handler,
+			Summary:     a.summary,
+			Description: strings.Join(a.description, " "),
+			Tags:        a.tags,
+			Responses:   map[string]*Response{},
+		}
+		if n := operationIDs[r.handler]; n > 1 {
+			operation.OperationID += strconv.Itoa(n)
+		}
+		if r.security != "" {
+			operation.Security = []map[string][]string{{r.security: {}}}
+		}
+
+		inPath := map[string]bool{}
+		for _, segment := range splitPath(r.path) {
+			if isParam(segment) {
+				inPath[strings.Trim(segment, "{}")] = true
+			}
+		}
+		documentedPath := map[string]bool{}
+		form := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		for _, p := range a.params {
+			switch p.in {
+			case "path":
+				if !inPath[p.name] {
+					warn(r, "path parameter %s isn't in the route", p.name)
+					continue
+				}
+				documentedPath[p.name] = true
+				operation.Parameters = append(operation.Parameters, &Parameter{
+					Name: p.name, In: "path", Description: p.description, Required: true,
+					Schema: types.annotationSchema(p.typ),
+				})
+			case "query", "header":
+				operation.Parameters = append(operation.Parameters, &Parameter{
+					Name: p.name, In: p.in, Description: p.description, Required: p.required,
+					Schema: types.annotationSchema(p.typ),
+				})
+			case "body":
+				operation.RequestBody = &RequestBody{
+					Description: p.description,
+					Required:    p.required,
+					Content:     map[string]*MediaType{mimeType(a.accept, "application/json"): {Schema: types.annotationSchema(p.typ)}},
+				}
+			case "formData":
+				schema := types.annotationSchema(p.typ)
+				if p.typ == "file" {
+					schema = &Schema{Type: "string", Format: "binary"}
+				}
+				form.Properties[p.name] = schema
+				if p.required {
+					form.Required = append(form.Required, p.name)
+				}
+			}
+		}
+		if len(form.Properties) > 0 {
+			operation.RequestBody = &RequestBody{
+				Required: len(form.Required) > 0,
+				Content:  map[string]*MediaType{mimeType(a.accept, "multipart/form-data"): {Schema: form}},
+			}
+		}
+		for _, segment := range splitPath(r.path) {
+			name := strings.Trim(segment, "{}")
+			if isParam(segment) && !documentedPath[name] {
+				if documented {
+					warn(r, "path parameter %s isn't documented", name)
+				}
+				operation.Parameters = append(operation.Parameters, &Parameter{
+					Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"},
+				})
+			}
+		}
+
+		for _, response := range a.responses {
+			operation.Responses[response.status] = types.response(response, a.produce)
+		}
+		if len(a.responses) == 0 {
+			// Without annotations the success response could be anything
+			operation.Responses["200"] = &Response{
+				Description: "OK",
+				Content:     map[string]*MediaType{"application/json": {Schema: &Schema{}}},
+			}
+		}
+		operation.Responses["default"] = &Response{
+			Description: "Error",
+			Content:     map[string]*MediaType{"application/json": {Schema: &Schema{Ref: refPrefix + ErrorSchema}}},
+		}
+
+		item := doc.Paths[r.path]
+		if item == nil {
+			item = PathItem{}
+			doc.Paths[r.path] = item
+		}
+		item[strings.ToLower(r.method)] = operation
+	}
+
+	for _, err := range types.errors {
+		warnings = append(warnings, err)
+	}
+	doc.index()
+	return doc, warnings, nil
+}
+
+// response builds an annotated response. Handlers producing several content
+// types document the schema of the first; the others could be anything.
+func (x *typeIndex) response(a responseAnnotation, produce []string) *Response {
+	response := &Response{Description: a.description}
+	if response.Description == "" {
+		response.Description = statusText(a.status)
+	}
+	if a.kind == "" {
+		return response
+	}
+
+	var schema *Schema
+	fallback := "application/json"
+	switch a.kind {
+	case "file":
+		schema = &Schema{Type: "string", Format: "binary"}
+		fallback = "application/octet-stream"
+	case "array":
+		schema = &Schema{Type: "array", Items: x.annotationSchema(a.typ)}
+	default:
+		schema = x.annotationSchema(a.typ)
+	}
+	if len(produce) == 0 {
+		produce = []string{""}
+	}
+	response.Content = map[string]*MediaType{}
+	for i, contentType := range produce {
+		if i > 0 {
+			schema = &Schema{}
+		}
+		response.Content[mimeType(contentType, fallback)] = &MediaType{Schema: schema}
+	}
+	return response
+}
+
+func statusText(status string) string {
+	switch status {
+	case "200":
+		return "OK"
+	case "201":
+		return "Created"
+	case "202":
+		return "Accepted"
+	case "204":
+		return "No Content"
+	}
+	return "Error"
+}
+
+// mimeType expands swag's short names for content types
+func mimeType(value, fallback string) string {
+	switch strings.ToLower(value) {
+	case "":
+		return fallback
+	case "json":
+		return "application/json"
+	case "plain":
+		return "text/plain"
+	case "html":
+		return "text/html"
+	case "octet-stream":
+		return "application/octet-stream"
+	case "mpfd":
+		return "multipart/form-data"
+	}
+	return value
+}
+
+// parseRoutes reads the routes registered with handlers in routes.go,
+// following route groups and the authentication middleware they add
+func parseRoutes(path string) ([]routeDecl, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse routes: %w", err)
+	}
+
+	type group struct {
+		prefix   string
+		security string
+	}
+	groups := map[string]group{"app": {}}
+	var routes []routeDecl
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.AssignStmt:
+			if len(n.Lhs) != 1 || len(n.Rhs) != 1 {
+				return true
+			}
+			name, ok := n.Lhs[0].(*ast.Ident)
+			call, isCall := n.Rhs[0].(*ast.CallExpr)
+			if !ok || !isCall {
+				return true
+			}
+			receiver, method := callee(call)
+			parent, known := groups[receiver]
+			if method != "Group" || !known || len(call.Args) == 0 {
+				return true
+			}
+			prefix, ok := stringLiteral(call.Args[0])
+			if !ok {
+				return true
+			}
+			g := group{prefix: parent.prefix + prefix, security: parent.security}
+			if security := middlewareSecurity(call.Args[1:]); security != "" {
+				g.security = security
+			}
+			groups[name.Name] = g
+		case *ast.CallExpr:
+			receiver, method := callee(n)
+			g, known := groups[receiver]
+			verb := strings.ToUpper(method)
+			if !known || len(n.Args) < 2 || (verb != "GET" && verb != "POST" && verb != "PUT" && verb != "PATCH" && verb != "DELETE") {
+				return true
+			}
+			path, ok := stringLiteral(n.Args[0])
+			handlerPackage, handler := callee(&ast.CallExpr{Fun: n.Args[len(n.Args)-1]})
+			if !ok || handlerPackage != "handlers" {
+				return true
+			}
+			security := g.security
+			if s := middlewareSecurity(n.Args[1 : len(n.Args)-1]); s != "" {
+				security = s
+			}
+			routes = append(routes, routeDecl{
+				method:   verb,
+				path:     openAPIPath(g.prefix + path),
+				handler:  handler,
+				security: security,
+			})
+		}
+		return true
+	})
+	return routes, nil
+}
+
+// callee returns the receiver and name of a call like receiver.Name(...)
+func callee(call *ast.CallExpr) (string, string) {
+	selector, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return "", ""
+	}
+	receiver, ok := selector.X.(*ast.Ident)
+	if !ok {
+		return "", ""
+	}
+	return receiver.Name, selector.Sel.Name
+}
+
+// middlewareSecurity returns the security scheme the middleware of a route
+// or group authenticates with, if any
+func middlewareSecurity(args []ast.Expr) string {
+	for _, arg := range args {
+		call, ok := arg.(*ast.CallExpr)
+		if !ok {
+			continue
+		}
+		switch receiver, method := callee(call); {
+		case receiver == "auth" && method == "Middleware":
+			return "bearerAuth"
+		case method == "Authenticate":
+			return "apiKeyAuth"
+		}
+	}
+	return ""
+}
+
+func stringLiteral(expr ast.Expr) (string, bool) {
+	literal, ok := expr.(*ast.BasicLit)
+	if !ok || literal.Kind != token.STRING {
+		return "", false
+	}
+	value, err := strconv.Unquote(literal.Value)
+	return value, err == nil
+}
+
+// openAPIPath converts a fiber path to an OpenAPI path template, as
+// /trips/:trip_id/ to /trips/{trip_id}
+func openAPIPath(path string) string {
+	segments := splitPath(path)
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// handlerAnnotations parses the swag annotations of the functions of the
+// handlers package
+func handlerAnnotations(handlers *goPackage) map[string]*annotations {
+	docs := map[string]*annotations{}
+	for _, file := range handlers.files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || fn.Doc == nil {
+				continue
+			}
+			if a := parseAnnotations(fn.Doc.Text()); a != nil {
+				docs[fn.Name.Name] = a
+			}
+		}
+	}
+	return docs
+}
+
+// parseAnnotations parses swag annotations, or returns nil if a comment has
+// none. The first line starts with the function name, as in
+// "GetTrip @Summary Get a trip".
+func parseAnnotations(comment string) *annotations {
+	var a *annotations
+	for _, line := range strings.Split(comment, "\n") {
+		at := strings.Index(line, "@")
+		if at < 0 || (at > 0 && line[at-1] != ' ') {
+			continue
+		}
+		key, value, _ := strings.Cut(line[at:], " ")
+		value = strings.TrimSpace(value)
+		if a == nil {
+			a = &annotations{}
+		}
+		switch key {
+		case "@Summary":
+			a.summary = value
+		case "@Description":
+			a.description = append(a.description, value)
+		case "@Tags":
+			for _, tag := range strings.Split(value, ",") {
+				a.tags = append(a.tags, strings.TrimSpace(tag))
+			}
+		case "@Accept":
+			a.accept = value
+		case "@Produce":
+			for _, produce := range strings.Split(value, ",") {
+				a.produce = append(a.produce, strings.TrimSpace(produce))
+			}
+		case "@Param":
+			fields, description := splitQuoted(value)
+			if len(fields) < 3 {
+				continue
+			}
+			p := paramAnnotation{name: fields[0], in: fields[1], typ: fields[2], description: description}
+			if len(fields) > 3 {
+				p.required = fields[3] == "true"
+			}
+			a.params = append(a.params, p)
+		case "@Success", "@Failure":
+			fields, description := splitQuoted(value)
+			if len(fields) == 0 {
+				continue
+			}
+			r := responseAnnotation{status: fields[0], description: description}
+			if len(fields) > 2 {
+				r.kind = strings.Trim(fields[1], "{}")
+				r.typ = fields[2]
+			}
+			a.responses = append(a.responses, r)
+		case "@Router":
+			fields, _ := splitQuoted(value)
+			if len(fields) == 2 {
+				a.routerPath = fields[0]
+				a.routerVerb = strings.Trim(fields[1], "[]")
+			}
+		}
+	}
+	return a
+}
+
+// splitQuoted splits an annotation into its fields and its trailing quoted
+// description
+func splitQuoted(value string) ([]string, string) {
+	description := ""
+	if quote := strings.Index(value, `"`); quote >= 0 {
+		description = strings.Trim(strings.TrimSpace(value[quote:]), `"`)
+		value = value[:quote]
+	}
+	return strings.Fields(value), description
+}
@@ -0,0 +1,220 @@
+package openapi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSource writes a small backend to a directory, for Generate to read
+func writeSource(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return root
+}
+
+const testRoutes = `package routes
+
+func Setup(app *fiber.App) {
+	app.Get("/healthz", handlers.GetHealth)
+	app.Get("/api/books/:id", auth.Middleware(), handlers.GetBook)
+	books := app.Group("/api/books", auth.Middleware())
+	books.Get("/featured", handlers.GetFeaturedBooks)
+	books.Post("/", handlers.CreateBook)
+	app.Get("/swagger/*", swagger.HandlerDefault)
+}
+`
+
+const testHandlers = `package handlers
+
+import "triplink/backend/models"
+
+// GetHealth @Summary Get health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /healthz [get]
+func GetHealth(c *fiber.Ctx) error { return nil }
+
+// GetBook @Summary Get a book
+// @Description Get a book by ID
+// @Tags books
+// @Produce json
+// @Param book_id path int true "Book ID"
+// @Param fields query string false "Fields to return"
+// @Success 200 {object} models.Book
+// @Router /books/{book_id} [get]
+func GetBook(c *fiber.Ctx) error { return nil }
+
+// GetFeaturedBooks @Summary Get featured books
+// @Produce json
+// @Success 200 {array} models.Book
+// @Router /books/featured [get]
+func GetFeaturedBooks(c *fiber.Ctx) error { return nil }
+
+func CreateBook(c *fiber.Ctx) error { return nil }
+
+// BookPage is a page of books
+type BookPage struct {
+	Books []models.Book
+}
+`
+
+const testModels = `package models
+
+import "time"
+
+type BaseModel struct {
+	ID        uint       ` + "`json:\"id\"`" + `
+	CreatedAt time.Time  ` + "`json:\"created_at\"`" + `
+	DeletedAt *time.Time ` + "`json:\"deleted_at,omitempty\"`" + `
+}
+
+type Book struct {
+	BaseModel
+	Title    string            ` + "`json:\"title\"`" + `
+	Pages    int               ` + "`json:\"pages\"`" + `
+	Rating   *float64          ` + "`json:\"rating\"`" + `
+	Author   *Author           ` + "`json:\"author,omitempty\"`" + `
+	Tags     []string          ` + "`json:\"tags\"`" + `
+	Extra    map[string]string ` + "`json:\"extra,omitempty\"`" + `
+	Secret   string            ` + "`json:\"-\"`" + `
+	internal string
+}
+
+type Author struct {
+	Name string ` + "`json:\"name\"`" + `
+}
+`
+
+func generateTestSpec(t *testing.T) (*Document, []string) {
+	root := writeSource(t, map[string]string{
+		"routes/routes.go":     testRoutes,
+		"handlers/handlers.go": testHandlers,
+		"models/models.go":     testModels,
+	})
+	doc, warnings, err := Generate(root)
+	require.NoError(t, err)
+	return doc, warnings
+}
+
+func TestGenerate(t *testing.T) {
+	doc, warnings := generateTestSpec(t)
+
+	assert.ElementsMatch(t, [][2]string{
+		{"GET", "/healthz"},
+		{"GET", "/api/books/{id}"},
+		{"GET", "/api/books/featured"},
+		{"POST", "/api/books"},
+	}, doc.Operations())
+
+	// Paths and parameters follow the routes, not the annotations
+	book := doc.Paths["/api/books/{id}"]["get"]
+	require.NotNil(t, book)
+	assert.Equal(t, "GetBook", book.OperationID)
+	assert.Equal(t, []string{"books"}, book.Tags)
+	assert.Equal(t, []map[string][]string{{"bearerAuth": {}}}, book.Security)
+	require.Len(t, book.Parameters, 2)
+	assert.Equal(t, "fields", book.Parameters[0].Name)
+	assert.Equal(t, "id", book.Parameters[1].Name)
+	assert.Equal(t, "#/components/schemas/models.Book", book.Responses["200"].Content["application/json"].Schema.Ref)
+	assert.Equal(t, "#/components/schemas/Error", book.Responses["default"].Content["application/json"].Schema.Ref)
+	assert.Nil(t, doc.Paths["/healthz"]["get"].Security)
+	assert.Equal(t, []map[string][]string{{"bearerAuth": {}}}, doc.Paths["/api/books"]["post"].Security)
+
+	assert.Equal(t, []string{
+		"GET /api/books/{id} (GetBook): @Router says /books/{book_id} [get]",
+		"GET /api/books/{id} (GetBook): path parameter book_id isn't in the route",
+		"GET /api/books/{id} (GetBook): path parameter id isn't documented",
+		"POST /api/books (CreateBook): handler has no annotations",
+	}, warnings)
+
+	// Schemas are encoded as encoding/json would encode the types
+	schema := doc.Components.Schemas["models.Book"]
+	require.NotNil(t, schema)
+	var names []string
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	assert.ElementsMatch(t, []string{"id", "created_at", "deleted_at", "title", "pages", "rating", "author", "tags", "extra"}, names)
+	assert.Equal(t, []string{"created_at", "id", "pages", "rating", "tags", "title"}, schema.Required)
+	assert.True(t, schema.AdditionalProperties.Forbidden)
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, schema.Properties["created_at"])
+	assert.Equal(t, &Schema{Type: "number", Nullable: true}, schema.Properties["rating"])
+	assert.Equal(t, &Schema{AllOf: []*Schema{{Ref: "#/components/schemas/models.Author"}}, Nullable: true}, schema.Properties["author"])
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Type: "string"}, Nullable: true}, schema.Properties["tags"])
+}
+
+func TestValidate(t *testing.T) {
+	doc, _ := generateTestSpec(t)
+	book := &Schema{Ref: "#/components/schemas/models.Book"}
+	decode := func(body string) interface{} {
+		var value interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &value))
+		return value
+	}
+
+	valid := decode(`{"id": 1, "created_at": "2024-05-01T10:00:00Z", "title": "Arrow of God", "pages": 230,
+		"rating": null, "tags": null, "author": {"name": "Achebe"}}`)
+	assert.NoError(t, doc.Validate(book, valid, true))
+
+	for body, message := range map[string]string{
+		`{"id": 1, "created_at": "2024-05-01T10:00:00Z", "title": "Arrow of God", "pages": 230, "tags": []}`:                              "$: is missing rating",
+		`{"id": 1.5, "created_at": "2024-05-01T10:00:00Z", "title": "Arrow of God", "pages": 230, "rating": 4, "tags": []}`:               "$.id: is a number, not an integer",
+		`{"id": 1, "created_at": "May 1st", "title": "Arrow of God", "pages": 230, "rating": 4, "tags": []}`:                              "$.created_at: isn't an RFC 3339 date-time",
+		`{"id": 1, "created_at": "2024-05-01T10:00:00Z", "title": "Arrow of God", "pages": 230, "rating": 4, "tags": [3]}`:                "$.tags[0]: is a number, not a string",
+		`{"id": 1, "created_at": "2024-05-01T10:00:00Z", "title": "Arrow of God", "pages": 230, "rating": 4, "tags": [], "isbn": "x"}`:    "$.isbn: isn't a property of the schema",
+		`{"id": 1, "created_at": "2024-05-01T10:00:00Z", "title": "Arrow of God", "pages": 230, "rating": 4, "tags": [], "author": null}`: "",
+	} {
+		err := doc.Validate(book, decode(body), true)
+		if message == "" {
+			assert.NoError(t, err, body)
+		} else {
+			assert.EqualError(t, err, message, body)
+		}
+	}
+
+	// Requests only have their types checked
+	assert.NoError(t, doc.Validate(book, decode(`{"title": "Arrow of God", "isbn": "x", "rating": null}`), false))
+	assert.EqualError(t, doc.Validate(book, decode(`{"pages": "many"}`), false), "$.pages: is a string, not an integer")
+
+	assert.NoError(t, ValidateParameter(&Parameter{Name: "id", In: "path", Schema: &Schema{Type: "integer"}}, "12"))
+	assert.EqualError(t, ValidateParameter(&Parameter{Name: "id", In: "path", Schema: &Schema{Type: "integer"}}, "twelve"), "path id: isn't a valid integer")
+}
+
+func TestFind(t *testing.T) {
+	doc, _ := generateTestSpec(t)
+
+	operation, path, params := doc.Find("GET", "/api/books/featured")
+	require.NotNil(t, operation)
+	assert.Equal(t, "GetFeaturedBooks", operation.OperationID)
+	assert.Equal(t, "/api/books/featured", path)
+	assert.Empty(t, params)
+
+	operation, path, params = doc.Find("get", "/api/books/12/")
+	require.NotNil(t, operation)
+	assert.Equal(t, "/api/books/{id}", path)
+	assert.Equal(t, map[string]string{"id": "12"}, params)
+
+	operation, _, _ = doc.Find("DELETE", "/api/books/12")
+	assert.Nil(t, operation)
+}
+
+func TestSpecIsUpToDate(t *testing.T) {
+	doc, warnings, err := Generate(filepath.Join("..", ".."))
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	spec, err := json.MarshalIndent(doc, "", "  ")
+	require.NoError(t, err)
+	current, err := os.ReadFile(filepath.Join("..", "..", "docs", "openapi.json"))
+	require.NoError(t, err)
+	assert.True(t, string(current) == string(spec)+"\n", "docs/openapi.json is out of date, run go run ./cmd/openapi")
+}
@@ -0,0 +1,402 @@
+package openapi
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goPackage is the parsed source of a package of the module
+type goPackage struct {
+	name       string
+	files      []*ast.File
+	types      map[string]*ast.TypeSpec
+	imports    map[string]map[string]string
+	marshalers map[string]bool
+}
+
+// typeIndex builds component schemas from the Go types of the module's
+// packages, reading the packages as types refer to them
+type typeIndex struct {
+	root     string
+	packages map[string]*goPackage
+	schemas  map[string]*Schema
+	errors   []string
+}
+
+func newTypeIndex(root string) *typeIndex {
+	return &typeIndex{root: root, packages: map[string]*goPackage{}, schemas: map[string]*Schema{}}
+}
+
+// load parses the non-test files of a package of the module
+func (x *typeIndex) load(importPath string) (*goPackage, error) {
+	if pkg, ok := x.packages[importPath]; ok {
+		return pkg, nil
+	}
+	dir := filepath.Join(x.root, strings.TrimPrefix(strings.TrimPrefix(importPath, modulePath), "/"))
+	parsed, err := parser.ParseDir(token.NewFileSet(), dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", importPath, err)
+	}
+
+	pkg := &goPackage{
+		name:       filepath.Base(dir),
+		types:      map[string]*ast.TypeSpec{},
+		imports:    map[string]map[string]string{},
+		marshalers: map[string]bool{},
+	}
+	var names []string
+	for name := range parsed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var paths []string
+		for path := range parsed[name].Files {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			file := parsed[name].Files[path]
+			pkg.files = append(pkg.files, file)
+			imports := fileImports(file)
+			for _, decl := range file.Decls {
+				switch d := decl.(type) {
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+							pkg.types[typeSpec.Name.Name] = typeSpec
+							pkg.imports[typeSpec.Name.Name] = imports
+						}
+					}
+				case *ast.FuncDecl:
+					if d.Recv != nil && d.Name.Name == "MarshalJSON" && len(d.Recv.List) == 1 {
+						if receiver := baseIdent(d.Recv.List[0].Type); receiver != "" {
+							pkg.marshalers[receiver] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	x.packages[importPath] = pkg
+	return pkg, nil
+}
+
+// fileImports maps the names a file imports packages by to their paths
+func fileImports(file *ast.File) map[string]string {
+	imports := map[string]string{}
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := filepath.Base(path)
+		if strings.HasPrefix(name, "v") && strings.Contains(path, "/") {
+			if _, err := strconv.Atoi(name[1:]); err == nil {
+				name = filepath.Base(filepath.Dir(path))
+			}
+		}
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = path
+	}
+	return imports
+}
+
+func baseIdent(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.StarExpr:
+		return baseIdent(e.X)
+	}
+	return ""
+}
+
+// annotationSchema returns the schema of a type named in a handler
+// annotation, such as models.Trip, []string or map[string]interface{}.
+// Unqualified names are types of the handlers package.
+func (x *typeIndex) annotationSchema(name string) *Schema {
+	expr, err := parser.ParseExpr(name)
+	if err != nil {
+		x.errors = append(x.errors, fmt.Sprintf("annotation type %s: %v", name, err))
+		return &Schema{}
+	}
+	// Annotations use swag's names for basic types
+	if ident, ok := expr.(*ast.Ident); ok {
+		switch ident.Name {
+		case "object":
+			return &Schema{Type: "object"}
+		case "integer":
+			return &Schema{Type: "integer"}
+		case "number":
+			return &Schema{Type: "number"}
+		case "boolean":
+			return &Schema{Type: "boolean"}
+		case "file":
+			return &Schema{Type: "string", Format: "binary"}
+		}
+	}
+	pkg, _ := x.load(modulePath + "/handlers")
+	imports := map[string]string{
+		"models":   modulePath + "/models",
+		"services": modulePath + "/services",
+		"graphql":  modulePath + "/internal/graphql",
+		"fiber":    "github.com/gofiber/fiber/v2",
+		"time":     "time",
+	}
+	schema := x.schema(pkg, imports, expr)
+	if schema.Ref == "" {
+		schema.Nullable = false
+	}
+	return schema
+}
+
+// schema returns the schema of a type expression in a package
+func (x *typeIndex) schema(pkg *goPackage, imports map[string]string, expr ast.Expr) *Schema {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if schema := basicSchema(e.Name); schema != nil {
+			return schema
+		}
+		if _, ok := pkg.types[e.Name]; ok {
+			return x.ref(pkg, e.Name)
+		}
+		x.errors = append(x.errors, fmt.Sprintf("unknown type %s.%s", pkg.name, e.Name))
+		return &Schema{}
+	case *ast.SelectorExpr:
+		packageName, ok := e.X.(*ast.Ident)
+		if !ok {
+			return &Schema{}
+		}
+		return x.external(imports[packageName.Name], e.Sel.Name)
+	case *ast.StarExpr:
+		return nullable(x.schema(pkg, imports, e.X))
+	case *ast.ArrayType:
+		if ident, ok := e.Elt.(*ast.Ident); ok && ident.Name == "byte" {
+			return &Schema{Type: "string", Format: "byte", Nullable: e.Len == nil}
+		}
+		return &Schema{Type: "array", Items: x.schema(pkg, imports, e.Elt), Nullable: e.Len == nil}
+	case *ast.MapType:
+		return &Schema{Type: "object", AdditionalProperties: &Additional{Schema: x.schema(pkg, imports, e.Value)}, Nullable: true}
+	case *ast.StructType:
+		return x.structSchema(pkg, imports, e)
+	}
+	// Interfaces, and anything else, could be any value
+	return &Schema{}
+}
+
+// basicSchema returns the schema of a predeclared type, or nil
+func basicSchema(name string) *Schema {
+	switch name {
+	case "string":
+		return &Schema{Type: "string"}
+	case "bool":
+		return &Schema{Type: "boolean"}
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte", "rune":
+		return &Schema{Type: "integer"}
+	case "float32", "float64":
+		return &Schema{Type: "number"}
+	case "any", "error":
+		return &Schema{}
+	}
+	return nil
+}
+
+// external returns the schema of a type of another package
+func (x *typeIndex) external(importPath, name string) *Schema {
+	switch importPath + "." + name {
+	case "time.Time":
+		return &Schema{Type: "string", Format: "date-time"}
+	case "time.Duration":
+		return &Schema{Type: "integer"}
+	case "gorm.io/gorm.DeletedAt":
+		return &Schema{Type: "string", Format: "date-time", Nullable: true}
+	case "github.com/gofiber/fiber/v2.Map":
+		return &Schema{Type: "object", AdditionalProperties: &Additional{Schema: &Schema{}}}
+	}
+	if !strings.HasPrefix(importPath, modulePath+"/") {
+		return &Schema{}
+	}
+	pkg, err := x.load(importPath)
+	if err != nil {
+		x.errors = append(x.errors, err.Error())
+		return &Schema{}
+	}
+	if _, ok := pkg.types[name]; !ok {
+		x.errors = append(x.errors, fmt.Sprintf("unknown type %s.%s", pkg.name, name))
+		return &Schema{}
+	}
+	return x.ref(pkg, name)
+}
+
+// ref returns a reference to the component schema of a named type, building
+// the component the first time
+func (x *typeIndex) ref(pkg *goPackage, name string) *Schema {
+	key := pkg.name + "." + name
+	ref := &Schema{Ref: refPrefix + key}
+	if _, ok := x.schemas[key]; ok {
+		return ref
+	}
+	// Types that encode themselves could be anything
+	x.schemas[key] = &Schema{}
+	if pkg.marshalers[name] {
+		return ref
+	}
+	spec := pkg.types[name]
+	if spec.TypeParams != nil {
+		return ref
+	}
+	schema := x.schema(pkg, pkg.imports[name], spec.Type)
+	// A named map or slice is still null when nil, which the referring
+	// field says
+	if schema.Ref == "" {
+		schema.Nullable = false
+	}
+	x.schemas[key] = schema
+	return ref
+}
+
+// nullable returns a schema that also allows null. OpenAPI 3.0 ignores
+// siblings of $ref, so references are wrapped in allOf.
+func nullable(schema *Schema) *Schema {
+	if schema.Ref != "" {
+		return &Schema{AllOf: []*Schema{schema}, Nullable: true}
+	}
+	if schema.Type == "" && len(schema.AllOf) == 0 {
+		return schema
+	}
+	copied := *schema
+	copied.Nullable = true
+	return &copied
+}
+
+// structSchema returns the schema of a struct as encoding/json marshals it:
+// every exported field is present unless it's omitempty, and the fields of
+// embedded structs without a JSON name are promoted
+func (x *typeIndex) structSchema(pkg *goPackage, imports map[string]string, st *ast.StructType) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: &Additional{Forbidden: true}}
+	required := map[string]bool{}
+	x.addFields(schema, required, pkg, imports, st, 0)
+	for name := range required {
+		schema.Required = append(schema.Required, name)
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// addFields adds the fields of a struct to an object schema. Fields of the
+// outer struct win over promoted ones with the same name.
+func (x *typeIndex) addFields(schema *Schema, required map[string]bool, pkg *goPackage, imports map[string]string, st *ast.StructType, depth int) {
+	var promoted []structDecl
+	for _, field := range st.Fields.List {
+		tag := ""
+		if field.Tag != nil {
+			value, _ := strconv.Unquote(field.Tag.Value)
+			tag = reflect.StructTag(value).Get("json")
+		}
+		if tag == "-" {
+			continue
+		}
+		jsonName, options, _ := strings.Cut(tag, ",")
+
+		names := field.Names
+		if len(names) == 0 {
+			if jsonName == "" {
+				if e, ok := x.embeddedStruct(pkg, imports, field.Type); ok {
+					promoted = append(promoted, e)
+					continue
+				}
+			}
+			typeName := baseIdent(field.Type)
+			if selector, ok := unstar(field.Type).(*ast.SelectorExpr); ok {
+				typeName = selector.Sel.Name
+			}
+			names = []*ast.Ident{ast.NewIdent(typeName)}
+		}
+
+		for _, name := range names {
+			if !name.IsExported() {
+				continue
+			}
+			property := jsonName
+			if property == "" {
+				property = name.Name
+			}
+			if _, exists := schema.Properties[property]; exists {
+				continue
+			}
+			fieldSchema := x.schema(pkg, imports, field.Type)
+			if strings.Contains(","+options+",", ",string,") {
+				fieldSchema = &Schema{Type: "string"}
+			}
+			schema.Properties[property] = fieldSchema
+			if !strings.Contains(","+options+",", ",omitempty,") {
+				required[property] = true
+			}
+		}
+	}
+
+	if depth > 8 {
+		return
+	}
+	for _, e := range promoted {
+		x.addFields(schema, required, e.pkg, e.imports, e.st, depth+1)
+	}
+}
+
+func unstar(expr ast.Expr) ast.Expr {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		return star.X
+	}
+	return expr
+}
+
+// structDecl is a struct type with the package and imports it's declared
+// with
+type structDecl struct {
+	pkg     *goPackage
+	imports map[string]string
+	st      *ast.StructType
+}
+
+// embeddedStruct finds the declaration of an embedded struct type
+func (x *typeIndex) embeddedStruct(pkg *goPackage, imports map[string]string, expr ast.Expr) (structDecl, bool) {
+	var found structDecl
+	owner, name := pkg, ""
+	switch e := unstar(expr).(type) {
+	case *ast.Ident:
+		name = e.Name
+	case *ast.SelectorExpr:
+		packageName, ok := e.X.(*ast.Ident)
+		if !ok || !strings.HasPrefix(imports[packageName.Name], modulePath+"/") {
+			return found, false
+		}
+		importPath := imports[packageName.Name]
+		loaded, err := x.load(importPath)
+		if err != nil {
+			return found, false
+		}
+		owner, name = loaded, e.Sel.Name
+	default:
+		return found, false
+	}
+	spec, ok := owner.types[name]
+	if !ok || owner.marshalers[name] {
+		return found, false
+	}
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return found, false
+	}
+	found.pkg, found.imports, found.st = owner, owner.imports[name], st
+	return found, true
+}
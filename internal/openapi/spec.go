@@ -0,0 +1,258 @@
+// Package openapi generates the OpenAPI 3 spec of the API and validates
+// requests and responses against it. Paths come from the routes registered
+// in routes/routes.go rather than the @Router annotations, which have drifted,
+// and schemas come from the Go types the handler annotations name.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Document is an OpenAPI 3 document
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+
+	routes []*route
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem is the operations of a path by lower case method
+type PathItem map[string]*Operation
+
+// Operation is a method of a path
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path, query or header parameter of an operation
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body an operation accepts
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+// MediaType is the schema of a body of a content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Response is a response of an operation. Responses without content have no
+// body.
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// Components are the schemas and security schemes operations refer to
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme is a way requests authenticate
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+// Schema is a JSON schema, in the subset OpenAPI 3.0 uses. The empty schema
+// matches any value.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Additional        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+}
+
+// Additional is the additionalProperties of an object schema: either false,
+// or the schema of the properties that aren't listed
+type Additional struct {
+	Forbidden bool
+	Schema    *Schema
+}
+
+func (a *Additional) MarshalJSON() ([]byte, error) {
+	if a.Forbidden {
+		return []byte("false"), nil
+	}
+	if a.Schema == nil {
+		return []byte("true"), nil
+	}
+	return json.Marshal(a.Schema)
+}
+
+func (a *Additional) UnmarshalJSON(data []byte) error {
+	switch strings.TrimSpace(string(data)) {
+	case "false":
+		a.Forbidden = true
+		return nil
+	case "true":
+		a.Schema = &Schema{}
+		return nil
+	}
+	a.Schema = &Schema{}
+	return json.Unmarshal(data, a.Schema)
+}
+
+// ErrorSchema is the name of the schema of error responses
+const ErrorSchema = "Error"
+
+// refPrefix is where $ref points to component schemas
+const refPrefix = "#/components/schemas/"
+
+// Load parses a JSON document
+func Load(data []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+	doc.index()
+	return &doc, nil
+}
+
+// route is an operation with its path template split into segments, for
+// matching request paths
+type route struct {
+	method    string
+	path      string
+	segments  []string
+	static    int
+	operation *Operation
+}
+
+// index splits the path templates of the operations for Find
+func (d *Document) index() {
+	d.routes = nil
+	for path, item := range d.Paths {
+		segments := splitPath(path)
+		static := 0
+		for _, segment := range segments {
+			if !isParam(segment) {
+				static++
+			}
+		}
+		for method, operation := range item {
+			d.routes = append(d.routes, &route{
+				method:    strings.ToUpper(method),
+				path:      path,
+				segments:  segments,
+				static:    static,
+				operation: operation,
+			})
+		}
+	}
+	// Paths with more fixed segments win, so /trips/active isn't taken for
+	// /trips/{id}
+	sort.Slice(d.routes, func(i, j int) bool {
+		if d.routes[i].static != d.routes[j].static {
+			return d.routes[i].static > d.routes[j].static
+		}
+		return d.routes[i].path < d.routes[j].path
+	})
+}
+
+// Find returns the operation of a request, its path template and the values
+// of its path parameters, or a nil operation when the spec doesn't have one
+func (d *Document) Find(method, path string) (*Operation, string, map[string]string) {
+	segments := splitPath(path)
+	method = strings.ToUpper(method)
+	for _, r := range d.routes {
+		if r.method != method || len(r.segments) != len(segments) {
+			continue
+		}
+		params := map[string]string{}
+		matched := true
+		for i, segment := range r.segments {
+			if isParam(segment) {
+				if segments[i] == "" {
+					matched = false
+					break
+				}
+				params[strings.Trim(segment, "{}")] = segments[i]
+			} else if segment != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return r.operation, r.path, params
+		}
+	}
+	return nil, "", nil
+}
+
+// Operations returns the method and path template of every operation, sorted
+// by path
+func (d *Document) Operations() [][2]string {
+	var operations [][2]string
+	for path, item := range d.Paths {
+		for method := range item {
+			operations = append(operations, [2]string{strings.ToUpper(method), path})
+		}
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		if operations[i][1] != operations[j][1] {
+			return operations[i][1] < operations[j][1]
+		}
+		return operations[i][0] < operations[j][0]
+	})
+	return operations
+}
+
+// Response returns the documented response of an operation for a status,
+// falling back to the default response
+func (o *Operation) Response(status int) *Response {
+	if response, ok := o.Responses[fmt.Sprintf("%d", status)]; ok {
+		return response
+	}
+	return o.Responses["default"]
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
@@ -0,0 +1,164 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationError is a value that doesn't match its schema
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Validate checks a value decoded from JSON against a schema. Strict
+// validation, for responses, also requires the required properties and
+// rejects nulls and properties the schema doesn't allow. Requests are only
+// checked for the types of the values they send, since handlers fill in
+// what's missing.
+func (d *Document) Validate(schema *Schema, value interface{}, strict bool) error {
+	return d.validate(schema, value, strict, "$")
+}
+
+func (d *Document) validate(schema *Schema, value interface{}, strict bool, path string) error {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != "" {
+		resolved, ok := d.Components.Schemas[strings.TrimPrefix(schema.Ref, refPrefix)]
+		if !ok {
+			return &ValidationError{Path: path, Message: "unknown schema " + schema.Ref}
+		}
+		return d.validate(resolved, value, strict, path)
+	}
+	if value == nil {
+		if !strict || schema.Nullable || isAny(schema) {
+			return nil
+		}
+		return &ValidationError{Path: path, Message: "is null"}
+	}
+	for _, part := range schema.AllOf {
+		if err := d.validate(part, value, strict, path); err != nil {
+			return err
+		}
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return typeError(path, "an object", value)
+		}
+		if strict {
+			for _, name := range schema.Required {
+				if _, ok := object[name]; !ok {
+					return &ValidationError{Path: path, Message: "is missing " + name}
+				}
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, listed := schema.Properties[name]
+			if !listed && schema.AdditionalProperties != nil {
+				if schema.AdditionalProperties.Forbidden {
+					if strict {
+						return &ValidationError{Path: path + "." + name, Message: "isn't a property of the schema"}
+					}
+					continue
+				}
+				property = schema.AdditionalProperties.Schema
+			}
+			if err := d.validate(property, object[name], strict, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return typeError(path, "an array", value)
+		}
+		for i, item := range array {
+			if err := d.validate(schema.Items, item, strict, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return typeError(path, "a string", value)
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, text); err != nil {
+				return &ValidationError{Path: path, Message: "isn't an RFC 3339 date-time"}
+			}
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) {
+			return typeError(path, "an integer", value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return typeError(path, "a number", value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return typeError(path, "a boolean", value)
+		}
+	}
+	return nil
+}
+
+// ValidateParameter checks the value of a path, query or header parameter.
+// Only numbers and booleans are checked, since every value is a string.
+func ValidateParameter(parameter *Parameter, value string) error {
+	if parameter.Schema == nil {
+		return nil
+	}
+	var err error
+	switch parameter.Schema.Type {
+	case "integer":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "number":
+		_, err = strconv.ParseFloat(value, 64)
+	case "boolean":
+		_, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		return &ValidationError{Path: parameter.In + " " + parameter.Name, Message: "isn't a valid " + parameter.Schema.Type}
+	}
+	return nil
+}
+
+func isAny(schema *Schema) bool {
+	return schema.Type == "" && len(schema.AllOf) == 0
+}
+
+func typeError(path, expected string, value interface{}) error {
+	actual := "a " + fmt.Sprintf("%T", value)
+	switch value.(type) {
+	case map[string]interface{}:
+		actual = "an object"
+	case []interface{}:
+		actual = "an array"
+	case string:
+		actual = "a string"
+	case float64:
+		actual = "a number"
+	case bool:
+		actual = "a boolean"
+	}
+	return &ValidationError{Path: path, Message: fmt.Sprintf("is %s, not %s", actual, expected)}
+}
@@ -0,0 +1,5 @@
+// Package telematicspb holds the messages and gRPC service of the telematics
+// ingestion API, generated from proto/telematics.proto
+package telematicspb
+
+//go:generate protoc -I ../../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative telematics.proto
@@ -0,0 +1,71 @@
+// Package timezone finds the timezone of a place from its coordinates and
+// renders times in it, so that trips stored in UTC can be shown at the local
+// time of their origin and destination.
+package timezone
+
+import (
+	"log"
+	"sync"
+	"time"
+	// Timezones must load on hosts without a zoneinfo database
+	_ "time/tzdata"
+
+	"github.com/ringsaturn/tzf"
+)
+
+var (
+	finder     tzf.F
+	finderOnce sync.Once
+)
+
+// defaultFinder loads the timezone boundaries on first use, since they take a
+// moment to decode. A finder that can't load leaves every place in UTC.
+func defaultFinder() tzf.F {
+	finderOnce.Do(func() {
+		f, err := tzf.NewDefaultFinder()
+		if err != nil {
+			log.Printf("Timezone lookups are disabled: %v", err)
+			return
+		}
+		finder = f
+	})
+	return finder
+}
+
+// Lookup returns the IANA name of the timezone at a latitude and longitude,
+// e.g. "America/Chicago", or "" when it isn't known. Coordinates of 0, 0 are
+// those of places that weren't geocoded and aren't looked up.
+func Lookup(lat, lng float64) string {
+	if lat == 0 && lng == 0 {
+		return ""
+	}
+	f := defaultFinder()
+	if f == nil {
+		return ""
+	}
+	return f.GetTimezoneName(lng, lat)
+}
+
+// Location returns the location of a timezone name, UTC for names that are
+// empty or unknown
+func Location(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// In returns a time in a timezone
+func In(t time.Time, name string) time.Time {
+	return t.In(Location(name))
+}
+
+// Format formats a time in a timezone. Layouts should include the zone, e.g.
+// "Jan 2 15:04 MST", since readers can't tell which one it is otherwise.
+func Format(t time.Time, name, layout string) string {
+	return In(t, name).Format(layout)
+}
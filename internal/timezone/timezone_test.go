@@ -0,0 +1,40 @@
+package timezone
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		expected string
+	}{
+		{"Chicago", 41.8781, -87.6298, "America/Chicago"},
+		{"Los Angeles", 34.0522, -118.2437, "America/Los_Angeles"},
+		{"Harare", -17.8292, 31.0522, "Africa/Harare"},
+		{"Berlin", 52.52, 13.405, "Europe/Berlin"},
+		{"Not geocoded", 0, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Lookup(tt.lat, tt.lng))
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	at := time.Date(2026, 1, 15, 18, 30, 0, 0, time.UTC)
+
+	assert.Equal(t, "Jan 15 12:30 CST", Format(at, "America/Chicago", "Jan 2 15:04 MST"))
+	assert.Equal(t, "Jan 15 20:30 CAT", Format(at, "Africa/Harare", "Jan 2 15:04 MST"))
+	// Unknown zones fall back to UTC
+	assert.Equal(t, "Jan 15 18:30 UTC", Format(at, "", "Jan 2 15:04 MST"))
+	assert.Equal(t, "Jan 15 18:30 UTC", Format(at, "Mars/Olympus_Mons", "Jan 2 15:04 MST"))
+
+	assert.True(t, at.Equal(In(at, "America/Chicago")))
+	assert.Equal(t, time.UTC, Location("Nowhere/Else"))
+}
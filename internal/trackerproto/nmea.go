@@ -0,0 +1,279 @@
+// Package trackerproto decodes the raw payloads of hardware GPS trackers,
+// NMEA 0183 sentences and Teltonika AVL packets, into positions in the units
+// tracking records use: decimal degrees, meters and km/h.
+package trackerproto
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// knotsToKmh converts speeds over ground reported in knots
+const knotsToKmh = 1.852
+
+// hdopAccuracyMeters estimates the horizontal accuracy of a fix from its
+// HDOP, assuming the typical 5 m range error of consumer receivers
+const hdopAccuracyMeters = 5.0
+
+// ErrChecksum is returned for sentences and packets whose checksum doesn't
+// match their content
+var ErrChecksum = errors.New("checksum mismatch")
+
+// Position is a fix decoded from a tracker payload
+type Position struct {
+	Latitude     float64
+	Longitude    float64
+	Altitude     *float64 // meters above sea level
+	Speed        *float64 // km/h
+	Heading      *float64 // degrees from true north
+	Accuracy     *float64 // meters
+	Satellites   *int
+	BatteryLevel *float64 // percent
+	Timestamp    time.Time
+}
+
+// nmeaFix is the part of a fix carried by one RMC or GGA sentence
+type nmeaFix struct {
+	timeOfDay time.Duration
+	date      time.Time // only RMC sentences carry the date
+	valid     bool
+	position  Position
+}
+
+// DecodeNMEA decodes a payload of NMEA sentences, one per line, into the
+// fixes it reports. RMC and GGA sentences of the same fix are merged; other
+// sentences are ignored, as are sentences without a fix. GGA sentences only
+// carry the time of day, so fixes without an RMC sentence are dated on the
+// UTC day of received. A sentence with a bad checksum fails the payload.
+func DecodeNMEA(payload []byte, received time.Time) ([]Position, error) {
+	var fixes []*nmeaFix
+	byTime := make(map[time.Duration]*nmeaFix)
+
+	scanner := bufio.NewScanner(bytes.NewReader(payload))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fix, err := parseNMEASentence(line)
+		if err != nil {
+			return nil, err
+		}
+		if fix == nil || !fix.valid {
+			continue
+		}
+
+		existing, ok := byTime[fix.timeOfDay]
+		if !ok {
+			byTime[fix.timeOfDay] = fix
+			fixes = append(fixes, fix)
+			continue
+		}
+		mergeNMEAFix(existing, fix)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	day := received.UTC().Truncate(24 * time.Hour)
+	positions := make([]Position, 0, len(fixes))
+	for _, fix := range fixes {
+		position := fix.position
+		date := fix.date
+		if date.IsZero() {
+			date = day
+			// A fix from just before midnight received just after it
+			if date.Add(fix.timeOfDay).After(received.Add(12 * time.Hour)) {
+				date = date.Add(-24 * time.Hour)
+			}
+		}
+		position.Timestamp = date.Add(fix.timeOfDay)
+		positions = append(positions, position)
+	}
+	return positions, nil
+}
+
+// mergeNMEAFix adds what one sentence of a fix knows to the other's
+func mergeNMEAFix(into, from *nmeaFix) {
+	if into.date.IsZero() {
+		into.date = from.date
+	}
+	p, q := &into.position, from.position
+	if p.Altitude == nil {
+		p.Altitude = q.Altitude
+	}
+	if p.Speed == nil {
+		p.Speed = q.Speed
+	}
+	if p.Heading == nil {
+		p.Heading = q.Heading
+	}
+	if p.Accuracy == nil {
+		p.Accuracy = q.Accuracy
+	}
+	if p.Satellites == nil {
+		p.Satellites = q.Satellites
+	}
+}
+
+// parseNMEASentence parses an RMC or GGA sentence, returning nil for other
+// sentence types
+func parseNMEASentence(sentence string) (*nmeaFix, error) {
+	if !strings.HasPrefix(sentence, "$") {
+		return nil, fmt.Errorf("invalid NMEA sentence %q", sentence)
+	}
+	star := strings.LastIndex(sentence, "*")
+	if star < 0 || len(sentence) != star+3 {
+		return nil, fmt.Errorf("NMEA sentence without checksum %q", sentence)
+	}
+	expected, err := strconv.ParseUint(sentence[star+1:], 16, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NMEA checksum %q", sentence[star+1:])
+	}
+	var sum byte
+	for i := 1; i < star; i++ {
+		sum ^= sentence[i]
+	}
+	if sum != byte(expected) {
+		return nil, fmt.Errorf("%w in %q", ErrChecksum, sentence)
+	}
+
+	fields := strings.Split(sentence[1:star], ",")
+	if len(fields[0]) != 5 {
+		return nil, nil
+	}
+	switch fields[0][2:] {
+	case "RMC":
+		return parseRMC(fields)
+	case "GGA":
+		return parseGGA(fields)
+	}
+	return nil, nil
+}
+
+// parseRMC parses a recommended minimum data sentence:
+// $--RMC,hhmmss.ss,A,ddmm.mm,N,dddmm.mm,E,knots,course,ddmmyy,...
+func parseRMC(fields []string) (*nmeaFix, error) {
+	if len(fields) < 10 {
+		return nil, fmt.Errorf("RMC sentence has %d fields", len(fields))
+	}
+	fix := &nmeaFix{valid: fields[2] == "A"}
+	if !fix.valid {
+		return fix, nil
+	}
+
+	var err error
+	if fix.timeOfDay, err = parseNMEATime(fields[1]); err != nil {
+		return nil, err
+	}
+	if fix.date, err = time.Parse("020106", fields[9]); err != nil {
+		return nil, fmt.Errorf("invalid RMC date %q", fields[9])
+	}
+	if fix.position.Latitude, fix.position.Longitude, err = parseNMEACoordinates(fields[3:7]); err != nil {
+		return nil, err
+	}
+	if knots, err := strconv.ParseFloat(fields[7], 64); err == nil {
+		speed := knots * knotsToKmh
+		fix.position.Speed = &speed
+	}
+	if course, err := strconv.ParseFloat(fields[8], 64); err == nil {
+		fix.position.Heading = &course
+	}
+	return fix, nil
+}
+
+// parseGGA parses a fix data sentence:
+// $--GGA,hhmmss.ss,ddmm.mm,N,dddmm.mm,E,quality,satellites,hdop,altitude,M,...
+func parseGGA(fields []string) (*nmeaFix, error) {
+	if len(fields) < 10 {
+		return nil, fmt.Errorf("GGA sentence has %d fields", len(fields))
+	}
+	fix := &nmeaFix{valid: fields[6] != "" && fields[6] != "0"}
+	if !fix.valid {
+		return fix, nil
+	}
+
+	var err error
+	if fix.timeOfDay, err = parseNMEATime(fields[1]); err != nil {
+		return nil, err
+	}
+	if fix.position.Latitude, fix.position.Longitude, err = parseNMEACoordinates(fields[2:6]); err != nil {
+		return nil, err
+	}
+	if satellites, err := strconv.Atoi(fields[7]); err == nil {
+		fix.position.Satellites = &satellites
+	}
+	if hdop, err := strconv.ParseFloat(fields[8], 64); err == nil {
+		accuracy := hdop * hdopAccuracyMeters
+		fix.position.Accuracy = &accuracy
+	}
+	if altitude, err := strconv.ParseFloat(fields[9], 64); err == nil {
+		fix.position.Altitude = &altitude
+	}
+	return fix, nil
+}
+
+// parseNMEATime parses hhmmss.ss into the time of day
+func parseNMEATime(value string) (time.Duration, error) {
+	if len(value) < 6 {
+		return 0, fmt.Errorf("invalid NMEA time %q", value)
+	}
+	hours, err1 := strconv.Atoi(value[0:2])
+	minutes, err2 := strconv.Atoi(value[2:4])
+	seconds, err3 := strconv.ParseFloat(value[4:], 64)
+	if err1 != nil || err2 != nil || err3 != nil || hours > 23 || minutes > 59 || seconds >= 61 {
+		return 0, fmt.Errorf("invalid NMEA time %q", value)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second)), nil
+}
+
+// parseNMEACoordinates parses latitude ddmm.mm, N/S, longitude dddmm.mm, E/W
+// into decimal degrees
+func parseNMEACoordinates(fields []string) (float64, float64, error) {
+	latitude, err := parseNMEADegrees(fields[0], 2)
+	if err != nil {
+		return 0, 0, err
+	}
+	longitude, err := parseNMEADegrees(fields[2], 3)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch fields[1] {
+	case "S":
+		latitude = -latitude
+	case "N":
+	default:
+		return 0, 0, fmt.Errorf("invalid NMEA hemisphere %q", fields[1])
+	}
+	switch fields[3] {
+	case "W":
+		longitude = -longitude
+	case "E":
+	default:
+		return 0, 0, fmt.Errorf("invalid NMEA hemisphere %q", fields[3])
+	}
+	return latitude, longitude, nil
+}
+
+// parseNMEADegrees parses degrees and decimal minutes, where the degrees
+// take degreeDigits digits
+func parseNMEADegrees(value string, degreeDigits int) (float64, error) {
+	if len(value) < degreeDigits+2 {
+		return 0, fmt.Errorf("invalid NMEA coordinate %q", value)
+	}
+	degrees, err := strconv.Atoi(value[:degreeDigits])
+	if err != nil {
+		return 0, fmt.Errorf("invalid NMEA coordinate %q", value)
+	}
+	minutes, err := strconv.ParseFloat(value[degreeDigits:], 64)
+	if err != nil || minutes >= 60 {
+		return 0, fmt.Errorf("invalid NMEA coordinate %q", value)
+	}
+	return float64(degrees) + minutes/60, nil
+}
@@ -0,0 +1,178 @@
+package trackerproto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Teltonika codecs of AVL data packets
+const (
+	TeltonikaCodec8         = 0x08
+	TeltonikaCodec8Extended = 0x8E
+)
+
+// teltonikaBatteryLevelIO is the IO element with the battery level in percent
+const teltonikaBatteryLevelIO = 113
+
+// IsTeltonikaPacket reports whether a payload looks like a Teltonika AVL data
+// packet, which starts with a zero preamble
+func IsTeltonikaPacket(payload []byte) bool {
+	return len(payload) >= 12 && binary.BigEndian.Uint32(payload) == 0
+}
+
+// DecodeTeltonikaIMEI decodes the packet a Teltonika device opens a TCP
+// session with: the length of its IMEI followed by the IMEI
+func DecodeTeltonikaIMEI(packet []byte) (string, error) {
+	if len(packet) < 2 || int(binary.BigEndian.Uint16(packet)) != len(packet)-2 {
+		return "", errors.New("invalid Teltonika IMEI packet")
+	}
+	imei := string(packet[2:])
+	for _, r := range imei {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("invalid IMEI %q", imei)
+		}
+	}
+	return imei, nil
+}
+
+// DecodeTeltonika decodes a Teltonika AVL data packet of codec 8 or 8
+// Extended, as sent over TCP, after verifying its CRC. Records without a
+// GPS fix are skipped, as they repeat the last known coordinates.
+func DecodeTeltonika(packet []byte) ([]Position, error) {
+	if !IsTeltonikaPacket(packet) {
+		return nil, errors.New("not a Teltonika AVL packet")
+	}
+	length := int(binary.BigEndian.Uint32(packet[4:]))
+	if len(packet) != 8+length+4 || length < 3 {
+		return nil, fmt.Errorf("Teltonika packet of %d bytes declares %d bytes of data", len(packet), length)
+	}
+	data := packet[8 : 8+length]
+	if uint32(crc16IBM(data)) != binary.BigEndian.Uint32(packet[8+length:]) {
+		return nil, fmt.Errorf("%w in Teltonika packet", ErrChecksum)
+	}
+
+	codec := data[0]
+	if codec != TeltonikaCodec8 && codec != TeltonikaCodec8Extended {
+		return nil, fmt.Errorf("unsupported Teltonika codec 0x%02X", codec)
+	}
+	count := int(data[1])
+	if int(data[len(data)-1]) != count {
+		return nil, errors.New("Teltonika packet record counts differ")
+	}
+
+	r := &avlReader{data: data[2 : len(data)-1], extended: codec == TeltonikaCodec8Extended}
+	positions := make([]Position, 0, count)
+	for i := 0; i < count; i++ {
+		position, fix, err := r.record()
+		if err != nil {
+			return nil, fmt.Errorf("Teltonika record %d: %w", i+1, err)
+		}
+		if fix {
+			positions = append(positions, position)
+		}
+	}
+	if r.offset != len(r.data) {
+		return nil, errors.New("Teltonika packet has trailing data")
+	}
+	return positions, nil
+}
+
+// avlReader reads the AVL records of a packet
+type avlReader struct {
+	data     []byte
+	offset   int
+	extended bool
+	err      error
+}
+
+func (r *avlReader) next(n int) []byte {
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	if r.offset+n > len(r.data) {
+		r.err = errors.New("truncated record")
+		return make([]byte, n)
+	}
+	b := r.data[r.offset : r.offset+n]
+	r.offset += n
+	return b
+}
+
+func (r *avlReader) uint8() int   { return int(r.next(1)[0]) }
+func (r *avlReader) uint16() int  { return int(binary.BigEndian.Uint16(r.next(2))) }
+func (r *avlReader) int32() int32 { return int32(binary.BigEndian.Uint32(r.next(4))) }
+
+// count reads an element count or ID, which take two bytes in codec 8
+// Extended and one in codec 8
+func (r *avlReader) count() int {
+	if r.extended {
+		return r.uint16()
+	}
+	return r.uint8()
+}
+
+// record reads an AVL record, returning whether it has a GPS fix
+func (r *avlReader) record() (Position, bool, error) {
+	var position Position
+	position.Timestamp = time.UnixMilli(int64(binary.BigEndian.Uint64(r.next(8)))).UTC()
+	r.next(1) // priority
+
+	longitude := r.int32()
+	latitude := r.int32()
+	position.Longitude = float64(longitude) / 1e7
+	position.Latitude = float64(latitude) / 1e7
+	altitude := float64(int16(r.uint16()))
+	heading := float64(r.uint16())
+	satellites := r.uint8()
+	speed := float64(r.uint16())
+	position.Altitude = &altitude
+	position.Heading = &heading
+	position.Satellites = &satellites
+	position.Speed = &speed
+
+	// IO elements: the event IO, the total count, then groups of elements
+	// with 1, 2, 4 and 8 byte values, and variable length values in codec 8
+	// Extended
+	r.count()
+	r.count()
+	for _, size := range []int{1, 2, 4, 8} {
+		for n := r.count(); n > 0; n-- {
+			id := r.count()
+			value := r.next(size)
+			if id == teltonikaBatteryLevelIO && size == 1 {
+				battery := float64(value[0])
+				position.BatteryLevel = &battery
+			}
+		}
+	}
+	if r.extended {
+		for n := r.count(); n > 0; n-- {
+			r.count()
+			r.next(r.uint16())
+		}
+	}
+
+	if r.err != nil {
+		return Position{}, false, r.err
+	}
+	return position, satellites > 0, nil
+}
+
+// crc16IBM is the CRC-16/IBM checksum of Teltonika packets: polynomial
+// 0xA001 reflected, initial value 0
+func crc16IBM(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,248 @@
+package trackerproto
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestDecodeNMEA(t *testing.T) {
+	payload := "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47\r\n" +
+		"$GPGSA,A,3,04,05,,09,12,,,24,,,,,2.5,1.3,2.1*39\r\n" +
+		"$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A\r\n"
+
+	positions, err := DecodeNMEA([]byte(payload), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 1 {
+		t.Fatalf("expected the GGA and RMC sentences to be merged, got %d positions", len(positions))
+	}
+
+	p := positions[0]
+	if !near(p.Latitude, 48.1173) || !near(p.Longitude, 11.516666666) {
+		t.Errorf("unexpected coordinates %f, %f", p.Latitude, p.Longitude)
+	}
+	if !p.Timestamp.Equal(time.Date(1994, 3, 23, 12, 35, 19, 0, time.UTC)) {
+		t.Errorf("unexpected timestamp %s", p.Timestamp)
+	}
+	if !near(*p.Speed, 22.4*1.852) || !near(*p.Heading, 84.4) {
+		t.Errorf("unexpected speed %f and heading %f", *p.Speed, *p.Heading)
+	}
+	if !near(*p.Altitude, 545.4) || !near(*p.Accuracy, 4.5) || *p.Satellites != 8 {
+		t.Errorf("unexpected altitude %f, accuracy %f, satellites %d", *p.Altitude, *p.Accuracy, *p.Satellites)
+	}
+}
+
+func TestDecodeNMEAHemispheresAndDates(t *testing.T) {
+	// Southern and western hemispheres, GGA only, just before midnight
+	sentence := withChecksum("GNGGA,235959.50,3352.128,S,15112.558,W,1,05,1.2,10.0,M,0.0,M,,")
+	received := time.Date(2024, 6, 2, 0, 0, 3, 0, time.UTC)
+
+	positions, err := DecodeNMEA([]byte(sentence), received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 1 {
+		t.Fatalf("expected 1 position, got %d", len(positions))
+	}
+	p := positions[0]
+	if !near(p.Latitude, -33.8688) || !near(p.Longitude, -151.2093) {
+		t.Errorf("unexpected coordinates %f, %f", p.Latitude, p.Longitude)
+	}
+	if !p.Timestamp.Equal(time.Date(2024, 6, 1, 23, 59, 59, 500000000, time.UTC)) {
+		t.Errorf("expected the fix to be dated the day before, got %s", p.Timestamp)
+	}
+	if p.Speed != nil {
+		t.Error("GGA sentences carry no speed")
+	}
+}
+
+func TestDecodeNMEASkipsSentencesWithoutFix(t *testing.T) {
+	payload := withChecksum("GPRMC,123519,V,,,,,,,230394,,") + "\n" +
+		withChecksum("GPGGA,123519,,,,,0,00,,,M,,M,,")
+
+	positions, err := DecodeNMEA([]byte(payload), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 0 {
+		t.Errorf("expected no positions, got %d", len(positions))
+	}
+}
+
+func TestDecodeNMEARejectsBadSentences(t *testing.T) {
+	tests := map[string]string{
+		"bad checksum":     "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6B",
+		"missing checksum": "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W",
+		"not a sentence":   "GPRMC,123519",
+		"bad hemisphere":   withChecksum("GPRMC,123519,A,4807.038,X,01131.000,E,022.4,084.4,230394,003.1,W"),
+		"bad time":         withChecksum("GPRMC,1235,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W"),
+	}
+	for name, sentence := range tests {
+		if _, err := DecodeNMEA([]byte(sentence), time.Now()); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	_, err := DecodeNMEA([]byte(tests["bad checksum"]), time.Now())
+	if !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected ErrChecksum, got %v", err)
+	}
+}
+
+// withChecksum frames the body of a sentence with its checksum
+func withChecksum(body string) string {
+	var sum byte
+	for i := 0; i < len(body); i++ {
+		sum ^= body[i]
+	}
+	return "$" + body + "*" + hex.EncodeToString([]byte{sum})
+}
+
+func TestDecodeTeltonikaDocumentedPacket(t *testing.T) {
+	// The codec 8 example of the Teltonika protocol documentation, a record
+	// without a GPS fix
+	packet, _ := hex.DecodeString("000000000000003608010000016B40D8EA30010000000000000000000000000000000105021503010101425E0F01F10000601A014E0000000000000000010000C7CF")
+
+	positions, err := DecodeTeltonika(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 0 {
+		t.Errorf("expected the record without fix to be skipped, got %d positions", len(positions))
+	}
+
+	packet[len(packet)-1] ^= 0xFF
+	if _, err := DecodeTeltonika(packet); !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected ErrChecksum, got %v", err)
+	}
+}
+
+// avlRecord is a record to encode into a test packet
+type avlRecord struct {
+	timestamp  time.Time
+	latitude   float64
+	longitude  float64
+	altitude   int16
+	heading    uint16
+	satellites byte
+	speed      uint16
+	battery    byte
+}
+
+// teltonikaPacket encodes records into an AVL data packet
+func teltonikaPacket(codec byte, records []avlRecord) []byte {
+	id := func(b []byte, v int) []byte {
+		if codec == TeltonikaCodec8Extended {
+			return binary.BigEndian.AppendUint16(b, uint16(v))
+		}
+		return append(b, byte(v))
+	}
+
+	data := []byte{codec, byte(len(records))}
+	for _, record := range records {
+		data = binary.BigEndian.AppendUint64(data, uint64(record.timestamp.UnixMilli()))
+		data = append(data, 1)
+		data = binary.BigEndian.AppendUint32(data, uint32(int32(math.Round(record.longitude*1e7))))
+		data = binary.BigEndian.AppendUint32(data, uint32(int32(math.Round(record.latitude*1e7))))
+		data = binary.BigEndian.AppendUint16(data, uint16(record.altitude))
+		data = binary.BigEndian.AppendUint16(data, record.heading)
+		data = append(data, record.satellites)
+		data = binary.BigEndian.AppendUint16(data, record.speed)
+
+		data = id(data, 0) // event IO
+		data = id(data, 3) // total IO elements
+		data = id(data, 2) // 1 byte values
+		data = id(data, 239)
+		data = append(data, 1)
+		data = id(data, teltonikaBatteryLevelIO)
+		data = append(data, record.battery)
+		data = id(data, 1) // 2 byte values
+		data = id(data, 66)
+		data = binary.BigEndian.AppendUint16(data, 12800)
+		data = id(data, 0) // 4 byte values
+		data = id(data, 0) // 8 byte values
+		if codec == TeltonikaCodec8Extended {
+			data = id(data, 1) // variable length values
+			data = id(data, 385)
+			data = binary.BigEndian.AppendUint16(data, 3)
+			data = append(data, 0xAA, 0xBB, 0xCC)
+		}
+	}
+	data = append(data, byte(len(records)))
+
+	packet := make([]byte, 4)
+	packet = binary.BigEndian.AppendUint32(packet, uint32(len(data)))
+	packet = append(packet, data...)
+	return binary.BigEndian.AppendUint32(packet, uint32(crc16IBM(data)))
+}
+
+func TestDecodeTeltonika(t *testing.T) {
+	recorded := time.Date(2024, 6, 1, 8, 30, 0, 0, time.UTC)
+	records := []avlRecord{
+		{timestamp: recorded, latitude: -26.2041028, longitude: 28.0473051, altitude: 1753, heading: 270, satellites: 11, speed: 64, battery: 87},
+		{timestamp: recorded.Add(time.Minute), latitude: 0, longitude: 0, satellites: 0},
+	}
+
+	for _, codec := range []byte{TeltonikaCodec8, TeltonikaCodec8Extended} {
+		packet := teltonikaPacket(codec, records)
+		if !IsTeltonikaPacket(packet) {
+			t.Fatalf("codec 0x%02X: packet not recognized", codec)
+		}
+
+		positions, err := DecodeTeltonika(packet)
+		if err != nil {
+			t.Fatalf("codec 0x%02X: %v", codec, err)
+		}
+		if len(positions) != 1 {
+			t.Fatalf("codec 0x%02X: expected the record without fix to be skipped, got %d positions", codec, len(positions))
+		}
+		p := positions[0]
+		if !near(p.Latitude, -26.2041028) || !near(p.Longitude, 28.0473051) {
+			t.Errorf("codec 0x%02X: unexpected coordinates %f, %f", codec, p.Latitude, p.Longitude)
+		}
+		if !p.Timestamp.Equal(recorded) {
+			t.Errorf("codec 0x%02X: unexpected timestamp %s", codec, p.Timestamp)
+		}
+		if *p.Altitude != 1753 || *p.Heading != 270 || *p.Speed != 64 || *p.Satellites != 11 || *p.BatteryLevel != 87 {
+			t.Errorf("codec 0x%02X: unexpected values %+v", codec, p)
+		}
+	}
+}
+
+func TestDecodeTeltonikaRejectsMalformedPackets(t *testing.T) {
+	packet := teltonikaPacket(TeltonikaCodec8, []avlRecord{{timestamp: time.Now(), latitude: 1, longitude: 1, satellites: 5}})
+
+	if _, err := DecodeTeltonika(packet[:len(packet)-6]); err == nil {
+		t.Error("expected a truncated packet to be rejected")
+	}
+
+	unsupported := teltonikaPacket(0x10, nil)
+	if _, err := DecodeTeltonika(unsupported); err == nil {
+		t.Error("expected an unsupported codec to be rejected")
+	}
+
+	if IsTeltonikaPacket([]byte(`{"lat":1,"lon":2}`)) {
+		t.Error("expected JSON not to be taken for a Teltonika packet")
+	}
+}
+
+func TestDecodeTeltonikaIMEI(t *testing.T) {
+	packet, _ := hex.DecodeString("000F333536333037303432343431303133")
+	imei, err := DecodeTeltonikaIMEI(packet)
+	if err != nil || imei != "356307042441013" {
+		t.Errorf("unexpected IMEI %q, %v", imei, err)
+	}
+
+	if _, err := DecodeTeltonikaIMEI(packet[:10]); err == nil {
+		t.Error("expected a truncated IMEI packet to be rejected")
+	}
+}
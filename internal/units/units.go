@@ -0,0 +1,225 @@
+// Package units converts the metric measurements the API stores to the
+// system a client asked for: distances, speeds, weights, lengths and
+// temperatures, whether in JSON responses or in the text of notifications.
+package units
+
+import (
+	"fmt"
+	"strings"
+)
+
+// System is a system of measurement
+type System string
+
+const (
+	Metric   System = "metric"
+	Imperial System = "imperial"
+)
+
+const (
+	milesPerKm    = 0.621371
+	poundsPerKg   = 2.20462
+	feetPerMeter  = 3.28084
+	fahrenheitPer = 9.0 / 5.0
+)
+
+// Parse returns the system of a name, case-insensitively. The empty name is
+// metric.
+func Parse(name string) (System, bool) {
+	switch System(strings.ToLower(strings.TrimSpace(name))) {
+	case "", Metric:
+		return Metric, true
+	case Imperial:
+		return Imperial, true
+	}
+	return "", false
+}
+
+// Distance converts kilometers
+func (s System) Distance(km float64) float64 {
+	if s == Imperial {
+		return km * milesPerKm
+	}
+	return km
+}
+
+// Speed converts kilometers per hour
+func (s System) Speed(kmh float64) float64 {
+	if s == Imperial {
+		return kmh * milesPerKm
+	}
+	return kmh
+}
+
+// Weight converts kilograms
+func (s System) Weight(kg float64) float64 {
+	if s == Imperial {
+		return kg * poundsPerKg
+	}
+	return kg
+}
+
+// Length converts meters
+func (s System) Length(m float64) float64 {
+	if s == Imperial {
+		return m * feetPerMeter
+	}
+	return m
+}
+
+// Temperature converts degrees Celsius
+func (s System) Temperature(celsius float64) float64 {
+	if s == Imperial {
+		return celsius*fahrenheitPer + 32
+	}
+	return celsius
+}
+
+// DistanceUnit returns the abbreviation of the system's distance unit
+func (s System) DistanceUnit() string {
+	if s == Imperial {
+		return "mi"
+	}
+	return "km"
+}
+
+// SpeedUnit returns the abbreviation of the system's speed unit
+func (s System) SpeedUnit() string {
+	if s == Imperial {
+		return "mph"
+	}
+	return "km/h"
+}
+
+// WeightUnit returns the abbreviation of the system's weight unit
+func (s System) WeightUnit() string {
+	if s == Imperial {
+		return "lb"
+	}
+	return "kg"
+}
+
+// LengthUnit returns the abbreviation of the system's length unit
+func (s System) LengthUnit() string {
+	if s == Imperial {
+		return "ft"
+	}
+	return "m"
+}
+
+// TemperatureUnit returns the symbol of the system's temperature unit
+func (s System) TemperatureUnit() string {
+	if s == Imperial {
+		return "°F"
+	}
+	return "°C"
+}
+
+// FormatDistance formats kilometers for text, e.g. "12.4 mi"
+func (s System) FormatDistance(km float64) string {
+	return fmt.Sprintf("%.1f %s", s.Distance(km), s.DistanceUnit())
+}
+
+// FormatWholeDistance formats kilometers rounded to a whole number, e.g.
+// "12 mi", for odometer readings and service intervals
+func (s System) FormatWholeDistance(km float64) string {
+	return fmt.Sprintf("%.0f %s", s.Distance(km), s.DistanceUnit())
+}
+
+// FormatSpeed formats kilometers per hour for text, e.g. "65 mph"
+func (s System) FormatSpeed(kmh float64) string {
+	return fmt.Sprintf("%.0f %s", s.Speed(kmh), s.SpeedUnit())
+}
+
+// FormatWeight formats kilograms for text, e.g. "2205 lb"
+func (s System) FormatWeight(kg float64) string {
+	return fmt.Sprintf("%.0f %s", s.Weight(kg), s.WeightUnit())
+}
+
+// FormatTemperature formats degrees Celsius for text, e.g. "-4°F"
+func (s System) FormatTemperature(celsius float64) string {
+	return fmt.Sprintf("%.0f%s", s.Temperature(celsius), s.TemperatureUnit())
+}
+
+// suffixes maps the suffixes of metric JSON keys to those of the imperial keys
+// they're renamed to, with the conversion of their values
+var suffixes = []struct {
+	metric, imperial string
+	convert          func(float64) float64
+}{
+	{"_per_kg", "_per_lb", func(v float64) float64 { return v / poundsPerKg }},
+	{"_per_km", "_per_mi", func(v float64) float64 { return v / milesPerKm }},
+	{"_kmh", "_mph", Imperial.Speed},
+	{"_km", "_mi", Imperial.Distance},
+	{"_kg", "_lb", Imperial.Weight},
+	{"_meters", "_feet", Imperial.Length},
+}
+
+// keys that look metric but aren't measurements to convert
+var unconverted = map[string]bool{
+	"tonne_km":       true,
+	"playback_speed": true,
+}
+
+// bareKey converts the value of keys without a unit in their name, which keep
+// their name
+func bareKey(key string) func(float64) float64 {
+	switch {
+	case key == "speed" || strings.HasSuffix(key, "_speed") || key == "speed_limit":
+		return Imperial.Speed
+	case key == "weight" || strings.HasSuffix(key, "_weight"):
+		return Imperial.Weight
+	case key == "altitude" || key == "accuracy":
+		return Imperial.Length
+	case key == "temperature" || strings.HasSuffix(key, "_temperature"):
+		return Imperial.Temperature
+	case key == "visibility":
+		return Imperial.Distance
+	}
+	return nil
+}
+
+// ConvertJSON converts the measurements of a decoded JSON value in place and
+// returns it. Keys suffixed with a metric unit, like distance_km, are renamed
+// to the imperial one, like distance_mi; speeds, weights, altitudes and
+// temperatures without a unit in their name keep it. Metric values are
+// returned unchanged.
+func ConvertJSON(value interface{}, system System) interface{} {
+	if system != Imperial {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if unconverted[key] {
+				continue
+			}
+			if convert, renamed := convertKey(key); convert != nil {
+				if number, ok := child.(float64); ok {
+					if renamed != key {
+						delete(v, key)
+					}
+					v[renamed] = convert(number)
+					continue
+				}
+			}
+			v[key] = ConvertJSON(child, system)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = ConvertJSON(child, system)
+		}
+	}
+	return value
+}
+
+// convertKey returns the conversion of a key's value and its imperial name, or
+// nil if the key isn't a measurement
+func convertKey(key string) (func(float64) float64, string) {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(key, suffix.metric) {
+			return suffix.convert, strings.TrimSuffix(key, suffix.metric) + suffix.imperial
+		}
+	}
+	return bareKey(key), key
+}
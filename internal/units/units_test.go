@@ -0,0 +1,101 @@
+package units
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected System
+		ok       bool
+	}{
+		{"", Metric, true},
+		{"metric", Metric, true},
+		{"Imperial", Imperial, true},
+		{" imperial ", Imperial, true},
+		{"us", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			system, ok := Parse(tt.name)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, system)
+		})
+	}
+}
+
+func TestConversions(t *testing.T) {
+	assert.InDelta(t, 62.1371, Imperial.Distance(100), 1e-9)
+	assert.InDelta(t, 55.9234, Imperial.Speed(90), 1e-4)
+	assert.InDelta(t, 2204.62, Imperial.Weight(1000), 1e-9)
+	assert.InDelta(t, 328.084, Imperial.Length(100), 1e-9)
+	assert.InDelta(t, -40, Imperial.Temperature(-40), 1e-9)
+	assert.InDelta(t, 212, Imperial.Temperature(100), 1e-9)
+
+	assert.Equal(t, 100.0, Metric.Distance(100))
+	assert.Equal(t, 100.0, Metric.Temperature(100))
+
+	assert.Equal(t, "62.1 mi", Imperial.FormatDistance(100))
+	assert.Equal(t, "100.0 km", Metric.FormatDistance(100))
+	assert.Equal(t, "62 mi", Imperial.FormatWholeDistance(100))
+	assert.Equal(t, "56 mph", Imperial.FormatSpeed(90))
+	assert.Equal(t, "90 km/h", Metric.FormatSpeed(90))
+	assert.Equal(t, "2205 lb", Imperial.FormatWeight(1000))
+	assert.Equal(t, "23°F", Imperial.FormatTemperature(-5))
+	assert.Equal(t, "-5°C", Metric.FormatTemperature(-5))
+}
+
+func TestConvertJSON(t *testing.T) {
+	body := `{
+		"trip_id": 7,
+		"distance_km": 100,
+		"price_per_kg": 2.20462,
+		"tonne_km": 1000,
+		"playback_speed": 4,
+		"tolerance_meters": 10,
+		"current_location": {"speed": 90, "altitude": 100, "accuracy": null, "heading": 180},
+		"weather": [{"temperature": 0, "wind_speed": 10, "visibility": 10}],
+		"load": {"weight": 1000, "total_weight": 500},
+		"summary_km": {"count": 3}
+	}`
+	var value interface{}
+	require.NoError(t, json.Unmarshal([]byte(body), &value))
+
+	converted := ConvertJSON(value, Imperial).(map[string]interface{})
+
+	assert.Equal(t, float64(7), converted["trip_id"])
+	assert.NotContains(t, converted, "distance_km")
+	assert.InDelta(t, 62.1371, converted["distance_mi"], 1e-9)
+	assert.InDelta(t, 1, converted["price_per_lb"], 1e-9)
+	assert.Equal(t, float64(1000), converted["tonne_km"])
+	assert.Equal(t, float64(4), converted["playback_speed"])
+	assert.InDelta(t, 32.8084, converted["tolerance_feet"], 1e-9)
+
+	location := converted["current_location"].(map[string]interface{})
+	assert.InDelta(t, 55.9234, location["speed"], 1e-4)
+	assert.InDelta(t, 328.084, location["altitude"], 1e-9)
+	assert.Nil(t, location["accuracy"])
+	assert.Equal(t, float64(180), location["heading"])
+
+	weather := converted["weather"].([]interface{})[0].(map[string]interface{})
+	assert.InDelta(t, 32, weather["temperature"], 1e-9)
+	assert.InDelta(t, 6.21371, weather["wind_speed"], 1e-9)
+	assert.InDelta(t, 6.21371, weather["visibility"], 1e-9)
+
+	load := converted["load"].(map[string]interface{})
+	assert.InDelta(t, 2204.62, load["weight"], 1e-9)
+	assert.InDelta(t, 1102.31, load["total_weight"], 1e-9)
+
+	// Keys named like measurements but holding objects are left named as is
+	assert.Equal(t, map[string]interface{}{"count": float64(3)}, converted["summary_km"])
+
+	// Metric leaves values unchanged
+	var metric interface{}
+	require.NoError(t, json.Unmarshal([]byte(body), &metric))
+	assert.Equal(t, float64(100), ConvertJSON(metric, Metric).(map[string]interface{})["distance_km"])
+}
@@ -1,12 +1,24 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	"triplink/backend/apierror"
+	"triplink/backend/config"
 	"triplink/backend/database"
+	"triplink/backend/database/migrations"
+	"triplink/backend/metrics"
 	"triplink/backend/routes"
 	"triplink/backend/services"
+	"triplink/backend/tracing"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 
 	_ "triplink/backend/docs" // docs is generated by Swag CLI, you have to import it.
 )
@@ -14,21 +26,177 @@ import (
 // @title Triplink API
 // @version 1.0
 func main() {
+	// Read the configuration file and refuse to start with invalid settings
+	initConfig()
+
+	// Trace requests through services, queries and external APIs
+	shutdownTracing, err := tracing.Init(config.GetTracingConfig())
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
 	// Connect to database
-	database.Connect()
+	db := database.Connect()
+	if err := db.Use(tracing.NewGormPlugin()); err != nil {
+		log.Printf("Failed to register query tracing: %v", err)
+	}
+
+	// Time database queries for the metrics endpoint
+	if err := db.Use(metrics.NewGormPlugin()); err != nil {
+		log.Printf("Failed to register query metrics: %v", err)
+	}
+
+	// Limit the reads made on behalf of a user to their organizations' data.
+	// Serving without it would leak other tenants' trips and loads.
+	if err := db.Use(services.NewTenantScopePlugin()); err != nil {
+		log.Fatalf("Failed to register tenant scoping: %v", err)
+	}
+
+	// Make sure the schema is up to date before serving
+	checkMigrations(db)
+
+	// Normalize quote and payment amounts to the base currency
+	currencyConfig := config.GetCurrencyConfig()
+	if err := currencyConfig.ValidateCurrencyConfig(); err != nil {
+		log.Fatalf("Invalid currency configuration: %v", err)
+	}
+	services.SetCurrencyService(services.NewCurrencyService(currencyConfig))
+
+	// Expected tolls of new trips and changed routes
+	tollConfig := config.GetTollConfig()
+	if err := tollConfig.ValidateTollConfig(); err != nil {
+		log.Fatalf("Invalid toll configuration: %v", err)
+	}
+	services.SetTripTollService(services.NewTripTollService(db, services.NewTollAPIService(), tollConfig))
+
+	// Delivery delays predicted from the history of completed trips
+	delayModelConfig := config.GetDelayModelConfig()
+	if err := delayModelConfig.ValidateDelayModelConfig(); err != nil {
+		log.Fatalf("Invalid delay model configuration: %v", err)
+	}
+	delayModelService := services.NewDelayModelService(db, delayModelConfig)
+	services.SetDelayModelService(delayModelService)
+
+	// Feature flags for gradual rollouts
+	services.SetFeatureFlagService(services.NewFeatureFlagService(db, config.GetFeatureFlagConfig().RefreshInterval))
 
 	// Initialize notification service
-	initNotificationService()
+	notificationService := initNotificationService(db)
 
 	// Register notification triggers
 	services.RegisterNotificationTriggers()
 
-	// Create Fiber app
-	app := fiber.New()
+	// Post critical events to the Slack and Teams channels of organizations
+	if opsAlertConfig := config.GetOpsAlertConfig(); opsAlertConfig.Enabled {
+		services.SetOpsAlertService(services.NewOpsAlertService(db, opsAlertConfig))
+	}
+
+	// Stream location updates to clients, across instances when Redis is enabled
+	initLocationHub()
+
+	// Start background tracking jobs (delay alerts, ETA refresh, stale data, anomalies)
+	schedulerConfig := config.GetSchedulerConfig()
+	scheduler := services.NewTrackingScheduler(db, schedulerConfig)
+	scheduler.RegisterJob("notification_digests", schedulerConfig.DigestCheckInterval, notificationService.ProcessDigests)
+	scheduler.RegisterJob("quote_expiry", schedulerConfig.QuoteExpiryInterval, services.NewQuoteService(db).ExpireQuotes)
+	scheduler.RegisterJob("customs_expiry_alerts", schedulerConfig.CustomsExpiryInterval, services.NewCustomsService(db).SendExpiryAlerts)
+	scheduler.RegisterJob("vehicle_expiry_reminders", schedulerConfig.VehicleExpiryInterval, services.NewVehicleComplianceService(db, config.GetVehicleComplianceConfig().ReminderDays).SendExpiryReminders)
+	scheduler.RegisterJob("report_subscriptions", schedulerConfig.ReportSubscriptionInterval, services.NewReportSubscriptionService(db, config.GetEmailConfig()).SendDueReports)
+	scheduler.RegisterJob("retention_cleanup", schedulerConfig.RetentionCleanupInterval, services.NewRetentionService(db, config.GetRetentionConfig(), config.GetStorageConfig()).RunScheduledCleanup)
+	scheduler.RegisterJob("telematics_poll", schedulerConfig.TelematicsPollInterval, services.NewTelematicsService(db, config.GetTelematicsConfig()).PollAll)
+	scheduler.RegisterJob("pickup_reminders", schedulerConfig.PickupReminderInterval, services.NewPickupReminderService(db, notificationService, schedulerConfig.PickupReminderLeadTime).SendPickupReminders)
+	scheduler.RegisterJob("trip_templates", schedulerConfig.TripTemplateInterval, services.NewTripTemplateService(db).GenerateDueTrips)
+	scheduler.RegisterJob("tracking_rollups", schedulerConfig.TrackingRollupInterval, services.NewTrackingRollupService(db).RollupRecent)
+	scheduler.RegisterJob("trip_emissions", schedulerConfig.EmissionsInterval, services.NewEmissionsService(db, config.GetEmissionsConfig()).RecordCompletedTrips)
+	scheduler.RegisterJob("delay_model", delayModelConfig.Interval, delayModelService.RunScheduled)
+	scheduler.RegisterJob("vehicle_maintenance", schedulerConfig.VehicleMaintenanceInterval, services.NewVehicleMaintenanceService(db, config.GetVehicleMaintenanceConfig()).UpdateMileage)
+	scheduler.RegisterJob("feedback_analysis", schedulerConfig.FeedbackAnalysisInterval, services.NewFeedbackService(db, services.NewMLService()).AnalyzePending)
+
+	// Create tracking record partitions ahead of time and archive the records of closed trips
+	trackingArchiveConfig := config.GetTrackingArchiveConfig()
+	if err := trackingArchiveConfig.ValidateTrackingArchiveConfig(); err != nil {
+		log.Fatalf("Invalid tracking archive configuration: %v", err)
+	}
+	if trackingArchiveConfig.Enabled {
+		scheduler.RegisterJob("tracking_archive", trackingArchiveConfig.Interval, services.NewTrackingArchiveService(db, trackingArchiveConfig).RunScheduledMaintenance)
+	}
+
+	// Publish the tracking events recorded with status changes
+	initOutboxDispatcher(db, scheduler)
+	scheduler.Start()
+
+	// Create Fiber app, accepting request bodies as large as the biggest upload
+	bodyLimit := config.GetStorageConfig().MaxUploadSize
+	if documentSize := config.GetDocumentConfig().MaxSize; documentSize > bodyLimit {
+		bodyLimit = documentSize
+	}
+	app := fiber.New(fiber.Config{
+		// Leave room for multipart encoding around the file
+		BodyLimit: int(bodyLimit) + 1024*1024,
+		// Errors of middleware ahead of the error middleware, like oversized
+		// bodies, are sent in the same envelope
+		ErrorHandler: apierror.Respond,
+	})
 
 	// Setup routes
 	routes.Setup(app)
 
+	// Devices stream high-frequency positions over gRPC with client certificates
+	grpcServer := initGRPCServer(db)
+
+	// Cheap GPS trackers publish positions to an MQTT broker
+	stopMQTTBridge := initMQTTBridge(db)
+
+	// Stop gracefully so in-flight work completes and pending spans are exported
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		if err := app.Shutdown(); err != nil {
+			log.Printf("Failed to shut down server: %v", err)
+		}
+	}()
+
 	// Start server
-	log.Fatal(app.Listen(":8080"))
+	if err := app.Listen(":8080"); err != nil {
+		log.Fatal(err)
+	}
+
+	stopMQTTBridge()
+
+	// Record the positions of open device streams
+	if grpcServer != nil {
+		stopGRPCServer(grpcServer)
+	}
+
+	// Finish the notification deliveries in progress
+	if queue := services.GetNotificationQueue(); queue != nil {
+		queue.Stop()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+}
+
+// checkMigrations refuses to start with pending migrations, unless the
+// configuration asks for them to be applied at startup
+func checkMigrations(db *gorm.DB) {
+	pending, err := migrations.Pending(db)
+	if err != nil {
+		log.Fatalf("Failed to check database migrations: %v", err)
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	if !config.GetDatabaseConfig().AutoMigrate {
+		log.Fatalf("Database has %d pending migrations (%s), run go run ./cmd/migrate up", len(pending), strings.Join(pending, ", "))
+	}
+	if err := migrations.New(db).Migrate(); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+	log.Printf("Applied %d database migrations", len(pending))
 }
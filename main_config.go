@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"triplink/backend/config"
+)
+
+// defaultConfigFile is read when present unless CONFIG_FILE names another
+const defaultConfigFile = "config.yaml"
+
+// initConfig loads the configuration file, validates every setting and
+// reloads the file on SIGHUP. Only settings like alert thresholds follow a
+// reload; the others need a restart.
+func initConfig() {
+	path, required := os.LookupEnv("CONFIG_FILE")
+	if !required {
+		path = defaultConfigFile
+	}
+	if err := config.Load(path, required); err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := config.Reload(); err != nil {
+				log.Printf("Failed to reload configuration, keeping the previous settings: %v", err)
+				continue
+			}
+			log.Printf("Reloaded configuration from %s", path)
+		}
+	}()
+}
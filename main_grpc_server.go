@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"net"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/handlers"
+	"triplink/backend/services"
+
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
+)
+
+// initGRPCServer starts the gRPC API that telematics devices and gateways
+// stream positions to. It returns nil when the API is disabled.
+func initGRPCServer(db *gorm.DB) *grpc.Server {
+	grpcConfig := config.GetGRPCConfig()
+	if err := grpcConfig.ValidateGRPCConfig(); err != nil {
+		log.Fatalf("Invalid gRPC configuration: %v", err)
+	}
+	if !grpcConfig.Enabled {
+		return nil
+	}
+
+	server, err := handlers.NewGRPCServer(grpcConfig, services.NewTelematicsService(db, config.GetTelematicsConfig()))
+	if err != nil {
+		log.Fatalf("Failed to create gRPC server: %v", err)
+	}
+	listener, err := net.Listen("tcp", grpcConfig.Address)
+	if err != nil {
+		log.Fatalf("Failed to listen for gRPC on %s: %v", grpcConfig.Address, err)
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Printf("gRPC server stopped: %v", err)
+		}
+	}()
+
+	log.Printf("gRPC telematics ingestion listening on %s", grpcConfig.Address)
+	return server
+}
+
+// stopGRPCServer lets device streams finish, then cancels the ones still open
+// after the grace period, as gateways may keep streaming indefinitely
+func stopGRPCServer(server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		server.Stop()
+	}
+}
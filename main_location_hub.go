@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/services"
+)
+
+// initLocationHub sets up the hub streaming location updates to clients. With
+// Redis pub/sub enabled, updates are fanned out across all API instances.
+func initLocationHub() {
+	realtimeConfig := config.GetRealtimeConfig()
+	if err := realtimeConfig.ValidateRealtimeConfig(); err != nil {
+		log.Printf("Invalid realtime configuration, using defaults: %v", err)
+		realtimeConfig = &config.RealtimeConfig{StreamHeartbeat: 15 * time.Second, SubscriberBuffer: 16}
+	}
+
+	if realtimeConfig.LocationCacheEnabled {
+		services.SetTripLocationCache(services.NewRedisTripLocationCache(services.NewRedisService().Client, realtimeConfig.LocationCacheTTL))
+		log.Println("Trip locations and ETAs cached in Redis")
+	}
+
+	if !realtimeConfig.RedisPubSubEnabled {
+		services.SetLocationHub(services.NewLocationHub(nil, realtimeConfig.SubscriberBuffer))
+		log.Println("Location streaming initialized without Redis, updates stay on this instance")
+		return
+	}
+
+	hub := services.NewLocationHub(services.NewRedisService().Client, realtimeConfig.SubscriberBuffer)
+	services.SetLocationHub(hub)
+
+	// Updates are delivered locally until the Redis subscription is up
+	go func() {
+		for {
+			if err := hub.Run(context.Background()); err != nil {
+				log.Printf("Location relay stopped: %v", err)
+			}
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	log.Println("Location streaming initialized with Redis pub/sub")
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"log"
+	"triplink/backend/config"
+	"triplink/backend/services"
+
+	"gorm.io/gorm"
+)
+
+// initMQTTBridge starts bridging positions that GPS trackers publish to the
+// MQTT broker into trips. The returned function stops the bridge.
+func initMQTTBridge(db *gorm.DB) context.CancelFunc {
+	mqttConfig := config.GetMQTTConfig()
+	if err := mqttConfig.ValidateMQTTConfig(); err != nil {
+		log.Fatalf("Invalid MQTT configuration: %v", err)
+	}
+	if !mqttConfig.Enabled {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go services.NewMQTTBridge(db, mqttConfig).Run(ctx)
+
+	log.Printf("MQTT bridge started for %s", mqttConfig.BrokerURL)
+	return cancel
+}
@@ -2,39 +2,59 @@ package main
 
 import (
 	"log"
-	"time"
+	"triplink/backend/config"
 	"triplink/backend/services"
+
+	"gorm.io/gorm"
 )
 
 // initNotificationService initializes the notification service and registers providers
-func initNotificationService() {
-	// Get notification service instance
-	notificationService := services.GetNotificationService()
+func initNotificationService(db *gorm.DB) *services.NotificationService {
+	notificationService := services.NewNotificationService(db)
 
 	// Register Expo notification provider
-	expoProvider := services.NewExpoNotificationProvider()
+	expoProvider := services.NewExpoNotificationProvider(db)
 	notificationService.RegisterProvider(expoProvider)
 
+	// Register email provider when email delivery is enabled
+	emailConfig := config.GetEmailConfig()
+	if emailConfig.Enabled {
+		emailProvider, err := services.NewEmailNotificationProvider(emailConfig)
+		if err != nil {
+			log.Printf("Email notifications disabled: %v", err)
+		} else {
+			notificationService.RegisterEmailProvider(emailProvider)
+		}
+	}
+
+	// Register SMS provider when SMS delivery is enabled
+	smsConfig := config.GetSMSConfig()
+	if smsConfig.Enabled {
+		smsProvider, err := services.NewSMSNotificationProvider(smsConfig)
+		if err != nil {
+			log.Printf("SMS notifications disabled: %v", err)
+		} else {
+			notificationService.RegisterSMSProvider(smsProvider)
+		}
+	}
+
+	// Deliver notifications with background workers, retrying failures
+	queueConfig := config.GetNotificationQueueConfig()
+	if err := queueConfig.ValidateNotificationQueueConfig(); err != nil {
+		log.Printf("Invalid notification queue configuration, delivering in requests: %v", err)
+	} else if queueConfig.Enabled {
+		queue := services.NewNotificationQueue(db, notificationService, queueConfig)
+		queue.Start()
+		services.SetNotificationQueue(queue)
+	}
+
 	// Initialize and start notification batch service
-	batchService := services.GetNotificationBatchService()
+	batchService := services.GetNotificationBatchService(notificationService)
 	batchService.Start()
 
-	// Schedule periodic delay checks for notifications
-	go scheduleDelayChecks()
+	services.SetNotificationService(notificationService)
 
 	log.Println("Notification service initialized with Expo provider and batch processing")
-}
 
-// scheduleDelayChecks schedules periodic checks for delays
-func scheduleDelayChecks() {
-	triggerService := services.NewNotificationTriggerService()
-	ticker := time.NewTicker(15 * time.Minute) // Check every 15 minutes
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			triggerService.ScheduleDelayCheck()
-		}
-	}
+	return notificationService
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+	"triplink/backend/config"
+	"triplink/backend/services"
+
+	"gorm.io/gorm"
+)
+
+// initOutboxDispatcher registers the job publishing the tracking events
+// recorded in the outbox to the trip streams, webhooks and Kafka
+func initOutboxDispatcher(db *gorm.DB, scheduler *services.TrackingScheduler) {
+	outboxConfig := config.GetOutboxConfig()
+	if err := outboxConfig.ValidateOutboxConfig(); err != nil {
+		log.Fatalf("Invalid outbox configuration: %v", err)
+	}
+	kafkaConfig := config.GetKafkaConfig()
+	if err := kafkaConfig.ValidateKafkaConfig(); err != nil {
+		log.Fatalf("Invalid Kafka configuration: %v", err)
+	}
+
+	var publishers []services.OutboxPublisher
+	if outboxConfig.StreamEnabled {
+		publishers = append(publishers, services.StreamPublisher{})
+	}
+	for _, url := range outboxConfig.WebhookURLs {
+		publishers = append(publishers, services.NewWebhookPublisher(url, outboxConfig.WebhookSecret, outboxConfig.WebhookTimeout))
+	}
+	if kafkaConfig.Enabled {
+		producer, err := services.NewKafkaProducer(kafkaConfig)
+		if err != nil {
+			log.Fatalf("Failed to create Kafka producer: %v", err)
+		}
+		publishers = append(publishers, services.NewKafkaPublisher(kafkaConfig, producer))
+		services.SetLocationOutboxEnabled(kafkaConfig.PublishLocations)
+	}
+
+	dispatcher := services.NewOutboxDispatcher(db, outboxConfig, publishers...)
+	scheduler.RegisterJob("outbox_dispatch", outboxConfig.PollInterval, dispatcher.DispatchPending)
+	log.Printf("Outbox dispatcher publishing to %d destinations", len(publishers))
+}
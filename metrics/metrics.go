@@ -0,0 +1,132 @@
+// Package metrics instruments the API with Prometheus metrics: request
+// latency per route, database query timing, and counters of location updates
+// and notification deliveries.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds the application's metrics along with the Go runtime and
+// process metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// RequestDuration is the latency of API requests by route pattern, so
+	// requests for different trips share a series
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "triplink",
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of API requests by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// QueryDuration is the time taken by database queries
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "triplink",
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by database queries by operation and table.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	// LocationUpdates counts trip location updates by source and result
+	LocationUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "triplink",
+		Name:      "location_updates_total",
+		Help:      "Trip location updates by source and result (recorded, rejected, failed).",
+	}, []string{"source", "result"})
+
+	// NotificationDeliveries counts notification delivery attempts
+	NotificationDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "triplink",
+		Name:      "notification_deliveries_total",
+		Help:      "Notification delivery attempts by provider and result (success, failure).",
+	}, []string{"provider", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RequestDuration,
+		QueryDuration,
+		LocationUpdates,
+		NotificationDeliveries,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Results of location updates
+const (
+	LocationRecorded  = "recorded"
+	LocationRejected  = "rejected" // invalid, or tracking disabled
+	LocationFailed    = "failed"
+	LocationDuplicate = "duplicate" // already recorded
+	LocationFiltered  = "filtered"  // too inaccurate
+)
+
+// ObserveLocationUpdate counts the result of a location update
+func ObserveLocationUpdate(source, result string) {
+	if source == "" {
+		source = "UNKNOWN"
+	}
+	LocationUpdates.WithLabelValues(source, result).Inc()
+}
+
+// ObserveNotificationDelivery counts a notification delivery attempt
+func ObserveNotificationDelivery(provider string, success bool) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	NotificationDeliveries.WithLabelValues(provider, result).Inc()
+}
+
+// RouteLatency summarizes the requests served on a route since the server
+// started
+type RouteLatency struct {
+	Requests  uint64  `json:"requests"`
+	AverageMs float64 `json:"average_ms"`
+}
+
+// RequestLatency returns the latency of a route's requests across status
+// codes, or nil when the route hasn't served any
+func RequestLatency(method, route string) *RouteLatency {
+	families, err := Registry.Gather()
+	if err != nil {
+		return nil
+	}
+
+	var count uint64
+	var sum float64
+	for _, family := range families {
+		if family.GetName() != "triplink_http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["method"] == method && labels["route"] == route {
+				count += metric.GetHistogram().GetSampleCount()
+				sum += metric.GetHistogram().GetSampleSum()
+			}
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	return &RouteLatency{
+		Requests:  count,
+		AverageMs: sum / float64(count) * 1000,
+	}
+}
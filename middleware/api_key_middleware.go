@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"triplink/backend/models"
+	"triplink/backend/services"
+)
+
+// ApiKeyMiddleware authenticates server-to-server integrations by API key,
+// separately from the JWTs of users
+type ApiKeyMiddleware struct {
+	keys *services.ApiKeyService
+}
+
+// NewApiKeyMiddleware creates a new API key middleware instance
+func NewApiKeyMiddleware(db *gorm.DB) *ApiKeyMiddleware {
+	return &ApiKeyMiddleware{keys: services.NewApiKeyService(db)}
+}
+
+// Authenticate returns a middleware requiring a valid key in the X-API-Key
+// header, or an "Authorization: ApiKey <key>" header. Requests act as the
+// key's carrier, so user_id is set as for user tokens.
+func (akm *ApiKeyMiddleware) Authenticate() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get("X-API-Key")
+		if key == "" {
+			if value := c.Get("Authorization"); strings.HasPrefix(value, "ApiKey ") {
+				key = strings.TrimSpace(strings.TrimPrefix(value, "ApiKey "))
+			}
+		}
+		if key == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "API key required"})
+		}
+
+		apiKey, err := akm.keys.Authenticate(key)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		c.Locals("user_id", float64(apiKey.UserID))
+		c.Locals("role", "CARRIER")
+		c.Locals("api_key", apiKey)
+		return c.Next()
+	}
+}
+
+// RequireScope returns a middleware requiring the authenticated key to have a
+// scope, and to be allowed to access the route's :trip_id if it has one
+func (akm *ApiKeyMiddleware) RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		apiKey, ok := c.Locals("api_key").(*models.ApiKey)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "API key required"})
+		}
+		if !services.ApiKeyHasScope(apiKey, scope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": services.ErrApiKeyScope.Error()})
+		}
+
+		if tripIDStr := c.Params("trip_id"); tripIDStr != "" {
+			tripID, err := strconv.ParseUint(tripIDStr, 10, 32)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid trip ID"})
+			}
+			if err := akm.keys.AuthorizeTrip(apiKey, uint(tripID)); err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+		return c.Next()
+	}
+}
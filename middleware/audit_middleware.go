@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"triplink/backend/config"
+	"triplink/backend/models"
+	"triplink/backend/services"
+)
+
+// auditCollections maps the path segments of collections to the entity type
+// recorded in the audit log. Other collections are recorded by segment name.
+var auditCollections = map[string]string{
+	"register":             "user",
+	"users":                "user",
+	"trips":                "trip",
+	"loads":                "load",
+	"quotes":               "quote",
+	"vehicles":             "vehicle",
+	"stops":                "trip_stop",
+	"transactions":         "transaction",
+	"invoices":             "invoice",
+	"manifests":            "manifest",
+	"customs-documents":    "customs_document",
+	"documents":            "document",
+	"conversations":        "conversation",
+	"messages":             "message",
+	"report-subscriptions": "report_subscription",
+	"trip-templates":       "trip_template",
+	"saved-locations":      "saved_location",
+	"policies":             "retention_policy",
+	"runs":                 "retention_run",
+	"api-keys":             "api_key",
+	"connections":          "telematics_connection",
+	"notifications":        "notification",
+	"dead-letters":         "notification_dead_letter",
+	"verification":         "phone_verification",
+	"verify":               "phone_verification",
+}
+
+// AuditMiddleware records an audit log of every mutating API call
+type AuditMiddleware struct {
+	audit     *services.AuditService
+	enabled   bool
+	skipPaths [][]string
+}
+
+// NewAuditMiddleware creates a new audit middleware instance
+func NewAuditMiddleware(db *gorm.DB, cfg *config.AuditConfig) *AuditMiddleware {
+	am := &AuditMiddleware{
+		audit:   services.NewAuditService(db),
+		enabled: cfg.Enabled,
+	}
+	for _, path := range cfg.SkipPaths {
+		am.skipPaths = append(am.skipPaths, pathSegments(path))
+	}
+	return am
+}
+
+// Audit returns a middleware logging POST, PUT, PATCH and DELETE calls with
+// their actor, endpoint and the entity they address. The audited fields of
+// the entity are read before and after the call to record what changed.
+func (am *AuditMiddleware) Audit() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !am.enabled || !isMutatingMethod(c.Method()) || am.skipped(c.Path()) {
+			return c.Next()
+		}
+
+		entityType, entityID := auditTarget(c.Path())
+		entity, audited := services.AuditEntities[entityType]
+
+		var before *services.AuditSnapshot
+		if audited && entityID != nil {
+			before = am.audit.Snapshot(entity, *entityID, bodyTripID(c))
+		}
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			if fiberErr, ok := err.(*fiber.Error); ok {
+				status = fiberErr.Code
+			} else {
+				status = fiber.StatusInternalServerError
+			}
+		}
+
+		// Calls creating an entity return it with its ID
+		if entityID == nil && status >= 200 && status < 300 {
+			entityID = responseID(c)
+			if audited && entityID != nil {
+				before = &services.AuditSnapshot{Trips: map[uint]map[string]interface{}{}}
+			}
+		}
+
+		entry := models.AuditLog{
+			RequestID:  requestID(c),
+			Method:     c.Method(),
+			Endpoint:   c.Route().Path,
+			Path:       c.Path(),
+			EntityType: entityType,
+			EntityID:   entityID,
+			StatusCode: status,
+			IPAddress:  c.IP(),
+		}
+		if userID, ok := c.Locals("user_id").(float64); ok {
+			actorID := uint(userID)
+			entry.ActorID = &actorID
+		}
+
+		var after *services.AuditSnapshot
+		var auditedEntity *services.AuditEntity
+		if audited && before != nil {
+			after = am.audit.Snapshot(entity, *entityID, bodyTripID(c))
+			auditedEntity = &entity
+		}
+		if recordErr := am.audit.Record(entry, auditedEntity, before, after); recordErr != nil {
+			log.Printf("Failed to record audit log for %s %s: %v", entry.Method, entry.Path, recordErr)
+		}
+
+		return err
+	}
+}
+
+// skipped reports whether a path matches one of the skipped path prefixes
+func (am *AuditMiddleware) skipped(path string) bool {
+	segments := pathSegments(path)
+	for _, skip := range am.skipPaths {
+		if len(skip) > len(segments) {
+			continue
+		}
+		matched := true
+		for i, part := range skip {
+			if part != "*" && part != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// auditTarget returns the entity a call addresses: the last collection of the
+// path followed by an ID, e.g. the stop of /api/tracking/trips/4/stops/9/status.
+// Calls without an ID address the last collection, e.g. POST /api/trips.
+func auditTarget(path string) (string, *uint) {
+	segments := pathSegments(path)
+
+	entityType := ""
+	var entityID *uint
+	for i := 0; i+1 < len(segments); i++ {
+		if id, err := strconv.ParseUint(segments[i+1], 10, 32); err == nil {
+			entityType = collectionEntityType(segments[i])
+			value := uint(id)
+			entityID = &value
+		}
+	}
+	if entityID == nil && len(segments) > 0 {
+		entityType = collectionEntityType(segments[len(segments)-1])
+	}
+	return entityType, entityID
+}
+
+// collectionEntityType returns the entity type of a collection path segment
+func collectionEntityType(segment string) string {
+	if entityType, ok := auditCollections[segment]; ok {
+		return entityType
+	}
+	return strings.ReplaceAll(segment, "-", "_")
+}
+
+// pathSegments splits a path into its segments, without the /api prefix
+func pathSegments(path string) []string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 0 && segments[0] == "api" {
+		segments = segments[1:]
+	}
+	return segments
+}
+
+// bodyTripID returns the trip_id of a JSON request body, e.g. the trip a load
+// is booked onto
+func bodyTripID(c *fiber.Ctx) uint {
+	var body struct {
+		TripID uint `json:"trip_id"`
+	}
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		return 0
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return 0
+	}
+	return body.TripID
+}
+
+// responseID returns the id of the entity in a JSON response body
+func responseID(c *fiber.Ctx) *uint {
+	if !strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return nil
+	}
+	var body struct {
+		ID uint `json:"id"`
+	}
+	if err := json.Unmarshal(c.Response().Body(), &body); err != nil || body.ID == 0 {
+		return nil
+	}
+	return &body.ID
+}
+
+// requestID returns the caller's X-Request-ID, or a new random ID
+func requestID(c *fiber.Ctx) string {
+	if id := c.Get(fiber.HeaderXRequestID); id != "" {
+		return id
+	}
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// isMutatingMethod reports whether an HTTP method changes data
+func isMutatingMethod(method string) bool {
+	switch method {
+	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -38,7 +38,7 @@ var DefaultCacheConfigs = map[string]CacheConfig{
 	"analytics": {
 		TTL:       15 * time.Minute,
 		KeyPrefix: "api:analytics:",
-		VaryBy:    []string{"body", "user_id"},
+		VaryBy:    []string{"body", "params", "query", "user_id"},
 		SkipAuth:  false,
 	},
 	// Route optimization endpoints
@@ -107,6 +107,9 @@ func (cm *CacheMiddleware) CacheWithConfig(config CacheConfig) fiber.Handler {
 			c.Set("X-Cache", "HIT")
 			c.Set("X-Cache-TTL", strconv.Itoa(int(cachedResponse.TTL)))
 			c.Set("Content-Type", cachedResponse.ContentType)
+			for name, value := range cachedResponse.Headers {
+				c.Set(name, value)
+			}
 			
 			return c.Status(cachedResponse.StatusCode).Send(cachedResponse.Body)
 		}
@@ -145,6 +148,10 @@ func (cm *CacheMiddleware) captureAndCacheResponse(c *fiber.Ctx, cacheKey string
 			TTL:         int64(config.TTL.Seconds()),
 			CachedAt:    time.Now(),
 		}
+		// Keep downloads named when served from cache
+		if disposition := c.Response().Header.Peek(fiber.HeaderContentDisposition); len(disposition) > 0 {
+			cachedResponse.Headers = map[string]string{fiber.HeaderContentDisposition: string(disposition)}
+		}
 		
 		// Store in cache (async to not block response)
 		go func() {
@@ -202,39 +209,6 @@ func (cm *CacheMiddleware) generateCacheKey(c *fiber.Ctx, config CacheConfig) st
 	return strings.Join(keyParts, ":")
 }
 
-// RateLimitMiddleware provides Redis-based rate limiting
-func (cm *CacheMiddleware) RateLimitMiddleware(requests int, window time.Duration) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		// Get client identifier (IP + User ID if available)
-		identifier := c.IP()
-		if userID := c.Locals("user_id"); userID != nil {
-			identifier = fmt.Sprintf("%s:user:%v", identifier, userID)
-		}
-		
-		// Check rate limit
-		allowed, remaining, err := cm.redis.CheckRateLimit(identifier, requests, window)
-		if err != nil {
-			// If Redis is down, allow the request but log the error
-			// In production, you might want to fail closed instead
-			return c.Next()
-		}
-		
-		// Set rate limit headers
-		c.Set("X-RateLimit-Limit", strconv.Itoa(requests))
-		c.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
-		c.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(window).Unix(), 10))
-		
-		if !allowed {
-			return c.Status(429).JSON(fiber.Map{
-				"error": "Rate limit exceeded",
-				"retry_after": int64(window.Seconds()),
-			})
-		}
-		
-		return c.Next()
-	}
-}
-
 // CacheInvalidationMiddleware provides cache invalidation for write operations
 func (cm *CacheMiddleware) CacheInvalidationMiddleware(patterns []string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
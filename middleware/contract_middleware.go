@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"triplink/backend/config"
+	"triplink/backend/internal/openapi"
+)
+
+// ContractMiddleware checks API calls against the OpenAPI spec, so handlers
+// that drift from their documentation fail in development instead of
+// surprising clients
+type ContractMiddleware struct {
+	spec    *openapi.Document
+	enabled bool
+}
+
+// NewContractMiddleware creates a new contract middleware instance checking
+// calls against a JSON spec. A spec that can't be loaded disables it.
+func NewContractMiddleware(spec []byte, cfg *config.APIContractConfig) *ContractMiddleware {
+	cm := &ContractMiddleware{enabled: cfg.Validate}
+	if !cm.enabled {
+		return cm
+	}
+	doc, err := openapi.Load(spec)
+	if err != nil {
+		log.Printf("Not validating the API contract: %v", err)
+		cm.enabled = false
+		return cm
+	}
+	cm.spec = doc
+	return cm
+}
+
+// Validate returns a middleware rejecting requests with parameters or JSON
+// bodies of the wrong types with a 400, and replacing responses that don't
+// match their documented status and schema with a 500. Paths the spec doesn't
+// have, like static files, aren't checked.
+func (cm *ContractMiddleware) Validate() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !cm.enabled {
+			return c.Next()
+		}
+		operation, path, params := cm.spec.Find(c.Method(), c.Path())
+		if operation == nil {
+			return c.Next()
+		}
+
+		if err := cm.checkRequest(c, operation, params); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Request does not match the API contract: " + err.Error(),
+			})
+		}
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		if err := cm.checkResponse(c, operation); err != nil {
+			log.Printf("Response of %s %s does not match the API contract: %v", c.Method(), path, err)
+			c.Response().ResetBody()
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Response does not match the API contract: " + err.Error(),
+			})
+		}
+		return nil
+	}
+}
+
+// checkRequest checks the parameters and JSON body of a request
+func (cm *ContractMiddleware) checkRequest(c *fiber.Ctx, operation *openapi.Operation, params map[string]string) error {
+	for _, parameter := range operation.Parameters {
+		value := ""
+		switch parameter.In {
+		case "path":
+			value = params[parameter.Name]
+		case "query":
+			value = c.Query(parameter.Name)
+		case "header":
+			value = c.Get(parameter.Name)
+		}
+		if value == "" {
+			continue
+		}
+		if err := openapi.ValidateParameter(parameter, value); err != nil {
+			return err
+		}
+	}
+
+	if operation.RequestBody == nil || len(c.Body()) == 0 || !isJSON(string(c.Request().Header.ContentType())) {
+		return nil
+	}
+	media, ok := operation.RequestBody.Content[fiber.MIMEApplicationJSON]
+	if !ok {
+		return nil
+	}
+	var body interface{}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return fmt.Errorf("body isn't valid JSON")
+	}
+	return cm.spec.Validate(media.Schema, body, false)
+}
+
+// checkResponse checks the status and JSON body of a response
+func (cm *ContractMiddleware) checkResponse(c *fiber.Ctx, operation *openapi.Operation) error {
+	status := c.Response().StatusCode()
+	response := operation.Response(status)
+	if response == nil {
+		return fmt.Errorf("status %d isn't documented", status)
+	}
+	if len(response.Content) == 0 || c.Response().IsBodyStream() {
+		return nil
+	}
+
+	contentType, _, _ := mime.ParseMediaType(string(c.Response().Header.ContentType()))
+	media, ok := response.Content[contentType]
+	if !ok {
+		var documented []string
+		for documentedType := range response.Content {
+			documented = append(documented, documentedType)
+		}
+		return fmt.Errorf("status %d is %s, documented as %s", status, contentType, strings.Join(documented, ", "))
+	}
+	if !isJSON(contentType) {
+		return nil
+	}
+	var body interface{}
+	if err := json.Unmarshal(c.Response().Body(), &body); err != nil {
+		return fmt.Errorf("body isn't valid JSON")
+	}
+	if err := cm.spec.Validate(media.Schema, body, true); err != nil {
+		return fmt.Errorf("status %d %w", status, err)
+	}
+	return nil
+}
+
+// isJSON reports whether a content type is JSON, including types like
+// application/geo+json
+func isJSON(contentType string) bool {
+	contentType, _, _ = mime.ParseMediaType(contentType)
+	return contentType == fiber.MIMEApplicationJSON || strings.HasSuffix(contentType, "+json")
+}
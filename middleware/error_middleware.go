@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+	"triplink/backend/apierror"
+	"triplink/backend/tracing"
+)
+
+// ErrorMiddleware sends every error response in the envelope of package
+// apierror, so clients get a code and a trace ID whichever handler failed
+type ErrorMiddleware struct{}
+
+// NewErrorMiddleware creates a new error middleware instance
+func NewErrorMiddleware() *ErrorMiddleware {
+	return &ErrorMiddleware{}
+}
+
+// Handle responds to errors returned by later handlers with their code's
+// status, and adds a code and the trace ID to error bodies handlers wrote
+// themselves. Codes handlers set are kept; otherwise the code is the general
+// one of the status.
+func (m *ErrorMiddleware) Handle() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return apierror.Respond(c, err)
+		}
+
+		status := c.Response().StatusCode()
+		if status < 400 || !isJSON(string(c.Response().Header.ContentType())) {
+			return nil
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(c.Response().Body(), &body); err != nil {
+			return nil
+		}
+		if _, ok := body["error"].(string); !ok {
+			return nil
+		}
+
+		if code, ok := body["code"].(string); !ok || code == "" {
+			body["code"] = apierror.CodeForStatus(status)
+		}
+		if traceID := tracing.TraceID(c.UserContext()); traceID != "" {
+			body["trace_id"] = traceID
+		}
+		return c.JSON(body)
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"triplink/backend/apierror"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func newErrorTestApp(t *testing.T) *fiber.App {
+	provider := sdktrace.NewTracerProvider()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	app := fiber.New()
+	app.Use(NewTracingMiddleware().Trace())
+	app.Use(NewErrorMiddleware().Handle())
+	app.Get("/coded", func(c *fiber.Ctx) error {
+		return apierror.New(apierror.CodePaymentRequired, "Upgrade to track more vehicles").
+			WithDetails(fiber.Map{"limit": 5})
+	})
+	app.Get("/tracking", func(c *fiber.Ctx) error {
+		tripID := uint(7)
+		return services.NewTrackingError("TRACKING_DISABLED", "Tracking is paused for this trip", "Paused by the carrier", &tripID, nil)
+	})
+	app.Get("/broken", func(c *fiber.Ctx) error {
+		return errors.New("pq: connection refused")
+	})
+	app.Get("/written", func(c *fiber.Ctx) error {
+		return c.Status(404).JSON(fiber.Map{"error": "Trip not found"})
+	})
+	app.Get("/written-with-code", func(c *fiber.Ctx) error {
+		return c.Status(409).JSON(fiber.Map{"error": "Tracking was archived", "code": "TRACKING_ARCHIVED"})
+	})
+	app.Get("/ok", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"error": "not an error"})
+	})
+	app.Get("/text", func(c *fiber.Ctx) error {
+		return c.Status(400).SendString("bad request")
+	})
+	return app
+}
+
+func errorResponse(t *testing.T, app *fiber.App, path string) (int, map[string]interface{}) {
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body
+}
+
+func TestErrorMiddlewareRespondsWithEnvelope(t *testing.T) {
+	app := newErrorTestApp(t)
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	tests := []struct {
+		path   string
+		status int
+		body   map[string]interface{}
+	}{
+		{"/coded", 402, map[string]interface{}{"error": "Upgrade to track more vehicles", "code": "PAYMENT_REQUIRED", "details": map[string]interface{}{"limit": float64(5)}, "trace_id": traceID}},
+		{"/tracking", 409, map[string]interface{}{"error": "Tracking is paused for this trip", "code": "TRACKING_DISABLED", "details": "Paused by the carrier", "trace_id": traceID}},
+		// Internal errors don't reveal their cause
+		{"/broken", 500, map[string]interface{}{"error": "Internal server error", "code": "INTERNAL_ERROR", "trace_id": traceID}},
+		{"/written", 404, map[string]interface{}{"error": "Trip not found", "code": "NOT_FOUND", "trace_id": traceID}},
+		{"/written-with-code", 409, map[string]interface{}{"error": "Tracking was archived", "code": "TRACKING_ARCHIVED", "trace_id": traceID}},
+		{"/missing", 404, map[string]interface{}{"error": "Cannot GET /missing", "code": "NOT_FOUND", "trace_id": traceID}},
+		{"/ok", 200, map[string]interface{}{"error": "not an error"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			status, body := errorResponse(t, app, tt.path)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.body, body)
+		})
+	}
+
+	// Bodies that aren't JSON are left alone
+	resp, err := app.Test(httptest.NewRequest("GET", "/text", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+}
+
+func TestErrorCatalog(t *testing.T) {
+	seen := map[apierror.Code]bool{}
+	for _, entry := range apierror.Catalog() {
+		assert.False(t, seen[entry.Code], "%s is in the catalog twice", entry.Code)
+		seen[entry.Code] = true
+		assert.GreaterOrEqual(t, entry.Status, 400, entry.Code)
+		assert.NotEmpty(t, entry.Description, entry.Code)
+	}
+
+	assert.Equal(t, 422, apierror.Status(apierror.CodeValidationFailed))
+	assert.Equal(t, 500, apierror.Status("NO_SUCH_CODE"))
+	assert.Equal(t, apierror.CodeRateLimited, apierror.CodeForStatus(429))
+	assert.Equal(t, apierror.CodeBadRequest, apierror.CodeForStatus(418))
+	assert.Equal(t, apierror.CodeInternal, apierror.CodeForStatus(507))
+}
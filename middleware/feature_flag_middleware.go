@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"triplink/backend/services"
+)
+
+// RequireFeature returns a middleware serving a route only to the users the
+// feature is on for. Others get a 404, as if the route didn't exist yet.
+// Place it after authentication so the user is known.
+func RequireFeature(key string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(float64)
+		if !services.FeatureEnabled(key, uint(userID)) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Not found"})
+		}
+		return c.Next()
+	}
+}
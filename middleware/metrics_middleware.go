@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"triplink/backend/config"
+	"triplink/backend/metrics"
+)
+
+// MetricsMiddleware records the latency of requests and serves the metrics
+// to Prometheus
+type MetricsMiddleware struct {
+	enabled bool
+	path    string
+	token   string
+}
+
+// NewMetricsMiddleware creates a new metrics middleware instance
+func NewMetricsMiddleware(cfg *config.MetricsConfig) *MetricsMiddleware {
+	return &MetricsMiddleware{
+		enabled: cfg.Enabled,
+		path:    cfg.Path,
+		token:   cfg.Token,
+	}
+}
+
+// Record observes the latency and status of each request by route pattern
+func (m *MetricsMiddleware) Record() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !m.enabled || c.Path() == m.path {
+			return c.Next()
+		}
+
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+
+		metrics.RequestDuration.WithLabelValues(c.Method(), c.Route().Path, strconv.Itoa(status)).
+			Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format, requiring the
+// configured bearer token if there is one
+func (m *MetricsMiddleware) Handler() fiber.Handler {
+	serve := adaptor.HTTPHandler(metrics.Handler())
+	return func(c *fiber.Ctx) error {
+		if m.token != "" {
+			expected := []byte("Bearer " + m.token)
+			if subtle.ConstantTimeCompare([]byte(c.Get("Authorization")), expected) != 1 {
+				return c.Status(401).JSON(fiber.Map{
+					"error": "Unauthorized",
+				})
+			}
+		}
+		return serve(c)
+	}
+}
+
+// Path is where the metrics are served
+func (m *MetricsMiddleware) Path() string {
+	return m.path
+}
+
+// Enabled reports whether metrics are recorded and served
+func (m *MetricsMiddleware) Enabled() bool {
+	return m.enabled
+}
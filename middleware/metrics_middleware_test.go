@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"triplink/backend/config"
+	"triplink/backend/metrics"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMetricsTestApp(token string) *fiber.App {
+	m := NewMetricsMiddleware(&config.MetricsConfig{Enabled: true, Path: "/metrics", Token: token})
+	app := fiber.New()
+	app.Use(m.Record())
+	app.Get(m.Path(), m.Handler())
+	app.Get("/api/widgets/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") == "0" {
+			return fiber.NewError(fiber.StatusNotFound, "widget not found")
+		}
+		return c.JSON(fiber.Map{"id": c.Params("id")})
+	})
+	return app
+}
+
+func TestMetricsRecordsRequestsByRoute(t *testing.T) {
+	app := newMetricsTestApp("")
+	before := testutil.CollectAndCount(metrics.RequestDuration)
+
+	for _, id := range []string{"1", "2", "0"} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/widgets/"+id, nil))
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	// Requests for different widgets share the route's series
+	assert.Equal(t, before+2, testutil.CollectAndCount(metrics.RequestDuration))
+	latency := metrics.RequestLatency("GET", "/api/widgets/:id")
+	require.NotNil(t, latency)
+	assert.Equal(t, uint64(3), latency.Requests)
+	assert.Nil(t, metrics.RequestLatency("POST", "/api/widgets/:id"))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, string(body), `triplink_http_request_duration_seconds_count{method="GET",route="/api/widgets/:id",status="200"} 2`)
+	assert.Contains(t, string(body), `triplink_http_request_duration_seconds_count{method="GET",route="/api/widgets/:id",status="404"} 1`)
+	assert.False(t, strings.Contains(string(body), `route="/metrics"`))
+}
+
+func TestMetricsEndpointRequiresToken(t *testing.T) {
+	app := newMetricsTestApp("scrape-secret")
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 401, resp.StatusCode)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-secret")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestMetricsCountsLocationUpdatesAndDeliveries(t *testing.T) {
+	metrics.ObserveLocationUpdate("GPS", metrics.LocationRecorded)
+	metrics.ObserveLocationUpdate("", metrics.LocationRejected)
+	metrics.ObserveNotificationDelivery("SMTP", false)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.LocationUpdates.WithLabelValues("GPS", "recorded")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.LocationUpdates.WithLabelValues("UNKNOWN", "rejected")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.NotificationDeliveries.WithLabelValues("SMTP", "failure")))
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"triplink/backend/auth"
+	"triplink/backend/config"
+	"triplink/backend/services"
+)
+
+// RateLimiter counts requests against a limit per window
+type RateLimiter interface {
+	HitRateLimit(identifier string, limit int, window time.Duration) (*services.RateLimitResult, error)
+}
+
+// rateLimitRule is a limit applied to the requests of one user or IP address
+type rateLimitRule struct {
+	name      string
+	userLimit int
+	ipLimit   int
+	window    time.Duration
+}
+
+// RateLimitMiddleware limits how many requests each user, or each IP address
+// for anonymous requests, can make per window
+type RateLimitMiddleware struct {
+	limiter        RateLimiter
+	enabled        bool
+	standard       rateLimitRule
+	expensive      rateLimitRule
+	expensivePaths []string
+}
+
+// NewRateLimitMiddleware creates a new rate limit middleware instance
+func NewRateLimitMiddleware(limiter RateLimiter, cfg *config.RateLimitConfig) *RateLimitMiddleware {
+	return &RateLimitMiddleware{
+		limiter: limiter,
+		enabled: cfg.Enabled,
+		standard: rateLimitRule{
+			name:      "standard",
+			userLimit: cfg.UserLimit,
+			ipLimit:   cfg.IPLimit,
+			window:    cfg.Window,
+		},
+		expensive: rateLimitRule{
+			name:      "expensive",
+			userLimit: cfg.ExpensiveUserLimit,
+			ipLimit:   cfg.ExpensiveIPLimit,
+			window:    cfg.ExpensiveWindow,
+		},
+		expensivePaths: cfg.ExpensivePaths,
+	}
+}
+
+// Limit returns a middleware counting each request against the standard
+// limit, and against the expensive limit for expensive endpoints. The
+// X-RateLimit headers describe the limit closest to being exceeded, and
+// requests over a limit get 429 with a Retry-After header.
+//
+// Users are identified from their token, since the middleware runs before the
+// routes' auth middleware. Requests are let through when the limiter fails.
+func (rl *RateLimitMiddleware) Limit() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !rl.enabled {
+			return c.Next()
+		}
+
+		rules := []rateLimitRule{rl.standard}
+		if rl.isExpensive(c.Path()) {
+			rules = append(rules, rl.expensive)
+		}
+
+		var tightest *services.RateLimitResult
+		for _, rule := range rules {
+			identifier, limit := rl.identify(c, rule)
+			result, err := rl.limiter.HitRateLimit(identifier, limit, rule.window)
+			if err != nil {
+				log.Printf("Rate limiter unavailable, allowing request: %v", err)
+				return c.Next()
+			}
+			if tightest == nil || !result.Allowed || (tightest.Allowed && result.Remaining < tightest.Remaining) {
+				tightest = result
+			}
+		}
+
+		c.Set("X-RateLimit-Limit", strconv.Itoa(tightest.Limit))
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+		c.Set("X-RateLimit-Reset", strconv.FormatInt(tightest.ResetAt.Unix(), 10))
+
+		if !tightest.Allowed {
+			retryAfter := int64(math.Ceil(time.Until(tightest.ResetAt).Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(retryAfter, 10))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":       "Rate limit exceeded",
+				"retry_after": retryAfter,
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// identify returns the counter key and limit of a request under a rule
+func (rl *RateLimitMiddleware) identify(c *fiber.Ctx, rule rateLimitRule) (string, int) {
+	if userID, ok := auth.RequestUserID(c); ok {
+		return fmt.Sprintf("%s:user:%d", rule.name, userID), rule.userLimit
+	}
+	return fmt.Sprintf("%s:ip:%s", rule.name, c.IP()), rule.ipLimit
+}
+
+// isExpensive reports whether a path is under one of the expensive paths
+func (rl *RateLimitMiddleware) isExpensive(path string) bool {
+	for _, prefix := range rl.expensivePaths {
+		if path == prefix || strings.HasPrefix(path, strings.TrimRight(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"triplink/backend/auth"
+	"triplink/backend/config"
+	"triplink/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryLimiter counts requests in memory, with windows that never expire
+type memoryLimiter struct {
+	counts map[string]int
+	err    error
+}
+
+func (m *memoryLimiter) HitRateLimit(identifier string, limit int, window time.Duration) (*services.RateLimitResult, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.counts[identifier]++
+	remaining := limit - m.counts[identifier]
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &services.RateLimitResult{
+		Allowed:   m.counts[identifier] <= limit,
+		Limit:     limit,
+		Remaining: remaining,
+		ResetAt:   time.Now().Add(window),
+	}, nil
+}
+
+func newRateLimitTestApp(limiter RateLimiter) *fiber.App {
+	app := fiber.New()
+	app.Use(NewRateLimitMiddleware(limiter, &config.RateLimitConfig{
+		Enabled:            true,
+		UserLimit:          5,
+		IPLimit:            3,
+		Window:             time.Minute,
+		ExpensivePaths:     []string{"/api/analytics"},
+		ExpensiveUserLimit: 2,
+		ExpensiveIPLimit:   1,
+		ExpensiveWindow:    30 * time.Second,
+	}).Limit())
+	app.Get("/api/trips", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	app.Get("/api/analytics/revenue", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	app.Get("/api/analytics-export", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	return app
+}
+
+func rateLimitedGet(t *testing.T, app *fiber.App, path, token string) (int, map[string]string) {
+	req := httptest.NewRequest("GET", path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := app.Test(req, -1)
+	require.NoError(t, err)
+
+	headers := map[string]string{}
+	for _, name := range []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"} {
+		headers[name] = resp.Header.Get(name)
+	}
+	return resp.StatusCode, headers
+}
+
+func TestRateLimitPerIP(t *testing.T) {
+	app := newRateLimitTestApp(&memoryLimiter{counts: map[string]int{}})
+
+	for i := 0; i < 3; i++ {
+		status, headers := rateLimitedGet(t, app, "/api/trips", "")
+		assert.Equal(t, 200, status)
+		assert.Equal(t, "3", headers["X-RateLimit-Limit"])
+		assert.Equal(t, strconv.Itoa(2-i), headers["X-RateLimit-Remaining"])
+		assert.NotEmpty(t, headers["X-RateLimit-Reset"])
+	}
+
+	status, headers := rateLimitedGet(t, app, "/api/trips", "")
+	assert.Equal(t, 429, status)
+	assert.Equal(t, "0", headers["X-RateLimit-Remaining"])
+	assert.Equal(t, "60", headers["Retry-After"])
+}
+
+func TestRateLimitPerUser(t *testing.T) {
+	app := newRateLimitTestApp(&memoryLimiter{counts: map[string]int{}})
+	token, err := auth.GenerateJWT(7, "SHIPPER")
+	require.NoError(t, err)
+	otherToken, err := auth.GenerateJWT(8, "SHIPPER")
+	require.NoError(t, err)
+
+	// Authenticated users get their own, higher limit
+	for i := 0; i < 5; i++ {
+		status, headers := rateLimitedGet(t, app, "/api/trips", token)
+		assert.Equal(t, 200, status)
+		assert.Equal(t, "5", headers["X-RateLimit-Limit"])
+	}
+	status, _ := rateLimitedGet(t, app, "/api/trips", token)
+	assert.Equal(t, 429, status)
+
+	status, _ = rateLimitedGet(t, app, "/api/trips", otherToken)
+	assert.Equal(t, 200, status)
+	status, _ = rateLimitedGet(t, app, "/api/trips", "")
+	assert.Equal(t, 200, status)
+}
+
+func TestRateLimitExpensiveEndpoints(t *testing.T) {
+	app := newRateLimitTestApp(&memoryLimiter{counts: map[string]int{}})
+	token, err := auth.GenerateJWT(7, "SHIPPER")
+	require.NoError(t, err)
+
+	// The expensive limit is the tighter one, so it is reported
+	status, headers := rateLimitedGet(t, app, "/api/analytics/revenue", token)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "2", headers["X-RateLimit-Limit"])
+	assert.Equal(t, "1", headers["X-RateLimit-Remaining"])
+
+	rateLimitedGet(t, app, "/api/analytics/revenue", token)
+	status, headers = rateLimitedGet(t, app, "/api/analytics/revenue", token)
+	assert.Equal(t, 429, status)
+	assert.Equal(t, "30", headers["Retry-After"])
+
+	// Other endpoints still have standard requests left
+	status, headers = rateLimitedGet(t, app, "/api/trips", token)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "5", headers["X-RateLimit-Limit"])
+	assert.Equal(t, "1", headers["X-RateLimit-Remaining"])
+
+	// Prefixes match whole path segments
+	status, headers = rateLimitedGet(t, app, "/api/analytics-export", token)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "5", headers["X-RateLimit-Limit"])
+}
+
+func TestRateLimitAllowsWhenLimiterFails(t *testing.T) {
+	app := newRateLimitTestApp(&memoryLimiter{err: errors.New("connection refused")})
+
+	status, headers := rateLimitedGet(t, app, "/api/trips", "")
+	assert.Equal(t, 200, status)
+	assert.Empty(t, headers["X-RateLimit-Limit"])
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"triplink/backend/services"
+)
+
+// TenantMiddleware limits what a request reads to what the current user can
+// see
+type TenantMiddleware struct {
+	organizationService *services.OrganizationService
+}
+
+// NewTenantMiddleware creates a new tenant middleware
+func NewTenantMiddleware(db *gorm.DB) *TenantMiddleware {
+	return &TenantMiddleware{organizationService: services.NewOrganizationService(db)}
+}
+
+// Scope resolves the current user's organization scope into the request's
+// user context. Handlers and services using database sessions of that
+// context only read the trips and loads in the scope. It must run after
+// authentication.
+func (tm *TenantMiddleware) Scope() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("user_id").(float64)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		scope, err := tm.organizationService.Scope(uint(userID))
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		c.SetUserContext(services.WithTenantScope(c.UserContext(), scope))
+		return c.Next()
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"triplink/backend/tracing"
+)
+
+// TracingMiddleware starts a span for each request, continuing the trace of
+// the caller when the request carries a traceparent header
+type TracingMiddleware struct{}
+
+// NewTracingMiddleware creates a new tracing middleware instance
+func NewTracingMiddleware() *TracingMiddleware {
+	return &TracingMiddleware{}
+}
+
+// Trace starts the request's span and puts it in the user context, where
+// handlers pass it on to services with c.UserContext(). The trace ID is
+// returned in the X-Trace-ID header.
+func (m *TracingMiddleware) Trace() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		headers := make(http.Header)
+		c.Request().Header.VisitAll(func(key, value []byte) {
+			headers.Add(string(key), string(value))
+		})
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), propagation.HeaderCarrier(headers))
+
+		ctx, span := tracing.Tracer().Start(ctx, c.Method()+" "+c.Path(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Method()),
+				attribute.String("url.path", c.Path()),
+				attribute.String("client.address", c.IP()),
+			))
+		defer span.End()
+
+		c.SetUserContext(ctx)
+		if traceID := tracing.TraceID(ctx); traceID != "" {
+			c.Set("X-Trace-ID", traceID)
+		}
+
+		err := c.Next()
+
+		// The route is only known once the request has been routed
+		route := c.Route().Path
+		span.SetName(c.Method() + " " + route)
+		span.SetAttributes(attribute.String("http.route", route))
+
+		status := c.Response().StatusCode()
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+			if err != nil {
+				span.RecordError(err)
+				tracing.Logf(ctx, "%s %s failed: %v", c.Method(), c.Path(), err)
+			}
+		}
+		return err
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"triplink/backend/models"
+	"triplink/backend/tracing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTracingTestApp(t *testing.T) (*fiber.App, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Trip{}))
+	require.NoError(t, db.Use(tracing.NewGormPlugin()))
+
+	app := fiber.New()
+	app.Use(NewTracingMiddleware().Trace())
+	app.Get("/api/trips/:id", func(c *fiber.Ctx) error {
+		ctx, span := tracing.Start(c.UserContext(), "TripService.GetTrip")
+		defer span.End()
+
+		var trip models.Trip
+		if err := db.WithContext(ctx).First(&trip, c.Params("id")).Error; err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Trip not found"})
+		}
+		return c.JSON(trip)
+	})
+	app.Get("/api/broken", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusBadGateway, "upstream failed")
+	})
+	return app, recorder
+}
+
+func spanNamed(spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	for _, span := range spans {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func TestTracingContinuesCallerTrace(t *testing.T) {
+	app, recorder := newTracingTestApp(t)
+
+	req := httptest.NewRequest("GET", "/api/trips/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", resp.Header.Get("X-Trace-ID"))
+
+	spans := recorder.Ended()
+	server := spanNamed(spans, "GET /api/trips/:id")
+	require.NotNil(t, server)
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+
+	// The service span and its query belong to the request's trace
+	service := spanNamed(spans, "TripService.GetTrip")
+	require.NotNil(t, service)
+	assert.Equal(t, server.SpanContext().SpanID(), service.Parent().SpanID())
+
+	query := spanNamed(spans, "db.query")
+	require.NotNil(t, query)
+	assert.Equal(t, service.SpanContext().SpanID(), query.Parent().SpanID())
+	assert.Contains(t, query.Attributes(), tracingAttr("db.sql.table", "trips"))
+}
+
+func TestTracingMarksServerErrors(t *testing.T) {
+	app, recorder := newTracingTestApp(t)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/broken", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 502, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("X-Trace-ID"))
+
+	server := spanNamed(recorder.Ended(), "GET /api/broken")
+	require.NotNil(t, server)
+	assert.Equal(t, "Error", server.Status().Code.String())
+	assert.False(t, server.Parent().IsValid())
+}
+
+func tracingAttr(key, value string) attribute.KeyValue {
+	return attribute.String(key, value)
+}
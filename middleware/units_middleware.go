@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"triplink/backend/apierror"
+	"triplink/backend/internal/units"
+	"triplink/backend/services"
+)
+
+// unitsPaths are the prefixes of the paths whose measurements are converted
+var unitsPaths = []string{
+	"/api/tracking/",
+	"/api/mobile/",
+	"/api/monitoring/",
+	"/api/analytics/",
+	"/api/trips/",
+	"/api/vehicles/",
+	"/api/users/me/vehicles/",
+}
+
+// UnitsMiddleware converts the measurements of responses, which handlers
+// always write in metric units, to the system the client asked for
+type UnitsMiddleware struct {
+	db *gorm.DB
+}
+
+// NewUnitsMiddleware creates a new units middleware instance
+func NewUnitsMiddleware(db *gorm.DB) *UnitsMiddleware {
+	return &UnitsMiddleware{db: db}
+}
+
+// Convert returns a middleware converting the JSON bodies of successful reads
+// to the system of the units query parameter, or else to the one the current
+// user prefers. Imperial responses rename the keys suffixed with a metric
+// unit, e.g. distance_km becomes distance_mi. The system used is sent in the
+// X-Units header.
+func (m *UnitsMiddleware) Convert() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet || !hasUnitsPath(c.Path()) {
+			return c.Next()
+		}
+
+		requested := c.Query("units")
+		system, ok := units.Parse(requested)
+		if !ok {
+			return apierror.Newf(apierror.CodeBadRequest, "Invalid units %q, use metric or imperial", requested)
+		}
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if status < 200 || status >= 300 || !isJSON(string(c.Response().Header.ContentType())) {
+			return nil
+		}
+		if requested == "" {
+			if userID, ok := c.Locals("user_id").(float64); ok {
+				system = services.UserUnitSystem(m.db, uint(userID))
+			}
+		}
+		c.Set("X-Units", string(system))
+		if system == units.Metric {
+			return nil
+		}
+
+		var body interface{}
+		if err := json.Unmarshal(c.Response().Body(), &body); err != nil {
+			return nil
+		}
+		converted, err := json.Marshal(units.ConvertJSON(body, system))
+		if err != nil {
+			return err
+		}
+		c.Response().SetBodyRaw(converted)
+		return nil
+	}
+}
+
+func hasUnitsPath(path string) bool {
+	for _, prefix := range unitsPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
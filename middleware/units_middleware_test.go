@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"triplink/backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newUnitsTestApp(t *testing.T) (*fiber.App, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}))
+
+	app := fiber.New()
+	app.Use(NewErrorMiddleware().Handle())
+	app.Use(NewUnitsMiddleware(db).Convert())
+	authenticate := func(c *fiber.Ctx) error {
+		if userID, err := strconv.Atoi(c.Get("X-User-ID")); err == nil {
+			c.Locals("user_id", float64(userID))
+		}
+		return c.Next()
+	}
+	position := func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"trip_id": 7, "distance_km": 100, "speed": 90, "load": fiber.Map{"weight": 1000}})
+	}
+	app.Get("/api/tracking/trips/7", authenticate, position)
+	app.Post("/api/tracking/trips/7", authenticate, position)
+	app.Get("/api/loads/7", authenticate, position)
+	app.Get("/api/tracking/missing", func(c *fiber.Ctx) error {
+		return c.Status(404).JSON(fiber.Map{"error": "Trip not found", "distance_km": 100})
+	})
+	return app, db
+}
+
+func unitsResponse(t *testing.T, app *fiber.App, method, path string, userID uint) (int, string, map[string]interface{}) {
+	req := httptest.NewRequest(method, path, nil)
+	if userID != 0 {
+		req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, resp.Header.Get("X-Units"), body
+}
+
+func TestUnitsMiddlewareConvertsToRequestedSystem(t *testing.T) {
+	app, _ := newUnitsTestApp(t)
+
+	status, system, body := unitsResponse(t, app, "GET", "/api/tracking/trips/7", 0)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "metric", system)
+	assert.Equal(t, float64(100), body["distance_km"])
+
+	status, system, body = unitsResponse(t, app, "GET", "/api/tracking/trips/7?units=imperial", 0)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "imperial", system)
+	assert.Equal(t, float64(7), body["trip_id"])
+	assert.NotContains(t, body, "distance_km")
+	assert.InDelta(t, 62.1371, body["distance_mi"], 1e-9)
+	assert.InDelta(t, 55.9234, body["speed"], 1e-4)
+	assert.InDelta(t, 2204.62, body["load"].(map[string]interface{})["weight"], 1e-9)
+
+	status, _, body = unitsResponse(t, app, "GET", "/api/tracking/trips/7?units=furlongs", 0)
+	assert.Equal(t, 400, status)
+	assert.Equal(t, "BAD_REQUEST", body["code"])
+
+	// Errors, writes and other paths are left alone
+	_, system, body = unitsResponse(t, app, "GET", "/api/tracking/missing?units=imperial", 0)
+	assert.Empty(t, system)
+	assert.Equal(t, float64(100), body["distance_km"])
+	_, _, body = unitsResponse(t, app, "POST", "/api/tracking/trips/7?units=imperial", 0)
+	assert.Equal(t, float64(100), body["distance_km"])
+	_, _, body = unitsResponse(t, app, "GET", "/api/loads/7?units=imperial", 0)
+	assert.Equal(t, float64(100), body["distance_km"])
+}
+
+func TestUnitsMiddlewareUsesUserPreference(t *testing.T) {
+	app, db := newUnitsTestApp(t)
+	user := models.User{Email: "units@example.com", Phone: "+15550000801", Password: "password", Role: "SHIPPER", UnitSystem: "imperial"}
+	require.NoError(t, db.Create(&user).Error)
+
+	_, system, body := unitsResponse(t, app, "GET", "/api/tracking/trips/7", user.ID)
+	assert.Equal(t, "imperial", system)
+	assert.InDelta(t, 62.1371, body["distance_mi"], 1e-9)
+
+	// The query parameter overrides the preference
+	_, system, body = unitsResponse(t, app, "GET", "/api/tracking/trips/7?units=metric", user.ID)
+	assert.Equal(t, "metric", system)
+	assert.Equal(t, float64(100), body["distance_km"])
+}
@@ -18,7 +18,7 @@ type User struct {
 	Email           string     `gorm:"unique" json:"email"`
 	Phone           string     `gorm:"unique" json:"phone"`
 	Password        string     `json:"-"`
-	Role            string     `json:"role"` // CARRIER, SHIPPER, ADMIN
+	Role            string     `json:"role"` // CARRIER, SHIPPER, DRIVER, ADMIN
 	FirstName       string     `json:"first_name"`
 	LastName        string     `json:"last_name"`
 	CompanyName     string     `json:"company_name"`
@@ -36,27 +36,66 @@ type User struct {
 	State           string     `json:"state"`
 	Country         string     `json:"country"`
 	PostalCode      string     `json:"postal_code"`
-	Vehicles        []Vehicle  `json:"vehicles,omitempty" gorm:"foreignKey:UserID"`
+	// Verification of the account's documents by an admin
+	VerificationStatus string     `gorm:"default:PENDING" json:"verification_status"` // PENDING, APPROVED, REJECTED
+	VerificationNote   string     `json:"verification_note,omitempty"`
+	VerifiedAt         *time.Time `json:"verified_at,omitempty"`
+	VerifiedBy         *uint      `json:"verified_by,omitempty"`
+	// Suspended accounts can't sign in or use the API
+	SuspendedAt      *time.Time `json:"suspended_at,omitempty"`
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
+	Vehicles         []Vehicle  `json:"vehicles,omitempty" gorm:"foreignKey:UserID"`
+	// Set when the phone number is confirmed with an SMS code; SMS
+	// notifications are only sent to verified numbers
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at,omitempty"`
+	// System of measurement of responses and notifications: metric or
+	// imperial
+	UnitSystem string `gorm:"default:metric" json:"unit_system"`
+	// Language notifications are written in: en, es or fr
+	Language string `gorm:"default:en" json:"language"`
+}
+
+// Organization is a carrier or shipper company whose members share its
+// trips and loads
+type Organization struct {
+	BaseModel
+	Name    string                   `json:"name"`
+	Type    string                   `json:"type"` // CARRIER, SHIPPER
+	OwnerID uint                     `json:"owner_id" gorm:"index"`
+	Members []OrganizationMembership `json:"members,omitempty" gorm:"foreignKey:OrganizationID"`
+}
+
+// OrganizationMembership makes a user a member of an organization with a role
+type OrganizationMembership struct {
+	BaseModel
+	OrganizationID uint   `json:"organization_id" gorm:"uniqueIndex:idx_organization_memberships_member"`
+	UserID         uint   `json:"user_id" gorm:"uniqueIndex:idx_organization_memberships_member;index"`
+	Role           string `json:"role"` // OWNER, DISPATCHER, DRIVER, FINANCE
+	User           *User  `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
 
 type Trip struct {
 	BaseModel
 	UserID              uint       `json:"user_id"`
+	OrganizationID      *uint      `json:"organization_id,omitempty" gorm:"index"`
 	VehicleID           uint       `json:"vehicle_id"`
 	OriginAddress       string     `json:"origin_address"`
 	OriginCity          string     `json:"origin_city"`
 	OriginState         string     `json:"origin_state"`
 	OriginCountry       string     `json:"origin_country"`
-	OriginLat           float64    `json:"origin_lat"`
-	OriginLng           float64    `json:"origin_lng"`
+	OriginLat           float64    `gorm:"index:idx_trips_origin_location" json:"origin_lat"`
+	OriginLng           float64    `gorm:"index:idx_trips_origin_location" json:"origin_lng"`
 	DestinationAddress  string     `json:"destination_address"`
 	DestinationCity     string     `json:"destination_city"`
 	DestinationState    string     `json:"destination_state"`
 	DestinationCountry  string     `json:"destination_country"`
-	DestinationLat      float64    `json:"destination_lat"`
-	DestinationLng      float64    `json:"destination_lng"`
-	DepartureDate       time.Time  `json:"departure_date"`
+	DestinationLat      float64    `gorm:"index:idx_trips_destination_location" json:"destination_lat"`
+	DestinationLng      float64    `gorm:"index:idx_trips_destination_location" json:"destination_lng"`
+	OriginTimezone      string     `json:"origin_timezone"`      // IANA name found from the coordinates
+	DestinationTimezone string     `json:"destination_timezone"` // times are stored in UTC and shown in these
+	DepartureDate       time.Time  `gorm:"index" json:"departure_date"`
 	EstimatedArrival    time.Time  `json:"estimated_arrival"`
+	ScheduledArrival    *time.Time `json:"scheduled_arrival"` // as planned, while EstimatedArrival follows the live ETA
 	ActualDeparture     *time.Time `json:"actual_departure"`
 	ActualArrival       *time.Time `json:"actual_arrival"`
 	TotalCapacityWeight float64    `json:"total_capacity_weight"`
@@ -69,23 +108,45 @@ type Trip struct {
 	Status              string     `json:"status"` // PLANNED, ACTIVE, IN_TRANSIT, COMPLETED, CANCELLED
 	Notes               string     `json:"notes"`
 	IsPublic            bool       `gorm:"default:true" json:"is_public"`
+	Version             uint       `gorm:"not null;default:1" json:"version"` // incremented by each status change
 	// Tracking fields
 	CurrentLatitude    *float64   `json:"current_latitude"`
 	CurrentLongitude   *float64   `json:"current_longitude"`
 	LastLocationUpdate *time.Time `json:"last_location_update"`
 	TrackingEnabled    bool       `gorm:"default:true" json:"tracking_enabled"`
+	TrackingPausedAt   *time.Time `json:"tracking_paused_at,omitempty"`
+	// Location tracking consent given by the carrier, and its withdrawal
+	TrackingConsentAt          *time.Time `json:"tracking_consent_at,omitempty"`
+	TrackingConsentUserID      *uint      `json:"tracking_consent_user_id,omitempty"`
+	TrackingConsentWithdrawnAt *time.Time `json:"tracking_consent_withdrawn_at,omitempty"`
+	// When the trip's tracking records were moved to the archive table
+	TrackingArchivedAt *time.Time `json:"tracking_archived_at,omitempty"`
+	// Planned route (Google encoded polyline)
+	PlannedRoutePolyline  string     `gorm:"type:text" json:"planned_route_polyline,omitempty"`
+	PlannedRouteSource    string     `json:"planned_route_source,omitempty"` // GOOGLE_MAPS, HERE, MANUAL
+	PlannedRouteUpdatedAt *time.Time `json:"planned_route_updated_at,omitempty"`
+	// Expected tolls of the planned route, and the route they were
+	// calculated for
+	TollCost          float64    `json:"toll_cost"`
+	TollCurrency      string     `json:"toll_currency,omitempty"`
+	TollRoutePolyline string     `gorm:"type:text" json:"-"`
+	TollsCalculatedAt *time.Time `json:"tolls_calculated_at,omitempty"`
+	// Template the trip was created from, for recurring trips
+	TemplateID *uint `json:"template_id,omitempty" gorm:"index"`
 	// Relationships
 	Loads           []Load           `json:"loads,omitempty" gorm:"foreignKey:TripID"`
 	Manifest        *Manifest        `json:"manifest,omitempty" gorm:"foreignKey:TripID"`
 	TrackingRecords []TrackingRecord `json:"tracking_records,omitempty" gorm:"foreignKey:TripID"`
 	TrackingStatus  *TrackingStatus  `json:"tracking_status,omitempty" gorm:"foreignKey:TripID"`
 	TrackingEvents  []TrackingEvent  `json:"tracking_events,omitempty" gorm:"foreignKey:TripID"`
+	Stops           []TripStop       `json:"stops,omitempty" gorm:"foreignKey:TripID"`
 }
 
 type Load struct {
 	BaseModel
 	TripID                uint              `json:"trip_id"`
 	ShipperID             uint              `json:"shipper_id"`
+	OrganizationID        *uint             `json:"organization_id,omitempty" gorm:"index"`
 	BookingReference      string            `gorm:"unique" json:"booking_reference"`
 	Description           string            `json:"description"`
 	Category              string            `json:"category"` // ELECTRONICS, MACHINERY, FOOD, TEXTILES, etc.
@@ -122,21 +183,191 @@ type Load struct {
 	InsuranceValue        float64           `json:"insurance_value"`
 	AgreedPrice           float64           `json:"agreed_price"`
 	Status                string            `json:"status"` // QUOTE_REQUESTED, QUOTED, BOOKED, PICKED_UP, IN_TRANSIT, DELIVERED, CANCELLED
+	Version               uint              `gorm:"not null;default:1" json:"version"`
 	PickupProof           string            `json:"pickup_proof"`
 	DeliveryProof         string            `json:"delivery_proof"`
 	CustomsDocuments      []CustomsDocument `json:"customs_documents,omitempty" gorm:"foreignKey:LoadID"`
+	Proofs                []LoadProof       `json:"proofs,omitempty" gorm:"foreignKey:LoadID"`
 	Quotes                []Quote           `json:"quotes,omitempty" gorm:"foreignKey:LoadID"`
+	// Set once the carrier has been reminded of the pickup
+	PickupReminderSentAt *time.Time `json:"pickup_reminder_sent_at,omitempty"`
 	// Tracking relationships
 	TrackingRecords []TrackingRecord `json:"tracking_records,omitempty" gorm:"foreignKey:LoadID"`
 	TrackingStatus  *TrackingStatus  `json:"tracking_status,omitempty" gorm:"foreignKey:LoadID"`
 	TrackingEvents  []TrackingEvent  `json:"tracking_events,omitempty" gorm:"foreignKey:LoadID"`
 }
 
+// TripTemplate is a lane a carrier runs regularly. Trips are created from the
+// template ahead of time on the dates of its recurrence rule.
+type TripTemplate struct {
+	BaseModel
+	UserID             uint    `json:"user_id" gorm:"index"`
+	Name               string  `json:"name"`
+	VehicleID          uint    `json:"vehicle_id"`
+	OriginAddress      string  `json:"origin_address"`
+	OriginCity         string  `json:"origin_city"`
+	OriginState        string  `json:"origin_state"`
+	OriginCountry      string  `json:"origin_country"`
+	OriginLat          float64 `json:"origin_lat"`
+	OriginLng          float64 `json:"origin_lng"`
+	DestinationAddress string  `json:"destination_address"`
+	DestinationCity    string  `json:"destination_city"`
+	DestinationState   string  `json:"destination_state"`
+	DestinationCountry string  `json:"destination_country"`
+	DestinationLat     float64 `json:"destination_lat"`
+	DestinationLng     float64 `json:"destination_lng"`
+	// Capacity and pricing copied to each trip
+	TotalCapacityWeight float64 `json:"total_capacity_weight"`
+	TotalCapacityVolume float64 `json:"total_capacity_volume"`
+	BasePrice           float64 `json:"base_price"`
+	PricePerKg          float64 `json:"price_per_kg"`
+	PricePerCubicMeter  float64 `json:"price_per_cubic_meter"`
+	Notes               string  `json:"notes"`
+	IsPublic            bool    `json:"is_public"`
+	// Schedule: departures at DepartureTime (HH:MM in Timezone) on the dates
+	// of the recurrence rule, counted from StartDate
+	RecurrenceRule  string    `json:"recurrence_rule"` // e.g. FREQ=WEEKLY;BYDAY=MO,TH
+	StartDate       time.Time `json:"start_date"`
+	DepartureTime   string    `json:"departure_time"`
+	Timezone        string    `json:"timezone" gorm:"default:'UTC'"`
+	DurationMinutes int       `json:"duration_minutes"` // estimated arrival after departure
+	// Trips are created this many days before they depart
+	GenerateAheadDays int        `json:"generate_ahead_days" gorm:"default:14"`
+	Active            bool       `json:"active"`
+	LastGeneratedAt   *time.Time `json:"last_generated_at"`
+}
+
+// TripAssignment assigns a driver to a trip for a period. A trip can have
+// several drivers, e.g. a team or a relief driver taking over mid-trip.
+type TripAssignment struct {
+	BaseModel
+	TripID     uint       `json:"trip_id" gorm:"index"`
+	DriverID   uint       `json:"driver_id" gorm:"index"`
+	AssignedBy uint       `json:"assigned_by"`
+	StartsAt   time.Time  `json:"starts_at"`
+	EndsAt     *time.Time `json:"ends_at,omitempty"` // open-ended when nil
+	Notes      string     `json:"notes,omitempty"`
+	Driver     *User      `gorm:"foreignKey:DriverID" json:"driver,omitempty"`
+}
+
+// DriverAvailability is a shift a driver declared they can drive in, or
+// planned time off. Drivers who declare shifts can only be assigned trips
+// starting in one; time off blocks assignments altogether.
+type DriverAvailability struct {
+	BaseModel
+	DriverID uint      `json:"driver_id" gorm:"index"`
+	Kind     string    `json:"kind"` // SHIFT, TIME_OFF
+	StartsAt time.Time `json:"starts_at" gorm:"index"`
+	EndsAt   time.Time `json:"ends_at"`
+	Notes    string    `json:"notes,omitempty"`
+}
+
+// SavedLocation is an address in a user's address book, such as a
+// warehouse that loads are regularly picked up from
+type SavedLocation struct {
+	BaseModel
+	UserID       uint    `json:"user_id" gorm:"index"`
+	Name         string  `json:"name"`
+	Address      string  `json:"address"`
+	City         string  `json:"city"`
+	State        string  `json:"state"`
+	Country      string  `json:"country"`
+	PostalCode   string  `json:"postal_code"`
+	Lat          float64 `json:"lat"`
+	Lng          float64 `json:"lng"`
+	ContactName  string  `json:"contact_name"`
+	ContactPhone string  `json:"contact_phone"`
+	Notes        string  `json:"notes"`
+	// Used when a load or trip is created without a pickup or delivery
+	// address. A user has at most one default of each.
+	IsDefaultPickup   bool `json:"is_default_pickup"`
+	IsDefaultDelivery bool `json:"is_default_delivery"`
+}
+
+// GeocodedAddress caches the geocoding of an address, keyed by its
+// normalized form so that differences in case and spacing share an entry
+type GeocodedAddress struct {
+	BaseModel
+	AddressKey string  `json:"address_key" gorm:"uniqueIndex"`
+	Address    string  `json:"address"`
+	Found      bool    `json:"found"` // false when the provider had no result
+	Lat        float64 `json:"lat"`
+	Lng        float64 `json:"lng"`
+	// Provider result as JSON, with the formatted address and components
+	Result    string    `json:"-" gorm:"type:text"`
+	Hits      int       `json:"hits"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+}
+
+// SavedFilter is a named set of filters a user applies to the trips or
+// loads of their tracking view. Dates are either fixed or relative to the
+// day the filter is applied.
+type SavedFilter struct {
+	BaseModel
+	UserID          uint       `json:"user_id" gorm:"index"`
+	Name            string     `json:"name"`
+	View            string     `json:"view"`     // TRIPS, LOADS
+	Statuses        string     `json:"statuses"` // comma separated, e.g. PLANNED,IN_TRANSIT
+	OriginCity      string     `json:"origin_city,omitempty"`
+	DestinationCity string     `json:"destination_city,omitempty"`
+	DateFrom        *time.Time `json:"date_from,omitempty"`
+	DateTo          *time.Time `json:"date_to,omitempty"`
+	DaysBack        *int       `json:"days_back,omitempty"`
+	DaysAhead       *int       `json:"days_ahead,omitempty"`
+	// Restored when the user opens the view. A user has at most one default
+	// filter per view.
+	IsDefault bool `json:"is_default"`
+}
+
+// Dashboard is a layout of widgets a user arranges their workspace in
+type Dashboard struct {
+	BaseModel
+	UserID    uint              `json:"user_id" gorm:"index"`
+	Name      string            `json:"name"`
+	IsDefault bool              `json:"is_default"` // a user has at most one default dashboard
+	Widgets   []DashboardWidget `json:"widgets" gorm:"foreignKey:DashboardID"`
+}
+
+// DashboardWidget is a widget placed on a dashboard's grid
+type DashboardWidget struct {
+	BaseModel
+	DashboardID uint   `json:"dashboard_id" gorm:"index"`
+	Type        string `json:"type"` // TRIP_LIST, LOAD_LIST, MAP, KPI, ALERTS
+	Title       string `json:"title,omitempty"`
+	// Saved filter of the trips or loads the widget shows
+	FilterID *uint `json:"filter_id,omitempty"`
+	// Grid cell of the widget's top left corner and its size in cells
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
 type Message struct {
 	BaseModel
-	SenderID   uint   `json:"sender_id"`
-	ReceiverID uint   `json:"receiver_id"`
-	Content    string `json:"content"`
+	ConversationID *uint  `json:"conversation_id,omitempty" gorm:"index"`
+	SenderID       uint   `json:"sender_id"`
+	ReceiverID     uint   `json:"receiver_id"` // 0 for group conversations
+	Content        string `json:"content"`
+}
+
+// Conversation groups messages between users, optionally about a load or trip
+type Conversation struct {
+	BaseModel
+	LoadID        *uint                     `json:"load_id,omitempty" gorm:"index"`
+	TripID        *uint                     `json:"trip_id,omitempty" gorm:"index"`
+	Subject       string                    `json:"subject"`
+	CreatedBy     uint                      `json:"created_by"`
+	LastMessageAt *time.Time                `json:"last_message_at"`
+	Participants  []ConversationParticipant `json:"participants,omitempty" gorm:"foreignKey:ConversationID"`
+}
+
+// ConversationParticipant is a member of a conversation and how far they have read it
+type ConversationParticipant struct {
+	BaseModel
+	ConversationID    uint `json:"conversation_id" gorm:"uniqueIndex:idx_conversation_participant"`
+	UserID            uint `json:"user_id" gorm:"uniqueIndex:idx_conversation_participant;index"`
+	LastReadMessageID uint `json:"last_read_message_id"`
 }
 
 type Vehicle struct {
@@ -163,6 +394,36 @@ type Vehicle struct {
 	InspectionExpiry   *time.Time `json:"inspection_expiry"`
 	IsActive           bool       `gorm:"default:true" json:"is_active"`
 	Images             []string   `gorm:"type:text[]" json:"images"`
+	// Kilometers driven on the vehicle's trips, from their tracking data
+	TrackedKm float64 `json:"tracked_km"`
+	// Odometer reading less TrackedKm when the odometer was last read, so
+	// that the odometer is TrackedKm plus this
+	OdometerOffsetKm float64 `json:"-"`
+}
+
+// VehicleComplianceReminder records an expiry reminder sent for a vehicle
+// document, so each reminder stage is only sent once per expiry date
+type VehicleComplianceReminder struct {
+	BaseModel
+	VehicleID    uint      `json:"vehicle_id" gorm:"index"`
+	DocumentType string    `json:"document_type"` // INSURANCE, REGISTRATION, INSPECTION
+	ExpiryDate   time.Time `json:"expiry_date"`
+	DaysBefore   int       `json:"days_before"` // reminder stage, e.g. 30, 14 or 3 days before expiry
+	SentAt       time.Time `json:"sent_at"`
+}
+
+// VehicleServiceInterval is a service a vehicle is due every so many
+// kilometers, such as an oil change
+type VehicleServiceInterval struct {
+	BaseModel
+	VehicleID   uint    `json:"vehicle_id" gorm:"uniqueIndex:idx_vehicle_service"`
+	ServiceType string  `json:"service_type" gorm:"uniqueIndex:idx_vehicle_service"` // OIL, TIRES, INSPECTION
+	IntervalKm  float64 `json:"interval_km"`
+	// Odometer reading at the last service
+	LastServiceKm float64    `json:"last_service_km"`
+	LastServiceAt *time.Time `json:"last_service_at,omitempty"`
+	// Most urgent status the carrier was notified of since the last service
+	NotifiedStatus string `json:"-"`
 }
 
 type Manifest struct {
@@ -176,18 +437,115 @@ type Manifest struct {
 	OriginCountry      string    `json:"origin_country"`
 	DestinationCountry string    `json:"destination_country"`
 	DocumentURL        string    `json:"document_url"`
+	DocumentKey        string    `json:"-"` // storage key of the generated PDF
 	GeneratedAt        time.Time `json:"generated_at"`
 }
 
 type CustomsDocument struct {
 	BaseModel
 	LoadID           uint       `json:"load_id"`
-	DocumentType     string     `json:"document_type"` // COMMERCIAL_INVOICE, PACKING_LIST, BOL, CUSTOMS_DECLARATION, CERTIFICATE_OF_ORIGIN
+	DocumentType     string     `json:"document_type"` // COMMERCIAL_INVOICE, PACKING_LIST, BOL, CUSTOMS_DECLARATION, CERTIFICATE_OF_ORIGIN, DANGEROUS_GOODS_DECLARATION, PHYTOSANITARY_CERTIFICATE
 	DocumentNumber   string     `json:"document_number"`
 	DocumentURL      string     `json:"document_url"`
 	IssuedDate       time.Time  `json:"issued_date"`
 	ExpiryDate       *time.Time `json:"expiry_date"`
 	IssuingAuthority string     `json:"issuing_authority"`
+	// Set when the shipper has been alerted that the document is about to expire
+	ExpiryAlertSentAt *time.Time `json:"expiry_alert_sent_at,omitempty"`
+}
+
+// ApiKey authenticates a carrier's server-to-server integration, e.g. a
+// telematics provider pushing locations. Only a hash of the key is stored.
+type ApiKey struct {
+	BaseModel
+	UserID      uint       `gorm:"index" json:"user_id"` // carrier the key acts for
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"` // start of the key, to tell keys apart
+	KeyHash     string     `gorm:"uniqueIndex" json:"-"`
+	Scopes      string     `json:"scopes"`   // comma separated, e.g. tracking:write
+	TripIDs     string     `json:"trip_ids"` // comma separated trips the key is limited to, empty for all the carrier's trips
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	RotatedToID *uint      `json:"rotated_to_id,omitempty"` // key issued when this one was rotated
+}
+
+// TelematicsConnection links a carrier's account at a telematics provider,
+// whose vehicle positions are ingested into the trips of the matching vehicles
+type TelematicsConnection struct {
+	BaseModel
+	UserID        uint       `gorm:"index" json:"user_id"`
+	Provider      string     `json:"provider"` // SAMSARA, GEOTAB
+	Name          string     `json:"name"`
+	AccountID     string     `json:"account_id,omitempty"` // Geotab database
+	Username      string     `json:"username,omitempty"`   // Geotab user
+	Secret        string     `json:"-"`                    // Samsara API token or Geotab password
+	WebhookSecret string     `json:"-"`
+	IsActive      bool       `gorm:"default:true" json:"is_active"`
+	Cursor        string     `json:"-"` // position in the provider's feed to poll from
+	LastPolledAt  *time.Time `json:"last_polled_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// TelematicsDevice is a device or gateway streaming a carrier's vehicle
+// positions over gRPC. It authenticates with a client certificate issued by
+// the configured CA with the device's common name.
+type TelematicsDevice struct {
+	BaseModel
+	UserID     uint       `gorm:"index" json:"user_id"`
+	Name       string     `json:"name"`
+	CommonName string     `gorm:"uniqueIndex" json:"common_name"`
+	IsActive   bool       `gorm:"default:true" json:"is_active"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// TrackerDevice is a carrier's hardware GPS tracker, identified by the ID it
+// reports positions under, usually its IMEI. Positions are recorded in the
+// trip the tracker is pinned to, or else in the active trip of the vehicle
+// it is installed in.
+type TrackerDevice struct {
+	BaseModel
+	UserID     uint       `gorm:"index" json:"user_id"`
+	DeviceID   string     `gorm:"uniqueIndex" json:"device_id"`
+	Name       string     `json:"name"`
+	VehicleID  *uint      `gorm:"index" json:"vehicle_id,omitempty"`
+	TripID     *uint      `gorm:"index" json:"trip_id,omitempty"`
+	IsActive   bool       `gorm:"default:true" json:"is_active"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// Document is a file uploaded through the document service, owned by the
+// user who uploaded it and optionally attached to a load
+type Document struct {
+	BaseModel
+	OwnerID      uint       `gorm:"index" json:"owner_id"`
+	LoadID       *uint      `gorm:"index" json:"load_id,omitempty"`
+	DocumentType string     `json:"document_type"` // DRIVER_LICENSE, BUSINESS_LICENSE, INSURANCE, VEHICLE_REGISTRATION, CUSTOMS, PROOF_OF_DELIVERY, INVOICE, OTHER
+	FileName     string     `json:"file_name"`
+	ContentType  string     `json:"content_type"`
+	Size         int64      `json:"size"`
+	StorageKey   string     `json:"-"`
+	Status       string     `gorm:"default:PENDING_UPLOAD;index" json:"status"` // PENDING_UPLOAD, AVAILABLE, INFECTED
+	ScanResult   string     `json:"scan_result,omitempty"`
+	UploadedAt   *time.Time `json:"uploaded_at,omitempty"`
+	ScannedAt    *time.Time `json:"scanned_at,omitempty"`
+}
+
+// LoadProof is a proof of pickup or delivery photo or e-signature stored in file storage
+type LoadProof struct {
+	BaseModel
+	LoadID      uint      `json:"load_id"`
+	Stage       string    `json:"stage"` // PICKUP, DELIVERY
+	Kind        string    `json:"kind"`  // PHOTO, SIGNATURE
+	URL         string    `json:"url"`
+	StorageKey  string    `json:"-"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SignedBy    string    `json:"signed_by,omitempty"`
+	UploadedBy  uint      `json:"uploaded_by"`
+	Latitude    *float64  `json:"latitude"`
+	Longitude   *float64  `json:"longitude"`
+	CapturedAt  time.Time `json:"captured_at"`
 }
 
 type Quote struct {
@@ -200,8 +558,18 @@ type Quote struct {
 	PickupDate   time.Time  `json:"pickup_date"`
 	DeliveryDate time.Time  `json:"delivery_date"`
 	Notes        string     `json:"notes"`
-	Status       string     `json:"status"` // PENDING, ACCEPTED, REJECTED, EXPIRED
+	Status       string     `json:"status"` // PENDING, ACCEPTED, REJECTED, EXPIRED, COUNTERED
 	AcceptedAt   *time.Time `json:"accepted_at"`
+	// Trip the load is booked onto when the quote is accepted
+	TripID uint `json:"trip_id"`
+	// Counter-offers reference the quote they replace
+	ParentQuoteID *uint  `json:"parent_quote_id,omitempty"`
+	ProposedBy    string `gorm:"default:CARRIER" json:"proposed_by"` // CARRIER, SHIPPER
+	// Amount in the base currency at the exchange rate of when the quote was
+	// made. Empty when no rate was available.
+	BaseAmount   float64 `json:"base_amount"`
+	BaseCurrency string  `json:"base_currency"`
+	ExchangeRate float64 `json:"exchange_rate"`
 }
 
 type Review struct {
@@ -214,6 +582,33 @@ type Review struct {
 	ReviewType string `json:"review_type"` // CARRIER_TO_SHIPPER, SHIPPER_TO_CARRIER
 }
 
+// Feedback is a shipper's survey of a delivered load. Its comment is analyzed
+// for sentiment and topic in the background after it is submitted.
+type Feedback struct {
+	BaseModel
+	LoadID    uint `gorm:"uniqueIndex" json:"load_id"`
+	TripID    uint `gorm:"index" json:"trip_id"`
+	ShipperID uint `gorm:"index" json:"shipper_id"`
+	CarrierID uint `gorm:"index" json:"carrier_id"`
+	Rating    int  `json:"rating"` // 1-5 stars
+	// 0-10, how likely the shipper is to recommend the carrier
+	RecommendScore *int   `json:"recommend_score,omitempty"`
+	Comment        string `gorm:"type:text" json:"comment"`
+
+	AnalysisStatus      string     `gorm:"index" json:"analysis_status"` // PENDING, ANALYZED, SKIPPED, FAILED
+	AnalysisAttempts    int        `json:"-"`
+	Sentiment           string     `json:"sentiment,omitempty"` // POSITIVE, NEUTRAL, NEGATIVE
+	SentimentConfidence float64    `json:"sentiment_confidence,omitempty"`
+	Category            string     `json:"category,omitempty"`
+	CategoryConfidence  float64    `json:"category_confidence,omitempty"`
+	AnalyzedAt          *time.Time `json:"analyzed_at,omitempty"`
+
+	// Set when the carrier follows up on the feedback
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy     *uint      `json:"resolved_by,omitempty"`
+	ResolutionNote string     `json:"resolution_note,omitempty"`
+}
+
 type Notification struct {
 	BaseModel
 	UserID    uint   `json:"user_id"`
@@ -222,6 +617,16 @@ type Notification struct {
 	Type      string `json:"type"` // QUOTE_RECEIVED, LOAD_BOOKED, PICKUP_SCHEDULED, etc.
 	IsRead    bool   `gorm:"default:false" json:"is_read"`
 	RelatedID uint   `json:"related_id"` // ID of related load, trip, etc.
+	// Catalog key and values the title and message were rendered from, in
+	// the language of the user
+	MessageKey    string                 `json:"message_key,omitempty"`
+	MessageParams map[string]interface{} `gorm:"serializer:json" json:"message_params,omitempty"`
+	// Number of notifications of the same type about the same entity
+	// collapsed into this one, which shows the latest of them
+	GroupCount int `gorm:"not null;default:1" json:"group_count"`
+	// Set when the user archives the notification, which hides it from the
+	// inbox and its unread counts
+	ArchivedAt *time.Time `gorm:"index" json:"archived_at,omitempty"`
 	// Delivery tracking
 	Deliveries []NotificationDelivery `json:"deliveries,omitempty" gorm:"foreignKey:NotificationID"`
 }
@@ -246,6 +651,18 @@ type NotificationDelivery struct {
 	Error          string    `json:"error,omitempty"`
 }
 
+// NotificationDeadLetter is a queued notification delivery that failed all
+// its attempts, kept for admins to inspect and retry
+type NotificationDeadLetter struct {
+	BaseModel
+	NotificationID uint       `gorm:"index" json:"notification_id"`
+	UserID         uint       `gorm:"index" json:"user_id"`
+	Channel        string     `json:"channel"` // PUSH, EMAIL, SMS
+	Attempts       int        `json:"attempts"`
+	LastError      string     `json:"last_error"`
+	RetriedAt      *time.Time `json:"retried_at,omitempty"`
+}
+
 // NotificationPreferences stores user preferences for notifications
 type NotificationPreferences struct {
 	BaseModel
@@ -256,8 +673,45 @@ type NotificationPreferences struct {
 	ETAUpdates      bool `json:"eta_updates" gorm:"default:true"`
 	LoadStatus      bool `json:"load_status" gorm:"default:true"`
 	LocationUpdates bool `json:"location_updates" gorm:"default:false"`
+	QuoteUpdates    bool `json:"quote_updates" gorm:"default:true"`
 	EmailEnabled    bool `json:"email_enabled" gorm:"default:true"`
 	PushEnabled     bool `json:"push_enabled" gorm:"default:true"`
+	// SMS is opt-in, and covers delay alerts and pickup reminders only
+	SMSEnabled         bool `json:"sms_enabled" gorm:"default:false"`
+	SMSDelays          bool `json:"sms_delays" gorm:"default:true"`
+	SMSPickupReminders bool `json:"sms_pickup_reminders" gorm:"default:true"`
+	// Quiet hours (local time in Timezone, HH:MM)
+	QuietHoursEnabled bool   `json:"quiet_hours_enabled" gorm:"default:false"`
+	QuietHoursStart   string `json:"quiet_hours_start" gorm:"default:'22:00'"`
+	QuietHoursEnd     string `json:"quiet_hours_end" gorm:"default:'07:00'"`
+	Timezone          string `json:"timezone" gorm:"default:'UTC'"`
+	// Digest delivery
+	DigestMode       string     `json:"digest_mode" gorm:"default:'NONE'"` // NONE, HOURLY, DAILY
+	DigestHour       int        `json:"digest_hour" gorm:"default:8"`      // local hour for daily digests
+	LastDigestSentAt *time.Time `json:"last_digest_sent_at"`
+}
+
+// PhoneVerification is a code sent by SMS to confirm a user's phone number
+type PhoneVerification struct {
+	BaseModel
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Phone      string     `json:"phone"`
+	CodeHash   string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Attempts   int        `json:"attempts"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+}
+
+// NotificationDigestEntry is a notification held back for quiet hours or
+// digest mode, waiting to be delivered as part of a digest
+type NotificationDigestEntry struct {
+	BaseModel
+	UserID         uint         `json:"user_id" gorm:"index"`
+	NotificationID uint         `json:"notification_id"`
+	Reason         string       `json:"reason"` // QUIET_HOURS, DIGEST
+	QueuedAt       time.Time    `json:"queued_at"`
+	DeliveredAt    *time.Time   `json:"delivered_at"`
+	Notification   Notification `json:"notification,omitempty" gorm:"foreignKey:NotificationID"`
 }
 
 type Transaction struct {
@@ -274,6 +728,49 @@ type Transaction struct {
 	Status         string     `json:"status"` // PENDING, COMPLETED, FAILED, REFUNDED
 	ProcessedAt    *time.Time `json:"processed_at"`
 	FailureReason  string     `json:"failure_reason"`
+	RefundedAmount float64    `gorm:"default:0" json:"refunded_amount"`
+	RefundedAt     *time.Time `json:"refunded_at"`
+	// Amount in the base currency at the exchange rate of when the payment
+	// was made. Empty when no rate was available.
+	BaseAmount   float64 `json:"base_amount"`
+	BaseCurrency string  `json:"base_currency"`
+	ExchangeRate float64 `json:"exchange_rate"`
+}
+
+// Invoice bills the shipper of a delivered load for the agreed price and
+// any surcharges. Payments of the load are reconciled against it.
+type Invoice struct {
+	BaseModel
+	InvoiceNumber  string            `gorm:"unique" json:"invoice_number"`
+	LoadID         uint              `gorm:"index" json:"load_id"`
+	ShipperID      uint              `gorm:"index" json:"shipper_id"`
+	CarrierID      uint              `gorm:"index" json:"carrier_id"`
+	TransactionID  *uint             `gorm:"index" json:"transaction_id,omitempty"`
+	Currency       string            `gorm:"default:USD" json:"currency"`
+	Subtotal       float64           `json:"subtotal"` // agreed price
+	SurchargeTotal float64           `json:"surcharge_total"`
+	Total          float64           `json:"total"`
+	PlatformFee    float64           `json:"platform_fee"` // included in the total, kept by the platform
+	AmountPaid     float64           `json:"amount_paid"`
+	Status         string            `gorm:"index" json:"status"` // ISSUED, PAID, VOID
+	IssuedAt       time.Time         `json:"issued_at"`
+	DueDate        time.Time         `json:"due_date"`
+	PaidAt         *time.Time        `json:"paid_at,omitempty"`
+	VoidedAt       *time.Time        `json:"voided_at,omitempty"`
+	VoidReason     string            `json:"void_reason,omitempty"`
+	Notes          string            `json:"notes"`
+	DocumentURL    string            `json:"document_url"`
+	DocumentKey    string            `json:"-"` // storage key of the rendered PDF
+	LineItems      []InvoiceLineItem `json:"line_items,omitempty" gorm:"foreignKey:InvoiceID"`
+}
+
+// InvoiceLineItem is a charge on an invoice
+type InvoiceLineItem struct {
+	BaseModel
+	InvoiceID   uint    `gorm:"index" json:"invoice_id"`
+	Type        string  `json:"type"` // FREIGHT, TOLL, DETENTION, OTHER
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
 }
 
 // Tracking Models
@@ -291,6 +788,58 @@ type TrackingRecord struct {
 	Timestamp time.Time `json:"timestamp"`
 	Source    string    `json:"source"` // GPS, MANUAL, ESTIMATED
 	Status    string    `json:"status"` // ACTIVE, INACTIVE
+	// Position snapped to the road network, when map matching is enabled
+	// and the point could be matched
+	MatchedLatitude  *float64 `json:"matched_latitude,omitempty"`
+	MatchedLongitude *float64 `json:"matched_longitude,omitempty"`
+	MatchConfidence  *float64 `json:"match_confidence,omitempty"` // 0-1 scale
+	// Position smoothed with the trip's earlier positions, weighted by
+	// accuracy, and the estimated error of the smoothed position in meters
+	SmoothedLatitude  *float64 `json:"smoothed_latitude,omitempty"`
+	SmoothedLongitude *float64 `json:"smoothed_longitude,omitempty"`
+	SmoothedAccuracy  *float64 `json:"smoothed_accuracy,omitempty"`
+	// Battery level of the reporting device, in percent
+	BatteryLevel *float64 `json:"battery_level,omitempty"`
+	// Assigned driver who posted the update
+	DriverID *uint `json:"driver_id,omitempty" gorm:"index"`
+	// Posted speed limit at the position in km/h, when the device reports it
+	SpeedLimit *float64 `json:"speed_limit,omitempty"`
+}
+
+// TrackingAggregate summarizes a trip's tracking records over a fixed
+// interval, so the history of long trips can be served at a coarser
+// resolution. Aggregates are recomputed when records of their bucket arrive.
+type TrackingAggregate struct {
+	BaseModel
+	TripID      uint      `gorm:"uniqueIndex:idx_tracking_aggregate_bucket" json:"trip_id"`
+	Resolution  string    `gorm:"uniqueIndex:idx_tracking_aggregate_bucket" json:"resolution"` // 5m, 1h
+	BucketStart time.Time `gorm:"uniqueIndex:idx_tracking_aggregate_bucket" json:"bucket_start"`
+	// Last position in the bucket, snapped to the road when it was matched
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// Of the speeds reported in the bucket, in km/h
+	AvgSpeed *float64 `json:"avg_speed,omitempty"`
+	MaxSpeed *float64 `json:"max_speed,omitempty"`
+	// Driven to the positions in the bucket, from the one before each
+	DistanceKm     float64   `json:"distance_km"`
+	PointCount     int       `json:"point_count"`
+	FirstTimestamp time.Time `json:"first_timestamp"`
+	LastTimestamp  time.Time `json:"last_timestamp"`
+	// When the rollup computing the aggregate started; records created
+	// later are rolled up by the next run
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// ArchivedTrackingRecord is a tracking record of a closed trip, moved out of
+// tracking_records by the archival job to keep that table small
+type ArchivedTrackingRecord struct {
+	TrackingRecord
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// TableName places archived records in their own table
+func (ArchivedTrackingRecord) TableName() string {
+	return "tracking_records_archive"
 }
 
 type TrackingStatus struct {
@@ -304,14 +853,29 @@ type TrackingStatus struct {
 	DelayMinutes      *int       `json:"delay_minutes"`
 	DelayReason       string     `json:"delay_reason"`
 	NextMilestone     string     `json:"next_milestone"`
-	CompletionPercent float64    `json:"completion_percent"`
+	CompletionPercent float64    `json:"completion_percent"` // Share of the route covered, or by status before the first location
+	ETASource         string     `json:"eta_source"`         // GOOGLE_MAPS, HERE, HAVERSINE, PLANNED
+	ETAConfidence     float64    `json:"eta_confidence"`     // 0-1 scale
+	ETAUpdatedAt      *time.Time `json:"eta_updated_at"`
+	// Of the tracking status of a load: when the vehicle is expected at the
+	// load's pickup, until it gets there, and at its delivery
+	PickupETA   *time.Time `json:"pickup_eta,omitempty"`
+	DeliveryETA *time.Time `json:"delivery_eta,omitempty"`
+	// Distance along the route to the last location, and the route's length
+	DistanceCoveredKm float64 `json:"distance_covered_km"`
+	RouteDistanceKm   float64 `json:"route_distance_km"`
+	// Worst weather forecast on the remaining route, and the time it adds to
+	// the rest of the trip as a fraction of the trip's duration without it
+	WeatherCondition string     `json:"weather_condition,omitempty"`
+	WeatherSlowdown  float64    `json:"weather_slowdown"`
+	WeatherCheckedAt *time.Time `json:"weather_checked_at,omitempty"`
 }
 
 type TrackingEvent struct {
 	BaseModel
 	TripID      uint      `json:"trip_id"`
 	LoadID      *uint     `json:"load_id,omitempty"`
-	EventType   string    `json:"event_type"` // DEPARTURE, ARRIVAL, DELAY, MILESTONE
+	EventType   string    `json:"event_type"` // DEPARTURE, ARRIVAL, DELAY, MILESTONE, WEATHER_ALERT
 	EventData   string    `json:"event_data"` // JSON data specific to event
 	Location    string    `json:"location"`
 	Latitude    *float64  `json:"latitude"`
@@ -319,3 +883,276 @@ type TrackingEvent struct {
 	Timestamp   time.Time `json:"timestamp"`
 	Description string    `json:"description"`
 }
+
+// OutboxEvent is a tracking event recorded in the same transaction as the
+// state change it describes, until the outbox dispatcher has published it.
+// Delivered lists the publishers that already have it, so retries after a
+// partial failure only go to the others.
+type OutboxEvent struct {
+	BaseModel
+	TripID        uint       `gorm:"index" json:"trip_id"`
+	LoadID        *uint      `json:"load_id,omitempty"`
+	EventType     string     `json:"event_type"`
+	Payload       string     `json:"payload"` // JSON of the event
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	ClaimedUntil  *time.Time `json:"claimed_until,omitempty"`
+	Delivered     string     `json:"delivered"` // comma separated publisher names
+	LastError     string     `json:"last_error,omitempty"`
+	PublishedAt   *time.Time `gorm:"index" json:"published_at,omitempty"`
+	FailedAt      *time.Time `json:"failed_at,omitempty"`
+}
+
+// ETAPrediction is an ETA calculated for a trip. Once the trip completes the
+// prediction is compared with the actual arrival to measure ETA accuracy.
+type ETAPrediction struct {
+	BaseModel
+	TripID           uint       `json:"trip_id" gorm:"index"`
+	Source           string     `json:"source"` // GOOGLE_MAPS, HERE, HAVERSINE, PLANNED
+	Confidence       float64    `json:"confidence"`
+	DistanceKm       float64    `json:"distance_km"`
+	PredictedAt      time.Time  `json:"predicted_at" gorm:"index"`
+	PredictedArrival time.Time  `json:"predicted_arrival"`
+	ActualArrival    *time.Time `json:"actual_arrival"`
+	ErrorMinutes     *float64   `json:"error_minutes"` // actual minus predicted arrival, positive when the trip arrived late
+}
+
+// TripStop is a stop of a trip itinerary: the trip origin and destination and
+// the pickup and delivery addresses of its loads, in the order they are visited
+type TripStop struct {
+	BaseModel
+	TripID           uint       `json:"trip_id" gorm:"index"`
+	LoadID           *uint      `json:"load_id,omitempty" gorm:"index"`
+	Sequence         int        `json:"sequence"`
+	StopType         string     `json:"stop_type"` // ORIGIN, PICKUP, DELIVERY, DESTINATION
+	Address          string     `json:"address"`
+	City             string     `json:"city"`
+	Country          string     `json:"country"`
+	Latitude         float64    `json:"latitude"`
+	Longitude        float64    `json:"longitude"`
+	Status           string     `json:"status" gorm:"default:PENDING"` // PENDING, ARRIVED, COMPLETED, SKIPPED
+	PlannedArrival   *time.Time `json:"planned_arrival"`
+	EstimatedArrival *time.Time `json:"estimated_arrival"`
+	ActualArrival    *time.Time `json:"actual_arrival"`
+	ActualDeparture  *time.Time `json:"actual_departure"`
+	// Time spent at the stop and the part of it beyond the free time, set on
+	// departure from pickup and delivery stops
+	DwellMinutes     int     `json:"dwell_minutes"`
+	DetentionMinutes int     `json:"detention_minutes"`
+	DetentionCharge  float64 `json:"detention_charge"`
+}
+
+// TripStatusSuggestion is a trip status change proposed from the trip's
+// tracking data, e.g. completion after the vehicle stopped at the
+// destination. The status only changes once the carrier confirms it.
+type TripStatusSuggestion struct {
+	BaseModel
+	TripID      uint       `json:"trip_id" gorm:"index"`
+	Status      string     `json:"status"` // the suggested status
+	Reason      string     `json:"reason"`
+	State       string     `json:"state" gorm:"default:PENDING"` // PENDING, CONFIRMED, DISMISSED
+	SuggestedAt time.Time  `json:"suggested_at"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy  *uint      `json:"resolved_by,omitempty"`
+}
+
+// StopCheckIn is a driver's check-in at or check-out of a trip stop, with
+// the position it was reported from
+type StopCheckIn struct {
+	BaseModel
+	TripID     uint      `json:"trip_id" gorm:"index"`
+	StopID     uint      `json:"stop_id" gorm:"index"`
+	LoadID     *uint     `json:"load_id,omitempty"`
+	DriverID   uint      `json:"driver_id"`
+	Action     string    `json:"action"` // ARRIVE, DEPART
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	Accuracy   *float64  `json:"accuracy,omitempty"` // meters
+	DistanceKm float64   `json:"distance_km"`        // from the stop
+	Notes      string    `json:"notes,omitempty"`
+	PhotoURL   string    `json:"photo_url,omitempty"`
+	PhotoKey   string    `json:"-"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// ReportSubscription emails an analytics report to a user on a schedule, e.g.
+// the weekly on-time delivery report every Monday at 08:00
+type ReportSubscription struct {
+	BaseModel
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Report     string     `json:"report"`       // on-time-delivery, delay-incidents, capacity-utilization
+	Format     string     `json:"format"`       // CSV, PDF
+	Frequency  string     `json:"frequency"`    // DAILY, WEEKLY, MONTHLY
+	DayOfWeek  int        `json:"day_of_week"`  // weekly reports, 0 is Sunday
+	DayOfMonth int        `json:"day_of_month"` // monthly reports, 1-28
+	Hour       int        `json:"hour"`         // local hour in Timezone
+	Timezone   string     `json:"timezone" gorm:"default:'UTC'"`
+	Recipients string     `json:"recipients"` // comma separated, empty sends to the user
+	Active     bool       `json:"active"`
+	NextRunAt  *time.Time `json:"next_run_at" gorm:"index"`
+	LastSentAt *time.Time `json:"last_sent_at"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+// OpsChannel is a Slack or Microsoft Teams incoming webhook an organization
+// gets operational alerts in
+type OpsChannel struct {
+	BaseModel
+	OrganizationID uint   `json:"organization_id" gorm:"index"`
+	Name           string `json:"name"`
+	Provider       string `json:"provider"` // SLACK, TEAMS
+	WebhookURL     string `json:"-"`
+	// Alert types posted to the channel, all of them when empty
+	EventTypes []string `json:"event_types" gorm:"serializer:json"`
+	// Message templates replacing the built-in ones, by alert type
+	Templates  map[string]string `json:"templates,omitempty" gorm:"serializer:json"`
+	Active     bool              `json:"active"`
+	LastSentAt *time.Time        `json:"last_sent_at"`
+	LastError  string            `json:"last_error,omitempty"`
+}
+
+// RetentionPolicy sets how long a type of data is kept. A policy without a
+// carrier is the default for carriers without a policy of their own.
+type RetentionPolicy struct {
+	BaseModel
+	CarrierID     *uint  `json:"carrier_id" gorm:"index"`
+	DataType      string `json:"data_type"` // TRACKING_RECORDS, TRACKING_EVENTS, CRITICAL_TRACKING_EVENTS, NOTIFICATIONS
+	RetentionDays int    `json:"retention_days"`
+	Archive       bool   `json:"archive"` // archive to storage before deleting
+}
+
+// RetentionRun is a run of the data retention cleanup
+type RetentionRun struct {
+	BaseModel
+	Trigger         string               `json:"trigger"` // SCHEDULED, MANUAL
+	TriggeredBy     *uint                `json:"triggered_by,omitempty"`
+	Status          string               `json:"status"` // RUNNING, COMPLETED, FAILED
+	StartedAt       time.Time            `json:"started_at"`
+	FinishedAt      *time.Time           `json:"finished_at"`
+	RecordsArchived int64                `json:"records_archived"`
+	RecordsDeleted  int64                `json:"records_deleted"`
+	Error           string               `json:"error,omitempty"`
+	Results         []RetentionRunResult `json:"results,omitempty" gorm:"foreignKey:RunID"`
+}
+
+// RetentionRunResult is the cleanup of one retention policy during a run
+type RetentionRunResult struct {
+	BaseModel
+	RunID           uint      `json:"run_id" gorm:"index"`
+	DataType        string    `json:"data_type"`
+	CarrierID       *uint     `json:"carrier_id"`
+	RetentionDays   int       `json:"retention_days"`
+	Cutoff          time.Time `json:"cutoff"`
+	RecordsArchived int64     `json:"records_archived"`
+	RecordsDeleted  int64     `json:"records_deleted"`
+	ArchivePrefix   string    `json:"archive_prefix,omitempty"` // storage key prefix of the archived batches
+	Error           string    `json:"error,omitempty"`
+}
+
+// AuditLog records a mutating API call: who made it, on which entity, and how
+// the status and capacity fields of the entity changed
+type AuditLog struct {
+	BaseModel
+	RequestID  string `json:"request_id" gorm:"index"` // shared by the logs of one request
+	ActorID    *uint  `json:"actor_id" gorm:"index"`
+	Method     string `json:"method"`
+	Endpoint   string `json:"endpoint"` // route pattern, e.g. /api/loads/:load_id/book
+	Path       string `json:"path"`
+	EntityType string `json:"entity_type" gorm:"index:idx_audit_logs_entity"`
+	EntityID   *uint  `json:"entity_id" gorm:"index:idx_audit_logs_entity"`
+	StatusCode int    `json:"status_code"`
+	IPAddress  string `json:"ip_address"`
+	Changes    string `json:"changes,omitempty" gorm:"type:text"` // JSON object of changed fields with their before and after values
+}
+
+// FeatureFlag gates a feature being rolled out. An enabled flag is on for the
+// users and organizations it targets, and for a stable share of other users.
+type FeatureFlag struct {
+	BaseModel
+	Key             string `json:"key" gorm:"uniqueIndex"`
+	Description     string `json:"description"`
+	Enabled         bool   `json:"enabled"`          // off for everyone when false
+	RolloutPercent  int    `json:"rollout_percent"`  // 0-100 of users, bucketed by a hash of the key and user
+	UserIDs         string `json:"user_ids"`         // comma separated users the flag is on for
+	OrganizationIDs string `json:"organization_ids"` // comma separated organizations the flag is on for
+	UpdatedBy       *uint  `json:"updated_by,omitempty"`
+}
+
+// TripEmission is the fuel a trip used and the CO2 it emitted, estimated from
+// the distance driven, the vehicle and the payload
+type TripEmission struct {
+	BaseModel
+	TripID      uint    `json:"trip_id" gorm:"uniqueIndex"`
+	VehicleType string  `json:"vehicle_type"`
+	Method      string  `json:"method"` // TELEMATICS from the tracked speed profile, PLANNED from the origin and destination
+	DistanceKm  float64 `json:"distance_km"`
+	PayloadKg   float64 `json:"payload_kg"`
+	FuelLitres  float64 `json:"fuel_litres"`
+	CO2Kg       float64 `json:"co2_kg"`
+	// When the trip arrived, or departed when it has no arrival, for the
+	// period it is reported in
+	TripDate     time.Time `json:"trip_date" gorm:"index"`
+	CalculatedAt time.Time `json:"calculated_at"`
+}
+
+// TripFuelPlan is where a trip is planned to refuel along its route, and how
+// much fuel it buys at each stop
+type TripFuelPlan struct {
+	BaseModel
+	TripID              uint           `json:"trip_id" gorm:"uniqueIndex"`
+	RouteDistanceKm     float64        `json:"route_distance_km"`
+	TankRangeKm         float64        `json:"tank_range_km"`  // on a full tank
+	StartRangeKm        float64        `json:"start_range_km"` // on the fuel in the tank at departure
+	ReserveKm           float64        `json:"reserve_km"`     // of range never planned to be used
+	ConsumptionPer100Km float64        `json:"consumption_per_100km"`
+	TotalLitres         float64        `json:"total_litres"`
+	TotalCost           float64        `json:"total_cost"`
+	DetourKm            float64        `json:"detour_km"` // driven off the route to reach the stations
+	PlannedAt           time.Time      `json:"planned_at"`
+	Stops               []TripFuelStop `json:"stops" gorm:"foreignKey:PlanID"`
+}
+
+// TripFuelStop is a station a fuel plan stops at
+type TripFuelStop struct {
+	BaseModel
+	PlanID        uint    `json:"plan_id" gorm:"index"`
+	Sequence      int     `json:"sequence"`
+	StationID     string  `json:"station_id"`
+	Name          string  `json:"name"`
+	Brand         string  `json:"brand"`
+	Address       string  `json:"address"`
+	Latitude      float64 `json:"latitude"`
+	Longitude     float64 `json:"longitude"`
+	RouteKm       float64 `json:"route_km"`  // along the route where it turns off to the station
+	DetourKm      float64 `json:"detour_km"` // there and back
+	PricePerLitre float64 `json:"price_per_litre"`
+	Litres        float64 `json:"litres"`
+	Cost          float64 `json:"cost"`
+}
+
+// DelayModel is a trained delay prediction model: a linear regression of how
+// late trips arrive on their lane's and carrier's delay history, departure
+// time, distance and weather
+type DelayModel struct {
+	BaseModel
+	Version            int       `json:"version" gorm:"uniqueIndex"`
+	TrainedAt          time.Time `json:"trained_at"`
+	TrainingTrips      int       `json:"training_trips"`
+	HoldoutTrips       int       `json:"holdout_trips"`
+	HoldoutMAEMinutes  float64   `json:"holdout_mae_minutes"`
+	BaselineMAEMinutes float64   `json:"baseline_mae_minutes"` // of predicting the mean delay for every trip
+	Parameters         string    `json:"-" gorm:"type:text"`
+}
+
+// DelayPrediction is a delay model's prediction of how late a trip arrives,
+// kept to evaluate the model once the trip completes
+type DelayPrediction struct {
+	BaseModel
+	TripID                uint       `json:"trip_id" gorm:"index"`
+	ModelVersion          int        `json:"model_version" gorm:"index"`
+	PredictedAt           time.Time  `json:"predicted_at" gorm:"index"`
+	ScheduledArrival      time.Time  `json:"scheduled_arrival"`
+	PredictedDelayMinutes float64    `json:"predicted_delay_minutes"`
+	ActualArrival         *time.Time `json:"actual_arrival"`
+	ErrorMinutes          *float64   `json:"error_minutes"` // actual minus predicted delay, positive when the trip arrived later than predicted
+}
@@ -1,73 +1,216 @@
 package routes
 
 import (
-	"time"
-
 	"github.com/gofiber/fiber/v2"
 	"triplink/backend/auth"
+	"triplink/backend/config"
+	"triplink/backend/database"
+	"triplink/backend/docs"
 	"triplink/backend/handlers"
 	"triplink/backend/middleware"
+	"triplink/backend/services"
 
 	swagger "github.com/gofiber/swagger" // swagger handler
 )
 
 func Setup(app *fiber.App) {
 	// @BasePath /api
-	
+
+	// Record request latency and serve the metrics to Prometheus
+	metricsMiddleware := middleware.NewMetricsMiddleware(config.GetMetricsConfig())
+	if metricsMiddleware.Enabled() {
+		app.Use(metricsMiddleware.Record())
+		app.Get(metricsMiddleware.Path(), metricsMiddleware.Handler())
+	}
+
+	// Kubernetes probes, ahead of rate limiting and sessions
+	app.Get("/healthz", handlers.GetHealth)
+	app.Get("/readyz", handlers.GetReadiness)
+	app.Get("/livez", handlers.GetLiveness)
+
+	// Trace each request, continuing the caller's trace
+	app.Use(middleware.NewTracingMiddleware().Trace())
+
+	// Send errors in one envelope with a code and the trace ID
+	app.Use(middleware.NewErrorMiddleware().Handle())
+
 	// Initialize cache middleware
 	cacheMiddleware := middleware.NewCacheMiddleware()
 	
-	// Add rate limiting middleware globally (100 requests per minute)
-	app.Use(cacheMiddleware.RateLimitMiddleware(100, time.Minute))
+	// Limit requests per user, or per IP address for anonymous requests
+	rateLimitMiddleware := middleware.NewRateLimitMiddleware(services.NewRedisService(), config.GetRateLimitConfig())
+	app.Use(rateLimitMiddleware.Limit())
 	
 	// Add session middleware
 	app.Use(cacheMiddleware.SessionMiddleware())
+
+	// Record an audit log of mutating calls
+	auditMiddleware := middleware.NewAuditMiddleware(database.DB, config.GetAuditConfig())
+	app.Use(auditMiddleware.Audit())
+
+	// Convert tracking and analytics measurements to the client's units
+	app.Use(middleware.NewUnitsMiddleware(database.DB).Convert())
+
+	// Check calls against the OpenAPI spec, in development
+	contractMiddleware := middleware.NewContractMiddleware(docs.OpenAPI, config.GetAPIContractConfig())
+	app.Use(contractMiddleware.Validate())
+
+	// Limit reads of trips and loads to the current user's organizations
+	tenantMiddleware := middleware.NewTenantMiddleware(database.DB)
 	
 	// Cache health check endpoint
 	app.Get("/api/cache/health", cacheMiddleware.HealthCheckHandler())
 	
-	// Auth
+	// Auth, rejecting suspended accounts
+	auth.AccountCheck = handlers.CheckAccountActive
+	auth.AccountRole = handlers.AccountRole
 	app.Post("/api/register", handlers.Register)
 	app.Post("/api/login", handlers.Login)
 
+	// Phone verification, required for SMS notifications
+	app.Post("/api/users/me/phone/verification", auth.Middleware(), handlers.StartPhoneVerification)
+	app.Post("/api/users/me/phone/verify", auth.Middleware(), handlers.ConfirmPhoneVerification)
+
+	// Loads the current carrier could add to its upcoming trips
+	app.Get("/api/users/me/consolidation-suggestions", auth.Middleware(), handlers.GetConsolidationSuggestions)
+
+	// Features being rolled out that are on for the current user
+	app.Get("/api/users/me/feature-flags", auth.Middleware(), handlers.GetMyFeatureFlags)
+
+	// Services of the current carrier's vehicles coming due with their mileage
+	app.Get("/api/users/me/vehicles/maintenance", auth.Middleware(), handlers.GetUpcomingVehicleMaintenance)
+
+	// Trips booked on the same vehicle of the current carrier at the same time
+	app.Get("/api/users/me/vehicles/conflicts", auth.Middleware(), handlers.GetMyVehicleConflicts)
+
+	// Preferences of the current user, like the units of measurement
+	app.Get("/api/users/me/preferences", auth.Middleware(), handlers.GetMyPreferences)
+	app.Put("/api/users/me/preferences", auth.Middleware(), handlers.UpdateMyPreferences)
+
+	// Shifts and time off the current driver declares, and drivers' calendars
+	app.Get("/api/users/me/availability", auth.Middleware(), handlers.GetMyAvailability)
+	app.Post("/api/users/me/availability", auth.Middleware(), handlers.CreateMyAvailability)
+	app.Put("/api/users/me/availability/:id", auth.Middleware(), handlers.UpdateMyAvailability)
+	app.Delete("/api/users/me/availability/:id", auth.Middleware(), handlers.DeleteMyAvailability)
+	app.Get("/api/drivers/:driver_id/availability", auth.Middleware(), handlers.GetDriverAvailability)
+
 	// Users
 	app.Get("/api/users/:user_id/vehicles", handlers.GetUserVehicles)
+	app.Get("/api/users/:user_id/vehicles/expirations", handlers.GetUserVehicleExpirations)
 
 	// Vehicles
 	app.Post("/api/vehicles", auth.Middleware(), handlers.CreateVehicle)
 	app.Get("/api/vehicles/:id", handlers.GetVehicle)
+	app.Get("/api/vehicles/:id/compliance", handlers.GetVehicleCompliance)
+	app.Get("/api/vehicles/:id/maintenance", auth.Middleware(), handlers.GetVehicleMaintenance)
+	app.Put("/api/vehicles/:id/maintenance/:service_type", auth.Middleware(), handlers.SetVehicleServiceInterval)
+	app.Post("/api/vehicles/:id/maintenance/:service_type/complete", auth.Middleware(), handlers.CompleteVehicleService)
+	app.Put("/api/vehicles/:id/odometer", auth.Middleware(), handlers.SetVehicleOdometer)
 	app.Put("/api/vehicles/:id", auth.Middleware(), handlers.UpdateVehicle)
 	app.Delete("/api/vehicles/:id", auth.Middleware(), handlers.DeleteVehicle)
 	app.Get("/api/vehicles/search", handlers.SearchVehicles)
 
 	// Trips
-	app.Get("/api/trips", handlers.GetTrips)
-	app.Get("/api/trips/:id", handlers.GetTrip)
+	app.Get("/api/trips", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetTrips)
+	app.Get("/api/trips/search", handlers.SearchTrips)
+	app.Get("/api/trips/:id", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetTrip)
 	app.Post("/api/trips", auth.Middleware(), handlers.CreateTrip)
+	app.Put("/api/trips/:id", auth.Middleware(), handlers.UpdateTrip)
+	app.Post("/api/trips/:trip_id/assignments", auth.Middleware(), tenantMiddleware.Scope(), handlers.AssignTripDriver)
+	app.Get("/api/trips/:trip_id/assignments", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetTripAssignments)
+	app.Put("/api/trips/:trip_id/assignments/:assignment_id", auth.Middleware(), tenantMiddleware.Scope(), handlers.UpdateTripAssignment)
+	app.Delete("/api/trips/:trip_id/assignments/:assignment_id", auth.Middleware(), tenantMiddleware.Scope(), handlers.EndTripAssignment)
 	app.Post("/api/trips/:trip_id/manifest", auth.Middleware(), handlers.GenerateManifest)
-	app.Get("/api/trips/:trip_id/manifest", handlers.GetTripManifest)
-	app.Get("/api/trips/:trip_id/customs-summary", handlers.GetTripCustomsSummary)
+	app.Get("/api/trips/:trip_id/manifest", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetTripManifest)
+	app.Post("/api/trips/:trip_id/manifest/generate", auth.Middleware(), handlers.GenerateManifestPDF)
+	app.Get("/api/trips/:trip_id/customs-summary", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetTripCustomsSummary)
+	app.Get("/api/trips/:trip_id/emissions", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetTripEmissions)
+	app.Post("/api/trips/:trip_id/fuel-plan", auth.Middleware(), tenantMiddleware.Scope(), handlers.PlanTripFuelStops)
+	app.Get("/api/trips/:trip_id/fuel-plan", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetTripFuelPlan)
+	app.Post("/api/trips/:trip_id/tolls/recalculate", auth.Middleware(), handlers.RecalculateTripTolls)
+	app.Get("/api/trips/:trip_id/delay-prediction", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetTripDelayPrediction)
+
+	// Carbon reporting
+	app.Get("/api/emissions/report", auth.Middleware(), handlers.GetCarbonReport)
+
+	// Trip templates for recurring lanes
+	app.Post("/api/trip-templates", auth.Middleware(), handlers.CreateTripTemplate)
+	app.Get("/api/trip-templates", auth.Middleware(), handlers.GetTripTemplates)
+	app.Get("/api/trip-templates/:id", auth.Middleware(), handlers.GetTripTemplate)
+	app.Put("/api/trip-templates/:id", auth.Middleware(), handlers.UpdateTripTemplate)
+	app.Delete("/api/trip-templates/:id", auth.Middleware(), handlers.DeleteTripTemplate)
+	app.Post("/api/trip-templates/:id/generate", auth.Middleware(), handlers.GenerateTripTemplateTrips)
+
+	// Saved locations
+	app.Post("/api/saved-locations", auth.Middleware(), handlers.CreateSavedLocation)
+	app.Get("/api/saved-locations", auth.Middleware(), handlers.GetSavedLocations)
+	app.Get("/api/saved-locations/:id", auth.Middleware(), handlers.GetSavedLocation)
+	app.Put("/api/saved-locations/:id", auth.Middleware(), handlers.UpdateSavedLocation)
+	app.Delete("/api/saved-locations/:id", auth.Middleware(), handlers.DeleteSavedLocation)
+
+	// Organizations
+	app.Post("/api/organizations", auth.Middleware(), handlers.CreateOrganization)
+	app.Get("/api/organizations", auth.Middleware(), handlers.GetOrganizations)
+	app.Get("/api/organizations/:id", auth.Middleware(), handlers.GetOrganization)
+	app.Put("/api/organizations/:id", auth.Middleware(), handlers.UpdateOrganization)
+	app.Post("/api/organizations/:id/members", auth.Middleware(), handlers.AddOrganizationMember)
+	app.Put("/api/organizations/:id/members/:user_id", auth.Middleware(), handlers.UpdateOrganizationMember)
+	app.Delete("/api/organizations/:id/members/:user_id", auth.Middleware(), handlers.RemoveOrganizationMember)
+	app.Get("/api/organizations/:id/ops-channels", auth.Middleware(), handlers.GetOpsChannels)
+	app.Post("/api/organizations/:id/ops-channels", auth.Middleware(), handlers.CreateOpsChannel)
+	app.Put("/api/organizations/:id/ops-channels/:channel_id", auth.Middleware(), handlers.UpdateOpsChannel)
+	app.Delete("/api/organizations/:id/ops-channels/:channel_id", auth.Middleware(), handlers.DeleteOpsChannel)
+	app.Post("/api/organizations/:id/ops-channels/:channel_id/test", auth.Middleware(), handlers.TestOpsChannel)
+
+	// Saved filters and dashboards
+	app.Get("/api/workspace", auth.Middleware(), handlers.GetWorkspace)
+	app.Post("/api/saved-filters", auth.Middleware(), handlers.CreateSavedFilter)
+	app.Get("/api/saved-filters", auth.Middleware(), handlers.GetSavedFilters)
+	app.Put("/api/saved-filters/:id", auth.Middleware(), handlers.UpdateSavedFilter)
+	app.Delete("/api/saved-filters/:id", auth.Middleware(), handlers.DeleteSavedFilter)
+	app.Post("/api/dashboards", auth.Middleware(), handlers.CreateDashboard)
+	app.Get("/api/dashboards", auth.Middleware(), handlers.GetDashboards)
+	app.Get("/api/dashboards/:id", auth.Middleware(), handlers.GetDashboard)
+	app.Put("/api/dashboards/:id", auth.Middleware(), handlers.UpdateDashboard)
+	app.Delete("/api/dashboards/:id", auth.Middleware(), handlers.DeleteDashboard)
+
+	// GraphQL over trips, loads, tracking and analytics
+	app.Post("/api/graphql", auth.Middleware(), tenantMiddleware.Scope(), handlers.GraphQL)
+	app.Get("/api/graphql/schema", handlers.GetGraphQLSchema)
 
 	// Loads
-	app.Get("/api/loads", handlers.GetLoads)
-	app.Get("/api/loads/:id", handlers.GetLoad)
+	app.Get("/api/loads", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetLoads)
+	app.Post("/api/loads/import", auth.Middleware(), handlers.ImportLoads)
+	app.Get("/api/loads/:id", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetLoad)
 	app.Post("/api/loads", auth.Middleware(), handlers.CreateLoad)
-	app.Get("/api/loads/:load_id/quotes", handlers.GetLoadQuotes)
-	app.Get("/api/loads/:load_id/customs-documents", handlers.GetLoadCustomsDocuments)
+	app.Post("/api/loads/:load_id/book", auth.Middleware(), handlers.BookLoadOnTrip)
+	app.Delete("/api/loads/:load_id/book", auth.Middleware(), handlers.CancelLoadBooking)
+	app.Get("/api/loads/:load_id/quotes", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetLoadQuotes)
+	app.Get("/api/loads/:load_id/matches", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetLoadMatches)
+	app.Get("/api/loads/:load_id/customs-documents", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetLoadCustomsDocuments)
+	app.Get("/api/loads/:load_id/customs-compliance", auth.Middleware(), tenantMiddleware.Scope(), handlers.CheckLoadCustomsCompliance)
 	app.Post("/api/loads/:load_id/commercial-invoice", auth.Middleware(), handlers.GenerateCommercialInvoice)
 	app.Post("/api/loads/:load_id/bill-of-lading", auth.Middleware(), handlers.GenerateBillOfLading)
 	app.Post("/api/loads/:load_id/packing-list", auth.Middleware(), handlers.GeneratePackingList)
+	app.Post("/api/loads/:load_id/proofs", auth.Middleware(), handlers.UploadLoadProof)
+	app.Get("/api/loads/:load_id/proofs", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetLoadProofs)
 
 	// Quotes
 	app.Post("/api/quotes", auth.Middleware(), handlers.CreateQuote)
 	app.Get("/api/carriers/:carrier_id/quotes", handlers.GetCarrierQuotes)
 	app.Post("/api/quotes/:id/accept", auth.Middleware(), handlers.AcceptQuote)
 	app.Post("/api/quotes/:id/reject", auth.Middleware(), handlers.RejectQuote)
+	app.Post("/api/quotes/:id/counter", auth.Middleware(), handlers.CounterQuote)
 	app.Put("/api/quotes/:id", auth.Middleware(), handlers.UpdateQuote)
 
+	// Exchange rates that quotes, payments and analytics are normalized at
+	app.Get("/api/exchange-rates", handlers.GetExchangeRates)
+	app.Get("/api/exchange-rates/convert", handlers.ConvertCurrency)
+
 	// Manifests
-	app.Get("/api/manifests/:id", handlers.GetManifest)
-	app.Get("/api/manifests/:id/detailed", handlers.GetDetailedManifest)
+	app.Get("/api/manifests/:id", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetManifest)
+	app.Get("/api/manifests/:id/detailed", auth.Middleware(), tenantMiddleware.Scope(), handlers.GetDetailedManifest)
+	app.Get("/api/manifests/:id/download", auth.Middleware(), tenantMiddleware.Scope(), handlers.DownloadManifest)
 	app.Put("/api/manifests/:id/document", auth.Middleware(), handlers.UpdateManifestDocument)
 
 	// Customs Documents
@@ -76,16 +219,72 @@ func Setup(app *fiber.App) {
 	app.Put("/api/customs-documents/:id", auth.Middleware(), handlers.UpdateCustomsDocument)
 	app.Delete("/api/customs-documents/:id", auth.Middleware(), handlers.DeleteCustomsDocument)
 
+	// Documents
+	app.Post("/api/documents", auth.Middleware(), handlers.CreateDocumentUpload)
+	app.Get("/api/documents", auth.Middleware(), handlers.GetDocuments)
+	app.Get("/api/documents/:id", auth.Middleware(), handlers.GetDocument)
+	app.Delete("/api/documents/:id", auth.Middleware(), handlers.DeleteDocument)
+	app.Post("/api/documents/:id/complete", auth.Middleware(), handlers.CompleteDocumentUpload)
+	app.Put("/api/documents/:id/content", auth.Middleware(), handlers.UploadDocumentContent)
+	app.Get("/api/documents/:id/content", auth.Middleware(), handlers.GetDocumentContent)
+	app.Get("/api/documents/:id/download", auth.Middleware(), handlers.GetDocumentDownloadURL)
+
 	// Messages
 	app.Get("/api/messages", auth.Middleware(), handlers.GetMessages)
 	app.Post("/api/messages", auth.Middleware(), handlers.CreateMessage)
+	app.Post("/api/conversations", auth.Middleware(), handlers.StartConversation)
+	app.Get("/api/conversations", auth.Middleware(), handlers.GetConversations)
+	app.Get("/api/conversations/unread", auth.Middleware(), handlers.GetUnreadMessageCounts)
+	app.Get("/api/conversations/:id/messages", auth.Middleware(), handlers.GetConversationMessages)
+	app.Post("/api/conversations/:id/messages", auth.Middleware(), handlers.SendConversationMessage)
+	app.Post("/api/conversations/:id/read", auth.Middleware(), handlers.MarkConversationRead)
+
+	// Notifications
+	app.Post("/api/notifications", auth.Middleware(), handlers.CreateNotification)
+	app.Put("/api/notifications/:id/read", auth.Middleware(), handlers.MarkNotificationAsRead)
+	app.Put("/api/notifications/:id/unread", auth.Middleware(), handlers.MarkNotificationAsUnread)
+	app.Put("/api/notifications/:id/archive", auth.Middleware(), handlers.ArchiveNotification)
+	app.Put("/api/notifications/:id/unarchive", auth.Middleware(), handlers.UnarchiveNotification)
+	app.Delete("/api/notifications/:id", auth.Middleware(), handlers.DeleteNotification)
+	app.Get("/api/users/:user_id/notifications", auth.Middleware(), handlers.GetUserNotifications)
+	app.Get("/api/users/:user_id/notifications/count", auth.Middleware(), handlers.GetNotificationCounts)
+	app.Get("/api/users/:user_id/notifications/summary", auth.Middleware(), handlers.GetNotificationSummary)
+	app.Put("/api/users/:user_id/notifications/read-all", auth.Middleware(), handlers.MarkAllNotificationsAsRead)
+	app.Post("/api/users/:user_id/notifications/bulk", auth.Middleware(), handlers.BulkUpdateNotifications)
+	app.Post("/api/users/:user_id/notification-tokens", auth.Middleware(), handlers.RegisterDeviceToken)
+	app.Delete("/api/users/:user_id/notification-tokens", auth.Middleware(), handlers.UnregisterDeviceToken)
+	app.Get("/api/users/:user_id/notification-preferences", auth.Middleware(), handlers.GetNotificationPreferences)
+	app.Put("/api/users/:user_id/notification-preferences", auth.Middleware(), handlers.UpdateNotificationPreferences)
 
 	// Transactions
 	app.Get("/api/transactions", auth.Middleware(), handlers.GetTransactions)
 	app.Post("/api/transactions", auth.Middleware(), handlers.CreateTransaction)
 
+	// Payments
+	app.Post("/api/loads/:load_id/payments", auth.Middleware(), handlers.ChargeLoadPayment)
+	app.Post("/api/loads/:load_id/refunds", auth.Middleware(), handlers.RefundLoadPayment)
+	app.Post("/api/payments/webhooks/stripe", handlers.StripeWebhook)
+
+	// Invoices
+	app.Post("/api/loads/:load_id/invoices", auth.Middleware(), handlers.IssueInvoice)
+	app.Get("/api/invoices", auth.Middleware(), handlers.GetInvoices)
+	app.Get("/api/invoices/:id", auth.Middleware(), handlers.GetInvoice)
+	app.Get("/api/invoices/:id/pdf", auth.Middleware(), handlers.DownloadInvoice)
+	app.Post("/api/invoices/:id/void", auth.Middleware(), handlers.VoidInvoice)
+
+	// Shippers' feedback on delivered loads
+	app.Post("/api/loads/:load_id/feedback", auth.Middleware(), handlers.SubmitFeedback)
+	app.Get("/api/feedback", auth.Middleware(), handlers.GetFeedback)
+	app.Post("/api/feedback/:id/resolve", auth.Middleware(), handlers.ResolveFeedback)
+
+	// Driver safety scoring from tracking data
+	app.Get("/api/drivers/:driver_id/scorecard", auth.Middleware(), handlers.GetDriverScorecard)
+
+	// Carrier performance scorecards, visible to shippers
+	app.Get("/api/carriers/:carrier_id/scorecard", auth.Middleware(), handlers.GetCarrierScorecard)
+
 	// Analytics Routes with caching
-	analyticsGroup := app.Group("/api/analytics", auth.Middleware(), cacheMiddleware.Cache("analytics"))
+	analyticsGroup := app.Group("/api/analytics", auth.Middleware(), tenantMiddleware.Scope(), cacheMiddleware.Cache("analytics"))
 	analyticsGroup.Post("/on-time-delivery", handlers.GetOnTimeDeliveryAnalytics)
 	analyticsGroup.Post("/delivery-performance/by-route", handlers.GetDeliveryPerformanceByRoute)
 	analyticsGroup.Post("/delivery-performance/by-driver", handlers.GetDeliveryPerformanceByDriver)
@@ -93,9 +292,21 @@ func Setup(app *fiber.App) {
 	analyticsGroup.Post("/load-matching", handlers.GetLoadMatchingAnalytics)
 	analyticsGroup.Post("/capacity-utilization", handlers.GetCapacityUtilizationAnalytics)
 	analyticsGroup.Post("/delay-analysis", handlers.GetDelayAnalysisAnalytics)
+	analyticsGroup.Post("/dwell-time", handlers.GetDwellTimeAnalytics)
 	analyticsGroup.Post("/vehicle-capacity", handlers.GetVehicleCapacityData)
+	analyticsGroup.Post("/trends", handlers.GetAnalyticsTrends)
+	analyticsGroup.Post("/comparison", handlers.GetAnalyticsComparison)
+	analyticsGroup.Post("/lanes", handlers.GetLaneBenchmark)
+	analyticsGroup.Post("/reports/:report", handlers.GenerateAnalyticsReport)
 	analyticsGroup.Post("/kpis/:category", handlers.GetOperationalKPIs)
 
+	// Scheduled analytics report emails
+	app.Post("/api/report-subscriptions", auth.Middleware(), handlers.CreateReportSubscription)
+	app.Get("/api/report-subscriptions", auth.Middleware(), handlers.GetReportSubscriptions)
+	app.Put("/api/report-subscriptions/:id", auth.Middleware(), handlers.UpdateReportSubscription)
+	app.Delete("/api/report-subscriptions/:id", auth.Middleware(), handlers.DeleteReportSubscription)
+	app.Post("/api/report-subscriptions/:id/send", auth.Middleware(), handlers.SendReportSubscription)
+
 	// Route Optimization Routes with caching
 	routeOptGroup := app.Group("/api/route-optimization", auth.Middleware(), cacheMiddleware.Cache("route_optimization"))
 	routeOptGroup.Post("/optimize", handlers.OptimizeRoute)
@@ -104,6 +315,9 @@ func Setup(app *fiber.App) {
 	routeOptGroup.Get("/traffic/:route_id", handlers.GetRealTimeTraffic)
 	routeOptGroup.Get("/recommendations/:route_id", handlers.GetRouteRecommendations)
 
+	// Geocoding, cached across requests
+	app.Post("/api/geocode/batch", auth.Middleware(), handlers.BatchGeocodeAddresses)
+
 	// External API Routes with caching
 	externalGroup := app.Group("/api/external", auth.Middleware(), cacheMiddleware.Cache("external_api"))
 	externalGroup.Post("/fuel-prices", handlers.GetFuelPricesAlongRoute)
@@ -114,7 +328,7 @@ func Setup(app *fiber.App) {
 	// Machine Learning Routes with caching
 	mlGroup := app.Group("/api/ml", auth.Middleware(), cacheMiddleware.Cache("ml_predictions"))
 	mlGroup.Post("/sentiment-analysis", handlers.AnalyzeSentiment)
-	mlGroup.Post("/predict-delay", handlers.PredictDeliveryDelay)
+	mlGroup.Post("/predict-delay", tenantMiddleware.Scope(), handlers.PredictDeliveryDelay)
 	mlGroup.Post("/predict-satisfaction", handlers.PredictCustomerSatisfaction)
 	mlGroup.Post("/classify-text", handlers.ClassifyText)
 	mlGroup.Post("/optimize-route", handlers.OptimizeRouteWithML)
@@ -122,16 +336,31 @@ func Setup(app *fiber.App) {
 	mlGroup.Post("/operations-insights", handlers.GetOperationsMLInsights)
 
 	// Tracking Routes (Phase 4 - Real-time tracking)
-	trackingGroup := app.Group("/api/tracking", auth.Middleware())
+	trackingGroup := app.Group("/api/tracking", auth.Middleware(), tenantMiddleware.Scope())
 	
 	// Trip Tracking Endpoints
 	trackingGroup.Post("/trips/:trip_id/location", handlers.UpdateTripLocation)
 	trackingGroup.Get("/trips/:trip_id/current", handlers.GetCurrentTripLocation)
+	trackingGroup.Get("/trips/:trip_id/stream", handlers.StreamTripLocation)
 	trackingGroup.Get("/trips/:trip_id/history", handlers.GetTripTrackingHistory)
 	trackingGroup.Put("/trips/:trip_id/status", handlers.UpdateTripStatus)
+	trackingGroup.Post("/trips/:trip_id/pause", handlers.PauseTripTracking)
+	trackingGroup.Post("/trips/:trip_id/resume", handlers.ResumeTripTracking)
+	trackingGroup.Post("/trips/:trip_id/consent", handlers.RecordTripTrackingConsent)
 	trackingGroup.Get("/trips/:trip_id/eta", handlers.GetTripETA)
 	trackingGroup.Get("/trips/:trip_id/status", handlers.GetTripTrackingStatus)
+	trackingGroup.Get("/trips/:trip_id/status-suggestions", handlers.GetTripStatusSuggestions)
+	trackingGroup.Post("/trips/:trip_id/status-suggestions/:suggestion_id/confirm", handlers.ConfirmTripStatusSuggestion)
+	trackingGroup.Post("/trips/:trip_id/status-suggestions/:suggestion_id/dismiss", handlers.DismissTripStatusSuggestion)
 	trackingGroup.Get("/trips/:trip_id/events", handlers.GetTripTrackingEvents)
+	trackingGroup.Get("/trips/:trip_id/route", handlers.GetTripRoute)
+	trackingGroup.Put("/trips/:trip_id/route", handlers.UpdateTripPlannedRoute)
+	trackingGroup.Get("/trips/:trip_id/replay", handlers.GetTripReplay)
+	trackingGroup.Get("/trips/:trip_id/stops", handlers.GetTripStops)
+	trackingGroup.Post("/trips/:trip_id/stops/generate", handlers.GenerateTripStops)
+	trackingGroup.Put("/trips/:trip_id/stops/:stop_id/status", handlers.UpdateTripStopStatus)
+	trackingGroup.Get("/trips/:trip_id/stops/:stop_id/check-ins", handlers.GetStopCheckIns)
+	trackingGroup.Post("/trips/:trip_id/loads/status", handlers.UpdateTripLoadStatuses)
 	
 	// Load Tracking Endpoints
 	trackingGroup.Get("/loads/:load_id", handlers.GetLoadTracking)
@@ -143,24 +372,89 @@ func Setup(app *fiber.App) {
 	trackingGroup.Get("/users/:user_id/active", handlers.GetUserActiveTrackings)
 	trackingGroup.Get("/users/:user_id/shipper-view", handlers.GetShipperTrackingView)
 	trackingGroup.Get("/users/:user_id/carrier-view", handlers.GetCarrierTrackingView)
-	trackingGroup.Get("/users/:user_id/notifications", handlers.GetUserTrackingNotifications)
+	trackingGroup.Get("/users/:carrier_id/fleet/live", handlers.GetFleetLiveMap)
 	
 	// Mobile-optimized Tracking Endpoints
 	mobileGroup := app.Group("/api/mobile")
 	mobileGroup.Get("/trips/:trip_id/tracking", handlers.GetLightweightTracking)
 	mobileGroup.Post("/trips/:trip_id/sync", auth.Middleware(), handlers.SyncOfflineData)
+	mobileGroup.Post("/trips/:trip_id/stops/:stop_id/check-in", auth.Middleware(), handlers.CheckInAtStop)
+	mobileGroup.Post("/trips/:trip_id/stops/:stop_id/check-out", auth.Middleware(), handlers.CheckOutOfStop)
 	mobileGroup.Get("/trips/:trip_id/battery-settings", handlers.GetBatteryOptimizedSettings)
+	mobileGroup.Get("/trips/:trip_id/tracking-settings/stream", auth.Middleware(), handlers.StreamTrackingSettings)
 	mobileGroup.Put("/users/:user_id/preferences", auth.Middleware(), handlers.UpdateMobileTrackingPreferences)
 	mobileGroup.Get("/users/:user_id/tracking/summary", handlers.GetMobileTrackingSummary)
 	
+	// Integration Endpoints, authenticated by API key for server-to-server calls
+	apiKeyMiddleware := middleware.NewApiKeyMiddleware(database.DB)
+	integrationGroup := app.Group("/api/integrations", apiKeyMiddleware.Authenticate())
+	integrationGroup.Post("/trips/:trip_id/location", apiKeyMiddleware.RequireScope(services.ScopeTrackingWrite), handlers.UpdateTripLocation)
+	integrationGroup.Get("/trips/:trip_id/current", apiKeyMiddleware.RequireScope(services.ScopeTrackingRead), handlers.GetCurrentTripLocation)
+
+	// API Keys
+	apiKeyGroup := app.Group("/api/api-keys", auth.Middleware(), auth.RequireRole("CARRIER", "ADMIN"))
+	apiKeyGroup.Post("/", handlers.CreateApiKey)
+	apiKeyGroup.Get("/", handlers.GetApiKeys)
+	apiKeyGroup.Post("/:id/rotate", handlers.RotateApiKey)
+	apiKeyGroup.Delete("/:id", handlers.RevokeApiKey)
+
+	// Telematics Providers, ingesting vehicle positions into trips
+	telematicsGroup := app.Group("/api/telematics")
+	telematicsGroup.Post("/connections", auth.Middleware(), auth.RequireRole("CARRIER", "ADMIN"), handlers.CreateTelematicsConnection)
+	telematicsGroup.Get("/connections", auth.Middleware(), handlers.GetTelematicsConnections)
+	telematicsGroup.Delete("/connections/:id", auth.Middleware(), handlers.DeleteTelematicsConnection)
+	telematicsGroup.Post("/connections/:id/poll", auth.Middleware(), handlers.PollTelematicsConnection)
+	telematicsGroup.Post("/webhooks/:id", handlers.ReceiveTelematicsWebhook)
+	telematicsGroup.Post("/devices", auth.Middleware(), auth.RequireRole("CARRIER", "ADMIN"), handlers.CreateTelematicsDevice)
+	telematicsGroup.Get("/devices", auth.Middleware(), handlers.GetTelematicsDevices)
+	telematicsGroup.Delete("/devices/:id", auth.Middleware(), handlers.DeleteTelematicsDevice)
+
+	// GPS Trackers, publishing positions over MQTT
+	trackerGroup := app.Group("/api/trackers", auth.Middleware(), auth.RequireRole("CARRIER", "ADMIN"))
+	trackerGroup.Post("/", handlers.CreateTracker)
+	trackerGroup.Get("/", handlers.GetTrackers)
+	trackerGroup.Put("/:id", handlers.UpdateTracker)
+	trackerGroup.Delete("/:id", handlers.DeleteTracker)
+
 	// Analytics and Monitoring Endpoints
 	monitoringGroup := app.Group("/api/monitoring", auth.Middleware())
 	monitoringGroup.Get("/trips/:trip_id/analytics", handlers.GetTrackingAnalytics)
 	monitoringGroup.Get("/tracking/health", handlers.GetSystemHealthMetrics)
 	monitoringGroup.Get("/tracking/performance", handlers.GetTrackingPerformanceMetrics)
 	monitoringGroup.Get("/tracking/data-quality", handlers.GetDataQualityReport)
+	monitoringGroup.Get("/tracking/eta-accuracy", handlers.GetETAAccuracyReport)
 
-	// Swagger
+	// Admin Endpoints
+	adminGroup := app.Group("/api/admin", auth.Middleware(), auth.RequireRole("ADMIN"))
+	adminGroup.Get("/users", handlers.GetAdminUsers)
+	adminGroup.Get("/users/:id", handlers.GetAdminUser)
+	adminGroup.Post("/users/:id/verification/approve", handlers.ApproveUserVerification)
+	adminGroup.Post("/users/:id/verification/reject", handlers.RejectUserVerification)
+	adminGroup.Post("/users/:id/suspend", handlers.SuspendUser)
+	adminGroup.Post("/users/:id/reinstate", handlers.ReinstateUser)
+	adminGroup.Get("/retention/policies", handlers.GetRetentionPolicies)
+	adminGroup.Put("/retention/policies", handlers.SetRetentionPolicy)
+	adminGroup.Delete("/retention/policies/:id", handlers.DeleteRetentionPolicy)
+	adminGroup.Post("/retention/runs", handlers.RunRetentionCleanup)
+	adminGroup.Get("/retention/runs", handlers.GetRetentionRuns)
+	adminGroup.Get("/retention/runs/:id", handlers.GetRetentionRun)
+	adminGroup.Get("/audit-logs", handlers.GetAuditLogs)
+	adminGroup.Get("/vehicles/conflicts", handlers.GetVehicleConflicts)
+	adminGroup.Get("/notifications/dead-letters", handlers.GetNotificationDeadLetters)
+	adminGroup.Post("/notifications/dead-letters/:id/retry", handlers.RetryNotificationDeadLetter)
+	adminGroup.Get("/feature-flags", handlers.GetFeatureFlags)
+	adminGroup.Put("/feature-flags/:key", handlers.SetFeatureFlag)
+	adminGroup.Delete("/feature-flags/:key", handlers.DeleteFeatureFlag)
+	adminGroup.Get("/delay-model", handlers.GetDelayModelReport)
+	adminGroup.Post("/delay-model/train", handlers.TrainDelayModel)
+
+	// Swagger, and the OpenAPI 3 spec generated by cmd/openapi
+	app.Get("/api/openapi.json", handlers.GetOpenAPISpec)
 	app.Get("/swagger/*", swagger.HandlerDefault) // default
 	app.Static("/docs", "./docs")                 // Serve swagger files directly
+
+	// Uploaded files, when stored on the local disk
+	if storage := config.GetStorageConfig(); storage.Provider == "local" && storage.PublicBaseURL == "" {
+		app.Static("/uploads", storage.LocalPath)
+	}
 }
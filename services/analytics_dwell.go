@@ -0,0 +1,211 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"triplink/backend/models"
+)
+
+// DwellTimeMetrics summarizes the time vehicles spent at pickup and delivery
+// stops, and the detention beyond the free time
+type DwellTimeMetrics struct {
+	TotalStops            int                `json:"total_stops"`
+	AverageDwellMinutes   float64            `json:"average_dwell_minutes"`
+	DetentionStops        int                `json:"detention_stops"`
+	DetentionPercentage   float64            `json:"detention_percentage"`
+	TotalDetentionMinutes int                `json:"total_detention_minutes"`
+	DetentionCharges      float64            `json:"detention_charges"`
+	ByStopType            []DwellTimeSummary `json:"by_stop_type"`
+	ByCarrier             []DwellTimeSummary `json:"by_carrier"`
+	ByShipper             []DwellTimeSummary `json:"by_shipper"`
+}
+
+// DwellTimeSummary is the dwell time at the stops of a stop type, carrier or
+// shipper
+type DwellTimeSummary struct {
+	ID                  string  `json:"id"` // stop type or user ID
+	Name                string  `json:"name,omitempty"`
+	Stops               int     `json:"stops"`
+	AverageDwellMinutes float64 `json:"average_dwell_minutes"`
+	DetentionStops      int     `json:"detention_stops"`
+	DetentionMinutes    int     `json:"detention_minutes"`
+	DetentionCharges    float64 `json:"detention_charges"`
+}
+
+// dwellTotals accumulates the dwell times of stops
+type dwellTotals struct {
+	stops            int
+	dwellMinutes     int
+	detentionStops   int
+	detentionMinutes int
+	charges          float64
+}
+
+func (t *dwellTotals) add(stop models.TripStop) {
+	t.stops++
+	t.dwellMinutes += stop.DwellMinutes
+	if stop.DetentionMinutes > 0 {
+		t.detentionStops++
+		t.detentionMinutes += stop.DetentionMinutes
+		t.charges += stop.DetentionCharge
+	}
+}
+
+func (t *dwellTotals) summary(id, name string) DwellTimeSummary {
+	summary := DwellTimeSummary{
+		ID:               id,
+		Name:             name,
+		Stops:            t.stops,
+		DetentionStops:   t.detentionStops,
+		DetentionMinutes: t.detentionMinutes,
+		DetentionCharges: roundHundredths(t.charges),
+	}
+	if t.stops > 0 {
+		summary.AverageDwellMinutes = roundHundredths(float64(t.dwellMinutes) / float64(t.stops))
+	}
+	return summary
+}
+
+// GetDwellTimeMetrics summarizes the dwell time at the pickup and delivery
+// stops departed from on the trips matching the filter, overall and per
+// stop type, carrier and shipper. With customer IDs only the stops of those
+// shippers' loads are included.
+func (as *AnalyticsService) GetDwellTimeMetrics(filter AnalyticsFilter) (*DwellTimeMetrics, error) {
+	trips, err := as.findTrips(as.db, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trips: %w", err)
+	}
+
+	metrics := &DwellTimeMetrics{
+		ByStopType: []DwellTimeSummary{},
+		ByCarrier:  []DwellTimeSummary{},
+		ByShipper:  []DwellTimeSummary{},
+	}
+	if len(trips) == 0 {
+		return metrics, nil
+	}
+
+	carrierByTrip := make(map[uint]uint, len(trips))
+	tripIDs := make([]uint, 0, len(trips))
+	for _, trip := range trips {
+		carrierByTrip[trip.ID] = trip.UserID
+		tripIDs = append(tripIDs, trip.ID)
+	}
+
+	var stops []models.TripStop
+	if err := as.db.Where("trip_id IN ? AND stop_type IN ? AND status = ? AND actual_departure IS NOT NULL",
+		tripIDs, []string{TripStopPickup, TripStopDelivery}, TripStopCompleted).
+		Find(&stops).Error; err != nil {
+		return nil, fmt.Errorf("failed to get trip stops: %w", err)
+	}
+
+	var loadIDs []uint
+	for _, stop := range stops {
+		if stop.LoadID != nil {
+			loadIDs = append(loadIDs, *stop.LoadID)
+		}
+	}
+	shipperByLoad := make(map[uint]uint)
+	if len(loadIDs) > 0 {
+		var loads []models.Load
+		if err := as.db.Select("id, shipper_id").Where("id IN ?", loadIDs).Find(&loads).Error; err != nil {
+			return nil, fmt.Errorf("failed to get loads: %w", err)
+		}
+		for _, load := range loads {
+			shipperByLoad[load.ID] = load.ShipperID
+		}
+	}
+	customers := make(map[uint]bool, len(filter.CustomerIDs))
+	for _, id := range filter.CustomerIDs {
+		customers[id] = true
+	}
+
+	var overall dwellTotals
+	byType := make(map[string]*dwellTotals)
+	byCarrier := make(map[uint]*dwellTotals)
+	byShipper := make(map[uint]*dwellTotals)
+	for _, stop := range stops {
+		var shipperID uint
+		if stop.LoadID != nil {
+			shipperID = shipperByLoad[*stop.LoadID]
+		}
+		if len(customers) > 0 && !customers[shipperID] {
+			continue
+		}
+
+		overall.add(stop)
+		if byType[stop.StopType] == nil {
+			byType[stop.StopType] = &dwellTotals{}
+		}
+		byType[stop.StopType].add(stop)
+		addUserDwell(byCarrier, carrierByTrip[stop.TripID], stop)
+		if shipperID != 0 {
+			addUserDwell(byShipper, shipperID, stop)
+		}
+	}
+
+	total := overall.summary("", "")
+	metrics.TotalStops = total.Stops
+	metrics.AverageDwellMinutes = total.AverageDwellMinutes
+	metrics.DetentionStops = total.DetentionStops
+	metrics.TotalDetentionMinutes = total.DetentionMinutes
+	metrics.DetentionCharges = total.DetentionCharges
+	if total.Stops > 0 {
+		metrics.DetentionPercentage = roundHundredths(float64(total.DetentionStops) / float64(total.Stops) * 100)
+	}
+
+	for _, stopType := range []string{TripStopPickup, TripStopDelivery} {
+		if totals, ok := byType[stopType]; ok {
+			metrics.ByStopType = append(metrics.ByStopType, totals.summary(stopType, ""))
+		}
+	}
+	if metrics.ByCarrier, err = as.userDwellSummaries(byCarrier); err != nil {
+		return nil, err
+	}
+	if metrics.ByShipper, err = as.userDwellSummaries(byShipper); err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// addUserDwell adds a stop to the totals of a user
+func addUserDwell(totals map[uint]*dwellTotals, userID uint, stop models.TripStop) {
+	if totals[userID] == nil {
+		totals[userID] = &dwellTotals{}
+	}
+	totals[userID].add(stop)
+}
+
+// userDwellSummaries returns the summaries of the users' stops, longest
+// detention first
+func (as *AnalyticsService) userDwellSummaries(totals map[uint]*dwellTotals) ([]DwellTimeSummary, error) {
+	summaries := []DwellTimeSummary{}
+	if len(totals) == 0 {
+		return summaries, nil
+	}
+
+	userIDs := make([]uint, 0, len(totals))
+	for id := range totals {
+		userIDs = append(userIDs, id)
+	}
+	var users []models.User
+	if err := as.db.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	names := make(map[uint]string, len(users))
+	for i := range users {
+		names[users[i].ID] = userDisplayName(&users[i])
+	}
+
+	for id, total := range totals {
+		summaries = append(summaries, total.summary(strconv.FormatUint(uint64(id), 10), names[id]))
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].DetentionMinutes != summaries[j].DetentionMinutes {
+			return summaries[i].DetentionMinutes > summaries[j].DetentionMinutes
+		}
+		return summaries[i].ID < summaries[j].ID
+	})
+	return summaries, nil
+}
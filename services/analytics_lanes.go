@@ -0,0 +1,279 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// laneHistoryPeriod is how far back lane benchmarks go when no start date
+	// is given
+	laneHistoryPeriod = 365 * 24 * time.Hour
+
+	// recentLaneQuotes is how many of the latest quotes a lane benchmark lists
+	recentLaneQuotes = 10
+)
+
+// Lane is an origin/destination corridor. Cities are matched regardless of
+// case and surrounding spaces, and countries only when given.
+type Lane struct {
+	OriginCity         string `json:"origin_city"`
+	OriginCountry      string `json:"origin_country,omitempty"`
+	DestinationCity    string `json:"destination_city"`
+	DestinationCountry string `json:"destination_country,omitempty"`
+}
+
+// LaneBenchmark is the market history of a lane that rates can be negotiated
+// against: the prices agreed for its loads, how long its trips took and how
+// many arrived on time, and the quotes made for it
+type LaneBenchmark struct {
+	Origin       string         `json:"origin"`
+	Destination  string         `json:"destination"`
+	From         time.Time      `json:"from"`
+	To           time.Time      `json:"to"`
+	Currency     string         `json:"currency"` // of prices and quotes
+	AgreedPrices LanePriceStats `json:"agreed_prices"`
+	Quotes       LanePriceStats `json:"quotes"`
+	Transit      LaneTransit    `json:"transit"`
+	RecentQuotes []LaneQuote    `json:"recent_quotes"` // latest first
+}
+
+// LanePriceStats summarizes prices on a lane
+type LanePriceStats struct {
+	Count        int     `json:"count"`
+	Average      float64 `json:"average"`
+	Median       float64 `json:"median"`
+	Min          float64 `json:"min"`
+	Max          float64 `json:"max"`
+	AveragePerKg float64 `json:"average_per_kg"` // of the loads with a weight
+}
+
+// LaneTransit summarizes the completed trips of a lane
+type LaneTransit struct {
+	Trips               int     `json:"trips"`
+	AverageTransitHours float64 `json:"average_transit_hours"`
+	OnTimePercentage    float64 `json:"on_time_percentage"`
+	AverageDelay        float64 `json:"average_delay"` // minutes, of the trips arriving late
+}
+
+// LaneQuote is a quote made for a load on a lane. Quotes are anonymous, as
+// benchmarks cover other users' loads.
+type LaneQuote struct {
+	QuoteAmount   float64   `json:"quote_amount"`
+	QuoteCurrency string    `json:"quote_currency"`
+	Amount        float64   `json:"amount"` // in the benchmark's currency
+	Weight        float64   `json:"weight"` // of the load, kg
+	Status        string    `json:"status"`
+	ProposedBy    string    `json:"proposed_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// lanePrice is a price on a lane in the benchmark's currency, with the weight
+// of its load
+type lanePrice struct {
+	amount float64
+	weight float64
+}
+
+// GetLaneBenchmark returns the history of a lane between the filter's dates,
+// the last year by default, with prices in the filter's currency. Benchmarks
+// cover every load and trip on the lane; the filter's scope isn't applied.
+func (as *AnalyticsService) GetLaneBenchmark(lane Lane, filter AnalyticsFilter) (*LaneBenchmark, error) {
+	if filter.From == nil {
+		to := time.Now()
+		if filter.To != nil {
+			to = *filter.To
+		}
+		from := to.Add(-laneHistoryPeriod)
+		filter.From = &from
+	}
+	filter = analyticsPeriod(filter)
+
+	benchmark := &LaneBenchmark{
+		Origin:       tripPlaceName(lane.OriginCity, strings.ToUpper(lane.OriginCountry)),
+		Destination:  tripPlaceName(lane.DestinationCity, strings.ToUpper(lane.DestinationCountry)),
+		From:         *filter.From,
+		To:           *filter.To,
+		Currency:     filter.Currency,
+		RecentQuotes: []LaneQuote{},
+	}
+
+	// Prices agreed for loads that were booked, picked up from the lane's
+	// origin in the period
+	var loads []models.Load
+	if err := as.laneLoads(lane).
+		Where("agreed_price > 0 AND status IN ?", []string{"BOOKED", "PICKED_UP", "IN_TRANSIT", "DELIVERED"}).
+		Where("requested_pickup_date BETWEEN ? AND ?", *filter.From, *filter.To).
+		Find(&loads).Error; err != nil {
+		return nil, fmt.Errorf("failed to get lane loads: %w", err)
+	}
+	var agreed []lanePrice
+	for _, load := range loads {
+		amount, err := laneAmountIn(load.AgreedPrice, load.Currency, filter.Currency)
+		if err != nil {
+			log.Printf("Leaving load %d out of the lane benchmark: %v", load.ID, err)
+			continue
+		}
+		agreed = append(agreed, lanePrice{amount: amount, weight: load.Weight})
+	}
+	benchmark.AgreedPrices = summarizeLanePrices(agreed)
+
+	var quotes []models.Quote
+	if err := as.db.Where("load_id IN (?)", as.laneLoads(lane).Select("id")).
+		Where("created_at BETWEEN ? AND ?", *filter.From, *filter.To).
+		Order("created_at DESC, id DESC").Find(&quotes).Error; err != nil {
+		return nil, fmt.Errorf("failed to get lane quotes: %w", err)
+	}
+	weights, err := as.loadWeights(quotes)
+	if err != nil {
+		return nil, err
+	}
+	var quoted []lanePrice
+	for _, quote := range quotes {
+		amount, err := quoteAmountIn(&quote, filter.Currency)
+		if err != nil {
+			log.Printf("Leaving quote %d out of the lane benchmark: %v", quote.ID, err)
+			continue
+		}
+		quoted = append(quoted, lanePrice{amount: amount, weight: weights[quote.LoadID]})
+		if len(benchmark.RecentQuotes) < recentLaneQuotes {
+			benchmark.RecentQuotes = append(benchmark.RecentQuotes, LaneQuote{
+				QuoteAmount:   quote.QuoteAmount,
+				QuoteCurrency: quote.Currency,
+				Amount:        amount,
+				Weight:        weights[quote.LoadID],
+				Status:        quote.Status,
+				ProposedBy:    quote.ProposedBy,
+				CreatedAt:     quote.CreatedAt,
+			})
+		}
+	}
+	benchmark.Quotes = summarizeLanePrices(quoted)
+
+	trips, err := as.completedTrips(AnalyticsFilter{From: filter.From, To: filter.To})
+	if err != nil {
+		return nil, err
+	}
+	laneTrips := trips[:0]
+	for _, trip := range trips {
+		if lane.matches(trip.OriginCity, trip.OriginCountry, trip.DestinationCity, trip.DestinationCountry) {
+			laneTrips = append(laneTrips, trip)
+		}
+	}
+	summary := summarizeDeliveries(laneTrips)
+	benchmark.Transit.Trips = summary.Total
+	if summary.Total > 0 {
+		benchmark.Transit.AverageTransitHours = roundHundredths(summary.TripHours / float64(summary.Total))
+		benchmark.Transit.OnTimePercentage = roundHundredths(float64(summary.OnTime) / float64(summary.Total) * 100)
+	}
+	if summary.Late > 0 {
+		benchmark.Transit.AverageDelay = roundHundredths(summary.LateMinutes / float64(summary.Late))
+	}
+	return benchmark, nil
+}
+
+// laneLoads selects the loads picked up and delivered on a lane
+func (as *AnalyticsService) laneLoads(lane Lane) *gorm.DB {
+	query := as.db.Model(&models.Load{}).
+		Where("UPPER(TRIM(pickup_city)) = ? AND UPPER(TRIM(delivery_city)) = ?",
+			normalizeLanePlace(lane.OriginCity), normalizeLanePlace(lane.DestinationCity))
+	if lane.OriginCountry != "" {
+		query = query.Where("UPPER(TRIM(pickup_country)) = ?", normalizeLanePlace(lane.OriginCountry))
+	}
+	if lane.DestinationCountry != "" {
+		query = query.Where("UPPER(TRIM(delivery_country)) = ?", normalizeLanePlace(lane.DestinationCountry))
+	}
+	return query
+}
+
+// loadWeights returns the weight of the loads quoted for by load ID
+func (as *AnalyticsService) loadWeights(quotes []models.Quote) (map[uint]float64, error) {
+	weights := make(map[uint]float64)
+	if len(quotes) == 0 {
+		return weights, nil
+	}
+
+	loadIDs := make([]uint, 0, len(quotes))
+	for _, quote := range quotes {
+		loadIDs = append(loadIDs, quote.LoadID)
+	}
+	var loads []models.Load
+	if err := as.db.Select("id", "weight").Where("id IN ?", loadIDs).Find(&loads).Error; err != nil {
+		return nil, fmt.Errorf("failed to get quoted loads: %w", err)
+	}
+	for _, load := range loads {
+		weights[load.ID] = load.Weight
+	}
+	return weights, nil
+}
+
+// matches reports whether a trip's places are on the lane
+func (lane Lane) matches(originCity, originCountry, destinationCity, destinationCountry string) bool {
+	if normalizeLanePlace(originCity) != normalizeLanePlace(lane.OriginCity) ||
+		normalizeLanePlace(destinationCity) != normalizeLanePlace(lane.DestinationCity) {
+		return false
+	}
+	if lane.OriginCountry != "" && normalizeLanePlace(originCountry) != normalizeLanePlace(lane.OriginCountry) {
+		return false
+	}
+	return lane.DestinationCountry == "" || normalizeLanePlace(destinationCountry) == normalizeLanePlace(lane.DestinationCountry)
+}
+
+func normalizeLanePlace(value string) string {
+	return strings.ToUpper(strings.TrimSpace(value))
+}
+
+// quoteAmountIn returns a quote's amount in the given currency, at the rate
+// stored with the quote when it was normalized to that currency
+func quoteAmountIn(quote *models.Quote, currency string) (float64, error) {
+	if quote.BaseCurrency == currency && quote.ExchangeRate > 0 {
+		return roundHundredths(quote.BaseAmount), nil
+	}
+	return laneAmountIn(quote.QuoteAmount, quote.Currency, currency)
+}
+
+// laneAmountIn converts an amount to the given currency at the current rate
+func laneAmountIn(amount float64, from, currency string) (float64, error) {
+	if from == "" {
+		from = "USD"
+	}
+	if strings.EqualFold(from, currency) {
+		return amount, nil
+	}
+	return GetCurrencyService().Convert(amount, from, currency)
+}
+
+// summarizeLanePrices returns the statistics of prices on a lane
+func summarizeLanePrices(prices []lanePrice) LanePriceStats {
+	stats := LanePriceStats{Count: len(prices)}
+	if len(prices) == 0 {
+		return stats
+	}
+
+	amounts := make([]float64, len(prices))
+	var total, weighedTotal, weight float64
+	for i, price := range prices {
+		amounts[i] = price.amount
+		total += price.amount
+		if price.weight > 0 {
+			weighedTotal += price.amount
+			weight += price.weight
+		}
+	}
+	sort.Float64s(amounts)
+
+	stats.Average = roundHundredths(total / float64(len(prices)))
+	stats.Median = roundHundredths(percentile(amounts, 50))
+	stats.Min = amounts[0]
+	stats.Max = amounts[len(amounts)-1]
+	if weight > 0 {
+		stats.AveragePerKg = roundHundredths(weighedTotal / weight)
+	}
+	return stats
+}
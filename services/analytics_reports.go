@@ -0,0 +1,261 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Analytics report names
+const (
+	ReportOnTimeDelivery      = "on-time-delivery"
+	ReportDelayIncidents      = "delay-incidents"
+	ReportCapacityUtilization = "capacity-utilization"
+)
+
+// AnalyticsReports lists the exportable reports in workbook sheet order
+var AnalyticsReports = []string{ReportOnTimeDelivery, ReportDelayIncidents, ReportCapacityUtilization}
+
+// ReportTable is an analytics report as rows for export. Cells are strings,
+// numbers, bools, times or nil.
+type ReportTable struct {
+	Name    string
+	Title   string
+	Headers []string
+	Rows    [][]interface{}
+}
+
+// CSV encodes the report with a header row
+func (t *ReportTable) CSV() ([]byte, error) {
+	var out bytes.Buffer
+	writer := csv.NewWriter(&out)
+	if err := writer.Write(t.Headers); err != nil {
+		return nil, fmt.Errorf("failed to write report: %w", err)
+	}
+
+	record := make([]string, len(t.Headers))
+	for _, row := range t.Rows {
+		record = record[:0]
+		for _, value := range row {
+			text := formatReportValue(value)
+			// Keep spreadsheets from evaluating text as a formula
+			if _, isText := value.(string); isText && text != "" && strings.ContainsRune("=+-@", rune(text[0])) {
+				text = "'" + text
+			}
+			record = append(record, text)
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write report: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// ReportsXLSX encodes reports as a workbook with a sheet per report
+func ReportsXLSX(tables ...*ReportTable) ([]byte, error) {
+	workbook := NewXLSXWriter()
+	for _, table := range tables {
+		workbook.AddSheet(table.Title, table.Headers, table.Rows)
+	}
+	return workbook.Bytes()
+}
+
+// GetReportTable builds an analytics report for export
+func (as *AnalyticsService) GetReportTable(report string, filter AnalyticsFilter) (*ReportTable, error) {
+	switch report {
+	case ReportOnTimeDelivery:
+		return as.onTimeDeliveryReport(filter)
+	case ReportDelayIncidents:
+		return as.delayIncidentsReport(filter)
+	case ReportCapacityUtilization:
+		return as.capacityUtilizationReport(filter)
+	default:
+		return nil, fmt.Errorf("unknown report %q", report)
+	}
+}
+
+// onTimeDeliveryReport lists the arrival of every completed trip
+func (as *AnalyticsService) onTimeDeliveryReport(filter AnalyticsFilter) (*ReportTable, error) {
+	trips, err := as.completedTrips(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &ReportTable{
+		Name:  ReportOnTimeDelivery,
+		Title: "On-Time Delivery",
+		Headers: []string{"Trip ID", "Carrier ID", "Vehicle ID", "Origin", "Destination",
+			"Departure", "Estimated Arrival", "Actual Arrival", "Delay (min)", "Status"},
+	}
+	for _, trip := range trips {
+		delay := trip.ActualArrival.Sub(trip.EstimatedArrival)
+		table.Rows = append(table.Rows, []interface{}{
+			trip.ID, trip.UserID, trip.VehicleID,
+			tripPlaceName(trip.OriginCity, trip.OriginCountry),
+			tripPlaceName(trip.DestinationCity, trip.DestinationCountry),
+			tripDepartureTime(trip), trip.EstimatedArrival, trip.ActualArrival,
+			roundReportValue(delay.Minutes()), classifyDelivery(delay),
+		})
+	}
+	return table, nil
+}
+
+// delayIncidentsReport lists the completed trips that arrived late
+func (as *AnalyticsService) delayIncidentsReport(filter AnalyticsFilter) (*ReportTable, error) {
+	trips, err := as.completedTrips(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &ReportTable{
+		Name:  ReportDelayIncidents,
+		Title: "Delay Incidents",
+		Headers: []string{"Trip ID", "Carrier ID", "Vehicle ID", "Origin", "Destination",
+			"Estimated Arrival", "Actual Arrival", "Delay (min)", "Severity"},
+	}
+	for _, trip := range trips {
+		delay := trip.ActualArrival.Sub(trip.EstimatedArrival)
+		if classifyDelivery(delay) != DeliveryLate {
+			continue
+		}
+		table.Rows = append(table.Rows, []interface{}{
+			trip.ID, trip.UserID, trip.VehicleID,
+			tripPlaceName(trip.OriginCity, trip.OriginCountry),
+			tripPlaceName(trip.DestinationCity, trip.DestinationCountry),
+			trip.EstimatedArrival, trip.ActualArrival,
+			roundReportValue(delay.Minutes()), delaySeverity(delay),
+		})
+	}
+	return table, nil
+}
+
+// capacityUtilizationReport lists the current utilization of each active vehicle
+func (as *AnalyticsService) capacityUtilizationReport(filter AnalyticsFilter) (*ReportTable, error) {
+	vehicles, err := as.GetVehicleCapacity(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &ReportTable{
+		Name:  ReportCapacityUtilization,
+		Title: "Capacity Utilization",
+		Headers: []string{"Vehicle ID", "License Plate", "Vehicle Type", "Max Capacity (kg)", "Max Volume (m3)",
+			"Current Load (kg)", "Current Volume (m3)", "Weight Utilization (%)", "Volume Utilization (%)",
+			"Overall Utilization (%)", "Completed Trips", "Efficiency", "Status"},
+	}
+	for _, vehicle := range vehicles {
+		table.Rows = append(table.Rows, []interface{}{
+			vehicle.VehicleID, vehicle.VehicleNumber, vehicle.VehicleType,
+			vehicle.MaxCapacity, vehicle.MaxVolume, vehicle.CurrentLoad, vehicle.CurrentVolume,
+			roundReportValue(vehicle.WeightUtilization), roundReportValue(vehicle.VolumeUtilization),
+			roundReportValue(vehicle.OverallUtilization), vehicle.Trips, vehicle.Efficiency, vehicle.Status,
+		})
+	}
+	return table, nil
+}
+
+// delaySeverity rates a late arrival by its delay
+func delaySeverity(delay time.Duration) string {
+	switch {
+	case delay > criticalDelayThreshold:
+		return "CRITICAL"
+	case delay > time.Hour:
+		return "MAJOR"
+	default:
+		return "MINOR"
+	}
+}
+
+func roundReportValue(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// formatReportValue formats a report cell as text. Times are written in
+// RFC3339 in UTC.
+func formatReportValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return formatReportValue(*v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// PDF renders the report as a table on A4 pages, with subtitle (e.g. the
+// reporting period) under the title
+func (t *ReportTable) PDF(subtitle string) []byte {
+	pdf := NewPDFWriter()
+	const left, right, bottom = 30.0, pdfPageWidth - 30, 50.0
+	const rowHeight, fontSize = 11.0, 6.0
+
+	columnWidth := (right - left) / float64(max(len(t.Headers), 1))
+
+	pdf.AddPage()
+	y := pdfPageHeight - 50
+	pdf.Text(left, y, 16, true, t.Title)
+	y -= 16
+	if subtitle != "" {
+		pdf.Text(left, y, 9, false, subtitle)
+		y -= 20
+	}
+
+	drawHeader := func() {
+		for i, header := range t.Headers {
+			pdf.Text(left+float64(i)*columnWidth, y, fontSize, true, pdfTruncate(header, columnWidth-3, fontSize))
+		}
+		pdf.Line(left, y-4, right, y-4)
+		y -= rowHeight + 2
+	}
+	drawHeader()
+
+	if len(t.Rows) == 0 {
+		pdf.Text(left, y, 8, false, "No data for this period")
+	}
+	for _, row := range t.Rows {
+		if y < bottom {
+			pdf.AddPage()
+			y = pdfPageHeight - 50
+			drawHeader()
+		}
+		for i, value := range row {
+			pdf.Text(left+float64(i)*columnWidth, y, fontSize, false, pdfTruncate(pdfReportValue(value), columnWidth-3, fontSize))
+		}
+		y -= rowHeight
+	}
+	return pdf.Bytes()
+}
+
+// pdfReportValue formats a report cell for a PDF table. Times are shortened
+// to minutes so they fit the narrow columns.
+func pdfReportValue(value interface{}) string {
+	if at, ok := value.(*time.Time); ok && at != nil {
+		value = *at
+	}
+	if at, ok := value.(time.Time); ok && !at.IsZero() {
+		return at.UTC().Format("2006-01-02 15:04")
+	}
+	return formatReportValue(value)
+}
@@ -0,0 +1,1111 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// onTimeWindow is how far an arrival may be from its estimate and still
+	// count as on time
+	onTimeWindow = 30 * time.Minute
+
+	// criticalDelayThreshold marks deliveries late enough to need follow-up
+	criticalDelayThreshold = 2 * time.Hour
+
+	// satisfactionPeriod is the period customer satisfaction trends over when
+	// no start date is given
+	satisfactionPeriod = 90 * 24 * time.Hour
+
+	// trendThreshold is the change in on-time percentage points from the
+	// previous period that counts as improving or declining
+	trendThreshold = 5.0
+)
+
+// Delivery classifications
+const (
+	DeliveryOnTime = "ON_TIME"
+	DeliveryEarly  = "EARLY"
+	DeliveryLate   = "LATE"
+)
+
+// AnalyticsFilter limits the records included in analytics
+type AnalyticsFilter struct {
+	From        *time.Time `json:"from,omitempty"`
+	To          *time.Time `json:"to,omitempty"`
+	VehicleIDs  []uint     `json:"vehicle_ids,omitempty"`
+	DriverIDs   []uint     `json:"driver_ids,omitempty"`
+	RouteIDs    []string   `json:"route_ids,omitempty"`
+	CustomerIDs []uint     `json:"customer_ids,omitempty"`
+	// Currency revenue is reported in, defaulting to the base currency
+	Currency string `json:"currency,omitempty"`
+	// Limits analytics to what a user can see; nil covers the whole platform
+	Scope *OrganizationScope `json:"scope,omitempty"`
+}
+
+// On-Time Delivery Analytics
+type OnTimeDeliveryMetrics struct {
+	TotalDeliveries     int     `json:"total_deliveries"`
+	OnTimeDeliveries    int     `json:"on_time_deliveries"`
+	OnTimePercentage    float64 `json:"on_time_percentage"`
+	AverageDelay        float64 `json:"average_delay"` // minutes
+	EarlyDeliveries     int     `json:"early_deliveries"`
+	LateDeliveries      int     `json:"late_deliveries"`
+	CriticalDelays      int     `json:"critical_delays"`
+	AverageDeliveryTime float64 `json:"average_delivery_time"` // hours
+	OnTimeImprovement   float64 `json:"on_time_improvement"`   // percentage change
+}
+
+type DeliveryPerformanceByRoute struct {
+	RouteID          string  `json:"route_id"`
+	RouteName        string  `json:"route_name"`
+	Origin           string  `json:"origin"`
+	Destination      string  `json:"destination"`
+	Distance         float64 `json:"distance"` // average straight-line km
+	TotalDeliveries  int     `json:"total_deliveries"`
+	OnTimeDeliveries int     `json:"on_time_deliveries"`
+	OnTimePercentage float64 `json:"on_time_percentage"`
+	AverageDelay     float64 `json:"average_delay"`
+	Improvement      float64 `json:"improvement"` // on-time percentage points vs previous period
+	RiskLevel        string  `json:"risk_level"`
+}
+
+type DeliveryPerformanceByDriver struct {
+	DriverID          string  `json:"driver_id"`
+	DriverName        string  `json:"driver_name"`
+	TotalDeliveries   int     `json:"total_deliveries"`
+	OnTimeDeliveries  int     `json:"on_time_deliveries"`
+	OnTimePercentage  float64 `json:"on_time_percentage"`
+	AverageDelay      float64 `json:"average_delay"`
+	EarlyDeliveries   int     `json:"early_deliveries"`
+	LateDeliveries    int     `json:"late_deliveries"`
+	PerformanceRating float64 `json:"performance_rating"`
+	ImprovementTrend  string  `json:"improvement_trend"`
+	// Safety score from the driver's tracking data over the period, nil
+	// when they drove too little to be scored
+	SafetyScore         *float64 `json:"safety_score"`
+	TrainingRecommended bool     `json:"training_recommended"`
+}
+
+// Customer Satisfaction Analytics, from shippers' feedback on delivered loads
+type CustomerSatisfactionMetrics struct {
+	OverallScore   float64 `json:"overall_score"` // average rating, 1-5
+	TotalResponses int     `json:"total_responses"`
+	// Percentage of the loads delivered in the period that were given feedback
+	ResponseRate float64 `json:"response_rate"`
+	// Change in the average rating from the previous period of the same length
+	ScoreImprovement      float64 `json:"score_improvement"`
+	NPSScore              int     `json:"nps_score"`
+	SatisfiedCustomers    int     `json:"satisfied_customers"`
+	NeutralCustomers      int     `json:"neutral_customers"`
+	DissatisfiedCustomers int     `json:"dissatisfied_customers"`
+	// Percentage of the previous period's shippers that booked again in the
+	// period, and of those that didn't
+	RetentionRate       float64 `json:"retention_rate"`
+	ChurnRate           float64 `json:"churn_rate"`
+	AverageResponseTime float64 `json:"average_response_time"` // hours from feedback to its resolution
+	// Percentage of negative feedback that carriers resolved
+	ResolutionRate float64 `json:"resolution_rate"`
+
+	// Feedback comments by the sentiment and topic found by analysis
+	PositiveFeedback int                     `json:"positive_feedback"`
+	NeutralFeedback  int                     `json:"neutral_feedback"`
+	NegativeFeedback int                     `json:"negative_feedback"`
+	PendingAnalysis  int                     `json:"pending_analysis"`
+	Categories       []FeedbackCategoryCount `json:"categories"`
+}
+
+// FeedbackCategoryCount is how many feedback comments were about a topic
+type FeedbackCategoryCount struct {
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+	Negative int    `json:"negative"`
+}
+
+// Load Matching Analytics
+type LoadMatchingMetrics struct {
+	TotalLoads             int     `json:"total_loads"`
+	MatchedLoads           int     `json:"matched_loads"`
+	MatchingRate           float64 `json:"matching_rate"`
+	AverageMatchTime       float64 `json:"average_match_time"` // hours
+	OptimalMatches         int     `json:"optimal_matches"`
+	SuboptimalMatches      int     `json:"suboptimal_matches"`
+	UnmatchedLoads         int     `json:"unmatched_loads"`
+	UtilizationRate        float64 `json:"utilization_rate"`
+	RevenueEfficiency      float64 `json:"revenue_efficiency"`
+	CostEfficiency         float64 `json:"cost_efficiency"`
+	ImprovementOpportunity float64 `json:"improvement_opportunity"`
+}
+
+// Capacity Utilization Analytics
+type CapacityMetrics struct {
+	TotalCapacity          float64 `json:"total_capacity"`
+	UtilizedCapacity       float64 `json:"utilized_capacity"`
+	UtilizationRate        float64 `json:"utilization_rate"`
+	AvailableCapacity      float64 `json:"available_capacity"`
+	PeakUtilization        float64 `json:"peak_utilization"`
+	AverageUtilization     float64 `json:"average_utilization"`
+	CapacityEfficiency     float64 `json:"capacity_efficiency"`
+	RevenuePerCapacityUnit float64 `json:"revenue_per_capacity_unit"`
+	CostPerCapacityUnit    float64 `json:"cost_per_capacity_unit"`
+	CapacityTrend          string  `json:"capacity_trend"`
+	DemandVsCapacity       float64 `json:"demand_vs_capacity"`
+	ForecastedDemand       float64 `json:"forecasted_demand"`
+}
+
+type VehicleCapacityData struct {
+	VehicleID          string    `json:"vehicle_id"`
+	VehicleNumber      string    `json:"vehicle_number"`
+	VehicleType        string    `json:"vehicle_type"`
+	MaxCapacity        float64   `json:"max_capacity"`
+	MaxVolume          float64   `json:"max_volume"`
+	CurrentLoad        float64   `json:"current_load"`
+	CurrentVolume      float64   `json:"current_volume"`
+	WeightUtilization  float64   `json:"weight_utilization"`
+	VolumeUtilization  float64   `json:"volume_utilization"`
+	OverallUtilization float64   `json:"overall_utilization"`
+	Trips              int       `json:"trips"`
+	Revenue            float64   `json:"revenue"`
+	OperatingCosts     float64   `json:"operating_costs"`
+	Profitability      float64   `json:"profitability"`
+	Efficiency         string    `json:"efficiency"`
+	Location           string    `json:"location"`
+	Status             string    `json:"status"`
+	LastUpdated        time.Time `json:"last_updated"`
+	UtilizationTrend   string    `json:"utilization_trend"`
+}
+
+// Delay Analysis Analytics
+type DelayMetrics struct {
+	TotalDelays            int     `json:"total_delays"`
+	AverageDelayDuration   float64 `json:"average_delay_duration"` // minutes
+	DelayFrequency         float64 `json:"delay_frequency"`        // delays per 100 trips
+	TotalDelayTime         float64 `json:"total_delay_time"`       // total minutes lost
+	CostOfDelays           float64 `json:"cost_of_delays"`
+	CustomerImpact         float64 `json:"customer_impact"`
+	OnTimePerformance      float64 `json:"on_time_performance"`
+	DelayTrend             string  `json:"delay_trend"`
+	RecurrentDelays        int     `json:"recurrent_delays"`
+	PreventableDelays      int     `json:"preventable_delays"`
+	MitigatedDelays        int     `json:"mitigated_delays"`
+	ImprovementOpportunity float64 `json:"improvement_opportunity"`
+}
+
+// deliverySummary aggregates the arrivals of completed trips
+type deliverySummary struct {
+	Total    int
+	OnTime   int
+	Early    int
+	Late     int
+	Critical int
+
+	// Trips arriving after their estimate by any amount, and their delay
+	DelayedTrips   int
+	DelayedMinutes float64
+
+	// Delay of the trips counted as late
+	LateMinutes float64
+
+	TripHours float64
+}
+
+// AnalyticsService computes operational analytics. Records are selected with
+// plain GORM queries and time arithmetic is done in Go, so the same code runs
+// on Postgres and SQLite.
+type AnalyticsService struct {
+	db      *gorm.DB
+	scoring *DriverScoringService
+}
+
+// NewAnalyticsService creates a new analytics service
+func NewAnalyticsService(db *gorm.DB) *AnalyticsService {
+	return &AnalyticsService{db: db, scoring: NewDriverScoringService(db, config.GetDriverScoringConfig())}
+}
+
+// GetOnTimeDeliveryMetrics summarizes the arrivals of completed trips
+func (as *AnalyticsService) GetOnTimeDeliveryMetrics(filter AnalyticsFilter) (*OnTimeDeliveryMetrics, error) {
+	trips, err := as.completedTrips(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := summarizeDeliveries(trips)
+	metrics := &OnTimeDeliveryMetrics{
+		TotalDeliveries:   summary.Total,
+		OnTimeDeliveries:  summary.OnTime,
+		EarlyDeliveries:   summary.Early,
+		LateDeliveries:    summary.Late,
+		CriticalDelays:    summary.Critical,
+		OnTimeImprovement: 0, // Calculate trend
+	}
+	if summary.Total > 0 {
+		metrics.OnTimePercentage = float64(summary.OnTime) / float64(summary.Total) * 100
+		metrics.AverageDeliveryTime = summary.TripHours / float64(summary.Total)
+	}
+	if summary.DelayedTrips > 0 {
+		metrics.AverageDelay = summary.DelayedMinutes / float64(summary.DelayedTrips)
+	}
+	return metrics, nil
+}
+
+// GetRoutePerformance summarizes the arrivals of completed trips per
+// origin/destination corridor, busiest corridor first. Corridors are compared
+// with the period of the same length before the filter's date range.
+func (as *AnalyticsService) GetRoutePerformance(filter AnalyticsFilter) ([]DeliveryPerformanceByRoute, error) {
+	trips, err := as.completedTrips(filter)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := as.previousOnTimePercentages(filter, tripCorridorKey)
+	if err != nil {
+		return nil, err
+	}
+
+	tripsByCorridor := make(map[string][]models.Trip)
+	for _, trip := range trips {
+		key := tripCorridorKey(trip)
+		tripsByCorridor[key] = append(tripsByCorridor[key], trip)
+	}
+
+	routes := []DeliveryPerformanceByRoute{}
+	for key, corridorTrips := range tripsByCorridor {
+		summary := summarizeDeliveries(corridorTrips)
+		first := corridorTrips[0]
+		origin := tripPlaceName(first.OriginCity, first.OriginCountry)
+		destination := tripPlaceName(first.DestinationCity, first.DestinationCountry)
+
+		var distance float64
+		for _, trip := range corridorTrips {
+			distance += geo.Distance(trip.OriginLat, trip.OriginLng, trip.DestinationLat, trip.DestinationLng)
+		}
+
+		route := DeliveryPerformanceByRoute{
+			RouteID:          key,
+			RouteName:        fmt.Sprintf("%s - %s", origin, destination),
+			Origin:           origin,
+			Destination:      destination,
+			Distance:         distance / float64(len(corridorTrips)),
+			TotalDeliveries:  summary.Total,
+			OnTimeDeliveries: summary.OnTime,
+		}
+		if summary.Total > 0 {
+			route.OnTimePercentage = float64(summary.OnTime) / float64(summary.Total) * 100
+			route.AverageDelay = summary.DelayedMinutes / float64(summary.Total)
+		}
+		if before, ok := previous[key]; ok {
+			route.Improvement = route.OnTimePercentage - before
+		}
+		route.RiskLevel = routeRiskLevel(route.OnTimePercentage, route.Improvement)
+		routes = append(routes, route)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].TotalDeliveries != routes[j].TotalDeliveries {
+			return routes[i].TotalDeliveries > routes[j].TotalDeliveries
+		}
+		return routes[i].RouteID < routes[j].RouteID
+	})
+	return routes, nil
+}
+
+// GetDriverPerformance summarizes the arrivals of each carrier's completed trips
+func (as *AnalyticsService) GetDriverPerformance(filter AnalyticsFilter) ([]DeliveryPerformanceByDriver, error) {
+	trips, err := as.completedTrips(filter)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := as.previousOnTimePercentages(filter, tripDriverKey)
+	if err != nil {
+		return nil, err
+	}
+
+	tripsByDriver := make(map[uint][]models.Trip)
+	for _, trip := range trips {
+		tripsByDriver[trip.UserID] = append(tripsByDriver[trip.UserID], trip)
+	}
+
+	drivers := []DeliveryPerformanceByDriver{}
+	if len(tripsByDriver) == 0 {
+		return drivers, nil
+	}
+
+	driverIDs := make([]uint, 0, len(tripsByDriver))
+	for id := range tripsByDriver {
+		driverIDs = append(driverIDs, id)
+	}
+
+	var users []models.User
+	if err := as.db.Where("id IN ? AND role = ?", driverIDs, "CARRIER").
+		Order("id ASC").
+		Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to get drivers: %w", err)
+	}
+
+	from, to := as.scoring.Period(filter.From, filter.To)
+	scorecards, err := as.scoring.Scorecards(driverIDs, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		summary := summarizeDeliveries(tripsByDriver[user.ID])
+
+		var onTimePercentage, averageDelay float64
+		if summary.Total > 0 {
+			onTimePercentage = float64(summary.OnTime) / float64(summary.Total) * 100
+			averageDelay = summary.DelayedMinutes / float64(summary.Total)
+		}
+
+		trend := "stable"
+		if before, ok := previous[fmt.Sprintf("%d", user.ID)]; ok {
+			trend = performanceTrend(onTimePercentage - before)
+		}
+
+		// Drivers without enough tracked driving to score fall back to their
+		// punctuality
+		scorecard := scorecards[user.ID]
+		trainingRecommended := onTimePercentage < 80
+		if scorecard.Score != nil {
+			trainingRecommended = scorecard.TrainingRecommended
+		}
+
+		drivers = append(drivers, DeliveryPerformanceByDriver{
+			DriverID:            fmt.Sprintf("%d", user.ID),
+			DriverName:          strings.TrimSpace(user.FirstName + " " + user.LastName),
+			TotalDeliveries:     summary.Total,
+			OnTimeDeliveries:    summary.OnTime,
+			OnTimePercentage:    onTimePercentage,
+			AverageDelay:        averageDelay,
+			EarlyDeliveries:     summary.Early,
+			LateDeliveries:      summary.Late,
+			PerformanceRating:   user.Rating,
+			ImprovementTrend:    trend,
+			SafetyScore:         scorecard.Score,
+			TrainingRecommended: trainingRecommended,
+		})
+	}
+
+	return drivers, nil
+}
+
+// GetDelayMetrics summarizes the completed trips that arrived late
+func (as *AnalyticsService) GetDelayMetrics(filter AnalyticsFilter) (*DelayMetrics, error) {
+	trips, err := as.completedTrips(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := summarizeDeliveries(trips)
+	metrics := &DelayMetrics{
+		TotalDelays:            summary.Late,
+		TotalDelayTime:         summary.LateMinutes,
+		CostOfDelays:           85000,       // Mock data - calculate based on delay cost
+		CustomerImpact:         23.5,        // Mock data
+		DelayTrend:             "improving", // Mock data - calculate trend
+		RecurrentDelays:        89,          // Mock data
+		PreventableDelays:      156,         // Mock data
+		MitigatedDelays:        67,          // Mock data
+		ImprovementOpportunity: 32.4,        // Mock data
+	}
+	if summary.Late > 0 {
+		metrics.AverageDelayDuration = summary.LateMinutes / float64(summary.Late)
+	}
+	if summary.Total > 0 {
+		metrics.DelayFrequency = float64(summary.Late) / float64(summary.Total) * 100
+		metrics.OnTimePerformance = float64(summary.OnTime) / float64(summary.Total) * 100
+	}
+	return metrics, nil
+}
+
+// GetCustomerSatisfactionMetrics summarizes shippers' feedback on delivered
+// loads. Without a start date, the score trend and retention compare the last
+// satisfactionPeriod with the one before.
+func (as *AnalyticsService) GetCustomerSatisfactionMetrics(filter AnalyticsFilter) (*CustomerSatisfactionMetrics, error) {
+	var feedback []models.Feedback
+	if err := as.feedbackQuery(filter, filter.From, filter.To).
+		Select("id, created_at, rating, recommend_score, analysis_status, sentiment, category, resolved_at").
+		Find(&feedback).Error; err != nil {
+		return nil, fmt.Errorf("failed to get feedback: %w", err)
+	}
+
+	metrics := &CustomerSatisfactionMetrics{
+		TotalResponses: len(feedback),
+		Categories:     []FeedbackCategoryCount{},
+	}
+
+	total, recommendations, promoters, detractors := 0, 0, 0, 0
+	negative, resolvedNegative, resolved := 0, 0, 0
+	var resolutionHours float64
+	categories := map[string]*FeedbackCategoryCount{}
+	for _, f := range feedback {
+		total += f.Rating
+		switch {
+		case f.Rating >= 4:
+			metrics.SatisfiedCustomers++
+		case f.Rating == 3:
+			metrics.NeutralCustomers++
+		default:
+			metrics.DissatisfiedCustomers++
+		}
+		if f.RecommendScore != nil {
+			recommendations++
+			if *f.RecommendScore >= 9 {
+				promoters++
+			} else if *f.RecommendScore <= 6 {
+				detractors++
+			}
+		}
+		if f.ResolvedAt != nil {
+			resolved++
+			resolutionHours += f.ResolvedAt.Sub(f.CreatedAt).Hours()
+		}
+
+		switch f.AnalysisStatus {
+		case FeedbackPending:
+			metrics.PendingAnalysis++
+			continue
+		case FeedbackAnalyzed:
+		default:
+			continue
+		}
+		switch f.Sentiment {
+		case SentimentPositive:
+			metrics.PositiveFeedback++
+		case SentimentNegative:
+			metrics.NegativeFeedback++
+		default:
+			metrics.NeutralFeedback++
+		}
+		count, ok := categories[f.Category]
+		if !ok {
+			count = &FeedbackCategoryCount{Category: f.Category}
+			categories[f.Category] = count
+		}
+		count.Count++
+		if f.Sentiment == SentimentNegative {
+			count.Negative++
+			negative++
+			if f.ResolvedAt != nil {
+				resolvedNegative++
+			}
+		}
+	}
+	for _, count := range categories {
+		metrics.Categories = append(metrics.Categories, *count)
+	}
+	sort.Slice(metrics.Categories, func(i, j int) bool {
+		if metrics.Categories[i].Count != metrics.Categories[j].Count {
+			return metrics.Categories[i].Count > metrics.Categories[j].Count
+		}
+		return metrics.Categories[i].Category < metrics.Categories[j].Category
+	})
+
+	if len(feedback) > 0 {
+		metrics.OverallScore = float64(total) / float64(len(feedback))
+		if recommendations > 0 {
+			// Promoters answer 9-10 and detractors 0-6
+			metrics.NPSScore = int(math.Round(float64(promoters-detractors) / float64(recommendations) * 100))
+		} else {
+			// Without recommendation scores, promoters rate 4-5 and
+			// detractors 1-2
+			metrics.NPSScore = int(math.Round(float64(metrics.SatisfiedCustomers-metrics.DissatisfiedCustomers) / float64(len(feedback)) * 100))
+		}
+	}
+	if resolved > 0 {
+		metrics.AverageResponseTime = resolutionHours / float64(resolved)
+	}
+	if negative > 0 {
+		metrics.ResolutionRate = float64(resolvedNegative) / float64(negative) * 100
+	}
+
+	responseRate, err := as.feedbackResponseRate(filter)
+	if err != nil {
+		return nil, err
+	}
+	metrics.ResponseRate = responseRate
+
+	end := time.Now()
+	if filter.To != nil {
+		end = *filter.To
+	}
+	start := end.Add(-satisfactionPeriod)
+	if filter.From != nil {
+		start = *filter.From
+	}
+	previousStart := start.Add(-end.Sub(start))
+
+	current, err := as.averageRating(filter, start, end)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := as.averageRating(filter, previousStart, start)
+	if err != nil {
+		return nil, err
+	}
+	if current > 0 && previous > 0 {
+		metrics.ScoreImprovement = current - previous
+	}
+
+	retention, err := as.shipperRetention(filter, previousStart, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if retention >= 0 {
+		metrics.RetentionRate = retention
+		metrics.ChurnRate = 100 - retention
+	}
+	return metrics, nil
+}
+
+// feedbackQuery returns the query of the feedback submitted between from and
+// to that the filter covers
+func (as *AnalyticsService) feedbackQuery(filter AnalyticsFilter, from, to *time.Time) *gorm.DB {
+	query := as.db.Model(&models.Feedback{}).Where("deleted_at IS NULL")
+	if from != nil {
+		query = query.Where("created_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("created_at <= ?", *to)
+	}
+	if len(filter.CustomerIDs) > 0 {
+		query = query.Where("shipper_id IN ?", filter.CustomerIDs)
+	}
+	if filter.Scope != nil {
+		query = query.Where("load_id IN (?)", as.scopedLoadIDs(filter.Scope))
+	}
+	return query
+}
+
+// averageRating returns the average rating of the feedback submitted between
+// from and to, or 0 without any
+func (as *AnalyticsService) averageRating(filter AnalyticsFilter, from, to time.Time) (float64, error) {
+	var average *float64
+	if err := as.feedbackQuery(filter, &from, nil).Where("created_at < ?", to).
+		Select("AVG(rating)").Scan(&average).Error; err != nil {
+		return 0, fmt.Errorf("failed to average ratings: %w", err)
+	}
+	if average == nil {
+		return 0, nil
+	}
+	return *average, nil
+}
+
+// feedbackResponseRate returns the percentage of the loads delivered in the
+// period that were given feedback
+func (as *AnalyticsService) feedbackResponseRate(filter AnalyticsFilter) (float64, error) {
+	query := as.db.Model(&models.Load{}).Where("status = ?", "DELIVERED")
+	if filter.From != nil {
+		query = query.Where("actual_delivery_date >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("actual_delivery_date <= ?", *filter.To)
+	}
+	if len(filter.CustomerIDs) > 0 {
+		query = query.Where("shipper_id IN ?", filter.CustomerIDs)
+	}
+	if filter.Scope != nil {
+		query = query.Where("id IN (?)", as.scopedLoadIDs(filter.Scope))
+	}
+
+	var delivered, responded int64
+	if err := query.Session(&gorm.Session{}).Count(&delivered).Error; err != nil {
+		return 0, fmt.Errorf("failed to count delivered loads: %w", err)
+	}
+	if delivered == 0 {
+		return 0, nil
+	}
+	if err := query.Session(&gorm.Session{}).
+		Where("id IN (?)", as.db.Model(&models.Feedback{}).Select("load_id").Where("deleted_at IS NULL")).
+		Count(&responded).Error; err != nil {
+		return 0, fmt.Errorf("failed to count loads with feedback: %w", err)
+	}
+	return float64(responded) / float64(delivered) * 100, nil
+}
+
+// shipperRetention returns the percentage of the shippers that booked loads
+// between previousStart and start that booked again between start and end,
+// or -1 when none booked before
+func (as *AnalyticsService) shipperRetention(filter AnalyticsFilter, previousStart, start, end time.Time) (float64, error) {
+	shippers := func(from, to time.Time) *gorm.DB {
+		query := as.db.Model(&models.Load{}).Where("created_at >= ? AND created_at < ?", from, to)
+		if len(filter.CustomerIDs) > 0 {
+			query = query.Where("shipper_id IN ?", filter.CustomerIDs)
+		}
+		if filter.Scope != nil {
+			query = query.Where("id IN (?)", as.scopedLoadIDs(filter.Scope))
+		}
+		return query
+	}
+
+	var previous, retained int64
+	if err := shippers(previousStart, start).Distinct("shipper_id").Count(&previous).Error; err != nil {
+		return 0, fmt.Errorf("failed to count shippers: %w", err)
+	}
+	if previous == 0 {
+		return -1, nil
+	}
+	if err := shippers(start, end.Add(time.Nanosecond)).
+		Where("shipper_id IN (?)", shippers(previousStart, start).Select("shipper_id")).
+		Distinct("shipper_id").Count(&retained).Error; err != nil {
+		return 0, fmt.Errorf("failed to count returning shippers: %w", err)
+	}
+	return float64(retained) / float64(previous) * 100, nil
+}
+
+// GetLoadMatchingMetrics summarizes how many loads were booked on a trip
+func (as *AnalyticsService) GetLoadMatchingMetrics(filter AnalyticsFilter) (*LoadMatchingMetrics, error) {
+	query := as.db.Model(&models.Load{})
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at <= ?", *filter.To)
+	}
+	if len(filter.CustomerIDs) > 0 {
+		query = query.Where("shipper_id IN ?", filter.CustomerIDs)
+	}
+	if filter.Scope != nil {
+		query = query.Where("id IN (?)", as.scopedLoadIDs(filter.Scope))
+	}
+
+	var totalLoads, matchedLoads int64
+	if err := query.Session(&gorm.Session{}).Count(&totalLoads).Error; err != nil {
+		return nil, fmt.Errorf("failed to count loads: %w", err)
+	}
+	// Unbooked loads have no trip, stored as 0
+	if err := query.Session(&gorm.Session{}).Where("trip_id <> 0").Count(&matchedLoads).Error; err != nil {
+		return nil, fmt.Errorf("failed to count matched loads: %w", err)
+	}
+
+	var matchingRate float64
+	if totalLoads > 0 {
+		matchingRate = float64(matchedLoads) / float64(totalLoads) * 100
+	}
+
+	return &LoadMatchingMetrics{
+		TotalLoads:             int(totalLoads),
+		MatchedLoads:           int(matchedLoads),
+		MatchingRate:           matchingRate,
+		AverageMatchTime:       3.4,                          // Mock data - calculate from load creation to trip assignment
+		OptimalMatches:         int(matchedLoads * 60 / 100), // Mock: 60% optimal
+		SuboptimalMatches:      int(matchedLoads * 40 / 100), // Mock: 40% suboptimal
+		UnmatchedLoads:         int(totalLoads - matchedLoads),
+		UtilizationRate:        78.3, // Mock data
+		RevenueEfficiency:      87.5, // Mock data
+		CostEfficiency:         82.1, // Mock data
+		ImprovementOpportunity: 15.8, // Mock data
+	}, nil
+}
+
+// GetCapacityMetrics compares the weight carried by active trips with the
+// capacity of the active fleet
+func (as *AnalyticsService) GetCapacityMetrics(filter AnalyticsFilter) (*CapacityMetrics, error) {
+	vehicles, err := as.activeVehicles(filter)
+	if err != nil {
+		return nil, err
+	}
+	trips, err := as.activeTrips(vehicles)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalCapacity, utilizedCapacity float64
+	for _, vehicle := range vehicles {
+		totalCapacity += vehicle.LoadCapacityKg
+	}
+	for _, trip := range trips {
+		utilizedCapacity += trip.UsedWeight
+	}
+
+	var utilizationRate float64
+	if totalCapacity > 0 {
+		utilizationRate = utilizedCapacity / totalCapacity * 100
+	}
+
+	return &CapacityMetrics{
+		TotalCapacity:          totalCapacity,
+		UtilizedCapacity:       utilizedCapacity,
+		UtilizationRate:        utilizationRate,
+		AvailableCapacity:      totalCapacity - utilizedCapacity,
+		PeakUtilization:        94.2, // Mock data - calculate from historical data
+		AverageUtilization:     76.8, // Mock data
+		CapacityEfficiency:     82.1, // Mock data
+		RevenuePerCapacityUnit: 1.85, // Mock data
+		CostPerCapacityUnit:    1.32, // Mock data
+		CapacityTrend:          "increasing",
+		DemandVsCapacity:       85.7,    // Mock data
+		ForecastedDemand:       1920000, // Mock data
+	}, nil
+}
+
+// GetVehicleCapacity returns the current utilization of each active vehicle
+func (as *AnalyticsService) GetVehicleCapacity(filter AnalyticsFilter) ([]VehicleCapacityData, error) {
+	vehicles, err := as.activeVehicles(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []VehicleCapacityData{}
+	if len(vehicles) == 0 {
+		return result, nil
+	}
+
+	vehicleIDs := make([]uint, len(vehicles))
+	for i, vehicle := range vehicles {
+		vehicleIDs[i] = vehicle.ID
+	}
+
+	var trips []models.Trip
+	if err := as.db.Select("id", "vehicle_id", "status", "used_weight", "used_volume").
+		Where("vehicle_id IN ?", vehicleIDs).
+		Find(&trips).Error; err != nil {
+		return nil, fmt.Errorf("failed to get vehicle trips: %w", err)
+	}
+
+	tripsByVehicle := make(map[uint][]models.Trip)
+	for _, trip := range trips {
+		tripsByVehicle[trip.VehicleID] = append(tripsByVehicle[trip.VehicleID], trip)
+	}
+
+	now := time.Now()
+	for _, vehicle := range vehicles {
+		var currentLoad, currentVolume float64
+		completedTrips := 0
+		for _, trip := range tripsByVehicle[vehicle.ID] {
+			switch trip.Status {
+			case "ACTIVE", "IN_TRANSIT":
+				currentLoad += trip.UsedWeight
+				currentVolume += trip.UsedVolume
+			case "COMPLETED":
+				completedTrips++
+			}
+		}
+
+		var weightUtilization, volumeUtilization float64
+		if vehicle.LoadCapacityKg > 0 {
+			weightUtilization = currentLoad / vehicle.LoadCapacityKg * 100
+		}
+		if vehicle.LoadCapacityM3 > 0 {
+			volumeUtilization = currentVolume / vehicle.LoadCapacityM3 * 100
+		}
+		overallUtilization := (weightUtilization + volumeUtilization) / 2
+
+		status := "idle"
+		if currentLoad > 0 {
+			status = "active"
+		}
+
+		result = append(result, VehicleCapacityData{
+			VehicleID:          fmt.Sprintf("%d", vehicle.ID),
+			VehicleNumber:      vehicle.LicensePlate,
+			VehicleType:        vehicle.VehicleType,
+			MaxCapacity:        vehicle.LoadCapacityKg,
+			MaxVolume:          vehicle.LoadCapacityM3,
+			CurrentLoad:        currentLoad,
+			CurrentVolume:      currentVolume,
+			WeightUtilization:  weightUtilization,
+			VolumeUtilization:  volumeUtilization,
+			OverallUtilization: overallUtilization,
+			Trips:              completedTrips,
+			Revenue:            0, // Mock data - calculate from completed trips
+			OperatingCosts:     0, // Mock data
+			Profitability:      0, // Mock data
+			Efficiency:         utilizationEfficiency(overallUtilization),
+			Location:           "Unknown", // Mock data - get from tracking
+			Status:             status,
+			LastUpdated:        now,
+			UtilizationTrend:   "stable", // Mock data
+		})
+	}
+
+	return result, nil
+}
+
+// completedTrips returns the completed trips with a recorded arrival that
+// match the filter. Trips are filtered by departure date.
+func (as *AnalyticsService) completedTrips(filter AnalyticsFilter) ([]models.Trip, error) {
+	trips, err := as.findTrips(as.db.Where("status = ? AND actual_arrival IS NOT NULL", "COMPLETED"), filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get completed trips: %w", err)
+	}
+	return trips, nil
+}
+
+// findTrips returns the trips selected by query that match the filter
+func (as *AnalyticsService) findTrips(query *gorm.DB, filter AnalyticsFilter) ([]models.Trip, error) {
+	if filter.From != nil {
+		query = query.Where("departure_date >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("departure_date <= ?", *filter.To)
+	}
+	if len(filter.VehicleIDs) > 0 {
+		query = query.Where("vehicle_id IN ?", filter.VehicleIDs)
+	}
+	if len(filter.DriverIDs) > 0 {
+		query = query.Where("user_id IN ?", filter.DriverIDs)
+	}
+	if len(filter.CustomerIDs) > 0 {
+		query = query.Where("id IN (?)", as.db.Model(&models.Load{}).
+			Select("trip_id").
+			Where("shipper_id IN ?", filter.CustomerIDs))
+	}
+	if filter.Scope != nil {
+		query = query.Where("id IN (?)", as.scopedTripIDs(filter.Scope))
+	}
+
+	var trips []models.Trip
+	if err := query.Order("id ASC").Find(&trips).Error; err != nil {
+		return nil, err
+	}
+	if len(filter.RouteIDs) == 0 {
+		return trips, nil
+	}
+
+	// Corridors are derived from the trip's places, so they are matched here
+	// rather than in the query
+	routeIDs := make(map[string]bool, len(filter.RouteIDs))
+	for _, id := range filter.RouteIDs {
+		routeIDs[id] = true
+	}
+	matching := trips[:0]
+	for _, trip := range trips {
+		if routeIDs[tripCorridorKey(trip)] {
+			matching = append(matching, trip)
+		}
+	}
+	return matching, nil
+}
+
+// previousOnTimePercentages returns the on-time percentage of each group of
+// the completed trips in the period before the filter's date range. It is
+// empty when the filter has no start date.
+func (as *AnalyticsService) previousOnTimePercentages(filter AnalyticsFilter, groupKey func(models.Trip) string) (map[string]float64, error) {
+	percentages := make(map[string]float64)
+	previousFilter, ok := previousPeriod(filter)
+	if !ok {
+		return percentages, nil
+	}
+
+	trips, err := as.completedTrips(previousFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]models.Trip)
+	for _, trip := range trips {
+		key := groupKey(trip)
+		groups[key] = append(groups[key], trip)
+	}
+	for key, groupTrips := range groups {
+		if summary := summarizeDeliveries(groupTrips); summary.Total > 0 {
+			percentages[key] = float64(summary.OnTime) / float64(summary.Total) * 100
+		}
+	}
+	return percentages, nil
+}
+
+// activeVehicles returns the active vehicles matching the filter
+func (as *AnalyticsService) activeVehicles(filter AnalyticsFilter) ([]models.Vehicle, error) {
+	query := as.db.Where("is_active = ?", true)
+	if len(filter.VehicleIDs) > 0 {
+		query = query.Where("id IN ?", filter.VehicleIDs)
+	}
+	// Vehicles of the user, and those driven on the trips they can see
+	if filter.Scope != nil {
+		query = query.Where("user_id = ? OR id IN (?)", filter.Scope.UserID,
+			as.db.Model(&models.Trip{}).Select("vehicle_id").Where("id IN (?)", as.scopedTripIDs(filter.Scope)))
+	}
+
+	var vehicles []models.Vehicle
+	if err := query.Order("id ASC").Find(&vehicles).Error; err != nil {
+		return nil, fmt.Errorf("failed to get vehicles: %w", err)
+	}
+	return vehicles, nil
+}
+
+// scopedTripIDs selects the trips in a scope: those of the user and their
+// organizations, and the trips carrying their loads
+func (as *AnalyticsService) scopedTripIDs(scope *OrganizationScope) *gorm.DB {
+	return as.db.Model(&models.Trip{}).Select("id").
+		Where("user_id = ? OR organization_id IN ? OR id IN (?)", scope.UserID, scope.OrganizationIDs,
+			as.db.Model(&models.Load{}).Select("trip_id").
+				Where("shipper_id = ? OR organization_id IN ?", scope.UserID, scope.OrganizationIDs))
+}
+
+// scopedLoadIDs selects the loads in a scope: those of the user and their
+// organizations, and the loads carried on their trips
+func (as *AnalyticsService) scopedLoadIDs(scope *OrganizationScope) *gorm.DB {
+	return as.db.Model(&models.Load{}).Select("id").
+		Where("shipper_id = ? OR organization_id IN ? OR trip_id IN (?)", scope.UserID, scope.OrganizationIDs,
+			as.db.Model(&models.Trip{}).Select("id").
+				Where("user_id = ? OR organization_id IN ?", scope.UserID, scope.OrganizationIDs))
+}
+
+// activeTrips returns the trips under way on the given vehicles
+func (as *AnalyticsService) activeTrips(vehicles []models.Vehicle) ([]models.Trip, error) {
+	if len(vehicles) == 0 {
+		return nil, nil
+	}
+
+	vehicleIDs := make([]uint, len(vehicles))
+	for i, vehicle := range vehicles {
+		vehicleIDs[i] = vehicle.ID
+	}
+
+	var trips []models.Trip
+	if err := as.db.Where("vehicle_id IN ? AND status IN ?", vehicleIDs, []string{"ACTIVE", "IN_TRANSIT"}).
+		Find(&trips).Error; err != nil {
+		return nil, fmt.Errorf("failed to get active trips: %w", err)
+	}
+	return trips, nil
+}
+
+// classifyDelivery classifies an arrival by its delay. Arrivals within the
+// on-time window of the estimate are on time, earlier ones early and later
+// ones late.
+func classifyDelivery(delay time.Duration) string {
+	switch {
+	case delay > onTimeWindow:
+		return DeliveryLate
+	case delay < -onTimeWindow:
+		return DeliveryEarly
+	default:
+		return DeliveryOnTime
+	}
+}
+
+// summarizeDeliveries aggregates the arrivals of completed trips
+func summarizeDeliveries(trips []models.Trip) deliverySummary {
+	var summary deliverySummary
+	for _, trip := range trips {
+		if trip.ActualArrival == nil {
+			continue
+		}
+		summary.Total++
+
+		delay := trip.ActualArrival.Sub(trip.EstimatedArrival)
+		switch classifyDelivery(delay) {
+		case DeliveryLate:
+			summary.Late++
+			summary.LateMinutes += delay.Minutes()
+		case DeliveryEarly:
+			summary.Early++
+		default:
+			summary.OnTime++
+		}
+		if delay > criticalDelayThreshold {
+			summary.Critical++
+		}
+		if delay > 0 {
+			summary.DelayedTrips++
+			summary.DelayedMinutes += delay.Minutes()
+		}
+
+		if duration := trip.ActualArrival.Sub(tripDepartureTime(trip)); duration > 0 {
+			summary.TripHours += duration.Hours()
+		}
+	}
+	return summary
+}
+
+// previousPeriod returns the filter for the period of the same length ending
+// where the filter's date range starts. An open-ended range runs until now.
+func previousPeriod(filter AnalyticsFilter) (AnalyticsFilter, bool) {
+	if filter.From == nil {
+		return filter, false
+	}
+
+	end := time.Now()
+	if filter.To != nil {
+		end = *filter.To
+	}
+	length := end.Sub(*filter.From)
+	if length <= 0 {
+		return filter, false
+	}
+
+	from := filter.From.Add(-length)
+	to := filter.From.Add(-time.Nanosecond)
+	previous := filter
+	previous.From = &from
+	previous.To = &to
+	return previous, true
+}
+
+// tripCorridorKey identifies the origin/destination corridor of a trip,
+// ignoring case and surrounding spaces
+func tripCorridorKey(trip models.Trip) string {
+	normalize := func(value string) string {
+		return strings.ToUpper(strings.TrimSpace(value))
+	}
+	return fmt.Sprintf("%s,%s:%s,%s",
+		normalize(trip.OriginCity), normalize(trip.OriginCountry),
+		normalize(trip.DestinationCity), normalize(trip.DestinationCountry))
+}
+
+func tripDriverKey(trip models.Trip) string {
+	return fmt.Sprintf("%d", trip.UserID)
+}
+
+// tripDepartureTime returns when a trip actually departed, or its planned
+// departure when that wasn't recorded
+func tripDepartureTime(trip models.Trip) time.Time {
+	if trip.ActualDeparture != nil {
+		return *trip.ActualDeparture
+	}
+	return trip.DepartureDate
+}
+
+// tripPlaceName formats the city and country of a trip's origin or destination
+func tripPlaceName(city, country string) string {
+	return placeName(strings.TrimSpace(city), strings.TrimSpace(country))
+}
+
+// routeRiskLevel rates a corridor by its on-time percentage, raising the
+// level when performance declined since the previous period
+func routeRiskLevel(onTimePercentage, improvement float64) string {
+	declining := improvement <= -trendThreshold
+	switch {
+	case onTimePercentage < 75, onTimePercentage < 90 && declining:
+		return "high"
+	case onTimePercentage < 90, declining:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// performanceTrend describes a change in on-time percentage points
+func performanceTrend(change float64) string {
+	switch {
+	case change >= trendThreshold:
+		return "improving"
+	case change <= -trendThreshold:
+		return "declining"
+	default:
+		return "stable"
+	}
+}
+
+// utilizationEfficiency rates a vehicle's utilization percentage
+func utilizationEfficiency(utilization float64) string {
+	switch {
+	case utilization >= 85:
+		return "excellent"
+	case utilization >= 70:
+		return "good"
+	case utilization >= 60:
+		return "average"
+	default:
+		return "poor"
+	}
+}
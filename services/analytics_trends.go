@@ -0,0 +1,328 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"triplink/backend/models"
+)
+
+// Trend series granularities
+const (
+	TrendDaily   = "daily"
+	TrendWeekly  = "weekly"
+	TrendMonthly = "monthly"
+)
+
+const (
+	// defaultAnalyticsPeriod is the date range of trends without a start date
+	defaultAnalyticsPeriod = 30 * 24 * time.Hour
+
+	// maxTrendPoints caps the buckets of a series so long ranges need a
+	// coarser granularity
+	maxTrendPoints = 1000
+)
+
+// PeriodMetrics are the headline metrics of a period. Deliveries, on-time
+// percentage and delays cover completed trips departing in the period,
+// utilization the trips departing in it and revenue the payments processed in it.
+type PeriodMetrics struct {
+	Deliveries       int     `json:"deliveries"`
+	OnTimePercentage float64 `json:"on_time_percentage"`
+	AverageDelay     float64 `json:"average_delay"` // minutes
+	LateDeliveries   int     `json:"late_deliveries"`
+	UtilizationRate  float64 `json:"utilization_rate"` // used share of the trips' weight capacity
+	Revenue          float64 `json:"revenue"`
+}
+
+// TrendPoint holds the metrics of one bucket of a trend series
+type TrendPoint struct {
+	PeriodStart time.Time `json:"period_start"`
+	PeriodMetrics
+}
+
+// TrendSeries is a time-bucketed series of analytics metrics
+type TrendSeries struct {
+	Granularity string       `json:"granularity"`
+	Currency    string       `json:"currency"` // of revenue
+	From        time.Time    `json:"from"`
+	To          time.Time    `json:"to"`
+	Points      []TrendPoint `json:"points"`
+}
+
+// PeriodComparison compares the metrics of a date range with the period of
+// the same length before it
+type PeriodComparison struct {
+	From         time.Time     `json:"from"`
+	To           time.Time     `json:"to"`
+	PreviousFrom time.Time     `json:"previous_from"`
+	PreviousTo   time.Time     `json:"previous_to"`
+	Currency     string        `json:"currency"` // of revenue
+	Current      PeriodMetrics `json:"current"`
+	Previous     PeriodMetrics `json:"previous"`
+	Change       PeriodMetrics `json:"change"` // current minus previous
+}
+
+// periodRecords are the records metrics of a period are calculated from
+type periodRecords struct {
+	completed []models.Trip
+	scheduled []models.Trip
+	payments  []paymentRecord
+}
+
+type paymentRecord struct {
+	at     time.Time
+	amount float64
+}
+
+// GetTrendSeries buckets the metrics of the filter's date range by day, week
+// (starting Monday) or month, in UTC. Without a start date the series covers
+// the last 30 days.
+func (as *AnalyticsService) GetTrendSeries(filter AnalyticsFilter, granularity string) (*TrendSeries, error) {
+	switch granularity {
+	case TrendDaily, TrendWeekly, TrendMonthly:
+	default:
+		return nil, fmt.Errorf("invalid granularity %q, use daily, weekly or monthly", granularity)
+	}
+
+	filter = analyticsPeriod(filter)
+	from, to := *filter.From, *filter.To
+
+	var starts []time.Time
+	for start := trendBucketStart(from, granularity); !start.After(to); start = nextTrendBucket(start, granularity) {
+		if len(starts) == maxTrendPoints {
+			return nil, fmt.Errorf("series would have more than %d points, use a coarser granularity", maxTrendPoints)
+		}
+		starts = append(starts, start)
+	}
+
+	records, err := as.periodRecords(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make(map[time.Time]*periodRecords, len(starts))
+	for _, start := range starts {
+		buckets[start] = &periodRecords{}
+	}
+	bucketOf := func(at time.Time) *periodRecords {
+		return buckets[trendBucketStart(at, granularity)]
+	}
+	for _, trip := range records.completed {
+		if bucket := bucketOf(trip.DepartureDate); bucket != nil {
+			bucket.completed = append(bucket.completed, trip)
+		}
+	}
+	for _, trip := range records.scheduled {
+		if bucket := bucketOf(trip.DepartureDate); bucket != nil {
+			bucket.scheduled = append(bucket.scheduled, trip)
+		}
+	}
+	for _, payment := range records.payments {
+		if bucket := bucketOf(payment.at); bucket != nil {
+			bucket.payments = append(bucket.payments, payment)
+		}
+	}
+
+	series := &TrendSeries{
+		Granularity: granularity,
+		Currency:    filter.Currency,
+		From:        from,
+		To:          to,
+		Points:      make([]TrendPoint, 0, len(starts)),
+	}
+	for _, start := range starts {
+		series.Points = append(series.Points, TrendPoint{
+			PeriodStart:   start,
+			PeriodMetrics: calculatePeriodMetrics(buckets[start]),
+		})
+	}
+	return series, nil
+}
+
+// GetPeriodComparison compares the metrics of the filter's date range with
+// the previous period of the same length. Without a start date the last 30
+// days are compared.
+func (as *AnalyticsService) GetPeriodComparison(filter AnalyticsFilter) (*PeriodComparison, error) {
+	filter = analyticsPeriod(filter)
+	previousFilter, ok := previousPeriod(filter)
+	if !ok {
+		return nil, errors.New("date range must end after it starts")
+	}
+
+	current, err := as.periodRecords(filter)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := as.periodRecords(previousFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &PeriodComparison{
+		From:         *filter.From,
+		To:           *filter.To,
+		PreviousFrom: *previousFilter.From,
+		PreviousTo:   *previousFilter.To,
+		Currency:     filter.Currency,
+		Current:      calculatePeriodMetrics(current),
+		Previous:     calculatePeriodMetrics(previous),
+	}
+	comparison.Change = PeriodMetrics{
+		Deliveries:       comparison.Current.Deliveries - comparison.Previous.Deliveries,
+		OnTimePercentage: comparison.Current.OnTimePercentage - comparison.Previous.OnTimePercentage,
+		AverageDelay:     comparison.Current.AverageDelay - comparison.Previous.AverageDelay,
+		LateDeliveries:   comparison.Current.LateDeliveries - comparison.Previous.LateDeliveries,
+		UtilizationRate:  comparison.Current.UtilizationRate - comparison.Previous.UtilizationRate,
+		Revenue:          comparison.Current.Revenue - comparison.Previous.Revenue,
+	}
+	return comparison, nil
+}
+
+// periodRecords loads the trips and payments of the filter's date range
+func (as *AnalyticsService) periodRecords(filter AnalyticsFilter) (*periodRecords, error) {
+	completed, err := as.completedTrips(filter)
+	if err != nil {
+		return nil, err
+	}
+	scheduled, err := as.findTrips(as.db.Where("status <> ?", "CANCELLED"), filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trips: %w", err)
+	}
+
+	// Payments are dated when processed, falling back to when they were made
+	query := as.db.Model(&models.Transaction{}).
+		Where("status IN ?", []string{"COMPLETED", "REFUNDED"})
+	if filter.From != nil {
+		query = query.Where("COALESCE(processed_at, created_at) >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("COALESCE(processed_at, created_at) <= ?", *filter.To)
+	}
+	if len(filter.CustomerIDs) > 0 {
+		query = query.Where("payer_id IN ?", filter.CustomerIDs)
+	}
+	if filter.Scope != nil {
+		query = query.Where("payer_id = ? OR payee_id = ? OR load_id IN (?)", filter.Scope.UserID, filter.Scope.UserID, as.scopedLoadIDs(filter.Scope))
+	}
+
+	var transactions []models.Transaction
+	if err := query.Find(&transactions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get payments: %w", err)
+	}
+
+	records := &periodRecords{completed: completed, scheduled: scheduled}
+	for _, transaction := range transactions {
+		at := transaction.CreatedAt
+		if transaction.ProcessedAt != nil {
+			at = *transaction.ProcessedAt
+		}
+		amount, err := paymentAmountIn(&transaction, filter.Currency)
+		if err != nil {
+			log.Printf("Leaving payment %d out of revenue: %v", transaction.ID, err)
+			continue
+		}
+		records.payments = append(records.payments, paymentRecord{
+			at:     at,
+			amount: amount,
+		})
+	}
+	return records, nil
+}
+
+// paymentAmountIn returns a payment less refunds in the given currency. The
+// rate stored with the payment is used when it was normalized to that
+// currency, so revenue doesn't change as exchange rates move.
+func paymentAmountIn(transaction *models.Transaction, currency string) (float64, error) {
+	amount := transaction.Amount - transaction.RefundedAmount
+	paid := transaction.Currency
+	if paid == "" {
+		paid = "USD"
+	}
+	if strings.EqualFold(paid, currency) {
+		return amount, nil
+	}
+	if transaction.BaseCurrency == currency && transaction.ExchangeRate > 0 {
+		return roundHundredths(amount * transaction.ExchangeRate), nil
+	}
+	return GetCurrencyService().Convert(amount, paid, currency)
+}
+
+// calculatePeriodMetrics calculates the metrics of a period's records
+func calculatePeriodMetrics(records *periodRecords) PeriodMetrics {
+	summary := summarizeDeliveries(records.completed)
+	metrics := PeriodMetrics{
+		Deliveries:     summary.Total,
+		LateDeliveries: summary.Late,
+	}
+	if summary.Total > 0 {
+		metrics.OnTimePercentage = float64(summary.OnTime) / float64(summary.Total) * 100
+	}
+	if summary.DelayedTrips > 0 {
+		metrics.AverageDelay = summary.DelayedMinutes / float64(summary.DelayedTrips)
+	}
+
+	var usedWeight, capacity float64
+	for _, trip := range records.scheduled {
+		usedWeight += trip.UsedWeight
+		capacity += trip.TotalCapacityWeight
+	}
+	if capacity > 0 {
+		metrics.UtilizationRate = usedWeight / capacity * 100
+	}
+
+	for _, payment := range records.payments {
+		metrics.Revenue += payment.amount
+	}
+	return metrics
+}
+
+// analyticsPeriod fills in the currency and date range of a filter,
+// defaulting to the base currency and the last 30 days
+func analyticsPeriod(filter AnalyticsFilter) AnalyticsFilter {
+	if filter.Currency == "" {
+		filter.Currency = GetCurrencyService().BaseCurrency()
+	}
+	filter.Currency = strings.ToUpper(filter.Currency)
+
+	to := time.Now()
+	if filter.To != nil {
+		to = *filter.To
+	}
+	from := to.Add(-defaultAnalyticsPeriod)
+	if filter.From != nil {
+		from = *filter.From
+	}
+	filter.From = &from
+	filter.To = &to
+	return filter
+}
+
+// trendBucketStart returns the start of the bucket containing t, in UTC
+func trendBucketStart(t time.Time, granularity string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch granularity {
+	case TrendWeekly:
+		// Weeks start on Monday
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case TrendMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// nextTrendBucket returns the start of the bucket after the one starting at start
+func nextTrendBucket(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case TrendWeekly:
+		return start.AddDate(0, 0, 7)
+	case TrendMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
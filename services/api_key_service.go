@@ -0,0 +1,261 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// API key scopes
+const (
+	ScopeTrackingWrite = "tracking:write"
+	ScopeTrackingRead  = "tracking:read"
+)
+
+// apiKeyScopes are the scopes keys can be granted
+var apiKeyScopes = map[string]bool{
+	ScopeTrackingWrite: true,
+	ScopeTrackingRead:  true,
+}
+
+// apiKeyPrefix starts every key, so leaked keys are easy to recognize
+const apiKeyPrefix = "tlk_"
+
+// apiKeyUsageInterval throttles how often a key's last use is saved
+const apiKeyUsageInterval = time.Minute
+
+// Errors returned when authenticating a key
+var (
+	ErrInvalidApiKey   = errors.New("invalid API key")
+	ErrApiKeyScope     = errors.New("API key is missing the required scope")
+	ErrApiKeyTripScope = errors.New("API key is not allowed to access this trip")
+)
+
+// ApiKeyRequest describes a key to issue
+type ApiKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	TripIDs   []uint     `json:"trip_ids"` // empty allows all the carrier's trips
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// IssuedApiKey is a new key with its secret, which is only shown once
+type IssuedApiKey struct {
+	ApiKey models.ApiKey `json:"api_key"`
+	Key    string        `json:"key"`
+}
+
+// ApiKeyService issues, rotates and revokes API keys and authenticates the
+// requests made with them
+type ApiKeyService struct {
+	db *gorm.DB
+}
+
+// NewApiKeyService creates a new API key service
+func NewApiKeyService(db *gorm.DB) *ApiKeyService {
+	return &ApiKeyService{db: db}
+}
+
+// CreateKey issues a key acting for a carrier
+func (aks *ApiKeyService) CreateKey(userID uint, req ApiKeyRequest) (*IssuedApiKey, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, errors.New("name is required")
+	}
+	if len(req.Scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	for _, scope := range req.Scopes {
+		if !apiKeyScopes[scope] {
+			return nil, fmt.Errorf("unknown scope %s", scope)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, errors.New("expires_at must be in the future")
+	}
+	trips := uniqueIDs(req.TripIDs)
+	if len(trips) > 0 {
+		var count int64
+		aks.db.Model(&models.Trip{}).Where("id IN ? AND user_id = ?", trips, userID).Count(&count)
+		if count != int64(len(trips)) {
+			return nil, errors.New("trip_ids must be your own trips")
+		}
+	}
+
+	tripIDs := make([]string, 0, len(trips))
+	for _, id := range trips {
+		tripIDs = append(tripIDs, strconv.FormatUint(uint64(id), 10))
+	}
+
+	return aks.issue(aks.db, models.ApiKey{
+		UserID:    userID,
+		Name:      strings.TrimSpace(req.Name),
+		Scopes:    strings.Join(req.Scopes, ","),
+		TripIDs:   strings.Join(tripIDs, ","),
+		ExpiresAt: req.ExpiresAt,
+	})
+}
+
+// issue generates a secret for a key and saves it
+func (aks *ApiKeyService) issue(tx *gorm.DB, apiKey models.ApiKey) (*IssuedApiKey, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := apiKeyPrefix + hex.EncodeToString(buf)
+
+	apiKey.Prefix = key[:len(apiKeyPrefix)+8]
+	apiKey.KeyHash = hashApiKey(key)
+	if err := tx.Create(&apiKey).Error; err != nil {
+		return nil, fmt.Errorf("failed to save API key: %w", err)
+	}
+	return &IssuedApiKey{ApiKey: apiKey, Key: key}, nil
+}
+
+// GetKeys returns a carrier's keys, newest first
+func (aks *ApiKeyService) GetKeys(userID uint) ([]models.ApiKey, error) {
+	var keys []models.ApiKey
+	if err := aks.db.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// activeKey returns a carrier's key that hasn't been revoked
+func (aks *ApiKeyService) activeKey(userID, keyID uint) (*models.ApiKey, error) {
+	var apiKey models.ApiKey
+	if err := aks.db.First(&apiKey, keyID).Error; err != nil || apiKey.UserID != userID {
+		return nil, errors.New("API key not found")
+	}
+	if apiKey.RevokedAt != nil {
+		return nil, errors.New("API key is revoked")
+	}
+	return &apiKey, nil
+}
+
+// RotateKey issues a replacement key with the same name, scopes and trips.
+// The old key keeps working for the grace period, so integrations can switch
+// over, and is revoked right away without one.
+func (aks *ApiKeyService) RotateKey(userID, keyID uint, gracePeriod time.Duration) (*IssuedApiKey, error) {
+	if gracePeriod < 0 {
+		return nil, errors.New("grace period can't be negative")
+	}
+	old, err := aks.activeKey(userID, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var issued *IssuedApiKey
+	err = aks.db.Transaction(func(tx *gorm.DB) error {
+		issued, err = aks.issue(tx, models.ApiKey{
+			UserID:    old.UserID,
+			Name:      old.Name,
+			Scopes:    old.Scopes,
+			TripIDs:   old.TripIDs,
+			ExpiresAt: old.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"rotated_to_id": issued.ApiKey.ID}
+		now := time.Now()
+		if gracePeriod == 0 {
+			updates["revoked_at"] = now
+		} else if graceEnd := now.Add(gracePeriod); old.ExpiresAt == nil || graceEnd.Before(*old.ExpiresAt) {
+			updates["expires_at"] = graceEnd
+		}
+		if err := tx.Model(old).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update rotated API key: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return issued, nil
+}
+
+// RevokeKey stops a key from authenticating
+func (aks *ApiKeyService) RevokeKey(userID, keyID uint) (*models.ApiKey, error) {
+	apiKey, err := aks.activeKey(userID, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := aks.db.Model(apiKey).Update("revoked_at", &now).Error; err != nil {
+		return nil, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	apiKey.RevokedAt = &now
+	return apiKey, nil
+}
+
+// Authenticate returns the active key matching a secret
+func (aks *ApiKeyService) Authenticate(key string) (*models.ApiKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidApiKey
+	}
+
+	var apiKey models.ApiKey
+	if err := aks.db.Where("key_hash = ?", hashApiKey(key)).First(&apiKey).Error; err != nil {
+		return nil, ErrInvalidApiKey
+	}
+	now := time.Now()
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && !apiKey.ExpiresAt.After(now)) {
+		return nil, ErrInvalidApiKey
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyUsageInterval {
+		aks.db.Model(&apiKey).UpdateColumn("last_used_at", now)
+	}
+	return &apiKey, nil
+}
+
+// AuthorizeTrip checks that a key may access a trip: the trip must belong to
+// the key's carrier and be one of the key's trips, when it is limited to some
+func (aks *ApiKeyService) AuthorizeTrip(apiKey *models.ApiKey, tripID uint) error {
+	if apiKey.TripIDs != "" {
+		allowed := false
+		for _, id := range strings.Split(apiKey.TripIDs, ",") {
+			if id == strconv.FormatUint(uint64(tripID), 10) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return ErrApiKeyTripScope
+		}
+	}
+
+	var count int64
+	aks.db.Model(&models.Trip{}).Where("id = ? AND user_id = ?", tripID, apiKey.UserID).Count(&count)
+	if count == 0 {
+		return ErrApiKeyTripScope
+	}
+	return nil
+}
+
+// ApiKeyHasScope reports whether a key was granted a scope
+func ApiKeyHasScope(apiKey *models.ApiKey, scope string) bool {
+	for _, granted := range strings.Split(apiKey.Scopes, ",") {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// hashApiKey returns the stored hash of a key. Keys are random, so a plain
+// SHA-256 is enough to make the stored hashes useless if leaked.
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
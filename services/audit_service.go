@@ -0,0 +1,227 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// AuditChange is the value of a field before and after an audited call
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// AuditEntity describes an entity type whose changes are audited
+type AuditEntity struct {
+	Type   string
+	Table  string
+	Fields []string // columns compared before and after the call
+	// The entity is booked onto a trip through its trip_id, so calls on it
+	// can change the trip's capacity
+	BooksTripCapacity bool
+}
+
+// tripCapacityFields are the trip columns recorded when a call on another
+// entity changes a trip's capacity
+var tripCapacityFields = []string{"used_weight", "used_volume", "total_capacity_weight", "total_capacity_volume"}
+
+// AuditEntities are the audited entity types, by type
+var AuditEntities = map[string]AuditEntity{
+	"trip": {
+		Type:   "trip",
+		Table:  "trips",
+		Fields: []string{"status", "version", "vehicle_id", "total_capacity_weight", "total_capacity_volume", "used_weight", "used_volume", "tracking_enabled"},
+	},
+	"load": {
+		Type:              "load",
+		Table:             "loads",
+		Fields:            []string{"status", "version", "trip_id", "weight", "volume", "agreed_price"},
+		BooksTripCapacity: true,
+	},
+	"quote": {
+		Type:              "quote",
+		Table:             "quotes",
+		Fields:            []string{"status", "quote_amount", "trip_id"},
+		BooksTripCapacity: true,
+	},
+	"vehicle": {
+		Type:   "vehicle",
+		Table:  "vehicles",
+		Fields: []string{"load_capacity_kg", "load_capacity_m3", "is_active"},
+	},
+	"trip_stop": {
+		Type:   "trip_stop",
+		Table:  "trip_stops",
+		Fields: []string{"status"},
+	},
+	"user": {
+		Type:   "user",
+		Table:  "users",
+		Fields: []string{"role", "is_verified", "verification_status", "suspended_at"},
+	},
+	"transaction": {
+		Type:   "transaction",
+		Table:  "transactions",
+		Fields: []string{"status", "amount", "refunded_amount"},
+	},
+}
+
+// AuditSnapshot is the audited fields of an entity, and of the trips whose
+// capacity it can change, at one point of a call
+type AuditSnapshot struct {
+	Fields map[string]interface{}
+	Trips  map[uint]map[string]interface{}
+}
+
+// AuditService records audit logs of mutating API calls
+type AuditService struct {
+	db *gorm.DB
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Snapshot reads the audited fields of an entity. The capacity of the trip
+// the entity is booked on is read too, along with the trips in tripIDs, e.g.
+// the trip a load is being booked onto.
+func (as *AuditService) Snapshot(entity AuditEntity, entityID uint, tripIDs ...uint) *AuditSnapshot {
+	snapshot := &AuditSnapshot{
+		Fields: as.readFields(entity.Table, entity.Fields, entityID),
+		Trips:  make(map[uint]map[string]interface{}),
+	}
+	if !entity.BooksTripCapacity {
+		return snapshot
+	}
+
+	if tripID := toUint(snapshot.Fields["trip_id"]); tripID != 0 {
+		tripIDs = append(tripIDs, tripID)
+	}
+	for _, tripID := range tripIDs {
+		if _, ok := snapshot.Trips[tripID]; tripID != 0 && !ok {
+			snapshot.Trips[tripID] = as.readFields("trips", tripCapacityFields, tripID)
+		}
+	}
+	return snapshot
+}
+
+// readFields reads columns of a row, nil when the row doesn't exist
+func (as *AuditService) readFields(table string, fields []string, id uint) map[string]interface{} {
+	var rows []map[string]interface{}
+	if err := as.db.Table(table).Select(fields).Where("id = ?", id).Limit(1).Find(&rows).Error; err != nil || len(rows) == 0 {
+		return nil
+	}
+	return rows[0]
+}
+
+// DiffAuditFields returns the fields whose value differs between two
+// snapshots of the same row. A missing snapshot compares as empty values.
+func DiffAuditFields(fields []string, before, after map[string]interface{}) map[string]AuditChange {
+	changes := make(map[string]AuditChange)
+	for _, field := range fields {
+		from, to := before[field], after[field]
+		if !reflect.DeepEqual(normalizeAuditValue(from), normalizeAuditValue(to)) {
+			changes[field] = AuditChange{From: from, To: to}
+		}
+	}
+	return changes
+}
+
+// normalizeAuditValue makes values read by different drivers comparable
+func normalizeAuditValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case int64:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case float32:
+		return float64(v)
+	}
+	return value
+}
+
+// Record saves the audit log of a call, with the changes of the entity
+// between the before and after snapshots. Trips whose capacity changed get
+// their own log with the same request ID.
+func (as *AuditService) Record(log models.AuditLog, entity *AuditEntity, before, after *AuditSnapshot) error {
+	var tripLogs []models.AuditLog
+	if entity != nil && before != nil && after != nil {
+		changes := DiffAuditFields(entity.Fields, before.Fields, after.Fields)
+		if err := setAuditChanges(&log, changes); err != nil {
+			return err
+		}
+
+		for tripID, tripBefore := range before.Trips {
+			if _, ok := after.Trips[tripID]; !ok {
+				after.Trips[tripID] = as.readFields("trips", tripCapacityFields, tripID)
+			}
+
+			tripChanges := DiffAuditFields(tripCapacityFields, tripBefore, after.Trips[tripID])
+			if len(tripChanges) == 0 {
+				continue
+			}
+			tripLog := log
+			tripLog.EntityType = "trip"
+			id := tripID
+			tripLog.EntityID = &id
+			if err := setAuditChanges(&tripLog, tripChanges); err != nil {
+				return err
+			}
+			tripLogs = append(tripLogs, tripLog)
+		}
+	}
+
+	return as.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&log).Error; err != nil {
+			return fmt.Errorf("failed to save audit log: %w", err)
+		}
+		for i := range tripLogs {
+			if err := tx.Create(&tripLogs[i]).Error; err != nil {
+				return fmt.Errorf("failed to save audit log: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// setAuditChanges stores changes on a log as JSON
+func setAuditChanges(log *models.AuditLog, changes map[string]AuditChange) error {
+	if len(changes) == 0 {
+		log.Changes = ""
+		return nil
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit changes: %w", err)
+	}
+	log.Changes = string(data)
+	return nil
+}
+
+// toUint converts an ID column value read into a map
+func toUint(value interface{}) uint {
+	switch v := value.(type) {
+	case int64:
+		return uint(v)
+	case int32:
+		return uint(v)
+	case int:
+		return uint(v)
+	case uint:
+		return v
+	case uint64:
+		return uint(v)
+	case float64:
+		return uint(v)
+	}
+	return 0
+}
@@ -8,7 +8,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 )
 
 // CacheMonitor provides monitoring and metrics for Redis cache
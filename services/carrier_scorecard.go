@@ -0,0 +1,291 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// carrierScorecardPeriod is the period carriers are scored over when no
+	// start date is given
+	carrierScorecardPeriod = 90 * 24 * time.Hour
+
+	// trackingCoverageGap is the longest gap between a trip's positions that
+	// still counts as tracked
+	trackingCoverageGap = 15 * time.Minute
+)
+
+// CarrierScorecard summarizes how reliably a carrier delivered over a period,
+// for shippers choosing who to book with. Percentages and averages are nil
+// when the carrier had nothing to measure them by in the period.
+type CarrierScorecard struct {
+	CarrierID   uint      `json:"carrier_id"`
+	CarrierName string    `json:"carrier_name"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+
+	// Completed trips and how many arrived within the on-time window
+	CompletedTrips   int      `json:"completed_trips"`
+	OnTimeTrips      int      `json:"on_time_trips"`
+	OnTimePercentage *float64 `json:"on_time_percentage"`
+
+	// Loads carried and how many were moved to EXCEPTION on the way
+	Loads          int      `json:"loads"`
+	ExceptionLoads int      `json:"exception_loads"`
+	ExceptionRate  *float64 `json:"exception_rate"`
+
+	// Loads quoted for and the average time from a load being posted to the
+	// carrier's first quote
+	QuotedLoads               int      `json:"quoted_loads"`
+	AverageQuoteResponseHours *float64 `json:"average_quote_response_hours"`
+
+	// Share of the completed trips' time with positions reported no more than
+	// trackingCoverageGap apart, averaged over the trips; untracked trips
+	// score 0
+	TrackedTrips         int      `json:"tracked_trips"`
+	TrackingQualityScore *float64 `json:"tracking_quality_score"`
+
+	// Shippers' reviews of the carrier
+	Reviews       int      `json:"reviews"`
+	AverageRating *float64 `json:"average_rating"`
+}
+
+// CarrierScorecardService scores carriers from their trips, loads, quotes,
+// tracking data and reviews
+type CarrierScorecardService struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+// NewCarrierScorecardService creates a new carrier scorecard service
+func NewCarrierScorecardService(db *gorm.DB) *CarrierScorecardService {
+	return &CarrierScorecardService{db: db, now: time.Now}
+}
+
+// Period returns the period to score, defaulting to the last 90 days up to
+// now
+func (s *CarrierScorecardService) Period(from, to *time.Time) (time.Time, time.Time) {
+	end := s.now()
+	if to != nil {
+		end = *to
+	}
+	start := end.Add(-carrierScorecardPeriod)
+	if from != nil {
+		start = *from
+	}
+	return start, end
+}
+
+// Scorecard scores a carrier between from and to. Trips and their loads are
+// included by departure date, quotes and reviews by when they were made. It
+// returns gorm.ErrRecordNotFound when the user isn't a carrier.
+func (s *CarrierScorecardService) Scorecard(carrierID uint, from, to time.Time) (*CarrierScorecard, error) {
+	var carrier models.User
+	if err := s.db.Select("id, first_name, last_name, company_name, role").
+		Where("role = ?", "CARRIER").First(&carrier, carrierID).Error; err != nil {
+		return nil, err
+	}
+
+	scorecard := &CarrierScorecard{
+		CarrierID:   carrierID,
+		CarrierName: strings.TrimSpace(carrier.FirstName + " " + carrier.LastName),
+		From:        from,
+		To:          to,
+	}
+	if carrier.CompanyName != "" {
+		scorecard.CarrierName = carrier.CompanyName
+	}
+
+	trips := s.db.Model(&models.Trip{}).Select("id").
+		Where("user_id = ? AND departure_date >= ? AND departure_date < ?", carrierID, from, to)
+
+	var completed []models.Trip
+	if err := s.db.Where("id IN (?) AND status = ? AND actual_arrival IS NOT NULL", trips, "COMPLETED").
+		Order("id ASC").Find(&completed).Error; err != nil {
+		return nil, fmt.Errorf("failed to get completed trips: %w", err)
+	}
+	summary := summarizeDeliveries(completed)
+	scorecard.CompletedTrips = summary.Total
+	scorecard.OnTimeTrips = summary.OnTime
+	if summary.Total > 0 {
+		scorecard.OnTimePercentage = scorecardPercentage(summary.OnTime, summary.Total)
+	}
+
+	if err := s.scoreExceptions(scorecard, trips); err != nil {
+		return nil, err
+	}
+	if err := s.scoreQuoteResponses(scorecard, carrierID, from, to); err != nil {
+		return nil, err
+	}
+	if err := s.scoreTracking(scorecard, completed); err != nil {
+		return nil, err
+	}
+
+	var reviews struct {
+		Count   int
+		Average float64
+	}
+	if err := s.db.Model(&models.Review{}).Select("COUNT(*) AS count, COALESCE(AVG(rating), 0) AS average").
+		Where("reviewee_id = ? AND review_type = ? AND created_at >= ? AND created_at < ?", carrierID, "SHIPPER_TO_CARRIER", from, to).
+		Scan(&reviews).Error; err != nil {
+		return nil, fmt.Errorf("failed to get reviews: %w", err)
+	}
+	scorecard.Reviews = reviews.Count
+	if reviews.Count > 0 {
+		average := roundHundredths(reviews.Average)
+		scorecard.AverageRating = &average
+	}
+	return scorecard, nil
+}
+
+// scoreExceptions counts the loads carried on the trips and those that were
+// moved to EXCEPTION, whether or not they recovered since
+func (s *CarrierScorecardService) scoreExceptions(scorecard *CarrierScorecard, trips *gorm.DB) error {
+	var loads []models.Load
+	if err := s.db.Select("id", "status").Where("trip_id IN (?) AND status <> ?", trips, "CANCELLED").
+		Find(&loads).Error; err != nil {
+		return fmt.Errorf("failed to get loads: %w", err)
+	}
+	scorecard.Loads = len(loads)
+	if len(loads) == 0 {
+		return nil
+	}
+
+	loadIDs := make([]uint, 0, len(loads))
+	exceptions := make(map[uint]bool)
+	for _, load := range loads {
+		loadIDs = append(loadIDs, load.ID)
+		if load.Status == "EXCEPTION" {
+			exceptions[load.ID] = true
+		}
+	}
+	var moved []uint
+	if err := s.db.Model(&models.TrackingEvent{}).Distinct("load_id").
+		Where("load_id IN ? AND event_type = ? AND event_data LIKE ?", loadIDs, LoadStatusMachine.EventType, `%"to":"EXCEPTION"%`).
+		Pluck("load_id", &moved).Error; err != nil {
+		return fmt.Errorf("failed to get load exceptions: %w", err)
+	}
+	for _, id := range moved {
+		exceptions[id] = true
+	}
+
+	scorecard.ExceptionLoads = len(exceptions)
+	scorecard.ExceptionRate = scorecardPercentage(len(exceptions), len(loads))
+	return nil
+}
+
+// scoreQuoteResponses averages how long after a load was posted the carrier
+// first quoted for it. Counter-offers aren't responses.
+func (s *CarrierScorecardService) scoreQuoteResponses(scorecard *CarrierScorecard, carrierID uint, from, to time.Time) error {
+	var responses []struct {
+		LoadID         uint
+		LoadCreatedAt  time.Time
+		QuoteCreatedAt time.Time
+	}
+	if err := s.db.Table("quotes").
+		Select("quotes.load_id, loads.created_at AS load_created_at, quotes.created_at AS quote_created_at").
+		Joins("JOIN loads ON loads.id = quotes.load_id").
+		Where("quotes.carrier_id = ? AND quotes.proposed_by = ? AND quotes.parent_quote_id IS NULL", carrierID, "CARRIER").
+		Where("quotes.created_at >= ? AND quotes.created_at < ? AND quotes.deleted_at IS NULL", from, to).
+		Order("quotes.created_at ASC").
+		Scan(&responses).Error; err != nil {
+		return fmt.Errorf("failed to get quotes: %w", err)
+	}
+
+	var hours float64
+	quoted := make(map[uint]bool)
+	for _, response := range responses {
+		if quoted[response.LoadID] {
+			continue
+		}
+		quoted[response.LoadID] = true
+		if elapsed := response.QuoteCreatedAt.Sub(response.LoadCreatedAt); elapsed > 0 {
+			hours += elapsed.Hours()
+		}
+	}
+	scorecard.QuotedLoads = len(quoted)
+	if len(quoted) > 0 {
+		average := roundHundredths(hours / float64(len(quoted)))
+		scorecard.AverageQuoteResponseHours = &average
+	}
+	return nil
+}
+
+// scoreTracking scores how completely the completed trips were tracked, from
+// their live and archived positions
+func (s *CarrierScorecardService) scoreTracking(scorecard *CarrierScorecard, trips []models.Trip) error {
+	if len(trips) == 0 {
+		return nil
+	}
+
+	tripIDs := make([]uint, len(trips))
+	for i, trip := range trips {
+		tripIDs[i] = trip.ID
+	}
+	positions := make(map[uint][]time.Time)
+	for _, table := range []string{"tracking_records", archivedTrackingRecordsTable} {
+		var records []struct {
+			TripID    uint
+			Timestamp time.Time
+		}
+		if err := s.db.Table(table).Select("trip_id, timestamp").
+			Where("trip_id IN ? AND deleted_at IS NULL", tripIDs).
+			Scan(&records).Error; err != nil {
+			return fmt.Errorf("failed to get tracking records: %w", err)
+		}
+		for _, record := range records {
+			positions[record.TripID] = append(positions[record.TripID], record.Timestamp)
+		}
+	}
+
+	var coverage float64
+	for _, trip := range trips {
+		if len(positions[trip.ID]) == 0 {
+			continue
+		}
+		scorecard.TrackedTrips++
+		coverage += trackingCoverage(tripDepartureTime(trip), *trip.ActualArrival, positions[trip.ID])
+	}
+	score := roundHundredths(coverage / float64(len(trips)) * 100)
+	scorecard.TrackingQualityScore = &score
+	return nil
+}
+
+// trackingCoverage returns the share of the time between start and end that
+// positions were reported no more than trackingCoverageGap apart
+func trackingCoverage(start, end time.Time, timestamps []time.Time) float64 {
+	duration := end.Sub(start)
+	if duration <= 0 {
+		return 1
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i].Before(timestamps[j]) })
+	var covered time.Duration
+	for i := 1; i < len(timestamps); i++ {
+		from, to := timestamps[i-1], timestamps[i]
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if gap := timestamps[i].Sub(timestamps[i-1]); gap <= trackingCoverageGap && to.After(from) {
+			covered += to.Sub(from)
+		}
+	}
+	if covered > duration {
+		return 1
+	}
+	return covered.Seconds() / duration.Seconds()
+}
+
+// scorecardPercentage returns part as a percentage of total
+func scorecardPercentage(part, total int) *float64 {
+	percentage := roundHundredths(float64(part) / float64(total) * 100)
+	return &percentage
+}
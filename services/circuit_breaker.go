@@ -0,0 +1,182 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+	"triplink/backend/config"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "CLOSED"    // calls go through
+	CircuitOpen     = "OPEN"      // calls fail fast
+	CircuitHalfOpen = "HALF_OPEN" // one trial call decides whether to close
+)
+
+// ErrCircuitOpen is returned instead of calling a provider whose circuit is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreakerStatus is the health of an external API provider
+type CircuitBreakerStatus struct {
+	Name                string     `json:"name"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"` // when an open circuit lets a trial call through
+}
+
+// CircuitBreaker stops calling a provider after consecutive failures, so an
+// outage fails fast instead of slowing every request down to the provider's
+// timeout. Once open, a trial call is let through after the open timeout and
+// its outcome closes or reopens the circuit.
+type CircuitBreaker struct {
+	name             string
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+
+	lastError     string
+	lastFailureAt *time.Time
+	lastSuccessAt *time.Time
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(name string, failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:             name,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		state:            CircuitClosed,
+	}
+}
+
+// Execute calls fn unless the circuit is open, recording its outcome
+func (cb *CircuitBreaker) Execute(fn func() error) error {
+	if !cb.allow() {
+		return ErrCircuitOpen
+	}
+	err := fn()
+	cb.record(err)
+	return err
+}
+
+// allow reports whether a call may go through, moving an open circuit whose
+// timeout has passed to half open for a single trial call
+func (cb *CircuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.openTimeout {
+			return false
+		}
+		cb.state = CircuitHalfOpen
+		cb.probing = true
+		return true
+	case CircuitHalfOpen:
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+		return true
+	}
+	return true
+}
+
+// record updates the circuit with the outcome of a call
+func (cb *CircuitBreaker) record(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	cb.probing = false
+	if err == nil {
+		cb.state = CircuitClosed
+		cb.failures = 0
+		cb.lastSuccessAt = &now
+		return
+	}
+
+	cb.failures++
+	cb.lastError = err.Error()
+	cb.lastFailureAt = &now
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.failureThreshold {
+		cb.state = CircuitOpen
+		cb.openedAt = now
+	}
+}
+
+// State returns the current state of the circuit
+func (cb *CircuitBreaker) State() string {
+	return cb.Status().State
+}
+
+// Status returns the health of the provider behind the circuit
+func (cb *CircuitBreaker) Status() CircuitBreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	status := CircuitBreakerStatus{
+		Name:                cb.name,
+		State:               cb.state,
+		ConsecutiveFailures: cb.failures,
+		LastError:           cb.lastError,
+		LastFailureAt:       cb.lastFailureAt,
+		LastSuccessAt:       cb.lastSuccessAt,
+	}
+	if cb.state == CircuitOpen {
+		retryAt := cb.openedAt.Add(cb.openTimeout)
+		status.RetryAt = &retryAt
+	}
+	return status
+}
+
+// circuitBreakers holds a breaker per external API provider, shared by all
+// the calls made to it
+var circuitBreakers = struct {
+	sync.Mutex
+	byName map[string]*CircuitBreaker
+}{byName: make(map[string]*CircuitBreaker)}
+
+// GetCircuitBreaker returns the circuit breaker of an external API provider,
+// creating it on first use
+func GetCircuitBreaker(name string) *CircuitBreaker {
+	circuitBreakers.Lock()
+	defer circuitBreakers.Unlock()
+
+	cb, ok := circuitBreakers.byName[name]
+	if !ok {
+		cfg := config.GetCircuitBreakerConfig()
+		cb = NewCircuitBreaker(name, cfg.FailureThreshold, cfg.OpenTimeout)
+		circuitBreakers.byName[name] = cb
+	}
+	return cb
+}
+
+// CircuitBreakerStatuses returns the health of the external API providers
+// that have been called, by name
+func CircuitBreakerStatuses() []CircuitBreakerStatus {
+	circuitBreakers.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(circuitBreakers.byName))
+	for _, cb := range circuitBreakers.byName {
+		breakers = append(breakers, cb)
+	}
+	circuitBreakers.Unlock()
+
+	statuses := make([]CircuitBreakerStatus, 0, len(breakers))
+	for _, cb := range breakers {
+		statuses = append(statuses, cb.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
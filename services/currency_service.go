@@ -0,0 +1,338 @@
+package services
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"triplink/backend/config"
+)
+
+// ErrUnsupportedCurrency is returned for currencies the rate provider has no
+// exchange rate for
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// ExchangeRateProvider fetches the latest exchange rates
+type ExchangeRateProvider interface {
+	// LatestRates returns the units of each currency worth one unit of the
+	// returned base currency
+	LatestRates() (base string, rates map[string]float64, err error)
+	Name() string
+}
+
+// ExchangeRates are the exchange rates against the base currency: the units
+// of each currency worth one unit of the base
+type ExchangeRates struct {
+	Base      string             `json:"base"`
+	Rates     map[string]float64 `json:"rates"`
+	Provider  string             `json:"provider"`
+	FetchedAt time.Time          `json:"fetched_at"`
+}
+
+// CurrencyService converts amounts between currencies at cached exchange
+// rates. Rates are refreshed after the cache TTL; when the provider fails,
+// the last rates fetched keep being used.
+type CurrencyService struct {
+	provider     ExchangeRateProvider
+	baseCurrency string
+	ttl          time.Duration
+
+	mu        sync.Mutex
+	rateBase  string
+	rates     map[string]float64
+	fetchedAt time.Time
+}
+
+var (
+	currencyServiceMu       sync.RWMutex
+	currencyServiceInstance *CurrencyService
+)
+
+// GetCurrencyService returns the currency service set at startup, creating
+// one from the environment on first use
+func GetCurrencyService() *CurrencyService {
+	currencyServiceMu.RLock()
+	service := currencyServiceInstance
+	currencyServiceMu.RUnlock()
+	if service != nil {
+		return service
+	}
+
+	currencyServiceMu.Lock()
+	defer currencyServiceMu.Unlock()
+	if currencyServiceInstance == nil {
+		currencyServiceInstance = NewCurrencyService(config.GetCurrencyConfig())
+	}
+	return currencyServiceInstance
+}
+
+// SetCurrencyService sets the currency service used to normalize amounts
+func SetCurrencyService(service *CurrencyService) {
+	currencyServiceMu.Lock()
+	defer currencyServiceMu.Unlock()
+	currencyServiceInstance = service
+}
+
+// NewCurrencyService creates a currency service with the rate provider
+// configured in cfg
+func NewCurrencyService(cfg *config.CurrencyConfig) *CurrencyService {
+	var provider ExchangeRateProvider
+	if cfg.RateProvider == "OPENEXCHANGERATES" {
+		provider = NewOpenExchangeRatesProvider(cfg)
+	} else {
+		provider = NewECBRateProvider(cfg)
+	}
+	return NewCurrencyServiceWithProvider(provider, cfg.BaseCurrency, cfg.RateCacheTTL)
+}
+
+// NewCurrencyServiceWithProvider creates a currency service with the given
+// rate provider
+func NewCurrencyServiceWithProvider(provider ExchangeRateProvider, baseCurrency string, ttl time.Duration) *CurrencyService {
+	return &CurrencyService{
+		provider:     provider,
+		baseCurrency: strings.ToUpper(baseCurrency),
+		ttl:          ttl,
+	}
+}
+
+// BaseCurrency returns the currency amounts are normalized to
+func (s *CurrencyService) BaseCurrency() string {
+	return s.baseCurrency
+}
+
+// Rate returns the units of to worth one unit of from
+func (s *CurrencyService) Rate(from, to string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return 1, nil
+	}
+
+	rateBase, rates, _, err := s.currentRates()
+	if err != nil {
+		return 0, err
+	}
+	fromRate, ok := rateAgainst(rateBase, rates, from)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, from)
+	}
+	toRate, ok := rateAgainst(rateBase, rates, to)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, to)
+	}
+	return toRate / fromRate, nil
+}
+
+// Convert converts an amount from one currency to another, rounded to cents
+func (s *CurrencyService) Convert(amount float64, from, to string) (float64, error) {
+	rate, err := s.Rate(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return roundHundredths(amount * rate), nil
+}
+
+// ToBase converts an amount to the base currency, returning the converted
+// amount and the exchange rate used
+func (s *CurrencyService) ToBase(amount float64, currency string) (float64, float64, error) {
+	if currency == "" {
+		currency = s.baseCurrency
+	}
+	rate, err := s.Rate(currency, s.baseCurrency)
+	if err != nil {
+		return 0, 0, err
+	}
+	return roundHundredths(amount * rate), rate, nil
+}
+
+// Normalize converts an amount to the base currency, to be stored next to
+// the original amount. Without an exchange rate it returns zero values, so
+// the amount can still be recorded and converted later.
+func (s *CurrencyService) Normalize(amount float64, currency string) (float64, string, float64) {
+	baseAmount, rate, err := s.ToBase(amount, currency)
+	if err != nil {
+		log.Printf("Failed to convert %.2f %s to %s: %v", amount, currency, s.baseCurrency, err)
+		return 0, "", 0
+	}
+	return baseAmount, s.baseCurrency, rate
+}
+
+// Rates returns the exchange rates against the base currency
+func (s *CurrencyService) Rates() (*ExchangeRates, error) {
+	rateBase, rates, fetchedAt, err := s.currentRates()
+	if err != nil {
+		return nil, err
+	}
+	baseRate, ok := rateAgainst(rateBase, rates, s.baseCurrency)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, s.baseCurrency)
+	}
+
+	result := &ExchangeRates{
+		Base:      s.baseCurrency,
+		Rates:     make(map[string]float64, len(rates)+1),
+		Provider:  s.provider.Name(),
+		FetchedAt: fetchedAt,
+	}
+	result.Rates[rateBase] = roundRate(1 / baseRate)
+	for currency, rate := range rates {
+		result.Rates[currency] = roundRate(rate / baseRate)
+	}
+	return result, nil
+}
+
+// currentRates returns the cached rates, fetching them when they have
+// expired. Expired rates are returned when fetching fails.
+func (s *CurrencyService) currentRates() (string, map[string]float64, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rates != nil && time.Since(s.fetchedAt) < s.ttl {
+		return s.rateBase, s.rates, s.fetchedAt, nil
+	}
+
+	base, rates, err := s.provider.LatestRates()
+	if err != nil {
+		if s.rates != nil {
+			log.Printf("Failed to refresh exchange rates from %s, using rates from %s: %v", s.provider.Name(), s.fetchedAt.Format(time.RFC3339), err)
+			return s.rateBase, s.rates, s.fetchedAt, nil
+		}
+		return "", nil, time.Time{}, fmt.Errorf("failed to get exchange rates: %w", err)
+	}
+
+	s.rateBase = strings.ToUpper(base)
+	s.rates = rates
+	s.fetchedAt = time.Now()
+	return s.rateBase, s.rates, s.fetchedAt, nil
+}
+
+// rateAgainst returns the units of currency worth one unit of the rates' base
+func rateAgainst(rateBase string, rates map[string]float64, currency string) (float64, bool) {
+	if currency == rateBase {
+		return 1, true
+	}
+	rate, ok := rates[currency]
+	return rate, ok && rate > 0
+}
+
+// roundRate rounds an exchange rate to six decimal places
+func roundRate(rate float64) float64 {
+	return math.Round(rate*1e6) / 1e6
+}
+
+// ECBRateProvider fetches the European Central Bank's daily reference rates,
+// which are against the euro
+type ECBRateProvider struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// NewECBRateProvider creates a new ECB rate provider
+func NewECBRateProvider(cfg *config.CurrencyConfig) *ECBRateProvider {
+	return &ECBRateProvider{
+		URL: cfg.ECBRatesURL,
+		HTTPClient: &http.Client{
+			Timeout: cfg.HTTPTimeout,
+		},
+	}
+}
+
+// Name returns the provider name
+func (p *ECBRateProvider) Name() string {
+	return "ecb"
+}
+
+// ecbEnvelope is the eurofxref-daily.xml document
+type ecbEnvelope struct {
+	Cube struct {
+		Cube struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string  `xml:"currency,attr"`
+				Rate     float64 `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+// LatestRates fetches the latest reference rates
+func (p *ECBRateProvider) LatestRates() (string, map[string]float64, error) {
+	resp, err := p.HTTPClient.Get(p.URL)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch ECB rates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("ECB rates request failed with status %d", resp.StatusCode)
+	}
+
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return "", nil, fmt.Errorf("failed to parse ECB rates: %w", err)
+	}
+
+	rates := make(map[string]float64, len(envelope.Cube.Cube.Rates))
+	for _, rate := range envelope.Cube.Cube.Rates {
+		rates[strings.ToUpper(rate.Currency)] = rate.Rate
+	}
+	if len(rates) == 0 {
+		return "", nil, errors.New("ECB rates response has no rates")
+	}
+	return "EUR", rates, nil
+}
+
+// OpenExchangeRatesProvider fetches the latest rates from Open Exchange Rates
+type OpenExchangeRatesProvider struct {
+	APIURL     string
+	AppID      string
+	HTTPClient *http.Client
+}
+
+// NewOpenExchangeRatesProvider creates a new Open Exchange Rates provider
+func NewOpenExchangeRatesProvider(cfg *config.CurrencyConfig) *OpenExchangeRatesProvider {
+	return &OpenExchangeRatesProvider{
+		APIURL: cfg.OpenExchangeRatesURL,
+		AppID:  cfg.OpenExchangeRatesAppID,
+		HTTPClient: &http.Client{
+			Timeout: cfg.HTTPTimeout,
+		},
+	}
+}
+
+// Name returns the provider name
+func (p *OpenExchangeRatesProvider) Name() string {
+	return "openexchangerates"
+}
+
+// LatestRates fetches the latest rates
+func (p *OpenExchangeRatesProvider) LatestRates() (string, map[string]float64, error) {
+	endpoint := strings.TrimRight(p.APIURL, "/") + "/latest.json?app_id=" + url.QueryEscape(p.AppID)
+	resp, err := p.HTTPClient.Get(endpoint)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch Open Exchange Rates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("Open Exchange Rates request failed with status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Base  string             `json:"base"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", nil, fmt.Errorf("failed to parse Open Exchange Rates response: %w", err)
+	}
+	if result.Base == "" || len(result.Rates) == 0 {
+		return "", nil, errors.New("Open Exchange Rates response has no rates")
+	}
+	return result.Base, result.Rates, nil
+}
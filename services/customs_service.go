@@ -0,0 +1,280 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Customs document types
+const (
+	DocumentTypeCommercialInvoice   = "COMMERCIAL_INVOICE"
+	DocumentTypePackingList         = "PACKING_LIST"
+	DocumentTypeBillOfLading        = "BOL"
+	DocumentTypeCustomsDeclaration  = "CUSTOMS_DECLARATION"
+	DocumentTypeCertificateOfOrigin = "CERTIFICATE_OF_ORIGIN"
+	DocumentTypeDangerousGoods      = "DANGEROUS_GOODS_DECLARATION"
+	DocumentTypePhytosanitary       = "PHYTOSANITARY_CERTIFICATE"
+)
+
+// defaultCustomsExpiryWarning is how long before expiry shippers are alerted
+const defaultCustomsExpiryWarning = 14 * 24 * time.Hour
+
+// customsUnions lists trade blocs whose members need a certificate of origin
+// to claim preferential tariffs, or none at all for a customs union
+var customsUnions = []struct {
+	name              string
+	members           []string
+	freeMovement      bool // single customs territory, no declaration needed
+	certificateNeeded bool
+}{
+	{name: "EU", members: []string{"AT", "BE", "BG", "HR", "CY", "CZ", "DK", "EE", "FI", "FR", "DE", "GR", "HU", "IE", "IT", "LV", "LT", "LU", "MT", "NL", "PL", "PT", "RO", "SK", "SI", "ES", "SE"}, freeMovement: true},
+	{name: "SACU", members: []string{"ZA", "BW", "LS", "NA", "SZ"}, freeMovement: true},
+	{name: "SADC", members: []string{"AO", "BW", "KM", "CD", "SZ", "LS", "MG", "MW", "MU", "MZ", "NA", "SC", "ZA", "TZ", "ZM", "ZW"}, certificateNeeded: true},
+	{name: "USMCA", members: []string{"US", "CA", "MX"}, certificateNeeded: true},
+}
+
+// countryCodes maps common country names to ISO 3166-1 alpha-2 codes
+var countryCodes = map[string]string{
+	"SOUTH AFRICA": "ZA", "ZIMBABWE": "ZW", "BOTSWANA": "BW", "ZAMBIA": "ZM", "MOZAMBIQUE": "MZ",
+	"NAMIBIA": "NA", "MALAWI": "MW", "LESOTHO": "LS", "ESWATINI": "SZ", "SWAZILAND": "SZ",
+	"TANZANIA": "TZ", "ANGOLA": "AO", "KENYA": "KE", "UNITED STATES": "US", "USA": "US",
+	"CANADA": "CA", "MEXICO": "MX", "UNITED KINGDOM": "GB", "UK": "GB", "GERMANY": "DE",
+	"FRANCE": "FR", "NETHERLANDS": "NL", "BELGIUM": "BE", "SPAIN": "ES", "ITALY": "IT",
+	"POLAND": "PL", "CHINA": "CN", "INDIA": "IN",
+}
+
+// CustomsDocumentIssue is an expired or soon to expire document
+type CustomsDocumentIssue struct {
+	DocumentID     uint      `json:"document_id"`
+	DocumentType   string    `json:"document_type"`
+	DocumentNumber string    `json:"document_number"`
+	ExpiryDate     time.Time `json:"expiry_date"`
+}
+
+// CustomsComplianceReport lists the documents a load needs for its border
+// crossing and which of them are missing or expired
+type CustomsComplianceReport struct {
+	LoadID             uint                   `json:"load_id"`
+	OriginCountry      string                 `json:"origin_country"`
+	DestinationCountry string                 `json:"destination_country"`
+	International      bool                   `json:"international"`
+	RequiredDocuments  []string               `json:"required_documents"`
+	MissingDocuments   []string               `json:"missing_documents"`
+	ExpiredDocuments   []CustomsDocumentIssue `json:"expired_documents"`
+	ExpiringDocuments  []CustomsDocumentIssue `json:"expiring_documents"`
+	Compliant          bool                   `json:"compliant"`
+	CheckedAt          time.Time              `json:"checked_at"`
+}
+
+// CustomsService validates customs documents for loads and alerts shippers
+// about documents approaching expiry
+type CustomsService struct {
+	db                  *gorm.DB
+	notificationService *NotificationService
+	expiryWarning       time.Duration
+}
+
+// NewCustomsService creates a new customs service instance
+func NewCustomsService(db *gorm.DB) *CustomsService {
+	return &CustomsService{
+		db:                  db,
+		notificationService: NewNotificationService(db),
+		expiryWarning:       defaultCustomsExpiryWarning,
+	}
+}
+
+// RequiredCustomsDocuments returns the document types a load needs for its
+// origin/destination country pair
+func RequiredCustomsDocuments(load *models.Load) []string {
+	origin := normalizeCountry(load.PickupCountry)
+	destination := normalizeCountry(load.DeliveryCountry)
+
+	// Domestic, or the countries are unknown
+	if origin == "" || destination == "" || origin == destination {
+		required := []string{DocumentTypeBillOfLading}
+		if load.IsHazmat {
+			required = append(required, DocumentTypeDangerousGoods)
+		}
+		return required
+	}
+
+	required := []string{DocumentTypeBillOfLading, DocumentTypeCommercialInvoice}
+
+	freeMovement := false
+	certificateNeeded := false
+	for _, union := range customsUnions {
+		if containsString(union.members, origin) && containsString(union.members, destination) {
+			freeMovement = freeMovement || union.freeMovement
+			certificateNeeded = certificateNeeded || union.certificateNeeded
+		}
+	}
+
+	if !freeMovement {
+		required = append(required, DocumentTypePackingList, DocumentTypeCustomsDeclaration)
+		if certificateNeeded {
+			required = append(required, DocumentTypeCertificateOfOrigin)
+		}
+	}
+	if load.IsHazmat {
+		required = append(required, DocumentTypeDangerousGoods)
+	}
+	if load.Category == "FOOD" || load.Category == "AGRICULTURE" {
+		if !freeMovement {
+			required = append(required, DocumentTypePhytosanitary)
+		}
+	}
+
+	return required
+}
+
+// CheckLoadCompliance checks a load's customs documents against the documents
+// required for its route
+func (cs *CustomsService) CheckLoadCompliance(loadID uint) (*CustomsComplianceReport, error) {
+	var load models.Load
+	if err := cs.db.Preload("CustomsDocuments").First(&load, loadID).Error; err != nil {
+		return nil, errors.New("load not found")
+	}
+
+	return buildComplianceReport(&load, time.Now(), cs.expiryWarning), nil
+}
+
+// buildComplianceReport compares a load's documents with the required documents.
+// Documents expiring before the requested delivery date count as expiring.
+func buildComplianceReport(load *models.Load, now time.Time, expiryWarning time.Duration) *CustomsComplianceReport {
+	origin := normalizeCountry(load.PickupCountry)
+	destination := normalizeCountry(load.DeliveryCountry)
+
+	report := &CustomsComplianceReport{
+		LoadID:             load.ID,
+		OriginCountry:      origin,
+		DestinationCountry: destination,
+		International:      origin != "" && destination != "" && origin != destination,
+		RequiredDocuments:  RequiredCustomsDocuments(load),
+		MissingDocuments:   []string{},
+		ExpiredDocuments:   []CustomsDocumentIssue{},
+		ExpiringDocuments:  []CustomsDocumentIssue{},
+		CheckedAt:          now,
+	}
+
+	warnUntil := now.Add(expiryWarning)
+	if load.RequestedDeliveryDate.After(warnUntil) {
+		warnUntil = load.RequestedDeliveryDate
+	}
+
+	// A document type is satisfied by any of its documents that has not expired
+	valid := make(map[string]bool)
+	for _, document := range load.CustomsDocuments {
+		if document.ExpiryDate == nil {
+			valid[document.DocumentType] = true
+			continue
+		}
+
+		issue := CustomsDocumentIssue{
+			DocumentID:     document.ID,
+			DocumentType:   document.DocumentType,
+			DocumentNumber: document.DocumentNumber,
+			ExpiryDate:     *document.ExpiryDate,
+		}
+		switch {
+		case document.ExpiryDate.Before(now):
+			report.ExpiredDocuments = append(report.ExpiredDocuments, issue)
+		case document.ExpiryDate.Before(warnUntil):
+			report.ExpiringDocuments = append(report.ExpiringDocuments, issue)
+			valid[document.DocumentType] = true
+		default:
+			valid[document.DocumentType] = true
+		}
+	}
+
+	for _, documentType := range report.RequiredDocuments {
+		if !valid[documentType] {
+			report.MissingDocuments = append(report.MissingDocuments, documentType)
+		}
+	}
+
+	sort.Slice(report.ExpiringDocuments, func(i, j int) bool {
+		return report.ExpiringDocuments[i].ExpiryDate.Before(report.ExpiringDocuments[j].ExpiryDate)
+	})
+
+	report.Compliant = len(report.MissingDocuments) == 0
+	return report
+}
+
+// SendExpiryAlerts notifies shippers once about customs documents of active
+// loads that expire within the warning window
+func (cs *CustomsService) SendExpiryAlerts() error {
+	now := time.Now()
+
+	var documents []models.CustomsDocument
+	if err := cs.db.Joins("JOIN loads ON loads.id = customs_documents.load_id").
+		Where("customs_documents.expiry_date IS NOT NULL AND customs_documents.expiry_date BETWEEN ? AND ?", now, now.Add(cs.expiryWarning)).
+		Where("customs_documents.expiry_alert_sent_at IS NULL").
+		Where("loads.status NOT IN ?", []string{"DELIVERED", "CANCELLED"}).
+		Find(&documents).Error; err != nil {
+		return fmt.Errorf("failed to get expiring customs documents: %w", err)
+	}
+
+	sent := 0
+	for _, document := range documents {
+		var load models.Load
+		if err := cs.db.First(&load, document.LoadID).Error; err != nil {
+			continue
+		}
+
+		days := int(document.ExpiryDate.Sub(now).Hours() / 24)
+		message := fmt.Sprintf("%s %s expires on %s (%d days)", strings.ReplaceAll(document.DocumentType, "_", " "),
+			document.DocumentNumber, document.ExpiryDate.Format("2006-01-02"), days)
+		if load.BookingReference != "" {
+			message += fmt.Sprintf(" (Ref: %s)", load.BookingReference)
+		}
+
+		notification := models.Notification{
+			UserID:    load.ShipperID,
+			Title:     "Customs Document Expiring",
+			Message:   message,
+			Type:      "CUSTOMS_DOCUMENT_EXPIRING",
+			RelatedID: load.ID,
+		}
+		// The notification is stored even when push delivery fails, so only a
+		// nil notification means it has to be retried
+		if created, _, err := cs.notificationService.CreateNotificationWithDelivery(&notification); created == nil {
+			log.Printf("Failed to send customs expiry alert for document %d: %v", document.ID, err)
+			continue
+		}
+
+		if err := cs.db.Model(&document).Update("expiry_alert_sent_at", now).Error; err != nil {
+			log.Printf("Failed to mark customs expiry alert sent for document %d: %v", document.ID, err)
+		}
+		sent++
+	}
+
+	if sent > 0 {
+		log.Printf("Sent %d customs document expiry alerts", sent)
+	}
+	return nil
+}
+
+// normalizeCountry returns the ISO alpha-2 code of a country name or code
+func normalizeCountry(country string) string {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if code, exists := countryCodes[country]; exists {
+		return code
+	}
+	return country
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,738 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Delay risk levels of a prediction
+const (
+	DelayRiskLow      = "low"
+	DelayRiskModerate = "moderate"
+	DelayRiskHigh     = "high"
+)
+
+const (
+	// delayPredictionSampleInterval limits how often a trip's predicted
+	// delay is recorded, since it is predicted on every request
+	delayPredictionSampleInterval = time.Hour
+
+	// Predicted delays in minutes from which a trip is at moderate and high
+	// risk of arriving late
+	moderateDelayMinutes = 15
+	highDelayMinutes     = 60
+
+	// maxDelayAccuracyPredictions caps the predictions read for a report
+	maxDelayAccuracyPredictions = 100000
+)
+
+// Errors returned when the delay model can't predict or be trained
+var (
+	ErrNoDelayModel          = errors.New("no delay model has been trained yet")
+	ErrNotEnoughDelayHistory = errors.New("not enough completed trips to train the delay model")
+)
+
+// delayFeatures names the delay model's inputs, in the order of its
+// coefficients. Departures on Sundays have none of the weekday features.
+var delayFeatures = []string{
+	"lane_history", "carrier_history", "departure_hour_sin", "departure_hour_cos",
+	"monday", "tuesday", "wednesday", "thursday", "friday", "saturday",
+	"distance_km", "weather_slowdown",
+}
+
+// delayInput describes a trip to predict the delay of
+type delayInput struct {
+	OriginCity      string
+	DestinationCity string
+	CarrierID       uint
+	Departure       time.Time
+	DistanceKm      float64
+	WeatherSlowdown float64 // time the weather adds as a fraction of the trip's duration
+}
+
+// laneKey identifies the lane of a trip regardless of case and spacing
+func (in delayInput) laneKey() string {
+	return strings.ToLower(strings.TrimSpace(in.OriginCity)) + " - " + strings.ToLower(strings.TrimSpace(in.DestinationCity))
+}
+
+// carrierKey identifies the carrier of a trip in the delay history
+func (in delayInput) carrierKey() string {
+	return strconv.FormatUint(uint64(in.CarrierID), 10)
+}
+
+// delayTally sums the delays of a group of completed trips
+type delayTally struct {
+	Trips        int     `json:"trips"`
+	DelayMinutes float64 `json:"delay_minutes"`
+}
+
+// smoothed averages the group's delays with prior as if prior were the
+// delay of smoothing more trips
+func (t delayTally) smoothed(prior, smoothing float64) float64 {
+	if float64(t.Trips)+smoothing == 0 {
+		return prior
+	}
+	return (t.DelayMinutes + prior*smoothing) / (float64(t.Trips) + smoothing)
+}
+
+func (t delayTally) mean() float64 {
+	if t.Trips == 0 {
+		return 0
+	}
+	return t.DelayMinutes / float64(t.Trips)
+}
+
+// delayHistory is how late the trips of each lane and carrier arrived
+type delayHistory struct {
+	Overall  delayTally            `json:"overall"`
+	Lanes    map[string]delayTally `json:"lanes"`
+	Carriers map[string]delayTally `json:"carriers"` // by carrier user ID
+}
+
+func newDelayHistory() *delayHistory {
+	return &delayHistory{Lanes: map[string]delayTally{}, Carriers: map[string]delayTally{}}
+}
+
+func (h *delayHistory) add(in delayInput, delayMinutes float64) {
+	h.Overall.Trips++
+	h.Overall.DelayMinutes += delayMinutes
+
+	lane := h.Lanes[in.laneKey()]
+	lane.Trips++
+	lane.DelayMinutes += delayMinutes
+	h.Lanes[in.laneKey()] = lane
+
+	carrier := h.Carriers[in.carrierKey()]
+	carrier.Trips++
+	carrier.DelayMinutes += delayMinutes
+	h.Carriers[in.carrierKey()] = carrier
+}
+
+// features returns the model inputs of a trip given the history so far
+func (h *delayHistory) features(in delayInput, smoothing float64) []float64 {
+	prior := h.Overall.mean()
+	hour := 2 * math.Pi * (float64(in.Departure.UTC().Hour()) + float64(in.Departure.UTC().Minute())/60) / 24
+
+	x := make([]float64, len(delayFeatures))
+	x[0] = h.Lanes[in.laneKey()].smoothed(prior, smoothing)
+	x[1] = h.Carriers[in.carrierKey()].smoothed(prior, smoothing)
+	x[2] = math.Sin(hour)
+	x[3] = math.Cos(hour)
+	if weekday := in.Departure.UTC().Weekday(); weekday != time.Sunday {
+		x[3+int(weekday)] = 1
+	}
+	x[10] = in.DistanceKm
+	x[11] = in.WeatherSlowdown
+	return x
+}
+
+// delayModelParameters are what a trained delay model keeps to predict: a
+// ridge regression on standardized features, and the delay history the
+// lane and carrier features are looked up in
+type delayModelParameters struct {
+	Features     []string     `json:"features"`
+	Means        []float64    `json:"means"`
+	Scales       []float64    `json:"scales"`
+	Coefficients []float64    `json:"coefficients"`
+	Intercept    float64      `json:"intercept"`
+	History      delayHistory `json:"history"`
+}
+
+// contributions returns the minutes each feature adds to the mean delay
+func (p *delayModelParameters) contributions(x []float64) []float64 {
+	contributions := make([]float64, len(x))
+	for j := range x {
+		contributions[j] = p.Coefficients[j] * (x[j] - p.Means[j]) / p.Scales[j]
+	}
+	return contributions
+}
+
+func (p *delayModelParameters) predict(x []float64) float64 {
+	delay := p.Intercept
+	for _, contribution := range p.contributions(x) {
+		delay += contribution
+	}
+	return delay
+}
+
+// fitDelayRegression fits a ridge regression of the delays on the
+// standardized rows. The intercept, the mean delay, isn't penalized.
+func fitDelayRegression(rows [][]float64, delays []float64, regularization float64) delayModelParameters {
+	k := len(delayFeatures)
+	n := float64(len(rows))
+	params := delayModelParameters{
+		Features: delayFeatures,
+		Means:    make([]float64, k),
+		Scales:   make([]float64, k),
+	}
+
+	for _, delay := range delays {
+		params.Intercept += delay / n
+	}
+	for _, row := range rows {
+		for j, value := range row {
+			params.Means[j] += value / n
+		}
+	}
+	for _, row := range rows {
+		for j, value := range row {
+			params.Scales[j] += (value - params.Means[j]) * (value - params.Means[j]) / n
+		}
+	}
+	for j := range params.Scales {
+		params.Scales[j] = math.Sqrt(params.Scales[j])
+		if params.Scales[j] < 1e-9 {
+			params.Scales[j] = 1
+		}
+	}
+
+	// Normal equations (ZᵀZ + λI)w = Zᵀ(y - ȳ), as an augmented matrix
+	system := make([][]float64, k)
+	for i := range system {
+		system[i] = make([]float64, k+1)
+		system[i][i] = regularization
+	}
+	z := make([]float64, k)
+	for r, row := range rows {
+		for j, value := range row {
+			z[j] = (value - params.Means[j]) / params.Scales[j]
+		}
+		for i := 0; i < k; i++ {
+			for j := 0; j < k; j++ {
+				system[i][j] += z[i] * z[j]
+			}
+			system[i][k] += z[i] * (delays[r] - params.Intercept)
+		}
+	}
+	params.Coefficients = solveLinearSystem(system)
+	return params
+}
+
+// solveLinearSystem solves an augmented square system by Gaussian
+// elimination with partial pivoting. Unknowns without a usable pivot, such
+// as the coefficients of features that never vary, are 0.
+func solveLinearSystem(system [][]float64) []float64 {
+	k := len(system)
+	pivoted := make([]bool, k)
+	for col := 0; col < k; col++ {
+		best := col
+		for row := col + 1; row < k; row++ {
+			if math.Abs(system[row][col]) > math.Abs(system[best][col]) {
+				best = row
+			}
+		}
+		if math.Abs(system[best][col]) < 1e-12 {
+			continue
+		}
+		system[col], system[best] = system[best], system[col]
+		pivoted[col] = true
+		for row := col + 1; row < k; row++ {
+			factor := system[row][col] / system[col][col]
+			for j := col; j <= k; j++ {
+				system[row][j] -= factor * system[col][j]
+			}
+		}
+	}
+
+	solution := make([]float64, k)
+	for col := k - 1; col >= 0; col-- {
+		if !pivoted[col] {
+			continue
+		}
+		sum := system[col][k]
+		for j := col + 1; j < k; j++ {
+			sum -= system[col][j] * solution[j]
+		}
+		solution[col] = sum / system[col][col]
+	}
+	return solution
+}
+
+// delayTrip is a completed trip the delay model is trained on
+type delayTrip struct {
+	input         delayInput
+	actualArrival time.Time
+	delayMinutes  float64
+}
+
+// tripDelayInput describes a trip to the delay model
+func tripDelayInput(trip *models.Trip, weatherSlowdown float64) delayInput {
+	return delayInput{
+		OriginCity:      trip.OriginCity,
+		DestinationCity: trip.DestinationCity,
+		CarrierID:       trip.UserID,
+		Departure:       trip.DepartureDate,
+		DistanceKm:      geo.Distance(trip.OriginLat, trip.OriginLng, trip.DestinationLat, trip.DestinationLng),
+		WeatherSlowdown: weatherSlowdown,
+	}
+}
+
+// DelayModelReport describes the current delay model and how accurate the
+// delays predicted for completed trips were, overall, by model version and
+// by route. Errors are the actual minus the predicted delay.
+type DelayModelReport struct {
+	Model *models.DelayModel `json:"model"`
+	// Minutes of delay per standard deviation of each feature
+	Coefficients map[string]float64 `json:"coefficients,omitempty"`
+	Lanes        int                `json:"lanes"`
+	Carriers     int                `json:"carriers"`
+	Overall      ETAAccuracyStats   `json:"overall"`
+	ByModel      []ETAAccuracyStats `json:"by_model"`
+	ByRoute      []ETAAccuracyStats `json:"by_route"`
+	GeneratedAt  time.Time          `json:"generated_at"`
+}
+
+// DelayModelService trains a model of how late trips arrive on the history
+// of completed trips, predicts the delay of upcoming trips with it and
+// tracks how accurate its predictions turn out
+type DelayModelService struct {
+	db      *gorm.DB
+	cfg     *config.DelayModelConfig
+	weather *config.WeatherConfig
+	now     func() time.Time
+}
+
+// NewDelayModelService creates a new DelayModelService
+func NewDelayModelService(db *gorm.DB, cfg *config.DelayModelConfig) *DelayModelService {
+	return &DelayModelService{db: db, cfg: cfg, weather: config.GetWeatherConfig(), now: time.Now}
+}
+
+var (
+	delayModelServiceInstance *DelayModelService
+	delayModelServiceMu       sync.RWMutex
+)
+
+// GetDelayModelService returns the shared delay model service, or nil when
+// none was set up
+func GetDelayModelService() *DelayModelService {
+	delayModelServiceMu.RLock()
+	defer delayModelServiceMu.RUnlock()
+	return delayModelServiceInstance
+}
+
+// SetDelayModelService replaces the shared delay model service, which the
+// ML service predicts delivery delays with
+func SetDelayModelService(service *DelayModelService) {
+	delayModelServiceMu.Lock()
+	defer delayModelServiceMu.Unlock()
+	delayModelServiceInstance = service
+}
+
+// Train trains a new version of the model on the most recent completed
+// trips. Each trip is described by the history of the trips that arrived
+// before it departed, as it would have been when it was predicted. The
+// model is first trained without the trips that departed last to measure
+// its error on them, then on all the trips.
+func (s *DelayModelService) Train() (*models.DelayModel, error) {
+	trips, err := s.completedTrips()
+	if err != nil {
+		return nil, err
+	}
+	if len(trips) < s.cfg.MinTrainingTrips {
+		return nil, fmt.Errorf("%w: %d of %d", ErrNotEnoughDelayHistory, len(trips), s.cfg.MinTrainingTrips)
+	}
+
+	arrivals := append([]delayTrip{}, trips...)
+	sort.Slice(arrivals, func(i, j int) bool { return arrivals[i].actualArrival.Before(arrivals[j].actualArrival) })
+	sort.Slice(trips, func(i, j int) bool { return trips[i].input.Departure.Before(trips[j].input.Departure) })
+
+	history := newDelayHistory()
+	rows := make([][]float64, len(trips))
+	delays := make([]float64, len(trips))
+	arrived := 0
+	for i, trip := range trips {
+		for ; arrived < len(arrivals) && !arrivals[arrived].actualArrival.After(trip.input.Departure); arrived++ {
+			history.add(arrivals[arrived].input, arrivals[arrived].delayMinutes)
+		}
+		rows[i] = history.features(trip.input, s.cfg.SmoothingTrips)
+		delays[i] = trip.delayMinutes
+	}
+	for ; arrived < len(arrivals); arrived++ {
+		history.add(arrivals[arrived].input, arrivals[arrived].delayMinutes)
+	}
+
+	model := models.DelayModel{TrainedAt: s.now(), TrainingTrips: len(trips)}
+	if holdout := int(float64(len(trips)) * s.cfg.HoldoutFraction); holdout > 0 {
+		split := len(trips) - holdout
+		params := fitDelayRegression(rows[:split], delays[:split], s.cfg.Regularization)
+		var absErrors, baselineErrors float64
+		for i := split; i < len(trips); i++ {
+			absErrors += math.Abs(delays[i] - params.predict(rows[i]))
+			baselineErrors += math.Abs(delays[i] - params.Intercept)
+		}
+		model.HoldoutTrips = holdout
+		model.HoldoutMAEMinutes = roundHundredths(absErrors / float64(holdout))
+		model.BaselineMAEMinutes = roundHundredths(baselineErrors / float64(holdout))
+	}
+
+	params := fitDelayRegression(rows, delays, s.cfg.Regularization)
+	params.History = *history
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode delay model: %w", err)
+	}
+	model.Parameters = string(encoded)
+
+	var latest int
+	if err := s.db.Model(&models.DelayModel{}).Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+		return nil, fmt.Errorf("failed to get delay model version: %w", err)
+	}
+	model.Version = latest + 1
+	if err := s.db.Create(&model).Error; err != nil {
+		return nil, fmt.Errorf("failed to save delay model: %w", err)
+	}
+
+	log.Printf("Trained delay model v%d on %d trips (holdout MAE %.1f minutes, baseline %.1f)",
+		model.Version, model.TrainingTrips, model.HoldoutMAEMinutes, model.BaselineMAEMinutes)
+	return &model, nil
+}
+
+// completedTrips returns the most recently completed trips with a
+// scheduled arrival, and the weather last forecast on their routes
+func (s *DelayModelService) completedTrips() ([]delayTrip, error) {
+	var rows []struct {
+		models.Trip
+		WeatherSlowdown float64
+	}
+	if err := s.db.Table("trips").
+		Select("trips.*, COALESCE(tracking_statuses.weather_slowdown, 0) AS weather_slowdown").
+		Joins("LEFT JOIN tracking_statuses ON tracking_statuses.trip_id = trips.id AND tracking_statuses.deleted_at IS NULL").
+		Where("trips.status = ? AND trips.deleted_at IS NULL", "COMPLETED").
+		Where("trips.scheduled_arrival IS NOT NULL AND trips.actual_arrival IS NOT NULL").
+		Order("trips.actual_arrival DESC").
+		Limit(s.cfg.MaxTrainingTrips).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get completed trips: %w", err)
+	}
+
+	trips := make([]delayTrip, len(rows))
+	for i := range rows {
+		trip := &rows[i].Trip
+		trips[i] = delayTrip{
+			input:         tripDelayInput(trip, rows[i].WeatherSlowdown),
+			actualArrival: *trip.ActualArrival,
+			delayMinutes:  trip.ActualArrival.Sub(*trip.ScheduledArrival).Minutes(),
+		}
+	}
+	return trips, nil
+}
+
+// latestModel returns the most recently trained model and its parameters
+func (s *DelayModelService) latestModel() (*models.DelayModel, *delayModelParameters, error) {
+	var model models.DelayModel
+	err := s.db.Where("deleted_at IS NULL").Order("version DESC").First(&model).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrNoDelayModel
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get delay model: %w", err)
+	}
+
+	var params delayModelParameters
+	if err := json.Unmarshal([]byte(model.Parameters), &params); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode delay model v%d: %w", model.Version, err)
+	}
+	if len(params.Coefficients) != len(delayFeatures) {
+		return nil, nil, fmt.Errorf("delay model v%d has %d coefficients, expected %d", model.Version, len(params.Coefficients), len(delayFeatures))
+	}
+	return &model, &params, nil
+}
+
+// Predict predicts the delay of a trip on a lane from its carrier,
+// departure, distance and the weather on its route, without recording it
+func (s *DelayModelService) Predict(in delayInput) (*DelayPredictionResult, error) {
+	model, params, err := s.latestModel()
+	if err != nil {
+		return nil, err
+	}
+	result := s.explain(model, params, in)
+	result.RouteID = strings.TrimSpace(in.OriginCity + " - " + in.DestinationCity)
+	return result, nil
+}
+
+// PredictTrip predicts the delay of a trip and records the prediction to
+// evaluate once the trip completes
+func (s *DelayModelService) PredictTrip(tripID uint) (*DelayPredictionResult, error) {
+	var trip models.Trip
+	if err := s.db.First(&trip, tripID).Error; err != nil {
+		return nil, errors.New("trip not found")
+	}
+	model, params, err := s.latestModel()
+	if err != nil {
+		return nil, err
+	}
+	return s.predictTrip(&trip, model, params), nil
+}
+
+func (s *DelayModelService) predictTrip(trip *models.Trip, model *models.DelayModel, params *delayModelParameters) *DelayPredictionResult {
+	// In-transit trips have a forecast for the rest of their route
+	var status models.TrackingStatus
+	s.db.Where("trip_id = ? AND load_id IS NULL", trip.ID).First(&status)
+
+	result := s.explain(model, params, tripDelayInput(trip, status.WeatherSlowdown))
+	result.RouteID = strconv.FormatUint(uint64(trip.ID), 10)
+	result.TripID = trip.ID
+	scheduled := trip.EstimatedArrival
+	if trip.ScheduledArrival != nil {
+		scheduled = *trip.ScheduledArrival
+	}
+	if !scheduled.IsZero() {
+		predicted := scheduled.Add(time.Duration(result.PredictedDelay * float64(time.Minute)))
+		result.PredictedArrival = &predicted
+	}
+
+	// Only predictions of trips that are still to arrive can be evaluated
+	if trip.ScheduledArrival != nil && trip.Status != "COMPLETED" && trip.Status != "CANCELLED" {
+		if err := s.recordPrediction(trip, model.Version, result); err != nil {
+			log.Printf("Failed to record delay prediction for trip %d: %v", trip.ID, err)
+		}
+	}
+	return result
+}
+
+// recordPrediction stores a trip's predicted delay, unless the previous
+// prediction of the trip was made by the same model less than the sample
+// interval ago
+func (s *DelayModelService) recordPrediction(trip *models.Trip, version int, result *DelayPredictionResult) error {
+	var last models.DelayPrediction
+	err := s.db.Where("trip_id = ? AND deleted_at IS NULL", trip.ID).Order("predicted_at DESC").First(&last).Error
+	if err == nil && last.ModelVersion == version && result.PredictionTime.Sub(last.PredictedAt) < delayPredictionSampleInterval {
+		return nil
+	}
+
+	return s.db.Create(&models.DelayPrediction{
+		TripID:                trip.ID,
+		ModelVersion:          version,
+		PredictedAt:           result.PredictionTime,
+		ScheduledArrival:      *trip.ScheduledArrival,
+		PredictedDelayMinutes: result.PredictedDelay,
+	}).Error
+}
+
+// explain predicts a trip's delay and breaks it down into the factors that
+// make it differ from the mean delay of the trips the model was trained on
+func (s *DelayModelService) explain(model *models.DelayModel, params *delayModelParameters, in delayInput) *DelayPredictionResult {
+	history := &params.History
+	x := history.features(in, s.cfg.SmoothingTrips)
+	contributions := params.contributions(x)
+	delay := params.Intercept
+	for _, contribution := range contributions {
+		delay += contribution
+	}
+	delay = roundHundredths(delay)
+
+	lane := history.Lanes[in.laneKey()]
+	carrier := history.Carriers[in.carrierKey()]
+	laneSupport := float64(lane.Trips) / (float64(lane.Trips) + s.cfg.SmoothingTrips + 1)
+	carrierSupport := float64(carrier.Trips) / (float64(carrier.Trips) + s.cfg.SmoothingTrips + 1)
+	weekday := 0.0
+	for _, contribution := range contributions[4:10] {
+		weekday += contribution
+	}
+
+	factors := []PredictionFactor{
+		{
+			Factor:      "lane_history",
+			Impact:      contributions[0],
+			Confidence:  laneSupport,
+			Description: fmt.Sprintf("%d earlier trips from %s to %s arrived %.0f minutes late on average", lane.Trips, in.OriginCity, in.DestinationCity, lane.mean()),
+		},
+		{
+			Factor:      "carrier_history",
+			Impact:      contributions[1],
+			Confidence:  carrierSupport,
+			Description: fmt.Sprintf("The carrier's %d earlier trips arrived %.0f minutes late on average", carrier.Trips, carrier.mean()),
+		},
+		{
+			Factor:      "departure_hour",
+			Impact:      contributions[2] + contributions[3],
+			Description: fmt.Sprintf("Departing at %s UTC", in.Departure.UTC().Format("15:04")),
+		},
+		{
+			Factor:      "departure_weekday",
+			Impact:      weekday,
+			Description: "Departing on a " + in.Departure.UTC().Weekday().String(),
+		},
+		{
+			Factor:      "distance",
+			Impact:      contributions[10],
+			Description: fmt.Sprintf("%.0f km between origin and destination", in.DistanceKm),
+		},
+		{
+			Factor:      "weather",
+			Impact:      contributions[11],
+			Description: fmt.Sprintf("Weather on the route adds %.0f%% to the driving time", in.WeatherSlowdown*100),
+		},
+	}
+
+	// Impacts are the factors' minutes relative to the largest one, and the
+	// model is as confident in the others as in its overall fit
+	largest := 0.0
+	for _, factor := range factors {
+		largest = math.Max(largest, math.Abs(factor.Impact))
+	}
+	fit := 0.5
+	if model.BaselineMAEMinutes > 0 {
+		fit = math.Max(0, math.Min(1, 1-model.HoldoutMAEMinutes/model.BaselineMAEMinutes))
+	}
+	for i := range factors {
+		if largest > 0 {
+			factors[i].Impact = roundHundredths(factors[i].Impact / largest)
+		}
+		if i >= 2 {
+			factors[i].Confidence = fit
+		}
+		factors[i].Confidence = roundHundredths(factors[i].Confidence)
+	}
+
+	riskLevel := DelayRiskLow
+	recommendations := []string{}
+	switch {
+	case delay >= highDelayMinutes:
+		riskLevel = DelayRiskHigh
+		recommendations = append(recommendations,
+			fmt.Sprintf("Depart %.0f minutes earlier to arrive on schedule", delay),
+			"Let the consignees know the delivery is likely to be late")
+	case delay >= moderateDelayMinutes:
+		riskLevel = DelayRiskModerate
+		recommendations = append(recommendations, fmt.Sprintf("Depart %.0f minutes earlier to arrive on schedule", delay))
+	}
+	if in.WeatherSlowdown > 0 && contributions[11] >= moderateDelayMinutes {
+		recommendations = append(recommendations, "Check the weather forecast on the route before departure")
+	}
+
+	return &DelayPredictionResult{
+		PredictedDelay:  delay,
+		Confidence:      roundHundredths(0.2 + 0.6*(laneSupport+carrierSupport)/2 + 0.2*fit),
+		FactorsAnalyzed: factors,
+		RiskLevel:       riskLevel,
+		Recommendations: recommendations,
+		ModelUsed:       fmt.Sprintf("delay-regression-v%d", model.Version),
+		PredictionTime:  s.now(),
+	}
+}
+
+// ResolveDelayPredictions compares the open delay predictions of a trip
+// with how late it actually arrived
+func ResolveDelayPredictions(db *gorm.DB, tripID uint, actualArrival time.Time) error {
+	var predictions []models.DelayPrediction
+	if err := db.Where("trip_id = ? AND actual_arrival IS NULL AND deleted_at IS NULL", tripID).Find(&predictions).Error; err != nil {
+		return fmt.Errorf("failed to get delay predictions: %w", err)
+	}
+
+	for i := range predictions {
+		delay := actualArrival.Sub(predictions[i].ScheduledArrival).Minutes()
+		if err := db.Model(&predictions[i]).Updates(map[string]interface{}{
+			"actual_arrival": actualArrival,
+			"error_minutes":  delay - predictions[i].PredictedDelayMinutes,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to resolve delay prediction: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetReport describes the current model and evaluates the resolved
+// predictions of all models
+func (s *DelayModelService) GetReport() (*DelayModelReport, error) {
+	report := &DelayModelReport{GeneratedAt: s.now()}
+	model, params, err := s.latestModel()
+	if err != nil && !errors.Is(err, ErrNoDelayModel) {
+		return nil, err
+	}
+	if model != nil {
+		report.Model = model
+		report.Coefficients = make(map[string]float64, len(params.Features))
+		for j, feature := range params.Features {
+			report.Coefficients[feature] = roundHundredths(params.Coefficients[j])
+		}
+		report.Lanes = len(params.History.Lanes)
+		report.Carriers = len(params.History.Carriers)
+	}
+
+	var rows []struct {
+		models.DelayPrediction
+		OriginCity      string
+		DestinationCity string
+	}
+	if err := s.db.Table("delay_predictions").
+		Select("delay_predictions.*, trips.origin_city, trips.destination_city").
+		Joins("JOIN trips ON trips.id = delay_predictions.trip_id").
+		Where("delay_predictions.error_minutes IS NOT NULL AND delay_predictions.deleted_at IS NULL").
+		Order("delay_predictions.predicted_at DESC").
+		Limit(maxDelayAccuracyPredictions).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get delay predictions: %w", err)
+	}
+
+	var all []float64
+	byModel := make(map[string][]float64)
+	byRoute := make(map[string][]float64)
+	for _, row := range rows {
+		errorMinutes := *row.ErrorMinutes
+		all = append(all, errorMinutes)
+		version := fmt.Sprintf("v%d", row.ModelVersion)
+		byModel[version] = append(byModel[version], errorMinutes)
+		route := fmt.Sprintf("%s - %s", row.OriginCity, row.DestinationCity)
+		byRoute[route] = append(byRoute[route], errorMinutes)
+	}
+	report.Overall = calculateETAAccuracy("all", all)
+	report.ByModel = groupETAAccuracy(byModel)
+	report.ByRoute = groupETAAccuracy(byRoute)
+	return report, nil
+}
+
+// RunScheduled trains a new model once the current one is older than the
+// retrain interval, then predicts the delay of the open trips departing
+// within the prediction horizon
+func (s *DelayModelService) RunScheduled() error {
+	model, _, err := s.latestModel()
+	if err != nil && !errors.Is(err, ErrNoDelayModel) {
+		return err
+	}
+	if model == nil || s.now().Sub(model.TrainedAt) >= s.cfg.RetrainInterval {
+		if _, err := s.Train(); errors.Is(err, ErrNotEnoughDelayHistory) {
+			log.Printf("Delay model not trained: %v", err)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	model, params, err := s.latestModel()
+	if errors.Is(err, ErrNoDelayModel) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var trips []models.Trip
+	if err := s.db.Where("status NOT IN ? AND departure_date <= ? AND deleted_at IS NULL",
+		[]string{"COMPLETED", "CANCELLED"}, s.now().Add(s.cfg.PredictionHorizon)).
+		Find(&trips).Error; err != nil {
+		return fmt.Errorf("failed to get upcoming trips: %w", err)
+	}
+	for i := range trips {
+		s.predictTrip(&trips[i], model, params)
+	}
+	return nil
+}
+
+// weatherConditionSlowdown returns the time a weather condition adds to a
+// trip as a fraction of its duration
+func (s *DelayModelService) weatherConditionSlowdown(condition string) float64 {
+	return 1/weatherSpeedFactor(s.weather, WeatherCondition{Condition: condition}) - 1
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Device tracking modes
+const (
+	DeviceTrackingMoving          = "MOVING"
+	DeviceTrackingApproaching     = "APPROACHING"
+	DeviceTrackingStationary      = "STATIONARY"
+	DeviceTrackingLowBattery      = "LOW_BATTERY"
+	DeviceTrackingCriticalBattery = "CRITICAL_BATTERY"
+	DeviceTrackingOff             = "OFF"
+)
+
+// DeviceTrackingSettings are the tracking settings recommended to a driver's
+// device for a trip, along with the readings they were derived from
+type DeviceTrackingSettings struct {
+	TripID uint   `json:"trip_id"`
+	Mode   string `json:"mode"` // MOVING, APPROACHING, STATIONARY, LOW_BATTERY, CRITICAL_BATTERY, OFF
+	Reason string `json:"reason"`
+
+	TrackingEnabled       bool `json:"tracking_enabled"`
+	UpdateIntervalSeconds int  `json:"update_interval_seconds"`
+	DistanceFilterMeters  int  `json:"distance_filter_meters"`
+	HighAccuracyMode      bool `json:"high_accuracy_mode"`
+	// Queue positions on the device and upload them together
+	BatchUploads bool `json:"batch_uploads"`
+
+	SpeedKmh             *float64  `json:"speed_kmh,omitempty"`
+	DistanceToNextStopKm *float64  `json:"distance_to_next_stop_km,omitempty"`
+	BatteryLevel         *float64  `json:"battery_level,omitempty"`
+	CalculatedAt         time.Time `json:"calculated_at"`
+}
+
+// sameAs reports whether other tells the device to track the same way
+func (s *DeviceTrackingSettings) sameAs(other *DeviceTrackingSettings) bool {
+	return s.Mode == other.Mode &&
+		s.TrackingEnabled == other.TrackingEnabled &&
+		s.UpdateIntervalSeconds == other.UpdateIntervalSeconds &&
+		s.DistanceFilterMeters == other.DistanceFilterMeters &&
+		s.HighAccuracyMode == other.HighAccuracyMode &&
+		s.BatchUploads == other.BatchUploads
+}
+
+// RecommendTrackingSettings recommends tracking settings for a trip's device
+// from its latest position: its speed, its distance to the next stop and the
+// device's battery level. batteryLevel overrides the level last reported
+// with a position.
+func (ts *TrackingService) RecommendTrackingSettings(tripID uint, batteryLevel *float64) (*DeviceTrackingSettings, error) {
+	var trip models.Trip
+	if err := ts.db.First(&trip, tripID).Error; err != nil {
+		return nil, err
+	}
+
+	var latest models.TrackingRecord
+	err := ts.db.Where("trip_id = ?", tripID).Order("timestamp DESC").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get current location: %w", err)
+	}
+
+	var distanceToNextStop *float64
+	if latest.ID != 0 {
+		if batteryLevel == nil {
+			batteryLevel = latest.BatteryLevel
+		}
+		if next, ok := ts.nextStopPosition(&trip); ok {
+			distance := geo.Distance(latest.Latitude, latest.Longitude, next.Latitude, next.Longitude)
+			distanceToNextStop = &distance
+		}
+	}
+
+	settings := recommendDeviceSettings(ts.device, latest.Speed, distanceToNextStop, batteryLevel)
+	settings.TripID = tripID
+	settings.CalculatedAt = time.Now()
+	return settings, nil
+}
+
+// nextStopPosition returns where the trip goes next: its next stop that
+// hasn't been completed or skipped, or its destination when it has no stops
+func (ts *TrackingService) nextStopPosition(trip *models.Trip) (Coordinate, bool) {
+	var stop models.TripStop
+	err := ts.db.Where("trip_id = ? AND status IN ?", trip.ID, []string{TripStopPending, TripStopArrived}).
+		Order("sequence ASC").First(&stop).Error
+	if err == nil {
+		return Coordinate{Latitude: stop.Latitude, Longitude: stop.Longitude}, true
+	}
+	if trip.DestinationLat != 0 || trip.DestinationLng != 0 {
+		return Coordinate{Latitude: trip.DestinationLat, Longitude: trip.DestinationLng}, true
+	}
+	return Coordinate{}, false
+}
+
+// recommendDeviceSettings picks the update interval for the vehicle's
+// movement, then slows tracking down as the battery runs low. Readings that
+// are unknown are nil.
+func recommendDeviceSettings(cfg *config.DeviceTrackingConfig, speedKmh, distanceToNextStopKm, batteryLevel *float64) *DeviceTrackingSettings {
+	settings := &DeviceTrackingSettings{
+		Mode:                 DeviceTrackingMoving,
+		TrackingEnabled:      true,
+		SpeedKmh:             speedKmh,
+		DistanceToNextStopKm: distanceToNextStopKm,
+		BatteryLevel:         batteryLevel,
+	}
+	interval := cfg.DefaultInterval
+	settings.DistanceFilterMeters = int(cfg.TargetSpacingMeters / 10)
+
+	switch {
+	case distanceToNextStopKm != nil && *distanceToNextStopKm <= cfg.ApproachDistanceKm:
+		settings.Mode = DeviceTrackingApproaching
+		settings.Reason = fmt.Sprintf("Within %.1f km of the next stop", *distanceToNextStopKm)
+		interval = cfg.ApproachInterval
+		settings.DistanceFilterMeters = 0
+		settings.HighAccuracyMode = true
+	case speedKmh != nil && *speedKmh < cfg.StationarySpeedKmh:
+		settings.Mode = DeviceTrackingStationary
+		settings.Reason = "Vehicle is stationary"
+		interval = cfg.StationaryInterval
+		settings.BatchUploads = true
+	case speedKmh != nil:
+		// Space positions evenly along the road whatever the speed
+		metersPerSecond := *speedKmh / 3.6
+		interval = time.Duration(cfg.TargetSpacingMeters / metersPerSecond * float64(time.Second))
+		interval = time.Duration(math.Max(float64(cfg.MinInterval), math.Min(float64(cfg.MaxInterval), float64(interval))))
+		settings.Reason = fmt.Sprintf("Moving at %.0f km/h", *speedKmh)
+	default:
+		settings.Reason = "Speed not reported yet"
+	}
+
+	if batteryLevel != nil {
+		switch {
+		case *batteryLevel <= cfg.StopTrackingPercent:
+			settings.Mode = DeviceTrackingOff
+			settings.Reason = fmt.Sprintf("Battery at %.0f%%", *batteryLevel)
+			settings.TrackingEnabled = false
+			settings.HighAccuracyMode = false
+			interval = 0
+		case *batteryLevel <= cfg.CriticalBatteryPercent:
+			settings.Mode = DeviceTrackingCriticalBattery
+			settings.Reason = fmt.Sprintf("Battery at %.0f%%", *batteryLevel)
+			settings.HighAccuracyMode = false
+			settings.BatchUploads = true
+			if interval < cfg.StationaryInterval {
+				interval = cfg.StationaryInterval
+			}
+		case *batteryLevel <= cfg.LowBatteryPercent:
+			// Arrivals are still tracked closely, at half the usual rate
+			if settings.Mode != DeviceTrackingApproaching {
+				settings.Mode = DeviceTrackingLowBattery
+				settings.Reason = fmt.Sprintf("Battery at %.0f%%", *batteryLevel)
+				settings.HighAccuracyMode = false
+			}
+			settings.BatchUploads = true
+			interval *= 2
+		}
+	}
+
+	settings.UpdateIntervalSeconds = int(interval / time.Second)
+	return settings
+}
+
+// PushTrackingSettings recommends tracking settings for a trip's device and
+// pushes them to the device when they differ from the settings it was last sent
+func (ts *TrackingService) PushTrackingSettings(tripID uint, batteryLevel *float64) (*DeviceTrackingSettings, error) {
+	settings, err := ts.RecommendTrackingSettings(tripID, batteryLevel)
+	if err != nil {
+		return nil, err
+	}
+	GetDeviceConfigHub().Publish(settings)
+	return settings, nil
+}
+
+// DeviceConfigHub pushes changed tracking settings to the devices of trips
+// connected to this instance. Devices connected elsewhere pick the settings
+// up from the responses to their location updates.
+type DeviceConfigHub struct {
+	mu          sync.Mutex
+	subscribers map[uint]map[chan DeviceTrackingSettings]struct{}
+	latest      map[uint]*DeviceTrackingSettings
+}
+
+// NewDeviceConfigHub creates a device config hub
+func NewDeviceConfigHub() *DeviceConfigHub {
+	return &DeviceConfigHub{
+		subscribers: make(map[uint]map[chan DeviceTrackingSettings]struct{}),
+		latest:      make(map[uint]*DeviceTrackingSettings),
+	}
+}
+
+var deviceConfigHubInstance = NewDeviceConfigHub()
+
+// GetDeviceConfigHub returns the hub shared by the tracking service and the
+// device config streams
+func GetDeviceConfigHub() *DeviceConfigHub {
+	return deviceConfigHubInstance
+}
+
+// Publish sends settings to the trip's devices when they changed, returning
+// whether they did
+func (h *DeviceConfigHub) Publish(settings *DeviceTrackingSettings) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if latest, ok := h.latest[settings.TripID]; ok && latest.sameAs(settings) {
+		return false
+	}
+	h.latest[settings.TripID] = settings
+
+	for subscriber := range h.subscribers[settings.TripID] {
+		// Only the newest settings matter to a device that is behind
+		select {
+		case <-subscriber:
+		default:
+		}
+		subscriber <- *settings
+	}
+	return true
+}
+
+// Latest returns the settings last pushed for a trip, or nil
+func (h *DeviceConfigHub) Latest(tripID uint) *DeviceTrackingSettings {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.latest[tripID]
+}
+
+// Subscribe returns a channel receiving the settings pushed for a trip and a
+// function to stop receiving them
+func (h *DeviceConfigHub) Subscribe(tripID uint) (<-chan DeviceTrackingSettings, func()) {
+	updates := make(chan DeviceTrackingSettings, 1)
+
+	h.mu.Lock()
+	if h.subscribers[tripID] == nil {
+		h.subscribers[tripID] = make(map[chan DeviceTrackingSettings]struct{})
+	}
+	h.subscribers[tripID][updates] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[tripID], updates)
+			if len(h.subscribers[tripID]) == 0 {
+				delete(h.subscribers, tripID)
+			}
+			h.mu.Unlock()
+			close(updates)
+		})
+	}
+	return updates, unsubscribe
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ScanResult is the outcome of a virus scan
+type ScanResult struct {
+	Clean     bool
+	Signature string // name of the virus found, when not clean
+}
+
+// DocumentScanner scans uploaded documents for viruses
+type DocumentScanner interface {
+	Scan(data []byte) (*ScanResult, error)
+}
+
+// clamAVChunkSize is the size of the chunks streamed to clamd
+const clamAVChunkSize = 64 * 1024
+
+// ClamAVScanner scans files with a clamd daemon using its INSTREAM command
+type ClamAVScanner struct {
+	Address string
+	Timeout time.Duration
+}
+
+// NewClamAVScanner creates a new ClamAV scanner for the clamd at address
+func NewClamAVScanner(address string, timeout time.Duration) *ClamAVScanner {
+	return &ClamAVScanner{
+		Address: address,
+		Timeout: timeout,
+	}
+}
+
+// Scan streams data to clamd and parses its verdict
+func (s *ClamAVScanner) Scan(data []byte) (*ScanResult, error) {
+	conn, err := net.DialTimeout("tcp", s.Address, s.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.Timeout))
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, fmt.Errorf("failed to send scan command: %w", err)
+	}
+
+	// Each chunk is prefixed with its length; a zero length ends the stream
+	size := make([]byte, 4)
+	for offset := 0; offset < len(data); offset += clamAVChunkSize {
+		end := offset + clamAVChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		binary.BigEndian.PutUint32(size, uint32(end-offset))
+		if _, err := conn.Write(size); err != nil {
+			return nil, fmt.Errorf("failed to stream file to clamd: %w", err)
+		}
+		if _, err := conn.Write(data[offset:end]); err != nil {
+			return nil, fmt.Errorf("failed to stream file to clamd: %w", err)
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return nil, fmt.Errorf("failed to stream file to clamd: %w", err)
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return parseClamAVReply(string(bytes.TrimRight(reply, "\x00\n")))
+}
+
+// parseClamAVReply parses replies such as "stream: OK" and
+// "stream: Eicar-Test-Signature FOUND"
+func parseClamAVReply(reply string) (*ScanResult, error) {
+	verdict := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case verdict == "OK":
+		return &ScanResult{Clean: true}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return &ScanResult{Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	default:
+		return nil, fmt.Errorf("clamd scan failed: %s", reply)
+	}
+}
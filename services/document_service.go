@@ -0,0 +1,443 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Document statuses
+const (
+	DocumentPendingUpload = "PENDING_UPLOAD"
+	DocumentAvailable     = "AVAILABLE"
+	DocumentInfected      = "INFECTED"
+)
+
+// documentTypes are the accepted document types
+var documentTypes = map[string]bool{
+	"DRIVER_LICENSE":       true,
+	"BUSINESS_LICENSE":     true,
+	"INSURANCE":            true,
+	"VEHICLE_REGISTRATION": true,
+	"CUSTOMS":              true,
+	"PROOF_OF_DELIVERY":    true,
+	"INVOICE":              true,
+	"OTHER":                true,
+}
+
+// userDocumentFields are the user columns referencing an account's license
+// documents, set when the document is uploaded
+var userDocumentFields = map[string]string{
+	"DRIVER_LICENSE":   "driver_license",
+	"BUSINESS_LICENSE": "business_license",
+}
+
+// ErrDocumentInfected is returned when an uploaded document fails the virus scan
+var ErrDocumentInfected = errors.New("document failed virus scan")
+
+// DocumentUploadRequest describes a document about to be uploaded
+type DocumentUploadRequest struct {
+	DocumentType string `json:"document_type"`
+	FileName     string `json:"file_name"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	LoadID       *uint  `json:"load_id,omitempty"`
+}
+
+// DocumentURL is a time-limited URL to upload or download a document
+type DocumentURL struct {
+	Document  models.Document   `json:"document"`
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// DocumentFilter narrows the documents listed
+type DocumentFilter struct {
+	LoadID       *uint
+	DocumentType string
+}
+
+// DocumentService stores documents in file storage. Clients upload and
+// download them directly with presigned URLs when the storage supports them,
+// or through the API otherwise. Uploads are checked for size and content type
+// and scanned for viruses before they become available.
+type DocumentService struct {
+	db      *gorm.DB
+	storage FileStorage
+	scanner DocumentScanner
+	cfg     *config.DocumentConfig
+}
+
+// NewDocumentService creates a new document service. Uploads are scanned
+// with ClamAV when an address is configured.
+func NewDocumentService(db *gorm.DB, storage FileStorage, cfg *config.DocumentConfig) *DocumentService {
+	ds := &DocumentService{
+		db:      db,
+		storage: storage,
+		cfg:     cfg,
+	}
+	if cfg.ClamAVAddress != "" {
+		ds.scanner = NewClamAVScanner(cfg.ClamAVAddress, cfg.ClamAVTimeout)
+	}
+	return ds
+}
+
+// SetStorage replaces the storage documents are kept in
+func (ds *DocumentService) SetStorage(storage FileStorage) {
+	ds.storage = storage
+}
+
+// SetScanner replaces the virus scanner, nil disables scanning
+func (ds *DocumentService) SetScanner(scanner DocumentScanner) {
+	ds.scanner = scanner
+}
+
+// CreateUpload validates a document and returns the URL to upload it to.
+// The document stays PENDING_UPLOAD until the upload is completed.
+func (ds *DocumentService) CreateUpload(userID uint, req DocumentUploadRequest) (*DocumentURL, error) {
+	req.DocumentType = strings.ToUpper(req.DocumentType)
+	if !documentTypes[req.DocumentType] {
+		return nil, fmt.Errorf("unsupported document type %s", req.DocumentType)
+	}
+	fileName := path.Base(strings.ReplaceAll(strings.TrimSpace(req.FileName), "\\", "/"))
+	if fileName == "" || fileName == "." || fileName == "/" {
+		return nil, errors.New("file_name is required")
+	}
+	if req.Size <= 0 {
+		return nil, errors.New("size is required")
+	}
+	if req.Size > ds.cfg.MaxSize {
+		return nil, fmt.Errorf("file exceeds maximum size of %d bytes", ds.cfg.MaxSize)
+	}
+	if !ds.allowedContentType(req.ContentType) {
+		return nil, fmt.Errorf("unsupported file type %s", req.ContentType)
+	}
+	if req.LoadID != nil {
+		if err := ds.checkLoadAccess(userID, *req.LoadID); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := documentKey(userID, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	document := models.Document{
+		OwnerID:      userID,
+		LoadID:       req.LoadID,
+		DocumentType: req.DocumentType,
+		FileName:     fileName,
+		ContentType:  req.ContentType,
+		Size:         req.Size,
+		StorageKey:   key,
+		Status:       DocumentPendingUpload,
+	}
+	if err := ds.db.Create(&document).Error; err != nil {
+		return nil, fmt.Errorf("failed to save document: %w", err)
+	}
+
+	upload := &DocumentURL{
+		Document:  document,
+		Method:    "PUT",
+		Headers:   map[string]string{"Content-Type": req.ContentType},
+		ExpiresAt: time.Now().Add(ds.cfg.URLExpiry),
+	}
+	if presigner, ok := ds.storage.(PresignedURLStorage); ok {
+		upload.URL, err = presigner.PresignURL("PUT", key, ds.cfg.URLExpiry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to presign upload URL: %w", err)
+		}
+	} else {
+		upload.URL = documentContentPath(document.ID)
+	}
+	return upload, nil
+}
+
+// StoreContent uploads a document's file through the API, for storage
+// without presigned URLs, and completes the upload
+func (ds *DocumentService) StoreContent(userID, documentID uint, data []byte) (*models.Document, error) {
+	document, err := ds.pendingDocument(userID, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ds.validateContent(document, data); err != nil {
+		return nil, err
+	}
+	if _, err := ds.storage.Put(document.StorageKey, document.ContentType, data); err != nil {
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
+	return ds.finishUpload(document, data)
+}
+
+// CompleteUpload checks a document uploaded to its presigned URL and makes it
+// available. Files that fail validation or the virus scan are removed.
+func (ds *DocumentService) CompleteUpload(userID, documentID uint) (*models.Document, error) {
+	document, err := ds.pendingDocument(userID, documentID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ds.storage.Get(document.StorageKey)
+	if err != nil {
+		return nil, errors.New("document has not been uploaded")
+	}
+	if err := ds.validateContent(document, data); err != nil {
+		ds.deleteFile(document)
+		return nil, err
+	}
+	return ds.finishUpload(document, data)
+}
+
+// pendingDocument returns a document of the user awaiting its upload
+func (ds *DocumentService) pendingDocument(userID, documentID uint) (*models.Document, error) {
+	var document models.Document
+	if err := ds.db.First(&document, documentID).Error; err != nil || document.OwnerID != userID {
+		return nil, errors.New("document not found")
+	}
+	if document.Status != DocumentPendingUpload {
+		return nil, errors.New("document has already been uploaded")
+	}
+	return &document, nil
+}
+
+// validateContent checks an uploaded file against the size limit and the
+// allowed content types. The content type is detected from the file rather
+// than trusted from the client.
+func (ds *DocumentService) validateContent(document *models.Document, data []byte) error {
+	if len(data) == 0 {
+		return errors.New("file is empty")
+	}
+	if int64(len(data)) > ds.cfg.MaxSize {
+		return fmt.Errorf("file exceeds maximum size of %d bytes", ds.cfg.MaxSize)
+	}
+	contentType := http.DetectContentType(data)
+	if !ds.allowedContentType(contentType) {
+		return fmt.Errorf("unsupported file type %s", contentType)
+	}
+	document.ContentType = contentType
+	document.Size = int64(len(data))
+	return nil
+}
+
+// finishUpload scans an uploaded document and marks it available, or infected
+func (ds *DocumentService) finishUpload(document *models.Document, data []byte) (*models.Document, error) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"content_type": document.ContentType,
+		"size":         document.Size,
+		"uploaded_at":  &now,
+		"status":       DocumentAvailable,
+	}
+
+	if ds.scanner != nil {
+		result, err := ds.scanner.Scan(data)
+		if err != nil {
+			// The document stays pending so the upload can be completed again
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		updates["scanned_at"] = &now
+		if result.Clean {
+			updates["scan_result"] = "CLEAN"
+		} else {
+			updates["scan_result"] = result.Signature
+			updates["status"] = DocumentInfected
+		}
+	}
+
+	err := ds.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(document).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update document: %w", err)
+		}
+		field, linked := userDocumentFields[document.DocumentType]
+		if linked && document.LoadID == nil && updates["status"] == DocumentAvailable {
+			if err := tx.Model(&models.User{}).Where("id = ?", document.OwnerID).
+				Update(field, documentPath(document.ID)).Error; err != nil {
+				return fmt.Errorf("failed to link document to user: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ds.db.First(document, document.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to reload document: %w", err)
+	}
+	if document.Status == DocumentInfected {
+		log.Printf("Document %d uploaded by user %d is infected: %s", document.ID, document.OwnerID, document.ScanResult)
+		ds.deleteFile(document)
+		return document, ErrDocumentInfected
+	}
+	return document, nil
+}
+
+// GetDocument returns a document the user owns or can see through its load
+func (ds *DocumentService) GetDocument(userID, documentID uint) (*models.Document, error) {
+	var document models.Document
+	if err := ds.db.First(&document, documentID).Error; err != nil {
+		return nil, errors.New("document not found")
+	}
+	if document.OwnerID == userID || ds.isAdmin(userID) {
+		return &document, nil
+	}
+	if document.LoadID != nil && ds.checkLoadAccess(userID, *document.LoadID) == nil {
+		return &document, nil
+	}
+	return nil, errors.New("document not found")
+}
+
+// ListDocuments returns the user's documents, or all documents of a load the
+// user takes part in, newest first
+func (ds *DocumentService) ListDocuments(userID uint, filter DocumentFilter) ([]models.Document, error) {
+	query := ds.db.Model(&models.Document{})
+	if filter.LoadID != nil {
+		if err := ds.checkLoadAccess(userID, *filter.LoadID); err != nil {
+			return nil, err
+		}
+		query = query.Where("load_id = ?", *filter.LoadID)
+	} else {
+		query = query.Where("owner_id = ?", userID)
+	}
+	if filter.DocumentType != "" {
+		query = query.Where("document_type = ?", strings.ToUpper(filter.DocumentType))
+	}
+
+	var documents []models.Document
+	if err := query.Order("created_at DESC, id DESC").Find(&documents).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch documents: %w", err)
+	}
+	return documents, nil
+}
+
+// DownloadURL returns a time-limited URL to download an available document
+func (ds *DocumentService) DownloadURL(userID, documentID uint) (*DocumentURL, error) {
+	document, err := ds.GetDocument(userID, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if document.Status != DocumentAvailable {
+		return nil, errors.New("document is not available")
+	}
+
+	download := &DocumentURL{
+		Document:  *document,
+		Method:    "GET",
+		ExpiresAt: time.Now().Add(ds.cfg.URLExpiry),
+	}
+	if presigner, ok := ds.storage.(PresignedURLStorage); ok {
+		download.URL, err = presigner.PresignURL("GET", document.StorageKey, ds.cfg.URLExpiry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to presign download URL: %w", err)
+		}
+	} else {
+		download.URL = documentContentPath(document.ID)
+	}
+	return download, nil
+}
+
+// ReadContent returns the file of an available document
+func (ds *DocumentService) ReadContent(userID, documentID uint) (*models.Document, []byte, error) {
+	document, err := ds.GetDocument(userID, documentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if document.Status != DocumentAvailable {
+		return nil, nil, errors.New("document is not available")
+	}
+	data, err := ds.storage.Get(document.StorageKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	return document, data, nil
+}
+
+// DeleteDocument deletes a document the user owns and its file
+func (ds *DocumentService) DeleteDocument(userID, documentID uint) error {
+	var document models.Document
+	if err := ds.db.First(&document, documentID).Error; err != nil || document.OwnerID != userID {
+		return errors.New("document not found")
+	}
+	if err := ds.db.Delete(&document).Error; err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	ds.deleteFile(&document)
+	return nil
+}
+
+// deleteFile removes a document's file from storage
+func (ds *DocumentService) deleteFile(document *models.Document) {
+	if err := ds.storage.Delete(document.StorageKey); err != nil {
+		log.Printf("Failed to delete file of document %d: %v", document.ID, err)
+	}
+}
+
+// checkLoadAccess checks that the user is the load's shipper, the carrier of
+// the trip it is booked on, or an admin
+func (ds *DocumentService) checkLoadAccess(userID, loadID uint) error {
+	var load models.Load
+	if err := ds.db.First(&load, loadID).Error; err != nil {
+		return errors.New("load not found")
+	}
+	if load.ShipperID == userID || ds.isAdmin(userID) {
+		return nil
+	}
+	if load.TripID != 0 {
+		var trip models.Trip
+		if err := ds.db.First(&trip, load.TripID).Error; err == nil && trip.UserID == userID {
+			return nil
+		}
+	}
+	return errors.New("load not found")
+}
+
+// isAdmin reports whether the user is an admin
+func (ds *DocumentService) isAdmin(userID uint) bool {
+	var count int64
+	ds.db.Model(&models.User{}).Where("id = ? AND role = ?", userID, "ADMIN").Count(&count)
+	return count > 0
+}
+
+// allowedContentType reports whether a content type may be uploaded
+func (ds *DocumentService) allowedContentType(contentType string) bool {
+	contentType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	for _, allowed := range ds.cfg.AllowedContentTypes {
+		if strings.EqualFold(contentType, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// documentKey returns a unique storage key for a user's document
+func documentKey(userID uint, fileName string) (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate document key: %w", err)
+	}
+	return fmt.Sprintf("documents/%d/%s/%s", userID, hex.EncodeToString(buf), fileName), nil
+}
+
+// documentPath is the API path of a document
+func documentPath(documentID uint) string {
+	return fmt.Sprintf("/api/documents/%d", documentID)
+}
+
+// documentContentPath is the API path to upload and download a document's
+// file when the storage can't presign URLs
+func documentContentPath(documentID uint) string {
+	return documentPath(documentID) + "/content"
+}
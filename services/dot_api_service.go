@@ -6,9 +6,9 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 	"time"
+	"triplink/backend/config"
 )
 
 // DOT API Service Implementation
@@ -21,7 +21,7 @@ type DOTAPIService struct {
 
 func NewDOTAPIService() *DOTAPIService {
 	return &DOTAPIService{
-		APIKey:  os.Getenv("DOT_API_KEY"), // 511.org or state DOT API key
+		APIKey:  config.GetAPIKeysConfig().DOT, // 511.org or state DOT API key
 		BaseURL: "https://api.511.org/traffic",
 		HTTPClient: &http.Client{
 			Timeout: 15 * time.Second,
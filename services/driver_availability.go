@@ -0,0 +1,328 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"triplink/backend/apierror"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of driver availability
+const (
+	DriverAvailabilityShift   = "SHIFT"
+	DriverAvailabilityTimeOff = "TIME_OFF"
+)
+
+// ErrDriverAvailabilityNotFound is returned for shifts and time off missing
+// from the driver's calendar
+var ErrDriverAvailabilityNotFound = errors.New("availability not found")
+
+// DriverAvailabilityRequest declares a shift or planned time off
+type DriverAvailabilityRequest struct {
+	Kind     string    `json:"kind" validate:"required"`
+	StartsAt time.Time `json:"starts_at" validate:"required"`
+	EndsAt   time.Time `json:"ends_at" validate:"required"`
+	Notes    string    `json:"notes"`
+}
+
+// DriverCalendar is a driver's shifts, time off and trip assignments in a
+// period
+type DriverCalendar struct {
+	DriverID     uint                        `json:"driver_id"`
+	From         time.Time                   `json:"from"`
+	To           time.Time                   `json:"to"`
+	Availability []models.DriverAvailability `json:"availability"`
+	Assignments  []models.TripAssignment     `json:"assignments"`
+}
+
+// ScheduleConflictError is a driver or vehicle that can't take a trip at the
+// time asked for, with the reason the client is told. Vehicle conflicts are
+// found by the VehicleBookingService.
+type ScheduleConflictError struct {
+	Code      apierror.Code
+	Reason    string
+	DriverID  uint
+	VehicleID uint
+	// The trip the driver or vehicle is booked on, or the time off or shift
+	// in the way
+	TripID         uint
+	AvailabilityID uint
+}
+
+func (e *ScheduleConflictError) Error() string {
+	return fmt.Sprintf("schedule conflict: %s", e.Reason)
+}
+
+// APIError converts the conflict to the API error it's responded with
+func (e *ScheduleConflictError) APIError() *apierror.Error {
+	details := map[string]interface{}{}
+	if e.DriverID != 0 {
+		details["driver_id"] = e.DriverID
+	}
+	if e.VehicleID != 0 {
+		details["vehicle_id"] = e.VehicleID
+	}
+	if e.TripID != 0 {
+		details["trip_id"] = e.TripID
+	}
+	if e.AvailabilityID != 0 {
+		details["availability_id"] = e.AvailabilityID
+	}
+	return apierror.New(e.Code, e.Reason).WithDetails(details)
+}
+
+// DriverAvailabilityService manages the shifts and time off drivers declare,
+// and checks drivers are free before they're assigned to a trip
+type DriverAvailabilityService struct {
+	db *gorm.DB
+}
+
+// NewDriverAvailabilityService creates a new DriverAvailabilityService
+func NewDriverAvailabilityService(db *gorm.DB) *DriverAvailabilityService {
+	return &DriverAvailabilityService{db: db}
+}
+
+// GetCalendar returns a driver's shifts, time off and assignments overlapping
+// a period, in the order they start
+func (s *DriverAvailabilityService) GetCalendar(driverID uint, from, to time.Time) (*DriverCalendar, error) {
+	calendar := &DriverCalendar{DriverID: driverID, From: from, To: to}
+	if err := s.db.Where("driver_id = ? AND starts_at < ? AND ends_at > ?", driverID, to, from).
+		Order("starts_at ASC, id ASC").Find(&calendar.Availability).Error; err != nil {
+		return nil, fmt.Errorf("failed to get availability: %w", err)
+	}
+	if err := s.db.Where("driver_id = ? AND starts_at < ? AND (ends_at IS NULL OR ends_at > ?)", driverID, to, from).
+		Order("starts_at ASC, id ASC").Find(&calendar.Assignments).Error; err != nil {
+		return nil, fmt.Errorf("failed to get trip assignments: %w", err)
+	}
+	return calendar, nil
+}
+
+// CreateAvailability adds a shift or time off to a driver's calendar. Time
+// off can be declared over trips the driver is assigned to; the carrier has
+// to reassign them, and until then the trips aren't offered to shippers.
+func (s *DriverAvailabilityService) CreateAvailability(driverID uint, req DriverAvailabilityRequest) (*models.DriverAvailability, error) {
+	var driver models.User
+	if err := s.db.First(&driver, driverID).Error; err != nil {
+		return nil, errors.New("driver not found")
+	}
+	if driver.Role != "DRIVER" && driver.Role != "CARRIER" {
+		return nil, errors.New("only drivers and carriers can declare their availability")
+	}
+
+	availability := &models.DriverAvailability{DriverID: driverID}
+	if err := s.applyAvailabilityRequest(availability, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(availability).Error; err != nil {
+		return nil, fmt.Errorf("failed to create availability: %w", err)
+	}
+	return availability, nil
+}
+
+// GetAvailability returns a shift or time off of a driver
+func (s *DriverAvailabilityService) GetAvailability(driverID, availabilityID uint) (*models.DriverAvailability, error) {
+	var availability models.DriverAvailability
+	if err := s.db.Where("id = ? AND driver_id = ?", availabilityID, driverID).
+		First(&availability).Error; err != nil {
+		return nil, ErrDriverAvailabilityNotFound
+	}
+	return &availability, nil
+}
+
+// UpdateAvailability changes a shift or time off of a driver
+func (s *DriverAvailabilityService) UpdateAvailability(driverID, availabilityID uint, req DriverAvailabilityRequest) (*models.DriverAvailability, error) {
+	availability, err := s.GetAvailability(driverID, availabilityID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyAvailabilityRequest(availability, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(availability).Error; err != nil {
+		return nil, fmt.Errorf("failed to update availability: %w", err)
+	}
+	return availability, nil
+}
+
+// DeleteAvailability removes a shift or time off from a driver's calendar
+func (s *DriverAvailabilityService) DeleteAvailability(driverID, availabilityID uint) error {
+	result := s.db.Where("id = ? AND driver_id = ?", availabilityID, driverID).
+		Delete(&models.DriverAvailability{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete availability: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrDriverAvailabilityNotFound
+	}
+	return nil
+}
+
+// CheckDriver returns why a driver can't drive a trip from start until end,
+// or nil if they can. The trip itself, if it exists yet, doesn't conflict
+// with the driver's assignments.
+func (s *DriverAvailabilityService) CheckDriver(driverID, tripID uint, start, end time.Time) error {
+	return checkDriverSchedule(s.db, driverID, tripID, start, end)
+}
+
+// applyAvailabilityRequest validates a request and copies it to a shift or
+// time off. Shifts can't overlap each other and neither can time off.
+func (s *DriverAvailabilityService) applyAvailabilityRequest(availability *models.DriverAvailability, req DriverAvailabilityRequest) error {
+	kind := strings.ToUpper(strings.TrimSpace(req.Kind))
+	if kind != DriverAvailabilityShift && kind != DriverAvailabilityTimeOff {
+		return fmt.Errorf("invalid kind %q, use %s or %s", req.Kind, DriverAvailabilityShift, DriverAvailabilityTimeOff)
+	}
+	if req.StartsAt.IsZero() || req.EndsAt.IsZero() {
+		return errors.New("starts_at and ends_at are required")
+	}
+	if !req.EndsAt.After(req.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+
+	var count int64
+	if err := s.db.Model(&models.DriverAvailability{}).
+		Where("driver_id = ? AND kind = ? AND id <> ?", availability.DriverID, kind, availability.ID).
+		Where("starts_at < ? AND ends_at > ?", req.EndsAt, req.StartsAt).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check availability: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("the %s overlaps another", strings.ToLower(strings.ReplaceAll(kind, "_", " ")))
+	}
+
+	availability.Kind = kind
+	availability.StartsAt = req.StartsAt
+	availability.EndsAt = req.EndsAt
+	availability.Notes = req.Notes
+	return nil
+}
+
+// unscheduledTripDuration is how long trips without an arrival after their
+// departure are taken to last when booking drivers and vehicles
+const unscheduledTripDuration = 24 * time.Hour
+
+// AssignmentEnd returns when an assignment ends, the end of its trip for
+// open-ended ones
+func AssignmentEnd(db *gorm.DB, assignment *models.TripAssignment) (time.Time, error) {
+	if assignment.EndsAt != nil {
+		return *assignment.EndsAt, nil
+	}
+	var trip models.Trip
+	if err := db.First(&trip, assignment.TripID).Error; err != nil {
+		return time.Time{}, fmt.Errorf("failed to get trip %d: %w", assignment.TripID, err)
+	}
+	return TripEnd(&trip), nil
+}
+
+// TripEnd returns when a trip is expected to end: its actual arrival once it
+// arrived, otherwise its estimated arrival
+func TripEnd(trip *models.Trip) time.Time {
+	end := trip.EstimatedArrival
+	if trip.ActualArrival != nil {
+		end = *trip.ActualArrival
+	}
+	if !end.After(trip.DepartureDate) {
+		return trip.DepartureDate.Add(unscheduledTripDuration)
+	}
+	return end
+}
+
+// formatSchedulePeriod formats a period for the reason of a conflict
+func formatSchedulePeriod(start, end time.Time) string {
+	return fmt.Sprintf("from %s to %s", start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+}
+
+// driverTimeOff returns the first time off of a driver overlapping a period,
+// or nil if they have none
+func driverTimeOff(db *gorm.DB, driverID uint, start, end time.Time) (*models.DriverAvailability, error) {
+	var timeOff []models.DriverAvailability
+	if err := db.Where("driver_id = ? AND kind = ? AND starts_at < ? AND ends_at > ?", driverID, DriverAvailabilityTimeOff, end, start).
+		Order("starts_at ASC").Limit(1).Find(&timeOff).Error; err != nil {
+		return nil, fmt.Errorf("failed to check time off: %w", err)
+	}
+	if len(timeOff) == 0 {
+		return nil, nil
+	}
+	return &timeOff[0], nil
+}
+
+// checkDriverAvailability returns the conflict of a period with a driver's
+// declared time off and, for drivers who declare shifts, whether they're on
+// shift when it starts. Multi-day trips run past shifts for rest breaks, so
+// only the start is checked against them.
+func checkDriverAvailability(db *gorm.DB, driverID uint, start, end time.Time) error {
+	timeOff, err := driverTimeOff(db, driverID, start, end)
+	if err != nil {
+		return err
+	}
+	if timeOff != nil {
+		return &ScheduleConflictError{
+			Code:           apierror.CodeDriverUnavailable,
+			Reason:         fmt.Sprintf("The driver is on time off %s", formatSchedulePeriod(timeOff.StartsAt, timeOff.EndsAt)),
+			DriverID:       driverID,
+			AvailabilityID: timeOff.ID,
+		}
+	}
+
+	var shifts int64
+	if err := db.Model(&models.DriverAvailability{}).
+		Where("driver_id = ? AND kind = ?", driverID, DriverAvailabilityShift).
+		Count(&shifts).Error; err != nil {
+		return fmt.Errorf("failed to check shifts: %w", err)
+	}
+	if shifts == 0 {
+		return nil
+	}
+	var onShift int64
+	if err := db.Model(&models.DriverAvailability{}).
+		Where("driver_id = ? AND kind = ? AND starts_at <= ? AND ends_at > ?", driverID, DriverAvailabilityShift, start, start).
+		Count(&onShift).Error; err != nil {
+		return fmt.Errorf("failed to check shifts: %w", err)
+	}
+	if onShift == 0 {
+		return &ScheduleConflictError{
+			Code:     apierror.CodeDriverUnavailable,
+			Reason:   fmt.Sprintf("The driver has no shift at %s", start.UTC().Format(time.RFC3339)),
+			DriverID: driverID,
+		}
+	}
+	return nil
+}
+
+// checkDriverSchedule returns the conflict of a driver driving a trip for a
+// period with their availability and their assignments to other trips that
+// aren't over
+func checkDriverSchedule(db *gorm.DB, driverID, tripID uint, start, end time.Time) error {
+	if err := checkDriverAvailability(db, driverID, start, end); err != nil {
+		return err
+	}
+
+	var assignments []models.TripAssignment
+	if err := db.Joins("JOIN trips ON trips.id = trip_assignments.trip_id AND trips.deleted_at IS NULL").
+		Where("trip_assignments.driver_id = ? AND trip_assignments.trip_id <> ?", driverID, tripID).
+		Where("trips.status NOT IN ?", []string{"COMPLETED", "CANCELLED"}).
+		Where("trip_assignments.starts_at < ?", end).
+		Where("trip_assignments.ends_at IS NULL OR trip_assignments.ends_at > ?", start).
+		Order("trip_assignments.starts_at ASC").Find(&assignments).Error; err != nil {
+		return fmt.Errorf("failed to check trip assignments: %w", err)
+	}
+
+	for _, assignment := range assignments {
+		assignmentEnd, err := AssignmentEnd(db, &assignment)
+		if err != nil {
+			return err
+		}
+		if assignment.StartsAt.Before(end) && start.Before(assignmentEnd) {
+			return &ScheduleConflictError{
+				Code:     apierror.CodeDriverDoubleBooked,
+				Reason:   fmt.Sprintf("The driver is assigned to trip %d %s", assignment.TripID, formatSchedulePeriod(assignment.StartsAt, assignmentEnd)),
+				DriverID: driverID,
+				TripID:   assignment.TripID,
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Ratings of driver safety scores
+const (
+	SafetyExcellent = "EXCELLENT"
+	SafetyGood      = "GOOD"
+	SafetyFair      = "FAIR"
+	SafetyPoor      = "POOR"
+)
+
+// ScorePenalty is the points a driving behavior cost a driver's safety score
+type ScorePenalty struct {
+	Factor      string  `json:"factor"` // HARSH_EVENTS, SPEEDING, NIGHT_DRIVING or IDLING
+	Points      float64 `json:"points"`
+	Description string  `json:"description"`
+}
+
+// DriverScorecard summarizes how safely a driver drove over a period, from
+// the positions tracked on their trips
+type DriverScorecard struct {
+	DriverID   uint      `json:"driver_id"`
+	DriverName string    `json:"driver_name"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Trips      int       `json:"trips"`
+
+	DistanceKm    float64 `json:"distance_km"`
+	DrivingHours  float64 `json:"driving_hours"`
+	IdleHours     float64 `json:"idle_hours"`
+	SpeedingHours float64 `json:"speeding_hours"`
+	NightHours    float64 `json:"night_hours"`
+
+	HarshAccelerations  int     `json:"harsh_accelerations"`
+	HarshBrakings       int     `json:"harsh_brakings"`
+	HarshEventsPer100Km float64 `json:"harsh_events_per_100km"`
+	// Shares of driving time, and of driving and idle time for idling
+	SpeedingPercent     float64 `json:"speeding_percent"`
+	NightDrivingPercent float64 `json:"night_driving_percent"`
+	IdlingPercent       float64 `json:"idling_percent"`
+
+	// 0-100, nil when the driver drove too little in the period to be scored
+	Score               *float64       `json:"score"`
+	Rating              string         `json:"rating,omitempty"`
+	Penalties           []ScorePenalty `json:"penalties"`
+	TrainingRecommended bool           `json:"training_recommended"`
+}
+
+// DriverScoringService scores drivers' safety from their trips' tracking data
+type DriverScoringService struct {
+	db  *gorm.DB
+	cfg *config.DriverScoringConfig
+	now func() time.Time
+}
+
+// NewDriverScoringService creates a new driver scoring service
+func NewDriverScoringService(db *gorm.DB, cfg *config.DriverScoringConfig) *DriverScoringService {
+	return &DriverScoringService{db: db, cfg: cfg, now: time.Now}
+}
+
+// scoringSample is a tracked position attributed to the driver who drove it
+type scoringSample struct {
+	TripID     uint
+	DriverID   uint
+	Latitude   float64
+	Longitude  float64
+	Speed      *float64
+	SpeedLimit *float64
+	Timestamp  time.Time
+}
+
+// Period returns the period to score, defaulting to the configured period up
+// to now
+func (s *DriverScoringService) Period(from, to *time.Time) (time.Time, time.Time) {
+	end := s.now()
+	if to != nil {
+		end = *to
+	}
+	start := end.Add(-s.cfg.DefaultPeriod)
+	if from != nil {
+		start = *from
+	}
+	return start, end
+}
+
+// CanViewScorecard reports whether a user may see a driver's scorecard: the
+// driver themselves, the owners and dispatchers of the driver's
+// organizations, and carriers the driver was assigned trips by
+func (s *DriverScoringService) CanViewScorecard(userID, driverID uint) bool {
+	if userID == driverID {
+		return true
+	}
+
+	var count int64
+	s.db.Table("organization_memberships AS viewer").
+		Joins("JOIN organization_memberships AS driver ON driver.organization_id = viewer.organization_id").
+		Where("viewer.user_id = ? AND viewer.role IN ? AND driver.user_id = ?",
+			userID, []string{OrganizationOwner, OrganizationDispatcher}, driverID).
+		Count(&count)
+	if count > 0 {
+		return true
+	}
+
+	s.db.Model(&models.TripAssignment{}).
+		Joins("JOIN trips ON trips.id = trip_assignments.trip_id").
+		Where("trip_assignments.driver_id = ? AND trips.user_id = ?", driverID, userID).
+		Count(&count)
+	return count > 0
+}
+
+// Scorecard scores a driver's safety between from and to
+func (s *DriverScoringService) Scorecard(driverID uint, from, to time.Time) (*DriverScorecard, error) {
+	var driver models.User
+	if err := s.db.Select("id, first_name, last_name").First(&driver, driverID).Error; err != nil {
+		return nil, err
+	}
+
+	scorecards, err := s.Scorecards([]uint{driverID}, from, to)
+	if err != nil {
+		return nil, err
+	}
+	scorecard := scorecards[driverID]
+	scorecard.DriverName = strings.TrimSpace(driver.FirstName + " " + driver.LastName)
+	return scorecard, nil
+}
+
+// Scorecards scores the safety of several drivers between from and to. A
+// position is attributed to the driver it was reported for, or else to the
+// trip's carrier.
+func (s *DriverScoringService) Scorecards(driverIDs []uint, from, to time.Time) (map[uint]*DriverScorecard, error) {
+	scorecards := make(map[uint]*DriverScorecard, len(driverIDs))
+	for _, id := range driverIDs {
+		scorecards[id] = &DriverScorecard{DriverID: id, From: from, To: to, Penalties: []ScorePenalty{}}
+	}
+	if len(driverIDs) == 0 {
+		return scorecards, nil
+	}
+
+	var samples []scoringSample
+	for _, table := range []string{"tracking_records", archivedTrackingRecordsTable} {
+		var found []scoringSample
+		if err := s.db.Table(table+" AS r").
+			Select("r.trip_id, COALESCE(r.driver_id, trips.user_id) AS driver_id, r.latitude, r.longitude, r.speed, r.speed_limit, r.timestamp").
+			Joins("JOIN trips ON trips.id = r.trip_id").
+			Where("r.deleted_at IS NULL AND r.timestamp >= ? AND r.timestamp < ?", from, to).
+			Where("COALESCE(r.driver_id, trips.user_id) IN ?", driverIDs).
+			Order("r.trip_id, r.timestamp").
+			Scan(&found).Error; err != nil {
+			return nil, fmt.Errorf("failed to get tracking records: %w", err)
+		}
+		samples = append(samples, found...)
+	}
+
+	location, err := time.LoadLocation(s.cfg.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	speedLimit := config.CurrentAlertConfig().SpeedLimitKmh
+	trips := make(map[uint]map[uint]bool)
+
+	for i := 1; i < len(samples); i++ {
+		previous, current := samples[i-1], samples[i]
+		elapsed := current.Timestamp.Sub(previous.Timestamp)
+		if current.TripID != previous.TripID || current.DriverID != previous.DriverID ||
+			elapsed <= 0 || elapsed > s.cfg.MaxSampleGap {
+			continue
+		}
+		scorecard := scorecards[current.DriverID]
+		hours := elapsed.Hours()
+		distance := geo.Distance(previous.Latitude, previous.Longitude, current.Latitude, current.Longitude)
+
+		speed := distance / hours
+		if current.Speed != nil {
+			speed = *current.Speed
+		}
+		moving := speed >= s.cfg.IdleSpeedKmh
+		if previous.Speed != nil && current.Speed != nil {
+			moving = moving || *previous.Speed >= s.cfg.IdleSpeedKmh
+		}
+		if !moving {
+			scorecard.IdleHours += hours
+			continue
+		}
+
+		scorecard.DrivingHours += hours
+		scorecard.DistanceKm += distance
+		if trips[current.DriverID] == nil {
+			trips[current.DriverID] = make(map[uint]bool)
+		}
+		trips[current.DriverID][current.TripID] = true
+
+		limit := speedLimit
+		if current.SpeedLimit != nil {
+			limit = *current.SpeedLimit
+		}
+		if speed > limit+s.cfg.SpeedingToleranceKmh {
+			scorecard.SpeedingHours += hours
+		}
+		if s.isNight(current.Timestamp.In(location)) {
+			scorecard.NightHours += hours
+		}
+
+		if previous.Speed != nil && current.Speed != nil {
+			acceleration := (*current.Speed - *previous.Speed) / 3.6 / elapsed.Seconds()
+			switch {
+			case acceleration > s.cfg.HarshAccelerationMps2:
+				scorecard.HarshAccelerations++
+			case acceleration < -s.cfg.HarshBrakingMps2:
+				scorecard.HarshBrakings++
+			}
+		}
+	}
+
+	for id, scorecard := range scorecards {
+		scorecard.Trips = len(trips[id])
+		s.score(scorecard)
+	}
+	return scorecards, nil
+}
+
+// isNight reports whether a local time is within the night driving hours
+func (s *DriverScoringService) isNight(t time.Time) bool {
+	hour := t.Hour()
+	if s.cfg.NightStartHour > s.cfg.NightEndHour {
+		return hour >= s.cfg.NightStartHour || hour < s.cfg.NightEndHour
+	}
+	return hour >= s.cfg.NightStartHour && hour < s.cfg.NightEndHour
+}
+
+// score works out the rates of a scorecard's driving behaviors and the score
+// they add up to
+func (s *DriverScoringService) score(scorecard *DriverScorecard) {
+	harshEvents := scorecard.HarshAccelerations + scorecard.HarshBrakings
+	if scorecard.DistanceKm > 0 {
+		scorecard.HarshEventsPer100Km = float64(harshEvents) / scorecard.DistanceKm * 100
+	}
+	if scorecard.DrivingHours > 0 {
+		scorecard.SpeedingPercent = scorecard.SpeedingHours / scorecard.DrivingHours * 100
+		scorecard.NightDrivingPercent = scorecard.NightHours / scorecard.DrivingHours * 100
+	}
+	if total := scorecard.DrivingHours + scorecard.IdleHours; total > 0 {
+		scorecard.IdlingPercent = scorecard.IdleHours / total * 100
+	}
+
+	if scorecard.DistanceKm >= s.cfg.MinDistanceKm && scorecard.DistanceKm > 0 {
+		penalize := func(factor string, points float64, description string) {
+			if points > 0 {
+				scorecard.Penalties = append(scorecard.Penalties, ScorePenalty{
+					Factor:      factor,
+					Points:      roundHundredths(points),
+					Description: description,
+				})
+			}
+		}
+		penalize("HARSH_EVENTS", scorecard.HarshEventsPer100Km*s.cfg.HarshEventPenalty,
+			fmt.Sprintf("%d harsh accelerations and %d harsh brakings over %.0f km",
+				scorecard.HarshAccelerations, scorecard.HarshBrakings, scorecard.DistanceKm))
+		penalize("SPEEDING", scorecard.SpeedingPercent*s.cfg.SpeedingPenalty,
+			fmt.Sprintf("Speeding %.1f%% of driving time", scorecard.SpeedingPercent))
+		penalize("NIGHT_DRIVING", scorecard.NightDrivingPercent*s.cfg.NightDrivingPenalty,
+			fmt.Sprintf("Driving at night %.1f%% of driving time", scorecard.NightDrivingPercent))
+		penalize("IDLING", scorecard.IdlingPercent*s.cfg.IdlingPenalty,
+			fmt.Sprintf("Idling %.1f%% of the time", scorecard.IdlingPercent))
+
+		score := 100.0
+		for _, penalty := range scorecard.Penalties {
+			score -= penalty.Points
+		}
+		score = math.Round(math.Max(score, 0)*10) / 10
+		scorecard.Score = &score
+		scorecard.Rating = safetyRating(score)
+		scorecard.TrainingRecommended = score < s.cfg.TrainingScore
+	}
+
+	scorecard.DistanceKm = roundHundredths(scorecard.DistanceKm)
+	scorecard.DrivingHours = roundHundredths(scorecard.DrivingHours)
+	scorecard.IdleHours = roundHundredths(scorecard.IdleHours)
+	scorecard.SpeedingHours = roundHundredths(scorecard.SpeedingHours)
+	scorecard.NightHours = roundHundredths(scorecard.NightHours)
+	scorecard.HarshEventsPer100Km = roundHundredths(scorecard.HarshEventsPer100Km)
+	scorecard.SpeedingPercent = roundHundredths(scorecard.SpeedingPercent)
+	scorecard.NightDrivingPercent = roundHundredths(scorecard.NightDrivingPercent)
+	scorecard.IdlingPercent = roundHundredths(scorecard.IdlingPercent)
+}
+
+func safetyRating(score float64) string {
+	switch {
+	case score >= 90:
+		return SafetyExcellent
+	case score >= 75:
+		return SafetyGood
+	case score >= 60:
+		return SafetyFair
+	default:
+		return SafetyPoor
+	}
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+)
+
+// EmailSender delivers a rendered email to a single recipient
+type EmailSender interface {
+	Send(to string, email *RenderedEmail) error
+}
+
+// EmailNotificationProvider implements the NotificationProvider interface for email.
+// Recipients are email addresses instead of device tokens.
+type EmailNotificationProvider struct {
+	sender   EmailSender
+	renderer *EmailTemplateRenderer
+}
+
+// NewEmailNotificationProvider creates an email provider using the sender
+// configured in cfg (SMTP or SendGrid)
+func NewEmailNotificationProvider(cfg *config.EmailConfig) (*EmailNotificationProvider, error) {
+	if err := cfg.ValidateEmailConfig(); err != nil {
+		return nil, err
+	}
+
+	renderer, err := NewEmailTemplateRenderer(cfg.AppBaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EmailNotificationProvider{
+		sender:   NewEmailSender(cfg),
+		renderer: renderer,
+	}, nil
+}
+
+// NewEmailSender creates the sender configured in cfg (SMTP or SendGrid)
+func NewEmailSender(cfg *config.EmailConfig) EmailSender {
+	switch cfg.Provider {
+	case "sendgrid":
+		return NewSendGridEmailSender(cfg)
+	default:
+		return NewSMTPEmailSender(cfg)
+	}
+}
+
+// Name returns the name of the provider
+func (p *EmailNotificationProvider) Name() string {
+	return "email"
+}
+
+// SendNotification renders the notification and emails it to each recipient
+func (p *EmailNotificationProvider) SendNotification(recipients []string, notification *models.Notification) error {
+	if len(recipients) == 0 {
+		return fmt.Errorf("no recipients provided")
+	}
+
+	email, err := p.renderer.Render(notification)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, to := range recipients {
+		if err := p.sender.Send(to, email); err != nil {
+			log.Printf("Failed to email notification %d to %s: %v", notification.ID, to, err)
+			failed = append(failed, to)
+		}
+	}
+
+	if len(failed) == len(recipients) {
+		return fmt.Errorf("failed to send email to all %d recipients", len(recipients))
+	}
+	return nil
+}
+
+// BatchSendNotifications emails each notification in the batch
+func (p *EmailNotificationProvider) BatchSendNotifications(batches []NotificationBatch) error {
+	var errorCount int
+	for _, batch := range batches {
+		if err := p.SendNotification(batch.Tokens, batch.Notification); err != nil {
+			errorCount++
+		}
+	}
+
+	if errorCount > 0 {
+		return fmt.Errorf("failed to send %d of %d email batches", errorCount, len(batches))
+	}
+	return nil
+}
+
+// SMTPEmailSender sends email through an SMTP server
+type SMTPEmailSender struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	fromName string
+}
+
+// NewSMTPEmailSender creates a new SMTP email sender
+func NewSMTPEmailSender(cfg *config.EmailConfig) *SMTPEmailSender {
+	return &SMTPEmailSender{
+		host:     cfg.SMTPHost,
+		port:     cfg.SMTPPort,
+		username: cfg.SMTPUsername,
+		password: cfg.SMTPPassword,
+		from:     cfg.FromAddress,
+		fromName: cfg.FromName,
+	}
+}
+
+// Send sends a multipart (plain text and HTML) email
+func (s *SMTPEmailSender) Send(to string, email *RenderedEmail) error {
+	boundary := fmt.Sprintf("triplink-%d", time.Now().UnixNano())
+
+	var msg bytes.Buffer
+	msg.WriteString(fmt.Sprintf("From: %s <%s>\r\n", mime.QEncoding.Encode("utf-8", s.fromName), s.from))
+	msg.WriteString(fmt.Sprintf("To: %s\r\n", to))
+	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject)))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	// Attachments wrap the alternative bodies in a multipart/mixed message
+	mixedBoundary := boundary + "-mixed"
+	if len(email.Attachments) > 0 {
+		msg.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixedBoundary))
+		msg.WriteString(fmt.Sprintf("--%s\r\n", mixedBoundary))
+	}
+	msg.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=%s\r\n\r\n", boundary))
+
+	msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(email.TextBody + "\r\n")
+
+	msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	msg.WriteString(email.HTMLBody + "\r\n")
+	msg.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+
+	if len(email.Attachments) > 0 {
+		for _, attachment := range email.Attachments {
+			msg.WriteString(fmt.Sprintf("--%s\r\n", mixedBoundary))
+			msg.WriteString(fmt.Sprintf("Content-Type: %s\r\n", attachment.ContentType))
+			msg.WriteString("Content-Transfer-Encoding: base64\r\n")
+			msg.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n\r\n", mime.QEncoding.Encode("utf-8", attachment.Filename)))
+			encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+			for len(encoded) > 76 {
+				msg.WriteString(encoded[:76] + "\r\n")
+				encoded = encoded[76:]
+			}
+			msg.WriteString(encoded + "\r\n")
+		}
+		msg.WriteString(fmt.Sprintf("--%s--\r\n", mixedBoundary))
+	}
+
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", s.host, s.port)
+	if err := smtp.SendMail(addr, auth, s.from, []string{to}, msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to send email via SMTP: %w", err)
+	}
+	return nil
+}
+
+// SendGridEmailSender sends email through the SendGrid v3 API
+type SendGridEmailSender struct {
+	APIURL     string
+	APIKey     string
+	HTTPClient *http.Client
+	from       string
+	fromName   string
+}
+
+// NewSendGridEmailSender creates a new SendGrid email sender
+func NewSendGridEmailSender(cfg *config.EmailConfig) *SendGridEmailSender {
+	return &SendGridEmailSender{
+		APIURL: "https://api.sendgrid.com/v3/mail/send",
+		APIKey: cfg.SendGridAPIKey,
+		HTTPClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		from:     cfg.FromAddress,
+		fromName: cfg.FromName,
+	}
+}
+
+// Send sends an email through SendGrid
+func (s *SendGridEmailSender) Send(to string, email *RenderedEmail) error {
+	requestBody := map[string]interface{}{
+		"personalizations": []map[string]interface{}{
+			{"to": []map[string]string{{"email": to}}},
+		},
+		"from": map[string]string{
+			"email": s.from,
+			"name":  s.fromName,
+		},
+		"subject": email.Subject,
+		"content": []map[string]string{
+			{"type": "text/plain", "value": email.TextBody},
+			{"type": "text/html", "value": email.HTMLBody},
+		},
+	}
+
+	if len(email.Attachments) > 0 {
+		attachments := make([]map[string]string, len(email.Attachments))
+		for i, attachment := range email.Attachments {
+			attachments[i] = map[string]string{
+				"content":     base64.StdEncoding.EncodeToString(attachment.Content),
+				"type":        attachment.ContentType,
+				"filename":    attachment.Filename,
+				"disposition": "attachment",
+			}
+		}
+		requestBody["attachments"] = attachments
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return fmt.Errorf("failed to serialize SendGrid request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", s.APIURL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.APIKey)
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send SendGrid request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var body bytes.Buffer
+		body.ReadFrom(resp.Body)
+		return fmt.Errorf("SendGrid returned status %d: %s", resp.StatusCode, strings.TrimSpace(body.String()))
+	}
+	return nil
+}
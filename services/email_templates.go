@@ -0,0 +1,178 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"time"
+	"triplink/backend/models"
+)
+
+// EmailTemplateData is the data available to email templates
+type EmailTemplateData struct {
+	Title     string
+	Message   string
+	Type      string
+	RelatedID uint
+	ActionURL string
+	SentAt    time.Time
+}
+
+// RenderedEmail is an email subject with its HTML and plain text bodies
+type RenderedEmail struct {
+	Subject     string
+	HTMLBody    string
+	TextBody    string
+	Attachments []EmailAttachment
+}
+
+// EmailAttachment is a file attached to an email
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+const emailLayoutTemplate = `{{define "layout"}}<!DOCTYPE html>
+<html>
+<head><meta charset="UTF-8"><title>{{.Title}}</title></head>
+<body style="font-family: Arial, sans-serif; background-color: #f4f5f7; margin: 0; padding: 24px;">
+  <table width="100%" cellpadding="0" cellspacing="0" style="max-width: 600px; margin: 0 auto; background-color: #ffffff; border-radius: 6px;">
+    <tr><td style="background-color: #1a56db; color: #ffffff; padding: 16px 24px; font-size: 20px; font-weight: bold;">TripLink</td></tr>
+    <tr><td style="padding: 24px;">{{template "content" .}}</td></tr>
+    <tr><td style="padding: 16px 24px; color: #6b7280; font-size: 12px;">You are receiving this email because email notifications are enabled in your TripLink notification preferences.</td></tr>
+  </table>
+</body>
+</html>{{end}}`
+
+const delayAlertEmailTemplate = `{{define "content"}}
+<h2 style="color: #b91c1c; margin-top: 0;">Delay alert</h2>
+<p>{{.Message}}</p>
+{{if .ActionURL}}<p><a href="{{.ActionURL}}" style="color: #1a56db;">Track this trip</a></p>{{end}}
+<p style="color: #6b7280; font-size: 12px;">Reported {{.SentAt.Format "Jan 2, 2006 15:04 MST"}}</p>
+{{end}}`
+
+const deliveryConfirmationEmailTemplate = `{{define "content"}}
+<h2 style="color: #047857; margin-top: 0;">Delivery confirmed</h2>
+<p>{{.Message}}</p>
+{{if .ActionURL}}<p><a href="{{.ActionURL}}" style="color: #1a56db;">View delivery details</a></p>{{end}}
+<p style="color: #6b7280; font-size: 12px;">Confirmed {{.SentAt.Format "Jan 2, 2006 15:04 MST"}}</p>
+{{end}}`
+
+const quoteEmailTemplate = `{{define "content"}}
+<h2 style="color: #1a56db; margin-top: 0;">{{.Title}}</h2>
+<p>{{.Message}}</p>
+{{if .ActionURL}}<p><a href="{{.ActionURL}}" style="color: #1a56db;">Review the quote</a></p>{{end}}
+{{end}}`
+
+const defaultEmailTemplate = `{{define "content"}}
+<h2 style="margin-top: 0;">{{.Title}}</h2>
+<p>{{.Message}}</p>
+{{if .ActionURL}}<p><a href="{{.ActionURL}}" style="color: #1a56db;">Open TripLink</a></p>{{end}}
+{{end}}`
+
+// EmailTemplateRenderer renders notifications into HTML emails
+type EmailTemplateRenderer struct {
+	appBaseURL string
+	templates  map[string]*template.Template
+}
+
+// NewEmailTemplateRenderer parses the built-in email templates
+func NewEmailTemplateRenderer(appBaseURL string) (*EmailTemplateRenderer, error) {
+	contents := map[string]string{
+		"delay":    delayAlertEmailTemplate,
+		"delivery": deliveryConfirmationEmailTemplate,
+		"quote":    quoteEmailTemplate,
+		"default":  defaultEmailTemplate,
+	}
+
+	r := &EmailTemplateRenderer{
+		appBaseURL: appBaseURL,
+		templates:  make(map[string]*template.Template),
+	}
+	for name, content := range contents {
+		tmpl, err := template.New(name).Parse(emailLayoutTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse email layout: %w", err)
+		}
+		if _, err := tmpl.Parse(content); err != nil {
+			return nil, fmt.Errorf("failed to parse %s email template: %w", name, err)
+		}
+		r.templates[name] = tmpl
+	}
+
+	return r, nil
+}
+
+// emailTemplateName returns the template used for a notification type
+func emailTemplateName(notificationType string) string {
+	switch notificationType {
+	case "TRIP_DELAYED", "DELAY_ALERT":
+		return "delay"
+	case "LOAD_DELIVERED", "TRIP_ARRIVED":
+		return "delivery"
+	case "QUOTE_RECEIVED", "QUOTE_ACCEPTED", "QUOTE_REJECTED":
+		return "quote"
+	default:
+		return "default"
+	}
+}
+
+// actionURL returns a link to the entity related to a notification
+func (r *EmailTemplateRenderer) actionURL(notification *models.Notification) string {
+	return notificationActionURL(r.appBaseURL, notification)
+}
+
+// notificationActionURL returns a link in the web app to the entity related
+// to a notification
+func notificationActionURL(appBaseURL string, notification *models.Notification) string {
+	if notification.RelatedID == 0 || appBaseURL == "" {
+		return ""
+	}
+
+	switch notification.Type {
+	case "TRIP_DEPARTED", "TRIP_ARRIVED", "TRIP_DELAYED", "DELAY_ALERT", "ETA_UPDATED", "TRIP_STATUS_CHANGE":
+		return fmt.Sprintf("%s/trips/%d", appBaseURL, notification.RelatedID)
+	case "LOAD_STATUS_CHANGED", "LOAD_BOOKED", "PICKUP_SCHEDULED", "PICKUP_REMINDER", "LOAD_DELIVERED", "CUSTOMS_DOCUMENT_EXPIRING":
+		return fmt.Sprintf("%s/loads/%d", appBaseURL, notification.RelatedID)
+	case "QUOTE_RECEIVED", "QUOTE_ACCEPTED", "QUOTE_REJECTED":
+		return fmt.Sprintf("%s/quotes/%d", appBaseURL, notification.RelatedID)
+	case "NEW_MESSAGE":
+		return fmt.Sprintf("%s/conversations/%d", appBaseURL, notification.RelatedID)
+	case "VEHICLE_DOCUMENT_EXPIRING":
+		return fmt.Sprintf("%s/vehicles/%d", appBaseURL, notification.RelatedID)
+	case "ACCOUNT_VERIFIED", "ACCOUNT_VERIFICATION_REJECTED", "ACCOUNT_SUSPENDED", "ACCOUNT_REINSTATED":
+		return appBaseURL + "/account"
+	default:
+		return ""
+	}
+}
+
+// Render renders a notification into an email
+func (r *EmailTemplateRenderer) Render(notification *models.Notification) (*RenderedEmail, error) {
+	data := EmailTemplateData{
+		Title:     notification.Title,
+		Message:   notification.Message,
+		Type:      notification.Type,
+		RelatedID: notification.RelatedID,
+		ActionURL: r.actionURL(notification),
+		SentAt:    time.Now(),
+	}
+
+	var body bytes.Buffer
+	tmpl := r.templates[emailTemplateName(notification.Type)]
+	if err := tmpl.ExecuteTemplate(&body, "layout", data); err != nil {
+		return nil, fmt.Errorf("failed to render email: %w", err)
+	}
+
+	text := data.Message
+	if data.ActionURL != "" {
+		text += "\n\n" + data.ActionURL
+	}
+
+	return &RenderedEmail{
+		Subject:  "TripLink: " + data.Title,
+		HTMLBody: body.String(),
+		TextBody: text,
+	}, nil
+}
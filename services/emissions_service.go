@@ -0,0 +1,430 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// How a trip's emissions were estimated
+const (
+	EmissionsTelematics = "TELEMATICS"
+	EmissionsPlanned    = "PLANNED"
+)
+
+// Carbon report views: carriers report the emissions of the trips they run,
+// shippers the share of those emissions allocated to their loads
+const (
+	CarbonViewCarrier = "carrier"
+	CarbonViewShipper = "shipper"
+)
+
+// Errors returned by GetCarbonReport for invalid requests
+var (
+	ErrInvalidCarbonView   = fmt.Errorf("view must be %s or %s", CarbonViewCarrier, CarbonViewShipper)
+	ErrInvalidCarbonPeriod = errors.New("date range must end after it starts")
+)
+
+// LoadEmission is the share of a trip's emissions allocated to one of its
+// loads, by the load's share of the trip's payload weight
+type LoadEmission struct {
+	LoadID           uint      `json:"load_id"`
+	BookingReference string    `json:"booking_reference"`
+	TripID           uint      `json:"trip_id"`
+	TripDate         time.Time `json:"trip_date"`
+	WeightKg         float64   `json:"weight_kg"`
+	Share            float64   `json:"share"` // 0-1 of the trip's emissions
+	DistanceKm       float64   `json:"distance_km"`
+	FuelLitres       float64   `json:"fuel_litres"`
+	CO2Kg            float64   `json:"co2_kg"`
+	// Grams of CO2 per tonne of the load carried a kilometer
+	CO2PerTonneKm float64 `json:"co2_per_tonne_km"`
+}
+
+// TripEmissions are a trip's emissions and their allocation to its loads
+type TripEmissions struct {
+	models.TripEmission
+	// Whether the emissions were recorded when the trip completed, rather
+	// than estimated so far
+	Recorded bool           `json:"recorded"`
+	Loads    []LoadEmission `json:"loads"`
+}
+
+// CarbonTotals sums the emissions of a period
+type CarbonTotals struct {
+	Trips      int     `json:"trips"`
+	Loads      int     `json:"loads"`
+	DistanceKm float64 `json:"distance_km"`
+	FuelLitres float64 `json:"fuel_litres"`
+	CO2Kg      float64 `json:"co2_kg"`
+	TonneKm    float64 `json:"tonne_km"`
+	// Grams of CO2 per tonne carried a kilometer
+	CO2PerTonneKm float64 `json:"co2_per_tonne_km"`
+}
+
+// CarbonReport sums the emissions of a date range and compares them with
+// the period of the same length before it
+type CarbonReport struct {
+	View         string       `json:"view"`
+	From         time.Time    `json:"from"`
+	To           time.Time    `json:"to"`
+	PreviousFrom time.Time    `json:"previous_from"`
+	PreviousTo   time.Time    `json:"previous_to"`
+	Current      CarbonTotals `json:"current"`
+	Previous     CarbonTotals `json:"previous"`
+	Change       CarbonTotals `json:"change"` // current minus previous
+	// Percent change of the CO2 emitted, nil without previous emissions
+	CO2ChangePercent *float64 `json:"co2_change_percent,omitempty"`
+	// The shipper's loads of the date range, for their customers' ESG
+	// reporting
+	Loads []LoadEmission `json:"loads,omitempty"`
+}
+
+// EmissionsService estimates trips' fuel use and CO2 emissions
+type EmissionsService struct {
+	db  *gorm.DB
+	cfg *config.EmissionsConfig
+	now func() time.Time
+}
+
+// NewEmissionsService creates a new EmissionsService
+func NewEmissionsService(db *gorm.DB, cfg *config.EmissionsConfig) *EmissionsService {
+	return &EmissionsService{db: db, cfg: cfg, now: time.Now}
+}
+
+// speedFactor scales fuel use by the average speed of a stretch of a trip:
+// stop-and-go traffic and speeds past the most efficient cruising speed
+// burn more fuel per kilometer
+func speedFactor(avgSpeed *float64) float64 {
+	if avgSpeed == nil || *avgSpeed <= 0 {
+		return 1
+	}
+	switch speed := *avgSpeed; {
+	case speed < 20:
+		return 1.35
+	case speed < 50:
+		return 1.15
+	case speed <= 90:
+		return 1
+	default:
+		return 1 + 0.02*(speed-90)
+	}
+}
+
+// EstimateTrip estimates a trip's emissions so far. Tracked trips are
+// estimated from the distance and speed of each 5 minute stretch, others from
+// the road distance between their origin and destination.
+func (s *EmissionsService) EstimateTrip(tripID uint) (*models.TripEmission, error) {
+	var trip models.Trip
+	if err := s.db.First(&trip, tripID).Error; err != nil {
+		return nil, errors.New("trip not found")
+	}
+
+	vehicleType, payloadKg, litresPer100Km, err := s.tripConsumption(&trip)
+	if err != nil {
+		return nil, err
+	}
+
+	var aggregates []models.TrackingAggregate
+	if err := s.db.Where("trip_id = ? AND resolution = ?", trip.ID, TrackingResolution5m).
+		Order("bucket_start ASC").Find(&aggregates).Error; err != nil {
+		return nil, fmt.Errorf("failed to get tracking aggregates: %w", err)
+	}
+
+	emission := &models.TripEmission{
+		TripID:       trip.ID,
+		VehicleType:  vehicleType,
+		Method:       EmissionsTelematics,
+		PayloadKg:    payloadKg,
+		TripDate:     tripDate(&trip),
+		CalculatedAt: s.now(),
+	}
+	for _, aggregate := range aggregates {
+		emission.DistanceKm += aggregate.DistanceKm
+		emission.FuelLitres += aggregate.DistanceKm / 100 * litresPer100Km * speedFactor(aggregate.AvgSpeed)
+	}
+	if emission.DistanceKm == 0 {
+		emission.Method = EmissionsPlanned
+		emission.DistanceKm = geo.Distance(trip.OriginLat, trip.OriginLng, trip.DestinationLat, trip.DestinationLng) * s.cfg.RoadDistanceFactor
+		emission.FuelLitres = emission.DistanceKm / 100 * litresPer100Km
+	}
+	emission.CO2Kg = emission.FuelLitres * s.cfg.CO2PerLitre
+	return emission, nil
+}
+
+// tripConsumption returns the type of a trip's vehicle, the weight of the
+// loads it carries and the litres per 100 km it uses carrying them
+func (s *EmissionsService) tripConsumption(trip *models.Trip) (string, float64, float64, error) {
+	var vehicle models.Vehicle
+	if trip.VehicleID != 0 {
+		s.db.Select("id", "vehicle_type").First(&vehicle, trip.VehicleID)
+	}
+
+	var payloadKg float64
+	if err := s.db.Model(&models.Load{}).
+		Where("trip_id = ? AND status <> ?", trip.ID, "CANCELLED").
+		Select("COALESCE(SUM(weight), 0)").Scan(&payloadKg).Error; err != nil {
+		return "", 0, 0, fmt.Errorf("failed to get trip payload: %w", err)
+	}
+	litresPer100Km := s.cfg.Consumption(vehicle.VehicleType) + s.cfg.PayloadConsumption*payloadKg/1000
+	return vehicle.VehicleType, payloadKg, litresPer100Km, nil
+}
+
+// tripDate is when a trip is reported: when it arrived, or else departed
+func tripDate(trip *models.Trip) time.Time {
+	if trip.ActualArrival != nil {
+		return *trip.ActualArrival
+	}
+	if trip.ActualDeparture != nil {
+		return *trip.ActualDeparture
+	}
+	return trip.DepartureDate
+}
+
+// RecordTrip estimates a trip's emissions and stores them, replacing those
+// recorded before
+func (s *EmissionsService) RecordTrip(tripID uint) (*models.TripEmission, error) {
+	emission, err := s.EstimateTrip(tripID)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing models.TripEmission
+	if err := s.db.Where("trip_id = ?", tripID).First(&existing).Error; err == nil {
+		emission.ID = existing.ID
+		emission.CreatedAt = existing.CreatedAt
+	}
+	if err := s.db.Save(emission).Error; err != nil {
+		return nil, fmt.Errorf("failed to save trip emissions: %w", err)
+	}
+	return emission, nil
+}
+
+// RecordCompletedTrips records the emissions of the completed trips that
+// don't have them yet
+func (s *EmissionsService) RecordCompletedTrips() error {
+	var tripIDs []uint
+	if err := s.db.Model(&models.Trip{}).
+		Where("status = ?", "COMPLETED").
+		Where("id NOT IN (?)", s.db.Model(&models.TripEmission{}).Select("trip_id")).
+		Pluck("id", &tripIDs).Error; err != nil {
+		return fmt.Errorf("failed to get trips without emissions: %w", err)
+	}
+
+	failed := 0
+	for _, tripID := range tripIDs {
+		if _, err := s.RecordTrip(tripID); err != nil {
+			log.Printf("Failed to record emissions of trip %d: %v", tripID, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to record emissions of %d of %d trips", failed, len(tripIDs))
+	}
+	return nil
+}
+
+// GetTripEmissions returns a trip's recorded emissions, or an estimate so far
+// when none were recorded, allocated to its loads
+func (s *EmissionsService) GetTripEmissions(tripID uint) (*TripEmissions, error) {
+	result := &TripEmissions{Recorded: true}
+	err := s.db.Where("trip_id = ?", tripID).First(&result.TripEmission).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		estimate, err := s.EstimateTrip(tripID)
+		if err != nil {
+			return nil, err
+		}
+		result.TripEmission, result.Recorded = *estimate, false
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get trip emissions: %w", err)
+	}
+
+	loads, err := s.tripLoads([]uint{tripID})
+	if err != nil {
+		return nil, err
+	}
+	result.Loads = allocateEmissions(&result.TripEmission, loads[tripID])
+	return result, nil
+}
+
+// tripLoads returns the loads carried on trips, by trip
+func (s *EmissionsService) tripLoads(tripIDs []uint) (map[uint][]models.Load, error) {
+	var loads []models.Load
+	if err := s.db.Where("trip_id IN ? AND status <> ?", tripIDs, "CANCELLED").
+		Order("id ASC").Find(&loads).Error; err != nil {
+		return nil, fmt.Errorf("failed to get trip loads: %w", err)
+	}
+	byTrip := make(map[uint][]models.Load)
+	for _, load := range loads {
+		byTrip[load.TripID] = append(byTrip[load.TripID], load)
+	}
+	return byTrip, nil
+}
+
+// allocateEmissions splits a trip's emissions between its loads by weight,
+// evenly when their weights aren't known
+func allocateEmissions(emission *models.TripEmission, loads []models.Load) []LoadEmission {
+	totalWeight := 0.0
+	for _, load := range loads {
+		totalWeight += load.Weight
+	}
+
+	allocations := make([]LoadEmission, 0, len(loads))
+	for _, load := range loads {
+		share := 1 / float64(len(loads))
+		if totalWeight > 0 {
+			share = load.Weight / totalWeight
+		}
+		allocation := LoadEmission{
+			LoadID:           load.ID,
+			BookingReference: load.BookingReference,
+			TripID:           emission.TripID,
+			TripDate:         emission.TripDate,
+			WeightKg:         load.Weight,
+			Share:            share,
+			DistanceKm:       emission.DistanceKm,
+			FuelLitres:       emission.FuelLitres * share,
+			CO2Kg:            emission.CO2Kg * share,
+		}
+		if tonneKm := load.Weight / 1000 * emission.DistanceKm; tonneKm > 0 {
+			allocation.CO2PerTonneKm = allocation.CO2Kg * 1000 / tonneKm
+		}
+		allocations = append(allocations, allocation)
+	}
+	return allocations
+}
+
+// GetCarbonReport sums the recorded emissions of a scope's trips, or of its
+// loads for the shipper view, between from and to, and compares them with
+// the period of the same length before. A nil scope reports everyone's.
+func (s *EmissionsService) GetCarbonReport(scope *OrganizationScope, view string, from, to time.Time) (*CarbonReport, error) {
+	if view != CarbonViewCarrier && view != CarbonViewShipper {
+		return nil, ErrInvalidCarbonView
+	}
+	length := to.Sub(from)
+	if length <= 0 {
+		return nil, ErrInvalidCarbonPeriod
+	}
+
+	report := &CarbonReport{
+		View:         view,
+		From:         from,
+		To:           to,
+		PreviousFrom: from.Add(-length),
+		PreviousTo:   from.Add(-time.Nanosecond),
+	}
+	current, loads, err := s.periodTotals(scope, view, report.From, report.To)
+	if err != nil {
+		return nil, err
+	}
+	previous, _, err := s.periodTotals(scope, view, report.PreviousFrom, report.PreviousTo)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Current, report.Previous = *current, *previous
+	report.Change = CarbonTotals{
+		Trips:         current.Trips - previous.Trips,
+		Loads:         current.Loads - previous.Loads,
+		DistanceKm:    current.DistanceKm - previous.DistanceKm,
+		FuelLitres:    current.FuelLitres - previous.FuelLitres,
+		CO2Kg:         current.CO2Kg - previous.CO2Kg,
+		TonneKm:       current.TonneKm - previous.TonneKm,
+		CO2PerTonneKm: current.CO2PerTonneKm - previous.CO2PerTonneKm,
+	}
+	if previous.CO2Kg > 0 {
+		change := (current.CO2Kg - previous.CO2Kg) / previous.CO2Kg * 100
+		report.CO2ChangePercent = &change
+	}
+	if view == CarbonViewShipper {
+		report.Loads = loads
+	}
+	return report, nil
+}
+
+// periodTotals sums the emissions of a period, returning the allocations of
+// the scope's loads for the shipper view
+func (s *EmissionsService) periodTotals(scope *OrganizationScope, view string, from, to time.Time) (*CarbonTotals, []LoadEmission, error) {
+	query := s.db.Where("trip_date >= ? AND trip_date <= ?", from, to)
+	if scope != nil {
+		if view == CarbonViewCarrier {
+			query = query.Where("trip_id IN (?)", s.db.Model(&models.Trip{}).Select("id").
+				Where("user_id = ? OR organization_id IN ?", scope.UserID, scope.OrganizationIDs))
+		} else {
+			query = query.Where("trip_id IN (?)", s.shippedLoads(scope).Select("trip_id"))
+		}
+	}
+
+	var emissions []models.TripEmission
+	if err := query.Order("trip_date ASC").Find(&emissions).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to get trip emissions: %w", err)
+	}
+	tripIDs := make([]uint, len(emissions))
+	for i, emission := range emissions {
+		tripIDs[i] = emission.TripID
+	}
+	loads, err := s.tripLoads(tripIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var shipped map[uint]bool
+	if view == CarbonViewShipper && scope != nil {
+		var loadIDs []uint
+		if err := s.shippedLoads(scope).Where("trip_id IN ?", tripIDs).Pluck("id", &loadIDs).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to get loads: %w", err)
+		}
+		shipped = make(map[uint]bool, len(loadIDs))
+		for _, loadID := range loadIDs {
+			shipped[loadID] = true
+		}
+	}
+
+	totals := &CarbonTotals{}
+	var allocations []LoadEmission
+	for i := range emissions {
+		emission := &emissions[i]
+		if view == CarbonViewCarrier {
+			totals.Trips++
+			totals.Loads += len(loads[emission.TripID])
+			totals.DistanceKm += emission.DistanceKm
+			totals.FuelLitres += emission.FuelLitres
+			totals.CO2Kg += emission.CO2Kg
+			totals.TonneKm += emission.PayloadKg / 1000 * emission.DistanceKm
+			continue
+		}
+
+		counted := false
+		for _, allocation := range allocateEmissions(emission, loads[emission.TripID]) {
+			if shipped != nil && !shipped[allocation.LoadID] {
+				continue
+			}
+			if !counted {
+				totals.Trips++
+				totals.DistanceKm += emission.DistanceKm
+				counted = true
+			}
+			totals.Loads++
+			totals.FuelLitres += allocation.FuelLitres
+			totals.CO2Kg += allocation.CO2Kg
+			totals.TonneKm += allocation.WeightKg / 1000 * allocation.DistanceKm
+			allocations = append(allocations, allocation)
+		}
+	}
+	if totals.TonneKm > 0 {
+		totals.CO2PerTonneKm = totals.CO2Kg * 1000 / totals.TonneKm
+	}
+	return totals, allocations, nil
+}
+
+// shippedLoads selects the loads of a scope's user and organizations
+func (s *EmissionsService) shippedLoads(scope *OrganizationScope) *gorm.DB {
+	return s.db.Model(&models.Load{}).
+		Where("shipper_id = ? OR organization_id IN ?", scope.UserID, scope.OrganizationIDs)
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+	"triplink/backend/models"
+)
+
+const (
+	// etaPredictionSampleInterval limits how often an ETA is recorded per
+	// trip, since it is recalculated on every location update
+	etaPredictionSampleInterval = 5 * time.Minute
+
+	// maxETAAccuracyPredictions caps the predictions read for a report
+	maxETAAccuracyPredictions = 100000
+)
+
+// ETAAccuracyFilter limits the predictions included in an accuracy report
+type ETAAccuracyFilter struct {
+	From      *time.Time
+	To        *time.Time
+	CarrierID uint
+	Source    string
+}
+
+// ETAAccuracyStats summarizes the errors of a group of predictions in minutes
+type ETAAccuracyStats struct {
+	Group                string  `json:"group"`
+	Count                int     `json:"count"`
+	MAEMinutes           float64 `json:"mae_minutes"`
+	MeanErrorMinutes     float64 `json:"mean_error_minutes"` // positive when trips arrive later than predicted
+	P50AbsErrorMinutes   float64 `json:"p50_abs_error_minutes"`
+	P90AbsErrorMinutes   float64 `json:"p90_abs_error_minutes"`
+	P95AbsErrorMinutes   float64 `json:"p95_abs_error_minutes"`
+	WithinFifteenPercent float64 `json:"within_15_minutes_percent"`
+}
+
+// ETAAccuracyReport breaks the accuracy of completed trips' ETAs down by
+// source, route, carrier, hour of day (UTC) and how long before arrival the
+// ETA was made
+type ETAAccuracyReport struct {
+	Overall     ETAAccuracyStats   `json:"overall"`
+	BySource    []ETAAccuracyStats `json:"by_source"`
+	ByRoute     []ETAAccuracyStats `json:"by_route"`
+	ByCarrier   []ETAAccuracyStats `json:"by_carrier"`
+	ByHourOfDay []ETAAccuracyStats `json:"by_hour_of_day"`
+	ByHorizon   []ETAAccuracyStats `json:"by_horizon"`
+	GeneratedAt time.Time          `json:"generated_at"`
+}
+
+// recordETAPrediction stores an ETA for later evaluation. Predictions are
+// sampled: one is skipped when the previous one of the trip has the same
+// source and was made less than the sample interval ago.
+func (ts *TrackingService) recordETAPrediction(tripID uint, estimate *ETAEstimate) error {
+	var last models.ETAPrediction
+	err := ts.db.Where("trip_id = ?", tripID).Order("predicted_at DESC").First(&last).Error
+	if err == nil && last.Source == estimate.Source &&
+		estimate.CalculatedAt.Sub(last.PredictedAt) < etaPredictionSampleInterval {
+		return nil
+	}
+
+	return ts.db.Create(&models.ETAPrediction{
+		TripID:           tripID,
+		Source:           estimate.Source,
+		Confidence:       estimate.Confidence,
+		DistanceKm:       estimate.DistanceKm,
+		PredictedAt:      estimate.CalculatedAt,
+		PredictedArrival: estimate.EstimatedArrival,
+	}).Error
+}
+
+// ResolveETAPredictions compares the open predictions of a trip with its
+// actual arrival
+func (ts *TrackingService) ResolveETAPredictions(tripID uint, actualArrival time.Time) error {
+	var predictions []models.ETAPrediction
+	if err := ts.db.Where("trip_id = ? AND actual_arrival IS NULL", tripID).Find(&predictions).Error; err != nil {
+		return fmt.Errorf("failed to get ETA predictions: %w", err)
+	}
+
+	for i := range predictions {
+		errorMinutes := actualArrival.Sub(predictions[i].PredictedArrival).Minutes()
+		if err := ts.db.Model(&predictions[i]).Updates(map[string]interface{}{
+			"actual_arrival": actualArrival,
+			"error_minutes":  errorMinutes,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to resolve ETA prediction: %w", err)
+		}
+	}
+
+	if len(predictions) > 0 {
+		log.Printf("Resolved %d ETA predictions for trip %d", len(predictions), tripID)
+	}
+	return nil
+}
+
+// tripArrivalTime returns when a trip arrived at its destination stop, or
+// fallback when the itinerary doesn't record it
+func (ts *TrackingService) tripArrivalTime(tripID uint, fallback time.Time) time.Time {
+	var destination models.TripStop
+	if err := ts.db.Where("trip_id = ? AND stop_type = ? AND actual_arrival IS NOT NULL", tripID, TripStopDestination).
+		First(&destination).Error; err == nil {
+		return *destination.ActualArrival
+	}
+	return fallback
+}
+
+// GetETAAccuracyReport evaluates the resolved ETA predictions matching the filter
+func (ts *TrackingService) GetETAAccuracyReport(filter ETAAccuracyFilter) (*ETAAccuracyReport, error) {
+	var rows []struct {
+		models.ETAPrediction
+		CarrierID       uint
+		OriginCity      string
+		DestinationCity string
+	}
+
+	query := ts.db.Table("eta_predictions").
+		Select("eta_predictions.*, trips.user_id AS carrier_id, trips.origin_city, trips.destination_city").
+		Joins("JOIN trips ON trips.id = eta_predictions.trip_id").
+		Where("eta_predictions.error_minutes IS NOT NULL AND eta_predictions.deleted_at IS NULL")
+	if filter.From != nil {
+		query = query.Where("eta_predictions.predicted_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("eta_predictions.predicted_at <= ?", *filter.To)
+	}
+	if filter.CarrierID != 0 {
+		query = query.Where("trips.user_id = ?", filter.CarrierID)
+	}
+	if filter.Source != "" {
+		query = query.Where("eta_predictions.source = ?", filter.Source)
+	}
+	if err := query.Order("eta_predictions.predicted_at DESC").
+		Limit(maxETAAccuracyPredictions).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get ETA predictions: %w", err)
+	}
+
+	var all []float64
+	bySource := make(map[string][]float64)
+	byRoute := make(map[string][]float64)
+	byCarrier := make(map[string][]float64)
+	byHour := make(map[string][]float64)
+	byHorizon := make(map[string][]float64)
+
+	for _, row := range rows {
+		errorMinutes := *row.ErrorMinutes
+		all = append(all, errorMinutes)
+		bySource[row.Source] = append(bySource[row.Source], errorMinutes)
+
+		route := fmt.Sprintf("%s - %s", row.OriginCity, row.DestinationCity)
+		byRoute[route] = append(byRoute[route], errorMinutes)
+
+		carrier := fmt.Sprintf("%d", row.CarrierID)
+		byCarrier[carrier] = append(byCarrier[carrier], errorMinutes)
+
+		hour := fmt.Sprintf("%02d:00", row.PredictedAt.UTC().Hour())
+		byHour[hour] = append(byHour[hour], errorMinutes)
+
+		if row.ActualArrival != nil {
+			horizon := etaHorizonBucket(row.ActualArrival.Sub(row.PredictedAt))
+			byHorizon[horizon] = append(byHorizon[horizon], errorMinutes)
+		}
+	}
+
+	return &ETAAccuracyReport{
+		Overall:     calculateETAAccuracy("all", all),
+		BySource:    groupETAAccuracy(bySource),
+		ByRoute:     groupETAAccuracy(byRoute),
+		ByCarrier:   groupETAAccuracy(byCarrier),
+		ByHourOfDay: groupETAAccuracy(byHour),
+		ByHorizon:   groupETAAccuracy(byHorizon),
+		GeneratedAt: time.Now(),
+	}, nil
+}
+
+// etaHorizonBucket groups predictions by how long before the arrival they were made
+func etaHorizonBucket(horizon time.Duration) string {
+	switch {
+	case horizon < time.Hour:
+		return "0-1h"
+	case horizon < 4*time.Hour:
+		return "1-4h"
+	case horizon < 12*time.Hour:
+		return "4-12h"
+	default:
+		return "12h+"
+	}
+}
+
+// groupETAAccuracy calculates the accuracy of each group, sorted by group name
+func groupETAAccuracy(groups map[string][]float64) []ETAAccuracyStats {
+	stats := make([]ETAAccuracyStats, 0, len(groups))
+	for group, values := range groups {
+		stats = append(stats, calculateETAAccuracy(group, values))
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Group < stats[j].Group
+	})
+	return stats
+}
+
+// calculateETAAccuracy summarizes signed prediction errors in minutes
+func calculateETAAccuracy(group string, values []float64) ETAAccuracyStats {
+	stats := ETAAccuracyStats{Group: group, Count: len(values)}
+	if len(values) == 0 {
+		return stats
+	}
+
+	absErrors := make([]float64, len(values))
+	var sum, absSum float64
+	within := 0
+	for i, e := range values {
+		absErrors[i] = math.Abs(e)
+		sum += e
+		absSum += absErrors[i]
+		if absErrors[i] <= 15 {
+			within++
+		}
+	}
+	sort.Float64s(absErrors)
+
+	n := float64(len(values))
+	stats.MAEMinutes = absSum / n
+	stats.MeanErrorMinutes = sum / n
+	stats.P50AbsErrorMinutes = percentile(absErrors, 50)
+	stats.P90AbsErrorMinutes = percentile(absErrors, 90)
+	stats.P95AbsErrorMinutes = percentile(absErrors, 95)
+	stats.WithinFifteenPercent = float64(within) / n * 100
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted values, interpolating
+// between the closest ranks
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
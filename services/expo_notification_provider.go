@@ -78,6 +78,7 @@ func (p *ExpoNotificationProvider) SendNotification(tokens []string, notificatio
 		Body:  notification.Message,
 		Data:  payload,
 		Sound: "default",
+		Badge: payloadBadge(payload),
 		TTL:   3600, // 1 hour
 	}
 
@@ -158,6 +159,7 @@ func (p *ExpoNotificationProvider) BatchSendNotifications(notifications []Notifi
 			Body:  batch.Notification.Message,
 			Data:  payload,
 			Sound: "default",
+			Badge: payloadBadge(payload),
 			TTL:   3600, // 1 hour
 		}
 
@@ -214,3 +216,9 @@ func (p *ExpoNotificationProvider) BatchSendNotifications(notifications []Notifi
 
 	return nil
 }
+
+// payloadBadge returns the unread count set in a notification payload
+func payloadBadge(payload map[string]interface{}) int {
+	count, _ := payload["badge"].(int64)
+	return int(count)
+}
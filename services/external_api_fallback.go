@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"triplink/backend/config"
+)
+
+// WeatherSourceOpenWeatherMap names the OpenWeatherMap provider's circuit breaker
+const WeatherSourceOpenWeatherMap = "OPENWEATHERMAP"
+
+// circuitBreakerETAProvider calls a routing provider through its circuit
+// breaker, giving up on calls that take longer than the timeout
+type circuitBreakerETAProvider struct {
+	provider ETARouteProvider
+	breaker  *CircuitBreaker
+	timeout  time.Duration
+}
+
+// NewCircuitBreakerETAProvider wraps a routing provider with a circuit
+// breaker, so that while it is down ETAs fall back to the next provider
+// without waiting on it
+func NewCircuitBreakerETAProvider(provider ETARouteProvider, breaker *CircuitBreaker, timeout time.Duration) ETARouteProvider {
+	return &circuitBreakerETAProvider{provider: provider, breaker: breaker, timeout: timeout}
+}
+
+// Name returns the ETA source name of the wrapped provider
+func (p *circuitBreakerETAProvider) Name() string {
+	return p.provider.Name()
+}
+
+// EstimateRoute estimates the route with the wrapped provider unless its circuit is open
+func (p *circuitBreakerETAProvider) EstimateRoute(ctx context.Context, origin, destination Coordinate) (*RoadRouteEstimate, error) {
+	var route *RoadRouteEstimate
+	err := p.breaker.Execute(func() error {
+		callCtx, cancel := context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+
+		var err error
+		route, err = p.provider.EstimateRoute(callCtx, origin, destination)
+		return err
+	})
+	return route, err
+}
+
+// routingProvider returns the routing provider of a name if its API key is configured
+func routingProvider(name string) interface {
+	ETARouteProvider
+	PlannedRouteProvider
+	TrafficAPIService
+} {
+	switch name {
+	case ETASourceHERE:
+		if config.GetAPIKeysConfig().HERE != "" {
+			return NewHEREAPIService()
+		}
+	case ETASourceGoogleMaps:
+		if config.GetAPIKeysConfig().GoogleMaps != "" {
+			return NewGoogleMapsService()
+		}
+	}
+	return nil
+}
+
+// namedTrafficProvider is a traffic provider and the breaker guarding it
+type namedTrafficProvider struct {
+	name     string
+	provider TrafficAPIService
+	breaker  *CircuitBreaker
+}
+
+// fallbackTrafficService asks traffic providers in turn, skipping those whose
+// circuit is open
+type fallbackTrafficService struct {
+	providers []namedTrafficProvider
+}
+
+// newFallbackTrafficService returns the configured traffic providers in order
+// of preference, or Google Maps alone when none has an API key
+func newFallbackTrafficService(cfg *config.CircuitBreakerConfig) TrafficAPIService {
+	service := &fallbackTrafficService{}
+	for _, name := range cfg.RoutingProviders {
+		if provider := routingProvider(name); provider != nil {
+			service.providers = append(service.providers, namedTrafficProvider{name, provider, GetCircuitBreaker(name)})
+		}
+	}
+	if len(service.providers) == 0 {
+		service.providers = append(service.providers, namedTrafficProvider{ETASourceGoogleMaps, NewGoogleMapsService(), GetCircuitBreaker(ETASourceGoogleMaps)})
+	}
+	return service
+}
+
+// try calls each provider until one succeeds, returning all the errors otherwise
+func (s *fallbackTrafficService) try(call func(TrafficAPIService) error) error {
+	var failures []string
+	for _, p := range s.providers {
+		err := p.breaker.Execute(func() error { return call(p.provider) })
+		if err == nil {
+			return nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", p.name, err))
+	}
+	return fmt.Errorf("all traffic providers failed: %s", strings.Join(failures, "; "))
+}
+
+func (s *fallbackTrafficService) GetTrafficConditions(origin, destination string) (*TrafficInfo, error) {
+	var info *TrafficInfo
+	err := s.try(func(provider TrafficAPIService) error {
+		var err error
+		info, err = provider.GetTrafficConditions(origin, destination)
+		return err
+	})
+	return info, err
+}
+
+func (s *fallbackTrafficService) GetRouteMatrix(origins, destinations []string) (*RouteMatrix, error) {
+	var matrix *RouteMatrix
+	err := s.try(func(provider TrafficAPIService) error {
+		var err error
+		matrix, err = provider.GetRouteMatrix(origins, destinations)
+		return err
+	})
+	return matrix, err
+}
+
+func (s *fallbackTrafficService) GetTrafficIncidents(bounds BoundingBox) ([]TrafficIncident, error) {
+	var incidents []TrafficIncident
+	err := s.try(func(provider TrafficAPIService) error {
+		var err error
+		incidents, err = provider.GetTrafficIncidents(bounds)
+		return err
+	})
+	return incidents, err
+}
+
+// circuitBreakerWeatherService calls a weather provider through its circuit breaker
+type circuitBreakerWeatherService struct {
+	provider WeatherAPIService
+	breaker  *CircuitBreaker
+}
+
+func (s *circuitBreakerWeatherService) GetCurrentWeather(lat, lng float64) (*WeatherCondition, error) {
+	var weather *WeatherCondition
+	err := s.breaker.Execute(func() error {
+		var err error
+		weather, err = s.provider.GetCurrentWeather(lat, lng)
+		return err
+	})
+	return weather, err
+}
+
+func (s *circuitBreakerWeatherService) GetWeatherForecast(lat, lng float64, hours int) ([]WeatherCondition, error) {
+	var forecast []WeatherCondition
+	err := s.breaker.Execute(func() error {
+		var err error
+		forecast, err = s.provider.GetWeatherForecast(lat, lng, hours)
+		return err
+	})
+	return forecast, err
+}
+
+func (s *circuitBreakerWeatherService) GetWeatherAlerts(bounds BoundingBox) ([]WeatherAlert, error) {
+	var alerts []WeatherAlert
+	err := s.breaker.Execute(func() error {
+		var err error
+		alerts, err = s.provider.GetWeatherAlerts(bounds)
+		return err
+	})
+	return alerts, err
+}
+
+func (s *circuitBreakerWeatherService) GetRouteWeather(waypoints []Coordinate) ([]WeatherCondition, error) {
+	var conditions []WeatherCondition
+	err := s.breaker.Execute(func() error {
+		var err error
+		conditions, err = s.provider.GetRouteWeather(waypoints)
+		return err
+	})
+	return conditions, err
+}
@@ -1,13 +1,15 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"time"
+	"triplink/backend/config"
+	"triplink/backend/tracing"
 )
 
 // External API service interfaces and implementations
@@ -211,10 +213,11 @@ type GoogleMapsService struct {
 
 func NewGoogleMapsService() *GoogleMapsService {
 	return &GoogleMapsService{
-		APIKey:  os.Getenv("GOOGLE_MAPS_API_KEY"),
+		APIKey:  config.GetAPIKeysConfig().GoogleMaps,
 		BaseURL: "https://maps.googleapis.com/maps/api",
 		HTTPClient: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout:   10 * time.Second,
+			Transport: tracing.Transport(nil),
 		},
 	}
 }
@@ -375,6 +378,11 @@ func (g *GoogleMapsService) GetOptimizedRoute(request RouteRequest) (*RouteRespo
 }
 
 func (g *GoogleMapsService) GetDirections(origin, destination string, options DirectionOptions) (*DirectionsResponse, error) {
+	return g.GetDirectionsContext(context.Background(), origin, destination, options)
+}
+
+// GetDirectionsContext gets directions, tracing the call as part of the trace in ctx
+func (g *GoogleMapsService) GetDirectionsContext(ctx context.Context, origin, destination string, options DirectionOptions) (*DirectionsResponse, error) {
 	// Build avoid parameter
 	avoidStr := ""
 	if options.AvoidTolls {
@@ -410,7 +418,11 @@ func (g *GoogleMapsService) GetDirections(origin, destination string, options Di
 
 	apiURL := fmt.Sprintf("%s/directions/json?%s", g.BaseURL, params.Encode())
 
-	resp, err := g.HTTPClient.Get(apiURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := g.HTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get directions: %w", err)
 	}
@@ -501,7 +513,7 @@ type OpenWeatherMapService struct {
 
 func NewOpenWeatherMapService() *OpenWeatherMapService {
 	return &OpenWeatherMapService{
-		APIKey:  os.Getenv("OPENWEATHERMAP_API_KEY"),
+		APIKey:  config.GetAPIKeysConfig().OpenWeatherMap,
 		BaseURL: "https://api.openweathermap.org/data/2.5",
 		HTTPClient: &http.Client{
 			Timeout: 10 * time.Second,
@@ -865,13 +877,18 @@ type RouteOptimizationOptions struct {
 	TrafficModel  string     `json:"traffic_model"`
 }
 
-// Service factory function
+// Service factory function. Traffic falls back across the routing providers
+// and weather fails fast while OpenWeatherMap is down.
 func NewExternalAPIServices() (TrafficAPIService, WeatherAPIService, MappingAPIService, FuelPriceAPIService, TollAPIService, ConstructionAPIService) {
 	googleMaps := NewGoogleMapsService()
-	openWeather := NewOpenWeatherMapService()
+	traffic := newFallbackTrafficService(config.GetCircuitBreakerConfig())
+	openWeather := &circuitBreakerWeatherService{
+		provider: NewOpenWeatherMapService(),
+		breaker:  GetCircuitBreaker(WeatherSourceOpenWeatherMap),
+	}
 	fuelService := NewFuelAPIService()
 	tollService := NewTollAPIService()
 	constructionService := NewDOTAPIService()
 
-	return googleMaps, openWeather, googleMaps, fuelService, tollService, constructionService
+	return traffic, openWeather, googleMaps, fuelService, tollService, constructionService
 }
\ No newline at end of file
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Flags of the features being rolled out
+const (
+	FeatureMLETA      = "ml_eta"      // ETAs predicted by the ML model
+	FeatureMatchingV2 = "matching_v2" // the new load matching engine
+)
+
+var (
+	// ErrFeatureFlagNotFound is returned for flags that don't exist
+	ErrFeatureFlagNotFound = errors.New("feature flag not found")
+
+	// ErrInvalidFeatureFlagKey is returned for keys that aren't lowercase
+	// words separated by underscores, dots or dashes
+	ErrInvalidFeatureFlagKey = errors.New("feature flag key must be lowercase letters, digits, underscores, dots or dashes")
+)
+
+var featureFlagKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+// FeatureFlagRequest changes a feature flag. Fields left out keep their
+// value, or their default for a new flag.
+type FeatureFlagRequest struct {
+	Description     *string `json:"description"`
+	Enabled         *bool   `json:"enabled"`
+	RolloutPercent  *int    `json:"rollout_percent"`
+	UserIDs         *[]uint `json:"user_ids"`
+	OrganizationIDs *[]uint `json:"organization_ids"`
+}
+
+// FeatureFlagService evaluates feature flags for users. Flags are cached and
+// re-read from the database every refresh interval.
+type FeatureFlagService struct {
+	db      *gorm.DB
+	refresh time.Duration
+	now     func() time.Time
+
+	mu       sync.RWMutex
+	flags    map[string]models.FeatureFlag
+	loadedAt time.Time
+}
+
+// NewFeatureFlagService creates a feature flag service
+func NewFeatureFlagService(db *gorm.DB, refresh time.Duration) *FeatureFlagService {
+	return &FeatureFlagService{db: db, refresh: refresh, now: time.Now}
+}
+
+// cachedFlags returns the flags by key, re-reading them once stale. When they
+// can't be read the stale flags are kept.
+func (s *FeatureFlagService) cachedFlags() map[string]models.FeatureFlag {
+	s.mu.RLock()
+	flags, loadedAt := s.flags, s.loadedAt
+	s.mu.RUnlock()
+	if flags != nil && s.now().Sub(loadedAt) < s.refresh {
+		return flags
+	}
+
+	var stored []models.FeatureFlag
+	if err := s.db.Find(&stored).Error; err != nil {
+		if flags == nil {
+			return map[string]models.FeatureFlag{}
+		}
+		return flags
+	}
+	flags = make(map[string]models.FeatureFlag, len(stored))
+	for _, flag := range stored {
+		flags[flag.Key] = flag
+	}
+
+	s.mu.Lock()
+	s.flags, s.loadedAt = flags, s.now()
+	s.mu.Unlock()
+	return flags
+}
+
+// invalidate makes the next evaluation re-read the flags
+func (s *FeatureFlagService) invalidate() {
+	s.mu.Lock()
+	s.flags = nil
+	s.mu.Unlock()
+}
+
+// IsEnabled tells whether a feature is on for a user. Unknown and disabled
+// flags are off. Anonymous requests, with no user, only get fully rolled out
+// features.
+func (s *FeatureFlagService) IsEnabled(key string, userID uint) bool {
+	flag, ok := s.cachedFlags()[key]
+	if !ok {
+		return false
+	}
+	return s.evaluate(flag, userID, nil)
+}
+
+// EnabledFeatures returns whether each flag is on for a user, by key
+func (s *FeatureFlagService) EnabledFeatures(userID uint) map[string]bool {
+	var organizationIDs []uint
+	if userID != 0 {
+		organizationIDs = s.userOrganizationIDs(userID)
+	}
+
+	features := map[string]bool{}
+	for key, flag := range s.cachedFlags() {
+		features[key] = s.evaluate(flag, userID, organizationIDs)
+	}
+	return features
+}
+
+// evaluate tells whether a flag is on for a user. organizationIDs are the
+// user's organizations, looked up when nil and the flag targets any.
+func (s *FeatureFlagService) evaluate(flag models.FeatureFlag, userID uint, organizationIDs []uint) bool {
+	if !flag.Enabled {
+		return false
+	}
+	if flag.RolloutPercent >= 100 {
+		return true
+	}
+	if userID == 0 {
+		return false
+	}
+
+	if containsID(parseIDList(flag.UserIDs), userID) {
+		return true
+	}
+	if targeted := parseIDList(flag.OrganizationIDs); len(targeted) > 0 {
+		if organizationIDs == nil {
+			organizationIDs = s.userOrganizationIDs(userID)
+		}
+		for _, organizationID := range organizationIDs {
+			if containsID(targeted, organizationID) {
+				return true
+			}
+		}
+	}
+
+	return rolloutBucket(flag.Key, userID) < flag.RolloutPercent
+}
+
+// userOrganizationIDs returns the organizations a user is a member of
+func (s *FeatureFlagService) userOrganizationIDs(userID uint) []uint {
+	organizationIDs := []uint{}
+	s.db.Model(&models.OrganizationMembership{}).Where("user_id = ?", userID).Pluck("organization_id", &organizationIDs)
+	return organizationIDs
+}
+
+// rolloutBucket places a user in one of 100 buckets of a flag. Users stay in
+// their bucket as the rollout grows, and the buckets of different flags are
+// independent.
+func rolloutBucket(key string, userID uint) int {
+	h := fnv.New32a()
+	h.Write([]byte(key + ":" + strconv.FormatUint(uint64(userID), 10)))
+	return int(h.Sum32() % 100)
+}
+
+// ListFlags returns all feature flags by key
+func (s *FeatureFlagService) ListFlags() ([]models.FeatureFlag, error) {
+	var flags []models.FeatureFlag
+	if err := s.db.Order("key").Find(&flags).Error; err != nil {
+		return nil, fmt.Errorf("failed to list feature flags: %w", err)
+	}
+	return flags, nil
+}
+
+// SetFlag creates or changes a feature flag. New flags are disabled unless
+// the request enables them.
+func (s *FeatureFlagService) SetFlag(key string, req FeatureFlagRequest, updatedBy uint) (*models.FeatureFlag, error) {
+	if !featureFlagKeyPattern.MatchString(key) {
+		return nil, ErrInvalidFeatureFlagKey
+	}
+	if req.RolloutPercent != nil && (*req.RolloutPercent < 0 || *req.RolloutPercent > 100) {
+		return nil, errors.New("rollout percent must be between 0 and 100")
+	}
+
+	var flag models.FeatureFlag
+	if err := s.db.Where("key = ?", key).First(&flag).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to get feature flag: %w", err)
+		}
+		flag = models.FeatureFlag{Key: key}
+	}
+
+	if req.Description != nil {
+		flag.Description = *req.Description
+	}
+	if req.Enabled != nil {
+		flag.Enabled = *req.Enabled
+	}
+	if req.RolloutPercent != nil {
+		flag.RolloutPercent = *req.RolloutPercent
+	}
+	if req.UserIDs != nil {
+		flag.UserIDs = formatIDList(*req.UserIDs)
+	}
+	if req.OrganizationIDs != nil {
+		flag.OrganizationIDs = formatIDList(*req.OrganizationIDs)
+	}
+	flag.UpdatedBy = &updatedBy
+
+	if err := s.db.Save(&flag).Error; err != nil {
+		return nil, fmt.Errorf("failed to save feature flag: %w", err)
+	}
+	s.invalidate()
+	return &flag, nil
+}
+
+// DeleteFlag deletes a feature flag, turning its feature off for everyone
+func (s *FeatureFlagService) DeleteFlag(key string) error {
+	result := s.db.Where("key = ?", key).Delete(&models.FeatureFlag{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete feature flag: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrFeatureFlagNotFound
+	}
+	s.invalidate()
+	return nil
+}
+
+// parseIDList parses a comma separated list of IDs, skipping invalid entries
+func parseIDList(value string) []uint {
+	var ids []uint
+	for _, part := range strings.Split(value, ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// formatIDList formats IDs as a sorted comma separated list without duplicates
+func formatIDList(ids []uint) string {
+	unique := uniqueIDs(ids)
+	sort.Slice(unique, func(i, j int) bool { return unique[i] < unique[j] })
+	parts := make([]string, len(unique))
+	for i, id := range unique {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Global feature flag service instance, set up at startup
+var (
+	featureFlagServiceInstance *FeatureFlagService
+	featureFlagServiceMu       sync.RWMutex
+)
+
+// GetFeatureFlagService returns the shared feature flag service, or nil when
+// none was set up
+func GetFeatureFlagService() *FeatureFlagService {
+	featureFlagServiceMu.RLock()
+	defer featureFlagServiceMu.RUnlock()
+	return featureFlagServiceInstance
+}
+
+// SetFeatureFlagService replaces the shared feature flag service
+func SetFeatureFlagService(service *FeatureFlagService) {
+	featureFlagServiceMu.Lock()
+	defer featureFlagServiceMu.Unlock()
+	featureFlagServiceInstance = service
+}
+
+// FeatureEnabled tells whether a feature is on for a user, for services
+// choosing between the old and new behavior. Features are off when no
+// feature flag service was set up.
+func FeatureEnabled(key string, userID uint) bool {
+	service := GetFeatureFlagService()
+	if service == nil {
+		return false
+	}
+	return service.IsEnabled(key, userID)
+}
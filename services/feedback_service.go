@@ -0,0 +1,271 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Analysis status of feedback
+const (
+	FeedbackPending  = "PENDING"
+	FeedbackAnalyzed = "ANALYZED"
+	// Feedback without a comment has nothing to analyze
+	FeedbackSkipped = "SKIPPED"
+	// Analysis failed on every attempt
+	FeedbackFailed = "FAILED"
+)
+
+// Sentiment of analyzed feedback
+const (
+	SentimentPositive = "POSITIVE"
+	SentimentNeutral  = "NEUTRAL"
+	SentimentNegative = "NEGATIVE"
+)
+
+// FeedbackCategories are the topics feedback comments are classified into
+var FeedbackCategories = []string{
+	"timeliness",
+	"communication",
+	"cargo condition",
+	"pricing",
+	"driver conduct",
+	"documentation",
+}
+
+const (
+	// feedbackAnalysisBatch is how many feedback comments are analyzed per run
+	feedbackAnalysisBatch = 50
+	// maxFeedbackAnalysisAttempts is how often analysis is tried before the
+	// feedback is marked failed
+	maxFeedbackAnalysisAttempts = 3
+)
+
+var (
+	// ErrNotLoadShipper is returned when someone other than a load's shipper
+	// gives feedback on it
+	ErrNotLoadShipper = errors.New("only the shipper of the load can give feedback on it")
+	// ErrFeedbackExists is returned when a load already has feedback
+	ErrFeedbackExists = errors.New("feedback was already given for this load")
+	// ErrNotFeedbackCarrier is returned when someone other than the carrier
+	// the feedback is about resolves it
+	ErrNotFeedbackCarrier = errors.New("only the carrier of the load can resolve its feedback")
+	// ErrFeedbackNotFound is returned for feedback that doesn't exist or that
+	// the user isn't a party to
+	ErrFeedbackNotFound = errors.New("feedback not found")
+)
+
+// FeedbackAnalyzer analyzes the sentiment and topic of feedback comments.
+// Implemented by MLService.
+type FeedbackAnalyzer interface {
+	AnalyzeSentiment(text string) (*SentimentAnalysisResult, error)
+	ClassifyText(text string, categories []string) (*TextClassificationResult, error)
+}
+
+// SubmitFeedbackRequest is a shipper's survey of a delivered load
+type SubmitFeedbackRequest struct {
+	Rating         int    `json:"rating"`                    // 1-5 stars
+	RecommendScore *int   `json:"recommend_score,omitempty"` // 0-10
+	Comment        string `json:"comment"`
+}
+
+// FeedbackService collects shippers' feedback on delivered loads and analyzes
+// it in the background
+type FeedbackService struct {
+	db       *gorm.DB
+	analyzer FeedbackAnalyzer
+	now      func() time.Time
+}
+
+// NewFeedbackService creates a new FeedbackService
+func NewFeedbackService(db *gorm.DB, analyzer FeedbackAnalyzer) *FeedbackService {
+	return &FeedbackService{
+		db:       db,
+		analyzer: analyzer,
+		now:      time.Now,
+	}
+}
+
+// Submit records a shipper's feedback on a delivered load. Comments are
+// analyzed later by AnalyzePending.
+func (s *FeedbackService) Submit(shipperID, loadID uint, req SubmitFeedbackRequest) (*models.Feedback, error) {
+	if req.Rating < 1 || req.Rating > 5 {
+		return nil, errors.New("rating must be between 1 and 5")
+	}
+	if req.RecommendScore != nil && (*req.RecommendScore < 0 || *req.RecommendScore > 10) {
+		return nil, errors.New("recommend score must be between 0 and 10")
+	}
+
+	var load models.Load
+	if err := s.db.First(&load, loadID).Error; err != nil {
+		return nil, errors.New("load not found")
+	}
+	if load.ShipperID != shipperID {
+		return nil, ErrNotLoadShipper
+	}
+	if load.Status != "DELIVERED" {
+		return nil, errors.New("feedback can only be given on delivered loads")
+	}
+
+	var existing int64
+	s.db.Model(&models.Feedback{}).Where("load_id = ? AND deleted_at IS NULL", loadID).Count(&existing)
+	if existing > 0 {
+		return nil, ErrFeedbackExists
+	}
+
+	feedback := models.Feedback{
+		LoadID:         load.ID,
+		TripID:         load.TripID,
+		ShipperID:      shipperID,
+		Rating:         req.Rating,
+		RecommendScore: req.RecommendScore,
+		Comment:        strings.TrimSpace(req.Comment),
+		AnalysisStatus: FeedbackPending,
+	}
+	var trip models.Trip
+	if err := s.db.Select("id, user_id").First(&trip, load.TripID).Error; err == nil {
+		feedback.CarrierID = trip.UserID
+	}
+	if feedback.Comment == "" {
+		feedback.AnalysisStatus = FeedbackSkipped
+	}
+	if err := s.db.Create(&feedback).Error; err != nil {
+		return nil, fmt.Errorf("failed to save feedback: %w", err)
+	}
+	return &feedback, nil
+}
+
+// UserFeedbackQuery returns the query of feedback a user gave as shipper or
+// received as carrier
+func (s *FeedbackService) UserFeedbackQuery(userID uint) *gorm.DB {
+	return s.db.Model(&models.Feedback{}).
+		Where("(shipper_id = ? OR carrier_id = ?) AND deleted_at IS NULL", userID, userID)
+}
+
+// Resolve records the carrier's follow-up on feedback they received
+func (s *FeedbackService) Resolve(carrierID, feedbackID uint, note string) (*models.Feedback, error) {
+	var feedback models.Feedback
+	if err := s.UserFeedbackQuery(carrierID).First(&feedback, feedbackID).Error; err != nil {
+		return nil, ErrFeedbackNotFound
+	}
+	if feedback.CarrierID != carrierID {
+		return nil, ErrNotFeedbackCarrier
+	}
+	if feedback.ResolvedAt != nil {
+		return nil, errors.New("feedback is already resolved")
+	}
+
+	now := s.now()
+	feedback.ResolvedAt = &now
+	feedback.ResolvedBy = &carrierID
+	feedback.ResolutionNote = strings.TrimSpace(note)
+	if err := s.db.Model(&feedback).Updates(map[string]interface{}{
+		"resolved_at":     feedback.ResolvedAt,
+		"resolved_by":     feedback.ResolvedBy,
+		"resolution_note": feedback.ResolutionNote,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve feedback: %w", err)
+	}
+	return &feedback, nil
+}
+
+// AnalyzePending analyzes the sentiment and topic of feedback submitted since
+// the last run. Feedback whose analysis fails is retried on the next runs, up
+// to maxFeedbackAnalysisAttempts.
+func (s *FeedbackService) AnalyzePending() error {
+	var pending []models.Feedback
+	if err := s.db.Where("analysis_status = ? AND deleted_at IS NULL", FeedbackPending).
+		Order("id").Limit(feedbackAnalysisBatch).Find(&pending).Error; err != nil {
+		return fmt.Errorf("failed to get pending feedback: %w", err)
+	}
+
+	for i := range pending {
+		if err := s.analyze(&pending[i]); err != nil {
+			log.Printf("Failed to analyze feedback %d: %v", pending[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// analyze runs a feedback comment through sentiment analysis and topic
+// classification, and tells the carrier about negative feedback
+func (s *FeedbackService) analyze(feedback *models.Feedback) error {
+	attempts := feedback.AnalysisAttempts + 1
+	sentiment, err := s.analyzer.AnalyzeSentiment(feedback.Comment)
+	var classification *TextClassificationResult
+	if err == nil {
+		classification, err = s.analyzer.ClassifyText(feedback.Comment, FeedbackCategories)
+	}
+	if err != nil {
+		status := FeedbackPending
+		if attempts >= maxFeedbackAnalysisAttempts {
+			status = FeedbackFailed
+		}
+		s.db.Model(feedback).Updates(map[string]interface{}{
+			"analysis_status":   status,
+			"analysis_attempts": attempts,
+		})
+		return err
+	}
+
+	now := s.now()
+	updates := map[string]interface{}{
+		"analysis_status":      FeedbackAnalyzed,
+		"analysis_attempts":    attempts,
+		"sentiment":            normalizeSentiment(sentiment.Sentiment),
+		"sentiment_confidence": sentiment.Confidence,
+		"category":             classification.TopCategory,
+		"category_confidence":  classification.Confidence,
+		"analyzed_at":          now,
+	}
+	if err := s.db.Model(feedback).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to save analysis: %w", err)
+	}
+
+	if updates["sentiment"] == SentimentNegative {
+		s.notifyNegative(feedback, classification.TopCategory)
+	}
+	return nil
+}
+
+// notifyNegative asks the carrier to follow up on negative feedback
+func (s *FeedbackService) notifyNegative(feedback *models.Feedback, category string) {
+	if feedback.CarrierID == 0 {
+		return
+	}
+	var load models.Load
+	s.db.Select("id, booking_reference").First(&load, feedback.LoadID)
+
+	notification := models.Notification{
+		UserID:    feedback.CarrierID,
+		Title:     "Negative Feedback",
+		Message:   fmt.Sprintf("The shipper of load %s rated it %d/5, mostly about %s. Follow up and resolve the feedback.", load.BookingReference, feedback.Rating, category),
+		Type:      "FEEDBACK_NEGATIVE",
+		RelatedID: feedback.ID,
+	}
+	if notifications := GetNotificationService(); notifications != nil {
+		if created, _, err := notifications.CreateNotificationWithDelivery(&notification); created == nil {
+			log.Printf("Failed to notify carrier of negative feedback %d: %v", feedback.ID, err)
+		}
+	} else {
+		s.db.Create(&notification)
+	}
+}
+
+// normalizeSentiment maps a sentiment model's label to POSITIVE, NEUTRAL or
+// NEGATIVE
+func normalizeSentiment(label string) string {
+	label = strings.ToUpper(label)
+	switch {
+	case strings.HasPrefix(label, "POS"), label == "LABEL_2":
+		return SentimentPositive
+	case strings.HasPrefix(label, "NEG"), label == "LABEL_0":
+		return SentimentNegative
+	}
+	return SentimentNeutral
+}
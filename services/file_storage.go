@@ -0,0 +1,320 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"triplink/backend/config"
+)
+
+// FileStorage stores uploaded files and returns the URL they can be retrieved from
+type FileStorage interface {
+	Put(key, contentType string, data []byte) (string, error)
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+	Name() string
+}
+
+// PresignedURLStorage is a file storage that can issue time-limited URLs for
+// clients to upload and download files directly
+type PresignedURLStorage interface {
+	PresignURL(method, key string, expires time.Duration) (string, error)
+}
+
+// NewFileStorage creates the file storage configured in cfg
+func NewFileStorage(cfg *config.StorageConfig) FileStorage {
+	if cfg.Provider == "s3" {
+		return NewS3FileStorage(cfg)
+	}
+	return NewLocalFileStorage(cfg.LocalPath, cfg.PublicBaseURL)
+}
+
+// LocalFileStorage stores files on the local disk, for development and tests
+type LocalFileStorage struct {
+	BasePath string
+	BaseURL  string
+}
+
+// NewLocalFileStorage creates a new local file storage
+func NewLocalFileStorage(basePath, baseURL string) *LocalFileStorage {
+	if baseURL == "" {
+		baseURL = "/uploads"
+	}
+	return &LocalFileStorage{
+		BasePath: basePath,
+		BaseURL:  strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// Name returns the storage provider name
+func (s *LocalFileStorage) Name() string {
+	return "local"
+}
+
+// Put writes the file under the base path
+func (s *LocalFileStorage) Put(key, contentType string, data []byte) (string, error) {
+	path := filepath.Join(s.BasePath, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	return s.BaseURL + "/" + key, nil
+}
+
+// Get reads a file stored under the base path
+func (s *LocalFileStorage) Get(key string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.BasePath, filepath.FromSlash(key)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return data, nil
+}
+
+// Delete removes a file stored under the base path. Missing files are ignored.
+func (s *LocalFileStorage) Delete(key string) error {
+	err := os.Remove(filepath.Join(s.BasePath, filepath.FromSlash(key)))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+// S3FileStorage stores files in an S3-compatible bucket using signed PUT requests
+type S3FileStorage struct {
+	Endpoint     string
+	Region       string
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	UsePathStyle bool
+	BaseURL      string
+	HTTPClient   *http.Client
+}
+
+// NewS3FileStorage creates a new S3-compatible file storage
+func NewS3FileStorage(cfg *config.StorageConfig) *S3FileStorage {
+	return &S3FileStorage{
+		Endpoint:     strings.TrimRight(cfg.S3Endpoint, "/"),
+		Region:       cfg.S3Region,
+		Bucket:       cfg.S3Bucket,
+		AccessKey:    cfg.S3AccessKey,
+		SecretKey:    cfg.S3SecretKey,
+		UsePathStyle: cfg.S3UsePathStyle,
+		BaseURL:      strings.TrimRight(cfg.PublicBaseURL, "/"),
+		HTTPClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// Name returns the storage provider name
+func (s *S3FileStorage) Name() string {
+	return "s3"
+}
+
+// Put uploads the file to the bucket
+func (s *S3FileStorage) Put(key, contentType string, data []byte) (string, error) {
+	objectURL, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("PUT", objectURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.signRequest(req, data, time.Now().UTC())
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload to storage: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("storage returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if s.BaseURL != "" {
+		return s.BaseURL + "/" + key, nil
+	}
+	return objectURL.String(), nil
+}
+
+// Get downloads a file from the bucket
+func (s *S3FileStorage) Get(key string) ([]byte, error) {
+	objectURL, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", objectURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	s.signRequest(req, nil, time.Now().UTC())
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download from storage: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("storage returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return data, nil
+}
+
+// Delete removes a file from the bucket
+func (s *S3FileStorage) Delete(key string) error {
+	objectURL, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("DELETE", objectURL.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	s.signRequest(req, nil, time.Now().UTC())
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete from storage: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("storage returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// PresignURL returns a URL signed with AWS Signature Version 4 query
+// parameters, letting a client GET or PUT an object until it expires
+func (s *S3FileStorage) PresignURL(method, key string, expires time.Duration) (string, error) {
+	return s.presignURL(method, key, expires, time.Now().UTC())
+}
+
+func (s *S3FileStorage) presignURL(method, key string, expires time.Duration, now time.Time) (string, error) {
+	objectURL, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + s.Region + "/s3/aws4_request"
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	// Encode sorts by key, as the canonical query string requires
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		objectURL.EscapedPath(),
+		canonicalQuery,
+		"host:" + objectURL.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	signature := hex.EncodeToString(hmacSHA256(s.signingKey(now.Format("20060102")), stringToSign))
+
+	objectURL.RawQuery = canonicalQuery + "&X-Amz-Signature=" + signature
+	return objectURL.String(), nil
+}
+
+// objectURL builds the path-style or virtual-hosted-style URL of an object
+func (s *S3FileStorage) objectURL(key string) (*url.URL, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage endpoint: %w", err)
+	}
+	if s.UsePathStyle {
+		endpoint.Path = "/" + s.Bucket + "/" + key
+	} else {
+		endpoint.Host = s.Bucket + "." + endpoint.Host
+		endpoint.Path = "/" + key
+	}
+	return endpoint, nil
+}
+
+// signRequest adds AWS Signature Version 4 headers to the request
+func (s *S3FileStorage) signRequest(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		signedHeaders = "content-type;" + signedHeaders
+		canonicalHeaders = "content-type:" + contentType + "\n" + canonicalHeaders
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := dateStamp + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signature := hex.EncodeToString(hmacSHA256(s.signingKey(dateStamp), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+// signingKey derives the Signature Version 4 key for a date
+func (s *S3FileStorage) signingKey(dateStamp string) []byte {
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), dateStamp)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	return hmacSHA256(key, "aws4_request")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
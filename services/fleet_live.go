@@ -0,0 +1,164 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// fleetClusterPixels is the on-screen size of a cluster cell at the requested
+// zoom, in 256 pixel web map tiles
+const fleetClusterPixels = 60
+
+// FleetPosition is the latest known position of one of a carrier's active trips
+type FleetPosition struct {
+	TripID           uint       `json:"trip_id"`
+	VehicleID        uint       `json:"vehicle_id"`
+	Status           string     `json:"status"`
+	OriginCity       string     `json:"origin_city"`
+	DestinationCity  string     `json:"destination_city"`
+	EstimatedArrival time.Time  `json:"estimated_arrival"`
+	Latitude         *float64   `json:"latitude"` // nil until the trip reports a location
+	Longitude        *float64   `json:"longitude"`
+	Speed            *float64   `json:"speed,omitempty"`
+	Heading          *float64   `json:"heading,omitempty"`
+	Source           string     `json:"source,omitempty"`
+	Timestamp        *time.Time `json:"timestamp"`
+}
+
+// FleetCluster groups fleet positions that would overlap on the map
+type FleetCluster struct {
+	Latitude  float64 `json:"latitude"` // centroid of the grouped positions
+	Longitude float64 `json:"longitude"`
+	Count     int     `json:"count"`
+	TripIDs   []uint  `json:"trip_ids"`
+	// Bounds of the grouped positions, for zooming into the cluster
+	MinLatitude  float64 `json:"min_latitude"`
+	MinLongitude float64 `json:"min_longitude"`
+	MaxLatitude  float64 `json:"max_latitude"`
+	MaxLongitude float64 `json:"max_longitude"`
+}
+
+// FleetLiveMap is the live position of a carrier's fleet. When clustered,
+// positions close to each other are replaced by clusters.
+type FleetLiveMap struct {
+	CarrierID   uint            `json:"carrier_id"`
+	ActiveTrips int             `json:"active_trips"`
+	Located     int             `json:"located"` // trips with a known position
+	Clustered   bool            `json:"clustered"`
+	Zoom        int             `json:"zoom,omitempty"`
+	Positions   []FleetPosition `json:"positions"`
+	Clusters    []FleetCluster  `json:"clusters"`
+	GeneratedAt time.Time       `json:"generated_at"`
+}
+
+// GetFleetLiveMap returns the latest position of every active trip of a
+// carrier, reading the latest tracking record per trip in a single query.
+// With cluster set, positions that would overlap at the map zoom are grouped.
+func (ts *TrackingService) GetFleetLiveMap(carrierID uint, cluster bool, zoom int) (*FleetLiveMap, error) {
+	active := []string{"ACTIVE", "IN_TRANSIT"}
+
+	var positions []FleetPosition
+	err := ts.db.Raw(`
+		SELECT t.id AS trip_id, t.vehicle_id, t.status, t.origin_city, t.destination_city, t.estimated_arrival,
+			r.latitude, r.longitude, r.speed, r.heading, r.source, r.timestamp
+		FROM trips t
+		LEFT JOIN (
+			SELECT trip_id, latitude, longitude, speed, heading, source, timestamp,
+				ROW_NUMBER() OVER (PARTITION BY trip_id ORDER BY timestamp DESC, id DESC) AS position_rank
+			FROM tracking_records
+			WHERE trip_id IN (SELECT id FROM trips WHERE user_id = ? AND status IN ?)
+		) r ON r.trip_id = t.id AND r.position_rank = 1
+		WHERE t.user_id = ? AND t.status IN ?
+		ORDER BY t.id`,
+		carrierID, active, carrierID, active).
+		Scan(&positions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fleet positions: %w", err)
+	}
+
+	fleet := &FleetLiveMap{
+		CarrierID:   carrierID,
+		ActiveTrips: len(positions),
+		Positions:   positions,
+		Clusters:    []FleetCluster{},
+		GeneratedAt: time.Now(),
+	}
+	for _, position := range positions {
+		if position.Latitude != nil && position.Longitude != nil {
+			fleet.Located++
+		}
+	}
+	if fleet.Positions == nil {
+		fleet.Positions = []FleetPosition{}
+	}
+
+	if cluster {
+		fleet.Clustered = true
+		fleet.Zoom = zoom
+		fleet.Positions, fleet.Clusters = clusterFleetPositions(positions, zoom)
+	}
+	return fleet, nil
+}
+
+// clusterFleetPositions groups located positions falling in the same grid
+// cell at the map zoom. Cells with a single position, and trips without a
+// position, stay individual positions.
+func clusterFleetPositions(positions []FleetPosition, zoom int) ([]FleetPosition, []FleetCluster) {
+	// Degrees covered by the cluster cell, using the web map convention of
+	// 256 pixel tiles spanning 360 degrees at zoom 0
+	cellSize := 360 / (256 * math.Pow(2, float64(zoom))) * fleetClusterPixels
+
+	type cell struct{ row, column int }
+	cells := make(map[cell][]FleetPosition)
+	var order []cell
+	single := []FleetPosition{}
+
+	for _, position := range positions {
+		if position.Latitude == nil || position.Longitude == nil {
+			single = append(single, position)
+			continue
+		}
+		key := cell{
+			row:    int(math.Floor(*position.Latitude / cellSize)),
+			column: int(math.Floor(*position.Longitude / cellSize)),
+		}
+		if _, ok := cells[key]; !ok {
+			order = append(order, key)
+		}
+		cells[key] = append(cells[key], position)
+	}
+
+	clusters := []FleetCluster{}
+	for _, key := range order {
+		members := cells[key]
+		if len(members) == 1 {
+			single = append(single, members[0])
+			continue
+		}
+
+		cluster := FleetCluster{
+			Count:        len(members),
+			MinLatitude:  *members[0].Latitude,
+			MinLongitude: *members[0].Longitude,
+			MaxLatitude:  *members[0].Latitude,
+			MaxLongitude: *members[0].Longitude,
+		}
+		for _, member := range members {
+			cluster.Latitude += *member.Latitude
+			cluster.Longitude += *member.Longitude
+			cluster.TripIDs = append(cluster.TripIDs, member.TripID)
+			cluster.MinLatitude = math.Min(cluster.MinLatitude, *member.Latitude)
+			cluster.MinLongitude = math.Min(cluster.MinLongitude, *member.Longitude)
+			cluster.MaxLatitude = math.Max(cluster.MaxLatitude, *member.Latitude)
+			cluster.MaxLongitude = math.Max(cluster.MaxLongitude, *member.Longitude)
+		}
+		cluster.Latitude /= float64(len(members))
+		cluster.Longitude /= float64(len(members))
+		clusters = append(clusters, cluster)
+	}
+
+	sort.Slice(single, func(i, j int) bool { return single[i].TripID < single[j].TripID })
+	return single, clusters
+}
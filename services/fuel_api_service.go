@@ -6,9 +6,9 @@ import (
 	"io"
 	"math"
 	"net/http"
-	"net/url"
-	"os"
 	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/geo"
 )
 
 // Fuel Price API Service Implementation
@@ -21,7 +21,7 @@ type FuelAPIService struct {
 
 func NewFuelAPIService() *FuelAPIService {
 	return &FuelAPIService{
-		APIKey:  os.Getenv("GASBUDDY_API_KEY"), // Or other fuel price API
+		APIKey:  config.GetAPIKeysConfig().GasBuddy, // Or other fuel price API
 		BaseURL: "https://api.gasbuddy.com/v3",
 		HTTPClient: &http.Client{
 			Timeout: 10 * time.Second,
@@ -83,10 +83,7 @@ func (f *FuelAPIService) GetFuelPrices(location Coordinate, radius float64) (*Fu
 		updatedAt, _ := time.Parse(time.RFC3339, station.UpdatedAt)
 		
 		// Calculate distance from reference point
-		distance := calculateDistanceBetweenCoordinates(
-			location,
-			Coordinate{Latitude: station.Location.Lat, Longitude: station.Location.Lng},
-		)
+		distance := geo.Distance(location.Latitude, location.Longitude, station.Location.Lat, station.Location.Lng)
 
 		fuelStation := FuelStation{
 			StationID:    station.ID,
@@ -295,20 +292,3 @@ func (f *FuelAPIService) removeDuplicateStations(stations []FuelStation) []FuelS
 
 	return unique
 }
-
-func calculateDistanceBetweenCoordinates(coord1, coord2 Coordinate) float64 {
-	// Haversine formula for calculating distance between two coordinates
-	const R = 6371 // Earth's radius in km
-
-	lat1 := coord1.Latitude * math.Pi / 180
-	lat2 := coord2.Latitude * math.Pi / 180
-	deltaLat := (coord2.Latitude - coord1.Latitude) * math.Pi / 180
-	deltaLng := (coord2.Longitude - coord1.Longitude) * math.Pi / 180
-
-	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
-		math.Cos(lat1)*math.Cos(lat2)*
-			math.Sin(deltaLng/2)*math.Sin(deltaLng/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-
-	return R * c
-}
\ No newline at end of file
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Errors returned when planning fuel stops
+var (
+	ErrFuelPlanNotFound = errors.New("trip has no fuel plan")
+	ErrNoTripRoute      = errors.New("trip has no planned route, give a polyline")
+	// The fuel price API failed
+	ErrFuelPricesUnavailable = errors.New("fuel prices are not available")
+	// The route can't be driven on the tank range with the stations found
+	// along it
+	ErrFuelPlanUnreachable = errors.New("no fuel stations within range to complete the route")
+)
+
+// FuelPlanRequest describes the route and vehicle to plan fuel stops for
+type FuelPlanRequest struct {
+	// Encoded polyline of the route, the trip's planned route when empty
+	Polyline    string  `json:"polyline,omitempty"`
+	TankRangeKm float64 `json:"tank_range_km" validate:"gt=0"` // on a full tank
+	// Range on the fuel in the tank at departure, a full tank when nil
+	StartRangeKm *float64 `json:"start_range_km,omitempty" validate:"omitempty,gte=0"`
+	// Range never planned to be used, the configured reserve when nil
+	ReserveKm *float64 `json:"reserve_km,omitempty" validate:"omitempty,gte=0"`
+	// Litres per 100 km, estimated from the trip's vehicle and payload when nil
+	ConsumptionPer100Km *float64 `json:"consumption_per_100km,omitempty" validate:"omitempty,gt=0"`
+}
+
+// FuelPlanService plans where trips refuel along their routes
+type FuelPlanService struct {
+	db        *gorm.DB
+	fuel      FuelPriceAPIService
+	cfg       *config.FuelPlanConfig
+	emissions *EmissionsService
+	now       func() time.Time
+}
+
+// NewFuelPlanService creates a new FuelPlanService
+func NewFuelPlanService(db *gorm.DB, fuel FuelPriceAPIService, cfg *config.FuelPlanConfig, emissionsConfig *config.EmissionsConfig) *FuelPlanService {
+	return &FuelPlanService{
+		db:        db,
+		fuel:      fuel,
+		cfg:       cfg,
+		emissions: NewEmissionsService(db, emissionsConfig),
+		now:       time.Now,
+	}
+}
+
+// fuelCandidate is a station near the route
+type fuelCandidate struct {
+	station  FuelStation
+	routeKm  float64 // along the route where it turns off to the station
+	offsetKm float64 // from the route to the station
+}
+
+// PlanTrip plans the fuel stops of a trip's route and attaches the plan to
+// the trip, replacing the one planned before
+func (s *FuelPlanService) PlanTrip(tripID uint, req FuelPlanRequest) (*models.TripFuelPlan, error) {
+	var trip models.Trip
+	if err := s.db.First(&trip, tripID).Error; err != nil {
+		return nil, errors.New("trip not found")
+	}
+
+	if req.TankRangeKm <= 0 {
+		return nil, errors.New("tank_range_km must be positive")
+	}
+	reserveKm := s.cfg.ReserveKm
+	if req.ReserveKm != nil {
+		reserveKm = *req.ReserveKm
+	}
+	if reserveKm < 0 || reserveKm >= req.TankRangeKm {
+		return nil, errors.New("reserve_km must be at least 0 and less than tank_range_km")
+	}
+	startRangeKm := req.TankRangeKm
+	if req.StartRangeKm != nil {
+		startRangeKm = *req.StartRangeKm
+	}
+	if startRangeKm < 0 || startRangeKm > req.TankRangeKm {
+		return nil, errors.New("start_range_km must be between 0 and tank_range_km")
+	}
+
+	consumption := 0.0
+	if req.ConsumptionPer100Km != nil {
+		consumption = *req.ConsumptionPer100Km
+		if consumption <= 0 {
+			return nil, errors.New("consumption_per_100km must be positive")
+		}
+	} else {
+		_, _, litresPer100Km, err := s.emissions.tripConsumption(&trip)
+		if err != nil {
+			return nil, err
+		}
+		consumption = litresPer100Km
+	}
+
+	encoded := req.Polyline
+	if encoded == "" {
+		encoded = trip.PlannedRoutePolyline
+	}
+	if encoded == "" {
+		return nil, ErrNoTripRoute
+	}
+	route, err := DecodePolyline(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(route) < 2 {
+		return nil, errors.New("route must have at least two points")
+	}
+	cumulative := routeDistances(route)
+	routeKm := cumulative[len(cumulative)-1]
+
+	plan := &models.TripFuelPlan{
+		TripID:              trip.ID,
+		RouteDistanceKm:     routeKm,
+		TankRangeKm:         req.TankRangeKm,
+		StartRangeKm:        startRangeKm,
+		ReserveKm:           reserveKm,
+		ConsumptionPer100Km: consumption,
+		PlannedAt:           s.now(),
+	}
+	if startRangeKm-reserveKm < routeKm {
+		stations, err := s.fuel.GetFuelPricesAlongRoute(sampleRoute(route, cumulative, s.cfg.SampleIntervalKm))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrFuelPricesUnavailable, err)
+		}
+		plan.Stops, err = planFuelStops(s.candidates(route, cumulative, stations), routeKm,
+			req.TankRangeKm-reserveKm, startRangeKm-reserveKm, consumption)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, stop := range plan.Stops {
+		plan.TotalLitres += stop.Litres
+		plan.TotalCost += stop.Cost
+		plan.DetourKm += stop.DetourKm
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var previous []uint
+		if err := tx.Model(&models.TripFuelPlan{}).Where("trip_id = ?", trip.ID).Pluck("id", &previous).Error; err != nil {
+			return err
+		}
+		if len(previous) > 0 {
+			if err := tx.Where("plan_id IN ?", previous).Delete(&models.TripFuelStop{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", previous).Delete(&models.TripFuelPlan{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(plan).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save fuel plan: %w", err)
+	}
+	return plan, nil
+}
+
+// GetTripPlan returns the fuel plan attached to a trip
+func (s *FuelPlanService) GetTripPlan(tripID uint) (*models.TripFuelPlan, error) {
+	var plan models.TripFuelPlan
+	err := s.db.Preload("Stops", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sequence ASC")
+	}).Where("trip_id = ?", tripID).First(&plan).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFuelPlanNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fuel plan: %w", err)
+	}
+	return &plan, nil
+}
+
+// candidates returns the open stations selling diesel within the maximum
+// detour of the route, in the order the route passes them
+func (s *FuelPlanService) candidates(route []Coordinate, cumulative []float64, stations []FuelStation) []fuelCandidate {
+	var candidates []fuelCandidate
+	for _, station := range stations {
+		if !station.IsOpen || station.DieselPrice <= 0 {
+			continue
+		}
+		offsetMeters, progress := ProjectOntoPath(route, station.Location)
+		if offsetMeters/1000 > s.cfg.MaxDetourKm {
+			continue
+		}
+		candidates = append(candidates, fuelCandidate{
+			station:  station,
+			routeKm:  progress * cumulative[len(cumulative)-1],
+			offsetKm: offsetMeters / 1000,
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].routeKm < candidates[j].routeKm
+	})
+	return candidates
+}
+
+// planFuelStops picks where to refuel and how much, with the greedy plan that
+// is cheapest when fuel can be bought in any amount: at each station, buy
+// just enough to reach the next cheaper station within a tank's range, or
+// the destination, and otherwise fill up and go on to the cheapest station
+// within range. Ranges are in km after the reserve; the detour to a station
+// and back onto the route is driven on the fuel in the tank.
+func planFuelStops(candidates []fuelCandidate, routeKm, capacityKm, startKm, consumption float64) ([]models.TripFuelStop, error) {
+	// Distance from candidate i, or the start when -1, to candidate j, or the
+	// destination when len(candidates)
+	distance := func(i, j int) float64 {
+		from, to := 0.0, routeKm
+		km := 0.0
+		if i >= 0 {
+			from = candidates[i].routeKm
+			km += candidates[i].offsetKm
+		}
+		if j < len(candidates) {
+			to = candidates[j].routeKm
+			km += candidates[j].offsetKm
+		}
+		return km + to - from
+	}
+	price := func(i int) float64 {
+		if i < 0 {
+			return math.Inf(1)
+		}
+		return candidates[i].station.DieselPrice
+	}
+
+	var stops []models.TripFuelStop
+	buy := func(i int, km float64) {
+		if km <= 0 {
+			return
+		}
+		candidate := candidates[i]
+		litres := km / 100 * consumption
+		stops = append(stops, models.TripFuelStop{
+			Sequence:      len(stops) + 1,
+			StationID:     candidate.station.StationID,
+			Name:          candidate.station.Name,
+			Brand:         candidate.station.Brand,
+			Address:       candidate.station.Address,
+			Latitude:      candidate.station.Location.Latitude,
+			Longitude:     candidate.station.Location.Longitude,
+			RouteKm:       candidate.routeKm,
+			DetourKm:      2 * candidate.offsetKm,
+			PricePerLitre: candidate.station.DieselPrice,
+			Litres:        litres,
+			Cost:          litres * candidate.station.DieselPrice,
+		})
+	}
+
+	destination := len(candidates)
+	current, fuelKm := -1, startKm
+	for {
+		if current < 0 && distance(current, destination) <= fuelKm {
+			return stops, nil
+		}
+
+		// Fuel can't be bought before the first station
+		reach := capacityKm
+		if current < 0 {
+			reach = fuelKm
+		}
+
+		next := -1
+		for j := current + 1; j < destination && distance(current, j) <= reach; j++ {
+			if price(j) < price(current) {
+				next = j
+				break
+			}
+		}
+		if next >= 0 {
+			buy(current, distance(current, next)-fuelKm)
+			fuelKm = math.Max(fuelKm, distance(current, next)) - distance(current, next)
+			current = next
+			continue
+		}
+		if distance(current, destination) <= reach {
+			buy(current, distance(current, destination)-fuelKm)
+			return stops, nil
+		}
+
+		cheapest := -1
+		for j := current + 1; j < destination && distance(current, j) <= reach; j++ {
+			if cheapest < 0 || price(j) < price(cheapest) {
+				cheapest = j
+			}
+		}
+		if cheapest < 0 {
+			return nil, ErrFuelPlanUnreachable
+		}
+		if current >= 0 {
+			buy(current, capacityKm-fuelKm)
+			fuelKm = capacityKm
+		}
+		fuelKm -= distance(current, cheapest)
+		current = cheapest
+	}
+}
@@ -0,0 +1,354 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrNoGeocoder is returned when an address isn't cached and no geocoding
+// provider is configured
+var ErrNoGeocoder = errors.New("no geocoding provider is configured")
+
+// AddressGeocoder resolves addresses to coordinates
+type AddressGeocoder interface {
+	GeocodeAddress(address string) (*GeocodeResult, error)
+}
+
+// BatchGeocoder geocodes many addresses at once
+type BatchGeocoder interface {
+	BatchGeocode(addresses []string) []BatchGeocodeResult
+}
+
+// DefaultAddressGeocoder returns the geocoder of the configured mapping
+// provider, or nil when none is configured
+func DefaultAddressGeocoder() AddressGeocoder {
+	if config.GetAPIKeysConfig().GoogleMaps != "" {
+		return NewGoogleMapsService()
+	}
+	return nil
+}
+
+// BatchGeocodeResult is the geocoding of one address of a batch
+type BatchGeocodeResult struct {
+	Address string         `json:"address"`
+	Result  *GeocodeResult `json:"result,omitempty"`
+	Cached  bool           `json:"cached"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// GeocodingCache geocodes addresses through a provider, storing the results
+// in the database so each address is only sent to the provider once per
+// cache TTL. Addresses the provider has no result for are cached for a
+// shorter time.
+type GeocodingCache struct {
+	db       *gorm.DB
+	geocoder AddressGeocoder
+	cfg      *config.GeocodingConfig
+}
+
+// NewGeocodingCache creates a geocoding cache in front of a geocoder. With no
+// geocoder only cached addresses are geocoded.
+func NewGeocodingCache(db *gorm.DB, geocoder AddressGeocoder, cfg *config.GeocodingConfig) *GeocodingCache {
+	return &GeocodingCache{
+		db:       db,
+		geocoder: geocoder,
+		cfg:      cfg,
+	}
+}
+
+// GeocodeAddress returns the cached geocoding of an address, geocoding it
+// when it isn't cached or has expired
+func (gc *GeocodingCache) GeocodeAddress(address string) (*GeocodeResult, error) {
+	key := NormalizeAddress(address)
+	if key == "" {
+		return nil, errors.New("address is required")
+	}
+
+	var entry models.GeocodedAddress
+	if err := gc.db.Where("address_key = ? AND expires_at > ?", key, time.Now()).First(&entry).Error; err == nil {
+		gc.db.Model(&entry).UpdateColumn("hits", gorm.Expr("hits + ?", 1))
+		return cachedGeocodeResult(&entry)
+	}
+
+	return gc.geocode(key, address)
+}
+
+// BatchGeocode geocodes addresses in the order given. Cached addresses are
+// read in one query, and the rest are sent to the provider a few at a time,
+// each distinct address once.
+func (gc *GeocodingCache) BatchGeocode(addresses []string) []BatchGeocodeResult {
+	results := make([]BatchGeocodeResult, len(addresses))
+	keys := make([]string, len(addresses))
+	pending := make(map[string]string) // key to the address sent to the provider
+	for i, address := range addresses {
+		results[i].Address = address
+		keys[i] = NormalizeAddress(address)
+		if keys[i] == "" {
+			results[i].Error = "address is required"
+			continue
+		}
+		if _, ok := pending[keys[i]]; !ok {
+			pending[keys[i]] = address
+		}
+	}
+
+	resolved := make(map[string]BatchGeocodeResult, len(pending))
+	if len(pending) > 0 {
+		lookup := make([]string, 0, len(pending))
+		for key := range pending {
+			lookup = append(lookup, key)
+		}
+		var entries []models.GeocodedAddress
+		gc.db.Where("address_key IN ? AND expires_at > ?", lookup, time.Now()).Find(&entries)
+		for i := range entries {
+			result, err := cachedGeocodeResult(&entries[i])
+			resolved[entries[i].AddressKey] = batchResult(entries[i].Address, result, err, true)
+			delete(pending, entries[i].AddressKey)
+		}
+		if len(entries) > 0 {
+			ids := make([]uint, len(entries))
+			for i, entry := range entries {
+				ids[i] = entry.ID
+			}
+			gc.db.Model(&models.GeocodedAddress{}).Where("id IN ?", ids).UpdateColumn("hits", gorm.Expr("hits + ?", 1))
+		}
+	}
+
+	// Geocode the rest concurrently, bounded by the batch concurrency
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, gc.cfg.BatchConcurrency)
+	for key, address := range pending {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(key, address string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			result, err := gc.geocode(key, address)
+			mu.Lock()
+			resolved[key] = batchResult(address, result, err, false)
+			mu.Unlock()
+		}(key, address)
+	}
+	wg.Wait()
+
+	for i, key := range keys {
+		if key == "" {
+			continue
+		}
+		resolved := resolved[key]
+		results[i].Result = resolved.Result
+		results[i].Cached = resolved.Cached
+		results[i].Error = resolved.Error
+	}
+	return results
+}
+
+// geocode sends an address to the provider and caches the result
+func (gc *GeocodingCache) geocode(key, address string) (*GeocodeResult, error) {
+	if gc.geocoder == nil {
+		return nil, ErrNoGeocoder
+	}
+
+	result, err := gc.geocoder.GeocodeAddress(address)
+	entry := models.GeocodedAddress{AddressKey: key, Address: address}
+	if err == nil && result != nil {
+		payload, marshalErr := json.Marshal(result)
+		if marshalErr != nil {
+			return result, nil
+		}
+		entry.Found = true
+		entry.Lat = result.Geometry.Location.Latitude
+		entry.Lng = result.Geometry.Location.Longitude
+		entry.Result = string(payload)
+		entry.ExpiresAt = time.Now().Add(gc.cfg.CacheTTL)
+	} else {
+		if err == nil {
+			err = errors.New("no geocoding results found")
+		}
+		if gc.cfg.FailureCacheTTL == 0 {
+			return nil, err
+		}
+		entry.ExpiresAt = time.Now().Add(gc.cfg.FailureCacheTTL)
+	}
+
+	// Replace an expired entry, keeping its hit count
+	var existing models.GeocodedAddress
+	if gc.db.Where("address_key = ?", key).First(&existing).Error == nil {
+		entry.ID = existing.ID
+		entry.CreatedAt = existing.CreatedAt
+		entry.Hits = existing.Hits
+	}
+	if saveErr := gc.db.Save(&entry).Error; saveErr != nil {
+		log.Printf("Failed to cache geocoding of %q: %v", address, saveErr)
+	}
+
+	if !entry.Found {
+		return nil, err
+	}
+	return result, nil
+}
+
+// cachedGeocodeResult returns the result stored in a cache entry
+func cachedGeocodeResult(entry *models.GeocodedAddress) (*GeocodeResult, error) {
+	if !entry.Found {
+		return nil, errors.New("no geocoding results found")
+	}
+	var result GeocodeResult
+	if err := json.Unmarshal([]byte(entry.Result), &result); err != nil {
+		// Fall back to the coordinates if the stored result is unreadable
+		result = GeocodeResult{Address: entry.Address}
+		result.Geometry.Location = Coordinate{Latitude: entry.Lat, Longitude: entry.Lng}
+	}
+	return &result, nil
+}
+
+// batchResult builds the result of an address of a batch
+func batchResult(address string, result *GeocodeResult, err error, cached bool) BatchGeocodeResult {
+	batch := BatchGeocodeResult{Address: address, Result: result, Cached: cached}
+	if err != nil {
+		batch.Error = err.Error()
+	}
+	return batch
+}
+
+// NormalizeAddress returns the cache key of an address: lower case, with
+// runs of spaces collapsed and the spaces around commas removed
+func NormalizeAddress(address string) string {
+	parts := strings.Split(strings.ToLower(address), ",")
+	normalized := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.Join(strings.Fields(part), " "); part != "" {
+			normalized = append(normalized, part)
+		}
+	}
+	return strings.Join(normalized, ",")
+}
+
+// geocodeAll geocodes distinct addresses, in one batch when the geocoder
+// supports it. Addresses that couldn't be geocoded map to their error.
+func geocodeAll(geocoder AddressGeocoder, addresses []string) map[string]BatchGeocodeResult {
+	results := make(map[string]BatchGeocodeResult, len(addresses))
+	if batcher, ok := geocoder.(BatchGeocoder); ok {
+		for _, result := range batcher.BatchGeocode(addresses) {
+			results[result.Address] = result
+		}
+		return results
+	}
+	for _, address := range addresses {
+		if _, done := results[address]; done {
+			continue
+		}
+		if geocoder == nil {
+			results[address] = batchResult(address, nil, ErrNoGeocoder, false)
+			continue
+		}
+		result, err := geocoder.GeocodeAddress(address)
+		results[address] = batchResult(address, result, err, false)
+	}
+	return results
+}
+
+// geocodePlace is an address of a load or trip and the fields its geocoding
+// fills in
+type geocodePlace struct {
+	name                          string
+	address, city, state, country *string
+	lat, lng                      *float64
+}
+
+// loadPlaces returns the pickup and delivery of a load
+func loadPlaces(load *models.Load) []geocodePlace {
+	return []geocodePlace{
+		{"pickup", &load.PickupAddress, &load.PickupCity, &load.PickupState, &load.PickupCountry, &load.PickupLat, &load.PickupLng},
+		{"delivery", &load.DeliveryAddress, &load.DeliveryCity, &load.DeliveryState, &load.DeliveryCountry, &load.DeliveryLat, &load.DeliveryLng},
+	}
+}
+
+// tripPlaces returns the origin and destination of a trip
+func tripPlaces(trip *models.Trip) []geocodePlace {
+	return []geocodePlace{
+		{"origin", &trip.OriginAddress, &trip.OriginCity, &trip.OriginState, &trip.OriginCountry, &trip.OriginLat, &trip.OriginLng},
+		{"destination", &trip.DestinationAddress, &trip.DestinationCity, &trip.DestinationState, &trip.DestinationCountry, &trip.DestinationLat, &trip.DestinationLng},
+	}
+}
+
+// needsGeocoding reports whether a place has an address but no coordinates
+func (p geocodePlace) needsGeocoding() bool {
+	return *p.address != "" && *p.lat == 0 && *p.lng == 0
+}
+
+// query returns the address sent to the geocoder
+func (p geocodePlace) query() string {
+	return joinNonEmpty(*p.address, *p.city, *p.state, *p.country)
+}
+
+// apply sets the coordinates of a place, and its city and country when
+// missing, from a geocoding result
+func (p geocodePlace) apply(result *GeocodeResult) {
+	*p.lat = result.Geometry.Location.Latitude
+	*p.lng = result.Geometry.Location.Longitude
+	for _, component := range result.AddressComponents {
+		for _, componentType := range component.Types {
+			switch {
+			case componentType == "locality" && *p.city == "":
+				*p.city = component.LongName
+			case componentType == "country" && *p.country == "":
+				*p.country = component.ShortName
+			}
+		}
+	}
+}
+
+// geocodePlaces geocodes the places without coordinates, returning the
+// error of the first that couldn't be geocoded. Places are left without
+// coordinates when no geocoding provider is configured.
+func geocodePlaces(geocoder AddressGeocoder, places []geocodePlace) error {
+	var queries []string
+	for _, place := range places {
+		if place.needsGeocoding() {
+			queries = append(queries, place.query())
+		}
+	}
+	if len(queries) == 0 {
+		return nil
+	}
+
+	results := geocodeAll(geocoder, queries)
+	var firstErr error
+	for _, place := range places {
+		if !place.needsGeocoding() {
+			continue
+		}
+		result := results[place.query()]
+		if result.Result == nil {
+			if firstErr == nil && result.Error != ErrNoGeocoder.Error() {
+				firstErr = fmt.Errorf("%s address could not be geocoded: %s", place.name, result.Error)
+			}
+			continue
+		}
+		place.apply(result.Result)
+	}
+	return firstErr
+}
+
+// GeocodeLoad sets the coordinates of a load's pickup and delivery addresses
+// that were given without them
+func GeocodeLoad(geocoder AddressGeocoder, load *models.Load) error {
+	return geocodePlaces(geocoder, loadPlaces(load))
+}
+
+// GeocodeTrip sets the coordinates of a trip's origin and destination
+// addresses that were given without them
+func GeocodeTrip(geocoder AddressGeocoder, trip *models.Trip) error {
+	return geocodePlaces(geocoder, tripPlaces(trip))
+}
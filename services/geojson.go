@@ -0,0 +1,113 @@
+package services
+
+import (
+	"time"
+	"triplink/backend/models"
+)
+
+// GeoJSONContentType is the media type of GeoJSON responses
+const GeoJSONContentType = "application/geo+json"
+
+// GeoJSONGeometry is a GeoJSON geometry. Positions are [longitude, latitude].
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"` // Point, LineString
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// GeoJSONFeature is a GeoJSON feature
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   *GeoJSONGeometry       `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONFeatureCollection is a GeoJSON feature collection. Metadata such as
+// pagination is added as foreign members next to the features.
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// NewGeoJSONFeatureCollection returns a collection of features, never null
+func NewGeoJSONFeatureCollection(features []GeoJSONFeature) *GeoJSONFeatureCollection {
+	if features == nil {
+		features = []GeoJSONFeature{}
+	}
+	return &GeoJSONFeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+// geoJSONPoint returns a Point feature
+func geoJSONPoint(latitude, longitude float64, properties map[string]interface{}) GeoJSONFeature {
+	return GeoJSONFeature{
+		Type:       "Feature",
+		Geometry:   &GeoJSONGeometry{Type: "Point", Coordinates: []float64{longitude, latitude}},
+		Properties: properties,
+	}
+}
+
+// TrackingHistoryGeoJSON returns a trip's tracking records as a LineString
+// of the path driven, in the order given. The time of each position is in
+// the coordTimes property, as read by Mapbox and Leaflet GPX/KML plugins. A
+// single record gives a Point, and no records an empty collection.
+func TrackingHistoryGeoJSON(tripID uint, records []models.TrackingRecord) *GeoJSONFeatureCollection {
+	if len(records) == 0 {
+		return NewGeoJSONFeatureCollection(nil)
+	}
+
+	coordinates := make([][]float64, 0, len(records))
+	times := make([]time.Time, 0, len(records))
+	for _, record := range records {
+		coordinates = append(coordinates, []float64{record.Longitude, record.Latitude})
+		times = append(times, record.Timestamp)
+	}
+
+	properties := map[string]interface{}{
+		"trip_id":     tripID,
+		"start_time":  times[0],
+		"end_time":    times[len(times)-1],
+		"point_count": len(records),
+		"coordTimes":  times,
+	}
+	if len(records) == 1 {
+		return NewGeoJSONFeatureCollection([]GeoJSONFeature{geoJSONPoint(records[0].Latitude, records[0].Longitude, properties)})
+	}
+
+	return NewGeoJSONFeatureCollection([]GeoJSONFeature{{
+		Type:       "Feature",
+		Geometry:   &GeoJSONGeometry{Type: "LineString", Coordinates: coordinates},
+		Properties: properties,
+	}})
+}
+
+// FleetLiveGeoJSON returns the positions of a fleet map as Points. Clusters
+// are Points too, with cluster set and point_count as in Mapbox clustering.
+// Trips that haven't reported a location yet are left out.
+func FleetLiveGeoJSON(fleet *FleetLiveMap) *GeoJSONFeatureCollection {
+	features := make([]GeoJSONFeature, 0, len(fleet.Positions)+len(fleet.Clusters))
+	for _, position := range fleet.Positions {
+		if position.Latitude == nil || position.Longitude == nil {
+			continue
+		}
+		features = append(features, geoJSONPoint(*position.Latitude, *position.Longitude, map[string]interface{}{
+			"trip_id":           position.TripID,
+			"vehicle_id":        position.VehicleID,
+			"status":            position.Status,
+			"origin_city":       position.OriginCity,
+			"destination_city":  position.DestinationCity,
+			"estimated_arrival": position.EstimatedArrival,
+			"speed":             position.Speed,
+			"heading":           position.Heading,
+			"source":            position.Source,
+			"timestamp":         position.Timestamp,
+		}))
+	}
+	for _, cluster := range fleet.Clusters {
+		features = append(features, geoJSONPoint(cluster.Latitude, cluster.Longitude, map[string]interface{}{
+			"cluster":     true,
+			"point_count": cluster.Count,
+			"trip_ids":    cluster.TripIDs,
+			"bbox":        []float64{cluster.MinLongitude, cluster.MinLatitude, cluster.MaxLongitude, cluster.MaxLatitude},
+		}))
+	}
+	return NewGeoJSONFeatureCollection(features)
+}
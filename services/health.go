@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Health statuses of components and of the instance
+const (
+	HealthUp       = "UP"
+	HealthDegraded = "DEGRADED" // a non-critical component is down
+	HealthDown     = "DOWN"
+)
+
+// HealthCheck checks a dependency the API relies on. Critical dependencies
+// make the instance unready while they are down; the others only degrade it.
+type HealthCheck struct {
+	Name     string
+	Critical bool
+	Check    func(ctx context.Context) error
+}
+
+// ComponentHealth is the outcome of a health check
+type ComponentHealth struct {
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// HealthReport is the health of the instance and of the components checked
+type HealthReport struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components"`
+	CheckedAt  time.Time                  `json:"checked_at"`
+}
+
+// HealthService runs the health checks behind the probe endpoints
+type HealthService struct {
+	timeout   time.Duration
+	startedAt time.Time
+
+	mu     sync.RWMutex
+	checks []HealthCheck
+}
+
+// NewHealthService creates a health service abandoning each check after timeout
+func NewHealthService(timeout time.Duration) *HealthService {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &HealthService{timeout: timeout, startedAt: time.Now()}
+}
+
+// Register adds a health check
+func (s *HealthService) Register(check HealthCheck) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks = append(s.checks, check)
+}
+
+// Uptime returns how long the instance has been running
+func (s *HealthService) Uptime() time.Duration {
+	return time.Since(s.startedAt)
+}
+
+// Check runs all health checks concurrently
+func (s *HealthService) Check(ctx context.Context) HealthReport {
+	return s.run(ctx, func(HealthCheck) bool { return true })
+}
+
+// CheckReadiness runs the checks of the critical components only, which
+// decide whether the instance can serve traffic
+func (s *HealthService) CheckReadiness(ctx context.Context) HealthReport {
+	return s.run(ctx, func(check HealthCheck) bool { return check.Critical })
+}
+
+// CheckComponent runs the check of a single component, reporting false when
+// no check of that name is registered
+func (s *HealthService) CheckComponent(ctx context.Context, name string) (ComponentHealth, bool) {
+	report := s.run(ctx, func(check HealthCheck) bool { return check.Name == name })
+	health, ok := report.Components[name]
+	return health, ok
+}
+
+func (s *HealthService) run(ctx context.Context, include func(HealthCheck) bool) HealthReport {
+	s.mu.RLock()
+	var checks []HealthCheck
+	for _, check := range s.checks {
+		if include(check) {
+			checks = append(checks, check)
+		}
+	}
+	s.mu.RUnlock()
+
+	results := make([]ComponentHealth, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check HealthCheck) {
+			defer wg.Done()
+			results[i] = s.runCheck(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := HealthReport{
+		Status:     HealthUp,
+		Components: make(map[string]ComponentHealth, len(checks)),
+		CheckedAt:  time.Now(),
+	}
+	for i, check := range checks {
+		report.Components[check.Name] = results[i]
+		if results[i].Status == HealthUp {
+			continue
+		}
+		if check.Critical {
+			report.Status = HealthDown
+		} else if report.Status == HealthUp {
+			report.Status = HealthDegraded
+		}
+	}
+	return report
+}
+
+func (s *HealthService) runCheck(ctx context.Context, check HealthCheck) ComponentHealth {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+		done <- check.Check(ctx)
+	}()
+
+	// Checks ignoring the context are abandoned at the timeout
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", s.timeout)
+	}
+
+	health := ComponentHealth{
+		Status:    HealthUp,
+		Critical:  check.Critical,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		health.Status = HealthDown
+		health.Error = err.Error()
+	}
+	return health
+}
+
+// DatabaseHealthCheck pings the database. db is called on every check so the
+// check follows the connection the API uses.
+func DatabaseHealthCheck(db func() *gorm.DB) HealthCheck {
+	return HealthCheck{
+		Name:     "database",
+		Critical: true,
+		Check: func(ctx context.Context) error {
+			conn := db()
+			if conn == nil {
+				return fmt.Errorf("database not connected")
+			}
+			sqlDB, err := conn.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		},
+	}
+}
+
+// RedisHealthCheck pings Redis
+func RedisHealthCheck(client *redis.Client, critical bool) HealthCheck {
+	return HealthCheck{
+		Name:     "redis",
+		Critical: critical,
+		Check: func(ctx context.Context) error {
+			return client.Ping(ctx).Err()
+		},
+	}
+}
+
+// HTTPHealthCheck checks an external API is reachable, named after its host.
+// Any response below 500 counts, as the API answering is what matters, not
+// the endpoint.
+func HTTPHealthCheck(rawURL string) HealthCheck {
+	name := rawURL
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+		name = parsed.Host
+	}
+	return HealthCheck{
+		Name: "external:" + name,
+		Check: func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 500 {
+				return fmt.Errorf("responded with status %d", resp.StatusCode)
+			}
+			return nil
+		},
+	}
+}
@@ -1,13 +1,15 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"time"
+	"triplink/backend/config"
+	"triplink/backend/tracing"
 )
 
 // HERE API Service Implementation for traffic incidents and advanced routing
@@ -19,10 +21,11 @@ type HEREAPIService struct {
 
 func NewHEREAPIService() *HEREAPIService {
 	return &HEREAPIService{
-		APIKey:  os.Getenv("HERE_API_KEY"),
+		APIKey:  config.GetAPIKeysConfig().HERE,
 		BaseURL: "https://api.here.com/v1",
 		HTTPClient: &http.Client{
-			Timeout: 15 * time.Second,
+			Timeout:   15 * time.Second,
+			Transport: tracing.Transport(nil),
 		},
 	}
 }
@@ -138,7 +141,7 @@ type HERENotice struct {
 // Implement TrafficAPIService interface
 func (h *HEREAPIService) GetTrafficConditions(origin, destination string) (*TrafficInfo, error) {
 	// Get route with traffic information
-	route, err := h.getRouteWithTraffic(origin, destination)
+	route, err := h.getRouteWithTraffic(context.Background(), origin, destination)
 	if err != nil {
 		return nil, err
 	}
@@ -364,7 +367,7 @@ func (h *HEREAPIService) GetRouteMatrix(origins, destinations []string) (*RouteM
 }
 
 // Helper methods
-func (h *HEREAPIService) getRouteWithTraffic(origin, destination string) (*HERERouteResponse, error) {
+func (h *HEREAPIService) getRouteWithTraffic(ctx context.Context, origin, destination string) (*HERERouteResponse, error) {
 	// HERE Routing API v8
 	apiURL := "https://router.hereapi.com/v8/routes"
 
@@ -378,7 +381,11 @@ func (h *HEREAPIService) getRouteWithTraffic(origin, destination string) (*HERER
 
 	fullURL := fmt.Sprintf("%s?%s", apiURL, params.Encode())
 
-	resp, err := h.HTTPClient.Get(fullURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := h.HTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get route: %w", err)
 	}
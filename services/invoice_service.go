@@ -0,0 +1,503 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Invoice statuses
+const (
+	InvoiceStatusIssued = "ISSUED"
+	InvoiceStatusPaid   = "PAID"
+	InvoiceStatusVoid   = "VOID"
+)
+
+// Invoice line item types
+const (
+	InvoiceItemFreight   = "FREIGHT"
+	InvoiceItemToll      = "TOLL"
+	InvoiceItemDetention = "DETENTION"
+	InvoiceItemOther     = "OTHER"
+)
+
+var (
+	// ErrInvoiceNotFound is returned for invoices that don't exist or that the
+	// user isn't a party to
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	// ErrNotLoadCarrier is returned when someone other than the carrier of a
+	// load's trip invoices it
+	ErrNotLoadCarrier = errors.New("only the carrier of the load's trip can invoice it")
+	// ErrInvoiceExists is returned when a load already has an invoice that
+	// hasn't been voided
+	ErrInvoiceExists = errors.New("load already has an invoice")
+)
+
+// InvoiceSurcharge is a charge added to an invoice on top of the agreed price
+type InvoiceSurcharge struct {
+	Type        string  `json:"type"` // TOLL, DETENTION, OTHER
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+}
+
+// IssueInvoiceRequest holds the surcharges and terms of a new invoice
+type IssueInvoiceRequest struct {
+	Surcharges []InvoiceSurcharge `json:"surcharges"`
+	DueDays    int                `json:"due_days"` // defaults to INVOICE_DUE_DAYS
+	Notes      string             `json:"notes"`
+}
+
+// InvoiceDocument is the data rendered on an invoice PDF
+type InvoiceDocument struct {
+	Invoice models.Invoice
+	Load    models.Load
+	Shipper *models.User
+	Carrier *models.User
+}
+
+// InvoiceService issues invoices for delivered loads, renders and stores
+// their PDFs and reconciles them with the load's payments
+type InvoiceService struct {
+	db                 *gorm.DB
+	storage            FileStorage
+	platformFeePercent float64
+	dueDays            int
+}
+
+// NewInvoiceService creates a new invoice service instance
+func NewInvoiceService(db *gorm.DB, storage FileStorage, cfg *config.PaymentConfig) *InvoiceService {
+	return &InvoiceService{
+		db:                 db,
+		storage:            storage,
+		platformFeePercent: cfg.PlatformFeePercent,
+		dueDays:            cfg.InvoiceDueDays,
+	}
+}
+
+// IssueInvoice invoices the shipper of a delivered load for the agreed price
+// and surcharges. A payment already made for the load is reconciled with the
+// new invoice.
+func (s *InvoiceService) IssueInvoice(carrierID, loadID uint, req IssueInvoiceRequest) (*models.Invoice, error) {
+	var load models.Load
+	if err := s.db.First(&load, loadID).Error; err != nil {
+		return nil, errors.New("load not found")
+	}
+	if load.Status != "DELIVERED" {
+		return nil, errors.New("only delivered loads can be invoiced")
+	}
+	if load.AgreedPrice <= 0 {
+		return nil, errors.New("load has no agreed price")
+	}
+
+	var trip models.Trip
+	if err := s.db.Select("id, user_id, toll_cost, toll_currency, total_capacity_weight").First(&trip, load.TripID).Error; err != nil || trip.UserID != carrierID {
+		return nil, ErrNotLoadCarrier
+	}
+
+	var existing int64
+	s.db.Model(&models.Invoice{}).Where("load_id = ? AND status <> ?", loadID, InvoiceStatusVoid).Count(&existing)
+	if existing > 0 {
+		return nil, ErrInvoiceExists
+	}
+	// Reissues after a void get the next sequence number of the load
+	var issued int64
+	s.db.Model(&models.Invoice{}).Where("load_id = ?", loadID).Count(&issued)
+
+	dueDays := req.DueDays
+	if dueDays == 0 {
+		dueDays = s.dueDays
+	}
+	if dueDays < 0 || dueDays > 365 {
+		return nil, errors.New("due days must be between 1 and 365")
+	}
+
+	currency := load.Currency
+	if currency == "" {
+		currency = "USD"
+	}
+	items := []models.InvoiceLineItem{{
+		Type:        InvoiceItemFreight,
+		Description: fmt.Sprintf("Freight for load %s", load.BookingReference),
+		Amount:      load.AgreedPrice,
+	}}
+	var surchargeTotal float64
+	itemizedDetention, itemizedTolls := false, false
+	for _, surcharge := range req.Surcharges {
+		item, err := invoiceSurchargeItem(surcharge)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		surchargeTotal += item.Amount
+		itemizedDetention = itemizedDetention || item.Type == InvoiceItemDetention
+		itemizedTolls = itemizedTolls || item.Type == InvoiceItemToll
+	}
+
+	// The load's share of the trip's expected tolls, unless the carrier
+	// itemized tolls themselves
+	if tolls := TollShare(&trip, load.Weight); tolls > 0 && !itemizedTolls {
+		var err error
+		if trip.TollCurrency != "" && !strings.EqualFold(trip.TollCurrency, currency) {
+			tolls, err = GetCurrencyService().Convert(tolls, trip.TollCurrency, currency)
+		}
+		if err != nil {
+			log.Printf("Failed to convert the tolls of trip %d to %s: %v", trip.ID, currency, err)
+		} else {
+			items = append(items, models.InvoiceLineItem{
+				Type:        InvoiceItemToll,
+				Description: fmt.Sprintf("Tolls, share of trip %d", trip.ID),
+				Amount:      tolls,
+			})
+			surchargeTotal += tolls
+		}
+	}
+
+	// Detention charged automatically at the load's stops, unless the carrier
+	// itemized detention themselves
+	if !itemizedDetention {
+		var stops []models.TripStop
+		s.db.Where("load_id = ? AND detention_charge > 0", loadID).Order("sequence ASC").Find(&stops)
+		for _, stop := range stops {
+			items = append(items, models.InvoiceLineItem{
+				Type:        InvoiceItemDetention,
+				Description: fmt.Sprintf("Detention at %s, %s", strings.ToLower(stop.StopType), formatMinutes(stop.DetentionMinutes)),
+				Amount:      stop.DetentionCharge,
+			})
+			surchargeTotal += stop.DetentionCharge
+		}
+	}
+
+	now := time.Now()
+	total := roundHundredths(load.AgreedPrice + surchargeTotal)
+	invoice := &models.Invoice{
+		InvoiceNumber:  fmt.Sprintf("INV-%06d-%d", loadID, issued+1),
+		LoadID:         load.ID,
+		ShipperID:      load.ShipperID,
+		CarrierID:      carrierID,
+		Currency:       currency,
+		Subtotal:       load.AgreedPrice,
+		SurchargeTotal: roundHundredths(surchargeTotal),
+		Total:          total,
+		PlatformFee:    math.Round(total*s.platformFeePercent) / 100,
+		Status:         InvoiceStatusIssued,
+		IssuedAt:       now,
+		DueDate:        now.AddDate(0, 0, dueDays),
+		Notes:          req.Notes,
+		LineItems:      items,
+	}
+
+	if err := s.db.Create(invoice).Error; err != nil {
+		return nil, fmt.Errorf("failed to create invoice: %w", err)
+	}
+
+	// Shippers may have paid for the load before it was invoiced
+	var transaction models.Transaction
+	if err := s.db.Where("load_id = ? AND status = ?", loadID, "COMPLETED").
+		Order("id DESC").First(&transaction).Error; err == nil {
+		if err := ReconcileInvoicePayment(s.db, &transaction); err != nil {
+			log.Printf("Failed to reconcile payment %d with invoice %s: %v", transaction.ID, invoice.InvoiceNumber, err)
+		}
+		s.db.First(invoice, invoice.ID)
+	}
+
+	if err := s.renderInvoice(invoice); err != nil {
+		log.Printf("Failed to render invoice %s: %v", invoice.InvoiceNumber, err)
+	}
+
+	if notifications := GetNotificationService(); notifications != nil {
+		notification := models.Notification{
+			UserID:    load.ShipperID,
+			Title:     "Invoice Issued",
+			Message:   fmt.Sprintf("Invoice %s for load %s: %.2f %s due %s", invoice.InvoiceNumber, load.BookingReference, invoice.Total, invoice.Currency, invoice.DueDate.Format("2006-01-02")),
+			Type:      "INVOICE_ISSUED",
+			RelatedID: load.ID,
+		}
+		if created, _, err := notifications.CreateNotificationWithDelivery(&notification); created == nil {
+			log.Printf("Failed to notify shipper of invoice %s: %v", invoice.InvoiceNumber, err)
+		}
+	}
+
+	return s.GetInvoice(carrierID, invoice.ID)
+}
+
+// invoiceSurchargeItem validates a surcharge and returns its line item
+func invoiceSurchargeItem(surcharge InvoiceSurcharge) (models.InvoiceLineItem, error) {
+	itemType := strings.ToUpper(surcharge.Type)
+	switch itemType {
+	case InvoiceItemToll, InvoiceItemDetention, InvoiceItemOther:
+	case "":
+		itemType = InvoiceItemOther
+	default:
+		return models.InvoiceLineItem{}, fmt.Errorf("invalid surcharge type %q, use TOLL, DETENTION or OTHER", surcharge.Type)
+	}
+	if surcharge.Amount <= 0 {
+		return models.InvoiceLineItem{}, errors.New("surcharge amounts must be positive")
+	}
+
+	description := strings.TrimSpace(surcharge.Description)
+	if description == "" {
+		description = strings.ToUpper(itemType[:1]) + strings.ToLower(itemType[1:])
+	}
+	return models.InvoiceLineItem{
+		Type:        itemType,
+		Description: description,
+		Amount:      roundHundredths(surcharge.Amount),
+	}, nil
+}
+
+// GetInvoice returns an invoice with its line items, if the user is its
+// shipper or carrier
+func (s *InvoiceService) GetInvoice(userID, invoiceID uint) (*models.Invoice, error) {
+	var invoice models.Invoice
+	if err := s.db.Preload("LineItems").
+		Where("id = ? AND (shipper_id = ? OR carrier_id = ?)", invoiceID, userID, userID).
+		First(&invoice).Error; err != nil {
+		return nil, ErrInvoiceNotFound
+	}
+	return &invoice, nil
+}
+
+// UserInvoicesQuery returns the query of invoices a user is the shipper or
+// carrier of
+func (s *InvoiceService) UserInvoicesQuery(userID uint) *gorm.DB {
+	return s.db.Model(&models.Invoice{}).Where("shipper_id = ? OR carrier_id = ?", userID, userID)
+}
+
+// VoidInvoice voids an unpaid invoice so that it no longer has to be paid. A
+// new invoice can then be issued for the load.
+func (s *InvoiceService) VoidInvoice(carrierID, invoiceID uint, reason string) (*models.Invoice, error) {
+	invoice, err := s.GetInvoice(carrierID, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if invoice.CarrierID != carrierID {
+		return nil, ErrNotLoadCarrier
+	}
+	switch invoice.Status {
+	case InvoiceStatusVoid:
+		return nil, errors.New("invoice is already void")
+	case InvoiceStatusPaid:
+		return nil, errors.New("paid invoices cannot be voided, refund the payment instead")
+	}
+
+	now := time.Now()
+	invoice.Status = InvoiceStatusVoid
+	invoice.VoidedAt = &now
+	invoice.VoidReason = strings.TrimSpace(reason)
+	if err := s.db.Model(invoice).Updates(map[string]interface{}{
+		"status":      invoice.Status,
+		"voided_at":   now,
+		"void_reason": invoice.VoidReason,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to void invoice: %w", err)
+	}
+
+	if err := s.renderInvoice(invoice); err != nil {
+		log.Printf("Failed to render voided invoice %s: %v", invoice.InvoiceNumber, err)
+	}
+	return invoice, nil
+}
+
+// GetInvoicePDF returns the stored PDF of an invoice
+func (s *InvoiceService) GetInvoicePDF(userID, invoiceID uint) ([]byte, *models.Invoice, error) {
+	invoice, err := s.GetInvoice(userID, invoiceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if invoice.DocumentKey == "" {
+		if err := s.renderInvoice(invoice); err != nil {
+			return nil, invoice, err
+		}
+	}
+
+	data, err := s.storage.Get(invoice.DocumentKey)
+	if err != nil {
+		return nil, invoice, fmt.Errorf("failed to read invoice PDF: %w", err)
+	}
+	return data, invoice, nil
+}
+
+// renderInvoice renders the PDF of an invoice and stores it
+func (s *InvoiceService) renderInvoice(invoice *models.Invoice) error {
+	doc := &InvoiceDocument{Invoice: *invoice}
+	if err := s.db.First(&doc.Load, invoice.LoadID).Error; err != nil {
+		return errors.New("load not found")
+	}
+	if len(doc.Invoice.LineItems) == 0 {
+		s.db.Where("invoice_id = ?", invoice.ID).Order("id ASC").Find(&doc.Invoice.LineItems)
+	}
+	var shipper, carrier models.User
+	if err := s.db.First(&shipper, invoice.ShipperID).Error; err == nil {
+		doc.Shipper = &shipper
+	}
+	if err := s.db.First(&carrier, invoice.CarrierID).Error; err == nil {
+		doc.Carrier = &carrier
+	}
+
+	key := fmt.Sprintf("invoices/%d/%s.pdf", invoice.LoadID, invoice.InvoiceNumber)
+	documentURL, err := s.storage.Put(key, "application/pdf", RenderInvoicePDF(doc))
+	if err != nil {
+		return fmt.Errorf("failed to store invoice PDF: %w", err)
+	}
+
+	invoice.DocumentURL = documentURL
+	invoice.DocumentKey = key
+	return s.db.Model(invoice).Updates(map[string]interface{}{
+		"document_url": documentURL,
+		"document_key": key,
+	}).Error
+}
+
+// ReconcileInvoicePayment records a completed payment against the open
+// invoice of its load, marking the invoice paid once the payments cover it
+func ReconcileInvoicePayment(db *gorm.DB, transaction *models.Transaction) error {
+	var invoice models.Invoice
+	if err := db.Where("load_id = ? AND status = ?", transaction.LoadID, InvoiceStatusIssued).
+		Order("id DESC").First(&invoice).Error; err != nil {
+		// Loads are often paid before they are invoiced
+		return nil
+	}
+
+	paid := transaction.Amount - transaction.RefundedAmount
+	if !strings.EqualFold(transaction.Currency, invoice.Currency) {
+		converted, err := GetCurrencyService().Convert(paid, transaction.Currency, invoice.Currency)
+		if err != nil {
+			return err
+		}
+		paid = converted
+	}
+
+	updates := map[string]interface{}{
+		"transaction_id": transaction.ID,
+		"amount_paid":    roundHundredths(paid),
+	}
+	if paid >= invoice.Total-0.005 {
+		now := time.Now()
+		if transaction.ProcessedAt != nil {
+			now = *transaction.ProcessedAt
+		}
+		updates["status"] = InvoiceStatusPaid
+		updates["paid_at"] = now
+	}
+	return db.Model(&invoice).Updates(updates).Error
+}
+
+// RenderInvoicePDF renders an invoice as a PDF document
+func RenderInvoicePDF(doc *InvoiceDocument) []byte {
+	pdf := NewPDFWriter()
+	const left, right, bottom = 40.0, pdfPageWidth - 40, 60.0
+	const rowHeight = 14.0
+	invoice := doc.Invoice
+
+	pdf.AddPage()
+	y := pdfPageHeight - 50
+
+	title := "INVOICE"
+	if invoice.Status == InvoiceStatusVoid {
+		title = "INVOICE (VOID)"
+	}
+	pdf.Text(left, y, 18, true, title)
+	pdf.Text(right-170, y, 10, false, "No. "+invoice.InvoiceNumber)
+	y -= 16
+	pdf.Text(right-170, y, 9, false, "Issued "+invoice.IssuedAt.Format("2006-01-02"))
+	y -= rowHeight
+	pdf.Text(right-170, y, 9, false, "Due "+invoice.DueDate.Format("2006-01-02"))
+	y -= 24
+
+	// Parties
+	pdf.Text(left, y, 11, true, "Bill to")
+	pdf.Text(left+270, y, 11, true, "From")
+	y -= rowHeight
+	party := func(user *models.User) []string {
+		if user == nil {
+			return nil
+		}
+		lines := []string{userDisplayName(user)}
+		if address := placeName(user.Address, user.City, user.Country); address != "" {
+			lines = append(lines, address)
+		}
+		if user.TaxID != "" {
+			lines = append(lines, "Tax ID "+user.TaxID)
+		}
+		if user.Email != "" {
+			lines = append(lines, user.Email)
+		}
+		return lines
+	}
+	billTo, from := party(doc.Shipper), party(doc.Carrier)
+	for i := 0; i < len(billTo) || i < len(from); i++ {
+		if i < len(billTo) {
+			pdf.Text(left, y, 9, false, pdfTruncate(billTo[i], 260, 9))
+		}
+		if i < len(from) {
+			pdf.Text(left+270, y, 9, false, pdfTruncate(from[i], right-left-270, 9))
+		}
+		y -= rowHeight - 2
+	}
+	y -= 12
+
+	load := doc.Load
+	pdf.Text(left, y, 9, false, pdfTruncate(fmt.Sprintf("Load %s: %s -> %s", load.BookingReference, placeName(load.PickupCity, load.PickupCountry), placeName(load.DeliveryCity, load.DeliveryCountry)), right-left, 9))
+	y -= rowHeight
+	if load.ActualDeliveryDate != nil {
+		pdf.Text(left, y, 9, false, "Delivered "+load.ActualDeliveryDate.Format("2006-01-02 15:04"))
+		y -= rowHeight
+	}
+	y -= 10
+
+	// Charges
+	amountX := right - 90
+	pdf.Text(left, y, 8, true, "Description")
+	pdf.Text(amountX, y, 8, true, "Amount ("+invoice.Currency+")")
+	pdf.Line(left, y-4, right, y-4)
+	y -= rowHeight + 2
+	for _, item := range invoice.LineItems {
+		if y < bottom+rowHeight*5 {
+			pdf.AddPage()
+			y = pdfPageHeight - 50
+		}
+		pdf.Text(left, y, 9, false, pdfTruncate(item.Description, amountX-left-10, 9))
+		pdf.Text(amountX, y, 9, false, fmt.Sprintf("%.2f", item.Amount))
+		y -= rowHeight
+	}
+	pdf.Line(left, y+rowHeight-4, right, y+rowHeight-4)
+
+	totals := [][2]string{
+		{"Subtotal", fmt.Sprintf("%.2f", invoice.Subtotal)},
+		{"Surcharges", fmt.Sprintf("%.2f", invoice.SurchargeTotal)},
+		{"Total", fmt.Sprintf("%.2f %s", invoice.Total, invoice.Currency)},
+		{"Paid", fmt.Sprintf("%.2f", invoice.AmountPaid)},
+		{"Balance due", fmt.Sprintf("%.2f %s", math.Max(0, invoice.Total-invoice.AmountPaid), invoice.Currency)},
+	}
+	for _, row := range totals {
+		bold := row[0] == "Total" || row[0] == "Balance due"
+		pdf.Text(amountX-100, y, 9, bold, row[0])
+		pdf.Text(amountX, y, 9, bold, row[1])
+		y -= rowHeight
+	}
+	y -= 6
+	pdf.Text(left, y, 8, false, fmt.Sprintf("Includes a platform fee of %.2f %s.", invoice.PlatformFee, invoice.Currency))
+	y -= rowHeight
+
+	if invoice.Status == InvoiceStatusVoid && invoice.VoidReason != "" {
+		pdf.Text(left, y, 9, true, pdfTruncate("Voided: "+invoice.VoidReason, right-left, 9))
+		y -= rowHeight
+	}
+	if invoice.Notes != "" {
+		pdf.Text(left, y, 9, false, pdfTruncate(invoice.Notes, right-left, 9))
+	}
+
+	for i := 0; i < pdf.PageCount(); i++ {
+		pdf.SetPage(i)
+		pdf.Text(right-50, 30, 8, false, fmt.Sprintf("Page %d of %d", i+1, pdf.PageCount()))
+	}
+
+	return pdf.Bytes()
+}
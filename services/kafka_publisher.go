@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/avro"
+	"triplink/backend/internal/kafka"
+	"triplink/backend/models"
+)
+
+// KafkaSchemaVersion is the version of the events published to Kafka. It is
+// bumped on incompatible changes only; fields may be added within a version.
+const KafkaSchemaVersion = 1
+
+// Event types published to Kafka
+const (
+	KafkaLocationUpdated   = "location.updated"
+	KafkaTripStatusChanged = "trip.status.changed"
+	KafkaLoadDelivered     = "load.delivered"
+)
+
+// KafkaEventAvroSchema is the Avro schema of KafkaEvent in parsing canonical
+// form. Avro messages are framed in the single-object encoding with its
+// fingerprint. Timestamps are milliseconds since the epoch.
+const KafkaEventAvroSchema = `{"name":"triplink.events.TrackingEvent","type":"record","fields":[` +
+	`{"name":"schema_version","type":"int"},` +
+	`{"name":"event_id","type":"long"},` +
+	`{"name":"event_type","type":"string"},` +
+	`{"name":"occurred_at","type":"long"},` +
+	`{"name":"trip_id","type":"long"},` +
+	`{"name":"load_id","type":["null","long"]},` +
+	`{"name":"location","type":["null",{"name":"triplink.events.Location","type":"record","fields":[` +
+	`{"name":"record_id","type":"long"},` +
+	`{"name":"latitude","type":"double"},` +
+	`{"name":"longitude","type":"double"},` +
+	`{"name":"altitude","type":["null","double"]},` +
+	`{"name":"speed","type":["null","double"]},` +
+	`{"name":"heading","type":["null","double"]},` +
+	`{"name":"accuracy","type":["null","double"]},` +
+	`{"name":"source","type":"string"},` +
+	`{"name":"driver_id","type":["null","long"]},` +
+	`{"name":"battery_level","type":["null","double"]}]}]},` +
+	`{"name":"status","type":["null",{"name":"triplink.events.StatusChange","type":"record","fields":[` +
+	`{"name":"from","type":"string"},` +
+	`{"name":"to","type":"string"}]}]}]}`
+
+var kafkaEventFingerprint = avro.Fingerprint(KafkaEventAvroSchema)
+
+// KafkaEvent is an event published to Kafka. EventID is the outbox event's
+// ID; events are published at least once, so consumers should skip IDs they
+// have seen.
+type KafkaEvent struct {
+	SchemaVersion int                `json:"schema_version"`
+	EventID       uint               `json:"event_id"`
+	EventType     string             `json:"event_type"`
+	OccurredAt    time.Time          `json:"occurred_at"`
+	TripID        uint               `json:"trip_id"`
+	LoadID        *uint              `json:"load_id,omitempty"`
+	Location      *KafkaLocation     `json:"location,omitempty"`
+	Status        *KafkaStatusChange `json:"status,omitempty"`
+}
+
+// KafkaLocation is the position of a location.updated event
+type KafkaLocation struct {
+	RecordID     uint     `json:"record_id"`
+	Latitude     float64  `json:"latitude"`
+	Longitude    float64  `json:"longitude"`
+	Altitude     *float64 `json:"altitude,omitempty"`
+	Speed        *float64 `json:"speed,omitempty"`
+	Heading      *float64 `json:"heading,omitempty"`
+	Accuracy     *float64 `json:"accuracy,omitempty"`
+	Source       string   `json:"source"`
+	DriverID     *uint    `json:"driver_id,omitempty"`
+	BatteryLevel *float64 `json:"battery_level,omitempty"`
+}
+
+// KafkaStatusChange is the change of a status event
+type KafkaStatusChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// KafkaProducer produces messages to a Kafka topic
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, messages ...kafka.Message) error
+}
+
+// NewKafkaProducer creates a producer for the configured cluster
+func NewKafkaProducer(cfg *config.KafkaConfig) (*kafka.Producer, error) {
+	opts := kafka.Options{
+		Brokers:  cfg.Brokers,
+		ClientID: cfg.ClientID,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		Timeout:  cfg.Timeout,
+	}
+	if cfg.TLSEnabled {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if cfg.CAFile != "" {
+			caPEM, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Kafka CA: %w", err)
+			}
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(caPEM) {
+				return nil, fmt.Errorf("Kafka CA %s has no certificates", cfg.CAFile)
+			}
+			opts.TLSConfig.RootCAs = roots
+		}
+	}
+	return kafka.NewProducer(opts)
+}
+
+// KafkaPublisher publishes location updates, trip status changes and load
+// deliveries from the outbox to their Kafka topics. Messages are keyed by
+// trip, so a trip's events are consumed in order.
+type KafkaPublisher struct {
+	cfg      *config.KafkaConfig
+	producer KafkaProducer
+}
+
+// NewKafkaPublisher creates a publisher producing with producer
+func NewKafkaPublisher(cfg *config.KafkaConfig, producer KafkaProducer) *KafkaPublisher {
+	return &KafkaPublisher{cfg: cfg, producer: producer}
+}
+
+// Name implements OutboxPublisher
+func (kp *KafkaPublisher) Name() string {
+	return "kafka"
+}
+
+// Accepts implements OutboxFilter
+func (kp *KafkaPublisher) Accepts(eventType string) bool {
+	switch eventType {
+	case LocationUpdateEvent, "STATUS_CHANGE", "LOAD_STATUS_CHANGE":
+		return true
+	}
+	return false
+}
+
+// Publish implements OutboxPublisher. Load status changes other than
+// deliveries are not published.
+func (kp *KafkaPublisher) Publish(ctx context.Context, message OutboxMessage) error {
+	event, topic, err := kp.event(message)
+	if err != nil || event == nil {
+		return err
+	}
+
+	contentType := "application/json"
+	var value []byte
+	if kp.cfg.Format == "avro" {
+		contentType = "avro/binary"
+		value = avro.SingleObject(kafkaEventFingerprint, encodeKafkaEventAvro(event))
+	} else if value, err = json.Marshal(event); err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	return kp.producer.Produce(ctx, topic, kafka.Message{
+		Key:   []byte(strconv.FormatUint(uint64(event.TripID), 10)),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "event_type", Value: []byte(event.EventType)},
+			{Key: "schema_version", Value: []byte(strconv.Itoa(event.SchemaVersion))},
+			{Key: "content_type", Value: []byte(contentType)},
+			{Key: "event_id", Value: []byte(strconv.FormatUint(uint64(event.EventID), 10))},
+		},
+		Time: event.OccurredAt,
+	})
+}
+
+// event converts an outbox message to the event published for it and its
+// topic, or nil if nothing is published
+func (kp *KafkaPublisher) event(message OutboxMessage) (*KafkaEvent, string, error) {
+	event := &KafkaEvent{
+		SchemaVersion: KafkaSchemaVersion,
+		EventID:       message.ID,
+		TripID:        message.TripID,
+		LoadID:        message.LoadID,
+		OccurredAt:    message.CreatedAt,
+	}
+
+	switch message.Type {
+	case LocationUpdateEvent:
+		var record models.TrackingRecord
+		if err := json.Unmarshal(message.Data, &record); err != nil {
+			return nil, "", fmt.Errorf("failed to decode tracking record: %w", err)
+		}
+		event.EventType = KafkaLocationUpdated
+		event.OccurredAt = record.Timestamp
+		event.Location = &KafkaLocation{
+			RecordID:     record.ID,
+			Latitude:     record.Latitude,
+			Longitude:    record.Longitude,
+			Altitude:     record.Altitude,
+			Speed:        record.Speed,
+			Heading:      record.Heading,
+			Accuracy:     record.Accuracy,
+			Source:       record.Source,
+			DriverID:     record.DriverID,
+			BatteryLevel: record.BatteryLevel,
+		}
+		return event, kp.cfg.LocationTopic, nil
+
+	case "STATUS_CHANGE", "LOAD_STATUS_CHANGE":
+		var trackingEvent models.TrackingEvent
+		if err := json.Unmarshal(message.Data, &trackingEvent); err != nil {
+			return nil, "", fmt.Errorf("failed to decode tracking event: %w", err)
+		}
+		var change KafkaStatusChange
+		if err := json.Unmarshal([]byte(trackingEvent.EventData), &change); err != nil {
+			return nil, "", fmt.Errorf("failed to decode status change: %w", err)
+		}
+		event.OccurredAt = trackingEvent.Timestamp
+		event.Status = &change
+
+		if message.Type == "STATUS_CHANGE" {
+			event.EventType = KafkaTripStatusChanged
+			return event, kp.cfg.TripStatusTopic, nil
+		}
+		if change.To != "DELIVERED" {
+			return nil, "", nil
+		}
+		event.EventType = KafkaLoadDelivered
+		return event, kp.cfg.LoadTopic, nil
+	}
+	return nil, "", nil
+}
+
+// encodeKafkaEventAvro encodes an event in the binary encoding of
+// KafkaEventAvroSchema
+func encodeKafkaEventAvro(event *KafkaEvent) []byte {
+	e := &avro.Encoder{}
+	e.Long(int64(event.SchemaVersion))
+	e.Long(int64(event.EventID))
+	e.String(event.EventType)
+	e.Long(event.OccurredAt.UnixMilli())
+	e.Long(int64(event.TripID))
+	e.OptionalLong(optionalAvroID(event.LoadID))
+
+	if location := event.Location; location != nil {
+		e.Union(1)
+		e.Long(int64(location.RecordID))
+		e.Double(location.Latitude)
+		e.Double(location.Longitude)
+		e.OptionalDouble(location.Altitude)
+		e.OptionalDouble(location.Speed)
+		e.OptionalDouble(location.Heading)
+		e.OptionalDouble(location.Accuracy)
+		e.String(location.Source)
+		e.OptionalLong(optionalAvroID(location.DriverID))
+		e.OptionalDouble(location.BatteryLevel)
+	} else {
+		e.Union(0)
+	}
+
+	if status := event.Status; status != nil {
+		e.Union(1)
+		e.String(status.From)
+		e.String(status.To)
+	} else {
+		e.Union(0)
+	}
+	return e.Bytes()
+}
+
+func optionalAvroID(id *uint) *int64 {
+	if id == nil {
+		return nil
+	}
+	v := int64(*id)
+	return &v
+}
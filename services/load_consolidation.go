@@ -0,0 +1,178 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+	"triplink/backend/models"
+)
+
+// ConsolidationOptions controls which loads are suggested for a carrier's
+// trips and how detours are costed
+type ConsolidationOptions struct {
+	// Maximum distance in km between the trip route and the load pickup or delivery
+	MaxDeviationKm float64
+	// Trips departing within this window are considered
+	Horizon time.Duration
+	// Cost of driving one extra km, in the trip's pricing currency
+	CostPerKm float64
+	// Pickup and delivery dates may fall outside the trip dates by this much
+	DateFlexibility time.Duration
+	// Maximum number of suggestions returned
+	Limit int
+	// Only consider this trip when set
+	TripID uint
+}
+
+// DefaultConsolidationOptions returns the default consolidation options
+func DefaultConsolidationOptions() ConsolidationOptions {
+	return ConsolidationOptions{
+		MaxDeviationKm:  50,
+		Horizon:         14 * 24 * time.Hour,
+		CostPerKm:       1.5,
+		DateFlexibility: 24 * time.Hour,
+		Limit:           20,
+	}
+}
+
+// ConsolidationSuggestion is a pending load that fits along one of a
+// carrier's trips, with the revenue it adds and the cost of the detour
+type ConsolidationSuggestion struct {
+	TripID              uint        `json:"trip_id"`
+	Load                models.Load `json:"load"`
+	PickupDeviationKm   float64     `json:"pickup_deviation_km"`
+	DeliveryDeviationKm float64     `json:"delivery_deviation_km"`
+	DetourKm            float64     `json:"detour_km"`
+	AddedRevenue        float64     `json:"added_revenue"`
+	DetourCost          float64     `json:"detour_cost"`
+	NetGain             float64     `json:"net_gain"`
+	RemainingWeight     float64     `json:"remaining_weight"` // trip capacity left after the load
+	RemainingVolume     float64     `json:"remaining_volume"`
+}
+
+// SuggestConsolidations finds pending loads that could be added to a
+// carrier's upcoming trips: loads whose pickup and delivery lie within the
+// route corridor, in the direction of travel, that fit the remaining capacity
+// and vehicle. Suggestions are ranked by added revenue less detour cost; each
+// is independent, so two suggestions for a trip may not fit together.
+func (ms *MatchingService) SuggestConsolidations(carrierID uint, opts ConsolidationOptions) ([]ConsolidationSuggestion, error) {
+	defaults := DefaultConsolidationOptions()
+	if opts.MaxDeviationKm <= 0 {
+		opts.MaxDeviationKm = defaults.MaxDeviationKm
+	}
+	if opts.Horizon <= 0 {
+		opts.Horizon = defaults.Horizon
+	}
+	if opts.CostPerKm < 0 {
+		opts.CostPerKm = defaults.CostPerKm
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaults.Limit
+	}
+
+	now := time.Now()
+	tripQuery := ms.db.Where("user_id = ? AND status = ?", carrierID, "PLANNED").
+		Where("departure_date BETWEEN ? AND ?", now, now.Add(opts.Horizon))
+	if opts.TripID != 0 {
+		tripQuery = tripQuery.Where("id = ?", opts.TripID)
+	}
+	var trips []models.Trip
+	if err := tripQuery.Order("departure_date ASC").Find(&trips).Error; err != nil {
+		return nil, err
+	}
+	if len(trips) == 0 {
+		return []ConsolidationSuggestion{}, nil
+	}
+
+	// Unassigned loads still looking for a carrier
+	var loads []models.Load
+	if err := ms.db.Where("trip_id = ? AND status IN ?", 0, []string{"QUOTE_REQUESTED", "QUOTED"}).
+		Where("shipper_id <> ?", carrierID).
+		Find(&loads).Error; err != nil {
+		return nil, err
+	}
+
+	vehicles, err := ms.getVehicles(trips)
+	if err != nil {
+		return nil, err
+	}
+	unavailable, err := ms.getUnavailableTrips(trips)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := []ConsolidationSuggestion{}
+	for i := range trips {
+		trip := &trips[i]
+		if unavailable[trip.ID] {
+			continue
+		}
+		vehicle := vehicles[trip.VehicleID]
+		route := tripRoutePath(trip)
+		remainingWeight := trip.TotalCapacityWeight - trip.UsedWeight
+		remainingVolume := trip.TotalCapacityVolume - trip.UsedVolume
+
+		for j := range loads {
+			load := &loads[j]
+			if load.Weight > remainingWeight || load.Volume > remainingVolume {
+				continue
+			}
+			if !consolidationDatesFit(trip, load, opts.DateFlexibility) {
+				continue
+			}
+			if !vehicleMeetsRequirements(vehicle, load) {
+				continue
+			}
+
+			pickupMeters, pickupProgress := ProjectOntoPath(route, Coordinate{Latitude: load.PickupLat, Longitude: load.PickupLng})
+			deliveryMeters, deliveryProgress := ProjectOntoPath(route, Coordinate{Latitude: load.DeliveryLat, Longitude: load.DeliveryLng})
+			pickupKm := pickupMeters / 1000
+			deliveryKm := deliveryMeters / 1000
+			if pickupKm > opts.MaxDeviationKm || deliveryKm > opts.MaxDeviationKm || pickupProgress > deliveryProgress {
+				continue
+			}
+
+			// Leaving the route for the pickup and the delivery and rejoining it
+			detourKm := 2 * (pickupKm + deliveryKm)
+			revenue := trip.BasePrice + trip.PricePerKg*load.Weight + trip.PricePerCubicMeter*load.Volume
+			cost := detourKm * opts.CostPerKm
+
+			suggestions = append(suggestions, ConsolidationSuggestion{
+				TripID:              trip.ID,
+				Load:                *load,
+				PickupDeviationKm:   roundHundredths(pickupKm),
+				DeliveryDeviationKm: roundHundredths(deliveryKm),
+				DetourKm:            roundHundredths(detourKm),
+				AddedRevenue:        roundHundredths(revenue),
+				DetourCost:          roundHundredths(cost),
+				NetGain:             roundHundredths(revenue - cost),
+				RemainingWeight:     remainingWeight - load.Weight,
+				RemainingVolume:     remainingVolume - load.Volume,
+			})
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].NetGain > suggestions[j].NetGain
+	})
+	if len(suggestions) > opts.Limit {
+		suggestions = suggestions[:opts.Limit]
+	}
+	return suggestions, nil
+}
+
+// consolidationDatesFit reports whether a trip's dates overlap a load's
+// pickup and delivery window
+func consolidationDatesFit(trip *models.Trip, load *models.Load, flexibility time.Duration) bool {
+	if !load.RequestedDeliveryDate.IsZero() && trip.DepartureDate.After(load.RequestedDeliveryDate.Add(flexibility)) {
+		return false
+	}
+	if !load.RequestedPickupDate.IsZero() && trip.EstimatedArrival.Before(load.RequestedPickupDate.Add(-flexibility)) {
+		return false
+	}
+	return true
+}
+
+func roundHundredths(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"fmt"
+	"time"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+)
+
+// LoadETAs are the times a load is expected at its pickup and its delivery.
+// The pickup ETA is left out once the vehicle reached the pickup.
+type LoadETAs struct {
+	LoadID      uint       `json:"load_id"`
+	PickupETA   *time.Time `json:"pickup_eta,omitempty"`
+	DeliveryETA *time.Time `json:"delivery_eta,omitempty"`
+}
+
+// loadPickedUpStatuses are the statuses of loads that are on the vehicle
+var loadPickedUpStatuses = map[string]bool{
+	"PICKED_UP":        true,
+	"IN_TRANSIT":       true,
+	"OUT_FOR_DELIVERY": true,
+}
+
+// updateLoadETAs estimates when each load of a trip will be picked up and
+// delivered and stores the times on the load's tracking status. Loads on the
+// itinerary take the ETAs of their stops, so they follow the stop sequence;
+// other loads are estimated from the current location over their own pickup
+// and delivery, at the speed of the trip estimate.
+func (ts *TrackingService) updateLoadETAs(tripID uint, current Coordinate, estimate *ETAEstimate) error {
+	var loads []models.Load
+	if err := ts.db.Where("trip_id = ? AND status NOT IN ?", tripID, []string{"CANCELLED", "DELIVERED"}).
+		Find(&loads).Error; err != nil {
+		return fmt.Errorf("failed to get trip loads: %w", err)
+	}
+	if len(loads) == 0 {
+		return nil
+	}
+
+	stops, err := ts.GetTripStops(tripID)
+	if err != nil {
+		return err
+	}
+	pickups := make(map[uint]*models.TripStop)
+	deliveries := make(map[uint]*models.TripStop)
+	for i := range stops {
+		if stops[i].LoadID == nil {
+			continue
+		}
+		switch stops[i].StopType {
+		case TripStopPickup:
+			pickups[*stops[i].LoadID] = &stops[i]
+		case TripStopDelivery:
+			deliveries[*stops[i].LoadID] = &stops[i]
+		}
+	}
+
+	for i := range loads {
+		load := &loads[i]
+		var etas LoadETAs
+		if pickup, delivery := pickups[load.ID], deliveries[load.ID]; pickup != nil && delivery != nil {
+			etas = LoadETAs{LoadID: load.ID, PickupETA: pendingStopETA(pickup), DeliveryETA: pendingStopETA(delivery)}
+		} else {
+			etas = estimateLoadETAs(load, current, estimate)
+		}
+		if err := ts.persistLoadETAs(load, &etas, estimate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pendingStopETA returns the ETA of a stop that wasn't reached yet
+func pendingStopETA(stop *models.TripStop) *time.Time {
+	if stop.Status != TripStopPending {
+		return nil
+	}
+	return stop.EstimatedArrival
+}
+
+// estimateLoadETAs estimates the pickup and delivery of a load that isn't on
+// the itinerary, going straight to its pickup and then to its delivery. Loads
+// without delivery coordinates arrive with the trip.
+func estimateLoadETAs(load *models.Load, current Coordinate, estimate *ETAEstimate) LoadETAs {
+	etas := LoadETAs{LoadID: load.ID}
+	speedKmh := estimate.speedKmh()
+	travel := func(from, to Coordinate) time.Duration {
+		distance := geo.Distance(from.Latitude, from.Longitude, to.Latitude, to.Longitude)
+		return time.Duration(distance / speedKmh * float64(time.Hour))
+	}
+
+	position := current
+	at := estimate.CalculatedAt
+	pickedUp := load.ActualPickupDate != nil || loadPickedUpStatuses[load.Status]
+	if !pickedUp && (load.PickupLat != 0 || load.PickupLng != 0) {
+		pickup := Coordinate{Latitude: load.PickupLat, Longitude: load.PickupLng}
+		at = at.Add(travel(position, pickup))
+		pickupETA := at
+		etas.PickupETA = &pickupETA
+		at = at.Add(stopDwellTime)
+		position = pickup
+	}
+
+	if load.DeliveryLat == 0 && load.DeliveryLng == 0 {
+		deliveryETA := estimate.EstimatedArrival
+		etas.DeliveryETA = &deliveryETA
+		return etas
+	}
+	deliveryETA := at.Add(travel(position, Coordinate{Latitude: load.DeliveryLat, Longitude: load.DeliveryLng}))
+	etas.DeliveryETA = &deliveryETA
+	return etas
+}
+
+// persistLoadETAs stores the ETAs of a load on its tracking status, whose
+// estimated arrival is the delivery
+func (ts *TrackingService) persistLoadETAs(load *models.Load, etas *LoadETAs, estimate *ETAEstimate) error {
+	var status models.TrackingStatus
+	if err := ts.db.Where("load_id = ?", load.ID).First(&status).Error; err != nil {
+		status = models.TrackingStatus{
+			TripID:           load.TripID,
+			LoadID:           &load.ID,
+			CurrentStatus:    load.Status,
+			StatusChangedAt:  estimate.CalculatedAt,
+			EstimatedArrival: etas.DeliveryETA,
+			PickupETA:        etas.PickupETA,
+			DeliveryETA:      etas.DeliveryETA,
+			ETASource:        estimate.Source,
+			ETAConfidence:    estimate.Confidence,
+			ETAUpdatedAt:     &estimate.CalculatedAt,
+		}
+		if err := ts.db.Create(&status).Error; err != nil {
+			return fmt.Errorf("failed to create load tracking status: %w", err)
+		}
+		return nil
+	}
+
+	if err := ts.db.Model(&status).Updates(map[string]interface{}{
+		"estimated_arrival": etas.DeliveryETA,
+		"pickup_eta":        etas.PickupETA,
+		"delivery_eta":      etas.DeliveryETA,
+		"eta_source":        estimate.Source,
+		"eta_confidence":    estimate.Confidence,
+		"eta_updated_at":    estimate.CalculatedAt,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update load tracking status: %w", err)
+	}
+	return nil
+}
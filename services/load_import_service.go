@@ -0,0 +1,466 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// maxLoadImportRows caps the loads created by one import
+const maxLoadImportRows = 1000
+
+// Load import row statuses
+const (
+	LoadImportValid   = "VALID"
+	LoadImportInvalid = "INVALID"
+	LoadImportCreated = "CREATED"
+)
+
+// loadImportColumns are the columns of an import file. Headers are matched
+// case-insensitively with spaces and dashes read as underscores.
+var loadImportColumns = []string{
+	"booking_reference", "description", "category", "hs_code", "quantity",
+	"weight", "length", "width", "height", "volume", "value", "currency",
+	"pickup_address", "pickup_city", "pickup_state", "pickup_country", "pickup_lat", "pickup_lng",
+	"delivery_address", "delivery_city", "delivery_state", "delivery_country", "delivery_lat", "delivery_lng",
+	"pickup_date", "delivery_date", "special_instructions",
+	"fragile", "hazmat", "refrigerated", "insurance_value",
+}
+
+// LoadImportReport is the result of importing a file of loads
+type LoadImportReport struct {
+	TotalRows      int             `json:"total_rows"`
+	ValidRows      int             `json:"valid_rows"`
+	InvalidRows    int             `json:"invalid_rows"`
+	Created        int             `json:"created"`
+	DryRun         bool            `json:"dry_run"`
+	UnknownColumns []string        `json:"unknown_columns,omitempty"`
+	Rows           []LoadImportRow `json:"rows"`
+}
+
+// LoadImportRow is the result of one row of an import file
+type LoadImportRow struct {
+	Row              int      `json:"row"` // line of the file, the header is row 1
+	Status           string   `json:"status"`
+	BookingReference string   `json:"booking_reference,omitempty"`
+	LoadID           uint     `json:"load_id,omitempty"`
+	Errors           []string `json:"errors,omitempty"`
+	Warnings         []string `json:"warnings,omitempty"`
+}
+
+// LoadImportService creates loads in bulk from CSV and XLSX files
+type LoadImportService struct {
+	db       *gorm.DB
+	geocoder AddressGeocoder
+}
+
+// NewLoadImportService creates a new load import service. Without a geocoding
+// provider rows are imported without coordinates unless the file has them.
+func NewLoadImportService(db *gorm.DB, geocoder AddressGeocoder) *LoadImportService {
+	return &LoadImportService{
+		db:       db,
+		geocoder: geocoder,
+	}
+}
+
+// ImportLoads validates the rows of a CSV or XLSX file and creates a load
+// for each of them. Loads are only created when every row is valid, and in a
+// single transaction, so a file is imported completely or not at all. A dry
+// run validates and geocodes the rows without creating loads.
+func (s *LoadImportService) ImportLoads(shipperID uint, fileName string, data []byte, dryRun bool) (*LoadImportReport, error) {
+	records, err := readImportRecords(fileName, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("file is empty")
+	}
+
+	columns, unknown := importColumnIndexes(records[0])
+	for _, required := range []string{"weight", "pickup_address", "delivery_address", "pickup_date", "delivery_date"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing required column %s", required)
+		}
+	}
+
+	report := &LoadImportReport{DryRun: dryRun, UnknownColumns: unknown, Rows: []LoadImportRow{}}
+	var loads []*models.Load
+	var rows []*LoadImportRow
+	references := make(map[string]int)
+	for i, record := range records[1:] {
+		if isBlankRecord(record) {
+			continue
+		}
+		if len(rows) == maxLoadImportRows {
+			return nil, fmt.Errorf("file has more than %d loads", maxLoadImportRows)
+		}
+
+		row := &LoadImportRow{Row: i + 2}
+		cell := func(column string) string {
+			if index, ok := columns[column]; ok && index < len(record) {
+				return strings.TrimSpace(record[index])
+			}
+			return ""
+		}
+		load := s.importLoad(shipperID, cell, row)
+		if load.BookingReference != "" {
+			if previous, ok := references[load.BookingReference]; ok {
+				row.Errors = append(row.Errors, fmt.Sprintf("booking_reference is also used on row %d", previous))
+			}
+			references[load.BookingReference] = row.Row
+		}
+
+		loads = append(loads, load)
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("file has no loads")
+	}
+	s.geocodeLoads(loads, rows)
+
+	// References already used by other loads
+	if len(references) > 0 {
+		existing := make([]string, 0, len(references))
+		for reference := range references {
+			existing = append(existing, reference)
+		}
+		var taken []string
+		s.db.Model(&models.Load{}).Where("booking_reference IN ?", existing).Pluck("booking_reference", &taken)
+		for _, reference := range taken {
+			row := rows[indexOfImportRow(rows, references[reference])]
+			row.Errors = append(row.Errors, "booking_reference is already used by another load")
+		}
+	}
+
+	report.TotalRows = len(rows)
+	for _, row := range rows {
+		row.Status = LoadImportValid
+		if len(row.Errors) > 0 {
+			row.Status = LoadImportInvalid
+			report.InvalidRows++
+		}
+	}
+	report.ValidRows = report.TotalRows - report.InvalidRows
+
+	if report.InvalidRows == 0 && !dryRun {
+		batch, err := importBatchID()
+		if err != nil {
+			return nil, err
+		}
+		organizationID, err := NewOrganizationService(s.db).ResolveOrganization(shipperID, OrganizationShipper, nil)
+		if err != nil {
+			return nil, err
+		}
+		err = s.db.Transaction(func(tx *gorm.DB) error {
+			for i, load := range loads {
+				if load.BookingReference == "" {
+					load.BookingReference = fmt.Sprintf("IMP-%s-%d", batch, rows[i].Row)
+				}
+				load.OrganizationID = organizationID
+				if err := tx.Create(load).Error; err != nil {
+					return fmt.Errorf("failed to create load of row %d: %w", rows[i].Row, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i, load := range loads {
+			rows[i].Status = LoadImportCreated
+			rows[i].LoadID = load.ID
+		}
+		report.Created = len(loads)
+	}
+
+	for i, row := range rows {
+		row.BookingReference = loads[i].BookingReference
+		report.Rows = append(report.Rows, *row)
+	}
+	return report, nil
+}
+
+// importLoad builds the load of a row, adding the problems found to the row
+func (s *LoadImportService) importLoad(shipperID uint, cell func(string) string, row *LoadImportRow) *models.Load {
+	load := &models.Load{
+		ShipperID:           shipperID,
+		Status:              "QUOTE_REQUESTED",
+		BookingReference:    cell("booking_reference"),
+		Description:         cell("description"),
+		Category:            strings.ToUpper(cell("category")),
+		HSCode:              cell("hs_code"),
+		Currency:            cell("currency"),
+		PickupAddress:       cell("pickup_address"),
+		PickupCity:          cell("pickup_city"),
+		PickupState:         cell("pickup_state"),
+		PickupCountry:       cell("pickup_country"),
+		DeliveryAddress:     cell("delivery_address"),
+		DeliveryCity:        cell("delivery_city"),
+		DeliveryState:       cell("delivery_state"),
+		DeliveryCountry:     cell("delivery_country"),
+		SpecialInstructions: cell("special_instructions"),
+	}
+	fail := func(format string, args ...interface{}) {
+		row.Errors = append(row.Errors, fmt.Sprintf(format, args...))
+	}
+
+	number := func(column string, target *float64) {
+		value := cell(column)
+		if value == "" {
+			return
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || math.IsInf(parsed, 0) || math.IsNaN(parsed) {
+			fail("%s must be a non-negative number", column)
+			return
+		}
+		*target = parsed
+	}
+	number("weight", &load.Weight)
+	number("length", &load.Length)
+	number("width", &load.Width)
+	number("height", &load.Height)
+	number("volume", &load.Volume)
+	number("value", &load.Value)
+	number("insurance_value", &load.InsuranceValue)
+	if cell("weight") != "" && load.Weight == 0 {
+		fail("weight must be positive")
+	} else if cell("weight") == "" {
+		fail("weight is required")
+	}
+	if load.Volume == 0 && load.Length > 0 && load.Width > 0 && load.Height > 0 {
+		load.Volume = load.Length * load.Width * load.Height
+	}
+	load.InsuranceRequired = load.InsuranceValue > 0
+
+	if value := cell("quantity"); value != "" {
+		quantity, err := strconv.Atoi(value)
+		if err != nil || quantity < 0 {
+			fail("quantity must be a whole number")
+		}
+		load.Quantity = quantity
+	}
+
+	for column, target := range map[string]*bool{
+		"fragile":      &load.IsFragile,
+		"hazmat":       &load.IsHazmat,
+		"refrigerated": &load.RequiresRefrigeration,
+	} {
+		flag, err := parseImportBool(cell(column))
+		if err != nil {
+			fail("%s must be yes or no", column)
+		}
+		*target = flag
+	}
+
+	if err := validateCurrencyCode(&load.Currency); err != nil {
+		fail("%v", err)
+	}
+
+	if load.PickupAddress == "" {
+		fail("pickup_address is required")
+	}
+	if load.DeliveryAddress == "" {
+		fail("delivery_address is required")
+	}
+	coordinates := func(latColumn, lngColumn string, lat, lng *float64) {
+		if cell(latColumn) == "" && cell(lngColumn) == "" {
+			return
+		}
+		parsedLat, latErr := strconv.ParseFloat(cell(latColumn), 64)
+		parsedLng, lngErr := strconv.ParseFloat(cell(lngColumn), 64)
+		if latErr != nil || lngErr != nil || !isValidCoordinate(parsedLat, parsedLng) {
+			fail("%s and %s must be valid coordinates", latColumn, lngColumn)
+			return
+		}
+		*lat, *lng = parsedLat, parsedLng
+	}
+	coordinates("pickup_lat", "pickup_lng", &load.PickupLat, &load.PickupLng)
+	coordinates("delivery_lat", "delivery_lng", &load.DeliveryLat, &load.DeliveryLng)
+
+	pickup, pickupErr := parseImportDate(cell("pickup_date"))
+	if pickupErr != nil {
+		fail("pickup_date %v", pickupErr)
+	}
+	delivery, deliveryErr := parseImportDate(cell("delivery_date"))
+	if deliveryErr != nil {
+		fail("delivery_date %v", deliveryErr)
+	}
+	if pickupErr == nil && deliveryErr == nil && delivery.Before(pickup) {
+		fail("delivery_date must not be before pickup_date")
+	}
+	load.RequestedPickupDate = pickup
+	load.RequestedDeliveryDate = delivery
+
+	return load
+}
+
+// geocodeLoads sets the coordinates of the pickup and delivery addresses of
+// valid rows that have none. The addresses of all rows are geocoded in one
+// batch, each distinct address once.
+func (s *LoadImportService) geocodeLoads(loads []*models.Load, rows []*LoadImportRow) {
+	var queries []string
+	for i, load := range loads {
+		if len(rows[i].Errors) > 0 {
+			continue
+		}
+		for _, place := range loadPlaces(load) {
+			if place.needsGeocoding() {
+				queries = append(queries, place.query())
+			}
+		}
+	}
+	if len(queries) == 0 {
+		return
+	}
+
+	results := geocodeAll(s.geocoder, queries)
+	for i, load := range loads {
+		if len(rows[i].Errors) > 0 {
+			continue
+		}
+		for _, place := range loadPlaces(load) {
+			if !place.needsGeocoding() {
+				continue
+			}
+			result := results[place.query()]
+			switch {
+			case result.Result != nil:
+				place.apply(result.Result)
+			case result.Error == ErrNoGeocoder.Error():
+				rows[i].Warnings = append(rows[i].Warnings, fmt.Sprintf("%s address was not geocoded, no geocoding provider is configured", place.name))
+			default:
+				rows[i].Errors = append(rows[i].Errors, fmt.Sprintf("%s address could not be geocoded", place.name))
+			}
+		}
+	}
+}
+
+// readImportRecords reads the rows of an XLSX workbook, recognized by its ZIP
+// signature, or of a CSV file
+func readImportRecords(fileName string, data []byte) ([][]string, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return ReadXLSXRows(data)
+	}
+	if strings.HasSuffix(strings.ToLower(fileName), ".xlsx") {
+		return nil, errors.New("file is not a valid XLSX workbook")
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	return records, nil
+}
+
+// importColumnIndexes maps the known columns of a header row to their index
+// and returns the headers that aren't known
+func importColumnIndexes(header []string) (map[string]int, []string) {
+	known := make(map[string]bool, len(loadImportColumns))
+	for _, column := range loadImportColumns {
+		known[column] = true
+	}
+
+	columns := make(map[string]int)
+	var unknown []string
+	for i, name := range header {
+		normalized := strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(name)))
+		if normalized == "" {
+			continue
+		}
+		if !known[normalized] {
+			unknown = append(unknown, name)
+			continue
+		}
+		if _, duplicate := columns[normalized]; !duplicate {
+			columns[normalized] = i
+		}
+	}
+	sort.Strings(unknown)
+	return columns, unknown
+}
+
+// parseImportDate parses a date as RFC3339, YYYY-MM-DD, YYYY-MM-DD HH:MM or
+// a spreadsheet serial day number
+func parseImportDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("is required")
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, nil
+		}
+	}
+	// Spreadsheets store dates as days since 30 December 1899
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial > 0 && serial < 2958466 {
+		epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+		return epoch.Add(time.Duration(serial * 24 * float64(time.Hour))).Round(time.Second), nil
+	}
+	return time.Time{}, errors.New("must be a date such as 2024-03-01")
+}
+
+// parseImportBool parses a yes/no cell, empty meaning no
+func parseImportBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "", "no", "n", "false", "0":
+		return false, nil
+	case "yes", "y", "true", "1", "x":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid flag %q", value)
+}
+
+// isBlankRecord reports whether every cell of a record is empty
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// indexOfImportRow returns the index of the row with a file row number
+func indexOfImportRow(rows []*LoadImportRow, number int) int {
+	for i, row := range rows {
+		if row.Row == number {
+			return i
+		}
+	}
+	return -1
+}
+
+// importBatchID returns a random identifier for the booking references of
+// an import's loads
+func importBatchID() (string, error) {
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate booking references: %w", err)
+	}
+	return strings.ToUpper(hex.EncodeToString(buf)), nil
+}
+
+// joinNonEmpty joins the non-empty parts with commas
+func joinNonEmpty(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, ", ")
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrInaccurateLocation is returned for a position reported less accurately
+// than the location filter accepts
+var ErrInaccurateLocation = errors.New("location accuracy worse than the filter allows")
+
+// SetLocationFilter replaces the settings positions are filtered and
+// smoothed with
+func (ts *TrackingService) SetLocationFilter(cfg *config.LocationFilterConfig) {
+	ts.locationFilter = cfg
+}
+
+// SmoothedPosition returns the smoothed position of a tracking record, or
+// its raw position for records recorded without smoothing
+func SmoothedPosition(record models.TrackingRecord) (float64, float64) {
+	if record.SmoothedLatitude != nil && record.SmoothedLongitude != nil {
+		return *record.SmoothedLatitude, *record.SmoothedLongitude
+	}
+	return record.Latitude, record.Longitude
+}
+
+// acceptsLocation reports whether a position is accurate enough to record
+func (ts *TrackingService) acceptsLocation(location LocationUpdate) bool {
+	cfg := ts.locationFilter
+	return !cfg.Enabled || location.Accuracy == nil || *location.Accuracy <= cfg.MaxAccuracyMeters
+}
+
+// smoothLocation sets the smoothed position of a new tracking record with a
+// Kalman filter over the trip's positions: the smoothed position before the
+// record is moved towards the record's position by how much more certain
+// the record is than it. The uncertainty of the earlier position grows with
+// the time since it at the speed the vehicle reports, or at least the
+// configured process noise, so fresh positions of a moving vehicle are
+// followed closely while the jitter of a slow one is smoothed out.
+//
+// Positions reported without an accuracy can't be weighed against the
+// track and are taken as they are.
+func (ts *TrackingService) smoothLocation(tx *gorm.DB, record *models.TrackingRecord) error {
+	cfg := ts.locationFilter
+	if !cfg.Enabled {
+		return nil
+	}
+
+	latitude, longitude := record.Latitude, record.Longitude
+	variance := cfg.DefaultAccuracyMeters * cfg.DefaultAccuracyMeters
+
+	if record.Accuracy != nil {
+		measured := math.Max(*record.Accuracy, 1)
+		measured *= measured
+		variance = measured
+
+		var previous models.TrackingRecord
+		err := tx.Where("trip_id = ? AND timestamp < ? AND smoothed_accuracy IS NOT NULL", record.TripID, record.Timestamp).
+			Order("timestamp DESC").
+			First(&previous).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil {
+			elapsed := math.Max(record.Timestamp.Sub(previous.Timestamp).Seconds(), 1)
+			speed := cfg.ProcessNoiseMps
+			if record.Speed != nil && *record.Speed/3.6 > speed {
+				speed = *record.Speed / 3.6
+			}
+			predicted := *previous.SmoothedAccuracy**previous.SmoothedAccuracy + elapsed*speed*speed
+
+			gain := predicted / (predicted + measured)
+			previousLatitude, previousLongitude := SmoothedPosition(previous)
+			latitude = previousLatitude + gain*(record.Latitude-previousLatitude)
+			longitude = previousLongitude + gain*(record.Longitude-previousLongitude)
+			variance = (1 - gain) * predicted
+		}
+	}
+
+	latitude = math.Round(latitude*1000000) / 1000000
+	longitude = math.Round(longitude*1000000) / 1000000
+	accuracy := math.Round(math.Sqrt(variance)*10) / 10
+	record.SmoothedLatitude = &latitude
+	record.SmoothedLongitude = &longitude
+	record.SmoothedAccuracy = &accuracy
+	return nil
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tripLocationChannelPattern matches the Redis channels of all trips
+const tripLocationChannelPattern = "trip:*:location"
+
+// TripLocationUpdate is a location update streamed to clients following a
+// trip. Tracking events published through the outbox are streamed alongside,
+// with Event set instead of the position.
+type TripLocationUpdate struct {
+	TripID    uint      `json:"trip_id"`
+	RecordID  uint      `json:"record_id"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Altitude  *float64  `json:"altitude,omitempty"`
+	Speed     *float64  `json:"speed,omitempty"`
+	Heading   *float64  `json:"heading,omitempty"`
+	Accuracy  *float64  `json:"accuracy,omitempty"`
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"`
+
+	Event *OutboxMessage `json:"event,omitempty"`
+}
+
+// TripLocationChannel returns the Redis channel of a trip's location updates
+func TripLocationChannel(tripID uint) string {
+	return fmt.Sprintf("trip:%d:location", tripID)
+}
+
+// parseTripLocationChannel returns the trip ID of a trip location channel
+func parseTripLocationChannel(channel string) (uint, error) {
+	parts := strings.Split(channel, ":")
+	if len(parts) != 3 || parts[0] != "trip" || parts[2] != "location" {
+		return 0, fmt.Errorf("not a trip location channel: %s", channel)
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("not a trip location channel: %s", channel)
+	}
+	return uint(id), nil
+}
+
+// LocationHub fans trip location updates out to the clients streaming them.
+// Without Redis, updates only reach clients of this instance. With Redis,
+// updates are published to the trip's channel and every instance relays the
+// channels to its own clients, so clients can connect to any instance.
+type LocationHub struct {
+	redis      *redis.Client
+	bufferSize int
+
+	mu          sync.RWMutex
+	subscribers map[uint]map[chan TripLocationUpdate]struct{}
+	relaying    bool
+}
+
+// NewLocationHub creates a location hub. client may be nil to keep updates
+// within this instance; bufferSize is the number of updates buffered per client.
+func NewLocationHub(client *redis.Client, bufferSize int) *LocationHub {
+	if bufferSize <= 0 {
+		bufferSize = 16
+	}
+	return &LocationHub{
+		redis:       client,
+		bufferSize:  bufferSize,
+		subscribers: make(map[uint]map[chan TripLocationUpdate]struct{}),
+	}
+}
+
+// Global location hub instance
+var (
+	locationHubInstance = NewLocationHub(nil, 0)
+	locationHubMu       sync.RWMutex
+)
+
+// GetLocationHub returns the location hub shared by the tracking service and
+// the location streams
+func GetLocationHub() *LocationHub {
+	locationHubMu.RLock()
+	defer locationHubMu.RUnlock()
+	return locationHubInstance
+}
+
+// SetLocationHub replaces the shared location hub, e.g. with a Redis backed one
+// at startup
+func SetLocationHub(hub *LocationHub) {
+	locationHubMu.Lock()
+	defer locationHubMu.Unlock()
+	locationHubInstance = hub
+}
+
+// Run relays the trip location channels from Redis to the clients of this
+// instance until ctx is cancelled. Until Run is subscribed, or when the hub
+// has no Redis client, updates are delivered locally only.
+func (h *LocationHub) Run(ctx context.Context) error {
+	if h.redis == nil {
+		return errors.New("location hub has no redis client")
+	}
+
+	pubsub := h.redis.PSubscribe(ctx, tripLocationChannelPattern)
+	defer pubsub.Close()
+
+	// Wait for the subscription to be confirmed before publishing to Redis,
+	// otherwise this instance would miss its own updates
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to trip location channels: %w", err)
+	}
+
+	h.setRelaying(true)
+	defer h.setRelaying(false)
+	log.Printf("Relaying trip location updates from Redis")
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			tripID, err := parseTripLocationChannel(message.Channel)
+			if err != nil {
+				continue
+			}
+			var update TripLocationUpdate
+			if err := json.Unmarshal([]byte(message.Payload), &update); err != nil {
+				log.Printf("Invalid location update on %s: %v", message.Channel, err)
+				continue
+			}
+			update.TripID = tripID
+			h.dispatch(update)
+		}
+	}
+}
+
+// Publish sends a location update to every client following the trip. When
+// publishing to Redis fails the update is still delivered locally.
+func (h *LocationHub) Publish(update TripLocationUpdate) error {
+	if !h.isRelaying() {
+		h.dispatch(update)
+		return nil
+	}
+
+	payload, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("failed to encode location update: %w", err)
+	}
+	if err := h.redis.Publish(context.Background(), TripLocationChannel(update.TripID), payload).Err(); err != nil {
+		h.dispatch(update)
+		return fmt.Errorf("failed to publish location update: %w", err)
+	}
+	return nil
+}
+
+// Subscribe returns a channel receiving the location updates of a trip and a
+// function to stop receiving them. Updates are dropped for clients that fall
+// more than the buffer size behind.
+func (h *LocationHub) Subscribe(tripID uint) (<-chan TripLocationUpdate, func()) {
+	updates := make(chan TripLocationUpdate, h.bufferSize)
+
+	h.mu.Lock()
+	if h.subscribers[tripID] == nil {
+		h.subscribers[tripID] = make(map[chan TripLocationUpdate]struct{})
+	}
+	h.subscribers[tripID][updates] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[tripID], updates)
+			if len(h.subscribers[tripID]) == 0 {
+				delete(h.subscribers, tripID)
+			}
+			h.mu.Unlock()
+			close(updates)
+		})
+	}
+	return updates, unsubscribe
+}
+
+// SubscriberCount returns the number of clients of this instance following a trip
+func (h *LocationHub) SubscriberCount(tripID uint) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subscribers[tripID])
+}
+
+// dispatch delivers an update to the local clients following the trip
+func (h *LocationHub) dispatch(update TripLocationUpdate) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for updates := range h.subscribers[update.TripID] {
+		select {
+		case updates <- update:
+		default:
+			// Slow client, drop the update rather than block the others
+		}
+	}
+}
+
+func (h *LocationHub) setRelaying(relaying bool) {
+	h.mu.Lock()
+	h.relaying = relaying
+	h.mu.Unlock()
+}
+
+func (h *LocationHub) isRelaying() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.relaying
+}
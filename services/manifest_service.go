@@ -0,0 +1,328 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"triplink/backend/internal/timezone"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// manifestLoadStatuses are the load statuses included on a trip manifest
+var manifestLoadStatuses = []string{"BOOKED", "PICKED_UP", "IN_TRANSIT"}
+
+// ManifestDocument is the data rendered on a manifest PDF
+type ManifestDocument struct {
+	Manifest models.Manifest
+	Trip     models.Trip
+	Vehicle  *models.Vehicle
+	Carrier  *models.User
+	Loads    []models.Load
+	Shippers map[uint]models.User
+}
+
+// ManifestService aggregates the loads of a trip into a manifest and
+// renders and stores the manifest PDF
+type ManifestService struct {
+	db      *gorm.DB
+	storage FileStorage
+}
+
+// NewManifestService creates a new manifest service instance
+func NewManifestService(db *gorm.DB, storage FileStorage) *ManifestService {
+	return &ManifestService{db: db, storage: storage}
+}
+
+// GenerateManifest creates or refreshes the manifest of a trip from its current
+// loads, renders the PDF and stores it
+func (ms *ManifestService) GenerateManifest(tripID uint) (*models.Manifest, error) {
+	doc, err := ms.BuildManifestDocument(tripID)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Loads) == 0 {
+		return nil, errors.New("no loads found for this trip")
+	}
+
+	manifest := &doc.Manifest
+	if manifest.ID == 0 {
+		manifest.ManifestNumber = fmt.Sprintf("MAN-%d-%d", tripID, time.Now().Unix())
+	}
+	manifest.GeneratedAt = time.Now()
+
+	pdf := RenderManifestPDF(doc)
+	key := fmt.Sprintf("manifests/%d/%s.pdf", tripID, manifest.ManifestNumber)
+	documentURL, err := ms.storage.Put(key, "application/pdf", pdf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store manifest PDF: %w", err)
+	}
+	manifest.DocumentURL = documentURL
+	manifest.DocumentKey = key
+
+	if err := ms.db.Save(manifest).Error; err != nil {
+		return nil, fmt.Errorf("failed to save manifest: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// GetManifestPDF returns the stored PDF of a manifest
+func (ms *ManifestService) GetManifestPDF(manifestID uint) ([]byte, *models.Manifest, error) {
+	var manifest models.Manifest
+	if err := ms.db.First(&manifest, manifestID).Error; err != nil {
+		return nil, nil, errors.New("manifest not found")
+	}
+	if manifest.DocumentKey == "" {
+		return nil, &manifest, errors.New("manifest PDF has not been generated")
+	}
+
+	data, err := ms.storage.Get(manifest.DocumentKey)
+	if err != nil {
+		return nil, &manifest, fmt.Errorf("failed to read manifest PDF: %w", err)
+	}
+	return data, &manifest, nil
+}
+
+// BuildManifestDocument loads the trip, carrier, vehicle, loads and shippers of
+// a manifest and computes its totals
+func (ms *ManifestService) BuildManifestDocument(tripID uint) (*ManifestDocument, error) {
+	doc := &ManifestDocument{Shippers: make(map[uint]models.User)}
+
+	if err := ms.db.First(&doc.Trip, tripID).Error; err != nil {
+		return nil, errors.New("trip not found")
+	}
+
+	var carrier models.User
+	if err := ms.db.First(&carrier, doc.Trip.UserID).Error; err == nil {
+		doc.Carrier = &carrier
+	}
+	if doc.Trip.VehicleID != 0 {
+		var vehicle models.Vehicle
+		if err := ms.db.First(&vehicle, doc.Trip.VehicleID).Error; err == nil {
+			doc.Vehicle = &vehicle
+		}
+	}
+
+	if err := ms.db.Where("trip_id = ? AND status IN ?", tripID, manifestLoadStatuses).
+		Order("id ASC").
+		Find(&doc.Loads).Error; err != nil {
+		return nil, fmt.Errorf("failed to get loads: %w", err)
+	}
+
+	shipperIDs := make([]uint, 0, len(doc.Loads))
+	for _, load := range doc.Loads {
+		shipperIDs = append(shipperIDs, load.ShipperID)
+	}
+	if len(shipperIDs) > 0 {
+		var shippers []models.User
+		ms.db.Where("id IN ?", shipperIDs).Find(&shippers)
+		for _, shipper := range shippers {
+			doc.Shippers[shipper.ID] = shipper
+		}
+	}
+
+	// Reuse the existing manifest of the trip so regenerating keeps its number
+	ms.db.Where("trip_id = ?", tripID).First(&doc.Manifest)
+	doc.Manifest.TripID = tripID
+	applyManifestTotals(&doc.Manifest, doc.Loads)
+
+	return doc, nil
+}
+
+// applyManifestTotals sets the load count, weight, volume, value and countries of a manifest
+func applyManifestTotals(manifest *models.Manifest, loads []models.Load) {
+	manifest.TotalWeight = 0
+	manifest.TotalVolume = 0
+	manifest.TotalValue = 0
+	manifest.LoadCount = len(loads)
+	manifest.OriginCountry = ""
+	manifest.DestinationCountry = ""
+
+	for _, load := range loads {
+		manifest.TotalWeight += load.Weight
+		manifest.TotalVolume += load.Volume
+		manifest.TotalValue += load.Value
+
+		if manifest.OriginCountry == "" {
+			manifest.OriginCountry = load.PickupCountry
+		}
+		if manifest.DestinationCountry == "" {
+			manifest.DestinationCountry = load.DeliveryCountry
+		}
+	}
+}
+
+// manifestColumn is a column of the manifest load table
+type manifestColumn struct {
+	title string
+	x     float64
+	width float64
+}
+
+var manifestColumns = []manifestColumn{
+	{"Ref", 40, 70},
+	{"Description", 110, 120},
+	{"HS Code", 230, 55},
+	{"Qty", 285, 30},
+	{"Weight (kg)", 315, 55},
+	{"Volume (m3)", 370, 55},
+	{"Value", 425, 60},
+	{"Shipper", 485, 70},
+}
+
+// RenderManifestPDF renders a manifest as a PDF document
+func RenderManifestPDF(doc *ManifestDocument) []byte {
+	pdf := NewPDFWriter()
+	const left, right, bottom = 40.0, pdfPageWidth - 40, 60.0
+	const rowHeight = 14.0
+
+	pdf.AddPage()
+	y := pdfPageHeight - 50
+
+	pdf.Text(left, y, 18, true, "CARGO MANIFEST")
+	pdf.Text(right-170, y, 10, false, "No. "+doc.Manifest.ManifestNumber)
+	y -= 16
+	pdf.Text(right-170, y, 9, false, "Generated "+doc.Manifest.GeneratedAt.Format("2006-01-02 15:04 MST"))
+	y -= 24
+
+	// Trip, carrier and vehicle details
+	trip := doc.Trip
+	pdf.Text(left, y, 11, true, "Trip")
+	y -= rowHeight
+	pdf.Text(left, y, 9, false, fmt.Sprintf("Trip #%d: %s -> %s", trip.ID, placeName(trip.OriginAddress, trip.OriginCity, trip.OriginCountry), placeName(trip.DestinationAddress, trip.DestinationCity, trip.DestinationCountry)))
+	y -= rowHeight
+	pdf.Text(left, y, 9, false, fmt.Sprintf("Departure: %s    Estimated arrival: %s",
+		timezone.Format(trip.DepartureDate, trip.OriginTimezone, "2006-01-02 15:04 MST"),
+		timezone.Format(trip.EstimatedArrival, trip.DestinationTimezone, "2006-01-02 15:04 MST")))
+	y -= rowHeight
+	if doc.Carrier != nil {
+		pdf.Text(left, y, 9, false, "Carrier: "+userDisplayName(doc.Carrier))
+		y -= rowHeight
+	}
+	if doc.Vehicle != nil {
+		pdf.Text(left, y, 9, false, fmt.Sprintf("Vehicle: %d %s %s, plate %s", doc.Vehicle.Year, doc.Vehicle.Make, doc.Vehicle.Model, doc.Vehicle.LicensePlate))
+		y -= rowHeight
+	}
+	y -= 10
+
+	drawTableHeader := func() {
+		for _, column := range manifestColumns {
+			pdf.Text(column.x, y, 8, true, column.title)
+		}
+		pdf.Line(left, y-4, right, y-4)
+		y -= rowHeight + 2
+	}
+
+	pdf.Text(left, y, 11, true, "Loads")
+	y -= rowHeight + 2
+	drawTableHeader()
+
+	for _, load := range doc.Loads {
+		if y < bottom {
+			pdf.AddPage()
+			y = pdfPageHeight - 50
+			drawTableHeader()
+		}
+
+		shipper := doc.Shippers[load.ShipperID]
+		values := []string{
+			load.BookingReference,
+			load.Description,
+			load.HSCode,
+			fmt.Sprint(load.Quantity),
+			fmt.Sprintf("%.1f", load.Weight),
+			fmt.Sprintf("%.2f", load.Volume),
+			fmt.Sprintf("%.2f %s", load.Value, load.Currency),
+			userDisplayName(&shipper),
+		}
+		for i, column := range manifestColumns {
+			pdf.Text(column.x, y, 8, false, pdfTruncate(values[i], column.width-4, 8))
+		}
+		y -= rowHeight
+	}
+
+	// Totals
+	pdf.Line(left, y+rowHeight-4, right, y+rowHeight-4)
+	pdf.Text(manifestColumns[0].x, y, 8, true, fmt.Sprintf("Total (%d loads)", doc.Manifest.LoadCount))
+	pdf.Text(manifestColumns[4].x, y, 8, true, fmt.Sprintf("%.1f", doc.Manifest.TotalWeight))
+	pdf.Text(manifestColumns[5].x, y, 8, true, fmt.Sprintf("%.2f", doc.Manifest.TotalVolume))
+	pdf.Text(manifestColumns[6].x, y, 8, true, fmt.Sprintf("%.2f", doc.Manifest.TotalValue))
+	y -= rowHeight * 2
+
+	// Shipper details, in order of first appearance
+	if y < bottom+rowHeight*3 {
+		pdf.AddPage()
+		y = pdfPageHeight - 50
+	}
+	pdf.Text(left, y, 11, true, "Shippers")
+	y -= rowHeight + 2
+
+	seen := make(map[uint]bool)
+	for _, load := range doc.Loads {
+		shipper, exists := doc.Shippers[load.ShipperID]
+		if !exists || seen[shipper.ID] {
+			continue
+		}
+		seen[shipper.ID] = true
+
+		if y < bottom+rowHeight*2 {
+			pdf.AddPage()
+			y = pdfPageHeight - 50
+		}
+
+		pdf.Text(left, y, 9, true, userDisplayName(&shipper))
+		y -= rowHeight - 2
+		details := []string{}
+		if address := placeName(shipper.Address, shipper.City, shipper.Country); address != "" {
+			details = append(details, address)
+		}
+		if shipper.TaxID != "" {
+			details = append(details, "Tax ID "+shipper.TaxID)
+		}
+		if shipper.Email != "" {
+			details = append(details, shipper.Email)
+		}
+		if shipper.Phone != "" {
+			details = append(details, shipper.Phone)
+		}
+		pdf.Text(left, y, 8, false, pdfTruncate(strings.Join(details, " | "), right-left, 8))
+		y -= rowHeight + 4
+	}
+
+	// Page numbers
+	for i := 0; i < pdf.PageCount(); i++ {
+		pdf.SetPage(i)
+		pdf.Text(right-50, 30, 8, false, fmt.Sprintf("Page %d of %d", i+1, pdf.PageCount()))
+	}
+
+	return pdf.Bytes()
+}
+
+// placeName joins the non-empty parts of an address
+func placeName(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, ", ")
+}
+
+// userDisplayName returns the company name of a user, falling back to their name
+func userDisplayName(user *models.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if user.CompanyName != "" {
+		if name != "" {
+			return user.CompanyName + " (" + name + ")"
+		}
+		return user.CompanyName
+	}
+	if name == "" {
+		return fmt.Sprintf("User #%d", user.ID)
+	}
+	return name
+}
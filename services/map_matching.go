@@ -0,0 +1,337 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+	"triplink/backend/tracing"
+
+	"gorm.io/gorm"
+)
+
+// TracePoint is a raw GPS position sent for map matching
+type TracePoint struct {
+	Latitude  float64
+	Longitude float64
+	Timestamp time.Time
+	// Radius in meters in which to look for roads
+	RadiusMeters float64
+}
+
+// MatchedPoint is a position snapped to the road network
+type MatchedPoint struct {
+	Latitude   float64
+	Longitude  float64
+	Confidence float64 // 0-1 scale
+}
+
+// MapMatcher snaps a trace of GPS positions to the road network
+type MapMatcher interface {
+	// MatchTrace returns the matched position of each point of the trace in
+	// order, nil for points that couldn't be matched
+	MatchTrace(ctx context.Context, points []TracePoint) ([]*MatchedPoint, error)
+	Name() string
+}
+
+// DefaultMapMatcher returns the matcher of the configured map matching
+// provider, or nil when matching is disabled
+func DefaultMapMatcher(cfg *config.MapMatchingConfig) MapMatcher {
+	switch cfg.Provider {
+	case "OSRM":
+		return NewOSRMMapMatcher(cfg)
+	case "HERE":
+		return NewHEREMapMatcher(cfg)
+	}
+	return nil
+}
+
+// SetMapMatcher replaces the matcher used to snap tracking records to roads.
+// With no matcher, only raw positions are recorded.
+func (ts *TrackingService) SetMapMatcher(matcher MapMatcher) {
+	ts.mapMatcher = matcher
+}
+
+// TrackPosition returns the position of a tracking record to use for paths
+// and distances: the matched position when there is one, otherwise the raw
+// position. The boolean reports whether the position is matched.
+func TrackPosition(record models.TrackingRecord) (float64, float64, bool) {
+	if record.MatchedLatitude != nil && record.MatchedLongitude != nil {
+		return *record.MatchedLatitude, *record.MatchedLongitude, true
+	}
+	return record.Latitude, record.Longitude, false
+}
+
+// SnapTripRecords map matches a trip's tracking records that haven't been
+// matched yet, returning the number of records matched
+func (ts *TrackingService) SnapTripRecords(tripID uint) (int, error) {
+	return ts.snapRecords(ts.db.Where("trip_id = ?", tripID))
+}
+
+// snapRecords map matches the unmatched tracking records selected by query,
+// a trip's records at a time. Records are sent to the provider in time order
+// in chunks, and chunks of a single record are left as they are since a
+// lone point says nothing about the road being driven on. Matches further
+// from the raw position than the configured maximum are discarded.
+func (ts *TrackingService) snapRecords(query *gorm.DB) (int, error) {
+	if ts.mapMatcher == nil {
+		return 0, nil
+	}
+
+	var records []models.TrackingRecord
+	if err := query.Where("matched_latitude IS NULL").
+		Order("timestamp ASC").Order("id ASC").
+		Find(&records).Error; err != nil {
+		return 0, fmt.Errorf("failed to get tracking records: %w", err)
+	}
+
+	matched := 0
+	size := ts.mapMatching.MaxPointsPerRequest
+	for start := 0; start < len(records); start += size {
+		end := start + size
+		if end > len(records) {
+			end = len(records)
+		}
+		chunk := records[start:end]
+		if len(chunk) < 2 {
+			continue
+		}
+
+		points := make([]TracePoint, len(chunk))
+		for i, record := range chunk {
+			radius := ts.mapMatching.SearchRadiusMeters
+			if record.Accuracy != nil && *record.Accuracy > radius {
+				radius = *record.Accuracy
+			}
+			points[i] = TracePoint{
+				Latitude:     record.Latitude,
+				Longitude:    record.Longitude,
+				Timestamp:    record.Timestamp,
+				RadiusMeters: radius,
+			}
+		}
+
+		results, err := ts.mapMatcher.MatchTrace(ts.ctx, points)
+		if err != nil {
+			return matched, fmt.Errorf("failed to match trace with %s: %w", ts.mapMatcher.Name(), err)
+		}
+		if len(results) != len(chunk) {
+			return matched, fmt.Errorf("%s matched %d points of %d", ts.mapMatcher.Name(), len(results), len(chunk))
+		}
+
+		for i, result := range results {
+			if result == nil {
+				continue
+			}
+			record := chunk[i]
+			snapMeters := geo.Distance(record.Latitude, record.Longitude, result.Latitude, result.Longitude) * 1000
+			if snapMeters > ts.mapMatching.MaxSnapMeters {
+				continue
+			}
+			if err := ts.db.Model(&models.TrackingRecord{}).Where("id = ?", record.ID).UpdateColumns(map[string]interface{}{
+				"matched_latitude":  result.Latitude,
+				"matched_longitude": result.Longitude,
+				"match_confidence":  result.Confidence,
+			}).Error; err != nil {
+				return matched, fmt.Errorf("failed to save matched position: %w", err)
+			}
+			matched++
+		}
+	}
+
+	return matched, nil
+}
+
+// OSRMMapMatcher matches traces with the match service of an OSRM server
+type OSRMMapMatcher struct {
+	BaseURL    string
+	Profile    string
+	HTTPClient *http.Client
+}
+
+// NewOSRMMapMatcher creates an OSRM map matcher
+func NewOSRMMapMatcher(cfg *config.MapMatchingConfig) *OSRMMapMatcher {
+	return &OSRMMapMatcher{
+		BaseURL: strings.TrimSuffix(cfg.OSRMURL, "/"),
+		Profile: cfg.OSRMProfile,
+		HTTPClient: &http.Client{
+			Timeout:   cfg.HTTPTimeout,
+			Transport: tracing.Transport(nil),
+		},
+	}
+}
+
+// Name returns the matcher's name
+func (m *OSRMMapMatcher) Name() string {
+	return "OSRM"
+}
+
+// osrmMatchResponse is the part of the OSRM match response used here
+type osrmMatchResponse struct {
+	Code        string `json:"code"`
+	Message     string `json:"message"`
+	Tracepoints []*struct {
+		Location      []float64 `json:"location"` // longitude, latitude
+		MatchingIndex int       `json:"matchings_index"`
+	} `json:"tracepoints"`
+	Matchings []struct {
+		Confidence float64 `json:"confidence"`
+	} `json:"matchings"`
+}
+
+// MatchTrace matches a trace with the OSRM match service
+func (m *OSRMMapMatcher) MatchTrace(ctx context.Context, points []TracePoint) ([]*MatchedPoint, error) {
+	coordinates := make([]string, len(points))
+	timestamps := make([]string, len(points))
+	radiuses := make([]string, len(points))
+	for i, point := range points {
+		coordinates[i] = fmt.Sprintf("%.6f,%.6f", point.Longitude, point.Latitude)
+		timestamps[i] = strconv.FormatInt(point.Timestamp.Unix(), 10)
+		radiuses[i] = strconv.FormatFloat(point.RadiusMeters, 'f', 1, 64)
+	}
+
+	params := url.Values{}
+	params.Set("timestamps", strings.Join(timestamps, ";"))
+	params.Set("radiuses", strings.Join(radiuses, ";"))
+	params.Set("overview", "false")
+	params.Set("gaps", "split")
+	apiURL := fmt.Sprintf("%s/match/v1/%s/%s?%s", m.BaseURL, m.Profile, strings.Join(coordinates, ";"), params.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := m.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match trace: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var matchResp osrmMatchResponse
+	if err := json.Unmarshal(body, &matchResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	results := make([]*MatchedPoint, len(points))
+	// NoMatch means no road was found near the trace, which isn't an error
+	if matchResp.Code == "NoMatch" {
+		return results, nil
+	}
+	if resp.StatusCode != http.StatusOK || matchResp.Code != "Ok" {
+		return nil, fmt.Errorf("OSRM match request failed with status %d: %s %s", resp.StatusCode, matchResp.Code, matchResp.Message)
+	}
+
+	for i, tracepoint := range matchResp.Tracepoints {
+		if i >= len(results) || tracepoint == nil || len(tracepoint.Location) != 2 {
+			continue
+		}
+		result := &MatchedPoint{Latitude: tracepoint.Location[1], Longitude: tracepoint.Location[0]}
+		if tracepoint.MatchingIndex < len(matchResp.Matchings) {
+			result.Confidence = matchResp.Matchings[tracepoint.MatchingIndex].Confidence
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// HEREMapMatcher matches traces with the HERE Route Matching API
+type HEREMapMatcher struct {
+	APIKey     string
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewHEREMapMatcher creates a HERE map matcher
+func NewHEREMapMatcher(cfg *config.MapMatchingConfig) *HEREMapMatcher {
+	return &HEREMapMatcher{
+		APIKey:  cfg.HEREAPIKey,
+		BaseURL: cfg.HEREMatchURL,
+		HTTPClient: &http.Client{
+			Timeout:   cfg.HTTPTimeout,
+			Transport: tracing.Transport(nil),
+		},
+	}
+}
+
+// Name returns the matcher's name
+func (m *HEREMapMatcher) Name() string {
+	return "HERE"
+}
+
+// hereMatchResponse is the part of the HERE route matching response used here
+type hereMatchResponse struct {
+	TracePoints []struct {
+		LatMatched      float64 `json:"latMatched"`
+		LonMatched      float64 `json:"lonMatched"`
+		ConfidenceValue float64 `json:"confidenceValue"`
+		LinkIDMatched   int64   `json:"linkIdMatched"`
+	} `json:"TracePoints"`
+}
+
+// MatchTrace matches a trace with the HERE Route Matching API, which takes
+// the trace as CSV
+func (m *HEREMapMatcher) MatchTrace(ctx context.Context, points []TracePoint) ([]*MatchedPoint, error) {
+	var trace strings.Builder
+	trace.WriteString("LATITUDE,LONGITUDE,TIMESTAMP\n")
+	for _, point := range points {
+		fmt.Fprintf(&trace, "%.6f,%.6f,%s\n", point.Latitude, point.Longitude, point.Timestamp.UTC().Format(time.RFC3339))
+	}
+
+	params := url.Values{}
+	params.Set("apikey", m.APIKey)
+	params.Set("routemode", "car")
+	apiURL := fmt.Sprintf("%s?%s", m.BaseURL, params.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, strings.NewReader(trace.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/csv")
+
+	resp, err := m.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match trace: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HERE route matching request failed with status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var matchResp hereMatchResponse
+	if err := json.Unmarshal(body, &matchResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	results := make([]*MatchedPoint, len(points))
+	for i, tracePoint := range matchResp.TracePoints {
+		// Points not matched to a link have no link ID
+		if i >= len(results) || tracePoint.LinkIDMatched == 0 {
+			continue
+		}
+		results[i] = &MatchedPoint{
+			Latitude:   tracePoint.LatMatched,
+			Longitude:  tracePoint.LonMatched,
+			Confidence: tracePoint.ConfidenceValue,
+		}
+	}
+	return results, nil
+}
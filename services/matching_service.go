@@ -0,0 +1,335 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// MatchingService matches unassigned loads with trips that can carry them
+type MatchingService struct {
+	db *gorm.DB
+}
+
+// NewMatchingService creates a new matching service instance
+func NewMatchingService(db *gorm.DB) *MatchingService {
+	return &MatchingService{db: db}
+}
+
+// MatchOptions controls how candidate trips are searched and ranked
+type MatchOptions struct {
+	// Maximum distance in km between the trip route and the load pickup or delivery
+	MaxDeviationKm float64
+	// Maximum number of candidates returned
+	Limit int
+	// Pickup and delivery dates may fall outside the trip dates by this much
+	DateFlexibility time.Duration
+}
+
+// DefaultMatchOptions returns the default matching options
+func DefaultMatchOptions() MatchOptions {
+	return MatchOptions{
+		MaxDeviationKm:  100,
+		Limit:           10,
+		DateFlexibility: 24 * time.Hour,
+	}
+}
+
+// MatchScoreBreakdown shows how each criterion contributed to a match score
+type MatchScoreBreakdown struct {
+	RouteProximity float64 `json:"route_proximity"` // 0-40
+	Capacity       float64 `json:"capacity"`        // 0-25
+	DateWindow     float64 `json:"date_window"`     // 0-25
+	Vehicle        float64 `json:"vehicle"`         // 0-10
+}
+
+// MatchCandidate is a trip that can carry a load, with its match score
+type MatchCandidate struct {
+	Trip                models.Trip         `json:"trip"`
+	Vehicle             *models.Vehicle     `json:"vehicle,omitempty"`
+	Score               float64             `json:"score"` // 0-100
+	Breakdown           MatchScoreBreakdown `json:"breakdown"`
+	PickupDeviationKm   float64             `json:"pickup_deviation_km"`
+	DeliveryDeviationKm float64             `json:"delivery_deviation_km"`
+	RemainingWeight     float64             `json:"remaining_weight"`
+	RemainingVolume     float64             `json:"remaining_volume"`
+}
+
+// FindTripsForLoad returns trips that can carry an unassigned load, ranked by
+// route proximity, remaining capacity, vehicle suitability and date windows.
+// Trips whose drivers took time off during them are left out.
+func (ms *MatchingService) FindTripsForLoad(loadID uint, opts MatchOptions) ([]MatchCandidate, error) {
+	var load models.Load
+	if err := ms.db.First(&load, loadID).Error; err != nil {
+		return nil, err
+	}
+	if load.TripID != 0 {
+		return nil, errors.New("load is already assigned to a trip")
+	}
+
+	defaults := DefaultMatchOptions()
+	if opts.MaxDeviationKm <= 0 {
+		opts.MaxDeviationKm = defaults.MaxDeviationKm
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaults.Limit
+	}
+
+	// Trips that have not departed yet, with enough remaining capacity and
+	// dates overlapping the load's pickup/delivery window
+	query := ms.db.Where("status IN ?", []string{"PLANNED", "ACTIVE"}).
+		Where("is_public = ?", true).
+		Where("total_capacity_weight - used_weight >= ?", load.Weight).
+		Where("total_capacity_volume - used_volume >= ?", load.Volume)
+	if !load.RequestedDeliveryDate.IsZero() {
+		query = query.Where("departure_date <= ?", load.RequestedDeliveryDate.Add(opts.DateFlexibility))
+	}
+	if !load.RequestedPickupDate.IsZero() {
+		query = query.Where("estimated_arrival >= ?", load.RequestedPickupDate.Add(-opts.DateFlexibility))
+	}
+
+	var trips []models.Trip
+	if err := query.Find(&trips).Error; err != nil {
+		return nil, err
+	}
+
+	vehicles, err := ms.getVehicles(trips)
+	if err != nil {
+		return nil, err
+	}
+	unavailable, err := ms.getUnavailableTrips(trips)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]MatchCandidate, 0, len(trips))
+	for _, trip := range trips {
+		if unavailable[trip.ID] {
+			continue
+		}
+		vehicle := vehicles[trip.VehicleID]
+		if !vehicleMeetsRequirements(vehicle, &load) {
+			continue
+		}
+
+		candidate, ok := scoreTripForLoad(&trip, vehicle, &load, opts)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+
+	if len(candidates) > opts.Limit {
+		candidates = candidates[:opts.Limit]
+	}
+
+	return candidates, nil
+}
+
+// getVehicles loads the vehicles of the given trips keyed by vehicle ID
+func (ms *MatchingService) getVehicles(trips []models.Trip) (map[uint]*models.Vehicle, error) {
+	vehicleIDs := make([]uint, 0, len(trips))
+	for _, trip := range trips {
+		if trip.VehicleID != 0 {
+			vehicleIDs = append(vehicleIDs, trip.VehicleID)
+		}
+	}
+
+	result := make(map[uint]*models.Vehicle)
+	if len(vehicleIDs) == 0 {
+		return result, nil
+	}
+
+	var vehicles []models.Vehicle
+	if err := ms.db.Where("id IN ?", vehicleIDs).Find(&vehicles).Error; err != nil {
+		return nil, err
+	}
+	for i := range vehicles {
+		result[vehicles[i].ID] = &vehicles[i]
+	}
+	return result, nil
+}
+
+// getUnavailableTrips returns the given trips a driver assigned to them is on
+// time off during, which can't take loads until they're reassigned
+func (ms *MatchingService) getUnavailableTrips(trips []models.Trip) (map[uint]bool, error) {
+	unavailable := make(map[uint]bool)
+	if len(trips) == 0 {
+		return unavailable, nil
+	}
+	byID := make(map[uint]*models.Trip, len(trips))
+	tripIDs := make([]uint, 0, len(trips))
+	for i := range trips {
+		byID[trips[i].ID] = &trips[i]
+		tripIDs = append(tripIDs, trips[i].ID)
+	}
+
+	var assignments []models.TripAssignment
+	if err := ms.db.Where("trip_id IN ?", tripIDs).
+		Where("ends_at IS NULL OR ends_at > ?", time.Now()).
+		Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+	for _, assignment := range assignments {
+		if unavailable[assignment.TripID] {
+			continue
+		}
+		end := TripEnd(byID[assignment.TripID])
+		if assignment.EndsAt != nil {
+			end = *assignment.EndsAt
+		}
+		timeOff, err := driverTimeOff(ms.db, assignment.DriverID, assignment.StartsAt, end)
+		if err != nil {
+			return nil, err
+		}
+		unavailable[assignment.TripID] = timeOff != nil
+	}
+	return unavailable, nil
+}
+
+// vehicleMeetsRequirements checks the hard vehicle requirements of a load.
+// Trips without a known vehicle only match loads without special requirements.
+func vehicleMeetsRequirements(vehicle *models.Vehicle, load *models.Load) bool {
+	if vehicle == nil {
+		return !load.RequiresRefrigeration && !load.IsHazmat
+	}
+	if !vehicle.IsActive {
+		return false
+	}
+	if load.RequiresRefrigeration && !vehicle.IsRefrigerated {
+		return false
+	}
+	if load.IsHazmat && !vehicle.IsHazmatCertified {
+		return false
+	}
+
+	// Dimension limits, when both sides are known
+	if vehicle.MaxLength > 0 && load.Length > vehicle.MaxLength {
+		return false
+	}
+	if vehicle.MaxWidth > 0 && load.Width > vehicle.MaxWidth {
+		return false
+	}
+	if vehicle.MaxHeight > 0 && load.Height > vehicle.MaxHeight {
+		return false
+	}
+	return true
+}
+
+// scoreTripForLoad scores how well a trip fits a load. It returns false when the
+// load pickup or delivery is too far from the trip route or in the wrong direction.
+func scoreTripForLoad(trip *models.Trip, vehicle *models.Vehicle, load *models.Load, opts MatchOptions) (MatchCandidate, bool) {
+	route := tripRoutePath(trip)
+	pickupMeters, pickupProgress := ProjectOntoPath(route, Coordinate{Latitude: load.PickupLat, Longitude: load.PickupLng})
+	deliveryMeters, deliveryProgress := ProjectOntoPath(route, Coordinate{Latitude: load.DeliveryLat, Longitude: load.DeliveryLng})
+	pickupKm := pickupMeters / 1000
+	deliveryKm := deliveryMeters / 1000
+
+	if pickupKm > opts.MaxDeviationKm || deliveryKm > opts.MaxDeviationKm {
+		return MatchCandidate{}, false
+	}
+	// The pickup must come before the delivery along the route
+	if pickupProgress > deliveryProgress {
+		return MatchCandidate{}, false
+	}
+
+	remainingWeight := trip.TotalCapacityWeight - trip.UsedWeight
+	remainingVolume := trip.TotalCapacityVolume - trip.UsedVolume
+
+	breakdown := MatchScoreBreakdown{
+		RouteProximity: 40 * (1 - (pickupKm+deliveryKm)/(2*opts.MaxDeviationKm)),
+		Capacity:       25 * capacityFitScore(load, remainingWeight, remainingVolume),
+		DateWindow:     25 * dateWindowScore(trip, load),
+		Vehicle:        10 * vehicleFitScore(vehicle, load),
+	}
+
+	score := breakdown.RouteProximity + breakdown.Capacity + breakdown.DateWindow + breakdown.Vehicle
+
+	return MatchCandidate{
+		Trip:                *trip,
+		Vehicle:             vehicle,
+		Score:               math.Round(score*100) / 100,
+		Breakdown:           breakdown,
+		PickupDeviationKm:   pickupKm,
+		DeliveryDeviationKm: deliveryKm,
+		RemainingWeight:     remainingWeight,
+		RemainingVolume:     remainingVolume,
+	}, true
+}
+
+// tripRoutePath returns the planned route of a trip, or the straight line
+// from origin to destination when no route has been planned
+func tripRoutePath(trip *models.Trip) []Coordinate {
+	if trip.PlannedRoutePolyline != "" {
+		if planned, err := DecodePolyline(trip.PlannedRoutePolyline); err == nil && len(planned) >= 2 {
+			return planned
+		}
+	}
+	return []Coordinate{
+		{Latitude: trip.OriginLat, Longitude: trip.OriginLng},
+		{Latitude: trip.DestinationLat, Longitude: trip.DestinationLng},
+	}
+}
+
+// capacityFitScore favours trips the load fills well, so large trips stay
+// available for large loads. Returns 0-1.
+func capacityFitScore(load *models.Load, remainingWeight, remainingVolume float64) float64 {
+	var ratios []float64
+	if remainingWeight > 0 && load.Weight > 0 {
+		ratios = append(ratios, load.Weight/remainingWeight)
+	}
+	if remainingVolume > 0 && load.Volume > 0 {
+		ratios = append(ratios, load.Volume/remainingVolume)
+	}
+	if len(ratios) == 0 {
+		return 0.5
+	}
+
+	best := 0.0
+	for _, ratio := range ratios {
+		best = math.Max(best, ratio)
+	}
+	// A load using at least 20% of the remaining capacity is a good fit
+	return math.Min(1, 0.5+best*2.5)
+}
+
+// dateWindowScore favours trips departing close to the requested pickup date
+// and arriving before the requested delivery date. Returns 0-1.
+func dateWindowScore(trip *models.Trip, load *models.Load) float64 {
+	if load.RequestedPickupDate.IsZero() {
+		return 0.5
+	}
+
+	hoursOff := math.Abs(trip.DepartureDate.Sub(load.RequestedPickupDate).Hours())
+	score := math.Max(0, 1-hoursOff/72)
+
+	if !load.RequestedDeliveryDate.IsZero() && trip.EstimatedArrival.After(load.RequestedDeliveryDate) {
+		score *= 0.5
+	}
+	return score
+}
+
+// vehicleFitScore favours vehicles whose special equipment is actually needed,
+// keeping reefers and hazmat-certified vehicles for the loads that require them. Returns 0-1.
+func vehicleFitScore(vehicle *models.Vehicle, load *models.Load) float64 {
+	if vehicle == nil {
+		return 0.5
+	}
+
+	score := 1.0
+	if vehicle.IsRefrigerated && !load.RequiresRefrigeration {
+		score -= 0.25
+	}
+	if vehicle.IsHazmatCertified && !load.IsHazmat {
+		score -= 0.25
+	}
+	return score
+}
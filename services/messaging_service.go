@@ -0,0 +1,328 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// maxMessageLength caps the length of a message in characters
+const maxMessageLength = 4000
+
+// ConversationRequest is the data needed to start a conversation
+type ConversationRequest struct {
+	LoadID         *uint  `json:"load_id"`
+	TripID         *uint  `json:"trip_id"`
+	Subject        string `json:"subject"`
+	ParticipantIDs []uint `json:"participant_ids"`
+}
+
+// ConversationSummary is a conversation with its latest message and the
+// number of messages the user hasn't read
+type ConversationSummary struct {
+	Conversation models.Conversation `json:"conversation"`
+	LastMessage  *models.Message     `json:"last_message"`
+	UnreadCount  int64               `json:"unread_count"`
+}
+
+// MessagingService groups messages into conversations per load or trip and
+// tracks what each participant has read
+type MessagingService struct {
+	db       *gorm.DB
+	triggers *NotificationTriggerService
+}
+
+// NewMessagingService creates a new messaging service instance
+func NewMessagingService(db *gorm.DB) *MessagingService {
+	return &MessagingService{
+		db:       db,
+		triggers: NewNotificationTriggerService(db),
+	}
+}
+
+// StartConversation returns the conversation between the creator and the
+// requested participants about a load or trip, creating it if needed. The
+// shipper and carrier of the load or trip are always participants.
+func (ms *MessagingService) StartConversation(creatorID uint, req ConversationRequest) (*models.Conversation, bool, error) {
+	participantIDs := append([]uint{creatorID}, req.ParticipantIDs...)
+
+	if req.LoadID != nil {
+		var load models.Load
+		if err := ms.db.First(&load, *req.LoadID).Error; err != nil {
+			return nil, false, errors.New("load not found")
+		}
+		participantIDs = append(participantIDs, load.ShipperID)
+		if load.TripID != 0 {
+			var trip models.Trip
+			if err := ms.db.First(&trip, load.TripID).Error; err == nil {
+				participantIDs = append(participantIDs, trip.UserID)
+			}
+		}
+	}
+	if req.TripID != nil {
+		var trip models.Trip
+		if err := ms.db.First(&trip, *req.TripID).Error; err != nil {
+			return nil, false, errors.New("trip not found")
+		}
+		participantIDs = append(participantIDs, trip.UserID)
+	}
+
+	participantIDs = uniqueIDs(participantIDs)
+	if len(participantIDs) < 2 {
+		return nil, false, errors.New("a conversation needs at least two participants")
+	}
+
+	var userCount int64
+	ms.db.Model(&models.User{}).Where("id IN ?", participantIDs).Count(&userCount)
+	if int(userCount) != len(participantIDs) {
+		return nil, false, errors.New("participant not found")
+	}
+
+	if existing := ms.findConversation(req.LoadID, req.TripID, participantIDs); existing != nil {
+		return existing, false, nil
+	}
+
+	conversation := models.Conversation{
+		LoadID:    req.LoadID,
+		TripID:    req.TripID,
+		Subject:   strings.TrimSpace(req.Subject),
+		CreatedBy: creatorID,
+	}
+	for _, userID := range participantIDs {
+		conversation.Participants = append(conversation.Participants, models.ConversationParticipant{UserID: userID})
+	}
+	if err := ms.db.Create(&conversation).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to create conversation: %w", err)
+	}
+
+	return &conversation, true, nil
+}
+
+// findConversation returns the conversation about the same load or trip with
+// exactly the given participants
+func (ms *MessagingService) findConversation(loadID, tripID *uint, participantIDs []uint) *models.Conversation {
+	query := ms.db.Preload("Participants").
+		Joins("JOIN conversation_participants ON conversation_participants.conversation_id = conversations.id").
+		Where("conversation_participants.user_id = ?", participantIDs[0])
+	if loadID != nil {
+		query = query.Where("conversations.load_id = ?", *loadID)
+	} else {
+		query = query.Where("conversations.load_id IS NULL")
+	}
+	if tripID != nil {
+		query = query.Where("conversations.trip_id = ?", *tripID)
+	} else {
+		query = query.Where("conversations.trip_id IS NULL")
+	}
+
+	var candidates []models.Conversation
+	if err := query.Find(&candidates).Error; err != nil {
+		return nil
+	}
+
+	for i := range candidates {
+		ids := make([]uint, 0, len(candidates[i].Participants))
+		for _, participant := range candidates[i].Participants {
+			ids = append(ids, participant.UserID)
+		}
+		if sameIDs(ids, participantIDs) {
+			return &candidates[i]
+		}
+	}
+	return nil
+}
+
+// SendDirectMessage sends a message in the direct conversation between two users
+func (ms *MessagingService) SendDirectMessage(senderID, receiverID uint, content string) (*models.Message, error) {
+	conversation, _, err := ms.StartConversation(senderID, ConversationRequest{ParticipantIDs: []uint{receiverID}})
+	if err != nil {
+		return nil, err
+	}
+	return ms.SendMessage(conversation.ID, senderID, content)
+}
+
+// SendMessage adds a message to a conversation and notifies the other participants
+func (ms *MessagingService) SendMessage(conversationID, senderID uint, content string) (*models.Message, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, errors.New("message content is required")
+	}
+	if len([]rune(content)) > maxMessageLength {
+		return nil, fmt.Errorf("message cannot be longer than %d characters", maxMessageLength)
+	}
+
+	var participants []models.ConversationParticipant
+	if err := ms.db.Where("conversation_id = ?", conversationID).Find(&participants).Error; err != nil || len(participants) == 0 {
+		return nil, errors.New("conversation not found")
+	}
+
+	isParticipant := false
+	receiverID := uint(0)
+	for _, participant := range participants {
+		if participant.UserID == senderID {
+			isParticipant = true
+		} else if len(participants) == 2 {
+			receiverID = participant.UserID
+		}
+	}
+	if !isParticipant {
+		return nil, errors.New("sender is not a participant of this conversation")
+	}
+
+	message := models.Message{
+		ConversationID: &conversationID,
+		SenderID:       senderID,
+		ReceiverID:     receiverID,
+		Content:        content,
+	}
+	err := ms.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&message).Error; err != nil {
+			return fmt.Errorf("failed to create message: %w", err)
+		}
+		if err := tx.Model(&models.Conversation{}).Where("id = ?", conversationID).
+			Update("last_message_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to update conversation: %w", err)
+		}
+		// Senders have read their own messages
+		return tx.Model(&models.ConversationParticipant{}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, senderID).
+			Update("last_read_message_id", message.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ms.triggers.MessageReceivedHandler(message.ID)
+
+	return &message, nil
+}
+
+// IsParticipant reports whether a user is a participant of a conversation
+func (ms *MessagingService) IsParticipant(conversationID, userID uint) bool {
+	var count int64
+	ms.db.Model(&models.ConversationParticipant{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Count(&count)
+	return count > 0
+}
+
+// GetUserConversations returns a user's conversations, most recently active first
+func (ms *MessagingService) GetUserConversations(userID uint) ([]ConversationSummary, error) {
+	var conversations []models.Conversation
+	if err := ms.db.Preload("Participants").
+		Joins("JOIN conversation_participants ON conversation_participants.conversation_id = conversations.id").
+		Where("conversation_participants.user_id = ?", userID).
+		Order("conversations.id DESC").
+		Find(&conversations).Error; err != nil {
+		return nil, fmt.Errorf("failed to get conversations: %w", err)
+	}
+
+	unread, _, err := ms.GetUnreadCounts(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]ConversationSummary, 0, len(conversations))
+	for _, conversation := range conversations {
+		summary := ConversationSummary{
+			Conversation: conversation,
+			UnreadCount:  unread[conversation.ID],
+		}
+		var lastMessage models.Message
+		if err := ms.db.Where("conversation_id = ?", conversation.ID).Order("id DESC").First(&lastMessage).Error; err == nil {
+			summary.LastMessage = &lastMessage
+		}
+		summaries = append(summaries, summary)
+	}
+
+	// Most recently active first; conversations without messages by creation time
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return conversationActivity(&summaries[i].Conversation).After(conversationActivity(&summaries[j].Conversation))
+	})
+	return summaries, nil
+}
+
+// MarkConversationRead marks all messages of a conversation as read by a user
+func (ms *MessagingService) MarkConversationRead(conversationID, userID uint) error {
+	if !ms.IsParticipant(conversationID, userID) {
+		return errors.New("user is not a participant of this conversation")
+	}
+
+	var lastMessage models.Message
+	if err := ms.db.Where("conversation_id = ?", conversationID).Order("id DESC").First(&lastMessage).Error; err != nil {
+		return nil // nothing to read
+	}
+
+	return ms.db.Model(&models.ConversationParticipant{}).
+		Where("conversation_id = ? AND user_id = ? AND last_read_message_id < ?", conversationID, userID, lastMessage.ID).
+		Update("last_read_message_id", lastMessage.ID).Error
+}
+
+// GetUnreadCounts returns the number of unread messages per conversation of a
+// user and in total
+func (ms *MessagingService) GetUnreadCounts(userID uint) (map[uint]int64, int64, error) {
+	var rows []struct {
+		ConversationID uint
+		Unread         int64
+	}
+	if err := ms.db.Model(&models.Message{}).
+		Select("messages.conversation_id AS conversation_id, COUNT(*) AS unread").
+		Joins("JOIN conversation_participants ON conversation_participants.conversation_id = messages.conversation_id").
+		Where("conversation_participants.user_id = ?", userID).
+		Where("messages.sender_id <> ? AND messages.id > conversation_participants.last_read_message_id", userID).
+		Group("messages.conversation_id").
+		Scan(&rows).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count unread messages: %w", err)
+	}
+
+	counts := make(map[uint]int64, len(rows))
+	var total int64
+	for _, row := range rows {
+		counts[row.ConversationID] = row.Unread
+		total += row.Unread
+	}
+	return counts, total, nil
+}
+
+func conversationActivity(conversation *models.Conversation) time.Time {
+	if conversation.LastMessageAt != nil {
+		return *conversation.LastMessageAt
+	}
+	return conversation.CreatedAt
+}
+
+// uniqueIDs removes zero and duplicate IDs, keeping the first occurrence
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
+
+// sameIDs reports whether two ID lists contain the same IDs
+func sameIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[uint]bool, len(a))
+	for _, id := range a {
+		seen[id] = true
+	}
+	for _, id := range b {
+		if !seen[id] {
+			return false
+		}
+	}
+	return true
+}
@@ -6,9 +6,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strings"
 	"time"
+	"triplink/backend/config"
 )
 
 // ML Service for Hugging Face model integration
@@ -20,7 +20,7 @@ type MLService struct {
 
 func NewMLService() *MLService {
 	return &MLService{
-		APIKey:  os.Getenv("HUGGINGFACE_API_KEY"),
+		APIKey:  config.GetAPIKeysConfig().HuggingFace,
 		BaseURL: "https://api-inference.huggingface.co/models",
 		HTTPClient: &http.Client{
 			Timeout: 30 * time.Second,
@@ -52,6 +52,8 @@ type DelayPredictionResult struct {
 	Recommendations   []string            `json:"recommendations"`
 	ModelUsed         string              `json:"model_used"`
 	PredictionTime    time.Time           `json:"prediction_time"`
+	TripID            uint                `json:"trip_id,omitempty"`
+	PredictedArrival  *time.Time          `json:"predicted_arrival,omitempty"`
 }
 
 type PredictionFactor struct {
@@ -204,47 +206,47 @@ func (ml *MLService) AnalyzeSentiment(text string) (*SentimentAnalysisResult, er
 	}, nil
 }
 
-// Predict delivery delays using ML models
+// PredictDeliveryDelay predicts how late a delivery arrives with the delay
+// model trained on completed trips. With a trip_id the trip is predicted
+// and the prediction recorded; otherwise the trip is described by its
+// origin_city, destination_city, carrier_id, departure_time (RFC3339),
+// distance (km) and weather condition.
 func (ml *MLService) PredictDeliveryDelay(routeData map[string]interface{}) (*DelayPredictionResult, error) {
-	// Use a regression model for delay prediction
-	modelName := "microsoft/DialoGPT-medium" // Placeholder - would use a custom trained model
-
-	// Prepare input features for the model
-	inputText := ml.prepareDelayPredictionInput(routeData)
-
-	// For demonstration, using text generation model
-	// In production, would use a custom regression model
-	apiURL := fmt.Sprintf("%s/%s", ml.BaseURL, modelName)
-
-	requestBody := map[string]interface{}{
-		"inputs": inputText,
-		"parameters": map[string]interface{}{
-			"max_length": 100,
-			"temperature": 0.3,
-		},
+	delays := GetDelayModelService()
+	if delays == nil {
+		return nil, ErrNoDelayModel
 	}
 
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	if tripID, ok := routeData["trip_id"].(float64); ok && tripID > 0 {
+		return delays.PredictTrip(uint(tripID))
 	}
 
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	in := delayInput{Departure: time.Now()}
+	in.OriginCity, _ = routeData["origin_city"].(string)
+	in.DestinationCity, _ = routeData["destination_city"].(string)
+	in.DistanceKm, _ = routeData["distance"].(float64)
+	if carrierID, ok := routeData["carrier_id"].(float64); ok && carrierID > 0 {
+		in.CarrierID = uint(carrierID)
+	}
+	if departure, ok := routeData["departure_time"].(string); ok && departure != "" {
+		parsed, err := time.Parse(time.RFC3339, departure)
+		if err != nil {
+			return nil, fmt.Errorf("invalid departure time: %w", err)
+		}
+		in.Departure = parsed
+	}
+	if weather, ok := routeData["weather"].(string); ok {
+		in.WeatherSlowdown = delays.weatherConditionSlowdown(weather)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+ml.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := ml.HTTPClient.Do(req)
+	result, err := delays.Predict(in)
 	if err != nil {
-		return ml.getMockDelayPrediction(routeData), nil
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	// For now, return mock data as we would need a properly trained model
-	return ml.getMockDelayPrediction(routeData), nil
+	if routeID, ok := routeData["route_id"].(string); ok && routeID != "" {
+		result.RouteID = routeID
+	}
+	return result, nil
 }
 
 // Predict customer satisfaction using ML
@@ -334,26 +336,6 @@ func (ml *MLService) OptimizeRouteWithML(routeData map[string]interface{}) (*Rou
 
 // Helper functions for mock data and input preparation
 
-func (ml *MLService) prepareDelayPredictionInput(routeData map[string]interface{}) string {
-	// Convert route data to text input for the model
-	var inputParts []string
-
-	if distance, ok := routeData["distance"].(float64); ok {
-		inputParts = append(inputParts, fmt.Sprintf("Distance: %.1f km", distance))
-	}
-	if trafficLevel, ok := routeData["traffic_level"].(string); ok {
-		inputParts = append(inputParts, fmt.Sprintf("Traffic: %s", trafficLevel))
-	}
-	if weather, ok := routeData["weather"].(string); ok {
-		inputParts = append(inputParts, fmt.Sprintf("Weather: %s", weather))
-	}
-	if timeOfDay, ok := routeData["time_of_day"].(string); ok {
-		inputParts = append(inputParts, fmt.Sprintf("Time: %s", timeOfDay))
-	}
-
-	return "Predict delivery delay for route with " + strings.Join(inputParts, ", ")
-}
-
 func (ml *MLService) getMockSentimentAnalysis(text string) *SentimentAnalysisResult {
 	// Intelligent mock based on text content
 	textLower := strings.ToLower(text)
@@ -400,54 +382,6 @@ func (ml *MLService) getMockSentimentAnalysis(text string) *SentimentAnalysisRes
 	}
 }
 
-func (ml *MLService) getMockDelayPrediction(routeData map[string]interface{}) *DelayPredictionResult {
-	// Generate intelligent mock delay prediction
-	baseDelay := 12.0 // Base delay in minutes
-
-	factors := []PredictionFactor{
-		{
-			Factor:      "traffic_congestion",
-			Impact:      0.6,
-			Confidence:  0.85,
-			Description: "Moderate traffic congestion expected during peak hours",
-		},
-		{
-			Factor:      "weather_conditions",
-			Impact:      0.2,
-			Confidence:  0.92,
-			Description: "Clear weather with minimal impact on travel time",
-		},
-		{
-			Factor:      "route_complexity",
-			Impact:      0.3,
-			Confidence:  0.78,
-			Description: "Multiple stops and urban routing increase complexity",
-		},
-	}
-
-	recommendations := []string{
-		"Depart 15 minutes earlier to account for predicted delay",
-		"Monitor traffic conditions before departure",
-		"Consider alternative route during peak hours",
-	}
-
-	routeID := "default_route"
-	if id, ok := routeData["route_id"].(string); ok {
-		routeID = id
-	}
-
-	return &DelayPredictionResult{
-		RouteID:         routeID,
-		PredictedDelay:  baseDelay,
-		Confidence:      0.82,
-		FactorsAnalyzed: factors,
-		RiskLevel:       "moderate",
-		Recommendations: recommendations,
-		ModelUsed:       "delay-prediction-v1.2",
-		PredictionTime:  time.Now(),
-	}
-}
-
 func (ml *MLService) getMockSatisfactionPrediction(tripData map[string]interface{}) *CustomerSatisfactionPrediction {
 	customerID := "unknown"
 	if id, ok := tripData["customer_id"].(string); ok {
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/mqtt"
+	"triplink/backend/internal/trackerproto"
+
+	"gorm.io/gorm"
+)
+
+// trackerPayload is a position published by a tracker. Both descriptive keys
+// and the short keys of OwnTracks-style firmware are accepted.
+type trackerPayload struct {
+	Latitude  *float64 `json:"latitude"`
+	Lat       *float64 `json:"lat"`
+	Longitude *float64 `json:"longitude"`
+	Lon       *float64 `json:"lon"`
+	Lng       *float64 `json:"lng"`
+	Altitude  *float64 `json:"altitude"`
+	Alt       *float64 `json:"alt"`
+	Speed     *float64 `json:"speed"` // km/h
+	Vel       *float64 `json:"vel"`
+	Heading   *float64 `json:"heading"`
+	Cog       *float64 `json:"cog"`
+	Accuracy  *float64 `json:"accuracy"`
+	Acc       *float64 `json:"acc"`
+	Battery   *float64 `json:"battery"`
+	Batt      *float64 `json:"batt"`
+
+	// RFC 3339 or Unix seconds
+	Timestamp json.RawMessage `json:"timestamp"`
+	Tst       *int64          `json:"tst"`
+}
+
+// firstOf returns the first value that is set
+func firstOf(values ...*float64) *float64 {
+	for _, value := range values {
+		if value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+// ParseTrackerPayload decodes the positions published by a tracker: a
+// Teltonika AVL packet, NMEA sentences or a JSON position
+func ParseTrackerPayload(payload []byte) ([]LocationUpdate, error) {
+	switch {
+	case trackerproto.IsTeltonikaPacket(payload):
+		positions, err := trackerproto.DecodeTeltonika(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tracker payload: %w", err)
+		}
+		return positionUpdates(positions), nil
+	case bytes.HasPrefix(bytes.TrimSpace(payload), []byte("$")):
+		positions, err := trackerproto.DecodeNMEA(payload, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("invalid tracker payload: %w", err)
+		}
+		return positionUpdates(positions), nil
+	}
+
+	update, err := parseJSONTrackerPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	return []LocationUpdate{update}, nil
+}
+
+// positionUpdates converts positions decoded from a tracker protocol
+func positionUpdates(positions []trackerproto.Position) []LocationUpdate {
+	updates := make([]LocationUpdate, len(positions))
+	for i, position := range positions {
+		timestamp := position.Timestamp
+		updates[i] = LocationUpdate{
+			Latitude:     position.Latitude,
+			Longitude:    position.Longitude,
+			Altitude:     position.Altitude,
+			Speed:        position.Speed,
+			Heading:      position.Heading,
+			Accuracy:     position.Accuracy,
+			BatteryLevel: position.BatteryLevel,
+			Timestamp:    &timestamp,
+			Source:       "GPS",
+		}
+	}
+	return updates
+}
+
+// parseJSONTrackerPayload decodes a JSON position
+func parseJSONTrackerPayload(payload []byte) (LocationUpdate, error) {
+	var p trackerPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return LocationUpdate{}, fmt.Errorf("invalid tracker payload: %w", err)
+	}
+
+	latitude := firstOf(p.Latitude, p.Lat)
+	longitude := firstOf(p.Longitude, p.Lon, p.Lng)
+	if latitude == nil || longitude == nil {
+		return LocationUpdate{}, errors.New("tracker payload has no coordinates")
+	}
+	update := LocationUpdate{
+		Latitude:     *latitude,
+		Longitude:    *longitude,
+		Altitude:     firstOf(p.Altitude, p.Alt),
+		Speed:        firstOf(p.Speed, p.Vel),
+		Heading:      firstOf(p.Heading, p.Cog),
+		Accuracy:     firstOf(p.Accuracy, p.Acc),
+		BatteryLevel: firstOf(p.Battery, p.Batt),
+		Source:       "GPS",
+	}
+
+	if p.Tst != nil {
+		timestamp := time.Unix(*p.Tst, 0)
+		update.Timestamp = &timestamp
+	} else if len(p.Timestamp) > 0 && string(p.Timestamp) != "null" {
+		timestamp, err := parseTrackerTimestamp(p.Timestamp)
+		if err != nil {
+			return LocationUpdate{}, err
+		}
+		update.Timestamp = &timestamp
+	}
+	return update, nil
+}
+
+// parseTrackerTimestamp parses an RFC 3339 string or Unix seconds
+func parseTrackerTimestamp(raw json.RawMessage) (time.Time, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		if timestamp, err := time.Parse(time.RFC3339, text); err == nil {
+			return timestamp, nil
+		}
+		raw = json.RawMessage(text)
+	}
+	seconds, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid tracker timestamp %s", raw)
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), nil
+}
+
+// MQTTBridge subscribes to the topic IoT GPS trackers publish positions to
+// and records the positions in the trackers' trips
+type MQTTBridge struct {
+	cfg      *config.MQTTConfig
+	trackers *TrackerService
+}
+
+// NewMQTTBridge creates a new MQTTBridge
+func NewMQTTBridge(db *gorm.DB, cfg *config.MQTTConfig) *MQTTBridge {
+	return &MQTTBridge{cfg: cfg, trackers: NewTrackerService(db)}
+}
+
+// Run keeps the bridge connected to the broker until ctx is done,
+// reconnecting after the configured delay when the connection is lost
+func (mb *MQTTBridge) Run(ctx context.Context) {
+	for {
+		err := mb.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("MQTT bridge disconnected, reconnecting in %s: %v", mb.cfg.ReconnectDelay, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(mb.cfg.ReconnectDelay):
+		}
+	}
+}
+
+// session connects, subscribes and handles messages until the connection is
+// lost or ctx is done
+func (mb *MQTTBridge) session(ctx context.Context) error {
+	opts := mqtt.Options{
+		Broker:       mb.cfg.BrokerURL,
+		ClientID:     mb.cfg.ClientID,
+		Username:     mb.cfg.Username,
+		Password:     mb.cfg.Password,
+		CleanSession: mb.cfg.QoS == 0,
+		KeepAlive:    mb.cfg.KeepAlive,
+	}
+	if mb.cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(mb.cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read MQTT CA: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("MQTT CA %s has no certificates", mb.cfg.CAFile)
+		}
+		opts.TLSConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+
+	connectCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	client, err := mqtt.Connect(connectCtx, opts)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if err := client.Subscribe(mb.cfg.Topic, byte(mb.cfg.QoS)); err != nil {
+		client.Close()
+		return err
+	}
+	log.Printf("MQTT bridge subscribed to %s", mb.cfg.Topic)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.Close()
+		case <-done:
+		}
+	}()
+
+	return client.Serve(func(message mqtt.Message) {
+		if err := mb.HandleMessage(message.Topic, message.Payload); err != nil {
+			log.Printf("MQTT bridge dropped message on %s: %v", message.Topic, err)
+		}
+	})
+}
+
+// HandleMessage records the positions published on a tracker's topic
+func (mb *MQTTBridge) HandleMessage(topic string, payload []byte) error {
+	deviceID := mb.deviceID(topic)
+	if deviceID == "" {
+		return fmt.Errorf("topic %s has no device ID", topic)
+	}
+	updates, err := ParseTrackerPayload(payload)
+	if err != nil {
+		return err
+	}
+	_, err = mb.trackers.IngestTrackerUpdates(deviceID, updates)
+	return err
+}
+
+// deviceID returns the level of a topic matched by the first + wildcard of
+// the subscription
+func (mb *MQTTBridge) deviceID(topic string) string {
+	if !mqtt.MatchTopic(mb.cfg.Topic, topic) {
+		return ""
+	}
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range strings.Split(mb.cfg.Topic, "/") {
+		if level == "+" {
+			return topicLevels[i]
+		}
+	}
+	return ""
+}
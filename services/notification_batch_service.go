@@ -107,6 +107,53 @@ func (s *NotificationBatchService) processBatch() {
 	}
 
 	log.Printf("Batch processed: %d notifications, %d successful", len(batch), successCount)
+
+	if err != nil || successCount < len(results) {
+		s.alertFailedBatch(batch, results, err)
+	}
+}
+
+// alertFailedBatch posts the failures of a batch to the ops channels of the
+// organizations of the users whose notifications failed
+func (s *NotificationBatchService) alertFailedBatch(batch []*models.Notification, results []*NotificationDeliveryResult, batchErr error) {
+	failedUsers := make(map[uint]int)
+	reason := ""
+	if batchErr != nil {
+		for _, notification := range batch {
+			failedUsers[notification.UserID]++
+		}
+		reason = batchErr.Error()
+	} else {
+		for _, result := range results {
+			if !result.Success {
+				failedUsers[result.UserID]++
+				reason = result.Error
+			}
+		}
+	}
+
+	userIDs := make([]uint, 0, len(failedUsers))
+	for userID := range failedUsers {
+		userIDs = append(userIDs, userID)
+	}
+	var memberships []models.OrganizationMembership
+	s.notificationService.db.Where("user_id IN ?", userIDs).Order("organization_id").Find(&memberships)
+
+	failedByOrganization := make(map[uint]int)
+	var organizationIDs []uint
+	for _, membership := range memberships {
+		if _, ok := failedByOrganization[membership.OrganizationID]; !ok {
+			organizationIDs = append(organizationIDs, membership.OrganizationID)
+		}
+		failedByOrganization[membership.OrganizationID] += failedUsers[membership.UserID]
+	}
+	for _, organizationID := range organizationIDs {
+		sendOpsAlert(OpsAlert{
+			Type:           OpsAlertNotificationFailure,
+			OrganizationID: organizationID,
+			Data:           map[string]interface{}{"failed": failedByOrganization[organizationID], "total": len(batch), "error": reason},
+		})
+	}
 }
 
 // Global notification batch service instance
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"triplink/backend/models"
+)
+
+// Digest modes
+const (
+	DigestModeNone   = "NONE"
+	DigestModeHourly = "HOURLY"
+	DigestModeDaily  = "DAILY"
+)
+
+// maxDigestItems is the number of notifications listed in a digest message
+const maxDigestItems = 10
+
+// ValidateNotificationPreferences validates quiet hours and digest settings
+func ValidateNotificationPreferences(preferences *models.NotificationPreferences) error {
+	if preferences.QuietHoursEnabled {
+		if _, err := parseClockTime(preferences.QuietHoursStart); err != nil {
+			return fmt.Errorf("invalid quiet hours start: %w", err)
+		}
+		if _, err := parseClockTime(preferences.QuietHoursEnd); err != nil {
+			return fmt.Errorf("invalid quiet hours end: %w", err)
+		}
+	}
+	if preferences.Timezone != "" {
+		if _, err := time.LoadLocation(preferences.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %s", preferences.Timezone)
+		}
+	}
+	switch preferences.DigestMode {
+	case "", DigestModeNone, DigestModeHourly, DigestModeDaily:
+	default:
+		return fmt.Errorf("invalid digest mode: %s", preferences.DigestMode)
+	}
+	if preferences.DigestHour < 0 || preferences.DigestHour > 23 {
+		return errors.New("digest hour must be between 0 and 23")
+	}
+	return nil
+}
+
+// parseClockTime parses an HH:MM time and returns the minutes since midnight
+func parseClockTime(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, errors.New("expected HH:MM")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// preferencesLocation returns the user's timezone, defaulting to UTC
+func preferencesLocation(preferences *models.NotificationPreferences) *time.Location {
+	if preferences.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(preferences.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// IsWithinQuietHours checks if the given time falls within the user's quiet hours.
+// Quiet hours that end before they start span midnight (e.g. 22:00-07:00).
+func IsWithinQuietHours(preferences *models.NotificationPreferences, now time.Time) bool {
+	if !preferences.QuietHoursEnabled {
+		return false
+	}
+
+	start, err := parseClockTime(preferences.QuietHoursStart)
+	if err != nil {
+		return false
+	}
+	end, err := parseClockTime(preferences.QuietHoursEnd)
+	if err != nil {
+		return false
+	}
+
+	local := now.In(preferencesLocation(preferences))
+	minutes := local.Hour()*60 + local.Minute()
+
+	if start == end {
+		return false
+	}
+	if start < end {
+		return minutes >= start && minutes < end
+	}
+	return minutes >= start || minutes < end
+}
+
+// isDigestDue checks if a digest should be sent now for the user's digest mode
+func isDigestDue(preferences *models.NotificationPreferences, now time.Time) bool {
+	switch preferences.DigestMode {
+	case DigestModeHourly:
+		return preferences.LastDigestSentAt == nil || now.Sub(*preferences.LastDigestSentAt) >= time.Hour
+	case DigestModeDaily:
+		loc := preferencesLocation(preferences)
+		local := now.In(loc)
+		if local.Hour() < preferences.DigestHour {
+			return false
+		}
+		if preferences.LastDigestSentAt == nil {
+			return true
+		}
+		last := preferences.LastDigestSentAt.In(loc)
+		return last.YearDay() != local.YearDay() || last.Year() != local.Year()
+	default:
+		// Notifications held only for quiet hours are sent as soon as they end
+		return true
+	}
+}
+
+// deferralReason returns why a notification should be held back for a digest,
+// or an empty string if it should be delivered immediately
+func deferralReason(preferences *models.NotificationPreferences, now time.Time) string {
+	if preferences.DigestMode == DigestModeHourly || preferences.DigestMode == DigestModeDaily {
+		return "DIGEST"
+	}
+	if IsWithinQuietHours(preferences, now) {
+		return "QUIET_HOURS"
+	}
+	return ""
+}
+
+// queueForDigest holds a stored notification back until the next digest
+func (s *NotificationService) queueForDigest(notification *models.Notification, reason string) error {
+	entry := models.NotificationDigestEntry{
+		UserID:         notification.UserID,
+		NotificationID: notification.ID,
+		Reason:         reason,
+		QueuedAt:       time.Now(),
+	}
+	if err := s.db.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to queue notification for digest: %w", err)
+	}
+	return nil
+}
+
+// ProcessDigests delivers a single summarized digest to every user with queued
+// notifications whose quiet hours are over and whose digest is due
+func (s *NotificationService) ProcessDigests() error {
+	var userIDs []uint
+	if err := s.db.Model(&models.NotificationDigestEntry{}).
+		Where("delivered_at IS NULL").
+		Distinct("user_id").
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return fmt.Errorf("failed to get pending digests: %w", err)
+	}
+
+	now := time.Now()
+	for _, userID := range userIDs {
+		preferences, err := s.GetUserNotificationPreferences(userID)
+		if err != nil {
+			log.Printf("Failed to get notification preferences for user %d: %v", userID, err)
+			continue
+		}
+
+		if IsWithinQuietHours(preferences, now) || !isDigestDue(preferences, now) {
+			continue
+		}
+
+		if err := s.sendDigest(preferences, now); err != nil {
+			log.Printf("Failed to send digest to user %d: %v", userID, err)
+		}
+	}
+
+	return nil
+}
+
+// sendDigest summarizes the user's queued notifications into one notification and delivers it
+func (s *NotificationService) sendDigest(preferences *models.NotificationPreferences, now time.Time) error {
+	var entries []models.NotificationDigestEntry
+	if err := s.db.Preload("Notification").
+		Where("user_id = ? AND delivered_at IS NULL", preferences.UserID).
+		Order("queued_at ASC").
+		Find(&entries).Error; err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	notifications := make([]models.Notification, len(entries))
+	entryIDs := make([]uint, len(entries))
+	for i, entry := range entries {
+		notifications[i] = entry.Notification
+		entryIDs[i] = entry.ID
+	}
+
+	digest := &models.Notification{
+		UserID:  preferences.UserID,
+		Title:   fmt.Sprintf("You have %d new notifications", len(notifications)),
+		Message: buildDigestMessage(notifications),
+		Type:    "DIGEST",
+	}
+	if len(notifications) == 1 {
+		digest.Title = "You have 1 new notification"
+	}
+
+	if err := s.db.Create(digest).Error; err != nil {
+		return fmt.Errorf("failed to create digest notification: %w", err)
+	}
+
+	if preferences.PushEnabled {
+		if _, err := s.SendNotification(digest); err != nil {
+			log.Printf("Failed to push digest %d: %v", digest.ID, err)
+		}
+	}
+	if preferences.EmailEnabled && s.emailProvider != nil {
+		if _, err := s.SendEmailNotification(digest); err != nil {
+			log.Printf("Failed to email digest %d: %v", digest.ID, err)
+		}
+	}
+
+	if err := s.db.Model(&models.NotificationDigestEntry{}).
+		Where("id IN ?", entryIDs).
+		Update("delivered_at", now).Error; err != nil {
+		return fmt.Errorf("failed to mark digest entries delivered: %w", err)
+	}
+
+	return s.db.Model(&models.NotificationPreferences{}).
+		Where("user_id = ?", preferences.UserID).
+		Update("last_digest_sent_at", now).Error
+}
+
+// buildDigestMessage lists the titles of the summarized notifications
+func buildDigestMessage(notifications []models.Notification) string {
+	var sb strings.Builder
+	for i, notification := range notifications {
+		if i == maxDigestItems {
+			sb.WriteString(fmt.Sprintf("...and %d more", len(notifications)-maxDigestItems))
+			break
+		}
+		sb.WriteString("- ")
+		sb.WriteString(notification.Title)
+		sb.WriteString("\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
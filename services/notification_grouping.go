@@ -0,0 +1,84 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// SetGrouping replaces the settings notifications are collapsed with
+func (s *NotificationService) SetGrouping(cfg *config.NotificationGroupingConfig) {
+	s.grouping = cfg
+}
+
+// groupNotification collapses a notification into the unread notification
+// of the same type about the same entity the user got within the grouping
+// window, if there is one. That notification takes the title and message of
+// the new one and counts it, and is returned; it was already delivered, so
+// a cascade of changes reaches the user once. An email or text can't be
+// updated once sent, so a notification going out by email or SMS is only
+// grouped with one the user was emailed or texted. Notifications not about
+// an entity are never grouped.
+func (s *NotificationService) groupNotification(notification *models.Notification, shouldEmail, shouldText bool) (*models.Notification, error) {
+	cfg := s.grouping
+	if cfg == nil || !cfg.Enabled || notification.RelatedID == 0 {
+		return nil, nil
+	}
+
+	var group models.Notification
+	err := s.db.Where("user_id = ? AND type = ? AND related_id = ? AND is_read = ? AND archived_at IS NULL AND created_at >= ?",
+		notification.UserID, notification.Type, notification.RelatedID, false, time.Now().Add(-cfg.Window)).
+		Order("created_at DESC").
+		First(&group).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to find notification to group with: %w", err)
+	}
+
+	if delivered, err := s.deliveredBy(group.ID, shouldEmail, shouldText); err != nil || !delivered {
+		return nil, err
+	}
+
+	group.Title = notification.Title
+	group.Message = notification.Message
+	group.MessageKey = notification.MessageKey
+	group.MessageParams = notification.MessageParams
+	group.GroupCount++
+	if err := s.db.Model(&group).
+		Select("title", "message", "message_key", "message_params", "group_count").
+		Updates(&group).Error; err != nil {
+		return nil, fmt.Errorf("failed to group notification: %w", err)
+	}
+	return &group, nil
+}
+
+// deliveredBy reports whether a notification was delivered by the email and
+// SMS providers, of those asked for
+func (s *NotificationService) deliveredBy(notificationID uint, email, sms bool) (bool, error) {
+	s.mu.Lock()
+	var providers []string
+	if email && s.emailProvider != nil {
+		providers = append(providers, s.emailProvider.Name())
+	}
+	if sms && s.smsProvider != nil {
+		providers = append(providers, s.smsProvider.Name())
+	}
+	s.mu.Unlock()
+	if len(providers) == 0 {
+		return true, nil
+	}
+
+	var delivered int64
+	if err := s.db.Model(&models.NotificationDelivery{}).
+		Where("notification_id = ? AND success = ? AND provider IN ?", notificationID, true, providers).
+		Distinct("provider").
+		Count(&delivered).Error; err != nil {
+		return false, fmt.Errorf("failed to check notification deliveries: %w", err)
+	}
+	return int(delivered) == len(providers), nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// NotificationCategories groups notification types the inbox can be
+// filtered by together
+var NotificationCategories = map[string][]string{
+	"tracking": {
+		"TRIP_DEPARTED", "TRIP_ARRIVED", "TRIP_DELAYED", "ETA_UPDATED",
+		"LOAD_STATUS_CHANGED", "LOCATION_UPDATE", "PICKUP_SCHEDULED",
+		"LOAD_DELIVERED",
+	},
+}
+
+// NotificationInboxFilter narrows down the notifications of a user's inbox
+type NotificationInboxFilter struct {
+	Types      []string // any of these types, or all types when empty
+	UnreadOnly bool
+	Archived   bool // only archived notifications, instead of the others
+	From       *time.Time
+	To         *time.Time
+}
+
+// NotificationTypeSummary counts a user's notifications of one type
+type NotificationTypeSummary struct {
+	Type     string `json:"type"`
+	Total    int64  `json:"total"`
+	Unread   int64  `json:"unread"`
+	Archived int64  `json:"archived"`
+}
+
+// NotificationInboxSummary counts a user's notifications, in total and for
+// each type. Archived notifications are counted apart, not as unread.
+type NotificationInboxSummary struct {
+	Total    int64                     `json:"total"`
+	Unread   int64                     `json:"unread"`
+	Archived int64                     `json:"archived"`
+	ByType   []NotificationTypeSummary `json:"by_type"`
+}
+
+// InboxQuery returns the query of the notifications of a user matching the
+// filter, to count or page through
+func (s *NotificationService) InboxQuery(userID uint, filter NotificationInboxFilter) *gorm.DB {
+	query := s.db.Model(&models.Notification{}).Where("user_id = ?", userID)
+	if filter.Archived {
+		query = query.Where("archived_at IS NOT NULL")
+	} else {
+		query = query.Where("archived_at IS NULL")
+	}
+	if filter.UnreadOnly {
+		query = query.Where("is_read = ?", false)
+	}
+	if len(filter.Types) > 0 {
+		query = query.Where("type IN ?", filter.Types)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at <= ?", *filter.To)
+	}
+	return query
+}
+
+// GetInboxSummary counts the notifications of a user for each type
+func (s *NotificationService) GetInboxSummary(userID uint) (*NotificationInboxSummary, error) {
+	var rows []NotificationTypeSummary
+	if err := s.db.Model(&models.Notification{}).
+		Select("type, COUNT(*) AS total, "+
+			"SUM(CASE WHEN is_read = ? AND archived_at IS NULL THEN 1 ELSE 0 END) AS unread, "+
+			"SUM(CASE WHEN archived_at IS NOT NULL THEN 1 ELSE 0 END) AS archived", false).
+		Where("user_id = ?", userID).
+		Group("type").
+		Order("type").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count notifications: %w", err)
+	}
+
+	summary := &NotificationInboxSummary{ByType: rows}
+	for _, row := range rows {
+		summary.Total += row.Total
+		summary.Unread += row.Unread
+		summary.Archived += row.Archived
+	}
+	return summary, nil
+}
+
+// SetNotificationsArchived archives the given notifications of a user or
+// moves them back to the inbox, returning how many were changed
+func (s *NotificationService) SetNotificationsArchived(userID uint, ids []uint, archived bool) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	query := s.db.Model(&models.Notification{}).Where("user_id = ? AND id IN ?", userID, ids)
+	var archivedAt interface{}
+	if archived {
+		query = query.Where("archived_at IS NULL")
+		archivedAt = time.Now()
+	} else {
+		query = query.Where("archived_at IS NOT NULL")
+	}
+	result := query.Update("archived_at", archivedAt)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to update notifications: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Notification delivery channels
+const (
+	DeliveryChannelPush  = "PUSH"
+	DeliveryChannelEmail = "EMAIL"
+	DeliveryChannelSMS   = "SMS"
+)
+
+// ErrNotificationQueueFull is returned when a delivery can't be queued
+var ErrNotificationQueueFull = errors.New("notification queue is full")
+
+// NotificationJob is the delivery of a notification over one channel
+type NotificationJob struct {
+	NotificationID uint
+	Channel        string
+	Attempts       int // attempts made so far
+}
+
+// NotificationQueue delivers notifications with a pool of workers, so that
+// requests creating notifications don't wait on the providers. Failed
+// deliveries are retried with exponential backoff and moved to the dead
+// letter list after the last attempt. Queued deliveries are held in memory;
+// the notifications themselves are stored before they are queued.
+type NotificationQueue struct {
+	db     *gorm.DB
+	sender *NotificationService
+	cfg    *config.NotificationQueueConfig
+
+	jobs     chan NotificationJob
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewNotificationQueue creates a queue delivering through the providers of sender
+func NewNotificationQueue(db *gorm.DB, sender *NotificationService, cfg *config.NotificationQueueConfig) *NotificationQueue {
+	return &NotificationQueue{
+		db:     db,
+		sender: sender,
+		cfg:    cfg,
+		jobs:   make(chan NotificationJob, cfg.QueueSize),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start starts the delivery workers
+func (q *NotificationQueue) Start() {
+	for i := 0; i < q.cfg.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	log.Printf("Notification queue started with %d workers", q.cfg.Workers)
+}
+
+// Stop stops the workers once their current deliveries are done. Deliveries
+// still queued or waiting to be retried are dropped.
+func (q *NotificationQueue) Stop() {
+	q.stopOnce.Do(func() {
+		close(q.stop)
+		q.wg.Wait()
+	})
+}
+
+// Enqueue queues the delivery of a notification over a channel
+func (q *NotificationQueue) Enqueue(notificationID uint, channel string) error {
+	if channel != DeliveryChannelPush && channel != DeliveryChannelEmail && channel != DeliveryChannelSMS {
+		return fmt.Errorf("invalid delivery channel %s", channel)
+	}
+	return q.push(NotificationJob{NotificationID: notificationID, Channel: channel})
+}
+
+// push queues a job without blocking
+func (q *NotificationQueue) push(job NotificationJob) error {
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		return ErrNotificationQueueFull
+	}
+}
+
+// Backoff returns how long to wait before retrying a delivery that failed
+// after the given number of attempts
+func (q *NotificationQueue) Backoff(attempts int) time.Duration {
+	delay := q.cfg.InitialBackoff
+	for i := 1; i < attempts && delay < q.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.cfg.MaxBackoff {
+		delay = q.cfg.MaxBackoff
+	}
+	return delay
+}
+
+// work delivers queued jobs until the queue is stopped
+func (q *NotificationQueue) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case job := <-q.jobs:
+			q.process(job)
+		}
+	}
+}
+
+// process attempts a delivery, scheduling a retry or dead lettering it when it fails
+func (q *NotificationQueue) process(job NotificationJob) {
+	var notification models.Notification
+	if err := q.db.First(&notification, job.NotificationID).Error; err != nil {
+		log.Printf("Failed to load queued notification %d: %v", job.NotificationID, err)
+		return
+	}
+
+	job.Attempts++
+	var result *NotificationDeliveryResult
+	var err error
+	switch job.Channel {
+	case DeliveryChannelEmail:
+		result, err = q.sender.SendEmailNotification(&notification)
+	case DeliveryChannelSMS:
+		result, err = q.sender.SendSMSNotification(&notification)
+	default:
+		result, err = q.sender.SendNotification(&notification)
+	}
+	if err == nil {
+		return
+	}
+	if result == nil {
+		// Nothing to deliver to, e.g. the user has no devices registered
+		log.Printf("Skipped %s delivery of notification %d: %v", job.Channel, notification.ID, err)
+		return
+	}
+
+	if job.Attempts >= q.cfg.MaxAttempts {
+		q.deadLetter(job, &notification, err)
+		return
+	}
+
+	time.AfterFunc(q.Backoff(job.Attempts), func() {
+		select {
+		case <-q.stop:
+		default:
+			if err := q.push(job); err != nil {
+				q.deadLetter(job, &notification, err)
+			}
+		}
+	})
+}
+
+// deadLetter records a delivery the queue gave up on
+func (q *NotificationQueue) deadLetter(job NotificationJob, notification *models.Notification, cause error) {
+	letter := models.NotificationDeadLetter{
+		NotificationID: notification.ID,
+		UserID:         notification.UserID,
+		Channel:        job.Channel,
+		Attempts:       job.Attempts,
+		LastError:      cause.Error(),
+	}
+	if err := q.db.Create(&letter).Error; err != nil {
+		log.Printf("Failed to record dead letter of notification %d: %v", notification.ID, err)
+		return
+	}
+	log.Printf("Gave up %s delivery of notification %d after %d attempts: %v", job.Channel, notification.ID, job.Attempts, cause)
+}
+
+// RetryDeadLetter queues a dead lettered delivery again, with a fresh set of attempts
+func (q *NotificationQueue) RetryDeadLetter(id uint) (*models.NotificationDeadLetter, error) {
+	var letter models.NotificationDeadLetter
+	if err := q.db.First(&letter, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("dead letter not found")
+		}
+		return nil, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+	if letter.RetriedAt != nil {
+		return nil, errors.New("dead letter was already retried")
+	}
+
+	if err := q.Enqueue(letter.NotificationID, letter.Channel); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	letter.RetriedAt = &now
+	if err := q.db.Model(&letter).Update("retried_at", now).Error; err != nil {
+		return nil, fmt.Errorf("failed to update dead letter: %w", err)
+	}
+	return &letter, nil
+}
+
+// The queue used by notification services of this instance, if running
+var (
+	notificationQueueMu       sync.RWMutex
+	notificationQueueInstance *NotificationQueue
+)
+
+// GetNotificationQueue returns the running notification queue, or nil when
+// notifications are delivered in the request
+func GetNotificationQueue() *NotificationQueue {
+	notificationQueueMu.RLock()
+	defer notificationQueueMu.RUnlock()
+	return notificationQueueInstance
+}
+
+// SetNotificationQueue sets the queue that notification services deliver through
+func SetNotificationQueue(queue *NotificationQueue) {
+	notificationQueueMu.Lock()
+	defer notificationQueueMu.Unlock()
+	notificationQueueInstance = queue
+}
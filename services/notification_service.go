@@ -7,6 +7,9 @@ import (
 	"log"
 	"sync"
 	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/i18n"
+	"triplink/backend/metrics"
 	"triplink/backend/models"
 	
 	"gorm.io/gorm"
@@ -18,10 +21,17 @@ type NotificationService struct {
 	mu sync.Mutex
 	// Database connection
 	db *gorm.DB
-	// Map of user IDs to their device tokens
+	// Map of user IDs to their device tokens, loaded on first use
 	deviceTokens map[uint][]DeviceToken
+	tokensLoaded bool
 	// Delivery providers
 	providers []NotificationProvider
+	// Email delivery provider, used alongside push providers
+	emailProvider NotificationProvider
+	// SMS delivery provider, for users who opted in with a verified phone
+	smsProvider NotificationProvider
+	// Collapsing of repeated notifications about the same entity
+	grouping *config.NotificationGroupingConfig
 }
 
 // DeviceToken represents a user's device token for push notifications
@@ -55,6 +65,27 @@ type NotificationDeliveryResult struct {
 	Error          string    `json:"error,omitempty"`
 }
 
+// The notification service of this instance, with its providers registered
+var (
+	notificationServiceMu       sync.RWMutex
+	notificationServiceInstance *NotificationService
+)
+
+// GetNotificationService returns the notification service set at startup,
+// or nil before it is set
+func GetNotificationService() *NotificationService {
+	notificationServiceMu.RLock()
+	defer notificationServiceMu.RUnlock()
+	return notificationServiceInstance
+}
+
+// SetNotificationService sets the notification service used by handlers
+func SetNotificationService(service *NotificationService) {
+	notificationServiceMu.Lock()
+	defer notificationServiceMu.Unlock()
+	notificationServiceInstance = service
+}
+
 // NewNotificationService creates a new NotificationService instance
 func NewNotificationService(db *gorm.DB) *NotificationService {
 	s := &NotificationService{
@@ -62,22 +93,25 @@ func NewNotificationService(db *gorm.DB) *NotificationService {
 		db:           db,
 		deviceTokens: make(map[uint][]DeviceToken),
 		providers:    []NotificationProvider{},
+		grouping:     config.GetNotificationGroupingConfig(),
 	}
-	// Load device tokens from database
-	s.loadDeviceTokens()
 	return s
 }
 
-// loadDeviceTokens loads all device tokens from the database
+// loadDeviceTokens loads all device tokens from the database the first time
+// they are needed, as services are created before the database is connected.
+// The caller must hold s.mu.
 func (s *NotificationService) loadDeviceTokens() {
+	if s.tokensLoaded || s.db == nil {
+		return
+	}
+
 	var tokenRecords []models.NotificationToken
 	if err := s.db.Find(&tokenRecords).Error; err != nil {
 		log.Printf("Error loading device tokens: %v", err)
 		return
 	}
-
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.tokensLoaded = true
 
 	for _, record := range tokenRecords {
 		if _, exists := s.deviceTokens[record.UserID]; !exists {
@@ -103,6 +137,22 @@ func (s *NotificationService) RegisterProvider(provider NotificationProvider) {
 	log.Printf("Registered notification provider: %s", provider.Name())
 }
 
+// RegisterEmailProvider sets the provider used to deliver notifications by email
+func (s *NotificationService) RegisterEmailProvider(provider NotificationProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emailProvider = provider
+	log.Printf("Registered email notification provider: %s", provider.Name())
+}
+
+// RegisterSMSProvider sets the provider used to deliver notifications by SMS
+func (s *NotificationService) RegisterSMSProvider(provider NotificationProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.smsProvider = provider
+	log.Printf("Registered SMS notification provider: %s", provider.Name())
+}
+
 // RegisterDeviceToken registers a device token for a user
 func (s *NotificationService) RegisterDeviceToken(userID uint, token string, deviceType string) error {
 	if token == "" {
@@ -136,6 +186,7 @@ func (s *NotificationService) RegisterDeviceToken(userID uint, token string, dev
 	// Update in-memory cache
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.loadDeviceTokens()
 
 	newDeviceToken := DeviceToken{
 		Token:      token,
@@ -172,6 +223,7 @@ func (s *NotificationService) UnregisterDeviceToken(userID uint, token string) e
 	// Remove from in-memory cache
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.loadDeviceTokens()
 
 	tokens, exists := s.deviceTokens[userID]
 	if !exists {
@@ -193,6 +245,7 @@ func (s *NotificationService) UnregisterDeviceToken(userID uint, token string) e
 func (s *NotificationService) GetUserDeviceTokens(userID uint) []DeviceToken {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.loadDeviceTokens()
 
 	tokens, exists := s.deviceTokens[userID]
 	if !exists {
@@ -212,6 +265,9 @@ func (s *NotificationService) SendNotification(notification *models.Notification
 	if len(tokens) == 0 {
 		return nil, fmt.Errorf("no device tokens found for user %d", notification.UserID)
 	}
+	if len(s.providers) == 0 {
+		return nil, errors.New("no notification providers registered")
+	}
 
 	// Extract just the token strings
 	tokenStrings := make([]string, len(tokens))
@@ -331,6 +387,80 @@ func (s *NotificationService) BatchSendNotifications(notifications []*models.Not
 	return results, lastError
 }
 
+// SendEmailNotification sends a notification to the user's email address
+func (s *NotificationService) SendEmailNotification(notification *models.Notification) (*NotificationDeliveryResult, error) {
+	s.mu.Lock()
+	provider := s.emailProvider
+	s.mu.Unlock()
+
+	if provider == nil {
+		return nil, errors.New("no email provider registered")
+	}
+
+	var user models.User
+	if err := s.db.Select("id, email").First(&user, notification.UserID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user %d: %w", notification.UserID, err)
+	}
+	if user.Email == "" {
+		return nil, fmt.Errorf("no email address found for user %d", notification.UserID)
+	}
+
+	result := &NotificationDeliveryResult{
+		NotificationID: notification.ID,
+		UserID:         notification.UserID,
+		Provider:       provider.Name(),
+		SentAt:         time.Now(),
+	}
+
+	err := provider.SendNotification([]string{user.Email}, notification)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Success = true
+	}
+
+	s.recordDelivery(result)
+
+	return result, err
+}
+
+// SendSMSNotification texts a notification to the user's verified phone number
+func (s *NotificationService) SendSMSNotification(notification *models.Notification) (*NotificationDeliveryResult, error) {
+	s.mu.Lock()
+	provider := s.smsProvider
+	s.mu.Unlock()
+
+	if provider == nil {
+		return nil, errors.New("no SMS provider registered")
+	}
+
+	var user models.User
+	if err := s.db.Select("id, phone, phone_verified_at").First(&user, notification.UserID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user %d: %w", notification.UserID, err)
+	}
+	if user.Phone == "" || user.PhoneVerifiedAt == nil {
+		return nil, fmt.Errorf("no verified phone number found for user %d", notification.UserID)
+	}
+
+	result := &NotificationDeliveryResult{
+		NotificationID: notification.ID,
+		UserID:         notification.UserID,
+		Provider:       provider.Name(),
+		SentAt:         time.Now(),
+	}
+
+	err := provider.SendNotification([]string{user.Phone}, notification)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Success = true
+	}
+
+	s.recordDelivery(result)
+
+	return result, err
+}
+
 // recordDelivery records a notification delivery attempt in the database
 func (s *NotificationService) recordDelivery(result *NotificationDeliveryResult) {
 	delivery := models.NotificationDelivery{
@@ -342,6 +472,8 @@ func (s *NotificationService) recordDelivery(result *NotificationDeliveryResult)
 		Error:          result.Error,
 	}
 
+	metrics.ObserveNotificationDelivery(result.Provider, result.Success)
+
 	if err := s.db.Create(&delivery).Error; err != nil {
 		log.Printf("Error recording notification delivery: %v", err)
 	}
@@ -363,8 +495,13 @@ func (s *NotificationService) GetUserNotificationPreferences(userID uint) (*mode
 				ETAUpdates:      true,
 				LoadStatus:      true,
 				LocationUpdates: false,
+				QuoteUpdates:    true,
 				EmailEnabled:    true,
 				PushEnabled:     true,
+				// SMS is opt-in, but covers both types once enabled
+				SMSEnabled:         false,
+				SMSDelays:          true,
+				SMSPickupReminders: true,
 			}
 
 			if err := s.db.Create(&preferences).Error; err != nil {
@@ -385,6 +522,10 @@ func (s *NotificationService) UpdateUserNotificationPreferences(userID uint, pre
 	// Ensure the user ID matches
 	preferences.UserID = userID
 
+	if err := ValidateNotificationPreferences(preferences); err != nil {
+		return err
+	}
+
 	// Check if preferences exist
 	var count int64
 	s.db.Model(&models.NotificationPreferences{}).Where("user_id = ?", userID).Count(&count)
@@ -399,12 +540,16 @@ func (s *NotificationService) UpdateUserNotificationPreferences(userID uint, pre
 		if err := s.db.Model(&models.NotificationPreferences{}).Where("user_id = ?", userID).Updates(preferences).Error; err != nil {
 			return fmt.Errorf("failed to update preferences: %w", err)
 		}
+		// Updates skips false values, so opting out of SMS is saved explicitly
+		if err := s.db.Model(&models.NotificationPreferences{}).Where("user_id = ?", userID).Update("sms_enabled", preferences.SMSEnabled).Error; err != nil {
+			return fmt.Errorf("failed to update preferences: %w", err)
+		}
 	}
 
 	return nil
 }
 
-// ShouldSendNotification checks if a notification should be sent based on user preferences
+// ShouldSendNotification checks if a push notification should be sent based on user preferences
 func (s *NotificationService) ShouldSendNotification(userID uint, notificationType string) (bool, error) {
 	preferences, err := s.GetUserNotificationPreferences(userID)
 	if err != nil {
@@ -416,44 +561,150 @@ func (s *NotificationService) ShouldSendNotification(userID uint, notificationTy
 		return false, nil
 	}
 
-	// Check specific notification type
+	return isNotificationTypeEnabled(preferences, notificationType), nil
+}
+
+// ShouldSendEmailNotification checks if an email notification should be sent based on user preferences
+func (s *NotificationService) ShouldSendEmailNotification(userID uint, notificationType string) (bool, error) {
+	preferences, err := s.GetUserNotificationPreferences(userID)
+	if err != nil {
+		return false, err
+	}
+
+	// If email notifications are disabled, don't send
+	if !preferences.EmailEnabled {
+		return false, nil
+	}
+
+	return isNotificationTypeEnabled(preferences, notificationType), nil
+}
+
+// ShouldSendSMSNotification checks if an SMS should be sent based on user
+// preferences. Users opt in to SMS, which is only sent for delay and weather
+// alerts and pickup reminders.
+func (s *NotificationService) ShouldSendSMSNotification(userID uint, notificationType string) (bool, error) {
+	preferences, err := s.GetUserNotificationPreferences(userID)
+	if err != nil {
+		return false, err
+	}
+
+	if !preferences.SMSEnabled {
+		return false, nil
+	}
+
+	switch notificationType {
+	case "TRIP_DELAYED", "DELAY_ALERT", "WEATHER_ALERT":
+		return preferences.SMSDelays, nil
+	case "PICKUP_REMINDER":
+		return preferences.SMSPickupReminders, nil
+	default:
+		return false, nil
+	}
+}
+
+// isNotificationTypeEnabled checks the per-type preference flag for a notification type
+func isNotificationTypeEnabled(preferences *models.NotificationPreferences, notificationType string) bool {
 	switch notificationType {
 	case "TRIP_DEPARTED", "TRIP_STATUS_CHANGE":
-		return preferences.TripDeparture, nil
+		return preferences.TripDeparture
 	case "TRIP_ARRIVED":
-		return preferences.TripArrival, nil
-	case "TRIP_DELAYED", "DELAY_ALERT":
-		return preferences.Delays, nil
+		return preferences.TripArrival
+	case "TRIP_DELAYED", "DELAY_ALERT", "WEATHER_ALERT":
+		return preferences.Delays
 	case "ETA_UPDATED":
-		return preferences.ETAUpdates, nil
-	case "LOAD_STATUS_CHANGED", "LOAD_BOOKED", "PICKUP_SCHEDULED", "LOAD_DELIVERED":
-		return preferences.LoadStatus, nil
+		return preferences.ETAUpdates
+	case "LOAD_STATUS_CHANGED", "LOAD_BOOKED", "PICKUP_SCHEDULED", "PICKUP_REMINDER", "LOAD_DELIVERED", "CUSTOMS_DOCUMENT_EXPIRING":
+		return preferences.LoadStatus
+	case "QUOTE_RECEIVED", "QUOTE_ACCEPTED", "QUOTE_REJECTED":
+		return preferences.QuoteUpdates
 	case "LOCATION_UPDATE":
-		return preferences.LocationUpdates, nil
+		return preferences.LocationUpdates
 	default:
 		// For unknown types, default to true
-		return true, nil
+		return true
 	}
 }
 
-// CreateNotificationWithDelivery creates a notification and delivers it
+// CreateNotificationWithDelivery creates a notification and delivers it. When
+// the notification queue is running the deliveries are queued and no delivery
+// result is returned.
 func (s *NotificationService) CreateNotificationWithDelivery(notification *models.Notification) (*models.Notification, *NotificationDeliveryResult, error) {
+	LocalizeNotification(s.db, notification)
+
 	// First check if we should send this notification based on user preferences
 	shouldSend, err := s.ShouldSendNotification(notification.UserID, notification.Type)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error checking notification preferences: %w", err)
 	}
 
-	if !shouldSend {
+	shouldEmail := false
+	if s.emailProvider != nil {
+		shouldEmail, err = s.ShouldSendEmailNotification(notification.UserID, notification.Type)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error checking notification preferences: %w", err)
+		}
+	}
+
+	shouldText := false
+	if s.smsProvider != nil {
+		shouldText, err = s.ShouldSendSMSNotification(notification.UserID, notification.Type)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error checking notification preferences: %w", err)
+		}
+	}
+
+	if !shouldSend && !shouldEmail && !shouldText {
 		// Skip this notification based on user preferences
 		return notification, nil, nil
 	}
 
+	// A notification repeating an unread one is counted on it instead of
+	// being stored and sent again
+	if grouped, err := s.groupNotification(notification, shouldEmail, shouldText); err != nil {
+		return nil, nil, err
+	} else if grouped != nil {
+		return grouped, nil, nil
+	}
+
 	// Create the notification in the database
 	if err := s.db.Create(notification).Error; err != nil {
 		return nil, nil, fmt.Errorf("failed to create notification: %w", err)
 	}
 
+	// Hold the notification back during quiet hours or when the user prefers digests
+	preferences, err := s.GetUserNotificationPreferences(notification.UserID)
+	if err != nil {
+		return notification, nil, fmt.Errorf("error checking notification preferences: %w", err)
+	}
+	if reason := deferralReason(preferences, time.Now()); reason != "" {
+		if err := s.queueForDigest(notification, reason); err != nil {
+			return notification, nil, err
+		}
+		return notification, nil, nil
+	}
+
+	// Deliver outside the request when the queue is running
+	if queue := GetNotificationQueue(); queue != nil {
+		s.enqueueDeliveries(queue, notification, shouldSend, shouldEmail, shouldText)
+		return notification, nil, nil
+	}
+
+	// Email and SMS are delivered independently of push, so a push failure doesn't block them
+	if shouldEmail {
+		if _, err := s.SendEmailNotification(notification); err != nil {
+			log.Printf("Failed to email notification %d: %v", notification.ID, err)
+		}
+	}
+	if shouldText {
+		if _, err := s.SendSMSNotification(notification); err != nil {
+			log.Printf("Failed to text notification %d: %v", notification.ID, err)
+		}
+	}
+
+	if !shouldSend {
+		return notification, nil, nil
+	}
+
 	// Send the notification
 	deliveryResult, err := s.SendNotification(notification)
 	if err != nil {
@@ -465,6 +716,124 @@ func (s *NotificationService) CreateNotificationWithDelivery(notification *model
 	return notification, deliveryResult, nil
 }
 
+// LocalizeNotification renders the title and message of a notification from
+// its message key, in the language of the user it's for. Notifications
+// without a key are left as they are.
+func LocalizeNotification(db *gorm.DB, notification *models.Notification) {
+	if notification.MessageKey == "" {
+		return
+	}
+	language := UserLanguage(db, notification.UserID)
+	params := i18n.Params(notification.MessageParams)
+	notification.Title = i18n.T(language, notification.MessageKey+".title", params)
+	notification.Message = i18n.T(language, notification.MessageKey+".message", params)
+}
+
+// enqueueDeliveries queues the push, email and SMS deliveries of a
+// notification. A delivery that doesn't fit in the queue is made right away
+// instead.
+func (s *NotificationService) enqueueDeliveries(queue *NotificationQueue, notification *models.Notification, push, email, sms bool) {
+	if email {
+		if err := queue.Enqueue(notification.ID, DeliveryChannelEmail); err != nil {
+			log.Printf("Failed to queue email of notification %d, sending now: %v", notification.ID, err)
+			if _, err := s.SendEmailNotification(notification); err != nil {
+				log.Printf("Failed to email notification %d: %v", notification.ID, err)
+			}
+		}
+	}
+	if sms {
+		if err := queue.Enqueue(notification.ID, DeliveryChannelSMS); err != nil {
+			log.Printf("Failed to queue SMS of notification %d, sending now: %v", notification.ID, err)
+			if _, err := s.SendSMSNotification(notification); err != nil {
+				log.Printf("Failed to text notification %d: %v", notification.ID, err)
+			}
+		}
+	}
+	if push {
+		if err := queue.Enqueue(notification.ID, DeliveryChannelPush); err != nil {
+			log.Printf("Failed to queue notification %d, sending now: %v", notification.ID, err)
+			if _, err := s.SendNotification(notification); err != nil {
+				log.Printf("Failed to deliver notification %d: %v", notification.ID, err)
+			}
+		}
+	}
+}
+
+// GetUnreadCount returns the number of unread notifications of a user,
+// leaving out archived ones
+func (s *NotificationService) GetUnreadCount(userID uint) (int64, error) {
+	var count int64
+	if err := s.db.Model(&models.Notification{}).Where("user_id = ? AND is_read = ? AND archived_at IS NULL", userID, false).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// GetUnreadCountsByType returns the number of unread notifications of a user
+// for each notification type
+func (s *NotificationService) GetUnreadCountsByType(userID uint) (map[string]int64, error) {
+	var rows []struct {
+		Type  string
+		Count int64
+	}
+	if err := s.db.Model(&models.Notification{}).
+		Select("type, COUNT(*) AS count").
+		Where("user_id = ? AND is_read = ? AND archived_at IS NULL", userID, false).
+		Group("type").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Type] = row.Count
+	}
+	return counts, nil
+}
+
+// SetNotificationsRead marks the given notifications of a user read or
+// unread, returning how many were changed. Notifications of other users are
+// left alone.
+func (s *NotificationService) SetNotificationsRead(userID uint, ids []uint, read bool) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := s.db.Model(&models.Notification{}).
+		Where("user_id = ? AND id IN ? AND is_read = ?", userID, ids, !read).
+		Update("is_read", read)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to update notifications: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// MarkAllNotificationsRead marks all unread notifications of a user read,
+// or only those of a type when notificationType is set
+func (s *NotificationService) MarkAllNotificationsRead(userID uint, notificationType string) (int64, error) {
+	query := s.db.Model(&models.Notification{}).Where("user_id = ? AND is_read = ?", userID, false)
+	if notificationType != "" {
+		query = query.Where("type = ?", notificationType)
+	}
+	result := query.Update("is_read", true)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to mark notifications as read: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// DeleteNotifications deletes the given notifications of a user, returning
+// how many were deleted
+func (s *NotificationService) DeleteNotifications(userID uint, ids []uint) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := s.db.Where("user_id = ? AND id IN ?", userID, ids).Delete(&models.Notification{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete notifications: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
 // PrepareNotificationPayload prepares the payload for a push notification
 func (s *NotificationService) PrepareNotificationPayload(notification *models.Notification) map[string]interface{} {
 	// Basic payload with notification content
@@ -477,6 +846,11 @@ func (s *NotificationService) PrepareNotificationPayload(notification *models.No
 		"createdAt": notification.CreatedAt,
 	}
 
+	// Let the app set its icon badge to the number of unread notifications
+	if count, err := s.GetUnreadCount(notification.UserID); err == nil {
+		payload["badge"] = count
+	}
+
 	// Add related entity information if available
 	if notification.RelatedID > 0 {
 		payload["relatedId"] = notification.RelatedID
@@ -485,12 +859,14 @@ func (s *NotificationService) PrepareNotificationPayload(notification *models.No
 		switch notification.Type {
 		case "TRIP_DEPARTED", "TRIP_ARRIVED", "TRIP_DELAYED", "ETA_UPDATED", "TRIP_STATUS_CHANGE":
 			payload["relatedEntityType"] = "trip"
-		case "LOAD_STATUS_CHANGED", "LOAD_BOOKED", "PICKUP_SCHEDULED", "LOAD_DELIVERED":
+		case "LOAD_STATUS_CHANGED", "LOAD_BOOKED", "PICKUP_SCHEDULED", "LOAD_DELIVERED", "CUSTOMS_DOCUMENT_EXPIRING":
 			payload["relatedEntityType"] = "load"
 		case "QUOTE_RECEIVED":
 			payload["relatedEntityType"] = "quote"
 		case "NEW_MESSAGE":
 			payload["relatedEntityType"] = "conversation"
+		case "VEHICLE_DOCUMENT_EXPIRING":
+			payload["relatedEntityType"] = "vehicle"
 		}
 	}
 
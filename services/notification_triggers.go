@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
+	"triplink/backend/internal/timezone"
 	"triplink/backend/models"
 	
 	"gorm.io/gorm"
@@ -180,7 +182,59 @@ func (s *NotificationTriggerService) LoadStatusChangeHandler(loadID uint, oldSta
 	return nil
 }
 
+// LoadStatusesChangeHandler notifies shippers of a bulk change of a trip's
+// load statuses, with one notification per shipper for all their loads
+// changed
+func (s *NotificationTriggerService) LoadStatusesChangeHandler(tripID uint, newStatus string, results []LoadStatusResult) error {
+	var shippers []uint
+	loads := map[uint][]LoadStatusResult{}
+	for _, result := range results {
+		if !result.Updated {
+			continue
+		}
+		if _, ok := loads[result.ShipperID]; !ok {
+			shippers = append(shippers, result.ShipperID)
+		}
+		loads[result.ShipperID] = append(loads[result.ShipperID], result)
+	}
+
+	for _, shipperID := range shippers {
+		changed := loads[shipperID]
+		if len(changed) == 1 {
+			if err := s.LoadStatusChangeHandler(changed[0].LoadID, changed[0].PreviousStatus, newStatus); err != nil {
+				log.Printf("Failed to notify shipper %d of load status change: %v", shipperID, err)
+			}
+			continue
+		}
+
+		references := make([]string, len(changed))
+		for i, result := range changed {
+			references[i] = result.BookingReference
+			if references[i] == "" {
+				references[i] = fmt.Sprintf("#%d", result.LoadID)
+			}
+		}
+		notification := models.Notification{
+			UserID:     shipperID,
+			MessageKey: "notification.loads_status_changed",
+			MessageParams: map[string]interface{}{
+				"count":      len(changed),
+				"trip":       tripID,
+				"status":     newStatus,
+				"references": strings.Join(references, ", "),
+			},
+			Type:      "LOAD_STATUS_CHANGED",
+			RelatedID: tripID,
+		}
+		if _, _, err := s.notificationService.CreateNotificationWithDelivery(&notification); err != nil {
+			log.Printf("Failed to notify shipper %d of load status changes: %v", shipperID, err)
+		}
+	}
+	return nil
+}
+
 // MessageReceivedHandler handles new message events and sends notifications
+// to the other participants of the message's conversation
 func (s *NotificationTriggerService) MessageReceivedHandler(messageID uint) error {
 	// Get message details
 	var message models.Message
@@ -194,18 +248,41 @@ func (s *NotificationTriggerService) MessageReceivedHandler(messageID uint) erro
 		return fmt.Errorf("failed to get sender details: %w", err)
 	}
 
-	// Create notification for the receiver
-	notification := models.Notification{
-		UserID:    message.ReceiverID,
-		Title:     "New Message",
-		Message:   fmt.Sprintf("You have received a new message from %s %s", sender.FirstName, sender.LastName),
-		Type:      "NEW_MESSAGE",
-		RelatedID: messageID,
+	recipientIDs := []uint{message.ReceiverID}
+	relatedID := messageID
+	if message.ConversationID != nil {
+		relatedID = *message.ConversationID
+		recipientIDs = nil
+		var participants []models.ConversationParticipant
+		s.db.Where("conversation_id = ? AND user_id <> ?", *message.ConversationID, message.SenderID).Find(&participants)
+		for _, participant := range participants {
+			recipientIDs = append(recipientIDs, participant.UserID)
+		}
 	}
 
-	_, _, err := s.notificationService.CreateNotificationWithDelivery(&notification)
-	if err != nil {
-		return fmt.Errorf("failed to send notification: %w", err)
+	preview := []rune(message.Content)
+	if len(preview) > 100 {
+		preview = append(preview[:97], []rune("...")...)
+	}
+
+	for _, recipientID := range recipientIDs {
+		if recipientID == 0 {
+			continue
+		}
+
+		// Create notification for the receiver
+		notification := models.Notification{
+			UserID:    recipientID,
+			Title:     fmt.Sprintf("New message from %s", userDisplayName(&sender)),
+			Message:   string(preview),
+			Type:      "NEW_MESSAGE",
+			RelatedID: relatedID,
+		}
+
+		_, _, err := s.notificationService.CreateNotificationWithDelivery(&notification)
+		if err != nil {
+			log.Printf("Failed to send message notification to user %d: %v", recipientID, err)
+		}
 	}
 
 	return nil
@@ -225,18 +302,15 @@ func (s *NotificationTriggerService) DelayDetectionHandler(tripID uint, delayMin
 		return fmt.Errorf("failed to get loads: %w", err)
 	}
 
-	// Prepare notification message
-	message := fmt.Sprintf("Your shipment is delayed by %d minutes", delayMinutes)
-	if reason != "" {
-		message += " due to " + reason
-	}
-
 	// Send notifications to all shippers with loads on this trip
 	for _, load := range loads {
 		notification := models.Notification{
-			UserID:    load.ShipperID,
-			Title:     "Shipment Delayed",
-			Message:   message,
+			UserID:     load.ShipperID,
+			MessageKey: "notification.trip_delayed",
+			MessageParams: map[string]interface{}{
+				"minutes": delayMinutes,
+				"reason":  reason,
+			},
 			Type:      "TRIP_DELAYED",
 			RelatedID: tripID,
 		}
@@ -290,18 +364,17 @@ func (s *NotificationTriggerService) ETAUpdateHandler(tripID uint, newETA time.T
 		return nil
 	}
 
-	// Prepare notification message
-	message := fmt.Sprintf("Your shipment's estimated arrival time has been updated to %s",
-		newETA.Format("Jan 2, 2006 at 3:04 PM"))
+	// The new ETA is told at the trip's destination
+	localETA := timezone.In(newETA, trip.DestinationTimezone)
 
 	// Send notifications to all shippers with loads on this trip
 	for _, load := range loads {
 		notification := models.Notification{
-			UserID:    load.ShipperID,
-			Title:     "ETA Updated",
-			Message:   message,
-			Type:      "ETA_UPDATED",
-			RelatedID: tripID,
+			UserID:        load.ShipperID,
+			MessageKey:    "notification.eta_updated",
+			MessageParams: map[string]interface{}{"eta": localETA},
+			Type:          "ETA_UPDATED",
+			RelatedID:     tripID,
 		}
 
 		_, _, err := s.notificationService.CreateNotificationWithDelivery(&notification)
@@ -327,8 +400,8 @@ func (s *NotificationTriggerService) ETAUpdateHandler(tripID uint, newETA time.T
 		nil,
 		nil,
 		fmt.Sprintf("ETA updated from %s to %s",
-			trip.EstimatedArrival.Format("Jan 2, 2006 at 3:04 PM"),
-			newETA.Format("Jan 2, 2006 at 3:04 PM")),
+			FormatArrival(&trip, trip.EstimatedArrival),
+			FormatArrival(&trip, newETA)),
 	)
 
 	return nil
@@ -364,11 +437,11 @@ func (s *NotificationTriggerService) LocationMilestoneHandler(tripID uint, miles
 
 		// Create notification
 		notification := models.Notification{
-			UserID:    load.ShipperID,
-			Title:     "Location Update",
-			Message:   fmt.Sprintf("Your shipment has reached %s", milestone),
-			Type:      "LOCATION_UPDATE",
-			RelatedID: tripID,
+			UserID:        load.ShipperID,
+			MessageKey:    "notification.location_update",
+			MessageParams: map[string]interface{}{"location": milestone},
+			Type:          "LOCATION_UPDATE",
+			RelatedID:     tripID,
 		}
 
 		_, _, err = s.notificationService.CreateNotificationWithDelivery(&notification)
@@ -0,0 +1,453 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Ops channel providers
+const (
+	OpsChannelSlack = "SLACK"
+	OpsChannelTeams = "TEAMS"
+)
+
+// Types of ops alerts, which channels choose the alerts they get by
+const (
+	// Trips more than two hours behind schedule
+	OpsAlertCriticalDelay = "CRITICAL_DELAY"
+	// HIGH severity anomalies in a trip's tracking data
+	OpsAlertTrackingAnomaly = "TRACKING_ANOMALY"
+	// Loads moved to EXCEPTION
+	OpsAlertLoadException = "LOAD_EXCEPTION"
+	// Batches of notifications to members that failed to send
+	OpsAlertNotificationFailure = "NOTIFICATION_FAILURE"
+	// Posted to check a channel is connected, whatever types it gets
+	OpsAlertTest = "TEST"
+)
+
+// ErrOpsChannelNotFound is returned for channels that aren't connected to
+// the organization
+var ErrOpsChannelNotFound = errors.New("ops channel not found")
+
+// OpsAlertTypes lists the alert types channels can be routed
+var OpsAlertTypes = []string{OpsAlertCriticalDelay, OpsAlertTrackingAnomaly, OpsAlertLoadException, OpsAlertNotificationFailure}
+
+var opsAlertTitles = map[string]string{
+	OpsAlertCriticalDelay:       "Critical delay",
+	OpsAlertTrackingAnomaly:     "Tracking anomaly",
+	OpsAlertLoadException:       "Load exception",
+	OpsAlertNotificationFailure: "Notifications failed",
+	OpsAlertTest:                "TripLink alerts connected",
+}
+
+// Built-in message templates of each alert type, rendered with
+// OpsAlertTemplateData. Channels can replace them with their own.
+var opsAlertTemplates = map[string]string{
+	OpsAlertCriticalDelay:       `Trip {{.TripID}} is {{.Data.delay_minutes}} minutes behind schedule: {{.Data.reason}}`,
+	OpsAlertTrackingAnomaly:     `Trip {{.TripID}}: {{.Data.description}}`,
+	OpsAlertLoadException:       `Load {{.Data.booking_reference}} on trip {{.TripID}} was {{.Data.previous_status}} and is now an exception`,
+	OpsAlertNotificationFailure: `{{.Data.failed}} notifications to members of {{.Organization}} failed to send: {{.Data.error}}`,
+	OpsAlertTest:                `{{.Organization}} will get {{.Data.event_types}} alerts in this channel`,
+}
+
+// OpsAlert is an operational event posted to the channels of the
+// organization it happened in
+type OpsAlert struct {
+	Type           string
+	OrganizationID uint
+	TripID         uint // trip the alert links to, if any
+	// Values the alert's message is rendered with
+	Data map[string]interface{}
+}
+
+// OpsAlertTemplateData is the data available to ops alert templates
+type OpsAlertTemplateData struct {
+	Type         string
+	Title        string
+	Organization string
+	TripID       uint
+	URL          string // of the trip in the web app
+	Data         map[string]interface{}
+}
+
+// OpsChannelRequest connects a channel to an organization or changes it
+type OpsChannelRequest struct {
+	Name       string            `json:"name"`
+	Provider   string            `json:"provider"`    // SLACK or TEAMS
+	WebhookURL string            `json:"webhook_url"` // incoming webhook, kept when empty on updates
+	EventTypes []string          `json:"event_types"` // alert types posted, all when empty
+	Templates  map[string]string `json:"templates"`   // message templates by alert type
+	Active     *bool             `json:"active"`
+}
+
+// OpsAlertService posts ops alerts to the Slack and Microsoft Teams
+// channels of organizations and manages the channels
+type OpsAlertService struct {
+	db            *gorm.DB
+	cfg           *config.OpsAlertConfig
+	client        *http.Client
+	organizations *OrganizationService
+}
+
+// NewOpsAlertService creates a new OpsAlertService
+func NewOpsAlertService(db *gorm.DB, cfg *config.OpsAlertConfig) *OpsAlertService {
+	return &OpsAlertService{
+		db:            db,
+		cfg:           cfg,
+		client:        &http.Client{Timeout: cfg.Timeout},
+		organizations: NewOrganizationService(db),
+	}
+}
+
+// The ops alert service of this instance, nil while alerts are disabled
+var (
+	opsAlertServiceMu       sync.RWMutex
+	opsAlertServiceInstance *OpsAlertService
+)
+
+// GetOpsAlertService returns the ops alert service, or nil when alerts are
+// disabled
+func GetOpsAlertService() *OpsAlertService {
+	opsAlertServiceMu.RLock()
+	defer opsAlertServiceMu.RUnlock()
+	return opsAlertServiceInstance
+}
+
+// SetOpsAlertService sets the ops alert service events are posted with
+func SetOpsAlertService(service *OpsAlertService) {
+	opsAlertServiceMu.Lock()
+	defer opsAlertServiceMu.Unlock()
+	opsAlertServiceInstance = service
+}
+
+// sendOpsAlert posts an alert when ops alerts are enabled
+func sendOpsAlert(alert OpsAlert) {
+	if service := GetOpsAlertService(); service != nil {
+		service.Send(alert)
+	}
+}
+
+// sendTripOpsAlert posts an alert about a trip to the channels of the trip's
+// organization. Trips outside an organization have no channels.
+func sendTripOpsAlert(db *gorm.DB, tripID uint, alert OpsAlert) {
+	service := GetOpsAlertService()
+	if service == nil {
+		return
+	}
+	var trip models.Trip
+	if err := db.Select("id", "organization_id").First(&trip, tripID).Error; err != nil || trip.OrganizationID == nil {
+		return
+	}
+	alert.OrganizationID = *trip.OrganizationID
+	alert.TripID = tripID
+	service.Send(alert)
+}
+
+// Send posts an alert to the active channels of its organization that get
+// its type, returning how many it was posted to. A channel that can't be
+// posted to records the error and doesn't hold up the others.
+func (s *OpsAlertService) Send(alert OpsAlert) int {
+	var channels []models.OpsChannel
+	if err := s.db.Where("organization_id = ? AND active = ?", alert.OrganizationID, true).
+		Order("id ASC").Find(&channels).Error; err != nil {
+		log.Printf("Failed to get ops channels of organization %d: %v", alert.OrganizationID, err)
+		return 0
+	}
+
+	sent := 0
+	for i := range channels {
+		channel := &channels[i]
+		if !opsChannelRoutes(channel, alert.Type) {
+			continue
+		}
+		if err := s.post(channel, alert); err != nil {
+			log.Printf("Failed to post %s alert to ops channel %d: %v", alert.Type, channel.ID, err)
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// opsChannelRoutes reports whether a channel gets alerts of a type
+func opsChannelRoutes(channel *models.OpsChannel, alertType string) bool {
+	if len(channel.EventTypes) == 0 || alertType == OpsAlertTest {
+		return true
+	}
+	for _, eventType := range channel.EventTypes {
+		if eventType == alertType {
+			return true
+		}
+	}
+	return false
+}
+
+// post renders an alert for a channel's provider and posts it, recording
+// the outcome on the channel
+func (s *OpsAlertService) post(channel *models.OpsChannel, alert OpsAlert) error {
+	err := s.deliver(channel, alert)
+
+	updates := map[string]interface{}{"last_error": ""}
+	if err != nil {
+		updates["last_error"] = err.Error()
+	} else {
+		updates["last_sent_at"] = time.Now()
+	}
+	s.db.Model(channel).Updates(updates)
+	return err
+}
+
+func (s *OpsAlertService) deliver(channel *models.OpsChannel, alert OpsAlert) error {
+	data := s.templateData(alert)
+	text, err := renderOpsAlert(channel, data)
+	if err != nil {
+		return err
+	}
+
+	var payload interface{}
+	switch channel.Provider {
+	case OpsChannelSlack:
+		payload = slackPayload(data, text)
+	case OpsChannelTeams:
+		payload = teamsPayload(data, text)
+	default:
+		return fmt.Errorf("unknown provider %s", channel.Provider)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	resp, err := s.client.Post(channel.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// templateData returns the data an alert's message is rendered with
+func (s *OpsAlertService) templateData(alert OpsAlert) OpsAlertTemplateData {
+	data := OpsAlertTemplateData{
+		Type:   alert.Type,
+		Title:  opsAlertTitles[alert.Type],
+		TripID: alert.TripID,
+		Data:   alert.Data,
+	}
+	var organization models.Organization
+	if err := s.db.Select("id", "name").First(&organization, alert.OrganizationID).Error; err == nil {
+		data.Organization = organization.Name
+	}
+	if alert.TripID != 0 {
+		data.URL = fmt.Sprintf("%s/trips/%d", s.cfg.AppBaseURL, alert.TripID)
+	}
+	return data
+}
+
+// renderOpsAlert renders the message of an alert with the channel's template
+// of its type, or the built-in one
+func renderOpsAlert(channel *models.OpsChannel, data OpsAlertTemplateData) (string, error) {
+	content, ok := channel.Templates[data.Type]
+	if !ok {
+		content = opsAlertTemplates[data.Type]
+	}
+	tmpl, err := template.New(data.Type).Option("missingkey=zero").Parse(content)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", data.Type, err)
+	}
+	var text bytes.Buffer
+	if err := tmpl.Execute(&text, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", data.Type, err)
+	}
+	return text.String(), nil
+}
+
+// slackPayload is the body of a Slack incoming webhook post, formatted with
+// Slack's mrkdwn
+func slackPayload(data OpsAlertTemplateData, text string) map[string]interface{} {
+	message := "*" + data.Title + "*\n" + text
+	if data.URL != "" {
+		message += "\n<" + data.URL + "|Open in TripLink>"
+	}
+	return map[string]interface{}{"text": message}
+}
+
+// teamsPayload is the body of a Microsoft Teams incoming webhook post, as a
+// message card
+func teamsPayload(data OpsAlertTemplateData, text string) map[string]interface{} {
+	card := map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    data.Title,
+		"themeColor": "D93F0B",
+		"title":      data.Title,
+		"text":       text,
+	}
+	if data.URL != "" {
+		card["potentialAction"] = []map[string]interface{}{{
+			"@type":   "OpenUri",
+			"name":    "Open in TripLink",
+			"targets": []map[string]string{{"os": "default", "uri": data.URL}},
+		}}
+	}
+	return card
+}
+
+// GetChannels returns the ops channels of an organization the user owns
+func (s *OpsAlertService) GetChannels(organizationID, userID uint) ([]models.OpsChannel, error) {
+	if err := s.organizations.checkOwner(organizationID, userID); err != nil {
+		return nil, err
+	}
+	var channels []models.OpsChannel
+	if err := s.db.Where("organization_id = ?", organizationID).Order("id ASC").Find(&channels).Error; err != nil {
+		return nil, fmt.Errorf("failed to get ops channels: %w", err)
+	}
+	return channels, nil
+}
+
+// CreateChannel connects a channel to an organization the user owns
+func (s *OpsAlertService) CreateChannel(organizationID, userID uint, req OpsChannelRequest) (*models.OpsChannel, error) {
+	if err := s.organizations.checkOwner(organizationID, userID); err != nil {
+		return nil, err
+	}
+	channel := &models.OpsChannel{OrganizationID: organizationID, Active: true}
+	if err := applyOpsChannelRequest(channel, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(channel).Error; err != nil {
+		return nil, fmt.Errorf("failed to create ops channel: %w", err)
+	}
+	return channel, nil
+}
+
+// UpdateChannel changes a channel of an organization the user owns
+func (s *OpsAlertService) UpdateChannel(organizationID, userID, channelID uint, req OpsChannelRequest) (*models.OpsChannel, error) {
+	channel, err := s.getChannel(organizationID, userID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyOpsChannelRequest(channel, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(channel).Error; err != nil {
+		return nil, fmt.Errorf("failed to update ops channel: %w", err)
+	}
+	return channel, nil
+}
+
+// DeleteChannel disconnects a channel from an organization the user owns
+func (s *OpsAlertService) DeleteChannel(organizationID, userID, channelID uint) error {
+	channel, err := s.getChannel(organizationID, userID, channelID)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Delete(channel).Error; err != nil {
+		return fmt.Errorf("failed to delete ops channel: %w", err)
+	}
+	return nil
+}
+
+// TestChannel posts a test alert to a channel of an organization the user
+// owns, returning the channel with the outcome
+func (s *OpsAlertService) TestChannel(organizationID, userID, channelID uint) (*models.OpsChannel, error) {
+	channel, err := s.getChannel(organizationID, userID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	eventTypes := channel.EventTypes
+	if len(eventTypes) == 0 {
+		eventTypes = OpsAlertTypes
+	}
+	alert := OpsAlert{
+		Type:           OpsAlertTest,
+		OrganizationID: organizationID,
+		Data:           map[string]interface{}{"event_types": strings.Join(eventTypes, ", ")},
+	}
+	err = s.post(channel, alert)
+	s.db.First(channel, channel.ID)
+	return channel, err
+}
+
+func (s *OpsAlertService) getChannel(organizationID, userID, channelID uint) (*models.OpsChannel, error) {
+	if err := s.organizations.checkOwner(organizationID, userID); err != nil {
+		return nil, err
+	}
+	var channel models.OpsChannel
+	if err := s.db.Where("id = ? AND organization_id = ?", channelID, organizationID).First(&channel).Error; err != nil {
+		return nil, ErrOpsChannelNotFound
+	}
+	return &channel, nil
+}
+
+// applyOpsChannelRequest validates a channel request and applies it
+func applyOpsChannelRequest(channel *models.OpsChannel, req OpsChannelRequest) error {
+	if req.Name = strings.TrimSpace(req.Name); req.Name == "" {
+		return errors.New("name is required")
+	}
+
+	provider := strings.ToUpper(req.Provider)
+	if provider != OpsChannelSlack && provider != OpsChannelTeams {
+		return fmt.Errorf("invalid provider %q, use SLACK or TEAMS", req.Provider)
+	}
+
+	if req.WebhookURL != "" {
+		parsed, err := url.Parse(req.WebhookURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return errors.New("invalid webhook URL")
+		}
+		channel.WebhookURL = req.WebhookURL
+	} else if channel.WebhookURL == "" {
+		return errors.New("webhook URL is required")
+	}
+
+	eventTypes := make([]string, 0, len(req.EventTypes))
+	for _, eventType := range req.EventTypes {
+		eventType = strings.ToUpper(eventType)
+		if opsAlertTitles[eventType] == "" || eventType == OpsAlertTest {
+			return fmt.Errorf("unknown alert type %q, use one of %s", eventType, strings.Join(OpsAlertTypes, ", "))
+		}
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+
+	templates := make(map[string]string, len(req.Templates))
+	for eventType, content := range req.Templates {
+		eventType = strings.ToUpper(eventType)
+		if opsAlertTitles[eventType] == "" {
+			return fmt.Errorf("template for unknown alert type %q", eventType)
+		}
+		if _, err := template.New(eventType).Parse(content); err != nil {
+			return fmt.Errorf("invalid %s template: %w", eventType, err)
+		}
+		templates[eventType] = content
+	}
+
+	channel.Name = req.Name
+	channel.Provider = provider
+	channel.EventTypes = eventTypes
+	channel.Templates = templates
+	if req.Active != nil {
+		channel.Active = *req.Active
+	}
+	return nil
+}
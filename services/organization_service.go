@@ -0,0 +1,359 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Organization types
+const (
+	OrganizationCarrier = "CARRIER"
+	OrganizationShipper = "SHIPPER"
+)
+
+// Organization membership roles. Owners manage the organization and its
+// members, dispatchers manage its trips and loads, finance members see them
+// and drivers only see the trips they are assigned to.
+const (
+	OrganizationOwner      = "OWNER"
+	OrganizationDispatcher = "DISPATCHER"
+	OrganizationDriver     = "DRIVER"
+	OrganizationFinance    = "FINANCE"
+)
+
+var (
+	// ErrOrganizationNotFound is returned for organizations that don't exist
+	// or that the user isn't a member of
+	ErrOrganizationNotFound = errors.New("organization not found")
+	// ErrNotOrganizationOwner is returned when a member other than an owner
+	// changes an organization
+	ErrNotOrganizationOwner = errors.New("only the organization's owners can change it")
+	// ErrOrganizationMemberNotFound is returned for users who aren't members
+	// of the organization
+	ErrOrganizationMemberNotFound = errors.New("organization member not found")
+)
+
+// OrganizationRequest creates or renames an organization
+type OrganizationRequest struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // CARRIER, SHIPPER
+}
+
+// MembershipRequest adds a user to an organization, by ID or email, or
+// changes their role
+type MembershipRequest struct {
+	UserID uint   `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"` // OWNER, DISPATCHER, DRIVER, FINANCE
+}
+
+// OrganizationScope is what a user can see: their own trips and loads and
+// those of the organizations they are a member of other than as a driver
+type OrganizationScope struct {
+	UserID          uint   `json:"user_id"`
+	OrganizationIDs []uint `json:"organization_ids,omitempty"`
+	// AssignedTripIDs are the trips the user is assigned to drive
+	AssignedTripIDs []uint `json:"-"`
+}
+
+// OrganizationService manages carrier and shipper organizations and their
+// members
+type OrganizationService struct {
+	db *gorm.DB
+}
+
+// NewOrganizationService creates a new OrganizationService
+func NewOrganizationService(db *gorm.DB) *OrganizationService {
+	return &OrganizationService{db: db}
+}
+
+// CreateOrganization creates an organization owned by the user
+func (s *OrganizationService) CreateOrganization(ownerID uint, req OrganizationRequest) (*models.Organization, error) {
+	organization := &models.Organization{
+		Name:    strings.TrimSpace(req.Name),
+		Type:    strings.ToUpper(req.Type),
+		OwnerID: ownerID,
+	}
+	if organization.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if organization.Type != OrganizationCarrier && organization.Type != OrganizationShipper {
+		return nil, errors.New("type must be CARRIER or SHIPPER")
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(organization).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrganizationMembership{
+			OrganizationID: organization.ID,
+			UserID:         ownerID,
+			Role:           OrganizationOwner,
+		}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", err)
+	}
+	return s.GetOrganization(organization.ID, ownerID)
+}
+
+// GetUserOrganizations returns the organizations a user is a member of
+func (s *OrganizationService) GetUserOrganizations(userID uint) ([]models.Organization, error) {
+	var organizations []models.Organization
+	if err := s.db.Where("id IN (?)", s.db.Model(&models.OrganizationMembership{}).
+		Select("organization_id").Where("user_id = ?", userID)).
+		Order("name ASC").Find(&organizations).Error; err != nil {
+		return nil, fmt.Errorf("failed to get organizations: %w", err)
+	}
+	return organizations, nil
+}
+
+// GetOrganization returns an organization with its members, for one of them
+func (s *OrganizationService) GetOrganization(organizationID, userID uint) (*models.Organization, error) {
+	if _, ok := s.MemberRole(organizationID, userID); !ok {
+		return nil, ErrOrganizationNotFound
+	}
+
+	var organization models.Organization
+	if err := s.db.Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Preload("Members.User").First(&organization, organizationID).Error; err != nil {
+		return nil, ErrOrganizationNotFound
+	}
+	return &organization, nil
+}
+
+// UpdateOrganization renames an organization. Its type can't be changed.
+func (s *OrganizationService) UpdateOrganization(organizationID, userID uint, req OrganizationRequest) (*models.Organization, error) {
+	if err := s.checkOwner(organizationID, userID); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	if err := s.db.Model(&models.Organization{}).Where("id = ?", organizationID).
+		Update("name", name).Error; err != nil {
+		return nil, fmt.Errorf("failed to update organization: %w", err)
+	}
+	return s.GetOrganization(organizationID, userID)
+}
+
+// AddMember adds a user to an organization with a role
+func (s *OrganizationService) AddMember(organizationID, userID uint, req MembershipRequest) (*models.OrganizationMembership, error) {
+	if err := s.checkOwner(organizationID, userID); err != nil {
+		return nil, err
+	}
+	if err := validateMembershipRole(req.Role); err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	query := s.db.Where("id = ?", req.UserID)
+	if req.UserID == 0 {
+		query = s.db.Where("email = ?", strings.TrimSpace(req.Email))
+	}
+	if err := query.First(&user).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if _, ok := s.MemberRole(organizationID, user.ID); ok {
+		return nil, errors.New("the user is already a member of the organization")
+	}
+
+	membership := &models.OrganizationMembership{
+		OrganizationID: organizationID,
+		UserID:         user.ID,
+		Role:           strings.ToUpper(req.Role),
+	}
+	if err := s.db.Create(membership).Error; err != nil {
+		return nil, fmt.Errorf("failed to add organization member: %w", err)
+	}
+	membership.User = &user
+	return membership, nil
+}
+
+// UpdateMember changes the role of a member of an organization
+func (s *OrganizationService) UpdateMember(organizationID, userID, memberID uint, role string) (*models.OrganizationMembership, error) {
+	if err := s.checkOwner(organizationID, userID); err != nil {
+		return nil, err
+	}
+	if err := validateMembershipRole(role); err != nil {
+		return nil, err
+	}
+	membership, err := s.getMembership(organizationID, memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	role = strings.ToUpper(role)
+	if membership.Role == OrganizationOwner && role != OrganizationOwner {
+		if err := s.checkOtherOwners(organizationID, memberID); err != nil {
+			return nil, err
+		}
+	}
+
+	membership.Role = role
+	if err := s.db.Model(&models.OrganizationMembership{}).Where("id = ?", membership.ID).
+		Update("role", role).Error; err != nil {
+		return nil, fmt.Errorf("failed to update organization member: %w", err)
+	}
+	return membership, nil
+}
+
+// RemoveMember removes a member from an organization. Owners remove members;
+// members can also leave on their own.
+func (s *OrganizationService) RemoveMember(organizationID, userID, memberID uint) error {
+	if userID != memberID {
+		if err := s.checkOwner(organizationID, userID); err != nil {
+			return err
+		}
+	}
+	membership, err := s.getMembership(organizationID, memberID)
+	if err != nil {
+		if userID == memberID {
+			return ErrOrganizationNotFound
+		}
+		return err
+	}
+	if membership.Role == OrganizationOwner {
+		if err := s.checkOtherOwners(organizationID, memberID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.db.Delete(&models.OrganizationMembership{}, membership.ID).Error; err != nil {
+		return fmt.Errorf("failed to remove organization member: %w", err)
+	}
+	return nil
+}
+
+// MemberRole returns a user's role in an organization, and whether they are
+// a member at all
+func (s *OrganizationService) MemberRole(organizationID, userID uint) (string, bool) {
+	membership, err := s.getMembership(organizationID, userID)
+	if err != nil {
+		return "", false
+	}
+	return membership.Role, true
+}
+
+// CanDispatch reports whether a user manages an organization's trips and
+// loads: its owners and dispatchers
+func (s *OrganizationService) CanDispatch(organizationID, userID uint) bool {
+	role, ok := s.MemberRole(organizationID, userID)
+	return ok && (role == OrganizationOwner || role == OrganizationDispatcher)
+}
+
+// VisibleOrganizationIDs returns the organizations whose trips and loads a
+// user sees. Drivers see the trips they are assigned to instead.
+func (s *OrganizationService) VisibleOrganizationIDs(userID uint) ([]uint, error) {
+	var organizationIDs []uint
+	if err := s.db.Model(&models.OrganizationMembership{}).
+		Where("user_id = ? AND role <> ?", userID, OrganizationDriver).
+		Order("organization_id ASC").
+		Pluck("organization_id", &organizationIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get organizations: %w", err)
+	}
+	return organizationIDs, nil
+}
+
+// Scope returns what a user can see across trips and loads, or nil for
+// admins, who see everything
+func (s *OrganizationService) Scope(userID uint) (*OrganizationScope, error) {
+	var user models.User
+	if err := s.db.Select("id", "role").First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if user.Role == "ADMIN" {
+		return nil, nil
+	}
+
+	organizationIDs, err := s.VisibleOrganizationIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	assignedTripIDs, err := NewTripAssignmentService(s.db).AssignedTripIDs(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &OrganizationScope{UserID: userID, OrganizationIDs: organizationIDs, AssignedTripIDs: assignedTripIDs}, nil
+}
+
+// ResolveOrganization returns the organization a user's new trip or load
+// belongs to: the requested one, which the user must dispatch for, or else
+// the first organization of the type they dispatch for. Users who aren't
+// dispatching for any organization create trips and loads of their own.
+func (s *OrganizationService) ResolveOrganization(userID uint, organizationType string, requested *uint) (*uint, error) {
+	if requested != nil && *requested != 0 {
+		if !s.CanDispatch(*requested, userID) {
+			return nil, errors.New("only the organization's owners and dispatchers can add to it")
+		}
+		return requested, nil
+	}
+
+	var membership models.OrganizationMembership
+	err := s.db.Joins("JOIN organizations ON organizations.id = organization_memberships.organization_id AND organizations.deleted_at IS NULL").
+		Where("organization_memberships.user_id = ? AND organization_memberships.role IN ? AND organizations.type = ?",
+			userID, []string{OrganizationOwner, OrganizationDispatcher}, organizationType).
+		Order("organization_memberships.id ASC").
+		First(&membership).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+	return &membership.OrganizationID, nil
+}
+
+// getMembership returns a user's membership of an organization
+func (s *OrganizationService) getMembership(organizationID, userID uint) (*models.OrganizationMembership, error) {
+	var membership models.OrganizationMembership
+	if err := s.db.Where("organization_id = ? AND user_id = ?", organizationID, userID).
+		First(&membership).Error; err != nil {
+		return nil, ErrOrganizationMemberNotFound
+	}
+	return &membership, nil
+}
+
+// checkOwner checks that a user owns an organization. Organizations are not
+// found for non-members.
+func (s *OrganizationService) checkOwner(organizationID, userID uint) error {
+	role, ok := s.MemberRole(organizationID, userID)
+	if !ok {
+		return ErrOrganizationNotFound
+	}
+	if role != OrganizationOwner {
+		return ErrNotOrganizationOwner
+	}
+	return nil
+}
+
+// checkOtherOwners keeps an organization from being left without an owner
+func (s *OrganizationService) checkOtherOwners(organizationID, memberID uint) error {
+	var owners int64
+	if err := s.db.Model(&models.OrganizationMembership{}).
+		Where("organization_id = ? AND role = ? AND user_id <> ?", organizationID, OrganizationOwner, memberID).
+		Count(&owners).Error; err != nil {
+		return fmt.Errorf("failed to count organization owners: %w", err)
+	}
+	if owners == 0 {
+		return errors.New("an organization must keep at least one owner")
+	}
+	return nil
+}
+
+// validateMembershipRole checks that a membership role is known
+func validateMembershipRole(role string) error {
+	switch strings.ToUpper(role) {
+	case OrganizationOwner, OrganizationDispatcher, OrganizationDriver, OrganizationFinance:
+		return nil
+	}
+	return errors.New("role must be OWNER, DISPATCHER, DRIVER or FINANCE")
+}
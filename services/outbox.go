@@ -0,0 +1,351 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// maxOutboxBackoff caps the wait between attempts to publish an event
+const maxOutboxBackoff = time.Hour
+
+// LocationUpdateEvent is the outbox event type of location updates. They
+// are only recorded while a publisher wants them, see
+// SetLocationOutboxEnabled.
+const LocationUpdateEvent = "LOCATION_UPDATE"
+
+var locationOutboxEnabled atomic.Bool
+
+// SetLocationOutboxEnabled sets whether location updates are recorded in the
+// outbox
+func SetLocationOutboxEnabled(enabled bool) {
+	locationOutboxEnabled.Store(enabled)
+}
+
+// LocationOutboxEnabled returns whether location updates are recorded in
+// the outbox
+func LocationOutboxEnabled() bool {
+	return locationOutboxEnabled.Load()
+}
+
+// RecordTrackingEvent creates a tracking event and records it in the outbox
+// for publishing. Pass the transaction of the state change the event
+// describes, so that the event is published if and only if the change is
+// committed.
+func RecordTrackingEvent(tx *gorm.DB, event *models.TrackingEvent) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if err := tx.Create(event).Error; err != nil {
+		return fmt.Errorf("failed to create tracking event: %w", err)
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode tracking event: %w", err)
+	}
+	outboxEvent := models.OutboxEvent{
+		TripID:        event.TripID,
+		LoadID:        event.LoadID,
+		EventType:     event.EventType,
+		Payload:       string(payload),
+		NextAttemptAt: event.Timestamp,
+	}
+	if err := tx.Create(&outboxEvent).Error; err != nil {
+		return fmt.Errorf("failed to record outbox event: %w", err)
+	}
+	return nil
+}
+
+// RecordLocationUpdate records a saved tracking record in the outbox. Like
+// RecordTrackingEvent, pass the transaction the record is created in.
+func RecordLocationUpdate(tx *gorm.DB, record *models.TrackingRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode tracking record: %w", err)
+	}
+	outboxEvent := models.OutboxEvent{
+		TripID:        record.TripID,
+		LoadID:        record.LoadID,
+		EventType:     LocationUpdateEvent,
+		Payload:       string(payload),
+		NextAttemptAt: time.Now(),
+	}
+	if err := tx.Create(&outboxEvent).Error; err != nil {
+		return fmt.Errorf("failed to record outbox event: %w", err)
+	}
+	return nil
+}
+
+// OutboxMessage is the envelope outbox events are published in. Events are
+// published at least once, so consumers should skip IDs they have seen.
+type OutboxMessage struct {
+	ID        uint            `json:"id"`
+	Type      string          `json:"type"`
+	TripID    uint            `json:"trip_id"`
+	LoadID    *uint           `json:"load_id,omitempty"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewOutboxMessage wraps an outbox event for publishing
+func NewOutboxMessage(event models.OutboxEvent) OutboxMessage {
+	return OutboxMessage{
+		ID:        event.ID,
+		Type:      event.EventType,
+		TripID:    event.TripID,
+		LoadID:    event.LoadID,
+		Data:      json.RawMessage(event.Payload),
+		CreatedAt: event.CreatedAt,
+	}
+}
+
+// OutboxPublisher publishes outbox events to one destination. Name must be
+// stable across restarts, it records which publishers have an event.
+type OutboxPublisher interface {
+	Name() string
+	Publish(ctx context.Context, message OutboxMessage) error
+}
+
+// OutboxFilter is implemented by publishers that only publish some event
+// types. Events they don't accept count as delivered to them.
+type OutboxFilter interface {
+	Accepts(eventType string) bool
+}
+
+func acceptsEvent(publisher OutboxPublisher, eventType string) bool {
+	filter, ok := publisher.(OutboxFilter)
+	return !ok || filter.Accepts(eventType)
+}
+
+// OutboxDispatcher publishes the events recorded in the outbox. Events of a
+// trip are published in the order they were recorded: while one is waiting
+// to be retried, the trip's later events wait too.
+type OutboxDispatcher struct {
+	db         *gorm.DB
+	cfg        *config.OutboxConfig
+	publishers []OutboxPublisher
+	now        func() time.Time
+}
+
+// NewOutboxDispatcher creates a new OutboxDispatcher
+func NewOutboxDispatcher(db *gorm.DB, cfg *config.OutboxConfig, publishers ...OutboxPublisher) *OutboxDispatcher {
+	return &OutboxDispatcher{db: db, cfg: cfg, publishers: publishers, now: time.Now}
+}
+
+// DispatchPending publishes a batch of pending events, oldest first. It is
+// safe to run on several instances at once: each event is claimed by the
+// instance publishing it.
+func (d *OutboxDispatcher) DispatchPending() error {
+	var events []models.OutboxEvent
+	err := d.db.Where("published_at IS NULL AND failed_at IS NULL").
+		Order("id").
+		Limit(d.cfg.BatchSize).
+		Find(&events).Error
+	if err != nil {
+		return fmt.Errorf("failed to get outbox events: %w", err)
+	}
+
+	waiting := make(map[uint]bool)
+	failed := 0
+	for i := range events {
+		event := &events[i]
+		if waiting[event.TripID] {
+			continue
+		}
+		if event.NextAttemptAt.After(d.now()) || !d.claim(event) {
+			waiting[event.TripID] = true
+			continue
+		}
+		if !d.publish(event) {
+			waiting[event.TripID] = true
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to publish %d outbox events", failed)
+	}
+	return nil
+}
+
+// claim reserves an event for this instance until the claim timeout
+func (d *OutboxDispatcher) claim(event *models.OutboxEvent) bool {
+	now := d.now()
+	result := d.db.Model(&models.OutboxEvent{}).
+		Where("id = ? AND published_at IS NULL AND (claimed_until IS NULL OR claimed_until < ?)", event.ID, now).
+		Update("claimed_until", now.Add(d.cfg.ClaimTimeout))
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// publish sends an event to the publishers that don't have it yet and
+// records the outcome, returning whether all of them have it now
+func (d *OutboxDispatcher) publish(event *models.OutboxEvent) bool {
+	message := NewOutboxMessage(*event)
+	delivered := parseDelivered(event.Delivered)
+
+	var errs []string
+	for _, publisher := range d.publishers {
+		if delivered[publisher.Name()] || !acceptsEvent(publisher, event.EventType) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), d.cfg.ClaimTimeout)
+		err := publisher.Publish(ctx, message)
+		cancel()
+		if err != nil {
+			errs = append(errs, publisher.Name()+": "+err.Error())
+			continue
+		}
+		delivered[publisher.Name()] = true
+		event.Delivered = joinDelivered(event.Delivered, publisher.Name())
+	}
+
+	now := d.now()
+	event.Attempts++
+	updates := map[string]interface{}{
+		"attempts":      event.Attempts,
+		"delivered":     event.Delivered,
+		"claimed_until": nil,
+	}
+	switch {
+	case len(errs) == 0:
+		updates["published_at"] = now
+		updates["last_error"] = ""
+	case event.Attempts >= d.cfg.MaxAttempts:
+		updates["failed_at"] = now
+		updates["last_error"] = strings.Join(errs, "; ")
+	default:
+		updates["next_attempt_at"] = now.Add(outboxBackoff(d.cfg.RetryBackoff, event.Attempts))
+		updates["last_error"] = strings.Join(errs, "; ")
+	}
+	d.db.Model(event).Updates(updates)
+
+	return len(errs) == 0
+}
+
+// outboxBackoff doubles the wait after every failed attempt
+func outboxBackoff(base time.Duration, attempts int) time.Duration {
+	backoff := base
+	for i := 1; i < attempts && backoff < maxOutboxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxOutboxBackoff {
+		return maxOutboxBackoff
+	}
+	return backoff
+}
+
+func parseDelivered(delivered string) map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range strings.Split(delivered, ",") {
+		if name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+func joinDelivered(delivered, name string) string {
+	if delivered == "" {
+		return name
+	}
+	return delivered + "," + name
+}
+
+// WebhookPublisher posts outbox events to an HTTP endpoint. The body is
+// signed with HMAC-SHA256 of the timestamp and the body, so receivers can
+// verify the sender and reject replays.
+type WebhookPublisher struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookPublisher creates a publisher posting to url
+func NewWebhookPublisher(url, secret string, timeout time.Duration) *WebhookPublisher {
+	return &WebhookPublisher{url: url, secret: secret, client: &http.Client{Timeout: timeout}}
+}
+
+// Name implements OutboxPublisher
+func (wp *WebhookPublisher) Name() string {
+	return "webhook:" + wp.url
+}
+
+// Accepts implements OutboxFilter. Location updates are only recorded for
+// Kafka, webhooks get the tracking events.
+func (wp *WebhookPublisher) Accepts(eventType string) bool {
+	return eventType != LocationUpdateEvent
+}
+
+// Publish implements OutboxPublisher
+func (wp *WebhookPublisher) Publish(ctx context.Context, message OutboxMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wp.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Triplink-Event-ID", strconv.FormatUint(uint64(message.ID), 10))
+	req.Header.Set("X-Triplink-Timestamp", timestamp)
+	req.Header.Set("X-Triplink-Signature", "sha256="+WebhookSignature(wp.secret, timestamp, body))
+
+	resp, err := wp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// WebhookSignature returns the hex HMAC-SHA256 an outbox webhook is signed
+// with: of the timestamp header, a dot and the body
+func WebhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// StreamPublisher streams outbox events to the clients following the trip's
+// location, through the shared location hub
+type StreamPublisher struct{}
+
+// Name implements OutboxPublisher
+func (StreamPublisher) Name() string {
+	return "stream"
+}
+
+// Accepts implements OutboxFilter. The hub streams location updates as they
+// are recorded already.
+func (StreamPublisher) Accepts(eventType string) bool {
+	return eventType != LocationUpdateEvent
+}
+
+// Publish implements OutboxPublisher
+func (StreamPublisher) Publish(ctx context.Context, message OutboxMessage) error {
+	return GetLocationHub().Publish(TripLocationUpdate{TripID: message.TripID, Event: &message})
+}
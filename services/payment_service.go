@@ -0,0 +1,327 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// PaymentGateway interface for different payment processors
+type PaymentGateway interface {
+	CreateCharge(request ChargeRequest) (*ChargeResult, error)
+	Refund(gatewayTxnID string, amount float64) (*RefundResult, error)
+	ParseWebhook(payload []byte, signature string) (*PaymentWebhookEvent, error)
+	Name() string
+}
+
+// ChargeRequest represents a request to charge a payer
+type ChargeRequest struct {
+	Amount          float64           `json:"amount"`
+	Currency        string            `json:"currency"`
+	PaymentMethodID string            `json:"payment_method_id"`
+	Description     string            `json:"description"`
+	IdempotencyKey  string            `json:"-"`
+	Metadata        map[string]string `json:"metadata"`
+}
+
+// ChargeResult represents the result of a charge at the gateway
+type ChargeResult struct {
+	GatewayTxnID  string `json:"gateway_txn_id"`
+	Status        string `json:"status"` // PENDING, COMPLETED, FAILED
+	FailureReason string `json:"failure_reason,omitempty"`
+	ClientSecret  string `json:"client_secret,omitempty"`
+}
+
+// RefundResult represents the result of a refund at the gateway
+type RefundResult struct {
+	GatewayRefundID string  `json:"gateway_refund_id"`
+	Amount          float64 `json:"amount"`
+}
+
+// PaymentWebhookEvent is a gateway webhook event converted to a transaction status change
+type PaymentWebhookEvent struct {
+	Type           string  `json:"type"`
+	GatewayTxnID   string  `json:"gateway_txn_id"`
+	Status         string  `json:"status,omitempty"` // empty when the event doesn't change status
+	FailureReason  string  `json:"failure_reason,omitempty"`
+	RefundedAmount float64 `json:"refunded_amount,omitempty"`
+}
+
+// PaymentService handles charging shippers for booked loads, gateway
+// webhooks and refunds
+type PaymentService struct {
+	db                 *gorm.DB
+	gateways           map[string]PaymentGateway
+	platformFeePercent float64
+	mu                 sync.RWMutex
+}
+
+// NewPaymentService creates a new payment service with the gateways configured in cfg
+func NewPaymentService(db *gorm.DB, cfg *config.PaymentConfig) *PaymentService {
+	s := &PaymentService{
+		db:                 db,
+		gateways:           make(map[string]PaymentGateway),
+		platformFeePercent: cfg.PlatformFeePercent,
+	}
+
+	if cfg.StripeSecretKey != "" {
+		s.RegisterGateway(NewStripePaymentGateway(cfg.StripeSecretKey, cfg.StripeWebhookSecret))
+	}
+
+	return s
+}
+
+// RegisterGateway adds a payment gateway to the service
+func (s *PaymentService) RegisterGateway(gateway PaymentGateway) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gateways[gateway.Name()] = gateway
+}
+
+// getGateway returns the gateway registered under name
+func (s *PaymentService) getGateway(name string) (PaymentGateway, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	gateway, exists := s.gateways[name]
+	if !exists {
+		return nil, fmt.Errorf("payment gateway %s is not configured", name)
+	}
+	return gateway, nil
+}
+
+// ChargeLoad charges the shipper of a booked load the agreed price and pays the
+// carrier of the trip the load is booked on
+func (s *PaymentService) ChargeLoad(loadID uint, gatewayName, paymentMethod, paymentMethodID string) (*models.Transaction, error) {
+	gateway, err := s.getGateway(gatewayName)
+	if err != nil {
+		return nil, err
+	}
+
+	var load models.Load
+	if err := s.db.First(&load, loadID).Error; err != nil {
+		return nil, errors.New("load not found")
+	}
+	if load.TripID == 0 || load.Status == "QUOTE_REQUESTED" || load.Status == "QUOTED" || load.Status == "CANCELLED" {
+		return nil, errors.New("load must be booked before payment")
+	}
+	if load.AgreedPrice <= 0 {
+		return nil, errors.New("load has no agreed price")
+	}
+
+	var trip models.Trip
+	if err := s.db.First(&trip, load.TripID).Error; err != nil {
+		return nil, errors.New("trip not found")
+	}
+
+	var existing int64
+	s.db.Model(&models.Transaction{}).
+		Where("load_id = ? AND status IN ?", loadID, []string{"PENDING", "COMPLETED"}).
+		Count(&existing)
+	if existing > 0 {
+		return nil, errors.New("load already has a pending or completed payment")
+	}
+
+	// Invoiced loads are charged the invoice total, surcharges included
+	amount, currency := load.AgreedPrice, load.Currency
+	var invoice models.Invoice
+	if err := s.db.Where("load_id = ? AND status = ?", loadID, InvoiceStatusIssued).First(&invoice).Error; err == nil {
+		amount, currency = invoice.Total, invoice.Currency
+	}
+
+	transaction := models.Transaction{
+		LoadID:         load.ID,
+		PayerID:        load.ShipperID,
+		PayeeID:        trip.UserID,
+		Amount:         amount,
+		Currency:       currency,
+		PlatformFee:    math.Round(amount*s.platformFeePercent) / 100,
+		PaymentMethod:  paymentMethod,
+		PaymentGateway: gateway.Name(),
+		Status:         "PENDING",
+	}
+	if transaction.Currency == "" {
+		transaction.Currency = "USD"
+	}
+	transaction.BaseAmount, transaction.BaseCurrency, transaction.ExchangeRate = GetCurrencyService().Normalize(transaction.Amount, transaction.Currency)
+	if err := s.db.Create(&transaction).Error; err != nil {
+		return nil, fmt.Errorf("failed to create transaction: %w", err)
+	}
+
+	result, err := gateway.CreateCharge(ChargeRequest{
+		Amount:          transaction.Amount,
+		Currency:        transaction.Currency,
+		PaymentMethodID: paymentMethodID,
+		Description:     fmt.Sprintf("TripLink load %s", load.BookingReference),
+		IdempotencyKey:  fmt.Sprintf("transaction-%d", transaction.ID),
+		Metadata: map[string]string{
+			"transaction_id": fmt.Sprint(transaction.ID),
+			"load_id":        fmt.Sprint(load.ID),
+		},
+	})
+	if err != nil {
+		s.applyStatus(&transaction, "FAILED", err.Error())
+		return &transaction, fmt.Errorf("charge failed: %w", err)
+	}
+
+	transaction.GatewayTxnID = result.GatewayTxnID
+	if err := s.db.Model(&transaction).Update("gateway_txn_id", result.GatewayTxnID).Error; err != nil {
+		log.Printf("Failed to store gateway transaction ID for transaction %d: %v", transaction.ID, err)
+	}
+	s.applyStatus(&transaction, result.Status, result.FailureReason)
+
+	return &transaction, nil
+}
+
+// HandleWebhook verifies a gateway webhook and applies the status transition
+// to the matching transaction
+func (s *PaymentService) HandleWebhook(gatewayName string, payload []byte, signature string) error {
+	gateway, err := s.getGateway(gatewayName)
+	if err != nil {
+		return err
+	}
+
+	event, err := gateway.ParseWebhook(payload, signature)
+	if err != nil {
+		return fmt.Errorf("invalid webhook: %w", err)
+	}
+	if event.Status == "" || event.GatewayTxnID == "" {
+		return nil
+	}
+
+	var transaction models.Transaction
+	if err := s.db.Where("payment_gateway = ? AND gateway_txn_id = ?", gateway.Name(), event.GatewayTxnID).
+		First(&transaction).Error; err != nil {
+		// Payments not created by this platform are ignored
+		log.Printf("No transaction for %s webhook %s (%s)", gateway.Name(), event.Type, event.GatewayTxnID)
+		return nil
+	}
+
+	if event.Status == "REFUNDED" {
+		return s.recordRefund(&transaction, event.RefundedAmount)
+	}
+
+	if !isValidPaymentTransition(transaction.Status, event.Status) {
+		log.Printf("Ignoring %s transition %s -> %s for transaction %d", event.Type, transaction.Status, event.Status, transaction.ID)
+		return nil
+	}
+
+	s.applyStatus(&transaction, event.Status, event.FailureReason)
+	return nil
+}
+
+// RefundLoadPayment refunds the completed payment of a load. An amount of 0
+// refunds the remaining balance.
+func (s *PaymentService) RefundLoadPayment(loadID uint, amount float64) (*models.Transaction, error) {
+	var transaction models.Transaction
+	if err := s.db.Where("load_id = ? AND status = ?", loadID, "COMPLETED").
+		Order("created_at DESC").
+		First(&transaction).Error; err != nil {
+		return nil, errors.New("no completed payment found for load")
+	}
+
+	remaining := transaction.Amount - transaction.RefundedAmount
+	if amount <= 0 {
+		amount = remaining
+	}
+	if amount > remaining+0.005 {
+		return nil, fmt.Errorf("refund amount exceeds refundable balance of %.2f", remaining)
+	}
+
+	gateway, err := s.getGateway(transaction.PaymentGateway)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := gateway.Refund(transaction.GatewayTxnID, amount); err != nil {
+		return nil, fmt.Errorf("refund failed: %w", err)
+	}
+
+	if err := s.recordRefund(&transaction, transaction.RefundedAmount+amount); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// recordRefund stores the total refunded amount, marking the transaction
+// REFUNDED once it is fully refunded
+func (s *PaymentService) recordRefund(transaction *models.Transaction, totalRefunded float64) error {
+	if totalRefunded <= transaction.RefundedAmount {
+		return nil
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"refunded_amount": totalRefunded,
+		"refunded_at":     now,
+	}
+	if totalRefunded >= transaction.Amount-0.005 {
+		updates["status"] = "REFUNDED"
+	}
+
+	if err := s.db.Model(transaction).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to record refund: %w", err)
+	}
+
+	transaction.RefundedAmount = totalRefunded
+	transaction.RefundedAt = &now
+	if status, ok := updates["status"].(string); ok {
+		transaction.Status = status
+	}
+	return nil
+}
+
+// applyStatus updates the status of a transaction
+func (s *PaymentService) applyStatus(transaction *models.Transaction, status, failureReason string) {
+	updates := map[string]interface{}{"status": status}
+	if status == "COMPLETED" || status == "FAILED" {
+		now := time.Now()
+		updates["processed_at"] = now
+		transaction.ProcessedAt = &now
+	}
+	if status == "FAILED" {
+		updates["failure_reason"] = failureReason
+		transaction.FailureReason = failureReason
+	}
+
+	if err := s.db.Model(transaction).Updates(updates).Error; err != nil {
+		log.Printf("Failed to update transaction %d status to %s: %v", transaction.ID, status, err)
+		return
+	}
+	transaction.Status = status
+
+	if status == "COMPLETED" {
+		if err := ReconcileInvoicePayment(s.db, transaction); err != nil {
+			log.Printf("Failed to reconcile transaction %d with its invoice: %v", transaction.ID, err)
+		}
+	}
+}
+
+// isValidPaymentTransition checks if a transaction status transition is valid
+func isValidPaymentTransition(from, to string) bool {
+	validTransitions := map[string][]string{
+		"PENDING":   {"COMPLETED", "FAILED"},
+		"FAILED":    {"COMPLETED"}, // payment retried at the gateway
+		"COMPLETED": {"REFUNDED"},
+		"REFUNDED":  {},
+	}
+
+	allowed, exists := validTransitions[from]
+	if !exists {
+		return false
+	}
+
+	for _, status := range allowed {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size in PDF points
+const (
+	pdfPageWidth  = 595.28
+	pdfPageHeight = 841.89
+)
+
+// PDFWriter builds simple text and line PDF documents using the standard
+// Helvetica fonts, so no font files need to be embedded
+type PDFWriter struct {
+	pages   []*bytes.Buffer
+	current int
+}
+
+// NewPDFWriter creates an empty PDF document
+func NewPDFWriter() *PDFWriter {
+	return &PDFWriter{}
+}
+
+// AddPage starts a new page. Subsequent drawing goes to this page.
+func (w *PDFWriter) AddPage() {
+	w.pages = append(w.pages, &bytes.Buffer{})
+	w.current = len(w.pages) - 1
+}
+
+// SetPage makes an existing page (zero based) the page drawn on
+func (w *PDFWriter) SetPage(index int) {
+	if index >= 0 && index < len(w.pages) {
+		w.current = index
+	}
+}
+
+// PageCount returns the number of pages
+func (w *PDFWriter) PageCount() int {
+	return len(w.pages)
+}
+
+// Text draws text with its baseline at x, y (from the bottom left of the page)
+func (w *PDFWriter) Text(x, y, size float64, bold bool, text string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(w.currentPage(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfEscape(text))
+}
+
+// Line draws a line between two points
+func (w *PDFWriter) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(w.currentPage(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+// Bytes returns the encoded PDF document
+func (w *PDFWriter) Bytes() []byte {
+	if len(w.pages) == 0 {
+		w.AddPage()
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+
+	// Objects: 1 catalog, 2 page tree, 3-4 fonts, then a page and content stream per page
+	writeObject := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	kids := make([]string, len(w.pages))
+	for i := range w.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+i*2)
+	}
+
+	writeObject("<< /Type /Catalog /Pages 2 0 R >>")
+	writeObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(w.pages)))
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range w.pages {
+		writeObject(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+i*2))
+		writeObject(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xrefOffset := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xrefOffset)
+
+	return out.Bytes()
+}
+
+func (w *PDFWriter) currentPage() *bytes.Buffer {
+	if len(w.pages) == 0 {
+		w.AddPage()
+	}
+	return w.pages[w.current]
+}
+
+// pdfEscape escapes a string for a PDF literal string. Characters outside
+// Latin-1 are replaced since the standard fonts can't render them.
+func pdfEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r < 32 || r > 255:
+			b.WriteByte('?')
+		case r > 126:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// pdfTruncate shortens text to fit roughly within width points at the given font size
+func pdfTruncate(text string, width, size float64) string {
+	// Helvetica averages about half the font size per character
+	maxChars := int(width / (size * 0.5))
+	runes := []rune(text)
+	if len(runes) <= maxChars {
+		return text
+	}
+	if maxChars <= 3 {
+		return string(runes[:maxChars])
+	}
+	return string(runes[:maxChars-3]) + "..."
+}
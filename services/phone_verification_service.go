@@ -0,0 +1,164 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Phone verification errors
+var (
+	ErrPhoneVerificationUnavailable = errors.New("SMS delivery is not configured")
+	ErrInvalidPhoneNumber           = errors.New("phone number must be in E.164 format, e.g. +14155550123")
+	ErrPhoneAlreadyVerified         = errors.New("phone number is already verified")
+	ErrVerificationCodeRecentlySent = errors.New("a verification code was sent recently, try again shortly")
+	ErrInvalidVerificationCode      = errors.New("invalid or expired verification code")
+	ErrTooManyVerificationAttempts  = errors.New("too many attempts, request a new verification code")
+)
+
+// e164Pattern matches phone numbers in E.164 format
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// PhoneVerificationService confirms that users own their phone number by
+// texting them a one-time code
+type PhoneVerificationService struct {
+	db     *gorm.DB
+	cfg    *config.SMSConfig
+	sender SMSSender
+}
+
+// NewPhoneVerificationService creates a new PhoneVerificationService. Codes
+// are sent through Twilio when SMS delivery is enabled.
+func NewPhoneVerificationService(db *gorm.DB, cfg *config.SMSConfig) *PhoneVerificationService {
+	s := &PhoneVerificationService{db: db, cfg: cfg}
+	if cfg.Enabled {
+		s.sender = NewTwilioSMSSender(cfg)
+	}
+	return s
+}
+
+// SetSMSSender replaces the sender used to text verification codes
+func (s *PhoneVerificationService) SetSMSSender(sender SMSSender) {
+	s.sender = sender
+}
+
+// StartVerification texts a new verification code to the user's phone
+// number. Earlier codes stop working.
+func (s *PhoneVerificationService) StartVerification(userID uint) (*models.PhoneVerification, error) {
+	if s.sender == nil {
+		return nil, ErrPhoneVerificationUnavailable
+	}
+
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if !e164Pattern.MatchString(user.Phone) {
+		return nil, ErrInvalidPhoneNumber
+	}
+	if user.PhoneVerifiedAt != nil {
+		return nil, ErrPhoneAlreadyVerified
+	}
+
+	var last models.PhoneVerification
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC").First(&last).Error
+	if err == nil && time.Since(last.CreatedAt) < s.cfg.VerificationResendAfter {
+		return nil, ErrVerificationCodeRecentlySent
+	}
+
+	code, err := generateVerificationCode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate verification code: %w", err)
+	}
+
+	verification := models.PhoneVerification{
+		UserID:    userID,
+		Phone:     user.Phone,
+		CodeHash:  hashVerificationCode(userID, code),
+		ExpiresAt: time.Now().Add(s.cfg.VerificationCodeTTL),
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND verified_at IS NULL", userID).Delete(&models.PhoneVerification{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&verification).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create phone verification: %w", err)
+	}
+
+	message := fmt.Sprintf("Your TripLink verification code is %s. It expires in %d minutes.", code, int(s.cfg.VerificationCodeTTL.Minutes()))
+	if err := s.sender.Send(user.Phone, message); err != nil {
+		return nil, fmt.Errorf("failed to send verification code: %w", err)
+	}
+
+	return &verification, nil
+}
+
+// ConfirmVerification checks a code sent to the user and marks their phone
+// number verified. A code only verifies the number it was sent to.
+func (s *PhoneVerificationService) ConfirmVerification(userID uint, code string) (*models.User, error) {
+	var verification models.PhoneVerification
+	if err := s.db.Where("user_id = ? AND verified_at IS NULL", userID).
+		Order("created_at DESC").First(&verification).Error; err != nil {
+		return nil, ErrInvalidVerificationCode
+	}
+
+	if verification.Attempts >= s.cfg.VerificationMaxAttempts {
+		return nil, ErrTooManyVerificationAttempts
+	}
+	if time.Now().After(verification.ExpiresAt) {
+		return nil, ErrInvalidVerificationCode
+	}
+
+	if subtle.ConstantTimeCompare([]byte(verification.CodeHash), []byte(hashVerificationCode(userID, code))) != 1 {
+		s.db.Model(&verification).Update("attempts", gorm.Expr("attempts + 1"))
+		return nil, ErrInvalidVerificationCode
+	}
+
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if user.Phone != verification.Phone {
+		return nil, ErrInvalidVerificationCode
+	}
+
+	now := time.Now()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&verification).Update("verified_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Update("phone_verified_at", now).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify phone number: %w", err)
+	}
+
+	return &user, nil
+}
+
+// generateVerificationCode returns a random six digit code
+func generateVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashVerificationCode hashes a code for storage, salted with the user ID
+func hashVerificationCode(userID uint, code string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", userID, code)))
+	return hex.EncodeToString(sum[:])
+}
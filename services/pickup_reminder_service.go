@@ -0,0 +1,91 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+	"triplink/backend/internal/timezone"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// PickupReminderService reminds carriers of the loads they are due to pick up
+type PickupReminderService struct {
+	db                  *gorm.DB
+	notificationService *NotificationService
+	leadTime            time.Duration
+}
+
+// NewPickupReminderService creates a service sending reminders leadTime
+// before each pickup
+func NewPickupReminderService(db *gorm.DB, notificationService *NotificationService, leadTime time.Duration) *PickupReminderService {
+	return &PickupReminderService{
+		db:                  db,
+		notificationService: notificationService,
+		leadTime:            leadTime,
+	}
+}
+
+// SendPickupReminders notifies the carrier of each booked load whose
+// requested pickup is within the lead time. Each load is reminded once.
+func (s *PickupReminderService) SendPickupReminders() error {
+	now := time.Now()
+
+	var loads []models.Load
+	if err := s.db.Where("status = ? AND trip_id <> 0 AND pickup_reminder_sent_at IS NULL", "BOOKED").
+		Where("requested_pickup_date BETWEEN ? AND ?", now, now.Add(s.leadTime)).
+		Find(&loads).Error; err != nil {
+		return fmt.Errorf("failed to get loads due for pickup: %w", err)
+	}
+
+	sent := 0
+	for i := range loads {
+		load := &loads[i]
+
+		var trip models.Trip
+		if err := s.db.Select("id, user_id").First(&trip, load.TripID).Error; err != nil {
+			log.Printf("Failed to get trip %d of load %d for pickup reminder: %v", load.TripID, load.ID, err)
+			continue
+		}
+
+		notification := models.Notification{
+			UserID:    trip.UserID,
+			Title:     "Pickup Reminder",
+			Message:   pickupReminderMessage(load),
+			Type:      "PICKUP_REMINDER",
+			RelatedID: load.ID,
+		}
+		if created, _, err := s.notificationService.CreateNotificationWithDelivery(&notification); created == nil {
+			log.Printf("Failed to send pickup reminder for load %d: %v", load.ID, err)
+			continue
+		}
+
+		if err := s.db.Model(load).Update("pickup_reminder_sent_at", now).Error; err != nil {
+			log.Printf("Failed to record pickup reminder for load %d: %v", load.ID, err)
+		}
+		sent++
+	}
+
+	if sent > 0 {
+		log.Printf("Sent %d pickup reminders", sent)
+	}
+	return nil
+}
+
+// pickupReminderMessage describes where and when a load is to be picked up
+func pickupReminderMessage(load *models.Load) string {
+	location := load.PickupAddress
+	if location == "" {
+		location = load.PickupCity
+	}
+
+	// At the local time of the pickup, UTC when its place isn't known
+	pickupTimezone := timezone.Lookup(load.PickupLat, load.PickupLng)
+	message := fmt.Sprintf("Load %s is due for pickup at %s", load.BookingReference,
+		timezone.Format(load.RequestedPickupDate, pickupTimezone, "Jan 2 15:04 MST"))
+	if location != "" {
+		message += " from " + location
+	}
+	return message
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Proof stages and kinds
+const (
+	ProofStagePickup   = "PICKUP"
+	ProofStageDelivery = "DELIVERY"
+	ProofKindPhoto     = "PHOTO"
+	ProofKindSignature = "SIGNATURE"
+)
+
+// proofContentTypes maps allowed proof content types to file extensions
+var proofContentTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// ProofUpload is a proof-of-pickup or proof-of-delivery file with its capture details
+type ProofUpload struct {
+	Stage      string
+	Kind       string
+	Data       []byte
+	SignedBy   string
+	UploadedBy uint
+	Latitude   *float64
+	Longitude  *float64
+	CapturedAt time.Time
+}
+
+// ProofUploadResult is the stored proof and the load status change it caused, if any
+type ProofUploadResult struct {
+	Proof          models.LoadProof `json:"proof"`
+	LoadStatus     string           `json:"load_status"`
+	PreviousStatus string           `json:"previous_status"`
+	Delivered      bool             `json:"delivered"`
+}
+
+// ProofOfDeliveryService stores pickup/delivery photos and e-signatures for loads
+type ProofOfDeliveryService struct {
+	db            *gorm.DB
+	storage       FileStorage
+	maxUploadSize int64
+}
+
+// NewProofOfDeliveryService creates a new proof-of-delivery service
+func NewProofOfDeliveryService(db *gorm.DB, storage FileStorage, maxUploadSize int64) *ProofOfDeliveryService {
+	return &ProofOfDeliveryService{
+		db:            db,
+		storage:       storage,
+		maxUploadSize: maxUploadSize,
+	}
+}
+
+// UploadProof stores a proof file and attaches it to the load. The first delivery
+// proof marks the load DELIVERED and creates a LOAD_DELIVERED tracking event.
+func (ps *ProofOfDeliveryService) UploadProof(loadID uint, upload ProofUpload) (*ProofUploadResult, error) {
+	if upload.Stage != ProofStagePickup && upload.Stage != ProofStageDelivery {
+		return nil, errors.New("stage must be PICKUP or DELIVERY")
+	}
+	if upload.Kind != ProofKindPhoto && upload.Kind != ProofKindSignature {
+		return nil, errors.New("kind must be PHOTO or SIGNATURE")
+	}
+	if upload.Kind == ProofKindSignature && upload.SignedBy == "" {
+		return nil, errors.New("signed_by is required for signatures")
+	}
+	if len(upload.Data) == 0 {
+		return nil, errors.New("file is empty")
+	}
+	if ps.maxUploadSize > 0 && int64(len(upload.Data)) > ps.maxUploadSize {
+		return nil, fmt.Errorf("file exceeds maximum size of %d bytes", ps.maxUploadSize)
+	}
+
+	// Content type is detected from the file rather than trusted from the client
+	contentType := http.DetectContentType(upload.Data)
+	extension, allowed := proofContentTypes[contentType]
+	if !allowed {
+		return nil, fmt.Errorf("unsupported file type %s", contentType)
+	}
+
+	var load models.Load
+	if err := ps.db.First(&load, loadID).Error; err != nil {
+		return nil, errors.New("load not found")
+	}
+	if load.TripID == 0 {
+		return nil, errors.New("load is not booked on a trip")
+	}
+	if load.Status == "CANCELLED" {
+		return nil, errors.New("load is cancelled")
+	}
+
+	if upload.CapturedAt.IsZero() {
+		upload.CapturedAt = time.Now()
+	}
+
+	key := fmt.Sprintf("loads/%d/%s/%s-%d%s", load.ID, upload.Stage, upload.Kind, upload.CapturedAt.UnixNano(), extension)
+	fileURL, err := ps.storage.Put(key, contentType, upload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
+
+	result := &ProofUploadResult{
+		Proof: models.LoadProof{
+			LoadID:      load.ID,
+			Stage:       upload.Stage,
+			Kind:        upload.Kind,
+			URL:         fileURL,
+			StorageKey:  key,
+			ContentType: contentType,
+			Size:        int64(len(upload.Data)),
+			SignedBy:    upload.SignedBy,
+			UploadedBy:  upload.UploadedBy,
+			Latitude:    upload.Latitude,
+			Longitude:   upload.Longitude,
+			CapturedAt:  upload.CapturedAt,
+		},
+		LoadStatus:     load.Status,
+		PreviousStatus: load.Status,
+	}
+
+	err = ps.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&result.Proof).Error; err != nil {
+			return fmt.Errorf("failed to save proof: %w", err)
+		}
+
+		updates := map[string]interface{}{}
+		if upload.Stage == ProofStagePickup {
+			updates["pickup_proof"] = fileURL
+			if load.ActualPickupDate == nil {
+				updates["actual_pickup_date"] = upload.CapturedAt
+			}
+		} else {
+			updates["delivery_proof"] = fileURL
+			if load.Status != "DELIVERED" {
+				updates["status"] = "DELIVERED"
+				updates["actual_delivery_date"] = upload.CapturedAt
+				result.LoadStatus = "DELIVERED"
+				result.Delivered = true
+			}
+		}
+
+		if err := tx.Model(&load).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update load: %w", err)
+		}
+
+		if !result.Delivered {
+			return nil
+		}
+
+		event := models.TrackingEvent{
+			TripID:      load.TripID,
+			LoadID:      &load.ID,
+			EventType:   "LOAD_DELIVERED",
+			EventData:   fmt.Sprintf(`{"proof_id":%d,"kind":"%s","from":"%s"}`, result.Proof.ID, upload.Kind, result.PreviousStatus),
+			Latitude:    upload.Latitude,
+			Longitude:   upload.Longitude,
+			Timestamp:   upload.CapturedAt,
+			Description: "Load delivered with proof of delivery",
+		}
+		if err := tx.Create(&event).Error; err != nil {
+			return fmt.Errorf("failed to create tracking event: %w", err)
+		}
+
+		return ps.updateLoadTrackingStatus(tx, &load, result.PreviousStatus)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Stored %s %s proof for load %d in %s storage", upload.Stage, upload.Kind, load.ID, ps.storage.Name())
+	return result, nil
+}
+
+// GetLoadProofs returns the proofs of a load, oldest first
+func (ps *ProofOfDeliveryService) GetLoadProofs(loadID uint) ([]models.LoadProof, error) {
+	var proofs []models.LoadProof
+	if err := ps.db.Where("load_id = ?", loadID).Order("captured_at ASC").Find(&proofs).Error; err != nil {
+		return nil, err
+	}
+	return proofs, nil
+}
+
+// updateLoadTrackingStatus records the DELIVERED status on the load tracking status
+func (ps *ProofOfDeliveryService) updateLoadTrackingStatus(tx *gorm.DB, load *models.Load, previousStatus string) error {
+	var status models.TrackingStatus
+	if err := tx.Where("load_id = ?", load.ID).First(&status).Error; err != nil {
+		status = models.TrackingStatus{
+			TripID:         load.TripID,
+			LoadID:         &load.ID,
+			PreviousStatus: previousStatus,
+		}
+	} else {
+		status.PreviousStatus = status.CurrentStatus
+	}
+
+	status.CurrentStatus = "DELIVERED"
+	status.StatusChangedAt = time.Now()
+	status.CompletionPercent = 100
+	status.NextMilestone = ""
+
+	if err := tx.Save(&status).Error; err != nil {
+		return fmt.Errorf("failed to update tracking status: %w", err)
+	}
+	return nil
+}
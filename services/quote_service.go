@@ -0,0 +1,313 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Quote statuses
+const (
+	QuoteStatusPending   = "PENDING"
+	QuoteStatusAccepted  = "ACCEPTED"
+	QuoteStatusRejected  = "REJECTED"
+	QuoteStatusExpired   = "EXPIRED"
+	QuoteStatusCountered = "COUNTERED"
+)
+
+// defaultQuoteValidity is used when a quote is created without a ValidUntil date
+const defaultQuoteValidity = 72 * time.Hour
+
+// QuoteService implements the quote lifecycle: creation, counter-offers,
+// acceptance with load booking, rejection and expiry
+type QuoteService struct {
+	db       *gorm.DB
+	capacity *TripCapacityService
+}
+
+// NewQuoteService creates a new quote service instance
+func NewQuoteService(db *gorm.DB) *QuoteService {
+	return &QuoteService{
+		db:       db,
+		capacity: NewTripCapacityService(db),
+	}
+}
+
+// CreateQuote validates and stores a new pending quote from a carrier
+func (qs *QuoteService) CreateQuote(quote *models.Quote) error {
+	if quote.QuoteAmount <= 0 {
+		return errors.New("quote amount must be positive")
+	}
+
+	var load models.Load
+	if err := qs.db.First(&load, quote.LoadID).Error; err != nil {
+		return errors.New("load not found")
+	}
+	if load.Status == "DELIVERED" || load.Status == "CANCELLED" {
+		return fmt.Errorf("cannot quote a load with status %s", load.Status)
+	}
+
+	if quote.TripID != 0 {
+		var trip models.Trip
+		if err := qs.db.First(&trip, quote.TripID).Error; err != nil {
+			return errors.New("trip not found")
+		}
+		if !hasCapacityFor(&trip, &load) {
+			return errors.New("trip does not have enough remaining capacity for this load")
+		}
+	}
+
+	// Quotes are in the load's currency unless the carrier names another
+	if quote.Currency == "" {
+		quote.Currency = load.Currency
+	}
+	if err := validateCurrencyCode(&quote.Currency); err != nil {
+		return err
+	}
+	NormalizeQuoteAmount(quote)
+
+	if quote.ValidUntil.IsZero() {
+		quote.ValidUntil = time.Now().Add(defaultQuoteValidity)
+	} else if quote.ValidUntil.Before(time.Now()) {
+		return errors.New("valid until date must be in the future")
+	}
+
+	quote.Status = QuoteStatusPending
+	quote.AcceptedAt = nil
+	if quote.ProposedBy == "" {
+		quote.ProposedBy = "CARRIER"
+	}
+
+	return qs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(quote).Error; err != nil {
+			return fmt.Errorf("failed to create quote: %w", err)
+		}
+
+		// First quote moves the load from QUOTE_REQUESTED to QUOTED
+		if load.Status == "" || load.Status == "QUOTE_REQUESTED" {
+			if err := tx.Model(&load).Update("status", "QUOTED").Error; err != nil {
+				return fmt.Errorf("failed to update load status: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// CounterQuote replaces a pending quote with a counter-offer from the other party.
+// The original quote is marked COUNTERED and the counter-offer becomes the pending quote.
+func (qs *QuoteService) CounterQuote(quoteID uint, amount float64, notes string, validUntil *time.Time) (*models.Quote, error) {
+	if amount <= 0 {
+		return nil, errors.New("counter amount must be positive")
+	}
+
+	if err := qs.checkQuoteAvailable(quoteID); err != nil {
+		return nil, err
+	}
+
+	var counter models.Quote
+	err := qs.db.Transaction(func(tx *gorm.DB) error {
+		var original models.Quote
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&original, quoteID).Error; err != nil {
+			return errors.New("quote not found")
+		}
+		if original.Status != QuoteStatusPending {
+			return errors.New("quote is no longer available")
+		}
+
+		if err := tx.Model(&original).Update("status", QuoteStatusCountered).Error; err != nil {
+			return fmt.Errorf("failed to update quote: %w", err)
+		}
+
+		proposedBy := "SHIPPER"
+		if original.ProposedBy == "SHIPPER" {
+			proposedBy = "CARRIER"
+		}
+
+		counter = models.Quote{
+			LoadID:        original.LoadID,
+			CarrierID:     original.CarrierID,
+			TripID:        original.TripID,
+			QuoteAmount:   amount,
+			Currency:      original.Currency,
+			ValidUntil:    time.Now().Add(defaultQuoteValidity),
+			PickupDate:    original.PickupDate,
+			DeliveryDate:  original.DeliveryDate,
+			Notes:         notes,
+			Status:        QuoteStatusPending,
+			ParentQuoteID: &original.ID,
+			ProposedBy:    proposedBy,
+		}
+		if validUntil != nil {
+			if validUntil.Before(time.Now()) {
+				return errors.New("valid until date must be in the future")
+			}
+			counter.ValidUntil = *validUntil
+		}
+
+		NormalizeQuoteAmount(&counter)
+		if err := tx.Create(&counter).Error; err != nil {
+			return fmt.Errorf("failed to create counter-offer: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &counter, nil
+}
+
+// AcceptQuote accepts a pending quote, books the load onto the quoted trip,
+// reserves the trip capacity and rejects the other pending quotes for the load
+func (qs *QuoteService) AcceptQuote(quoteID uint) (*models.Quote, error) {
+	if err := qs.checkQuoteAvailable(quoteID); err != nil {
+		return nil, err
+	}
+
+	var quote models.Quote
+	err := qs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&quote, quoteID).Error; err != nil {
+			return errors.New("quote not found")
+		}
+		if quote.Status != QuoteStatusPending {
+			return errors.New("quote is no longer available")
+		}
+
+		var load models.Load
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&load, quote.LoadID).Error; err != nil {
+			return errors.New("load not found")
+		}
+
+		var acceptedCount int64
+		tx.Model(&models.Quote{}).
+			Where("load_id = ? AND status = ?", load.ID, QuoteStatusAccepted).
+			Count(&acceptedCount)
+		if acceptedCount > 0 {
+			return errors.New("load already has an accepted quote")
+		}
+
+		// Quotes without a trip book the load onto the trip it was requested for
+		tripID := quote.TripID
+		if tripID == 0 {
+			tripID = load.TripID
+		}
+		if tripID == 0 {
+			return errors.New("quote does not specify a trip")
+		}
+
+		if err := qs.capacity.ReserveCapacity(tx, tripID, load.Weight, load.Volume); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		quote.Status = QuoteStatusAccepted
+		quote.AcceptedAt = &now
+		quote.TripID = tripID
+		if err := tx.Save(&quote).Error; err != nil {
+			return fmt.Errorf("failed to accept quote: %w", err)
+		}
+
+		if err := tx.Model(&load).Updates(map[string]interface{}{
+			"status":       "BOOKED",
+			"agreed_price": quote.QuoteAmount,
+			"currency":     quote.Currency,
+			"trip_id":      tripID,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to book load: %w", err)
+		}
+
+		if err := tx.Model(&models.Quote{}).
+			Where("load_id = ? AND id != ? AND status = ?", quote.LoadID, quote.ID, QuoteStatusPending).
+			Update("status", QuoteStatusRejected).Error; err != nil {
+			return fmt.Errorf("failed to reject other quotes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &quote, nil
+}
+
+// RejectQuote rejects a pending quote
+func (qs *QuoteService) RejectQuote(quoteID uint) (*models.Quote, error) {
+	var quote models.Quote
+	if err := qs.db.First(&quote, quoteID).Error; err != nil {
+		return nil, errors.New("quote not found")
+	}
+	if quote.Status != QuoteStatusPending {
+		return nil, errors.New("quote cannot be rejected")
+	}
+
+	quote.Status = QuoteStatusRejected
+	if err := qs.db.Save(&quote).Error; err != nil {
+		return nil, fmt.Errorf("failed to reject quote: %w", err)
+	}
+	return &quote, nil
+}
+
+// ExpireQuotes marks pending quotes past their valid until date as EXPIRED
+func (qs *QuoteService) ExpireQuotes() error {
+	result := qs.db.Model(&models.Quote{}).
+		Where("status = ? AND valid_until < ?", QuoteStatusPending, time.Now()).
+		Update("status", QuoteStatusExpired)
+	if result.Error != nil {
+		return fmt.Errorf("failed to expire quotes: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Expired %d quotes", result.RowsAffected)
+	}
+	return nil
+}
+
+// checkQuoteAvailable checks that a quote can still be acted on, expiring it
+// if its validity has passed
+func (qs *QuoteService) checkQuoteAvailable(quoteID uint) error {
+	var quote models.Quote
+	if err := qs.db.First(&quote, quoteID).Error; err != nil {
+		return errors.New("quote not found")
+	}
+	if quote.Status != QuoteStatusPending {
+		return errors.New("quote is no longer available")
+	}
+	if time.Now().After(quote.ValidUntil) {
+		if err := qs.db.Model(&quote).Update("status", QuoteStatusExpired).Error; err != nil {
+			log.Printf("Failed to expire quote %d: %v", quote.ID, err)
+		}
+		return errors.New("quote has expired")
+	}
+	return nil
+}
+
+// hasCapacityFor checks if a trip has enough remaining weight and volume for a load
+func hasCapacityFor(trip *models.Trip, load *models.Load) bool {
+	return trip.TotalCapacityWeight-trip.UsedWeight >= load.Weight &&
+		trip.TotalCapacityVolume-trip.UsedVolume >= load.Volume
+}
+
+// NormalizeQuoteAmount stores a quote's amount in the base currency at the
+// current exchange rate
+func NormalizeQuoteAmount(quote *models.Quote) {
+	quote.BaseAmount, quote.BaseCurrency, quote.ExchangeRate = GetCurrencyService().Normalize(quote.QuoteAmount, quote.Currency)
+}
+
+// validateCurrencyCode upper-cases a currency code, defaulting to USD, and
+// checks it is an ISO 4217 code
+func validateCurrencyCode(currency *string) error {
+	code := strings.ToUpper(strings.TrimSpace(*currency))
+	if code == "" {
+		code = "USD"
+	}
+	if len(code) != 3 || strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return errors.New("currency must be a 3 letter ISO 4217 code")
+	}
+	*currency = code
+	return nil
+}
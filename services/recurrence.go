@@ -0,0 +1,194 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies
+const (
+	RecurrenceDaily   = "DAILY"
+	RecurrenceWeekly  = "WEEKLY"
+	RecurrenceMonthly = "MONTHLY"
+)
+
+// maxRecurrenceDays bounds how far recurrence dates are searched
+const maxRecurrenceDays = 5 * 366
+
+var recurrenceWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// RecurrenceRule is the subset of the iCalendar RRULE used for recurring
+// trips: FREQ (DAILY, WEEKLY or MONTHLY), INTERVAL, BYDAY for weekly rules,
+// and an end by COUNT or UNTIL. For example FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH
+// repeats on Mondays and Thursdays every other week.
+type RecurrenceRule struct {
+	Frequency string
+	Interval  int
+	Weekdays  []time.Weekday
+	Count     int
+	Until     *time.Time // last date, inclusive
+}
+
+// ParseRecurrenceRule parses a rule such as FREQ=WEEKLY;BYDAY=MO,WE. An
+// RRULE: prefix is allowed.
+func ParseRecurrenceRule(value string) (*RecurrenceRule, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	if value == "" {
+		return nil, errors.New("recurrence rule is required")
+	}
+
+	rule := &RecurrenceRule{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+		key = strings.ToUpper(key)
+		val = strings.ToUpper(strings.TrimSpace(val))
+
+		switch key {
+		case "FREQ":
+			switch val {
+			case RecurrenceDaily, RecurrenceWeekly, RecurrenceMonthly:
+				rule.Frequency = val
+			default:
+				return nil, fmt.Errorf("unsupported frequency %q, use DAILY, WEEKLY or MONTHLY", val)
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(val)
+			if err != nil || interval < 1 {
+				return nil, errors.New("INTERVAL must be a positive number")
+			}
+			rule.Interval = interval
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				weekday, ok := recurrenceWeekdays[strings.TrimSpace(day)]
+				if !ok {
+					return nil, fmt.Errorf("invalid weekday %q in BYDAY", day)
+				}
+				rule.Weekdays = append(rule.Weekdays, weekday)
+			}
+		case "COUNT":
+			count, err := strconv.Atoi(val)
+			if err != nil || count < 1 {
+				return nil, errors.New("COUNT must be a positive number")
+			}
+			rule.Count = count
+		case "UNTIL":
+			until, err := parseRecurrenceUntil(val)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = &until
+		default:
+			return nil, fmt.Errorf("unsupported recurrence rule part %s", key)
+		}
+	}
+
+	if rule.Frequency == "" {
+		return nil, errors.New("recurrence rule needs a FREQ")
+	}
+	if len(rule.Weekdays) > 0 && rule.Frequency != RecurrenceWeekly {
+		return nil, errors.New("BYDAY is only supported for weekly rules")
+	}
+	if rule.Count > 0 && rule.Until != nil {
+		return nil, errors.New("use either COUNT or UNTIL, not both")
+	}
+	return rule, nil
+}
+
+// parseRecurrenceUntil parses the UNTIL date of a rule
+func parseRecurrenceUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102", "2006-01-02"} {
+		if until, err := time.Parse(layout, value); err == nil {
+			return until, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL date %q, use YYYYMMDD", value)
+}
+
+// Occurrences returns the occurrences of the rule from start up to and
+// including end, at start's time of day and location. Occurrences before
+// from are left out but still count towards COUNT.
+func (r *RecurrenceRule) Occurrences(start, from, end time.Time) []time.Time {
+	loc := start.Location()
+	first := civilDate(start)
+	weekdays := r.Weekdays
+	if r.Frequency == RecurrenceWeekly && len(weekdays) == 0 {
+		weekdays = []time.Weekday{start.Weekday()}
+	}
+
+	var occurrences []time.Time
+	count := 0
+	for offset := 0; offset < maxRecurrenceDays; offset++ {
+		day := first.AddDate(0, 0, offset)
+		if r.Until != nil && day.After(civilDate(*r.Until)) {
+			break
+		}
+		occurrence := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+		if occurrence.After(end) {
+			break
+		}
+		if !r.matches(first, day, weekdays) {
+			continue
+		}
+
+		count++
+		if !occurrence.Before(from) {
+			occurrences = append(occurrences, occurrence)
+		}
+		if r.Count > 0 && count >= r.Count {
+			break
+		}
+	}
+	return occurrences
+}
+
+// matches reports whether the rule repeats on day, both civil dates
+func (r *RecurrenceRule) matches(first, day time.Time, weekdays []time.Weekday) bool {
+	switch r.Frequency {
+	case RecurrenceDaily:
+		return daysBetween(first, day)%r.Interval == 0
+	case RecurrenceWeekly:
+		onWeekday := false
+		for _, weekday := range weekdays {
+			if day.Weekday() == weekday {
+				onWeekday = true
+			}
+		}
+		// Weeks start on Monday, as in RRULE's default WKST
+		weeks := daysBetween(startOfWeek(first), startOfWeek(day)) / 7
+		return onWeekday && weeks%r.Interval == 0
+	case RecurrenceMonthly:
+		// Months without the start's day are skipped
+		months := (day.Year()-first.Year())*12 + int(day.Month()-first.Month())
+		return day.Day() == first.Day() && months%r.Interval == 0
+	default:
+		return false
+	}
+}
+
+// civilDate returns the date of t as midnight UTC, so that date arithmetic
+// isn't affected by daylight saving changes
+func civilDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// daysBetween returns the days from one civil date to another
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// startOfWeek returns the Monday of a civil date's week
+func startOfWeek(day time.Time) time.Time {
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
@@ -4,9 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
-	"strconv"
 	"time"
+	"triplink/backend/config"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -64,34 +63,14 @@ func (ck CacheKey) String() string {
 
 // NewRedisService creates a new Redis service instance
 func NewRedisService() *RedisService {
-	// Redis configuration from environment variables
-	redisHost := os.Getenv("REDIS_HOST")
-	if redisHost == "" {
-		redisHost = "localhost"
-	}
-	
-	redisPort := os.Getenv("REDIS_PORT")
-	if redisPort == "" {
-		redisPort = "6379"
-	}
-	
-	redisPassword := os.Getenv("REDIS_PASSWORD")
-	redisDB := os.Getenv("REDIS_DB")
-	
-	db := 0
-	if redisDB != "" {
-		if dbNum, err := strconv.Atoi(redisDB); err == nil {
-			db = dbNum
-		}
-	}
-
+	cfg := config.GetRedisConfig()
 	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", redisHost, redisPort),
-		Password: redisPassword,
-		DB:       db,
-		PoolSize: 20,
-		ConnMaxIdleTime: 30 * time.Second,
-		ConnMaxLifetime: 5 * time.Minute,
+		Addr:            fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
+		Password:        cfg.Password,
+		DB:              cfg.DB,
+		PoolSize:        cfg.PoolSize,
+		ConnMaxIdleTime: cfg.ConnMaxIdleTime,
+		ConnMaxLifetime: cfg.ConnMaxLifetime,
 	})
 
 	return &RedisService{
@@ -275,35 +254,56 @@ func (r *RedisService) GetCachedFuelPrices(locationHash string, dest interface{}
 
 // Rate Limiting
 
-// CheckRateLimit implements rate limiting for API endpoints
-func (r *RedisService) CheckRateLimit(identifier string, limit int, window time.Duration) (bool, int, error) {
+// RateLimitResult is the state of a rate limit counter after counting a request
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// rateLimitScript counts a request in a fixed window that starts with the
+// window's first request, returning the count and the window's remaining
+// milliseconds
+var rateLimitScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+local ttl = redis.call("PTTL", KEYS[1])
+if count == 1 or ttl < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+	ttl = tonumber(ARGV[1])
+end
+return {count, ttl}
+`)
+
+// HitRateLimit counts a request against a limit per window. The counter is
+// incremented atomically, so concurrent requests can't exceed the limit.
+func (r *RedisService) HitRateLimit(identifier string, limit int, window time.Duration) (*RateLimitResult, error) {
 	key := CacheKey{Prefix: RateLimitPrefix, ID: identifier}.String()
-	
-	// Get current count
-	current, err := r.Client.Get(r.ctx, key).Int()
-	if err == redis.Nil {
-		// First request in window
-		err = r.Client.SetNX(r.ctx, key, 1, window).Err()
-		if err != nil {
-			return false, 0, err
-		}
-		return true, limit-1, nil
-	} else if err != nil {
-		return false, 0, err
+	values, err := rateLimitScript.Run(r.ctx, r.Client, []string{key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return nil, err
 	}
-	
-	// Check if limit exceeded
-	if current >= limit {
-		return false, 0, nil
+
+	count, ttl := values[0], values[1]
+	remaining := limit - int(count)
+	if remaining < 0 {
+		remaining = 0
 	}
-	
-	// Increment counter
-	newCount, err := r.Client.Incr(r.ctx, key).Result()
+	return &RateLimitResult{
+		Allowed:   count <= int64(limit),
+		Limit:     limit,
+		Remaining: remaining,
+		ResetAt:   time.Now().Add(time.Duration(ttl) * time.Millisecond),
+	}, nil
+}
+
+// CheckRateLimit implements rate limiting for API endpoints
+func (r *RedisService) CheckRateLimit(identifier string, limit int, window time.Duration) (bool, int, error) {
+	result, err := r.HitRateLimit(identifier, limit, window)
 	if err != nil {
 		return false, 0, err
 	}
-	
-	return true, limit-int(newCount), nil
+	return result.Allowed, result.Remaining, nil
 }
 
 // Session Management
@@ -0,0 +1,370 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Report subscription formats
+const (
+	ReportFormatCSV = "CSV"
+	ReportFormatPDF = "PDF"
+)
+
+// Report subscription frequencies
+const (
+	ReportDaily   = "DAILY"
+	ReportWeekly  = "WEEKLY"
+	ReportMonthly = "MONTHLY"
+)
+
+// ReportSubscriptionRequest configures which report a subscription emails and when
+type ReportSubscriptionRequest struct {
+	Report     string `json:"report"`
+	Format     string `json:"format"`       // CSV (default) or PDF
+	Frequency  string `json:"frequency"`    // DAILY, WEEKLY or MONTHLY
+	DayOfWeek  int    `json:"day_of_week"`  // weekly reports, 0 is Sunday
+	DayOfMonth int    `json:"day_of_month"` // monthly reports, 1-28
+	Hour       int    `json:"hour"`         // local hour the report is sent
+	Timezone   string `json:"timezone"`     // defaults to UTC
+	Recipients string `json:"recipients"`   // comma separated, empty sends to the user
+	Active     *bool  `json:"active"`
+}
+
+// ReportSubscriptionService manages report subscriptions and emails the
+// reports that are due
+type ReportSubscriptionService struct {
+	db        *gorm.DB
+	analytics *AnalyticsService
+	sender    EmailSender
+	renderer  *EmailTemplateRenderer
+}
+
+// NewReportSubscriptionService creates a report subscription service sending
+// through the email provider configured in cfg. Reports can't be sent while
+// email delivery is disabled.
+func NewReportSubscriptionService(db *gorm.DB, cfg *config.EmailConfig) *ReportSubscriptionService {
+	s := &ReportSubscriptionService{
+		db:        db,
+		analytics: NewAnalyticsService(db),
+	}
+
+	renderer, err := NewEmailTemplateRenderer(cfg.AppBaseURL)
+	if err != nil {
+		log.Printf("Report emails disabled: %v", err)
+		return s
+	}
+	s.renderer = renderer
+	if cfg.Enabled {
+		s.sender = NewEmailSender(cfg)
+	}
+	return s
+}
+
+// SetEmailSender replaces the sender reports are emailed with
+func (s *ReportSubscriptionService) SetEmailSender(sender EmailSender) {
+	s.sender = sender
+}
+
+// CreateSubscription subscribes a user to a report
+func (s *ReportSubscriptionService) CreateSubscription(userID uint, req ReportSubscriptionRequest) (*models.ReportSubscription, error) {
+	subscription := &models.ReportSubscription{UserID: userID, Active: true}
+	if err := applyReportSubscriptionRequest(subscription, req); err != nil {
+		return nil, err
+	}
+
+	next := nextReportRun(subscription, time.Now())
+	subscription.NextRunAt = &next
+	if err := s.db.Create(subscription).Error; err != nil {
+		return nil, fmt.Errorf("failed to create report subscription: %w", err)
+	}
+	return subscription, nil
+}
+
+// GetUserSubscriptions returns a user's report subscriptions
+func (s *ReportSubscriptionService) GetUserSubscriptions(userID uint) ([]models.ReportSubscription, error) {
+	var subscriptions []models.ReportSubscription
+	if err := s.db.Where("user_id = ?", userID).Order("id ASC").Find(&subscriptions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get report subscriptions: %w", err)
+	}
+	return subscriptions, nil
+}
+
+// GetSubscription returns one of a user's report subscriptions
+func (s *ReportSubscriptionService) GetSubscription(userID, subscriptionID uint) (*models.ReportSubscription, error) {
+	var subscription models.ReportSubscription
+	if err := s.db.Where("id = ? AND user_id = ?", subscriptionID, userID).First(&subscription).Error; err != nil {
+		return nil, errors.New("report subscription not found")
+	}
+	return &subscription, nil
+}
+
+// UpdateSubscription replaces the report and schedule of a subscription
+func (s *ReportSubscriptionService) UpdateSubscription(userID, subscriptionID uint, req ReportSubscriptionRequest) (*models.ReportSubscription, error) {
+	subscription, err := s.GetSubscription(userID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyReportSubscriptionRequest(subscription, req); err != nil {
+		return nil, err
+	}
+
+	next := nextReportRun(subscription, time.Now())
+	subscription.NextRunAt = &next
+	if err := s.db.Save(subscription).Error; err != nil {
+		return nil, fmt.Errorf("failed to update report subscription: %w", err)
+	}
+	return subscription, nil
+}
+
+// DeleteSubscription unsubscribes a user from a report
+func (s *ReportSubscriptionService) DeleteSubscription(userID, subscriptionID uint) error {
+	subscription, err := s.GetSubscription(userID, subscriptionID)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Delete(subscription).Error; err != nil {
+		return fmt.Errorf("failed to delete report subscription: %w", err)
+	}
+	return nil
+}
+
+// SendDueReports emails every active subscription whose next run has passed
+// and schedules its following run. Runs missed while the scheduler was down
+// are sent once, not caught up one by one.
+func (s *ReportSubscriptionService) SendDueReports() error {
+	now := time.Now()
+
+	var subscriptions []models.ReportSubscription
+	if err := s.db.Where("active = ? AND next_run_at <= ?", true, now).Find(&subscriptions).Error; err != nil {
+		return fmt.Errorf("failed to get due report subscriptions: %w", err)
+	}
+
+	for i := range subscriptions {
+		subscription := &subscriptions[i]
+		updates := map[string]interface{}{
+			"next_run_at": nextReportRun(subscription, now),
+			"last_error":  "",
+		}
+		if err := s.SendReport(subscription, *subscription.NextRunAt); err != nil {
+			log.Printf("Failed to send report subscription %d: %v", subscription.ID, err)
+			updates["last_error"] = err.Error()
+		} else {
+			updates["last_sent_at"] = now
+		}
+
+		if err := s.db.Model(subscription).Updates(updates).Error; err != nil {
+			log.Printf("Failed to schedule report subscription %d: %v", subscription.ID, err)
+		}
+	}
+	return nil
+}
+
+// SendReport emails a subscription's report for the period ending at end
+func (s *ReportSubscriptionService) SendReport(subscription *models.ReportSubscription, end time.Time) error {
+	if s.sender == nil || s.renderer == nil {
+		return errors.New("email delivery is disabled")
+	}
+
+	recipients, err := s.reportRecipients(subscription)
+	if err != nil {
+		return err
+	}
+
+	// Reports cover what the subscriber sees in the app
+	scope, err := NewOrganizationService(s.db).Scope(subscription.UserID)
+	if err != nil {
+		return err
+	}
+
+	start := reportPeriodStart(subscription, end)
+	table, err := s.analytics.GetReportTable(subscription.Report, AnalyticsFilter{From: &start, To: &end, Scope: scope})
+	if err != nil {
+		return err
+	}
+
+	period := fmt.Sprintf("%s to %s", start.In(reportLocation(subscription)).Format("Jan 2, 2006 15:04"),
+		end.In(reportLocation(subscription)).Format("Jan 2, 2006 15:04 MST"))
+	attachment := EmailAttachment{
+		Filename: fmt.Sprintf("%s-%s", table.Name, end.In(reportLocation(subscription)).Format("2006-01-02")),
+	}
+	if subscription.Format == ReportFormatPDF {
+		attachment.Filename += ".pdf"
+		attachment.ContentType = "application/pdf"
+		attachment.Content = table.PDF(period)
+	} else {
+		attachment.Filename += ".csv"
+		attachment.ContentType = "text/csv; charset=utf-8"
+		if attachment.Content, err = table.CSV(); err != nil {
+			return err
+		}
+	}
+
+	email, err := s.renderer.Render(&models.Notification{
+		Title:   fmt.Sprintf("Your %s %s report", strings.ToLower(subscription.Frequency), table.Title),
+		Message: fmt.Sprintf("The %s report for %s is attached with %d rows.", table.Title, period, len(table.Rows)),
+		Type:    "ANALYTICS_REPORT",
+	})
+	if err != nil {
+		return err
+	}
+	email.Attachments = []EmailAttachment{attachment}
+
+	var failed int
+	for _, to := range recipients {
+		if err := s.sender.Send(to, email); err != nil {
+			log.Printf("Failed to email report subscription %d to %s: %v", subscription.ID, to, err)
+			failed++
+		}
+	}
+	if failed == len(recipients) {
+		return fmt.Errorf("failed to send report to all %d recipients", len(recipients))
+	}
+	return nil
+}
+
+// reportRecipients returns the addresses a subscription's report is sent to,
+// defaulting to the subscribed user
+func (s *ReportSubscriptionService) reportRecipients(subscription *models.ReportSubscription) ([]string, error) {
+	if subscription.Recipients != "" {
+		return strings.Split(subscription.Recipients, ", "), nil
+	}
+
+	var user models.User
+	if err := s.db.First(&user, subscription.UserID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if user.Email == "" {
+		return nil, errors.New("user has no email address")
+	}
+	return []string{user.Email}, nil
+}
+
+// applyReportSubscriptionRequest validates a request and copies it to the subscription
+func applyReportSubscriptionRequest(subscription *models.ReportSubscription, req ReportSubscriptionRequest) error {
+	report := ""
+	for _, name := range AnalyticsReports {
+		if name == req.Report {
+			report = name
+		}
+	}
+	if report == "" {
+		return fmt.Errorf("unknown report %q, use one of %s", req.Report, strings.Join(AnalyticsReports, ", "))
+	}
+
+	format := strings.ToUpper(req.Format)
+	switch format {
+	case "":
+		format = ReportFormatCSV
+	case ReportFormatCSV, ReportFormatPDF:
+	default:
+		return fmt.Errorf("invalid format %q, use CSV or PDF", req.Format)
+	}
+
+	frequency := strings.ToUpper(req.Frequency)
+	switch frequency {
+	case ReportDaily:
+	case ReportWeekly:
+		if req.DayOfWeek < 0 || req.DayOfWeek > 6 {
+			return errors.New("day of week must be between 0 (Sunday) and 6")
+		}
+	case ReportMonthly:
+		// Later days don't exist in every month
+		if req.DayOfMonth < 1 || req.DayOfMonth > 28 {
+			return errors.New("day of month must be between 1 and 28")
+		}
+	default:
+		return fmt.Errorf("invalid frequency %q, use DAILY, WEEKLY or MONTHLY", req.Frequency)
+	}
+
+	if req.Hour < 0 || req.Hour > 23 {
+		return errors.New("hour must be between 0 and 23")
+	}
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %s", req.Timezone)
+	}
+
+	var recipients []string
+	for _, recipient := range strings.Split(req.Recipients, ",") {
+		if recipient = strings.TrimSpace(recipient); recipient == "" {
+			continue
+		}
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return fmt.Errorf("invalid recipient: %s", recipient)
+		}
+		recipients = append(recipients, address.Address)
+	}
+
+	subscription.Report = report
+	subscription.Format = format
+	subscription.Frequency = frequency
+	subscription.DayOfWeek = req.DayOfWeek
+	subscription.DayOfMonth = req.DayOfMonth
+	subscription.Hour = req.Hour
+	subscription.Timezone = timezone
+	subscription.Recipients = strings.Join(recipients, ", ")
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+	return nil
+}
+
+// reportLocation returns the subscription's timezone, defaulting to UTC
+func reportLocation(subscription *models.ReportSubscription) *time.Location {
+	loc, err := time.LoadLocation(subscription.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// nextReportRun returns the first scheduled send of a subscription after t
+func nextReportRun(subscription *models.ReportSubscription, t time.Time) time.Time {
+	local := t.In(reportLocation(subscription))
+	run := time.Date(local.Year(), local.Month(), local.Day(), subscription.Hour, 0, 0, 0, local.Location())
+
+	switch subscription.Frequency {
+	case ReportWeekly:
+		run = run.AddDate(0, 0, (subscription.DayOfWeek-int(run.Weekday())+7)%7)
+		if !run.After(local) {
+			run = run.AddDate(0, 0, 7)
+		}
+	case ReportMonthly:
+		run = time.Date(local.Year(), local.Month(), subscription.DayOfMonth, subscription.Hour, 0, 0, 0, local.Location())
+		if !run.After(local) {
+			run = run.AddDate(0, 1, 0)
+		}
+	default:
+		if !run.After(local) {
+			run = run.AddDate(0, 0, 1)
+		}
+	}
+	return run
+}
+
+// reportPeriodStart returns the start of the period a report sent at end
+// covers: the previous day, week or month
+func reportPeriodStart(subscription *models.ReportSubscription, end time.Time) time.Time {
+	local := end.In(reportLocation(subscription))
+	switch subscription.Frequency {
+	case ReportWeekly:
+		return local.AddDate(0, 0, -7)
+	case ReportMonthly:
+		return local.AddDate(0, -1, 0)
+	default:
+		return local.AddDate(0, 0, -1)
+	}
+}
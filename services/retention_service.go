@@ -0,0 +1,432 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Data types covered by retention policies
+const (
+	RetentionTrackingRecords = "TRACKING_RECORDS"
+	RetentionTrackingEvents  = "TRACKING_EVENTS"
+	RetentionCriticalEvents  = "CRITICAL_TRACKING_EVENTS"
+	RetentionNotifications   = "NOTIFICATIONS"
+)
+
+// Retention run statuses
+const (
+	RetentionRunning   = "RUNNING"
+	RetentionCompleted = "COMPLETED"
+	RetentionFailed    = "FAILED"
+)
+
+// A RUNNING run older than this is assumed to have died with its process and
+// doesn't block new runs
+const retentionRunTimeout = 6 * time.Hour
+
+// ErrRetentionRunInProgress is returned when a cleanup is started while
+// another one is running
+var ErrRetentionRunInProgress = errors.New("a retention cleanup is already running")
+
+// criticalTrackingEvents are kept under their own, usually longer, retention
+var criticalTrackingEvents = []string{"DEPARTURE", "ARRIVAL", "DELAY", "EXCEPTION"}
+
+// retentionTarget describes where the rows of a data type are stored
+type retentionTarget struct {
+	table      string
+	timeColumn string
+	// Table rows are moved to when archived in the database, under the
+	// same retention
+	archiveTable string
+	// Condition matching the rows of the carriers given as its argument
+	owner string
+	// Extra condition on the rows, with criticalTrackingEvents as its argument
+	eventFilter string
+	// Rows of another table referencing the deleted rows, deleted with them
+	dependentTable  string
+	dependentColumn string
+}
+
+var retentionTargets = map[string]retentionTarget{
+	RetentionTrackingRecords: {
+		table:        "tracking_records",
+		timeColumn:   "timestamp",
+		archiveTable: archivedTrackingRecordsTable,
+		owner:        "trip_id IN (SELECT id FROM trips WHERE user_id IN ?)",
+	},
+	RetentionTrackingEvents: {
+		table:       "tracking_events",
+		timeColumn:  "timestamp",
+		owner:       "trip_id IN (SELECT id FROM trips WHERE user_id IN ?)",
+		eventFilter: "event_type NOT IN ?",
+	},
+	RetentionCriticalEvents: {
+		table:       "tracking_events",
+		timeColumn:  "timestamp",
+		owner:       "trip_id IN (SELECT id FROM trips WHERE user_id IN ?)",
+		eventFilter: "event_type IN ?",
+	},
+	RetentionNotifications: {
+		table:           "notifications",
+		timeColumn:      "created_at",
+		owner:           "user_id IN ?",
+		dependentTable:  "notification_deliveries",
+		dependentColumn: "notification_id",
+	},
+}
+
+// RetentionPolicyRequest sets the retention of a data type, for a carrier or
+// as the default
+type RetentionPolicyRequest struct {
+	CarrierID     *uint  `json:"carrier_id"` // empty sets the default policy
+	DataType      string `json:"data_type"`
+	RetentionDays int    `json:"retention_days"`
+	Archive       *bool  `json:"archive"` // defaults to the configured archiving
+}
+
+// RetentionService deletes data past its retention, archiving it as JSON to
+// storage first when the policy asks for it
+type RetentionService struct {
+	db      *gorm.DB
+	cfg     *config.RetentionConfig
+	archive FileStorage
+}
+
+// NewRetentionService creates a retention service archiving to the storage
+// configured in storageCfg. Archives stored on the local disk are written
+// outside the public uploads directory.
+func NewRetentionService(db *gorm.DB, cfg *config.RetentionConfig, storageCfg *config.StorageConfig) *RetentionService {
+	var archive FileStorage
+	if storageCfg.Provider == "s3" {
+		archive = NewS3FileStorage(storageCfg)
+	} else {
+		archive = NewLocalFileStorage(cfg.ArchiveLocalPath, "")
+	}
+
+	return &RetentionService{
+		db:      db,
+		cfg:     cfg,
+		archive: archive,
+	}
+}
+
+// SetArchiveStorage replaces the storage data is archived to
+func (rs *RetentionService) SetArchiveStorage(storage FileStorage) {
+	rs.archive = storage
+}
+
+// GetPolicies returns the stored retention policies, defaults first
+func (rs *RetentionService) GetPolicies() ([]models.RetentionPolicy, error) {
+	var policies []models.RetentionPolicy
+	if err := rs.db.Order("carrier_id IS NOT NULL, carrier_id, data_type").Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("failed to get retention policies: %w", err)
+	}
+	return policies, nil
+}
+
+// SetPolicy creates or replaces the policy of a data type for a carrier, or
+// the default policy when no carrier is given
+func (rs *RetentionService) SetPolicy(req RetentionPolicyRequest) (*models.RetentionPolicy, error) {
+	dataType := strings.ToUpper(strings.TrimSpace(req.DataType))
+	if _, ok := retentionTargets[dataType]; !ok {
+		return nil, fmt.Errorf("unknown data type %q", req.DataType)
+	}
+	if req.RetentionDays <= 0 {
+		return nil, errors.New("retention days must be positive")
+	}
+
+	query := rs.db.Where("data_type = ?", dataType)
+	if req.CarrierID != nil {
+		var carrier models.User
+		if err := rs.db.First(&carrier, *req.CarrierID).Error; err != nil {
+			return nil, errors.New("carrier not found")
+		}
+		query = query.Where("carrier_id = ?", *req.CarrierID)
+	} else {
+		query = query.Where("carrier_id IS NULL")
+	}
+
+	var policy models.RetentionPolicy
+	if err := query.First(&policy).Error; err != nil {
+		policy = models.RetentionPolicy{CarrierID: req.CarrierID, DataType: dataType}
+	}
+	policy.RetentionDays = req.RetentionDays
+	policy.Archive = rs.cfg.Archive
+	if req.Archive != nil {
+		policy.Archive = *req.Archive
+	}
+
+	if err := rs.db.Save(&policy).Error; err != nil {
+		return nil, fmt.Errorf("failed to save retention policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// DeletePolicy deletes a retention policy. Data of the carrier falls back to
+// the default policy.
+func (rs *RetentionService) DeletePolicy(policyID uint) error {
+	result := rs.db.Delete(&models.RetentionPolicy{}, policyID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete retention policy: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("retention policy not found")
+	}
+	return nil
+}
+
+// GetRuns returns the latest cleanup runs, newest first
+func (rs *RetentionService) GetRuns(limit int) ([]models.RetentionRun, error) {
+	var runs []models.RetentionRun
+	if err := rs.db.Order("id DESC").Limit(limit).Find(&runs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get retention runs: %w", err)
+	}
+	return runs, nil
+}
+
+// GetRun returns a cleanup run with the result of each policy
+func (rs *RetentionService) GetRun(runID uint) (*models.RetentionRun, error) {
+	var run models.RetentionRun
+	if err := rs.db.Preload("Results").First(&run, runID).Error; err != nil {
+		return nil, errors.New("retention run not found")
+	}
+	return &run, nil
+}
+
+// RunScheduledCleanup runs the cleanup from the background scheduler
+func (rs *RetentionService) RunScheduledCleanup() error {
+	run, err := rs.RunCleanup("SCHEDULED", nil)
+	if err == ErrRetentionRunInProgress {
+		log.Printf("Skipping retention cleanup: %v", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if run.Status == RetentionFailed {
+		return fmt.Errorf("retention cleanup failed: %s", run.Error)
+	}
+	return nil
+}
+
+// RunCleanup applies every retention policy, archiving and deleting the data
+// past its retention. A policy failing doesn't stop the others; the run is
+// marked FAILED and the error kept on the policy result.
+func (rs *RetentionService) RunCleanup(trigger string, triggeredBy *uint) (*models.RetentionRun, error) {
+	var running int64
+	rs.db.Model(&models.RetentionRun{}).
+		Where("status = ? AND started_at > ?", RetentionRunning, time.Now().Add(-retentionRunTimeout)).
+		Count(&running)
+	if running > 0 {
+		return nil, ErrRetentionRunInProgress
+	}
+
+	run := &models.RetentionRun{
+		Trigger:     trigger,
+		TriggeredBy: triggeredBy,
+		Status:      RetentionRunning,
+		StartedAt:   time.Now(),
+	}
+	if err := rs.db.Create(run).Error; err != nil {
+		return nil, fmt.Errorf("failed to create retention run: %w", err)
+	}
+
+	failed := 0
+	policies, err := rs.effectivePolicies()
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	// Carriers with their own policy are left out of the default policy
+	ownPolicy := make(map[string][]uint)
+	for _, policy := range policies {
+		if policy.CarrierID != nil {
+			ownPolicy[policy.DataType] = append(ownPolicy[policy.DataType], *policy.CarrierID)
+		}
+	}
+
+	for _, policy := range policies {
+		result := rs.applyPolicy(run.ID, policy, ownPolicy[policy.DataType])
+		if err := rs.db.Create(&result).Error; err != nil {
+			log.Printf("Failed to save retention result of run %d: %v", run.ID, err)
+		}
+		if result.Error != "" {
+			failed++
+		}
+		run.RecordsArchived += result.RecordsArchived
+		run.RecordsDeleted += result.RecordsDeleted
+		run.Results = append(run.Results, result)
+	}
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.Status = RetentionCompleted
+	if failed > 0 {
+		run.Error = fmt.Sprintf("%d of %d policies failed", failed, len(policies))
+	}
+	if run.Error != "" {
+		run.Status = RetentionFailed
+	}
+	if err := rs.db.Omit("Results").Save(run).Error; err != nil {
+		return nil, fmt.Errorf("failed to save retention run: %w", err)
+	}
+
+	log.Printf("Retention run %d %s: %d records archived, %d deleted",
+		run.ID, strings.ToLower(run.Status), run.RecordsArchived, run.RecordsDeleted)
+	return run, nil
+}
+
+// effectivePolicies returns the stored policies, completed with a default
+// policy from the configuration for data types without one
+func (rs *RetentionService) effectivePolicies() ([]models.RetentionPolicy, error) {
+	var policies []models.RetentionPolicy
+	if err := rs.db.Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("failed to get retention policies: %w", err)
+	}
+
+	configured := map[string]int{
+		RetentionTrackingRecords: rs.cfg.TrackingRecordDays,
+		RetentionTrackingEvents:  rs.cfg.TrackingEventDays,
+		RetentionCriticalEvents:  rs.cfg.CriticalEventDays,
+		RetentionNotifications:   rs.cfg.NotificationDays,
+	}
+	for _, policy := range policies {
+		if policy.CarrierID == nil {
+			delete(configured, policy.DataType)
+		}
+	}
+	for dataType, days := range configured {
+		policies = append(policies, models.RetentionPolicy{
+			DataType:      dataType,
+			RetentionDays: days,
+			Archive:       rs.cfg.Archive,
+		})
+	}
+
+	sort.Slice(policies, func(i, j int) bool {
+		if policies[i].DataType != policies[j].DataType {
+			return policies[i].DataType < policies[j].DataType
+		}
+		if policies[i].CarrierID == nil || policies[j].CarrierID == nil {
+			return policies[j].CarrierID == nil && policies[i].CarrierID != nil
+		}
+		return *policies[i].CarrierID < *policies[j].CarrierID
+	})
+	return policies, nil
+}
+
+// applyPolicy archives and deletes, batch by batch, the data of a policy
+// older than its retention. The default policy skips the carriers in excluded.
+func (rs *RetentionService) applyPolicy(runID uint, policy models.RetentionPolicy, excluded []uint) models.RetentionRunResult {
+	target, ok := retentionTargets[policy.DataType]
+	cutoff := time.Now().AddDate(0, 0, -policy.RetentionDays)
+	result := models.RetentionRunResult{
+		RunID:         runID,
+		DataType:      policy.DataType,
+		CarrierID:     policy.CarrierID,
+		RetentionDays: policy.RetentionDays,
+		Cutoff:        cutoff,
+	}
+	if !ok {
+		result.Error = fmt.Sprintf("unknown data type %q", policy.DataType)
+		return result
+	}
+
+	if policy.Archive {
+		tenant := "default"
+		if policy.CarrierID != nil {
+			tenant = fmt.Sprintf("carrier-%d", *policy.CarrierID)
+		}
+		result.ArchivePrefix = path.Join(rs.cfg.ArchivePrefix, fmt.Sprintf("run-%d", runID),
+			strings.ToLower(policy.DataType), tenant)
+	}
+
+	tables := []string{target.table}
+	if target.archiveTable != "" {
+		tables = append(tables, target.archiveTable)
+	}
+	batch := 0
+	for _, table := range tables {
+		for {
+			batch++
+			query := rs.db.Table(table).Where(target.timeColumn+" < ?", cutoff)
+			if policy.CarrierID != nil {
+				query = query.Where(target.owner, []uint{*policy.CarrierID})
+			} else if len(excluded) > 0 {
+				query = query.Where("NOT ("+target.owner+")", excluded)
+			}
+			if target.eventFilter != "" {
+				query = query.Where(target.eventFilter, criticalTrackingEvents)
+			}
+
+			var ids []uint
+			if err := query.Order("id").Limit(rs.cfg.BatchSize).Pluck("id", &ids).Error; err != nil {
+				result.Error = fmt.Sprintf("failed to select %s: %v", table, err)
+				return result
+			}
+			if len(ids) == 0 {
+				break
+			}
+
+			if policy.Archive {
+				key := fmt.Sprintf("%s/%04d.json", result.ArchivePrefix, batch)
+				archived, err := rs.archiveRows(table, ids, key)
+				if err != nil {
+					result.Error = err.Error()
+					return result
+				}
+				result.RecordsArchived += archived
+			}
+
+			var deleted int64
+			err := rs.db.Transaction(func(tx *gorm.DB) error {
+				if target.dependentTable != "" {
+					if err := tx.Exec("DELETE FROM "+target.dependentTable+" WHERE "+target.dependentColumn+" IN ?", ids).Error; err != nil {
+						return err
+					}
+				}
+				res := tx.Exec("DELETE FROM "+table+" WHERE id IN ?", ids)
+				deleted = res.RowsAffected
+				return res.Error
+			})
+			if err != nil {
+				result.Error = fmt.Sprintf("failed to delete %s: %v", table, err)
+				return result
+			}
+			result.RecordsDeleted += deleted
+
+			if len(ids) < rs.cfg.BatchSize {
+				break
+			}
+		}
+	}
+	return result
+}
+
+// archiveRows writes the rows with the given IDs to the archive storage as a
+// JSON array
+func (rs *RetentionService) archiveRows(table string, ids []uint, key string) (int64, error) {
+	var rows []map[string]interface{}
+	if err := rs.db.Table(table).Where("id IN ?", ids).Order("id").Find(&rows).Error; err != nil {
+		return 0, fmt.Errorf("failed to read %s for archiving: %w", table, err)
+	}
+
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode %s archive: %w", table, err)
+	}
+	if _, err := rs.archive.Put(key, "application/json", data); err != nil {
+		return 0, fmt.Errorf("failed to archive %s: %w", table, err)
+	}
+	return int64(len(rows)), nil
+}
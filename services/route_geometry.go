@@ -0,0 +1,185 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"triplink/backend/internal/geo"
+)
+
+// EncodePolyline encodes coordinates using the Google encoded polyline algorithm
+// with 5 decimal places of precision
+func EncodePolyline(points []Coordinate) string {
+	geoPoints := make([]geo.Point, len(points))
+	for i, point := range points {
+		geoPoints[i] = geo.Point{Lat: point.Latitude, Lng: point.Longitude}
+	}
+	return geo.EncodePolyline(geoPoints)
+}
+
+// DecodePolyline decodes a Google encoded polyline into coordinates
+func DecodePolyline(encoded string) ([]Coordinate, error) {
+	geoPoints, err := geo.DecodePolyline(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []Coordinate
+	for _, point := range geoPoints {
+		points = append(points, Coordinate{Latitude: point.Lat, Longitude: point.Lng})
+	}
+	return points, nil
+}
+
+// SimplifyPath reduces the number of points in a path using the Douglas-Peucker
+// algorithm. Points closer than toleranceMeters to the simplified line are dropped.
+func SimplifyPath(points []Coordinate, toleranceMeters float64) []Coordinate {
+	if len(points) < 3 || toleranceMeters <= 0 {
+		return points
+	}
+
+	keep := make([]bool, len(points))
+	keep[0] = true
+	keep[len(points)-1] = true
+
+	// Iterative stack of segments to avoid deep recursion on long traces
+	type segment struct{ start, end int }
+	stack := []segment{{0, len(points) - 1}}
+
+	for len(stack) > 0 {
+		seg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		maxDistance := 0.0
+		maxIndex := -1
+		for i := seg.start + 1; i < seg.end; i++ {
+			distance := perpendicularDistanceMeters(points[i], points[seg.start], points[seg.end])
+			if distance > maxDistance {
+				maxDistance = distance
+				maxIndex = i
+			}
+		}
+
+		if maxIndex != -1 && maxDistance > toleranceMeters {
+			keep[maxIndex] = true
+			stack = append(stack, segment{seg.start, maxIndex}, segment{maxIndex, seg.end})
+		}
+	}
+
+	simplified := make([]Coordinate, 0, len(points))
+	for i, point := range points {
+		if keep[i] {
+			simplified = append(simplified, point)
+		}
+	}
+	return simplified
+}
+
+// perpendicularDistanceMeters returns the distance from point to the segment
+// start-end using an equirectangular projection, which is accurate enough for
+// the short segments found in tracking traces
+func perpendicularDistanceMeters(point, start, end Coordinate) float64 {
+	const earthRadiusMeters = 6371000.0
+
+	refLat := start.Latitude * math.Pi / 180
+	project := func(c Coordinate) (float64, float64) {
+		x := c.Longitude * math.Pi / 180 * math.Cos(refLat) * earthRadiusMeters
+		y := c.Latitude * math.Pi / 180 * earthRadiusMeters
+		return x, y
+	}
+
+	px, py := project(point)
+	sx, sy := project(start)
+	ex, ey := project(end)
+
+	dx, dy := ex-sx, ey-sy
+	if dx == 0 && dy == 0 {
+		return math.Hypot(px-sx, py-sy)
+	}
+
+	// Clamp the projection onto the segment
+	t := ((px-sx)*dx + (py-sy)*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+
+	return math.Hypot(px-(sx+t*dx), py-(sy+t*dy))
+}
+
+// ProjectOntoPath returns the distance in meters from point to the nearest
+// segment of path, and how far along the path (0-1) that nearest point lies
+func ProjectOntoPath(path []Coordinate, point Coordinate) (float64, float64) {
+	if len(path) == 0 {
+		return math.Inf(1), 0
+	}
+	if len(path) == 1 {
+		return pointDistanceMeters(point, path[0]), 0
+	}
+
+	segmentLengths := make([]float64, len(path)-1)
+	totalLength := 0.0
+	for i := 0; i < len(path)-1; i++ {
+		segmentLengths[i] = pointDistanceMeters(path[i+1], path[i])
+		totalLength += segmentLengths[i]
+	}
+
+	bestDistance := math.Inf(1)
+	bestAlong := 0.0
+	traveled := 0.0
+	for i := 0; i < len(path)-1; i++ {
+		distance := perpendicularDistanceMeters(point, path[i], path[i+1])
+		if distance < bestDistance {
+			bestDistance = distance
+			// Distance from the segment start to the projected point
+			fromStart := pointDistanceMeters(point, path[i])
+			along := math.Sqrt(math.Max(0, fromStart*fromStart-distance*distance))
+			bestAlong = traveled + math.Min(along, segmentLengths[i])
+		}
+		traveled += segmentLengths[i]
+	}
+
+	if totalLength == 0 {
+		return bestDistance, 0
+	}
+	return bestDistance, bestAlong / totalLength
+}
+
+// pointDistanceMeters returns the distance between two nearby points using the
+// same projection as perpendicularDistanceMeters
+func pointDistanceMeters(a, b Coordinate) float64 {
+	return perpendicularDistanceMeters(a, b, b)
+}
+
+// routeDistances returns the distance in km along a route to each of its
+// points
+func routeDistances(route []Coordinate) []float64 {
+	cumulative := make([]float64, len(route))
+	for i := 1; i < len(route); i++ {
+		cumulative[i] = cumulative[i-1] + geo.Distance(route[i-1].Latitude, route[i-1].Longitude, route[i].Latitude, route[i].Longitude)
+	}
+	return cumulative
+}
+
+// pointAlongRoute returns the point a distance in km along a route, given
+// the distances to its points
+func pointAlongRoute(route []Coordinate, cumulative []float64, km float64) Coordinate {
+	segment := sort.SearchFloat64s(cumulative, km)
+	if segment == 0 {
+		return route[0]
+	}
+	if segment == len(route) {
+		return route[len(route)-1]
+	}
+	from, to := route[segment-1], route[segment]
+	fraction := (km - cumulative[segment-1]) / (cumulative[segment] - cumulative[segment-1])
+	return Coordinate{
+		Latitude:  from.Latitude + (to.Latitude-from.Latitude)*fraction,
+		Longitude: from.Longitude + (to.Longitude-from.Longitude)*fraction,
+	}
+}
+
+// sampleRoute returns points every interval km along a route, and its end
+func sampleRoute(route []Coordinate, cumulative []float64, intervalKm float64) []Coordinate {
+	samples := []Coordinate{route[0]}
+	for km := intervalKm; km < cumulative[len(cumulative)-1]; km += intervalKm {
+		samples = append(samples, pointAlongRoute(route, cumulative, km))
+	}
+	return append(samples, route[len(route)-1])
+}
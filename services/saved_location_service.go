@@ -0,0 +1,256 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrSavedLocationNotFound is returned for locations missing from the user's
+// address book
+var ErrSavedLocationNotFound = errors.New("saved location not found")
+
+// SavedLocationRequest sets the fields of a saved location. Locations
+// without coordinates are geocoded from their address.
+type SavedLocationRequest struct {
+	Name              string   `json:"name" validate:"required"`
+	Address           string   `json:"address" validate:"required"`
+	City              string   `json:"city"`
+	State             string   `json:"state"`
+	Country           string   `json:"country"`
+	PostalCode        string   `json:"postal_code"`
+	Lat               *float64 `json:"lat" validate:"omitempty,latitude"`
+	Lng               *float64 `json:"lng" validate:"omitempty,longitude"`
+	ContactName       string   `json:"contact_name"`
+	ContactPhone      string   `json:"contact_phone"`
+	Notes             string   `json:"notes"`
+	IsDefaultPickup   bool     `json:"is_default_pickup"`
+	IsDefaultDelivery bool     `json:"is_default_delivery"`
+}
+
+// SavedLocationService manages users' address books
+type SavedLocationService struct {
+	db       *gorm.DB
+	geocoder AddressGeocoder
+}
+
+// NewSavedLocationService creates a new SavedLocationService. Without a
+// geocoder locations must be saved with their coordinates.
+func NewSavedLocationService(db *gorm.DB, geocoder AddressGeocoder) *SavedLocationService {
+	return &SavedLocationService{
+		db:       db,
+		geocoder: geocoder,
+	}
+}
+
+// CreateLocation adds a location to a user's address book
+func (s *SavedLocationService) CreateLocation(userID uint, req SavedLocationRequest) (*models.SavedLocation, error) {
+	location := &models.SavedLocation{UserID: userID}
+	if err := s.applyRequest(location, req); err != nil {
+		return nil, err
+	}
+	if err := s.save(location); err != nil {
+		return nil, fmt.Errorf("failed to create saved location: %w", err)
+	}
+	return location, nil
+}
+
+// GetUserLocations returns a user's saved locations by name
+func (s *SavedLocationService) GetUserLocations(userID uint) ([]models.SavedLocation, error) {
+	var locations []models.SavedLocation
+	if err := s.db.Where("user_id = ?", userID).Order("name ASC, id ASC").Find(&locations).Error; err != nil {
+		return nil, fmt.Errorf("failed to get saved locations: %w", err)
+	}
+	return locations, nil
+}
+
+// GetLocation returns one of a user's saved locations
+func (s *SavedLocationService) GetLocation(userID, locationID uint) (*models.SavedLocation, error) {
+	var location models.SavedLocation
+	if err := s.db.Where("id = ? AND user_id = ?", locationID, userID).First(&location).Error; err != nil {
+		return nil, ErrSavedLocationNotFound
+	}
+	return &location, nil
+}
+
+// UpdateLocation replaces the fields of a saved location. A changed address
+// is geocoded again unless coordinates are given.
+func (s *SavedLocationService) UpdateLocation(userID, locationID uint, req SavedLocationRequest) (*models.SavedLocation, error) {
+	location, err := s.GetLocation(userID, locationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyRequest(location, req); err != nil {
+		return nil, err
+	}
+	if err := s.save(location); err != nil {
+		return nil, fmt.Errorf("failed to update saved location: %w", err)
+	}
+	return location, nil
+}
+
+// DeleteLocation removes a location from a user's address book. Loads and
+// trips created from it keep their addresses.
+func (s *SavedLocationService) DeleteLocation(userID, locationID uint) error {
+	location, err := s.GetLocation(userID, locationID)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Delete(location).Error; err != nil {
+		return fmt.Errorf("failed to delete saved location: %w", err)
+	}
+	return nil
+}
+
+// ApplyToLoad fills the pickup and delivery of a load from the user's saved
+// locations. A location ID of 0 leaves the address as given, or uses the
+// user's default location when the load has no address.
+func (s *SavedLocationService) ApplyToLoad(userID uint, load *models.Load, pickupID, deliveryID uint) error {
+	pickup, err := s.resolve(userID, pickupID, load.PickupAddress == "", "is_default_pickup")
+	if err != nil {
+		return fmt.Errorf("pickup %w", err)
+	}
+	if pickup != nil {
+		load.PickupAddress, load.PickupCity, load.PickupState, load.PickupCountry = pickup.Address, pickup.City, pickup.State, pickup.Country
+		load.PickupLat, load.PickupLng = pickup.Lat, pickup.Lng
+	}
+
+	delivery, err := s.resolve(userID, deliveryID, load.DeliveryAddress == "", "is_default_delivery")
+	if err != nil {
+		return fmt.Errorf("delivery %w", err)
+	}
+	if delivery != nil {
+		load.DeliveryAddress, load.DeliveryCity, load.DeliveryState, load.DeliveryCountry = delivery.Address, delivery.City, delivery.State, delivery.Country
+		load.DeliveryLat, load.DeliveryLng = delivery.Lat, delivery.Lng
+	}
+	return nil
+}
+
+// ApplyToTrip fills the origin and destination of a trip from the user's
+// saved locations, the default pickup and delivery locations standing in
+// for a missing origin and destination
+func (s *SavedLocationService) ApplyToTrip(userID uint, trip *models.Trip, originID, destinationID uint) error {
+	origin, err := s.resolve(userID, originID, trip.OriginAddress == "", "is_default_pickup")
+	if err != nil {
+		return fmt.Errorf("origin %w", err)
+	}
+	if origin != nil {
+		trip.OriginAddress, trip.OriginCity, trip.OriginState, trip.OriginCountry = origin.Address, origin.City, origin.State, origin.Country
+		trip.OriginLat, trip.OriginLng = origin.Lat, origin.Lng
+	}
+
+	destination, err := s.resolve(userID, destinationID, trip.DestinationAddress == "", "is_default_delivery")
+	if err != nil {
+		return fmt.Errorf("destination %w", err)
+	}
+	if destination != nil {
+		trip.DestinationAddress, trip.DestinationCity, trip.DestinationState, trip.DestinationCountry = destination.Address, destination.City, destination.State, destination.Country
+		trip.DestinationLat, trip.DestinationLng = destination.Lat, destination.Lng
+	}
+	return nil
+}
+
+// resolve returns the saved location with an ID, or the user's default
+// location of a kind when no ID is given and a default is wanted
+func (s *SavedLocationService) resolve(userID, locationID uint, useDefault bool, defaultColumn string) (*models.SavedLocation, error) {
+	if locationID != 0 {
+		return s.GetLocation(userID, locationID)
+	}
+	if !useDefault || userID == 0 {
+		return nil, nil
+	}
+	var location models.SavedLocation
+	if err := s.db.Where("user_id = ? AND "+defaultColumn+" = ?", userID, true).First(&location).Error; err != nil {
+		return nil, nil
+	}
+	return &location, nil
+}
+
+// applyRequest validates a request and copies it onto a location, geocoding
+// the address when no coordinates are given
+func (s *SavedLocationService) applyRequest(location *models.SavedLocation, req SavedLocationRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Address = strings.TrimSpace(req.Address)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if req.Address == "" {
+		return errors.New("address is required")
+	}
+	if (req.Lat == nil) != (req.Lng == nil) {
+		return errors.New("lat and lng must be given together")
+	}
+
+	addressChanged := location.ID == 0 || req.Address != location.Address || req.City != location.City ||
+		req.State != location.State || req.Country != location.Country || req.PostalCode != location.PostalCode
+
+	location.Name = req.Name
+	location.Address = req.Address
+	location.City = req.City
+	location.State = req.State
+	location.Country = req.Country
+	location.PostalCode = req.PostalCode
+	location.ContactName = req.ContactName
+	location.ContactPhone = req.ContactPhone
+	location.Notes = req.Notes
+	location.IsDefaultPickup = req.IsDefaultPickup
+	location.IsDefaultDelivery = req.IsDefaultDelivery
+
+	switch {
+	case req.Lat != nil:
+		if !isValidCoordinate(*req.Lat, *req.Lng) {
+			return errors.New("invalid coordinates")
+		}
+		location.Lat, location.Lng = *req.Lat, *req.Lng
+	case addressChanged:
+		if s.geocoder == nil {
+			return errors.New("lat and lng are required, no geocoding provider is configured")
+		}
+		result, err := s.geocoder.GeocodeAddress(joinNonEmpty(location.Address, location.City, location.State, location.PostalCode, location.Country))
+		if errors.Is(err, ErrNoGeocoder) {
+			return errors.New("lat and lng are required, no geocoding provider is configured")
+		}
+		if err != nil {
+			return errors.New("address could not be geocoded")
+		}
+		location.Lat = result.Geometry.Location.Latitude
+		location.Lng = result.Geometry.Location.Longitude
+		for _, component := range result.AddressComponents {
+			for _, componentType := range component.Types {
+				switch {
+				case componentType == "locality" && location.City == "":
+					location.City = component.LongName
+				case componentType == "administrative_area_level_1" && location.State == "":
+					location.State = component.ShortName
+				case componentType == "country" && location.Country == "":
+					location.Country = component.ShortName
+				case componentType == "postal_code" && location.PostalCode == "":
+					location.PostalCode = component.LongName
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// save saves a location, clearing the user's other defaults of the kinds it
+// is the default for
+func (s *SavedLocationService) save(location *models.SavedLocation) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		others := tx.Model(&models.SavedLocation{}).Where("user_id = ? AND id <> ?", location.UserID, location.ID)
+		if location.IsDefaultPickup {
+			if err := others.Session(&gorm.Session{}).Update("is_default_pickup", false).Error; err != nil {
+				return err
+			}
+		}
+		if location.IsDefaultDelivery {
+			if err := others.Session(&gorm.Session{}).Update("is_default_delivery", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(location).Error
+	})
+}
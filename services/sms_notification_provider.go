@@ -0,0 +1,153 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+)
+
+// SMSSender delivers a text message to a single phone number
+type SMSSender interface {
+	Send(to, body string) error
+}
+
+// SMSNotificationProvider implements the NotificationProvider interface for
+// SMS. Recipients are phone numbers in E.164 format instead of device tokens.
+type SMSNotificationProvider struct {
+	sender   SMSSender
+	renderer *SMSTemplateRenderer
+}
+
+// NewSMSNotificationProvider creates an SMS provider sending through Twilio
+func NewSMSNotificationProvider(cfg *config.SMSConfig) (*SMSNotificationProvider, error) {
+	if err := cfg.ValidateSMSConfig(); err != nil {
+		return nil, err
+	}
+	return NewSMSNotificationProviderWithSender(NewTwilioSMSSender(cfg), cfg.AppBaseURL)
+}
+
+// NewSMSNotificationProviderWithSender creates an SMS provider sending through sender
+func NewSMSNotificationProviderWithSender(sender SMSSender, appBaseURL string) (*SMSNotificationProvider, error) {
+	renderer, err := NewSMSTemplateRenderer(appBaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SMSNotificationProvider{
+		sender:   sender,
+		renderer: renderer,
+	}, nil
+}
+
+// Name returns the name of the provider
+func (p *SMSNotificationProvider) Name() string {
+	return "sms"
+}
+
+// Sender returns the sender used to deliver messages
+func (p *SMSNotificationProvider) Sender() SMSSender {
+	return p.sender
+}
+
+// SendNotification renders the notification and texts it to each phone number
+func (p *SMSNotificationProvider) SendNotification(recipients []string, notification *models.Notification) error {
+	if len(recipients) == 0 {
+		return fmt.Errorf("no recipients provided")
+	}
+
+	body, err := p.renderer.Render(notification)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, to := range recipients {
+		if err := p.sender.Send(to, body); err != nil {
+			log.Printf("Failed to text notification %d to %s: %v", notification.ID, to, err)
+			failed = append(failed, to)
+		}
+	}
+
+	if len(failed) == len(recipients) {
+		return fmt.Errorf("failed to send SMS to all %d recipients", len(recipients))
+	}
+	return nil
+}
+
+// BatchSendNotifications texts each notification in the batch
+func (p *SMSNotificationProvider) BatchSendNotifications(batches []NotificationBatch) error {
+	var errorCount int
+	for _, batch := range batches {
+		if err := p.SendNotification(batch.Tokens, batch.Notification); err != nil {
+			errorCount++
+		}
+	}
+
+	if errorCount > 0 {
+		return fmt.Errorf("failed to send %d of %d SMS batches", errorCount, len(batches))
+	}
+	return nil
+}
+
+// TwilioSMSSender sends text messages through the Twilio Messages API
+type TwilioSMSSender struct {
+	APIURL              string
+	AccountSID          string
+	AuthToken           string
+	HTTPClient          *http.Client
+	from                string
+	messagingServiceSID string
+}
+
+// NewTwilioSMSSender creates a new Twilio SMS sender
+func NewTwilioSMSSender(cfg *config.SMSConfig) *TwilioSMSSender {
+	return &TwilioSMSSender{
+		APIURL:     strings.TrimSuffix(cfg.TwilioAPIURL, "/"),
+		AccountSID: cfg.TwilioAccountSID,
+		AuthToken:  cfg.TwilioAuthToken,
+		HTTPClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		from:                cfg.TwilioFromNumber,
+		messagingServiceSID: cfg.TwilioMessagingServiceSID,
+	}
+}
+
+// Send sends a text message through Twilio
+func (s *TwilioSMSSender) Send(to, body string) error {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("Body", body)
+	if s.messagingServiceSID != "" {
+		form.Set("MessagingServiceSid", s.messagingServiceSID)
+	} else {
+		form.Set("From", s.from)
+	}
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", s.APIURL, url.PathEscape(s.AccountSID))
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(s.AccountSID, s.AuthToken)
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send Twilio request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var respBody bytes.Buffer
+		respBody.ReadFrom(resp.Body)
+		return fmt.Errorf("Twilio returned status %d: %s", resp.StatusCode, strings.TrimSpace(respBody.String()))
+	}
+	return nil
+}
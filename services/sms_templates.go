@@ -0,0 +1,97 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"triplink/backend/models"
+)
+
+// maxSMSLength is the longest message sent, two concatenated SMS segments
+const maxSMSLength = 306
+
+const delayAlertSMSTemplate = `TripLink delay alert: {{.Message}}{{if .ActionURL}} Track: {{.ActionURL}}{{end}}`
+
+const pickupReminderSMSTemplate = `TripLink pickup reminder: {{.Message}}{{if .ActionURL}} Details: {{.ActionURL}}{{end}}`
+
+const defaultSMSTemplate = `TripLink: {{.Title}}. {{.Message}}{{if .ActionURL}} {{.ActionURL}}{{end}}`
+
+// SMSTemplateData is the data available to SMS templates
+type SMSTemplateData struct {
+	Title     string
+	Message   string
+	ActionURL string
+}
+
+// SMSTemplateRenderer renders notifications into text messages
+type SMSTemplateRenderer struct {
+	appBaseURL string
+	templates  map[string]*template.Template
+}
+
+// NewSMSTemplateRenderer parses the built-in SMS templates
+func NewSMSTemplateRenderer(appBaseURL string) (*SMSTemplateRenderer, error) {
+	contents := map[string]string{
+		"delay":   delayAlertSMSTemplate,
+		"pickup":  pickupReminderSMSTemplate,
+		"default": defaultSMSTemplate,
+	}
+
+	r := &SMSTemplateRenderer{
+		appBaseURL: appBaseURL,
+		templates:  make(map[string]*template.Template),
+	}
+	for name, content := range contents {
+		tmpl, err := template.New(name).Parse(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s SMS template: %w", name, err)
+		}
+		r.templates[name] = tmpl
+	}
+
+	return r, nil
+}
+
+// smsTemplateName returns the template used for a notification type
+func smsTemplateName(notificationType string) string {
+	switch notificationType {
+	case "TRIP_DELAYED", "DELAY_ALERT":
+		return "delay"
+	case "PICKUP_REMINDER", "PICKUP_SCHEDULED":
+		return "pickup"
+	default:
+		return "default"
+	}
+}
+
+// Render renders a notification into a text message, shortening the
+// notification's message when the text would run over two segments
+func (r *SMSTemplateRenderer) Render(notification *models.Notification) (string, error) {
+	data := SMSTemplateData{
+		Title:     notification.Title,
+		Message:   notification.Message,
+		ActionURL: notificationActionURL(r.appBaseURL, notification),
+	}
+
+	tmpl := r.templates[smsTemplateName(notification.Type)]
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return "", fmt.Errorf("failed to render SMS: %w", err)
+	}
+
+	text := []rune(strings.TrimSpace(body.String()))
+	if over := len(text) - maxSMSLength; over > 0 {
+		message := []rune(data.Message)
+		if over+1 > len(message) {
+			return string(text[:maxSMSLength-1]) + "…", nil
+		}
+		data.Message = string(message[:len(message)-over-1]) + "…"
+		body.Reset()
+		if err := tmpl.Execute(&body, data); err != nil {
+			return "", fmt.Errorf("failed to render SMS: %w", err)
+		}
+		return strings.TrimSpace(body.String()), nil
+	}
+	return string(text), nil
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"triplink/backend/apierror"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// StatusMachine is the lifecycle of an entity with a status: the statuses it
+// can move to from each of its statuses, and the tracking event each change
+// is recorded with. Changes are applied optimistically, to the version of the
+// entity they were requested against, so of two concurrent changes only the
+// first applies and the other is rejected as a conflict.
+type StatusMachine struct {
+	Entity      string // name of the entity in rejections, e.g. "trip"
+	Table       string
+	EventType   string
+	Transitions map[string][]string // statuses without transitions are final
+}
+
+// TripStatusMachine is the lifecycle of trips
+var TripStatusMachine = &StatusMachine{
+	Entity:    "trip",
+	Table:     "trips",
+	EventType: "STATUS_CHANGE",
+	Transitions: map[string][]string{
+		"PLANNED":     {"ACTIVE", "CANCELLED"},
+		"ACTIVE":      {"IN_TRANSIT", "AT_PICKUP", "CANCELLED"},
+		"AT_PICKUP":   {"IN_TRANSIT", "ACTIVE"},
+		"IN_TRANSIT":  {"AT_DELIVERY", "DELAYED", "COMPLETED"},
+		"AT_DELIVERY": {"COMPLETED", "IN_TRANSIT"},
+		"DELAYED":     {"IN_TRANSIT", "AT_DELIVERY", "COMPLETED"},
+		"COMPLETED":   {},
+		"CANCELLED":   {},
+	},
+}
+
+// LoadStatusMachine is the lifecycle of loads once booked. Loads are quoted
+// and booked by the quote service, and leave EXCEPTION for the step they
+// were held up at.
+var LoadStatusMachine = &StatusMachine{
+	Entity:    "load",
+	Table:     "loads",
+	EventType: "LOAD_STATUS_CHANGE",
+	Transitions: map[string][]string{
+		"BOOKED":           {"PICKUP_SCHEDULED", "PICKED_UP", "EXCEPTION"},
+		"PICKUP_SCHEDULED": {"PICKED_UP", "EXCEPTION"},
+		"PICKED_UP":        {"IN_TRANSIT", "OUT_FOR_DELIVERY", "DELIVERED", "EXCEPTION"},
+		"IN_TRANSIT":       {"OUT_FOR_DELIVERY", "DELIVERED", "EXCEPTION"},
+		"OUT_FOR_DELIVERY": {"DELIVERED", "IN_TRANSIT", "EXCEPTION"},
+		"EXCEPTION":        {"PICKUP_SCHEDULED", "PICKED_UP", "IN_TRANSIT", "OUT_FOR_DELIVERY", "DELIVERED"},
+		"DELIVERED":        {},
+		"CANCELLED":        {},
+	},
+}
+
+// StatusTransitionError is a status change rejected by a status machine,
+// with the reason the client is told
+type StatusTransitionError struct {
+	Entity  string
+	ID      uint
+	From    string
+	To      string
+	Version uint     // current version of the entity
+	Allowed []string // statuses the entity can move to from From
+	Reason  string
+	// The entity was changed by another request since the version the
+	// change was requested against
+	Conflict bool
+}
+
+func (e *StatusTransitionError) Error() string {
+	return fmt.Sprintf("invalid status transition: %s", e.Reason)
+}
+
+// APIError converts the rejection to the API error it's responded with
+func (e *StatusTransitionError) APIError() *apierror.Error {
+	code := apierror.CodeInvalidStatusTransition
+	if e.Conflict {
+		code = apierror.CodeStatusConflict
+	}
+	return apierror.New(code, e.Reason).WithDetails(map[string]interface{}{
+		"entity":  e.Entity,
+		"id":      e.ID,
+		"from":    e.From,
+		"to":      e.To,
+		"version": e.Version,
+		"allowed": e.Allowed,
+	})
+}
+
+// Allows reports whether the machine allows moving from one status to another
+func (m *StatusMachine) Allows(from, to string) bool {
+	for _, allowed := range m.Transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns why moving an entity from one status to another isn't
+// allowed, or nil if it is
+func (m *StatusMachine) Check(id uint, from, to string, version uint) *StatusTransitionError {
+	allowed, known := m.Transitions[from]
+	rejection := &StatusTransitionError{Entity: m.Entity, ID: id, From: from, To: to, Version: version, Allowed: append([]string{}, allowed...)}
+	switch {
+	case !known:
+		rejection.Reason = fmt.Sprintf("The %s's status %s can't be changed here", m.Entity, from)
+	case from == to:
+		rejection.Reason = fmt.Sprintf("The %s is already %s", m.Entity, to)
+	case len(allowed) == 0:
+		rejection.Reason = fmt.Sprintf("The %s is %s, a final status", m.Entity, from)
+	case !m.Allows(from, to):
+		rejection.Reason = fmt.Sprintf("A %s can't go from %s to %s, only to %s", m.Entity, from, to, strings.Join(allowed, ", "))
+	default:
+		return nil
+	}
+	return rejection
+}
+
+// StatusChange is a change of an entity's status to apply with a status
+// machine
+type StatusChange struct {
+	ID      uint
+	From    string
+	To      string
+	Version uint // version of the entity the change was requested against
+	// Other columns set along with the status
+	Updates map[string]interface{}
+	// The trip and load the change's event is recorded for
+	TripID uint
+	LoadID *uint
+	At     time.Time
+}
+
+// Apply changes the status of an entity inside the transaction tx and
+// records its event. The change is rejected when the machine doesn't allow
+// it, and as a conflict when the entity is no longer at the status and
+// version it was requested against.
+func (m *StatusMachine) Apply(tx *gorm.DB, change StatusChange) error {
+	if rejection := m.Check(change.ID, change.From, change.To, change.Version); rejection != nil {
+		return rejection
+	}
+
+	updates := map[string]interface{}{
+		"status":     change.To,
+		"version":    gorm.Expr("version + 1"),
+		"updated_at": change.At,
+	}
+	for column, value := range change.Updates {
+		updates[column] = value
+	}
+	result := tx.Table(m.Table).
+		Where("id = ? AND status = ? AND version = ? AND deleted_at IS NULL", change.ID, change.From, change.Version).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update %s status: %w", m.Entity, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return m.conflict(tx, change)
+	}
+
+	event := &models.TrackingEvent{
+		TripID:      change.TripID,
+		LoadID:      change.LoadID,
+		EventType:   m.EventType,
+		EventData:   `{"from":"` + change.From + `","to":"` + change.To + `"}`,
+		Timestamp:   change.At,
+		Description: strings.ToUpper(m.Entity[:1]) + m.Entity[1:] + " status changed from " + change.From + " to " + change.To,
+	}
+	return RecordTrackingEvent(tx, event)
+}
+
+// conflict describes the change that was made to an entity since the
+// version a change was requested against
+func (m *StatusMachine) conflict(tx *gorm.DB, change StatusChange) error {
+	var current struct {
+		Status  string
+		Version uint
+	}
+	err := tx.Table(m.Table).Select("status", "version").
+		Where("id = ? AND deleted_at IS NULL", change.ID).
+		Take(&current).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%s not found", m.Entity)
+	} else if err != nil {
+		return err
+	}
+	return &StatusTransitionError{
+		Entity:   m.Entity,
+		ID:       change.ID,
+		From:     current.Status,
+		To:       change.To,
+		Version:  current.Version,
+		Allowed:  append([]string{}, m.Transitions[current.Status]...),
+		Reason:   fmt.Sprintf("The %s was changed by another request and is now %s at version %d, not %s at version %d", m.Entity, current.Status, current.Version, change.From, change.Version),
+		Conflict: true,
+	}
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Stop check-in actions
+const (
+	StopCheckInArrive = "ARRIVE"
+	StopCheckInDepart = "DEPART"
+)
+
+// loadStatusOrder ranks the load statuses check-ins advance loads through, so
+// that a check-in never moves a load back
+var loadStatusOrder = map[string]int{
+	"BOOKED":           1,
+	"PICKUP_SCHEDULED": 2,
+	"PICKED_UP":        3,
+	"IN_TRANSIT":       4,
+	"OUT_FOR_DELIVERY": 5,
+	"DELIVERED":        6,
+}
+
+// StopCheckInRequest is a driver's check-in at or check-out of a stop
+type StopCheckInRequest struct {
+	Action    string
+	Latitude  float64
+	Longitude float64
+	Accuracy  *float64 // meters
+	Notes     string
+	Photo     []byte
+}
+
+// StopCheckInResult is the recorded check-in, the stop it advanced and the
+// load status change it caused, if any
+type StopCheckInResult struct {
+	CheckIn            models.StopCheckIn `json:"check_in"`
+	Stop               models.TripStop    `json:"stop"`
+	LoadStatus         string             `json:"load_status,omitempty"`
+	PreviousLoadStatus string             `json:"previous_load_status,omitempty"`
+	LoadStatusChanged  bool               `json:"load_status_changed"`
+}
+
+// StopCheckInService records drivers checking in at and out of trip stops
+type StopCheckInService struct {
+	db           *gorm.DB
+	storage      FileStorage
+	tracking     *TrackingService
+	toleranceKm  float64
+	maxPhotoSize int64
+}
+
+// NewStopCheckInService creates a new stop check-in service
+func NewStopCheckInService(db *gorm.DB, storage FileStorage, cfg *config.DetentionConfig, maxPhotoSize int64) *StopCheckInService {
+	tracking := NewTrackingService(db)
+	tracking.SetDetentionConfig(cfg)
+	return &StopCheckInService{
+		db:           db,
+		storage:      storage,
+		tracking:     tracking,
+		toleranceKm:  cfg.CheckInToleranceKm,
+		maxPhotoSize: maxPhotoSize,
+	}
+}
+
+// CheckIn records the driver's arrival at (ARRIVE) or departure from (DEPART)
+// a stop. The reported position must be within the check-in tolerance of the
+// stop, widened by the reported accuracy up to double the tolerance.
+// Departing a pickup marks its load picked up and departing a delivery marks
+// it delivered.
+func (s *StopCheckInService) CheckIn(driverID, tripID, stopID uint, req StopCheckInRequest) (*StopCheckInResult, error) {
+	req.Action = strings.ToUpper(req.Action)
+	var stopStatus string
+	switch req.Action {
+	case StopCheckInArrive:
+		stopStatus = TripStopArrived
+	case StopCheckInDepart:
+		stopStatus = TripStopCompleted
+	default:
+		return nil, errors.New("action must be ARRIVE or DEPART")
+	}
+	if !isValidCoordinate(req.Latitude, req.Longitude) {
+		return nil, errors.New("invalid coordinates")
+	}
+
+	var stop models.TripStop
+	if err := s.db.Where("id = ? AND trip_id = ?", stopID, tripID).First(&stop).Error; err != nil {
+		return nil, errors.New("trip stop not found")
+	}
+
+	distance := geo.Distance(req.Latitude, req.Longitude, stop.Latitude, stop.Longitude)
+	tolerance := s.toleranceKm
+	if req.Accuracy != nil && *req.Accuracy > 0 {
+		tolerance += math.Min(*req.Accuracy/1000, s.toleranceKm)
+	}
+	if distance > tolerance {
+		return nil, fmt.Errorf("reported position is %.2f km from the stop, check in within %.2f km of it", distance, tolerance)
+	}
+
+	now := time.Now()
+	checkIn := models.StopCheckIn{
+		TripID:     tripID,
+		StopID:     stop.ID,
+		LoadID:     stop.LoadID,
+		DriverID:   driverID,
+		Action:     req.Action,
+		Latitude:   req.Latitude,
+		Longitude:  req.Longitude,
+		Accuracy:   req.Accuracy,
+		DistanceKm: roundHundredths(distance),
+		Notes:      strings.TrimSpace(req.Notes),
+		RecordedAt: now,
+	}
+
+	// The photo is stored before the stop changes so that a rejected photo
+	// leaves the stop as it was
+	if len(req.Photo) > 0 {
+		if err := s.storePhoto(&checkIn, req.Photo); err != nil {
+			return nil, err
+		}
+	}
+
+	updated, err := s.tracking.UpdateTripStopStatus(tripID, stop.ID, stopStatus)
+	if err != nil {
+		s.deletePhoto(&checkIn)
+		return nil, err
+	}
+
+	if err := s.db.Create(&checkIn).Error; err != nil {
+		return nil, fmt.Errorf("failed to save check-in: %w", err)
+	}
+
+	result := &StopCheckInResult{CheckIn: checkIn, Stop: *updated}
+	if req.Action == StopCheckInDepart && stop.LoadID != nil {
+		if err := s.advanceLoad(result, *stop.LoadID, stop.StopType, now); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// GetStopCheckIns returns the check-ins of a stop, oldest first
+func (s *StopCheckInService) GetStopCheckIns(tripID, stopID uint) ([]models.StopCheckIn, error) {
+	var checkIns []models.StopCheckIn
+	if err := s.db.Where("trip_id = ? AND stop_id = ?", tripID, stopID).
+		Order("recorded_at ASC").Find(&checkIns).Error; err != nil {
+		return nil, fmt.Errorf("failed to get check-ins: %w", err)
+	}
+	return checkIns, nil
+}
+
+// storePhoto validates and stores the photo of a check-in
+func (s *StopCheckInService) storePhoto(checkIn *models.StopCheckIn, photo []byte) error {
+	if s.maxPhotoSize > 0 && int64(len(photo)) > s.maxPhotoSize {
+		return fmt.Errorf("photo exceeds maximum size of %d bytes", s.maxPhotoSize)
+	}
+	contentType := http.DetectContentType(photo)
+	extension, allowed := proofContentTypes[contentType]
+	if !allowed {
+		return fmt.Errorf("unsupported photo type %s", contentType)
+	}
+
+	key := fmt.Sprintf("trips/%d/stops/%d/%s-%d%s", checkIn.TripID, checkIn.StopID,
+		strings.ToLower(checkIn.Action), checkIn.RecordedAt.UnixNano(), extension)
+	url, err := s.storage.Put(key, contentType, photo)
+	if err != nil {
+		return fmt.Errorf("failed to store photo: %w", err)
+	}
+	checkIn.PhotoURL = url
+	checkIn.PhotoKey = key
+	return nil
+}
+
+// deletePhoto removes the stored photo of a check-in that wasn't recorded
+func (s *StopCheckInService) deletePhoto(checkIn *models.StopCheckIn) {
+	if checkIn.PhotoKey == "" {
+		return
+	}
+	if err := s.storage.Delete(checkIn.PhotoKey); err != nil {
+		log.Printf("Failed to delete photo %s: %v", checkIn.PhotoKey, err)
+	}
+}
+
+// advanceLoad marks the load of a departed pickup picked up, or of a
+// departed delivery delivered, stamping the actual pickup or delivery date
+func (s *StopCheckInService) advanceLoad(result *StopCheckInResult, loadID uint, stopType string, at time.Time) error {
+	var load models.Load
+	if err := s.db.First(&load, loadID).Error; err != nil {
+		return errors.New("load not found")
+	}
+	result.LoadStatus = load.Status
+	result.PreviousLoadStatus = load.Status
+
+	updates := map[string]interface{}{}
+	var status string
+	switch stopType {
+	case TripStopPickup:
+		status = "PICKED_UP"
+		if load.ActualPickupDate == nil {
+			updates["actual_pickup_date"] = at
+		}
+	case TripStopDelivery:
+		status = "DELIVERED"
+		if load.ActualDeliveryDate == nil {
+			updates["actual_delivery_date"] = at
+		}
+	default:
+		return nil
+	}
+	// Cancelled loads and loads further along are left as they are
+	current, known := loadStatusOrder[load.Status]
+	if known && current < loadStatusOrder[status] {
+		updates["status"] = status
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&load).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update load: %w", err)
+		}
+		if _, changed := updates["status"]; !changed {
+			return nil
+		}
+
+		result.LoadStatus = status
+		result.LoadStatusChanged = true
+		event := models.TrackingEvent{
+			TripID:      load.TripID,
+			LoadID:      &load.ID,
+			EventType:   "LOAD_STATUS_CHANGE",
+			EventData:   fmt.Sprintf(`{"from":"%s","to":"%s","check_in_id":%d}`, result.PreviousLoadStatus, status, result.CheckIn.ID),
+			Latitude:    &result.CheckIn.Latitude,
+			Longitude:   &result.CheckIn.Longitude,
+			Timestamp:   at,
+			Description: fmt.Sprintf("Load status changed from %s to %s at driver check-out", result.PreviousLoadStatus, status),
+		}
+		if err := tx.Create(&event).Error; err != nil {
+			return fmt.Errorf("failed to create tracking event: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"fmt"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+)
+
+// SetDetentionConfig replaces the geofence radius, free time and detention
+// rate used for the trip's stops
+func (ts *TrackingService) SetDetentionConfig(cfg *config.DetentionConfig) {
+	ts.detention = cfg
+}
+
+// recordStopDwell sets the dwell and detention times of a pickup or delivery
+// stop the vehicle has departed from. Vehicles arriving before the planned
+// arrival aren't detained until then, so the free time starts at the later
+// of the two.
+func (ts *TrackingService) recordStopDwell(stop *models.TripStop) {
+	if stop.StopType != TripStopPickup && stop.StopType != TripStopDelivery {
+		return
+	}
+	if stop.ActualArrival == nil || stop.ActualDeparture == nil {
+		return
+	}
+
+	stop.DwellMinutes = int(stop.ActualDeparture.Sub(*stop.ActualArrival).Minutes())
+	stop.DetentionMinutes = 0
+	stop.DetentionCharge = 0
+
+	clockStart := *stop.ActualArrival
+	if stop.PlannedArrival != nil && stop.PlannedArrival.After(clockStart) {
+		clockStart = *stop.PlannedArrival
+	}
+	detention := stop.ActualDeparture.Sub(clockStart) - ts.detention.FreeTime
+	if detention < time.Minute {
+		return
+	}
+	stop.DetentionMinutes = int(detention.Minutes())
+	if ts.detention.AutoCharge {
+		stop.DetentionCharge = roundHundredths(float64(stop.DetentionMinutes) / 60 * ts.detention.HourlyRate)
+	}
+}
+
+// logDetentionEvent records a DETENTION tracking event for a stop the
+// vehicle was detained at
+func (ts *TrackingService) logDetentionEvent(stop *models.TripStop, at time.Time) {
+	if stop.Status != TripStopCompleted || stop.DetentionMinutes <= 0 {
+		return
+	}
+
+	ts.db.Create(&models.TrackingEvent{
+		TripID:    stop.TripID,
+		LoadID:    stop.LoadID,
+		EventType: "DETENTION",
+		EventData: fmt.Sprintf(`{"stop_id":%d,"stop_type":"%s","dwell_minutes":%d,"detention_minutes":%d,"detention_charge":%.2f}`,
+			stop.ID, stop.StopType, stop.DwellMinutes, stop.DetentionMinutes, stop.DetentionCharge),
+		Location:    tripStopLocation(stop),
+		Latitude:    &stop.Latitude,
+		Longitude:   &stop.Longitude,
+		Timestamp:   at,
+		Description: fmt.Sprintf("Detained %s at stop %d: %s", formatMinutes(stop.DetentionMinutes), stop.Sequence, tripStopLocation(stop)),
+	})
+}
+
+// formatMinutes formats a number of minutes as hours and minutes, e.g. 1h 30m
+func formatMinutes(minutes int) string {
+	if minutes < 60 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	if minutes%60 == 0 {
+		return fmt.Sprintf("%dh", minutes/60)
+	}
+	return fmt.Sprintf("%dh %dm", minutes/60, minutes%60)
+}
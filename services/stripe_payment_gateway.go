@@ -0,0 +1,266 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stripeSignatureTolerance is how old a webhook signature timestamp may be
+const stripeSignatureTolerance = 5 * time.Minute
+
+// StripePaymentGateway implements the PaymentGateway interface using Stripe PaymentIntents
+type StripePaymentGateway struct {
+	APIKey        string
+	WebhookSecret string
+	BaseURL       string
+	HTTPClient    *http.Client
+}
+
+// NewStripePaymentGateway creates a new Stripe payment gateway
+func NewStripePaymentGateway(apiKey, webhookSecret string) *StripePaymentGateway {
+	return &StripePaymentGateway{
+		APIKey:        apiKey,
+		WebhookSecret: webhookSecret,
+		BaseURL:       "https://api.stripe.com/v1",
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// stripePaymentIntent is the subset of a Stripe PaymentIntent used here
+type stripePaymentIntent struct {
+	ID               string `json:"id"`
+	Status           string `json:"status"`
+	ClientSecret     string `json:"client_secret"`
+	LastPaymentError *struct {
+		Message string `json:"message"`
+	} `json:"last_payment_error"`
+}
+
+// stripeError is the error body returned by the Stripe API
+type stripeError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+// Name returns the gateway name stored on transactions
+func (g *StripePaymentGateway) Name() string {
+	return "STRIPE"
+}
+
+// CreateCharge creates and confirms a PaymentIntent
+func (g *StripePaymentGateway) CreateCharge(request ChargeRequest) (*ChargeResult, error) {
+	params := url.Values{}
+	params.Set("amount", strconv.FormatInt(toMinorUnits(request.Amount), 10))
+	params.Set("currency", strings.ToLower(request.Currency))
+	params.Set("description", request.Description)
+	if request.PaymentMethodID != "" {
+		params.Set("payment_method", request.PaymentMethodID)
+		params.Set("confirm", "true")
+	}
+	for key, value := range request.Metadata {
+		params.Set(fmt.Sprintf("metadata[%s]", key), value)
+	}
+
+	var intent stripePaymentIntent
+	if err := g.post("/payment_intents", params, request.IdempotencyKey, &intent); err != nil {
+		return nil, err
+	}
+
+	result := &ChargeResult{
+		GatewayTxnID: intent.ID,
+		Status:       stripeIntentStatus(intent.Status),
+		ClientSecret: intent.ClientSecret,
+	}
+	if intent.LastPaymentError != nil {
+		result.FailureReason = intent.LastPaymentError.Message
+	}
+	return result, nil
+}
+
+// Refund refunds all or part of a PaymentIntent
+func (g *StripePaymentGateway) Refund(gatewayTxnID string, amount float64) (*RefundResult, error) {
+	params := url.Values{}
+	params.Set("payment_intent", gatewayTxnID)
+	if amount > 0 {
+		params.Set("amount", strconv.FormatInt(toMinorUnits(amount), 10))
+	}
+
+	var refund struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+		Amount int64  `json:"amount"`
+	}
+	if err := g.post("/refunds", params, "", &refund); err != nil {
+		return nil, err
+	}
+
+	if refund.Status == "failed" || refund.Status == "canceled" {
+		return nil, fmt.Errorf("refund %s %s", refund.ID, refund.Status)
+	}
+
+	return &RefundResult{
+		GatewayRefundID: refund.ID,
+		Amount:          float64(refund.Amount) / 100,
+	}, nil
+}
+
+// ParseWebhook verifies the Stripe-Signature header and converts the event
+func (g *StripePaymentGateway) ParseWebhook(payload []byte, signature string) (*PaymentWebhookEvent, error) {
+	if err := verifyStripeSignature(payload, signature, g.WebhookSecret, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ID               string `json:"id"`
+				PaymentIntent    string `json:"payment_intent"`
+				AmountRefunded   int64  `json:"amount_refunded"`
+				LastPaymentError *struct {
+					Message string `json:"message"`
+				} `json:"last_payment_error"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook payload: %w", err)
+	}
+
+	object := event.Data.Object
+	result := &PaymentWebhookEvent{Type: event.Type, GatewayTxnID: object.ID}
+
+	switch event.Type {
+	case "payment_intent.succeeded":
+		result.Status = "COMPLETED"
+	case "payment_intent.payment_failed", "payment_intent.canceled":
+		result.Status = "FAILED"
+		if object.LastPaymentError != nil {
+			result.FailureReason = object.LastPaymentError.Message
+		}
+	case "charge.refunded":
+		result.Status = "REFUNDED"
+		result.GatewayTxnID = object.PaymentIntent
+		result.RefundedAmount = float64(object.AmountRefunded) / 100
+	default:
+		// Events we don't act on are acknowledged without a status change
+	}
+
+	return result, nil
+}
+
+// post sends a form encoded POST request to the Stripe API and decodes the response
+func (g *StripePaymentGateway) post(path string, params url.Values, idempotencyKey string, out interface{}) error {
+	req, err := http.NewRequest("POST", g.BaseURL+path, strings.NewReader(params.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+g.APIKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := g.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call Stripe: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var stripeErr stripeError
+		if json.Unmarshal(body, &stripeErr) == nil && stripeErr.Error.Message != "" {
+			return fmt.Errorf("stripe error: %s", stripeErr.Error.Message)
+		}
+		return fmt.Errorf("stripe returned status %d", resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// stripeIntentStatus maps a PaymentIntent status to a transaction status
+func stripeIntentStatus(status string) string {
+	switch status {
+	case "succeeded":
+		return "COMPLETED"
+	case "canceled", "requires_payment_method":
+		return "FAILED"
+	default:
+		// processing, requires_action, requires_confirmation, requires_capture
+		return "PENDING"
+	}
+}
+
+// verifyStripeSignature checks a Stripe-Signature header of the form t=...,v1=...
+func verifyStripeSignature(payload []byte, header, secret string, now time.Time) error {
+	if secret == "" {
+		return errors.New("webhook secret not configured")
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return errors.New("invalid signature header")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid signature timestamp")
+	}
+	if now.Sub(time.Unix(ts, 0)) > stripeSignatureTolerance {
+		return errors.New("signature timestamp outside tolerance")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return errors.New("signature mismatch")
+}
+
+// toMinorUnits converts an amount to cents
+func toMinorUnits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"triplink/backend/models"
+)
+
+// geotabFeedLimit is the most log records read per poll, the rest is read by
+// the next poll
+const geotabFeedLimit = 5000
+
+// GeotabProvider reads vehicle GPS positions from the MyGeotab API's
+// LogRecord data feed
+type GeotabProvider struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewGeotabProvider creates a new Geotab client
+func NewGeotabProvider(baseURL string, client *http.Client) *GeotabProvider {
+	return &GeotabProvider{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: client,
+	}
+}
+
+// geotabSession is an authenticated MyGeotab session on the server hosting
+// the database
+type geotabSession struct {
+	baseURL     string
+	credentials json.RawMessage
+}
+
+// Poll reads the log records since the connection's cursor, the feed
+// version, and the devices they were recorded by
+func (gp *GeotabProvider) Poll(conn *models.TelematicsConnection) ([]TelematicsPosition, string, error) {
+	session, err := gp.authenticate(conn)
+	if err != nil {
+		return nil, "", err
+	}
+
+	feedParams := map[string]interface{}{
+		"typeName":     "LogRecord",
+		"resultsLimit": geotabFeedLimit,
+		"credentials":  session.credentials,
+	}
+	if conn.Cursor != "" {
+		feedParams["fromVersion"] = conn.Cursor
+	}
+	var feed struct {
+		Data []struct {
+			DateTime  time.Time `json:"dateTime"`
+			Latitude  float64   `json:"latitude"`
+			Longitude float64   `json:"longitude"`
+			Speed     *float64  `json:"speed"`
+			Device    struct {
+				ID string `json:"id"`
+			} `json:"device"`
+		} `json:"data"`
+		ToVersion string `json:"toVersion"`
+	}
+	if err := gp.call(session.baseURL, "GetFeed", feedParams, &feed); err != nil {
+		return nil, "", err
+	}
+	if len(feed.Data) == 0 {
+		return nil, feed.ToVersion, nil
+	}
+
+	var devices []struct {
+		ID           string `json:"id"`
+		Name         string `json:"name"`
+		LicensePlate string `json:"licensePlate"`
+		VIN          string `json:"vehicleIdentificationNumber"`
+	}
+	if err := gp.call(session.baseURL, "Get", map[string]interface{}{
+		"typeName":    "Device",
+		"credentials": session.credentials,
+	}, &devices); err != nil {
+		return nil, "", err
+	}
+	byID := make(map[string]int, len(devices))
+	for i, device := range devices {
+		byID[device.ID] = i
+	}
+
+	positions := make([]TelematicsPosition, 0, len(feed.Data))
+	for _, record := range feed.Data {
+		position := TelematicsPosition{
+			VehicleID: record.Device.ID,
+			Latitude:  record.Latitude,
+			Longitude: record.Longitude,
+			Speed:     record.Speed,
+			Timestamp: record.DateTime,
+		}
+		if i, ok := byID[record.Device.ID]; ok {
+			position.VehicleName = devices[i].Name
+			position.LicensePlate = devices[i].LicensePlate
+			position.VIN = devices[i].VIN
+		}
+		positions = append(positions, position)
+	}
+	return positions, feed.ToVersion, nil
+}
+
+// authenticate signs in to the connection's database, following the
+// redirect to the server hosting it
+func (gp *GeotabProvider) authenticate(conn *models.TelematicsConnection) (*geotabSession, error) {
+	var result struct {
+		Credentials json.RawMessage `json:"credentials"`
+		Path        string          `json:"path"`
+	}
+	if err := gp.call(gp.BaseURL, "Authenticate", map[string]interface{}{
+		"database": conn.AccountID,
+		"userName": conn.Username,
+		"password": conn.Secret,
+	}, &result); err != nil {
+		return nil, err
+	}
+
+	session := &geotabSession{baseURL: gp.BaseURL, credentials: result.Credentials}
+	if result.Path != "" && result.Path != "ThisServer" {
+		session.baseURL = "https://" + strings.TrimRight(result.Path, "/")
+	}
+	return session, nil
+}
+
+// call makes a JSON-RPC call to the MyGeotab API
+func (gp *GeotabProvider) call(baseURL, method string, params interface{}, out interface{}) error {
+	payload, err := json.Marshal(map[string]interface{}{"method": method, "params": params})
+	if err != nil {
+		return fmt.Errorf("failed to encode Geotab request: %w", err)
+	}
+
+	resp, err := gp.HTTPClient.Post(baseURL+"/apiv1", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to call Geotab: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Geotab response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Geotab returned status %d", resp.StatusCode)
+	}
+
+	var rpc struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &rpc); err != nil {
+		return fmt.Errorf("failed to parse Geotab response: %w", err)
+	}
+	if rpc.Error != nil {
+		return fmt.Errorf("Geotab %s failed: %s", method, rpc.Error.Message)
+	}
+	if err := json.Unmarshal(rpc.Result, out); err != nil {
+		return fmt.Errorf("failed to parse Geotab %s result: %w", method, err)
+	}
+	return nil
+}
+
+// ParseWebhook rejects webhook calls, since Geotab positions are polled
+func (gp *GeotabProvider) ParseWebhook(conn *models.TelematicsConnection, headers map[string]string, body []byte) ([]TelematicsPosition, error) {
+	return nil, errors.New("Geotab positions are polled, not pushed")
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"triplink/backend/models"
+)
+
+// samsaraMaxPages bounds the feed pages read per poll, the rest is read by
+// the next poll
+const samsaraMaxPages = 20
+
+// mphToKmh converts Samsara's speeds to km/h
+const mphToKmh = 1.609344
+
+// SamsaraProvider reads vehicle GPS positions from the Samsara API's vehicle
+// stats feed
+type SamsaraProvider struct {
+	BaseURL          string
+	HTTPClient       *http.Client
+	WebhookTolerance time.Duration
+}
+
+// NewSamsaraProvider creates a new Samsara client
+func NewSamsaraProvider(baseURL string, client *http.Client, webhookTolerance time.Duration) *SamsaraProvider {
+	return &SamsaraProvider{
+		BaseURL:          strings.TrimRight(baseURL, "/"),
+		HTTPClient:       client,
+		WebhookTolerance: webhookTolerance,
+	}
+}
+
+// samsaraVehicleStats is a vehicle's entry in the stats feed
+type samsaraVehicleStats struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	ExternalIDs map[string]string `json:"externalIds"`
+	GPS         []struct {
+		Time              time.Time `json:"time"`
+		Latitude          float64   `json:"latitude"`
+		Longitude         float64   `json:"longitude"`
+		HeadingDegrees    *float64  `json:"headingDegrees"`
+		SpeedMilesPerHour *float64  `json:"speedMilesPerHour"`
+	} `json:"gps"`
+}
+
+// samsaraPagination is the pagination of Samsara list responses
+type samsaraPagination struct {
+	EndCursor   string `json:"endCursor"`
+	HasNextPage bool   `json:"hasNextPage"`
+}
+
+// Poll reads the GPS stats feed from the connection's cursor. The first poll
+// starts from the vehicles' latest positions.
+func (sp *SamsaraProvider) Poll(conn *models.TelematicsConnection) ([]TelematicsPosition, string, error) {
+	var stats []samsaraVehicleStats
+	cursor := conn.Cursor
+	for page := 0; page < samsaraMaxPages; page++ {
+		query := url.Values{"types": {"gps"}}
+		if cursor != "" {
+			query.Set("after", cursor)
+		}
+
+		var resp struct {
+			Data       []samsaraVehicleStats `json:"data"`
+			Pagination samsaraPagination     `json:"pagination"`
+		}
+		if err := sp.get(conn, "/fleet/vehicles/stats/feed?"+query.Encode(), &resp); err != nil {
+			return nil, "", err
+		}
+		stats = append(stats, resp.Data...)
+		if resp.Pagination.EndCursor != "" {
+			cursor = resp.Pagination.EndCursor
+		}
+		if !resp.Pagination.HasNextPage {
+			break
+		}
+	}
+
+	positions := samsaraPositions(stats)
+	if len(positions) == 0 {
+		return nil, cursor, nil
+	}
+
+	// The feed doesn't carry license plates, so they are read separately
+	plates, err := sp.licensePlates(conn)
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range positions {
+		positions[i].LicensePlate = plates[positions[i].VehicleID]
+	}
+	return positions, cursor, nil
+}
+
+// licensePlates returns the license plates of the account's vehicles by ID
+func (sp *SamsaraProvider) licensePlates(conn *models.TelematicsConnection) (map[string]string, error) {
+	plates := make(map[string]string)
+	cursor := ""
+	for page := 0; page < samsaraMaxPages; page++ {
+		path := "/fleet/vehicles"
+		if cursor != "" {
+			path += "?after=" + url.QueryEscape(cursor)
+		}
+
+		var resp struct {
+			Data []struct {
+				ID           string `json:"id"`
+				LicensePlate string `json:"licensePlate"`
+			} `json:"data"`
+			Pagination samsaraPagination `json:"pagination"`
+		}
+		if err := sp.get(conn, path, &resp); err != nil {
+			return nil, err
+		}
+		for _, vehicle := range resp.Data {
+			plates[vehicle.ID] = vehicle.LicensePlate
+		}
+		if !resp.Pagination.HasNextPage {
+			break
+		}
+		cursor = resp.Pagination.EndCursor
+	}
+	return plates, nil
+}
+
+// get calls the Samsara API with the connection's token
+func (sp *SamsaraProvider) get(conn *models.TelematicsConnection, path string, out interface{}) error {
+	req, err := http.NewRequest("GET", sp.BaseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create Samsara request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+conn.Secret)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := sp.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call Samsara: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Samsara response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Samsara returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse Samsara response: %w", err)
+	}
+	return nil
+}
+
+// ParseWebhook verifies a Samsara webhook signature and reads the vehicle
+// entries it carries, in the same shape as the stats feed. Samsara signs
+// "v1:<timestamp>:<body>" with the base64 webhook secret, in the
+// X-Samsara-Signature header as v1=<hex>.
+func (sp *SamsaraProvider) ParseWebhook(conn *models.TelematicsConnection, headers map[string]string, body []byte) ([]TelematicsPosition, error) {
+	if conn.WebhookSecret == "" {
+		return nil, errors.New("webhooks aren't set up for this connection")
+	}
+	secret, err := base64.StdEncoding.DecodeString(conn.WebhookSecret)
+	if err != nil {
+		return nil, errors.New("invalid webhook secret")
+	}
+
+	timestamp := headers["X-Samsara-Timestamp"]
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid webhook signature")
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > sp.WebhookTolerance || age < -sp.WebhookTolerance {
+		return nil, errors.New("webhook signature expired")
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("v1:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v1=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(headers["X-Samsara-Signature"])) {
+		return nil, errors.New("invalid webhook signature")
+	}
+
+	var payload struct {
+		Data []samsaraVehicleStats `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.New("invalid webhook payload")
+	}
+	return samsaraPositions(payload.Data), nil
+}
+
+// samsaraPositions flattens the GPS stats of vehicles into positions
+func samsaraPositions(stats []samsaraVehicleStats) []TelematicsPosition {
+	var positions []TelematicsPosition
+	for _, vehicle := range stats {
+		for _, gps := range vehicle.GPS {
+			position := TelematicsPosition{
+				VehicleID:   vehicle.ID,
+				VehicleName: vehicle.Name,
+				VIN:         vehicle.ExternalIDs["samsara.vin"],
+				Latitude:    gps.Latitude,
+				Longitude:   gps.Longitude,
+				Heading:     gps.HeadingDegrees,
+				Timestamp:   gps.Time,
+			}
+			if gps.SpeedMilesPerHour != nil {
+				speed := *gps.SpeedMilesPerHour * mphToKmh
+				position.Speed = &speed
+			}
+			positions = append(positions, position)
+		}
+	}
+	return positions
+}
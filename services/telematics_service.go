@@ -0,0 +1,437 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Telematics providers
+const (
+	TelematicsSamsara = "SAMSARA"
+	TelematicsGeotab  = "GEOTAB"
+)
+
+// TelematicsPosition is a vehicle position reported by a telematics provider
+type TelematicsPosition struct {
+	VehicleID    string // provider's ID of the vehicle
+	VehicleName  string
+	LicensePlate string
+	VIN          string
+	Latitude     float64
+	Longitude    float64
+	Altitude     *float64
+	Speed        *float64 // km/h
+	Heading      *float64
+	Accuracy     *float64
+	Timestamp    time.Time
+}
+
+// TelematicsProvider reads vehicle positions from a telematics provider's API
+type TelematicsProvider interface {
+	// Poll returns the positions reported since the connection's cursor, and
+	// the cursor to poll from next
+	Poll(conn *models.TelematicsConnection) ([]TelematicsPosition, string, error)
+
+	// ParseWebhook verifies the signature of a webhook call and returns the
+	// positions it carries
+	ParseWebhook(conn *models.TelematicsConnection, headers map[string]string, body []byte) ([]TelematicsPosition, error)
+}
+
+// TelematicsConnectionRequest describes a carrier's account at a provider
+type TelematicsConnectionRequest struct {
+	Provider      string `json:"provider"` // SAMSARA, GEOTAB
+	Name          string `json:"name"`
+	AccountID     string `json:"account_id"` // Geotab database
+	Username      string `json:"username"`   // Geotab user
+	Secret        string `json:"secret"`     // Samsara API token or Geotab password
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+// TelematicsDeviceRequest registers a device or gateway streaming positions
+// over gRPC
+type TelematicsDeviceRequest struct {
+	Name       string `json:"name"`
+	CommonName string `json:"common_name"` // of the device's client certificate
+}
+
+// TelematicsIngestResult summarizes the positions ingested from a provider
+type TelematicsIngestResult struct {
+	Positions         int      `json:"positions"`
+	Ingested          int      `json:"ingested"`
+	Trips             []uint   `json:"trips"`
+	UnmatchedVehicles []string `json:"unmatched_vehicles"` // no vehicle with the plate or VIN
+	IdleVehicles      []string `json:"idle_vehicles"`      // matched vehicles without an active trip
+	Errors            []string `json:"errors"`
+}
+
+// TelematicsService ingests vehicle positions from telematics providers into
+// the active trips of the carriers' vehicles, so carriers don't need the
+// mobile app to be tracked
+type TelematicsService struct {
+	db        *gorm.DB
+	tracking  *TrackingService
+	providers map[string]TelematicsProvider
+}
+
+// NewTelematicsService creates a new telematics service
+func NewTelematicsService(db *gorm.DB, cfg *config.TelematicsConfig) *TelematicsService {
+	client := &http.Client{Timeout: cfg.HTTPTimeout}
+	return &TelematicsService{
+		db:       db,
+		tracking: NewTrackingService(db),
+		providers: map[string]TelematicsProvider{
+			TelematicsSamsara: NewSamsaraProvider(cfg.SamsaraBaseURL, client, cfg.WebhookTolerance),
+			TelematicsGeotab:  NewGeotabProvider(cfg.GeotabBaseURL, client),
+		},
+	}
+}
+
+// SetProvider replaces the client of a provider
+func (tms *TelematicsService) SetProvider(name string, provider TelematicsProvider) {
+	tms.providers[name] = provider
+}
+
+// CreateConnection connects a carrier's account at a provider
+func (tms *TelematicsService) CreateConnection(userID uint, req TelematicsConnectionRequest) (*models.TelematicsConnection, error) {
+	provider := strings.ToUpper(strings.TrimSpace(req.Provider))
+	if _, ok := tms.providers[provider]; !ok {
+		return nil, fmt.Errorf("unknown provider %s", req.Provider)
+	}
+	if req.Secret == "" {
+		return nil, errors.New("secret is required")
+	}
+	if provider == TelematicsGeotab && (req.AccountID == "" || req.Username == "") {
+		return nil, errors.New("account_id and username are required for Geotab")
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = provider
+	}
+	conn := models.TelematicsConnection{
+		UserID:        userID,
+		Provider:      provider,
+		Name:          name,
+		AccountID:     req.AccountID,
+		Username:      req.Username,
+		Secret:        req.Secret,
+		WebhookSecret: req.WebhookSecret,
+		IsActive:      true,
+	}
+	if err := tms.db.Create(&conn).Error; err != nil {
+		return nil, fmt.Errorf("failed to create telematics connection: %w", err)
+	}
+	return &conn, nil
+}
+
+// GetConnections returns a carrier's connections
+func (tms *TelematicsService) GetConnections(userID uint) ([]models.TelematicsConnection, error) {
+	var connections []models.TelematicsConnection
+	if err := tms.db.Where("user_id = ?", userID).Order("id").Find(&connections).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch telematics connections: %w", err)
+	}
+	return connections, nil
+}
+
+// getConnection returns a carrier's connection
+func (tms *TelematicsService) getConnection(userID, connectionID uint) (*models.TelematicsConnection, error) {
+	var conn models.TelematicsConnection
+	if err := tms.db.First(&conn, connectionID).Error; err != nil || conn.UserID != userID {
+		return nil, errors.New("telematics connection not found")
+	}
+	return &conn, nil
+}
+
+// DeleteConnection disconnects a carrier's account
+func (tms *TelematicsService) DeleteConnection(userID, connectionID uint) error {
+	conn, err := tms.getConnection(userID, connectionID)
+	if err != nil {
+		return err
+	}
+	if err := tms.db.Delete(conn).Error; err != nil {
+		return fmt.Errorf("failed to delete telematics connection: %w", err)
+	}
+	return nil
+}
+
+// PollConnection polls a carrier's connection right away
+func (tms *TelematicsService) PollConnection(userID, connectionID uint) (*TelematicsIngestResult, error) {
+	conn, err := tms.getConnection(userID, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	return tms.poll(conn)
+}
+
+// PollAll polls every active connection, recording the errors of each on
+// the connection so one failing account doesn't hold up the others
+func (tms *TelematicsService) PollAll() error {
+	var connections []models.TelematicsConnection
+	if err := tms.db.Where("is_active = ?", true).Find(&connections).Error; err != nil {
+		return fmt.Errorf("failed to fetch telematics connections: %w", err)
+	}
+
+	failed := 0
+	for i := range connections {
+		if _, err := tms.poll(&connections[i]); err != nil {
+			failed++
+			log.Printf("Failed to poll telematics connection %d: %v", connections[i].ID, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to poll %d of %d telematics connections", failed, len(connections))
+	}
+	return nil
+}
+
+// poll reads the new positions of a connection and ingests them. The cursor
+// only moves forward once the positions are ingested.
+func (tms *TelematicsService) poll(conn *models.TelematicsConnection) (*TelematicsIngestResult, error) {
+	provider, ok := tms.providers[conn.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %s", conn.Provider)
+	}
+
+	now := time.Now()
+	positions, cursor, err := provider.Poll(conn)
+	if err != nil {
+		tms.db.Model(conn).Updates(map[string]interface{}{"last_polled_at": now, "last_error": err.Error()})
+		return nil, err
+	}
+
+	result := tms.Ingest(conn, positions)
+	tms.db.Model(conn).Updates(map[string]interface{}{"cursor": cursor, "last_polled_at": now, "last_error": ""})
+	return result, nil
+}
+
+// HandleWebhook ingests the positions pushed to a connection's webhook
+func (tms *TelematicsService) HandleWebhook(connectionID uint, headers map[string]string, body []byte) (*TelematicsIngestResult, error) {
+	var conn models.TelematicsConnection
+	if err := tms.db.First(&conn, connectionID).Error; err != nil || !conn.IsActive {
+		return nil, errors.New("telematics connection not found")
+	}
+	provider, ok := tms.providers[conn.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %s", conn.Provider)
+	}
+
+	positions, err := provider.ParseWebhook(&conn, headers, body)
+	if err != nil {
+		return nil, err
+	}
+	return tms.Ingest(&conn, positions), nil
+}
+
+// CreateDevice registers a carrier's device or gateway streaming positions
+func (tms *TelematicsService) CreateDevice(userID uint, req TelematicsDeviceRequest) (*models.TelematicsDevice, error) {
+	commonName := strings.TrimSpace(req.CommonName)
+	if commonName == "" {
+		return nil, errors.New("common_name is required")
+	}
+	var existing int64
+	tms.db.Model(&models.TelematicsDevice{}).Where("common_name = ?", commonName).Count(&existing)
+	if existing > 0 {
+		return nil, errors.New("common_name is already registered")
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = commonName
+	}
+	device := models.TelematicsDevice{
+		UserID:     userID,
+		Name:       name,
+		CommonName: commonName,
+		IsActive:   true,
+	}
+	if err := tms.db.Create(&device).Error; err != nil {
+		return nil, fmt.Errorf("failed to create telematics device: %w", err)
+	}
+	return &device, nil
+}
+
+// GetDevices returns a carrier's devices
+func (tms *TelematicsService) GetDevices(userID uint) ([]models.TelematicsDevice, error) {
+	var devices []models.TelematicsDevice
+	if err := tms.db.Where("user_id = ?", userID).Order("id").Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch telematics devices: %w", err)
+	}
+	return devices, nil
+}
+
+// DeleteDevice revokes a carrier's device. Its certificate is rejected from
+// then on, even while still valid.
+func (tms *TelematicsService) DeleteDevice(userID, deviceID uint) error {
+	var device models.TelematicsDevice
+	if err := tms.db.First(&device, deviceID).Error; err != nil || device.UserID != userID {
+		return errors.New("telematics device not found")
+	}
+	if err := tms.db.Delete(&device).Error; err != nil {
+		return fmt.Errorf("failed to delete telematics device: %w", err)
+	}
+	return nil
+}
+
+// AuthenticateDevice returns the active device registered with the common
+// name of a verified client certificate
+func (tms *TelematicsService) AuthenticateDevice(commonName string) (*models.TelematicsDevice, error) {
+	var device models.TelematicsDevice
+	if commonName == "" {
+		return nil, errors.New("telematics device not found")
+	}
+	if err := tms.db.Where("common_name = ? AND is_active = ?", commonName, true).First(&device).Error; err != nil {
+		return nil, errors.New("telematics device not found")
+	}
+	return &device, nil
+}
+
+// Ingest records positions in the active trips of the connection carrier's
+// vehicles, logging a sync event on each trip
+func (tms *TelematicsService) Ingest(conn *models.TelematicsConnection, positions []TelematicsPosition) *TelematicsIngestResult {
+	return tms.ingest(conn.UserID, positions, func(tripID uint, batch *LocationBatchResult) {
+		tms.tracking.LogTrackingEvent(tripID, nil, "TELEMATICS_SYNC",
+			fmt.Sprintf(`{"provider":%q,"total_records":%d,"success":%d,"errors":%d}`, conn.Provider, batch.TotalRecords, batch.SuccessCount, batch.ErrorCount),
+			"", nil, nil, fmt.Sprintf("Synced %d location records from %s", batch.SuccessCount, conn.Name))
+	})
+}
+
+// IngestDeviceBatch records a batch of the positions streamed by a device.
+// Devices send positions every few seconds, so unlike provider syncs the
+// batches are not logged as tracking events.
+func (tms *TelematicsService) IngestDeviceBatch(device *models.TelematicsDevice, positions []TelematicsPosition) *TelematicsIngestResult {
+	result := tms.ingest(device.UserID, positions, nil)
+	tms.db.Model(device).Update("last_seen_at", time.Now())
+	return result
+}
+
+// ingest records positions in the active trips of a carrier's vehicles.
+// Vehicles are matched by VIN, then by license plate, which is also tried
+// against the provider's vehicle name. Each trip's positions go through the
+// batch location path in the order they were recorded, and synced is called
+// with the outcome of each trip's batch.
+func (tms *TelematicsService) ingest(userID uint, positions []TelematicsPosition, synced func(tripID uint, batch *LocationBatchResult)) *TelematicsIngestResult {
+	result := &TelematicsIngestResult{
+		Positions:         len(positions),
+		Trips:             []uint{},
+		UnmatchedVehicles: []string{},
+		IdleVehicles:      []string{},
+		Errors:            []string{},
+	}
+	if len(positions) == 0 {
+		return result
+	}
+
+	var vehicles []models.Vehicle
+	tms.db.Where("user_id = ?", userID).Find(&vehicles)
+	byVIN := make(map[string]uint)
+	byPlate := make(map[string]uint)
+	for _, vehicle := range vehicles {
+		if vin := normalizeVehicleKey(vehicle.VIN); vin != "" {
+			byVIN[vin] = vehicle.ID
+		}
+		if plate := normalizeVehicleKey(vehicle.LicensePlate); plate != "" {
+			byPlate[plate] = vehicle.ID
+		}
+	}
+
+	tripOfVehicle := make(map[uint]uint)
+	updates := make(map[uint][]TelematicsPosition)
+	unmatched := make(map[string]bool)
+	idle := make(map[string]bool)
+	for _, position := range positions {
+		label := position.VehicleName
+		if label == "" {
+			label = position.VehicleID
+		}
+
+		vehicleID, ok := byVIN[normalizeVehicleKey(position.VIN)]
+		if !ok {
+			vehicleID, ok = byPlate[normalizeVehicleKey(position.LicensePlate)]
+		}
+		if !ok {
+			vehicleID, ok = byPlate[normalizeVehicleKey(position.VehicleName)]
+		}
+		if !ok {
+			unmatched[label] = true
+			continue
+		}
+
+		tripID, known := tripOfVehicle[vehicleID]
+		if !known {
+			var trip models.Trip
+			if err := tms.db.Where("vehicle_id = ? AND user_id = ? AND status IN ?", vehicleID, userID, []string{"ACTIVE", "IN_TRANSIT"}).
+				Order("departure_date DESC").First(&trip).Error; err == nil {
+				tripID = trip.ID
+			}
+			tripOfVehicle[vehicleID] = tripID
+		}
+		if tripID == 0 {
+			idle[label] = true
+			continue
+		}
+		updates[tripID] = append(updates[tripID], position)
+	}
+
+	for tripID, tripPositions := range updates {
+		sort.Slice(tripPositions, func(i, j int) bool { return tripPositions[i].Timestamp.Before(tripPositions[j].Timestamp) })
+
+		locationUpdates := make([]LocationUpdate, 0, len(tripPositions))
+		for _, position := range tripPositions {
+			timestamp := position.Timestamp
+			locationUpdates = append(locationUpdates, LocationUpdate{
+				Latitude:  position.Latitude,
+				Longitude: position.Longitude,
+				Altitude:  position.Altitude,
+				Speed:     position.Speed,
+				Heading:   position.Heading,
+				Accuracy:  position.Accuracy,
+				Source:    "GPS",
+				Timestamp: &timestamp,
+			})
+		}
+
+		batch := tms.tracking.IngestLocationBatch(tripID, locationUpdates)
+		result.Ingested += batch.SuccessCount
+		result.Trips = append(result.Trips, tripID)
+		for _, message := range batch.Errors {
+			result.Errors = append(result.Errors, fmt.Sprintf("trip %d: %s", tripID, message))
+		}
+
+		if synced != nil {
+			synced(tripID, batch)
+		}
+	}
+	sort.Slice(result.Trips, func(i, j int) bool { return result.Trips[i] < result.Trips[j] })
+
+	for label := range unmatched {
+		result.UnmatchedVehicles = append(result.UnmatchedVehicles, label)
+	}
+	for label := range idle {
+		result.IdleVehicles = append(result.IdleVehicles, label)
+	}
+	sort.Strings(result.UnmatchedVehicles)
+	sort.Strings(result.IdleVehicles)
+
+	return result
+}
+
+// normalizeVehicleKey normalizes a license plate or VIN for matching, e.g.
+// "abc-123" and "ABC 123" match
+func normalizeVehicleKey(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(value) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
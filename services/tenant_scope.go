@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tenantScopeKey is the context key of the scope a request's reads are
+// limited to
+type tenantScopeKey struct{}
+
+// WithTenantScope returns a context limiting the reads of trips and loads
+// made with it to those in the scope. A nil scope, an admin's, reads
+// everything.
+func WithTenantScope(ctx context.Context, scope *OrganizationScope) context.Context {
+	return context.WithValue(ctx, tenantScopeKey{}, scope)
+}
+
+// TenantScopeFromContext returns the scope of a context, and whether it has
+// one
+func TenantScopeFromContext(ctx context.Context) (*OrganizationScope, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	scope, ok := ctx.Value(tenantScopeKey{}).(*OrganizationScope)
+	return scope, ok
+}
+
+// TenantScopePlugin filters the trips and loads read by sessions whose
+// context has a tenant scope, so that a query made on behalf of a user, such
+// as fetching a trip by ID, can't return another organization's records.
+// Writes aren't filtered: handlers check the user may change a record first.
+type TenantScopePlugin struct{}
+
+// NewTenantScopePlugin creates the plugin, registered with db.Use
+func NewTenantScopePlugin() *TenantScopePlugin {
+	return &TenantScopePlugin{}
+}
+
+// Name implements gorm.Plugin
+func (p *TenantScopePlugin) Name() string {
+	return "tenant_scope"
+}
+
+// Initialize implements gorm.Plugin, filtering queries and row scans
+func (p *TenantScopePlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Query().Before("gorm:query").Register("tenant_scope:query", scopeTenantReads); err != nil {
+		return err
+	}
+	return callbacks.Row().Before("gorm:row").Register("tenant_scope:row", scopeTenantReads)
+}
+
+// scopeTenantReads adds the scope's condition to reads of trips and loads
+func scopeTenantReads(db *gorm.DB) {
+	scope, ok := TenantScopeFromContext(db.Statement.Context)
+	if !ok || scope == nil || db.Statement.Schema == nil {
+		return
+	}
+
+	var condition clause.Expression
+	switch db.Statement.Schema.Table {
+	case "trips":
+		condition = scope.tripCondition(unscopedSession(db))
+	case "loads":
+		condition = scope.loadCondition(unscopedSession(db))
+	default:
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{condition}})
+}
+
+// unscopedSession returns a new session for the subqueries of a scope's
+// conditions, which mustn't be filtered themselves
+func unscopedSession(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true, Context: context.Background()})
+}
+
+// tripCondition matches the trips a user sees: their own and their
+// organizations', those they are assigned to drive and those carrying loads
+// they see
+func (s *OrganizationScope) tripCondition(db *gorm.DB) clause.Expression {
+	shipped := db.Model(&models.Load{}).Select("trip_id").
+		Where("shipper_id = ? OR organization_id IN ?", s.UserID, s.OrganizationIDs)
+	return clause.Expr{
+		SQL: "(? = ? OR ? IN ? OR ? IN ? OR ? IN (?))",
+		Vars: []interface{}{
+			currentColumn("user_id"), s.UserID,
+			currentColumn("organization_id"), s.OrganizationIDs,
+			currentColumn("id"), s.AssignedTripIDs,
+			currentColumn("id"), shipped,
+		},
+	}
+}
+
+// loadCondition matches the loads a user sees: their own and their
+// organizations', and those on trips they carry or drive. Shippers don't see
+// the other loads on the trips carrying theirs.
+func (s *OrganizationScope) loadCondition(db *gorm.DB) clause.Expression {
+	carried := db.Model(&models.Trip{}).Select("id").
+		Where("user_id = ? OR organization_id IN ? OR id IN ?", s.UserID, s.OrganizationIDs, s.AssignedTripIDs)
+	return clause.Expr{
+		SQL: "(? = ? OR ? IN ? OR ? IN (?))",
+		Vars: []interface{}{
+			currentColumn("shipper_id"), s.UserID,
+			currentColumn("organization_id"), s.OrganizationIDs,
+			currentColumn("trip_id"), carried,
+		},
+	}
+}
+
+// currentColumn is a column of the table being read, qualified so joins
+// don't make it ambiguous
+func currentColumn(name string) clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: name}
+}
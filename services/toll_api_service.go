@@ -5,10 +5,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
-	"os"
 	"strings"
 	"time"
+	"triplink/backend/config"
 )
 
 // Toll API Service Implementation
@@ -21,7 +20,7 @@ type TollService struct {
 
 func NewTollAPIService() *TollService {
 	return &TollService{
-		APIKey:  os.Getenv("TOLLGURU_API_KEY"), // TollGuru or similar toll API
+		APIKey:  config.GetAPIKeysConfig().TollGuru, // TollGuru or similar toll API
 		BaseURL: "https://api.tollguru.com/v1",
 		HTTPClient: &http.Client{
 			Timeout: 15 * time.Second,
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrTrackerNotFound is returned for trackers that aren't registered,
+	// aren't the carrier's or are inactive
+	ErrTrackerNotFound = errors.New("tracker not found")
+	// ErrTrackerRegistered is returned when a device ID is already registered
+	ErrTrackerRegistered = errors.New("device_id is already registered")
+	// ErrTrackerNoTrip is returned for positions of trackers that are neither
+	// pinned to an active trip nor installed in a vehicle with one
+	ErrTrackerNoTrip = errors.New("tracker has no active trip")
+)
+
+// TrackerRequest registers a tracker or changes what it is installed in.
+// Omitted fields are left unchanged on update.
+type TrackerRequest struct {
+	DeviceID  string `json:"device_id"` // usually the IMEI
+	Name      string `json:"name"`
+	VehicleID *uint  `json:"vehicle_id"` // 0 uninstalls the tracker
+	TripID    *uint  `json:"trip_id"`    // 0 unpins the tracker
+	IsActive  *bool  `json:"is_active"`
+}
+
+// TrackerService manages carriers' hardware GPS trackers and records the
+// positions they report
+type TrackerService struct {
+	db       *gorm.DB
+	tracking *TrackingService
+}
+
+// NewTrackerService creates a new TrackerService
+func NewTrackerService(db *gorm.DB) *TrackerService {
+	return &TrackerService{db: db, tracking: NewTrackingService(db)}
+}
+
+// CreateTracker registers a carrier's tracker
+func (s *TrackerService) CreateTracker(userID uint, req TrackerRequest) (*models.TrackerDevice, error) {
+	deviceID := strings.TrimSpace(req.DeviceID)
+	if deviceID == "" {
+		return nil, errors.New("device_id is required")
+	}
+	var existing int64
+	s.db.Model(&models.TrackerDevice{}).Where("device_id = ?", deviceID).Count(&existing)
+	if existing > 0 {
+		return nil, ErrTrackerRegistered
+	}
+
+	tracker := models.TrackerDevice{UserID: userID, DeviceID: deviceID, IsActive: true}
+	if err := s.apply(userID, &tracker, req); err != nil {
+		return nil, err
+	}
+	if tracker.Name == "" {
+		tracker.Name = deviceID
+	}
+	if err := s.db.Create(&tracker).Error; err != nil {
+		return nil, fmt.Errorf("failed to create tracker: %w", err)
+	}
+	return &tracker, nil
+}
+
+// GetTrackers returns a carrier's trackers
+func (s *TrackerService) GetTrackers(userID uint) ([]models.TrackerDevice, error) {
+	var trackers []models.TrackerDevice
+	if err := s.db.Where("user_id = ?", userID).Order("id").Find(&trackers).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch trackers: %w", err)
+	}
+	return trackers, nil
+}
+
+// getTracker returns a carrier's tracker
+func (s *TrackerService) getTracker(userID, trackerID uint) (*models.TrackerDevice, error) {
+	var tracker models.TrackerDevice
+	if err := s.db.First(&tracker, trackerID).Error; err != nil || tracker.UserID != userID {
+		return nil, ErrTrackerNotFound
+	}
+	return &tracker, nil
+}
+
+// UpdateTracker renames a carrier's tracker, moves it to another vehicle or
+// trip, or deactivates it
+func (s *TrackerService) UpdateTracker(userID, trackerID uint, req TrackerRequest) (*models.TrackerDevice, error) {
+	tracker, err := s.getTracker(userID, trackerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(userID, tracker, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(tracker).Error; err != nil {
+		return nil, fmt.Errorf("failed to update tracker: %w", err)
+	}
+	return tracker, nil
+}
+
+// apply sets the fields given in a request, checking that the vehicle and
+// trip are the carrier's
+func (s *TrackerService) apply(userID uint, tracker *models.TrackerDevice, req TrackerRequest) error {
+	if name := strings.TrimSpace(req.Name); name != "" {
+		tracker.Name = name
+	}
+	if req.VehicleID != nil {
+		tracker.VehicleID = nil
+		if *req.VehicleID != 0 {
+			var vehicle models.Vehicle
+			if err := s.db.First(&vehicle, *req.VehicleID).Error; err != nil || vehicle.UserID != userID {
+				return errors.New("vehicle not found")
+			}
+			tracker.VehicleID = &vehicle.ID
+		}
+	}
+	if req.TripID != nil {
+		tracker.TripID = nil
+		if *req.TripID != 0 {
+			var trip models.Trip
+			if err := s.db.First(&trip, *req.TripID).Error; err != nil || trip.UserID != userID {
+				return errors.New("trip not found")
+			}
+			tracker.TripID = &trip.ID
+		}
+	}
+	if req.IsActive != nil {
+		tracker.IsActive = *req.IsActive
+	}
+	return nil
+}
+
+// DeleteTracker removes a carrier's tracker
+func (s *TrackerService) DeleteTracker(userID, trackerID uint) error {
+	tracker, err := s.getTracker(userID, trackerID)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Delete(tracker).Error; err != nil {
+		return fmt.Errorf("failed to delete tracker: %w", err)
+	}
+	return nil
+}
+
+// TripOf returns the active trip a tracker's positions are recorded in: the
+// trip it is pinned to while that is active, or else the active trip of the
+// vehicle it is installed in
+func (s *TrackerService) TripOf(tracker *models.TrackerDevice) (uint, error) {
+	active := []string{"ACTIVE", "IN_TRANSIT"}
+	var trip models.Trip
+	if tracker.TripID != nil {
+		if err := s.db.Where("id = ? AND status IN ?", *tracker.TripID, active).First(&trip).Error; err == nil {
+			return trip.ID, nil
+		}
+	}
+	if tracker.VehicleID != nil {
+		if err := s.db.Where("vehicle_id = ? AND user_id = ? AND status IN ?", *tracker.VehicleID, tracker.UserID, active).
+			Order("departure_date DESC").First(&trip).Error; err == nil {
+			return trip.ID, nil
+		}
+	}
+	return 0, ErrTrackerNoTrip
+}
+
+// IngestTrackerUpdates records the positions reported by a tracker in its
+// trip, through the same validation and sanitization as positions posted by
+// the app. It returns the trip the positions were recorded in; when some are
+// rejected, the others are still recorded and the first rejection returned.
+func (s *TrackerService) IngestTrackerUpdates(deviceID string, updates []LocationUpdate) (uint, error) {
+	var tracker models.TrackerDevice
+	if err := s.db.Where("device_id = ? AND is_active = ?", deviceID, true).First(&tracker).Error; err != nil {
+		return 0, ErrTrackerNotFound
+	}
+	s.db.Model(&tracker).Update("last_seen_at", time.Now())
+
+	tripID, err := s.TripOf(&tracker)
+	if err != nil {
+		return 0, err
+	}
+	if len(updates) == 0 {
+		return tripID, nil
+	}
+	for i := range updates {
+		if updates[i].Source == "" {
+			updates[i].Source = "GPS"
+		}
+	}
+
+	result := s.tracking.IngestLocationBatch(tripID, updates)
+	if result.ErrorCount > 0 {
+		return tripID, errors.New(result.Errors[0])
+	}
+	return tripID, nil
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/geo"
+	"triplink/backend/internal/units"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of tracking anomalies
+const (
+	AnomalySpeedChange = "SPEED_CHANGE"
+	AnomalyHighSpeed   = "HIGH_SPEED"
+	// A reported speed no ground vehicle drives
+	AnomalyImpossibleSpeed = "IMPOSSIBLE_SPEED"
+	// Consecutive positions too far apart to have been driven between
+	AnomalyTeleportation = "TELEPORTATION"
+	AnomalyLongSilence   = "LONG_SILENCE"
+)
+
+// Severity of tracking anomalies. HIGH anomalies are notified to the trip's
+// dispatchers.
+const (
+	AnomalySeverityLow    = "LOW"
+	AnomalySeverityMedium = "MEDIUM"
+	AnomalySeverityHigh   = "HIGH"
+)
+
+// anomalyRecords is how many of a trip's latest positions are checked
+const anomalyRecords = 10
+
+// TrackingAnomaly is an unusual pattern in a trip's tracking data
+type TrackingAnomaly struct {
+	Type        string  `json:"type"`
+	Severity    string  `json:"severity"`
+	Description string  `json:"description"`
+	Value       float64 `json:"value"` // km/h, or hours without updates
+	// Time of the position the anomaly was found at
+	ObservedAt time.Time `json:"observed_at"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+}
+
+// fingerprint identifies an anomaly across runs, so that it is recorded once
+func (a TrackingAnomaly) fingerprint() string {
+	return fmt.Sprintf("%s:%d", a.Type, a.ObservedAt.Unix())
+}
+
+// describe describes an anomaly with its speeds in a system of measurement
+func (a TrackingAnomaly) describe(system units.System) string {
+	speed := fmt.Sprintf("%.1f %s", system.Speed(a.Value), system.SpeedUnit())
+	switch a.Type {
+	case AnomalySpeedChange:
+		return fmt.Sprintf("Sudden speed change detected: %s difference", speed)
+	case AnomalyImpossibleSpeed:
+		return fmt.Sprintf("Impossible speed reported: %s", speed)
+	case AnomalyHighSpeed:
+		return fmt.Sprintf("High speed detected: %s", speed)
+	case AnomalyTeleportation:
+		return fmt.Sprintf("Impossible speed detected: %s between locations", speed)
+	case AnomalyLongSilence:
+		return fmt.Sprintf("No location updates for %.1f hours", a.Value)
+	}
+	return a.Description
+}
+
+// anomalyEventData is the event data of ANOMALY tracking events
+type anomalyEventData struct {
+	Type        string    `json:"type"`
+	Severity    string    `json:"severity"`
+	Value       float64   `json:"value"`
+	ObservedAt  time.Time `json:"observed_at"`
+	Fingerprint string    `json:"fingerprint"`
+}
+
+// DetectTripAnomalies checks a trip's latest positions for sudden speed
+// changes, speeding, impossible speeds, jumps between positions and a long
+// silence since the last update
+func (ts *TrackingService) DetectTripAnomalies(tripID uint) ([]TrackingAnomaly, error) {
+	var records []models.TrackingRecord
+	if err := TripTrackingRecords(ts.db, tripID).
+		Order("timestamp DESC").
+		Limit(anomalyRecords).
+		Find(&records).Error; err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil
+	}
+
+	thresholds := config.CurrentAlertConfig()
+	var anomalies []TrackingAnomaly
+	add := func(record models.TrackingRecord, anomalyType, severity string, value float64) {
+		anomaly := TrackingAnomaly{
+			Type:       anomalyType,
+			Severity:   severity,
+			Value:      value,
+			ObservedAt: record.Timestamp,
+			Latitude:   record.Latitude,
+			Longitude:  record.Longitude,
+		}
+		anomaly.Description = anomaly.describe(units.Metric)
+		anomalies = append(anomalies, anomaly)
+	}
+
+	for i := 0; i < len(records)-1; i++ {
+		current := records[i]
+		previous := records[i+1]
+
+		if current.Speed != nil && previous.Speed != nil {
+			speedDiff := math.Abs(*current.Speed - *previous.Speed)
+			if speedDiff > thresholds.SpeedChangeKmh {
+				add(current, AnomalySpeedChange, AnomalySeverityLow, speedDiff)
+			}
+
+			switch {
+			case *current.Speed > thresholds.ImpossibleSpeedKmh:
+				add(current, AnomalyImpossibleSpeed, AnomalySeverityHigh, *current.Speed)
+			case *current.Speed > thresholds.SpeedLimitKmh:
+				add(current, AnomalyHighSpeed, AnomalySeverityMedium, *current.Speed)
+			}
+		}
+
+		// Positions too far apart for the time between them, on the
+		// smoothed track so that a single inaccurate fix isn't a jump
+		currentLat, currentLng := SmoothedPosition(current)
+		previousLat, previousLng := SmoothedPosition(previous)
+		distance := geo.Distance(currentLat, currentLng, previousLat, previousLng)
+		if timeDiff := current.Timestamp.Sub(previous.Timestamp).Hours(); timeDiff > 0 {
+			if impliedSpeed := distance / timeDiff; impliedSpeed > thresholds.ImpossibleSpeedKmh {
+				add(current, AnomalyTeleportation, AnomalySeverityHigh, impliedSpeed)
+			}
+		}
+	}
+
+	last := records[0]
+	if silence := time.Since(last.Timestamp); silence > thresholds.UpdateGap {
+		add(last, AnomalyLongSilence, AnomalySeverityHigh, silence.Hours())
+	}
+
+	return anomalies, nil
+}
+
+// ProcessAnomalies records the anomalies newly found in a trip's tracking
+// data as ANOMALY tracking events, and notifies the trip's dispatchers of
+// HIGH severity ones. An anomaly found again on a later run isn't recorded
+// twice.
+func (ts *TrackingService) ProcessAnomalies(tripID uint) ([]TrackingAnomaly, error) {
+	anomalies, err := ts.DetectTripAnomalies(tripID)
+	if err != nil || len(anomalies) == 0 {
+		return nil, err
+	}
+
+	var recorded []TrackingAnomaly
+	for _, anomaly := range anomalies {
+		fingerprint := anomaly.fingerprint()
+		var count int64
+		ts.db.Model(&models.TrackingEvent{}).
+			Where("trip_id = ? AND event_type = ? AND event_data LIKE ?",
+				tripID, "ANOMALY", fmt.Sprintf("%%\"fingerprint\":\"%s\"%%", fingerprint)).
+			Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		data, err := json.Marshal(anomalyEventData{
+			Type:        anomaly.Type,
+			Severity:    anomaly.Severity,
+			Value:       math.Round(anomaly.Value*10) / 10,
+			ObservedAt:  anomaly.ObservedAt,
+			Fingerprint: fingerprint,
+		})
+		if err != nil {
+			return recorded, fmt.Errorf("failed to encode anomaly: %w", err)
+		}
+		latitude, longitude := anomaly.Latitude, anomaly.Longitude
+		if err := ts.LogTrackingEvent(tripID, nil, "ANOMALY", string(data), "", &latitude, &longitude, anomaly.Description); err != nil {
+			return recorded, fmt.Errorf("failed to record anomaly: %w", err)
+		}
+		recorded = append(recorded, anomaly)
+	}
+
+	var high []TrackingAnomaly
+	for _, anomaly := range recorded {
+		if anomaly.Severity == AnomalySeverityHigh {
+			high = append(high, anomaly)
+		}
+	}
+	if len(high) > 0 {
+		ts.notifyAnomalies(tripID, high)
+	}
+	return recorded, nil
+}
+
+// notifyAnomalies notifies the carrier of a trip and the owners and
+// dispatchers of its organization of anomalies in its tracking data
+func (ts *TrackingService) notifyAnomalies(tripID uint, anomalies []TrackingAnomaly) {
+	var trip models.Trip
+	if err := ts.db.Select("id, user_id, organization_id").First(&trip, tripID).Error; err != nil {
+		return
+	}
+	dispatchers := tripDispatchers(ts.db, &trip)
+
+	systems := UserUnitSystems(ts.db, dispatchers)
+
+	for _, anomaly := range anomalies {
+		for _, userID := range dispatchers {
+			notification := models.Notification{
+				UserID:    userID,
+				Title:     "Tracking Anomaly",
+				Message:   fmt.Sprintf("Trip %d: %s", trip.ID, anomaly.describe(systems[userID])),
+				Type:      "TRACKING_ANOMALY",
+				RelatedID: trip.ID,
+			}
+			if notifications := GetNotificationService(); notifications != nil {
+				if created, _, err := notifications.CreateNotificationWithDelivery(&notification); created == nil {
+					log.Printf("Failed to notify user %d of anomaly on trip %d: %v", userID, trip.ID, err)
+				}
+			} else {
+				ts.db.Create(&notification)
+			}
+		}
+
+		if trip.OrganizationID != nil {
+			sendOpsAlert(OpsAlert{
+				Type:           OpsAlertTrackingAnomaly,
+				OrganizationID: *trip.OrganizationID,
+				TripID:         trip.ID,
+				Data:           map[string]interface{}{"type": anomaly.Type, "severity": anomaly.Severity, "description": anomaly.describe(units.Metric)},
+			})
+		}
+	}
+}
+
+// tripDispatchers returns the users who manage a trip: its carrier, and the
+// owners and dispatchers of its organization
+func tripDispatchers(db *gorm.DB, trip *models.Trip) []uint {
+	users := []uint{trip.UserID}
+	if trip.OrganizationID == nil {
+		return users
+	}
+
+	var members []uint
+	db.Model(&models.OrganizationMembership{}).
+		Where("organization_id = ? AND role IN ? AND user_id <> ?", *trip.OrganizationID,
+			[]string{OrganizationOwner, OrganizationDispatcher}, trip.UserID).
+		Order("user_id").
+		Pluck("user_id", &members)
+	return append(users, members...)
+}
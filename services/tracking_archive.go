@@ -0,0 +1,195 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// archivedTrackingRecordsTable holds the tracking records of archived trips
+const archivedTrackingRecordsTable = "tracking_records_archive"
+
+// TripTrackingRecords returns a query of the tracking records of a trip,
+// reading from the archive once the trip's records were moved there. Use it
+// for a trip's history so archived trips read like any other.
+func TripTrackingRecords(db *gorm.DB, tripID uint) *gorm.DB {
+	var archived int64
+	db.Model(&models.Trip{}).Where("id = ? AND tracking_archived_at IS NOT NULL", tripID).Count(&archived)
+	if archived > 0 {
+		return db.Table(archivedTrackingRecordsTable).Where("trip_id = ?", tripID)
+	}
+	return db.Model(&models.TrackingRecord{}).Where("trip_id = ?", tripID)
+}
+
+// TrackingArchiveService keeps tracking_records small: on Postgres it
+// creates the table's monthly partitions ahead of time, and it moves the
+// records of long closed trips to the archive table.
+type TrackingArchiveService struct {
+	db  *gorm.DB
+	cfg *config.TrackingArchiveConfig
+	now func() time.Time
+}
+
+// NewTrackingArchiveService creates a new TrackingArchiveService
+func NewTrackingArchiveService(db *gorm.DB, cfg *config.TrackingArchiveConfig) *TrackingArchiveService {
+	return &TrackingArchiveService{db: db, cfg: cfg, now: time.Now}
+}
+
+// RunScheduledMaintenance creates the upcoming partitions and archives the
+// trips due, from the background scheduler
+func (s *TrackingArchiveService) RunScheduledMaintenance() error {
+	partitionErr := s.EnsurePartitions()
+	if partitionErr != nil {
+		log.Printf("Failed to create tracking record partitions: %v", partitionErr)
+	}
+
+	archived, err := s.ArchiveClosedTrips()
+	if archived > 0 {
+		log.Printf("Archived the tracking records of %d trips", archived)
+	}
+	if err != nil {
+		return err
+	}
+	return partitionErr
+}
+
+// EnsurePartitions creates the partitions of tracking_records for the
+// current month and the configured months ahead. Months with records in the
+// default partition are left there, as their partition can't be created.
+// Does nothing unless tracking_records is partitioned.
+func (s *TrackingArchiveService) EnsurePartitions() error {
+	if s.db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	var partitioned bool
+	err := s.db.Raw(`SELECT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = to_regclass('tracking_records'))`).
+		Scan(&partitioned).Error
+	if err != nil {
+		return fmt.Errorf("failed to check tracking record partitions: %w", err)
+	}
+	if !partitioned {
+		return nil
+	}
+
+	now := s.now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= s.cfg.PartitionMonthsAhead; i++ {
+		from := month.AddDate(0, i, 0)
+		if err := s.createPartition(from, from.AddDate(0, 1, 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createPartition creates the partition of the records from from until to
+func (s *TrackingArchiveService) createPartition(from, to time.Time) error {
+	name := fmt.Sprintf("tracking_records_%04d_%02d", from.Year(), from.Month())
+
+	var exists bool
+	if err := s.db.Raw("SELECT to_regclass(?) IS NOT NULL", name).Scan(&exists).Error; err != nil {
+		return fmt.Errorf("failed to check partition %s: %w", name, err)
+	}
+	if exists {
+		return nil
+	}
+
+	var stranded bool
+	err := s.db.Raw(`SELECT EXISTS (SELECT 1 FROM tracking_records_default WHERE "timestamp" >= ? AND "timestamp" < ?)`, from, to).
+		Scan(&stranded).Error
+	if err != nil {
+		return fmt.Errorf("failed to check default partition: %w", err)
+	}
+	if stranded {
+		log.Printf("Not creating partition %s: the default partition has records of its month", name)
+		return nil
+	}
+
+	err = s.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF tracking_records FOR VALUES FROM ('%s') TO ('%s')`,
+		name, from.Format(time.RFC3339), to.Format(time.RFC3339))).Error
+	if err != nil {
+		return fmt.Errorf("failed to create partition %s: %w", name, err)
+	}
+	return nil
+}
+
+// ArchiveClosedTrips moves the tracking records of a batch of trips closed
+// longer than the configured delay to the archive table, returning how many
+// trips were archived
+func (s *TrackingArchiveService) ArchiveClosedTrips() (int, error) {
+	cutoff := s.now().Add(-s.cfg.ArchiveAfter)
+	var tripIDs []uint
+	err := s.db.Model(&models.Trip{}).
+		Where("status IN ? AND tracking_archived_at IS NULL AND COALESCE(actual_arrival, updated_at) < ?",
+			[]string{"COMPLETED", "CANCELLED"}, cutoff).
+		Order("id").
+		Limit(s.cfg.BatchSize).
+		Pluck("id", &tripIDs).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to get trips to archive: %w", err)
+	}
+
+	for i, tripID := range tripIDs {
+		if err := s.ArchiveTrip(tripID); err != nil {
+			return i, err
+		}
+	}
+	return len(tripIDs), nil
+}
+
+// ArchiveTrip moves the tracking records of a trip to the archive table.
+// Location updates for the trip are rejected from then on.
+func (s *TrackingArchiveService) ArchiveTrip(tripID uint) error {
+	columns, err := trackingRecordColumns(s.db)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("INSERT INTO "+archivedTrackingRecordsTable+" ("+columns+", archived_at) SELECT "+columns+", ? FROM tracking_records WHERE trip_id = ?",
+			now, tripID).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM tracking_records WHERE trip_id = ?", tripID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Trip{}).Where("id = ?", tripID).UpdateColumn("tracking_archived_at", now).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive tracking records of trip %d: %w", tripID, err)
+	}
+	return nil
+}
+
+var (
+	trackingRecordColumnsOnce sync.Once
+	trackingRecordColumnList  string
+	trackingRecordColumnsErr  error
+)
+
+// trackingRecordColumns returns the quoted columns of tracking_records, which
+// the archive table has too
+func trackingRecordColumns(db *gorm.DB) (string, error) {
+	trackingRecordColumnsOnce.Do(func() {
+		s, err := schema.Parse(&models.TrackingRecord{}, &sync.Map{}, db.NamingStrategy)
+		if err != nil {
+			trackingRecordColumnsErr = fmt.Errorf("failed to parse tracking record schema: %w", err)
+			return
+		}
+		columns := make([]string, len(s.DBNames))
+		for i, name := range s.DBNames {
+			columns[i] = `"` + name + `"`
+		}
+		trackingRecordColumnList = strings.Join(columns, ", ")
+	})
+	return trackingRecordColumnList, trackingRecordColumnsErr
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"triplink/backend/models"
+)
+
+// PauseTracking stops accepting location updates for a trip until tracking is
+// resumed, logging a TRACKING_PAUSED event
+func (ts *TrackingService) PauseTracking(tripID, userID uint, reason string) (*models.Trip, error) {
+	trip, err := ts.getTrip(tripID)
+	if err != nil {
+		return nil, err
+	}
+	if !trip.TrackingEnabled {
+		return trip, nil
+	}
+
+	now := time.Now()
+	if err := ts.db.Model(trip).Updates(map[string]interface{}{
+		"tracking_enabled":   false,
+		"tracking_paused_at": now,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to pause tracking: %w", err)
+	}
+
+	description := "Tracking paused"
+	if reason != "" {
+		description += ": " + reason
+	}
+	ts.LogTrackingEvent(tripID, nil, "TRACKING_PAUSED", fmt.Sprintf(`{"user_id":%d}`, userID), "", nil, nil, description)
+	return trip, nil
+}
+
+// ResumeTracking accepts location updates for a paused trip again, logging a
+// TRACKING_RESUMED event. Tracking can't be resumed after consent was withdrawn.
+func (ts *TrackingService) ResumeTracking(tripID, userID uint) (*models.Trip, error) {
+	trip, err := ts.getTrip(tripID)
+	if err != nil {
+		return nil, err
+	}
+	if trip.TrackingEnabled {
+		return trip, nil
+	}
+	if trip.TrackingConsentWithdrawnAt != nil {
+		return nil, NewTrackingError("TRACKING_CONSENT_WITHDRAWN",
+			"Tracking consent was withdrawn",
+			"Consent must be given again before tracking can resume", &tripID, nil)
+	}
+
+	if err := ts.db.Model(trip).Updates(map[string]interface{}{
+		"tracking_enabled":   true,
+		"tracking_paused_at": nil,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to resume tracking: %w", err)
+	}
+
+	ts.LogTrackingEvent(tripID, nil, "TRACKING_RESUMED", fmt.Sprintf(`{"user_id":%d}`, userID), "", nil, nil, "Tracking resumed")
+	return trip, nil
+}
+
+// RecordTrackingConsent records the carrier giving or withdrawing consent to
+// location tracking of a trip. Withdrawing consent pauses tracking; giving it
+// again doesn't resume tracking by itself.
+func (ts *TrackingService) RecordTrackingConsent(tripID, userID uint, granted bool) (*models.Trip, error) {
+	trip, err := ts.getTrip(tripID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"tracking_consent_at":           now,
+		"tracking_consent_user_id":      userID,
+		"tracking_consent_withdrawn_at": nil,
+	}
+	eventType, description := "TRACKING_CONSENT_GIVEN", "Tracking consent given"
+	if !granted {
+		updates = map[string]interface{}{
+			"tracking_consent_withdrawn_at": now,
+			"tracking_enabled":              false,
+		}
+		if trip.TrackingEnabled {
+			updates["tracking_paused_at"] = now
+		}
+		eventType, description = "TRACKING_CONSENT_WITHDRAWN", "Tracking consent withdrawn, tracking paused"
+	}
+
+	if err := ts.db.Model(trip).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to record tracking consent: %w", err)
+	}
+
+	ts.LogTrackingEvent(tripID, nil, eventType, fmt.Sprintf(`{"user_id":%d}`, userID), "", nil, nil, description)
+	return trip, nil
+}
+
+// checkTrackingEnabled returns a TRACKING_DISABLED error for trips with
+// tracking paused. The rejection is logged once per pause so a device that
+// keeps reporting doesn't flood the event log.
+func (ts *TrackingService) checkTrackingEnabled(tripID uint) error {
+	var trip models.Trip
+	if err := ts.db.Select("id", "tracking_enabled", "tracking_paused_at", "tracking_archived_at").First(&trip, tripID).Error; err != nil {
+		return nil
+	}
+	if trip.TrackingArchivedAt != nil {
+		return NewTrackingError("TRACKING_ARCHIVED",
+			"Tracking of this trip is archived",
+			"Location updates are rejected once a closed trip's records are archived", &tripID, nil)
+	}
+	if trip.TrackingEnabled {
+		return nil
+	}
+
+	query := ts.db.Model(&models.TrackingEvent{}).Where("trip_id = ? AND event_type = ?", tripID, "TRACKING_DISABLED")
+	if trip.TrackingPausedAt != nil {
+		query = query.Where("timestamp >= ?", *trip.TrackingPausedAt)
+	}
+	var logged int64
+	query.Count(&logged)
+	if logged == 0 {
+		if err := ts.LogTrackingEvent(tripID, nil, "TRACKING_DISABLED", "", "", nil, nil,
+			"Location update rejected because tracking is disabled"); err != nil {
+			log.Printf("Failed to log disabled tracking for trip %d: %v", tripID, err)
+		}
+	}
+
+	return NewTrackingError("TRACKING_DISABLED",
+		"Tracking is disabled for this trip",
+		"Location updates are rejected until tracking is resumed", &tripID, nil)
+}
+
+// getTrip loads a trip for a tracking change
+func (ts *TrackingService) getTrip(tripID uint) (*models.Trip, error) {
+	var trip models.Trip
+	if err := ts.db.First(&trip, tripID).Error; err != nil {
+		return nil, errors.New("trip not found")
+	}
+	return &trip, nil
+}
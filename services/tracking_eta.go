@@ -0,0 +1,344 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+	"triplink/backend/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ETA sources
+const (
+	ETASourceGoogleMaps = "GOOGLE_MAPS"
+	ETASourceHERE       = "HERE"
+	ETASourceHaversine  = "HAVERSINE"
+	ETASourcePlanned    = "PLANNED"
+)
+
+// RoadRouteEstimate is a travel estimate along the road network
+type RoadRouteEstimate struct {
+	DistanceKm          float64 `json:"distance_km"`
+	DurationMinutes     float64 `json:"duration_minutes"`
+	TrafficDelayMinutes float64 `json:"traffic_delay_minutes"`
+	IncludesTraffic     bool    `json:"includes_traffic"`
+}
+
+// ETARouteProvider computes road travel estimates between two coordinates
+type ETARouteProvider interface {
+	EstimateRoute(ctx context.Context, origin, destination Coordinate) (*RoadRouteEstimate, error)
+	Name() string
+}
+
+// ETAEstimate is the result of an ETA calculation along with how it was computed
+type ETAEstimate struct {
+	EstimatedArrival    time.Time `json:"estimated_arrival"`
+	Source              string    `json:"source"`     // GOOGLE_MAPS, HERE, HAVERSINE, PLANNED
+	Confidence          float64   `json:"confidence"` // 0-1 scale
+	DistanceKm          float64   `json:"distance_km"`
+	DurationMinutes     float64   `json:"duration_minutes"`
+	TrafficDelayMinutes float64   `json:"traffic_delay_minutes"`
+	NextMilestone       string    `json:"next_milestone,omitempty"`
+	CalculatedAt        time.Time `json:"calculated_at"`
+	// Time added for the weather forecast on the remaining route, included
+	// in the duration, and the worst condition forecast
+	WeatherDelayMinutes float64 `json:"weather_delay_minutes"`
+	WeatherCondition    string  `json:"weather_condition,omitempty"`
+
+	weatherSlowdown  float64
+	weatherCheckedAt *time.Time
+}
+
+// speedKmh returns the average speed of the estimate, 60 km/h when it has no
+// distance to go
+func (e *ETAEstimate) speedKmh() float64 {
+	if e.DistanceKm > 0 && e.DurationMinutes > 0 {
+		return e.DistanceKm / (e.DurationMinutes / 60)
+	}
+	return 60
+}
+
+// defaultETAProviders returns the routing providers that have API keys
+// configured, in the configured order of preference. Each is called through
+// its circuit breaker, so a provider that is down is skipped until it recovers.
+func defaultETAProviders() []ETARouteProvider {
+	cfg := config.GetCircuitBreakerConfig()
+	var providers []ETARouteProvider
+	for _, name := range cfg.RoutingProviders {
+		if provider := routingProvider(name); provider != nil {
+			providers = append(providers, NewCircuitBreakerETAProvider(provider, GetCircuitBreaker(name), cfg.CallTimeout))
+		}
+	}
+	return providers
+}
+
+// SetETAProviders replaces the routing providers used for ETA calculation.
+// With no providers, ETAs are always calculated from straight-line distance.
+func (ts *TrackingService) SetETAProviders(providers ...ETARouteProvider) {
+	ts.etaProviders = providers
+}
+
+// CalculateETAEstimate calculates the ETA of a trip from its current location.
+// Routing providers are tried in order and the Haversine estimate is used when
+// none of them is available. The result is persisted on the trip and its tracking status.
+func (ts *TrackingService) CalculateETAEstimate(tripID uint) (estimate *ETAEstimate, err error) {
+	ctx, span := tracing.Start(ts.ctx, "TrackingService.CalculateETAEstimate", attribute.Int("trip.id", int(tripID)))
+	defer func() { tracing.End(span, err) }()
+	ts = ts.WithContext(ctx)
+
+	var trip models.Trip
+	if err := ts.db.First(&trip, tripID).Error; err != nil {
+		return nil, err
+	}
+
+	// If no current location, return original estimated arrival
+	if trip.CurrentLatitude == nil || trip.CurrentLongitude == nil {
+		return &ETAEstimate{
+			EstimatedArrival: trip.EstimatedArrival,
+			Source:           ETASourcePlanned,
+			Confidence:       0.2,
+			CalculatedAt:     time.Now(),
+		}, nil
+	}
+
+	current := Coordinate{Latitude: *trip.CurrentLatitude, Longitude: *trip.CurrentLongitude}
+	destination := Coordinate{Latitude: trip.DestinationLat, Longitude: trip.DestinationLng}
+
+	estimate = ts.estimateFromRoutingProviders(current, destination)
+	if estimate == nil {
+		estimate = ts.estimateFromHaversine(tripID, current, destination)
+	}
+
+	// Rain, snow and fog ahead slow the rest of the trip down
+	ts.applyWeather(&trip, current, estimate)
+
+	// With an itinerary the trip arrives after its remaining stops
+	if err := ts.updateStopProgress(tripID, current, estimate); err != nil {
+		tracing.Logf(ctx, "Failed to update stops of trip %d: %v", tripID, err)
+	}
+
+	if err := ts.persistETAEstimate(&trip, estimate); err != nil {
+		tracing.Logf(ctx, "Failed to persist ETA for trip %d: %v", tripID, err)
+	}
+
+	// Loads are picked up and delivered along the way
+	if err := ts.updateLoadETAs(tripID, current, estimate); err != nil {
+		tracing.Logf(ctx, "Failed to update load ETAs of trip %d: %v", tripID, err)
+	}
+	span.SetAttributes(attribute.String("eta.source", estimate.Source))
+
+	return estimate, nil
+}
+
+// estimateFromRoutingProviders returns the first successful road route estimate,
+// or nil if no provider is configured or all of them failed
+func (ts *TrackingService) estimateFromRoutingProviders(current, destination Coordinate) *ETAEstimate {
+	for _, provider := range ts.etaProviders {
+		ctx, span := tracing.Start(ts.ctx, "ETARouteProvider.EstimateRoute", attribute.String("eta.provider", provider.Name()))
+		route, err := provider.EstimateRoute(ctx, current, destination)
+		tracing.End(span, err)
+		if err != nil {
+			tracing.Logf(ctx, "ETA provider %s unavailable: %v", provider.Name(), err)
+			continue
+		}
+
+		confidence := 0.8
+		if route.IncludesTraffic {
+			confidence = 0.9
+		}
+
+		now := time.Now()
+		return &ETAEstimate{
+			EstimatedArrival:    now.Add(time.Duration(route.DurationMinutes * float64(time.Minute))),
+			Source:              provider.Name(),
+			Confidence:          confidence,
+			DistanceKm:          route.DistanceKm,
+			DurationMinutes:     route.DurationMinutes,
+			TrafficDelayMinutes: route.TrafficDelayMinutes,
+			CalculatedAt:        now,
+		}
+	}
+	return nil
+}
+
+// estimateFromHaversine estimates the ETA from the straight-line distance and
+// the average of recent speed readings
+func (ts *TrackingService) estimateFromHaversine(tripID uint, current, destination Coordinate) *ETAEstimate {
+	distance := geo.Distance(current.Latitude, current.Longitude,
+		destination.Latitude, destination.Longitude)
+
+	// Estimate average speed (default 60 km/h if no recent speed data)
+	avgSpeed := 60.0
+	confidence := 0.3
+
+	// Get recent tracking records to calculate average speed
+	var recentRecords []models.TrackingRecord
+	ts.db.Where("trip_id = ? AND speed IS NOT NULL", tripID).
+		Order("timestamp DESC").
+		Limit(5).
+		Find(&recentRecords)
+
+	if len(recentRecords) > 0 {
+		totalSpeed := 0.0
+		for _, record := range recentRecords {
+			if record.Speed != nil {
+				totalSpeed += *record.Speed
+			}
+		}
+		avgSpeed = totalSpeed / float64(len(recentRecords))
+		confidence = 0.5
+
+		// Ensure minimum speed to avoid division by zero
+		if avgSpeed < 10 {
+			avgSpeed = 30 // Default to 30 km/h for city driving
+		}
+	}
+
+	hoursToDestination := distance / avgSpeed
+	now := time.Now()
+	return &ETAEstimate{
+		EstimatedArrival: now.Add(time.Duration(hoursToDestination * float64(time.Hour))),
+		Source:           ETASourceHaversine,
+		Confidence:       confidence,
+		DistanceKm:       distance,
+		DurationMinutes:  hoursToDestination * 60,
+		CalculatedAt:     now,
+	}
+}
+
+// persistETAEstimate stores the ETA on the trip and its tracking status
+func (ts *TrackingService) persistETAEstimate(trip *models.Trip, estimate *ETAEstimate) error {
+	if err := ts.db.Model(trip).Update("estimated_arrival", estimate.EstimatedArrival).Error; err != nil {
+		return err
+	}
+
+	if err := ts.recordETAPrediction(trip.ID, estimate); err != nil {
+		tracing.Logf(ts.ctx, "Failed to record ETA prediction for trip %d: %v", trip.ID, err)
+	}
+
+	var trackingStatus models.TrackingStatus
+	if err := ts.db.Where("trip_id = ? AND load_id IS NULL", trip.ID).First(&trackingStatus).Error; err != nil {
+		trackingStatus = models.TrackingStatus{
+			TripID:            trip.ID,
+			CurrentStatus:     trip.Status,
+			StatusChangedAt:   estimate.CalculatedAt,
+			CompletionPercent: calculateCompletionPercent(trip.Status),
+			EstimatedArrival:  &estimate.EstimatedArrival,
+			ETASource:         estimate.Source,
+			ETAConfidence:     estimate.Confidence,
+			ETAUpdatedAt:      &estimate.CalculatedAt,
+			NextMilestone:     estimate.NextMilestone,
+			WeatherCondition:  estimate.WeatherCondition,
+			WeatherSlowdown:   estimate.weatherSlowdown,
+			WeatherCheckedAt:  estimate.weatherCheckedAt,
+		}
+		return ts.db.Create(&trackingStatus).Error
+	}
+
+	return ts.db.Model(&trackingStatus).Updates(map[string]interface{}{
+		"estimated_arrival":  estimate.EstimatedArrival,
+		"eta_source":         estimate.Source,
+		"eta_confidence":     estimate.Confidence,
+		"eta_updated_at":     estimate.CalculatedAt,
+		"next_milestone":     estimate.NextMilestone,
+		"weather_condition":  estimate.WeatherCondition,
+		"weather_slowdown":   estimate.weatherSlowdown,
+		"weather_checked_at": estimate.weatherCheckedAt,
+	}).Error
+}
+
+// Name returns the ETA source name of the Google Maps provider
+func (g *GoogleMapsService) Name() string {
+	return ETASourceGoogleMaps
+}
+
+// EstimateRoute returns the driving distance and duration in current traffic
+func (g *GoogleMapsService) EstimateRoute(ctx context.Context, origin, destination Coordinate) (*RoadRouteEstimate, error) {
+	now := time.Now()
+	directions, err := g.GetDirectionsContext(ctx,
+		fmt.Sprintf("%f,%f", origin.Latitude, origin.Longitude),
+		fmt.Sprintf("%f,%f", destination.Latitude, destination.Longitude),
+		DirectionOptions{
+			Mode:          "driving",
+			Units:         "metric",
+			DepartureTime: &now,
+			TrafficModel:  "best_guess",
+		})
+	if err != nil {
+		return nil, err
+	}
+	if directions.Status != "OK" || len(directions.Routes) == 0 {
+		return nil, fmt.Errorf("directions request failed with status %s", directions.Status)
+	}
+
+	// The route level totals are not always populated, so sum the legs
+	var distanceMeters, durationSeconds, trafficSeconds int
+	route := directions.Routes[0]
+	for _, leg := range route.Legs {
+		distanceMeters += leg.Distance.Value
+		durationSeconds += leg.Duration.Value
+	}
+	if distanceMeters == 0 {
+		distanceMeters = route.Distance.Value
+		durationSeconds = route.Duration.Value
+	}
+	trafficSeconds = route.TrafficDuration.Value
+	if durationSeconds == 0 {
+		return nil, errors.New("directions response has no duration")
+	}
+
+	estimate := &RoadRouteEstimate{
+		DistanceKm:      float64(distanceMeters) / 1000,
+		DurationMinutes: float64(durationSeconds) / 60,
+	}
+	if trafficSeconds > 0 {
+		estimate.IncludesTraffic = true
+		estimate.TrafficDelayMinutes = math.Max(0, float64(trafficSeconds-durationSeconds)/60)
+		estimate.DurationMinutes = float64(trafficSeconds) / 60
+	}
+	return estimate, nil
+}
+
+// Name returns the ETA source name of the HERE provider
+func (h *HEREAPIService) Name() string {
+	return ETASourceHERE
+}
+
+// EstimateRoute returns the driving distance and duration including live traffic
+func (h *HEREAPIService) EstimateRoute(ctx context.Context, origin, destination Coordinate) (*RoadRouteEstimate, error) {
+	route, err := h.getRouteWithTraffic(ctx,
+		fmt.Sprintf("%f,%f", origin.Latitude, origin.Longitude),
+		fmt.Sprintf("%f,%f", destination.Latitude, destination.Longitude))
+	if err != nil {
+		return nil, err
+	}
+	if len(route.Routes) == 0 {
+		return nil, fmt.Errorf("no routes found")
+	}
+
+	summary := route.Routes[0].Summary
+	if summary.Duration == 0 {
+		// Summaries are returned per section in Routing API v8
+		for _, section := range route.Routes[0].Sections {
+			summary.Duration += section.Summary.Duration
+			summary.Length += section.Summary.Length
+			summary.TrafficDelay += section.Summary.TrafficDelay
+		}
+	}
+	if summary.Duration == 0 {
+		return nil, errors.New("route response has no duration")
+	}
+
+	return &RoadRouteEstimate{
+		DistanceKm:          float64(summary.Length) / 1000,
+		DurationMinutes:     float64(summary.Duration) / 60,
+		TrafficDelayMinutes: float64(summary.TrafficDelay) / 60,
+		IncludesTraffic:     true,
+	}, nil
+}
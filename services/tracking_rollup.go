@@ -0,0 +1,195 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Resolutions the tracking history is served at
+const (
+	TrackingResolutionRaw = "raw"
+	TrackingResolution5m  = "5m"
+	TrackingResolution1h  = "1h"
+)
+
+// trackingRollupBuckets are the intervals trips' records are aggregated over
+var trackingRollupBuckets = map[string]time.Duration{
+	TrackingResolution5m: 5 * time.Minute,
+	TrackingResolution1h: time.Hour,
+}
+
+// trackingRollupLookback is how far back the first rollup after a start
+// looks for trips with new records
+const trackingRollupLookback = 24 * time.Hour
+
+// IsTrackingResolution tells whether resolution is one the history is
+// served at
+func IsTrackingResolution(resolution string) bool {
+	_, ok := trackingRollupBuckets[resolution]
+	return ok || resolution == TrackingResolutionRaw
+}
+
+// TrackingRollupService aggregates trips' tracking records into 5 minute
+// and hourly buckets
+type TrackingRollupService struct {
+	db  *gorm.DB
+	now func() time.Time
+
+	mu sync.Mutex
+	// Trips updated since are rolled up by the next run
+	since time.Time
+}
+
+// NewTrackingRollupService creates a new TrackingRollupService
+func NewTrackingRollupService(db *gorm.DB) *TrackingRollupService {
+	return &TrackingRollupService{db: db, now: time.Now, since: time.Now().Add(-trackingRollupLookback)}
+}
+
+// RollupRecent rolls up the trips with location updates since the last run
+func (s *TrackingRollupService) RollupRecent() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Updates being committed as the run starts are picked up by the next
+	started := s.now().Add(-time.Minute)
+	// Trips are found by when their records arrived, since positions synced
+	// late are older than the trip's last location
+	var tripIDs []uint
+	if err := s.db.Model(&models.TrackingRecord{}).Where("created_at >= ?", s.since).
+		Distinct("trip_id").Pluck("trip_id", &tripIDs).Error; err != nil {
+		return fmt.Errorf("failed to get trips to roll up: %w", err)
+	}
+
+	failed := 0
+	for _, tripID := range tripIDs {
+		if err := s.RollupTrip(tripID); err != nil {
+			log.Printf("Failed to roll up tracking records of trip %d: %v", tripID, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to roll up %d of %d trips", failed, len(tripIDs))
+	}
+	s.since = started
+	return nil
+}
+
+// RollupTrip recomputes the aggregates of a trip from the first hour with
+// records created since its last rollup
+func (s *TrackingRollupService) RollupTrip(tripID uint) error {
+	computedAt := s.now()
+
+	var latest models.TrackingAggregate
+	lastRollup := time.Time{}
+	if err := s.db.Where("trip_id = ?", tripID).Order("computed_at DESC").Limit(1).Find(&latest).Error; err != nil {
+		return err
+	}
+	if latest.ID != 0 {
+		lastRollup = latest.ComputedAt
+	}
+
+	var earliest models.TrackingRecord
+	err := s.db.Where("trip_id = ? AND created_at >= ?", tripID, lastRollup).
+		Order("timestamp ASC").Limit(1).Find(&earliest).Error
+	if err != nil {
+		return err
+	}
+	if earliest.ID == 0 {
+		return nil
+	}
+
+	// Hours hold whole 5 minute buckets, so both resolutions restart here
+	start := earliest.Timestamp.Truncate(time.Hour)
+
+	// The distance to the first position is from the one before
+	var previous models.TrackingRecord
+	if err := s.db.Where("trip_id = ? AND timestamp < ?", tripID, start).
+		Order("timestamp DESC").Order("id DESC").Limit(1).Find(&previous).Error; err != nil {
+		return err
+	}
+	var records []models.TrackingRecord
+	if err := s.db.Where("trip_id = ? AND timestamp >= ?", tripID, start).
+		Order("timestamp ASC").Order("id ASC").Find(&records).Error; err != nil {
+		return err
+	}
+
+	var aggregates []models.TrackingAggregate
+	for resolution, bucket := range trackingRollupBuckets {
+		var before *models.TrackingRecord
+		if previous.ID != 0 {
+			before = &previous
+		}
+		aggregates = append(aggregates, aggregateTrackingRecords(tripID, resolution, bucket, before, records, computedAt)...)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("trip_id = ? AND bucket_start >= ?", tripID, start).Delete(&models.TrackingAggregate{}).Error; err != nil {
+			return err
+		}
+		if len(aggregates) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(aggregates, 500).Error
+	})
+}
+
+// aggregateTrackingRecords aggregates records ordered by time into buckets
+// of the given length. The distance to the first record is from before.
+func aggregateTrackingRecords(tripID uint, resolution string, bucket time.Duration, before *models.TrackingRecord, records []models.TrackingRecord, computedAt time.Time) []models.TrackingAggregate {
+	var aggregates []models.TrackingAggregate
+	var current *models.TrackingAggregate
+	speedSum, speeds := 0.0, 0
+
+	closeBucket := func() {
+		if current == nil {
+			return
+		}
+		if speeds > 0 {
+			avg := speedSum / float64(speeds)
+			current.AvgSpeed = &avg
+		}
+		aggregates = append(aggregates, *current)
+	}
+
+	for i := range records {
+		record := &records[i]
+		bucketStart := record.Timestamp.Truncate(bucket)
+		if current == nil || !current.BucketStart.Equal(bucketStart) {
+			closeBucket()
+			current = &models.TrackingAggregate{
+				TripID:         tripID,
+				Resolution:     resolution,
+				BucketStart:    bucketStart,
+				FirstTimestamp: record.Timestamp,
+				ComputedAt:     computedAt,
+			}
+			speedSum, speeds = 0, 0
+		}
+
+		latitude, longitude, _ := TrackPosition(*record)
+		if before != nil {
+			fromLat, fromLng, _ := TrackPosition(*before)
+			current.DistanceKm += geo.Distance(fromLat, fromLng, latitude, longitude)
+		}
+		current.Latitude, current.Longitude = latitude, longitude
+		current.LastTimestamp = record.Timestamp
+		current.PointCount++
+		if record.Speed != nil {
+			speedSum += *record.Speed
+			speeds++
+			if current.MaxSpeed == nil || *record.Speed > *current.MaxSpeed {
+				speed := *record.Speed
+				current.MaxSpeed = &speed
+			}
+		}
+		before = record
+	}
+	closeBucket()
+	return aggregates
+}
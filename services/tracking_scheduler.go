@@ -0,0 +1,242 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ScheduledJob is a unit of periodic background work
+type ScheduledJob struct {
+	Name     string
+	Interval time.Duration
+	Run      func() error
+	LastRun  time.Time
+	LastErr  error
+}
+
+// TrackingScheduler periodically runs tracking maintenance jobs such as
+// delay alert processing, ETA refreshes, stale data and anomaly detection
+type TrackingScheduler struct {
+	db              *gorm.DB
+	trackingService *TrackingService
+	config          *config.SchedulerConfig
+	jobs            []*ScheduledJob
+	mutex           sync.Mutex
+	stopChan        chan struct{}
+	wg              sync.WaitGroup
+}
+
+// NewTrackingScheduler creates a new tracking scheduler with the default jobs registered
+func NewTrackingScheduler(db *gorm.DB, cfg *config.SchedulerConfig) *TrackingScheduler {
+	s := &TrackingScheduler{
+		db:              db,
+		trackingService: NewTrackingService(db),
+		config:          cfg,
+		stopChan:        make(chan struct{}),
+	}
+
+	s.RegisterJob("delay_alerts", cfg.DelayCheckInterval, s.processDelayAlerts)
+	s.RegisterJob("eta_refresh", cfg.ETARefreshInterval, s.refreshETAs)
+	s.RegisterJob("stale_data", cfg.StaleDataCheckInterval, s.flagStaleTrackingData)
+	s.RegisterJob("anomaly_detection", cfg.AnomalyCheckInterval, s.processAnomalies)
+
+	return s
+}
+
+// RegisterJob adds a job to the scheduler. Jobs must be registered before Start is called.
+func (s *TrackingScheduler) RegisterJob(name string, interval time.Duration, run func() error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.jobs = append(s.jobs, &ScheduledJob{
+		Name:     name,
+		Interval: interval,
+		Run:      run,
+	})
+}
+
+// Start starts a worker goroutine for every registered job
+func (s *TrackingScheduler) Start() {
+	if !s.config.Enabled {
+		log.Println("Tracking scheduler disabled")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.runJob(job)
+	}
+
+	log.Printf("Tracking scheduler started with %d jobs", len(s.jobs))
+}
+
+// Stop signals all jobs to stop and waits for running jobs to finish
+func (s *TrackingScheduler) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+	log.Println("Tracking scheduler stopped")
+}
+
+// GetJobStatus returns the last run time and error of every registered job
+func (s *TrackingScheduler) GetJobStatus() []map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	status := make([]map[string]interface{}, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		entry := map[string]interface{}{
+			"name":     job.Name,
+			"interval": job.Interval.String(),
+			"last_run": job.LastRun,
+		}
+		if job.LastErr != nil {
+			entry["last_error"] = job.LastErr.Error()
+		}
+		status = append(status, entry)
+	}
+	return status
+}
+
+// runJob runs a job on its interval until the scheduler is stopped
+func (s *TrackingScheduler) runJob(job *ScheduledJob) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := job.Run()
+			if err != nil {
+				log.Printf("Scheduled job %s failed: %v", job.Name, err)
+			}
+
+			s.mutex.Lock()
+			job.LastRun = time.Now()
+			job.LastErr = err
+			s.mutex.Unlock()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// getActiveTrips returns all trips that are currently ACTIVE or IN_TRANSIT
+func (s *TrackingScheduler) getActiveTrips() ([]models.Trip, error) {
+	var trips []models.Trip
+	err := s.db.Where("status IN ?", []string{"ACTIVE", "IN_TRANSIT"}).Find(&trips).Error
+	return trips, err
+}
+
+// processDelayAlerts checks every active trip for delays and sends alerts
+func (s *TrackingScheduler) processDelayAlerts() error {
+	trips, err := s.getActiveTrips()
+	if err != nil {
+		return fmt.Errorf("failed to get active trips: %w", err)
+	}
+
+	for _, trip := range trips {
+		delayInfo, err := s.trackingService.CheckForDelays(trip.ID)
+		if err != nil {
+			log.Printf("Failed to check delays for trip %d: %v", trip.ID, err)
+			continue
+		}
+
+		if delayInfo != nil {
+			if err := s.trackingService.ProcessDelayAlerts(trip.ID); err != nil {
+				log.Printf("Failed to process delay alerts for trip %d: %v", trip.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// refreshETAs recalculates the ETA of every active trip with a known location
+func (s *TrackingScheduler) refreshETAs() error {
+	trips, err := s.getActiveTrips()
+	if err != nil {
+		return fmt.Errorf("failed to get active trips: %w", err)
+	}
+
+	for _, trip := range trips {
+		if trip.CurrentLatitude == nil || trip.CurrentLongitude == nil {
+			continue
+		}
+
+		if _, err := s.trackingService.RefreshETA(trip.ID); err != nil {
+			log.Printf("Failed to refresh ETA for trip %d: %v", trip.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// flagStaleTrackingData logs a STALE_DATA event for active trips whose last
+// location update is older than the configured threshold. Each trip is flagged
+// at most once per missed update.
+func (s *TrackingScheduler) flagStaleTrackingData() error {
+	trips, err := s.getActiveTrips()
+	if err != nil {
+		return fmt.Errorf("failed to get active trips: %w", err)
+	}
+
+	cutoff := time.Now().Add(-s.config.StaleDataThreshold)
+
+	for _, trip := range trips {
+		if !trip.TrackingEnabled || trip.LastLocationUpdate == nil || trip.LastLocationUpdate.After(cutoff) {
+			continue
+		}
+
+		// Skip trips that were already flagged since their last update
+		var count int64
+		s.db.Model(&models.TrackingEvent{}).
+			Where("trip_id = ? AND event_type = ? AND timestamp > ?", trip.ID, "STALE_DATA", *trip.LastLocationUpdate).
+			Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		minutesSinceUpdate := int(time.Since(*trip.LastLocationUpdate).Minutes())
+		s.trackingService.LogTrackingEvent(trip.ID, nil, "STALE_DATA",
+			fmt.Sprintf(`{"minutes_since_update":%d}`, minutesSinceUpdate),
+			"", trip.CurrentLatitude, trip.CurrentLongitude,
+			fmt.Sprintf("No location updates for %d minutes", minutesSinceUpdate))
+
+		if err := s.trackingService.RecoverFromTrackingError(trip.ID, "STALE_DATA"); err != nil {
+			log.Printf("Failed to request location update for trip %d: %v", trip.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// processAnomalies records anomalies in the tracking data of every active
+// trip with tracking enabled
+func (s *TrackingScheduler) processAnomalies() error {
+	trips, err := s.getActiveTrips()
+	if err != nil {
+		return fmt.Errorf("failed to get active trips: %w", err)
+	}
+
+	for _, trip := range trips {
+		if !trip.TrackingEnabled {
+			continue
+		}
+		if _, err := s.trackingService.ProcessAnomalies(trip.ID); err != nil {
+			log.Printf("Failed to process anomalies for trip %d: %v", trip.ID, err)
+		}
+	}
+
+	return nil
+}
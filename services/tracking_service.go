@@ -1,13 +1,21 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
 	"math"
 	"strings"
 	"time"
+	"triplink/backend/apierror"
+	"triplink/backend/config"
+	"triplink/backend/internal/geo"
+	"triplink/backend/metrics"
 	"triplink/backend/models"
-	
+	"triplink/backend/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/gorm"
 )
 
@@ -20,6 +28,35 @@ type LocationUpdate struct {
 	Heading   *float64 `json:"heading,omitempty"`
 	Accuracy  *float64 `json:"accuracy,omitempty"`
 	Source    string   `json:"source"`
+	// Battery level of the device in percent, used to recommend tracking settings
+	BatteryLevel *float64 `json:"battery_level,omitempty"`
+	// Posted speed limit at the position in km/h, used to score speeding
+	SpeedLimit *float64 `json:"speed_limit,omitempty"`
+
+	// Assigned driver posting the update, set from the authenticated user
+	DriverID *uint `json:"-"`
+
+	// Time the position was recorded, when reported later than that, e.g. by
+	// offline sync or telematics providers. Defaults to the time received.
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+// ErrDuplicateLocationUpdate is returned for a position already recorded for
+// the trip at the same time
+var ErrDuplicateLocationUpdate = errors.New("location update already recorded")
+
+// LocationBatchResult summarizes the ingestion of a batch of location updates
+type LocationBatchResult struct {
+	TotalRecords int      `json:"total_records"`
+	SuccessCount int      `json:"success_count"`
+	ErrorCount   int      `json:"error_count"`
+	Errors       []string `json:"errors"`
+	// Records snapped to the road network
+	MatchedCount int `json:"matched_count"`
+	// Updates skipped because they were already recorded
+	DuplicateCount int `json:"duplicate_count"`
+	// Updates dropped as too inaccurate
+	FilteredCount int `json:"filtered_count"`
 }
 
 // DelayInfo represents delay information
@@ -31,21 +68,78 @@ type DelayInfo struct {
 
 // TrackingService provides tracking-related operations
 type TrackingService struct{
-	db *gorm.DB
+	db             *gorm.DB
+	ctx            context.Context
+	etaProviders   []ETARouteProvider
+	routeProviders []PlannedRouteProvider
+	detention      *config.DetentionConfig
+	mapMatching    *config.MapMatchingConfig
+	mapMatcher     MapMatcher
+	locationFilter *config.LocationFilterConfig
+	autoStatus     *config.AutoStatusConfig
+	device         *config.DeviceTrackingConfig
+	weather        WeatherAPIService
+	weatherConfig  *config.WeatherConfig
 }
 
 // NewTrackingService creates a new tracking service instance
 func NewTrackingService(db *gorm.DB) *TrackingService {
-	return &TrackingService{db: db}
+	mapMatching := config.GetMapMatchingConfig()
+	return &TrackingService{
+		db:             db,
+		ctx:            context.Background(),
+		etaProviders:   defaultETAProviders(),
+		routeProviders: defaultPlannedRouteProviders(),
+		detention:      config.GetDetentionConfig(),
+		mapMatching:    mapMatching,
+		mapMatcher:     DefaultMapMatcher(mapMatching),
+		locationFilter: config.GetLocationFilterConfig(),
+		autoStatus:     config.GetAutoStatusConfig(),
+		device:         config.GetDeviceTrackingConfig(),
+		weather:        defaultWeatherService(),
+		weatherConfig:  config.GetWeatherConfig(),
+	}
+}
+
+// WithContext returns a copy of the service whose spans, queries and calls to
+// routing providers belong to the trace in ctx
+func (ts *TrackingService) WithContext(ctx context.Context) *TrackingService {
+	clone := *ts
+	clone.ctx = ctx
+	clone.db = ts.db.WithContext(ctx)
+	return &clone
 }
 
 // UpdateLocation updates the location for a trip
-func (ts *TrackingService) UpdateLocation(tripID uint, location LocationUpdate) error {
+func (ts *TrackingService) UpdateLocation(tripID uint, location LocationUpdate) (err error) {
+	ctx, span := tracing.Start(ts.ctx, "TrackingService.UpdateLocation",
+		attribute.Int("trip.id", int(tripID)),
+		attribute.String("location.source", location.Source))
+	defer func() { tracing.End(span, err) }()
+	ts = ts.WithContext(ctx)
+
 	// Validate coordinates
 	if !isValidCoordinate(location.Latitude, location.Longitude) {
+		metrics.ObserveLocationUpdate(location.Source, metrics.LocationRejected)
 		return errors.New("invalid coordinates")
 	}
 
+	if err := ts.checkTrackingEnabled(tripID); err != nil {
+		metrics.ObserveLocationUpdate(location.Source, metrics.LocationRejected)
+		return err
+	}
+
+	if !ts.acceptsLocation(location) {
+		metrics.ObserveLocationUpdate(location.Source, metrics.LocationFiltered)
+		return ErrInaccurateLocation
+	}
+
+	// Times are compared with those stored, at the precision of the database
+	recordedAt := time.Now().UTC().Truncate(time.Microsecond)
+	if location.Timestamp != nil {
+		recordedAt = location.Timestamp.UTC().Truncate(time.Microsecond)
+	}
+
 	// Create tracking record
 	trackingRecord := models.TrackingRecord{
 		TripID:    tripID,
@@ -55,155 +149,338 @@ func (ts *TrackingService) UpdateLocation(tripID uint, location LocationUpdate)
 		Speed:     location.Speed,
 		Heading:   location.Heading,
 		Accuracy:  location.Accuracy,
-		Timestamp: time.Now(),
+		Timestamp: recordedAt,
 		Source:    location.Source,
 		Status:    "ACTIVE",
-	}
 
-	// Save tracking record
-	if err := ts.db.Create(&trackingRecord).Error; err != nil {
-		return err
-	}
+		BatteryLevel: location.BatteryLevel,
+		DriverID:     location.DriverID,
+		SpeedLimit:   location.SpeedLimit,
+	}
+
+	// Save the tracking record and the trip's current location together,
+	// along with the outbox event when location updates are published
+	latest := false
+	err = ts.db.Transaction(func(tx *gorm.DB) error {
+		// Devices retry and resend buffered positions on every sync
+		var recorded int64
+		if err := tx.Model(&models.TrackingRecord{}).
+			Where("trip_id = ? AND timestamp = ? AND latitude = ? AND longitude = ?",
+				tripID, recordedAt, location.Latitude, location.Longitude).
+			Count(&recorded).Error; err != nil {
+			return err
+		}
+		if recorded > 0 {
+			return ErrDuplicateLocationUpdate
+		}
 
-	// Update trip's current location
-	now := time.Now()
-	err := ts.db.Model(&models.Trip{}).Where("id = ?", tripID).Updates(map[string]interface{}{
-		"current_latitude":     location.Latitude,
-		"current_longitude":    location.Longitude,
-		"last_location_update": &now,
-	}).Error
+		if err := ts.smoothLocation(tx, &trackingRecord); err != nil {
+			return err
+		}
+		if err := tx.Create(&trackingRecord).Error; err != nil {
+			return err
+		}
+
+		// Positions older than the trip's current location only go into
+		// its history. The trip is placed on the smoothed track.
+		latitude, longitude := SmoothedPosition(trackingRecord)
+		result := tx.Model(&models.Trip{}).
+			Where("id = ? AND (last_location_update IS NULL OR last_location_update < ?)", tripID, recordedAt).
+			Updates(map[string]interface{}{
+				"current_latitude":     latitude,
+				"current_longitude":    longitude,
+				"last_location_update": recordedAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		latest = result.RowsAffected > 0
 
+		if LocationOutboxEnabled() {
+			return RecordLocationUpdate(tx, &trackingRecord)
+		}
+		return nil
+	})
+	if errors.Is(err, ErrDuplicateLocationUpdate) {
+		metrics.ObserveLocationUpdate(location.Source, metrics.LocationDuplicate)
+		return err
+	}
 	if err != nil {
+		metrics.ObserveLocationUpdate(location.Source, metrics.LocationFailed)
 		return err
 	}
+	metrics.ObserveLocationUpdate(location.Source, metrics.LocationRecorded)
+	if !latest {
+		return nil
+	}
+	ts.cacheLocation(&trackingRecord)
+
+	// Stream the update to clients following the trip
+	if err := GetLocationHub().Publish(TripLocationUpdate{
+		TripID:    tripID,
+		RecordID:  trackingRecord.ID,
+		Latitude:  trackingRecord.Latitude,
+		Longitude: trackingRecord.Longitude,
+		Altitude:  trackingRecord.Altitude,
+		Speed:     trackingRecord.Speed,
+		Heading:   trackingRecord.Heading,
+		Accuracy:  trackingRecord.Accuracy,
+		Source:    trackingRecord.Source,
+		Timestamp: trackingRecord.Timestamp,
+	}); err != nil {
+		tracing.Logf(ctx, "Failed to publish location update for trip %d: %v", tripID, err)
+	}
+
+	// Progress is measured along the route to the new location
+	latitude, longitude := SmoothedPosition(trackingRecord)
+	if err := ts.updateTripProgress(tripID, Coordinate{Latitude: latitude, Longitude: longitude}); err != nil {
+		tracing.Logf(ctx, "Failed to update progress of trip %d: %v", tripID, err)
+	}
+
+	// Statuses drivers forget to set follow the trip's movement
+	if err := ts.applyAutoStatus(&trackingRecord); err != nil {
+		tracing.Logf(ctx, "Failed to update status of trip %d from its location: %v", tripID, err)
+	}
 
 	// Update ETA based on new location
-	_, err = ts.CalculateETA(tripID)
+	_, err = ts.RefreshETA(tripID)
 	return err
 }
 
-// GetCurrentLocation retrieves the most recent location for a trip
+// GetCurrentLocation retrieves the most recent location for a trip, from the
+// trip location cache when it holds it
 func (ts *TrackingService) GetCurrentLocation(tripID uint) (*models.TrackingRecord, error) {
+	cache := GetTripLocationCache()
+	if cache != nil {
+		if location, err := cache.GetLocation(tripID); err == nil {
+			return location, nil
+		} else if !errors.Is(err, ErrTripLocationCacheMiss) {
+			tracing.Logf(ts.ctx, "Failed to read cached location of trip %d: %v", tripID, err)
+		}
+	}
+
 	var trackingRecord models.TrackingRecord
-	err := ts.db.Where("trip_id = ?", tripID).Order("timestamp DESC").First(&trackingRecord).Error
+	err := TripTrackingRecords(ts.db, tripID).Order("timestamp DESC").First(&trackingRecord).Error
 
 	if err != nil {
 		return nil, err
 	}
 
+	if cache != nil {
+		if err := cache.SetLocation(&trackingRecord); err != nil {
+			tracing.Logf(ts.ctx, "Failed to cache location of trip %d: %v", tripID, err)
+		}
+	}
 	return &trackingRecord, nil
 }
 
-// CalculateETA calculates estimated time of arrival based on current location
+// cacheLocation caches a newly recorded location unless a more recent one
+// is cached, as devices upload positions buffered while offline late
+func (ts *TrackingService) cacheLocation(record *models.TrackingRecord) {
+	cache := GetTripLocationCache()
+	if cache == nil {
+		return
+	}
+	if cached, err := cache.GetLocation(record.TripID); err == nil && cached.Timestamp.After(record.Timestamp) {
+		return
+	}
+	if err := cache.SetLocation(record); err != nil {
+		tracing.Logf(ts.ctx, "Failed to cache location of trip %d: %v", record.TripID, err)
+	}
+}
+
+// CalculateETA returns the estimated time of arrival of a trip, from the trip
+// location cache when it holds it and calculated from its current location
+// otherwise
 func (ts *TrackingService) CalculateETA(tripID uint) (*time.Time, error) {
+	if cache := GetTripLocationCache(); cache != nil {
+		if eta, err := cache.GetETA(tripID); err == nil {
+			return eta, nil
+		} else if !errors.Is(err, ErrTripLocationCacheMiss) {
+			tracing.Logf(ts.ctx, "Failed to read cached ETA of trip %d: %v", tripID, err)
+		}
+	}
+	return ts.RefreshETA(tripID)
+}
+
+// RefreshETA recalculates the ETA of a trip from its current location and
+// caches it
+func (ts *TrackingService) RefreshETA(tripID uint) (*time.Time, error) {
+	estimate, err := ts.CalculateETAEstimate(tripID)
+	if err != nil {
+		return nil, err
+	}
+	if cache := GetTripLocationCache(); cache != nil {
+		if err := cache.SetETA(tripID, estimate.EstimatedArrival); err != nil {
+			tracing.Logf(ts.ctx, "Failed to cache ETA of trip %d: %v", tripID, err)
+		}
+	}
+	return &estimate.EstimatedArrival, nil
+}
+
+// UpdateTripStatus updates the status of a trip with validation
+func (ts *TrackingService) UpdateTripStatus(tripID uint, newStatus string) error {
+	_, err := ts.ChangeTripStatus(tripID, newStatus, nil)
+	return err
+}
+
+// ChangeTripStatus moves a trip to a status its status machine allows,
+// rejecting the change with a StatusTransitionError otherwise. With a
+// version, the change is only applied if the trip is still at it.
+func (ts *TrackingService) ChangeTripStatus(tripID uint, newStatus string, version *uint) (*models.Trip, error) {
 	var trip models.Trip
 	if err := ts.db.First(&trip, tripID).Error; err != nil {
 		return nil, err
 	}
-
-	// If no current location, return original estimated arrival
-	if trip.CurrentLatitude == nil || trip.CurrentLongitude == nil {
-		return &trip.EstimatedArrival, nil
+	change := StatusChange{ID: tripID, From: trip.Status, To: newStatus, Version: trip.Version, TripID: tripID, At: time.Now()}
+	if version != nil {
+		change.Version = *version
 	}
 
-	// Calculate distance to destination
-	distance := calculateDistance(*trip.CurrentLatitude, *trip.CurrentLongitude,
-		trip.DestinationLat, trip.DestinationLng)
+	previousStatus := trip.Status
+	now := change.At
+	var arrival time.Time
+	if newStatus == "COMPLETED" {
+		if trip.ActualArrival != nil {
+			arrival = *trip.ActualArrival
+		} else {
+			arrival = ts.tripArrivalTime(tripID, now)
+			change.Updates = map[string]interface{}{"actual_arrival": arrival}
+		}
+	}
 
-	// Estimate average speed (default 60 km/h if no recent speed data)
-	avgSpeed := 60.0
+	// The status, its tracking status and its event are committed together,
+	// so the event is published if and only if the status changed
+	err := ts.db.Transaction(func(tx *gorm.DB) error {
+		if err := TripStatusMachine.Apply(tx, change); err != nil {
+			return err
+		}
 
-	// Get recent tracking records to calculate average speed
-	var recentRecords []models.TrackingRecord
-	ts.db.Where("trip_id = ? AND speed IS NOT NULL", tripID).
-		Order("timestamp DESC").
-		Limit(5).
-		Find(&recentRecords)
-
-	if len(recentRecords) > 0 {
-		totalSpeed := 0.0
-		for _, record := range recentRecords {
-			if record.Speed != nil {
-				totalSpeed += *record.Speed
+		// Create or update tracking status record
+		var trackingStatus models.TrackingStatus
+		result := tx.Where("trip_id = ? AND load_id IS NULL", tripID).First(&trackingStatus)
+
+		if result.Error != nil {
+			// Create new tracking status
+			trackingStatus = models.TrackingStatus{
+				TripID:            tripID,
+				CurrentStatus:     newStatus,
+				PreviousStatus:    previousStatus,
+				StatusChangedAt:   now,
+				CompletionPercent: calculateCompletionPercent(newStatus),
+			}
+			if err := tx.Create(&trackingStatus).Error; err != nil {
+				return err
+			}
+		} else {
+			// Update existing tracking status
+			trackingStatus.PreviousStatus = trackingStatus.CurrentStatus
+			trackingStatus.CurrentStatus = newStatus
+			trackingStatus.StatusChangedAt = now
+			// Once located on its route, a trip's progress is its distance
+			// covered until it completes
+			if trackingStatus.RouteDistanceKm == 0 || newStatus == "COMPLETED" {
+				trackingStatus.CompletionPercent = calculateCompletionPercent(newStatus)
+			}
+			if err := tx.Save(&trackingStatus).Error; err != nil {
+				return err
 			}
 		}
-		avgSpeed = totalSpeed / float64(len(recentRecords))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		// Ensure minimum speed to avoid division by zero
-		if avgSpeed < 10 {
-			avgSpeed = 30 // Default to 30 km/h for city driving
+	// Closed trips no longer move, so their cached location and ETA go
+	if newStatus == "COMPLETED" || newStatus == "CANCELLED" {
+		if cache := GetTripLocationCache(); cache != nil {
+			if err := cache.Invalidate(tripID); err != nil {
+				log.Printf("Failed to invalidate cached location of trip %d: %v", tripID, err)
+			}
 		}
 	}
 
-	// Calculate ETA
-	hoursToDestination := distance / avgSpeed
-	eta := time.Now().Add(time.Duration(hoursToDestination * float64(time.Hour)))
-
-	// Update trip's estimated arrival
-	ts.db.Model(&trip).Update("estimated_arrival", eta)
+	// Evaluate the ETAs and delays predicted for the trip against its arrival
+	if newStatus == "COMPLETED" {
+		if err := ts.ResolveETAPredictions(tripID, arrival); err != nil {
+			log.Printf("Failed to resolve ETA predictions for trip %d: %v", tripID, err)
+		}
+		if err := ResolveDelayPredictions(ts.db, tripID, arrival); err != nil {
+			log.Printf("Failed to resolve delay predictions for trip %d: %v", tripID, err)
+		}
+	}
 
-	return &eta, nil
+	if err := ts.db.First(&trip, tripID).Error; err != nil {
+		return nil, err
+	}
+	return &trip, nil
 }
 
-// UpdateTripStatus updates the status of a trip with validation
-func (ts *TrackingService) UpdateTripStatus(tripID uint, newStatus string) error {
-	var trip models.Trip
-	if err := ts.db.First(&trip, tripID).Error; err != nil {
-		return err
+// ChangeLoadStatus moves a load to a status its status machine allows, like
+// ChangeTripStatus for trips
+func (ts *TrackingService) ChangeLoadStatus(loadID uint, newStatus string, version *uint) (*models.Load, error) {
+	var load models.Load
+	if err := ts.db.First(&load, loadID).Error; err != nil {
+		return nil, err
+	}
+	change := StatusChange{ID: loadID, From: load.Status, To: newStatus, Version: load.Version, TripID: load.TripID, LoadID: &load.ID, At: time.Now()}
+	if version != nil {
+		change.Version = *version
 	}
 
-	// Validate status transition
-	if !isValidStatusTransition(trip.Status, newStatus) {
-		return errors.New("invalid status transition")
+	// The status, its tracking status and its event are committed together,
+	// so the event is published if and only if the status changed
+	err := ts.db.Transaction(func(tx *gorm.DB) error {
+		return applyLoadStatus(tx, change)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Update trip status
-	previousStatus := trip.Status
-	now := time.Now()
+	previousStatus := load.Status
+	if err := ts.db.First(&load, loadID).Error; err != nil {
+		return nil, err
+	}
+	if load.Status == "EXCEPTION" {
+		sendLoadExceptionAlert(ts.db, &load, previousStatus)
+	}
+	return &load, nil
+}
 
-	err := ts.db.Model(&trip).Updates(map[string]interface{}{
-		"status": newStatus,
-	}).Error
+// sendLoadExceptionAlert posts an alert of a load moved to EXCEPTION to the
+// channels of its trip's organization
+func sendLoadExceptionAlert(db *gorm.DB, load *models.Load, previousStatus string) {
+	sendTripOpsAlert(db, load.TripID, OpsAlert{
+		Type: OpsAlertLoadException,
+		Data: map[string]interface{}{"load_id": load.ID, "booking_reference": load.BookingReference, "previous_status": previousStatus},
+	})
+}
 
-	if err != nil {
+// applyLoadStatus applies a load status change and updates the load's
+// tracking status inside the transaction tx
+func applyLoadStatus(tx *gorm.DB, change StatusChange) error {
+	if err := LoadStatusMachine.Apply(tx, change); err != nil {
 		return err
 	}
 
-	// Create or update tracking status record
 	var trackingStatus models.TrackingStatus
-	result := ts.db.Where("trip_id = ?", tripID).First(&trackingStatus)
-
-	if result.Error != nil {
-		// Create new tracking status
+	if err := tx.Where("load_id = ?", change.ID).First(&trackingStatus).Error; err != nil {
 		trackingStatus = models.TrackingStatus{
-			TripID:            tripID,
-			CurrentStatus:     newStatus,
-			PreviousStatus:    previousStatus,
-			StatusChangedAt:   now,
-			CompletionPercent: calculateCompletionPercent(newStatus),
+			TripID:            change.TripID,
+			LoadID:            change.LoadID,
+			CurrentStatus:     change.To,
+			PreviousStatus:    change.From,
+			StatusChangedAt:   change.At,
+			CompletionPercent: calculateLoadCompletionPercent(change.To),
 		}
-		ts.db.Create(&trackingStatus)
-	} else {
-		// Update existing tracking status
-		trackingStatus.PreviousStatus = trackingStatus.CurrentStatus
-		trackingStatus.CurrentStatus = newStatus
-		trackingStatus.StatusChangedAt = now
-		trackingStatus.CompletionPercent = calculateCompletionPercent(newStatus)
-		ts.db.Save(&trackingStatus)
-	}
-
-	// Create tracking event
-	event := models.TrackingEvent{
-		TripID:      tripID,
-		EventType:   "STATUS_CHANGE",
-		EventData:   `{"from":"` + previousStatus + `","to":"` + newStatus + `"}`,
-		Location:    "",
-		Timestamp:   now,
-		Description: "Trip status changed from " + previousStatus + " to " + newStatus,
+		return tx.Create(&trackingStatus).Error
 	}
-	ts.db.Create(&event)
-
-	return nil
+	trackingStatus.PreviousStatus = trackingStatus.CurrentStatus
+	trackingStatus.CurrentStatus = change.To
+	trackingStatus.StatusChangedAt = change.At
+	trackingStatus.CompletionPercent = calculateLoadCompletionPercent(change.To)
+	return tx.Save(&trackingStatus).Error
 }
 
 // CheckForDelays checks if a trip is delayed and returns delay information
@@ -251,9 +528,7 @@ func (ts *TrackingService) ProcessDelayAlerts(tripID uint) error {
 
 	// Check if we should send an alert based on delay thresholds
 	shouldAlert := false
-	alertThresholds := []int{30, 60, 120, 240} // Alert at 30min, 1hr, 2hr, 4hr delays
-
-	for _, threshold := range alertThresholds {
+	for _, threshold := range config.CurrentAlertConfig().DelayThresholds {
 		if delayInfo.DelayMinutes >= threshold {
 			// Check if we've already sent an alert for this threshold
 			if !ts.hasDelayAlertBeenSent(tripID, threshold) {
@@ -274,12 +549,16 @@ func (ts *TrackingService) ProcessDelayAlerts(tripID uint) error {
 		// Create delay notification for each shipper
 		for _, load := range loads {
 			notification := models.Notification{
-				UserID:    load.ShipperID,
-				Title:     "Shipment Delayed",
-				Message:   fmt.Sprintf("Your shipment is delayed by %d minutes due to %s", delayInfo.DelayMinutes, delayInfo.Reason),
+				UserID:     load.ShipperID,
+				MessageKey: "notification.trip_delayed",
+				MessageParams: map[string]interface{}{
+					"minutes": delayInfo.DelayMinutes,
+					"reason":  delayInfo.Reason,
+				},
 				Type:      "TRIP_DELAYED",
 				RelatedID: tripID,
 			}
+			LocalizeNotification(ts.db, &notification)
 			ts.db.Create(&notification)
 		}
 
@@ -296,6 +575,13 @@ func (ts *TrackingService) ProcessDelayAlerts(tripID uint) error {
 
 		// Update tracking status with delay information
 		ts.updateDelayStatus(tripID, delayInfo.DelayMinutes, delayInfo.Reason)
+
+		if delayInfo.Severity == "CRITICAL" {
+			sendTripOpsAlert(ts.db, tripID, OpsAlert{
+				Type: OpsAlertCriticalDelay,
+				Data: map[string]interface{}{"delay_minutes": delayInfo.DelayMinutes, "reason": delayInfo.Reason},
+			})
+		}
 	}
 
 	return nil
@@ -304,7 +590,7 @@ func (ts *TrackingService) ProcessDelayAlerts(tripID uint) error {
 // updateDelayStatus updates the tracking status with delay information
 func (ts *TrackingService) updateDelayStatus(tripID uint, delayMinutes int, reason string) error {
 	var trackingStatus models.TrackingStatus
-	result := ts.db.Where("trip_id = ?", tripID).First(&trackingStatus)
+	result := ts.db.Where("trip_id = ? AND load_id IS NULL", tripID).First(&trackingStatus)
 
 	if result.Error != nil {
 		// Create new tracking status with delay info
@@ -347,63 +633,12 @@ func (ts *TrackingService) markDelayAlertSent(tripID uint, thresholdMinutes int)
 
 // DetectAnomalies detects unusual patterns in tracking data that might indicate issues
 func (ts *TrackingService) DetectAnomalies(tripID uint) ([]string, error) {
-	var anomalies []string
-
-	// Get recent tracking records
-	var records []models.TrackingRecord
-	err := ts.db.Where("trip_id = ?", tripID).
-		Order("timestamp DESC").
-		Limit(10).
-		Find(&records).Error
-
-	if err != nil || len(records) < 2 {
-		return anomalies, err
+	var descriptions []string
+	anomalies, err := ts.DetectTripAnomalies(tripID)
+	for _, anomaly := range anomalies {
+		descriptions = append(descriptions, anomaly.Description)
 	}
-
-	// Check for unusual speed patterns
-	for i := 0; i < len(records)-1; i++ {
-		current := records[i]
-		previous := records[i+1]
-
-		if current.Speed != nil && previous.Speed != nil {
-			speedDiff := math.Abs(*current.Speed - *previous.Speed)
-
-			// Flag sudden speed changes > 50 km/h
-			if speedDiff > 50 {
-				anomalies = append(anomalies, fmt.Sprintf("Sudden speed change detected: %.1f km/h difference", speedDiff))
-			}
-
-			// Flag unusually high speeds > 120 km/h
-			if *current.Speed > 120 {
-				anomalies = append(anomalies, fmt.Sprintf("High speed detected: %.1f km/h", *current.Speed))
-			}
-		}
-
-		// Check for location jumps (teleportation detection)
-		distance := calculateDistance(current.Latitude, current.Longitude, previous.Latitude, previous.Longitude)
-		timeDiff := current.Timestamp.Sub(previous.Timestamp).Hours()
-
-		if timeDiff > 0 {
-			impliedSpeed := distance / timeDiff
-
-			// Flag impossible speeds > 200 km/h for ground transport
-			if impliedSpeed > 200 {
-				anomalies = append(anomalies, fmt.Sprintf("Impossible speed detected: %.1f km/h between locations", impliedSpeed))
-			}
-		}
-	}
-
-	// Check for long periods without updates
-	if len(records) > 0 {
-		lastUpdate := records[0].Timestamp
-		hoursSinceUpdate := time.Since(lastUpdate).Hours()
-
-		if hoursSinceUpdate > 4 {
-			anomalies = append(anomalies, fmt.Sprintf("No location updates for %.1f hours", hoursSinceUpdate))
-		}
-	}
-
-	return anomalies, nil
+	return descriptions, err
 }
 
 // TrackingFilters represents filters for tracking history queries
@@ -419,7 +654,7 @@ type TrackingFilters struct {
 
 // GetTrackingHistory retrieves tracking history with optional filters
 func (ts *TrackingService) GetTrackingHistory(tripID uint, filters TrackingFilters) ([]models.TrackingRecord, error) {
-	query := ts.db.Where("trip_id = ?", tripID)
+	query := TripTrackingRecords(ts.db, tripID)
 
 	// Apply filters
 	if filters.StartDate != nil {
@@ -496,7 +731,7 @@ func (ts *TrackingService) LogTrackingEvent(tripID uint, loadID *uint, eventType
 func (ts *TrackingService) GetAuditTrail(tripID uint, includeSystemEvents bool) (map[string]interface{}, error) {
 	// Get all tracking records
 	var trackingRecords []models.TrackingRecord
-	ts.db.Where("trip_id = ?", tripID).
+	TripTrackingRecords(ts.db, tripID).
 		Order("timestamp ASC").
 		Find(&trackingRecords)
 
@@ -596,7 +831,7 @@ func (ts *TrackingService) GetTrackingStatistics(tripID uint) (map[string]interf
 
 	// Count tracking records
 	var recordCount int64
-	ts.db.Model(&models.TrackingRecord{}).Where("trip_id = ?", tripID).Count(&recordCount)
+	TripTrackingRecords(ts.db, tripID).Count(&recordCount)
 	stats["total_location_updates"] = recordCount
 
 	// Count tracking events by type
@@ -613,8 +848,8 @@ func (ts *TrackingService) GetTrackingStatistics(tripID uint) (map[string]interf
 
 	// Get first and last location updates
 	var firstRecord, lastRecord models.TrackingRecord
-	ts.db.Where("trip_id = ?", tripID).Order("timestamp ASC").First(&firstRecord)
-	ts.db.Where("trip_id = ?", tripID).Order("timestamp DESC").First(&lastRecord)
+	TripTrackingRecords(ts.db, tripID).Order("timestamp ASC").First(&firstRecord)
+	TripTrackingRecords(ts.db, tripID).Order("timestamp DESC").First(&lastRecord)
 
 	if firstRecord.ID != 0 {
 		stats["first_update"] = firstRecord.Timestamp
@@ -635,9 +870,9 @@ func (ts *TrackingService) GetTrackingStatistics(tripID uint) (map[string]interf
 		MinSpeed *float64 `json:"min_speed"`
 		AvgSpeed *float64 `json:"avg_speed"`
 	}
-	ts.db.Model(&models.TrackingRecord{}).
+	TripTrackingRecords(ts.db, tripID).
 		Select("MAX(speed) as max_speed, MIN(speed) as min_speed, AVG(speed) as avg_speed").
-		Where("trip_id = ? AND speed IS NOT NULL", tripID).
+		Where("speed IS NOT NULL").
 		Scan(&speedStats)
 
 	if speedStats.MaxSpeed != nil {
@@ -653,7 +888,7 @@ func (ts *TrackingService) GetTrackingStatistics(tripID uint) (map[string]interf
 func (ts *TrackingService) ExportTrackingData(tripID uint, format string) (interface{}, error) {
 	// Get all tracking data
 	var records []models.TrackingRecord
-	ts.db.Where("trip_id = ?", tripID).Order("timestamp ASC").Find(&records)
+	TripTrackingRecords(ts.db, tripID).Order("timestamp ASC").Find(&records)
 
 	var events []models.TrackingEvent
 	ts.db.Where("trip_id = ?", tripID).Order("timestamp ASC").Find(&events)
@@ -693,6 +928,16 @@ func (e TrackingError) Error() string {
 	return fmt.Sprintf("[%s] %s: %s", e.Code, e.Message, e.Details)
 }
 
+// APIError converts the error to the API error of its code, for the error
+// response
+func (e TrackingError) APIError() *apierror.Error {
+	apiErr := apierror.New(apierror.Code(e.Code), e.Message)
+	if e.Details != "" {
+		apiErr.Details = e.Details
+	}
+	return apiErr
+}
+
 // NewTrackingError creates a new tracking error
 func NewTrackingError(code, message, details string, tripID *uint, loadID *uint) *TrackingError {
 	return &TrackingError{
@@ -747,6 +992,30 @@ func (ts *TrackingService) ValidateLocationUpdate(tripID uint, location Location
 			&tripID, nil)
 	}
 
+	// Validate battery level if provided
+	if location.BatteryLevel != nil && (*location.BatteryLevel < 0 || *location.BatteryLevel > 100) {
+		return NewTrackingError("INVALID_BATTERY_LEVEL",
+			"Battery level must be between 0 and 100 percent",
+			fmt.Sprintf("Battery level: %.2f%%", *location.BatteryLevel),
+			&tripID, nil)
+	}
+
+	// Validate speed limit if provided
+	if location.SpeedLimit != nil && (*location.SpeedLimit <= 0 || *location.SpeedLimit > 200) {
+		return NewTrackingError("INVALID_SPEED_LIMIT",
+			"Speed limit out of reasonable range",
+			fmt.Sprintf("Speed limit: %.2f km/h", *location.SpeedLimit),
+			&tripID, nil)
+	}
+
+	// Validate timestamp if provided, allowing for some clock skew
+	if location.Timestamp != nil && location.Timestamp.After(time.Now().Add(5*time.Minute)) {
+		return NewTrackingError("INVALID_TIMESTAMP",
+			"Timestamp is in the future",
+			fmt.Sprintf("Timestamp: %s", location.Timestamp.Format(time.RFC3339)),
+			&tripID, nil)
+	}
+
 	// Validate source
 	validSources := []string{"GPS", "MANUAL", "ESTIMATED", "NETWORK", "PASSIVE"}
 	isValidSource := false
@@ -811,6 +1080,60 @@ func (ts *TrackingService) SanitizeLocationData(location *LocationUpdate) {
 	location.Source = strings.ToUpper(location.Source)
 }
 
+// IngestLocationBatch validates, sanitizes and records a batch of location
+// updates of a trip in order, e.g. positions synced after being offline.
+// Invalid updates are skipped and reported in the result.
+func (ts *TrackingService) IngestLocationBatch(tripID uint, updates []LocationUpdate) *LocationBatchResult {
+	result := &LocationBatchResult{TotalRecords: len(updates)}
+	var first, last time.Time
+
+	for _, locationUpdate := range updates {
+		if err := ts.ValidateLocationUpdate(tripID, locationUpdate); err != nil {
+			metrics.ObserveLocationUpdate(locationUpdate.Source, metrics.LocationRejected)
+			result.ErrorCount++
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+
+		ts.SanitizeLocationData(&locationUpdate)
+
+		if locationUpdate.Timestamp == nil {
+			now := time.Now()
+			locationUpdate.Timestamp = &now
+		}
+		if err := ts.UpdateLocation(tripID, locationUpdate); errors.Is(err, ErrDuplicateLocationUpdate) {
+			result.DuplicateCount++
+			continue
+		} else if errors.Is(err, ErrInaccurateLocation) {
+			result.FilteredCount++
+			continue
+		} else if err != nil {
+			result.ErrorCount++
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		result.SuccessCount++
+		if first.IsZero() || locationUpdate.Timestamp.Before(first) {
+			first = *locationUpdate.Timestamp
+		}
+		if locationUpdate.Timestamp.After(last) {
+			last = *locationUpdate.Timestamp
+		}
+	}
+
+	// Snap the batch's records to roads. The raw positions are kept when
+	// matching fails, so the batch still succeeds.
+	if result.SuccessCount > 0 && ts.mapMatching.OnIngest {
+		matched, err := ts.snapRecords(ts.db.Where("trip_id = ? AND timestamp BETWEEN ? AND ?", tripID, first, last))
+		if err != nil {
+			tracing.Logf(ts.ctx, "Failed to map match location batch of trip %d: %v", tripID, err)
+		}
+		result.MatchedCount = matched
+	}
+
+	return result
+}
+
 // RetryLocationUpdate implements retry logic for failed location updates
 func (ts *TrackingService) RetryLocationUpdate(tripID uint, location LocationUpdate, maxRetries int) error {
 	var lastError error
@@ -822,8 +1145,10 @@ func (ts *TrackingService) RetryLocationUpdate(tripID uint, location LocationUpd
 			time.Sleep(waitTime)
 		}
 
+		// An attempt that failed after recording the position leaves a
+		// duplicate for the next one
 		err := ts.UpdateLocation(tripID, location)
-		if err == nil {
+		if err == nil || errors.Is(err, ErrDuplicateLocationUpdate) {
 			// Success
 			if attempt > 0 {
 				// Log successful retry
@@ -833,6 +1158,10 @@ func (ts *TrackingService) RetryLocationUpdate(tripID uint, location LocationUpd
 			}
 			return nil
 		}
+		if errors.Is(err, ErrInaccurateLocation) {
+			// The same position is dropped on every attempt
+			return err
+		}
 
 		lastError = err
 
@@ -884,7 +1213,7 @@ func (ts *TrackingService) ValidateTrackingConsistency(tripID uint) []string {
 		}
 
 		// Check for unrealistic location jumps
-		distance := calculateDistance(current.Latitude, current.Longitude, next.Latitude, next.Longitude)
+		distance := geo.Distance(current.Latitude, current.Longitude, next.Latitude, next.Longitude)
 		timeDiff := current.Timestamp.Sub(next.Timestamp).Hours()
 
 		if timeDiff > 0 {
@@ -972,54 +1301,10 @@ func isValidCoordinate(lat, lng float64) bool {
 	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
 }
 
-// calculateDistance calculates the distance between two coordinates using Haversine formula
-func calculateDistance(lat1, lng1, lat2, lng2 float64) float64 {
-	const earthRadius = 6371 // Earth's radius in kilometers
-
-	// Convert degrees to radians
-	lat1Rad := lat1 * math.Pi / 180
-	lng1Rad := lng1 * math.Pi / 180
-	lat2Rad := lat2 * math.Pi / 180
-	lng2Rad := lng2 * math.Pi / 180
-
-	// Calculate differences
-	deltaLat := lat2Rad - lat1Rad
-	deltaLng := lng2Rad - lng1Rad
-
-	// Haversine formula
-	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
-		math.Cos(lat1Rad)*math.Cos(lat2Rad)*
-			math.Sin(deltaLng/2)*math.Sin(deltaLng/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
 
-	return earthRadius * c
-}
-
-// isValidStatusTransition validates if a status transition is allowed
+// isValidStatusTransition validates if a trip status transition is allowed
 func isValidStatusTransition(currentStatus, newStatus string) bool {
-	validTransitions := map[string][]string{
-		"PLANNED":     {"ACTIVE", "CANCELLED"},
-		"ACTIVE":      {"IN_TRANSIT", "AT_PICKUP", "CANCELLED"},
-		"AT_PICKUP":   {"IN_TRANSIT", "ACTIVE"},
-		"IN_TRANSIT":  {"AT_DELIVERY", "DELAYED", "COMPLETED"},
-		"AT_DELIVERY": {"COMPLETED", "IN_TRANSIT"},
-		"DELAYED":     {"IN_TRANSIT", "AT_DELIVERY", "COMPLETED"},
-		"COMPLETED":   {}, // Terminal state
-		"CANCELLED":   {}, // Terminal state
-	}
-
-	allowedTransitions, exists := validTransitions[currentStatus]
-	if !exists {
-		return false
-	}
-
-	for _, allowed := range allowedTransitions {
-		if allowed == newStatus {
-			return true
-		}
-	}
-
-	return false
+	return TripStatusMachine.Allows(currentStatus, newStatus)
 }
 
 // calculateCompletionPercent calculates completion percentage based on status
@@ -1040,3 +1325,21 @@ func calculateCompletionPercent(status string) float64 {
 	}
 	return 0.0
 }
+
+// calculateLoadCompletionPercent calculates completion percentage of a load based on its status
+func calculateLoadCompletionPercent(status string) float64 {
+	statusPercent := map[string]float64{
+		"BOOKED":           10.0,
+		"PICKUP_SCHEDULED": 20.0,
+		"PICKED_UP":        40.0,
+		"IN_TRANSIT":       60.0,
+		"OUT_FOR_DELIVERY": 80.0,
+		"DELIVERED":        100.0,
+		"EXCEPTION":        50.0, // Depends on context
+	}
+
+	if percent, exists := statusPercent[status]; exists {
+		return percent
+	}
+	return 0.0
+}
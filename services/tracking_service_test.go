@@ -1,8 +1,10 @@
 package services
 
 import (
+	"strings"
 	"testing"
 	"time"
+	"triplink/backend/internal/geo"
 	"triplink/backend/models"
 
 	"github.com/stretchr/testify/assert"
@@ -36,7 +38,7 @@ func (m *MockDB) Find(dest interface{}) error {
 
 // Test LocationUpdate validation
 func TestValidateLocationUpdate(t *testing.T) {
-	ts := NewTrackingService()
+	ts := NewTrackingService(nil)
 
 	tests := []struct {
 		name        string
@@ -180,7 +182,7 @@ func TestCalculateDistance(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := calculateDistance(tt.lat1, tt.lng1, tt.lat2, tt.lng2)
+			result := geo.Distance(tt.lat1, tt.lng1, tt.lat2, tt.lng2)
 			assert.InDelta(t, tt.expected, result, tt.tolerance)
 		})
 	}
@@ -234,9 +236,47 @@ func TestCalculateCompletionPercent(t *testing.T) {
 	}
 }
 
+// Test progress along the route
+func TestCalculateTripProgress(t *testing.T) {
+	straight := &models.Trip{DestinationLng: 2}
+	lShaped := &models.Trip{
+		DestinationLat:       1,
+		DestinationLng:       1,
+		PlannedRoutePolyline: EncodePolyline([]Coordinate{{0, 0}, {0, 1}, {1, 1}}),
+	}
+
+	tests := []struct {
+		name     string
+		trip     *models.Trip
+		position Coordinate
+		expected float64
+	}{
+		{"Start", straight, Coordinate{0, 0}, 0},
+		{"Quarter of the way", straight, Coordinate{0, 0.5}, 25},
+		{"Off the route", straight, Coordinate{0.2, 1.5}, 75},
+		{"Past the destination", straight, Coordinate{0, 2.5}, 100},
+		{"Along the planned route", lShaped, Coordinate{0.5, 1.01}, 75},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress, ok := calculateTripProgress(tt.trip, tt.position)
+			assert.True(t, ok)
+			assert.InDelta(t, tt.expected, progress.Percent, 0.5)
+			assert.InDelta(t, progress.RouteDistanceKm*progress.Percent/100, progress.DistanceCoveredKm, 0.5)
+		})
+	}
+
+	progress, _ := calculateTripProgress(straight, Coordinate{0, 0.5})
+	assert.InDelta(t, 222.4, progress.RouteDistanceKm, 0.5)
+
+	_, ok := calculateTripProgress(&models.Trip{}, Coordinate{0, 0.5})
+	assert.False(t, ok)
+}
+
 // Test data sanitization
 func TestSanitizeLocationData(t *testing.T) {
-	ts := NewTrackingService()
+	ts := NewTrackingService(nil)
 
 	location := LocationUpdate{
 		Latitude:  40.712812345678,
@@ -317,12 +357,12 @@ func BenchmarkCalculateDistance(b *testing.B) {
 	lat2, lng2 := 34.0522, -118.2437
 
 	for i := 0; i < b.N; i++ {
-		calculateDistance(lat1, lng1, lat2, lng2)
+		geo.Distance(lat1, lng1, lat2, lng2)
 	}
 }
 
 func BenchmarkValidateLocationUpdate(b *testing.B) {
-	ts := NewTrackingService()
+	ts := NewTrackingService(nil)
 	location := LocationUpdate{
 		Latitude:  40.7128,
 		Longitude: -74.0060,
@@ -333,3 +373,266 @@ func BenchmarkValidateLocationUpdate(b *testing.B) {
 		ts.ValidateLocationUpdate(1, location)
 	}
 }
+
+// Test polyline encoding round trip
+func TestEncodeDecodePolyline(t *testing.T) {
+	// Reference example from the Google polyline algorithm documentation
+	points := []Coordinate{
+		{Latitude: 38.5, Longitude: -120.2},
+		{Latitude: 40.7, Longitude: -120.95},
+		{Latitude: 43.252, Longitude: -126.453},
+	}
+
+	encoded := EncodePolyline(points)
+	assert.Equal(t, "_p~iF~ps|U_ulLnnqC_mqNvxq`@", encoded)
+
+	decoded, err := DecodePolyline(encoded)
+	assert.NoError(t, err)
+	assert.Len(t, decoded, len(points))
+	for i := range points {
+		assert.InDelta(t, points[i].Latitude, decoded[i].Latitude, 0.00001)
+		assert.InDelta(t, points[i].Longitude, decoded[i].Longitude, 0.00001)
+	}
+
+	_, err = DecodePolyline("_p~iF~ps|U_")
+	assert.Error(t, err)
+}
+
+// Test Douglas-Peucker path simplification
+func TestSimplifyPath(t *testing.T) {
+	// Nearly straight line with a small wobble and one large detour
+	path := []Coordinate{
+		{Latitude: 0.0, Longitude: 0.0},
+		{Latitude: 0.00001, Longitude: 0.001},
+		{Latitude: 0.0, Longitude: 0.002},
+		{Latitude: 0.01, Longitude: 0.003},
+		{Latitude: 0.0, Longitude: 0.004},
+	}
+
+	simplified := SimplifyPath(path, 25)
+	assert.Equal(t, []Coordinate{path[0], path[2], path[3], path[4]}, simplified)
+
+	// Zero tolerance keeps every point
+	assert.Len(t, SimplifyPath(path, 0), len(path))
+
+	// Short paths are returned unchanged
+	assert.Len(t, SimplifyPath(path[:2], 25), 2)
+}
+
+// Test quiet hours window, including windows that span midnight
+func TestIsWithinQuietHours(t *testing.T) {
+	preferences := &models.NotificationPreferences{
+		QuietHoursEnabled: true,
+		QuietHoursStart:   "22:00",
+		QuietHoursEnd:     "07:00",
+		Timezone:          "America/New_York",
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected bool
+	}{
+		{"Late evening local time", time.Date(2024, 6, 1, 3, 30, 0, 0, time.UTC), true},  // 23:30 EDT
+		{"Early morning local time", time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC), true}, // 06:00 EDT
+		{"End of quiet hours", time.Date(2024, 6, 1, 11, 0, 0, 0, time.UTC), false},      // 07:00 EDT
+		{"Afternoon local time", time.Date(2024, 6, 1, 18, 0, 0, 0, time.UTC), false},    // 14:00 EDT
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsWithinQuietHours(preferences, tt.now))
+		})
+	}
+
+	preferences.QuietHoursEnabled = false
+	assert.False(t, IsWithinQuietHours(preferences, time.Date(2024, 6, 1, 3, 30, 0, 0, time.UTC)))
+}
+
+// Test manifest PDF rendering across multiple pages
+func TestRenderManifestPDF(t *testing.T) {
+	doc := &ManifestDocument{
+		Manifest: models.Manifest{ManifestNumber: "MAN-1-1700000000", GeneratedAt: time.Now()},
+		Trip:     models.Trip{OriginCity: "Harare", DestinationCity: "Johannesburg"},
+		Shippers: map[uint]models.User{1: {BaseModel: models.BaseModel{ID: 1}, CompanyName: "Acme (Pty) Ltd", TaxID: "TX-1"}},
+	}
+	for i := 0; i < 80; i++ {
+		doc.Loads = append(doc.Loads, models.Load{ShipperID: 1, HSCode: "8471.30", Weight: 100, Value: 250})
+	}
+	applyManifestTotals(&doc.Manifest, doc.Loads)
+
+	pdf := string(RenderManifestPDF(doc))
+
+	assert.True(t, strings.HasPrefix(pdf, "%PDF-1.4"))
+	assert.True(t, strings.HasSuffix(pdf, "%%EOF\n"))
+	assert.Contains(t, pdf, "/Count 2")
+	assert.Contains(t, pdf, "Page 2 of 2")
+	assert.Contains(t, pdf, `Acme \(Pty\) Ltd`)
+	assert.Contains(t, pdf, "8000.0")
+	assert.Equal(t, 80, doc.Manifest.LoadCount)
+}
+
+// Test required customs documents per country pair and expiry classification
+func TestCustomsCompliance(t *testing.T) {
+	tests := []struct {
+		name     string
+		load     models.Load
+		expected []string
+	}{
+		{"Domestic", models.Load{PickupCountry: "ZW", DeliveryCountry: "Zimbabwe"}, []string{"BOL"}},
+		{"SACU customs union", models.Load{PickupCountry: "South Africa", DeliveryCountry: "BW"}, []string{"BOL", "COMMERCIAL_INVOICE"}},
+		{"SADC free trade area", models.Load{PickupCountry: "ZW", DeliveryCountry: "ZA"}, []string{"BOL", "COMMERCIAL_INVOICE", "PACKING_LIST", "CUSTOMS_DECLARATION", "CERTIFICATE_OF_ORIGIN"}},
+		{"Hazmat outside trade bloc", models.Load{PickupCountry: "KE", DeliveryCountry: "ZA", IsHazmat: true}, []string{"BOL", "COMMERCIAL_INVOICE", "PACKING_LIST", "CUSTOMS_DECLARATION", "DANGEROUS_GOODS_DECLARATION"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, RequiredCustomsDocuments(&tt.load))
+		})
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Hour)
+	expiring := now.Add(5 * 24 * time.Hour)
+	valid := now.Add(90 * 24 * time.Hour)
+	load := models.Load{
+		PickupCountry:   "ZA",
+		DeliveryCountry: "NA",
+		CustomsDocuments: []models.CustomsDocument{
+			{DocumentType: "BOL", ExpiryDate: &expiring},
+			{DocumentType: "COMMERCIAL_INVOICE", ExpiryDate: &expired},
+			{DocumentType: "CERTIFICATE_OF_ORIGIN", ExpiryDate: &valid},
+		},
+	}
+
+	report := buildComplianceReport(&load, now, 14*24*time.Hour)
+	assert.False(t, report.Compliant)
+	assert.Equal(t, []string{"COMMERCIAL_INVOICE"}, report.MissingDocuments)
+	assert.Len(t, report.ExpiredDocuments, 1)
+	assert.Len(t, report.ExpiringDocuments, 1)
+	assert.Equal(t, "BOL", report.ExpiringDocuments[0].DocumentType)
+}
+
+// Test vehicle document compliance and reminder stages
+func TestVehicleCompliance(t *testing.T) {
+	reminderDays := []int{30, 14, 3}
+	stageTests := []struct {
+		name      string
+		remaining time.Duration
+		expected  int
+	}{
+		{"Not due yet", 45 * 24 * time.Hour, 0},
+		{"Thirty day reminder", 29 * 24 * time.Hour, 30},
+		{"Fourteen day reminder", 10 * 24 * time.Hour, 14},
+		{"Three day reminder", 2 * 24 * time.Hour, 3},
+		{"Exactly at a stage", 14 * 24 * time.Hour, 14},
+	}
+
+	for _, tt := range stageTests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, reminderStage(reminderDays, tt.remaining))
+		})
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	insurance := now.Add(10 * 24 * time.Hour)
+	registration := now.Add(200 * 24 * time.Hour)
+	vehicle := models.Vehicle{
+		LicensePlate:       "ABC123",
+		InsuranceExpiry:    &insurance,
+		RegistrationExpiry: &registration,
+	}
+
+	status := buildVehicleCompliance(&vehicle, now.Add(2*24*time.Hour), now)
+	assert.True(t, status.Compliant)
+	assert.Equal(t, []string{"INSPECTION"}, status.MissingDocuments)
+	assert.Len(t, status.Expirations, 2)
+	assert.Equal(t, 10, status.Expirations[0].DaysRemaining)
+
+	// A trip ending after the insurance expires is not compliant
+	status = buildVehicleCompliance(&vehicle, now.Add(12*24*time.Hour), now)
+	assert.False(t, status.Compliant)
+	assert.Len(t, status.ExpiredDocuments, 1)
+	assert.Equal(t, "INSURANCE", status.ExpiredDocuments[0].DocumentType)
+}
+
+func TestLocationHub(t *testing.T) {
+	assert.Equal(t, "trip:42:location", TripLocationChannel(42))
+	tripID, err := parseTripLocationChannel("trip:42:location")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(42), tripID)
+	_, err = parseTripLocationChannel("trip:abc:location")
+	assert.Error(t, err)
+
+	hub := NewLocationHub(nil, 1)
+	first, unsubscribeFirst := hub.Subscribe(1)
+	second, unsubscribeSecond := hub.Subscribe(1)
+	other, unsubscribeOther := hub.Subscribe(2)
+	defer unsubscribeOther()
+	assert.Equal(t, 2, hub.SubscriberCount(1))
+
+	// Without Redis updates are delivered to the local subscribers of the trip
+	assert.NoError(t, hub.Publish(TripLocationUpdate{TripID: 1, Latitude: 40.7, Longitude: -74.0}))
+	assert.Equal(t, 40.7, (<-first).Latitude)
+	assert.Equal(t, 40.7, (<-second).Latitude)
+	assert.Len(t, other, 0)
+
+	// Updates to a client with a full buffer are dropped
+	assert.NoError(t, hub.Publish(TripLocationUpdate{TripID: 1, Latitude: 41.0}))
+	assert.NoError(t, hub.Publish(TripLocationUpdate{TripID: 1, Latitude: 42.0}))
+	assert.Equal(t, 41.0, (<-first).Latitude)
+	assert.Len(t, first, 0)
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	_, open := <-first
+	assert.False(t, open)
+	assert.Equal(t, 1, hub.SubscriberCount(1))
+
+	unsubscribeSecond()
+	assert.Equal(t, 0, hub.SubscriberCount(1))
+	assert.NoError(t, hub.Publish(TripLocationUpdate{TripID: 1}))
+}
+
+func TestOrderTripStops(t *testing.T) {
+	loadA, loadB := uint(1), uint(2)
+	stops := []models.TripStop{
+		{StopType: TripStopDestination, Latitude: 43.0},
+		{StopType: TripStopDelivery, LoadID: &loadA, Latitude: 40.1},
+		{StopType: TripStopPickup, LoadID: &loadB, Latitude: 41.0},
+		{StopType: TripStopPickup, LoadID: &loadA, Latitude: 42.0},
+		{StopType: TripStopDelivery, LoadID: &loadB, Latitude: 42.5},
+		{StopType: TripStopOrigin, Latitude: 40.0},
+	}
+
+	// Load A is delivered next to the origin but not before its pickup
+	ordered := orderTripStops(Coordinate{Latitude: 40.0}, stops, nil)
+	var keys []string
+	for _, stop := range ordered {
+		keys = append(keys, tripStopKey(stop.StopType, stop.LoadID))
+	}
+	assert.Equal(t, []string{"ORIGIN", "PICKUP:2", "PICKUP:1", "DELIVERY:2", "DELIVERY:1", "DESTINATION"}, keys)
+
+	// Deliveries of loads already picked up can come first
+	ordered = orderTripStops(Coordinate{Latitude: 40.0}, stops[:3], map[string]bool{"PICKUP:1": true})
+	assert.Equal(t, TripStopDelivery, ordered[0].StopType)
+	assert.Equal(t, TripStopDestination, ordered[len(ordered)-1].StopType)
+}
+
+func TestCalculateETAAccuracy(t *testing.T) {
+	stats := calculateETAAccuracy("all", []float64{-30, -10, 0, 5, 20})
+	assert.Equal(t, 5, stats.Count)
+	assert.InDelta(t, 13.0, stats.MAEMinutes, 1e-9)
+	assert.InDelta(t, -3.0, stats.MeanErrorMinutes, 1e-9)
+	assert.InDelta(t, 10.0, stats.P50AbsErrorMinutes, 1e-9)
+	assert.InDelta(t, 26.0, stats.P90AbsErrorMinutes, 1e-9)
+	assert.InDelta(t, 60.0, stats.WithinFifteenPercent, 1e-9)
+
+	empty := calculateETAAccuracy("none", nil)
+	assert.Equal(t, 0, empty.Count)
+	assert.Equal(t, 0.0, empty.MAEMinutes)
+
+	assert.Equal(t, "0-1h", etaHorizonBucket(30*time.Minute))
+	assert.Equal(t, "4-12h", etaHorizonBucket(5*time.Hour))
+	assert.Equal(t, "12h+", etaHorizonBucket(24*time.Hour))
+}
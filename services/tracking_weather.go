@@ -0,0 +1,344 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/timezone"
+	"triplink/backend/internal/units"
+	"triplink/backend/models"
+	"triplink/backend/tracing"
+)
+
+// Severe weather hazards trips are alerted of
+const (
+	WeatherHazardThunderstorm  = "THUNDERSTORM"
+	WeatherHazardSnow          = "SNOW"
+	WeatherHazardHighWind      = "HIGH_WIND"
+	WeatherHazardHeavyRain     = "HEAVY_RAIN"
+	WeatherHazardLowVisibility = "LOW_VISIBILITY"
+)
+
+var weatherHazardLabels = map[string]string{
+	WeatherHazardThunderstorm:  "Thunderstorms",
+	WeatherHazardSnow:          "Snow",
+	WeatherHazardHighWind:      "High winds",
+	WeatherHazardHeavyRain:     "Heavy rain",
+	WeatherHazardLowVisibility: "Low visibility",
+}
+
+// routeForecast is the weather forecast at a point of a trip's remaining
+// route for when the vehicle is expected to pass it
+type routeForecast struct {
+	location   Coordinate
+	routeKm    float64 // ahead of the vehicle
+	expectedAt time.Time
+	condition  WeatherCondition
+	// Share of the remaining duration driven in this weather
+	share       float64
+	speedFactor float64
+	hazard      string
+}
+
+// weatherAlertData is the event data of WEATHER_ALERT tracking events
+type weatherAlertData struct {
+	Hazard        string    `json:"hazard"`
+	Condition     string    `json:"condition"`
+	RouteKm       float64   `json:"route_km"`
+	ExpectedAt    time.Time `json:"expected_at"`
+	WindSpeed     float64   `json:"wind_speed"`
+	Precipitation float64   `json:"precipitation"`
+	Visibility    float64   `json:"visibility"`
+}
+
+// defaultWeatherService returns the weather provider, called through its
+// circuit breaker, or nil when no API key is configured
+func defaultWeatherService() WeatherAPIService {
+	if config.GetAPIKeysConfig().OpenWeatherMap == "" {
+		return nil
+	}
+	return &circuitBreakerWeatherService{
+		provider: NewOpenWeatherMapService(),
+		breaker:  GetCircuitBreaker(WeatherSourceOpenWeatherMap),
+	}
+}
+
+// SetWeatherService replaces the weather provider used to adjust ETAs and
+// alert on severe weather. With none, ETAs don't account for the weather.
+func (ts *TrackingService) SetWeatherService(weather WeatherAPIService) {
+	ts.weather = weather
+}
+
+// applyWeather slows an ETA estimate down for the weather forecast along the
+// trip's remaining route. The forecast is refreshed, and severe weather on it
+// alerted, once per refresh interval; in between the last slowdown is applied.
+func (ts *TrackingService) applyWeather(trip *models.Trip, current Coordinate, estimate *ETAEstimate) {
+	if ts.weather == nil || estimate.DurationMinutes <= 0 {
+		return
+	}
+
+	var status models.TrackingStatus
+	ts.db.Select("weather_condition", "weather_slowdown", "weather_checked_at").
+		Where("trip_id = ? AND load_id IS NULL", trip.ID).Limit(1).Find(&status)
+	if status.WeatherCheckedAt == nil || estimate.CalculatedAt.Sub(*status.WeatherCheckedAt) >= ts.weatherConfig.RefreshInterval {
+		forecasts, err := ts.forecastRoute(trip, current, estimate)
+		if err != nil {
+			tracing.Logf(ts.ctx, "Failed to forecast the weather on the route of trip %d: %v", trip.ID, err)
+		} else {
+			status.WeatherSlowdown, status.WeatherCondition = weatherSlowdown(forecasts)
+			status.WeatherCheckedAt = &estimate.CalculatedAt
+			ts.alertWeatherHazards(trip, forecasts, estimate.CalculatedAt)
+		}
+	}
+
+	delay := estimate.DurationMinutes * status.WeatherSlowdown
+	estimate.DurationMinutes += delay
+	estimate.EstimatedArrival = estimate.EstimatedArrival.Add(time.Duration(delay * float64(time.Minute)))
+	estimate.WeatherDelayMinutes = delay
+	estimate.WeatherCondition = status.WeatherCondition
+	estimate.weatherSlowdown = status.WeatherSlowdown
+	estimate.weatherCheckedAt = status.WeatherCheckedAt
+}
+
+// forecastRoute forecasts the weather at evenly spaced points of a trip's
+// remaining route that the vehicle reaches within the lookahead, each for
+// the time it is expected there
+func (ts *TrackingService) forecastRoute(trip *models.Trip, current Coordinate, estimate *ETAEstimate) ([]routeForecast, error) {
+	cfg := ts.weatherConfig
+	route := remainingRoute(trip, current)
+	cumulative := routeDistances(route)
+	lengthKm := cumulative[len(cumulative)-1]
+
+	samples := int(math.Ceil(lengthKm / cfg.SampleIntervalKm))
+	samples = max(1, min(samples, cfg.MaxSamples))
+	duration := time.Duration(estimate.DurationMinutes * float64(time.Minute))
+	horizon := estimate.CalculatedAt.Add(time.Duration(cfg.LookaheadHours) * time.Hour)
+
+	var forecasts []routeForecast
+	var lastErr error
+	for i := 0; i < samples; i++ {
+		// Each point stands for the stretch of route around it
+		fraction := (float64(i) + 0.5) / float64(samples)
+		expectedAt := estimate.CalculatedAt.Add(time.Duration(float64(duration) * fraction))
+		if expectedAt.After(horizon) {
+			break
+		}
+		point := pointAlongRoute(route, cumulative, fraction*lengthKm)
+
+		conditions, err := ts.weather.GetWeatherForecast(point.Latitude, point.Longitude, cfg.LookaheadHours+3)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		condition, ok := closestForecast(conditions, expectedAt)
+		if !ok {
+			continue
+		}
+		speedFactor, hazard := ts.classifyWeather(condition)
+		forecasts = append(forecasts, routeForecast{
+			location:    point,
+			routeKm:     fraction * lengthKm,
+			expectedAt:  expectedAt,
+			condition:   condition,
+			share:       1 / float64(samples),
+			speedFactor: speedFactor,
+			hazard:      hazard,
+		})
+	}
+	if len(forecasts) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return forecasts, nil
+}
+
+// remainingRoute returns the part of a trip's planned route ahead of a
+// position, or the straight line from it to the destination without one
+func remainingRoute(trip *models.Trip, current Coordinate) []Coordinate {
+	destination := Coordinate{Latitude: trip.DestinationLat, Longitude: trip.DestinationLng}
+	planned, err := DecodePolyline(trip.PlannedRoutePolyline)
+	if err != nil || len(planned) < 2 {
+		return []Coordinate{current, destination}
+	}
+
+	cumulative := routeDistances(planned)
+	_, progress := ProjectOntoPath(planned, current)
+	km := progress * cumulative[len(cumulative)-1]
+	route := []Coordinate{current}
+	for i, point := range planned {
+		if cumulative[i] > km {
+			route = append(route, point)
+		}
+	}
+	if len(route) == 1 {
+		route = append(route, planned[len(planned)-1])
+	}
+	return route
+}
+
+// closestForecast returns the forecast closest to a time
+func closestForecast(conditions []WeatherCondition, at time.Time) (WeatherCondition, bool) {
+	best := -1
+	for i := range conditions {
+		if best < 0 || conditions[i].Timestamp.Sub(at).Abs() < conditions[best].Timestamp.Sub(at).Abs() {
+			best = i
+		}
+	}
+	if best < 0 {
+		return WeatherCondition{}, false
+	}
+	return conditions[best], true
+}
+
+// classifyWeather returns the driving speed in a forecast's weather as a
+// fraction of normal, and the severe weather hazard it is, if any
+func (ts *TrackingService) classifyWeather(condition WeatherCondition) (float64, string) {
+	cfg := ts.weatherConfig
+	main := strings.ToLower(condition.Condition)
+	speedFactor := weatherSpeedFactor(cfg, condition)
+
+	hazard := ""
+	switch {
+	case main == "thunderstorm":
+		hazard = WeatherHazardThunderstorm
+	case main == "snow":
+		hazard = WeatherHazardSnow
+	case main == "tornado" || main == "squall" || condition.WindSpeed >= cfg.SevereWindKmh:
+		hazard = WeatherHazardHighWind
+	case condition.Precipitation >= cfg.SeverePrecipitationMm:
+		hazard = WeatherHazardHeavyRain
+	case condition.Visibility > 0 && condition.Visibility <= cfg.SevereVisibilityKm:
+		hazard = WeatherHazardLowVisibility
+	}
+	return speedFactor, hazard
+}
+
+// weatherSpeedFactor returns the driving speed in a forecast's weather as a
+// fraction of normal
+func weatherSpeedFactor(cfg *config.WeatherConfig, condition WeatherCondition) float64 {
+	speedFactor := 1.0
+	switch strings.ToLower(condition.Condition) {
+	case "rain", "drizzle", "thunderstorm", "squall":
+		speedFactor = cfg.RainSpeedFactor
+	case "snow":
+		speedFactor = cfg.SnowSpeedFactor
+	case "fog", "mist", "haze", "smoke", "dust", "sand", "ash":
+		speedFactor = cfg.FogSpeedFactor
+	}
+	if condition.Visibility > 0 && condition.Visibility < cfg.FogVisibilityKm {
+		speedFactor = math.Min(speedFactor, cfg.FogSpeedFactor)
+	}
+	return speedFactor
+}
+
+// weatherSlowdown returns the time the forecast weather adds to the rest of
+// a trip as a fraction of its duration, and the worst condition forecast
+func weatherSlowdown(forecasts []routeForecast) (float64, string) {
+	slowdown, worst := 0.0, -1
+	for i, forecast := range forecasts {
+		slowdown += forecast.share * (1/forecast.speedFactor - 1)
+		if worst < 0 || forecast.speedFactor < forecasts[worst].speedFactor {
+			worst = i
+		}
+	}
+	if worst < 0 {
+		return 0, ""
+	}
+	return slowdown, forecasts[worst].condition.Condition
+}
+
+// alertWeatherHazards logs a WEATHER_ALERT tracking event for the nearest
+// point of each severe weather hazard on the route and notifies the trip's
+// carrier, drivers and shippers, unless the trip was alerted of the hazard
+// within the cooldown
+func (ts *TrackingService) alertWeatherHazards(trip *models.Trip, forecasts []routeForecast, now time.Time) {
+	alerted := map[string]bool{}
+	for _, forecast := range forecasts {
+		if forecast.hazard == "" || alerted[forecast.hazard] {
+			continue
+		}
+		alerted[forecast.hazard] = true
+
+		var count int64
+		ts.db.Model(&models.TrackingEvent{}).
+			Where("trip_id = ? AND event_type = ? AND timestamp > ? AND event_data LIKE ?",
+				trip.ID, "WEATHER_ALERT", now.Add(-ts.weatherConfig.AlertCooldown), fmt.Sprintf("%%\"hazard\":\"%s\"%%", forecast.hazard)).
+			Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		data, err := json.Marshal(weatherAlertData{
+			Hazard:        forecast.hazard,
+			Condition:     forecast.condition.Condition,
+			RouteKm:       roundHundredths(forecast.routeKm),
+			ExpectedAt:    forecast.expectedAt,
+			WindSpeed:     forecast.condition.WindSpeed,
+			Precipitation: forecast.condition.Precipitation,
+			Visibility:    forecast.condition.Visibility,
+		})
+		if err != nil {
+			continue
+		}
+		// When the hazard is expected, at the local time where it is
+		hazardTimezone := timezone.Lookup(forecast.location.Latitude, forecast.location.Longitude)
+		describe := func(system units.System) string {
+			return fmt.Sprintf("%s expected %s ahead around %s", weatherHazardLabels[forecast.hazard],
+				system.FormatWholeDistance(forecast.routeKm), timezone.Format(forecast.expectedAt, hazardTimezone, "Jan 2 15:04 MST"))
+		}
+		description := describe(units.Metric)
+		event := models.TrackingEvent{
+			TripID:      trip.ID,
+			EventType:   "WEATHER_ALERT",
+			EventData:   string(data),
+			Latitude:    &forecast.location.Latitude,
+			Longitude:   &forecast.location.Longitude,
+			Timestamp:   now,
+			Description: description,
+		}
+		if err := ts.db.Create(&event).Error; err != nil {
+			tracing.Logf(ts.ctx, "Failed to log weather alert of trip %d: %v", trip.ID, err)
+			continue
+		}
+		ts.notifyWeatherHazard(trip, describe, now)
+	}
+}
+
+// notifyWeatherHazard notifies a trip's carrier, the drivers assigned to it
+// and the shippers of its loads of severe weather ahead, described in the
+// system of measurement each of them uses
+func (ts *TrackingService) notifyWeatherHazard(trip *models.Trip, describe func(units.System) string, now time.Time) {
+	var drivers, shippers []uint
+	activeAssignments(ts.db.Model(&models.TripAssignment{}), now).
+		Where("trip_id = ?", trip.ID).Pluck("driver_id", &drivers)
+	ts.db.Model(&models.Load{}).Where("trip_id = ?", trip.ID).Distinct().Pluck("shipper_id", &shippers)
+
+	recipients := append(append([]uint{trip.UserID}, drivers...), shippers...)
+	systems := UserUnitSystems(ts.db, recipients)
+
+	notified := map[uint]bool{}
+	for _, userID := range recipients {
+		if notified[userID] {
+			continue
+		}
+		notified[userID] = true
+
+		notification := models.Notification{
+			UserID:    userID,
+			Title:     "Severe Weather Ahead",
+			Message:   fmt.Sprintf("Trip %d: %s", trip.ID, describe(systems[userID])),
+			Type:      "WEATHER_ALERT",
+			RelatedID: trip.ID,
+		}
+		if notifications := GetNotificationService(); notifications != nil {
+			if created, _, err := notifications.CreateNotificationWithDelivery(&notification); created == nil {
+				log.Printf("Failed to notify user %d of weather on trip %d: %v", userID, trip.ID, err)
+			}
+		} else {
+			ts.db.Create(&notification)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrTripAssignmentNotFound is returned for assignments missing from the trip
+var ErrTripAssignmentNotFound = errors.New("trip assignment not found")
+
+// TripAssignmentRequest assigns a driver to a trip. The assignment starts
+// now unless StartsAt is given and is open-ended unless EndsAt is given.
+type TripAssignmentRequest struct {
+	DriverID uint       `json:"driver_id"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+	Notes    string     `json:"notes"`
+	// End the trip's other assignments when this one starts, handing the
+	// trip over to the driver
+	Reassign bool `json:"reassign"`
+}
+
+// TripAssignmentService manages the drivers assigned to trips by their
+// carrier's dispatcher
+type TripAssignmentService struct {
+	db *gorm.DB
+}
+
+// NewTripAssignmentService creates a new TripAssignmentService
+func NewTripAssignmentService(db *gorm.DB) *TripAssignmentService {
+	return &TripAssignmentService{db: db}
+}
+
+// AssignDriver assigns a driver to a trip. A driver can't be assigned to the
+// same trip twice for overlapping periods, nor to two trips at once or while
+// they're unavailable.
+func (s *TripAssignmentService) AssignDriver(tripID, dispatcherID uint, req TripAssignmentRequest) (*models.TripAssignment, error) {
+	if err := s.ValidateDriver(req.DriverID); err != nil {
+		return nil, err
+	}
+
+	assignment := &models.TripAssignment{
+		TripID:     tripID,
+		DriverID:   req.DriverID,
+		AssignedBy: dispatcherID,
+		StartsAt:   time.Now(),
+		EndsAt:     req.EndsAt,
+		Notes:      req.Notes,
+	}
+	if req.StartsAt != nil {
+		assignment.StartsAt = *req.StartsAt
+	}
+	if assignment.EndsAt != nil && !assignment.EndsAt.After(assignment.StartsAt) {
+		return nil, errors.New("ends_at must be after starts_at")
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if req.Reassign {
+			// Cut the other assignments short, and drop those that wouldn't
+			// have started yet
+			others := tx.Model(&models.TripAssignment{}).Where("trip_id = ? AND driver_id <> ?", tripID, req.DriverID)
+			if err := others.Session(&gorm.Session{}).
+				Where("starts_at >= ?", assignment.StartsAt).
+				Delete(&models.TripAssignment{}).Error; err != nil {
+				return err
+			}
+			if err := others.Session(&gorm.Session{}).
+				Where("ends_at IS NULL OR ends_at > ?", assignment.StartsAt).
+				Update("ends_at", assignment.StartsAt).Error; err != nil {
+				return err
+			}
+		}
+		if err := s.checkOverlap(tx, assignment); err != nil {
+			return err
+		}
+		if err := s.checkSchedule(tx, assignment); err != nil {
+			return err
+		}
+		return tx.Create(assignment).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetAssignment(tripID, assignment.ID)
+}
+
+// GetTripAssignments returns a trip's assignments in the order they start,
+// with their drivers
+func (s *TripAssignmentService) GetTripAssignments(tripID uint) ([]models.TripAssignment, error) {
+	var assignments []models.TripAssignment
+	if err := s.db.Preload("Driver").Where("trip_id = ?", tripID).
+		Order("starts_at ASC, id ASC").Find(&assignments).Error; err != nil {
+		return nil, fmt.Errorf("failed to get trip assignments: %w", err)
+	}
+	return assignments, nil
+}
+
+// GetAssignment returns one of a trip's assignments with its driver
+func (s *TripAssignmentService) GetAssignment(tripID, assignmentID uint) (*models.TripAssignment, error) {
+	var assignment models.TripAssignment
+	if err := s.db.Preload("Driver").Where("id = ? AND trip_id = ?", assignmentID, tripID).
+		First(&assignment).Error; err != nil {
+		return nil, ErrTripAssignmentNotFound
+	}
+	return &assignment, nil
+}
+
+// UpdateAssignment changes the period or notes of an assignment. The driver
+// can't be changed; reassign the trip instead so location updates stay
+// attributed to the driver who posted them.
+func (s *TripAssignmentService) UpdateAssignment(tripID, assignmentID uint, req TripAssignmentRequest) (*models.TripAssignment, error) {
+	assignment, err := s.GetAssignment(tripID, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	if req.DriverID != 0 && req.DriverID != assignment.DriverID {
+		return nil, errors.New("the driver of an assignment can't be changed, reassign the trip instead")
+	}
+
+	if req.StartsAt != nil {
+		assignment.StartsAt = *req.StartsAt
+	}
+	assignment.EndsAt = req.EndsAt
+	assignment.Notes = req.Notes
+	if assignment.EndsAt != nil && !assignment.EndsAt.After(assignment.StartsAt) {
+		return nil, errors.New("ends_at must be after starts_at")
+	}
+	if err := s.checkOverlap(s.db, assignment); err != nil {
+		return nil, err
+	}
+	if err := s.checkSchedule(s.db, assignment); err != nil {
+		return nil, err
+	}
+
+	assignment.Driver = nil
+	if err := s.db.Save(assignment).Error; err != nil {
+		return nil, fmt.Errorf("failed to update trip assignment: %w", err)
+	}
+	return s.GetAssignment(tripID, assignmentID)
+}
+
+// EndAssignment unassigns a driver from a trip now. Assignments that haven't
+// started are removed; others are kept, ended, for the record of who drove.
+func (s *TripAssignmentService) EndAssignment(tripID, assignmentID uint) (*models.TripAssignment, error) {
+	assignment, err := s.GetAssignment(tripID, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if assignment.StartsAt.After(now) {
+		if err := s.db.Delete(&models.TripAssignment{}, assignment.ID).Error; err != nil {
+			return nil, fmt.Errorf("failed to remove trip assignment: %w", err)
+		}
+		return assignment, nil
+	}
+	if assignment.EndsAt != nil && !assignment.EndsAt.After(now) {
+		return assignment, nil
+	}
+
+	assignment.EndsAt = &now
+	if err := s.db.Model(&models.TripAssignment{}).Where("id = ?", assignment.ID).
+		Update("ends_at", now).Error; err != nil {
+		return nil, fmt.Errorf("failed to end trip assignment: %w", err)
+	}
+	return assignment, nil
+}
+
+// IsAssigned reports whether a driver is assigned to a trip at a time
+func (s *TripAssignmentService) IsAssigned(tripID, driverID uint, at time.Time) bool {
+	var count int64
+	activeAssignments(s.db.Model(&models.TripAssignment{}), at).
+		Where("trip_id = ? AND driver_id = ?", tripID, driverID).
+		Count(&count)
+	return count > 0
+}
+
+// AssignedTripIDs returns the trips a driver is assigned to at a time
+func (s *TripAssignmentService) AssignedTripIDs(driverID uint, at time.Time) ([]uint, error) {
+	var tripIDs []uint
+	if err := activeAssignments(s.db.Model(&models.TripAssignment{}), at).
+		Where("driver_id = ?", driverID).
+		Distinct().Pluck("trip_id", &tripIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get assigned trips: %w", err)
+	}
+	return tripIDs, nil
+}
+
+// activeAssignments narrows a query to the assignments in effect at a time
+func activeAssignments(query *gorm.DB, at time.Time) *gorm.DB {
+	return query.Where("starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)", at, at)
+}
+
+// ValidateDriver checks that a user exists and can drive
+func (s *TripAssignmentService) ValidateDriver(driverID uint) error {
+	if driverID == 0 {
+		return errors.New("driver_id is required")
+	}
+	var driver models.User
+	if err := s.db.First(&driver, driverID).Error; err != nil {
+		return errors.New("driver not found")
+	}
+	if driver.Role != "DRIVER" && driver.Role != "CARRIER" {
+		return errors.New("only drivers and carriers can be assigned to trips")
+	}
+	return nil
+}
+
+// checkOverlap rejects an assignment overlapping another of the same driver
+// on the trip
+func (s *TripAssignmentService) checkOverlap(tx *gorm.DB, assignment *models.TripAssignment) error {
+	query := tx.Model(&models.TripAssignment{}).
+		Where("trip_id = ? AND driver_id = ? AND id <> ?", assignment.TripID, assignment.DriverID, assignment.ID).
+		Where("ends_at IS NULL OR ends_at > ?", assignment.StartsAt)
+	if assignment.EndsAt != nil {
+		query = query.Where("starts_at < ?", *assignment.EndsAt)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check trip assignments: %w", err)
+	}
+	if count > 0 {
+		return errors.New("the driver is already assigned to the trip for an overlapping period")
+	}
+	return nil
+}
+
+// checkSchedule rejects an assignment during the driver's time off, outside
+// their shifts or overlapping their assignments to other trips
+func (s *TripAssignmentService) checkSchedule(tx *gorm.DB, assignment *models.TripAssignment) error {
+	end, err := AssignmentEnd(tx, assignment)
+	if err != nil {
+		return err
+	}
+	return checkDriverSchedule(tx, assignment.DriverID, assignment.TripID, assignment.StartsAt, end)
+}
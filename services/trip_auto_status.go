@@ -0,0 +1,274 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// States of trip status suggestions
+const (
+	StatusSuggestionPending   = "PENDING"
+	StatusSuggestionConfirmed = "CONFIRMED"
+	StatusSuggestionDismissed = "DISMISSED"
+)
+
+var (
+	ErrStatusSuggestionNotFound = errors.New("status suggestion not found")
+	ErrStatusSuggestionResolved = errors.New("status suggestion already resolved")
+)
+
+// SetAutoStatusConfig replaces the rules trip statuses are changed with from
+// tracking data
+func (ts *TrackingService) SetAutoStatusConfig(cfg *config.AutoStatusConfig) {
+	ts.autoStatus = cfg
+}
+
+// applyAutoStatus moves a trip to the status its newly recorded position
+// implies: a PLANNED trip that starts moving after its departure time
+// becomes ACTIVE, and a trip under way that enters the destination geofence
+// is AT_DELIVERY. Once it has stayed at the destination, completing it is
+// suggested to the carrier.
+func (ts *TrackingService) applyAutoStatus(record *models.TrackingRecord) error {
+	if !ts.autoStatus.Enabled {
+		return nil
+	}
+
+	var trip models.Trip
+	if err := ts.db.First(&trip, record.TripID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	latitude, longitude := SmoothedPosition(*record)
+
+	switch trip.Status {
+	case "PLANNED":
+		if record.Timestamp.Before(trip.DepartureDate) {
+			return nil
+		}
+		moving, err := ts.isMoving(record)
+		if err != nil || !moving {
+			return err
+		}
+		return ts.autoTransition(&trip, "ACTIVE", "Started moving after the departure time", latitude, longitude)
+	case "IN_TRANSIT", "DELAYED":
+		if !ts.atDestination(&trip, latitude, longitude) {
+			return nil
+		}
+		return ts.autoTransition(&trip, "AT_DELIVERY", "Entered the destination geofence", latitude, longitude)
+	case "AT_DELIVERY":
+		return ts.suggestCompletion(&trip, record)
+	}
+	return nil
+}
+
+// isMoving reports whether a tracking record shows its vehicle moving: at
+// the moving speed, or away from the trip's position before it
+func (ts *TrackingService) isMoving(record *models.TrackingRecord) (bool, error) {
+	if record.Speed != nil && *record.Speed >= ts.autoStatus.MovingSpeedKmh {
+		return true, nil
+	}
+
+	var previous models.TrackingRecord
+	err := ts.db.Where("trip_id = ? AND timestamp < ?", record.TripID, record.Timestamp).
+		Order("timestamp DESC").
+		First(&previous).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	fromLat, fromLng := SmoothedPosition(previous)
+	toLat, toLng := SmoothedPosition(*record)
+	return geo.Distance(fromLat, fromLng, toLat, toLng)*1000 >= ts.autoStatus.MovingDistanceMeters, nil
+}
+
+// atDestination reports whether a position is within the geofence of a
+// trip's destination
+func (ts *TrackingService) atDestination(trip *models.Trip, latitude, longitude float64) bool {
+	if trip.DestinationLat == 0 && trip.DestinationLng == 0 {
+		return false
+	}
+	return geo.Distance(latitude, longitude, trip.DestinationLat, trip.DestinationLng) <= ts.detention.GeofenceRadiusKm
+}
+
+// autoTransition changes a trip's status from its tracking data, recording
+// an AUTO_STATUS_CHANGE event and notifying the trip's shippers as for a
+// status set by the carrier
+func (ts *TrackingService) autoTransition(trip *models.Trip, status, reason string, latitude, longitude float64) error {
+	previous := trip.Status
+	if err := ts.UpdateTripStatus(trip.ID, status); err != nil {
+		return fmt.Errorf("failed to change status to %s: %w", status, err)
+	}
+
+	data, _ := json.Marshal(map[string]string{"from": previous, "to": status, "reason": reason})
+	if err := ts.LogTrackingEvent(trip.ID, nil, "AUTO_STATUS_CHANGE", string(data), "", &latitude, &longitude,
+		fmt.Sprintf("Trip status automatically changed from %s to %s: %s", previous, status, reason)); err != nil {
+		log.Printf("Failed to log automatic status change of trip %d: %v", trip.ID, err)
+	}
+
+	if err := NewNotificationTriggerService(ts.db).TripStatusChangeHandler(trip.ID, previous, status); err != nil {
+		log.Printf("Failed to notify status change of trip %d: %v", trip.ID, err)
+	}
+	return nil
+}
+
+// suggestCompletion suggests completing a trip whose vehicle has been within
+// the destination geofence for the whole completion dwell time up to a
+// record. A trip gets one suggestion per arrival at the destination, so a
+// dismissed suggestion isn't made again until the trip arrives anew.
+func (ts *TrackingService) suggestCompletion(trip *models.Trip, record *models.TrackingRecord) error {
+	latitude, longitude := SmoothedPosition(*record)
+	if !ts.atDestination(trip, latitude, longitude) {
+		return nil
+	}
+
+	// The vehicle must have been at the destination when the dwell time
+	// started, and every position since
+	since := record.Timestamp.Add(-ts.autoStatus.CompletionDwell)
+	var arrived models.TrackingRecord
+	err := ts.db.Where("trip_id = ? AND timestamp <= ?", trip.ID, since).
+		Order("timestamp DESC").
+		First(&arrived).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var records []models.TrackingRecord
+	if err := ts.db.Where("trip_id = ? AND timestamp > ? AND timestamp <= ?", trip.ID, since, record.Timestamp).
+		Find(&records).Error; err != nil {
+		return err
+	}
+	for _, stopped := range append(records, arrived) {
+		lat, lng := SmoothedPosition(stopped)
+		if !ts.atDestination(trip, lat, lng) {
+			return nil
+		}
+	}
+
+	var status models.TrackingStatus
+	if err := ts.db.Where("trip_id = ? AND load_id IS NULL", trip.ID).First(&status).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	var suggested int64
+	if err := ts.db.Model(&models.TripStatusSuggestion{}).
+		Where("trip_id = ? AND status = ? AND (state = ? OR suggested_at >= ?)",
+			trip.ID, "COMPLETED", StatusSuggestionPending, status.StatusChangedAt).
+		Count(&suggested).Error; err != nil {
+		return err
+	}
+	if suggested > 0 {
+		return nil
+	}
+
+	minutes := int(ts.autoStatus.CompletionDwell.Minutes())
+	suggestion := models.TripStatusSuggestion{
+		TripID:      trip.ID,
+		Status:      "COMPLETED",
+		Reason:      fmt.Sprintf("Stopped at the destination for %s", formatMinutes(minutes)),
+		State:       StatusSuggestionPending,
+		SuggestedAt: time.Now(),
+	}
+	if err := ts.db.Create(&suggestion).Error; err != nil {
+		return fmt.Errorf("failed to save status suggestion: %w", err)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{"suggestion_id": suggestion.ID, "status": suggestion.Status})
+	if err := ts.LogTrackingEvent(trip.ID, nil, "STATUS_SUGGESTED", string(data), "", &latitude, &longitude,
+		fmt.Sprintf("Completion suggested: %s", suggestion.Reason)); err != nil {
+		log.Printf("Failed to log status suggestion for trip %d: %v", trip.ID, err)
+	}
+	ts.notifyStatusSuggestion(trip, &suggestion)
+	return nil
+}
+
+// notifyStatusSuggestion asks the trip's carrier and dispatchers to confirm
+// a suggested status
+func (ts *TrackingService) notifyStatusSuggestion(trip *models.Trip, suggestion *models.TripStatusSuggestion) {
+	for _, userID := range tripDispatchers(ts.db, trip) {
+		notification := models.Notification{
+			UserID:    userID,
+			Title:     "Confirm Trip Status",
+			Message:   fmt.Sprintf("Trip %d: %s. Confirm to mark it %s.", trip.ID, suggestion.Reason, suggestion.Status),
+			Type:      "TRIP_STATUS_SUGGESTION",
+			RelatedID: trip.ID,
+		}
+		if notifications := GetNotificationService(); notifications != nil {
+			if created, _, err := notifications.CreateNotificationWithDelivery(&notification); created == nil {
+				log.Printf("Failed to notify user %d of status suggestion for trip %d: %v", userID, trip.ID, err)
+			}
+		} else {
+			ts.db.Create(&notification)
+		}
+	}
+}
+
+// GetStatusSuggestions returns the status suggestions of a trip, newest
+// first, optionally in one state
+func (ts *TrackingService) GetStatusSuggestions(tripID uint, state string) ([]models.TripStatusSuggestion, error) {
+	query := ts.db.Where("trip_id = ?", tripID)
+	if state != "" {
+		query = query.Where("state = ?", state)
+	}
+	suggestions := []models.TripStatusSuggestion{}
+	err := query.Order("suggested_at DESC").Order("id DESC").Find(&suggestions).Error
+	return suggestions, err
+}
+
+// ConfirmStatusSuggestion applies a pending status suggestion of a trip on
+// behalf of a user
+func (ts *TrackingService) ConfirmStatusSuggestion(tripID, suggestionID, userID uint) (*models.TripStatusSuggestion, error) {
+	suggestion, err := ts.pendingStatusSuggestion(tripID, suggestionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ts.UpdateTripStatus(tripID, suggestion.Status); err != nil {
+		return nil, err
+	}
+	return suggestion, ts.resolveStatusSuggestion(suggestion, StatusSuggestionConfirmed, userID)
+}
+
+// DismissStatusSuggestion rejects a pending status suggestion of a trip on
+// behalf of a user, leaving the trip's status as it is
+func (ts *TrackingService) DismissStatusSuggestion(tripID, suggestionID, userID uint) (*models.TripStatusSuggestion, error) {
+	suggestion, err := ts.pendingStatusSuggestion(tripID, suggestionID)
+	if err != nil {
+		return nil, err
+	}
+	return suggestion, ts.resolveStatusSuggestion(suggestion, StatusSuggestionDismissed, userID)
+}
+
+func (ts *TrackingService) pendingStatusSuggestion(tripID, suggestionID uint) (*models.TripStatusSuggestion, error) {
+	var suggestion models.TripStatusSuggestion
+	if err := ts.db.Where("id = ? AND trip_id = ?", suggestionID, tripID).First(&suggestion).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrStatusSuggestionNotFound
+		}
+		return nil, err
+	}
+	if suggestion.State != StatusSuggestionPending {
+		return nil, ErrStatusSuggestionResolved
+	}
+	return &suggestion, nil
+}
+
+func (ts *TrackingService) resolveStatusSuggestion(suggestion *models.TripStatusSuggestion, state string, userID uint) error {
+	now := time.Now()
+	suggestion.State = state
+	suggestion.ResolvedAt = &now
+	suggestion.ResolvedBy = &userID
+	if err := ts.db.Save(suggestion).Error; err != nil {
+		return fmt.Errorf("failed to save status suggestion: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TripCapacityService reserves and releases trip capacity when loads are
+// booked onto or removed from trips
+type TripCapacityService struct {
+	db *gorm.DB
+}
+
+// NewTripCapacityService creates a new trip capacity service instance
+func NewTripCapacityService(db *gorm.DB) *TripCapacityService {
+	return &TripCapacityService{db: db}
+}
+
+// ReserveCapacity adds weight and volume to the used capacity of a trip inside
+// the transaction tx. The trip row is locked and the update only applies while
+// the trip stays within its total capacity, so concurrent bookings can't oversell it.
+func (tcs *TripCapacityService) ReserveCapacity(tx *gorm.DB, tripID uint, weight, volume float64) error {
+	if weight < 0 || volume < 0 {
+		return errors.New("weight and volume cannot be negative")
+	}
+
+	var trip models.Trip
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&trip, tripID).Error; err != nil {
+		return errors.New("trip not found")
+	}
+	if trip.Status == "COMPLETED" || trip.Status == "CANCELLED" {
+		return fmt.Errorf("cannot book loads on a %s trip", trip.Status)
+	}
+
+	// The capacity check is repeated in the UPDATE so it holds even where
+	// the database ignores row locks
+	result := tx.Model(&models.Trip{}).
+		Where("id = ?", tripID).
+		Where("used_weight + ? <= total_capacity_weight", weight).
+		Where("used_volume + ? <= total_capacity_volume", volume).
+		Updates(map[string]interface{}{
+			"used_weight": gorm.Expr("used_weight + ?", weight),
+			"used_volume": gorm.Expr("used_volume + ?", volume),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to reserve trip capacity: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("trip does not have enough remaining capacity: %.2f kg and %.2f m3 available",
+			trip.TotalCapacityWeight-trip.UsedWeight, trip.TotalCapacityVolume-trip.UsedVolume)
+	}
+	return nil
+}
+
+// ReleaseCapacity returns weight and volume to a trip inside the transaction tx
+func (tcs *TripCapacityService) ReleaseCapacity(tx *gorm.DB, tripID uint, weight, volume float64) error {
+	var trip models.Trip
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&trip, tripID).Error; err != nil {
+		return errors.New("trip not found")
+	}
+
+	usedWeight := trip.UsedWeight - weight
+	if usedWeight < 0 {
+		usedWeight = 0
+	}
+	usedVolume := trip.UsedVolume - volume
+	if usedVolume < 0 {
+		usedVolume = 0
+	}
+
+	if err := tx.Model(&trip).Updates(map[string]interface{}{
+		"used_weight": usedWeight,
+		"used_volume": usedVolume,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to release trip capacity: %w", err)
+	}
+	return nil
+}
+
+// CreateLoad creates a load, reserving capacity on its trip when it is created
+// already assigned to one
+func (tcs *TripCapacityService) CreateLoad(load *models.Load) error {
+	return tcs.db.Transaction(func(tx *gorm.DB) error {
+		if load.TripID != 0 {
+			if err := tcs.ReserveCapacity(tx, load.TripID, load.Weight, load.Volume); err != nil {
+				return err
+			}
+			if load.Status == "" {
+				load.Status = "BOOKED"
+			}
+		}
+
+		if err := tx.Create(load).Error; err != nil {
+			return fmt.Errorf("failed to create load: %w", err)
+		}
+		return nil
+	})
+}
+
+// BookLoad assigns an unassigned load to a trip and reserves its capacity
+func (tcs *TripCapacityService) BookLoad(loadID, tripID uint) (*models.Load, error) {
+	var load models.Load
+	err := tcs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&load, loadID).Error; err != nil {
+			return errors.New("load not found")
+		}
+		if load.TripID != 0 {
+			return errors.New("load is already assigned to a trip")
+		}
+		if load.Status == "DELIVERED" || load.Status == "CANCELLED" {
+			return fmt.Errorf("cannot book a load with status %s", load.Status)
+		}
+
+		if err := tcs.ReserveCapacity(tx, tripID, load.Weight, load.Volume); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&load).Updates(map[string]interface{}{
+			"trip_id": tripID,
+			"status":  "BOOKED",
+		}).Error; err != nil {
+			return fmt.Errorf("failed to book load: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &load, nil
+}
+
+// CancelBooking removes a load from its trip and releases the reserved capacity
+func (tcs *TripCapacityService) CancelBooking(loadID uint) (*models.Load, error) {
+	var load models.Load
+	err := tcs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&load, loadID).Error; err != nil {
+			return errors.New("load not found")
+		}
+		if load.TripID == 0 {
+			return errors.New("load is not assigned to a trip")
+		}
+		if load.Status != "BOOKED" && load.Status != "PICKUP_SCHEDULED" {
+			return fmt.Errorf("cannot cancel the booking of a load with status %s", load.Status)
+		}
+
+		if err := tcs.ReleaseCapacity(tx, load.TripID, load.Weight, load.Volume); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&load).Updates(map[string]interface{}{
+			"trip_id": 0,
+			"status":  "QUOTE_REQUESTED",
+		}).Error; err != nil {
+			return fmt.Errorf("failed to cancel booking: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &load, nil
+}
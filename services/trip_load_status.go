@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"triplink/backend/apierror"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// LoadStatusResult is the outcome of changing the status of one load of a
+// bulk change
+type LoadStatusResult struct {
+	LoadID           uint   `json:"load_id"`
+	BookingReference string `json:"booking_reference,omitempty"`
+	ShipperID        uint   `json:"-"`
+	PreviousStatus   string `json:"previous_status,omitempty"`
+	Status           string `json:"status,omitempty"`
+	Version          uint   `json:"version,omitempty"`
+	Updated          bool   `json:"updated"`
+	// Why the load wasn't changed, with the code of the API error
+	Code  string `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ChangeTripLoadStatuses moves loads of a trip to a status together, e.g.
+// when the trip departs: the given loads, or without any every load of the
+// trip that isn't at a final status. Loads whose status machine doesn't
+// allow the change, or that another request changed meanwhile, are left as
+// they are and reported with the reason. The changes and their events are
+// committed in one transaction, so they're published as one batch.
+func (ts *TrackingService) ChangeTripLoadStatuses(tripID uint, newStatus string, loadIDs []uint) ([]LoadStatusResult, error) {
+	query := ts.db.Where("trip_id = ?", tripID)
+	if len(loadIDs) > 0 {
+		query = query.Where("id IN ?", loadIDs)
+	} else {
+		var open []string
+		for status, transitions := range LoadStatusMachine.Transitions {
+			if len(transitions) > 0 {
+				open = append(open, status)
+			}
+		}
+		query = query.Where("status IN ?", open)
+	}
+	var loads []models.Load
+	if err := query.Order("id ASC").Find(&loads).Error; err != nil {
+		return nil, fmt.Errorf("failed to get loads: %w", err)
+	}
+
+	results := make([]LoadStatusResult, 0, len(loads)+len(loadIDs))
+	now := time.Now()
+	err := ts.db.Transaction(func(tx *gorm.DB) error {
+		for i := range loads {
+			load := &loads[i]
+			result := LoadStatusResult{
+				LoadID:           load.ID,
+				BookingReference: load.BookingReference,
+				ShipperID:        load.ShipperID,
+				PreviousStatus:   load.Status,
+				Status:           load.Status,
+				Version:          load.Version,
+			}
+			change := StatusChange{ID: load.ID, From: load.Status, To: newStatus, Version: load.Version, TripID: tripID, LoadID: &load.ID, At: now}
+
+			// Each load is changed in a savepoint, so a rejected change
+			// leaves the others in the batch
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				return applyLoadStatus(tx, change)
+			})
+			var rejection *StatusTransitionError
+			switch {
+			case errors.As(err, &rejection):
+				apiErr := rejection.APIError()
+				result.Code = string(apiErr.Code)
+				result.Error = apiErr.Message
+				result.Status = rejection.From
+				result.Version = rejection.Version
+			case err != nil:
+				return err
+			default:
+				result.Status = newStatus
+				result.Version = load.Version + 1
+				result.Updated = true
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if newStatus == "EXCEPTION" {
+		for i, result := range results {
+			if result.Updated {
+				sendLoadExceptionAlert(ts.db, &loads[i], result.PreviousStatus)
+			}
+		}
+	}
+
+	// Loads asked for that aren't on the trip
+	found := make(map[uint]bool, len(loads))
+	for _, load := range loads {
+		found[load.ID] = true
+	}
+	for _, loadID := range loadIDs {
+		if !found[loadID] {
+			found[loadID] = true
+			results = append(results, LoadStatusResult{LoadID: loadID, Code: string(apierror.CodeNotFound), Error: "Load not found on the trip"})
+		}
+	}
+	return results, nil
+}
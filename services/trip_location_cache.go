@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"triplink/backend/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrTripLocationCacheMiss is returned when a trip has nothing cached
+var ErrTripLocationCacheMiss = errors.New("trip location not cached")
+
+// TripLocationCache holds the latest location and ETA of trips so that
+// dashboards refreshing them don't query the database each time
+type TripLocationCache interface {
+	GetLocation(tripID uint) (*models.TrackingRecord, error)
+	SetLocation(record *models.TrackingRecord) error
+	GetETA(tripID uint) (*time.Time, error)
+	SetETA(tripID uint, eta time.Time) error
+	// Invalidate drops everything cached for a trip
+	Invalidate(tripID uint) error
+}
+
+// Global trip location cache instance. Without one, reads go to the database.
+var (
+	tripLocationCacheInstance TripLocationCache
+	tripLocationCacheMu       sync.RWMutex
+)
+
+// GetTripLocationCache returns the shared trip location cache, or nil when
+// locations aren't cached
+func GetTripLocationCache() TripLocationCache {
+	tripLocationCacheMu.RLock()
+	defer tripLocationCacheMu.RUnlock()
+	return tripLocationCacheInstance
+}
+
+// SetTripLocationCache replaces the shared trip location cache. nil disables
+// caching.
+func SetTripLocationCache(cache TripLocationCache) {
+	tripLocationCacheMu.Lock()
+	defer tripLocationCacheMu.Unlock()
+	tripLocationCacheInstance = cache
+}
+
+// RedisTripLocationCache caches trip locations and ETAs in Redis, shared by
+// all API instances
+type RedisTripLocationCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisTripLocationCache creates a Redis trip location cache whose entries
+// expire after ttl, bounding how stale a missed write can leave them
+func NewRedisTripLocationCache(client *redis.Client, ttl time.Duration) *RedisTripLocationCache {
+	if ttl <= 0 {
+		ttl = RealtimeCacheTTL
+	}
+	return &RedisTripLocationCache{client: client, ttl: ttl}
+}
+
+func tripLocationKey(tripID uint) string {
+	return fmt.Sprintf("%strip:%d:location", RealtimePrefix, tripID)
+}
+
+func tripETAKey(tripID uint) string {
+	return fmt.Sprintf("%strip:%d:eta", RealtimePrefix, tripID)
+}
+
+// GetLocation returns the cached location of a trip
+func (c *RedisTripLocationCache) GetLocation(tripID uint) (*models.TrackingRecord, error) {
+	var record models.TrackingRecord
+	if err := c.get(tripLocationKey(tripID), &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// SetLocation caches the location of the record's trip
+func (c *RedisTripLocationCache) SetLocation(record *models.TrackingRecord) error {
+	return c.set(tripLocationKey(record.TripID), record)
+}
+
+// GetETA returns the cached ETA of a trip
+func (c *RedisTripLocationCache) GetETA(tripID uint) (*time.Time, error) {
+	var eta time.Time
+	if err := c.get(tripETAKey(tripID), &eta); err != nil {
+		return nil, err
+	}
+	return &eta, nil
+}
+
+// SetETA caches the ETA of a trip
+func (c *RedisTripLocationCache) SetETA(tripID uint, eta time.Time) error {
+	return c.set(tripETAKey(tripID), eta)
+}
+
+// Invalidate drops the cached location and ETA of a trip
+func (c *RedisTripLocationCache) Invalidate(tripID uint) error {
+	return c.client.Del(context.Background(), tripLocationKey(tripID), tripETAKey(tripID)).Err()
+}
+
+func (c *RedisTripLocationCache) get(key string, dest interface{}) error {
+	data, err := c.client.Get(context.Background(), key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ErrTripLocationCacheMiss
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func (c *RedisTripLocationCache) set(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal data: %w", err)
+	}
+	return c.client.Set(context.Background(), key, data, c.ttl).Err()
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"triplink/backend/models"
+)
+
+// TripProgress is how far a trip has come along its route
+type TripProgress struct {
+	DistanceCoveredKm float64 `json:"distance_covered_km"`
+	RouteDistanceKm   float64 `json:"route_distance_km"`
+	Percent           float64 `json:"percent"`
+}
+
+// tripRoute returns the planned route of a trip, or the straight line from
+// its origin to its destination without one. Trips without coordinates have
+// no route.
+func tripRoute(trip *models.Trip) []Coordinate {
+	if planned, err := DecodePolyline(trip.PlannedRoutePolyline); err == nil && len(planned) >= 2 {
+		return planned
+	}
+	origin := Coordinate{Latitude: trip.OriginLat, Longitude: trip.OriginLng}
+	destination := Coordinate{Latitude: trip.DestinationLat, Longitude: trip.DestinationLng}
+	if origin == destination {
+		return nil
+	}
+	return []Coordinate{origin, destination}
+}
+
+// calculateTripProgress returns how far along its route a position puts a
+// trip. The position is projected onto the nearest point of the route, so
+// progress is measured along the road rather than as the crow flies.
+func calculateTripProgress(trip *models.Trip, position Coordinate) (*TripProgress, bool) {
+	route := tripRoute(trip)
+	if len(route) < 2 {
+		return nil, false
+	}
+	cumulative := routeDistances(route)
+	total := cumulative[len(cumulative)-1]
+	if total == 0 {
+		return nil, false
+	}
+
+	_, along := ProjectOntoPath(route, position)
+	covered := along * total
+	return &TripProgress{
+		DistanceCoveredKm: math.Round(covered*10) / 10,
+		RouteDistanceKm:   math.Round(total*10) / 10,
+		Percent:           math.Round(along*1000) / 10,
+	}, true
+}
+
+// updateTripProgress stores the progress of a trip at a position on its
+// tracking status
+func (ts *TrackingService) updateTripProgress(tripID uint, position Coordinate) error {
+	var trip models.Trip
+	if err := ts.db.First(&trip, tripID).Error; err != nil {
+		return err
+	}
+	progress, ok := calculateTripProgress(&trip, position)
+	if !ok {
+		return nil
+	}
+
+	var status models.TrackingStatus
+	if err := ts.db.Where("trip_id = ? AND load_id IS NULL", tripID).First(&status).Error; err != nil {
+		status = models.TrackingStatus{
+			TripID:            tripID,
+			CurrentStatus:     trip.Status,
+			StatusChangedAt:   time.Now(),
+			CompletionPercent: progress.Percent,
+			DistanceCoveredKm: progress.DistanceCoveredKm,
+			RouteDistanceKm:   progress.RouteDistanceKm,
+		}
+		if err := ts.db.Create(&status).Error; err != nil {
+			return fmt.Errorf("failed to create tracking status: %w", err)
+		}
+		return nil
+	}
+
+	return ts.db.Model(&status).Updates(map[string]interface{}{
+		"completion_percent":  progress.Percent,
+		"distance_covered_km": progress.DistanceCoveredKm,
+		"route_distance_km":   progress.RouteDistanceKm,
+	}).Error
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+	"triplink/backend/models"
+	"triplink/backend/tracing"
+)
+
+// maxReplayFrames caps the frames of a replay so long trips need a coarser interval
+const maxReplayFrames = 10000
+
+// ReplayFrame is the interpolated position of a trip at a point in time
+type ReplayFrame struct {
+	Index          int       `json:"index"`
+	Timestamp      time.Time `json:"timestamp"`
+	ElapsedSeconds float64   `json:"elapsed_seconds"`
+	// Offset from the start of the animation at the requested playback speed
+	PlaybackMs int64    `json:"playback_ms"`
+	Latitude   float64  `json:"latitude"`
+	Longitude  float64  `json:"longitude"`
+	Speed      *float64 `json:"speed,omitempty"`
+	Heading    *float64 `json:"heading,omitempty"`
+	// Set when no tracking record was taken at the frame time
+	Interpolated bool `json:"interpolated"`
+	// Set when the position is snapped to the road network
+	Snapped bool `json:"snapped"`
+}
+
+// TripReplay is the tracking history of a trip resampled into evenly spaced
+// frames for animated playback
+type TripReplay struct {
+	TripID          uint          `json:"trip_id"`
+	StartTime       *time.Time    `json:"start_time"`
+	EndTime         *time.Time    `json:"end_time"`
+	DurationSeconds float64       `json:"duration_seconds"`
+	IntervalSeconds float64       `json:"interval_seconds"`
+	PlaybackSpeed   float64       `json:"playback_speed"`
+	RecordCount     int           `json:"record_count"`
+	FrameCount      int           `json:"frame_count"`
+	Frames          []ReplayFrame `json:"frames"`
+}
+
+// GetTripReplay resamples a trip's tracking history into frames spaced by
+// interval. playbackSpeed compresses time for the animation, e.g. 60 plays
+// one minute of the trip per second.
+func (ts *TrackingService) GetTripReplay(tripID uint, interval time.Duration, playbackSpeed float64) (*TripReplay, error) {
+	if interval <= 0 {
+		return nil, errors.New("replay interval must be positive")
+	}
+	if playbackSpeed <= 0 {
+		return nil, errors.New("playback speed must be positive")
+	}
+
+	// Snap records missed at ingestion, e.g. while the provider was down.
+	// The replay falls back to raw positions when matching fails.
+	if ts.mapMatching.OnReplay {
+		if _, err := ts.SnapTripRecords(tripID); err != nil {
+			tracing.Logf(ts.ctx, "Failed to map match replay of trip %d: %v", tripID, err)
+		}
+	}
+
+	var records []models.TrackingRecord
+	if err := TripTrackingRecords(ts.db, tripID).
+		Order("timestamp ASC").Order("id ASC").
+		Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to get tracking history: %w", err)
+	}
+
+	replay := &TripReplay{
+		TripID:          tripID,
+		IntervalSeconds: interval.Seconds(),
+		PlaybackSpeed:   playbackSpeed,
+		RecordCount:     len(records),
+		Frames:          []ReplayFrame{},
+	}
+	if len(records) == 0 {
+		return replay, nil
+	}
+
+	start := records[0].Timestamp
+	end := records[len(records)-1].Timestamp
+	if frames := int(end.Sub(start)/interval) + 2; frames > maxReplayFrames {
+		return nil, fmt.Errorf("replay would have more than %d frames, use a larger interval", maxReplayFrames)
+	}
+
+	replay.StartTime = &start
+	replay.EndTime = &end
+	replay.DurationSeconds = end.Sub(start).Seconds()
+	replay.Frames = resampleTrack(records, interval, playbackSpeed)
+	replay.FrameCount = len(replay.Frames)
+	return replay, nil
+}
+
+// resampleTrack interpolates records, sorted by timestamp, at every interval
+// from the first record. The last record is always included as the final
+// frame, so the final step may be shorter than interval.
+func resampleTrack(records []models.TrackingRecord, interval time.Duration, playbackSpeed float64) []ReplayFrame {
+	if len(records) == 0 {
+		return []ReplayFrame{}
+	}
+
+	start := records[0].Timestamp
+	end := records[len(records)-1].Timestamp
+
+	var frames []ReplayFrame
+	addFrame := func(at time.Time, segment int) {
+		frame := interpolateRecords(records, segment, at)
+		frame.Index = len(frames)
+		frame.Timestamp = at
+		frame.ElapsedSeconds = at.Sub(start).Seconds()
+		frame.PlaybackMs = int64(frame.ElapsedSeconds * 1000 / playbackSpeed)
+		frames = append(frames, frame)
+	}
+
+	segment := 0
+	at := start
+	for !at.After(end) {
+		// Move to the segment whose records surround the frame time
+		for segment < len(records)-2 && !records[segment+1].Timestamp.After(at) {
+			segment++
+		}
+		addFrame(at, segment)
+		at = at.Add(interval)
+	}
+	if last := frames[len(frames)-1]; last.Timestamp.Before(end) {
+		addFrame(end, len(records)-2)
+	}
+
+	return frames
+}
+
+// interpolateRecords returns the position at a time between the record at
+// segment and the next one
+func interpolateRecords(records []models.TrackingRecord, segment int, at time.Time) ReplayFrame {
+	if len(records) == 1 || segment < 0 {
+		return recordFrame(records[0], !records[0].Timestamp.Equal(at))
+	}
+
+	from, to := records[segment], records[segment+1]
+	if at.Equal(from.Timestamp) {
+		return recordFrame(from, false)
+	}
+	if at.Equal(to.Timestamp) {
+		return recordFrame(to, false)
+	}
+
+	fraction := 0.0
+	if span := to.Timestamp.Sub(from.Timestamp); span > 0 {
+		fraction = math.Max(0, math.Min(1, float64(at.Sub(from.Timestamp))/float64(span)))
+	}
+
+	fromLat, fromLng, fromSnapped := TrackPosition(from)
+	toLat, toLng, toSnapped := TrackPosition(to)
+
+	// Take the short way around across the antimeridian
+	lngDelta := toLng - fromLng
+	if lngDelta > 180 {
+		lngDelta -= 360
+	} else if lngDelta < -180 {
+		lngDelta += 360
+	}
+	longitude := fromLng + lngDelta*fraction
+	if longitude > 180 {
+		longitude -= 360
+	} else if longitude < -180 {
+		longitude += 360
+	}
+
+	frame := ReplayFrame{
+		Latitude:     fromLat + (toLat-fromLat)*fraction,
+		Longitude:    longitude,
+		Interpolated: true,
+		Snapped:      fromSnapped && toSnapped,
+	}
+	if from.Speed != nil && to.Speed != nil {
+		speed := *from.Speed + (*to.Speed-*from.Speed)*fraction
+		frame.Speed = &speed
+	}
+	if from.Heading != nil && to.Heading != nil {
+		headingDelta := math.Mod(*to.Heading-*from.Heading+540, 360) - 180
+		heading := math.Mod(*from.Heading+headingDelta*fraction+360, 360)
+		frame.Heading = &heading
+	}
+	return frame
+}
+
+func recordFrame(record models.TrackingRecord, interpolated bool) ReplayFrame {
+	latitude, longitude, snapped := TrackPosition(record)
+	return ReplayFrame{
+		Latitude:     latitude,
+		Longitude:    longitude,
+		Speed:        record.Speed,
+		Heading:      record.Heading,
+		Interpolated: interpolated,
+		Snapped:      snapped,
+	}
+}
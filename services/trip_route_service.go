@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+)
+
+// RouteOverview combines the planned route with the simplified path actually
+// traveled so clients can render both without downloading every raw point
+type RouteOverview struct {
+	TripID               uint         `json:"trip_id"`
+	PlannedPolyline      string       `json:"planned_polyline,omitempty"`
+	PlannedRouteSource   string       `json:"planned_route_source,omitempty"`
+	PlannedRoute         []Coordinate `json:"planned_route"`
+	TraveledPolyline     string       `json:"traveled_polyline"`
+	TraveledPath         []Coordinate `json:"traveled_path"`
+	RawPointCount        int          `json:"raw_point_count"`
+	SimplifiedPointCount int          `json:"simplified_point_count"`
+	ToleranceMeters      float64      `json:"tolerance_meters"`
+	GeneratedAt          time.Time    `json:"generated_at"`
+}
+
+// SetPlannedRoute stores an encoded polyline as the planned route of a trip
+func (ts *TrackingService) SetPlannedRoute(tripID uint, polyline string, source string) error {
+	if polyline == "" {
+		return errors.New("polyline cannot be empty")
+	}
+	if _, err := DecodePolyline(polyline); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	result := ts.db.Model(&models.Trip{}).Where("id = ?", tripID).Updates(map[string]interface{}{
+		"planned_route_polyline":   polyline,
+		"planned_route_source":     source,
+		"planned_route_updated_at": &now,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("trip not found")
+	}
+
+	// Tolls follow the route, but a failure to price them doesn't undo it
+	if tolls := GetTripTollService(); tolls != nil {
+		if _, err := tolls.RefreshTrip(tripID); err != nil {
+			log.Printf("Failed to recalculate tolls of trip %d: %v", tripID, err)
+		}
+	}
+	return nil
+}
+
+// PlannedRouteProvider plans the road route between two coordinates
+type PlannedRouteProvider interface {
+	Name() string
+	PlannedRoute(ctx context.Context, origin, destination Coordinate) ([]Coordinate, error)
+}
+
+// defaultPlannedRouteProviders returns the routing providers that have API
+// keys configured, in the configured order of preference
+func defaultPlannedRouteProviders() []PlannedRouteProvider {
+	var providers []PlannedRouteProvider
+	for _, name := range config.GetCircuitBreakerConfig().RoutingProviders {
+		if provider := routingProvider(name); provider != nil {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+// SetPlannedRouteProviders replaces the routing providers planned routes are
+// fetched from
+func (ts *TrackingService) SetPlannedRouteProviders(providers ...PlannedRouteProvider) {
+	ts.routeProviders = providers
+}
+
+// FetchPlannedRoute plans the route between the trip origin and destination
+// with the first routing provider that succeeds and stores it on the trip
+func (ts *TrackingService) FetchPlannedRoute(tripID uint) error {
+	var trip models.Trip
+	if err := ts.db.First(&trip, tripID).Error; err != nil {
+		return err
+	}
+	if (trip.OriginLat == 0 && trip.OriginLng == 0) || (trip.DestinationLat == 0 && trip.DestinationLng == 0) {
+		return errors.New("trip has no origin or destination coordinates")
+	}
+	if len(ts.routeProviders) == 0 {
+		return errors.New("no routing provider is configured")
+	}
+
+	origin := Coordinate{Latitude: trip.OriginLat, Longitude: trip.OriginLng}
+	destination := Coordinate{Latitude: trip.DestinationLat, Longitude: trip.DestinationLng}
+
+	var failures []string
+	for _, provider := range ts.routeProviders {
+		route, err := provider.PlannedRoute(ts.ctx, origin, destination)
+		if err == nil && len(route) < 2 {
+			err = errors.New("no route returned")
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", provider.Name(), err))
+			continue
+		}
+		return ts.SetPlannedRoute(tripID, EncodePolyline(route), provider.Name())
+	}
+	return fmt.Errorf("all routing providers failed: %s", strings.Join(failures, "; "))
+}
+
+// PlannedRoute returns the overview path of the driving directions
+func (g *GoogleMapsService) PlannedRoute(ctx context.Context, origin, destination Coordinate) ([]Coordinate, error) {
+	directions, err := g.GetDirectionsContext(ctx,
+		fmt.Sprintf("%f,%f", origin.Latitude, origin.Longitude),
+		fmt.Sprintf("%f,%f", destination.Latitude, destination.Longitude),
+		DirectionOptions{
+			Mode:  "driving",
+			Units: "metric",
+		})
+	if err != nil {
+		return nil, err
+	}
+	if len(directions.Routes) == 0 || directions.Routes[0].OverviewPolyline == "" {
+		return nil, fmt.Errorf("directions request failed with status %s", directions.Status)
+	}
+	return DecodePolyline(directions.Routes[0].OverviewPolyline)
+}
+
+// PlannedRoute returns the path of the route's sections, which HERE encodes
+// as flexible polylines
+func (h *HEREAPIService) PlannedRoute(ctx context.Context, origin, destination Coordinate) ([]Coordinate, error) {
+	response, err := h.getRouteWithTraffic(ctx,
+		fmt.Sprintf("%f,%f", origin.Latitude, origin.Longitude),
+		fmt.Sprintf("%f,%f", destination.Latitude, destination.Longitude))
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Routes) == 0 {
+		return nil, errors.New("no routes found")
+	}
+
+	var route []Coordinate
+	for _, section := range response.Routes[0].Sections {
+		points, err := geo.DecodeFlexiblePolyline(section.Polyline)
+		if err != nil {
+			return nil, err
+		}
+		for i, point := range points {
+			// Each section starts where the previous one ended
+			if i == 0 && len(route) > 0 {
+				continue
+			}
+			route = append(route, Coordinate{Latitude: point.Lat, Longitude: point.Lng})
+		}
+	}
+	return route, nil
+}
+
+// GetRouteOverview returns the planned route and the traveled path of a trip,
+// simplified with Douglas-Peucker using the given tolerance in meters
+func (ts *TrackingService) GetRouteOverview(tripID uint, toleranceMeters float64) (*RouteOverview, error) {
+	var trip models.Trip
+	if err := ts.db.First(&trip, tripID).Error; err != nil {
+		return nil, err
+	}
+
+	overview := &RouteOverview{
+		TripID:             tripID,
+		PlannedPolyline:    trip.PlannedRoutePolyline,
+		PlannedRouteSource: trip.PlannedRouteSource,
+		PlannedRoute:       []Coordinate{},
+		ToleranceMeters:    toleranceMeters,
+		GeneratedAt:        time.Now(),
+	}
+
+	if trip.PlannedRoutePolyline != "" {
+		planned, err := DecodePolyline(trip.PlannedRoutePolyline)
+		if err != nil {
+			return nil, fmt.Errorf("stored planned route is invalid: %w", err)
+		}
+		overview.PlannedRoute = planned
+	}
+
+	var records []models.TrackingRecord
+	if err := TripTrackingRecords(ts.db, tripID).
+		Select("latitude, longitude, matched_latitude, matched_longitude, timestamp").
+		Order("timestamp ASC").
+		Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	path := make([]Coordinate, len(records))
+	for i, record := range records {
+		latitude, longitude, _ := TrackPosition(record)
+		path[i] = Coordinate{Latitude: latitude, Longitude: longitude}
+	}
+
+	simplified := SimplifyPath(path, toleranceMeters)
+	overview.TraveledPath = simplified
+	overview.TraveledPolyline = EncodePolyline(simplified)
+	overview.RawPointCount = len(path)
+	overview.SimplifiedPointCount = len(simplified)
+
+	return overview, nil
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Trip search sort orders
+const (
+	TripSortDepartureDate = "departure_date"
+	TripSortPrice         = "price"
+	TripSortDistance      = "distance"
+)
+
+// maxTripSearchCandidates caps the trips read before the exact radius filter
+const maxTripSearchCandidates = 2000
+
+// TripSearchParams filters and sorts public trips
+type TripSearchParams struct {
+	// Free text matched against the addresses, cities, countries and notes
+	Query string
+
+	// Radius searches around the trip origin and destination
+	OriginLat           *float64
+	OriginLng           *float64
+	OriginRadiusKm      float64
+	DestinationLat      *float64
+	DestinationLng      *float64
+	DestinationRadiusKm float64
+
+	// Departure date window
+	DepartureFrom *time.Time
+	DepartureTo   *time.Time
+
+	VehicleType string
+
+	// Remaining capacity the trip must have, also used to estimate the price
+	MinWeight float64
+	MinVolume float64
+
+	// Price limits. The estimated price is the base price plus the weight and
+	// volume rates applied to MinWeight and MinVolume, and MinWeight's share
+	// of the trip's tolls.
+	MaxPrice      float64
+	MaxPricePerKg float64
+
+	SortBy string
+	Limit  int
+	Offset int
+}
+
+// TripSearchResult is a trip matching a search
+type TripSearchResult struct {
+	Trip                  models.Trip `json:"trip"`
+	RemainingWeight       float64     `json:"remaining_weight"`
+	RemainingVolume       float64     `json:"remaining_volume"`
+	EstimatedPrice        float64     `json:"estimated_price"`
+	EstimatedTolls        float64     `json:"estimated_tolls"` // included in the estimated price
+	OriginDistanceKm      *float64    `json:"origin_distance_km,omitempty"`
+	DestinationDistanceKm *float64    `json:"destination_distance_km,omitempty"`
+}
+
+// TripSearchService searches public trips by text, location, dates, vehicle,
+// capacity and price
+type TripSearchService struct {
+	db *gorm.DB
+}
+
+// NewTripSearchService creates a new trip search service instance
+func NewTripSearchService(db *gorm.DB) *TripSearchService {
+	return &TripSearchService{db: db}
+}
+
+// SearchTrips returns a page of public trips matching the search and the total
+// number of matches. Radius searches prefilter with a bounding box in the
+// database and then apply the exact great-circle distance.
+func (tss *TripSearchService) SearchTrips(params TripSearchParams) ([]TripSearchResult, int, error) {
+	if err := validateTripSearch(&params); err != nil {
+		return nil, 0, err
+	}
+
+	query := tss.db.Model(&models.Trip{}).
+		Where("is_public = ?", true).
+		Where("status IN ?", []string{"PLANNED", "ACTIVE"})
+
+	for _, term := range strings.Fields(strings.ToLower(params.Query)) {
+		pattern := "%" + term + "%"
+		query = query.Where("LOWER(origin_address) LIKE ? OR LOWER(origin_city) LIKE ? OR LOWER(origin_country) LIKE ? OR "+
+			"LOWER(destination_address) LIKE ? OR LOWER(destination_city) LIKE ? OR LOWER(destination_country) LIKE ? OR LOWER(notes) LIKE ?",
+			pattern, pattern, pattern, pattern, pattern, pattern, pattern)
+	}
+
+	if params.OriginLat != nil {
+		query = whereWithinBoundingBox(query, "origin_lat", "origin_lng", *params.OriginLat, *params.OriginLng, params.OriginRadiusKm)
+	}
+	if params.DestinationLat != nil {
+		query = whereWithinBoundingBox(query, "destination_lat", "destination_lng", *params.DestinationLat, *params.DestinationLng, params.DestinationRadiusKm)
+	}
+
+	if params.DepartureFrom != nil {
+		query = query.Where("departure_date >= ?", *params.DepartureFrom)
+	}
+	if params.DepartureTo != nil {
+		query = query.Where("departure_date <= ?", *params.DepartureTo)
+	}
+	if params.VehicleType != "" {
+		query = query.Where("vehicle_id IN (?)",
+			tss.db.Model(&models.Vehicle{}).Select("id").Where("vehicle_type = ? AND is_active = ?", params.VehicleType, true))
+	}
+	if params.MinWeight > 0 {
+		query = query.Where("total_capacity_weight - used_weight >= ?", params.MinWeight)
+	}
+	if params.MinVolume > 0 {
+		query = query.Where("total_capacity_volume - used_volume >= ?", params.MinVolume)
+	}
+	if params.MaxPricePerKg > 0 {
+		query = query.Where("price_per_kg <= ?", params.MaxPricePerKg)
+	}
+	if params.MaxPrice > 0 {
+		// The weight's share of the trip's tolls, as in TollShare
+		query = query.Where(`base_price + price_per_kg * ? + price_per_cubic_meter * ? +
+			CASE WHEN total_capacity_weight <= 0 OR ? >= total_capacity_weight THEN toll_cost
+			ELSE toll_cost * ? / total_capacity_weight END <= ?`,
+			params.MinWeight, params.MinVolume, params.MinWeight, params.MinWeight, params.MaxPrice)
+	}
+
+	var trips []models.Trip
+	if err := query.Order("departure_date ASC").Order("id ASC").
+		Limit(maxTripSearchCandidates).
+		Find(&trips).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to search trips: %w", err)
+	}
+
+	results := make([]TripSearchResult, 0, len(trips))
+	for _, trip := range trips {
+		result := TripSearchResult{
+			Trip:            trip,
+			RemainingWeight: trip.TotalCapacityWeight - trip.UsedWeight,
+			RemainingVolume: trip.TotalCapacityVolume - trip.UsedVolume,
+			EstimatedTolls:  TollShare(&trip, params.MinWeight),
+		}
+		result.EstimatedPrice = trip.BasePrice + trip.PricePerKg*params.MinWeight + trip.PricePerCubicMeter*params.MinVolume + result.EstimatedTolls
+
+		if params.OriginLat != nil {
+			distance := geo.Distance(*params.OriginLat, *params.OriginLng, trip.OriginLat, trip.OriginLng)
+			if distance > params.OriginRadiusKm {
+				continue
+			}
+			result.OriginDistanceKm = &distance
+		}
+		if params.DestinationLat != nil {
+			distance := geo.Distance(*params.DestinationLat, *params.DestinationLng, trip.DestinationLat, trip.DestinationLng)
+			if distance > params.DestinationRadiusKm {
+				continue
+			}
+			result.DestinationDistanceKm = &distance
+		}
+
+		results = append(results, result)
+	}
+
+	sortTripSearchResults(results, params.SortBy)
+
+	total := len(results)
+	if params.Offset >= total {
+		return []TripSearchResult{}, total, nil
+	}
+	end := params.Offset + params.Limit
+	if end > total {
+		end = total
+	}
+	return results[params.Offset:end], total, nil
+}
+
+// validateTripSearch checks the search parameters and applies defaults
+func validateTripSearch(params *TripSearchParams) error {
+	if (params.OriginLat == nil) != (params.OriginLng == nil) {
+		return errors.New("origin latitude and longitude must be given together")
+	}
+	if (params.DestinationLat == nil) != (params.DestinationLng == nil) {
+		return errors.New("destination latitude and longitude must be given together")
+	}
+	if params.OriginLat != nil && !isValidCoordinate(*params.OriginLat, *params.OriginLng) {
+		return errors.New("invalid origin coordinates")
+	}
+	if params.DestinationLat != nil && !isValidCoordinate(*params.DestinationLat, *params.DestinationLng) {
+		return errors.New("invalid destination coordinates")
+	}
+	if params.OriginRadiusKm <= 0 {
+		params.OriginRadiusKm = 50
+	}
+	if params.DestinationRadiusKm <= 0 {
+		params.DestinationRadiusKm = 50
+	}
+	if params.DepartureFrom != nil && params.DepartureTo != nil && params.DepartureTo.Before(*params.DepartureFrom) {
+		return errors.New("departure window ends before it starts")
+	}
+
+	switch params.SortBy {
+	case "":
+		params.SortBy = TripSortDepartureDate
+	case TripSortDepartureDate, TripSortPrice:
+	case TripSortDistance:
+		if params.OriginLat == nil && params.DestinationLat == nil {
+			return errors.New("sorting by distance needs an origin or destination location")
+		}
+	default:
+		return fmt.Errorf("invalid sort %q", params.SortBy)
+	}
+
+	if params.Limit <= 0 {
+		params.Limit = 20
+	}
+	if params.Offset < 0 {
+		params.Offset = 0
+	}
+	return nil
+}
+
+// whereWithinBoundingBox limits a latitude/longitude column pair to the box
+// around a point that contains its radius, so an index on the columns can be
+// used before the exact distance check
+func whereWithinBoundingBox(query *gorm.DB, latColumn, lngColumn string, lat, lng, radiusKm float64) *gorm.DB {
+	bounds := geo.BoundsAround(lat, lng, radiusKm)
+	query = query.Where(latColumn+" BETWEEN ? AND ?", bounds.MinLat, bounds.MaxLat)
+
+	// Near the poles or across the antimeridian the longitude is left to the
+	// exact check
+	if bounds.SpansAllLongitudes() {
+		return query
+	}
+	return query.Where(lngColumn+" BETWEEN ? AND ?", bounds.MinLng, bounds.MaxLng)
+}
+
+// sortTripSearchResults sorts results in place. The results arrive sorted by
+// departure date, which is kept as the tie-breaker.
+func sortTripSearchResults(results []TripSearchResult, sortBy string) {
+	switch sortBy {
+	case TripSortPrice:
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].EstimatedPrice < results[j].EstimatedPrice
+		})
+	case TripSortDistance:
+		distance := func(result TripSearchResult) float64 {
+			total := 0.0
+			if result.OriginDistanceKm != nil {
+				total += *result.OriginDistanceKm
+			}
+			if result.DestinationDistanceKm != nil {
+				total += *result.DestinationDistanceKm
+			}
+			return total
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			return distance(results[i]) < distance(results[j])
+		})
+	}
+}
@@ -0,0 +1,427 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"triplink/backend/internal/geo"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Trip stop types
+const (
+	TripStopOrigin      = "ORIGIN"
+	TripStopPickup      = "PICKUP"
+	TripStopDelivery    = "DELIVERY"
+	TripStopDestination = "DESTINATION"
+)
+
+// Trip stop statuses
+const (
+	TripStopPending   = "PENDING"
+	TripStopArrived   = "ARRIVED"
+	TripStopCompleted = "COMPLETED"
+	TripStopSkipped   = "SKIPPED"
+)
+
+// stopDwellTime is the time planned at each stop when estimating the arrival
+// at the stops after it
+const stopDwellTime = 15 * time.Minute
+
+// GenerateTripStops builds the itinerary of a trip from its origin, the
+// pickup and delivery addresses of its loads and its destination. Stops that
+// were already visited are kept; the remaining stops are ordered by nearest
+// neighbour, with every pickup before the delivery of its load.
+func (ts *TrackingService) GenerateTripStops(tripID uint) ([]models.TripStop, error) {
+	var trip models.Trip
+	if err := ts.db.First(&trip, tripID).Error; err != nil {
+		return nil, errors.New("trip not found")
+	}
+
+	var loads []models.Load
+	if err := ts.db.Where("trip_id = ? AND status <> ?", tripID, "CANCELLED").
+		Order("id ASC").Find(&loads).Error; err != nil {
+		return nil, fmt.Errorf("failed to get trip loads: %w", err)
+	}
+
+	var existing []models.TripStop
+	if err := ts.db.Where("trip_id = ?", tripID).Order("sequence ASC").Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to get trip stops: %w", err)
+	}
+	existingByKey := make(map[string]*models.TripStop, len(existing))
+	for i := range existing {
+		existingByKey[tripStopKey(existing[i].StopType, existing[i].LoadID)] = &existing[i]
+	}
+
+	wanted := []models.TripStop{{
+		TripID:         tripID,
+		StopType:       TripStopOrigin,
+		Address:        trip.OriginAddress,
+		City:           trip.OriginCity,
+		Country:        trip.OriginCountry,
+		Latitude:       trip.OriginLat,
+		Longitude:      trip.OriginLng,
+		PlannedArrival: plannedTime(trip.DepartureDate),
+	}}
+	for i := range loads {
+		load := &loads[i]
+		wanted = append(wanted,
+			models.TripStop{
+				TripID:         tripID,
+				LoadID:         &load.ID,
+				StopType:       TripStopPickup,
+				Address:        load.PickupAddress,
+				City:           load.PickupCity,
+				Country:        load.PickupCountry,
+				Latitude:       load.PickupLat,
+				Longitude:      load.PickupLng,
+				PlannedArrival: plannedTime(load.RequestedPickupDate),
+			},
+			models.TripStop{
+				TripID:         tripID,
+				LoadID:         &load.ID,
+				StopType:       TripStopDelivery,
+				Address:        load.DeliveryAddress,
+				City:           load.DeliveryCity,
+				Country:        load.DeliveryCountry,
+				Latitude:       load.DeliveryLat,
+				Longitude:      load.DeliveryLng,
+				PlannedArrival: plannedTime(load.RequestedDeliveryDate),
+			})
+	}
+	wanted = append(wanted, models.TripStop{
+		TripID:         tripID,
+		StopType:       TripStopDestination,
+		Address:        trip.DestinationAddress,
+		City:           trip.DestinationCity,
+		Country:        trip.DestinationCountry,
+		Latitude:       trip.DestinationLat,
+		Longitude:      trip.DestinationLng,
+		PlannedArrival: plannedTime(trip.EstimatedArrival),
+	})
+
+	// Visited stops keep their place, pending ones are refreshed from the loads
+	var visited, pending []models.TripStop
+	wantedKeys := make(map[string]bool, len(wanted))
+	for _, stop := range wanted {
+		key := tripStopKey(stop.StopType, stop.LoadID)
+		wantedKeys[key] = true
+		if current, ok := existingByKey[key]; ok {
+			if current.Status != TripStopPending {
+				continue
+			}
+			stop.ID = current.ID
+			stop.CreatedAt = current.CreatedAt
+			stop.EstimatedArrival = current.EstimatedArrival
+		}
+		stop.Status = TripStopPending
+		pending = append(pending, stop)
+	}
+	var removed []uint
+	for _, stop := range existing {
+		if stop.Status != TripStopPending {
+			visited = append(visited, stop)
+		} else if !wantedKeys[tripStopKey(stop.StopType, stop.LoadID)] {
+			removed = append(removed, stop.ID)
+		}
+	}
+
+	start := Coordinate{Latitude: trip.OriginLat, Longitude: trip.OriginLng}
+	if len(visited) > 0 {
+		last := visited[len(visited)-1]
+		start = Coordinate{Latitude: last.Latitude, Longitude: last.Longitude}
+	}
+	if trip.CurrentLatitude != nil && trip.CurrentLongitude != nil {
+		start = Coordinate{Latitude: *trip.CurrentLatitude, Longitude: *trip.CurrentLongitude}
+	}
+
+	visitedTypes := make(map[string]bool, len(visited))
+	for _, stop := range visited {
+		visitedTypes[tripStopKey(stop.StopType, stop.LoadID)] = true
+	}
+	stops := append(visited, orderTripStops(start, pending, visitedTypes)...)
+
+	err := ts.db.Transaction(func(tx *gorm.DB) error {
+		if len(removed) > 0 {
+			if err := tx.Delete(&models.TripStop{}, removed).Error; err != nil {
+				return fmt.Errorf("failed to remove trip stops: %w", err)
+			}
+		}
+		for i := range stops {
+			stops[i].Sequence = i + 1
+			if err := tx.Save(&stops[i]).Error; err != nil {
+				return fmt.Errorf("failed to save trip stop: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stops, nil
+}
+
+// GetTripStops returns the itinerary of a trip in visiting order
+func (ts *TrackingService) GetTripStops(tripID uint) ([]models.TripStop, error) {
+	var stops []models.TripStop
+	if err := ts.db.Where("trip_id = ?", tripID).Order("sequence ASC").Find(&stops).Error; err != nil {
+		return nil, fmt.Errorf("failed to get trip stops: %w", err)
+	}
+	return stops, nil
+}
+
+// UpdateTripStopStatus records the arrival at, departure from or skipping of a stop
+func (ts *TrackingService) UpdateTripStopStatus(tripID, stopID uint, status string) (*models.TripStop, error) {
+	var stop models.TripStop
+	if err := ts.db.Where("id = ? AND trip_id = ?", stopID, tripID).First(&stop).Error; err != nil {
+		return nil, errors.New("trip stop not found")
+	}
+
+	now := time.Now()
+	switch {
+	case status == TripStopArrived && stop.Status == TripStopPending:
+		stop.ActualArrival = &now
+	case status == TripStopCompleted && (stop.Status == TripStopPending || stop.Status == TripStopArrived):
+		if stop.ActualArrival == nil {
+			stop.ActualArrival = &now
+		}
+		stop.ActualDeparture = &now
+		ts.recordStopDwell(&stop)
+	case status == TripStopSkipped && stop.Status == TripStopPending:
+	default:
+		return nil, fmt.Errorf("cannot change stop status from %s to %s", stop.Status, status)
+	}
+	stop.Status = status
+
+	if err := ts.db.Save(&stop).Error; err != nil {
+		return nil, fmt.Errorf("failed to update trip stop: %w", err)
+	}
+	ts.logStopEvent(&stop, now)
+
+	return &stop, nil
+}
+
+// updateStopProgress advances the itinerary from the current location: the
+// next stop is marked arrived when the vehicle is within the arrival radius
+// and completed when it leaves again. The remaining stops get ETAs at the
+// speed of the trip estimate plus a dwell time per stop, and the estimate is
+// moved to the arrival at the last stop.
+func (ts *TrackingService) updateStopProgress(tripID uint, current Coordinate, estimate *ETAEstimate) error {
+	stops, err := ts.GetTripStops(tripID)
+	if err != nil || len(stops) == 0 {
+		return err
+	}
+
+	now := estimate.CalculatedAt
+	speedKmh := estimate.speedKmh()
+
+	var remaining []*models.TripStop
+	for i := range stops {
+		if stops[i].Status == TripStopPending || stops[i].Status == TripStopArrived {
+			remaining = append(remaining, &stops[i])
+		}
+	}
+
+	// Arrival and departure detection as the vehicle enters and leaves the
+	// geofence of the next stop
+	radiusKm := ts.detention.GeofenceRadiusKm
+	for len(remaining) > 0 {
+		next := remaining[0]
+		distance := geo.Distance(current.Latitude, current.Longitude, next.Latitude, next.Longitude)
+		if next.Status == TripStopPending && distance <= radiusKm {
+			next.Status = TripStopArrived
+			next.ActualArrival = &now
+		} else if next.StopType == TripStopOrigin && next.Status == TripStopPending {
+			// Tracking started after the vehicle left the origin
+			next.Status = TripStopCompleted
+			next.ActualDeparture = &now
+			remaining = remaining[1:]
+		} else if next.Status == TripStopArrived && distance > radiusKm {
+			next.Status = TripStopCompleted
+			next.ActualDeparture = &now
+			ts.recordStopDwell(next)
+			remaining = remaining[1:]
+		} else {
+			break
+		}
+		if err := ts.db.Save(next).Error; err != nil {
+			return fmt.Errorf("failed to update trip stop: %w", err)
+		}
+		ts.logStopEvent(next, now)
+		if next.Status == TripStopArrived {
+			break
+		}
+	}
+
+	position := current
+	at := now
+	for _, stop := range remaining {
+		if stop.Status == TripStopArrived {
+			at = now
+			if stop.ActualArrival != nil && stop.ActualArrival.Add(stopDwellTime).After(now) {
+				at = stop.ActualArrival.Add(stopDwellTime)
+			}
+		} else {
+			distance := geo.Distance(position.Latitude, position.Longitude, stop.Latitude, stop.Longitude)
+			at = at.Add(time.Duration(distance / speedKmh * float64(time.Hour)))
+			eta := at
+			if err := ts.db.Model(stop).Update("estimated_arrival", eta).Error; err != nil {
+				return fmt.Errorf("failed to update trip stop ETA: %w", err)
+			}
+			stop.EstimatedArrival = &eta
+			at = at.Add(stopDwellTime)
+		}
+		position = Coordinate{Latitude: stop.Latitude, Longitude: stop.Longitude}
+	}
+
+	estimate.NextMilestone = ""
+	if len(remaining) > 0 {
+		estimate.NextMilestone = tripStopMilestone(remaining[0])
+		last := remaining[len(remaining)-1]
+		if last.EstimatedArrival != nil && last.Status == TripStopPending {
+			estimate.EstimatedArrival = *last.EstimatedArrival
+		}
+	}
+	return nil
+}
+
+// logStopEvent records a tracking event for a stop status change
+func (ts *TrackingService) logStopEvent(stop *models.TripStop, at time.Time) {
+	var eventType, action string
+	switch stop.Status {
+	case TripStopArrived:
+		eventType, action = "STOP_ARRIVAL", "Arrived at"
+	case TripStopCompleted:
+		eventType, action = "STOP_DEPARTURE", "Departed from"
+	case TripStopSkipped:
+		eventType, action = "STOP_SKIPPED", "Skipped"
+	default:
+		return
+	}
+
+	ts.db.Create(&models.TrackingEvent{
+		TripID:      stop.TripID,
+		LoadID:      stop.LoadID,
+		EventType:   eventType,
+		EventData:   fmt.Sprintf(`{"stop_id":%d,"stop_type":"%s","sequence":%d}`, stop.ID, stop.StopType, stop.Sequence),
+		Location:    tripStopLocation(stop),
+		Latitude:    &stop.Latitude,
+		Longitude:   &stop.Longitude,
+		Timestamp:   at,
+		Description: fmt.Sprintf("%s stop %d: %s", action, stop.Sequence, tripStopLocation(stop)),
+	})
+	ts.logDetentionEvent(stop, at)
+}
+
+// orderTripStops orders stops by nearest neighbour from start. The origin
+// comes first, the destination last and a delivery only after the pickup of
+// its load, unless the pickup is in visited.
+func orderTripStops(start Coordinate, stops []models.TripStop, visited map[string]bool) []models.TripStop {
+	var origin, destination []models.TripStop
+	var rest []models.TripStop
+	for _, stop := range stops {
+		switch stop.StopType {
+		case TripStopOrigin:
+			origin = append(origin, stop)
+		case TripStopDestination:
+			destination = append(destination, stop)
+		default:
+			rest = append(rest, stop)
+		}
+	}
+
+	ordered := append([]models.TripStop{}, origin...)
+	done := make(map[string]bool, len(visited)+len(stops))
+	for key := range visited {
+		done[key] = true
+	}
+	position := start
+	if len(origin) > 0 {
+		position = Coordinate{Latitude: origin[0].Latitude, Longitude: origin[0].Longitude}
+	}
+
+	for len(rest) > 0 {
+		best := -1
+		bestDistance := 0.0
+		for i, stop := range rest {
+			if stop.StopType == TripStopDelivery && !done[tripStopKey(TripStopPickup, stop.LoadID)] && hasPickup(rest, stop.LoadID) {
+				continue
+			}
+			distance := geo.Distance(position.Latitude, position.Longitude, stop.Latitude, stop.Longitude)
+			if best < 0 || distance < bestDistance {
+				best, bestDistance = i, distance
+			}
+		}
+
+		stop := rest[best]
+		ordered = append(ordered, stop)
+		done[tripStopKey(stop.StopType, stop.LoadID)] = true
+		position = Coordinate{Latitude: stop.Latitude, Longitude: stop.Longitude}
+		rest = append(rest[:best], rest[best+1:]...)
+	}
+
+	return append(ordered, destination...)
+}
+
+// hasPickup reports whether stops contain the pickup of a load
+func hasPickup(stops []models.TripStop, loadID *uint) bool {
+	for _, stop := range stops {
+		if stop.StopType == TripStopPickup && stop.LoadID != nil && loadID != nil && *stop.LoadID == *loadID {
+			return true
+		}
+	}
+	return false
+}
+
+// tripStopKey identifies a stop by its type and load across regenerations
+func tripStopKey(stopType string, loadID *uint) string {
+	if loadID == nil {
+		return stopType
+	}
+	return fmt.Sprintf("%s:%d", stopType, *loadID)
+}
+
+// plannedTime returns nil for unset times
+func plannedTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// tripStopLocation returns a short description of where a stop is
+func tripStopLocation(stop *models.TripStop) string {
+	parts := []string{}
+	for _, part := range []string{stop.Address, stop.City} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("%.5f, %.5f", stop.Latitude, stop.Longitude)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// tripStopMilestone describes a stop as the next milestone of a trip
+func tripStopMilestone(stop *models.TripStop) string {
+	var action string
+	switch stop.StopType {
+	case TripStopOrigin:
+		action = "Departure from"
+	case TripStopPickup:
+		action = fmt.Sprintf("Pickup of load %d at", *stop.LoadID)
+	case TripStopDelivery:
+		action = fmt.Sprintf("Delivery of load %d at", *stop.LoadID)
+	default:
+		action = "Arrival at"
+	}
+	if stop.Status == TripStopArrived {
+		action = "At"
+	}
+	return action + " " + tripStopLocation(stop)
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// maxGenerateAheadDays caps how far ahead trips are created from a template
+const maxGenerateAheadDays = 90
+
+// TripTemplateRequest configures the lane, vehicle, capacity, pricing and
+// schedule of a trip template
+type TripTemplateRequest struct {
+	Name                string    `json:"name"`
+	VehicleID           uint      `json:"vehicle_id"`
+	OriginAddress       string    `json:"origin_address"`
+	OriginCity          string    `json:"origin_city"`
+	OriginState         string    `json:"origin_state"`
+	OriginCountry       string    `json:"origin_country"`
+	OriginLat           float64   `json:"origin_lat"`
+	OriginLng           float64   `json:"origin_lng"`
+	DestinationAddress  string    `json:"destination_address"`
+	DestinationCity     string    `json:"destination_city"`
+	DestinationState    string    `json:"destination_state"`
+	DestinationCountry  string    `json:"destination_country"`
+	DestinationLat      float64   `json:"destination_lat"`
+	DestinationLng      float64   `json:"destination_lng"`
+	TotalCapacityWeight float64   `json:"total_capacity_weight"`
+	TotalCapacityVolume float64   `json:"total_capacity_volume"`
+	BasePrice           float64   `json:"base_price"`
+	PricePerKg          float64   `json:"price_per_kg"`
+	PricePerCubicMeter  float64   `json:"price_per_cubic_meter"`
+	Notes               string    `json:"notes"`
+	IsPublic            *bool     `json:"is_public"`       // defaults to true
+	RecurrenceRule      string    `json:"recurrence_rule"` // e.g. FREQ=WEEKLY;BYDAY=MO
+	StartDate           time.Time `json:"start_date"`
+	DepartureTime       string    `json:"departure_time"`      // HH:MM
+	Timezone            string    `json:"timezone"`            // defaults to UTC
+	DurationMinutes     int       `json:"duration_minutes"`    // time from departure to arrival
+	GenerateAheadDays   int       `json:"generate_ahead_days"` // defaults to 14
+	Active              *bool     `json:"active"`
+}
+
+// TripTemplateService manages trip templates and creates the trips of their
+// recurrence rules
+type TripTemplateService struct {
+	db *gorm.DB
+}
+
+// NewTripTemplateService creates a new TripTemplateService
+func NewTripTemplateService(db *gorm.DB) *TripTemplateService {
+	return &TripTemplateService{db: db}
+}
+
+// CreateTemplate creates a trip template for a carrier and the trips due
+// within its generation window
+func (s *TripTemplateService) CreateTemplate(userID uint, req TripTemplateRequest) (*models.TripTemplate, error) {
+	template := &models.TripTemplate{UserID: userID, Active: true, IsPublic: true}
+	if err := s.applyTripTemplateRequest(template, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(template).Error; err != nil {
+		return nil, fmt.Errorf("failed to create trip template: %w", err)
+	}
+
+	if _, err := s.GenerateTrips(template, time.Now()); err != nil {
+		log.Printf("Failed to create trips of template %d: %v", template.ID, err)
+	}
+	return template, nil
+}
+
+// GetUserTemplates returns a carrier's trip templates
+func (s *TripTemplateService) GetUserTemplates(userID uint) ([]models.TripTemplate, error) {
+	var templates []models.TripTemplate
+	if err := s.db.Where("user_id = ?", userID).Order("id ASC").Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to get trip templates: %w", err)
+	}
+	return templates, nil
+}
+
+// GetTemplate returns one of a carrier's trip templates
+func (s *TripTemplateService) GetTemplate(userID, templateID uint) (*models.TripTemplate, error) {
+	var template models.TripTemplate
+	if err := s.db.Where("id = ? AND user_id = ?", templateID, userID).First(&template).Error; err != nil {
+		return nil, errors.New("trip template not found")
+	}
+	return &template, nil
+}
+
+// UpdateTemplate replaces the settings of a template. Trips already created
+// keep their settings; later trips follow the new ones.
+func (s *TripTemplateService) UpdateTemplate(userID, templateID uint, req TripTemplateRequest) (*models.TripTemplate, error) {
+	template, err := s.GetTemplate(userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyTripTemplateRequest(template, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(template).Error; err != nil {
+		return nil, fmt.Errorf("failed to update trip template: %w", err)
+	}
+	return template, nil
+}
+
+// DeleteTemplate deletes a template. Trips created from it are kept.
+func (s *TripTemplateService) DeleteTemplate(userID, templateID uint) error {
+	template, err := s.GetTemplate(userID, templateID)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Delete(template).Error; err != nil {
+		return fmt.Errorf("failed to delete trip template: %w", err)
+	}
+	return nil
+}
+
+// GetTemplateTrips returns the trips created from a template, soonest first
+func (s *TripTemplateService) GetTemplateTrips(template *models.TripTemplate) ([]models.Trip, error) {
+	var trips []models.Trip
+	if err := s.db.Where("template_id = ?", template.ID).Order("departure_date ASC").Find(&trips).Error; err != nil {
+		return nil, fmt.Errorf("failed to get template trips: %w", err)
+	}
+	return trips, nil
+}
+
+// GenerateTrips creates the trips of an active template departing after now
+// and within its generation window. Only departures after the last trip
+// created are considered, and departures that already have a trip are
+// skipped, so trips that were edited or deleted aren't recreated.
+func (s *TripTemplateService) GenerateTrips(template *models.TripTemplate, now time.Time) ([]models.Trip, error) {
+	if !template.Active {
+		return nil, nil
+	}
+
+	rule, err := ParseRecurrenceRule(template.RecurrenceRule)
+	if err != nil {
+		return nil, err
+	}
+	start, err := templateStart(template)
+	if err != nil {
+		return nil, err
+	}
+	from := now
+	if template.LastGeneratedAt != nil && !template.LastGeneratedAt.Before(from) {
+		from = template.LastGeneratedAt.Add(time.Second)
+	}
+	departures := rule.Occurrences(start, from, now.AddDate(0, 0, template.GenerateAheadDays))
+	if len(departures) == 0 {
+		return nil, nil
+	}
+
+	var existing []time.Time
+	if err := s.db.Model(&models.Trip{}).
+		Where("template_id = ? AND departure_date >= ?", template.ID, departures[0].UTC()).
+		Pluck("departure_date", &existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to get template trips: %w", err)
+	}
+	created := make(map[int64]bool, len(existing))
+	for _, departure := range existing {
+		created[departure.Unix()] = true
+	}
+
+	var trips []models.Trip
+	for _, departure := range departures {
+		if created[departure.Unix()] {
+			continue
+		}
+		trips = append(trips, tripFromTemplate(template, departure))
+	}
+	if len(trips) == 0 {
+		return nil, nil
+	}
+	// Trips belong to the organization the template's carrier dispatches for
+	organizationID, err := NewOrganizationService(s.db).ResolveOrganization(template.UserID, OrganizationCarrier, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range trips {
+		trips[i].OrganizationID = organizationID
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&trips).Error; err != nil {
+			return err
+		}
+		last := trips[len(trips)-1].DepartureDate
+		template.LastGeneratedAt = &last
+		return tx.Model(template).Update("last_generated_at", last).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create template trips: %w", err)
+	}
+
+	if tolls := GetTripTollService(); tolls != nil {
+		for i := range trips {
+			if calculated, err := tolls.CalculateTrip(trips[i].ID); err != nil {
+				log.Printf("Failed to calculate tolls of trip %d: %v", trips[i].ID, err)
+			} else {
+				trips[i] = *calculated
+			}
+		}
+	}
+	return trips, nil
+}
+
+// GenerateDueTrips creates the upcoming trips of every active template
+func (s *TripTemplateService) GenerateDueTrips() error {
+	var templates []models.TripTemplate
+	if err := s.db.Where("active = ?", true).Find(&templates).Error; err != nil {
+		return fmt.Errorf("failed to get trip templates: %w", err)
+	}
+
+	now := time.Now()
+	created := 0
+	for i := range templates {
+		trips, err := s.GenerateTrips(&templates[i], now)
+		if err != nil {
+			log.Printf("Failed to create trips of template %d: %v", templates[i].ID, err)
+			continue
+		}
+		created += len(trips)
+	}
+
+	if created > 0 {
+		log.Printf("Created %d trips from %d trip templates", created, len(templates))
+	}
+	return nil
+}
+
+// tripFromTemplate returns a planned trip of a template departing at departure
+func tripFromTemplate(template *models.TripTemplate, departure time.Time) models.Trip {
+	templateID := template.ID
+	arrival := departure.Add(time.Duration(template.DurationMinutes) * time.Minute).UTC()
+	trip := models.Trip{
+		UserID:              template.UserID,
+		VehicleID:           template.VehicleID,
+		OriginAddress:       template.OriginAddress,
+		OriginCity:          template.OriginCity,
+		OriginState:         template.OriginState,
+		OriginCountry:       template.OriginCountry,
+		OriginLat:           template.OriginLat,
+		OriginLng:           template.OriginLng,
+		DestinationAddress:  template.DestinationAddress,
+		DestinationCity:     template.DestinationCity,
+		DestinationState:    template.DestinationState,
+		DestinationCountry:  template.DestinationCountry,
+		DestinationLat:      template.DestinationLat,
+		DestinationLng:      template.DestinationLng,
+		DepartureDate:       departure.UTC(),
+		EstimatedArrival:    arrival,
+		ScheduledArrival:    &arrival,
+		TotalCapacityWeight: template.TotalCapacityWeight,
+		TotalCapacityVolume: template.TotalCapacityVolume,
+		BasePrice:           template.BasePrice,
+		PricePerKg:          template.PricePerKg,
+		PricePerCubicMeter:  template.PricePerCubicMeter,
+		Status:              "PLANNED",
+		Notes:               template.Notes,
+		IsPublic:            template.IsPublic,
+		TrackingEnabled:     true,
+		TemplateID:          &templateID,
+	}
+	LocalizeTrip(&trip)
+	return trip
+}
+
+// templateStart returns the first departure of a template: its start date at
+// the departure time in its timezone
+func templateStart(template *models.TripTemplate) (time.Time, error) {
+	loc, err := time.LoadLocation(template.Timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timezone: %s", template.Timezone)
+	}
+	minutes, err := parseClockTime(template.DepartureTime)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid departure time: %w", err)
+	}
+	date := template.StartDate
+	return time.Date(date.Year(), date.Month(), date.Day(), minutes/60, minutes%60, 0, 0, loc), nil
+}
+
+// applyTripTemplateRequest validates a request and copies it to the template
+func (s *TripTemplateService) applyTripTemplateRequest(template *models.TripTemplate, req TripTemplateRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return errors.New("name is required")
+	}
+	if req.OriginAddress == "" && req.OriginCity == "" {
+		return errors.New("origin address or city is required")
+	}
+	if req.DestinationAddress == "" && req.DestinationCity == "" {
+		return errors.New("destination address or city is required")
+	}
+	if req.TotalCapacityWeight < 0 || req.TotalCapacityVolume < 0 {
+		return errors.New("capacity cannot be negative")
+	}
+	if req.BasePrice < 0 || req.PricePerKg < 0 || req.PricePerCubicMeter < 0 {
+		return errors.New("prices cannot be negative")
+	}
+	if req.DurationMinutes <= 0 {
+		return errors.New("duration must be positive")
+	}
+	if req.StartDate.IsZero() {
+		return errors.New("start date is required")
+	}
+	if _, err := ParseRecurrenceRule(req.RecurrenceRule); err != nil {
+		return fmt.Errorf("invalid recurrence rule: %w", err)
+	}
+	if _, err := parseClockTime(req.DepartureTime); err != nil {
+		return fmt.Errorf("invalid departure time: %w", err)
+	}
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %s", req.Timezone)
+	}
+	aheadDays := req.GenerateAheadDays
+	if aheadDays == 0 {
+		aheadDays = 14
+	}
+	if aheadDays < 1 || aheadDays > maxGenerateAheadDays {
+		return fmt.Errorf("generate ahead days must be between 1 and %d", maxGenerateAheadDays)
+	}
+
+	if req.VehicleID != 0 {
+		var count int64
+		s.db.Model(&models.Vehicle{}).Where("id = ? AND user_id = ?", req.VehicleID, template.UserID).Count(&count)
+		if count == 0 {
+			return errors.New("vehicle not found")
+		}
+	}
+
+	template.Name = strings.TrimSpace(req.Name)
+	template.VehicleID = req.VehicleID
+	template.OriginAddress = req.OriginAddress
+	template.OriginCity = req.OriginCity
+	template.OriginState = req.OriginState
+	template.OriginCountry = req.OriginCountry
+	template.OriginLat = req.OriginLat
+	template.OriginLng = req.OriginLng
+	template.DestinationAddress = req.DestinationAddress
+	template.DestinationCity = req.DestinationCity
+	template.DestinationState = req.DestinationState
+	template.DestinationCountry = req.DestinationCountry
+	template.DestinationLat = req.DestinationLat
+	template.DestinationLng = req.DestinationLng
+	template.TotalCapacityWeight = req.TotalCapacityWeight
+	template.TotalCapacityVolume = req.TotalCapacityVolume
+	template.BasePrice = req.BasePrice
+	template.PricePerKg = req.PricePerKg
+	template.PricePerCubicMeter = req.PricePerCubicMeter
+	template.Notes = req.Notes
+	if req.IsPublic != nil {
+		template.IsPublic = *req.IsPublic
+	}
+	template.RecurrenceRule = strings.TrimPrefix(strings.TrimSpace(req.RecurrenceRule), "RRULE:")
+	template.StartDate = req.StartDate
+	template.DepartureTime = req.DepartureTime
+	template.Timezone = timezone
+	template.DurationMinutes = req.DurationMinutes
+	template.GenerateAheadDays = aheadDays
+	if req.Active != nil {
+		template.Active = *req.Active
+	}
+	return nil
+}
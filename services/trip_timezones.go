@@ -0,0 +1,78 @@
+package services
+
+import (
+	"time"
+	"triplink/backend/internal/timezone"
+	"triplink/backend/models"
+)
+
+// tripTimeLayout is how trip times are written in notifications, with the
+// abbreviation of the timezone they are in
+const tripTimeLayout = "Jan 2, 2006 at 3:04 PM MST"
+
+// LocalizeTrip sets the timezones of a trip's origin and destination from
+// their coordinates, and stores its scheduled times in UTC. Times given with
+// an offset keep the instant they name.
+func LocalizeTrip(trip *models.Trip) {
+	trip.OriginTimezone = timezone.Lookup(trip.OriginLat, trip.OriginLng)
+	trip.DestinationTimezone = timezone.Lookup(trip.DestinationLat, trip.DestinationLng)
+
+	trip.DepartureDate = trip.DepartureDate.UTC()
+	trip.EstimatedArrival = trip.EstimatedArrival.UTC()
+	if trip.ScheduledArrival != nil {
+		scheduled := trip.ScheduledArrival.UTC()
+		trip.ScheduledArrival = &scheduled
+	}
+}
+
+// TripLocalTimes are a trip's times at the local time of the places they
+// happen: departures at the origin and arrivals at the destination
+type TripLocalTimes struct {
+	OriginTimezone      string     `json:"origin_timezone"`
+	DestinationTimezone string     `json:"destination_timezone"`
+	Departure           time.Time  `json:"departure"`
+	EstimatedArrival    time.Time  `json:"estimated_arrival"`
+	ScheduledArrival    *time.Time `json:"scheduled_arrival,omitempty"`
+	ActualDeparture     *time.Time `json:"actual_departure,omitempty"`
+	ActualArrival       *time.Time `json:"actual_arrival,omitempty"`
+}
+
+// LocalTimes returns a trip's times in the timezones of its origin and
+// destination. eta, when known, replaces the trip's estimated arrival.
+func LocalTimes(trip *models.Trip, eta *time.Time) TripLocalTimes {
+	origin := timezone.Location(trip.OriginTimezone)
+	destination := timezone.Location(trip.DestinationTimezone)
+	in := func(t *time.Time, loc *time.Location) *time.Time {
+		if t == nil {
+			return nil
+		}
+		local := t.In(loc)
+		return &local
+	}
+
+	arrival := trip.EstimatedArrival
+	if eta != nil {
+		arrival = *eta
+	}
+	return TripLocalTimes{
+		OriginTimezone:      origin.String(),
+		DestinationTimezone: destination.String(),
+		Departure:           trip.DepartureDate.In(origin),
+		EstimatedArrival:    arrival.In(destination),
+		ScheduledArrival:    in(trip.ScheduledArrival, destination),
+		ActualDeparture:     in(trip.ActualDeparture, origin),
+		ActualArrival:       in(trip.ActualArrival, destination),
+	}
+}
+
+// FormatArrival formats an arrival time at a trip's destination for
+// notifications
+func FormatArrival(trip *models.Trip, at time.Time) string {
+	return timezone.Format(at, trip.DestinationTimezone, tripTimeLayout)
+}
+
+// FormatDeparture formats a departure time at a trip's origin for
+// notifications
+func FormatDeparture(trip *models.Trip, at time.Time) string {
+	return timezone.Format(at, trip.OriginTimezone, tripTimeLayout)
+}
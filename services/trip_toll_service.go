@@ -0,0 +1,159 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// TripTollService calculates the expected tolls of trips' planned routes and
+// keeps them up to date as routes change
+type TripTollService struct {
+	db    *gorm.DB
+	tolls TollAPIService
+	cfg   *config.TollConfig
+	now   func() time.Time
+}
+
+// NewTripTollService creates a new TripTollService
+func NewTripTollService(db *gorm.DB, tolls TollAPIService, cfg *config.TollConfig) *TripTollService {
+	return &TripTollService{db: db, tolls: tolls, cfg: cfg, now: time.Now}
+}
+
+var (
+	tripTollServiceInstance *TripTollService
+	tripTollServiceMu       sync.RWMutex
+)
+
+// GetTripTollService returns the shared trip toll service, or nil when none
+// was set up
+func GetTripTollService() *TripTollService {
+	tripTollServiceMu.RLock()
+	defer tripTollServiceMu.RUnlock()
+	return tripTollServiceInstance
+}
+
+// SetTripTollService replaces the shared trip toll service, which keeps the
+// tolls of new trips and changed routes up to date
+func SetTripTollService(service *TripTollService) {
+	tripTollServiceMu.Lock()
+	defer tripTollServiceMu.Unlock()
+	tripTollServiceInstance = service
+}
+
+// CalculateTrip calculates the tolls of a trip's planned route, or between
+// its origin and destination before it has one, and stores them on the trip
+func (s *TripTollService) CalculateTrip(tripID uint) (*models.Trip, error) {
+	var trip models.Trip
+	if err := s.db.First(&trip, tripID).Error; err != nil {
+		return nil, errors.New("trip not found")
+	}
+
+	cost, currency := 0.0, s.cfg.Currency
+	if trip.PlannedRoutePolyline != "" {
+		breakdown, err := s.tolls.CalculateTollCosts(trip.PlannedRoutePolyline)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate toll costs: %w", err)
+		}
+		cost = breakdown.TotalCost
+	} else {
+		origin := fmt.Sprintf("%f,%f", trip.OriginLat, trip.OriginLng)
+		destination := fmt.Sprintf("%f,%f", trip.DestinationLat, trip.DestinationLng)
+		info, err := s.tolls.GetTollRates(origin, destination)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get toll rates: %w", err)
+		}
+		cost = info.TotalCost
+		if info.Currency != "" {
+			currency = strings.ToUpper(info.Currency)
+		}
+	}
+
+	now := s.now()
+	trip.TollCost = roundHundredths(cost)
+	trip.TollCurrency = currency
+	trip.TollRoutePolyline = trip.PlannedRoutePolyline
+	trip.TollsCalculatedAt = &now
+	if err := s.db.Model(&trip).Updates(map[string]interface{}{
+		"toll_cost":           trip.TollCost,
+		"toll_currency":       trip.TollCurrency,
+		"toll_route_polyline": trip.TollRoutePolyline,
+		"tolls_calculated_at": trip.TollsCalculatedAt,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to save trip tolls: %w", err)
+	}
+	return &trip, nil
+}
+
+// RefreshTrip recalculates a trip's tolls when they were never calculated or
+// its planned route changed significantly since, reporting whether it did
+func (s *TripTollService) RefreshTrip(tripID uint) (bool, error) {
+	var trip models.Trip
+	if err := s.db.Select("id", "planned_route_polyline", "toll_route_polyline", "tolls_calculated_at").
+		First(&trip, tripID).Error; err != nil {
+		return false, errors.New("trip not found")
+	}
+	if trip.TollsCalculatedAt != nil && !s.routeChanged(trip.TollRoutePolyline, trip.PlannedRoutePolyline) {
+		return false, nil
+	}
+	if _, err := s.CalculateTrip(tripID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// routeChanged reports whether a route differs enough from the one tolls
+// were calculated for to change them: its length changed by more than the
+// configured percent, or either route strays too far from the other
+func (s *TripTollService) routeChanged(previous, current string) bool {
+	if previous == current {
+		return false
+	}
+	previousRoute, err := DecodePolyline(previous)
+	if err != nil || len(previousRoute) == 0 {
+		return true
+	}
+	currentRoute, err := DecodePolyline(current)
+	if err != nil || len(currentRoute) == 0 {
+		return true
+	}
+
+	previousKm := routeDistances(previousRoute)[len(previousRoute)-1]
+	currentKm := routeDistances(currentRoute)[len(currentRoute)-1]
+	if previousKm == 0 || math.Abs(currentKm-previousKm)/previousKm*100 > s.cfg.RecomputeDistancePercent {
+		return true
+	}
+
+	deviationMeters := s.cfg.RecomputeDeviationKm * 1000
+	for _, point := range currentRoute {
+		if distance, _ := ProjectOntoPath(previousRoute, point); distance > deviationMeters {
+			return true
+		}
+	}
+	for _, point := range previousRoute {
+		if distance, _ := ProjectOntoPath(currentRoute, point); distance > deviationMeters {
+			return true
+		}
+	}
+	return false
+}
+
+// TollShare returns the part of a trip's tolls charged for a shipment of a
+// weight: its share of the trip's weight capacity, or all of them when the
+// trip's capacity isn't known
+func TollShare(trip *models.Trip, weight float64) float64 {
+	if trip.TollCost <= 0 {
+		return 0
+	}
+	if trip.TotalCapacityWeight <= 0 || weight >= trip.TotalCapacityWeight {
+		return trip.TollCost
+	}
+	return roundHundredths(trip.TollCost * math.Max(0, weight) / trip.TotalCapacityWeight)
+}
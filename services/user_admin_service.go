@@ -0,0 +1,286 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Account verification statuses
+const (
+	VerificationPending  = "PENDING"
+	VerificationApproved = "APPROVED"
+	VerificationRejected = "REJECTED"
+)
+
+// VerificationCheck is one requirement a carrier must meet to be verified
+type VerificationCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// UserAdminFilter narrows the accounts listed for review
+type UserAdminFilter struct {
+	Role               string
+	VerificationStatus string
+	Suspended          *bool
+	Search             string // matches email, name and company name
+}
+
+// UserAdminService lets admins review registrations, verify carriers and
+// suspend accounts
+type UserAdminService struct {
+	db *gorm.DB
+}
+
+// NewUserAdminService creates a new user admin service instance
+func NewUserAdminService(db *gorm.DB) *UserAdminService {
+	return &UserAdminService{db: db}
+}
+
+// UsersQuery returns a query of the accounts matching a filter
+func (uas *UserAdminService) UsersQuery(filter UserAdminFilter) *gorm.DB {
+	query := uas.db.Model(&models.User{})
+	if filter.Role != "" {
+		query = query.Where("role = ?", strings.ToUpper(filter.Role))
+	}
+	if filter.VerificationStatus != "" {
+		query = query.Where("verification_status = ?", strings.ToUpper(filter.VerificationStatus))
+	}
+	if filter.Suspended != nil {
+		if *filter.Suspended {
+			query = query.Where("suspended_at IS NOT NULL")
+		} else {
+			query = query.Where("suspended_at IS NULL")
+		}
+	}
+	if filter.Search != "" {
+		pattern := "%" + strings.ToLower(filter.Search) + "%"
+		query = query.Where("LOWER(email) LIKE ? OR LOWER(first_name) LIKE ? OR LOWER(last_name) LIKE ? OR LOWER(company_name) LIKE ?",
+			pattern, pattern, pattern, pattern)
+	}
+	return query
+}
+
+// GetUser returns an account with its vehicles
+func (uas *UserAdminService) GetUser(userID uint) (*models.User, error) {
+	var user models.User
+	if err := uas.db.Preload("Vehicles").First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	return &user, nil
+}
+
+// VerificationChecks checks a carrier's license and insurance documents.
+// Other roles have no document requirements.
+func (uas *UserAdminService) VerificationChecks(user *models.User) []VerificationCheck {
+	if user.Role != "CARRIER" {
+		return []VerificationCheck{}
+	}
+
+	now := time.Now()
+	checks := []VerificationCheck{
+		{
+			Name:   "driver_license",
+			Passed: user.LicenseNumber != "" && user.DriverLicense != "",
+			Detail: "License number and license document are required",
+		},
+		{
+			Name:   "license_expiry",
+			Passed: user.LicenseExpiry != nil && user.LicenseExpiry.After(now),
+			Detail: "Driver license must not be expired",
+		},
+		{
+			Name:   "business_license",
+			Passed: user.BusinessLicense != "",
+			Detail: "Business license document is required",
+		},
+	}
+
+	insured := false
+	for _, vehicle := range user.Vehicles {
+		if vehicle.IsActive && vehicle.InsuranceExpiry != nil && vehicle.InsuranceExpiry.After(now) {
+			insured = true
+			break
+		}
+	}
+	checks = append(checks, VerificationCheck{
+		Name:   "vehicle_insurance",
+		Passed: insured,
+		Detail: "At least one active vehicle with valid insurance is required",
+	})
+
+	for i := range checks {
+		if checks[i].Passed {
+			checks[i].Detail = ""
+		}
+	}
+	return checks
+}
+
+// failedChecks returns the names of the checks that didn't pass
+func failedChecks(checks []VerificationCheck) []string {
+	var failed []string
+	for _, check := range checks {
+		if !check.Passed {
+			failed = append(failed, check.Name)
+		}
+	}
+	return failed
+}
+
+// ApproveVerification verifies an account. Carriers must pass every
+// verification check first.
+func (uas *UserAdminService) ApproveVerification(userID, adminID uint, note string) (*models.User, error) {
+	user, err := uas.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if failed := failedChecks(uas.VerificationChecks(user)); len(failed) > 0 {
+		return nil, fmt.Errorf("verification checks failed: %s", strings.Join(failed, ", "))
+	}
+
+	if err := uas.setVerification(user, adminID, VerificationApproved, note); err != nil {
+		return nil, err
+	}
+
+	uas.notify(user.ID, "Account verified",
+		"Your account has been verified. You now have full access to TripLink.", "ACCOUNT_VERIFIED")
+	return user, nil
+}
+
+// RejectVerification rejects an account's verification, with the reason
+// sent to the user
+func (uas *UserAdminService) RejectVerification(userID, adminID uint, reason string) (*models.User, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("a rejection reason is required")
+	}
+
+	user, err := uas.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := uas.setVerification(user, adminID, VerificationRejected, reason); err != nil {
+		return nil, err
+	}
+
+	uas.notify(user.ID, "Account verification rejected",
+		fmt.Sprintf("Your account verification was rejected: %s. Please update your documents and contact support.", reason),
+		"ACCOUNT_VERIFICATION_REJECTED")
+	return user, nil
+}
+
+// setVerification records an admin's verification decision
+func (uas *UserAdminService) setVerification(user *models.User, adminID uint, status, note string) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"verification_status": status,
+		"verification_note":   note,
+		"is_verified":         status == VerificationApproved,
+		"verified_at":         &now,
+		"verified_by":         adminID,
+	}
+	if err := uas.db.Model(user).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update verification: %w", err)
+	}
+
+	user.VerificationStatus = status
+	user.VerificationNote = note
+	user.IsVerified = status == VerificationApproved
+	user.VerifiedAt = &now
+	user.VerifiedBy = &adminID
+	return nil
+}
+
+// SuspendUser suspends an account, blocking sign in and API access until it
+// is reinstated. Admins can't suspend themselves.
+func (uas *UserAdminService) SuspendUser(userID, adminID uint, reason string) (*models.User, error) {
+	if userID == adminID {
+		return nil, errors.New("you can't suspend your own account")
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("a suspension reason is required")
+	}
+
+	user, err := uas.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.SuspendedAt != nil {
+		return nil, errors.New("user is already suspended")
+	}
+
+	now := time.Now()
+	if err := uas.db.Model(user).Updates(map[string]interface{}{
+		"suspended_at":      &now,
+		"suspension_reason": reason,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to suspend user: %w", err)
+	}
+	user.SuspendedAt = &now
+	user.SuspensionReason = reason
+
+	uas.notify(user.ID, "Account suspended",
+		fmt.Sprintf("Your account has been suspended: %s. Please contact support.", reason), "ACCOUNT_SUSPENDED")
+	return user, nil
+}
+
+// ReinstateUser lifts an account's suspension
+func (uas *UserAdminService) ReinstateUser(userID uint) (*models.User, error) {
+	user, err := uas.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.SuspendedAt == nil {
+		return nil, errors.New("user is not suspended")
+	}
+
+	if err := uas.db.Model(user).Updates(map[string]interface{}{
+		"suspended_at":      nil,
+		"suspension_reason": "",
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to reinstate user: %w", err)
+	}
+	user.SuspendedAt = nil
+	user.SuspensionReason = ""
+
+	uas.notify(user.ID, "Account reinstated",
+		"Your account has been reinstated. You can sign in to TripLink again.", "ACCOUNT_REINSTATED")
+	return user, nil
+}
+
+// IsSuspended reports whether an account is suspended
+func (uas *UserAdminService) IsSuspended(userID uint) bool {
+	var count int64
+	uas.db.Model(&models.User{}).Where("id = ? AND suspended_at IS NOT NULL", userID).Count(&count)
+	return count > 0
+}
+
+// Role returns the stored role of a user
+func (uas *UserAdminService) Role(userID uint) (string, error) {
+	var user models.User
+	if err := uas.db.Select("role").First(&user, userID).Error; err != nil {
+		return "", err
+	}
+	return user.Role, nil
+}
+
+// notify sends an account notification to a user
+func (uas *UserAdminService) notify(userID uint, title, message, notificationType string) {
+	notification := models.Notification{
+		UserID:    userID,
+		Title:     title,
+		Message:   message,
+		Type:      notificationType,
+		RelatedID: userID,
+	}
+	if _, _, err := NewNotificationService(uas.db).CreateNotificationWithDelivery(&notification); err != nil {
+		log.Printf("Failed to send %s notification to user %d: %v", notificationType, userID, err)
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"triplink/backend/internal/i18n"
+	"triplink/backend/internal/units"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Errors returned when updating preferences
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrInvalidUnitSystem = errors.New("unit system must be metric or imperial")
+	ErrInvalidLanguage   = errors.New("language must be en, es or fr")
+)
+
+// userPreferenceColumns are the columns preferences are read from
+const userPreferenceColumns = "id, unit_system, language"
+
+// UserPreferences are the settings a user picks for how the API presents
+// data to them
+type UserPreferences struct {
+	UnitSystem units.System  `json:"unit_system"`
+	Language   i18n.Language `json:"language"`
+}
+
+// UserPreferencesUpdate changes the preferences that are set
+type UserPreferencesUpdate struct {
+	UnitSystem *string
+	Language   *string
+}
+
+// UserPreferencesService reads and updates users' preferences
+type UserPreferencesService struct {
+	db *gorm.DB
+}
+
+// NewUserPreferencesService creates a new user preferences service
+func NewUserPreferencesService(db *gorm.DB) *UserPreferencesService {
+	return &UserPreferencesService{db: db}
+}
+
+// GetPreferences returns a user's preferences
+func (s *UserPreferencesService) GetPreferences(userID uint) (*UserPreferences, error) {
+	var user models.User
+	if err := s.db.Select(userPreferenceColumns).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return userPreferences(&user), nil
+}
+
+// UpdatePreferences changes a user's preferences and returns them
+func (s *UserPreferencesService) UpdatePreferences(userID uint, update UserPreferencesUpdate) (*UserPreferences, error) {
+	var user models.User
+	if err := s.db.Select(userPreferenceColumns).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	updates := map[string]interface{}{}
+	if update.UnitSystem != nil {
+		system, ok := units.Parse(*update.UnitSystem)
+		if !ok {
+			return nil, ErrInvalidUnitSystem
+		}
+		updates["unit_system"] = string(system)
+		user.UnitSystem = string(system)
+	}
+	if update.Language != nil {
+		language, ok := i18n.Parse(*update.Language)
+		if !ok {
+			return nil, ErrInvalidLanguage
+		}
+		updates["language"] = string(language)
+		user.Language = string(language)
+	}
+	if len(updates) > 0 {
+		if err := s.db.Model(&user).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to update preferences: %w", err)
+		}
+	}
+	return userPreferences(&user), nil
+}
+
+func userPreferences(user *models.User) *UserPreferences {
+	system, ok := units.Parse(user.UnitSystem)
+	if !ok {
+		system = units.Metric
+	}
+	language, ok := i18n.Parse(user.Language)
+	if !ok {
+		language = i18n.Default
+	}
+	return &UserPreferences{UnitSystem: system, Language: language}
+}
+
+// UserUnitSystem returns the system of measurement a user wants, metric if
+// the user isn't found
+func UserUnitSystem(db *gorm.DB, userID uint) units.System {
+	return UserUnitSystems(db, []uint{userID})[userID]
+}
+
+// UserUnitSystems returns the systems of measurement of users, metric for
+// those not found
+func UserUnitSystems(db *gorm.DB, userIDs []uint) map[uint]units.System {
+	systems := make(map[uint]units.System, len(userIDs))
+	for _, userID := range userIDs {
+		systems[userID] = units.Metric
+	}
+	var users []models.User
+	db.Select(userPreferenceColumns).Where("id IN ?", userIDs).Find(&users)
+	for i := range users {
+		systems[users[i].ID] = userPreferences(&users[i]).UnitSystem
+	}
+	return systems
+}
+
+// UserLanguage returns the language a user wants notifications in, the
+// default language if the user isn't found
+func UserLanguage(db *gorm.DB, userID uint) i18n.Language {
+	var user models.User
+	if err := db.Select(userPreferenceColumns).First(&user, userID).Error; err != nil {
+		return i18n.Default
+	}
+	return userPreferences(&user).Language
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"fmt"
+	"time"
+	"triplink/backend/apierror"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// VehicleBooking is a trip a vehicle is booked on, from its departure until
+// the trip ends
+type VehicleBooking struct {
+	TripID        uint      `json:"trip_id"`
+	UserID        uint      `json:"user_id"`
+	Status        string    `json:"status"`
+	DepartureDate time.Time `json:"departure_date"`
+	EndsAt        time.Time `json:"ends_at"`
+}
+
+// VehicleConflict is two trips booked on a vehicle at the same time, e.g.
+// trips created before bookings were checked or with an admin's override
+type VehicleConflict struct {
+	VehicleID       uint             `json:"vehicle_id"`
+	LicensePlate    string           `json:"license_plate"`
+	Trips           []VehicleBooking `json:"trips"` // in the order they depart
+	OverlapStartsAt time.Time        `json:"overlap_starts_at"`
+	OverlapEndsAt   time.Time        `json:"overlap_ends_at"`
+}
+
+// VehicleBookingService checks vehicles aren't booked on two trips at once
+type VehicleBookingService struct {
+	db *gorm.DB
+}
+
+// NewVehicleBookingService creates a new VehicleBookingService
+func NewVehicleBookingService(db *gorm.DB) *VehicleBookingService {
+	return &VehicleBookingService{db: db}
+}
+
+// CheckVehicle returns the conflict of a vehicle being used for a trip from
+// start until end with the other trips it's booked on that aren't over, or
+// nil if it's free. The trip itself, if it exists yet, doesn't conflict.
+func (s *VehicleBookingService) CheckVehicle(vehicleID, tripID uint, start, end time.Time) error {
+	if vehicleID == 0 {
+		return nil
+	}
+
+	var trips []models.Trip
+	if err := s.db.Where("vehicle_id = ? AND id <> ?", vehicleID, tripID).
+		Where("status NOT IN ?", []string{"COMPLETED", "CANCELLED"}).
+		Where("departure_date < ?", end).
+		Order("departure_date ASC").Find(&trips).Error; err != nil {
+		return fmt.Errorf("failed to check vehicle bookings: %w", err)
+	}
+
+	for i := range trips {
+		otherEnd := TripEnd(&trips[i])
+		if start.Before(otherEnd) {
+			return &ScheduleConflictError{
+				Code:      apierror.CodeVehicleDoubleBooked,
+				Reason:    fmt.Sprintf("The vehicle is booked on trip %d %s", trips[i].ID, formatSchedulePeriod(trips[i].DepartureDate, otherEnd)),
+				VehicleID: vehicleID,
+				TripID:    trips[i].ID,
+			}
+		}
+	}
+	return nil
+}
+
+// GetConflicts returns the pairs of trips booked on the same vehicle at once
+// that haven't ended by now, for the vehicles of a carrier or every vehicle
+// when carrierID is 0. Conflicts are ordered by vehicle and departure.
+func (s *VehicleBookingService) GetConflicts(carrierID uint, now time.Time) ([]VehicleConflict, error) {
+	query := s.db.Model(&models.Trip{}).
+		Joins("JOIN vehicles ON vehicles.id = trips.vehicle_id").
+		Where("trips.status NOT IN ?", []string{"COMPLETED", "CANCELLED"})
+	if carrierID != 0 {
+		query = query.Where("vehicles.user_id = ?", carrierID)
+	}
+	var trips []models.Trip
+	if err := query.Order("trips.vehicle_id ASC, trips.departure_date ASC, trips.id ASC").
+		Find(&trips).Error; err != nil {
+		return nil, fmt.Errorf("failed to get vehicle bookings: %w", err)
+	}
+
+	conflicts := []VehicleConflict{}
+	for i := range trips {
+		end := TripEnd(&trips[i])
+		if !end.After(now) {
+			continue
+		}
+		// Trips of the vehicle departing before this one ends
+		for j := i + 1; j < len(trips) && trips[j].VehicleID == trips[i].VehicleID && trips[j].DepartureDate.Before(end); j++ {
+			otherEnd := TripEnd(&trips[j])
+			overlapEnd := end
+			if otherEnd.Before(overlapEnd) {
+				overlapEnd = otherEnd
+			}
+			conflicts = append(conflicts, VehicleConflict{
+				VehicleID:       trips[i].VehicleID,
+				Trips:           []VehicleBooking{vehicleBooking(&trips[i]), vehicleBooking(&trips[j])},
+				OverlapStartsAt: trips[j].DepartureDate,
+				OverlapEndsAt:   overlapEnd,
+			})
+		}
+	}
+	if len(conflicts) == 0 {
+		return conflicts, nil
+	}
+
+	vehicleIDs := make([]uint, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		vehicleIDs = append(vehicleIDs, conflict.VehicleID)
+	}
+	var vehicles []models.Vehicle
+	if err := s.db.Where("id IN ?", vehicleIDs).Find(&vehicles).Error; err != nil {
+		return nil, fmt.Errorf("failed to get vehicles: %w", err)
+	}
+	plates := make(map[uint]string, len(vehicles))
+	for _, vehicle := range vehicles {
+		plates[vehicle.ID] = vehicle.LicensePlate
+	}
+	for i := range conflicts {
+		conflicts[i].LicensePlate = plates[conflicts[i].VehicleID]
+	}
+	return conflicts, nil
+}
+
+// vehicleBooking returns a trip as a booking of its vehicle
+func vehicleBooking(trip *models.Trip) VehicleBooking {
+	return VehicleBooking{
+		TripID:        trip.ID,
+		UserID:        trip.UserID,
+		Status:        trip.Status,
+		DepartureDate: trip.DepartureDate,
+		EndsAt:        TripEnd(trip),
+	}
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Vehicle document types with expiry dates
+const (
+	VehicleDocumentInsurance    = "INSURANCE"
+	VehicleDocumentRegistration = "REGISTRATION"
+	VehicleDocumentInspection   = "INSPECTION"
+)
+
+// defaultVehicleReminderDays are the days before expiry at which carriers are reminded
+var defaultVehicleReminderDays = []int{30, 14, 3}
+
+// VehicleExpiration is an expiry date of a vehicle document
+type VehicleExpiration struct {
+	VehicleID     uint      `json:"vehicle_id"`
+	LicensePlate  string    `json:"license_plate"`
+	DocumentType  string    `json:"document_type"`
+	ExpiryDate    time.Time `json:"expiry_date"`
+	DaysRemaining int       `json:"days_remaining"`
+	Expired       bool      `json:"expired"`
+}
+
+// VehicleComplianceStatus lists the expired and missing documents of a vehicle
+type VehicleComplianceStatus struct {
+	VehicleID        uint                `json:"vehicle_id"`
+	LicensePlate     string              `json:"license_plate"`
+	Compliant        bool                `json:"compliant"`
+	ExpiredDocuments []VehicleExpiration `json:"expired_documents"`
+	MissingDocuments []string            `json:"missing_documents"`
+	Expirations      []VehicleExpiration `json:"expirations"`
+	CheckedAt        time.Time           `json:"checked_at"`
+}
+
+// VehicleComplianceService tracks vehicle insurance, registration and
+// inspection expiry dates and reminds carriers before they lapse
+type VehicleComplianceService struct {
+	db                  *gorm.DB
+	notificationService *NotificationService
+	reminderDays        []int
+}
+
+// NewVehicleComplianceService creates a new vehicle compliance service instance.
+// reminderDays defaults to 30, 14 and 3 days when empty.
+func NewVehicleComplianceService(db *gorm.DB, reminderDays []int) *VehicleComplianceService {
+	if len(reminderDays) == 0 {
+		reminderDays = defaultVehicleReminderDays
+	}
+	days := append([]int(nil), reminderDays...)
+	sort.Sort(sort.Reverse(sort.IntSlice(days)))
+
+	return &VehicleComplianceService{
+		db:                  db,
+		notificationService: NewNotificationService(db),
+		reminderDays:        days,
+	}
+}
+
+// GetVehicleCompliance checks a vehicle's documents as of now
+func (vcs *VehicleComplianceService) GetVehicleCompliance(vehicleID uint) (*VehicleComplianceStatus, error) {
+	var vehicle models.Vehicle
+	if err := vcs.db.First(&vehicle, vehicleID).Error; err != nil {
+		return nil, errors.New("vehicle not found")
+	}
+
+	now := time.Now()
+	return buildVehicleCompliance(&vehicle, now, now), nil
+}
+
+// GetUpcomingExpirations returns the documents of a carrier's active vehicles
+// that have expired or expire within the given number of days, soonest first
+func (vcs *VehicleComplianceService) GetUpcomingExpirations(carrierID uint, withinDays int) ([]VehicleExpiration, error) {
+	var vehicles []models.Vehicle
+	if err := vcs.db.Where("user_id = ? AND is_active = ?", carrierID, true).Find(&vehicles).Error; err != nil {
+		return nil, fmt.Errorf("failed to get vehicles: %w", err)
+	}
+
+	now := time.Now()
+	until := now.AddDate(0, 0, withinDays)
+
+	expirations := []VehicleExpiration{}
+	for i := range vehicles {
+		for _, expiration := range vehicleExpirations(&vehicles[i], now) {
+			if expiration.ExpiryDate.Before(until) {
+				expirations = append(expirations, expiration)
+			}
+		}
+	}
+
+	sort.Slice(expirations, func(i, j int) bool {
+		return expirations[i].ExpiryDate.Before(expirations[j].ExpiryDate)
+	})
+	return expirations, nil
+}
+
+// ValidateVehicleForTrip checks that the vehicle of a trip belongs to its
+// carrier, is active and that none of its documents expire before the trip ends
+func (vcs *VehicleComplianceService) ValidateVehicleForTrip(trip *models.Trip) error {
+	if trip.VehicleID == 0 {
+		return nil
+	}
+
+	var vehicle models.Vehicle
+	if err := vcs.db.First(&vehicle, trip.VehicleID).Error; err != nil {
+		return errors.New("vehicle not found")
+	}
+	if vehicle.UserID != trip.UserID {
+		return errors.New("vehicle does not belong to the trip carrier")
+	}
+	if !vehicle.IsActive {
+		return errors.New("vehicle is not active")
+	}
+
+	// Documents must stay valid until the trip ends
+	tripEnd := time.Now()
+	if trip.DepartureDate.After(tripEnd) {
+		tripEnd = trip.DepartureDate
+	}
+	if trip.EstimatedArrival.After(tripEnd) {
+		tripEnd = trip.EstimatedArrival
+	}
+
+	status := buildVehicleCompliance(&vehicle, tripEnd, time.Now())
+	if !status.Compliant {
+		documents := make([]string, 0, len(status.ExpiredDocuments))
+		for _, expired := range status.ExpiredDocuments {
+			documents = append(documents, strings.ToLower(expired.DocumentType))
+		}
+		return fmt.Errorf("vehicle %s has %s expiring before the end of the trip",
+			vehicle.LicensePlate, strings.Join(documents, ", "))
+	}
+	return nil
+}
+
+// SendExpiryReminders notifies carriers about vehicle documents that are
+// about to expire. Each reminder stage is sent once per expiry date; when a
+// stage was missed only the most urgent due stage is sent.
+func (vcs *VehicleComplianceService) SendExpiryReminders() error {
+	now := time.Now()
+	until := now.AddDate(0, 0, vcs.reminderDays[0])
+
+	var vehicles []models.Vehicle
+	if err := vcs.db.Where("is_active = ?", true).
+		Where("(insurance_expiry BETWEEN ? AND ?) OR (registration_expiry BETWEEN ? AND ?) OR (inspection_expiry BETWEEN ? AND ?)",
+			now, until, now, until, now, until).
+		Find(&vehicles).Error; err != nil {
+		return fmt.Errorf("failed to get vehicles with expiring documents: %w", err)
+	}
+
+	sent := 0
+	for i := range vehicles {
+		vehicle := &vehicles[i]
+		for _, expiration := range vehicleExpirations(vehicle, now) {
+			stage := reminderStage(vcs.reminderDays, expiration.ExpiryDate.Sub(now))
+			if expiration.Expired || stage == 0 {
+				continue
+			}
+
+			var count int64
+			vcs.db.Model(&models.VehicleComplianceReminder{}).
+				Where("vehicle_id = ? AND document_type = ? AND expiry_date = ? AND days_before <= ?",
+					vehicle.ID, expiration.DocumentType, expiration.ExpiryDate, stage).
+				Count(&count)
+			if count > 0 {
+				continue
+			}
+
+			notification := models.Notification{
+				UserID: vehicle.UserID,
+				Title:  "Vehicle Document Expiring",
+				Message: fmt.Sprintf("The %s of vehicle %s expires on %s (%d days)",
+					strings.ToLower(expiration.DocumentType), vehicle.LicensePlate,
+					expiration.ExpiryDate.Format("2006-01-02"), expiration.DaysRemaining),
+				Type:      "VEHICLE_DOCUMENT_EXPIRING",
+				RelatedID: vehicle.ID,
+			}
+			if created, _, err := vcs.notificationService.CreateNotificationWithDelivery(&notification); created == nil {
+				log.Printf("Failed to send expiry reminder for vehicle %d: %v", vehicle.ID, err)
+				continue
+			}
+
+			reminder := models.VehicleComplianceReminder{
+				VehicleID:    vehicle.ID,
+				DocumentType: expiration.DocumentType,
+				ExpiryDate:   expiration.ExpiryDate,
+				DaysBefore:   stage,
+				SentAt:       now,
+			}
+			if err := vcs.db.Create(&reminder).Error; err != nil {
+				log.Printf("Failed to record expiry reminder for vehicle %d: %v", vehicle.ID, err)
+			}
+			sent++
+		}
+	}
+
+	if sent > 0 {
+		log.Printf("Sent %d vehicle document expiry reminders", sent)
+	}
+	return nil
+}
+
+// buildVehicleCompliance checks a vehicle's documents. Documents expiring
+// before validUntil count as expired; days remaining are counted from now.
+func buildVehicleCompliance(vehicle *models.Vehicle, validUntil, now time.Time) *VehicleComplianceStatus {
+	status := &VehicleComplianceStatus{
+		VehicleID:        vehicle.ID,
+		LicensePlate:     vehicle.LicensePlate,
+		ExpiredDocuments: []VehicleExpiration{},
+		MissingDocuments: []string{},
+		Expirations:      vehicleExpirations(vehicle, now),
+		CheckedAt:        now,
+	}
+
+	for _, document := range []struct {
+		documentType string
+		expiry       *time.Time
+	}{
+		{VehicleDocumentInsurance, vehicle.InsuranceExpiry},
+		{VehicleDocumentRegistration, vehicle.RegistrationExpiry},
+		{VehicleDocumentInspection, vehicle.InspectionExpiry},
+	} {
+		if document.expiry == nil {
+			status.MissingDocuments = append(status.MissingDocuments, document.documentType)
+		}
+	}
+
+	for _, expiration := range status.Expirations {
+		if expiration.ExpiryDate.Before(validUntil) {
+			status.ExpiredDocuments = append(status.ExpiredDocuments, expiration)
+		}
+	}
+
+	// Missing dates are reported but don't block, since they were optional
+	status.Compliant = len(status.ExpiredDocuments) == 0
+	return status
+}
+
+// vehicleExpirations returns the known document expiry dates of a vehicle
+func vehicleExpirations(vehicle *models.Vehicle, now time.Time) []VehicleExpiration {
+	var expirations []VehicleExpiration
+	add := func(documentType string, expiry *time.Time) {
+		if expiry == nil {
+			return
+		}
+		expirations = append(expirations, VehicleExpiration{
+			VehicleID:     vehicle.ID,
+			LicensePlate:  vehicle.LicensePlate,
+			DocumentType:  documentType,
+			ExpiryDate:    *expiry,
+			DaysRemaining: int(expiry.Sub(now).Hours() / 24),
+			Expired:       expiry.Before(now),
+		})
+	}
+
+	add(VehicleDocumentInsurance, vehicle.InsuranceExpiry)
+	add(VehicleDocumentRegistration, vehicle.RegistrationExpiry)
+	add(VehicleDocumentInspection, vehicle.InspectionExpiry)
+	return expirations
+}
+
+// reminderStage returns the most urgent reminder stage (in days, sorted
+// descending) reached with the given time left, or 0 when none is due yet
+func reminderStage(reminderDays []int, remaining time.Duration) int {
+	stage := 0
+	for _, days := range reminderDays {
+		if remaining <= time.Duration(days)*24*time.Hour {
+			stage = days
+		}
+	}
+	return stage
+}
@@ -0,0 +1,486 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"triplink/backend/config"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Services vehicles are due every so many kilometers
+const (
+	VehicleServiceOil        = "OIL"
+	VehicleServiceTires      = "TIRES"
+	VehicleServiceInspection = "INSPECTION"
+)
+
+// Status of a vehicle service
+const (
+	MaintenanceOK      = "OK"
+	MaintenanceDueSoon = "DUE_SOON"
+	MaintenanceOverdue = "OVERDUE"
+)
+
+var (
+	// ErrVehicleNotFound is returned for vehicles that don't exist
+	ErrVehicleNotFound = errors.New("vehicle not found")
+	// ErrNotVehicleOwner is returned when a carrier manages the maintenance
+	// of another carrier's vehicle
+	ErrNotVehicleOwner = errors.New("vehicle belongs to another carrier")
+	// ErrInvalidServiceType is returned for services other than the ones
+	// tracked
+	ErrInvalidServiceType = errors.New("service type must be OIL, TIRES or INSPECTION")
+	// ErrServiceNotSetUp is returned when completing a service the vehicle
+	// has no interval for
+	ErrServiceNotSetUp    = errors.New("service interval is not set up for this vehicle")
+	ErrInvalidIntervalKm  = errors.New("interval_km cannot be negative")
+	ErrInvalidOdometerKm  = errors.New("odometer_km cannot be negative")
+	ErrInvalidLastService = errors.New("last_service_km cannot be above the odometer")
+	ErrInvalidWithinKm    = errors.New("within_km cannot be negative")
+)
+
+// vehicleServiceNames describe services in notifications
+var vehicleServiceNames = map[string]string{
+	VehicleServiceOil:        "oil change",
+	VehicleServiceTires:      "tire service",
+	VehicleServiceInspection: "inspection",
+}
+
+// MaintenanceDue is when a vehicle is next due a service
+type MaintenanceDue struct {
+	VehicleID     uint       `json:"vehicle_id"`
+	LicensePlate  string     `json:"license_plate"`
+	ServiceType   string     `json:"service_type"`
+	IntervalKm    float64    `json:"interval_km"`
+	LastServiceKm float64    `json:"last_service_km"`
+	LastServiceAt *time.Time `json:"last_service_at,omitempty"`
+	NextServiceKm float64    `json:"next_service_km"`
+	// Negative once overdue
+	RemainingKm float64 `json:"remaining_km"`
+	Status      string  `json:"status"`
+	// At the vehicle's recent daily distance, nil when it wasn't driven
+	EstimatedDueDate *time.Time `json:"estimated_due_date,omitempty"`
+}
+
+// VehicleMaintenanceStatus is a vehicle's mileage and the services it is due
+type VehicleMaintenanceStatus struct {
+	VehicleID      uint             `json:"vehicle_id"`
+	LicensePlate   string           `json:"license_plate"`
+	OdometerKm     float64          `json:"odometer_km"`
+	TrackedKm      float64          `json:"tracked_km"`
+	AverageDailyKm float64          `json:"average_daily_km"`
+	Services       []MaintenanceDue `json:"services"`
+}
+
+// ServiceIntervalRequest sets up a service a vehicle is due every so many
+// kilometers
+type ServiceIntervalRequest struct {
+	// Defaults to the configured interval of the service
+	IntervalKm float64 `json:"interval_km"`
+	// Odometer reading at the last service, defaulting to the current one
+	// for a new interval
+	LastServiceKm *float64   `json:"last_service_km"`
+	LastServiceAt *time.Time `json:"last_service_at"`
+}
+
+// VehicleMaintenanceService accumulates the kilometers vehicles drive from
+// their trips' tracking data and reminds carriers of services falling due
+type VehicleMaintenanceService struct {
+	db  *gorm.DB
+	cfg *config.VehicleMaintenanceConfig
+	now func() time.Time
+}
+
+// NewVehicleMaintenanceService creates a new vehicle maintenance service
+func NewVehicleMaintenanceService(db *gorm.DB, cfg *config.VehicleMaintenanceConfig) *VehicleMaintenanceService {
+	return &VehicleMaintenanceService{db: db, cfg: cfg, now: time.Now}
+}
+
+// VehicleOdometer returns a vehicle's odometer reading in km
+func VehicleOdometer(vehicle *models.Vehicle) float64 {
+	return roundHundredths(vehicle.TrackedKm + vehicle.OdometerOffsetKm)
+}
+
+// carrierVehicle returns a vehicle of a carrier
+func (s *VehicleMaintenanceService) carrierVehicle(carrierID, vehicleID uint) (*models.Vehicle, error) {
+	var vehicle models.Vehicle
+	if err := s.db.First(&vehicle, vehicleID).Error; err != nil {
+		return nil, ErrVehicleNotFound
+	}
+	if vehicle.UserID != carrierID {
+		return nil, ErrNotVehicleOwner
+	}
+	return &vehicle, nil
+}
+
+// GetMaintenance returns a carrier's vehicle's mileage and when it is next
+// due each of its services
+func (s *VehicleMaintenanceService) GetMaintenance(carrierID, vehicleID uint) (*VehicleMaintenanceStatus, error) {
+	vehicle, err := s.carrierVehicle(carrierID, vehicleID)
+	if err != nil {
+		return nil, err
+	}
+
+	var intervals []models.VehicleServiceInterval
+	if err := s.db.Where("vehicle_id = ?", vehicle.ID).Order("service_type").Find(&intervals).Error; err != nil {
+		return nil, fmt.Errorf("failed to get service intervals: %w", err)
+	}
+	daily, err := s.averageDailyKm([]uint{vehicle.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	status := &VehicleMaintenanceStatus{
+		VehicleID:      vehicle.ID,
+		LicensePlate:   vehicle.LicensePlate,
+		OdometerKm:     VehicleOdometer(vehicle),
+		TrackedKm:      roundHundredths(vehicle.TrackedKm),
+		AverageDailyKm: roundHundredths(daily[vehicle.ID]),
+		Services:       []MaintenanceDue{},
+	}
+	for i := range intervals {
+		status.Services = append(status.Services, s.maintenanceDue(vehicle, &intervals[i], daily[vehicle.ID]))
+	}
+	return status, nil
+}
+
+// GetUpcomingMaintenance returns the services of a carrier's active vehicles
+// that are overdue or due within withinKm, most urgent first
+func (s *VehicleMaintenanceService) GetUpcomingMaintenance(carrierID uint, withinKm float64) ([]MaintenanceDue, error) {
+	if withinKm < 0 {
+		return nil, ErrInvalidWithinKm
+	}
+
+	var vehicles []models.Vehicle
+	if err := s.db.Where("user_id = ? AND is_active = ?", carrierID, true).Find(&vehicles).Error; err != nil {
+		return nil, fmt.Errorf("failed to get vehicles: %w", err)
+	}
+	upcoming := []MaintenanceDue{}
+	if len(vehicles) == 0 {
+		return upcoming, nil
+	}
+
+	vehiclesByID := make(map[uint]*models.Vehicle, len(vehicles))
+	vehicleIDs := make([]uint, 0, len(vehicles))
+	for i := range vehicles {
+		vehiclesByID[vehicles[i].ID] = &vehicles[i]
+		vehicleIDs = append(vehicleIDs, vehicles[i].ID)
+	}
+
+	var intervals []models.VehicleServiceInterval
+	if err := s.db.Where("vehicle_id IN ?", vehicleIDs).Find(&intervals).Error; err != nil {
+		return nil, fmt.Errorf("failed to get service intervals: %w", err)
+	}
+	daily, err := s.averageDailyKm(vehicleIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range intervals {
+		vehicle := vehiclesByID[intervals[i].VehicleID]
+		due := s.maintenanceDue(vehicle, &intervals[i], daily[vehicle.ID])
+		if due.RemainingKm <= withinKm {
+			upcoming = append(upcoming, due)
+		}
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		return upcoming[i].RemainingKm < upcoming[j].RemainingKm
+	})
+	return upcoming, nil
+}
+
+// SetServiceInterval sets up or changes a service a carrier's vehicle is due
+// every so many kilometers
+func (s *VehicleMaintenanceService) SetServiceInterval(carrierID, vehicleID uint, serviceType string, req ServiceIntervalRequest) (*models.VehicleServiceInterval, error) {
+	serviceType = strings.ToUpper(serviceType)
+	defaultKm, ok := s.defaultIntervalKm(serviceType)
+	if !ok {
+		return nil, ErrInvalidServiceType
+	}
+	if req.IntervalKm < 0 {
+		return nil, ErrInvalidIntervalKm
+	}
+	vehicle, err := s.carrierVehicle(carrierID, vehicleID)
+	if err != nil {
+		return nil, err
+	}
+	odometer := VehicleOdometer(vehicle)
+
+	var interval models.VehicleServiceInterval
+	err = s.db.Where("vehicle_id = ? AND service_type = ?", vehicle.ID, serviceType).First(&interval).Error
+	if err == gorm.ErrRecordNotFound {
+		interval = models.VehicleServiceInterval{
+			VehicleID:     vehicle.ID,
+			ServiceType:   serviceType,
+			IntervalKm:    defaultKm,
+			LastServiceKm: odometer,
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get service interval: %w", err)
+	}
+
+	if req.IntervalKm > 0 {
+		interval.IntervalKm = req.IntervalKm
+	}
+	if req.LastServiceKm != nil {
+		if *req.LastServiceKm < 0 {
+			return nil, ErrInvalidOdometerKm
+		}
+		if *req.LastServiceKm > odometer {
+			return nil, ErrInvalidLastService
+		}
+		interval.LastServiceKm = *req.LastServiceKm
+	}
+	if req.LastServiceAt != nil {
+		interval.LastServiceAt = req.LastServiceAt
+	}
+	// Notify again of whatever the new interval makes due
+	interval.NotifiedStatus = ""
+
+	if err := s.db.Save(&interval).Error; err != nil {
+		return nil, fmt.Errorf("failed to save service interval: %w", err)
+	}
+	return &interval, nil
+}
+
+// CompleteService records that a carrier's vehicle was serviced at its
+// current odometer reading
+func (s *VehicleMaintenanceService) CompleteService(carrierID, vehicleID uint, serviceType string) (*models.VehicleServiceInterval, error) {
+	serviceType = strings.ToUpper(serviceType)
+	if _, ok := s.defaultIntervalKm(serviceType); !ok {
+		return nil, ErrInvalidServiceType
+	}
+	vehicle, err := s.carrierVehicle(carrierID, vehicleID)
+	if err != nil {
+		return nil, err
+	}
+
+	var interval models.VehicleServiceInterval
+	if err := s.db.Where("vehicle_id = ? AND service_type = ?", vehicle.ID, serviceType).First(&interval).Error; err != nil {
+		return nil, ErrServiceNotSetUp
+	}
+
+	now := s.now()
+	interval.LastServiceKm = VehicleOdometer(vehicle)
+	interval.LastServiceAt = &now
+	interval.NotifiedStatus = ""
+	if err := s.db.Save(&interval).Error; err != nil {
+		return nil, fmt.Errorf("failed to save service interval: %w", err)
+	}
+	return &interval, nil
+}
+
+// SetOdometer corrects a carrier's vehicle's odometer to a reading. Tracked
+// kilometers are added on top of it from then on.
+func (s *VehicleMaintenanceService) SetOdometer(carrierID, vehicleID uint, odometerKm float64) (*models.Vehicle, error) {
+	if odometerKm < 0 {
+		return nil, ErrInvalidOdometerKm
+	}
+	vehicle, err := s.carrierVehicle(carrierID, vehicleID)
+	if err != nil {
+		return nil, err
+	}
+
+	vehicle.OdometerOffsetKm = odometerKm - vehicle.TrackedKm
+	if err := s.db.Model(vehicle).Update("odometer_offset_km", vehicle.OdometerOffsetKm).Error; err != nil {
+		return nil, fmt.Errorf("failed to save odometer: %w", err)
+	}
+	return vehicle, nil
+}
+
+// UpdateMileage adds the kilometers vehicles drove since the last run, from
+// the hourly rollups of their trips' tracking data, and notifies carriers of
+// services that fell due
+func (s *VehicleMaintenanceService) UpdateMileage() error {
+	var totals []struct {
+		VehicleID  uint
+		DistanceKm float64
+	}
+	if err := s.db.Table("tracking_aggregates").
+		Select("trips.vehicle_id, SUM(tracking_aggregates.distance_km) AS distance_km").
+		Joins("JOIN trips ON trips.id = tracking_aggregates.trip_id").
+		Where("tracking_aggregates.resolution = ? AND trips.vehicle_id > 0", TrackingResolution1h).
+		Group("trips.vehicle_id").
+		Scan(&totals).Error; err != nil {
+		return fmt.Errorf("failed to sum vehicle mileage: %w", err)
+	}
+
+	updated := 0
+	for _, total := range totals {
+		// Rollups of a trip's last hours are recomputed as records arrive,
+		// so only ever count up
+		result := s.db.Model(&models.Vehicle{}).
+			Where("id = ? AND tracked_km < ?", total.VehicleID, total.DistanceKm-0.01).
+			Update("tracked_km", total.DistanceKm)
+		if result.Error != nil {
+			return fmt.Errorf("failed to update mileage of vehicle %d: %w", total.VehicleID, result.Error)
+		}
+		updated += int(result.RowsAffected)
+	}
+	if updated > 0 {
+		log.Printf("Updated the mileage of %d vehicles", updated)
+	}
+
+	return s.notifyDueServices()
+}
+
+// notifyDueServices notifies carriers once when a service of an active
+// vehicle comes due within the configured distance, and once when it is
+// overdue
+func (s *VehicleMaintenanceService) notifyDueServices() error {
+	var intervals []models.VehicleServiceInterval
+	if err := s.db.Joins("JOIN vehicles ON vehicles.id = vehicle_service_intervals.vehicle_id").
+		Where("vehicles.is_active = ? AND vehicle_service_intervals.notified_status <> ?", true, MaintenanceOverdue).
+		Find(&intervals).Error; err != nil {
+		return fmt.Errorf("failed to get service intervals: %w", err)
+	}
+	if len(intervals) == 0 {
+		return nil
+	}
+
+	vehicleIDs := make([]uint, 0, len(intervals))
+	for _, interval := range intervals {
+		vehicleIDs = append(vehicleIDs, interval.VehicleID)
+	}
+	var vehicles []models.Vehicle
+	if err := s.db.Where("id IN ?", vehicleIDs).Find(&vehicles).Error; err != nil {
+		return fmt.Errorf("failed to get vehicles: %w", err)
+	}
+	vehiclesByID := make(map[uint]*models.Vehicle, len(vehicles))
+	for i := range vehicles {
+		vehiclesByID[vehicles[i].ID] = &vehicles[i]
+	}
+	daily, err := s.averageDailyKm(vehicleIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range intervals {
+		interval := &intervals[i]
+		vehicle := vehiclesByID[interval.VehicleID]
+		due := s.maintenanceDue(vehicle, interval, daily[vehicle.ID])
+		if maintenanceUrgency(due.Status) <= maintenanceUrgency(interval.NotifiedStatus) {
+			continue
+		}
+
+		s.notifyDue(vehicle, due)
+		if err := s.db.Model(interval).Update("notified_status", due.Status).Error; err != nil {
+			log.Printf("Failed to record maintenance reminder for vehicle %d: %v", vehicle.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *VehicleMaintenanceService) notifyDue(vehicle *models.Vehicle, due MaintenanceDue) {
+	name := vehicleServiceNames[due.ServiceType]
+	system := UserUnitSystem(s.db, vehicle.UserID)
+	message := fmt.Sprintf("Vehicle %s is due its %s in %s, at %s", vehicle.LicensePlate, name,
+		system.FormatWholeDistance(due.RemainingKm), system.FormatWholeDistance(due.NextServiceKm))
+	if due.Status == MaintenanceOverdue {
+		message = fmt.Sprintf("Vehicle %s is %s overdue for its %s, due at %s", vehicle.LicensePlate,
+			system.FormatWholeDistance(-due.RemainingKm), name, system.FormatWholeDistance(due.NextServiceKm))
+	}
+
+	notification := models.Notification{
+		UserID:    vehicle.UserID,
+		Title:     "Vehicle Maintenance Due",
+		Message:   message,
+		Type:      "VEHICLE_MAINTENANCE_DUE",
+		RelatedID: vehicle.ID,
+	}
+	if notifications := GetNotificationService(); notifications != nil {
+		if created, _, err := notifications.CreateNotificationWithDelivery(&notification); created == nil {
+			log.Printf("Failed to send maintenance reminder for vehicle %d: %v", vehicle.ID, err)
+		}
+	} else {
+		s.db.Create(&notification)
+	}
+}
+
+// maintenanceDue works out when a vehicle is next due a service
+func (s *VehicleMaintenanceService) maintenanceDue(vehicle *models.Vehicle, interval *models.VehicleServiceInterval, dailyKm float64) MaintenanceDue {
+	next := interval.LastServiceKm + interval.IntervalKm
+	remaining := roundHundredths(next - VehicleOdometer(vehicle))
+
+	due := MaintenanceDue{
+		VehicleID:     vehicle.ID,
+		LicensePlate:  vehicle.LicensePlate,
+		ServiceType:   interval.ServiceType,
+		IntervalKm:    interval.IntervalKm,
+		LastServiceKm: interval.LastServiceKm,
+		LastServiceAt: interval.LastServiceAt,
+		NextServiceKm: roundHundredths(next),
+		RemainingKm:   remaining,
+		Status:        MaintenanceOK,
+	}
+	switch {
+	case remaining <= 0:
+		due.Status = MaintenanceOverdue
+	case remaining <= s.cfg.DueSoonKm:
+		due.Status = MaintenanceDueSoon
+	}
+
+	if dailyKm > 0 {
+		days := math.Max(remaining, 0) / dailyKm
+		date := s.now().Add(time.Duration(days * float64(24*time.Hour))).Truncate(24 * time.Hour)
+		due.EstimatedDueDate = &date
+	}
+	return due
+}
+
+// averageDailyKm returns the kilometers vehicles drove per day over the
+// usage window
+func (s *VehicleMaintenanceService) averageDailyKm(vehicleIDs []uint) (map[uint]float64, error) {
+	var totals []struct {
+		VehicleID  uint
+		DistanceKm float64
+	}
+	if err := s.db.Table("tracking_aggregates").
+		Select("trips.vehicle_id, SUM(tracking_aggregates.distance_km) AS distance_km").
+		Joins("JOIN trips ON trips.id = tracking_aggregates.trip_id").
+		Where("tracking_aggregates.resolution = ? AND tracking_aggregates.bucket_start >= ? AND trips.vehicle_id IN ?",
+			TrackingResolution1h, s.now().Add(-s.cfg.UsageWindow), vehicleIDs).
+		Group("trips.vehicle_id").
+		Scan(&totals).Error; err != nil {
+		return nil, fmt.Errorf("failed to get recent vehicle mileage: %w", err)
+	}
+
+	days := s.cfg.UsageWindow.Hours() / 24
+	daily := make(map[uint]float64, len(totals))
+	for _, total := range totals {
+		daily[total.VehicleID] = total.DistanceKm / days
+	}
+	return daily, nil
+}
+
+// defaultIntervalKm returns the configured interval of a service type
+func (s *VehicleMaintenanceService) defaultIntervalKm(serviceType string) (float64, bool) {
+	switch serviceType {
+	case VehicleServiceOil:
+		return s.cfg.OilIntervalKm, true
+	case VehicleServiceTires:
+		return s.cfg.TireIntervalKm, true
+	case VehicleServiceInspection:
+		return s.cfg.InspectionIntervalKm, true
+	}
+	return 0, false
+}
+
+// maintenanceUrgency orders maintenance statuses, with nothing notified yet
+// least urgent
+func maintenanceUrgency(status string) int {
+	switch status {
+	case MaintenanceDueSoon:
+		return 1
+	case MaintenanceOverdue:
+		return 2
+	}
+	return 0
+}
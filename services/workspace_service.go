@@ -0,0 +1,378 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"triplink/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Views saved filters apply to
+const (
+	SavedFilterTrips = "TRIPS"
+	SavedFilterLoads = "LOADS"
+)
+
+// dashboardWidgetTypes are the widgets dashboards can show
+var dashboardWidgetTypes = map[string]bool{
+	"TRIP_LIST": true,
+	"LOAD_LIST": true,
+	"MAP":       true,
+	"KPI":       true,
+	"ALERTS":    true,
+}
+
+var (
+	// ErrSavedFilterNotFound is returned for filters the user hasn't saved
+	ErrSavedFilterNotFound = errors.New("saved filter not found")
+	// ErrDashboardNotFound is returned for dashboards the user doesn't have
+	ErrDashboardNotFound = errors.New("dashboard not found")
+)
+
+// SavedFilterRequest sets the fields of a saved filter. A date bound is
+// either fixed or a number of days from the day the filter is applied.
+type SavedFilterRequest struct {
+	Name            string     `json:"name"`
+	View            string     `json:"view"` // TRIPS, LOADS
+	Statuses        []string   `json:"statuses"`
+	OriginCity      string     `json:"origin_city"`
+	DestinationCity string     `json:"destination_city"`
+	DateFrom        *time.Time `json:"date_from"`
+	DateTo          *time.Time `json:"date_to"`
+	DaysBack        *int       `json:"days_back"`
+	DaysAhead       *int       `json:"days_ahead"`
+	IsDefault       bool       `json:"is_default"`
+}
+
+// DashboardRequest sets the name and widgets of a dashboard. The widgets
+// replace those the dashboard had.
+type DashboardRequest struct {
+	Name      string                   `json:"name"`
+	IsDefault bool                     `json:"is_default"`
+	Widgets   []models.DashboardWidget `json:"widgets"`
+}
+
+// Workspace is what the frontend restores a user's workspace from: their
+// saved filters for a view and their dashboards
+type Workspace struct {
+	SavedFilters []models.SavedFilter `json:"saved_filters"`
+	Dashboards   []models.Dashboard   `json:"dashboards"`
+}
+
+// WorkspaceService manages users' saved filters and dashboards
+type WorkspaceService struct {
+	db *gorm.DB
+}
+
+// NewWorkspaceService creates a new WorkspaceService
+func NewWorkspaceService(db *gorm.DB) *WorkspaceService {
+	return &WorkspaceService{db: db}
+}
+
+// GetWorkspace returns a user's saved filters for a view, or for every view
+// when none is given, and their dashboards
+func (s *WorkspaceService) GetWorkspace(userID uint, view string) (*Workspace, error) {
+	filters, err := s.GetSavedFilters(userID, view)
+	if err != nil {
+		return nil, err
+	}
+	dashboards, err := s.GetDashboards(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Workspace{SavedFilters: filters, Dashboards: dashboards}, nil
+}
+
+// CreateSavedFilter saves a named filter for a user
+func (s *WorkspaceService) CreateSavedFilter(userID uint, req SavedFilterRequest) (*models.SavedFilter, error) {
+	filter := &models.SavedFilter{UserID: userID}
+	if err := applySavedFilterRequest(filter, req); err != nil {
+		return nil, err
+	}
+	if err := s.saveFilter(filter); err != nil {
+		return nil, fmt.Errorf("failed to create saved filter: %w", err)
+	}
+	return filter, nil
+}
+
+// GetSavedFilters returns a user's saved filters for a view by name, or of
+// every view when none is given
+func (s *WorkspaceService) GetSavedFilters(userID uint, view string) ([]models.SavedFilter, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if view != "" {
+		query = query.Where("view = ?", strings.ToUpper(view))
+	}
+
+	filters := []models.SavedFilter{}
+	if err := query.Order("name ASC, id ASC").Find(&filters).Error; err != nil {
+		return nil, fmt.Errorf("failed to get saved filters: %w", err)
+	}
+	return filters, nil
+}
+
+// GetSavedFilter returns one of a user's saved filters
+func (s *WorkspaceService) GetSavedFilter(userID, filterID uint) (*models.SavedFilter, error) {
+	var filter models.SavedFilter
+	if err := s.db.Where("id = ? AND user_id = ?", filterID, userID).First(&filter).Error; err != nil {
+		return nil, ErrSavedFilterNotFound
+	}
+	return &filter, nil
+}
+
+// UpdateSavedFilter replaces the fields of a saved filter
+func (s *WorkspaceService) UpdateSavedFilter(userID, filterID uint, req SavedFilterRequest) (*models.SavedFilter, error) {
+	filter, err := s.GetSavedFilter(userID, filterID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applySavedFilterRequest(filter, req); err != nil {
+		return nil, err
+	}
+	if err := s.saveFilter(filter); err != nil {
+		return nil, fmt.Errorf("failed to update saved filter: %w", err)
+	}
+	return filter, nil
+}
+
+// DeleteSavedFilter removes a saved filter. Dashboard widgets showing it
+// show everything instead.
+func (s *WorkspaceService) DeleteSavedFilter(userID, filterID uint) error {
+	filter, err := s.GetSavedFilter(userID, filterID)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.DashboardWidget{}).Where("filter_id = ?", filter.ID).
+			Update("filter_id", nil).Error; err != nil {
+			return fmt.Errorf("failed to update dashboard widgets: %w", err)
+		}
+		if err := tx.Delete(filter).Error; err != nil {
+			return fmt.Errorf("failed to delete saved filter: %w", err)
+		}
+		return nil
+	})
+}
+
+// ApplySavedFilter narrows a query of the trips or loads of the filter's
+// view to the filter, counting relative dates from now. Trips are filtered
+// by their departure and loads by their requested pickup.
+func ApplySavedFilter(query *gorm.DB, filter *models.SavedFilter, now time.Time) *gorm.DB {
+	originColumn, destinationColumn, dateColumn := "origin_city", "destination_city", "departure_date"
+	if filter.View == SavedFilterLoads {
+		originColumn, destinationColumn, dateColumn = "pickup_city", "delivery_city", "requested_pickup_date"
+	}
+
+	if filter.Statuses != "" {
+		query = query.Where("status IN ?", strings.Split(filter.Statuses, ","))
+	}
+	if filter.OriginCity != "" {
+		query = query.Where("LOWER("+originColumn+") = ?", strings.ToLower(filter.OriginCity))
+	}
+	if filter.DestinationCity != "" {
+		query = query.Where("LOWER("+destinationColumn+") = ?", strings.ToLower(filter.DestinationCity))
+	}
+
+	switch {
+	case filter.DateFrom != nil:
+		query = query.Where(dateColumn+" >= ?", *filter.DateFrom)
+	case filter.DaysBack != nil:
+		query = query.Where(dateColumn+" >= ?", now.AddDate(0, 0, -*filter.DaysBack))
+	}
+	switch {
+	case filter.DateTo != nil:
+		query = query.Where(dateColumn+" <= ?", *filter.DateTo)
+	case filter.DaysAhead != nil:
+		query = query.Where(dateColumn+" <= ?", now.AddDate(0, 0, *filter.DaysAhead))
+	}
+	return query
+}
+
+// CreateDashboard creates a dashboard for a user
+func (s *WorkspaceService) CreateDashboard(userID uint, req DashboardRequest) (*models.Dashboard, error) {
+	dashboard := &models.Dashboard{UserID: userID}
+	if err := s.saveDashboard(dashboard, req); err != nil {
+		return nil, err
+	}
+	return s.GetDashboard(userID, dashboard.ID)
+}
+
+// GetDashboards returns a user's dashboards by name, with their widgets
+func (s *WorkspaceService) GetDashboards(userID uint) ([]models.Dashboard, error) {
+	dashboards := []models.Dashboard{}
+	if err := s.db.Preload("Widgets", orderWidgets).Where("user_id = ?", userID).
+		Order("name ASC, id ASC").Find(&dashboards).Error; err != nil {
+		return nil, fmt.Errorf("failed to get dashboards: %w", err)
+	}
+	return dashboards, nil
+}
+
+// GetDashboard returns one of a user's dashboards with its widgets
+func (s *WorkspaceService) GetDashboard(userID, dashboardID uint) (*models.Dashboard, error) {
+	var dashboard models.Dashboard
+	if err := s.db.Preload("Widgets", orderWidgets).Where("id = ? AND user_id = ?", dashboardID, userID).
+		First(&dashboard).Error; err != nil {
+		return nil, ErrDashboardNotFound
+	}
+	return &dashboard, nil
+}
+
+// UpdateDashboard renames a dashboard and replaces its widgets
+func (s *WorkspaceService) UpdateDashboard(userID, dashboardID uint, req DashboardRequest) (*models.Dashboard, error) {
+	dashboard, err := s.GetDashboard(userID, dashboardID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.saveDashboard(dashboard, req); err != nil {
+		return nil, err
+	}
+	return s.GetDashboard(userID, dashboardID)
+}
+
+// DeleteDashboard removes a dashboard with its widgets
+func (s *WorkspaceService) DeleteDashboard(userID, dashboardID uint) error {
+	dashboard, err := s.GetDashboard(userID, dashboardID)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("dashboard_id = ?", dashboard.ID).Delete(&models.DashboardWidget{}).Error; err != nil {
+			return fmt.Errorf("failed to delete dashboard widgets: %w", err)
+		}
+		if err := tx.Delete(&models.Dashboard{}, dashboard.ID).Error; err != nil {
+			return fmt.Errorf("failed to delete dashboard: %w", err)
+		}
+		return nil
+	})
+}
+
+// orderWidgets orders a dashboard's widgets as they are laid out, top to
+// bottom and left to right
+func orderWidgets(db *gorm.DB) *gorm.DB {
+	return db.Order("y ASC, x ASC, id ASC")
+}
+
+// applySavedFilterRequest validates a request and copies it onto a filter
+func applySavedFilterRequest(filter *models.SavedFilter, req SavedFilterRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.View = strings.ToUpper(req.View)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if req.View != SavedFilterTrips && req.View != SavedFilterLoads {
+		return errors.New("view must be TRIPS or LOADS")
+	}
+	if req.DateFrom != nil && req.DaysBack != nil {
+		return errors.New("date_from and days_back can't be given together")
+	}
+	if req.DateTo != nil && req.DaysAhead != nil {
+		return errors.New("date_to and days_ahead can't be given together")
+	}
+	if (req.DaysBack != nil && *req.DaysBack < 0) || (req.DaysAhead != nil && *req.DaysAhead < 0) {
+		return errors.New("days_back and days_ahead can't be negative")
+	}
+	if req.DateFrom != nil && req.DateTo != nil && req.DateTo.Before(*req.DateFrom) {
+		return errors.New("date_to must be after date_from")
+	}
+
+	statuses := make([]string, 0, len(req.Statuses))
+	for _, status := range req.Statuses {
+		if status = strings.ToUpper(strings.TrimSpace(status)); status != "" {
+			statuses = append(statuses, status)
+		}
+	}
+
+	filter.Name = req.Name
+	filter.View = req.View
+	filter.Statuses = strings.Join(statuses, ",")
+	filter.OriginCity = strings.TrimSpace(req.OriginCity)
+	filter.DestinationCity = strings.TrimSpace(req.DestinationCity)
+	filter.DateFrom = req.DateFrom
+	filter.DateTo = req.DateTo
+	filter.DaysBack = req.DaysBack
+	filter.DaysAhead = req.DaysAhead
+	filter.IsDefault = req.IsDefault
+	return nil
+}
+
+// saveFilter saves a filter, clearing the default of the user's other
+// filters of its view when it is the default
+func (s *WorkspaceService) saveFilter(filter *models.SavedFilter) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if filter.IsDefault {
+			if err := tx.Model(&models.SavedFilter{}).
+				Where("user_id = ? AND view = ? AND id <> ?", filter.UserID, filter.View, filter.ID).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(filter).Error
+	})
+}
+
+// saveDashboard validates a request and saves it onto a dashboard, replacing
+// its widgets and clearing the default of the user's other dashboards when
+// it is the default
+func (s *WorkspaceService) saveDashboard(dashboard *models.Dashboard, req DashboardRequest) error {
+	dashboard.Name = strings.TrimSpace(req.Name)
+	dashboard.IsDefault = req.IsDefault
+	if dashboard.Name == "" {
+		return errors.New("name is required")
+	}
+
+	widgets := make([]models.DashboardWidget, len(req.Widgets))
+	for i, widget := range req.Widgets {
+		widget.Type = strings.ToUpper(widget.Type)
+		if !dashboardWidgetTypes[widget.Type] {
+			return fmt.Errorf("widget %d has an unknown type %q", i+1, widget.Type)
+		}
+		if widget.X < 0 || widget.Y < 0 || widget.Width <= 0 || widget.Height <= 0 {
+			return fmt.Errorf("widget %d must have a position and a positive size", i+1)
+		}
+		if widget.FilterID != nil {
+			if _, err := s.GetSavedFilter(dashboard.UserID, *widget.FilterID); err != nil {
+				return fmt.Errorf("widget %d: %w", i+1, err)
+			}
+		}
+		widgets[i] = models.DashboardWidget{
+			Type:     widget.Type,
+			Title:    strings.TrimSpace(widget.Title),
+			FilterID: widget.FilterID,
+			X:        widget.X,
+			Y:        widget.Y,
+			Width:    widget.Width,
+			Height:   widget.Height,
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if dashboard.IsDefault {
+			if err := tx.Model(&models.Dashboard{}).
+				Where("user_id = ? AND id <> ?", dashboard.UserID, dashboard.ID).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		dashboard.Widgets = nil
+		if err := tx.Save(dashboard).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("dashboard_id = ?", dashboard.ID).Delete(&models.DashboardWidget{}).Error; err != nil {
+			return err
+		}
+		for i := range widgets {
+			widgets[i].DashboardID = dashboard.ID
+		}
+		if len(widgets) > 0 {
+			return tx.Create(&widgets).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save dashboard: %w", err)
+	}
+	return nil
+}
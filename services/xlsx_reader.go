@@ -0,0 +1,182 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxXLSXPartSize bounds the size of a decompressed workbook part, so that a
+// small upload can't expand into an unbounded amount of XML
+const maxXLSXPartSize = 50 << 20
+
+// ReadXLSXRows returns the cells of the first sheet of a workbook as text,
+// one slice per row. Empty rows are kept so that row numbers match the
+// spreadsheet, and numbers are returned as stored, e.g. dates as serial days.
+func ReadXLSXRows(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("file is not a valid XLSX workbook")
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	var sharedStrings []string
+	if file, ok := files["xl/sharedStrings.xml"]; ok {
+		var table struct {
+			Items []xlsxRichText `xml:"si"`
+		}
+		if err := readXLSXPart(file, &table); err != nil {
+			return nil, err
+		}
+		for _, item := range table.Items {
+			sharedStrings = append(sharedStrings, item.text())
+		}
+	}
+
+	file, ok := files[firstXLSXSheet(files)]
+	if !ok {
+		return nil, errors.New("workbook has no sheets")
+	}
+	var sheet struct {
+		Rows []struct {
+			Number int `xml:"r,attr"`
+			Cells  []struct {
+				Ref    string       `xml:"r,attr"`
+				Type   string       `xml:"t,attr"`
+				Value  string       `xml:"v"`
+				Inline xlsxRichText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := readXLSXPart(file, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		number := row.Number
+		if number == 0 {
+			number = len(rows) + 1
+		}
+		for len(rows) < number {
+			rows = append(rows, nil)
+		}
+
+		var cells []string
+		for i, cell := range row.Cells {
+			column := i
+			if cell.Ref != "" {
+				if column, err = xlsxColumnIndex(cell.Ref); err != nil {
+					return nil, err
+				}
+			}
+			for len(cells) <= column {
+				cells = append(cells, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(cell.Value)
+				if err != nil || index < 0 || index >= len(sharedStrings) {
+					return nil, fmt.Errorf("invalid shared string in cell %s", cell.Ref)
+				}
+				cells[column] = sharedStrings[index]
+			case "inlineStr":
+				cells[column] = cell.Inline.text()
+			default:
+				cells[column] = cell.Value
+			}
+		}
+		rows[number-1] = cells
+	}
+	return rows, nil
+}
+
+// xlsxRichText is a string of a shared string table or inline string cell,
+// either plain or split into formatted runs
+type xlsxRichText struct {
+	Text string   `xml:"t"`
+	Runs []string `xml:"r>t"`
+}
+
+func (t xlsxRichText) text() string {
+	return t.Text + strings.Join(t.Runs, "")
+}
+
+// firstXLSXSheet returns the path of the workbook's first sheet
+func firstXLSXSheet(files map[string]*zip.File) string {
+	fallback := "xl/worksheets/sheet1.xml"
+
+	var workbook struct {
+		Sheets []struct {
+			RelationshipID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var relationships struct {
+		Items []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	workbookFile, ok := files["xl/workbook.xml"]
+	relsFile, relsOK := files["xl/_rels/workbook.xml.rels"]
+	if !ok || !relsOK || readXLSXPart(workbookFile, &workbook) != nil || readXLSXPart(relsFile, &relationships) != nil || len(workbook.Sheets) == 0 {
+		return fallback
+	}
+
+	for _, rel := range relationships.Items {
+		if rel.ID != workbook.Sheets[0].RelationshipID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/")
+		}
+		return path.Join("xl", rel.Target)
+	}
+	return fallback
+}
+
+// readXLSXPart decodes an XML part of a workbook
+func readXLSXPart(file *zip.File, v interface{}) error {
+	reader, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file.Name, err)
+	}
+	defer reader.Close()
+
+	limited := &io.LimitedReader{R: reader, N: maxXLSXPartSize + 1}
+	if err := xml.NewDecoder(limited).Decode(v); err != nil {
+		return fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+	if limited.N <= 0 {
+		return fmt.Errorf("%s is too large", file.Name)
+	}
+	return nil
+}
+
+// xlsxColumnIndex returns the zero based column index of a cell reference
+// such as B7
+func xlsxColumnIndex(ref string) (int, error) {
+	index := 0
+	letters := 0
+	for _, r := range strings.ToUpper(ref) {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+		letters++
+	}
+	if letters == 0 || letters > 3 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return index - 1, nil
+}
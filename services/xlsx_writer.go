@@ -0,0 +1,190 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxXLSXSheetName is the longest sheet name spreadsheet applications accept
+const maxXLSXSheetName = 31
+
+// XLSXWriter builds simple workbooks of text and number cells. Each sheet has
+// a bold header row followed by data rows.
+type XLSXWriter struct {
+	sheets []xlsxSheet
+}
+
+type xlsxSheet struct {
+	name    string
+	headers []string
+	rows    [][]interface{}
+}
+
+// NewXLSXWriter creates an empty workbook
+func NewXLSXWriter() *XLSXWriter {
+	return &XLSXWriter{}
+}
+
+// AddSheet appends a sheet. Cells may be strings, numbers, bools, times or
+// nil; times are written as RFC3339 text.
+func (w *XLSXWriter) AddSheet(name string, headers []string, rows [][]interface{}) {
+	w.sheets = append(w.sheets, xlsxSheet{
+		name:    xlsxSheetName(name, len(w.sheets)+1),
+		headers: headers,
+		rows:    rows,
+	})
+}
+
+// Bytes returns the encoded workbook
+func (w *XLSXWriter) Bytes() ([]byte, error) {
+	if len(w.sheets) == 0 {
+		w.AddSheet("Sheet1", nil, nil)
+	}
+
+	var out bytes.Buffer
+	archive := zip.NewWriter(&out)
+	writeFile := func(name, content string) error {
+		file, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = file.Write([]byte(xml.Header + content))
+		return err
+	}
+
+	var overrides, sheets, relationships strings.Builder
+	for i := range w.sheets {
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(w.sheets[i].name), i+1, i+1)
+		fmt.Fprintf(&relationships, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	fmt.Fprintf(&relationships, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(w.sheets)+1)
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			overrides.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			relationships.String() + `</Relationships>`},
+		// Style 0 is the default, style 1 bold for header rows
+		{"xl/styles.xml", `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+			`</styleSheet>`},
+	}
+	for i, sheet := range w.sheets {
+		files = append(files, struct {
+			name    string
+			content string
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sheet.xml()})
+	}
+
+	for _, file := range files {
+		if err := writeFile(file.name, file.content); err != nil {
+			return nil, fmt.Errorf("failed to write workbook: %w", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write workbook: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+func (s xlsxSheet) xml() string {
+	var b strings.Builder
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	row := 0
+	if len(s.headers) > 0 {
+		row++
+		fmt.Fprintf(&b, `<row r="%d">`, row)
+		for col, header := range s.headers {
+			fmt.Fprintf(&b, `<c r="%s%d" t="inlineStr" s="1"><is><t>%s</t></is></c>`, xlsxColumn(col), row, xlsxEscape(header))
+		}
+		b.WriteString(`</row>`)
+	}
+	for _, values := range s.rows {
+		row++
+		fmt.Fprintf(&b, `<row r="%d">`, row)
+		for col, value := range values {
+			ref := fmt.Sprintf("%s%d", xlsxColumn(col), row)
+			switch v := value.(type) {
+			case nil:
+				continue
+			case int, int64, uint, uint64:
+				fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+			case float64:
+				fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+			case bool:
+				flag := 0
+				if v {
+					flag = 1
+				}
+				fmt.Fprintf(&b, `<c r="%s" t="b"><v>%d</v></c>`, ref, flag)
+			default:
+				text := formatReportValue(value)
+				if text == "" {
+					continue
+				}
+				fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, xlsxEscape(text))
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+// xlsxColumn returns the column letters of a zero based column index
+func xlsxColumn(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// xlsxSheetName removes the characters sheet names can't contain and
+// shortens the name to the allowed length
+func xlsxSheetName(name string, position int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return ' '
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if runes := []rune(name); len(runes) > maxXLSXSheetName {
+		name = string(runes[:maxXLSXSheetName])
+	}
+	if name == "" {
+		name = fmt.Sprintf("Sheet%d", position)
+	}
+	return name
+}
+
+// xlsxEscape escapes text for XML content, replacing characters XML can't contain
+func xlsxEscape(text string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
@@ -17,7 +17,7 @@ type TrackingScenarioTestSuite struct {
 }
 
 func (suite *TrackingScenarioTestSuite) SetupTest() {
-	suite.trackingService = services.NewTrackingService()
+	suite.trackingService = services.NewTrackingService(nil)
 }
 
 // Test complete trip tracking scenario
@@ -326,7 +326,7 @@ func TestTrackingScenarios(t *testing.T) {
 
 // Performance test for high-frequency updates
 func TestHighFrequencyUpdates(t *testing.T) {
-	trackingService := services.NewTrackingService()
+	trackingService := services.NewTrackingService(nil)
 	tripID := uint(1)
 
 	// Simulate high-frequency location updates